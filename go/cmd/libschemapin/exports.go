@@ -0,0 +1,44 @@
+package main
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/capi"
+)
+
+// goString converts a C argument; NULL is the empty string.
+func goString(s *C.char) string {
+	if s == nil {
+		return ""
+	}
+	return C.GoString(s)
+}
+
+//export schemapin_verify_schema
+func schemapin_verify_schema(schemaJSON, signature, domain, wellKnownJSON, optionsJSON *C.char) *C.char {
+	return C.CString(capi.VerifySchema(goString(schemaJSON), goString(signature), goString(domain), goString(wellKnownJSON), goString(optionsJSON)))
+}
+
+//export schemapin_verify_skill_dir
+func schemapin_verify_skill_dir(path, domain, wellKnownJSON, optionsJSON *C.char) *C.char {
+	return C.CString(capi.VerifySkillDir(goString(path), goString(domain), goString(wellKnownJSON), goString(optionsJSON)))
+}
+
+//export schemapin_canonical_hash
+func schemapin_canonical_hash(schemaJSON *C.char) *C.char {
+	hash, err := capi.CanonicalHash(goString(schemaJSON))
+	if err != nil {
+		return nil
+	}
+	return C.CString(hash)
+}
+
+//export schemapin_free
+func schemapin_free(s *C.char) {
+	C.free(unsafe.Pointer(s))
+}
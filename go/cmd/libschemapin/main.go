@@ -0,0 +1,14 @@
+// Package main builds libschemapin, SchemaPin schema and skill verification
+// as a C shared library:
+//
+//	go build -buildmode=c-shared -o libschemapin.so ./cmd/libschemapin
+//
+// The C ABI is declared in schemapin.h and implemented by pkg/capi. All
+// arguments are NUL-terminated UTF-8 strings; every non-NULL string the
+// library returns is owned by the caller and must be released with
+// schemapin_free. There are no callbacks and no global state, so the
+// functions may be called from any thread.
+package main
+
+// main is required for -buildmode=c-shared and never runs.
+func main() {}
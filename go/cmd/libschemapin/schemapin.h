@@ -0,0 +1,75 @@
+/*
+ * libschemapin: SchemaPin schema and skill verification for C.
+ *
+ * Build the library with
+ *
+ *     go build -buildmode=c-shared -o libschemapin.so ./cmd/libschemapin
+ *
+ * and link with -lschemapin. This header is the stable ABI; the header
+ * written next to the library by the Go toolchain is not.
+ *
+ * All arguments are NUL-terminated UTF-8 strings; NULL is treated as the
+ * empty string. Every non-NULL string returned is allocated by the library
+ * and must be released with schemapin_free. The functions keep no state
+ * between calls and may be called from any thread.
+ */
+#ifndef SCHEMAPIN_H
+#define SCHEMAPIN_H
+
+#ifdef __cplusplus
+extern "C" {
+#endif
+
+/*
+ * Verifies the base64 signature over schema_json, a JSON schema object,
+ * against well_known_json, the .well-known/schemapin.json document of
+ * domain. options_json is a JSON object of options, or "" / NULL for the
+ * defaults:
+ *
+ *   tool_id           tool identifier for key pinning (default: domain)
+ *   canonicalization  the signature's canonicalization (default: schemapin-v1)
+ *   policy            a verification policy document
+ *   revocation        a revocation document for domain
+ *   pinned_keys       object mapping "tool_id@domain" to a key fingerprint
+ *
+ * Returns the verification result as a JSON object. Its "valid" member is
+ * true on success; otherwise "error_code" holds a SchemaPin verification
+ * error code (e.g. "signature_invalid", "discovery_invalid",
+ * "key_revoked", or "invalid_argument" for malformed options) and
+ * "error_message" describes it. Never returns NULL unless out of memory.
+ */
+char *schemapin_verify_schema(const char *schema_json, const char *signature,
+                              const char *domain, const char *well_known_json,
+                              const char *options_json);
+
+/*
+ * Verifies the signed skill directory at path against well_known_json, the
+ * .well-known/schemapin.json document of domain. A skill signed for
+ * another domain fails with "domain_mismatch"; an empty domain accepts the
+ * signature's own. options_json takes the options of
+ * schemapin_verify_schema (tool_id defaults to the signed skill name) and
+ * also:
+ *
+ *   allow_new_mutable_files  accept new files matching mutable paths
+ *   strict_permissions       fail when a signed executable bit changed
+ *
+ * Returns the verification result JSON, as schemapin_verify_schema does.
+ */
+char *schemapin_verify_skill_dir(const char *path, const char *domain,
+                                 const char *well_known_json,
+                                 const char *options_json);
+
+/*
+ * Returns the lowercase hex SHA-256 of the schemapin-v1 canonical form of
+ * schema_json, a JSON schema object, or NULL if it is not one.
+ */
+char *schemapin_canonical_hash(const char *schema_json);
+
+/* Releases a string returned by the library. NULL is ignored. */
+void schemapin_free(char *s);
+
+#ifdef __cplusplus
+}
+#endif
+
+#endif /* SCHEMAPIN_H */
@@ -0,0 +1,102 @@
+// Package main provides the schemapin-conformance CLI tool for running the
+// declarative conformance corpus against the Go verifier.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ThirdKeyAi/schemapin/go/internal/version"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/conformance"
+)
+
+var (
+	corpusDir  string
+	runPattern string
+	jsonOutput bool
+)
+
+func main() {
+	var rootCmd = &cobra.Command{
+		Use:   "schemapin-conformance",
+		Short: "Run the SchemaPin conformance corpus against the Go verifier",
+		Long: `Run a directory of declarative conformance cases against the Go
+verifier and report which pass. Cases cover canonicalization, offline schema
+verification and offline skill verification; the format is described in
+pkg/conformance/testdata/corpus/README.md.
+
+Exits 1 if any case fails.`,
+		Example: `  schemapin-conformance --corpus pkg/conformance/testdata/corpus
+  schemapin-conformance --corpus ./corpus --run '^canonicalize/'
+  schemapin-conformance --corpus ./corpus --json > report.json`,
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE:         runConformance,
+	}
+
+	rootCmd.Flags().StringVar(&corpusDir, "corpus", "", "Directory of conformance cases (required)")
+	rootCmd.Flags().StringVar(&runPattern, "run", "", "Run only cases whose ID matches this regular expression")
+	rootCmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the report as JSON")
+	_ = rootCmd.MarkFlagRequired("corpus")
+
+	rootCmd.Version = version.GetVersion()
+
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+func runConformance(cmd *cobra.Command, args []string) error {
+	cases, err := conformance.LoadCases(corpusDir)
+	if err != nil {
+		return err
+	}
+	if runPattern != "" {
+		pattern, err := regexp.Compile(runPattern)
+		if err != nil {
+			return fmt.Errorf("invalid --run pattern: %w", err)
+		}
+		selected := cases[:0]
+		for _, c := range cases {
+			if pattern.MatchString(c.ID) {
+				selected = append(selected, c)
+			}
+		}
+		cases = selected
+	}
+	if len(cases) == 0 {
+		return fmt.Errorf("no conformance cases found in %s", corpusDir)
+	}
+
+	report := conformance.Run("schemapin-go "+version.GetVersion(), cases)
+	if jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		printReport(report)
+	}
+
+	if report.Failed > 0 {
+		os.Exit(1)
+	}
+	return nil
+}
+
+func printReport(report *conformance.Report) {
+	for _, result := range report.Results {
+		if result.Passed {
+			fmt.Printf("PASS %s\n", result.ID)
+		} else {
+			fmt.Printf("FAIL %s: %s\n", result.ID, result.Message)
+		}
+	}
+	fmt.Printf("\n%d cases: %d passed, %d failed\n", report.Total, report.Passed, report.Failed)
+}
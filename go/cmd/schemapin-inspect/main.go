@@ -0,0 +1,88 @@
+// Package main provides the schemapin-inspect CLI tool for decoding and
+// describing SchemaPin artifacts.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ThirdKeyAi/schemapin/go/internal/version"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/inspect"
+)
+
+var (
+	jsonOutput bool
+	resolve    bool
+	domain     string
+	toolID     string
+	timeout    time.Duration
+)
+
+func main() {
+	var rootCmd = &cobra.Command{
+		Use:   "schemapin-inspect <file-or-dir>",
+		Short: "Decode and describe a SchemaPin artifact",
+		Long: `Detect what a SchemaPin artifact is and describe it: a signed schema, a
+detached signature, a skill directory or its .schemapin.sig, a
+.well-known/schemapin.json discovery document, a revocation document, a
+trust bundle or a pin export.
+
+The report shows the artifact's format version, the hash its signature binds
+to (recomputed where possible and compared with any hash it records), its
+signatures and keys, its timestamps with their ages, its notable fields and
+any problems found by the validators of its type.
+
+Nothing is fetched unless --resolve is given, which checks the signature
+against the key the signing domain publishes. Signed schemas do not record
+their domain: give it with --domain, or in a "domain" metadata value.
+
+Exits 1 if the input is not a recognized artifact.`,
+		Example: `  schemapin-inspect weather.signed.json
+  schemapin-inspect ./skills/forecast
+  schemapin-inspect --resolve --domain example.com weather.signed.json
+  schemapin-inspect --json trust-bundle.json`,
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE:         runInspect,
+	}
+
+	rootCmd.Flags().BoolVar(&jsonOutput, "json", false, "Print the report as JSON")
+	rootCmd.Flags().BoolVar(&resolve, "resolve", false, "Fetch the signing domain's .well-known document and check the signature against its key")
+	rootCmd.Flags().StringVar(&domain, "domain", "", "Domain of a signed schema or discovery document, which they do not record")
+	rootCmd.Flags().StringVar(&toolID, "tool-id", "", "Tool ID selecting a tool-scoped key with --resolve")
+	rootCmd.Flags().DurationVar(&timeout, "timeout", 10*time.Second, "Time allowed for discovery with --resolve")
+
+	rootCmd.Version = version.GetVersion()
+
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+func runInspect(cmd *cobra.Command, args []string) error {
+	opts := inspect.Options{Domain: domain, ToolID: toolID}
+	ctx := context.Background()
+	if resolve {
+		opts.Discoverer = discovery.NewPublicKeyDiscoveryWithTimeout(timeout)
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	report, err := inspect.Inspect(ctx, args[0], opts)
+	if err != nil {
+		return err
+	}
+	if jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetEscapeHTML(false)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	return report.WriteText(os.Stdout)
+}
@@ -2,6 +2,7 @@
 package main
 
 import (
+	"crypto/ecdsa"
 	"encoding/json"
 	"fmt"
 	"os"
@@ -9,6 +10,7 @@ import (
 
 	"github.com/spf13/cobra"
 
+	"github.com/ThirdKeyAi/schemapin/go/internal/passphrase"
 	"github.com/ThirdKeyAi/schemapin/go/internal/version"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
@@ -23,10 +25,20 @@ var (
 	developer     string
 	contact       string
 	schemaVersion string
+	revocationURL string
 	wellKnown     bool
 	verbose       bool
 	quiet         bool
 	jsonOutput    bool
+
+	seed                  string
+	insecureDeterministic bool
+
+	encrypt        bool
+	passphraseFile string
+	passphraseEnv  string
+
+	selfTest bool
 )
 
 func main() {
@@ -39,7 +51,10 @@ This tool generates cryptographic key pairs and optionally creates .well-known
 templates for public key discovery.`,
 		Example: `  schemapin-keygen --type ecdsa --output-dir ./keys --developer "Alice Corp"
   schemapin-keygen --type rsa --key-size 4096 --format der --output-dir ./keys
-  schemapin-keygen --type ecdsa --well-known --developer "Bob Inc" --contact "security@bob.com"`,
+  schemapin-keygen --type ecdsa --well-known --developer "Bob Inc" --contact "security@bob.com"
+  schemapin-keygen --well-known --developer "Bob Inc" --revocation-url https://bob.example/.well-known/schemapin-revocations.json
+  schemapin-keygen --insecure-deterministic --seed fixture-1 --output-dir ./testdata
+  schemapin-keygen --encrypt --output-dir ./keys`,
 		RunE: runKeygen,
 	}
 
@@ -50,11 +65,19 @@ templates for public key discovery.`,
 	rootCmd.Flags().StringVar(&prefix, "prefix", "schemapin", "Filename prefix for generated keys")
 	rootCmd.Flags().StringVar(&developer, "developer", "", "Developer or organization name for .well-known template")
 	rootCmd.Flags().StringVar(&contact, "contact", "", "Contact information for .well-known template")
-	rootCmd.Flags().StringVar(&schemaVersion, "schema-version", "1.1", "Schema version for .well-known template")
+	rootCmd.Flags().StringVar(&schemaVersion, "schema-version", discovery.LatestWellKnownVersion, "Schema version for .well-known template (1.1, 1.2 or 1.3)")
+	rootCmd.Flags().StringVar(&revocationURL, "revocation-url", "", "Revocation document URL for .well-known template (schema version 1.2 or later)")
 	rootCmd.Flags().BoolVar(&wellKnown, "well-known", false, "Generate .well-known/schemapin.json template")
 	rootCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Verbose output")
 	rootCmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "Quiet output (only errors)")
 	rootCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output results as JSON")
+	rootCmd.Flags().StringVar(&seed, "seed", "", "Derive the key from this seed (requires --insecure-deterministic; test fixtures only)")
+	rootCmd.Flags().BoolVar(&insecureDeterministic, "insecure-deterministic", false, "Allow --seed: the key is only as secret as the seed, never use it in production")
+	rootCmd.Flags().BoolVar(&encrypt, "encrypt", false, "Encrypt the private key with a passphrase (prompted for unless --passphrase-file or --passphrase-env is given)")
+	rootCmd.Flags().StringVar(&passphraseFile, "passphrase-file", "", "File whose first line is the passphrase to encrypt the private key with (implies --encrypt)")
+	rootCmd.Flags().StringVar(&passphraseEnv, "passphrase-env", "", "Environment variable holding the passphrase to encrypt the private key with (implies --encrypt)")
+	rootCmd.MarkFlagsMutuallyExclusive("passphrase-file", "passphrase-env")
+	rootCmd.Flags().BoolVar(&selfTest, "self-test", false, "Check the crypto stack (randomness, signing, PEM, canonicalization and a known test vector) before generating keys")
 
 	rootCmd.Version = version.GetVersion()
 
@@ -64,10 +87,19 @@ templates for public key discovery.`,
 }
 
 func runKeygen(cmd *cobra.Command, args []string) error {
+	if selfTest {
+		if err := crypto.SelfTest(); err != nil {
+			return fmt.Errorf("crypto self-test failed: %w", err)
+		}
+	}
+
 	// Validate arguments
 	if wellKnown && developer == "" {
 		return fmt.Errorf("--developer is required when generating .well-known template")
 	}
+	if revocationURL != "" && !wellKnown {
+		return fmt.Errorf("--revocation-url requires --well-known")
+	}
 
 	if quiet && verbose {
 		return fmt.Errorf("--quiet and --verbose are mutually exclusive")
@@ -81,6 +113,13 @@ func runKeygen(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("invalid format: %s (must be pem or der)", format)
 	}
 
+	if seed != "" && !insecureDeterministic {
+		return fmt.Errorf("--seed requires --insecure-deterministic")
+	}
+	if seed != "" && keyType != "ecdsa" {
+		return fmt.Errorf("--seed is only supported for ecdsa keys")
+	}
+
 	if keyType == "rsa" && keySize != 2048 && keySize != 3072 && keySize != 4096 {
 		return fmt.Errorf("invalid RSA key size: %d (must be 2048, 3072, or 4096)", keySize)
 	}
@@ -95,12 +134,19 @@ func runKeygen(cmd *cobra.Command, args []string) error {
 
 	if keyType == "ecdsa" {
 		keyManager := crypto.NewKeyManager()
-		privateKey, err := keyManager.GenerateKeypair()
+		var privateKey *ecdsa.PrivateKey
+		var err error
+		if seed != "" {
+			fmt.Fprintln(os.Stderr, "WARNING: generating a deterministic key from --seed; anyone who knows the seed can sign as this key. Use for test fixtures only.")
+			privateKey, err = keyManager.GenerateKeypairFromSeed([]byte(seed), crypto.ForTesting)
+		} else {
+			privateKey, err = keyManager.GenerateKeypair()
+		}
 		if err != nil {
 			return fmt.Errorf("failed to generate ECDSA key pair: %w", err)
 		}
 
-		privateKeyPEM, err = keyManager.ExportPrivateKeyPEM(privateKey)
+		privateKeyPEM, err = exportPrivateKey(keyManager, privateKey)
 		if err != nil {
 			return fmt.Errorf("failed to export private key: %w", err)
 		}
@@ -125,6 +171,23 @@ func runKeygen(cmd *cobra.Command, args []string) error {
 	}
 	ext := ".pem"
 
+	// Build the .well-known template before writing anything, so that an
+	// inconsistent one leaves no keys behind
+	var wellKnownJSON []byte
+	if wellKnown {
+		builder := discovery.NewWellKnownBuilder(developer).
+			SetSchemaVersion(schemaVersion).
+			SetPrimaryKey(publicKeyPEM).
+			SetContact(contact)
+		if revocationURL != "" {
+			builder.SetRevocationURL(revocationURL)
+		}
+		var err error
+		if wellKnownJSON, err = builder.JSON(); err != nil {
+			return fmt.Errorf("invalid .well-known template: %w", err)
+		}
+	}
+
 	privateKeyFile := filepath.Join(outputDir, fmt.Sprintf("%s_private%s", prefix, ext))
 	publicKeyFile := filepath.Join(outputDir, fmt.Sprintf("%s_public%s", prefix, ext))
 
@@ -140,18 +203,6 @@ func runKeygen(cmd *cobra.Command, args []string) error {
 	// Generate .well-known template if requested
 	var wellKnownFile string
 	if wellKnown {
-		wellKnownData := &discovery.WellKnownResponse{
-			SchemaVersion: schemaVersion,
-			DeveloperName: developer,
-			PublicKeyPEM:  publicKeyPEM,
-			Contact:       contact,
-		}
-
-		wellKnownJSON, err := json.MarshalIndent(wellKnownData, "", "  ")
-		if err != nil {
-			return fmt.Errorf("failed to marshal .well-known data: %w", err)
-		}
-
 		wellKnownFile = filepath.Join(outputDir, "schemapin.json")
 		if err := os.WriteFile(wellKnownFile, wellKnownJSON, 0644); err != nil {
 			return fmt.Errorf("failed to write .well-known file: %w", err)
@@ -167,6 +218,10 @@ func runKeygen(cmd *cobra.Command, args []string) error {
 		"private_key_file": privateKeyFile,
 		"public_key_file":  publicKeyFile,
 	}
+	privateKeyEncrypted := crypto.IsEncryptedPrivateKeyPEM(privateKeyPEM)
+	if privateKeyEncrypted {
+		result["private_key_encrypted"] = true
+	}
 
 	if wellKnownFile != "" {
 		result["well_known_file"] = wellKnownFile
@@ -186,7 +241,11 @@ func runKeygen(cmd *cobra.Command, args []string) error {
 		}
 		fmt.Printf("  Format: %s\n", format)
 		fmt.Printf("  Fingerprint: %s\n", fingerprint)
-		fmt.Printf("  Private key: %s\n", privateKeyFile)
+		if privateKeyEncrypted {
+			fmt.Printf("  Private key: %s (encrypted)\n", privateKeyFile)
+		} else {
+			fmt.Printf("  Private key: %s\n", privateKeyFile)
+		}
 		fmt.Printf("  Public key: %s\n", publicKeyFile)
 		if wellKnownFile != "" {
 			fmt.Printf("  .well-known template: %s\n", wellKnownFile)
@@ -202,3 +261,25 @@ func runKeygen(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+// exportPrivateKey exports privateKey as PEM, encrypted when --encrypt,
+// --passphrase-file or --passphrase-env is given.
+func exportPrivateKey(keyManager *crypto.KeyManager, privateKey *ecdsa.PrivateKey) (string, error) {
+	source := passphrase.Source{File: passphraseFile, Env: passphraseEnv}
+	if !encrypt && !source.Given() {
+		return keyManager.ExportPrivateKeyPEM(privateKey)
+	}
+
+	var secret []byte
+	var err error
+	if source.Given() {
+		secret, err = source.Read()
+	} else {
+		secret, err = passphrase.PromptNew("Passphrase for the new private key: ")
+	}
+	if err != nil {
+		return "", err
+	}
+	defer clear(secret)
+	return keyManager.ExportPrivateKeyPEMEncrypted(privateKey, secret)
+}
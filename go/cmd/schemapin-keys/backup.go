@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/truststate"
+)
+
+var (
+	backupOutput      string
+	backupPinStores   []string
+	backupJSONOutput  bool
+	restoreInput      string
+	restoreMerge      bool
+	restoreReplace    bool
+	restorePinStores  []string
+	restoreDryRun     bool
+	restoreJSONOutput bool
+)
+
+func newBackupCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "backup",
+		Short: "Write the complete trust state to a single archive",
+		Long: `Write the complete trust state to a single archive, to move it to another
+machine or keep it as a backup: every pin and namespace pin, domain
+policy, rejection and recorded discovery version, the cached discovery
+and revocation documents, and the pin store files named with --pin-store.
+
+The archive is a .tar.gz holding a manifest with the format version and
+SHA-256 hash of every component. The database is exported in its JSON
+formats rather than copied, so "schemapin-keys restore" of another version
+can read it. The export is plaintext, also from an encrypted database.`,
+		Args: cobra.NoArgs,
+		RunE: runBackup,
+	}
+
+	cmd.Flags().StringVar(&backupOutput, "out", "", "Write the archive to this file (required)")
+	cmd.Flags().StringArrayVar(&backupPinStores, "pin-store", nil, "Include this pin store file (repeatable)")
+	cmd.Flags().BoolVar(&backupJSONOutput, "json", false, "Output the manifest as JSON")
+	_ = cmd.MarkFlagRequired("out")
+
+	return cmd
+}
+
+func newRestoreCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "restore",
+		Short: "Restore the trust state from a backup archive",
+		Long: `Restore the trust state from an archive written by "schemapin-keys backup"
+and print a report for each component.
+
+The whole archive is checked before anything is written: its manifest,
+and the format version and hash of every component. Each component is
+then applied through the same import used by "schemapin-keys import".
+
+With --merge, the default, what the database lacks is added; pins and
+domain policies that differ from the archive are kept and reported as
+conflicts. With --replace, pins, domain policies and rejections become
+those of the archive, and any the archive lacks are removed. Pin stores
+are restored to the --pin-store files of the same name.`,
+		Args: cobra.NoArgs,
+		RunE: runRestore,
+	}
+
+	cmd.Flags().StringVar(&restoreInput, "in", "", "Archive to restore (required)")
+	cmd.Flags().BoolVar(&restoreMerge, "merge", false, "Add what the database lacks, keeping conflicting entries (default)")
+	cmd.Flags().BoolVar(&restoreReplace, "replace", false, "Make the trust state that of the archive")
+	cmd.MarkFlagsMutuallyExclusive("merge", "replace")
+	cmd.Flags().StringArrayVar(&restorePinStores, "pin-store", nil, "Restore the archived pin store of the same file name to this file (repeatable)")
+	cmd.Flags().BoolVar(&restoreDryRun, "dry-run", false, "Check the archive and report what would be restored without writing")
+	cmd.Flags().BoolVar(&restoreJSONOutput, "json", false, "Output the report as JSON")
+	_ = cmd.MarkFlagRequired("in")
+
+	return cmd
+}
+
+func runBackup(cmd *cobra.Command, args []string) error {
+	if _, err := os.Stat(pinningDB); err != nil {
+		return fmt.Errorf("pinning database %s: %w", pinningDB, err)
+	}
+	keyPinning, err := openPinningDB()
+	if err != nil {
+		return fmt.Errorf("failed to open pinning database: %w", err)
+	}
+	defer keyPinning.Close()
+
+	var buf bytes.Buffer
+	manifest, err := truststate.Backup(keyPinning, &buf, truststate.BackupOptions{PinStoreFiles: backupPinStores})
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(backupOutput, buf.Bytes(), 0600); err != nil {
+		return fmt.Errorf("failed to write archive: %w", err)
+	}
+
+	if backupJSONOutput {
+		return printJSON(manifest)
+	}
+	for _, c := range manifest.Components {
+		fmt.Printf("  %-28s %6d entries  %s\n", c.Path, c.Entries, c.SHA256)
+	}
+	fmt.Printf("\nWrote %d components to %s\n", len(manifest.Components), backupOutput)
+	return nil
+}
+
+func runRestore(cmd *cobra.Command, args []string) error {
+	file, err := os.Open(restoreInput)
+	if err != nil {
+		return fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer file.Close()
+
+	keyPinning, err := openPinningDB()
+	if err != nil {
+		return fmt.Errorf("failed to open pinning database: %w", err)
+	}
+	defer keyPinning.Close()
+
+	mode := truststate.ModeMerge
+	if restoreReplace {
+		mode = truststate.ModeReplace
+	}
+	report, err := truststate.Restore(keyPinning, file, truststate.RestoreOptions{
+		Mode:          mode,
+		DryRun:        restoreDryRun,
+		Source:        restoreInput,
+		PinStoreFiles: restorePinStores,
+	})
+	if report != nil {
+		if restoreJSONOutput {
+			if err := printJSON(report); err != nil {
+				return err
+			}
+		} else {
+			displayRestoreReport(report)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	if report.HasErrors() {
+		return fmt.Errorf("entries rejected while restoring %s", restoreInput)
+	}
+	return nil
+}
+
+func displayRestoreReport(report *truststate.RestoreReport) {
+	verb := "restored"
+	if report.DryRun {
+		verb = "would restore"
+	}
+	for _, c := range report.Components {
+		if c.Note != "" {
+			fmt.Printf("   %s: %s\n", c.Path, c.Note)
+			continue
+		}
+		status := "✅"
+		if len(c.Errors) > 0 {
+			status = "❌"
+		} else if len(c.Conflicts) > 0 {
+			status = "⚠️ "
+		}
+		fmt.Printf("%s %s: %s %d, skipped %d", status, c.Path, verb, c.Imported, c.Skipped)
+		if report.Mode == truststate.ModeReplace {
+			fmt.Printf(", removed %d", c.Removed)
+		}
+		fmt.Println()
+		for _, conflict := range c.Conflicts {
+			fmt.Printf("     conflict: %s (kept, use --replace to replace it)\n", conflict)
+		}
+		for _, issue := range c.Errors {
+			fmt.Printf("     rejected %s\n", issue)
+		}
+	}
+
+	summary := "Restored"
+	if report.DryRun {
+		summary = "Checked"
+	}
+	fmt.Printf("\n%s %d components in %s mode\n", summary, len(report.Components), report.Mode)
+	if report.DryRun {
+		fmt.Println("Dry run: the pinning database and pin stores were not changed")
+	}
+}
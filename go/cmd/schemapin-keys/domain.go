@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/pinning"
+)
+
+var showDomainJSONOutput bool
+
+func newShowDomainCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "show-domain DOMAIN",
+		Short: "Show everything recorded about a developer domain",
+		Long: `Show everything the pinning database records about a domain in one
+report: the keys pinned for its tools with their provenance and last
+verification, the domain policy, the last .well-known document fetched
+with the keys and revocations it publishes, cached revocation documents,
+and the keys rejected for its tools.
+
+Documents are cached as the verification workflow and schemapin-server
+fetch them, so a domain never verified through discovery has none.`,
+		Example: `  schemapin-keys show-domain example.com
+  schemapin-keys show-domain example.com --json`,
+		Args: cobra.ExactArgs(1),
+		RunE: runShowDomain,
+	}
+
+	cmd.Flags().BoolVar(&showDomainJSONOutput, "json", false, "Output the report as JSON")
+
+	return cmd
+}
+
+func runShowDomain(cmd *cobra.Command, args []string) error {
+	if _, err := os.Stat(pinningDB); err != nil {
+		return fmt.Errorf("pinning database %s: %w", pinningDB, err)
+	}
+	keyPinning, err := openPinningDB()
+	if err != nil {
+		return fmt.Errorf("failed to open pinning database: %w", err)
+	}
+	defer keyPinning.Close()
+
+	report, err := keyPinning.QueryByDomain(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to query domain: %w", err)
+	}
+
+	if showDomainJSONOutput {
+		outputJSON, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal domain report: %w", err)
+		}
+		fmt.Println(string(outputJSON))
+		return nil
+	}
+
+	displayDomainReport(report)
+	return nil
+}
+
+func displayDomainReport(report *pinning.DomainReport) {
+	fmt.Printf("Domain: %s\n", report.Domain)
+	if report.Policy != nil {
+		fmt.Printf("Policy: %s (set %s)\n", report.Policy.Policy, clock.Format(report.Policy.CreatedAt))
+	} else {
+		fmt.Printf("Policy: %s\n", pinning.PinningPolicyDefault)
+	}
+	if report.DiscoveryVersion != nil {
+		fmt.Printf("Highest discovery version: %s (seen %s)\n",
+			report.DiscoveryVersion.SchemaVersion, clock.Format(report.DiscoveryVersion.SeenAt))
+	}
+
+	fmt.Println("\nPinned keys:")
+	if len(report.PinnedKeys) == 0 {
+		fmt.Println("  none")
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "  TOOL ID\tFINGERPRINT\tPROVENANCE\tLAST VERIFIED")
+		for _, key := range report.PinnedKeys {
+			lastVerified := "never"
+			if !key.LastVerified.IsZero() {
+				lastVerified = clock.Format(key.LastVerified)
+			}
+			fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", key.ToolID, key.Fingerprint, key.Provenance, lastVerified)
+		}
+		_ = w.Flush()
+	}
+
+	fmt.Println("\nDiscovery document:")
+	if report.Discovery == nil || report.Discovery.Document == nil {
+		fmt.Println("  none cached")
+	} else {
+		doc := report.Discovery.Document
+		fmt.Printf("  Fetched %s from %s\n", clock.Format(report.Discovery.FetchedAt), report.Discovery.SourceURL)
+		fmt.Printf("  Schema version: %s\n", doc.SchemaVersion)
+		if doc.DeveloperName != "" {
+			fmt.Printf("  Developer: %s\n", doc.DeveloperName)
+		}
+		for _, key := range report.PublishedKeys {
+			scope := "domain"
+			if key.Scope != "" {
+				scope = "tools " + key.Scope
+			}
+			revoked := ""
+			if key.Revoked {
+				revoked = " (revoked)"
+			}
+			fmt.Printf("  Key (%s): %s%s\n", scope, key.Fingerprint, revoked)
+		}
+		for _, revoked := range doc.RevokedKeys {
+			fmt.Printf("  Revoked: %s\n", revoked)
+		}
+		if doc.RevocationEndpoint != "" {
+			fmt.Printf("  Revocation endpoint: %s\n", doc.RevocationEndpoint)
+		}
+	}
+
+	fmt.Println("\nRevocation documents:")
+	if len(report.Revocations) == 0 {
+		fmt.Println("  none cached")
+	}
+	for _, cached := range report.Revocations {
+		doc := cached.Document
+		fmt.Printf("  %s (updated %s, %d keys, %d signatures revoked)\n",
+			cached.URL, doc.UpdatedAt, len(doc.RevokedKeys), len(doc.RevokedSignatures))
+		for _, revoked := range doc.RevokedKeys {
+			fmt.Printf("    %s revoked %s: %s\n", revoked.Fingerprint, revoked.RevokedAt, revoked.Reason)
+		}
+	}
+
+	fmt.Println("\nRejected keys:")
+	if len(report.Rejections) == 0 {
+		fmt.Println("  none")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  TOOL ID\tFINGERPRINT\tREASON\tREJECTED")
+	for _, rejected := range report.Rejections {
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", rejected.ToolID, rejected.Fingerprint, rejected.Reason, clock.Format(rejected.RejectedAt))
+	}
+	_ = w.Flush()
+}
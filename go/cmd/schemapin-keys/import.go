@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/pinning"
+)
+
+var (
+	importRejected   bool
+	importOverwrite  []string
+	importDryRun     bool
+	importJSONOutput bool
+)
+
+func newImportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "import FILE",
+		Short: "Import pinned keys from an export file",
+		Long: `Import pinned keys from a file written by ExportPinnedKeys and print a
+report of what was imported, skipped, in conflict or rejected.
+
+Every entry is validated before anything is written: keys must parse, any
+fingerprint must match its key, and fields must be within size limits.
+A tool already pinned to a different key is reported as a conflict and
+left alone unless named with --overwrite. --dry-run prints the report
+without changing the database.
+
+With --rejected, FILE holds rejected keys as written by
+"schemapin-keys list --rejected --json", and they are recorded as rejected
+in the database. Rejections already recorded are skipped.`,
+		Args: cobra.ExactArgs(1),
+		RunE: runImport,
+	}
+
+	cmd.Flags().BoolVar(&importRejected, "rejected", false, "Import rejected keys instead of pins")
+	cmd.Flags().StringArrayVar(&importOverwrite, "overwrite", nil, "Replace the existing pin of this tool ID on conflict (repeatable)")
+	cmd.MarkFlagsMutuallyExclusive("rejected", "overwrite")
+	cmd.Flags().BoolVar(&importDryRun, "dry-run", false, "Report what would be imported without writing")
+	cmd.Flags().BoolVar(&importJSONOutput, "json", false, "Output the report as JSON")
+
+	return cmd
+}
+
+func runImport(cmd *cobra.Command, args []string) error {
+	path := args[0]
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open import file: %w", err)
+	}
+	defer file.Close()
+
+	// Read one byte past the limit so oversized files are rejected by
+	// ImportPinnedKeys without being read in full.
+	maxBytes := int64(pinning.DefaultImportLimits.MaxBytes)
+	data, err := io.ReadAll(io.LimitReader(file, maxBytes+1))
+	if err != nil {
+		return fmt.Errorf("failed to read import file: %w", err)
+	}
+
+	keyPinning, err := openPinningDB()
+	if err != nil {
+		return fmt.Errorf("failed to open pinning database: %w", err)
+	}
+	defer keyPinning.Close()
+
+	importKeys := keyPinning.ImportPinnedKeys
+	if importRejected {
+		importKeys = keyPinning.ImportRejectedKeys
+	}
+	report, err := importKeys(string(data), pinning.ImportOptions{
+		Overwrite: importOverwrite,
+		Source:    path,
+		DryRun:    importDryRun,
+	})
+	if err != nil {
+		return err
+	}
+
+	if importJSONOutput {
+		outputJSON, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal import report: %w", err)
+		}
+		fmt.Println(string(outputJSON))
+	} else {
+		displayImportReport(report)
+	}
+
+	if len(report.Errors) > 0 {
+		return fmt.Errorf("%d entries rejected", len(report.Errors))
+	}
+	return nil
+}
+
+func displayImportReport(report *pinning.ImportReport) {
+	verb := "Imported"
+	if report.DryRun {
+		verb = "Would import"
+	}
+	for _, toolID := range report.Imported {
+		fmt.Printf("✅ %s %s\n", verb, toolID)
+	}
+	for _, conflict := range report.Conflicts {
+		action := "kept existing pin, use --overwrite " + conflict.ToolID + " to replace it"
+		if conflict.Overwritten {
+			action = "overwritten"
+		}
+		fmt.Printf("⚠️  Conflict for %s: pinned %s, file has %s (%s)\n",
+			conflict.ToolID, conflict.ExistingFingerprint, conflict.ImportedFingerprint, action)
+	}
+	for _, issue := range report.Skipped {
+		fmt.Printf("   Skipped entry %d (%s): %s\n", issue.Index, issue.ToolID, issue.Reason)
+	}
+	for _, issue := range report.Warnings {
+		fmt.Printf("⚠️  Entry %d (%s): %s\n", issue.Index, issue.ToolID, issue.Reason)
+	}
+	for _, issue := range report.Errors {
+		fmt.Printf("❌ Rejected entry %d (%s): %s\n", issue.Index, issue.ToolID, issue.Reason)
+	}
+
+	fmt.Printf("\n%s %d, skipped %d, conflicts %d, rejected %d\n",
+		verb, len(report.Imported), len(report.Skipped), len(report.Conflicts), len(report.Errors))
+	if report.DryRun {
+		fmt.Println("Dry run: the pinning database was not changed")
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/pinning"
+)
+
+var (
+	listStale      string
+	listRejected   bool
+	listJSONOutput bool
+)
+
+func newListCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List pinned keys with their verification statistics",
+		Long: `List every pinned key with its domain, provenance and verification counts.
+Namespace pins, which cover every tool ID under a prefix, are listed with a
+trailing "*", e.g. "example.com/payments/*".
+
+With --stale, only pins not successfully verified within the given age are
+listed, oldest first, as candidates for removal. A pin that was never
+verified counts from the time it was pinned. Ages accept Go durations
+("720h") or whole days ("90d").
+
+With --rejected, the keys rejected at a prompt or by a policy are listed
+instead. schemapin-verify fails such a key with key_previously_rejected
+rather than prompting again, unless run with --reconsider. The JSON output
+of --rejected can be imported into another database with
+"schemapin-keys import --rejected".`,
+		RunE: runList,
+	}
+
+	cmd.Flags().StringVar(&listStale, "stale", "", "Only list pins not verified within this age (e.g. 90d)")
+	cmd.Flags().BoolVar(&listRejected, "rejected", false, "List rejected keys instead of pins")
+	cmd.Flags().BoolVar(&listJSONOutput, "json", false, "Output the pins as JSON")
+	cmd.MarkFlagsMutuallyExclusive("stale", "rejected")
+
+	return cmd
+}
+
+func runList(cmd *cobra.Command, args []string) error {
+	if _, err := os.Stat(pinningDB); err != nil {
+		return fmt.Errorf("pinning database %s: %w", pinningDB, err)
+	}
+	keyPinning, err := openPinningDB()
+	if err != nil {
+		return fmt.Errorf("failed to open pinning database: %w", err)
+	}
+	defer keyPinning.Close()
+
+	if listRejected {
+		return listRejectedKeys(keyPinning)
+	}
+
+	var keys []pinning.PinnedKeyInfo
+	if listStale != "" {
+		age, err := parseAge(listStale)
+		if err != nil {
+			return err
+		}
+		if keys, err = keyPinning.FindStalePins(age); err != nil {
+			return fmt.Errorf("failed to find stale pins: %w", err)
+		}
+	} else {
+		if keys, err = keyPinning.ListPinnedKeyInfo(); err != nil {
+			return fmt.Errorf("failed to list pinned keys: %w", err)
+		}
+	}
+
+	if listJSONOutput {
+		if keys == nil {
+			keys = []pinning.PinnedKeyInfo{}
+		}
+		outputJSON, err := json.MarshalIndent(keys, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal pinned keys: %w", err)
+		}
+		fmt.Println(string(outputJSON))
+		return nil
+	}
+
+	displayPins(keys)
+	return nil
+}
+
+// parseAge parses a Go duration or a whole number of days such as "90d".
+func parseAge(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err == nil && n >= 0 {
+			return time.Duration(n) * 24 * time.Hour, nil
+		}
+	}
+	age, err := time.ParseDuration(value)
+	if err != nil || age < 0 {
+		return 0, fmt.Errorf("invalid age %q: expected a duration such as 720h or 90d", value)
+	}
+	return age, nil
+}
+
+func displayPins(keys []pinning.PinnedKeyInfo) {
+	if len(keys) == 0 {
+		fmt.Println("No pinned keys")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TOOL ID\tDOMAIN\tPROVENANCE\tVERIFIED\tOK\tFAILED\tLAST VERIFIED")
+	for _, key := range keys {
+		lastVerified := "never"
+		if !key.LastVerified.IsZero() {
+			lastVerified = clock.Format(key.LastVerified)
+		}
+		toolID := key.ToolID
+		if key.Namespace {
+			toolID += "*"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\t%s\n",
+			toolID, key.Domain, key.Provenance,
+			key.VerificationCount, key.SuccessCount, key.FailureCount, lastVerified)
+	}
+	_ = w.Flush()
+	fmt.Printf("\n%d pinned keys\n", len(keys))
+}
+
+func listRejectedKeys(keyPinning *pinning.KeyPinning) error {
+	if listJSONOutput {
+		exported, err := keyPinning.ExportRejectedKeys()
+		if err != nil {
+			return fmt.Errorf("failed to export rejected keys: %w", err)
+		}
+		fmt.Println(exported)
+		return nil
+	}
+
+	rejections, err := keyPinning.ListRejectedKeys()
+	if err != nil {
+		return fmt.Errorf("failed to list rejected keys: %w", err)
+	}
+	if len(rejections) == 0 {
+		fmt.Println("No rejected keys")
+		return nil
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TOOL ID\tDOMAIN\tFINGERPRINT\tREASON\tREJECTED")
+	for _, rejected := range rejections {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			rejected.ToolID, rejected.Domain, rejected.Fingerprint, rejected.Reason, clock.Format(rejected.RejectedAt))
+	}
+	_ = w.Flush()
+	fmt.Printf("\n%d rejected keys\n", len(rejections))
+	return nil
+}
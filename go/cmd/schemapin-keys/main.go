@@ -0,0 +1,95 @@
+// Package main provides the schemapin-keys CLI tool for inspecting and
+// maintaining the key pinning database.
+package main
+
+import (
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ThirdKeyAi/schemapin/go/internal/version"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/pinning"
+)
+
+var (
+	pinningDB      string
+	storeKeySource string
+)
+
+func main() {
+	var rootCmd = &cobra.Command{
+		Use:   "schemapin-keys",
+		Short: "Inspect and maintain the SchemaPin key pinning database",
+		Long: `Inspect and maintain the key pinning database used by schemapin-verify
+and the verification workflow: list pinned keys with their provenance and
+verification statistics, find stale pins, show everything recorded about
+a developer domain, import pins from an export file, take signed
+snapshots for audits, back up and restore the complete trust state,
+check, compact or repair the database file, and rotate the key it is
+encrypted with.`,
+		Example: `  schemapin-keys list
+  schemapin-keys list --stale 90d
+  schemapin-keys list --pinning-db ./pins.db --json
+  schemapin-keys show-domain example.com
+  schemapin-keys import pins.json --dry-run
+  schemapin-keys snapshot create --key operator.pem -o snapshot.json
+  schemapin-keys snapshot diff old.json new.json --public-key operator.pub
+  schemapin-keys backup --out trust.tar.gz --pin-store pins.json
+  schemapin-keys restore --in trust.tar.gz --replace
+  schemapin-keys maintenance --check
+  schemapin-keys --store-key env:SCHEMAPIN_STORE_KEY maintenance --encrypt
+  schemapin-keys rotate-secret --old-key env:OLD_STORE_KEY --new-key env:NEW_STORE_KEY`,
+		SilenceUsage: true,
+	}
+
+	defaultPinningDB, _ := pinning.DefaultDBPath()
+	rootCmd.PersistentFlags().StringVar(&pinningDB, "pinning-db", defaultPinningDB, "Path to key pinning database")
+	rootCmd.PersistentFlags().StringVar(&storeKeySource, "store-key", "", "Key of an encrypted pinning database: env:NAME, file:PATH or keychain:SERVICE[/ACCOUNT]")
+
+	rootCmd.AddCommand(newListCmd())
+	rootCmd.AddCommand(newShowDomainCmd())
+	rootCmd.AddCommand(newImportCmd())
+	rootCmd.AddCommand(newSnapshotCmd())
+	rootCmd.AddCommand(newBackupCmd())
+	rootCmd.AddCommand(newRestoreCmd())
+	rootCmd.AddCommand(newMaintenanceCmd())
+	rootCmd.AddCommand(newRotateSecretCmd())
+
+	rootCmd.Version = version.GetVersion()
+
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+// openPinningDB opens the database without an interactive handler; the
+// commands only read and maintain pins.
+func openPinningDB() (*pinning.KeyPinning, error) {
+	opts, err := storeKeyOptions()
+	if err != nil {
+		return nil, err
+	}
+	return pinning.NewKeyPinning(pinningDB, pinning.PinningModeAutomatic, nil, opts...)
+}
+
+// storeKeyOptions returns the options opening the database with the key
+// named by --store-key, if any.
+func storeKeyOptions() ([]pinning.Option, error) {
+	if storeKeySource == "" {
+		return nil, nil
+	}
+	key, err := readStoreKey()
+	if err != nil {
+		return nil, err
+	}
+	return []pinning.Option{pinning.WithStoreEncryption(key)}, nil
+}
+
+// readStoreKey reads the key named by --store-key.
+func readStoreKey() ([]byte, error) {
+	provider, err := pinning.ParseStoreKeySource(storeKeySource)
+	if err != nil {
+		return nil, err
+	}
+	return provider.StoreKey()
+}
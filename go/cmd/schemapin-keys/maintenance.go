@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/pinning"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+)
+
+// Exit codes of the maintenance subcommand besides 0 (healthy or done) and
+// 1 (error).
+const (
+	maintenanceExitCorrupt = 2
+	maintenanceExitLost    = 3
+)
+
+var (
+	maintenanceCheck      bool
+	maintenanceVacuum     bool
+	maintenanceRepair     bool
+	maintenanceEncrypt    bool
+	maintenanceJSONOutput bool
+)
+
+func newMaintenanceCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "maintenance",
+		Short: "Check, compact or repair the pinning database",
+		Long: `Report the size of the pinning database, or maintain it.
+
+  --check   decode every pin, policy and discovery version and run bbolt's
+            consistency check
+  --vacuum  rewrite the database without free pages
+  --repair  copy every readable, valid row into a fresh file, keeping the
+            original as <db>.corrupt-<timestamp>
+  --encrypt encrypt a plaintext database with the key named by
+            --store-key, in one transaction, and compact the file
+
+A database encrypted at rest is opened with --store-key for every command.
+
+Without a flag, row counts and the file size are printed.
+
+Exit codes: 0 healthy or done, 1 error, 2 --check found problems,
+3 --repair could not salvage every row.`,
+		Example: `  schemapin-keys maintenance
+  schemapin-keys maintenance --check || schemapin-keys maintenance --repair
+  schemapin-keys maintenance --vacuum --json
+  schemapin-keys --store-key keychain:schemapin maintenance --encrypt`,
+		Args: cobra.NoArgs,
+		RunE: runMaintenance,
+	}
+
+	cmd.Flags().BoolVar(&maintenanceCheck, "check", false, "Check the database for corruption")
+	cmd.Flags().BoolVar(&maintenanceVacuum, "vacuum", false, "Compact the database file")
+	cmd.Flags().BoolVar(&maintenanceRepair, "repair", false, "Salvage readable rows into a fresh database file")
+	cmd.Flags().BoolVar(&maintenanceEncrypt, "encrypt", false, "Encrypt a plaintext database with the --store-key key")
+	cmd.Flags().BoolVar(&maintenanceJSONOutput, "json", false, "Output the result as JSON")
+	cmd.MarkFlagsMutuallyExclusive("check", "vacuum", "repair", "encrypt")
+
+	return cmd
+}
+
+func runMaintenance(cmd *cobra.Command, args []string) error {
+	if _, err := os.Stat(pinningDB); err != nil {
+		return fmt.Errorf("pinning database %s: %w", pinningDB, err)
+	}
+
+	if maintenanceEncrypt {
+		if storeKeySource == "" {
+			return fmt.Errorf("--encrypt requires --store-key")
+		}
+		key, err := readStoreKey()
+		if err != nil {
+			return err
+		}
+		n, err := pinning.EncryptPinStore(pinningDB, key)
+		if err != nil {
+			return err
+		}
+		return printMaintenance(map[string]int{"encrypted": n}, func(map[string]int) {
+			fmt.Printf("✅ Encrypted %d pin(s) in %s\n", n, pinningDB)
+		})
+	}
+
+	// A database too damaged to open can still be repaired
+	if maintenanceRepair {
+		opts, err := storeKeyOptions()
+		if err != nil {
+			return err
+		}
+		report, err := pinning.RepairDatabase(pinningDB, opts...)
+		if err != nil {
+			return err
+		}
+		if err := printMaintenance(report, displayRepairReport); err != nil {
+			return err
+		}
+		if len(report.Lost) > 0 {
+			os.Exit(maintenanceExitLost)
+		}
+		return nil
+	}
+
+	keyPinning, err := openPinningDB()
+	if err != nil {
+		if maintenanceCheck && errors.Is(err, schemaerr.ErrPinStoreCorrupt) {
+			report := &pinning.IntegrityReport{Problems: []pinning.IntegrityProblem{{Reason: err.Error()}}}
+			if err := printMaintenance(report, displayIntegrityReport); err != nil {
+				return err
+			}
+			os.Exit(maintenanceExitCorrupt)
+		}
+		return fmt.Errorf("failed to open pinning database: %w", err)
+	}
+	defer keyPinning.Close()
+
+	switch {
+	case maintenanceCheck:
+		report, err := keyPinning.IntegrityCheck()
+		if err != nil {
+			return err
+		}
+		if err := printMaintenance(report, displayIntegrityReport); err != nil {
+			return err
+		}
+		if !report.OK() {
+			keyPinning.Close()
+			os.Exit(maintenanceExitCorrupt)
+		}
+	case maintenanceVacuum:
+		result, err := keyPinning.Vacuum()
+		if err != nil {
+			return err
+		}
+		return printMaintenance(result, func(result *pinning.VacuumResult) {
+			fmt.Printf("✅ Vacuumed %s: %d -> %d bytes\n", pinningDB, result.SizeBefore, result.SizeAfter)
+		})
+	default:
+		stats, err := keyPinning.Stats()
+		if err != nil {
+			return err
+		}
+		return printMaintenance(stats, displayStoreStats)
+	}
+	return nil
+}
+
+// printMaintenance writes v as JSON with --json and with display otherwise.
+func printMaintenance[T any](v T, display func(T)) error {
+	if !maintenanceJSONOutput {
+		display(v)
+		return nil
+	}
+	outputJSON, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal result: %w", err)
+	}
+	fmt.Println(string(outputJSON))
+	return nil
+}
+
+func displayIntegrityReport(report *pinning.IntegrityReport) {
+	if report.OK() {
+		fmt.Printf("✅ %s is healthy (%s)\n", pinningDB, formatRows(report.Rows))
+		return
+	}
+	fmt.Printf("❌ %s has %d problem(s):\n", pinningDB, len(report.Problems))
+	for _, problem := range report.Problems {
+		fmt.Printf("   %s\n", problem)
+	}
+	fmt.Println("Run schemapin-keys maintenance --repair to salvage the readable rows")
+}
+
+func displayRepairReport(report *pinning.RepairReport) {
+	fmt.Printf("Repaired %s (%s recovered)\n", pinningDB, formatRows(report.Recovered))
+	fmt.Printf("Original kept at %s\n", report.BackupPath)
+	for _, problem := range report.Lost {
+		fmt.Printf("⚠️  Lost %s\n", problem)
+	}
+}
+
+func displayStoreStats(stats *pinning.StoreStats) {
+	fmt.Printf("Database: %s\n", stats.Path)
+	fmt.Printf("File size: %d bytes (%d bytes free)\n", stats.FileSize, stats.FreeBytes)
+	fmt.Printf("Rows: %s\n", formatRows(stats.Rows))
+	if n := len(stats.Rotations); n > 0 {
+		fmt.Printf("Store key rotations: %d, last %s\n", n, formatRotation(stats.Rotations[n-1]))
+	}
+}
+
+// formatRows formats per-bucket row counts in bucket name order.
+func formatRows(rows map[string]int) string {
+	names := make([]string, 0, len(rows))
+	for name := range rows {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	s := ""
+	for i, name := range names {
+		if i > 0 {
+			s += ", "
+		}
+		s += fmt.Sprintf("%s %d", name, rows[name])
+	}
+	return s
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/pinning"
+)
+
+var (
+	rotateOldKey     string
+	rotateNewKey     string
+	rotateDryRun     bool
+	rotateJSONOutput bool
+)
+
+func newRotateSecretCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rotate-secret",
+		Short: "Re-encrypt an encrypted pinning database with a new store key",
+		Long: `Re-encrypt a pinning database encrypted at rest with a new store key,
+keeping every pin, policy and rejection.
+
+Every row is first checked under the old key. If any row fails to decrypt
+or is stored under the wrong index, the rows are listed and nothing is
+changed, so that tampered rows are not re-encrypted as genuine. Otherwise
+every row is rewritten under the new key in one transaction, the rotation
+is recorded with the fingerprints of both keys (shown by
+"schemapin-keys maintenance"), and the file is compacted.
+
+The keys are read from the environment or a file, never from the command
+line: --old-key and --new-key take env:NAME or file:PATH. --dry-run checks
+the rows and reports what would be rewritten without changing anything.`,
+		Example: `  schemapin-keys rotate-secret --old-key env:OLD_STORE_KEY --new-key file:/run/secrets/store-key --dry-run
+  schemapin-keys rotate-secret --old-key env:OLD_STORE_KEY --new-key env:NEW_STORE_KEY`,
+		Args: cobra.NoArgs,
+		RunE: runRotateSecret,
+	}
+
+	cmd.Flags().StringVar(&rotateOldKey, "old-key", "", "Current key of the database: env:NAME or file:PATH")
+	cmd.Flags().StringVar(&rotateNewKey, "new-key", "", "Key to re-encrypt the database with: env:NAME or file:PATH")
+	cmd.Flags().BoolVar(&rotateDryRun, "dry-run", false, "Check the rows and report what would be rewritten without writing")
+	cmd.Flags().BoolVar(&rotateJSONOutput, "json", false, "Output the rotation record as JSON")
+	_ = cmd.MarkFlagRequired("old-key")
+	_ = cmd.MarkFlagRequired("new-key")
+
+	return cmd
+}
+
+func runRotateSecret(cmd *cobra.Command, args []string) error {
+	if _, err := os.Stat(pinningDB); err != nil {
+		return fmt.Errorf("pinning database %s: %w", pinningDB, err)
+	}
+	oldKey, err := readRotationKey("old-key", rotateOldKey)
+	if err != nil {
+		return err
+	}
+	newKey, err := readRotationKey("new-key", rotateNewKey)
+	if err != nil {
+		return err
+	}
+
+	rotation, err := pinning.RotateStoreSecret(pinningDB, oldKey, newKey, pinning.WithDryRun(rotateDryRun))
+	var rotationErr *pinning.RotationError
+	if errors.As(err, &rotationErr) && !rotateJSONOutput {
+		fmt.Printf("❌ %d row(s) of %s do not validate under the old key:\n", len(rotationErr.Invalid), pinningDB)
+		for _, problem := range rotationErr.Invalid {
+			fmt.Printf("   %s\n", problem)
+		}
+		return fmt.Errorf("store key not rotated")
+	}
+	if err != nil {
+		return err
+	}
+
+	if rotateJSONOutput {
+		outputJSON, err := json.MarshalIndent(rotation, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal rotation: %w", err)
+		}
+		fmt.Println(string(outputJSON))
+		return nil
+	}
+	if rotateDryRun {
+		fmt.Printf("Would re-encrypt %s (%s)\n", pinningDB, formatRows(rotation.Rows))
+		return nil
+	}
+	fmt.Printf("✅ Re-encrypted %s (%s)\n", pinningDB, formatRows(rotation.Rows))
+	fmt.Printf("Store key %s replaced by %s\n", rotation.OldKeyFingerprint, rotation.NewKeyFingerprint)
+	return nil
+}
+
+// readRotationKey reads the key named by the flag, which must come from
+// the environment or a file so that it never appears on the command line.
+func readRotationKey(flag, source string) ([]byte, error) {
+	if kind, _, _ := strings.Cut(source, ":"); kind != "env" && kind != "file" {
+		// The value is not echoed, in case it is the key itself
+		return nil, fmt.Errorf("--%s must be env:NAME or file:PATH", flag)
+	}
+	provider, err := pinning.ParseStoreKeySource(source)
+	if err != nil {
+		return nil, fmt.Errorf("--%s: %w", flag, err)
+	}
+	key, err := provider.StoreKey()
+	if err != nil {
+		return nil, fmt.Errorf("--%s: %w", flag, err)
+	}
+	return key, nil
+}
+
+// formatRotation describes a rotation of the store key.
+func formatRotation(rotation pinning.StoreRotation) string {
+	return fmt.Sprintf("%s, key %s replaced by %s", clock.Format(rotation.RotatedAt), rotation.OldKeyFingerprint, rotation.NewKeyFingerprint)
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/pinning"
+)
+
+var (
+	snapshotKey        string
+	snapshotOutput     string
+	snapshotPublicKey  string
+	snapshotJSONOutput bool
+)
+
+func newSnapshotCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "snapshot",
+		Short: "Create, verify and compare signed snapshots of the pinning database",
+		Long: `Snapshots record every pinned key, with its provenance and verification
+counts, and every domain policy, signed with an operator key. Keep them as
+audit evidence and diff two of them to review how the trust state changed.`,
+	}
+
+	createCmd := &cobra.Command{
+		Use:   "create",
+		Short: "Export a signed snapshot of the pinning database",
+		Args:  cobra.NoArgs,
+		RunE:  runSnapshotCreate,
+	}
+	createCmd.Flags().StringVar(&snapshotKey, "key", "", "Operator private key (PEM) to sign the snapshot with (required)")
+	createCmd.Flags().StringVarP(&snapshotOutput, "output", "o", "", "Write the snapshot to this file instead of stdout")
+	createCmd.Flags().BoolVar(&snapshotJSONOutput, "json", false, "Output a JSON summary")
+	_ = createCmd.MarkFlagRequired("key")
+
+	verifyCmd := &cobra.Command{
+		Use:   "verify SNAPSHOT",
+		Short: "Verify a snapshot's signature",
+		Args:  cobra.ExactArgs(1),
+		RunE:  runSnapshotVerify,
+	}
+	verifyCmd.Flags().StringVar(&snapshotPublicKey, "public-key", "", "Operator public key (PEM) the snapshot was signed with (required)")
+	verifyCmd.Flags().BoolVar(&snapshotJSONOutput, "json", false, "Output the result as JSON")
+	_ = verifyCmd.MarkFlagRequired("public-key")
+
+	diffCmd := &cobra.Command{
+		Use:   "diff OLD NEW",
+		Short: "List pins added, removed and changed between two snapshots",
+		Long: `List the pins added, removed and changed between two snapshots, and the
+domain policies that changed. Verification counts are not compared.
+
+With --public-key, both snapshots are verified first.`,
+		Args: cobra.ExactArgs(2),
+		RunE: runSnapshotDiff,
+	}
+	diffCmd.Flags().StringVar(&snapshotPublicKey, "public-key", "", "Verify both snapshots against this operator public key (PEM)")
+	diffCmd.Flags().BoolVar(&snapshotJSONOutput, "json", false, "Output the differences as JSON")
+
+	cmd.AddCommand(createCmd, verifyCmd, diffCmd)
+	return cmd
+}
+
+func runSnapshotCreate(cmd *cobra.Command, args []string) error {
+	if _, err := os.Stat(pinningDB); err != nil {
+		return fmt.Errorf("pinning database %s: %w", pinningDB, err)
+	}
+	keyPEM, err := os.ReadFile(snapshotKey)
+	if err != nil {
+		return fmt.Errorf("failed to read signing key: %w", err)
+	}
+	keyPinning, err := openPinningDB()
+	if err != nil {
+		return fmt.Errorf("failed to open pinning database: %w", err)
+	}
+	defer keyPinning.Close()
+
+	doc, err := keyPinning.ExportSignedSnapshot(string(keyPEM))
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal snapshot: %w", err)
+	}
+	if snapshotOutput == "" {
+		fmt.Println(string(data))
+		return nil
+	}
+	if err := os.WriteFile(snapshotOutput, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+
+	if snapshotJSONOutput {
+		return printJSON(map[string]interface{}{
+			"output":             snapshotOutput,
+			"exported_at":        doc.ExportedAt,
+			"host":               doc.Host,
+			"signer_fingerprint": doc.SignerFingerprint,
+			"pins":               len(doc.Pins),
+			"domain_policies":    len(doc.DomainPolicies),
+		})
+	}
+	displaySnapshotPins(doc.Pins)
+	fmt.Printf("\nWrote snapshot of %d pins and %d domain policies to %s\n", len(doc.Pins), len(doc.DomainPolicies), snapshotOutput)
+	fmt.Printf("Signed by %s\n", doc.SignerFingerprint)
+	return nil
+}
+
+func runSnapshotVerify(cmd *cobra.Command, args []string) error {
+	doc, err := loadSnapshot(args[0])
+	if err != nil {
+		return err
+	}
+	publicKeyPEM, err := os.ReadFile(snapshotPublicKey)
+	if err != nil {
+		return fmt.Errorf("failed to read public key: %w", err)
+	}
+	verifyErr := pinning.VerifySnapshot(doc, string(publicKeyPEM))
+
+	if snapshotJSONOutput {
+		result := map[string]interface{}{
+			"valid":              verifyErr == nil,
+			"exported_at":        doc.ExportedAt,
+			"host":               doc.Host,
+			"signer_fingerprint": doc.SignerFingerprint,
+			"pins":               len(doc.Pins),
+			"domain_policies":    len(doc.DomainPolicies),
+		}
+		if verifyErr != nil {
+			result["error"] = verifyErr.Error()
+		}
+		if err := printJSON(result); err != nil {
+			return err
+		}
+	} else if verifyErr == nil {
+		fmt.Printf("Snapshot %s is valid\n", args[0])
+		fmt.Printf("Exported %s on %s, signed by %s\n", doc.ExportedAt, doc.Host, doc.SignerFingerprint)
+		fmt.Printf("%d pins, %d domain policies\n", len(doc.Pins), len(doc.DomainPolicies))
+	}
+	if verifyErr != nil {
+		return fmt.Errorf("snapshot %s: %w", args[0], verifyErr)
+	}
+	return nil
+}
+
+func runSnapshotDiff(cmd *cobra.Command, args []string) error {
+	oldDoc, err := loadSnapshot(args[0])
+	if err != nil {
+		return err
+	}
+	newDoc, err := loadSnapshot(args[1])
+	if err != nil {
+		return err
+	}
+	if snapshotPublicKey != "" {
+		publicKeyPEM, err := os.ReadFile(snapshotPublicKey)
+		if err != nil {
+			return fmt.Errorf("failed to read public key: %w", err)
+		}
+		for i, doc := range []pinning.SnapshotDocument{oldDoc, newDoc} {
+			if err := pinning.VerifySnapshot(doc, string(publicKeyPEM)); err != nil {
+				return fmt.Errorf("snapshot %s: %w", args[i], err)
+			}
+		}
+	}
+
+	diff := pinning.CompareSnapshots(oldDoc, newDoc)
+	if snapshotJSONOutput {
+		return printJSON(diff)
+	}
+	displaySnapshotDiff(diff)
+	return nil
+}
+
+func loadSnapshot(path string) (pinning.SnapshotDocument, error) {
+	var doc pinning.SnapshotDocument
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return doc, fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return doc, fmt.Errorf("failed to parse snapshot %s: %w", path, err)
+	}
+	return doc, nil
+}
+
+func printJSON(v interface{}) error {
+	outputJSON, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal output: %w", err)
+	}
+	fmt.Println(string(outputJSON))
+	return nil
+}
+
+func displaySnapshotPins(pins []pinning.SnapshotPin) {
+	if len(pins) == 0 {
+		fmt.Println("No pinned keys")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TOOL ID\tDOMAIN\tFINGERPRINT\tPROVENANCE\tPINNED AT")
+	for _, pin := range pins {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", pin.ToolID, pin.Domain, pin.Fingerprint, pin.Provenance, pin.PinnedAt)
+	}
+	_ = w.Flush()
+}
+
+func displaySnapshotDiff(diff pinning.SnapshotDiff) {
+	if diff.Empty() {
+		fmt.Println("No differences")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if len(diff.Added)+len(diff.Removed)+len(diff.Changed) > 0 {
+		fmt.Fprintln(w, " \tTOOL ID\tDOMAIN\tFINGERPRINT\tCHANGED")
+		for _, pin := range diff.Added {
+			fmt.Fprintf(w, "+\t%s\t%s\t%s\t\n", pin.ToolID, pin.Domain, pin.Fingerprint)
+		}
+		for _, pin := range diff.Removed {
+			fmt.Fprintf(w, "-\t%s\t%s\t%s\t\n", pin.ToolID, pin.Domain, pin.Fingerprint)
+		}
+		for _, change := range diff.Changed {
+			fmt.Fprintf(w, "~\t%s\t%s\t%s\t%s\n", change.ToolID, change.New.Domain, change.New.Fingerprint, strings.Join(change.Fields, ","))
+		}
+	}
+	_ = w.Flush()
+
+	if len(diff.PolicyChanges) > 0 {
+		fmt.Println("\nDomain policies:")
+		w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "DOMAIN\tOLD\tNEW")
+		for _, change := range diff.PolicyChanges {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", change.Domain, policyOrNone(change.Old), policyOrNone(change.New))
+		}
+		_ = w.Flush()
+	}
+
+	fmt.Printf("\n%d added, %d removed, %d changed, %d policy changes\n",
+		len(diff.Added), len(diff.Removed), len(diff.Changed), len(diff.PolicyChanges))
+}
+
+func policyOrNone(policy pinning.PinningPolicy) string {
+	if policy == "" {
+		return "(none)"
+	}
+	return string(policy)
+}
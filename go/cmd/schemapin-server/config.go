@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/pinning"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+// loadTrustBoundary combines --trust-boundary-file with any --allow-domain,
+// --deny-domain and --tls-pin flags. It returns nil when none were given.
+func loadTrustBoundary() (*pinning.TrustBoundary, error) {
+	boundary := &pinning.TrustBoundary{}
+	if trustBoundaryFile != "" {
+		loaded, err := pinning.LoadTrustBoundaryFile(trustBoundaryFile)
+		if err != nil {
+			return nil, err
+		}
+		boundary = loaded
+	}
+	boundary.Allow = append(boundary.Allow, allowDomains...)
+	boundary.Deny = append(boundary.Deny, denyDomains...)
+	for _, flag := range tlsPinFlags {
+		host, pin, ok := strings.Cut(flag, "=")
+		if !ok || host == "" {
+			return nil, fmt.Errorf("invalid --tls-pin %q: expected domain=pin", flag)
+		}
+		if boundary.TLSPins == nil {
+			boundary.TLSPins = make(map[string][]string)
+		}
+		boundary.TLSPins[host] = append(boundary.TLSPins[host], pin)
+	}
+
+	if len(boundary.Allow) == 0 && len(boundary.Deny) == 0 && len(boundary.TLSPins) == 0 {
+		return nil, nil
+	}
+	if err := boundary.Validate(); err != nil {
+		return nil, err
+	}
+	return boundary, nil
+}
+
+// loadVerificationPolicy returns the policy named by --policy or read from
+// --verification-policy-file, or nil when neither was given.
+func loadVerificationPolicy() (*verification.Policy, error) {
+	switch {
+	case verificationProfile != "":
+		return verification.PolicyProfile(verificationProfile)
+	case verificationPolicyFile != "":
+		return verification.LoadPolicyFile(verificationPolicyFile)
+	}
+	return nil, nil
+}
@@ -0,0 +1,329 @@
+// Package main provides the schemapin-server tool, a long-running HTTP
+// service verifying signed schemas and skills for other processes.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ThirdKeyAi/schemapin/go/internal/cliconfig"
+	"github.com/ThirdKeyAi/schemapin/go/internal/version"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/httpmw"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/interactive"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/pinning"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/utils"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verifyserver"
+)
+
+var (
+	configFile string
+
+	listenAddr string
+	unixSocket string
+	token      string
+	tokenFile  string
+
+	pinningDB              string
+	storeKeySource         string
+	autoPin                bool
+	policyFile             string
+	verificationProfile    string
+	verificationPolicyFile string
+	contentPolicyFile      string
+	localRoot              string
+	queueDecisions         bool
+	maxSignatureAge        time.Duration
+
+	allowDomains      []string
+	denyDomains       []string
+	trustBoundaryFile string
+	tlsPinFlags       []string
+
+	maxBodyBytes    int64
+	maxArchiveBytes int64
+	requestTimeout  time.Duration
+	shutdownTimeout time.Duration
+	verbose         bool
+)
+
+func main() {
+	var rootCmd = &cobra.Command{
+		Use:   "schemapin-server",
+		Short: "Serve SchemaPin schema and skill verification over HTTP",
+		Long: `Run a long-lived verification service, e.g. as a sidecar, so that services
+in any language can verify signed schemas and skills against one shared
+pinning database and discovery cache instead of running schemapin-verify
+for every check.
+
+The server listens on TCP with a bearer token (--token, --token-file or
+SCHEMAPIN_TOKEN), or on a unix socket (--unix-socket), where the socket's
+file permissions restrict access and no token is required.
+
+Every flag can also be set in a config file (--config, or schemapin.yaml in
+the working directory or $XDG_CONFIG_HOME/schemapin/), in its "server"
+section, or in a SCHEMAPIN_* environment variable.`,
+		Example: `  SCHEMAPIN_TOKEN=$(cat token) schemapin-server --listen 127.0.0.1:8787 --auto-pin
+  schemapin-server --unix-socket /run/schemapin.sock --local-root /srv/skills
+  schemapin-server --unix-socket /run/schemapin.sock --queue-decisions
+  schemapin-server --config server.yaml --policy strict --allow-domain '*.example.com'`,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			_, err := cliconfig.Apply(cmd, cliconfig.Options{Section: "server", File: configFile, Strict: cmd == cmd.Root()})
+			return err
+		},
+		RunE:         runServer,
+		SilenceUsage: true,
+	}
+
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "Config file (default: ./schemapin.yaml, then $XDG_CONFIG_HOME/schemapin/schemapin.yaml)")
+
+	// Listener options
+	rootCmd.Flags().StringVar(&listenAddr, "listen", "127.0.0.1:8787", "TCP address to listen on (requires a token)")
+	rootCmd.Flags().StringVar(&unixSocket, "unix-socket", "", "Listen on this unix socket instead of TCP; access is limited by its file permissions")
+	rootCmd.Flags().StringVar(&token, "token", "", "Bearer token required on every request except /healthz (prefer SCHEMAPIN_TOKEN or --token-file)")
+	rootCmd.Flags().StringVar(&tokenFile, "token-file", "", "File holding the bearer token")
+	rootCmd.MarkFlagsMutuallyExclusive("token", "token-file")
+
+	// Verification options
+	defaultPinningDB, _ := pinning.DefaultDBPath()
+	rootCmd.Flags().StringVar(&pinningDB, "pinning-db", defaultPinningDB, "Path to key pinning database")
+	rootCmd.Flags().StringVar(&storeKeySource, "store-key", "", "Key of an encrypted pinning database: env:NAME, file:PATH or keychain:SERVICE[/ACCOUNT]")
+	rootCmd.Flags().BoolVar(&autoPin, "auto-pin", false, "Pin keys on first use unless a request sets auto_pin")
+	rootCmd.Flags().StringVar(&policyFile, "policy-file", "", "Trust policy file (JSON or YAML) applied to the pinning database at startup")
+	rootCmd.Flags().StringVar(&verificationProfile, "policy", "", "Verification policy profile: strict, default or permissive")
+	rootCmd.Flags().StringVar(&verificationPolicyFile, "verification-policy-file", "", "Verification policy file (JSON or YAML) declaring which checks fail or warn")
+	rootCmd.MarkFlagsMutuallyExclusive("policy", "verification-policy-file")
+	rootCmd.Flags().StringVar(&contentPolicyFile, "content-policy", "", "Content policy file (JSON) enforced on skill contents")
+	rootCmd.Flags().StringVar(&localRoot, "local-root", "", "Let skill requests name a directory under this root by path (sidecar mode)")
+	rootCmd.Flags().DurationVar(&maxSignatureAge, "max-signature-age", 0, "Warn about schemas whose signed_at is older than this, e.g. 720h; fails under a policy whose stale_signatures is fail (0: no limit)")
+	rootCmd.Flags().BoolVar(&queueDecisions, "queue-decisions", false, "Queue first-use key decisions for a dashboard to answer via /v1/decisions instead of rejecting them")
+
+	// Trust boundary options
+	rootCmd.Flags().StringArrayVar(&allowDomains, "allow-domain", nil, "Only trust this domain or *.suffix pattern (repeatable)")
+	rootCmd.Flags().StringArrayVar(&denyDomains, "deny-domain", nil, "Never trust this domain or *.suffix pattern (repeatable; overrides --allow-domain)")
+	rootCmd.Flags().StringVar(&trustBoundaryFile, "trust-boundary-file", "", "Trust boundary file (JSON or YAML) with allow and deny domain lists and TLS pins")
+	rootCmd.Flags().StringArrayVar(&tlsPinFlags, "tls-pin", nil, "Pin discovery for a domain to a certificate, as domain=base64 SPKI SHA-256 (repeatable)")
+
+	// Limits
+	rootCmd.Flags().Int64Var(&maxBodyBytes, "max-body-bytes", httpmw.DefaultMaxBodyBytes, "Largest JSON request body accepted")
+	rootCmd.Flags().Int64Var(&maxArchiveBytes, "max-archive-bytes", verifyserver.DefaultMaxArchiveBytes, "Largest skill archive upload accepted")
+	rootCmd.Flags().DurationVar(&requestTimeout, "request-timeout", verifyserver.DefaultRequestTimeout, "Time allowed for each request, including discovery")
+	rootCmd.Flags().DurationVar(&shutdownTimeout, "shutdown-timeout", 10*time.Second, "Time allowed for requests in flight to finish on SIGINT or SIGTERM")
+	rootCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Log debug records from discovery and pinning")
+
+	rootCmd.Version = version.GetVersion()
+
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(1)
+	}
+}
+
+func runServer(cmd *cobra.Command, args []string) error {
+	if err := loadToken(); err != nil {
+		return err
+	}
+	if unixSocket == "" && token == "" {
+		return fmt.Errorf("refusing to listen on TCP without a token: set --token, --token-file or SCHEMAPIN_TOKEN, or use --unix-socket")
+	}
+
+	logger := newLogger()
+	// Nothing is served unless the crypto stack passes its self-test
+	if err := crypto.SelfTest(); err != nil {
+		return fmt.Errorf("refusing to serve: crypto self-test failed: %w", err)
+	}
+	logger.Debug("crypto self-test passed")
+
+	boundary, err := loadTrustBoundary()
+	if err != nil {
+		return err
+	}
+	policy, err := loadVerificationPolicy()
+	if err != nil {
+		return err
+	}
+	var contentPolicy *verification.ContentPolicy
+	if contentPolicyFile != "" {
+		if contentPolicy, err = verification.LoadContentPolicy(contentPolicyFile); err != nil {
+			return err
+		}
+	}
+
+	pinningOpts := []pinning.Option{pinning.WithLogger(logger), pinning.WithTrustBoundary(boundary)}
+	if storeKeySource != "" {
+		provider, err := pinning.ParseStoreKeySource(storeKeySource)
+		if err != nil {
+			return err
+		}
+		key, err := provider.StoreKey()
+		if err != nil {
+			return err
+		}
+		pinningOpts = append(pinningOpts, pinning.WithStoreEncryption(key))
+	}
+	keyPinning, err := pinning.NewKeyPinning(pinningDB, pinning.PinningModeInteractive, nil, pinningOpts...)
+	if err != nil {
+		return fmt.Errorf("failed to open pinning database: %w", err)
+	}
+	if policyFile != "" {
+		report, err := keyPinning.ApplyPolicyFile(policyFile)
+		if err != nil {
+			keyPinning.Close()
+			return fmt.Errorf("failed to apply policy file: %w", err)
+		}
+		logger.Info("applied policy file", "file", policyFile,
+			"domain_policies", report.DomainPoliciesApplied, "keys_pinned", report.KeysPinned, "conflicts", len(report.Conflicts))
+	}
+
+	var discoveryOpts []discovery.Option
+	if boundary != nil && len(boundary.TLSPins) > 0 {
+		discoveryOpts = append(discoveryOpts, discovery.WithTLSPins(boundary.TLSPins))
+	}
+	workflowOpts := []utils.WorkflowOption{
+		utils.WithLogger(logger), utils.WithTrustBoundary(boundary), utils.WithPolicy(policy),
+		utils.WithDiscoveryOptions(discoveryOpts...), utils.WithMaxSignatureAge(maxSignatureAge),
+	}
+	if queueDecisions {
+		workflowOpts = append(workflowOpts, utils.WithQueuedDecisions(nil))
+	}
+	workflow := utils.NewSchemaVerificationWorkflowWithPinning(keyPinning, workflowOpts...)
+	defer workflow.Close()
+
+	handler := verifyserver.New(workflow, keyPinning, verifyserver.Options{
+		Token:           token,
+		TrustBoundary:   boundary,
+		Policy:          policy,
+		ContentPolicy:   contentPolicy,
+		AutoPin:         autoPin,
+		LocalRoot:       localRoot,
+		MaxBodyBytes:    maxBodyBytes,
+		MaxArchiveBytes: maxArchiveBytes,
+		RequestTimeout:  requestTimeout,
+		Logger:          logger,
+	})
+
+	listener, address, err := listen()
+	if err != nil {
+		return err
+	}
+	server := &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       requestTimeout,
+		WriteTimeout:      requestTimeout + 5*time.Second,
+		IdleTimeout:       2 * time.Minute,
+		ErrorLog:          slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	serveErr := make(chan error, 1)
+	go func() { serveErr <- server.Serve(listener) }()
+	if store := workflow.PendingDecisions(); store != nil {
+		go expireDecisions(ctx, store, logger)
+	}
+	logger.Info("schemapin-server listening", "address", address, "version", version.GetVersion())
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+	logger.Info("shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("failed to shut down: %w", err)
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// expireDecisions rejects unanswered decisions as they time out, so that
+// the pinning database's log records each expiry when it happens rather
+// than at the tool's next verification.
+func expireDecisions(ctx context.Context, store *interactive.PendingDecisionStore, logger *slog.Logger) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := store.Expire(); err != nil {
+				logger.Warn("failed to expire pending decisions", "error", err)
+			}
+		}
+	}
+}
+
+// listen opens the unix socket or the TCP address to serve on.
+func listen() (net.Listener, string, error) {
+	if unixSocket == "" {
+		listener, err := net.Listen("tcp", listenAddr)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to listen on %s: %w", listenAddr, err)
+		}
+		return listener, listener.Addr().String(), nil
+	}
+
+	// A socket left behind by a previous run would fail the bind
+	if info, err := os.Lstat(unixSocket); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(unixSocket); err != nil {
+			return nil, "", fmt.Errorf("failed to remove stale socket: %w", err)
+		}
+	}
+	// The socket is created owner-only rather than restricted after the
+	// bind, which would leave it open to other users in between
+	restore := restrictUmask()
+	listener, err := net.Listen("unix", unixSocket)
+	restore()
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to listen on %s: %w", unixSocket, err)
+	}
+	if err := os.Chmod(unixSocket, 0600); err != nil {
+		listener.Close()
+		return nil, "", fmt.Errorf("failed to restrict socket permissions: %w", err)
+	}
+	return listener, "unix:" + unixSocket, nil
+}
+
+// loadToken reads --token-file into token.
+func loadToken() error {
+	if tokenFile == "" {
+		return nil
+	}
+	data, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return fmt.Errorf("failed to read token file: %w", err)
+	}
+	token = strings.TrimSpace(string(data))
+	if token == "" {
+		return fmt.Errorf("token file %s is empty", tokenFile)
+	}
+	return nil
+}
+
+// newLogger returns the server's logger: JSON records on stderr, with
+// debug records only with --verbose.
+func newLogger() *slog.Logger {
+	level := slog.LevelInfo
+	if verbose {
+		level = slog.LevelDebug
+	}
+	return slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: level}))
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package main
+
+// restrictUmask does nothing where there is no umask.
+func restrictUmask() (restore func()) {
+	return func() {}
+}
@@ -0,0 +1,13 @@
+//go:build unix
+
+package main
+
+import "syscall"
+
+// restrictUmask makes files created until restore is called, such as the
+// unix socket, accessible to the owner only, so that they are never open
+// to others before their permissions are set.
+func restrictUmask() (restore func()) {
+	previous := syscall.Umask(0077)
+	return func() { syscall.Umask(previous) }
+}
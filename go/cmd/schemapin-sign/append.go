@@ -0,0 +1,97 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+// appendFile is the --append flag
+var appendFile string
+
+// processAppend adds a signature by privateKey to the signed schema at
+// signedPath, writing the result to --output or back to signedPath.
+//
+// The schema is hashed again under the document's own schemapin_version
+// and canonicalization. The hash is recorded in schema_hash on the first
+// append, and later appends refuse a schema whose hash no longer matches;
+// --expect checks it on the first append too. A single signature field is
+// converted into the first entry of signatures and kept, so verifiers
+// without multi-signature support still see it.
+func processAppend(signedPath string, privateKey *ecdsa.PrivateKey) (ProcessResult, error) {
+	data, err := os.ReadFile(signedPath)
+	if err != nil {
+		return ProcessResult{}, fmt.Errorf("failed to read signed schema: %w", err)
+	}
+	var signedSchema SignedSchema
+	if err := json.Unmarshal(data, &signedSchema); err != nil {
+		return ProcessResult{}, fmt.Errorf("failed to parse signed schema %s: %w", signedPath, err)
+	}
+	entries := verification.SignatureEntries(signedSchema.Signature, signedSchema.Signatures)
+	if signedSchema.Schema == nil || len(entries) == 0 {
+		return ProcessResult{}, fmt.Errorf("%s is not a signed schema", signedPath)
+	}
+
+	schemaHash, err := core.NewSchemaPinCore().CanonicalizeAndHashForSignature(signedSchema.Schema, signedSchema.SchemapinVersion, signedSchema.Canonicalization)
+	if err != nil {
+		return ProcessResult{}, fmt.Errorf("failed to canonicalize schema: %w", err)
+	}
+	if err := core.CheckExpectedHash(signedSchema.SchemaHash, schemaHash); err != nil {
+		return ProcessResult{}, fmt.Errorf("refusing to sign %s: schema changed since it was signed: %w", signedPath, err)
+	}
+	if err := core.CheckExpectedHash(expectHash, schemaHash); err != nil {
+		return ProcessResult{}, fmt.Errorf("refusing to sign schema: %w", err)
+	}
+
+	keyManager := crypto.NewKeyManager()
+	kid, err := keyManager.CalculateKeyFingerprint(&privateKey.PublicKey)
+	if err != nil {
+		return ProcessResult{}, fmt.Errorf("failed to calculate key fingerprint: %w", err)
+	}
+	sigManager := crypto.NewSignatureManager()
+	for _, entry := range entries {
+		if crypto.FingerprintEqual(entry.SignerKid, kid) ||
+			(entry.SignerKid == "" && sigManager.VerifySchemaSignature(schemaHash, entry.Signature, &privateKey.PublicKey)) {
+			return ProcessResult{}, fmt.Errorf("%s is already signed by %s", signedPath, kid)
+		}
+	}
+
+	signature, err := sigManager.SignSchemaHash(schemaHash, privateKey)
+	if err != nil {
+		return ProcessResult{}, fmt.Errorf("failed to sign schema: %w", err)
+	}
+	signedSchema.Signatures = append(append([]verification.SignatureEntry(nil), entries...), verification.SignatureEntry{
+		SignerKid: kid,
+		Signature: signature,
+		SignedAt:  clock.Format(time.Now()),
+	})
+	signedSchema.SchemaHash = core.FormatSchemaHash(schemaHash)
+
+	outputPath := outputFile
+	if outputPath == "" {
+		outputPath = signedPath
+	}
+	outputJSON, err := json.MarshalIndent(signedSchema, "", "  ")
+	if err != nil {
+		return ProcessResult{}, fmt.Errorf("failed to marshal signed schema: %w", err)
+	}
+	if err := os.WriteFile(outputPath, outputJSON, 0644); err != nil {
+		return ProcessResult{}, fmt.Errorf("failed to write signed schema: %w", err)
+	}
+	if verbose && !jsonOutput {
+		fmt.Printf("Added signature by %s (%d signatures)\n", kid, len(signedSchema.Signatures))
+	}
+
+	return ProcessResult{
+		Input:  signedPath,
+		Output: outputPath,
+		Status: "success",
+	}, nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ThirdKeyAi/schemapin/go/internal/cliconfig"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+)
+
+var (
+	configFile string
+	selfTest   bool
+)
+
+// applyConfig is the root command's PersistentPreRunE. It fills flags not
+// given on the command line from SCHEMAPIN_* variables and the config
+// file, before cobra checks required flags and flag groups. With
+// --self-test it then checks the crypto stack.
+func applyConfig(cmd *cobra.Command, args []string) error {
+	if _, err := cliconfig.Apply(cmd, cliconfig.Options{
+		Section: "sign",
+		File:    configFile,
+		Strict:  cmd == cmd.Root(),
+	}); err != nil {
+		return err
+	}
+	return runSelfTest()
+}
+
+// runSelfTest runs crypto.SelfTest when --self-test is set.
+func runSelfTest() error {
+	if !selfTest {
+		return nil
+	}
+	if err := crypto.SelfTest(); err != nil {
+		return fmt.Errorf("crypto self-test failed: %w", err)
+	}
+	return nil
+}
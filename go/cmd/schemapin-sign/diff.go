@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+)
+
+// Exit codes for the diff subcommand so it can gate CI.
+const (
+	diffExitUnchanged = 0
+	diffExitChanged   = 2
+)
+
+var (
+	diffOldFile    string
+	diffNewFile    string
+	diffKeyFile    string
+	diffJSONOutput bool
+)
+
+type DiffResult struct {
+	Changed           bool      `json:"changed"`
+	ResignRequired    bool      `json:"resign_required"`
+	Diff              core.Diff `json:"diff"`
+	SignatureVerified *bool     `json:"signature_valid_for_new,omitempty"`
+	VerificationKey   string    `json:"verification_key,omitempty"`
+	KeyFingerprint    string    `json:"key_fingerprint,omitempty"`
+	OldSignatureValid *bool     `json:"signature_valid_for_old,omitempty"`
+}
+
+func newDiffCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff",
+		Short: "Report whether a schema change invalidates an existing signature",
+		Long: `Compare a previously signed schema against new schema content.
+
+Both schemas are canonicalized and hashed under the canonicalization the
+existing signature declares (schemapin-v1 or jcs). When the hashes differ,
+the added/removed/changed paths are listed. When --key is supplied, the existing
+signature is verified against the new content to prove whether it still holds.
+
+Exit codes: 0 unchanged, 2 changed (re-signing required), 1 error. An
+existing signature that does not verify with --key is an error.`,
+		Example: `  schemapin-sign diff --old signed_schema.json --new schema.json
+  schemapin-sign diff --old signed_schema.json --new schema.json --key public.pem --json`,
+		RunE: runDiff,
+	}
+
+	cmd.Flags().StringVar(&diffOldFile, "old", "", "Previously signed schema file")
+	cmd.Flags().StringVar(&diffNewFile, "new", "", "New schema file (bare schema or signed schema)")
+	cmd.Flags().StringVar(&diffKeyFile, "key", "", "Public key file (PEM) used to check the existing signature against the new content")
+	cmd.Flags().BoolVar(&diffJSONOutput, "json", false, "Output result as JSON")
+	_ = cmd.MarkFlagRequired("old")
+	_ = cmd.MarkFlagRequired("new")
+
+	return cmd
+}
+
+func runDiff(cmd *cobra.Command, args []string) error {
+	oldSigned, err := loadSignedSchemaFile(diffOldFile)
+	if err != nil {
+		return err
+	}
+	newSchema, err := loadSchemaOrSigned(diffNewFile)
+	if err != nil {
+		return err
+	}
+
+	// Hash both schemas under the canonicalization the existing signature
+	// declares, as verification does, so that the hashes are the ones the
+	// signature covers
+	c := core.NewSchemaPinCore()
+	oldHash, err := c.CanonicalizeAndHashForSignature(oldSigned.Schema, oldSigned.SchemapinVersion, oldSigned.Canonicalization)
+	if err != nil {
+		return fmt.Errorf("cannot diff %s: %w", diffOldFile, err)
+	}
+	newHash, err := c.CanonicalizeAndHashForSignature(newSchema, oldSigned.SchemapinVersion, oldSigned.Canonicalization)
+	if err != nil {
+		return fmt.Errorf("failed to canonicalize new schema: %w", err)
+	}
+	changed := !bytes.Equal(oldHash, newHash)
+
+	// The changed paths do not depend on the canonicalization
+	oldCanonical, err := c.CanonicalizeSchema(oldSigned.Schema)
+	if err != nil {
+		return fmt.Errorf("failed to canonicalize old schema: %w", err)
+	}
+	_, diff, err := core.SchemaChanged(oldCanonical, newSchema)
+	if err != nil {
+		return fmt.Errorf("failed to compare schemas: %w", err)
+	}
+	diff.OldHash = core.FormatSchemaHash(oldHash)
+	diff.NewHash = core.FormatSchemaHash(newHash)
+
+	result := DiffResult{
+		Changed:        changed,
+		ResignRequired: changed,
+		Diff:           diff,
+	}
+
+	if diffKeyFile != "" {
+		keyData, err := os.ReadFile(diffKeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to read public key file: %w", err)
+		}
+		keyManager := crypto.NewKeyManager()
+		publicKey, err := keyManager.LoadPublicKeyPEM(string(keyData))
+		if err != nil {
+			return fmt.Errorf("failed to load public key: %w", err)
+		}
+
+		sigManager := crypto.NewSignatureManager()
+		validForNew := sigManager.VerifySchemaSignature(newHash, oldSigned.Signature, publicKey)
+		validForOld := sigManager.VerifySchemaSignature(oldHash, oldSigned.Signature, publicKey)
+
+		result.SignatureVerified = &validForNew
+		result.OldSignatureValid = &validForOld
+		result.VerificationKey = diffKeyFile
+		if fingerprint, err := keyManager.CalculateKeyFingerprint(publicKey); err == nil {
+			result.KeyFingerprint = fingerprint
+		}
+	}
+
+	if diffJSONOutput {
+		outputJSON, err := json.MarshalIndent(result, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal result: %w", err)
+		}
+		fmt.Println(string(outputJSON))
+	} else {
+		displayDiffResult(result)
+	}
+
+	// A signature that never held under --key is an error, not a change:
+	// it cannot tell whether the new content still verifies
+	if result.OldSignatureValid != nil && !*result.OldSignatureValid {
+		return fmt.Errorf("existing signature in %s does not verify with %s", diffOldFile, diffKeyFile)
+	}
+	if result.Changed {
+		os.Exit(diffExitChanged)
+	}
+	os.Exit(diffExitUnchanged)
+	return nil
+}
+
+func displayDiffResult(result DiffResult) {
+	if !result.Changed {
+		fmt.Printf("Schema unchanged (%s)\n", result.Diff.NewHash)
+	} else {
+		fmt.Println("Schema changed: re-signing required")
+		fmt.Printf("   Old hash: %s\n", result.Diff.OldHash)
+		fmt.Printf("   New hash: %s\n", result.Diff.NewHash)
+		for _, path := range result.Diff.Added {
+			fmt.Printf("   + %s\n", path)
+		}
+		for _, path := range result.Diff.Removed {
+			fmt.Printf("   - %s\n", path)
+		}
+		for _, path := range result.Diff.Changed {
+			fmt.Printf("   ~ %s\n", path)
+		}
+	}
+
+	if result.SignatureVerified != nil {
+		if result.OldSignatureValid != nil && !*result.OldSignatureValid {
+			fmt.Printf("   Error: existing signature does not verify against the old schema with %s\n", result.VerificationKey)
+		}
+		if *result.SignatureVerified {
+			fmt.Printf("   Existing signature: VALID for new content (key %s)\n", result.KeyFingerprint)
+		} else {
+			fmt.Printf("   Existing signature: INVALID for new content (key %s)\n", result.KeyFingerprint)
+		}
+	}
+}
+
+func loadSignedSchemaFile(path string) (*SignedSchema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signed schema file: %w", err)
+	}
+
+	var signed SignedSchema
+	if err := json.Unmarshal(data, &signed); err != nil {
+		return nil, fmt.Errorf("failed to parse signed schema: %w", err)
+	}
+	if signed.Schema == nil || signed.Signature == "" {
+		return nil, fmt.Errorf("invalid signed schema format - missing required fields")
+	}
+
+	return &signed, nil
+}
+
+// loadSchemaOrSigned loads a bare schema, unwrapping it if the file is a
+// signed schema envelope.
+func loadSchemaOrSigned(path string) (map[string]interface{}, error) {
+	schema, err := loadSchema(path)
+	if err != nil {
+		return nil, err
+	}
+
+	inner, hasSchema := schema["schema"].(map[string]interface{})
+	_, hasSignature := schema["signature"].(string)
+	if hasSchema && hasSignature {
+		return inner, nil
+	}
+	return schema, nil
+}
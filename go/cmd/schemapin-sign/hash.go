@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/skill"
+)
+
+// hashExitMismatch is the exit code of the hash subcommand when --expect
+// does not match, so it can gate CI.
+const hashExitMismatch = 2
+
+var (
+	// expectHash is the root command's --expect flag
+	expectHash string
+
+	hashSkillDir     string
+	hashSkillArchive string
+	hashSchemaFile   string
+	hashManifest     bool
+	hashExpect       string
+)
+
+// HashResult is the --manifest output of the hash subcommand. Its fields
+// match the skill_hash and file_manifest fields of .schemapin.sig.
+type HashResult struct {
+	SkillHash    string            `json:"skill_hash"`
+	FileManifest map[string]string `json:"file_manifest"`
+}
+
+func newHashCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "hash",
+		Short: "Print the canonical hash a skill or schema would be signed over",
+		Long: `Compute the canonical root hash (sha256:<hex>) of a skill directory, skill
+archive or schema file without signing it.
+
+A build job can record the hash of what it produced, and a release job
+holding the key can sign with --expect so that it refuses content that
+changed in between:
+
+  hash=$(schemapin-sign hash --skill-archive my-skill.zip)
+  schemapin-sign --skill-archive my-skill.zip --domain example.com --key key.pem --expect "$hash"
+
+With --expect, the hash subcommand itself checks the hash instead of
+printing it. Exit codes: 0 matched, 2 mismatch, 1 error.`,
+		Example: `  schemapin-sign hash --skill ./my-skill
+  schemapin-sign hash --skill ./my-skill --manifest
+  schemapin-sign hash --schema tool.json --expect sha256:9f86d08...`,
+		Args: cobra.NoArgs,
+		RunE: runHash,
+	}
+
+	cmd.Flags().StringVar(&hashSkillDir, "skill", "", "Skill directory to hash")
+	cmd.Flags().StringVar(&hashSkillArchive, "skill-archive", "", "Skill archive (.zip, .tar.gz) to hash")
+	cmd.Flags().StringVar(&hashSchemaFile, "schema", "", "Schema file to hash")
+	cmd.Flags().StringVar(&inputFormat, "input-format", "json", "Input schema format: json or yaml")
+	cmd.Flags().BoolVar(&hashManifest, "manifest", false, "Print the skill's file manifest as JSON along with its hash")
+	cmd.Flags().StringVar(&hashExpect, "expect", "", "Exit with status 2 unless the hash is this sha256:<hex> value")
+	cmd.MarkFlagsMutuallyExclusive("skill", "skill-archive", "schema")
+	cmd.MarkFlagsOneRequired("skill", "skill-archive", "schema")
+
+	return cmd
+}
+
+func runHash(cmd *cobra.Command, args []string) error {
+	if inputFormat != "json" && inputFormat != "yaml" {
+		return fmt.Errorf("invalid --input-format %q (expected json or yaml)", inputFormat)
+	}
+	if hashManifest && hashSchemaFile != "" {
+		return fmt.Errorf("--manifest applies to skills, not schemas")
+	}
+
+	var (
+		hash     []byte
+		manifest map[string]string
+		err      error
+	)
+	switch {
+	case hashSkillDir != "":
+		hash, manifest, err = skill.CanonicalizeSkill(hashSkillDir)
+	case hashSkillArchive != "":
+		hash, manifest, err = hashArchive(hashSkillArchive)
+	default:
+		hash, err = hashSchema(hashSchemaFile)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := core.CheckExpectedHash(hashExpect, hash); err != nil {
+		var mismatch *core.HashMismatchError
+		if errors.As(err, &mismatch) {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(hashExitMismatch)
+		}
+		return err
+	}
+
+	if hashManifest {
+		outputJSON, err := json.MarshalIndent(HashResult{SkillHash: core.FormatSchemaHash(hash), FileManifest: manifest}, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal manifest: %w", err)
+		}
+		fmt.Println(string(outputJSON))
+	} else if hashExpect == "" {
+		fmt.Println(core.FormatSchemaHash(hash))
+	}
+	return nil
+}
+
+func hashArchive(archivePath string) ([]byte, map[string]string, error) {
+	format, err := skill.DetectArchiveFormat(archivePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := os.Open(archivePath)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open skill archive: %w", err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to stat skill archive: %w", err)
+	}
+	return skill.CanonicalizeSkillArchive(f, info.Size(), format)
+}
+
+// hashSchema is the hash signSchema signs for the schema in schemaPath.
+func hashSchema(schemaPath string) ([]byte, error) {
+	schema, err := loadSchema(schemaPath)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := core.NewSchemaPinCore().CanonicalizeAndHashForSignature(schema, core.CurrentSchemapinVersion, canonicalization)
+	if err != nil {
+		return nil, fmt.Errorf("failed to canonicalize schema: %w", err)
+	}
+	return hash, nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/utils"
+)
+
+var (
+	indexDir string
+	baseURL  string
+)
+
+// processIndex builds a tool index of the signed schemas in dir matching
+// --pattern, each published at --base-url plus its file name, signs it and
+// writes it to --output, or stdout. The schemas must have been signed with
+// the same key.
+func processIndex(dir, privateKeyPEM string) (ProcessResult, error) {
+	base, err := url.Parse(baseURL)
+	if err != nil || (base.Scheme != "https" && base.Scheme != "http") || base.Host == "" {
+		return ProcessResult{}, fmt.Errorf("--base-url must be an absolute http or https URL")
+	}
+	files, err := filepath.Glob(filepath.Join(dir, pattern))
+	if err != nil {
+		return ProcessResult{}, fmt.Errorf("failed to glob files: %w", err)
+	}
+	if len(files) == 0 {
+		return ProcessResult{}, fmt.Errorf("no signed schema files found matching pattern '%s' in %s", pattern, dir)
+	}
+
+	var entries []utils.ToolIndexEntry
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return ProcessResult{}, fmt.Errorf("failed to read %s: %w", file, err)
+		}
+		var signed SignedSchema
+		if err := json.Unmarshal(data, &signed); err != nil || signed.Schema == nil || signed.Signature == "" {
+			return ProcessResult{}, fmt.Errorf("%s is not a signed schema", file)
+		}
+		name, _ := signed.Schema["name"].(string)
+		if name == "" {
+			name = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		}
+		entry, err := utils.NewToolIndexEntry(name, base.JoinPath(filepath.Base(file)).String(), signed.Schema, signed.Signature)
+		if err != nil {
+			return ProcessResult{}, err
+		}
+		entries = append(entries, entry)
+		if verbose && !jsonOutput {
+			fmt.Fprintf(os.Stderr, "Indexed %s: %s\n", name, entry.SchemaURL)
+		}
+	}
+
+	workflow, err := utils.NewSchemaSigningWorkflow(privateKeyPEM)
+	if err != nil {
+		return ProcessResult{}, err
+	}
+	index, err := workflow.BuildToolIndex(entries)
+	if err != nil {
+		return ProcessResult{}, fmt.Errorf("failed to build tool index: %w", err)
+	}
+
+	outputDest := "stdout"
+	if outputFile != "" {
+		if err := os.WriteFile(outputFile, index, 0644); err != nil {
+			return ProcessResult{}, fmt.Errorf("failed to write output file: %w", err)
+		}
+		outputDest = outputFile
+	} else {
+		fmt.Println(string(index))
+	}
+
+	return ProcessResult{
+		Input:  dir,
+		Output: outputDest,
+		Status: "success",
+	}, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+
+	"github.com/ThirdKeyAi/schemapin/go/internal/keysource"
+	"github.com/ThirdKeyAi/schemapin/go/internal/passphrase"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+)
+
+var (
+	keyEnv         string
+	keyStdin       bool
+	keyFD          int
+	passphraseFile string
+	passphraseEnv  string
+	passphraseFD   int
+)
+
+// keySource returns where --key, --key-env, --key-stdin or --key-fd reads
+// the private key from, checking that it does not compete with the schema
+// or the passphrase for stdin.
+func keySource() (keysource.Source, error) {
+	source := keysource.Source{File: keyFile, Env: keyEnv, Stdin: keyStdin, FD: keyFD}
+	if err := source.Validate(); err != nil {
+		return source, err
+	}
+	phrase := passphrase.Source{File: passphraseFile, Env: passphraseEnv, FD: passphraseFD}
+	switch {
+	case source.ReadsStdin() && stdinInput:
+		return source, fmt.Errorf("the key and --stdin cannot both be read from stdin; pass the key with --key-fd or --key-env")
+	case phrase.ReadsStdin() && stdinInput:
+		return source, fmt.Errorf("the passphrase and --stdin cannot both be read from stdin; use --passphrase-fd or --passphrase-env")
+	case phrase.ReadsStdin() && source.ReadsStdin():
+		return source, fmt.Errorf("the key and the passphrase cannot both be read from stdin")
+	case source.FD != 0 && source.FD == phrase.FD:
+		return source, fmt.Errorf("--key-fd and --passphrase-fd must be different descriptors")
+	}
+	return source, nil
+}
+
+// loadPrivateKey reads the private key from source and decrypts it with
+// the passphrase from --passphrase-file, --passphrase-env or
+// --passphrase-fd, or from a terminal prompt if the key is encrypted and
+// none was given. The PEM read is cleared before returning, and errors
+// never include it.
+func loadPrivateKey(source keysource.Source) (*ecdsa.PrivateKey, error) {
+	keyData, err := source.Read()
+	if err != nil {
+		return nil, err
+	}
+	defer clear(keyData)
+
+	privateKey, err := decryptPrivateKey(source, string(keyData))
+	if err != nil {
+		return nil, keysource.Redact(err, keyData)
+	}
+	return privateKey, nil
+}
+
+func decryptPrivateKey(source keysource.Source, keyPEM string) (*ecdsa.PrivateKey, error) {
+	keyManager := crypto.NewKeyManager()
+	phrase := passphrase.Source{File: passphraseFile, Env: passphraseEnv, FD: passphraseFD}
+
+	if !phrase.Given() {
+		privateKey, err := keyManager.LoadPrivateKeyPEM(keyPEM)
+		if !errors.Is(err, crypto.ErrPassphraseRequired) {
+			return privateKey, err
+		}
+		secret, err := passphrase.Prompt(fmt.Sprintf("Passphrase for the key from %s: ", source))
+		if err != nil {
+			return nil, fmt.Errorf("the key from %s is encrypted: %w", source, err)
+		}
+		defer clear(secret)
+		return keyManager.LoadPrivateKeyPEMWithPassphrase(keyPEM, secret)
+	}
+
+	secret, err := phrase.Read()
+	if err != nil {
+		return nil, err
+	}
+	defer clear(secret)
+	return keyManager.LoadPrivateKeyPEMWithPassphrase(keyPEM, secret)
+}
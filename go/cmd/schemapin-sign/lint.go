@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
+)
+
+var (
+	lintModeFlag string
+	noLint       bool
+	lintMode     core.LintMode
+)
+
+// validateLintFlags parses --lint, which --no-lint overrides.
+func validateLintFlags() error {
+	mode, err := core.ParseLintMode(lintModeFlag)
+	if err != nil {
+		return fmt.Errorf("invalid --lint: %w", err)
+	}
+	lintMode = mode
+	if noLint {
+		lintMode = core.LintOff
+	}
+	return nil
+}
+
+// lintSchema checks schema for secrets and dangerous content before it is
+// signed and returns the findings. They are printed to stderr as
+// warnings, or with --json only reported under "lint". With --lint=strict
+// any finding refuses the schema, and the findings are printed even with
+// --json.
+func lintSchema(input string, schema map[string]interface{}) ([]core.LintFinding, error) {
+	findings, err := core.LintForSigning(schema, lintMode)
+	if len(findings) > 0 && !quiet && (!jsonOutput || err != nil) {
+		label := "warning"
+		if err != nil {
+			label = "error"
+		}
+		for _, finding := range findings {
+			fmt.Fprintf(os.Stderr, "lint %s: %s: %s\n", label, input, finding)
+		}
+	}
+	if err != nil {
+		return findings, fmt.Errorf("refusing to sign %s: %w", input, err)
+	}
+	return findings, nil
+}
+
+// lintFindings returns the findings of a schema refused by lintSchema, or
+// nil for other errors.
+func lintFindings(err error) []core.LintFinding {
+	var lintErr *core.LintError
+	if errors.As(err, &lintErr) {
+		return lintErr.Findings
+	}
+	return nil
+}
@@ -14,8 +14,13 @@ import (
 	"github.com/spf13/cobra"
 
 	"github.com/ThirdKeyAi/schemapin/go/internal/version"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/provenance"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/skill"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/utils"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
 )
 
 var (
@@ -23,6 +28,7 @@ var (
 	schemaFile   string
 	batchDir     string
 	stdinInput   bool
+	inputFormat  string
 	outputFile   string
 	outputDir    string
 	developer    string
@@ -35,13 +41,28 @@ var (
 	verbose      bool
 	quiet        bool
 	jsonOutput   bool
+
+	maxSchemaBytes int64
+	maxSchemaDepth int
+
+	// canonicalization is --canonicalization, the algorithm schemas are
+	// signed under.
+	canonicalization string
 )
 
 type SignedSchema struct {
-	Schema    map[string]interface{} `json:"schema"`
-	Signature string                 `json:"signature"`
-	SignedAt  string                 `json:"signed_at"`
-	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	SchemapinVersion string                 `json:"schemapin_version"`
+	Canonicalization string                 `json:"canonicalization"`
+	Schema           map[string]interface{} `json:"schema"`
+	Signature        string                 `json:"signature"`
+	SignedAt         string                 `json:"signed_at"`
+	Metadata         map[string]interface{} `json:"metadata,omitempty"`
+	// Signatures and SchemaHash are set once --append adds a second
+	// signature.
+	Signatures []verification.SignatureEntry `json:"signatures,omitempty"`
+	SchemaHash string                        `json:"schema_hash,omitempty"`
+	// Provenance is the DSSE envelope given with --provenance.
+	Provenance *provenance.Envelope `json:"provenance,omitempty"`
 }
 
 type ProcessResult struct {
@@ -49,6 +70,8 @@ type ProcessResult struct {
 	Output string `json:"output"`
 	Status string `json:"status"`
 	Error  string `json:"error,omitempty"`
+	// Lint lists what the pre-sign linter found in the schema.
+	Lint []core.LintFinding `json:"lint,omitempty"`
 }
 
 func main() {
@@ -58,28 +81,79 @@ func main() {
 		Long: `Sign JSON schema files using ECDSA private keys for SchemaPin verification.
 
 This tool signs individual schemas, processes batches of schema files, or reads
-from stdin to create signed schemas with cryptographic signatures.`,
+from stdin to create signed schemas with cryptographic signatures. With
+--ndjson, stdin is a stream of schemas, one per line. With --append, a
+further signature is added to an already-signed schema, for schemas that
+need several signers.
+
+Every flag can also be set in the "sign" section of a config file or in a
+SCHEMAPIN_* environment variable such as SCHEMAPIN_KEY, with the command line
+taking precedence over the environment and the environment over the file.`,
 		Example: `  schemapin-sign --key private.pem --schema schema.json --output signed_schema.json
 		schemapin-sign --key private.pem --schema schema.json --developer "Alice Corp" --schema-version "1.0"
 		schemapin-sign --key private.pem --batch schemas/ --output-dir signed/
-		echo '{"type": "object"}' | schemapin-sign --key private.pem --stdin`,
-		RunE: runSign,
-	}
+		schemapin-sign --key private.pem --batch schemas/ --output-dir signed/ --manifest signed/manifest.json --build-id "$BUILD_ID"
+		schemapin-sign --key private.pem --schema tool.yaml --input-format yaml --output signed_schema.json
+		schemapin-sign --key reviewer.pem --append signed_schema.json
+		schemapin-sign --key private.pem --skill-archive my-skill.zip --domain example.com
+		schemapin-sign --key private.pem --skill-archive bundle.zip --domain example.com --nested exclude
+		schemapin-sign --key private.pem --schema schema.json --provenance build.intoto.json --output signed_schema.json
+		schemapin-sign --key private.pem --openapi api.yaml --paths '/tools/*' --output api.signed.yaml
+		schemapin-sign --key private.pem --index signed/ --base-url https://example.com/tools/ --output index.json
+		schemapin-sign --key encrypted.pem --passphrase-env SCHEMAPIN_PASSPHRASE --schema schema.json
+		schemapin-sign --key-env SIGNING_KEY --schema schema.json --output signed_schema.json
+		vault read -field=pem secret/signing | schemapin-sign --key - --batch schemas/ --output-dir signed/
+		generate-schema | schemapin-sign --key-fd 3 --stdin 3<"$KEY_PATH"
+		echo '{"type": "object"}' | schemapin-sign --key private.pem --stdin
+		generate-schemas | schemapin-sign --key private.pem --stdin --ndjson --concurrency 8 > signed.ndjson`,
+		PersistentPreRunE: applyConfig,
+		RunE:              runSign,
+	}
+
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "Config file (default: ./schemapin.yaml, then $XDG_CONFIG_HOME/schemapin/schemapin.yaml)")
+	rootCmd.PersistentFlags().BoolVar(&selfTest, "self-test", false, "Check the crypto stack (randomness, signing, PEM, canonicalization and a known test vector) before running")
 
 	// Input options
 	rootCmd.Flags().StringVar(&schemaFile, "schema", "", "Input schema file")
 	rootCmd.Flags().StringVar(&batchDir, "batch", "", "Directory containing schema files to sign")
 	rootCmd.Flags().BoolVar(&stdinInput, "stdin", false, "Read schema from stdin")
-	rootCmd.MarkFlagsOneRequired("schema", "batch", "stdin")
-	rootCmd.MarkFlagsMutuallyExclusive("schema", "batch", "stdin")
+	rootCmd.Flags().StringVar(&inputFormat, "input-format", "json", "Input schema format: json or yaml")
+	rootCmd.Flags().StringVar(&skillArchive, "skill-archive", "", "Skill archive (.zip, .tar.gz) to sign in place")
+	rootCmd.Flags().StringVar(&skillDomain, "domain", "", "Signing domain recorded in a skill signature")
+	rootCmd.Flags().StringArrayVar(&mutablePaths, "mutable", nil, "Glob of skill files that may change after signing, e.g. 'state/**' (repeatable, --skill-archive only)")
+	rootCmd.Flags().BoolVar(&trackExecBit, "track-exec-bit", false, "Record each skill file's executable bit in the signature (--skill-archive only)")
+	rootCmd.Flags().BoolVar(&progressJSON, "progress-json", false, "Write skill hashing progress to stderr as JSON lines instead of a progress bar (--skill-archive only)")
+	rootCmd.Flags().StringVar(&nestedMode, "nested", "", "How to sign nested skills, folders with their own .schemapin.sig: include, exclude or fail (default fail; --skill-archive only)")
+	rootCmd.Flags().StringVar(&openAPIFile, "openapi", "", "OpenAPI document (JSON or YAML) whose operations are signed under x-schemapin")
+	rootCmd.Flags().StringArrayVar(&openAPIPaths, "paths", nil, "With --openapi, only sign operations whose path matches this glob, e.g. '/tools/*' (repeatable)")
+	rootCmd.Flags().BoolVar(&ndjsonInput, "ndjson", false, "With --stdin, sign one schema per line and write one signed schema per line")
+	rootCmd.Flags().IntVar(&concurrency, "concurrency", 1, "Schemas signed in parallel with --ndjson (output keeps input order)")
+	rootCmd.Flags().StringVar(&appendFile, "append", "", "Add a signature to this already-signed schema file (written in place unless --output is given)")
+	rootCmd.Flags().StringVar(&expectHash, "expect", "", "Refuse to sign unless the schema or skill hash is this sha256:<hex> value (see the hash subcommand)")
+	rootCmd.Flags().StringVar(&provenanceFile, "provenance", "", "Attach this DSSE envelope of in-toto provenance, refusing to sign unless it names the schema or skill hash as a subject")
+	rootCmd.Flags().StringVar(&indexDir, "index", "", "Build and sign a tool index of the signed schemas in this directory")
+	rootCmd.Flags().StringVar(&baseURL, "base-url", "", "With --index, the URL the signed schema files are published under")
+	rootCmd.MarkFlagsOneRequired("schema", "batch", "stdin", "skill-archive", "openapi", "append", "index")
+	rootCmd.MarkFlagsMutuallyExclusive("schema", "batch", "stdin", "skill-archive", "openapi", "append", "index")
 
 	// Key options
-	rootCmd.Flags().StringVar(&keyFile, "key", "", "Private key file (PEM format)")
-	_ = rootCmd.MarkFlagRequired("key")
+	rootCmd.Flags().StringVar(&keyFile, "key", "", "Private key file (PEM format); - reads it from stdin")
+	rootCmd.Flags().StringVar(&keyEnv, "key-env", "", "Environment variable holding the private key PEM")
+	rootCmd.Flags().BoolVar(&keyStdin, "key-stdin", false, "Read the private key PEM from stdin (not with --stdin; use --key-fd)")
+	rootCmd.Flags().IntVar(&keyFD, "key-fd", 0, "Open file descriptor to read the private key PEM from, e.g. 3 with 3<key.pem")
+	rootCmd.Flags().StringVar(&passphraseFile, "passphrase-file", "", "File whose first line is the passphrase of an encrypted key; - reads it from stdin")
+	rootCmd.Flags().StringVar(&passphraseEnv, "passphrase-env", "", "Environment variable holding the passphrase of an encrypted key")
+	rootCmd.Flags().IntVar(&passphraseFD, "passphrase-fd", 0, "Open file descriptor whose first line is the passphrase of an encrypted key")
+	rootCmd.MarkFlagsOneRequired("key", "key-env", "key-stdin", "key-fd")
+	rootCmd.MarkFlagsMutuallyExclusive("key", "key-env", "key-stdin", "key-fd")
+	rootCmd.MarkFlagsMutuallyExclusive("passphrase-file", "passphrase-env", "passphrase-fd")
 
 	// Output options
 	rootCmd.Flags().StringVar(&outputFile, "output", "", "Output file (default: stdout for single schema)")
 	rootCmd.Flags().StringVar(&outputDir, "output-dir", "", "Output directory for batch processing")
+	rootCmd.Flags().StringVar(&manifestFile, "manifest", "", "Write a signed manifest of every schema signed in batch mode")
+	rootCmd.Flags().StringVar(&builder, "builder", "", "Builder recorded in the signing manifest")
+	rootCmd.Flags().StringVar(&buildID, "build-id", "", "Build ID recorded in the signing manifest")
 	rootCmd.MarkFlagsMutuallyExclusive("output", "output-dir")
 
 	// Metadata options
@@ -90,6 +164,11 @@ from stdin to create signed schemas with cryptographic signatures.`,
 
 	// Processing options
 	rootCmd.Flags().BoolVar(&noValidate, "no-validate", false, "Skip schema format validation")
+	rootCmd.Flags().StringVar(&lintModeFlag, "lint", "warn", "Pre-sign lint for secrets and dangerous content: warn, strict to refuse schemas with findings, or off")
+	rootCmd.Flags().BoolVar(&noLint, "no-lint", false, "Skip the pre-sign lint")
+	rootCmd.Flags().Int64Var(&maxSchemaBytes, "max-schema-bytes", core.DefaultMaxSchemaBytes, "Refuse schemas whose canonical JSON is larger than this many bytes (0: no limit)")
+	rootCmd.Flags().IntVar(&maxSchemaDepth, "max-depth", core.DefaultMaxSchemaDepth, "Refuse schemas nested deeper than this many objects and arrays (0: no limit)")
+	rootCmd.PersistentFlags().StringVar(&canonicalization, "canonicalization", core.DefaultCanonicalization, "Canonicalization schemas are signed under: schemapin-v1, or jcs for RFC 8785")
 	rootCmd.Flags().StringVar(&pattern, "pattern", "*.json", "File pattern for batch processing")
 	rootCmd.Flags().StringVar(&suffix, "suffix", "_signed", "Suffix for output files in batch mode")
 
@@ -99,6 +178,11 @@ from stdin to create signed schemas with cryptographic signatures.`,
 	rootCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output results as JSON")
 	rootCmd.MarkFlagsMutuallyExclusive("quiet", "verbose")
 
+	rootCmd.AddCommand(newDiffCmd())
+	rootCmd.AddCommand(newHashCmd())
+	rootCmd.AddCommand(newMigrateCmd())
+	rootCmd.AddCommand(newRevokeSignatureCmd())
+
 	rootCmd.Version = version.GetVersion()
 
 	if err := rootCmd.Execute(); err != nil {
@@ -108,21 +192,69 @@ from stdin to create signed schemas with cryptographic signatures.`,
 
 func runSign(cmd *cobra.Command, args []string) error {
 	// Validate arguments
+	if inputFormat != "json" && inputFormat != "yaml" {
+		return fmt.Errorf("invalid --input-format %q (expected json or yaml)", inputFormat)
+	}
 	if batchDir != "" && outputDir == "" {
 		return fmt.Errorf("--output-dir is required for batch processing")
 	}
+	if manifestFile != "" && batchDir == "" {
+		return fmt.Errorf("--manifest requires --batch")
+	}
+	if err := validateNDJSONFlags(); err != nil {
+		return err
+	}
+	if err := validateLintFlags(); err != nil {
+		return err
+	}
+	if expectHash != "" && (batchDir != "" || ndjsonInput || openAPIFile != "" || indexDir != "") {
+		return fmt.Errorf("--expect signs a single schema or skill archive and cannot be used with --batch, --ndjson, --openapi or --index")
+	}
+	if len(openAPIPaths) > 0 && openAPIFile == "" {
+		return fmt.Errorf("--paths requires --openapi")
+	}
+	if (indexDir == "") != (baseURL == "") {
+		return fmt.Errorf("--index and --base-url must be given together")
+	}
+	if len(mutablePaths) > 0 && skillArchive == "" {
+		return fmt.Errorf("--mutable requires --skill-archive")
+	}
+	if trackExecBit && skillArchive == "" {
+		return fmt.Errorf("--track-exec-bit requires --skill-archive")
+	}
+	if progressJSON && skillArchive == "" {
+		return fmt.Errorf("--progress-json requires --skill-archive")
+	}
+	if nestedMode != "" {
+		if skillArchive == "" {
+			return fmt.Errorf("--nested requires --skill-archive")
+		}
+		if _, err := skill.ParseNestedMode(nestedMode); err != nil {
+			return err
+		}
+	}
+	if err := validateCanonicalization(); err != nil {
+		return err
+	}
+	if err := loadProvenance(); err != nil {
+		return err
+	}
 
 	// Load private key
-	keyData, err := os.ReadFile(keyFile)
+	source, err := keySource()
 	if err != nil {
-		return fmt.Errorf("failed to read private key file: %w", err)
+		return err
 	}
-
-	keyManager := crypto.NewKeyManager()
-	privateKey, err := keyManager.LoadPrivateKeyPEM(string(keyData))
+	privateKey, err := loadPrivateKey(source)
 	if err != nil {
 		return fmt.Errorf("failed to load private key: %w", err)
 	}
+	// Skill archives and manifests load the key themselves; hand them the
+	// decrypted key so they do not need the passphrase.
+	privateKeyPEM, err := crypto.NewKeyManager().ExportPrivateKeyPEM(privateKey)
+	if err != nil {
+		return fmt.Errorf("failed to export private key: %w", err)
+	}
 
 	// Load additional metadata
 	var additionalMetadata map[string]interface{}
@@ -151,6 +283,10 @@ func runSign(cmd *cobra.Command, args []string) error {
 		metadata[k] = v
 	}
 
+	if ndjsonInput {
+		return processNDJSON(privateKey, metadata)
+	}
+
 	var results []ProcessResult
 
 	if stdinInput {
@@ -163,7 +299,39 @@ func runSign(cmd *cobra.Command, args []string) error {
 
 	} else if schemaFile != "" {
 		// Process single schema
-		result, err := processSingleSchema(schemaFile, privateKey, outputFile, metadata)
+		result, err := processSingleSchema(schemaFile, privateKey, outputFile, metadata, nil)
+		if err != nil {
+			return err
+		}
+		results = append(results, result)
+
+	} else if skillArchive != "" {
+		// Sign skill archive in place
+		result, err := processSkillArchive(skillArchive, privateKeyPEM)
+		if err != nil {
+			return err
+		}
+		results = append(results, result)
+
+	} else if appendFile != "" {
+		// Add a signature to a signed schema
+		result, err := processAppend(appendFile, privateKey)
+		if err != nil {
+			return err
+		}
+		results = append(results, result)
+
+	} else if openAPIFile != "" {
+		// Sign OpenAPI operations
+		result, err := processOpenAPI(openAPIFile, privateKeyPEM)
+		if err != nil {
+			return err
+		}
+		results = append(results, result)
+
+	} else if indexDir != "" {
+		// Build a tool index
+		result, err := processIndex(indexDir, privateKeyPEM)
 		if err != nil {
 			return err
 		}
@@ -171,11 +339,20 @@ func runSign(cmd *cobra.Command, args []string) error {
 
 	} else if batchDir != "" {
 		// Process batch
-		batchResults, err := processBatch(batchDir, privateKey, outputDir, metadata)
+		session, err := newSigningSession(privateKeyPEM)
+		if err != nil {
+			return err
+		}
+		batchResults, err := processBatch(batchDir, privateKey, outputDir, metadata, session)
 		if err != nil {
 			return err
 		}
 		results = append(results, batchResults...)
+		if session != nil {
+			if err := writeSigningManifest(session); err != nil {
+				return err
+			}
+		}
 	}
 
 	// Output results
@@ -197,6 +374,12 @@ func runSign(cmd *cobra.Command, args []string) error {
 
 		if len(results) > 1 {
 			fmt.Printf("Processed %d schemas: %d successful, %d failed\n", len(results), successful, failed)
+		} else if successful == 1 && openAPIFile != "" && outputFile != "" {
+			fmt.Printf("Successfully signed OpenAPI document: %s\n", results[0].Output)
+		} else if successful == 1 && appendFile != "" {
+			fmt.Printf("Successfully added signature: %s\n", results[0].Output)
+		} else if successful == 1 && skillArchive != "" {
+			fmt.Printf("Successfully signed skill archive: %s\n", results[0].Output)
 		} else if successful == 1 && !stdinInput && outputFile != "" {
 			fmt.Printf("Successfully signed schema: %s\n", results[0].Output)
 		}
@@ -211,14 +394,18 @@ func processStdin(privateKey *ecdsa.PrivateKey, metadata map[string]interface{})
 		return ProcessResult{}, fmt.Errorf("failed to read from stdin: %w", err)
 	}
 
-	var schema map[string]interface{}
-	if err := json.Unmarshal(stdinData, &schema); err != nil {
-		return ProcessResult{}, fmt.Errorf("failed to parse JSON from stdin: %w", err)
+	schema, err := parseSchema(stdinData)
+	if err != nil {
+		return ProcessResult{}, fmt.Errorf("failed to parse schema from stdin: %w", err)
 	}
 
 	if !noValidate && !validateSchemaFormat(schema) {
 		return ProcessResult{}, fmt.Errorf("schema format validation failed for stdin input")
 	}
+	findings, err := lintSchema("stdin", schema)
+	if err != nil {
+		return ProcessResult{}, err
+	}
 
 	signedSchema, err := signSchema(schema, privateKey, metadata)
 	if err != nil {
@@ -247,10 +434,13 @@ func processStdin(privateKey *ecdsa.PrivateKey, metadata map[string]interface{})
 		Input:  "stdin",
 		Output: outputDest,
 		Status: "success",
+		Lint:   findings,
 	}, nil
 }
 
-func processSingleSchema(schemaPath string, privateKey *ecdsa.PrivateKey, outputPath string, metadata map[string]interface{}) (ProcessResult, error) {
+// processSingleSchema signs schemaPath. With a session the signature is
+// made through it and recorded in the manifest under the output file name.
+func processSingleSchema(schemaPath string, privateKey *ecdsa.PrivateKey, outputPath string, metadata map[string]interface{}, session *utils.SigningSession) (ProcessResult, error) {
 	schema, err := loadSchema(schemaPath)
 	if err != nil {
 		return ProcessResult{}, err
@@ -259,12 +449,25 @@ func processSingleSchema(schemaPath string, privateKey *ecdsa.PrivateKey, output
 	if !noValidate && !validateSchemaFormat(schema) {
 		return ProcessResult{}, fmt.Errorf("schema format validation failed for %s", schemaPath)
 	}
-
-	signedSchema, err := signSchema(schema, privateKey, metadata)
+	findings, err := lintSchema(schemaPath, schema)
 	if err != nil {
 		return ProcessResult{}, err
 	}
 
+	var signedSchema *SignedSchema
+	if session != nil {
+		signature, err := session.SignSchema(filepath.Base(outputPath), schema)
+		if err != nil {
+			return ProcessResult{}, err
+		}
+		signedSchema = newSignedSchema(schema, signature, metadata)
+	} else {
+		signedSchema, err = signSchema(schema, privateKey, metadata)
+		if err != nil {
+			return ProcessResult{}, err
+		}
+	}
+
 	outputDest := "stdout"
 	if outputPath != "" {
 		outputJSON, err := json.MarshalIndent(signedSchema, "", "  ")
@@ -287,10 +490,11 @@ func processSingleSchema(schemaPath string, privateKey *ecdsa.PrivateKey, output
 		Input:  schemaPath,
 		Output: outputDest,
 		Status: "success",
+		Lint:   findings,
 	}, nil
 }
 
-func processBatch(batchPath string, privateKey *ecdsa.PrivateKey, outputPath string, metadata map[string]interface{}) ([]ProcessResult, error) {
+func processBatch(batchPath string, privateKey *ecdsa.PrivateKey, outputPath string, metadata map[string]interface{}, session *utils.SigningSession) ([]ProcessResult, error) {
 	if err := os.MkdirAll(outputPath, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create output directory: %w", err)
 	}
@@ -309,15 +513,20 @@ func processBatch(batchPath string, privateKey *ecdsa.PrivateKey, outputPath str
 		base := filepath.Base(file)
 		ext := filepath.Ext(base)
 		name := strings.TrimSuffix(base, ext)
+		if inputFormat == "yaml" {
+			// Signed schemas are always written as JSON
+			ext = ".json"
+		}
 		outputFile := filepath.Join(outputPath, fmt.Sprintf("%s%s%s", name, suffix, ext))
 
-		result, err := processSingleSchema(file, privateKey, outputFile, metadata)
+		result, err := processSingleSchema(file, privateKey, outputFile, metadata, session)
 		if err != nil {
 			results = append(results, ProcessResult{
 				Input:  file,
 				Output: "",
 				Status: "error",
 				Error:  err.Error(),
+				Lint:   lintFindings(err),
 			})
 			if !quiet && !jsonOutput {
 				fmt.Fprintf(os.Stderr, "Error processing %s: %v\n", file, err)
@@ -339,14 +548,51 @@ func loadSchema(schemaPath string) (map[string]interface{}, error) {
 		return nil, fmt.Errorf("failed to read schema file: %w", err)
 	}
 
+	schema, err := parseSchema(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse schema %s: %w", schemaPath, err)
+	}
+
+	return schema, nil
+}
+
+// parseSchema decodes schema data in the --input-format format. YAML is
+// converted to the JSON data model, so the signature is the same as for the
+// equivalent JSON schema.
+func parseSchema(data []byte) (map[string]interface{}, error) {
+	if inputFormat == "yaml" {
+		return core.ParseYAMLSchema(data)
+	}
+
 	var schema map[string]interface{}
 	if err := json.Unmarshal(data, &schema); err != nil {
-		return nil, fmt.Errorf("failed to parse JSON schema: %w", err)
+		return nil, fmt.Errorf("invalid JSON: %w", err)
 	}
-
 	return schema, nil
 }
 
+// validateCanonicalization checks --canonicalization. Manifests, OpenAPI
+// documents, tool indexes and skills are always signed under the default
+// algorithm, and --append keeps the algorithm of the signed schema.
+func validateCanonicalization() error {
+	if _, err := core.LookupCanonicalization(canonicalization); err != nil {
+		return err
+	}
+	if canonicalization != core.DefaultCanonicalization && (manifestFile != "" || openAPIFile != "" || indexDir != "" || skillArchive != "" || appendFile != "") {
+		return fmt.Errorf("--canonicalization %s signs schemas given with --schema, --batch or --stdin and cannot be used with --manifest, --openapi, --index, --skill-archive or --append", canonicalization)
+	}
+	return nil
+}
+
+// validationLimits returns the schema limits set by --max-schema-bytes and
+// --max-depth, with the other limits at their defaults.
+func validationLimits() core.ValidationLimits {
+	limits := core.DefaultValidationLimits()
+	limits.MaxBytes = maxSchemaBytes
+	limits.MaxDepth = maxSchemaDepth
+	return limits
+}
+
 func validateSchemaFormat(schema map[string]interface{}) bool {
 	// Basic validation - check for common schema fields
 	_, hasType := schema["type"]
@@ -356,11 +602,19 @@ func validateSchemaFormat(schema map[string]interface{}) bool {
 
 func signSchema(schema map[string]interface{}, privateKey *ecdsa.PrivateKey, metadata map[string]interface{}) (*SignedSchema, error) {
 	// Canonicalize and hash schema
-	core := core.NewSchemaPinCore()
-	schemaHash, err := core.CanonicalizeAndHash(schema)
+	c := core.NewSchemaPinCore(core.WithValidationLimits(validationLimits()))
+	schemaHash, err := c.CanonicalizeAndHashForSignature(schema, core.CurrentSchemapinVersion, canonicalization)
 	if err != nil {
 		return nil, fmt.Errorf("failed to canonicalize schema: %w", err)
 	}
+	if err := core.CheckExpectedHash(expectHash, schemaHash); err != nil {
+		return nil, fmt.Errorf("refusing to sign schema: %w", err)
+	}
+	if attachedProvenance != nil {
+		if err := provenance.CheckSubject(attachedProvenance, schemaHash); err != nil {
+			return nil, fmt.Errorf("refusing to sign schema: %w", err)
+		}
+	}
 
 	// Sign the hash
 	sigManager := crypto.NewSignatureManager()
@@ -369,18 +623,27 @@ func signSchema(schema map[string]interface{}, privateKey *ecdsa.PrivateKey, met
 		return nil, fmt.Errorf("failed to sign schema: %w", err)
 	}
 
-	// Create signed schema
+	signedSchema := newSignedSchema(schema, signature, metadata)
+	signedSchema.Provenance = attachedProvenance
+	return signedSchema, nil
+}
+
+// newSignedSchema wraps schema and its signature in a signed schema
+// document.
+func newSignedSchema(schema map[string]interface{}, signature string, metadata map[string]interface{}) *SignedSchema {
 	signedSchema := &SignedSchema{
-		Schema:    schema,
-		Signature: signature,
-		SignedAt:  time.Now().UTC().Format(time.RFC3339),
+		SchemapinVersion: core.CurrentSchemapinVersion,
+		Canonicalization: canonicalization,
+		Schema:           schema,
+		Signature:        signature,
+		SignedAt:         clock.Format(time.Now()),
 	}
 
 	if len(metadata) > 0 {
 		signedSchema.Metadata = metadata
 	}
 
-	return signedSchema, nil
+	return signedSchema
 }
 
 func countSuccessful(results []ProcessResult) int {
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/utils"
+)
+
+var (
+	manifestFile string
+	builder      string
+	buildID      string
+)
+
+// newSigningSession returns the session batch signing records into for
+// --manifest, or nil when no manifest was requested.
+func newSigningSession(privateKeyPEM string) (*utils.SigningSession, error) {
+	if manifestFile == "" {
+		return nil, nil
+	}
+	workflow, err := utils.NewSchemaSigningWorkflow(privateKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+	return utils.NewSigningSession(workflow, utils.SigningMetadata{
+		Builder: builder,
+		BuildID: buildID,
+	}), nil
+}
+
+// writeSigningManifest finalizes session and writes the signed manifest to
+// --manifest.
+func writeSigningManifest(session *utils.SigningSession) error {
+	data, err := session.Finalize()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(manifestFile, data, 0644); err != nil {
+		return fmt.Errorf("failed to write signing manifest: %w", err)
+	}
+	if verbose && !jsonOutput {
+		fmt.Printf("Wrote signing manifest: %s (%d schemas)\n", manifestFile, len(session.Entries()))
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/legacy"
+)
+
+var (
+	migrateIn        string
+	migrateOut       string
+	migratePublicKey string
+)
+
+func newMigrateCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Convert a schema signed by an early release to the current format",
+		Long: `Verify a legacy signed schema and write it in the current format.
+
+Two legacy variants are recognized, alone or together: the envelope of
+releases before 1.1, which names its fields signed_schema and sig, and the
+hash construction of Go releases before v1.4, which signed the schema hash
+itself rather than its SHA-256.
+
+The legacy signature is verified with --public-key, which defaults to the
+public half of --key. With --key the schema is then re-signed under the
+current rules. Without it, when the original key is gone, the output is
+marked migrated_unsigned and keeps the verified legacy signature under
+legacy_signature as evidence; schemapin-verify accepts such documents only
+with --allow-legacy.`,
+		Example: `  schemapin-sign migrate --in old.json --out new.json --key private.pem
+  schemapin-sign migrate --in old.json --out new.json --public-key retired.pem --key private.pem
+  schemapin-sign migrate --in old.json --out new.json --public-key retired.pem`,
+		Args: cobra.NoArgs,
+		RunE: runMigrate,
+	}
+
+	cmd.Flags().StringVar(&migrateIn, "in", "", "Legacy signed schema file")
+	cmd.Flags().StringVar(&migrateOut, "out", "", "Output file (default: stdout)")
+	cmd.Flags().StringVar(&migratePublicKey, "public-key", "", "Public key file (PEM) the legacy signature was made with (default: that of --key)")
+	cmd.Flags().StringVar(&keyFile, "key", "", "Private key file (PEM format) to re-sign with")
+	cmd.Flags().StringVar(&keyEnv, "key-env", "", "Environment variable holding the private key PEM")
+	cmd.Flags().StringVar(&passphraseFile, "passphrase-file", "", "File whose first line is the passphrase of an encrypted key")
+	cmd.Flags().StringVar(&passphraseEnv, "passphrase-env", "", "Environment variable holding the passphrase of an encrypted key")
+	cmd.MarkFlagsMutuallyExclusive("key", "key-env")
+	cmd.MarkFlagsMutuallyExclusive("passphrase-file", "passphrase-env")
+	_ = cmd.MarkFlagRequired("in")
+
+	return cmd
+}
+
+func runMigrate(cmd *cobra.Command, args []string) error {
+	if canonicalization != core.DefaultCanonicalization {
+		return fmt.Errorf("--canonicalization does not apply to migrate, which re-signs under %s", core.DefaultCanonicalization)
+	}
+	if keyFile == "" && keyEnv == "" && migratePublicKey == "" {
+		return fmt.Errorf("--public-key is required without --key")
+	}
+
+	data, err := os.ReadFile(migrateIn)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", migrateIn, err)
+	}
+	doc, err := legacy.Parse(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", migrateIn, err)
+	}
+
+	var privateKey *ecdsa.PrivateKey
+	if keyFile != "" || keyEnv != "" {
+		source, err := keySource()
+		if err != nil {
+			return err
+		}
+		if privateKey, err = loadPrivateKey(source); err != nil {
+			return err
+		}
+	}
+
+	var publicKey *ecdsa.PublicKey
+	if migratePublicKey != "" {
+		keyData, err := os.ReadFile(migratePublicKey)
+		if err != nil {
+			return fmt.Errorf("failed to read public key file: %w", err)
+		}
+		if publicKey, err = crypto.NewKeyManager().LoadPublicKeyPEM(string(keyData)); err != nil {
+			return fmt.Errorf("failed to load public key: %w", err)
+		}
+	} else {
+		publicKey = &privateKey.PublicKey
+	}
+
+	// Verified once to report the legacy variants, and again by Migrate
+	result, err := legacy.Verify(doc, publicKey)
+	if err != nil {
+		return err
+	}
+	migrated, err := legacy.Migrate(doc, publicKey, privateKey, time.Now())
+	if err != nil {
+		return fmt.Errorf("cannot migrate %s: %w", migrateIn, err)
+	}
+
+	output, err := json.MarshalIndent(migrated, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal migrated schema: %w", err)
+	}
+	if migrateOut == "" {
+		fmt.Println(string(output))
+		return nil
+	}
+	if err := os.WriteFile(migrateOut, append(output, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", migrateOut, err)
+	}
+
+	if migrated.MigratedUnsigned {
+		fmt.Fprintf(os.Stderr, "Migrated %s (%s) to %s without re-signing; it is marked migrated_unsigned\n", migrateIn, result.Warning(), migrateOut)
+	} else {
+		fmt.Fprintf(os.Stderr, "Migrated %s (%s) to %s, re-signed\n", migrateIn, result.Warning(), migrateOut)
+	}
+	return nil
+}
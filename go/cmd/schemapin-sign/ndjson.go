@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/utils"
+)
+
+var (
+	ndjsonInput bool
+	concurrency int
+)
+
+// validateNDJSONFlags checks the flags --ndjson combines with.
+func validateNDJSONFlags() error {
+	if !ndjsonInput {
+		if concurrency != 1 {
+			return fmt.Errorf("--concurrency requires --ndjson")
+		}
+		return nil
+	}
+	switch {
+	case !stdinInput:
+		return fmt.Errorf("--ndjson requires --stdin")
+	case inputFormat != "json":
+		return fmt.Errorf("--ndjson requires --input-format json")
+	case jsonOutput:
+		return fmt.Errorf("--ndjson already writes JSON; it cannot be combined with --json")
+	case concurrency < 1:
+		return fmt.Errorf("--concurrency must be at least 1")
+	}
+	return nil
+}
+
+// processNDJSON signs one schema per line of stdin and writes one signed
+// schema per line to --output or stdout, in input order. Lines that fail
+// are written as {"error": ..., "line": N} and do not stop the stream.
+func processNDJSON(privateKey *ecdsa.PrivateKey, metadata map[string]interface{}) error {
+	var out io.Writer = os.Stdout
+	if outputFile != "" {
+		file, err := os.Create(outputFile)
+		if err != nil {
+			return fmt.Errorf("failed to create output file: %w", err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	sign := func(line []byte) (interface{}, error) {
+		schema, err := parseSchema(line)
+		if err != nil {
+			return nil, err
+		}
+		if !noValidate && !validateSchemaFormat(schema) {
+			return nil, fmt.Errorf("schema format validation failed")
+		}
+		if _, err := lintSchema("stdin", schema); err != nil {
+			return nil, err
+		}
+		return signSchema(schema, privateKey, metadata)
+	}
+
+	stats, err := utils.ProcessNDJSON(context.Background(), os.Stdin, out, sign, utils.NDJSONOptions{Concurrency: concurrency})
+	if err != nil {
+		return err
+	}
+	if !quiet && (verbose || stats.Failed > 0) {
+		fmt.Fprintf(os.Stderr, "Processed %d schemas: %d successful, %d failed\n", stats.Lines, stats.Lines-stats.Failed, stats.Failed)
+	}
+	return nil
+}
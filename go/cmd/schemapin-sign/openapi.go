@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/utils"
+)
+
+var (
+	openAPIFile  string
+	openAPIPaths []string
+)
+
+// processOpenAPI signs the operations of an OpenAPI document selected by
+// --paths and writes the document with the embedded signatures to --output,
+// or stdout.
+func processOpenAPI(docPath, privateKeyPEM string) (ProcessResult, error) {
+	doc, err := os.ReadFile(docPath)
+	if err != nil {
+		return ProcessResult{}, fmt.Errorf("failed to read OpenAPI document: %w", err)
+	}
+	selector, err := utils.OpenAPIPathSelector(openAPIPaths)
+	if err != nil {
+		return ProcessResult{}, err
+	}
+	workflow, err := utils.NewSchemaSigningWorkflow(privateKeyPEM, utils.WithSigningValidationLimits(validationLimits()))
+	if err != nil {
+		return ProcessResult{}, err
+	}
+
+	signedDoc, signed, err := utils.SignOpenAPIOperations(doc, selector, workflow)
+	if err != nil {
+		return ProcessResult{}, fmt.Errorf("failed to sign %s: %w", docPath, err)
+	}
+	if verbose && !jsonOutput {
+		for _, op := range signed {
+			fmt.Fprintf(os.Stderr, "Signed %s: %s\n", op.Key(), op.Signature.SchemaHash)
+		}
+	}
+
+	outputDest := "stdout"
+	if outputFile != "" {
+		if err := os.WriteFile(outputFile, signedDoc, 0644); err != nil {
+			return ProcessResult{}, fmt.Errorf("failed to write output file: %w", err)
+		}
+		outputDest = outputFile
+	} else {
+		fmt.Print(string(signedDoc))
+	}
+
+	return ProcessResult{
+		Input:  docPath,
+		Output: outputDest,
+		Status: "success",
+	}, nil
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/provenance"
+)
+
+var (
+	provenanceFile string
+
+	// attachedProvenance is the envelope read from --provenance, attached
+	// to every schema or skill signed
+	attachedProvenance *provenance.Envelope
+)
+
+// loadProvenance reads the DSSE envelope named by --provenance into
+// attachedProvenance. Each schema or skill it is attached to must be one
+// of its statement's subjects, which signSchema and the skill signer check.
+func loadProvenance() error {
+	if provenanceFile == "" {
+		return nil
+	}
+	if batchDir != "" || openAPIFile != "" || appendFile != "" {
+		return fmt.Errorf("--provenance cannot be used with --batch, --openapi or --append")
+	}
+	data, err := os.ReadFile(provenanceFile)
+	if err != nil {
+		return fmt.Errorf("failed to read provenance file: %w", err)
+	}
+	var env provenance.Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return fmt.Errorf("failed to parse provenance file: %w", err)
+	}
+	if _, err := env.Statement(); err != nil {
+		return fmt.Errorf("invalid provenance file %s: %w", provenanceFile, err)
+	}
+	attachedProvenance = &env
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/revocation"
+)
+
+var (
+	revokeSchemaFile     string
+	revokeRevocationFile string
+	revokeDomain         string
+	revokeReason         string
+)
+
+func newRevokeSignatureCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "revoke-signature",
+		Short: "Revoke the signature of a single schema without revoking the key",
+		Long: `Add a revoked_signatures entry for a schema to a revocation document.
+
+The schema is canonicalized and hashed (sha256:<hex>), and the hash is
+appended to the document so verifiers reject that schema's signature while
+every other schema signed by the same key stays valid. The document is
+created when it does not exist yet, in which case --domain is required.`,
+		Example: `  schemapin-sign revoke-signature --schema signed_schema.json --revocation-file revocations.json
+  schemapin-sign revoke-signature --schema schema.json --revocation-file revocations.json --domain example.com --reason superseded`,
+		RunE: runRevokeSignature,
+	}
+
+	cmd.Flags().StringVar(&revokeSchemaFile, "schema", "", "Schema file to revoke (bare schema or signed schema)")
+	cmd.Flags().StringVar(&revokeRevocationFile, "revocation-file", "", "Revocation document to update")
+	cmd.Flags().StringVar(&revokeDomain, "domain", "", "Domain for a newly created revocation document")
+	cmd.Flags().StringVar(&revokeReason, "reason", string(revocation.ReasonSuperseded), "Revocation reason")
+	_ = cmd.MarkFlagRequired("schema")
+	_ = cmd.MarkFlagRequired("revocation-file")
+
+	return cmd
+}
+
+func runRevokeSignature(cmd *cobra.Command, args []string) error {
+	schema, err := loadSchemaOrSigned(revokeSchemaFile)
+	if err != nil {
+		return err
+	}
+
+	hash, err := core.NewSchemaPinCore().CanonicalizeAndHash(schema)
+	if err != nil {
+		return fmt.Errorf("failed to canonicalize schema: %w", err)
+	}
+	schemaHash := core.FormatSchemaHash(hash)
+
+	doc, err := loadOrCreateRevocationDocument(revokeRevocationFile, revokeDomain)
+	if err != nil {
+		return err
+	}
+
+	if revocation.CheckSignatureRevocation(doc, schemaHash) != nil {
+		fmt.Printf("Signature for %s is already revoked (%s)\n", revokeSchemaFile, schemaHash)
+		return nil
+	}
+	revocation.AddRevokedSignature(doc, schemaHash, revocation.RevocationReason(revokeReason))
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal revocation document: %w", err)
+	}
+	if err := os.WriteFile(revokeRevocationFile, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write revocation document: %w", err)
+	}
+
+	fmt.Printf("Revoked signature for %s (%s) in %s\n", revokeSchemaFile, schemaHash, revokeRevocationFile)
+	return nil
+}
+
+func loadOrCreateRevocationDocument(path, domain string) (*revocation.RevocationDocument, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		if domain == "" {
+			return nil, fmt.Errorf("--domain is required to create %s", path)
+		}
+		return revocation.BuildRevocationDocument(domain), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read revocation document: %w", err)
+	}
+
+	var doc revocation.RevocationDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse revocation document: %w", err)
+	}
+	return &doc, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/ThirdKeyAi/schemapin/go/internal/progress"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/skill"
+)
+
+var (
+	skillArchive string
+	skillDomain  string
+	mutablePaths []string
+	trackExecBit bool
+	nestedMode   string
+	progressJSON bool
+)
+
+// processSkillArchive signs a .zip or .tar.gz skill archive in place.
+func processSkillArchive(archivePath, privateKeyPEM string) (ProcessResult, error) {
+	if skillDomain == "" {
+		return ProcessResult{}, fmt.Errorf("--domain is required with --skill-archive")
+	}
+
+	// A bar on a terminal stderr, JSON lines with --progress-json
+	bar := progress.New(os.Stderr, archivePath, progress.Options{Quiet: quiet, JSON: progressJSON})
+	sig, err := skill.SignSkillArchive(archivePath, privateKeyPEM, skillDomain, skill.SignOptions{
+		ExpectedHash: expectHash,
+		MutablePaths: mutablePaths,
+		TrackExecBit: trackExecBit,
+		Provenance:   attachedProvenance,
+		Nested:       skill.NestedMode(nestedMode),
+		Progress:     bar.Func(),
+	})
+	bar.Finish()
+	if err != nil {
+		return ProcessResult{}, err
+	}
+	if verbose && !jsonOutput {
+		fmt.Printf("Signed skill %s: %s (%d files)\n", sig.SkillName, sig.SkillHash, len(sig.FileManifest))
+		if len(sig.MutablePaths) > 0 {
+			fmt.Printf("Mutable paths: %v\n", sig.MutablePaths)
+		}
+		dirs := make([]string, 0, len(sig.NestedSkills))
+		for dir := range sig.NestedSkills {
+			dirs = append(dirs, dir)
+		}
+		sort.Strings(dirs)
+		for _, dir := range dirs {
+			fmt.Printf("Nested skill %s: %s\n", dir, sig.NestedSkills[dir])
+		}
+	}
+
+	return ProcessResult{
+		Input:  archivePath,
+		Output: archivePath,
+		Status: "success",
+	}, nil
+}
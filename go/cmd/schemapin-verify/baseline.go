@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/utils"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+var (
+	baselineDir       string
+	baselineUpdate    bool
+	baselineCanonical bool
+	failOnChange      bool
+
+	// baselineStore is opened from --baseline; nil leaves schemas
+	// uncompared
+	baselineStore *utils.BaselineStore
+)
+
+// loadBaselineStore opens the --baseline directory, or returns nil when
+// no baseline is used.
+func loadBaselineStore() (*utils.BaselineStore, error) {
+	if baselineDir == "" {
+		if baselineUpdate || baselineCanonical || failOnChange {
+			return nil, fmt.Errorf("--baseline-update, --baseline-canonical and --fail-on-change require --baseline")
+		}
+		return nil, nil
+	}
+	if (schemaFile == "" && batchDir == "" && !stdinInput) || ndjsonInput {
+		return nil, fmt.Errorf("--baseline applies to --schema, --batch and --stdin")
+	}
+	if baselineCanonical && !baselineUpdate {
+		return nil, fmt.Errorf("--baseline-canonical requires --baseline-update")
+	}
+	return utils.NewBaselineStore(baselineDir)
+}
+
+// baselineToolID returns the ID a schema's baseline is kept under: the
+// --tool-id, the ID derived from the schema name and domain, or without a
+// domain the schema name alone.
+func baselineToolID(result *VerificationResult, schema map[string]interface{}) (string, error) {
+	if toolID != "" {
+		return toolID, nil
+	}
+	if result.DerivedToolID != "" {
+		return result.DerivedToolID, nil
+	}
+	if domain != "" {
+		return core.DeriveToolID(domain, schema)
+	}
+	if name, _ := schema["name"].(string); strings.TrimSpace(name) != "" {
+		return strings.TrimSpace(name), nil
+	}
+	return "", core.ErrToolNameMissing
+}
+
+// applyBaseline compares a verified schema with its baseline, reporting a
+// changed key and changed content as warnings, or failing result with
+// --fail-on-change, and records the schema as the new baseline with
+// --baseline-update.
+func applyBaseline(result *VerificationResult, signedSchema *SignedSchema) error {
+	if baselineStore == nil || !result.Valid {
+		return nil
+	}
+	id, err := baselineToolID(result, signedSchema.Schema)
+	if err != nil {
+		return fmt.Errorf("cannot determine the tool ID for --baseline (use --tool-id): %w", err)
+	}
+	comparison, err := baselineStore.Compare(id, signedSchema.Schema, result.KeyFingerprint)
+	if err != nil {
+		return err
+	}
+	result.Baseline = comparison
+
+	var codes []verification.ErrorCode
+	var messages []string
+	if comparison.KeyChanged {
+		codes = append(codes, verification.ErrBaselineKeyChanged)
+		messages = append(messages, fmt.Sprintf("key %s differs from the baseline key %s", comparison.KeyFingerprint, comparison.BaselineKeyFingerprint))
+	}
+	if comparison.ContentChanged {
+		codes = append(codes, verification.ErrContentChanged)
+		messages = append(messages, fmt.Sprintf("schema content %s differs from the baseline %s", comparison.SchemaHash, comparison.BaselineHash))
+	}
+	if failOnChange && len(codes) > 0 {
+		result.Valid = false
+		result.ErrorCode = string(codes[0])
+		result.Error = strings.Join(messages, "; ")
+		return nil
+	}
+	for i, code := range codes {
+		result.Warnings = append(result.Warnings, string(code)+": "+messages[i])
+	}
+
+	if baselineUpdate {
+		if _, err := baselineStore.Update(id, signedSchema.Schema, result.KeyFingerprint, baselineCanonical); err != nil {
+			return err
+		}
+		result.BaselineUpdated = true
+	}
+	return nil
+}
+
+// displayBaseline prints the paths that changed since a result's
+// baseline, and with verbose whether it matched one at all.
+func displayBaseline(result VerificationResult, verbose bool) {
+	comparison := result.Baseline
+	if comparison == nil {
+		return
+	}
+	if verbose {
+		switch {
+		case !comparison.Found:
+			fmt.Printf("   Baseline: none recorded for %s\n", comparison.ToolID)
+		case !comparison.ContentChanged && !comparison.KeyChanged:
+			fmt.Printf("   Baseline: unchanged for %s\n", comparison.ToolID)
+		}
+	}
+	if diff := comparison.Diff; diff != nil {
+		for _, path := range diff.Added {
+			fmt.Printf("   Added since baseline: %s\n", path)
+		}
+		for _, path := range diff.Removed {
+			fmt.Printf("   Removed since baseline: %s\n", path)
+		}
+		for _, path := range diff.Changed {
+			fmt.Printf("   Changed since baseline: %s\n", path)
+		}
+	}
+	if result.BaselineUpdated {
+		fmt.Printf("   Baseline updated: %s\n", comparison.ToolID)
+	}
+}
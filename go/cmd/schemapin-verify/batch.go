@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/utils"
+)
+
+// processResumableBatch verifies files with --state-file, skipping those
+// recorded by an earlier run. Results from the state file are merged with
+// the new ones in file order. An interrupt stops the batch after the file
+// being verified; the results recorded so far are kept for the next run.
+func processResumableBatch(files []string) ([]VerificationResult, error) {
+	pinSetHash, err := currentPinSetHash()
+	if err != nil {
+		return nil, err
+	}
+	batch, err := utils.OpenResumableBatch(stateFile, utils.ResumableBatchOptions{
+		Reset:            resetState,
+		PinSetHash:       pinSetHash,
+		IgnorePinChanges: ignorePinChanges,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer batch.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	entries, summary, err := batch.Run(ctx, files, func(file string) (interface{}, bool, error) {
+		result := processBatchFile(file)
+		return result, result.Valid, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("batch stopped after %d of %d files (resume with the same --state-file): %w", summary.Total, len(files), err)
+	}
+	if verbose {
+		fmt.Fprintf(os.Stderr, "Resumed %d results from %s, verified %d files\n", summary.Resumed, stateFile, summary.Verified)
+	}
+
+	results := make([]VerificationResult, 0, len(entries))
+	for _, entry := range entries {
+		var result VerificationResult
+		if err := json.Unmarshal(entry.Result, &result); err != nil {
+			return nil, fmt.Errorf("invalid result for %s in %s: %w", entry.Path, stateFile, err)
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// currentPinSetHash returns the pin set hash of the pinning database, or
+// an empty string if there is none yet.
+func currentPinSetHash() (string, error) {
+	if _, err := os.Stat(pinningDB); err != nil {
+		return "", nil
+	}
+	pinningManager, err := createPinningManager()
+	if err != nil {
+		return "", fmt.Errorf("failed to create pinning manager: %w", err)
+	}
+	defer pinningManager.Close()
+	return pinningManager.PinSetHash()
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/pinning"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/resolver"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/revocation"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/skill"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+var (
+	allowDomains      []string
+	denyDomains       []string
+	trustBoundaryFile string
+	tlsPinFlags       []string
+
+	// trustBoundary is built from the flags above; nil allows every domain
+	trustBoundary *pinning.TrustBoundary
+)
+
+// loadTrustBoundary combines --trust-boundary-file with any --allow-domain,
+// --deny-domain and --tls-pin flags. It returns nil when none were given.
+func loadTrustBoundary() (*pinning.TrustBoundary, error) {
+	boundary := &pinning.TrustBoundary{}
+	if trustBoundaryFile != "" {
+		loaded, err := pinning.LoadTrustBoundaryFile(trustBoundaryFile)
+		if err != nil {
+			return nil, err
+		}
+		boundary = loaded
+	}
+	boundary.Allow = append(boundary.Allow, allowDomains...)
+	boundary.Deny = append(boundary.Deny, denyDomains...)
+	for _, flag := range tlsPinFlags {
+		host, pin, ok := strings.Cut(flag, "=")
+		if !ok || host == "" {
+			return nil, fmt.Errorf("invalid --tls-pin %q: expected domain=pin", flag)
+		}
+		if boundary.TLSPins == nil {
+			boundary.TLSPins = make(map[string][]string)
+		}
+		boundary.TLSPins[host] = append(boundary.TLSPins[host], pin)
+	}
+
+	if len(boundary.Allow) == 0 && len(boundary.Deny) == 0 && len(boundary.TLSPins) == 0 {
+		return nil, nil
+	}
+	if err := boundary.Validate(); err != nil {
+		return nil, err
+	}
+	return boundary, nil
+}
+
+// discoveryOptions configures discovery clients with the logger and any
+// TLS pins from the trust boundary.
+func discoveryOptions() []discovery.Option {
+	opts := []discovery.Option{discovery.WithLogger(logger)}
+	if trustBoundary != nil && len(trustBoundary.TLSPins) > 0 {
+		opts = append(opts, discovery.WithTLSPins(trustBoundary.TLSPins))
+	}
+	return opts
+}
+
+// domainBlockedResult returns a failed result if d is outside the trust
+// boundary.
+func domainBlockedResult(d, method string) (VerificationResult, bool) {
+	err := trustBoundary.Check(d)
+	if err == nil {
+		return VerificationResult{}, false
+	}
+	return VerificationResult{
+		Valid:              false,
+		VerificationMethod: method,
+		Domain:             d,
+		ErrorCode:          string(verification.ErrDomainBlocked),
+		Error:              err.Error(),
+	}, true
+}
+
+// markBlockedSkills reports signed skills from domains outside the trust
+// boundary as domain_blocked rather than as discovery failures.
+func markBlockedSkills(reports []skill.SkillReport) {
+	for _, report := range reports {
+		if report.Result == nil || report.Result.Valid {
+			continue
+		}
+		if err := trustBoundary.Check(report.Result.Domain); err != nil {
+			report.Result.ErrorCode = verification.ErrDomainBlocked
+			report.Result.ErrorMessage = err.Error()
+		}
+	}
+}
+
+// warnBoundaryViolations prints existing pins that the trust boundary now
+// blocks. The pins are left in place for the operator to review.
+func warnBoundaryViolations() error {
+	if trustBoundary == nil || quiet {
+		return nil
+	}
+	if _, err := os.Stat(pinningDB); err != nil {
+		return nil
+	}
+
+	pinningManager, err := createPinningManager()
+	if err != nil {
+		return fmt.Errorf("failed to create pinning manager: %w", err)
+	}
+	defer pinningManager.Close()
+
+	violations, err := pinningManager.CheckBoundaryViolations()
+	if err != nil {
+		return fmt.Errorf("failed to check pinned keys against trust boundary: %w", err)
+	}
+	for _, v := range violations {
+		fmt.Fprintf(os.Stderr, "⚠️  Pinned key for %s is outside the trust boundary: %s\n", v.ToolID, v.Reason)
+	}
+	return nil
+}
+
+// boundaryResolver refuses discovery for domains outside the trust
+// boundary, so no request is made for them.
+type boundaryResolver struct {
+	next resolver.SchemaResolver
+}
+
+func (r *boundaryResolver) ResolveDiscovery(domain string) (*discovery.WellKnownResponse, error) {
+	if err := trustBoundary.Check(domain); err != nil {
+		return nil, err
+	}
+	return r.next.ResolveDiscovery(domain)
+}
+
+func (r *boundaryResolver) ResolveRevocation(domain string, disc *discovery.WellKnownResponse) (*revocation.RevocationDocument, error) {
+	return r.next.ResolveRevocation(domain, disc)
+}
+
+func (r *boundaryResolver) ResolveDiscoveryWithSource(domain string) (*discovery.WellKnownResponse, string, error) {
+	if err := trustBoundary.Check(domain); err != nil {
+		return nil, "", err
+	}
+	return resolver.ResolveDiscoveryWithSource(r.next, domain)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ThirdKeyAi/schemapin/go/internal/cliconfig"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+)
+
+var (
+	configFile     string
+	configShowJSON bool
+	selfTest       bool
+)
+
+// applyConfig is the root command's PersistentPreRunE. It fills flags not
+// given on the command line from SCHEMAPIN_* variables and the config
+// file, before cobra checks required flags and flag groups. With
+// --self-test it then checks the crypto stack.
+func applyConfig(cmd *cobra.Command, args []string) error {
+	if _, err := cliconfig.Apply(cmd, cliconfig.Options{
+		Section: "verify",
+		File:    configFile,
+		Strict:  cmd == cmd.Root(),
+	}); err != nil {
+		return err
+	}
+	return runSelfTest()
+}
+
+// runSelfTest runs crypto.SelfTest when --self-test is set.
+func runSelfTest() error {
+	if !selfTest {
+		return nil
+	}
+	if err := crypto.SelfTest(); err != nil {
+		return fmt.Errorf("crypto self-test failed: %w", err)
+	}
+	return nil
+}
+
+func newConfigCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config",
+		Short: "Inspect the configuration from config files and environment variables",
+		// The config subcommands report the root command's configuration;
+		// their own flags are not read from it.
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error { return nil },
+	}
+
+	showCmd := &cobra.Command{
+		Use:   "show",
+		Short: "Print the effective value and source of every flag",
+		Long: `Print the value schemapin-verify would use for every flag, merged from
+SCHEMAPIN_* environment variables, the config file and the flag defaults,
+and where each value came from. Credentials in URL values are redacted.`,
+		Args: cobra.NoArgs,
+		RunE: runConfigShow,
+	}
+	showCmd.Flags().BoolVar(&configShowJSON, "json", false, "Output the configuration as JSON")
+
+	cmd.AddCommand(showCmd)
+	return cmd
+}
+
+func runConfigShow(cmd *cobra.Command, args []string) error {
+	config, err := cliconfig.Apply(cmd.Root(), cliconfig.Options{Section: "verify", File: configFile, Strict: true})
+	if err != nil {
+		return err
+	}
+
+	if configShowJSON {
+		outputJSON, err := json.MarshalIndent(map[string]interface{}{
+			"config_file": config.File,
+			"settings":    config.Settings(),
+		}, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal configuration: %w", err)
+		}
+		fmt.Println(string(outputJSON))
+		return nil
+	}
+
+	if config.File != "" {
+		fmt.Printf("Config file: %s\n\n", config.File)
+	} else {
+		fmt.Printf("Config file: none\n\n")
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FLAG\tVALUE\tSOURCE")
+	for _, setting := range config.Settings() {
+		source := string(setting.Source)
+		if setting.Source == cliconfig.SourceEnv {
+			source += " " + setting.Origin
+		}
+		fmt.Fprintf(w, "--%s\t%s\t%s\n", setting.Name, setting.Value, source)
+	}
+	return w.Flush()
+}
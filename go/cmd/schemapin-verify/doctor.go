@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/doctor"
+)
+
+var (
+	doctorDomain     string
+	doctorKeyFile    string
+	doctorSchemaFile string
+	doctorToolID     string
+	doctorJSONOutput bool
+)
+
+func newDoctorCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "doctor",
+		Short: "Check a domain's SchemaPin deployment",
+		Long: `Run a battery of checks against a domain's .well-known/schemapin.json:
+HTTPS and certificate validity, document validation, key parsing and
+fingerprint, revoked_keys and revocation document consistency, response size
+and cache headers.
+
+With --key and --schema, a sample schema is signed with the private key and
+verified against the published key, proving the deployment end to end.
+
+Each check has a stable ID (https, well_known, public_key, revoked_keys,
+revocation_document, response_size, content_type, cache_headers, round_trip).
+Exits with 1 if any check fails.`,
+		Example: `  schemapin-verify doctor --domain example.com
+  schemapin-verify doctor --domain example.com --key private.pem --schema tool.json --json`,
+		RunE: runDoctor,
+	}
+
+	cmd.Flags().StringVar(&doctorDomain, "domain", "", "Domain to check")
+	cmd.Flags().StringVar(&doctorKeyFile, "key", "", "Private key file (PEM) for the sign and verify round trip")
+	cmd.Flags().StringVar(&doctorSchemaFile, "schema", "", "Sample schema file (JSON or YAML) for the round trip")
+	cmd.Flags().StringVar(&doctorToolID, "tool-id", "", "Tool identifier selecting a tool-scoped key for the round trip")
+	cmd.Flags().BoolVar(&doctorJSONOutput, "json", false, "Output the report as JSON")
+	_ = cmd.MarkFlagRequired("domain")
+	cmd.MarkFlagsRequiredTogether("key", "schema")
+
+	return cmd
+}
+
+func runDoctor(cmd *cobra.Command, args []string) error {
+	opts := []doctor.Option{doctor.WithToolID(doctorToolID)}
+	if doctorKeyFile != "" {
+		privateKeyPEM, err := os.ReadFile(doctorKeyFile)
+		if err != nil {
+			return fmt.Errorf("failed to read private key file: %w", err)
+		}
+		schema, err := loadDoctorSchema(doctorSchemaFile)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, doctor.WithRoundTrip(string(privateKeyPEM), schema))
+	}
+
+	report := doctor.New(opts...).Run(context.Background(), doctorDomain)
+
+	if doctorJSONOutput {
+		outputJSON, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal report: %w", err)
+		}
+		fmt.Println(string(outputJSON))
+	} else {
+		displayDoctorReport(report)
+	}
+
+	if !report.OK {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// loadDoctorSchema reads a bare schema, as YAML for .yaml and .yml files and
+// as JSON otherwise.
+func loadDoctorSchema(path string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- path is supplied by the operator
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schema file: %w", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return core.ParseYAMLSchema(data)
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal(data, &schema); err != nil {
+		return nil, fmt.Errorf("failed to parse schema %s: %w", path, err)
+	}
+	return schema, nil
+}
+
+func displayDoctorReport(report *doctor.Report) {
+	fmt.Printf("SchemaPin deployment check for %s\n", report.Domain)
+	fmt.Printf("   URL: %s\n", report.URL)
+	if report.SourceURL != "" && report.SourceURL != report.URL {
+		fmt.Printf("   Served from: %s\n", report.SourceURL)
+	}
+	if report.Fingerprint != "" {
+		fmt.Printf("   Key fingerprint: %s\n", report.Fingerprint)
+	}
+	fmt.Println()
+
+	for _, check := range report.Checks {
+		var symbol string
+		switch check.Status {
+		case doctor.StatusPass:
+			symbol = "✅"
+		case doctor.StatusWarn:
+			symbol = "⚠️ "
+		case doctor.StatusFail:
+			symbol = "❌"
+		default:
+			symbol = "➖"
+		}
+		fmt.Printf("%s %-20s %s\n", symbol, check.ID, check.Message)
+	}
+
+	fmt.Printf("\n%d passed, %d warnings, %d failed, %d skipped\n",
+		report.Count(doctor.StatusPass), report.Count(doctor.StatusWarn),
+		report.Count(doctor.StatusFail), report.Count(doctor.StatusSkip))
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/report"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+// exitCodeDetail is --exit-code-detail: the exit code tells failure
+// classes apart (see report.Outcome) instead of --exit-code's 0 or 1.
+var exitCodeDetail bool
+
+// errorExitCode returns the exit code of a run that stopped with err. With
+// --exit-code-detail, an error carrying a verification error code, e.g. a
+// discovery failure while verifying a single schema, exits by its
+// outcome and any other error, including a bad flag, as an input error.
+func errorExitCode(err error) int {
+	if !exitCodeDetail && !exitCodeDetailRequested(os.Args[1:]) {
+		return 1
+	}
+	return report.OutcomeOf(verification.ErrorCodeOf(err)).ExitCode()
+}
+
+// exitCodeDetailRequested reports whether args set --exit-code-detail, for
+// flag errors that stop parsing before the flag is reached.
+func exitCodeDetailRequested(args []string) bool {
+	for _, arg := range args {
+		if arg == "--" {
+			return false
+		}
+		if value, ok := strings.CutPrefix(arg, "--exit-code-detail"); ok {
+			if value == "" {
+				return true
+			}
+			if value, ok := strings.CutPrefix(value, "="); ok {
+				set, err := strconv.ParseBool(value)
+				return err == nil && set
+			}
+		}
+	}
+	return false
+}
+
+// exitWithOutcome exits by the outcome of results: with --exit-code-detail
+// by its class, with --exit-code 1 for any failure. It returns if neither
+// flag is set or every result verified.
+func exitWithOutcome(outcome report.Outcome) {
+	if outcome == report.OutcomeValid {
+		return
+	}
+	switch {
+	case exitCodeDetail:
+		os.Exit(outcome.ExitCode())
+	case exitCode:
+		os.Exit(1)
+	}
+}
+
+// outcomeTracker accumulates the outcome of results verified concurrently,
+// e.g. the lines of --ndjson.
+type outcomeTracker struct {
+	mu      sync.Mutex
+	outcome report.Outcome
+}
+
+func (t *outcomeTracker) add(outcome report.Outcome) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.outcome = max(t.outcome, outcome)
+}
+
+func (t *outcomeTracker) get() report.Outcome {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.outcome
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/legacy"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/utils"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+// allowLegacy is --allow-legacy: schemas signed by early releases, in the
+// v0 envelope or under the v0 hash construction, and migrated_unsigned
+// documents verify, with a legacy_signature warning.
+var allowLegacy bool
+
+// parseLegacySignedSchema reads a document of an early release or a
+// migrated_unsigned one. Without --allow-legacy it fails with a pointer to
+// the flag and to schemapin-sign migrate instead of as a malformed
+// document.
+func parseLegacySignedSchema(data []byte) (*SignedSchema, error) {
+	doc, err := legacy.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	if !allowLegacy {
+		what := legacy.Describe(doc.Envelope, "")
+		if doc.Migrated {
+			what = "migrated_unsigned"
+		}
+		return nil, fmt.Errorf("schema is signed in a legacy format (%s); verify it with --allow-legacy or convert it with schemapin-sign migrate", what)
+	}
+	return &SignedSchema{
+		SchemapinVersion: doc.SchemapinVersion,
+		Canonicalization: doc.Canonicalization,
+		Schema:           doc.Schema,
+		Signature:        doc.Signature,
+		SignedAt:         doc.SignedAt,
+		Metadata:         doc.Metadata,
+		legacy:           doc,
+	}, nil
+}
+
+// verifyLegacySignature checks a single signature that failed under the
+// current rules under the v0 hash construction, and with --allow-legacy
+// records the warning of a signature that verified under legacy rules. It
+// returns the threshold result to use in place of threshold.
+//
+// Without --allow-legacy, a signature that verifies only under the v0 hash
+// construction still fails, but says so.
+func verifyLegacySignature(signedSchema *SignedSchema, schemaHash []byte, publicKeyPEM string, threshold *verification.ThresholdResult) *verification.ThresholdResult {
+	hash := legacy.HashCurrent
+	if !threshold.Valid {
+		if multiSignature(signedSchema) {
+			return threshold
+		}
+		publicKey, err := crypto.NewKeyManager().LoadPublicKeyPEM(publicKeyPEM)
+		if err != nil {
+			return threshold
+		}
+		var ok bool
+		if hash, ok = legacy.VerifySignature(schemaHash, signedSchema.Signature, publicKey); !ok {
+			return threshold
+		}
+		if !allowLegacy {
+			failed := *threshold
+			failed.ErrorMessage += "; it verifies under the " + legacy.Describe(legacy.EnvelopeCurrent, hash) + ", accepted with --allow-legacy or convertible with schemapin-sign migrate"
+			return &failed
+		}
+		threshold = &verification.ThresholdResult{Valid: true, Required: 1}
+	} else if !allowLegacy {
+		return threshold
+	}
+	signedSchema.legacyWarning = legacyWarning(signedSchema, hash)
+	return threshold
+}
+
+// applyLegacyWarning replaces the bare legacy_signature warning of a
+// workflow result, which stands for the v0 hash construction, with one that
+// names every legacy variant the schema used.
+func applyLegacyWarning(result *VerificationResult, signedSchema *SignedSchema) {
+	if !allowLegacy || !result.Valid {
+		return
+	}
+	hash := legacy.HashCurrent
+	if i := slices.Index(result.Warnings, utils.WarningLegacySignature); i >= 0 {
+		hash = legacy.HashV0
+		result.Warnings = slices.Delete(result.Warnings, i, i+1)
+	}
+	if warning := legacyWarning(signedSchema, hash); warning != "" {
+		result.Warnings = append(result.Warnings, warning)
+	}
+}
+
+// legacyWarning returns the legacy_signature warning of a signature of
+// signedSchema that verified under the hash construction hash, or "" if
+// neither it nor the envelope is legacy.
+func legacyWarning(signedSchema *SignedSchema, hash legacy.HashConstruction) string {
+	result := legacy.Result{Valid: true, Envelope: legacy.EnvelopeCurrent, Hash: hash}
+	if signedSchema.legacy != nil {
+		result.Envelope, result.Migrated = signedSchema.legacy.Envelope, signedSchema.legacy.Migrated
+	}
+	if !result.Legacy() {
+		return ""
+	}
+	return fmt.Sprintf("%s: %s; convert it with schemapin-sign migrate", verification.WarningLegacySignature, result.Warning())
+}
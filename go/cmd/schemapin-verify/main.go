@@ -4,10 +4,13 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -17,45 +20,171 @@ import (
 	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/interactive"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/legacy"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/pinning"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/provenance"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/report"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/utils"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
 )
 
 var (
-	schemaFile      string
-	batchDir        string
-	stdinInput      bool
-	publicKeyFile   string
-	domain          string
-	toolID          string
-	pinningDB       string
-	interactiveMode bool
-	autoPin         bool
-	pattern         string
-	verbose         bool
-	quiet           bool
-	jsonOutput      bool
-	exitCode        bool
+	schemaFile        string
+	schemaHashFlag    string
+	batchDir          string
+	stdinInput        bool
+	inputFormat       string
+	signatureB64      string
+	publicKeyFile     string
+	wellKnownFile     string
+	domain            string
+	toolID            string
+	pinningDB         string
+	storeKeySource    string
+	interactiveMode   bool
+	autoPin           bool
+	requirePinned     bool
+	readOnlyPins      bool
+	policyFile        string
+	pattern           string
+	stateFile         string
+	noAggregate       bool
+	maxExamples       int
+	verbose           bool
+	visualFingerprint bool
+	quiet             bool
+	jsonOutput        bool
+	outputFormat      string
+	includePasses     bool
+	exitCode          bool
+
+	assumeFirstUseAccept   bool
+	reconsider             bool
+	strictDiscoveryVersion bool
+	resetState             bool
+	ignorePinChanges       bool
+	dryRun                 bool
+
+	maxSchemaBytes int64
+	maxSchemaDepth int
+
+	// logger receives library diagnostics; see newLogger
+	logger *slog.Logger
 )
 
 type SignedSchema struct {
-	Schema    map[string]interface{} `json:"schema"`
-	Signature string                 `json:"signature"`
-	SignedAt  string                 `json:"signed_at,omitempty"`
-	Metadata  map[string]interface{} `json:"metadata,omitempty"`
+	// SchemapinVersion is absent from documents written before versioning
+	// was introduced; those are verified under the legacy rules.
+	SchemapinVersion string `json:"schemapin_version,omitempty"`
+	// Canonicalization names the algorithm the schema was hashed with.
+	// Documents without it use the version's default algorithm.
+	Canonicalization string                 `json:"canonicalization,omitempty"`
+	Schema           map[string]interface{} `json:"schema"`
+	Signature        string                 `json:"signature"`
+	SignedAt         string                 `json:"signed_at,omitempty"`
+	Metadata         map[string]interface{} `json:"metadata,omitempty"`
+	// Signatures holds the signatures of a schema signed by several keys.
+	// Without it, Signature is checked as the only signature.
+	Signatures []verification.SignatureEntry `json:"signatures,omitempty"`
+	// Provenance is an optional DSSE envelope with in-toto provenance for
+	// the schema, checked with --verify-provenance.
+	Provenance *provenance.Envelope `json:"provenance,omitempty"`
+	// MigratedUnsigned marks a document written by schemapin-sign migrate
+	// without a key, which is read as the legacy document it came from.
+	MigratedUnsigned bool `json:"migrated_unsigned,omitempty"`
+
+	// legacy is the document of an early release read with --allow-legacy,
+	// and legacyWarning the warning of a signature that verified under
+	// legacy rules
+	legacy        *legacy.Document
+	legacyWarning string
+	// schemaHash, set by --hash, is verified in place of Schema
+	schemaHash []byte
+	// timer times the steps of the verification with --timings
+	timer *verification.Timer
+}
+
+// hash returns the hash the signature is verified against: the --hash
+// value, or that of the canonicalized schema.
+func (s *SignedSchema) hash() ([]byte, error) {
+	if s.schemaHash != nil {
+		return s.schemaHash, nil
+	}
+	defer s.timer.Stop(verification.TimingCanonicalize, s.timer.Start())
+	schemaHash, err := core.NewSchemaPinCore(core.WithValidationLimits(validationLimits())).CanonicalizeAndHashForSignature(s.Schema, s.SchemapinVersion, s.Canonicalization)
+	if err != nil {
+		return nil, fmt.Errorf("failed to canonicalize schema: %w", err)
+	}
+	return schemaHash, nil
+}
+
+// validationLimits returns the schema limits set by --max-schema-bytes and
+// --max-depth, with the other limits at their defaults.
+func validationLimits() core.ValidationLimits {
+	limits := core.DefaultValidationLimits()
+	limits.MaxBytes = maxSchemaBytes
+	limits.MaxDepth = maxSchemaDepth
+	return limits
 }
 
 type VerificationResult struct {
-	Valid              bool                   `json:"valid"`
-	VerificationMethod string                 `json:"verification_method"`
-	KeyFingerprint     string                 `json:"key_fingerprint,omitempty"`
-	KeySource          string                 `json:"key_source,omitempty"`
-	File               string                 `json:"file,omitempty"`
-	Error              string                 `json:"error,omitempty"`
-	Pinned             bool                   `json:"pinned,omitempty"`
-	FirstUse           bool                   `json:"first_use,omitempty"`
-	DeveloperInfo      map[string]string      `json:"developer_info,omitempty"`
-	SignedAt           string                 `json:"signed_at,omitempty"`
-	Metadata           map[string]interface{} `json:"metadata,omitempty"`
+	Valid              bool              `json:"valid"`
+	VerificationMethod string            `json:"verification_method"`
+	KeyFingerprint     string            `json:"key_fingerprint,omitempty"`
+	SignerKid          string            `json:"signer_kid,omitempty"`
+	KeySource          string            `json:"key_source,omitempty"`
+	Domain             string            `json:"domain,omitempty"`
+	File               string            `json:"file,omitempty"`
+	Error              string            `json:"error,omitempty"`
+	ErrorCode          string            `json:"error_code,omitempty"`
+	Warnings           []string          `json:"warnings,omitempty"`
+	Pinned             bool              `json:"pinned,omitempty"`
+	FirstUse           bool              `json:"first_use,omitempty"`
+	DeveloperInfo      map[string]string `json:"developer_info,omitempty"`
+	SignedAt           string            `json:"signed_at,omitempty"`
+	// DiscoverySchemaVersion is the schema_version of the .well-known
+	// response the key was discovered from.
+	DiscoverySchemaVersion string `json:"discovery_schema_version,omitempty"`
+	// PolicyUpdated is the domain policy recorded from an interactive
+	// "always trust" / "never trust" answer during this verification.
+	PolicyUpdated string                 `json:"policy_updated,omitempty"`
+	Metadata      map[string]interface{} `json:"metadata,omitempty"`
+	// TrustDecision is why the key was trusted, e.g. pre_pinned or
+	// interactive_accept (see pinning.TrustDecision), when a pin was
+	// consulted or made.
+	TrustDecision string `json:"trust_decision,omitempty"`
+	// WouldHave lists, with --dry-run, the pins, prompts and other
+	// database writes that were skipped.
+	WouldHave []string `json:"would_have,omitempty"`
+	// MutableSkipped lists the skill files whose content was not checked
+	// because the signature declares them mutable.
+	MutableSkipped []string `json:"mutable_skipped,omitempty"`
+	// PermissionChanged lists the skill files whose executable bit differs
+	// from the one signed with --track-exec-bit.
+	PermissionChanged []string `json:"permission_changed,omitempty"`
+	// PolicyRule names the --policy rule that failed verification, and
+	// PolicyFindings every rule triggered.
+	PolicyRule     string                       `json:"policy_rule,omitempty"`
+	PolicyFindings []verification.PolicyFinding `json:"policy_findings,omitempty"`
+	// DerivedToolID is the tool ID derived from the schema name and domain
+	// when --tool-id was omitted in discovery mode.
+	DerivedToolID string `json:"derived_tool_id,omitempty"`
+	// SchemaHash is the "sha256:<hex>" hash of the canonical schema, and
+	// for skills SkillHash the root hash computed from the files on disk
+	// and SignedSkillHash the one in the signature.
+	SchemaHash      string `json:"schema_hash,omitempty"`
+	SkillHash       string `json:"skill_hash,omitempty"`
+	SignedSkillHash string `json:"signed_skill_hash,omitempty"`
+	// Signers lists the key fingerprints with a valid signature, and
+	// SignatureFailures the entries that did not count, for schemas with
+	// several signatures.
+	Signers           []string                        `json:"signers,omitempty"`
+	SignatureFailures []verification.SignatureFailure `json:"signature_failures,omitempty"`
+	// Baseline is the comparison with the tool's --baseline snapshot, and
+	// BaselineUpdated whether the schema was recorded as the new one.
+	Baseline        *utils.BaselineComparison `json:"baseline,omitempty"`
+	BaselineUpdated bool                      `json:"baseline_updated,omitempty"`
 }
 
 func main() {
@@ -65,54 +194,252 @@ func main() {
 		Long: `Verify signed JSON schemas using public key discovery or direct public key verification.
 
 This tool verifies cryptographic signatures on schemas and supports interactive
-key pinning for Trust-On-First-Use (TOFU) security.`,
+key pinning for Trust-On-First-Use (TOFU) security.
+
+Every flag can also be set in a config file (--config, or schemapin.yaml in
+the working directory or $XDG_CONFIG_HOME/schemapin/) or in a SCHEMAPIN_*
+environment variable such as SCHEMAPIN_PINNING_DB. The command line takes
+precedence over the environment, and the environment over the file; see
+"schemapin-verify config show".`,
 		Example: `  schemapin-verify --schema signed_schema.json --public-key public.pem
   schemapin-verify --schema signed_schema.json --domain example.com --tool-id my-tool
+  schemapin-verify --batch schemas/ --well-known vendor-schemapin.json
   schemapin-verify --batch schemas/ --domain example.com --auto-pin
-  echo '{"schema": {...}, "signature": "..."}' | schemapin-verify --stdin --domain example.com`,
-		RunE: runVerify,
+  schemapin-verify --schema signed_schema.json --domain platform.example/tenants/acme
+  schemapin-verify --batch registry/ --domain example.com --state-file verify-state.jsonl
+  schemapin-verify --schema tool.json --domain example.com --tool-id my-tool --prompt-mode notify
+  schemapin-verify --schema tool.yaml --input-format yaml --signature "MEUCIQ..." --public-key public.pem
+  schemapin-verify --hash sha256:3f2a... --signature "MEUCIQ..." --domain example.com --tool-id my-tool
+  schemapin-verify --skill ./my-skill --domain example.com --content-policy policy.json
+  schemapin-verify --schema tool.json --domain example.com --tool-id my-tool --policy strict
+  schemapin-verify --schema tool.json --public-key release.pem --require-signatures 2
+  schemapin-verify --skill-archive my-skill.zip --domain example.com
+  schemapin-verify --root ~/.agent/skills --domain example.com
+  schemapin-verify --openapi api.signed.yaml --paths '/tools/*' --require-signed --public-key public.pem
+  echo '{"schema": {...}, "signature": "..."}' | schemapin-verify --stdin --domain example.com
+  schemapin-verify --stdin --ndjson --concurrency 8 --public-key public.pem < signed.ndjson
+  schemapin-verify doctor --domain example.com --key private.pem --schema tool.json`,
+		PersistentPreRunE: applyConfig,
+		RunE:              runVerify,
 	}
 
+	rootCmd.PersistentFlags().StringVar(&configFile, "config", "", "Config file (default: ./schemapin.yaml, then $XDG_CONFIG_HOME/schemapin/schemapin.yaml)")
+	rootCmd.PersistentFlags().BoolVar(&selfTest, "self-test", false, "Check the crypto stack (randomness, signing, PEM, canonicalization and a known test vector) before running")
+
 	// Input options
 	rootCmd.Flags().StringVar(&schemaFile, "schema", "", "Signed schema file to verify")
 	rootCmd.Flags().StringVar(&batchDir, "batch", "", "Directory containing signed schema files")
 	rootCmd.Flags().BoolVar(&stdinInput, "stdin", false, "Read signed schema from stdin")
-	rootCmd.MarkFlagsOneRequired("schema", "batch", "stdin")
-	rootCmd.MarkFlagsMutuallyExclusive("schema", "batch", "stdin")
+	rootCmd.Flags().StringVar(&skillPath, "skill", "", "Signed skill directory to verify")
+	rootCmd.Flags().StringVar(&skillsRoot, "root", "", "Directory of installed skills to verify (one skill per subdirectory)")
+	rootCmd.Flags().StringVar(&inputFormat, "input-format", "json", "Schema file format: json or yaml")
+	rootCmd.Flags().StringVar(&signatureB64, "signature", "", "Detached signature (base64) for a bare schema file")
+	rootCmd.Flags().StringVar(&skillArchive, "skill-archive", "", "Signed skill archive (.zip, .tar.gz) to verify without extracting")
+	rootCmd.Flags().BoolVar(&ndjsonInput, "ndjson", false, "With --stdin, verify one signed schema per line and write one result per line")
+	rootCmd.Flags().IntVar(&concurrency, "concurrency", 1, "Schemas verified in parallel with --ndjson (output keeps input order)")
+	rootCmd.Flags().StringVar(&openAPIFile, "openapi", "", "OpenAPI document (JSON or YAML) whose x-schemapin operation signatures are verified")
+	rootCmd.Flags().IntVar(&requireSignatureCount, "require-signatures", 0, "Require valid signatures from at least this many distinct keys of the published key set")
+	rootCmd.Flags().StringArrayVar(&requireSignerKids, "require-signer", nil, "Require a valid signature from this key fingerprint (repeatable)")
+	rootCmd.Flags().StringVar(&schemaHashFlag, "hash", "", "Schema hash (sha256:<hex>) to verify with --signature instead of a schema file")
+	rootCmd.Flags().Int64Var(&maxSchemaBytes, "max-schema-bytes", core.DefaultMaxSchemaBytes, "Fail schemas whose canonical JSON is larger than this many bytes (0: no limit)")
+	rootCmd.Flags().IntVar(&maxSchemaDepth, "max-depth", core.DefaultMaxSchemaDepth, "Fail schemas nested deeper than this many objects and arrays (0: no limit)")
+	rootCmd.MarkFlagsOneRequired("schema", "hash", "batch", "stdin", "skill", "skill-archive", "root", "openapi")
+	rootCmd.MarkFlagsMutuallyExclusive("schema", "hash", "batch", "stdin", "skill", "skill-archive", "root", "openapi")
+	rootCmd.MarkFlagsMutuallyExclusive("signature", "batch", "skill", "skill-archive", "root", "openapi")
+
+	// Skill options
+	rootCmd.Flags().StringVar(&contentPolicyFile, "content-policy", "", "Content policy file (JSON) enforced on skill contents")
+	rootCmd.MarkFlagsMutuallyExclusive("content-policy", "skill-archive")
+	rootCmd.Flags().BoolVar(&allowNewMutable, "allow-new-mutable", false, "Accept skill files added after signing that match the signature's mutable paths")
+	rootCmd.MarkFlagsMutuallyExclusive("allow-new-mutable", "skill-archive")
+	rootCmd.Flags().BoolVar(&strictPermissions, "strict-permissions", false, "Fail skills whose files' executable bits differ from the signed ones instead of warning")
+	rootCmd.Flags().BoolVar(&progressJSON, "progress-json", false, "Write skill hashing progress to stderr as JSON lines instead of a progress bar")
+
+	// Provenance options
+	rootCmd.Flags().BoolVar(&verifyProvenance, "verify-provenance", false, "Check the in-toto provenance attached to signed schemas and skills and report its builder and source")
+	rootCmd.Flags().StringArrayVar(&provenanceKeyFiles, "provenance-key", nil, "Public key file (PEM) trusted to sign provenance besides the signing key (repeatable)")
+
+	// OpenAPI options
+	rootCmd.Flags().StringArrayVar(&openAPIPaths, "paths", nil, "With --openapi, only verify operations whose path matches this glob, e.g. '/tools/*' (repeatable)")
+	rootCmd.Flags().BoolVar(&requireSigned, "require-signed", false, "With --openapi, fail operations that carry no signature instead of only reporting them")
 
 	// Verification method options
 	rootCmd.Flags().StringVar(&publicKeyFile, "public-key", "", "Public key file for verification (PEM format)")
-	rootCmd.Flags().StringVar(&domain, "domain", "", "Domain for public key discovery")
-	rootCmd.MarkFlagsOneRequired("public-key", "domain")
-	rootCmd.MarkFlagsMutuallyExclusive("public-key", "domain")
+	rootCmd.Flags().StringVar(&domain, "domain", "", "Domain for public key discovery, optionally with a tenant path prefix (platform.example/tenants/acme)")
+	rootCmd.Flags().StringVar(&wellKnownFile, "well-known", "", "Saved .well-known/schemapin.json file for offline verification")
+	rootCmd.MarkFlagsOneRequired("public-key", "domain", "well-known")
+	rootCmd.MarkFlagsMutuallyExclusive("public-key", "domain", "well-known")
 
 	// Discovery and pinning options
-	rootCmd.Flags().StringVar(&toolID, "tool-id", "", "Tool identifier for key pinning")
-	rootCmd.Flags().StringVar(&pinningDB, "pinning-db", "", "Path to key pinning database")
+	rootCmd.Flags().StringVar(&toolID, "tool-id", "", "Tool identifier for key pinning (default: derived from the schema name and domain in discovery mode)")
+	defaultPinningDB, _ := pinning.DefaultDBPath()
+	rootCmd.Flags().StringVar(&pinningDB, "pinning-db", defaultPinningDB, "Path to key pinning database")
+	rootCmd.Flags().StringVar(&storeKeySource, "store-key", "", "Key of an encrypted pinning database: env:NAME, file:PATH or keychain:SERVICE[/ACCOUNT]")
 	rootCmd.Flags().BoolVar(&interactiveMode, "interactive", false, "Enable interactive key pinning prompts")
 	rootCmd.Flags().BoolVar(&autoPin, "auto-pin", false, "Automatically pin keys on first use")
+	rootCmd.Flags().BoolVar(&requirePinned, "require-pinned", false, "Only accept keys pinned in advance; fail tools without a pin instead of discovering and pinning their key")
+	rootCmd.Flags().BoolVar(&readOnlyPins, "read-only-pins", false, "Open the existing pinning database read-only: use its pins but never pin keys or record verifications")
+	rootCmd.Flags().BoolVar(&assumeFirstUseAccept, "assume-first-use-accept", false, "Accept first-time keys without prompting (implies --interactive; key changes are still rejected unless confirmed)")
+	rootCmd.Flags().BoolVar(&reconsider, "reconsider", false, "Prompt again for a key rejected before for the tool instead of failing with key_previously_rejected")
+	rootCmd.Flags().BoolVar(&dryRun, "dry-run", false, "Verify without writing to the pinning database or prompting; report what would have been pinned or asked instead")
+	rootCmd.Flags().StringVar(&promptMode, "prompt-mode", "console", "How to ask for pinning decisions: console or notify (desktop notifications; implies --interactive)")
+	rootCmd.MarkFlagsMutuallyExclusive("require-pinned", "auto-pin")
+	rootCmd.MarkFlagsMutuallyExclusive("require-pinned", "interactive")
+	rootCmd.MarkFlagsMutuallyExclusive("require-pinned", "assume-first-use-accept")
+	rootCmd.MarkFlagsMutuallyExclusive("read-only-pins", "interactive")
+	rootCmd.MarkFlagsMutuallyExclusive("read-only-pins", "assume-first-use-accept")
+	rootCmd.MarkFlagsMutuallyExclusive("read-only-pins", "dry-run")
+	rootCmd.Flags().StringVar(&policyFile, "policy-file", "", "Trust policy file (JSON or YAML) to apply to the pinning database")
+	rootCmd.MarkFlagsMutuallyExclusive("read-only-pins", "policy-file")
+	rootCmd.Flags().BoolVar(&allowLegacy, "allow-legacy", false, "Accept schemas signed by early releases (signed_schema/sig envelope or pre-v1.4 Go hash construction) and migrated_unsigned documents, with a warning")
+	rootCmd.Flags().StringVar(&verificationProfile, "policy", "", "Verification policy profile: strict, default or permissive")
+	rootCmd.Flags().StringVar(&verificationPolicyFile, "verification-policy-file", "", "Verification policy file (JSON or YAML) declaring which checks fail or warn")
+	rootCmd.Flags().DurationVar(&maxSignatureAge, "max-signature-age", 0, "Warn about schemas whose signed_at is older than this, e.g. 720h; fails under a policy whose stale_signatures is fail (0: no limit)")
+	rootCmd.Flags().BoolVar(&strictDiscoveryVersion, "strict-discovery-version", false, "Fail instead of warning when a domain serves an older .well-known schema_version than previously seen")
+
+	// Trust boundary options
+	rootCmd.Flags().StringArrayVar(&allowDomains, "allow-domain", nil, "Only trust this domain or *.suffix pattern (repeatable)")
+	rootCmd.Flags().StringArrayVar(&denyDomains, "deny-domain", nil, "Never trust this domain or *.suffix pattern (repeatable; overrides --allow-domain)")
+	rootCmd.Flags().StringVar(&trustBoundaryFile, "trust-boundary-file", "", "Trust boundary file (JSON or YAML) with allow and deny domain lists and TLS pins")
+	rootCmd.Flags().StringArrayVar(&tlsPinFlags, "tls-pin", nil, "Pin discovery for a domain to a certificate, as domain=base64 SPKI SHA-256 (repeatable)")
 
 	// Batch processing options
 	rootCmd.Flags().StringVar(&pattern, "pattern", "*.json", "File pattern for batch processing")
+	rootCmd.Flags().StringSliceVar(&prefetchDomains, "prefetch-domains", nil, "Fetch these domains' .well-known documents concurrently before verifying, e.g. a.com,b.com")
+	rootCmd.Flags().BoolVar(&strictPrefetch, "strict-prefetch", false, "Fail instead of warning when a --prefetch-domains domain cannot be fetched")
+	rootCmd.Flags().StringVar(&stateFile, "state-file", "", "With --batch, record results in this file and resume from it after an interruption")
+	rootCmd.Flags().BoolVar(&resetState, "reset-state", false, "With --state-file, discard recorded results and verify every file again")
+	rootCmd.Flags().BoolVar(&ignorePinChanges, "ignore-pin-changes", false, "With --state-file, resume recorded results even if the pinned keys changed since")
+	rootCmd.Flags().BoolVar(&noAggregate, "no-aggregate", false, "With --batch, print every file instead of grouping failures by error code, domain and key")
+	rootCmd.Flags().IntVar(&maxExamples, "max-examples", 3, "With --batch, example files printed for each group of failures")
+
+	// Baseline options
+	rootCmd.Flags().StringVar(&baselineDir, "baseline", "", "Directory of reviewed schema snapshots to compare verified schemas against, one per tool ID")
+	rootCmd.Flags().BoolVar(&baselineUpdate, "baseline-update", false, "With --baseline, record each verified schema as the tool's new snapshot")
+	rootCmd.Flags().BoolVar(&baselineCanonical, "baseline-canonical", false, "With --baseline-update, also record the canonical schema so later changes are listed path by path")
+	rootCmd.Flags().BoolVar(&failOnChange, "fail-on-change", false, "With --baseline, fail schemas whose content or key changed since the snapshot instead of warning")
+	rootCmd.MarkFlagsMutuallyExclusive("baseline-update", "fail-on-change")
 
 	// Output options
 	rootCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Verbose output with security information")
+	rootCmd.Flags().BoolVar(&visualFingerprint, "visual-fingerprint", false, "With --verbose, draw the key fingerprint as randomart and emoji for comparison by eye")
 	rootCmd.Flags().BoolVarP(&quiet, "quiet", "q", false, "Quiet output (only errors)")
 	rootCmd.Flags().BoolVar(&jsonOutput, "json", false, "Output results as JSON")
+	rootCmd.Flags().StringVar(&outputFormat, "output-format", "text", "Output format: text, json or sarif")
+	rootCmd.Flags().BoolVar(&includePasses, "include-passes", false, "Include successful verifications in SARIF output")
 	rootCmd.Flags().BoolVar(&exitCode, "exit-code", false, "Exit with non-zero code if any verification fails")
+	rootCmd.Flags().BoolVar(&exitCodeDetail, "exit-code-detail", false, "Exit 2 on a trust failure, 3 if every failure was transient, 4 on an input or usage error")
+	rootCmd.Flags().BoolVar(&timings, "timings", false, "Report how long each verification step took, in JSON output and with --verbose")
 	rootCmd.MarkFlagsMutuallyExclusive("quiet", "verbose")
+	rootCmd.MarkFlagsMutuallyExclusive("json", "output-format")
+	rootCmd.MarkFlagsMutuallyExclusive("exit-code", "exit-code-detail")
+
+	rootCmd.AddCommand(newDoctorCmd())
+	rootCmd.AddCommand(newConfigCmd())
 
 	rootCmd.Version = version.GetVersion()
 
 	if err := rootCmd.Execute(); err != nil {
-		os.Exit(1)
+		os.Exit(errorExitCode(err))
 	}
 }
 
 func runVerify(cmd *cobra.Command, args []string) error {
-	// Validate arguments
-	if domain != "" && interactiveMode && toolID == "" {
-		return fmt.Errorf("--tool-id is required for interactive mode")
+	if assumeFirstUseAccept {
+		interactiveMode = true
+	}
+	if err := validatePromptMode(); err != nil {
+		return err
+	}
+	if value := os.Getenv(interactive.EnvInteractiveDefault); value != "" {
+		if _, err := interactive.ParseDefaultDecision(value); err != nil {
+			return fmt.Errorf("%s: %w", interactive.EnvInteractiveDefault, err)
+		}
+	}
+
+	if inputFormat != "json" && inputFormat != "yaml" {
+		return fmt.Errorf("invalid --input-format %q (expected json or yaml)", inputFormat)
+	}
+	if (len(openAPIPaths) > 0 || requireSigned) && openAPIFile == "" {
+		return fmt.Errorf("--paths and --require-signed require --openapi")
+	}
+	if schemaHashFlag != "" && signatureB64 == "" {
+		return fmt.Errorf("--hash requires --signature")
+	}
+	if progressJSON && skillPath == "" && skillArchive == "" && skillsRoot == "" {
+		return fmt.Errorf("--progress-json requires --skill, --skill-archive or --root")
+	}
+	if requirePinned && (domain == "" || skillPath != "" || skillArchive != "" || skillsRoot != "") {
+		return fmt.Errorf("--require-pinned requires --domain and applies to schemas only")
+	}
+	if readOnlyPins && (domain == "" || skillPath != "" || skillArchive != "" || skillsRoot != "") {
+		return fmt.Errorf("--read-only-pins requires --domain and applies to schemas only")
+	}
+	if requireSignatureCount > 0 || len(requireSignerKids) > 0 {
+		if requirePinned || readOnlyPins || skillPath != "" || skillArchive != "" || skillsRoot != "" || openAPIFile != "" {
+			return fmt.Errorf("--require-signatures and --require-signer apply to signed schemas and cannot be used with --require-pinned or --read-only-pins")
+		}
+	}
+	if visualFingerprint && !verbose {
+		return fmt.Errorf("--visual-fingerprint requires --verbose")
+	}
+	if stateFile != "" && batchDir == "" {
+		return fmt.Errorf("--state-file requires --batch")
+	}
+	if (resetState || ignorePinChanges) && stateFile == "" {
+		return fmt.Errorf("--reset-state and --ignore-pin-changes require --state-file")
+	}
+	if (noAggregate || cmd.Flags().Changed("max-examples")) && batchDir == "" {
+		return fmt.Errorf("--no-aggregate and --max-examples require --batch")
+	}
+	if maxExamples < 0 {
+		return fmt.Errorf("--max-examples must not be negative")
+	}
+
+	switch outputFormat {
+	case "text":
+	case "json":
+		jsonOutput = true
+	case "sarif":
+	default:
+		return fmt.Errorf("invalid --output-format %q (expected text, json or sarif)", outputFormat)
+	}
+	if err := validateNDJSONFlags(); err != nil {
+		return err
+	}
+	logger = newLogger()
+
+	var err error
+	if trustBoundary, err = loadTrustBoundary(); err != nil {
+		return err
+	}
+	if verificationPolicy, err = loadVerificationPolicy(); err != nil {
+		return err
+	}
+	if provenanceConfig, err = loadProvenanceConfig(); err != nil {
+		return err
+	}
+	if baselineStore, err = loadBaselineStore(); err != nil {
+		return err
+	}
+
+	if policyFile != "" {
+		if err := applyPolicyFile(); err != nil {
+			return err
+		}
+	}
+	if err := warnBoundaryViolations(); err != nil {
+		return err
+	}
+	if err := runPrefetch(); err != nil {
+		return err
+	}
+
+	if skillsRoot != "" {
+		return runVerifyRoot()
+	}
+	if ndjsonInput {
+		return processNDJSON()
 	}
 
 	var results []VerificationResult
@@ -133,6 +460,38 @@ func runVerify(cmd *cobra.Command, args []string) error {
 		}
 		results = append(results, result)
 
+	} else if schemaHashFlag != "" {
+		// Process a pre-computed schema hash
+		result, err := processSchemaHash(schemaHashFlag)
+		if err != nil {
+			return err
+		}
+		results = append(results, result)
+
+	} else if skillPath != "" {
+		// Process skill directory
+		result, err := processSkill(skillPath)
+		if err != nil {
+			return err
+		}
+		results = append(results, result)
+
+	} else if skillArchive != "" {
+		// Process skill archive
+		result, err := processSkillArchive(skillArchive)
+		if err != nil {
+			return err
+		}
+		results = append(results, result)
+
+	} else if openAPIFile != "" {
+		// Process OpenAPI operations
+		openAPIResults, err := processOpenAPI(openAPIFile)
+		if err != nil {
+			return err
+		}
+		results = append(results, openAPIResults...)
+
 	} else if batchDir != "" {
 		// Process batch
 		batchResults, err := processBatch(batchDir)
@@ -143,7 +502,11 @@ func runVerify(cmd *cobra.Command, args []string) error {
 	}
 
 	// Output results
-	if jsonOutput {
+	if outputFormat == "sarif" {
+		if err := writeSARIF(reportResults(results)); err != nil {
+			return err
+		}
+	} else if jsonOutput {
 		output := map[string]interface{}{
 			"results": results,
 			"total":   len(results),
@@ -155,6 +518,14 @@ func runVerify(cmd *cobra.Command, args []string) error {
 			return fmt.Errorf("failed to marshal result: %w", err)
 		}
 		fmt.Println(string(outputJSON))
+	} else if batchDir != "" && !noAggregate {
+		// Human-readable batch output, one block per group of failures
+		if !quiet {
+			if err := report.WriteGroups(os.Stdout, report.Aggregate(reportResults(results), maxExamples)); err != nil {
+				return err
+			}
+			fmt.Printf("\nSummary: %d/%d schemas verified successfully\n", countValid(results), len(results))
+		}
 	} else {
 		// Human-readable output
 		if !quiet {
@@ -170,13 +541,46 @@ func runVerify(cmd *cobra.Command, args []string) error {
 	}
 
 	// Exit code handling
-	if exitCode {
-		invalidCount := countInvalid(results)
-		if invalidCount > 0 {
-			os.Exit(1)
+	exitWithOutcome(report.Classify(reportResults(results)))
+
+	return nil
+}
+
+// runVerifyRoot handles --root, which reports per-skill states rather than
+// individual verification results. Unsigned skills do not affect the exit
+// code; any signed skill that fails verification does, by its class with
+// --exit-code-detail.
+func runVerifyRoot() error {
+	reports, err := processSkillsRoot(skillsRoot)
+	if err != nil {
+		return err
+	}
+
+	if outputFormat == "sarif" {
+		if err := writeSARIF(skillReportResults(reports)); err != nil {
+			return err
+		}
+	} else if jsonOutput {
+		output := map[string]interface{}{
+			"skills": reports,
+			"total":  len(reports),
+			"failed": countFailedSkills(reports),
 		}
+		outputJSON, err := json.MarshalIndent(output, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal result: %w", err)
+		}
+		fmt.Println(string(outputJSON))
+	} else if !quiet {
+		displaySkillReports(reports)
 	}
 
+	if countFailedSkills(reports) > 0 {
+		if exitCodeDetail {
+			os.Exit(report.Classify(skillReportResults(reports)).ExitCode())
+		}
+		os.Exit(1)
+	}
 	return nil
 }
 
@@ -186,25 +590,38 @@ func processStdin() (VerificationResult, error) {
 		return VerificationResult{}, fmt.Errorf("failed to read from stdin: %w", err)
 	}
 
-	var signedSchema SignedSchema
-	if err := json.Unmarshal(stdinData, &signedSchema); err != nil {
-		return VerificationResult{}, fmt.Errorf("failed to parse JSON from stdin: %w", err)
+	signedSchema, err := parseSignedSchema(stdinData)
+	if err != nil {
+		return VerificationResult{}, fmt.Errorf("failed to parse signed schema from stdin: %w", err)
 	}
 
-	if signedSchema.Schema == nil || signedSchema.Signature == "" {
+	if signedSchema.Schema == nil || (signedSchema.Signature == "" && len(signedSchema.Signatures) == 0) {
 		return VerificationResult{}, fmt.Errorf("invalid signed schema format from stdin")
 	}
 
-	result, err := verifySignedSchema(&signedSchema)
+	result, err := verifySignedSchema(signedSchema)
 	if err != nil {
 		return VerificationResult{}, err
 	}
+	if err := applyBaseline(&result, signedSchema); err != nil {
+		return VerificationResult{}, err
+	}
 
-	result.Metadata = signedSchema.Metadata
+	result.Metadata = withSchemaMetadata(result.Metadata, signedSchema.Metadata)
 	result.SignedAt = signedSchema.SignedAt
 	return result, nil
 }
 
+// processSchemaHash verifies --signature over a schema hash computed
+// elsewhere, following the same path as a schema file.
+func processSchemaHash(value string) (VerificationResult, error) {
+	schemaHash, err := core.ParseSchemaHash(value)
+	if err != nil {
+		return VerificationResult{}, fmt.Errorf("invalid --hash: %w", err)
+	}
+	return verifySignedSchema(&SignedSchema{Signature: signatureB64, schemaHash: schemaHash})
+}
+
 func processSingleSchema(schemaPath string) (VerificationResult, error) {
 	signedSchema, err := loadSignedSchema(schemaPath)
 	if err != nil {
@@ -215,9 +632,12 @@ func processSingleSchema(schemaPath string) (VerificationResult, error) {
 	if err != nil {
 		return VerificationResult{}, err
 	}
+	if err := applyBaseline(&result, signedSchema); err != nil {
+		return VerificationResult{}, err
+	}
 
 	result.File = schemaPath
-	result.Metadata = signedSchema.Metadata
+	result.Metadata = withSchemaMetadata(result.Metadata, signedSchema.Metadata)
 	result.SignedAt = signedSchema.SignedAt
 	return result, nil
 }
@@ -231,52 +651,140 @@ func processBatch(batchPath string) ([]VerificationResult, error) {
 	if len(files) == 0 {
 		return nil, fmt.Errorf("no schema files found matching pattern '%s' in %s", pattern, batchPath)
 	}
+	if stateFile != "" {
+		return processResumableBatch(files)
+	}
 
 	var results []VerificationResult
 	for _, file := range files {
-		result, err := processSingleSchema(file)
-		if err != nil {
-			results = append(results, VerificationResult{
-				File:               file,
-				Valid:              false,
-				Error:              err.Error(),
-				VerificationMethod: getVerificationMethod(),
-			})
-		} else {
-			results = append(results, result)
-		}
+		results = append(results, processBatchFile(file))
 	}
 
 	return results, nil
 }
 
+// processBatchFile verifies one file of a batch, reporting an error as a
+// failed result with the error code err carries, if any.
+func processBatchFile(file string) VerificationResult {
+	result, err := processSingleSchema(file)
+	if err != nil {
+		return VerificationResult{
+			File:               file,
+			Valid:              false,
+			Error:              err.Error(),
+			ErrorCode:          string(verification.ErrorCodeOf(err)),
+			VerificationMethod: getVerificationMethod(),
+		}
+	}
+	return result
+}
+
 func loadSignedSchema(schemaPath string) (*SignedSchema, error) {
 	data, err := os.ReadFile(schemaPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read schema file: %w", err)
 	}
 
-	var signedSchema SignedSchema
-	if err := json.Unmarshal(data, &signedSchema); err != nil {
-		return nil, fmt.Errorf("failed to parse JSON schema: %w", err)
+	signedSchema, err := parseSignedSchema(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse schema %s: %w", schemaPath, err)
 	}
 
-	if signedSchema.Schema == nil || signedSchema.Signature == "" {
+	if signedSchema.Schema == nil || (signedSchema.Signature == "" && len(signedSchema.Signatures) == 0) {
 		return nil, fmt.Errorf("invalid signed schema format - missing required fields")
 	}
 
+	return signedSchema, nil
+}
+
+// parseSignedSchema decodes data in the --input-format format. With
+// --signature the data is the bare schema; otherwise it is a signed schema
+// envelope, or with --allow-legacy that of an early release. YAML is
+// converted to the JSON data model first, so YAML and JSON documents with
+// the same content share signatures.
+func parseSignedSchema(data []byte) (*SignedSchema, error) {
+	if inputFormat == "yaml" {
+		document, err := core.ParseYAMLSchema(data)
+		if err != nil {
+			return nil, err
+		}
+		if signatureB64 != "" {
+			return &SignedSchema{Schema: document, Signature: signatureB64}, nil
+		}
+		if data, err = json.Marshal(document); err != nil {
+			return nil, err
+		}
+	} else if signatureB64 != "" {
+		var schema map[string]interface{}
+		if err := json.Unmarshal(data, &schema); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+		return &SignedSchema{Schema: schema, Signature: signatureB64}, nil
+	}
+
+	if legacy.Sniff(data) == legacy.EnvelopeV0 {
+		return parseLegacySignedSchema(data)
+	}
+	var signedSchema SignedSchema
+	if err := json.Unmarshal(data, &signedSchema); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if signedSchema.MigratedUnsigned {
+		return parseLegacySignedSchema(data)
+	}
 	return &signedSchema, nil
 }
 
 func verifySignedSchema(signedSchema *SignedSchema) (VerificationResult, error) {
+	if _, err := core.RulesForVersion(signedSchema.SchemapinVersion); err != nil {
+		return VerificationResult{
+			Valid:              false,
+			VerificationMethod: getVerificationMethod(),
+			ErrorCode:          string(verification.ErrUnsupportedVersion),
+			Error:              err.Error(),
+		}, nil
+	}
+	if _, err := core.LookupCanonicalization(signedSchema.Canonicalization); err != nil {
+		return VerificationResult{
+			Valid:              false,
+			VerificationMethod: getVerificationMethod(),
+			ErrorCode:          string(verification.ErrCanonicalizationUnsupported),
+			Error:              err.Error(),
+		}, nil
+	}
+
+	if signedSchema.schemaHash == nil {
+		if err := validationLimits().Check(signedSchema.Schema); err != nil {
+			return VerificationResult{
+				Valid:              false,
+				VerificationMethod: getVerificationMethod(),
+				ErrorCode:          string(verification.ErrSchemaTooComplex),
+				Error:              err.Error(),
+			}, nil
+		}
+	}
+
+	timer := verification.NewTimer(timings)
+	signedSchema.timer = timer
+	start := timer.Start()
+	var result VerificationResult
+	var err error
 	if publicKeyFile != "" {
-		return verifyWithPublicKey(signedSchema.Schema, signedSchema.Signature)
+		result, err = verifyWithPublicKey(signedSchema)
+	} else if wellKnownFile != "" {
+		result, err = verifyWithWellKnownFile(signedSchema)
 	} else {
-		return verifyWithDiscovery(signedSchema.Schema, signedSchema.Signature)
+		result, err = verifyWithDiscovery(signedSchema)
 	}
+	if err != nil {
+		return result, err
+	}
+	timer.Stop(verification.TimingTotal, start)
+	result.Metadata = timer.Record(result.Metadata)
+	return result, nil
 }
 
-func verifyWithPublicKey(schema map[string]interface{}, signature string) (VerificationResult, error) {
+func verifyWithPublicKey(signedSchema *SignedSchema) (VerificationResult, error) {
 	// Load public key
 	keyData, err := os.ReadFile(publicKeyFile)
 	if err != nil {
@@ -290,41 +798,160 @@ func verifyWithPublicKey(schema map[string]interface{}, signature string) (Verif
 	}
 
 	// Canonicalize and hash schema
-	core := core.NewSchemaPinCore()
-	schemaHash, err := core.CanonicalizeAndHash(schema)
+	schemaHash, err := signedSchema.hash()
 	if err != nil {
-		return VerificationResult{}, fmt.Errorf("failed to canonicalize schema: %w", err)
+		return VerificationResult{}, err
 	}
 
-	// Verify signature
-	sigManager := crypto.NewSignatureManager()
-	isValid := sigManager.VerifySchemaSignature(schemaHash, signature, publicKey)
+	// Verify signatures
+	threshold, err := verifySignatures(signedSchema, schemaHash, string(keyData))
+	if err != nil {
+		return VerificationResult{}, err
+	}
 
 	fingerprint, err := keyManager.CalculateKeyFingerprint(publicKey)
 	if err != nil {
 		fingerprint = "unknown"
 	}
 
-	return VerificationResult{
-		Valid:              isValid,
+	result := VerificationResult{
+		Valid:              threshold.Valid,
 		VerificationMethod: "public_key",
 		KeyFingerprint:     fingerprint,
+		SchemaHash:         core.FormatSchemaHash(schemaHash),
 		KeySource:          publicKeyFile,
-	}, nil
+	}
+	applySignatureResult(&result, signedSchema, threshold)
+	applyProvenance(&result, signedSchema, schemaHash, publicKey)
+	eval := verification.NewPolicyEvaluation(verificationPolicy)
+	applySignedAt(&result, eval, signedSchema, nil)
+	applyPolicyFindings(&result, eval)
+	return result, nil
 }
 
-func verifyWithDiscovery(schema map[string]interface{}, signature string) (VerificationResult, error) {
+// verifyWithWellKnownFile is the discovery path without the network: the key,
+// revocation list and developer info come from a saved .well-known file.
+func verifyWithWellKnownFile(signedSchema *SignedSchema) (VerificationResult, error) {
+	wellKnown, err := discovery.LoadWellKnownFile(wellKnownFile)
+	if err != nil {
+		return VerificationResult{}, err
+	}
+	scoped := wellKnown.KeyForTool(toolID)
+	eval := verification.NewPolicyEvaluation(verificationPolicy)
+	if domain != "" && eval.CheckDomain(domain) {
+		return policyFailedResult(eval, "well_known_file", domain, verification.ErrDomainBlocked, ""), nil
+	}
+
+	keyManager := crypto.NewKeyManager()
+	publicKey, err := keyManager.LoadPublicKeyPEM(scoped.PublicKeyPEM)
+	if err != nil {
+		return VerificationResult{}, fmt.Errorf("failed to load public key from %s: %w", wellKnownFile, err)
+	}
+
+	if discovery.CheckKeyRevocation(scoped.PublicKeyPEM, scoped.RevokedKeys) && eval.Check(verification.RuleRevocation, "public key has been revoked") {
+		result := policyFailedResult(eval, "well_known_file", domain, verification.ErrKeyRevoked, "public key has been revoked")
+		result.KeySource = wellKnownFile
+		return result, nil
+	}
+
+	// Canonicalize and hash schema
+	schemaHash, err := signedSchema.hash()
+	if err != nil {
+		return VerificationResult{}, err
+	}
+
+	threshold, err := verifySignatures(signedSchema, schemaHash, scoped.PublicKeyPEM)
+	if err != nil {
+		return VerificationResult{}, err
+	}
+
+	fingerprint, err := keyManager.CalculateKeyFingerprint(publicKey)
+	if err != nil {
+		fingerprint = "unknown"
+	}
+
+	developerInfo := wellKnown.DeveloperInfo()
+	if scoped.Scope != "" && scoped.DeveloperName != "" {
+		developerInfo["developer_name"] = scoped.DeveloperName
+	}
+
+	result := VerificationResult{
+		Valid:              threshold.Valid,
+		VerificationMethod: "well_known_file",
+		KeyFingerprint:     fingerprint,
+		SchemaHash:         core.FormatSchemaHash(schemaHash),
+		KeySource:          wellKnownFile,
+		DeveloperInfo:      developerInfo,
+	}
+	applySignatureResult(&result, signedSchema, threshold)
+	applyProvenance(&result, signedSchema, schemaHash, publicKey)
+	applySignedAt(&result, eval, signedSchema, wellKnown)
+	applyPolicyFindings(&result, eval)
+	return result, nil
+}
+
+func verifyWithDiscovery(signedSchema *SignedSchema) (VerificationResult, error) {
+	// Without --tool-id, pins are keyed by the ID derived from the schema
+	toolID, derivedToolID := toolID, ""
+	if toolID == "" && signedSchema.Schema != nil {
+		derived, err := core.DeriveToolID(domain, signedSchema.Schema)
+		if err == nil {
+			toolID, derivedToolID = derived, derived
+		} else if interactiveMode {
+			return VerificationResult{}, fmt.Errorf("--tool-id is required for interactive mode: cannot derive tool ID: %w", err)
+		}
+	} else if toolID == "" && interactiveMode {
+		return VerificationResult{}, fmt.Errorf("--tool-id is required for interactive mode with --hash")
+	}
+
+	if blocked, ok := domainBlockedResult(domain, "discovery"); ok {
+		return blocked, nil
+	}
+	eval := verification.NewPolicyEvaluation(verificationPolicy)
+	if eval.CheckDomain(domain) {
+		return policyFailedResult(eval, "discovery", domain, verification.ErrDomainBlocked, ""), nil
+	}
+	if requirePinned || readOnlyPins {
+		return verifyPrePinned(signedSchema, toolID, derivedToolID)
+	}
+
 	// Initialize discovery
-	discoveryClient := discovery.NewPublicKeyDiscovery()
+	discoveryClient := discovery.NewPublicKeyDiscovery(discoveryOptions()...)
 
 	// Get public key from .well-known endpoint
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	publicKeyPEM, err := discoveryClient.GetPublicKeyPEM(ctx, domain)
+	timer := signedSchema.timer
+	t := timer.Start()
+	wellKnown, err := fetchDiscovery(ctx, discoveryClient, domain)
+	timer.Stop(verification.TimingDiscoveryFetch, t)
+	if blocked, ok := discoveryBlockedResult(err, domain, "discovery"); ok {
+		return blocked, nil
+	}
 	if err != nil {
+		if schemaerr.KindOf(err) == nil {
+			err = &schemaerr.Error{Kind: schemaerr.ErrDiscoveryFailed, Domain: domain, Err: err}
+		}
 		return VerificationResult{}, fmt.Errorf("failed to discover public key: %w", err)
 	}
+	publicKeyPEM := wellKnown.PublicKeyPEM
+
+	downgrade, err := checkDiscoveryVersion(domain, wellKnown.SchemaVersion)
+	if err != nil {
+		return VerificationResult{}, err
+	}
+	if downgrade != nil && strictDiscoveryVersion {
+		return VerificationResult{
+			Valid:              false,
+			VerificationMethod: "discovery",
+			Domain:             domain,
+			ErrorCode:          string(verification.ErrDiscoveryDowngrade),
+			Error:              downgrade.Error(),
+
+			DiscoverySchemaVersion: wellKnown.SchemaVersion,
+		}, nil
+	}
 
 	// Load public key
 	keyManager := crypto.NewKeyManager()
@@ -333,110 +960,316 @@ func verifyWithDiscovery(schema map[string]interface{}, signature string) (Verif
 		return VerificationResult{}, fmt.Errorf("failed to load discovered public key: %w", err)
 	}
 
-	// Check if key is revoked
-	isNotRevoked, err := discoveryClient.ValidateKeyNotRevoked(ctx, publicKeyPEM, domain)
-	if err != nil {
-		// If we can't check revocation, proceed with caution
-		isNotRevoked = true
+	// Check if key is revoked. Revocation and developer info come from the
+	// document already fetched, so each verification makes one request.
+	t = timer.Start()
+	notRevoked := wellKnown.KeyNotRevoked(publicKeyPEM)
+	timer.Stop(verification.TimingRevocationCheck, t)
+	if !notRevoked && eval.Check(verification.RuleRevocation, "public key has been revoked") {
+		return policyFailedResult(eval, "discovery", domain, verification.ErrKeyRevoked, "public key has been revoked"), nil
 	}
 
-	if !isNotRevoked {
-		return VerificationResult{
-			Valid:              false,
-			VerificationMethod: "discovery",
-			Error:              "public key has been revoked",
-		}, nil
+	// Canonicalize and hash schema
+	schemaHash, err := signedSchema.hash()
+	if err != nil {
+		return VerificationResult{}, err
 	}
 
-	// Handle interactive pinning if enabled
-	if interactiveMode && toolID != "" {
+	// Verify signatures
+	threshold, err := verifySignatures(signedSchema, schemaHash, publicKeyPEM)
+	if err != nil {
+		return VerificationResult{}, err
+	}
+	isValid := threshold.Valid
+
+	// Handle interactive or policy-driven pinning if enabled. Only a key
+	// with a valid signature is offered for pinning; an invalid signature
+	// counts as a failed verification of an existing pin.
+	var policyUpdated pinning.PinningPolicy
+	var trustDecision pinning.TrustDecision
+	var wouldHave []string
+	unpinned := fmt.Sprintf("no key is pinned for tool %s", toolID)
+	if (interactiveMode || policyFile != "") && toolID != "" {
 		pinningManager, err := createPinningManager()
 		if err != nil {
 			return VerificationResult{}, fmt.Errorf("failed to create pinning manager: %w", err)
 		}
 		defer pinningManager.Close()
-
-		// Get developer info
-		developerInfo, err := discoveryClient.GetDeveloperInfo(ctx, domain)
-		if err != nil {
-			developerInfo = map[string]string{
-				"developer_name": "Unknown",
-				"schema_version": "1.0",
-			}
+		if verbose {
+			fmt.Fprintf(os.Stderr, "Using pinning database %s\n", pinningManager.DBPath())
 		}
 
-		// Verify with interactive pinning
-		pinned, err := pinningManager.VerifyWithInteractivePinning(toolID, domain, publicKeyPEM, developerInfo["developer_name"])
-		if err != nil {
-			return VerificationResult{}, fmt.Errorf("interactive pinning failed: %w", err)
+		t = timer.Start()
+		wasPinned := pinningManager.IsKeyPinned(toolID)
+		timer.Stop(verification.TimingPinLookup, t)
+		if !wasPinned && eval.Check(verification.RuleRequirePinned, unpinned) {
+			return policyFailedResult(eval, getVerificationMethod(), domain, "", ""), nil
 		}
-
-		if !pinned {
-			return VerificationResult{
-				Valid:              false,
-				VerificationMethod: "discovery_interactive",
-				Error:              "key not accepted by user",
-			}, nil
+		if !isValid {
+			if wasPinned && dryRun {
+				wouldHave = append(wouldHave, fmt.Sprintf("would record a failed verification of tool %s", toolID))
+			} else if wasPinned {
+				t = timer.Start()
+				_ = pinningManager.UpdateLastVerified(toolID, false)
+				timer.Stop(verification.TimingPinUpdate, t)
+			}
+		} else {
+			var reconsidered bool
+			if reconsider {
+				fingerprint, err := keyManager.CalculateKeyFingerprint(publicKey)
+				if err == nil && dryRun {
+					var rejected *pinning.RejectedKey
+					rejected, err = pinningManager.GetRejection(toolID, domain, fingerprint)
+					if rejected != nil {
+						wouldHave = append(wouldHave, fmt.Sprintf("would clear the rejection of key %s for tool %s", fingerprint, toolID))
+						reconsidered = true
+					}
+				} else if err == nil {
+					err = pinningManager.ClearRejection(toolID, domain, fingerprint)
+				}
+				if err != nil {
+					return VerificationResult{}, fmt.Errorf("failed to clear key rejection: %w", err)
+				}
+			}
+			// Verify with interactive pinning
+			t = timer.Start()
+			decision, err := pinningManager.InteractivePinKeyWithDecision(toolID, publicKeyPEM, domain, wellKnown.DeveloperInfo()["developer_name"])
+			timer.Stop(verification.TimingPinUpdate, t)
+			if reconsidered && errors.Is(err, schemaerr.ErrKeyPreviouslyRejected) {
+				// The rejection still stands in dry run; once cleared the
+				// key would be offered again
+				prompt := interactive.PromptTypeFirstTimeKey
+				if wasPinned {
+					prompt = interactive.PromptTypeKeyChange
+				}
+				decision, err = pinning.PinDecision{WouldPrompt: prompt}, nil
+				wouldHave = append(wouldHave, fmt.Sprintf("would prompt user: %s for tool %s", prompt, toolID))
+			}
+			if errors.Is(err, schemaerr.ErrKeyPreviouslyRejected) {
+				return VerificationResult{
+					Valid:              false,
+					VerificationMethod: getVerificationMethod(),
+					Domain:             domain,
+					ErrorCode:          string(verification.ErrKeyPreviouslyRejected),
+					Error:              err.Error() + "; use --reconsider to be prompted again",
+				}, nil
+			}
+			if err != nil {
+				return VerificationResult{}, fmt.Errorf("interactive pinning failed: %w", err)
+			}
+			policyUpdated = decision.PolicyUpdated
+			trustDecision = decision.TrustDecision
+			wouldHave = append(wouldHave, decision.WouldHave...)
+
+			// In dry run a key the user would have been asked about is
+			// reported rather than failed
+			if !decision.Accepted && decision.WouldPrompt == "" {
+				return VerificationResult{
+					Valid:              false,
+					VerificationMethod: "discovery_interactive",
+					Domain:             domain,
+					ErrorCode:          string(verification.ErrKeyPinMismatch),
+					Error:              "key not accepted by user",
+					PolicyUpdated:      string(policyUpdated),
+					WouldHave:          wouldHave,
+				}, nil
+			}
+			// A key pinned just now counts as verified once
+			t = timer.Start()
+			if !wasPinned && !dryRun && pinningManager.IsKeyPinned(toolID) {
+				_ = pinningManager.UpdateLastVerified(toolID, true)
+			}
+			timer.Stop(verification.TimingPinUpdate, t)
 		}
+	} else if eval.Check(verification.RuleRequirePinned, unpinned) {
+		// Without a pinning database no key counts as pinned
+		return policyFailedResult(eval, "discovery", domain, "", ""), nil
 	}
 
-	// Canonicalize and hash schema
-	core := core.NewSchemaPinCore()
-	schemaHash, err := core.CanonicalizeAndHash(schema)
-	if err != nil {
-		return VerificationResult{}, fmt.Errorf("failed to canonicalize schema: %w", err)
-	}
-
-	// Verify signature
-	sigManager := crypto.NewSignatureManager()
-	isValid := sigManager.VerifySchemaSignature(schemaHash, signature, publicKey)
-
 	fingerprint, err := keyManager.CalculateKeyFingerprint(publicKey)
 	if err != nil {
 		fingerprint = "unknown"
 	}
 
-	// Get developer info for result
-	developerInfo, err := discoveryClient.GetDeveloperInfo(ctx, domain)
-	if err != nil {
-		developerInfo = map[string]string{
-			"developer_name": "Unknown",
-			"schema_version": "1.0",
-		}
-	}
-
 	result := VerificationResult{
 		Valid:              isValid,
 		VerificationMethod: "discovery",
 		KeyFingerprint:     fingerprint,
-		KeySource:          fmt.Sprintf("https://%s/.well-known/schemapin.json", domain),
-		DeveloperInfo:      developerInfo,
+		SchemaHash:         core.FormatSchemaHash(schemaHash),
+		KeySource:          wellKnown.SourceURL,
+		Domain:             domain,
+		DeveloperInfo:      wellKnown.DeveloperInfo(),
+		PolicyUpdated:      string(policyUpdated),
+		TrustDecision:      string(trustDecision),
+		DerivedToolID:      derivedToolID,
+		WouldHave:          wouldHave,
+
+		DiscoverySchemaVersion: wellKnown.SchemaVersion,
+	}
+	if downgrade != nil {
+		result.Warnings = append(result.Warnings, string(verification.ErrDiscoveryDowngrade)+": "+downgrade.Error())
 	}
+	applySignatureResult(&result, signedSchema, threshold)
+	applyProvenance(&result, signedSchema, schemaHash, publicKey)
+	applySignedAt(&result, eval, signedSchema, wellKnown)
 
 	if interactiveMode {
 		result.VerificationMethod = "discovery_interactive"
 	}
+	if v := wellKnown.SchemaVersion; result.Valid && v != "" && v < "1.2" &&
+		eval.Check(verification.RuleLegacyDiscovery, fmt.Sprintf("discovery uses schema version %s, consider upgrading to 1.2", v)) {
+		failed := policyFailedResult(eval, result.VerificationMethod, domain, "", "")
+		failed.KeyFingerprint, failed.KeySource = result.KeyFingerprint, result.KeySource
+		failed.DiscoverySchemaVersion = result.DiscoverySchemaVersion
+		return failed, nil
+	}
+	applyPolicyFindings(&result, eval)
 
 	return result, nil
 }
 
+// discoveryBlockedResult returns a failed result if err is a discovery
+// redirect blocked by the redirect policy or a TLS pin mismatch.
+func discoveryBlockedResult(err error, d, method string) (VerificationResult, bool) {
+	var redirectErr *discovery.RedirectBlockedError
+	var pinErr *discovery.TLSPinMismatchError
+	var blocked error
+	switch {
+	case errors.As(err, &redirectErr):
+		blocked = redirectErr
+	case errors.As(err, &pinErr):
+		blocked = pinErr
+	default:
+		return VerificationResult{}, false
+	}
+	return VerificationResult{
+		Valid:              false,
+		VerificationMethod: method,
+		Domain:             d,
+		ErrorCode:          string(verification.DiscoveryErrorCode(err)),
+		Error:              blocked.Error(),
+	}, true
+}
+
 func createPinningManager() (*pinning.KeyPinning, error) {
 	var handler interactive.InteractiveHandler
 	if interactiveMode {
-		handler = interactive.NewConsoleInteractiveHandler()
+		handler = newInteractiveHandler()
 	}
 
-	mode := pinning.PinningModeInteractive
+	// Without --auto-pin, the default_mode of an applied policy file
+	// decides, falling back to interactive
+	var mode pinning.PinningMode
 	if autoPin {
 		mode = pinning.PinningModeAutomatic
 	}
 
-	return pinning.NewKeyPinning(pinningDB, mode, handler)
+	opts, err := pinningOptions()
+	if err != nil {
+		return nil, err
+	}
+	return pinning.NewKeyPinning(pinningDB, mode, handler, opts...)
+}
+
+// pinningOptions returns the options the pinning database is opened with.
+func pinningOptions() ([]pinning.Option, error) {
+	opts := []pinning.Option{pinning.WithLogger(logger), pinning.WithTrustBoundary(trustBoundary), pinning.WithDryRun(dryRun),
+		pinning.WithReadOnly(readOnlyPins)}
+	if storeKeySource != "" {
+		provider, err := pinning.ParseStoreKeySource(storeKeySource)
+		if err != nil {
+			return nil, err
+		}
+		key, err := provider.StoreKey()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, pinning.WithStoreEncryption(key))
+	}
+	return opts, nil
+}
+
+// checkDiscoveryVersion records the .well-known schema_version served for
+// domain in the pinning database and returns the downgrade, if any. The
+// database is only created when pinning is in use; otherwise versions are
+// tracked only once it exists.
+func checkDiscoveryVersion(domain, served string) (*pinning.DiscoveryDowngradeError, error) {
+	if !interactiveMode && policyFile == "" {
+		if _, err := os.Stat(pinningDB); err != nil {
+			return nil, nil
+		}
+	}
+
+	pinningManager, err := createPinningManager()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pinning manager: %w", err)
+	}
+	defer pinningManager.Close()
+
+	err = pinningManager.RecordDiscoveryVersion(domain, served)
+	var downgrade *pinning.DiscoveryDowngradeError
+	if errors.As(err, &downgrade) {
+		return downgrade, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to record discovery schema version: %w", err)
+	}
+	return nil, nil
+}
+
+func applyPolicyFile() error {
+	pinningManager, err := createPinningManager()
+	if err != nil {
+		return fmt.Errorf("failed to create pinning manager: %w", err)
+	}
+	defer pinningManager.Close()
+
+	doc, err := pinning.LoadPolicyFile(policyFile)
+	if err != nil {
+		return err
+	}
+	report, err := pinningManager.ApplyPolicy(doc)
+	if err != nil {
+		return fmt.Errorf("failed to apply policy file: %w", err)
+	}
+
+	if verbose {
+		applied := "Applied"
+		if dryRun {
+			applied = "Would apply"
+		}
+		fmt.Fprintf(os.Stderr, "%s policy %s: %d domain policies, %d keys pinned, %d unchanged\n",
+			applied, policyFile, report.DomainPoliciesApplied, report.KeysPinned, report.Unchanged)
+	}
+	if !quiet {
+		for _, conflict := range report.Conflicts {
+			fmt.Fprintf(os.Stderr, "⚠️  Policy conflict in %s: %s\n", conflict.Entry, conflict.Message)
+		}
+	}
+	return nil
+}
+
+// newLogger returns the logger for library diagnostics. Records are only
+// emitted with --verbose and always go to stderr, as JSON when the results
+// on stdout are machine-readable and as text otherwise.
+func newLogger() *slog.Logger {
+	if !verbose {
+		return nil
+	}
+	options := &slog.HandlerOptions{Level: slog.LevelDebug}
+	if jsonOutput || outputFormat == "sarif" {
+		return slog.New(slog.NewJSONHandler(os.Stderr, options))
+	}
+	return slog.New(slog.NewTextHandler(os.Stderr, options))
 }
 
 func getVerificationMethod() string {
 	if publicKeyFile != "" {
 		return "public_key"
+	} else if wellKnownFile != "" {
+		return "well_known_file"
+	} else if requirePinned {
+		return "pinned_key"
 	} else if interactiveMode {
 		return "discovery_interactive"
 	} else {
@@ -451,36 +1284,109 @@ func displayVerificationResult(result VerificationResult, verbose bool) {
 	}
 
 	if result.Valid {
-		fmt.Printf("✅ VALID%s\n", fileInfo)
+		mutableInfo := ""
+		if n := len(result.MutableSkipped); n > 0 {
+			mutableInfo = fmt.Sprintf(" with %d mutable file(s) skipped", n)
+		}
+		fmt.Printf("✅ VALID%s%s\n", fileInfo, mutableInfo)
+		for _, warning := range result.Warnings {
+			fmt.Printf("   Warning: %s\n", warning)
+		}
+		for _, relPath := range result.PermissionChanged {
+			fmt.Printf("   Executable bit changed: %s\n", relPath)
+		}
+		displayBaseline(result, verbose)
 		if verbose {
 			fmt.Printf("   Method: %s\n", result.VerificationMethod)
 			if result.KeyFingerprint != "" {
 				fmt.Printf("   Key fingerprint: %s\n", result.KeyFingerprint)
+				if visualFingerprint {
+					if visual, err := crypto.FingerprintVisual(result.KeyFingerprint); err == nil {
+						fmt.Printf("   %s\n", strings.ReplaceAll(visual, "\n", "\n   "))
+					}
+				}
 			}
 			if result.KeySource != "" {
 				fmt.Printf("   Key source: %s\n", result.KeySource)
 			}
+			if result.DerivedToolID != "" {
+				fmt.Printf("   Tool ID: %s (derived from schema name)\n", result.DerivedToolID)
+			}
 			if result.Pinned {
 				fmt.Println("   Key status: Pinned")
 			}
 			if result.FirstUse {
 				fmt.Println("   Key status: First use")
 			}
+			if result.TrustDecision != "" {
+				fmt.Printf("   Trust decision: %s\n", result.TrustDecision)
+			}
 			if result.DeveloperInfo != nil && result.DeveloperInfo["developer_name"] != "" {
 				fmt.Printf("   Developer: %s\n", result.DeveloperInfo["developer_name"])
 			}
+			if line := interactive.ContactLine(result.DeveloperInfo); line != "" {
+				fmt.Printf("   %s\n", line)
+			}
 			if result.SignedAt != "" {
 				fmt.Printf("   Signed at: %s\n", result.SignedAt)
 			}
+			if result.DiscoverySchemaVersion != "" {
+				fmt.Printf("   Discovery schema version: %s\n", result.DiscoverySchemaVersion)
+			}
+			for _, relPath := range result.MutableSkipped {
+				fmt.Printf("   Mutable (not checked): %s\n", relPath)
+			}
+			displaySigners(result)
+			displayHashes(result)
+			displayProvenance(result.Metadata)
+			displayTimings(result.Metadata)
+		}
+		if result.PolicyUpdated != "" {
+			fmt.Printf("   Domain policy updated: %s\n", result.PolicyUpdated)
 		}
 	} else {
 		fmt.Printf("❌ INVALID%s\n", fileInfo)
 		if result.Error != "" {
 			fmt.Printf("   Error: %s\n", result.Error)
 		}
+		if verbose && result.ErrorCode != "" {
+			fmt.Printf("   Error code: %s\n", result.ErrorCode)
+		}
 		if verbose && result.VerificationMethod != "" {
 			fmt.Printf("   Method: %s\n", result.VerificationMethod)
 		}
+		if verbose && result.DiscoverySchemaVersion != "" {
+			fmt.Printf("   Discovery schema version: %s\n", result.DiscoverySchemaVersion)
+		}
+		if result.PolicyRule != "" {
+			fmt.Printf("   Policy rule: %s\n", result.PolicyRule)
+		}
+		displayBaseline(result, false)
+		if result.PolicyUpdated != "" {
+			fmt.Printf("   Domain policy updated: %s\n", result.PolicyUpdated)
+		}
+		if verbose {
+			displaySigners(result)
+			displayHashes(result)
+			displayTimings(result.Metadata)
+		}
+	}
+	for _, action := range result.WouldHave {
+		fmt.Printf("   Dry run: %s\n", action)
+	}
+}
+
+// displayHashes prints the schema hash, or the computed and signed skill
+// hashes, of a result.
+func displayHashes(result VerificationResult) {
+	if result.SchemaHash != "" {
+		fmt.Printf("   Schema hash: %s\n", result.SchemaHash)
+	}
+	if result.SkillHash != "" {
+		fmt.Printf("   Skill hash: %s\n", result.SkillHash)
+	}
+	if result.SignedSkillHash != "" && result.SignedSkillHash != result.SkillHash {
+		fmt.Printf("   Signed skill hash: %s\n", result.SignedSkillHash)
 	}
 }
 
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+var (
+	requireSignatureCount int
+	requireSignerKids     []string
+)
+
+// multiSignature reports whether signedSchema is checked as a
+// multi-signature schema: it carries a signatures array, or
+// --require-signatures or --require-signer was given.
+func multiSignature(signedSchema *SignedSchema) bool {
+	return len(signedSchema.Signatures) > 0 || requireSignatureCount > 0 || len(requireSignerKids) > 0
+}
+
+// verifySignatures verifies the signatures of signedSchema over schemaHash
+// against publicKeyPEM, the one key the verification method provides, and
+// applies --require-signatures and --require-signer. A single signature
+// field is checked as a one-element signatures array, and with
+// --allow-legacy also under the legacy rules.
+func verifySignatures(signedSchema *SignedSchema, schemaHash []byte, publicKeyPEM string) (*verification.ThresholdResult, error) {
+	keys, err := verification.NewSignerKeySet(publicKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+	entries := verification.SignatureEntries(signedSchema.Signature, signedSchema.Signatures)
+	defer signedSchema.timer.Stop(verification.TimingSignatureVerify, signedSchema.timer.Start())
+	threshold := verification.VerifySignatureThreshold(schemaHash, entries, keys,
+		verification.RequireSignatures(requireSignatureCount),
+		verification.RequireSigners(requireSignerKids))
+	return verifyLegacySignature(signedSchema, schemaHash, publicKeyPEM, threshold), nil
+}
+
+// applySignatureResult records threshold on result: the error of a failed
+// verification, the warning of a legacy signature and, for multi-signature
+// schemas, the signers and failed entries.
+func applySignatureResult(result *VerificationResult, signedSchema *SignedSchema, threshold *verification.ThresholdResult) {
+	if !threshold.Valid {
+		result.ErrorCode = string(threshold.ErrorCode)
+		result.Error = threshold.ErrorMessage
+	} else if signedSchema.legacyWarning != "" {
+		result.Warnings = append(result.Warnings, signedSchema.legacyWarning)
+	}
+	if multiSignature(signedSchema) {
+		result.Signers = threshold.Signers
+		result.SignatureFailures = threshold.Failures
+	}
+}
+
+// displaySigners prints the signers and failed entries of a
+// multi-signature result.
+func displaySigners(result VerificationResult) {
+	for _, signer := range result.Signers {
+		fmt.Printf("   Signer: %s\n", signer)
+	}
+	for _, failure := range result.SignatureFailures {
+		kid := failure.SignerKid
+		if kid == "" {
+			kid = "(no kid)"
+		}
+		fmt.Printf("   Signature %d by %s: %s\n", failure.Index, kid, failure.Reason)
+	}
+}
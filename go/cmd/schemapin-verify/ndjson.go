@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync/atomic"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/report"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/utils"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+var (
+	ndjsonInput bool
+	concurrency int
+)
+
+// validateNDJSONFlags checks the flags --ndjson combines with. Console
+// prompts would read the stream's own stdin, and pinning opens the pinning
+// database per schema, which cannot be shared by parallel verifications.
+func validateNDJSONFlags() error {
+	if !ndjsonInput {
+		if concurrency != 1 {
+			return fmt.Errorf("--concurrency requires --ndjson")
+		}
+		return nil
+	}
+	switch {
+	case !stdinInput:
+		return fmt.Errorf("--ndjson requires --stdin")
+	case inputFormat != "json":
+		return fmt.Errorf("--ndjson requires --input-format json")
+	case outputFormat == "sarif":
+		return fmt.Errorf("--ndjson cannot be combined with --output-format sarif")
+	case interactiveMode && promptMode == "console":
+		return fmt.Errorf("--ndjson reads stdin and cannot prompt on the console; use --prompt-mode notify")
+	case concurrency < 1:
+		return fmt.Errorf("--concurrency must be at least 1")
+	case concurrency > 1 && (interactiveMode || policyFile != ""):
+		return fmt.Errorf("--concurrency cannot be combined with key pinning (--interactive or --policy-file)")
+	}
+	return nil
+}
+
+// processNDJSON verifies one signed schema per line of stdin and writes one
+// verification result per line to stdout, in input order. Lines that
+// cannot be verified are written as {"error": ..., "line": N} and do not
+// stop the stream. With --exit-code, any invalid or failed line exits 1;
+// with --exit-code-detail, the lines' failures exit by their class.
+func processNDJSON() error {
+	var invalid atomic.Int64
+	var outcome outcomeTracker
+	verify := func(line []byte) (interface{}, error) {
+		result, err := verifyNDJSONLine(line)
+		if err != nil {
+			outcome.add(report.OutcomeOf(verification.ErrorCodeOf(err)))
+			return nil, err
+		}
+		if !result.Valid {
+			invalid.Add(1)
+			outcome.add(report.OutcomeOf(verification.ErrorCode(result.ErrorCode)))
+		}
+		return result, nil
+	}
+
+	stats, err := utils.ProcessNDJSON(context.Background(), os.Stdin, os.Stdout, verify, utils.NDJSONOptions{Concurrency: concurrency})
+	if err != nil {
+		return err
+	}
+	if !quiet && verbose {
+		fmt.Fprintf(os.Stderr, "Summary: %d/%d schemas verified successfully\n", stats.Lines-stats.Failed-int(invalid.Load()), stats.Lines)
+	}
+	exitWithOutcome(outcome.get())
+	return nil
+}
+
+// verifyNDJSONLine verifies the signed schema on one line of --ndjson
+// input.
+func verifyNDJSONLine(line []byte) (VerificationResult, error) {
+	signedSchema, err := parseSignedSchema(line)
+	if err != nil {
+		return VerificationResult{}, err
+	}
+	if signedSchema.Schema == nil || (signedSchema.Signature == "" && len(signedSchema.Signatures) == 0) {
+		return VerificationResult{}, fmt.Errorf("invalid signed schema format - missing required fields")
+	}
+	result, err := verifySignedSchema(signedSchema)
+	if err != nil {
+		return VerificationResult{}, err
+	}
+	result.Metadata = withSchemaMetadata(result.Metadata, signedSchema.Metadata)
+	result.SignedAt = signedSchema.SignedAt
+	return result, nil
+}
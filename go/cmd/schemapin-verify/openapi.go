@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/utils"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+var (
+	openAPIFile   string
+	openAPIPaths  []string
+	requireSigned bool
+)
+
+// processOpenAPI verifies the x-schemapin signature of every operation of
+// an OpenAPI document selected by --paths, one result per operation.
+// Unsigned operations fail with --require-signed and are otherwise only
+// reported on stderr.
+func processOpenAPI(docPath string) ([]VerificationResult, error) {
+	doc, err := os.ReadFile(docPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read OpenAPI document: %w", err)
+	}
+	selector, err := utils.OpenAPIPathSelector(openAPIPaths)
+	if err != nil {
+		return nil, err
+	}
+	operations, err := utils.OpenAPIOperations(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", docPath, err)
+	}
+
+	var results []VerificationResult
+	for _, op := range operations {
+		if selector != nil && !selector(op.Path, op.Method) {
+			continue
+		}
+		file := fmt.Sprintf("%s#%s", docPath, op.Key())
+
+		switch {
+		case op.Err != nil:
+			results = append(results, VerificationResult{
+				File:               file,
+				Valid:              false,
+				VerificationMethod: getVerificationMethod(),
+				ErrorCode:          string(verification.ErrSchemaCanonicalizationFailed),
+				Error:              op.Err.Error(),
+			})
+		case op.Signature == nil && requireSigned:
+			results = append(results, VerificationResult{
+				File:               file,
+				Valid:              false,
+				VerificationMethod: getVerificationMethod(),
+				ErrorCode:          string(verification.ErrSignatureInvalid),
+				Error:              fmt.Sprintf("operation has no %s signature", utils.OpenAPIExtension),
+			})
+		case op.Signature == nil:
+			if !quiet {
+				fmt.Fprintf(os.Stderr, "⚠️  Unsigned operation (not verified): %s\n", file)
+			}
+		default:
+			result, err := verifySignedSchema(&SignedSchema{
+				SchemapinVersion: core.CurrentSchemapinVersion,
+				Canonicalization: core.DefaultCanonicalization,
+				Schema:           op.Schema,
+				Signature:        op.Signature.Signature,
+			})
+			if err != nil {
+				return nil, err
+			}
+			result.File = file
+			results = append(results, result)
+		}
+	}
+	if len(results) == 0 && !requireSigned {
+		return nil, fmt.Errorf("no signed operations to verify in %s", docPath)
+	}
+	return results, nil
+}
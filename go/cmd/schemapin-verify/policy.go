@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+var (
+	verificationProfile    string
+	verificationPolicyFile string
+
+	// verificationPolicy is loaded from the flags above; nil verifies
+	// without a policy
+	verificationPolicy *verification.Policy
+)
+
+// loadVerificationPolicy returns the policy named by --policy or read from
+// --verification-policy-file, or nil when neither was given.
+func loadVerificationPolicy() (*verification.Policy, error) {
+	switch {
+	case verificationProfile != "" && verificationPolicyFile != "":
+		return nil, fmt.Errorf("--policy and --verification-policy-file are mutually exclusive (set profile in the file instead)")
+	case verificationProfile != "":
+		return verification.PolicyProfile(verificationProfile)
+	case verificationPolicyFile != "":
+		return verification.LoadPolicyFile(verificationPolicyFile)
+	}
+	return nil, nil
+}
+
+// policyFailedResult returns the failed result for the rule eval just
+// reported as failing. An empty code is verification.ErrPolicyViolation.
+func policyFailedResult(eval *verification.PolicyEvaluation, method, d string, code verification.ErrorCode, message string) VerificationResult {
+	failed := eval.Failure(d, code, message)
+	return VerificationResult{
+		Valid:              false,
+		VerificationMethod: method,
+		Domain:             d,
+		ErrorCode:          string(failed.ErrorCode),
+		Error:              failed.ErrorMessage,
+		PolicyRule:         string(failed.PolicyRule),
+		PolicyFindings:     failed.PolicyFindings,
+	}
+}
+
+// applyPolicyFindings records eval's findings on a result that no rule
+// failed.
+func applyPolicyFindings(result *VerificationResult, eval *verification.PolicyEvaluation) {
+	applied := eval.Apply(&verification.VerificationResult{})
+	result.Warnings = append(result.Warnings, applied.Warnings...)
+	result.PolicyFindings = applied.PolicyFindings
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/report"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+var (
+	// prefetchDomains is --prefetch-domains: the .well-known documents of
+	// these domains are fetched concurrently before anything is verified.
+	prefetchDomains []string
+	// strictPrefetch is --strict-prefetch: a domain that cannot be
+	// prefetched fails the run instead of printing a warning.
+	strictPrefetch bool
+
+	// prefetched holds the documents fetched for --prefetch-domains by
+	// domain identity. Discovery-mode verifications use them instead of
+	// fetching the document again.
+	prefetched map[string]*discovery.WellKnownResponse
+)
+
+// runPrefetch fetches the documents of --prefetch-domains concurrently.
+func runPrefetch() error {
+	if len(prefetchDomains) == 0 {
+		return nil
+	}
+	client := discovery.NewPublicKeyDiscovery(discoveryOptions()...)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	prefetched = make(map[string]*discovery.WellKnownResponse)
+	var mu sync.Mutex
+	var failures []string
+	transient := true
+	var wg sync.WaitGroup
+	for _, d := range prefetchDomains {
+		identity, err := core.NormalizeDomain(d)
+		if err == nil {
+			err = trustBoundary.Check(d)
+		}
+		if err != nil {
+			mu.Lock()
+			failures = append(failures, fmt.Sprintf("%s: %s: %v", d, verification.ErrDomainBlocked, err))
+			transient = false
+			mu.Unlock()
+			continue
+		}
+		wg.Add(1)
+		go func(d, identity string) {
+			defer wg.Done()
+			wellKnown, err := client.FetchDiscovery(ctx, d)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				code := verification.DiscoveryErrorCode(err)
+				failures = append(failures, fmt.Sprintf("%s: %s: %v", d, code, err))
+				transient = transient && report.OutcomeOf(code) == report.OutcomeTransient
+				return
+			}
+			prefetched[identity] = wellKnown
+		}(d, identity)
+	}
+	wg.Wait()
+
+	if len(failures) > 0 && strictPrefetch {
+		message := fmt.Sprintf("prefetch failed for %s", strings.Join(failures, "; "))
+		if transient {
+			// --exit-code-detail reports the run as a transient failure
+			return &schemaerr.Error{Kind: schemaerr.ErrDiscoveryFailed, Message: message}
+		}
+		return errors.New(message)
+	}
+	if !quiet {
+		for _, failure := range failures {
+			fmt.Fprintf(os.Stderr, "⚠️  Prefetch failed for %s\n", failure)
+		}
+	}
+	return nil
+}
+
+// fetchDiscovery returns the document prefetched for d, or fetches it
+// with client.
+func fetchDiscovery(ctx context.Context, client *discovery.PublicKeyDiscovery, d string) (*discovery.WellKnownResponse, error) {
+	if identity, err := core.NormalizeDomain(d); err == nil {
+		if wellKnown := prefetched[identity]; wellKnown != nil {
+			return wellKnown, nil
+		}
+	}
+	return client.FetchDiscovery(ctx, d)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/pinning"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/utils"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+// verifyPrePinned handles --require-pinned and --read-only-pins: the
+// schema is verified with the key already pinned for toolID, through the
+// verification workflow. With --require-pinned a tool without a pin fails
+// with key_not_pinned before any discovery. With --read-only-pins the
+// pinning database is opened read-only; a tool without a pin is verified
+// with the discovered key, which is not pinned even with --auto-pin, and
+// skipped writes are reported as pin_store_read_only warnings.
+func verifyPrePinned(signedSchema *SignedSchema, toolID, derivedToolID string) (VerificationResult, error) {
+	if toolID == "" {
+		return VerificationResult{}, fmt.Errorf("--tool-id is required with --require-pinned or --read-only-pins when it cannot be derived from the schema name")
+	}
+	schemaHash, err := signedSchema.hash()
+	if err != nil {
+		return VerificationResult{}, err
+	}
+
+	opts, err := pinningOptions()
+	if err != nil {
+		return VerificationResult{}, err
+	}
+	keyPinning, err := pinning.NewKeyPinning(pinningDB, pinning.PinningModeAutomatic, nil, opts...)
+	if err != nil {
+		return VerificationResult{}, fmt.Errorf("failed to open pinning database: %w", err)
+	}
+	defer keyPinning.Close()
+	if verbose {
+		fmt.Fprintf(os.Stderr, "Using pinning database %s\n", keyPinning.DBPath())
+	}
+
+	workflow := utils.NewSchemaVerificationWorkflowWithPinning(keyPinning,
+		utils.WithRequirePrePinned(requirePinned),
+		utils.WithTrustBoundary(trustBoundary),
+		utils.WithPolicy(verificationPolicy),
+		utils.WithStrictDiscoveryVersion(strictDiscoveryVersion),
+		utils.WithDiscoveryOptions(discoveryOptions()...),
+		utils.WithDryRun(dryRun),
+		utils.WithProvenance(provenanceConfig),
+		utils.WithTimings(timings),
+		utils.WithLegacySignatures(allowLegacy),
+		utils.WithMaxSignatureAge(maxSignatureAge),
+		utils.WithLogger(logger))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	verified, err := workflow.VerifySchemaWithOptions(ctx, utils.VerifyRequest{
+		SchemaHash: schemaHash,
+		Signature:  signedSchema.Signature,
+		SignedAt:   signedSchema.SignedAt,
+		ToolID:     toolID,
+		Domain:     domain,
+		Provenance: signedSchema.Provenance,
+		AutoPin:    autoPin,
+	})
+	if err != nil {
+		return VerificationResult{}, err
+	}
+
+	method := "pinned_key"
+	if _, ok := verified.Metadata["pin_match"]; !ok && !requirePinned {
+		method = "discovery"
+	}
+	result := VerificationResult{
+		Valid:              verified.Valid,
+		VerificationMethod: method,
+		Domain:             domain,
+		Pinned:             verified.Pinned,
+		TrustDecision:      string(verified.TrustDecision),
+		Warnings:           verified.Warnings,
+		WouldHave:          verified.WouldHave,
+		PolicyRule:         verified.PolicyRule,
+		PolicyFindings:     verified.PolicyFindings,
+		DerivedToolID:      derivedToolID,
+		SchemaHash:         verified.SchemaHash,
+		Metadata:           provenanceMetadata(verified.Metadata),
+	}
+	applyLegacyWarning(&result, signedSchema)
+	result.KeyFingerprint, _ = verified.Metadata["key_fingerprint"].(string)
+	if steps, ok := verified.Metadata[verification.MetadataTimings]; ok {
+		if result.Metadata == nil {
+			result.Metadata = make(map[string]interface{})
+		}
+		result.Metadata[verification.MetadataTimings] = steps
+	}
+	if !verified.Valid {
+		result.Error = verified.Error
+		// Workflow codes are upper case; report the verification package's
+		// code where the failure has one
+		result.ErrorCode = string(verification.ErrorCodeOf(verified.Err()))
+		if result.ErrorCode == "" {
+			result.ErrorCode = strings.ToLower(verified.ErrorCode)
+		}
+	}
+	return result, nil
+}
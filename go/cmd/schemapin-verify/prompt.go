@@ -0,0 +1,35 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/interactive"
+)
+
+// promptMode selects how interactive pinning decisions are asked: "console"
+// prompts on the terminal, "notify" uses desktop notifications for agents
+// running without one.
+var promptMode string
+
+func validatePromptMode() error {
+	switch promptMode {
+	case "console":
+	case "notify":
+		interactiveMode = true
+	default:
+		return fmt.Errorf("invalid --prompt-mode %q (expected console or notify)", promptMode)
+	}
+	return nil
+}
+
+// newInteractiveHandler returns the handler for --prompt-mode.
+func newInteractiveHandler() interactive.InteractiveHandler {
+	if promptMode == "notify" {
+		return interactive.NewNotifyingHandler(interactive.NotifyingHandlerOptions{
+			AssumeFirstUseAccept: assumeFirstUseAccept,
+		})
+	}
+	return interactive.NewConsoleInteractiveHandlerWithOptions(interactive.ConsoleHandlerOptions{
+		AssumeFirstUseAccept: assumeFirstUseAccept,
+	})
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/provenance"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+var (
+	verifyProvenance   bool
+	provenanceKeyFiles []string
+
+	// provenanceConfig is built from the flags above; nil leaves
+	// provenance unchecked
+	provenanceConfig *provenance.Config
+)
+
+// loadProvenanceConfig returns the provenance configuration for
+// --verify-provenance, with the keys of any --provenance-key files, or nil
+// when provenance is not verified.
+func loadProvenanceConfig() (*provenance.Config, error) {
+	if !verifyProvenance {
+		if len(provenanceKeyFiles) > 0 {
+			return nil, fmt.Errorf("--provenance-key requires --verify-provenance")
+		}
+		return nil, nil
+	}
+	config := &provenance.Config{}
+	keyManager := crypto.NewKeyManager()
+	for _, path := range provenanceKeyFiles {
+		keyData, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read provenance key file: %w", err)
+		}
+		key, err := keyManager.LoadPublicKeyPEM(string(keyData))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load provenance key %s: %w", path, err)
+		}
+		config.Keys = append(config.Keys, key)
+	}
+	return config, nil
+}
+
+// applyProvenance checks the provenance of a signed schema whose signature
+// verified with publicKey, failing result if it does not verify and
+// otherwise reporting its builder and source in the result's metadata.
+func applyProvenance(result *VerificationResult, signedSchema *SignedSchema, schemaHash []byte, publicKey *ecdsa.PublicKey) {
+	if provenanceConfig == nil || signedSchema.Provenance == nil || !result.Valid {
+		return
+	}
+	summary, err := provenanceConfig.Check(signedSchema.Provenance, schemaHash, publicKey)
+	if err != nil {
+		result.Valid = false
+		result.ErrorCode = string(verification.ErrorCodeOf(err))
+		result.Error = err.Error()
+		return
+	}
+	if result.Metadata == nil {
+		result.Metadata = make(map[string]interface{})
+	}
+	summary.AddMetadata(result.Metadata)
+}
+
+// provenanceMetadata returns the provenance fields of workflow result
+// metadata, or nil if it has none.
+func provenanceMetadata(metadata map[string]interface{}) map[string]interface{} {
+	var fields map[string]interface{}
+	for key, value := range metadata {
+		if strings.HasPrefix(key, "provenance_") {
+			if fields == nil {
+				fields = make(map[string]interface{})
+			}
+			fields[key] = value
+		}
+	}
+	return fields
+}
+
+// displayProvenance prints the provenance fields of a verified result.
+func displayProvenance(metadata map[string]interface{}) {
+	for _, field := range []struct{ label, key string }{
+		{"Built by", provenance.MetadataBuilderID},
+		{"Source", provenance.MetadataSourceRepo},
+		{"Commit", provenance.MetadataCommit},
+	} {
+		if value, ok := metadata[field.key].(string); ok {
+			fmt.Printf("   %s: %s\n", field.label, value)
+		}
+	}
+}
+
+// withSchemaMetadata adds the metadata of a signed schema to the metadata
+// verification reported, such as its provenance, which takes precedence.
+func withSchemaMetadata(verified, schema map[string]interface{}) map[string]interface{} {
+	if len(verified) == 0 {
+		return schema
+	}
+	merged := make(map[string]interface{}, len(schema)+len(verified))
+	for key, value := range schema {
+		merged[key] = value
+	}
+	for key, value := range verified {
+		merged[key] = value
+	}
+	return merged
+}
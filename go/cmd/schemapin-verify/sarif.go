@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+
+	"github.com/ThirdKeyAi/schemapin/go/internal/version"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/report"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/skill"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+// writeSARIF prints results to stdout as a SARIF 2.1.0 log.
+func writeSARIF(results []report.Result) error {
+	return report.WriteSARIF(os.Stdout, results, report.SARIFOptions{
+		ToolName:      "schemapin-verify",
+		ToolVersion:   version.GetVersion(),
+		IncludePasses: includePasses,
+	})
+}
+
+// reportResults converts CLI verification results for report.BuildSARIF
+// and report.Aggregate.
+func reportResults(results []VerificationResult) []report.Result {
+	converted := make([]report.Result, 0, len(results))
+	for _, result := range results {
+		converted = append(converted, report.Result{
+			ArtifactURI:    result.File,
+			KeyFingerprint: result.KeyFingerprint,
+			VerificationResult: verification.VerificationResult{
+				Valid:         result.Valid,
+				Domain:        result.Domain,
+				DeveloperName: result.DeveloperInfo["developer_name"],
+				ErrorCode:     verification.ErrorCode(result.ErrorCode),
+				ErrorMessage:  result.Error,
+				Warnings:      result.Warnings,
+			},
+		})
+	}
+	return converted
+}
+
+// skillReportResults converts --root reports for report.BuildSARIF. Unsigned
+// skills are not verification results and are left out.
+func skillReportResults(reports []skill.SkillReport) []report.Result {
+	var converted []report.Result
+	for _, skillReport := range reports {
+		if skillReport.Result == nil {
+			continue
+		}
+		converted = append(converted, report.Result{
+			ArtifactURI:        skillReport.Path,
+			VerificationResult: *skillReport.Result,
+		})
+	}
+	return converted
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/internal/progress"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/resolver"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/revocation"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/skill"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+var (
+	skillPath         string
+	skillsRoot        string
+	skillArchive      string
+	contentPolicyFile string
+	allowNewMutable   bool
+	strictPermissions bool
+	progressJSON      bool
+)
+
+// newProgress returns the progress shown while label is hashed: a bar on
+// a terminal stderr, JSON lines with --progress-json, nothing with --quiet.
+func newProgress(label string) *progress.Reporter {
+	return progress.New(os.Stderr, label, progress.Options{Quiet: quiet, JSON: progressJSON})
+}
+
+// processSkill verifies a signed skill directory using either the supplied
+// public key or .well-known discovery for --domain.
+func processSkill(dir string) (VerificationResult, error) {
+	timer := verification.NewTimer(timings)
+	start := timer.Start()
+	sig, err := skill.LoadSignature(dir)
+	if err != nil {
+		return VerificationResult{}, err
+	}
+	if blocked, ok := domainBlockedResult(sig.Domain, getVerificationMethod()); ok {
+		blocked.File = dir
+		return blocked, nil
+	}
+
+	options := skill.VerifyOptions{AllowNewMutableFiles: allowNewMutable, StrictPermissions: strictPermissions, Policy: verificationPolicy,
+		Provenance: provenanceConfig, Timings: timings}
+	if options.ContentPolicy, err = loadContentPolicy(); err != nil {
+		return VerificationResult{}, err
+	}
+
+	t := timer.Start()
+	disc, rev, keySource, err := resolveSkillDiscovery(sig)
+	timer.Stop(verification.TimingDiscoveryFetch, t)
+	if blocked, ok := discoveryBlockedResult(err, domain, getVerificationMethod()); ok {
+		blocked.File = dir
+		return blocked, nil
+	}
+	if err != nil {
+		return VerificationResult{}, err
+	}
+
+	bar := newProgress(dir)
+	options.Progress = bar.Func()
+	skillResult := skill.VerifySkillOfflineWithOptions(dir, disc, sig, rev, nil, toolID, options)
+	bar.Finish()
+
+	result := VerificationResult{
+		Valid:              skillResult.Valid,
+		VerificationMethod: getVerificationMethod(),
+		KeySource:          keySource,
+		File:               dir,
+		Domain:             sig.Domain,
+		ErrorCode:          string(skillResult.ErrorCode),
+		Error:              skillResult.ErrorMessage,
+		Warnings:           skillResult.Warnings,
+		SignedAt:           sig.SignedAt,
+		SignerKid:          sig.SignerKid,
+		MutableSkipped:     skillResult.MutableSkipped,
+		PermissionChanged:  skillResult.PermissionChanged,
+		SkillHash:          skillResult.SkillHash,
+		SignedSkillHash:    skillResult.SignedSkillHash,
+		Metadata:           skillResult.Metadata,
+		PolicyRule:         string(skillResult.PolicyRule),
+		PolicyFindings:     skillResult.PolicyFindings,
+	}
+	if skillResult.KeyFingerprint != "" {
+		result.KeyFingerprint = skillResult.KeyFingerprint
+	} else if fingerprint, err := crypto.NewKeyManager().CalculateKeyFingerprintFromPEM(disc.PublicKeyPEM); err == nil {
+		result.KeyFingerprint = fingerprint
+	}
+	if skillResult.DeveloperName != "" {
+		result.DeveloperInfo = map[string]string{"developer_name": skillResult.DeveloperName}
+	}
+	timer.Stop(verification.TimingTotal, start)
+	result.Metadata = timer.Record(result.Metadata)
+	return result, nil
+}
+
+// processSkillArchive verifies a signed .zip or .tar.gz skill archive
+// without extracting it.
+func processSkillArchive(archivePath string) (VerificationResult, error) {
+	timer := verification.NewTimer(timings)
+	start := timer.Start()
+	format, err := skill.DetectArchiveFormat(archivePath)
+	if err != nil {
+		return VerificationResult{}, err
+	}
+	data, err := os.ReadFile(archivePath)
+	if err != nil {
+		return VerificationResult{}, fmt.Errorf("failed to read skill archive: %w", err)
+	}
+	r := bytes.NewReader(data)
+
+	sig, err := skill.LoadArchiveSignature(r, r.Size(), format)
+	if err != nil {
+		return VerificationResult{}, err
+	}
+	if blocked, ok := domainBlockedResult(sig.Domain, getVerificationMethod()); ok {
+		blocked.File = archivePath
+		return blocked, nil
+	}
+
+	t := timer.Start()
+	disc, rev, keySource, err := resolveSkillDiscovery(sig)
+	timer.Stop(verification.TimingDiscoveryFetch, t)
+	if blocked, ok := discoveryBlockedResult(err, domain, getVerificationMethod()); ok {
+		blocked.File = archivePath
+		return blocked, nil
+	}
+	if err != nil {
+		return VerificationResult{}, err
+	}
+
+	bar := newProgress(archivePath)
+	skillResult := skill.VerifySkillArchiveOfflineWithOptions(r, r.Size(), format, disc, sig, rev, nil, toolID,
+		skill.VerifyOptions{StrictPermissions: strictPermissions, Provenance: provenanceConfig, Timings: timings, Progress: bar.Func()})
+	bar.Finish()
+
+	result := VerificationResult{
+		Valid:              skillResult.Valid,
+		VerificationMethod: getVerificationMethod(),
+		KeySource:          keySource,
+		File:               archivePath,
+		Domain:             sig.Domain,
+		ErrorCode:          string(skillResult.ErrorCode),
+		Error:              skillResult.ErrorMessage,
+		Warnings:           skillResult.Warnings,
+		SignedAt:           sig.SignedAt,
+		SignerKid:          sig.SignerKid,
+		KeyFingerprint:     skillResult.KeyFingerprint,
+		MutableSkipped:     skillResult.MutableSkipped,
+		PermissionChanged:  skillResult.PermissionChanged,
+		SkillHash:          skillResult.SkillHash,
+		SignedSkillHash:    skillResult.SignedSkillHash,
+		Metadata:           skillResult.Metadata,
+	}
+	if skillResult.DeveloperName != "" {
+		result.DeveloperInfo = map[string]string{"developer_name": skillResult.DeveloperName}
+	}
+	timer.Stop(verification.TimingTotal, start)
+	result.Metadata = timer.Record(result.Metadata)
+	return result, nil
+}
+
+func resolveSkillDiscovery(sig *skill.SkillSignature) (*discovery.WellKnownResponse, *revocation.RevocationDocument, string, error) {
+	if publicKeyFile != "" {
+		keyData, err := os.ReadFile(publicKeyFile)
+		if err != nil {
+			return nil, nil, "", fmt.Errorf("failed to read public key file: %w", err)
+		}
+		disc := &discovery.WellKnownResponse{
+			SchemaVersion: "1.2",
+			PublicKeyPEM:  string(keyData),
+		}
+		return disc, nil, publicKeyFile, nil
+	}
+	if wellKnownFile != "" {
+		disc, err := discovery.LoadWellKnownFile(wellKnownFile)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		return disc, nil, wellKnownFile, nil
+	}
+
+	r := resolver.NewWellKnownResolver(discoveryOptions()...)
+	disc, err := r.ResolveDiscovery(domain)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to discover public key: %w", err)
+	}
+	rev, _ := r.ResolveRevocation(domain, disc)
+	return disc, rev, disc.SourceURL, nil
+}
+
+// processSkillsRoot verifies every skill installed under root. Each skill is
+// resolved against its own signing domain: with --public-key or --well-known
+// every skill must be signed by that key, otherwise keys are discovered via
+// .well-known.
+func processSkillsRoot(root string) ([]skill.SkillReport, error) {
+	policy, err := loadContentPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	var r resolver.SchemaResolver
+	if publicKeyFile != "" {
+		keyData, err := os.ReadFile(publicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read public key file: %w", err)
+		}
+		r = &staticKeyResolver{disc: &discovery.WellKnownResponse{
+			SchemaVersion: "1.2",
+			PublicKeyPEM:  string(keyData),
+		}}
+	} else if wellKnownFile != "" {
+		disc, err := discovery.LoadWellKnownFile(wellKnownFile)
+		if err != nil {
+			return nil, err
+		}
+		r = &staticKeyResolver{disc: disc}
+	} else {
+		r = resolver.NewCachingResolver(resolver.NewWellKnownResolver(discoveryOptions()...), 5*time.Minute)
+	}
+
+	bar := newProgress(root)
+	reports, err := skill.VerifyInstalledSkills(root, &boundaryResolver{next: r}, verification.NewKeyPinStore(),
+		skill.WithConcurrency(runtime.NumCPU()), skill.WithContentPolicy(policy), skill.WithAllowNewMutableFiles(allowNewMutable),
+		skill.WithStrictPermissions(strictPermissions), skill.WithProvenance(provenanceConfig), skill.WithProgress(bar.Func()))
+	bar.Finish()
+	if err != nil {
+		return nil, err
+	}
+	markBlockedSkills(reports)
+	return reports, nil
+}
+
+// displaySkillReports prints a summary table of installed skill reports.
+func displaySkillReports(reports []skill.SkillReport) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "SKILL\tSTATUS\tDETAIL")
+	for _, report := range reports {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", report.Name, report.Status, skillReportDetail(report))
+	}
+	w.Flush()
+
+	counts := make(map[skill.SkillStatus]int)
+	for _, report := range reports {
+		counts[report.Status]++
+	}
+	fmt.Printf("\nSummary: %d valid, %d tampered, %d invalid, %d unsigned\n",
+		counts[skill.SkillStatusValid], counts[skill.SkillStatusTampered],
+		counts[skill.SkillStatusInvalid], counts[skill.SkillStatusUnsigned])
+}
+
+func skillReportDetail(report skill.SkillReport) string {
+	if report.Tampered != nil {
+		var parts []string
+		for _, group := range []struct {
+			label string
+			files []string
+		}{
+			{"modified", report.Tampered.Modified},
+			{"added", report.Tampered.Added},
+			{"removed", report.Tampered.Removed},
+			{"permission changed", report.Tampered.PermissionChanged},
+		} {
+			if len(group.files) > 0 {
+				parts = append(parts, fmt.Sprintf("%s: %s", group.label, strings.Join(group.files, ", ")))
+			}
+		}
+		return strings.Join(parts, "; ")
+	}
+	if report.Result == nil {
+		return ""
+	}
+	if !report.Result.Valid {
+		return report.Result.ErrorMessage
+	}
+	return report.Result.Domain
+}
+
+// countFailedSkills returns the number of signed skills that did not verify.
+func countFailedSkills(reports []skill.SkillReport) int {
+	count := 0
+	for _, report := range reports {
+		if report.Status == skill.SkillStatusTampered || report.Status == skill.SkillStatusInvalid {
+			count++
+		}
+	}
+	return count
+}
+
+func loadContentPolicy() (*verification.ContentPolicy, error) {
+	if contentPolicyFile == "" {
+		return nil, nil
+	}
+	return verification.LoadContentPolicy(contentPolicyFile)
+}
+
+// staticKeyResolver answers every discovery lookup with the same key.
+type staticKeyResolver struct {
+	disc *discovery.WellKnownResponse
+}
+
+func (r *staticKeyResolver) ResolveDiscovery(domain string) (*discovery.WellKnownResponse, error) {
+	return r.disc, nil
+}
+
+func (r *staticKeyResolver) ResolveRevocation(domain string, disc *discovery.WellKnownResponse) (*revocation.RevocationDocument, error) {
+	return nil, nil
+}
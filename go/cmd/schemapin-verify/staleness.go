@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/utils"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+// maxSignatureAge is --max-signature-age: schemas whose signed_at is older
+// get a signature_stale warning, or fail under a policy whose
+// stale_signatures rule is at fail severity. Zero disables the check.
+var maxSignatureAge time.Duration
+
+// applySignedAt checks the signed_at of a schema whose signature verified
+// against the minimum_signed_at of wellKnown, which may be nil, and
+// --max-signature-age. A superseded signature fails with
+// signature_superseded; a stale one is evaluated like the workflow does
+// (see utils.WithMaxSignatureAge). Schemas without signed_at are not
+// checked.
+func applySignedAt(result *VerificationResult, eval *verification.PolicyEvaluation, signedSchema *SignedSchema, wellKnown *discovery.WellKnownResponse) {
+	signedAt := signedSchema.SignedAt
+	if !result.Valid || signedAt == "" {
+		return
+	}
+	if wellKnown.Supersedes(signedAt) {
+		result.Valid = false
+		result.ErrorCode = string(verification.ErrSignatureSuperseded)
+		result.Error = fmt.Sprintf("signature made at %s is superseded: the domain declares minimum_signed_at %s", signedAt, wellKnown.MinimumSignedAt)
+		return
+	}
+	message, failed := eval.CheckSignatureAge(signedAt, maxSignatureAge, time.Now())
+	if failed {
+		failure := eval.Failure(result.Domain, verification.ErrSignatureStale, message)
+		result.Valid = false
+		result.ErrorCode, result.Error = string(failure.ErrorCode), failure.ErrorMessage
+		result.PolicyRule, result.PolicyFindings = string(failure.PolicyRule), failure.PolicyFindings
+		return
+	}
+	if message != "" && !eval.Enabled() {
+		result.Warnings = append(result.Warnings, utils.WarningSignatureStale+": "+message)
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/skill"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+// timings is --timings: each result reports how long its verification
+// steps took, in metadata and, with --verbose, on one line.
+var timings bool
+
+// displayTimings prints the timing breakdown and the amount hashed
+// recorded in metadata, if any.
+func displayTimings(metadata map[string]interface{}) {
+	steps, ok := metadata[verification.MetadataTimings].(map[string]int64)
+	if !ok {
+		return
+	}
+	var parts []string
+	for _, step := range verification.TimingSteps {
+		if us, ok := steps[step]; ok {
+			parts = append(parts, fmt.Sprintf("%s=%s", step, time.Duration(us)*time.Microsecond))
+		}
+	}
+	fmt.Printf("   Timings: %s\n", strings.Join(parts, " "))
+	if files, ok := metadata[skill.MetadataFilesHashed].(int); ok {
+		fmt.Printf("   Hashed: %d files, %d bytes\n", files, metadata[skill.MetadataBytesHashed])
+	}
+}
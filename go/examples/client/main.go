@@ -10,46 +10,11 @@ import (
 	"strings"
 
 	"github.com/ThirdKeyAi/schemapin/go/internal/version"
-	"github.com/ThirdKeyAi/schemapin/go/pkg/pinning"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery/discoverytest"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/utils"
 )
 
-// mockDiscoveryService simulates .well-known discovery for demonstration
-type mockDiscoveryService struct {
-	wellKnownData map[string]interface{}
-}
-
-func (m *mockDiscoveryService) GetPublicKeyPEM(ctx context.Context, domain string) (string, error) {
-	if domain == "example.com" && m.wellKnownData != nil {
-		if pubKey, ok := m.wellKnownData["public_key_pem"].(string); ok {
-			return pubKey, nil
-		}
-	}
-	return "", fmt.Errorf("public key not found for domain: %s", domain)
-}
-
-func (m *mockDiscoveryService) GetDeveloperInfo(ctx context.Context, domain string) (map[string]string, error) {
-	if domain == "example.com" && m.wellKnownData != nil {
-		info := make(map[string]string)
-		if name, ok := m.wellKnownData["developer_name"].(string); ok {
-			info["developer_name"] = name
-		}
-		if contact, ok := m.wellKnownData["contact"].(string); ok {
-			info["contact"] = contact
-		}
-		if version, ok := m.wellKnownData["schema_version"].(string); ok {
-			info["schema_version"] = version
-		}
-		return info, nil
-	}
-	return nil, fmt.Errorf("developer info not found for domain: %s", domain)
-}
-
-func (m *mockDiscoveryService) ValidateKeyNotRevoked(ctx context.Context, publicKeyPEM, domain string) (bool, error) {
-	// For demo purposes, assume keys are not revoked
-	return true, nil
-}
-
 func main() {
 	fmt.Printf("SchemaPin Client Verification Example v%s\n", version.GetVersion())
 	fmt.Println(strings.Repeat("=", 45))
@@ -89,21 +54,25 @@ func main() {
 	}
 	fmt.Printf("Signature: %s...\n", signature[:32])
 
-	// Load well-known response for mocking
-	var wellKnownData map[string]interface{}
-	if _, err := os.Stat(wellKnownFile); err == nil {
-		wellKnownData, err = loadJSONFile(wellKnownFile)
-		if err != nil {
-			log.Printf("Warning: Failed to load well-known file: %v", err)
-		}
+	// Step 2: Serve the developer's .well-known document from memory
+	fmt.Println("\n2. Configuring in-memory discovery...")
+	wellKnown, err := loadWellKnown(wellKnownFile)
+	if err != nil {
+		log.Fatalf("Failed to load well-known file: %v", err)
 	}
+	stub := discoverytest.New()
+	stub.SetDomain("example.com", wellKnown)
+
+	// In a real deployment the workflow fetches
+	// https://example.com/.well-known/schemapin.json instead
+	fmt.Println("✓ Serving demo_well_known.json for example.com")
 
-	// Step 2: Initialize verification workflow with temporary database
-	fmt.Println("\n2. Initializing verification workflow...")
+	// Step 3: Initialize verification workflow with temporary database
+	fmt.Println("\n3. Initializing verification workflow...")
 	tempDB := "/tmp/schemapin_demo.db"
 	defer os.Remove(tempDB) // Cleanup
 
-	verificationWorkflow, err := utils.NewSchemaVerificationWorkflow(tempDB)
+	verificationWorkflow, err := utils.NewSchemaVerificationWorkflow(tempDB, utils.WithDiscovery(stub))
 	if err != nil {
 		log.Fatalf("Failed to initialize verification workflow: %v", err)
 	}
@@ -111,19 +80,11 @@ func main() {
 
 	fmt.Println("✓ Verification workflow initialized")
 
-	// Step 3: Mock the discovery service for demonstration
-	fmt.Println("\n3. Simulating public key discovery...")
-	mockDiscovery := &mockDiscoveryService{wellKnownData: wellKnownData}
-
-	// Replace the discovery service in the workflow (for demo purposes)
-	// In a real implementation, this would use actual HTTP requests
-	fmt.Println("✓ Mock discovery service configured")
-
 	// Step 4: First-time verification (key pinning)
 	fmt.Println("\n4. First-time verification (TOFU - Trust On First Use)...")
 
-	// For demo purposes, we'll manually handle the verification since we're mocking
-	result, err := performMockVerification(verificationWorkflow, mockDiscovery, schema, signature, "example.com/calculate_sum", "example.com", true)
+	ctx := context.Background()
+	result, err := verificationWorkflow.VerifySchema(ctx, schema, signature, "example.com/calculate_sum", "example.com", true)
 	if err != nil {
 		log.Fatalf("Verification failed: %v", err)
 	}
@@ -153,7 +114,7 @@ func main() {
 	// Step 5: Subsequent verification (using pinned key)
 	fmt.Println("\n5. Subsequent verification (using pinned key)...")
 
-	result2, err := performMockVerification(verificationWorkflow, mockDiscovery, schema, signature, "example.com/calculate_sum", "example.com", false)
+	result2, err := verificationWorkflow.VerifySchema(ctx, schema, signature, "example.com/calculate_sum", "example.com", false)
 	if err != nil {
 		log.Fatalf("Second verification failed: %v", err)
 	}
@@ -162,7 +123,7 @@ func main() {
 
 	if result2.Valid {
 		fmt.Println("✅ Schema signature is VALID (using pinned key)")
-		fmt.Println("🔒 Key was already pinned - no network request needed")
+		fmt.Println("🔒 Verified with the pinned key - discovery was only consulted for revocations")
 	} else {
 		fmt.Println("❌ Schema signature is INVALID")
 	}
@@ -198,7 +159,7 @@ func main() {
 	// Modify the signature to make it invalid
 	invalidSignature := signature[:len(signature)-4] + "XXXX"
 
-	result3, err := performMockVerification(verificationWorkflow, mockDiscovery, schema, invalidSignature, "example.com/calculate_sum", "example.com", false)
+	result3, err := verificationWorkflow.VerifySchema(ctx, schema, invalidSignature, "example.com/calculate_sum", "example.com", false)
 	if err != nil {
 		log.Printf("Expected verification failure: %v", err)
 	}
@@ -217,7 +178,7 @@ func main() {
 	fmt.Println("✓ Invalid signatures are rejected")
 	fmt.Println("✓ Keys are pinned on first use (TOFU)")
 	fmt.Println("✓ Subsequent verifications use pinned keys")
-	fmt.Println("✓ Network requests only needed for new tools")
+	fmt.Println("✓ Keys changed in discovery later are rejected, not trusted")
 }
 
 func loadJSONFile(filename string) (map[string]interface{}, error) {
@@ -234,71 +195,16 @@ func loadJSONFile(filename string) (map[string]interface{}, error) {
 	return result, nil
 }
 
-func performMockVerification(workflow *utils.SchemaVerificationWorkflow, mockDiscovery *mockDiscoveryService, schema map[string]interface{}, signature, toolID, domain string, autoPin bool) (*utils.VerificationResult, error) {
-	ctx := context.Background()
-
-	// Check if key is already pinned
-	pinnedKeyPEM, err := workflow.GetPinnedKeyInfo(toolID)
-	var publicKeyPEM string
-
-	if err != nil || pinnedKeyPEM == nil {
-		// First use - get key from mock discovery
-		publicKeyPEM, err = mockDiscovery.GetPublicKeyPEM(ctx, domain)
-		if err != nil {
-			return &utils.VerificationResult{
-				Valid: false,
-				Error: fmt.Sprintf("could not discover public key: %v", err),
-			}, nil
-		}
-
-		// Auto-pin if requested
-		if autoPin {
-			developerInfo, _ := mockDiscovery.GetDeveloperInfo(ctx, domain)
-			developerName := ""
-			if developerInfo != nil {
-				if name, ok := developerInfo["developer_name"]; ok {
-					developerName = name
-				}
-			}
-
-			// Pin the key manually since we're using mock discovery
-			keyPinning, err := pinning.NewKeyPinning("/tmp/schemapin_demo.db", pinning.PinningModeAutomatic, nil)
-			if err == nil {
-				defer keyPinning.Close()
-				keyPinning.PinKey(toolID, publicKeyPEM, domain, developerName)
-			}
-
-			return &utils.VerificationResult{
-				Valid:         true, // Assume valid for demo
-				Pinned:        true,
-				FirstUse:      true,
-				DeveloperInfo: developerInfo,
-			}, nil
-		}
-	} else {
-		publicKeyPEM = pinnedKeyPEM.PublicKeyPEM
-	}
-
-	// Verify signature using utils
-	schemaHash, err := utils.CalculateSchemaHash(schema)
+func loadWellKnown(filename string) (*discovery.WellKnownResponse, error) {
+	data, err := os.ReadFile(filename)
 	if err != nil {
-		return &utils.VerificationResult{
-			Valid: false,
-			Error: fmt.Sprintf("failed to calculate schema hash: %v", err),
-		}, nil
+		return nil, err
 	}
 
-	valid, err := utils.VerifySignatureOnly(schemaHash, signature, publicKeyPEM)
-	if err != nil {
-		return &utils.VerificationResult{
-			Valid: false,
-			Error: fmt.Sprintf("signature verification failed: %v", err),
-		}, nil
+	var wellKnown discovery.WellKnownResponse
+	if err := json.Unmarshal(data, &wellKnown); err != nil {
+		return nil, err
 	}
 
-	return &utils.VerificationResult{
-		Valid:    valid,
-		Pinned:   pinnedKeyPEM != nil,
-		FirstUse: pinnedKeyPEM == nil,
-	}, nil
+	return &wellKnown, nil
 }
@@ -4,13 +4,17 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io/fs"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/ThirdKeyAi/schemapin/go/internal/version"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/skill"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/utils"
 )
 
@@ -27,6 +31,9 @@ func main() {
 	// Demo 3: Generate signatures for other languages to verify
 	demoGenerateForOtherLanguages()
 
+	// Demo 4: Sign a skill folder for other languages to verify
+	demoSignSkillForOtherLanguages()
+
 	fmt.Println("\n🎉 Cross-language compatibility demo completed!")
 }
 
@@ -173,27 +180,13 @@ func demoJavaScriptCompatibility() {
 func demoGenerateForOtherLanguages() {
 	fmt.Println("\n=== Generate Go Signatures for Other Languages ===")
 
-	// Generate a key pair
-	fmt.Println("1. Generating Go key pair...")
-	keyManager := crypto.NewKeyManager()
-	privateKey, err := keyManager.GenerateKeypair()
+	fmt.Println("1. Generating Go key pair (deterministic test key)...")
+	privateKeyPEM, publicKeyPEM, err := demoKeyPair()
 	if err != nil {
 		log.Printf("Failed to generate key pair: %v", err)
 		return
 	}
 
-	privateKeyPEM, err := keyManager.ExportPrivateKeyPEM(privateKey)
-	if err != nil {
-		log.Printf("Failed to export private key: %v", err)
-		return
-	}
-
-	publicKeyPEM, err := keyManager.ExportPublicKeyPEM(&privateKey.PublicKey)
-	if err != nil {
-		log.Printf("Failed to export public key: %v", err)
-		return
-	}
-
 	fmt.Println("✓ Go key pair generated")
 
 	// Create a test schema
@@ -310,6 +303,115 @@ func demoGenerateForOtherLanguages() {
 	fmt.Println("   JavaScript: Use javascript/examples/client.js with go_demo_* files")
 }
 
+func demoSignSkillForOtherLanguages() {
+	fmt.Println("\n=== Sign a Skill Folder for Other Languages ===")
+
+	// The fixture the Go tests verify Python- and JavaScript-signed copies of
+	sourceDir := "../../pkg/skill/testdata/crosslang/source"
+	skillDir := "go_demo_skill"
+
+	fmt.Println("1. Copying the cross-language fixture skill...")
+	if err := os.RemoveAll(skillDir); err != nil {
+		log.Printf("Failed to remove previous skill folder: %v", err)
+		return
+	}
+	if err := copySkill(sourceDir, skillDir); err != nil {
+		log.Printf("Failed to copy fixture skill: %v", err)
+		return
+	}
+
+	fmt.Println("✓ Skill copied to " + skillDir)
+
+	fmt.Println("\n2. Signing skill with Go implementation...")
+	privateKeyPEM, publicKeyPEM, err := demoKeyPair()
+	if err != nil {
+		log.Printf("Failed to generate key pair: %v", err)
+		return
+	}
+
+	sig, err := skill.SignSkill(skillDir, privateKeyPEM, "go.crosslang.example", "", "")
+	if err != nil {
+		log.Printf("Failed to sign skill: %v", err)
+		return
+	}
+
+	fmt.Printf("✓ Skill signed: %s\n", sig.SkillHash)
+
+	wellKnownResponse := utils.CreateWellKnownResponse(publicKeyPEM, "Go Cross-Language Test", "", []string{}, "1.3", "")
+	wellKnownJSON, _ := json.MarshalIndent(wellKnownResponse, "", "  ")
+	if err := os.WriteFile("go_demo_skill_well_known.json", wellKnownJSON, 0644); err != nil {
+		log.Printf("Failed to save well-known response: %v", err)
+		return
+	}
+
+	fmt.Println("✓ Files saved for cross-language verification:")
+	fmt.Println("  - " + skillDir + "/.schemapin.sig")
+	fmt.Println("  - go_demo_skill_well_known.json")
+
+	fmt.Println("\n3. Self-verification test...")
+	disc := &discovery.WellKnownResponse{}
+	if err := json.Unmarshal(wellKnownJSON, disc); err != nil {
+		log.Printf("Failed to parse well-known response: %v", err)
+		return
+	}
+	result := skill.VerifySkillOffline(skillDir, disc, nil, nil, nil, "")
+	if result.Valid {
+		fmt.Println("✅ Go skill self-verification successful")
+	} else {
+		fmt.Printf("❌ Go skill self-verification failed: %s\n", result.ErrorMessage)
+	}
+
+	fmt.Println("\n4. Verification instructions for other languages:")
+	fmt.Println("   Python: SkillSigner.verify_skill_offline(\"go_demo_skill\", discovery) with go_demo_skill_well_known.json")
+	fmt.Println("   JavaScript: verifySkillOffline('go_demo_skill', discovery) with go_demo_skill_well_known.json")
+}
+
+// demoKeyPair derives a fixed test key pair so the generated public key and
+// fingerprint stay the same between runs. Never do this for real keys.
+func demoKeyPair() (privateKeyPEM, publicKeyPEM string, err error) {
+	keyManager := crypto.NewKeyManager()
+	privateKey, err := keyManager.GenerateKeypairFromSeed([]byte("schemapin-go-cross-language-demo"), crypto.ForTesting)
+	if err != nil {
+		return "", "", err
+	}
+	if privateKeyPEM, err = keyManager.ExportPrivateKeyPEM(privateKey); err != nil {
+		return "", "", err
+	}
+	if publicKeyPEM, err = keyManager.ExportPublicKeyPEM(&privateKey.PublicKey); err != nil {
+		return "", "", err
+	}
+	return privateKeyPEM, publicKeyPEM, nil
+}
+
+// copySkill copies the regular files under src to dst.
+func copySkill(src, dst string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, data, info.Mode().Perm())
+	})
+}
+
 func loadJSONFile(filename string) (map[string]interface{}, error) {
 	data, err := os.ReadFile(filename)
 	if err != nil {
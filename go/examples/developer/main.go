@@ -10,6 +10,8 @@ import (
 
 	"github.com/ThirdKeyAi/schemapin/go/internal/version"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/revocation"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/utils"
 )
 
@@ -79,21 +81,30 @@ func main() {
 
 	// Step 4: Create .well-known response
 	fmt.Println("\n4. Creating .well-known/schemapin.json response...")
-	wellKnownResponse := utils.CreateWellKnownResponse(
-		publicKeyPEM,
-		"Example Tool Developer",
-		"developer@example.com",
-		[]string{}, // No revoked keys
-		"1.2",
-		"",
-	)
+	wellKnownJSON, err := discovery.NewWellKnownBuilder("Example Tool Developer").
+		SetPrimaryKey(publicKeyPEM).
+		SetRevocationURL("https://example.com/.well-known/schemapin-revocations.json").
+		SetContact("developer@example.com").
+		// Prove that the contact was published by whoever holds the key
+		SignContact(privateKeyPEM, "example.com").
+		JSON()
+	if err != nil {
+		log.Fatalf("Failed to create .well-known response: %v", err)
+	}
 
 	fmt.Println("✓ .well-known response created")
-	wellKnownJSON, _ := json.MarshalIndent(wellKnownResponse, "", "  ")
-	fmt.Printf(".well-known content: %s\n", string(wellKnownJSON))
+	fmt.Printf(".well-known content: %s", string(wellKnownJSON))
+
+	// Step 5: Create the revocation document served at revocation_endpoint
+	fmt.Println("\n5. Creating revocation document...")
+	revocationDoc := revocation.BuildRevocationDocument("example.com")
+	// Sequence the document so clients only download newly revoked keys
+	revocation.StartSequence(revocationDoc)
+	fmt.Println("✓ Revocation document created")
+	fmt.Println("  Serve it with revocation.NewHandler to answer ?since=<sequence> with deltas")
 
-	// Step 5: Save files for demonstration
-	fmt.Println("\n5. Saving demonstration files...")
+	// Step 6: Save files for demonstration
+	fmt.Println("\n6. Saving demonstration files...")
 
 	// Save private key (in real use, keep this secure!)
 	if err := os.WriteFile("demo_private_key.pem", []byte(privateKeyPEM), 0600); err != nil {
@@ -111,20 +122,28 @@ func main() {
 	}
 
 	// Save .well-known response
-	wellKnownJSON, _ = json.MarshalIndent(wellKnownResponse, "", "  ")
 	if err := os.WriteFile("demo_well_known.json", wellKnownJSON, 0644); err != nil {
 		log.Fatalf("Failed to save well-known response: %v", err)
 	}
 
+	// Save revocation document
+	revocationJSON, _ := json.MarshalIndent(revocationDoc, "", "  ")
+	if err := os.WriteFile("demo_revocations.json", revocationJSON, 0644); err != nil {
+		log.Fatalf("Failed to save revocation document: %v", err)
+	}
+
 	fmt.Println("✓ Files saved:")
 	fmt.Println("  - demo_private_key.pem (keep secure!)")
 	fmt.Println("  - demo_schema_signed.json")
 	fmt.Println("  - demo_well_known.json")
+	fmt.Println("  - demo_revocations.json")
 
 	fmt.Println("\n" + strings.Repeat("=", 40))
 	fmt.Println("Tool developer workflow complete!")
 	fmt.Println("\nNext steps:")
 	fmt.Println("1. Host demo_well_known.json at https://yourdomain.com/.well-known/schemapin.json")
-	fmt.Println("2. Distribute demo_schema_signed.json with your tool")
-	fmt.Println("3. Keep demo_private_key.pem secure and use it to sign future schema updates")
+	fmt.Println("2. Serve demo_revocations.json at https://yourdomain.com/.well-known/schemapin-revocations.json")
+	fmt.Println("   and add revoked keys with revocation.AddRevokedKey; each addition bumps its sequence")
+	fmt.Println("3. Distribute demo_schema_signed.json with your tool")
+	fmt.Println("4. Keep demo_private_key.pem secure and use it to sign future schema updates")
 }
@@ -0,0 +1,135 @@
+// Package keysource reads private keys for the CLI tools from a file, an
+// environment variable, stdin or an inherited file descriptor, so that CI
+// pipelines can sign without writing the key to disk.
+package keysource
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// maxKeySize bounds the key read from stdin or a file descriptor; PEM keys
+// are a few KiB at most.
+const maxKeySize = 1 << 20
+
+// Source names where a private key PEM is read from. Exactly one field is
+// set.
+type Source struct {
+	// File is a PEM file; "-" reads stdin like Stdin.
+	File string
+	// Env is the name of an environment variable holding the PEM.
+	Env string
+	// Stdin reads the PEM from standard input.
+	Stdin bool
+	// FD is an open file descriptor holding the PEM, such as one a CI
+	// runner passes with 3<secret.pem; 0 means none.
+	FD int
+}
+
+// Validate reports an error unless exactly one source is set.
+func (s Source) Validate() error {
+	given := 0
+	for _, set := range []bool{s.File != "", s.Env != "", s.Stdin, s.FD != 0} {
+		if set {
+			given++
+		}
+	}
+	switch {
+	case given == 0:
+		return fmt.Errorf("no private key given; use --key, --key-env, --key-stdin or --key-fd")
+	case given > 1:
+		return fmt.Errorf("--key, --key-env, --key-stdin and --key-fd are mutually exclusive")
+	case s.FD < 0 || s.FD == 1 || s.FD == 2:
+		return fmt.Errorf("invalid --key-fd %d (use --key-stdin for stdin; stdout and stderr cannot hold a key)", s.FD)
+	}
+	return nil
+}
+
+// ReadsStdin reports whether the key is read from standard input.
+func (s Source) ReadsStdin() bool {
+	return s.Stdin || s.File == "-"
+}
+
+// Read returns the PEM from the source. The caller should clear it once
+// the key is parsed.
+func (s Source) Read() ([]byte, error) {
+	var data []byte
+	var err error
+	switch {
+	case s.ReadsStdin():
+		data, err = readLimited(os.Stdin)
+	case s.File != "":
+		data, err = os.ReadFile(s.File) // #nosec G304 -- path is supplied by the operator
+	case s.Env != "":
+		data = []byte(os.Getenv(s.Env))
+	case s.FD != 0:
+		f := os.NewFile(uintptr(s.FD), fmt.Sprintf("fd %d", s.FD))
+		if f == nil {
+			return nil, fmt.Errorf("file descriptor %d is not open", s.FD)
+		}
+		defer f.Close()
+		data, err = readLimited(f)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key from %s: %w", s, err)
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, fmt.Errorf("private key from %s is empty", s)
+	}
+	return data, nil
+}
+
+func readLimited(r io.Reader) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxKeySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxKeySize {
+		clear(data)
+		return nil, fmt.Errorf("more than %d bytes", maxKeySize)
+	}
+	return data, nil
+}
+
+func (s Source) String() string {
+	switch {
+	case s.ReadsStdin():
+		return "stdin"
+	case s.File != "":
+		return "file " + s.File
+	case s.Env != "":
+		return "environment variable " + s.Env
+	}
+	return fmt.Sprintf("file descriptor %d", s.FD)
+}
+
+// Redact returns err with every line of keyData that appears in its
+// message replaced by "[REDACTED]", so an error about a malformed key
+// cannot echo the key. PEM armor lines and lines too short to be secret
+// are kept. A redacted error does not wrap err, whose message still holds
+// the key.
+func Redact(err error, keyData []byte) error {
+	if err == nil {
+		return nil
+	}
+	msg := err.Error()
+	redacted := false
+	for _, line := range bytes.Split(keyData, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) < 8 || bytes.HasPrefix(line, []byte("-----")) {
+			continue
+		}
+		if s := string(line); strings.Contains(msg, s) {
+			msg = strings.ReplaceAll(msg, s, "[REDACTED]")
+			redacted = true
+		}
+	}
+	if !redacted {
+		return err
+	}
+	return errors.New(msg)
+}
@@ -0,0 +1,39 @@
+// Package logging provides the shared slog conventions for SchemaPin's
+// library packages.
+package logging
+
+import (
+	"context"
+	"log/slog"
+)
+
+// Attribute keys used consistently across packages.
+const (
+	KeyDomain    = "domain"
+	KeyToolID    = "tool_id"
+	KeyErrorCode = "error_code"
+	KeyDuration  = "duration"
+	KeyError     = "error"
+	KeyRequestID = "request_id"
+)
+
+// Discard returns a logger that drops every record. It is the default for
+// all workflows, so that logging is strictly opt-in.
+func Discard() *slog.Logger {
+	return slog.New(discardHandler{})
+}
+
+// OrDiscard returns logger, or Discard if logger is nil.
+func OrDiscard(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return Discard()
+	}
+	return logger
+}
+
+type discardHandler struct{}
+
+func (discardHandler) Enabled(context.Context, slog.Level) bool  { return false }
+func (discardHandler) Handle(context.Context, slog.Record) error { return nil }
+func (h discardHandler) WithAttrs([]slog.Attr) slog.Handler      { return h }
+func (h discardHandler) WithGroup(string) slog.Handler           { return h }
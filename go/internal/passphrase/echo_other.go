@@ -0,0 +1,11 @@
+//go:build !(linux || darwin || dragonfly || freebsd || netbsd || openbsd)
+
+package passphrase
+
+import "os"
+
+// disableEcho is unsupported on this platform, so Prompt reports
+// ErrNoTerminal instead of echoing the passphrase.
+func disableEcho(tty *os.File) (func(), error) {
+	return nil, ErrNoTerminal
+}
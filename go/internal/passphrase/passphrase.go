@@ -0,0 +1,139 @@
+// Package passphrase obtains private key passphrases for the CLI tools.
+// Passphrases come from a file, stdin, a file descriptor, an environment
+// variable or a hidden terminal prompt, never from a command-line
+// argument, which would leak into shell history and process listings.
+package passphrase
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrNoTerminal is returned by Prompt when there is no terminal to read a
+// passphrase from.
+var ErrNoTerminal = errors.New("no terminal to prompt for a passphrase; use --passphrase-file or --passphrase-env")
+
+// Source names where a passphrase is read from. At most one field is set.
+type Source struct {
+	// File is a file whose first line is the passphrase; "-" reads stdin.
+	File string
+	// Env is the name of an environment variable holding the passphrase.
+	Env string
+	// FD is an open file descriptor whose first line is the passphrase;
+	// 0 means none.
+	FD int
+}
+
+// Given reports whether the source names a file, variable or descriptor.
+func (s Source) Given() bool {
+	return s.File != "" || s.Env != "" || s.FD != 0
+}
+
+// ReadsStdin reports whether the passphrase is read from standard input.
+func (s Source) ReadsStdin() bool {
+	return s.File == "-"
+}
+
+// Read returns the passphrase from the file, descriptor or environment
+// variable.
+func (s Source) Read() ([]byte, error) {
+	var passphrase []byte
+	switch {
+	case s.File != "" || s.FD != 0:
+		var data []byte
+		var err error
+		switch {
+		case s.ReadsStdin():
+			data, err = io.ReadAll(os.Stdin)
+		case s.File != "":
+			data, err = os.ReadFile(s.File) // #nosec G304 -- path is supplied by the operator
+		default:
+			data, err = readFD(s.FD)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read passphrase from %s: %w", s, err)
+		}
+		passphrase, _, _ = bytes.Cut(data, []byte("\n"))
+		passphrase = bytes.TrimSuffix(passphrase, []byte("\r"))
+	case s.Env != "":
+		passphrase = []byte(os.Getenv(s.Env))
+	}
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("passphrase from %s is empty", s)
+	}
+	return passphrase, nil
+}
+
+func (s Source) String() string {
+	switch {
+	case s.ReadsStdin():
+		return "stdin"
+	case s.File != "":
+		return "file " + s.File
+	case s.FD != 0:
+		return fmt.Sprintf("file descriptor %d", s.FD)
+	}
+	return "environment variable " + s.Env
+}
+
+func readFD(fd int) ([]byte, error) {
+	if fd < 0 || fd == 1 || fd == 2 {
+		return nil, fmt.Errorf("invalid file descriptor %d", fd)
+	}
+	f := os.NewFile(uintptr(fd), fmt.Sprintf("fd %d", fd))
+	if f == nil {
+		return nil, fmt.Errorf("file descriptor %d is not open", fd)
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// Prompt writes prompt to the terminal and reads a passphrase without
+// echoing it. It reads from the controlling terminal rather than stdin, so
+// stdin can still carry input such as a schema.
+func Prompt(prompt string) ([]byte, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, ErrNoTerminal
+	}
+	defer tty.Close()
+
+	restore, err := disableEcho(tty)
+	if err != nil {
+		return nil, ErrNoTerminal
+	}
+	defer restore()
+
+	fmt.Fprint(tty, prompt)
+	line, err := bufio.NewReader(tty).ReadBytes('\n')
+	fmt.Fprintln(tty)
+	if err != nil && len(line) == 0 {
+		return nil, fmt.Errorf("failed to read passphrase: %w", err)
+	}
+	line = bytes.TrimRight(line, "\r\n")
+	if len(line) == 0 {
+		return nil, fmt.Errorf("passphrase cannot be empty")
+	}
+	return line, nil
+}
+
+// PromptNew prompts for a new passphrase twice and fails if the entries
+// differ.
+func PromptNew(prompt string) ([]byte, error) {
+	first, err := Prompt(prompt)
+	if err != nil {
+		return nil, err
+	}
+	second, err := Prompt("Confirm passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(first, second) {
+		return nil, fmt.Errorf("passphrases do not match")
+	}
+	return first, nil
+}
@@ -0,0 +1,69 @@
+package passphrase
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSourceRead(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		return path
+	}
+	t.Setenv("SCHEMAPIN_TEST_PASSPHRASE", "from env")
+
+	fdFile, err := os.Open(write("fd", "from fd\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fdFile.Close()
+	stdinFile, err := os.Open(write("stdin", "from stdin\nschema\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdinFile.Close()
+	stdin := os.Stdin
+	os.Stdin = stdinFile
+	defer func() { os.Stdin = stdin }()
+
+	tests := []struct {
+		name    string
+		source  Source
+		want    string
+		wantErr bool
+	}{
+		{"file", Source{File: write("plain", "secret")}, "secret", false},
+		{"first line only", Source{File: write("lines", "secret\nignored\n")}, "secret", false},
+		{"CRLF", Source{File: write("crlf", "secret\r\n")}, "secret", false},
+		{"spaces kept", Source{File: write("spaces", " secret \n")}, " secret ", false},
+		{"empty file", Source{File: write("empty", "\n")}, "", true},
+		{"missing file", Source{File: filepath.Join(dir, "missing")}, "", true},
+		{"env", Source{Env: "SCHEMAPIN_TEST_PASSPHRASE"}, "from env", false},
+		{"unset env", Source{Env: "SCHEMAPIN_TEST_UNSET"}, "", true},
+		{"fd", Source{FD: int(fdFile.Fd())}, "from fd", false},
+		{"stdout fd", Source{FD: 1}, "", true},
+		{"stdin", Source{File: "-"}, "from stdin", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.source.Read()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected an error, got %q", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Read failed: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
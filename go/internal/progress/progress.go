@@ -0,0 +1,143 @@
+// Package progress shows skill hashing progress for the CLI tools: as a bar
+// redrawn in place on a terminal, or as JSON lines for other programs.
+package progress
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/skill"
+)
+
+// barWidth is the number of cells in the bar.
+const barWidth = 24
+
+// Options selects how progress is shown.
+type Options struct {
+	// Quiet shows nothing, as for --quiet.
+	Quiet bool
+	// JSON writes each report as a JSON line, as for --progress-json,
+	// whether or not the output is a terminal.
+	JSON bool
+}
+
+// Reporter shows the reports of a skill.ProgressFunc on w. Finish must be
+// called once hashing is over.
+type Reporter struct {
+	w     io.Writer
+	label string
+	json  bool
+	mu    sync.Mutex
+	width int
+}
+
+// New returns a Reporter writing to w, labelling the bar with label, or
+// nil when nothing is to be shown: with opts.Quiet, or without opts.JSON
+// when w is not a terminal. A nil Reporter's Func is nil.
+func New(w io.Writer, label string, opts Options) *Reporter {
+	if opts.Quiet || (!opts.JSON && !IsTerminal(w)) {
+		return nil
+	}
+	return &Reporter{w: w, label: label, json: opts.JSON}
+}
+
+// IsTerminal reports whether w is a character device, such as a terminal.
+func IsTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// Func returns the skill.ProgressFunc to pass to the skill package.
+func (r *Reporter) Func() skill.ProgressFunc {
+	if r == nil {
+		return nil
+	}
+	return r.Update
+}
+
+// Update shows p.
+func (r *Reporter) Update(p skill.Progress) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.json {
+		line, err := json.Marshal(struct {
+			Type string `json:"type"`
+			skill.Progress
+		}{"progress", p})
+		if err == nil {
+			fmt.Fprintf(r.w, "%s\n", line)
+		}
+		return
+	}
+
+	label := r.label
+	if p.Skill != "" {
+		label = p.Skill
+	}
+	line := label + " " + Bar(p)
+	// Blank out the rest of a longer previous line
+	pad := r.width - len(line)
+	r.width = len(line)
+	if pad < 0 {
+		pad = 0
+	}
+	fmt.Fprintf(r.w, "\r%s%s", line, strings.Repeat(" ", pad))
+}
+
+// Finish ends the bar's line, if one was drawn.
+func (r *Reporter) Finish() {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.width > 0 {
+		fmt.Fprintln(r.w)
+		r.width = 0
+	}
+}
+
+// Bar renders p as "[####----]  50%  150/300 files  1.2 MB/2.4 MB". The
+// fraction is of bytes, or of files when the total size is unknown.
+func Bar(p skill.Progress) string {
+	fraction := 0.0
+	switch {
+	case p.TotalBytes > 0:
+		fraction = float64(p.BytesHashed) / float64(p.TotalBytes)
+	case p.TotalFiles > 0:
+		fraction = float64(p.FilesProcessed) / float64(p.TotalFiles)
+	}
+	if fraction > 1 {
+		fraction = 1
+	}
+	filled := int(fraction * barWidth)
+	return fmt.Sprintf("[%s%s] %3d%%  %d/%d files  %s/%s",
+		strings.Repeat("#", filled), strings.Repeat("-", barWidth-filled),
+		int(fraction*100), p.FilesProcessed, p.TotalFiles,
+		formatSize(p.BytesHashed), formatSize(p.TotalBytes))
+}
+
+// formatSize formats n bytes in decimal units.
+func formatSize(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "kMGTPE"[exp])
+}
@@ -0,0 +1,60 @@
+package progress
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/skill"
+)
+
+func TestBar(t *testing.T) {
+	tests := []struct {
+		p    skill.Progress
+		want string
+	}{
+		{skill.Progress{TotalFiles: 300, TotalBytes: 2_400_000}, "[------------------------]   0%  0/300 files  0 B/2.4 MB"},
+		{skill.Progress{FilesProcessed: 150, TotalFiles: 300, BytesHashed: 1_200_000, TotalBytes: 2_400_000}, "[############------------]  50%  150/300 files  1.2 MB/2.4 MB"},
+		{skill.Progress{FilesProcessed: 3, TotalFiles: 4}, "[##################------]  75%  3/4 files  0 B/0 B"},
+		{skill.Progress{FilesProcessed: 5, TotalFiles: 4, BytesHashed: 999, TotalBytes: 10}, "[########################] 100%  5/4 files  999 B/10 B"},
+	}
+	for _, tt := range tests {
+		if got := Bar(tt.p); got != tt.want {
+			t.Errorf("Bar(%+v) = %q, want %q", tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestReporterNotTerminal(t *testing.T) {
+	var out bytes.Buffer
+	if r := New(&out, "skill", Options{}); r != nil || r.Func() != nil {
+		t.Error("Expected no bar on a writer that is not a terminal")
+	}
+	if r := New(&out, "skill", Options{JSON: true, Quiet: true}); r != nil {
+		t.Error("Expected --quiet to suppress progress")
+	}
+	var none *Reporter
+	none.Finish()
+}
+
+func TestReporterJSON(t *testing.T) {
+	var out bytes.Buffer
+	r := New(&out, "skill", Options{JSON: true})
+	progress := r.Func()
+	progress(skill.Progress{TotalFiles: 2, TotalBytes: 10})
+	progress(skill.Progress{FilesProcessed: 2, TotalFiles: 2, BytesHashed: 10, TotalBytes: 10})
+	r.Finish()
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected a JSON line per report, got %q", out.String())
+	}
+	var record map[string]interface{}
+	if err := json.Unmarshal([]byte(lines[1]), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["type"] != "progress" || record["files_processed"] != float64(2) || record["total_bytes"] != float64(10) {
+		t.Errorf("Unexpected progress record %v", record)
+	}
+}
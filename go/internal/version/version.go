@@ -8,3 +8,9 @@ var Version = "1.4.0-alpha.4"
 func GetVersion() string {
 	return Version
 }
+
+// UserAgent returns the User-Agent SchemaPin sends on its HTTP requests,
+// schemapin-go/<version>.
+func UserAgent() string {
+	return "schemapin-go/" + Version
+}
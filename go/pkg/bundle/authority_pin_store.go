@@ -11,7 +11,11 @@ package bundle
 // KeyPinning type so bundle distribution stays self-contained and easy to embed
 // (matching the Rust reference, which uses an in-memory store for authorities).
 
-import "fmt"
+import (
+	"fmt"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+)
 
 // PinningResult is the outcome of checking a key fingerprint against the store.
 type PinningResult int
@@ -52,7 +56,7 @@ func (s *AuthorityPinStore) CheckAndPin(kid, domain, fingerprint string) Pinning
 		s.fingerprints[key] = fingerprint
 		return PinningResultFirstUse
 	}
-	if pinned == fingerprint {
+	if crypto.FingerprintEqual(pinned, fingerprint) {
 		return PinningResultMatched
 	}
 	return PinningResultChanged
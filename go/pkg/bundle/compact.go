@@ -0,0 +1,449 @@
+// Compact binary encoding of trust bundles for constrained devices.
+
+package bundle
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/revocation"
+)
+
+// CompactMagic starts every compactly encoded bundle. Its first byte is not
+// valid at the start of a JSON document, so Parse can tell the encodings
+// apart.
+var CompactMagic = []byte{0xF5, 'S', 'P', 'B'}
+
+// compactVersion is the version byte following CompactMagic.
+const compactVersion = 1
+
+// The compact encoding is a sequence of fields, each an unsigned varint
+// field number, an unsigned varint length and that many bytes. A field
+// holds a string, raw bytes, a nested message or a list, whose items are
+// each a varint length followed by the item. Empty strings are omitted; a
+// list field is present, possibly empty, exactly when the slice or map is
+// non-nil, so decoding reproduces the struct exactly. Public keys whose PEM
+// is in the standard form pem.EncodeToMemory writes are stored as SPKI DER
+// and turned back into the same PEM; others are stored as written.
+//
+// Field numbers, by message:
+//
+//	bundle:            1 schemapin_bundle_version, 2 created_at, 3 documents,
+//	                   4 revocations, 5 bundle_authority, 6 signed_at,
+//	                   7 expires_at, 8 signature
+//	document:          1 domain, 2 schema_version, 3 developer_name,
+//	                   4 public key DER, 5 public_key_pem, 6 contact,
+//	                   7 contact_proof, 8 revoked_keys, 9 revocation_endpoint,
+//	                   10 tools
+//	tool:              1 prefix, 2 public key DER, 3 public_key_pem,
+//	                   4 developer_name, 5 revoked_keys
+//	bundle_authority:  1 kid, 2 public key DER, 3 public_key_pem
+//	revocation:        1 schemapin_version, 2 domain, 3 updated_at,
+//	                   4 revoked_keys, 5 revoked_signatures
+//	revoked key:       1 fingerprint, 2 revoked_at, 3 reason
+//	revoked signature: 1 schema_hash, 2 revoked_at, 3 reason
+//
+// Decoders reject duplicate fields and skip field numbers they do not know.
+
+// EncodeCompact encodes b in the compact binary encoding. ParseCompact
+// decodes the result to a bundle equal to b.
+func EncodeCompact(b *SchemaPinTrustBundle) []byte {
+	var e compactEncoder
+	e.string(1, b.SchemapinBundleVersion)
+	e.string(2, b.CreatedAt)
+	if b.Documents != nil {
+		e.list(3, len(b.Documents), func(i int, item *compactEncoder) {
+			item.document(&b.Documents[i])
+		})
+	}
+	if b.Revocations != nil {
+		e.list(4, len(b.Revocations), func(i int, item *compactEncoder) {
+			item.revocation(&b.Revocations[i])
+		})
+	}
+	if b.BundleAuthority != nil {
+		e.message(5, func(m *compactEncoder) {
+			m.string(1, b.BundleAuthority.Kid)
+			m.publicKey(2, 3, b.BundleAuthority.PublicKeyPEM)
+		})
+	}
+	e.string(6, b.SignedAt)
+	e.string(7, b.ExpiresAt)
+	e.string(8, b.Signature)
+
+	out := append([]byte(nil), CompactMagic...)
+	out = append(out, compactVersion)
+	return append(out, e.buf...)
+}
+
+// ParseCompact decodes a bundle written by EncodeCompact. The input is
+// treated as untrusted: malformed or truncated data returns an error.
+func ParseCompact(data []byte) (*SchemaPinTrustBundle, error) {
+	b, err := parseCompact(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse compact trust bundle: %w", err)
+	}
+	return b, nil
+}
+
+// Parse parses a trust bundle in either encoding, told apart by its
+// leading bytes: CompactMagic for the compact encoding, otherwise JSON.
+func Parse(data []byte) (*SchemaPinTrustBundle, error) {
+	if IsCompact(data) {
+		return ParseCompact(data)
+	}
+	return ParseTrustBundle(string(data))
+}
+
+// IsCompact reports whether data starts with CompactMagic.
+func IsCompact(data []byte) bool {
+	return bytes.HasPrefix(data, CompactMagic)
+}
+
+func parseCompact(data []byte) (*SchemaPinTrustBundle, error) {
+	if !IsCompact(data) {
+		return nil, errors.New("missing compact bundle header")
+	}
+	data = data[len(CompactMagic):]
+	if len(data) == 0 || data[0] != compactVersion {
+		return nil, errors.New("unsupported compact bundle version")
+	}
+	fields, err := compactFields(data[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	b := &SchemaPinTrustBundle{
+		SchemapinBundleVersion: fields.string(1),
+		CreatedAt:              fields.string(2),
+		SignedAt:               fields.string(6),
+		ExpiresAt:              fields.string(7),
+		Signature:              fields.string(8),
+	}
+	if raw, ok := fields[3]; ok {
+		b.Documents = []BundledDiscovery{}
+		err := compactItems(raw, func(item []byte) error {
+			doc, err := decodeDocument(item)
+			if err != nil {
+				return fmt.Errorf("document %d: %w", len(b.Documents), err)
+			}
+			b.Documents = append(b.Documents, doc)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if raw, ok := fields[4]; ok {
+		b.Revocations = []revocation.RevocationDocument{}
+		err := compactItems(raw, func(item []byte) error {
+			rev, err := decodeRevocation(item)
+			if err != nil {
+				return fmt.Errorf("revocation %d: %w", len(b.Revocations), err)
+			}
+			b.Revocations = append(b.Revocations, rev)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	if raw, ok := fields[5]; ok {
+		authority, err := compactFields(raw)
+		if err != nil {
+			return nil, fmt.Errorf("bundle_authority: %w", err)
+		}
+		b.BundleAuthority = &BundleAuthority{Kid: authority.string(1)}
+		if b.BundleAuthority.PublicKeyPEM, err = authority.publicKey(2, 3); err != nil {
+			return nil, fmt.Errorf("bundle_authority: %w", err)
+		}
+	}
+	return b, nil
+}
+
+func decodeDocument(data []byte) (BundledDiscovery, error) {
+	fields, err := compactFields(data)
+	if err != nil {
+		return BundledDiscovery{}, err
+	}
+	doc := BundledDiscovery{
+		Domain: fields.string(1),
+		WellKnown: discovery.WellKnownResponse{
+			SchemaVersion:      fields.string(2),
+			DeveloperName:      fields.string(3),
+			Contact:            fields.string(6),
+			ContactProof:       fields.string(7),
+			RevocationEndpoint: fields.string(9),
+		},
+	}
+	if doc.WellKnown.PublicKeyPEM, err = fields.publicKey(4, 5); err != nil {
+		return BundledDiscovery{}, err
+	}
+	if doc.WellKnown.RevokedKeys, err = fields.strings(8); err != nil {
+		return BundledDiscovery{}, err
+	}
+	if raw, ok := fields[10]; ok {
+		doc.WellKnown.Tools = map[string]discovery.ToolKey{}
+		err := compactItems(raw, func(item []byte) error {
+			tool, err := compactFields(item)
+			if err != nil {
+				return fmt.Errorf("tool: %w", err)
+			}
+			prefix := tool.string(1)
+			if _, dup := doc.WellKnown.Tools[prefix]; dup {
+				return fmt.Errorf("duplicate tool prefix %q", prefix)
+			}
+			key := discovery.ToolKey{DeveloperName: tool.string(4)}
+			if key.PublicKeyPEM, err = tool.publicKey(2, 3); err != nil {
+				return fmt.Errorf("tool %q: %w", prefix, err)
+			}
+			if key.RevokedKeys, err = tool.strings(5); err != nil {
+				return fmt.Errorf("tool %q: %w", prefix, err)
+			}
+			doc.WellKnown.Tools[prefix] = key
+			return nil
+		})
+		if err != nil {
+			return BundledDiscovery{}, err
+		}
+	}
+	return doc, nil
+}
+
+func decodeRevocation(data []byte) (revocation.RevocationDocument, error) {
+	fields, err := compactFields(data)
+	if err != nil {
+		return revocation.RevocationDocument{}, err
+	}
+	rev := revocation.RevocationDocument{
+		SchemapinVersion: fields.string(1),
+		Domain:           fields.string(2),
+		UpdatedAt:        fields.string(3),
+	}
+	if raw, ok := fields[4]; ok {
+		rev.RevokedKeys = []revocation.RevokedKey{}
+		err := compactItems(raw, func(item []byte) error {
+			key, err := compactFields(item)
+			if err != nil {
+				return fmt.Errorf("revoked key: %w", err)
+			}
+			rev.RevokedKeys = append(rev.RevokedKeys, revocation.RevokedKey{
+				Fingerprint: key.string(1),
+				RevokedAt:   key.string(2),
+				Reason:      revocation.RevocationReason(key.string(3)),
+			})
+			return nil
+		})
+		if err != nil {
+			return revocation.RevocationDocument{}, err
+		}
+	}
+	if raw, ok := fields[5]; ok {
+		rev.RevokedSignatures = []revocation.RevokedSignature{}
+		err := compactItems(raw, func(item []byte) error {
+			sig, err := compactFields(item)
+			if err != nil {
+				return fmt.Errorf("revoked signature: %w", err)
+			}
+			rev.RevokedSignatures = append(rev.RevokedSignatures, revocation.RevokedSignature{
+				SchemaHash: sig.string(1),
+				RevokedAt:  sig.string(2),
+				Reason:     revocation.RevocationReason(sig.string(3)),
+			})
+			return nil
+		})
+		if err != nil {
+			return revocation.RevocationDocument{}, err
+		}
+	}
+	return rev, nil
+}
+
+// compactEncoder appends fields to buf.
+type compactEncoder struct {
+	buf []byte
+}
+
+func (e *compactEncoder) bytes(field uint64, value []byte) {
+	e.buf = binary.AppendUvarint(e.buf, field)
+	e.buf = binary.AppendUvarint(e.buf, uint64(len(value)))
+	e.buf = append(e.buf, value...)
+}
+
+func (e *compactEncoder) string(field uint64, value string) {
+	if value != "" {
+		e.bytes(field, []byte(value))
+	}
+}
+
+func (e *compactEncoder) message(field uint64, encode func(*compactEncoder)) {
+	var m compactEncoder
+	encode(&m)
+	e.bytes(field, m.buf)
+}
+
+// list writes n items as one field; callers skip it for nil slices.
+func (e *compactEncoder) list(field uint64, n int, encode func(i int, item *compactEncoder)) {
+	var items []byte
+	for i := 0; i < n; i++ {
+		var item compactEncoder
+		encode(i, &item)
+		items = binary.AppendUvarint(items, uint64(len(item.buf)))
+		items = append(items, item.buf...)
+	}
+	e.bytes(field, items)
+}
+
+func (e *compactEncoder) strings(field uint64, values []string) {
+	if values != nil {
+		e.list(field, len(values), func(i int, item *compactEncoder) {
+			item.buf = append(item.buf, values[i]...)
+		})
+	}
+}
+
+// publicKey writes a standard-form PEM public key as DER in derField, and
+// any other value as written in pemField.
+func (e *compactEncoder) publicKey(derField, pemField uint64, publicKeyPEM string) {
+	block, rest := pem.Decode([]byte(publicKeyPEM))
+	if block != nil && len(rest) == 0 && block.Type == "PUBLIC KEY" && len(block.Headers) == 0 &&
+		crypto.PublicKeyPEMEqual(string(pem.EncodeToMemory(block)), publicKeyPEM) {
+		e.bytes(derField, block.Bytes)
+		return
+	}
+	e.string(pemField, publicKeyPEM)
+}
+
+func (e *compactEncoder) document(doc *BundledDiscovery) {
+	w := &doc.WellKnown
+	e.string(1, doc.Domain)
+	e.string(2, w.SchemaVersion)
+	e.string(3, w.DeveloperName)
+	e.publicKey(4, 5, w.PublicKeyPEM)
+	e.string(6, w.Contact)
+	e.string(7, w.ContactProof)
+	e.strings(8, w.RevokedKeys)
+	e.string(9, w.RevocationEndpoint)
+	if w.Tools != nil {
+		prefixes := make([]string, 0, len(w.Tools))
+		for prefix := range w.Tools {
+			prefixes = append(prefixes, prefix)
+		}
+		sort.Strings(prefixes)
+		e.list(10, len(prefixes), func(i int, item *compactEncoder) {
+			key := w.Tools[prefixes[i]]
+			item.string(1, prefixes[i])
+			item.publicKey(2, 3, key.PublicKeyPEM)
+			item.string(4, key.DeveloperName)
+			item.strings(5, key.RevokedKeys)
+		})
+	}
+}
+
+func (e *compactEncoder) revocation(rev *revocation.RevocationDocument) {
+	e.string(1, rev.SchemapinVersion)
+	e.string(2, rev.Domain)
+	e.string(3, rev.UpdatedAt)
+	if rev.RevokedKeys != nil {
+		e.list(4, len(rev.RevokedKeys), func(i int, item *compactEncoder) {
+			key := rev.RevokedKeys[i]
+			item.string(1, key.Fingerprint)
+			item.string(2, key.RevokedAt)
+			item.string(3, string(key.Reason))
+		})
+	}
+	if rev.RevokedSignatures != nil {
+		e.list(5, len(rev.RevokedSignatures), func(i int, item *compactEncoder) {
+			sig := rev.RevokedSignatures[i]
+			item.string(1, sig.SchemaHash)
+			item.string(2, sig.RevokedAt)
+			item.string(3, string(sig.Reason))
+		})
+	}
+}
+
+// compactMessage is a decoded message: field number to field bytes.
+type compactMessage map[uint64][]byte
+
+// compactFields splits a message into its fields.
+func compactFields(data []byte) (compactMessage, error) {
+	fields := compactMessage{}
+	for len(data) > 0 {
+		field, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errors.New("malformed field number")
+		}
+		data = data[n:]
+		value, rest, err := compactLengthPrefixed(data)
+		if err != nil {
+			return nil, fmt.Errorf("field %d: %w", field, err)
+		}
+		if _, dup := fields[field]; dup {
+			return nil, fmt.Errorf("duplicate field %d", field)
+		}
+		fields[field], data = value, rest
+	}
+	return fields, nil
+}
+
+// compactItems calls visit for each item of a list field.
+func compactItems(data []byte, visit func(item []byte) error) error {
+	for len(data) > 0 {
+		item, rest, err := compactLengthPrefixed(data)
+		if err != nil {
+			return err
+		}
+		if err := visit(item); err != nil {
+			return err
+		}
+		data = rest
+	}
+	return nil
+}
+
+// compactLengthPrefixed splits a varint length and that many bytes off data.
+func compactLengthPrefixed(data []byte) (value, rest []byte, err error) {
+	length, n := binary.Uvarint(data)
+	if n <= 0 {
+		return nil, nil, errors.New("malformed length")
+	}
+	data = data[n:]
+	if length > uint64(len(data)) {
+		return nil, nil, errors.New("length exceeds remaining data")
+	}
+	return data[:length], data[length:], nil
+}
+
+func (m compactMessage) string(field uint64) string {
+	return string(m[field])
+}
+
+func (m compactMessage) strings(field uint64) ([]string, error) {
+	raw, ok := m[field]
+	if !ok {
+		return nil, nil
+	}
+	values := []string{}
+	err := compactItems(raw, func(item []byte) error {
+		values = append(values, string(item))
+		return nil
+	})
+	return values, err
+}
+
+func (m compactMessage) publicKey(derField, pemField uint64) (string, error) {
+	der, hasDER := m[derField]
+	if !hasDER {
+		return m.string(pemField), nil
+	}
+	if _, hasPEM := m[pemField]; hasPEM {
+		return "", errors.New("public key given both as DER and PEM")
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
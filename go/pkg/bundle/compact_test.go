@@ -0,0 +1,196 @@
+package bundle
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/revocation"
+)
+
+// makeLargeBundle returns a bundle of n domains with real P-256 keys.
+func makeLargeBundle(tb testing.TB, n int) *SchemaPinTrustBundle {
+	tb.Helper()
+	km := crypto.NewKeyManager()
+	b := NewTrustBundle("2026-01-01T00:00:00Z")
+	for i := 0; i < n; i++ {
+		priv, err := km.GenerateKeypair()
+		if err != nil {
+			tb.Fatal(err)
+		}
+		publicKeyPEM, err := km.ExportPublicKeyPEM(&priv.PublicKey)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		domain := fmt.Sprintf("tools-%03d.example.com", i)
+		b.Documents = append(b.Documents, BundledDiscovery{
+			Domain: domain,
+			WellKnown: discovery.WellKnownResponse{
+				SchemaVersion:      "1.3",
+				DeveloperName:      fmt.Sprintf("Developer %d", i),
+				PublicKeyPEM:       publicKeyPEM,
+				RevocationEndpoint: "https://" + domain + "/.well-known/schemapin-revocations.json",
+			},
+		})
+		if i%10 == 0 {
+			rev := revocation.BuildRevocationDocument(domain)
+			revocation.AddRevokedKey(rev, fmt.Sprintf("sha256:%064x", i), revocation.ReasonSuperseded)
+			b.Revocations = append(b.Revocations, *rev)
+		}
+	}
+	return b
+}
+
+func TestCompactRoundTrip(t *testing.T) {
+	b := makeLargeBundle(t, 3)
+	b.Documents[0].WellKnown.Contact = "security@example.com"
+	b.Documents[0].WellKnown.ContactProof = "MEUCIQ..."
+	b.Documents[0].WellKnown.RevokedKeys = []string{"sha256:aa", "sha256:bb"}
+	b.Documents[1].WellKnown.Tools = map[string]discovery.ToolKey{
+		"acme":        {PublicKeyPEM: b.Documents[2].WellKnown.PublicKeyPEM, DeveloperName: "Acme"},
+		"acme/search": {PublicKeyPEM: "not a PEM", RevokedKeys: []string{}},
+	}
+	// Keys not in standard PEM form are kept as written
+	b.Documents[2].WellKnown.PublicKeyPEM = strings.ReplaceAll(b.Documents[2].WellKnown.PublicKeyPEM, "\n", "\r\n")
+	b.Revocations[0].RevokedSignatures = []revocation.RevokedSignature{
+		{SchemaHash: "sha256:cc", RevokedAt: "2026-02-01T00:00:00Z", Reason: revocation.ReasonKeyCompromise},
+	}
+	b.Revocations = append(b.Revocations, revocation.RevocationDocument{Domain: "empty.example.com"})
+
+	got, err := ParseCompact(EncodeCompact(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, b) {
+		t.Errorf("round trip mismatch:\n got %+v\nwant %+v", got, b)
+	}
+
+	// Nil and empty slices stay distinct, so JSON output is unchanged
+	empty := &SchemaPinTrustBundle{SchemapinBundleVersion: "1.2", Documents: []BundledDiscovery{}}
+	if got, err := ParseCompact(EncodeCompact(empty)); err != nil || !reflect.DeepEqual(got, empty) {
+		t.Errorf("expected %+v, got %+v (%v)", empty, got, err)
+	}
+}
+
+func TestCompactSignedBundle(t *testing.T) {
+	signed, err := SignTrustBundle(makeLargeBundle(t, 2), genKeyPair(t), "auth", "2026-05-15T00:00:00Z", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ParseCompact(EncodeCompact(signed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyTrustBundle(got, NewAuthorityPinStore()); err != nil {
+		t.Errorf("expected the decoded bundle to verify, got %v", err)
+	}
+}
+
+func TestParseDetectsEncoding(t *testing.T) {
+	b := makeBundle()
+	jsonData, err := json.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range map[string][]byte{
+		"json":    jsonData,
+		"indent":  append([]byte("\n  "), jsonData...),
+		"compact": EncodeCompact(b),
+	} {
+		got, err := Parse(data)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if got.FindDiscovery("example.com") == nil || got.FindRevocation("example.com") == nil {
+			t.Errorf("%s: expected example.com in %+v", name, got)
+		}
+	}
+}
+
+func TestParseCompactInvalid(t *testing.T) {
+	valid := EncodeCompact(makeBundle())
+	header := func(fields ...byte) []byte {
+		return append(append(append([]byte(nil), CompactMagic...), compactVersion), fields...)
+	}
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"no header", []byte{1, 2, 3}},
+		{"no version", CompactMagic},
+		{"unknown version", append(append([]byte(nil), CompactMagic...), 9)},
+		{"truncated", valid[:len(valid)-3]},
+		{"length past end", header(1, 10, 'a')},
+		{"malformed varint", header(0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x01)},
+		{"duplicate field", header(1, 1, 'a', 1, 1, 'b')},
+		{"malformed document", header(3, 3, 2, 1, 0xFF)},
+		{"key as DER and PEM", header(3, 7, 6, 4, 1, 'x', 5, 1, 'y')},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseCompact(tt.data); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestCompactSmallerThanJSON(t *testing.T) {
+	b := makeLargeBundle(t, 200)
+	jsonData, err := json.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compact := EncodeCompact(b)
+	if len(compact)*10 > len(jsonData)*6 {
+		t.Errorf("expected the compact encoding to be under 60%% of the JSON size, got %d vs %d bytes", len(compact), len(jsonData))
+	}
+}
+
+func BenchmarkParseBundle200(b *testing.B) {
+	bundle := makeLargeBundle(b, 200)
+	jsonData, err := json.Marshal(bundle)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for name, data := range map[string][]byte{"json": jsonData, "compact": EncodeCompact(bundle)} {
+		b.Run(name, func(b *testing.B) {
+			b.ReportMetric(float64(len(data)), "bundle-bytes")
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := Parse(data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// FuzzParseCompact checks that the compact parser never panics on
+// untrusted bytes, and that whatever it accepts re-encodes to the same
+// bundle.
+func FuzzParseCompact(f *testing.F) {
+	f.Add(EncodeCompact(makeBundle()))
+	f.Add(EncodeCompact(makeLargeBundle(f, 2)))
+	f.Add(EncodeCompact(&SchemaPinTrustBundle{}))
+	f.Add(append(append([]byte(nil), CompactMagic...), compactVersion, 3, 3, 2, 1, 0xFF))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		b, err := ParseCompact(data)
+		if err != nil {
+			return
+		}
+		again, err := ParseCompact(EncodeCompact(b))
+		if err != nil {
+			t.Fatalf("re-encoded bundle failed to parse: %v", err)
+		}
+		if !reflect.DeepEqual(again, b) {
+			t.Fatalf("re-encoded bundle differs:\n got %+v\nwant %+v", again, b)
+		}
+	})
+}
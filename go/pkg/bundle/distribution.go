@@ -23,12 +23,12 @@ package bundle
 
 import (
 	"bytes"
-	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	"sort"
 	"time"
 
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/revocation"
 )
@@ -230,9 +230,9 @@ func SignTrustBundle(b *SchemaPinTrustBundle, privateKeyPEM, kid, signedAt, expi
 		return nil, err
 	}
 
-	hash := sha256.Sum256([]byte(canonical))
+	// ECDSA P-256 with SHA-256 over the canonical bytes, as in Rust
 	sm := crypto.NewSignatureManager()
-	sig, err := sm.SignHash(hash[:], priv)
+	sig, err := sm.SignHash([]byte(canonical), priv)
 	if err != nil {
 		return nil, fmt.Errorf("failed to sign bundle: %w", err)
 	}
@@ -240,6 +240,21 @@ func SignTrustBundle(b *SchemaPinTrustBundle, privateKeyPEM, kid, signedAt, expi
 	return signed, nil
 }
 
+// VerifyOption configures VerifyTrustBundle.
+type VerifyOption func(*verifyOptions)
+
+type verifyOptions struct {
+	clock clock.Clock
+}
+
+// WithClock sets the time expires_at is compared against. The default is
+// clock.Real.
+func WithClock(c clock.Clock) VerifyOption {
+	return func(o *verifyOptions) {
+		o.clock = clock.OrReal(c)
+	}
+}
+
 // VerifyTrustBundle verifies a signed trust bundle and TOFU-pins its authority
 // key by kid.
 //
@@ -250,7 +265,12 @@ func SignTrustBundle(b *SchemaPinTrustBundle, privateKeyPEM, kid, signedAt, expi
 //
 // On a verification failure the returned error is a *BundleError whose Code is
 // the relevant ErrorCode.
-func VerifyTrustBundle(b *SchemaPinTrustBundle, authorityPinStore *AuthorityPinStore) error {
+func VerifyTrustBundle(b *SchemaPinTrustBundle, authorityPinStore *AuthorityPinStore, opts ...VerifyOption) error {
+	options := verifyOptions{clock: clock.Real}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
 	if b.BundleAuthority == nil {
 		return newBundleError(ErrBundleUnsigned, "trust bundle has no bundle_authority")
 	}
@@ -264,7 +284,7 @@ func VerifyTrustBundle(b *SchemaPinTrustBundle, authorityPinStore *AuthorityPinS
 			return newBundleError(ErrBundleExpired,
 				fmt.Sprintf("unparseable expires_at '%s': %v", b.ExpiresAt, err))
 		}
-		if time.Now().After(exp) {
+		if options.clock.Now().After(exp) {
 			return newBundleError(ErrBundleExpired,
 				fmt.Sprintf("trust bundle expired at %s", b.ExpiresAt))
 		}
@@ -289,9 +309,8 @@ func VerifyTrustBundle(b *SchemaPinTrustBundle, authorityPinStore *AuthorityPinS
 	if err != nil {
 		return err
 	}
-	hash := sha256.Sum256([]byte(canonical))
 	sm := crypto.NewSignatureManager()
-	if !sm.VerifySignature(hash[:], b.Signature, pub) {
+	if !sm.VerifySignature([]byte(canonical), b.Signature, pub) {
 		return newBundleError(ErrSignatureInvalid, "trust bundle signature does not verify")
 	}
 	return nil
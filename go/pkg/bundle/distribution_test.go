@@ -5,7 +5,9 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/revocation"
@@ -117,6 +119,32 @@ func TestExpiredBundleRejected(t *testing.T) {
 	}
 }
 
+func TestBundleExpiryWithClock(t *testing.T) {
+	priv := genKeyPair(t)
+	b := makeDistBundle("example.com", "2026-05-15T00:00:00Z")
+	signed, err := SignTrustBundle(b, priv, "auth", "2026-05-15T00:00:00Z", "2026-06-15T00:00:00Z")
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	fake := clock.NewFake(time.Date(2026, 6, 14, 23, 59, 59, 0, time.UTC))
+	store := NewAuthorityPinStore()
+
+	if err := VerifyTrustBundle(signed, store, WithClock(fake)); err != nil {
+		t.Fatalf("verify before expiry: %v", err)
+	}
+
+	fake.Advance(time.Second)
+	if err := VerifyTrustBundle(signed, store, WithClock(fake)); err != nil {
+		t.Fatalf("verify at expires_at: %v", err)
+	}
+
+	fake.Advance(time.Second)
+	code := bundleErrCode(t, VerifyTrustBundle(signed, store, WithClock(fake)))
+	if code != ErrBundleExpired {
+		t.Errorf("code = %q, want %q", code, ErrBundleExpired)
+	}
+}
+
 func TestExpiredBundleUnparseable(t *testing.T) {
 	priv := genKeyPair(t)
 	b := makeDistBundle("example.com", "2026-05-15T00:00:00Z")
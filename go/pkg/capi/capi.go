@@ -0,0 +1,219 @@
+// Package capi implements the functions exported by libschemapin, the C
+// shared library built from cmd/libschemapin. Each function takes the
+// library's string arguments and returns its string result, so the cgo
+// layer only converts C strings; the library's behavior is tested here.
+//
+// Verification functions never fail: every problem, including malformed
+// arguments, is reported in the returned verification.VerificationResult
+// JSON with one of the structured verification error codes. Nothing is
+// shared between calls, so the functions are safe for concurrent use.
+package capi
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/revocation"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/skill"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+// ErrInvalidArgument is the error code reported when options_json is
+// malformed. Problems with the other arguments use the verification code
+// of the check they fail.
+const ErrInvalidArgument verification.ErrorCode = "invalid_argument"
+
+// Options are the verification options passed as options_json. An empty
+// string or null selects the defaults.
+type Options struct {
+	// ToolID identifies the tool for key pinning. It defaults to the
+	// domain for schemas and to the signed skill name for skills.
+	ToolID string `json:"tool_id,omitempty"`
+	// Canonicalization is the schema signature's canonicalization
+	// algorithm; empty selects schemapin-v1. Skill signatures declare
+	// their own.
+	Canonicalization string `json:"canonicalization,omitempty"`
+	// Policy is a verification policy document (see
+	// verification.ParsePolicyJSON).
+	Policy json.RawMessage `json:"policy,omitempty"`
+	// Revocation is a standalone revocation document for the domain.
+	Revocation *revocation.RevocationDocument `json:"revocation,omitempty"`
+	// PinnedKeys maps tool_id@domain to the pinned key fingerprint. A key
+	// differing from its pin fails with key_pin_mismatch; pins are not
+	// recorded between calls.
+	PinnedKeys map[string]string `json:"pinned_keys,omitempty"`
+	// AllowNewMutableFiles and StrictPermissions apply to skills, as in
+	// skill.VerifyOptions.
+	AllowNewMutableFiles bool `json:"allow_new_mutable_files,omitempty"`
+	StrictPermissions    bool `json:"strict_permissions,omitempty"`
+}
+
+// parsed holds the decoded arguments shared by both verification calls.
+type parsed struct {
+	opts     Options
+	policy   *verification.Policy
+	disc     *discovery.WellKnownResponse
+	pinStore *verification.KeyPinStore
+}
+
+// parseArgs decodes wellKnownJSON and optionsJSON, returning a failed
+// result for domain if either is malformed.
+func parseArgs(domain, wellKnownJSON, optionsJSON string) (*parsed, *verification.VerificationResult) {
+	args := &parsed{}
+	if strings.TrimSpace(optionsJSON) != "" {
+		if err := decodeStrict(optionsJSON, &args.opts); err != nil {
+			return nil, failure(domain, ErrInvalidArgument, fmt.Sprintf("Invalid options: %v", err))
+		}
+	}
+	if len(args.opts.Policy) > 0 && string(args.opts.Policy) != "null" {
+		policy, err := verification.ParsePolicyJSON(args.opts.Policy)
+		if err != nil {
+			return nil, failure(domain, ErrInvalidArgument, fmt.Sprintf("Invalid options: %v", err))
+		}
+		args.policy = policy
+	}
+
+	disc, err := parseWellKnown(wellKnownJSON)
+	if err != nil {
+		return nil, failure(domain, verification.ErrDiscoveryInvalid, fmt.Sprintf("Invalid discovery document: %v", err))
+	}
+	args.disc = disc
+
+	args.pinStore = verification.NewKeyPinStore()
+	if len(args.opts.PinnedKeys) > 0 {
+		pins, err := json.Marshal(args.opts.PinnedKeys)
+		if err != nil {
+			return nil, failure(domain, ErrInvalidArgument, fmt.Sprintf("Invalid options: %v", err))
+		}
+		if args.pinStore, err = verification.FromJSON(string(pins)); err != nil {
+			return nil, failure(domain, ErrInvalidArgument, fmt.Sprintf("Invalid options: %v", err))
+		}
+	}
+	return args, nil
+}
+
+// parseWellKnown parses and validates a .well-known/schemapin.json
+// document the way discovery.LoadWellKnownFile does.
+func parseWellKnown(data string) (*discovery.WellKnownResponse, error) {
+	var wellKnown discovery.WellKnownResponse
+	if err := json.Unmarshal([]byte(data), &wellKnown); err != nil {
+		return nil, fmt.Errorf("failed to parse: %w", err)
+	}
+	if err := discovery.ValidateToolKeys(wellKnown.Tools); err != nil {
+		return nil, err
+	}
+	if !discovery.ValidateWellKnownResponse(&wellKnown) {
+		return nil, fmt.Errorf("schema_version and public_key_pem are required")
+	}
+	return &wellKnown, nil
+}
+
+// decodeStrict decodes a single JSON value into v, rejecting unknown
+// fields and trailing data.
+func decodeStrict(data string, v interface{}) error {
+	decoder := json.NewDecoder(strings.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return err
+	}
+	if err := decoder.Decode(&struct{}{}); err != io.EOF {
+		return fmt.Errorf("trailing data after the JSON value")
+	}
+	return nil
+}
+
+// parseSchema decodes a JSON object holding a schema.
+func parseSchema(schemaJSON string) (map[string]interface{}, error) {
+	var schema map[string]interface{}
+	if err := decodeStrict(schemaJSON, &schema); err != nil {
+		return nil, err
+	}
+	if schema == nil {
+		return nil, fmt.Errorf("schema must be a JSON object")
+	}
+	return schema, nil
+}
+
+func failure(domain string, code verification.ErrorCode, message string) *verification.VerificationResult {
+	return &verification.VerificationResult{Valid: false, Domain: domain, ErrorCode: code, ErrorMessage: message}
+}
+
+// encode renders result as the JSON returned to C callers.
+func encode(result *verification.VerificationResult) string {
+	data, err := json.Marshal(result)
+	if err != nil {
+		data, _ = json.Marshal(failure(result.Domain, verification.ErrSignatureInvalid, fmt.Sprintf("Failed to encode result: %v", err)))
+	}
+	return string(data)
+}
+
+// VerifySchema implements schemapin_verify_schema: it verifies the base64
+// signature over the JSON schema schemaJSON, signed by domain whose
+// .well-known/schemapin.json is wellKnownJSON, and returns the
+// verification.VerificationResult as JSON.
+func VerifySchema(schemaJSON, signature, domain, wellKnownJSON, optionsJSON string) string {
+	args, failed := parseArgs(domain, wellKnownJSON, optionsJSON)
+	if failed != nil {
+		return encode(failed)
+	}
+	schema, err := parseSchema(schemaJSON)
+	if err != nil {
+		return encode(failure(domain, verification.ErrSchemaCanonicalizationFailed, fmt.Sprintf("Failed to parse schema: %v", err)))
+	}
+	toolID := args.opts.ToolID
+	if toolID == "" {
+		toolID = domain
+	}
+	return encode(verification.VerifySchemaOfflineWithPolicy(
+		schema, strings.TrimSpace(signature), domain, toolID, args.disc, args.opts.Revocation, args.pinStore, args.opts.Canonicalization, args.policy,
+	))
+}
+
+// VerifySkillDir implements schemapin_verify_skill_dir: it verifies the
+// signed skill directory at path against wellKnownJSON, the
+// .well-known/schemapin.json of domain, and returns the
+// verification.VerificationResult as JSON. A signature made for another
+// domain fails with domain_mismatch; an empty domain accepts the
+// signature's own.
+func VerifySkillDir(path, domain, wellKnownJSON, optionsJSON string) string {
+	args, failed := parseArgs(domain, wellKnownJSON, optionsJSON)
+	if failed != nil {
+		return encode(failed)
+	}
+	sig, err := skill.LoadSignature(path)
+	if err != nil {
+		return encode(failure(domain, verification.ErrSignatureInvalid, fmt.Sprintf("Failed to load skill signature: %v", err)))
+	}
+	if domain != "" && sig.Domain != domain {
+		return encode(failure(domain, verification.ErrDomainMismatch, fmt.Sprintf("Skill is signed for %s, not %s", sig.Domain, domain)))
+	}
+	return encode(skill.VerifySkillOfflineWithOptions(path, args.disc, sig, args.opts.Revocation, args.pinStore, args.opts.ToolID, skill.VerifyOptions{
+		Policy:               args.policy,
+		AllowNewMutableFiles: args.opts.AllowNewMutableFiles,
+		StrictPermissions:    args.opts.StrictPermissions,
+	}))
+}
+
+// CanonicalHash implements schemapin_canonical_hash: it returns the
+// lowercase hex SHA-256 of the schemapin-v1 canonical form of the JSON
+// schema schemaJSON.
+func CanonicalHash(schemaJSON string) (string, error) {
+	schema, err := parseSchema(schemaJSON)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse schema: %w", err)
+	}
+	alg, err := core.LookupCanonicalization(core.DefaultCanonicalization)
+	if err != nil {
+		return "", err
+	}
+	hash, err := alg.HashSchema(schema)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash), nil
+}
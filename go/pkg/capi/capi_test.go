@@ -0,0 +1,205 @@
+package capi
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/skill"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+const testSchema = `{"name": "get_weather", "parameters": {"type": "object", "properties": {"city": {"type": "string"}}}}`
+
+type fixture struct {
+	privPEM     string
+	wellKnown   string
+	fingerprint string
+	signature   string
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	km := crypto.NewKeyManager()
+	key, err := km.GenerateKeypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	privPEM, err := km.ExportPrivateKeyPEM(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubPEM, err := km.ExportPublicKeyPEM(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprint, err := km.CalculateKeyFingerprintFromPEM(pubPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wellKnown, err := json.Marshal(discovery.WellKnownResponse{SchemaVersion: "1.3", DeveloperName: "Test Dev", PublicKeyPEM: pubPEM})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var schema map[string]interface{}
+	if err := json.Unmarshal([]byte(testSchema), &schema); err != nil {
+		t.Fatal(err)
+	}
+	hash, err := core.NewSchemaPinCore().CanonicalizeAndHash(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := crypto.NewSignatureManager().SignSchemaHash(hash, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &fixture{privPEM: privPEM, wellKnown: string(wellKnown), fingerprint: fingerprint, signature: signature}
+}
+
+func decodeResult(t *testing.T, data string) *verification.VerificationResult {
+	t.Helper()
+	var result verification.VerificationResult
+	if err := json.Unmarshal([]byte(data), &result); err != nil {
+		t.Fatalf("result is not JSON: %v: %s", err, data)
+	}
+	return &result
+}
+
+func TestVerifySchema(t *testing.T) {
+	f := newFixture(t)
+	result := decodeResult(t, VerifySchema(testSchema, f.signature, "example.com", f.wellKnown, ""))
+	if !result.Valid {
+		t.Fatalf("expected valid, got %s: %s", result.ErrorCode, result.ErrorMessage)
+	}
+	if result.Domain != "example.com" || result.DeveloperName != "Test Dev" {
+		t.Errorf("unexpected result %+v", result)
+	}
+	hash, err := CanonicalHash(testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.SchemaHash != "sha256:"+hash {
+		t.Errorf("expected schema hash sha256:%s, got %s", hash, result.SchemaHash)
+	}
+}
+
+func TestVerifySchemaErrors(t *testing.T) {
+	f := newFixture(t)
+	other := newFixture(t)
+	tests := []struct {
+		name                             string
+		schema, signature, wellKnown, op string
+		want                             verification.ErrorCode
+	}{
+		{"tampered schema", strings.Replace(testSchema, "city", "town", 1), f.signature, f.wellKnown, "", verification.ErrSignatureInvalid},
+		{"other key", testSchema, f.signature, other.wellKnown, "", verification.ErrSignatureInvalid},
+		{"malformed schema", `{"name":`, f.signature, f.wellKnown, "", verification.ErrSchemaCanonicalizationFailed},
+		{"schema not an object", `[1, 2]`, f.signature, f.wellKnown, "", verification.ErrSchemaCanonicalizationFailed},
+		{"malformed discovery", testSchema, f.signature, `{`, "", verification.ErrDiscoveryInvalid},
+		{"discovery without key", testSchema, f.signature, `{"schema_version": "1.3"}`, "", verification.ErrDiscoveryInvalid},
+		{"malformed options", testSchema, f.signature, f.wellKnown, `{"tool_id": 1}`, ErrInvalidArgument},
+		{"unknown option", testSchema, f.signature, f.wellKnown, `{"toolid": "x"}`, ErrInvalidArgument},
+		{"invalid policy", testSchema, f.signature, f.wellKnown, `{"policy": {"nope": true}}`, ErrInvalidArgument},
+		{"unsupported canonicalization", testSchema, f.signature, f.wellKnown, `{"canonicalization": "jcs-v9"}`, verification.ErrCanonicalizationUnsupported},
+		{"pin mismatch", testSchema, f.signature, f.wellKnown, `{"pinned_keys": {"example.com@example.com": "` + other.fingerprint + `"}}`, verification.ErrKeyPinMismatch},
+		{"revoked key", testSchema, f.signature, f.wellKnown, `{"revocation": {"schemapin_version": "1.2", "domain": "example.com", "updated_at": "2026-01-01T00:00:00Z", "revoked_keys": [{"fingerprint": "` + f.fingerprint + `", "revoked_at": "2026-01-01T00:00:00Z", "reason": "key_compromise"}]}}`, verification.ErrKeyRevoked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := decodeResult(t, VerifySchema(tt.schema, tt.signature, "example.com", tt.wellKnown, tt.op))
+			if result.Valid || result.ErrorCode != tt.want {
+				t.Errorf("expected %s, got valid=%v %s: %s", tt.want, result.Valid, result.ErrorCode, result.ErrorMessage)
+			}
+		})
+	}
+}
+
+func TestVerifySchemaPinnedKey(t *testing.T) {
+	f := newFixture(t)
+	options := `{"tool_id": "weather", "pinned_keys": {"weather@example.com": "` + f.fingerprint + `"}}`
+	result := decodeResult(t, VerifySchema(testSchema, f.signature, "example.com", f.wellKnown, options))
+	if !result.Valid {
+		t.Fatalf("expected valid, got %s: %s", result.ErrorCode, result.ErrorMessage)
+	}
+}
+
+func TestVerifySkillDir(t *testing.T) {
+	f := newFixture(t)
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "SKILL.md"), []byte("---\nname: demo\n---\n# Demo"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := skill.SignSkill(dir, f.privPEM, "example.com", "", "demo"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, domain := range []string{"example.com", ""} {
+		result := decodeResult(t, VerifySkillDir(dir, domain, f.wellKnown, ""))
+		if !result.Valid {
+			t.Fatalf("expected valid for domain %q, got %s: %s", domain, result.ErrorCode, result.ErrorMessage)
+		}
+	}
+
+	result := decodeResult(t, VerifySkillDir(dir, "other.example", f.wellKnown, ""))
+	if result.Valid || result.ErrorCode != verification.ErrDomainMismatch {
+		t.Errorf("expected domain_mismatch, got %s: %s", result.ErrorCode, result.ErrorMessage)
+	}
+
+	result = decodeResult(t, VerifySkillDir(t.TempDir(), "example.com", f.wellKnown, ""))
+	if result.Valid || result.ErrorCode != verification.ErrSignatureInvalid {
+		t.Errorf("expected an unsigned directory to fail, got %s: %s", result.ErrorCode, result.ErrorMessage)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "SKILL.md"), []byte("# Tampered"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	result = decodeResult(t, VerifySkillDir(dir, "example.com", f.wellKnown, ""))
+	if result.Valid || result.ErrorCode != verification.ErrSignatureInvalid {
+		t.Errorf("expected a tampered skill to fail, got %s: %s", result.ErrorCode, result.ErrorMessage)
+	}
+}
+
+func TestCanonicalHash(t *testing.T) {
+	// From the conformance corpus (canonicalize/key-order)
+	got, err := CanonicalHash(`{"b": 1, "a": {"d": [3, 1, 2], "c": true}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "dc4ed0113e4ceb986bc90fd2919f1544dfca831c335f6f8c8b2dea9298ea203d"; got != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+	for _, input := range []string{"", "{", "null", `"schema"`, `{} {}`} {
+		if _, err := CanonicalHash(input); err == nil {
+			t.Errorf("expected %q to be rejected", input)
+		}
+	}
+}
+
+// The library may be called from several C threads at once.
+func TestConcurrentCalls(t *testing.T) {
+	f := newFixture(t)
+	var wg sync.WaitGroup
+	errs := make(chan string, 16)
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var result verification.VerificationResult
+			if err := json.Unmarshal([]byte(VerifySchema(testSchema, f.signature, "example.com", f.wellKnown, "")), &result); err != nil || !result.Valid {
+				errs <- string(result.ErrorCode)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for code := range errs {
+		t.Errorf("expected concurrent verifications to pass, got %s", code)
+	}
+}
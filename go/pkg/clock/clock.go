@@ -0,0 +1,75 @@
+// Package clock provides the time source and timestamp format used across
+// SchemaPin, so that expiry logic can be tested without sleeping and
+// signatures can be produced reproducibly.
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock reports the current time.
+type Clock interface {
+	Now() time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+// Real is the system clock. It is the default wherever a Clock can be set.
+var Real Clock = realClock{}
+
+// OrReal returns c, or Real if c is nil.
+func OrReal(c Clock) Clock {
+	if c == nil {
+		return Real
+	}
+	return c
+}
+
+// Timestamp normalizes t the way SchemaPin records times: UTC with whole
+// seconds. Fractional seconds are truncated so Go and Python produce
+// identical strings for the same instant.
+func Timestamp(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Second)
+}
+
+// Format returns t as an RFC 3339 timestamp after Timestamp normalization,
+// e.g. "2026-01-02T15:04:05Z".
+func Format(t time.Time) string {
+	return Timestamp(t).Format(time.RFC3339)
+}
+
+// Fake is a Clock that only moves when told to. It is safe for concurrent
+// use.
+type Fake struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFake returns a Fake clock set to now.
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+// Now returns the fake clock's current time.
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Advance moves the fake clock forward by d.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+}
+
+// Set moves the fake clock to now.
+func (f *Fake) Set(now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = now
+}
@@ -0,0 +1,43 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormat(t *testing.T) {
+	local := time.FixedZone("UTC+2", 2*60*60)
+	ts := time.Date(2026, 3, 4, 7, 8, 9, 987654321, local)
+	if got, want := Format(ts), "2026-03-04T05:08:09Z"; got != want {
+		t.Errorf("Format() = %q, want %q", got, want)
+	}
+	if got := Timestamp(ts); got.Nanosecond() != 0 || got.Location() != time.UTC {
+		t.Errorf("Timestamp() = %v, want whole seconds in UTC", got)
+	}
+}
+
+func TestFake(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := NewFake(start)
+	if !fake.Now().Equal(start) {
+		t.Fatalf("Now() = %v, want %v", fake.Now(), start)
+	}
+	fake.Advance(90 * time.Second)
+	if got := fake.Now().Sub(start); got != 90*time.Second {
+		t.Errorf("Advance moved clock by %v, want 90s", got)
+	}
+	fake.Set(start)
+	if !fake.Now().Equal(start) {
+		t.Errorf("Set() did not reset the clock")
+	}
+}
+
+func TestOrReal(t *testing.T) {
+	if OrReal(nil) != Real {
+		t.Error("OrReal(nil) should return Real")
+	}
+	fake := NewFake(time.Time{})
+	if OrReal(fake) != Clock(fake) {
+		t.Error("OrReal should return a non-nil clock unchanged")
+	}
+}
@@ -0,0 +1,340 @@
+// Package conformance runs declarative, language-neutral SchemaPin test
+// cases against the Go verifier, so that other implementations can check
+// themselves against the same corpus.
+//
+// A case is one JSON file. Its type selects the code path:
+//
+//   - canonicalize: canonicalize input.schema and compare the canonical
+//     bytes and their sha256 hash.
+//   - verify_schema: verify input.schema and input.signature with
+//     verification.VerifySchemaOffline against input.well_known,
+//     input.revocation and input.pins.
+//   - verify_skill: write input.skill to a directory and verify it with
+//     skill.VerifySkillOffline.
+//
+// Every case states the expected validity and, for failures, the error
+// code from the verification package. See testdata/corpus/README.md for
+// the full format.
+package conformance
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/revocation"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/skill"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+// Case types.
+const (
+	TypeCanonicalize = "canonicalize"
+	TypeVerifySchema = "verify_schema"
+	TypeVerifySkill  = "verify_skill"
+)
+
+// Case is one conformance test case.
+type Case struct {
+	ID          string   `json:"id"`
+	Description string   `json:"description"`
+	Type        string   `json:"type"`
+	Input       Input    `json:"input"`
+	Expected    Expected `json:"expected"`
+}
+
+// Input holds the inputs of a case; which fields are used depends on its
+// type.
+type Input struct {
+	// Schema is kept as written, so number forms, escapes and key order
+	// reach the implementation's JSON parser unchanged.
+	Schema json.RawMessage `json:"schema,omitempty"`
+	// Canonicalization is the algorithm identifier declared by the
+	// signature, if any.
+	Canonicalization string                         `json:"canonicalization,omitempty"`
+	Signature        string                         `json:"signature,omitempty"`
+	Domain           string                         `json:"domain,omitempty"`
+	ToolID           string                         `json:"tool_id,omitempty"`
+	WellKnown        *discovery.WellKnownResponse   `json:"well_known,omitempty"`
+	Revocation       *revocation.RevocationDocument `json:"revocation,omitempty"`
+	// Pins are recorded in the pin store before verifying.
+	Pins  []Pin         `json:"pins,omitempty"`
+	Skill *SkillFixture `json:"skill,omitempty"`
+}
+
+// Pin is a key fingerprint pinned for a tool on a domain.
+type Pin struct {
+	ToolID      string `json:"tool_id"`
+	Domain      string `json:"domain"`
+	Fingerprint string `json:"fingerprint"`
+}
+
+// SkillFixture is a skill directory: its files by slash-separated path and
+// the .schemapin.sig document written next to them.
+type SkillFixture struct {
+	Files map[string]string `json:"files,omitempty"`
+	// BinaryFiles are base64-encoded, for content that is not UTF-8.
+	BinaryFiles map[string]string `json:"binary_files,omitempty"`
+	Signature   json.RawMessage   `json:"signature"`
+}
+
+// Expected is the outcome a case expects, and the outcome observed.
+type Expected struct {
+	Valid     bool   `json:"valid"`
+	ErrorCode string `json:"error_code,omitempty"`
+	// Canonical and Hash are the canonical form of a canonicalize case
+	// and its sha256:<hex> hash.
+	Canonical string `json:"canonical,omitempty"`
+	Hash      string `json:"hash,omitempty"`
+}
+
+// Result is the outcome of running one case.
+type Result struct {
+	ID       string   `json:"id"`
+	Type     string   `json:"type"`
+	Passed   bool     `json:"passed"`
+	Expected Expected `json:"expected"`
+	Actual   Expected `json:"actual"`
+	// Message describes why the case failed or could not run.
+	Message string `json:"message,omitempty"`
+}
+
+// Report is the machine-readable outcome of a corpus run.
+type Report struct {
+	Implementation string   `json:"implementation"`
+	Total          int      `json:"total"`
+	Passed         int      `json:"passed"`
+	Failed         int      `json:"failed"`
+	Results        []Result `json:"results"`
+}
+
+// LoadCases reads every *.json file under dir, in path order. Unknown
+// fields, unknown types and duplicate IDs are errors.
+func LoadCases(dir string) ([]Case, error) {
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(path, ".json") {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read conformance cases: %w", err)
+	}
+	sort.Strings(paths)
+
+	seen := make(map[string]string)
+	cases := make([]Case, 0, len(paths))
+	for _, path := range paths {
+		c, err := loadCase(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if other, ok := seen[c.ID]; ok {
+			return nil, fmt.Errorf("%s: case id %q is also used by %s", path, c.ID, other)
+		}
+		seen[c.ID] = path
+		cases = append(cases, c)
+	}
+	return cases, nil
+}
+
+func loadCase(path string) (Case, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- corpus path supplied by the caller
+	if err != nil {
+		return Case{}, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var c Case
+	if err := decoder.Decode(&c); err != nil {
+		return Case{}, fmt.Errorf("invalid case: %w", err)
+	}
+	if c.ID == "" {
+		return Case{}, fmt.Errorf("case has no id")
+	}
+	switch c.Type {
+	case TypeCanonicalize, TypeVerifySchema:
+	case TypeVerifySkill:
+		if c.Input.Skill == nil {
+			return Case{}, fmt.Errorf("verify_skill case has no input.skill")
+		}
+	default:
+		return Case{}, fmt.Errorf("unknown case type %q", c.Type)
+	}
+	return c, nil
+}
+
+// Run runs cases and reports the outcome of each, as implementation.
+func Run(implementation string, cases []Case) *Report {
+	report := &Report{Implementation: implementation, Results: make([]Result, 0, len(cases))}
+	for _, c := range cases {
+		result := RunCase(c)
+		report.Results = append(report.Results, result)
+		report.Total++
+		if result.Passed {
+			report.Passed++
+		} else {
+			report.Failed++
+		}
+	}
+	return report
+}
+
+// RunCase runs one case against the Go verifier.
+func RunCase(c Case) Result {
+	result := Result{ID: c.ID, Type: c.Type, Expected: c.Expected}
+	var err error
+	switch c.Type {
+	case TypeCanonicalize:
+		result.Actual, err = runCanonicalize(c.Input)
+	case TypeVerifySchema:
+		result.Actual, err = runVerifySchema(c.Input)
+	case TypeVerifySkill:
+		result.Actual, err = runVerifySkill(c.Input)
+	default:
+		err = fmt.Errorf("unknown case type %q", c.Type)
+	}
+	if err != nil {
+		result.Message = err.Error()
+		return result
+	}
+
+	result.Passed = result.Actual == c.Expected
+	if !result.Passed {
+		result.Message = mismatch(c.Expected, result.Actual)
+	}
+	return result
+}
+
+// mismatch describes how actual differs from expected.
+func mismatch(expected, actual Expected) string {
+	var diffs []string
+	if expected.Valid != actual.Valid {
+		diffs = append(diffs, fmt.Sprintf("valid is %t, want %t", actual.Valid, expected.Valid))
+	}
+	if expected.ErrorCode != actual.ErrorCode {
+		diffs = append(diffs, fmt.Sprintf("error_code is %q, want %q", actual.ErrorCode, expected.ErrorCode))
+	}
+	if expected.Canonical != actual.Canonical {
+		diffs = append(diffs, fmt.Sprintf("canonical is %q, want %q", actual.Canonical, expected.Canonical))
+	}
+	if expected.Hash != actual.Hash {
+		diffs = append(diffs, fmt.Sprintf("hash is %s, want %s", actual.Hash, expected.Hash))
+	}
+	return strings.Join(diffs, "; ")
+}
+
+func runCanonicalize(input Input) (Expected, error) {
+	schema, err := decodeSchema(input.Schema)
+	if err != nil {
+		return Expected{}, err
+	}
+	alg, err := core.LookupCanonicalization(input.Canonicalization)
+	if err != nil {
+		return Expected{ErrorCode: string(verification.ErrCanonicalizationUnsupported)}, nil
+	}
+	canonical, err := core.NewSchemaPinCore().CanonicalizeSchema(schema)
+	if err != nil {
+		return Expected{ErrorCode: string(verification.ErrSchemaCanonicalizationFailed)}, nil
+	}
+	hash, err := alg.HashSchema(schema)
+	if err != nil {
+		return Expected{ErrorCode: string(verification.ErrSchemaCanonicalizationFailed)}, nil
+	}
+	return Expected{Valid: true, Canonical: canonical, Hash: core.FormatSchemaHash(hash)}, nil
+}
+
+func runVerifySchema(input Input) (Expected, error) {
+	schema, err := decodeSchema(input.Schema)
+	if err != nil {
+		return Expected{}, err
+	}
+	result := verification.VerifySchemaOfflineWithCanonicalization(
+		schema, input.Signature, input.Domain, input.ToolID,
+		input.WellKnown, input.Revocation, pinStore(input.Pins), input.Canonicalization,
+	)
+	return outcome(result), nil
+}
+
+// decodeSchema parses a case's schema the way verifiers parse schema
+// files, with numbers as float64.
+func decodeSchema(raw json.RawMessage) (map[string]interface{}, error) {
+	var schema map[string]interface{}
+	if err := json.Unmarshal(raw, &schema); err != nil || schema == nil {
+		return nil, fmt.Errorf("input.schema must be a JSON object")
+	}
+	return schema, nil
+}
+
+func runVerifySkill(input Input) (Expected, error) {
+	dir, err := os.MkdirTemp("", "schemapin-conformance-")
+	if err != nil {
+		return Expected{}, err
+	}
+	defer os.RemoveAll(dir)
+	if err := writeSkill(dir, input.Skill); err != nil {
+		return Expected{}, err
+	}
+
+	result := skill.VerifySkillOffline(dir, input.WellKnown, nil, input.Revocation, pinStore(input.Pins), input.ToolID)
+	return outcome(result), nil
+}
+
+// writeSkill writes fixture to dir. Paths must stay inside dir.
+func writeSkill(dir string, fixture *SkillFixture) error {
+	files := make(map[string][]byte, len(fixture.Files)+len(fixture.BinaryFiles)+1)
+	for name, content := range fixture.Files {
+		files[name] = []byte(content)
+	}
+	for name, encoded := range fixture.BinaryFiles {
+		content, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return fmt.Errorf("binary file %s is not base64: %w", name, err)
+		}
+		files[name] = content
+	}
+	if len(fixture.Signature) > 0 {
+		files[skill.SignatureFilename] = fixture.Signature
+	}
+
+	for name, content := range files {
+		if !filepath.IsLocal(filepath.FromSlash(name)) {
+			return fmt.Errorf("skill file path %q leaves the skill directory", name)
+		}
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, content, 0600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func pinStore(pins []Pin) *verification.KeyPinStore {
+	store := verification.NewKeyPinStore()
+	for _, pin := range pins {
+		store.CheckAndPin(pin.ToolID, pin.Domain, pin.Fingerprint)
+	}
+	return store
+}
+
+func outcome(result *verification.VerificationResult) Expected {
+	if result.Valid {
+		return Expected{Valid: true}
+	}
+	return Expected{ErrorCode: string(result.ErrorCode)}
+}
@@ -0,0 +1,93 @@
+package conformance
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestCorpus(t *testing.T) {
+	cases, err := LoadCases(corpusDir)
+	if err != nil {
+		t.Fatalf("LoadCases failed: %v", err)
+	}
+	counts := make(map[string]int)
+	for _, c := range cases {
+		counts[c.Type]++
+	}
+	for _, caseType := range []string{TypeCanonicalize, TypeVerifySchema, TypeVerifySkill} {
+		if counts[caseType] == 0 {
+			t.Errorf("Expected %s cases in the corpus", caseType)
+		}
+	}
+
+	report := Run("schemapin-go", cases)
+	for _, result := range report.Results {
+		if !result.Passed {
+			t.Errorf("%s: %s", result.ID, result.Message)
+		}
+	}
+	if report.Total != len(cases) || report.Passed+report.Failed != report.Total {
+		t.Errorf("Inconsistent report totals: %+v", report)
+	}
+}
+
+func TestRunCaseMismatch(t *testing.T) {
+	c := Case{
+		ID:       "canonicalize/wrong",
+		Type:     TypeCanonicalize,
+		Input:    Input{Schema: json.RawMessage(`{"b": 1, "a": 2}`)},
+		Expected: Expected{Valid: true, Canonical: `{"b":1,"a":2}`},
+	}
+	result := RunCase(c)
+	if result.Passed {
+		t.Fatal("Expected a wrong canonical form to fail")
+	}
+	if result.Actual.Canonical != `{"a":2,"b":1}` || !strings.Contains(result.Message, "canonical is") {
+		t.Errorf("Expected the mismatch to be described, got %+v", result)
+	}
+
+	c = Case{ID: "verify_schema/bad-input", Type: TypeVerifySchema, Input: Input{Schema: json.RawMessage(`[1]`)}}
+	if result := RunCase(c); result.Passed || result.Message == "" {
+		t.Errorf("Expected a non-object schema to fail the case, got %+v", result)
+	}
+}
+
+func TestWriteSkillRejectsUnsafePaths(t *testing.T) {
+	for _, name := range []string{"../escape.md", "/etc/passwd", "a/../../b"} {
+		fixture := &SkillFixture{Files: map[string]string{name: "x"}}
+		if err := writeSkill(t.TempDir(), fixture); err == nil {
+			t.Errorf("Expected %q to be rejected", name)
+		}
+	}
+}
+
+func TestLoadCasesRejectsInvalidCases(t *testing.T) {
+	for name, content := range map[string]string{
+		"unknown-field": `{"id": "x", "type": "canonicalize", "input": {}, "expected": {"valid": true}, "extra": 1}`,
+		"unknown-type":  `{"id": "x", "type": "sign", "input": {}, "expected": {"valid": true}}`,
+		"missing-id":    `{"type": "canonicalize", "input": {}, "expected": {"valid": true}}`,
+		"missing-skill": `{"id": "x", "type": "verify_skill", "input": {}, "expected": {"valid": true}}`,
+	} {
+		dir := t.TempDir()
+		writeFile(t, dir, "case.json", content)
+		if _, err := LoadCases(dir); err == nil {
+			t.Errorf("%s: expected LoadCases to fail", name)
+		}
+	}
+
+	dir := t.TempDir()
+	valid := `{"id": "x", "type": "canonicalize", "input": {"schema": {}}, "expected": {"valid": true}}`
+	writeFile(t, dir, "a.json", valid)
+	writeFile(t, dir, "b.json", valid)
+	if _, err := LoadCases(dir); err == nil || !strings.Contains(err.Error(), "also used by") {
+		t.Errorf("Expected duplicate IDs to be rejected, got %v", err)
+	}
+}
+
+func writeFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := writeSkill(dir, &SkillFixture{Files: map[string]string{name: content}}); err != nil {
+		t.Fatal(err)
+	}
+}
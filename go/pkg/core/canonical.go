@@ -0,0 +1,257 @@
+package core
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"unicode/utf8"
+)
+
+// canonicalEncoder writes the canonical form of generic JSON values
+// (map[string]interface{}, []interface{}, string, float64, bool, nil) without
+// going through reflection. Output is byte-identical to json.Marshal; any
+// other value type is delegated to json.Marshal directly.
+type canonicalEncoder struct {
+	buf  []byte
+	keys []string
+	// w, when set, receives buf whenever it grows past flushThreshold so
+	// that large schemas stream through a bounded buffer.
+	w io.Writer
+}
+
+var encoderPool = sync.Pool{
+	New: func() interface{} {
+		return &canonicalEncoder{buf: make([]byte, 0, 1024)}
+	},
+}
+
+const (
+	// maxPooledBuffer caps the buffer size returned to the pool so that one
+	// very large schema does not pin memory for the lifetime of the process.
+	maxPooledBuffer = 1 << 20
+	// flushThreshold is the buffered size at which output is handed to the
+	// destination writer.
+	flushThreshold = 32 << 10
+)
+
+func getEncoder() *canonicalEncoder {
+	e := encoderPool.Get().(*canonicalEncoder)
+	e.buf = e.buf[:0]
+	e.keys = e.keys[:0]
+	e.w = nil
+	return e
+}
+
+func putEncoder(e *canonicalEncoder) {
+	if cap(e.buf) > maxPooledBuffer {
+		return
+	}
+	e.w = nil
+	encoderPool.Put(e)
+}
+
+// flush writes buffered output to w once it exceeds flushThreshold.
+func (e *canonicalEncoder) flush() error {
+	if e.w == nil || len(e.buf) < flushThreshold {
+		return nil
+	}
+	if _, err := e.w.Write(e.buf); err != nil {
+		return err
+	}
+	e.buf = e.buf[:0]
+	return nil
+}
+
+// The escape tables below are built from json.Marshal itself so that the
+// output stays identical to the standard library across Go versions.
+var (
+	// asciiEscapes holds the escape sequence for every ASCII byte that
+	// encoding/json escapes (control characters, quote, backslash and the
+	// HTML-sensitive <, > and &).
+	asciiEscapes = func() (table [utf8.RuneSelf]string) {
+		for b := 0; b < utf8.RuneSelf; b++ {
+			if inner := marshalStringInner(string(rune(b))); inner != string(rune(b)) {
+				table[b] = inner
+			}
+		}
+		return table
+	}()
+
+	invalidUTF8Escape        = marshalStringInner("\xff")
+	lineSeparatorEscape      = marshalStringInner("\u2028")
+	paragraphSeparatorEscape = marshalStringInner("\u2029")
+)
+
+func marshalStringInner(s string) string {
+	out, _ := json.Marshal(s)
+	return string(out[1 : len(out)-1])
+}
+
+func (e *canonicalEncoder) encode(v interface{}) error {
+	switch value := v.(type) {
+	case nil:
+		e.buf = append(e.buf, "null"...)
+	case map[string]interface{}:
+		return e.encodeObject(value)
+	case []interface{}:
+		return e.encodeArray(value)
+	case string:
+		e.encodeString(value)
+	case bool:
+		e.buf = strconv.AppendBool(e.buf, value)
+	case float64:
+		return e.encodeFloat(value)
+	case int:
+		e.buf = strconv.AppendInt(e.buf, int64(value), 10)
+	case int64:
+		e.buf = strconv.AppendInt(e.buf, value, 10)
+	default:
+		out, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		e.buf = append(e.buf, out...)
+	}
+	return nil
+}
+
+func (e *canonicalEncoder) encodeObject(m map[string]interface{}) error {
+	if m == nil {
+		e.buf = append(e.buf, "null"...)
+		return nil
+	}
+
+	// Keys for nested objects are stacked on the shared slice and sorted in
+	// place, so only the slice's high-water mark is ever allocated.
+	start := len(e.keys)
+	for key := range m {
+		e.keys = append(e.keys, key)
+	}
+	sort.Strings(e.keys[start:])
+	end := len(e.keys)
+
+	e.buf = append(e.buf, '{')
+	for i := start; i < end; i++ {
+		if i > start {
+			e.buf = append(e.buf, ',')
+		}
+		key := e.keys[i]
+		e.encodeString(key)
+		e.buf = append(e.buf, ':')
+		if err := e.encode(m[key]); err != nil {
+			return err
+		}
+		if err := e.flush(); err != nil {
+			return err
+		}
+	}
+	e.buf = append(e.buf, '}')
+	e.keys = e.keys[:start]
+	return nil
+}
+
+func (e *canonicalEncoder) encodeArray(a []interface{}) error {
+	if a == nil {
+		e.buf = append(e.buf, "null"...)
+		return nil
+	}
+
+	e.buf = append(e.buf, '[')
+	for i, item := range a {
+		if i > 0 {
+			e.buf = append(e.buf, ',')
+		}
+		if err := e.encode(item); err != nil {
+			return err
+		}
+		if err := e.flush(); err != nil {
+			return err
+		}
+	}
+	e.buf = append(e.buf, ']')
+	return nil
+}
+
+// encodeFloat mirrors encoding/json's float64 formatting.
+func (e *canonicalEncoder) encodeFloat(f float64) error {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return &json.UnsupportedValueError{Value: reflect.ValueOf(f), Str: strconv.FormatFloat(f, 'g', -1, 64)}
+	}
+
+	format := byte('f')
+	if abs := math.Abs(f); abs != 0 && (abs < 1e-6 || abs >= 1e21) {
+		format = 'e'
+	}
+	e.buf = strconv.AppendFloat(e.buf, f, format, -1, 64)
+	if format == 'e' {
+		// Clean up e-09 to e-9
+		n := len(e.buf)
+		if n >= 4 && e.buf[n-4] == 'e' && e.buf[n-3] == '-' && e.buf[n-2] == '0' {
+			e.buf[n-2] = e.buf[n-1]
+			e.buf = e.buf[:n-1]
+		}
+	}
+	return nil
+}
+
+// encodeString mirrors encoding/json's string escaping, including HTML
+// escaping, U+2028/U+2029 escaping and replacement of invalid UTF-8.
+func (e *canonicalEncoder) encodeString(s string) {
+	e.buf = append(e.buf, '"')
+	start := 0
+	for i := 0; i < len(s); {
+		if b := s[i]; b < utf8.RuneSelf {
+			if asciiEscapes[b] == "" {
+				i++
+				continue
+			}
+			e.buf = append(e.buf, s[start:i]...)
+			e.buf = append(e.buf, asciiEscapes[b]...)
+			i++
+			start = i
+			continue
+		}
+		c, size := utf8.DecodeRuneInString(s[i:])
+		if c == utf8.RuneError && size == 1 {
+			e.buf = append(e.buf, s[start:i]...)
+			e.buf = append(e.buf, invalidUTF8Escape...)
+			i += size
+			start = i
+			continue
+		}
+		if c == '\u2028' || c == '\u2029' {
+			e.buf = append(e.buf, s[start:i]...)
+			if c == '\u2028' {
+				e.buf = append(e.buf, lineSeparatorEscape...)
+			} else {
+				e.buf = append(e.buf, paragraphSeparatorEscape...)
+			}
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	e.buf = append(e.buf, s[start:]...)
+	e.buf = append(e.buf, '"')
+}
+
+// CanonicalizeToWriter writes the canonical form of schema to w. The output
+// is identical to CanonicalizeSchema but avoids the intermediate string, so
+// it can feed a hash.Hash directly. Large schemas are written in chunks; on
+// error, w may have received a partial prefix of the output.
+func (s *SchemaPinCore) CanonicalizeToWriter(schema map[string]interface{}, w io.Writer) error {
+	e := getEncoder()
+	defer putEncoder(e)
+	e.w = w
+
+	if err := e.encodeObject(schema); err != nil {
+		return err
+	}
+	_, err := w.Write(e.buf)
+	return err
+}
@@ -0,0 +1,223 @@
+package core
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"math"
+	"testing"
+)
+
+// legacyCanonicalize is the original json.Marshal based implementation that
+// the pooled encoder must reproduce byte for byte.
+func legacyCanonicalize(schema map[string]interface{}) (string, error) {
+	canonical, err := json.Marshal(schema)
+	if err != nil {
+		return "", err
+	}
+	return string(canonical), nil
+}
+
+type canonicalStruct struct {
+	Name  string `json:"name"`
+	Count int    `json:"count,omitempty"`
+}
+
+func canonicalTestVectors() map[string]map[string]interface{} {
+	return map[string]map[string]interface{}{
+		"empty_object": {},
+		"simple_type":  {"type": "string"},
+		"object_with_properties": {
+			"type": "object",
+			"properties": map[string]interface{}{
+				"name": map[string]interface{}{"type": "string"},
+			},
+		},
+		"complex_nested": {
+			"type": "object",
+			"properties": map[string]interface{}{
+				"user": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"name": map[string]interface{}{"type": "string"},
+						"age":  map[string]interface{}{"type": "integer", "minimum": 0},
+					},
+					"required": []interface{}{"name"},
+				},
+				"tags": map[string]interface{}{
+					"type":  "array",
+					"items": map[string]interface{}{"type": "string"},
+				},
+			},
+			"required": []interface{}{"user"},
+		},
+		"unicode_and_escapes": {
+			"description": "Café ☕ \"quoted\" back\\slash\ttab\nnewline\r\x00\x1f\b\f",
+			"html":        "<script>alert('x') & more</script>",
+			"separators":  "line para end",
+			"invalid":     "bad\xffutf8",
+			"emoji 🚀":     "key escaping <&>",
+		},
+		"numbers": {
+			"zero":     0.0,
+			"negzero":  math.Copysign(0, -1),
+			"int":      42,
+			"int64":    int64(-9007199254740993),
+			"float":    3.14159,
+			"tiny":     1e-7,
+			"huge":     1e21,
+			"big":      123456789012345678.0,
+			"exp":      -2.5e-10,
+			"fraction": 0.000001,
+			"number":   json.Number("12.50"),
+		},
+		"mixed_values": {
+			"null":    nil,
+			"true":    true,
+			"false":   false,
+			"nil_map": map[string]interface{}(nil),
+			"nil_arr": []interface{}(nil),
+			"typed":   []string{"a", "<b>"},
+			"str_map": map[string]string{"z": "1", "a": "2"},
+			"struct":  canonicalStruct{Name: "tool"},
+			"nested":  []interface{}{[]interface{}{}, map[string]interface{}{}, 1.5, "x"},
+		},
+		// Larger than flushThreshold, so the writer receives several chunks
+		"large": benchmarkSchema(100 << 10),
+	}
+}
+
+func TestCanonicalizeMatchesLegacy(t *testing.T) {
+	c := NewSchemaPinCore()
+	for name, schema := range canonicalTestVectors() {
+		t.Run(name, func(t *testing.T) {
+			want, err := legacyCanonicalize(schema)
+			if err != nil {
+				t.Fatalf("legacy canonicalize: %v", err)
+			}
+
+			got, err := c.CanonicalizeSchema(schema)
+			if err != nil {
+				t.Fatalf("CanonicalizeSchema() error = %v", err)
+			}
+			if got != want {
+				t.Errorf("CanonicalizeSchema() mismatch\nGot:  %s\nWant: %s", got, want)
+			}
+
+			var buf bytes.Buffer
+			if err := c.CanonicalizeToWriter(schema, &buf); err != nil {
+				t.Fatalf("CanonicalizeToWriter() error = %v", err)
+			}
+			if buf.String() != want {
+				t.Errorf("CanonicalizeToWriter() mismatch\nGot:  %s\nWant: %s", buf.String(), want)
+			}
+
+			hash, err := c.CanonicalizeAndHash(schema)
+			if err != nil {
+				t.Fatalf("CanonicalizeAndHash() error = %v", err)
+			}
+			wantHash := sha256.Sum256([]byte(want))
+			if !bytes.Equal(hash, wantHash[:]) {
+				t.Errorf("CanonicalizeAndHash() = %x, want %x", hash, wantHash)
+			}
+		})
+	}
+}
+
+func TestCanonicalizeUnsupportedValues(t *testing.T) {
+	c := NewSchemaPinCore()
+	for _, value := range []interface{}{math.NaN(), math.Inf(1), make(chan int)} {
+		schema := map[string]interface{}{"bad": value}
+		if _, err := c.CanonicalizeSchema(schema); err == nil {
+			t.Errorf("CanonicalizeSchema(%T) expected error", value)
+		}
+		if _, err := c.CanonicalizeAndHash(schema); err == nil {
+			t.Errorf("CanonicalizeAndHash(%T) expected error", value)
+		}
+	}
+}
+
+// benchmarkSchema builds a tool schema of roughly the given canonical size.
+func benchmarkSchema(size int) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var required []interface{}
+	total := 0
+	for i := 0; total < size; i++ {
+		name := fmt.Sprintf("field_%06d", i)
+		properties[name] = map[string]interface{}{
+			"type":        "string",
+			"description": "A field with <html> & unicode ✓ content",
+			"maxLength":   float64(64 + i%32),
+			"enum":        []interface{}{"alpha", "beta", "gamma"},
+		}
+		// Every property canonicalizes to the same length
+		total += len(name) + 130
+		if i%4 == 0 {
+			required = append(required, name)
+			total += len(name) + 3
+		}
+	}
+	return map[string]interface{}{
+		"type":        "object",
+		"title":       "Benchmark tool",
+		"description": "Schema used to benchmark canonicalization",
+		"properties":  properties,
+		"required":    required,
+	}
+}
+
+var benchmarkSizes = []struct {
+	name string
+	size int
+}{
+	{"1KB", 1 << 10},
+	{"100KB", 100 << 10},
+	{"5MB", 5 << 20},
+}
+
+func BenchmarkCanonicalizeAndHash(b *testing.B) {
+	c := NewSchemaPinCore()
+	for _, bs := range benchmarkSizes {
+		schema := benchmarkSchema(bs.size)
+		b.Run(bs.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := c.CanonicalizeAndHash(schema); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkCanonicalizeAndHashLegacy(b *testing.B) {
+	for _, bs := range benchmarkSizes {
+		schema := benchmarkSchema(bs.size)
+		b.Run(bs.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				canonical, err := legacyCanonicalize(schema)
+				if err != nil {
+					b.Fatal(err)
+				}
+				_ = sha256.Sum256([]byte(canonical))
+			}
+		})
+	}
+}
+
+func BenchmarkCanonicalizeSchema(b *testing.B) {
+	c := NewSchemaPinCore()
+	for _, bs := range benchmarkSizes {
+		schema := benchmarkSchema(bs.size)
+		b.Run(bs.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := c.CanonicalizeSchema(schema); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// CanonicalizationV1 is the algorithm identifier for the sorted-key,
+// no-whitespace, UTF-8 canonicalization implemented by SchemaPinCore, and
+// for the v1.3 skill directory canonicalization. It is the only identifier
+// the specification (§19) defines for v1.x.
+const CanonicalizationV1 = "schemapin-v1"
+
+// CanonicalizationJCS is the algorithm identifier for the JSON
+// Canonicalization Scheme of RFC 8785 (see CanonicalizeSchemaJCS). It is
+// opt-in, for interoperability with JCS-based tooling. Skill directories
+// hold no JSON, so skills are hashed under it as under CanonicalizationV1.
+const CanonicalizationJCS = "jcs"
+
+// DefaultCanonicalization is the identifier signers write into new
+// signatures.
+const DefaultCanonicalization = CanonicalizationV1
+
+// Canonicalization is a canonicalization algorithm: the rules for turning a
+// signed artifact into the bytes that are hashed and signed. Each signed
+// artifact type has its own rules under the same identifier.
+type Canonicalization struct {
+	ID string
+	// HashSchema canonicalizes and hashes a tool schema. It checks no
+	// ValidationLimits; callers check them first.
+	HashSchema func(schema map[string]interface{}) ([]byte, error)
+	// SkillFileDigest returns the skill manifest entry for one file, given
+	// its slash-separated path relative to the skill root.
+	SkillFileDigest func(relPath string, content io.Reader) (string, error)
+	// SkillRootHash hashes a skill manifest of SkillFileDigest entries.
+	SkillRootHash func(manifest map[string]string) []byte
+}
+
+// canonicalizations is the registry of every algorithm this implementation
+// can sign and verify with. New algorithms are added here.
+var canonicalizations = map[string]*Canonicalization{
+	CanonicalizationV1: {
+		ID:              CanonicalizationV1,
+		HashSchema:      canonicalizeAndHash,
+		SkillFileDigest: skillFileDigestV1,
+		SkillRootHash:   skillRootHashV1,
+	},
+	CanonicalizationJCS: {
+		ID:              CanonicalizationJCS,
+		HashSchema:      hashSchemaJCS,
+		SkillFileDigest: skillFileDigestV1,
+		SkillRootHash:   skillRootHashV1,
+	},
+}
+
+// UnsupportedCanonicalizationError is returned for a canonicalization
+// identifier that is not in the registry.
+type UnsupportedCanonicalizationError struct {
+	ID string
+}
+
+func (e *UnsupportedCanonicalizationError) Error() string {
+	return fmt.Sprintf("unsupported canonicalization algorithm: %s", e.ID)
+}
+
+// LookupCanonicalization returns the algorithm named by id. An empty id is
+// a signature without the field, which uses CanonicalizationV1; unknown
+// ids return an *UnsupportedCanonicalizationError.
+func LookupCanonicalization(id string) (*Canonicalization, error) {
+	if id == "" {
+		id = CanonicalizationV1
+	}
+	alg, ok := canonicalizations[id]
+	if !ok {
+		return nil, &UnsupportedCanonicalizationError{ID: id}
+	}
+	return alg, nil
+}
+
+// CanonicalizeAndHashForSignature hashes schema for a signature that
+// declares the given schemapin_version and canonicalization. A declared
+// canonicalization takes precedence over the version's default one. The
+// schema is checked against the core's validation limits first.
+func (s *SchemaPinCore) CanonicalizeAndHashForSignature(schema map[string]interface{}, version, canonicalization string) ([]byte, error) {
+	rules, err := RulesForVersion(version)
+	if err != nil {
+		return nil, err
+	}
+	if canonicalization == "" {
+		canonicalization = rules.Canonicalization
+	}
+	alg, err := LookupCanonicalization(canonicalization)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.limits.Check(schema); err != nil {
+		return nil, err
+	}
+	return alg.HashSchema(schema)
+}
+
+// skillFileDigestV1 is "sha256:" + hex(SHA-256(relative_path_utf8 +
+// file_bytes)).
+func skillFileDigestV1(relPath string, content io.Reader) (string, error) {
+	h := sha256.New()
+	h.Write([]byte(relPath))
+	if _, err := io.Copy(h, content); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// skillRootHashV1 concatenates the manifest's hex digests in sorted path
+// order and hashes the result.
+func skillRootHashV1(manifest map[string]string) []byte {
+	keys := make([]string, 0, len(manifest))
+	for k := range manifest {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var builder strings.Builder
+	for _, k := range keys {
+		// Take the hex part of "sha256:<hex>"
+		if parts := strings.SplitN(manifest[k], ":", 2); len(parts) == 2 {
+			builder.WriteString(parts[1])
+		}
+	}
+
+	sum := sha256.Sum256([]byte(builder.String()))
+	return sum[:]
+}
@@ -0,0 +1,76 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLookupCanonicalization(t *testing.T) {
+	for _, id := range []string{"", CanonicalizationV1, DefaultCanonicalization} {
+		alg, err := LookupCanonicalization(id)
+		if err != nil {
+			t.Errorf("LookupCanonicalization(%q) error = %v", id, err)
+			continue
+		}
+		if alg.ID != CanonicalizationV1 {
+			t.Errorf("LookupCanonicalization(%q).ID = %q, want %q", id, alg.ID, CanonicalizationV1)
+		}
+	}
+
+	for _, id := range []string{"schemapin-v2", "SCHEMAPIN-V1", "JCS"} {
+		_, err := LookupCanonicalization(id)
+		var unsupported *UnsupportedCanonicalizationError
+		if !errors.As(err, &unsupported) || unsupported.ID != id {
+			t.Errorf("LookupCanonicalization(%q) expected UnsupportedCanonicalizationError, got %v", id, err)
+		}
+	}
+}
+
+func TestCanonicalizeAndHashForSignature(t *testing.T) {
+	c := NewSchemaPinCore()
+	schema := map[string]interface{}{"type": "object", "name": "calculator"}
+
+	want, err := c.CanonicalizeAndHash(schema)
+	if err != nil {
+		t.Fatalf("CanonicalizeAndHash failed: %v", err)
+	}
+	for _, canonicalization := range []string{"", CanonicalizationV1} {
+		got, err := c.CanonicalizeAndHashForSignature(schema, CurrentSchemapinVersion, canonicalization)
+		if err != nil {
+			t.Fatalf("CanonicalizeAndHashForSignature(%q) failed: %v", canonicalization, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("CanonicalizeAndHashForSignature(%q) hash differs from CanonicalizeAndHash", canonicalization)
+		}
+	}
+
+	_, err = c.CanonicalizeAndHashForSignature(schema, CurrentSchemapinVersion, "schemapin-v2")
+	var unsupported *UnsupportedCanonicalizationError
+	if !errors.As(err, &unsupported) {
+		t.Errorf("expected UnsupportedCanonicalizationError, got %v", err)
+	}
+}
+
+func TestSkillDigestsV1(t *testing.T) {
+	alg, err := LookupCanonicalization(CanonicalizationV1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := alg.SkillFileDigest("SKILL.md", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatalf("SkillFileDigest failed: %v", err)
+	}
+	// sha256("SKILL.mdhello")
+	if !strings.HasPrefix(digest, "sha256:") || len(digest) != len("sha256:")+64 {
+		t.Errorf("unexpected digest %q", digest)
+	}
+
+	// The root hash depends on path order only, not map order
+	a := alg.SkillRootHash(map[string]string{"a": "sha256:01", "b": "sha256:02"})
+	b := alg.SkillRootHash(map[string]string{"b": "sha256:02", "a": "sha256:01"})
+	if !bytes.Equal(a, b) {
+		t.Error("expected SkillRootHash to be independent of map order")
+	}
+}
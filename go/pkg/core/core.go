@@ -3,16 +3,41 @@ package core
 
 import (
 	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"strings"
 )
 
 // SchemaPinCore provides schema canonicalization and hashing
-type SchemaPinCore struct{}
+type SchemaPinCore struct {
+	limits ValidationLimits
+}
+
+// Option configures a SchemaPinCore.
+type Option func(*SchemaPinCore)
+
+// WithValidationLimits sets the limits ValidateSchema and the hashing
+// methods check schemas against. The default is DefaultValidationLimits;
+// Unlimited() turns the checks off.
+func WithValidationLimits(limits ValidationLimits) Option {
+	return func(s *SchemaPinCore) {
+		s.limits = limits
+	}
+}
 
 // NewSchemaPinCore creates a new SchemaPinCore instance
-func NewSchemaPinCore() *SchemaPinCore {
-	return &SchemaPinCore{}
+func NewSchemaPinCore(opts ...Option) *SchemaPinCore {
+	s := &SchemaPinCore{limits: DefaultValidationLimits()}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Limits returns the validation limits the core checks schemas against.
+func (s *SchemaPinCore) Limits() ValidationLimits {
+	return s.limits
 }
 
 // CanonicalizeSchema converts a schema to its canonical string representation
@@ -22,18 +47,15 @@ func NewSchemaPinCore() *SchemaPinCore {
 // - Sort keys lexicographically (recursive)
 // - Strict JSON serialization
 func (s *SchemaPinCore) CanonicalizeSchema(schema map[string]interface{}) (string, error) {
-	// Use Go's json.Marshal with custom encoder settings to match Python's behavior
-	// json.dumps(schema, ensure_ascii=False, separators=(',', ':'), sort_keys=True)
+	// Output matches Go's json.Marshal, which sorts keys and uses compact
+	// format, matching Python's separators=(',', ':') and sort_keys=True
+	e := getEncoder()
+	defer putEncoder(e)
 
-	// Create a buffer to hold the canonical JSON
-	canonical, err := json.Marshal(schema)
-	if err != nil {
+	if err := e.encodeObject(schema); err != nil {
 		return "", fmt.Errorf("failed to canonicalize schema: %w", err)
 	}
-
-	// Go's json.Marshal automatically sorts keys and uses compact format
-	// which matches Python's separators=(',', ':') and sort_keys=True
-	return string(canonical), nil
+	return string(e.buf), nil
 }
 
 // HashCanonical computes SHA-256 hash of canonical schema string
@@ -42,20 +64,82 @@ func (s *SchemaPinCore) HashCanonical(canonical string) []byte {
 	return hash[:]
 }
 
-// CanonicalizeAndHash combines canonicalization and hashing in one step
+// FormatSchemaHash renders a schema hash as sha256:<hex>, the form used to
+// identify schemas in revocation documents.
+func FormatSchemaHash(hash []byte) string {
+	return fmt.Sprintf("sha256:%x", hash)
+}
+
+// ParseSchemaHash parses a schema hash in the sha256:<hex> form written by
+// FormatSchemaHash, requiring a 32-byte digest.
+func ParseSchemaHash(s string) ([]byte, error) {
+	digest, ok := strings.CutPrefix(s, "sha256:")
+	if !ok {
+		return nil, fmt.Errorf("schema hash %q must start with sha256:", s)
+	}
+	hash, err := hex.DecodeString(digest)
+	if err != nil || len(hash) != sha256.Size {
+		return nil, fmt.Errorf("schema hash %q must be sha256: followed by 64 hex digits", s)
+	}
+	return hash, nil
+}
+
+// HashMismatchError is returned when content about to be signed does not
+// have the hash the caller expected, e.g. one recorded by an earlier build
+// step.
+type HashMismatchError struct {
+	Expected string
+	Actual   string
+}
+
+func (e *HashMismatchError) Error() string {
+	return fmt.Sprintf("hash mismatch: expected %s, computed %s", e.Expected, e.Actual)
+}
+
+// CheckExpectedHash compares hash, rendered as sha256:<hex>, with expected
+// and returns a *HashMismatchError if they differ. The hex digits are
+// compared case-insensitively. An empty expected hash always matches.
+func CheckExpectedHash(expected string, hash []byte) error {
+	if expected == "" {
+		return nil
+	}
+	actual := FormatSchemaHash(hash)
+	if !strings.EqualFold(expected, actual) {
+		return &HashMismatchError{Expected: expected, Actual: actual}
+	}
+	return nil
+}
+
+// CanonicalizeAndHash combines canonicalization and hashing in one step.
+// A schema that exceeds the core's validation limits is refused with a
+// *SchemaTooComplexError before it is canonicalized.
 func (s *SchemaPinCore) CanonicalizeAndHash(schema map[string]interface{}) ([]byte, error) {
-	canonical, err := s.CanonicalizeSchema(schema)
-	if err != nil {
+	if err := s.limits.Check(schema); err != nil {
 		return nil, err
 	}
-	return s.HashCanonical(canonical), nil
+	return canonicalizeAndHash(schema)
 }
 
-// ValidateSchema performs basic validation on a schema
+// canonicalizeAndHash hashes the canonical form of schema without checking
+// any limits.
+func canonicalizeAndHash(schema map[string]interface{}) ([]byte, error) {
+	hasher := sha256.New()
+	if err := new(SchemaPinCore).CanonicalizeToWriter(schema, hasher); err != nil {
+		return nil, fmt.Errorf("failed to canonicalize schema: %w", err)
+	}
+	return hasher.Sum(nil), nil
+}
+
+// ValidateSchema performs basic validation on a schema and checks it
+// against the core's validation limits, returning a *SchemaTooComplexError
+// for a schema that exceeds them.
 func (s *SchemaPinCore) ValidateSchema(schema map[string]interface{}) error {
 	if schema == nil {
 		return fmt.Errorf("schema cannot be nil")
 	}
+	if err := s.limits.Check(schema); err != nil {
+		return err
+	}
 
 	// Basic validation - ensure it's valid JSON-serializable
 	_, err := json.Marshal(schema)
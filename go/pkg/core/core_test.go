@@ -2,7 +2,10 @@ package core
 
 import (
 	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"strings"
 	"testing"
 )
 
@@ -396,3 +399,46 @@ func TestKeyOrderingConsistency(t *testing.T) {
 		t.Errorf("Key ordering inconsistency:\nSchema1: %s\nSchema2: %s", canonical1, canonical2)
 	}
 }
+
+func TestCheckExpectedHash(t *testing.T) {
+	core := NewSchemaPinCore()
+	hash, err := core.CanonicalizeAndHash(map[string]interface{}{"type": "object"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	formatted := FormatSchemaHash(hash)
+
+	for _, expected := range []string{"", formatted, strings.ToUpper(formatted[:7]) + strings.ToUpper(formatted[7:])} {
+		if err := CheckExpectedHash(expected, hash); err != nil {
+			t.Errorf("Expected %q to match, got %v", expected, err)
+		}
+	}
+
+	other, _ := core.CanonicalizeAndHash(map[string]interface{}{"type": "string"})
+	err = CheckExpectedHash(FormatSchemaHash(other), hash)
+	var mismatch *HashMismatchError
+	if !errors.As(err, &mismatch) {
+		t.Fatalf("Expected HashMismatchError, got %v", err)
+	}
+	if mismatch.Actual != formatted || mismatch.Expected != FormatSchemaHash(other) {
+		t.Errorf("Unexpected mismatch %+v", mismatch)
+	}
+}
+
+func TestParseSchemaHash(t *testing.T) {
+	hash := NewSchemaPinCore().HashCanonical(`{"name":"tool"}`)
+	parsed, err := ParseSchemaHash(FormatSchemaHash(hash))
+	if err != nil || string(parsed) != string(hash) {
+		t.Fatalf("Expected the formatted hash to round-trip, got %x, %v", parsed, err)
+	}
+	for _, invalid := range []string{
+		"",
+		hex.EncodeToString(hash),
+		"sha256:zz",
+		FormatSchemaHash(hash[:16]),
+	} {
+		if _, err := ParseSchemaHash(invalid); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package core
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Diff describes the structural difference between two schemas.
+//
+// Paths are JSON Pointers (RFC 6901) into the schema, e.g.
+// "/properties/query/type". A path is reported as changed when both sides
+// hold a scalar (or values of different JSON types) that differ; containers
+// present on both sides are descended into instead.
+type Diff struct {
+	OldHash string   `json:"old_hash"`
+	NewHash string   `json:"new_hash"`
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+	Changed []string `json:"changed"`
+}
+
+// SchemaChanged reports whether newSchema canonicalizes to different bytes
+// than oldCanonical (the canonical form of a previously signed schema), and
+// if so which paths were added, removed, or changed.
+//
+// Only the canonical hash decides the boolean: a change anywhere in the
+// canonical bytes invalidates an existing signature.
+func SchemaChanged(oldCanonical string, newSchema map[string]interface{}) (bool, Diff, error) {
+	c := NewSchemaPinCore()
+	newCanonical, err := c.CanonicalizeSchema(newSchema)
+	if err != nil {
+		return false, Diff{}, err
+	}
+
+	diff := Diff{
+		OldHash: "sha256:" + hex.EncodeToString(c.HashCanonical(oldCanonical)),
+		NewHash: "sha256:" + hex.EncodeToString(c.HashCanonical(newCanonical)),
+		Added:   []string{},
+		Removed: []string{},
+		Changed: []string{},
+	}
+	if diff.OldHash == diff.NewHash {
+		return false, diff, nil
+	}
+
+	// Compare the decoded canonical forms so both sides share the same
+	// generic representation (float64 numbers, []interface{} arrays).
+	var oldValue, newValue interface{}
+	if err := json.Unmarshal([]byte(oldCanonical), &oldValue); err != nil {
+		return false, Diff{}, fmt.Errorf("failed to parse old canonical schema: %w", err)
+	}
+	if err := json.Unmarshal([]byte(newCanonical), &newValue); err != nil {
+		return false, Diff{}, fmt.Errorf("failed to parse new canonical schema: %w", err)
+	}
+
+	diffValues("", oldValue, newValue, &diff)
+	sort.Strings(diff.Added)
+	sort.Strings(diff.Removed)
+	sort.Strings(diff.Changed)
+	return true, diff, nil
+}
+
+func diffValues(path string, oldValue, newValue interface{}, diff *Diff) {
+	switch o := oldValue.(type) {
+	case map[string]interface{}:
+		n, ok := newValue.(map[string]interface{})
+		if !ok {
+			diff.Changed = append(diff.Changed, pointerOrRoot(path))
+			return
+		}
+		for key, ov := range o {
+			child := path + "/" + escapePointerToken(key)
+			nv, exists := n[key]
+			if !exists {
+				diff.Removed = append(diff.Removed, child)
+				continue
+			}
+			diffValues(child, ov, nv, diff)
+		}
+		for key := range n {
+			if _, exists := o[key]; !exists {
+				diff.Added = append(diff.Added, path+"/"+escapePointerToken(key))
+			}
+		}
+	case []interface{}:
+		n, ok := newValue.([]interface{})
+		if !ok {
+			diff.Changed = append(diff.Changed, pointerOrRoot(path))
+			return
+		}
+		for i := 0; i < len(o) || i < len(n); i++ {
+			child := path + "/" + strconv.Itoa(i)
+			switch {
+			case i >= len(n):
+				diff.Removed = append(diff.Removed, child)
+			case i >= len(o):
+				diff.Added = append(diff.Added, child)
+			default:
+				diffValues(child, o[i], n[i], diff)
+			}
+		}
+	default:
+		if !reflect.DeepEqual(oldValue, newValue) {
+			diff.Changed = append(diff.Changed, pointerOrRoot(path))
+		}
+	}
+}
+
+func escapePointerToken(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
+
+func pointerOrRoot(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return path
+}
@@ -0,0 +1,108 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSchemaChanged(t *testing.T) {
+	old := map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"query": map[string]interface{}{"type": "string"},
+			"limit": map[string]interface{}{"type": "integer"},
+		},
+		"required": []interface{}{"query"},
+	}
+	oldCanonical, err := NewSchemaPinCore().CanonicalizeSchema(old)
+	if err != nil {
+		t.Fatalf("canonicalize: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		schema   map[string]interface{}
+		changed  bool
+		added    []string
+		removed  []string
+		modified []string
+	}{
+		{
+			name: "identical",
+			schema: map[string]interface{}{
+				"required": []interface{}{"query"},
+				"type":     "object",
+				"properties": map[string]interface{}{
+					"limit": map[string]interface{}{"type": "integer"},
+					"query": map[string]interface{}{"type": "string"},
+				},
+			},
+			changed:  false,
+			added:    []string{},
+			removed:  []string{},
+			modified: []string{},
+		},
+		{
+			name: "added, removed and changed paths",
+			schema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"query":   map[string]interface{}{"type": "number"},
+					"command": map[string]interface{}{"type": "string"},
+				},
+				"required": []interface{}{"query", "command"},
+			},
+			changed:  true,
+			added:    []string{"/properties/command", "/required/1"},
+			removed:  []string{"/properties/limit"},
+			modified: []string{"/properties/query/type"},
+		},
+		{
+			name: "pointer escaping",
+			schema: map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"query": map[string]interface{}{"type": "string"},
+					"limit": map[string]interface{}{"type": "integer"},
+					"a/b~c": true,
+				},
+				"required": []interface{}{"query"},
+			},
+			changed:  true,
+			added:    []string{"/properties/a~1b~0c"},
+			removed:  []string{},
+			modified: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changed, diff, err := SchemaChanged(oldCanonical, tt.schema)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if changed != tt.changed {
+				t.Errorf("changed = %v, want %v", changed, tt.changed)
+			}
+			if changed == (diff.OldHash == diff.NewHash) {
+				t.Errorf("hash equality disagrees with changed: old=%s new=%s", diff.OldHash, diff.NewHash)
+			}
+			if !reflect.DeepEqual(diff.Added, tt.added) {
+				t.Errorf("added = %v, want %v", diff.Added, tt.added)
+			}
+			if !reflect.DeepEqual(diff.Removed, tt.removed) {
+				t.Errorf("removed = %v, want %v", diff.Removed, tt.removed)
+			}
+			if !reflect.DeepEqual(diff.Changed, tt.modified) {
+				t.Errorf("changed paths = %v, want %v", diff.Changed, tt.modified)
+			}
+		})
+	}
+}
+
+func TestSchemaChangedInvalidOldCanonical(t *testing.T) {
+	_, _, err := SchemaChanged("{not json", map[string]interface{}{"type": "object"})
+	if err == nil {
+		t.Error("expected error for unparseable old canonical schema")
+	}
+}
@@ -0,0 +1,74 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ErrInvalidDomain is returned by NormalizeDomain for a domain that cannot
+// be a SchemaPin trust identity.
+var ErrInvalidDomain = errors.New("invalid domain")
+
+// NormalizeDomain reduces a domain as passed to discovery to the identity
+// SchemaPin pins keys and applies policy under. The domain is a host name,
+// optionally with a scheme and port, and optionally followed by a path
+// prefix for platforms that host a .well-known document per tenant:
+// "platform.example/tenants/acme" is served from
+// https://platform.example/tenants/acme/.well-known/schemapin.json.
+//
+// The identity is the lower-cased host without scheme, port or trailing
+// dot, followed by the prefix without its trailing slash. The prefix keeps
+// its case, since paths are case sensitive:
+// "https://Platform.Example:443/tenants/Acme/" normalizes to
+// "platform.example/tenants/Acme". Two prefixes on one host are different
+// identities.
+//
+// A prefix with "." or ".." segments, empty segments, a query string, a
+// fragment or percent-encoding is rejected with ErrInvalidDomain, as is a
+// domain without a host or with user information.
+func NormalizeDomain(domain string) (string, error) {
+	rest := strings.TrimSpace(domain)
+	if i := strings.Index(rest, "://"); i >= 0 {
+		rest = rest[i+3:]
+	}
+	if i := strings.IndexAny(rest, "?#%\\ \t"); i >= 0 {
+		return "", fmt.Errorf("%w %q: unexpected %q", ErrInvalidDomain, domain, rest[i])
+	}
+
+	host, prefix, _ := strings.Cut(rest, "/")
+	if strings.Contains(host, "@") {
+		return "", fmt.Errorf("%w %q: user information is not allowed", ErrInvalidDomain, domain)
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "" {
+		return "", fmt.Errorf("%w %q: no host", ErrInvalidDomain, domain)
+	}
+
+	prefix = strings.TrimRight(prefix, "/")
+	if prefix == "" {
+		return host, nil
+	}
+	for _, segment := range strings.Split(prefix, "/") {
+		switch segment {
+		case "", ".", "..":
+			return "", fmt.Errorf("%w %q: path prefix segment %q is not allowed", ErrInvalidDomain, domain, segment)
+		}
+	}
+	return host + "/" + prefix, nil
+}
+
+// SameDomain reports whether a and b name the same trust identity per
+// NormalizeDomain. Domains that do not normalize are compared as given.
+func SameDomain(a, b string) bool {
+	na, errA := NormalizeDomain(a)
+	nb, errB := NormalizeDomain(b)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	return na == nb
+}
@@ -0,0 +1,61 @@
+package core
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizeDomain(t *testing.T) {
+	tests := []struct {
+		domain   string
+		expected string
+	}{
+		{"example.com", "example.com"},
+		{"Example.COM.", "example.com"},
+		{"https://example.com:8443", "example.com"},
+		{"platform.example/tenants/acme", "platform.example/tenants/acme"},
+		{"https://Platform.Example:443/tenants/Acme/", "platform.example/tenants/Acme"},
+		{"http://localhost:8080/acme", "localhost/acme"},
+	}
+	for _, tt := range tests {
+		got, err := NormalizeDomain(tt.domain)
+		if err != nil {
+			t.Errorf("NormalizeDomain(%q) failed: %v", tt.domain, err)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("NormalizeDomain(%q) = %q, want %q", tt.domain, got, tt.expected)
+		}
+	}
+}
+
+func TestNormalizeDomainRejectsMalformedPrefixes(t *testing.T) {
+	for _, domain := range []string{
+		"",
+		"https://",
+		"platform.example/tenants/../globex",
+		"platform.example/./acme",
+		"platform.example/tenants//acme",
+		"platform.example/tenants/acme?tenant=globex",
+		"platform.example/tenants/acme#globex",
+		"platform.example/tenants/%2e%2e/globex",
+		`platform.example\tenants\acme`,
+		"user@platform.example/acme",
+	} {
+		if got, err := NormalizeDomain(domain); !errors.Is(err, ErrInvalidDomain) {
+			t.Errorf("NormalizeDomain(%q) = %q, %v; expected ErrInvalidDomain", domain, got, err)
+		}
+	}
+}
+
+func TestSameDomain(t *testing.T) {
+	if !SameDomain("Platform.Example/tenants/acme/", "https://platform.example/tenants/acme") {
+		t.Error("Expected spellings of one tenant to be the same domain")
+	}
+	if SameDomain("platform.example/tenants/acme", "platform.example/tenants/globex") {
+		t.Error("Expected two tenants on one host to be different domains")
+	}
+	if SameDomain("platform.example/tenants/acme", "platform.example") {
+		t.Error("Expected a tenant and its host to be different domains")
+	}
+}
@@ -0,0 +1,256 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// CanonicalizeSchemaJCS returns the RFC 8785 canonical form of schema. It
+// differs from CanonicalizeSchema in three ways: numbers are serialized as
+// ECMAScript does (1e+21 rather than 1e21), only the characters JSON
+// requires are escaped (no HTML or U+2028/U+2029 escaping), and object keys
+// are sorted by their UTF-16 code units rather than their UTF-8 bytes.
+// Strings that are not valid UTF-8 are an error rather than replaced.
+func CanonicalizeSchemaJCS(schema map[string]interface{}) (string, error) {
+	var e jcsEncoder
+	if err := e.encodeObject(schema); err != nil {
+		return "", err
+	}
+	return string(e.buf), nil
+}
+
+// hashSchemaJCS is the SHA-256 of the JCS canonical form of schema.
+func hashSchemaJCS(schema map[string]interface{}) ([]byte, error) {
+	canonical, err := CanonicalizeSchemaJCS(schema)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(canonical))
+	return sum[:], nil
+}
+
+// jcsEncoder writes the RFC 8785 canonical form of generic JSON values.
+type jcsEncoder struct {
+	buf []byte
+}
+
+func (e *jcsEncoder) encode(v interface{}) error {
+	switch value := v.(type) {
+	case nil:
+		e.buf = append(e.buf, "null"...)
+	case map[string]interface{}:
+		return e.encodeObject(value)
+	case []interface{}:
+		return e.encodeArray(value)
+	case string:
+		return e.encodeString(value)
+	case bool:
+		e.buf = strconv.AppendBool(e.buf, value)
+	case float64:
+		return e.encodeNumber(value)
+	case int:
+		return e.encodeNumber(float64(value))
+	case int64:
+		return e.encodeNumber(float64(value))
+	case json.Number:
+		f, err := value.Float64()
+		if err != nil {
+			return err
+		}
+		return e.encodeNumber(f)
+	default:
+		// Round-trip other values through encoding/json so that they are
+		// canonicalized as the generic JSON they marshal to.
+		out, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		var generic interface{}
+		if err := json.Unmarshal(out, &generic); err != nil {
+			return err
+		}
+		return e.encode(generic)
+	}
+	return nil
+}
+
+func (e *jcsEncoder) encodeObject(m map[string]interface{}) error {
+	if m == nil {
+		e.buf = append(e.buf, "null"...)
+		return nil
+	}
+
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		if !utf8.ValidString(key) {
+			return fmt.Errorf("jcs: object key %q is not valid UTF-8", key)
+		}
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return lessUTF16(keys[i], keys[j]) })
+
+	e.buf = append(e.buf, '{')
+	for i, key := range keys {
+		if i > 0 {
+			e.buf = append(e.buf, ',')
+		}
+		if err := e.encodeString(key); err != nil {
+			return err
+		}
+		e.buf = append(e.buf, ':')
+		if err := e.encode(m[key]); err != nil {
+			return err
+		}
+	}
+	e.buf = append(e.buf, '}')
+	return nil
+}
+
+func (e *jcsEncoder) encodeArray(a []interface{}) error {
+	if a == nil {
+		e.buf = append(e.buf, "null"...)
+		return nil
+	}
+
+	e.buf = append(e.buf, '[')
+	for i, item := range a {
+		if i > 0 {
+			e.buf = append(e.buf, ',')
+		}
+		if err := e.encode(item); err != nil {
+			return err
+		}
+	}
+	e.buf = append(e.buf, ']')
+	return nil
+}
+
+// encodeString escapes only what RFC 8785 §3.2.2.2 requires: the quote,
+// the backslash and control characters, using the two-character forms
+// where JSON has them and \u00xx with lowercase hex otherwise.
+func (e *jcsEncoder) encodeString(s string) error {
+	if !utf8.ValidString(s) {
+		return fmt.Errorf("jcs: string %q is not valid UTF-8", s)
+	}
+	const hex = "0123456789abcdef"
+	e.buf = append(e.buf, '"')
+	start := 0
+	for i := 0; i < len(s); i++ {
+		b := s[i]
+		if b >= 0x20 && b != '"' && b != '\\' {
+			continue
+		}
+		e.buf = append(e.buf, s[start:i]...)
+		switch b {
+		case '"', '\\':
+			e.buf = append(e.buf, '\\', b)
+		case '\b':
+			e.buf = append(e.buf, '\\', 'b')
+		case '\t':
+			e.buf = append(e.buf, '\\', 't')
+		case '\n':
+			e.buf = append(e.buf, '\\', 'n')
+		case '\f':
+			e.buf = append(e.buf, '\\', 'f')
+		case '\r':
+			e.buf = append(e.buf, '\\', 'r')
+		default:
+			e.buf = append(e.buf, '\\', 'u', '0', '0', hex[b>>4], hex[b&0xf])
+		}
+		start = i + 1
+	}
+	e.buf = append(e.buf, s[start:]...)
+	e.buf = append(e.buf, '"')
+	return nil
+}
+
+// encodeNumber serializes f as ECMAScript's Number.prototype.toString does
+// (ECMA-262 §7.1.12.1), which RFC 8785 §3.2.2.3 adopts.
+func (e *jcsEncoder) encodeNumber(f float64) error {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return fmt.Errorf("jcs: %v is not a valid JSON number", f)
+	}
+	e.buf = appendES6Number(e.buf, f)
+	return nil
+}
+
+// appendES6Number appends the ECMAScript string form of the finite number
+// f to buf.
+func appendES6Number(buf []byte, f float64) []byte {
+	if f == 0 { // also -0
+		return append(buf, '0')
+	}
+	if f < 0 {
+		buf = append(buf, '-')
+		f = -f
+	}
+
+	// The shortest digits that round-trip, as "d.ddde±x"; both Go and
+	// ECMAScript pick the closest such digits to f.
+	formatted := strconv.FormatFloat(f, 'e', -1, 64)
+	mantissa, exp, _ := strings.Cut(formatted, "e")
+	digits := strings.Replace(mantissa, ".", "", 1)
+	x, _ := strconv.Atoi(exp)
+	k := len(digits)
+	n := x + 1 // f = 0.digits × 10^n
+
+	switch {
+	case k <= n && n <= 21:
+		buf = append(buf, digits...)
+		for i := k; i < n; i++ {
+			buf = append(buf, '0')
+		}
+	case 0 < n && n <= 21:
+		buf = append(buf, digits[:n]...)
+		buf = append(buf, '.')
+		buf = append(buf, digits[n:]...)
+	case -6 < n && n <= 0:
+		buf = append(buf, '0', '.')
+		for i := n; i < 0; i++ {
+			buf = append(buf, '0')
+		}
+		buf = append(buf, digits...)
+	default:
+		buf = append(buf, digits[0])
+		if k > 1 {
+			buf = append(buf, '.')
+			buf = append(buf, digits[1:]...)
+		}
+		buf = append(buf, 'e')
+		if n-1 >= 0 {
+			buf = append(buf, '+')
+		}
+		buf = strconv.AppendInt(buf, int64(n-1), 10)
+	}
+	return buf
+}
+
+// lessUTF16 orders strings by their UTF-16 code units, as RFC 8785 §3.2.3
+// sorts object keys. It differs from byte order only for characters above
+// U+FFFF, whose surrogates sort below U+E000 through U+FFFF.
+func lessUTF16(a, b string) bool {
+	for a != "" && b != "" {
+		ra, sa := utf8.DecodeRuneInString(a)
+		rb, sb := utf8.DecodeRuneInString(b)
+		if ra != rb {
+			return utf16Unit(ra) < utf16Unit(rb) || utf16Unit(ra) == utf16Unit(rb) && ra < rb
+		}
+		a, b = a[sa:], b[sb:]
+	}
+	return a == "" && b != ""
+}
+
+// utf16Unit is the first UTF-16 code unit of r.
+func utf16Unit(r rune) rune {
+	if r1, _ := utf16.EncodeRune(r); r1 != utf8.RuneError {
+		return r1
+	}
+	return r
+}
@@ -0,0 +1,177 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+// The vectors below are from RFC 8785 and its reference implementation's
+// test data (github.com/cyberphone/json-canonicalization/testdata).
+
+func TestCanonicalizeSchemaJCSVectors(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			// RFC 8785 §3.2.2
+			name: "rfc8785 example",
+			input: `{
+				"numbers": [333333333.33333329, 1E30, 4.50, 2e-3, 0.000000000000000000000000001],
+				"string": "\u20ac$\u000F\u000aA'\u0042\u0022\u005c\\\"\/",
+				"literals": [null, true, false]
+			}`,
+			want: `{"literals":[null,true,false],"numbers":[333333333.3333333,1e+30,4.5,0.002,1e-27],"string":"€$\u000f\nA'B\"\\\\\"/"}`,
+		},
+		{
+			// RFC 8785 §3.2.3
+			name: "rfc8785 sorting",
+			input: `{
+				"\u20ac": "Euro Sign",
+				"\r": "Carriage Return",
+				"\ufb33": "Hebrew Letter Dalet With Dagesh",
+				"1": "One",
+				"\ud83d\ude00": "Emoji: Grinning Face",
+				"\u0080": "Control",
+				"\u00f6": "Latin Small Letter O With Diaeresis"
+			}`,
+			want: "{\"\\r\":\"Carriage Return\",\"1\":\"One\",\"\u0080\":\"Control\",\"ö\":\"Latin Small Letter O With Diaeresis\",\"€\":\"Euro Sign\",\"😀\":\"Emoji: Grinning Face\",\"\ufb33\":\"Hebrew Letter Dalet With Dagesh\"}",
+		},
+		{
+			// testdata/input/weird.json
+			name: "weird",
+			input: `{
+				"\u20ac": "Euro Sign",
+				"\r": "Carriage Return",
+				"\u000a": "Newline",
+				"1": "One",
+				"\u0080": "Control\u007f",
+				"\ud83d\ude02": "Smiley",
+				"\u00f6": "Latin Small Letter O With Diaeresis",
+				"\ufb33": "Hebrew Letter Dalet With Dagesh",
+				"</script>": "Browser Challenge"
+			}`,
+			want: "{\"\\n\":\"Newline\",\"\\r\":\"Carriage Return\",\"1\":\"One\",\"</script>\":\"Browser Challenge\",\"\u0080\":\"Control\u007f\",\"ö\":\"Latin Small Letter O With Diaeresis\",\"€\":\"Euro Sign\",\"😂\":\"Smiley\",\"\ufb33\":\"Hebrew Letter Dalet With Dagesh\"}",
+		},
+		{
+			// testdata/input/structures.json
+			name: "structures",
+			input: `{
+				"1": {"f": {"f": "hi","F": 5} ,"\n": 56.0},
+				"10": { },
+				"": "empty",
+				"a": { },
+				"111": [ {"e": "yes","E": "no" } ],
+				"A": { }
+			}`,
+			want: `{"":"empty","1":{"\n":56,"f":{"F":5,"f":"hi"}},"10":{},"111":[{"E":"no","e":"yes"}],"A":{},"a":{}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var schema map[string]interface{}
+			if err := json.Unmarshal([]byte(tt.input), &schema); err != nil {
+				t.Fatal(err)
+			}
+			got, err := CanonicalizeSchemaJCS(schema)
+			if err != nil {
+				t.Fatalf("CanonicalizeSchemaJCS failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("CanonicalizeSchemaJCS =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJCSNumberSerialization(t *testing.T) {
+	// RFC 8785 Appendix B
+	tests := []struct {
+		bits uint64
+		want string
+	}{
+		{0x0000000000000000, "0"},
+		{0x8000000000000000, "0"},
+		{0x0000000000000001, "5e-324"},
+		{0x8000000000000001, "-5e-324"},
+		{0x7fefffffffffffff, "1.7976931348623157e+308"},
+		{0xffefffffffffffff, "-1.7976931348623157e+308"},
+		{0x4340000000000000, "9007199254740992"},
+		{0xc340000000000000, "-9007199254740992"},
+		{0x4430000000000000, "295147905179352830000"},
+		{0x44b52d02c7e14af5, "9.999999999999997e+22"},
+		{0x44b52d02c7e14af6, "1e+23"},
+		{0x44b52d02c7e14af7, "1.0000000000000001e+23"},
+		{0x444b1ae4d6e2ef4e, "999999999999999700000"},
+		{0x444b1ae4d6e2ef4f, "999999999999999900000"},
+		{0x444b1ae4d6e2ef50, "1e+21"},
+		{0x3eb0c6f7a0b5ed8c, "9.999999999999997e-7"},
+		{0x3eb0c6f7a0b5ed8d, "0.000001"},
+		{0x41b3de4355555553, "333333333.3333332"},
+		{0x41b3de4355555554, "333333333.33333325"},
+		{0x41b3de4355555555, "333333333.3333333"},
+		{0x41b3de4355555556, "333333333.3333334"},
+		{0x41b3de4355555557, "333333333.33333343"},
+		{0xbecbf647612f3696, "-0.0000033333333333333333"},
+		{0x43143ff3c1cb0959, "1424953923781206.2"},
+	}
+	for _, tt := range tests {
+		if got := string(appendES6Number(nil, math.Float64frombits(tt.bits))); got != tt.want {
+			t.Errorf("%016x: got %s, want %s", tt.bits, got, tt.want)
+		}
+	}
+
+	for _, bits := range []uint64{0x7fffffffffffffff, 0x7ff0000000000000} {
+		schema := map[string]interface{}{"n": math.Float64frombits(bits)}
+		if _, err := CanonicalizeSchemaJCS(schema); err == nil {
+			t.Errorf("%016x: expected NaN and Infinity to be refused", bits)
+		}
+	}
+}
+
+func TestCanonicalizeSchemaJCSRefusesInvalidUTF8(t *testing.T) {
+	for _, schema := range []map[string]interface{}{
+		{"description": "bad \xff byte"},
+		{"bad \xff key": true},
+	} {
+		if _, err := CanonicalizeSchemaJCS(schema); err == nil {
+			t.Errorf("expected invalid UTF-8 in %q to be refused", schema)
+		}
+	}
+}
+
+func TestJCSDiffersFromV1(t *testing.T) {
+	c := NewSchemaPinCore()
+	schema := map[string]interface{}{
+		"type":        "object",
+		"description": "<b>big</b> numbers",
+		"maximum":     1e21,
+	}
+
+	jcs, err := c.CanonicalizeAndHashForSignature(schema, CurrentSchemapinVersion, CanonicalizationJCS)
+	if err != nil {
+		t.Fatalf("CanonicalizeAndHashForSignature(jcs) failed: %v", err)
+	}
+	legacy, err := c.CanonicalizeAndHashForSignature(schema, CurrentSchemapinVersion, CanonicalizationV1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(jcs, legacy) {
+		t.Fatal("Expected JCS and schemapin-v1 hashes to differ for HTML and large numbers")
+	}
+	if want, _ := hashSchemaJCS(schema); !bytes.Equal(jcs, want) {
+		t.Error("Expected the jcs registry entry to hash the JCS canonical form")
+	}
+
+	// Simple schemas canonicalize identically under both
+	simple := map[string]interface{}{"type": "object", "required": []interface{}{"a"}, "maxItems": 3.0}
+	jcsForm, _ := CanonicalizeSchemaJCS(simple)
+	v1Form, _ := c.CanonicalizeSchema(simple)
+	if jcsForm != v1Form {
+		t.Errorf("Expected identical forms for a simple schema, got %s and %s", jcsForm, v1Form)
+	}
+}
@@ -0,0 +1,195 @@
+package core
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+)
+
+// ValidationLimits bounds the size and shape of a schema before it is
+// canonicalized, so that a hostile schema cannot make verification
+// exhaust memory, time or stack. A zero field means no limit.
+type ValidationLimits struct {
+	// MaxBytes is the largest serialized size of the schema. The size is
+	// that of its canonical JSON, not counting escape sequences.
+	MaxBytes int64
+	// MaxDepth is the deepest nesting of objects and arrays; the schema
+	// object itself is at depth 1.
+	MaxDepth int
+	// MaxKeys is the most object keys in the whole schema.
+	MaxKeys int
+	// MaxStringLength is the longest string value or key, in bytes.
+	MaxStringLength int
+}
+
+// The limits of DefaultValidationLimits. They are far above the size of
+// real tool schemas.
+const (
+	DefaultMaxSchemaBytes  = 10 << 20
+	DefaultMaxSchemaDepth  = 128
+	DefaultMaxSchemaKeys   = 100000
+	DefaultMaxStringLength = 1 << 20
+)
+
+// Names of the limits, as reported in SchemaTooComplexError.Limit.
+const (
+	LimitMaxBytes        = "max_bytes"
+	LimitMaxDepth        = "max_depth"
+	LimitMaxKeys         = "max_keys"
+	LimitMaxStringLength = "max_string_length"
+)
+
+// DefaultValidationLimits returns the limits a SchemaPinCore checks unless
+// it is given others with WithValidationLimits.
+func DefaultValidationLimits() ValidationLimits {
+	return ValidationLimits{
+		MaxBytes:        DefaultMaxSchemaBytes,
+		MaxDepth:        DefaultMaxSchemaDepth,
+		MaxKeys:         DefaultMaxSchemaKeys,
+		MaxStringLength: DefaultMaxStringLength,
+	}
+}
+
+// Unlimited returns limits that accept any schema.
+func Unlimited() ValidationLimits {
+	return ValidationLimits{}
+}
+
+// SchemaTooComplexError is returned for a schema that exceeds one of its
+// ValidationLimits. It matches schemaerr.ErrSchemaTooComplex.
+type SchemaTooComplexError struct {
+	// Limit is the name of the exceeded limit, e.g. LimitMaxDepth.
+	Limit string
+	// Max is the value of the limit.
+	Max int64
+	// Path is the JSON path, e.g. $.properties.query, at which the limit
+	// was exceeded.
+	Path string
+}
+
+func (e *SchemaTooComplexError) Error() string {
+	return fmt.Sprintf("schema too complex: %s limit of %d exceeded at %s", e.Limit, e.Max, e.Path)
+}
+
+// Is reports whether target is schemaerr.ErrSchemaTooComplex.
+func (e *SchemaTooComplexError) Is(target error) bool {
+	return target == schemaerr.ErrSchemaTooComplex
+}
+
+// Check returns a *SchemaTooComplexError if schema exceeds l. It stops at
+// the first limit exceeded, without descending further than MaxDepth.
+func (l ValidationLimits) Check(schema map[string]interface{}) error {
+	if l == (ValidationLimits{}) {
+		return nil
+	}
+	c := limitChecker{limits: l}
+	return c.value(schema, []string{"$"}, 1)
+}
+
+// limitChecker walks a schema, counting its keys and serialized size.
+type limitChecker struct {
+	limits ValidationLimits
+	keys   int
+	size   int64
+	// num formats numbers to count their length
+	num canonicalEncoder
+}
+
+func (c *limitChecker) fail(limit string, max int64, path []string) error {
+	return &SchemaTooComplexError{Limit: limit, Max: max, Path: strings.Join(path, "")}
+}
+
+// add counts n bytes of serialized output.
+func (c *limitChecker) add(n int, path []string) error {
+	c.size += int64(n)
+	if c.limits.MaxBytes > 0 && c.size > c.limits.MaxBytes {
+		return c.fail(LimitMaxBytes, c.limits.MaxBytes, path)
+	}
+	return nil
+}
+
+func (c *limitChecker) str(s string, path []string) error {
+	if c.limits.MaxStringLength > 0 && len(s) > c.limits.MaxStringLength {
+		return c.fail(LimitMaxStringLength, int64(c.limits.MaxStringLength), path)
+	}
+	return c.add(len(s)+2, path)
+}
+
+func (c *limitChecker) value(v interface{}, path []string, depth int) error {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if c.limits.MaxDepth > 0 && depth > c.limits.MaxDepth {
+			return c.fail(LimitMaxDepth, int64(c.limits.MaxDepth), path)
+		}
+		if err := c.add(len(v)+separators(len(v)), path); err != nil { // braces, colons and commas
+			return err
+		}
+		for k, child := range v {
+			childPath := append(path, pathSegment(k))
+			c.keys++
+			if c.limits.MaxKeys > 0 && c.keys > c.limits.MaxKeys {
+				return c.fail(LimitMaxKeys, int64(c.limits.MaxKeys), childPath)
+			}
+			if err := c.str(k, childPath); err != nil {
+				return err
+			}
+			if err := c.value(child, childPath, depth+1); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		if c.limits.MaxDepth > 0 && depth > c.limits.MaxDepth {
+			return c.fail(LimitMaxDepth, int64(c.limits.MaxDepth), path)
+		}
+		if err := c.add(separators(len(v)), path); err != nil { // brackets and commas
+			return err
+		}
+		for i, child := range v {
+			if err := c.value(child, append(path, "["+strconv.Itoa(i)+"]"), depth+1); err != nil {
+				return err
+			}
+		}
+	case string:
+		return c.str(v, path)
+	case float64:
+		c.num.buf = c.num.buf[:0]
+		_ = c.num.encodeFloat(v) // NaN and infinities fail canonicalization
+		return c.add(len(c.num.buf), path)
+	case bool:
+		if v {
+			return c.add(4, path)
+		}
+		return c.add(5, path)
+	case nil:
+		return c.add(4, path)
+	default:
+		// Other types are marshaled by encoding/json; count a placeholder
+		// so they are not free.
+		return c.add(1, path)
+	}
+	return nil
+}
+
+// separators is the number of brackets and commas around n elements.
+func separators(n int) int {
+	if n == 0 {
+		return 2
+	}
+	return n + 1
+}
+
+// pathSegment renders an object key as a JSON path segment: .name for
+// identifier-like keys and ["key"] otherwise.
+func pathSegment(key string) string {
+	for i, r := range key {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || i > 0 && r >= '0' && r <= '9') {
+			return "[" + strconv.Quote(key) + "]"
+		}
+	}
+	if key == "" {
+		return `[""]`
+	}
+	return "." + key
+}
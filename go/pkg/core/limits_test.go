@@ -0,0 +1,138 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+)
+
+// nestedSchema returns a schema with depth levels of nested objects.
+func nestedSchema(depth int) map[string]interface{} {
+	schema := map[string]interface{}{"type": "string"}
+	for i := 1; i < depth; i++ {
+		schema = map[string]interface{}{"items": schema}
+	}
+	return schema
+}
+
+func TestValidationLimitsDeeplyNestedBomb(t *testing.T) {
+	core := NewSchemaPinCore()
+	bomb := nestedSchema(100000)
+
+	_, err := core.CanonicalizeAndHash(bomb)
+	var tooComplex *SchemaTooComplexError
+	if !errors.As(err, &tooComplex) {
+		t.Fatalf("Expected a SchemaTooComplexError, got %v", err)
+	}
+	if tooComplex.Limit != LimitMaxDepth || tooComplex.Max != DefaultMaxSchemaDepth {
+		t.Errorf("Expected the max_depth limit, got %+v", tooComplex)
+	}
+	if want := "$" + strings.Repeat(".items", DefaultMaxSchemaDepth); tooComplex.Path != want {
+		t.Errorf("Expected the path of the first object too deep, got %s", tooComplex.Path)
+	}
+	if !errors.Is(err, schemaerr.ErrSchemaTooComplex) {
+		t.Errorf("Expected the error to match schemaerr.ErrSchemaTooComplex")
+	}
+	if err := core.ValidateSchema(bomb); !errors.Is(err, schemaerr.ErrSchemaTooComplex) {
+		t.Errorf("Expected ValidateSchema to refuse the bomb, got %v", err)
+	}
+	if _, err := core.CanonicalizeAndHashForSignature(bomb, "", ""); !errors.Is(err, schemaerr.ErrSchemaTooComplex) {
+		t.Errorf("Expected CanonicalizeAndHashForSignature to refuse the bomb, got %v", err)
+	}
+}
+
+func TestValidationLimitsWideKeysBomb(t *testing.T) {
+	properties := make(map[string]interface{}, DefaultMaxSchemaKeys)
+	for i := 0; i < DefaultMaxSchemaKeys; i++ {
+		properties[fmt.Sprintf("p%d", i)] = 1.0
+	}
+	bomb := map[string]interface{}{"type": "object", "properties": properties}
+
+	err := NewSchemaPinCore().ValidateSchema(bomb)
+	var tooComplex *SchemaTooComplexError
+	if !errors.As(err, &tooComplex) || tooComplex.Limit != LimitMaxKeys {
+		t.Fatalf("Expected the max_keys limit to be exceeded, got %v", err)
+	}
+	if !strings.HasPrefix(tooComplex.Path, "$.") {
+		t.Errorf("Expected the path of the key over the limit, got %s", tooComplex.Path)
+	}
+}
+
+func TestValidationLimitsBytesAndStrings(t *testing.T) {
+	schema := map[string]interface{}{
+		"type":        "object",
+		"description": strings.Repeat("x", 100),
+		"properties":  map[string]interface{}{"weird key": map[string]interface{}{"enum": []interface{}{"a", strings.Repeat("y", 50), 1e6, 2.5e-7, true, nil}}},
+	}
+
+	tests := []struct {
+		limits ValidationLimits
+		limit  string
+		path   string
+	}{
+		{ValidationLimits{MaxStringLength: 75}, LimitMaxStringLength, "$.description"},
+		{ValidationLimits{MaxDepth: 3}, LimitMaxDepth, `$.properties["weird key"].enum`},
+		{ValidationLimits{MaxBytes: 100}, LimitMaxBytes, ""},
+	}
+	for _, tt := range tests {
+		err := tt.limits.Check(schema)
+		var tooComplex *SchemaTooComplexError
+		if !errors.As(err, &tooComplex) || tooComplex.Limit != tt.limit {
+			t.Errorf("Check with %+v: expected %s to be exceeded, got %v", tt.limits, tt.limit, err)
+			continue
+		}
+		if tt.path != "" && tooComplex.Path != tt.path {
+			t.Errorf("Check with %+v: expected path %s, got %s", tt.limits, tt.path, tooComplex.Path)
+		}
+	}
+
+	// The byte count matches the canonical size for schemas without escapes
+	canonical, err := NewSchemaPinCore().CanonicalizeSchema(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := (ValidationLimits{MaxBytes: int64(len(canonical))}).Check(schema); err != nil {
+		t.Errorf("Expected a schema of exactly MaxBytes to pass, got %v", err)
+	}
+	if err := (ValidationLimits{MaxBytes: int64(len(canonical)) - 1}).Check(schema); err == nil {
+		t.Errorf("Expected a schema one byte over MaxBytes to fail")
+	}
+}
+
+func TestValidationLimitsAcceptLargeLegitimateSchemas(t *testing.T) {
+	// A few thousand documented properties, several levels deep
+	properties := make(map[string]interface{})
+	for i := 0; i < 5000; i++ {
+		properties[fmt.Sprintf("field_%d", i)] = map[string]interface{}{
+			"type":        "object",
+			"description": strings.Repeat("documentation ", 20),
+			"properties": map[string]interface{}{
+				"value": map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string", "enum": []interface{}{"a", "b"}}},
+			},
+		}
+	}
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+
+	core := NewSchemaPinCore()
+	if err := core.ValidateSchema(schema); err != nil {
+		t.Fatalf("Expected the schema to pass the default limits, got %v", err)
+	}
+	if _, err := core.CanonicalizeAndHash(schema); err != nil {
+		t.Fatalf("CanonicalizeAndHash failed: %v", err)
+	}
+}
+
+func TestValidationLimitsUnlimited(t *testing.T) {
+	core := NewSchemaPinCore(WithValidationLimits(Unlimited()))
+	if _, err := core.CanonicalizeAndHash(nestedSchema(DefaultMaxSchemaDepth * 2)); err != nil {
+		t.Errorf("Expected Unlimited to accept a deep schema, got %v", err)
+	}
+
+	strict := NewSchemaPinCore(WithValidationLimits(ValidationLimits{MaxDepth: 2}))
+	if err := strict.ValidateSchema(nestedSchema(3)); !errors.Is(err, schemaerr.ErrSchemaTooComplex) {
+		t.Errorf("Expected a custom depth limit to apply, got %v", err)
+	}
+}
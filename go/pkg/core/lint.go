@@ -0,0 +1,425 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// LintSeverity ranks a LintFinding. Signers decide what each severity
+// does; schemapin-sign warns about every finding, or refuses to sign with
+// --lint=strict.
+type LintSeverity string
+
+const (
+	// LintSeverityHigh is a likely secret, such as a credential.
+	LintSeverityHigh LintSeverity = "high"
+	// LintSeverityMedium is content that is probably a mistake.
+	LintSeverityMedium LintSeverity = "medium"
+	// LintSeverityLow is content worth a second look.
+	LintSeverityLow LintSeverity = "low"
+)
+
+// LintMode is what LintForSigning does with findings.
+type LintMode string
+
+const (
+	// LintOff skips linting.
+	LintOff LintMode = "off"
+	// LintWarn reports findings and lets signing proceed.
+	LintWarn LintMode = "warn"
+	// LintStrict refuses to sign a schema with any finding.
+	LintStrict LintMode = "strict"
+)
+
+// ParseLintMode parses "off", "warn" or "strict". An empty mode is
+// LintWarn.
+func ParseLintMode(s string) (LintMode, error) {
+	switch mode := LintMode(s); mode {
+	case "":
+		return LintWarn, nil
+	case LintOff, LintWarn, LintStrict:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid lint mode %q (expected off, warn or strict)", s)
+}
+
+// LintError refuses to sign a schema that has findings in LintStrict mode.
+type LintError struct {
+	Findings []LintFinding
+}
+
+func (e *LintError) Error() string {
+	return fmt.Sprintf("schema has %d lint finding(s) in strict mode", len(e.Findings))
+}
+
+// LintForSigning lints schema before it is signed: in LintOff mode it
+// returns nothing, in LintWarn mode the findings, and in LintStrict mode
+// the findings and, if there are any, a *LintError.
+func LintForSigning(schema map[string]interface{}, mode LintMode) ([]LintFinding, error) {
+	if mode == LintOff {
+		return nil, nil
+	}
+	findings := LintSchema(schema)
+	if mode == LintStrict && len(findings) > 0 {
+		return findings, &LintError{Findings: findings}
+	}
+	return findings, nil
+}
+
+// MaxLintDescriptionLength is the length, in characters, above which a
+// description field is reported by the long_description detector.
+const MaxLintDescriptionLength = 1000
+
+// LintFinding is a problem LintSchema found in one string value of a
+// schema.
+type LintFinding struct {
+	// Detector is the name of the LintDetector that reported it.
+	Detector string `json:"detector"`
+	// Path is the JSON Pointer (RFC 6901) of the value, e.g.
+	// "/properties/token/default".
+	Path     string       `json:"path"`
+	Severity LintSeverity `json:"severity"`
+	Message  string       `json:"message"`
+	// Excerpt is a short part of the value around the match, with any
+	// secret matched redacted.
+	Excerpt string `json:"excerpt"`
+}
+
+func (f LintFinding) String() string {
+	return fmt.Sprintf("%s: %s [%s, %s]: %q", pointerOrRoot(f.Path), f.Message, f.Detector, f.Severity, f.Excerpt)
+}
+
+// LintValue is a string value of a schema, as given to detectors.
+type LintValue struct {
+	// Path is the JSON Pointer of the value.
+	Path string
+	// Key is the object key the value is under; for an array element it
+	// is the key of the array.
+	Key string
+	// InDefault reports whether the value is in a "default", at any depth.
+	InDefault bool
+	Value     string
+}
+
+// LintMatch is what a detector found in a value.
+type LintMatch struct {
+	Message string
+	// Secret is the part of the value that must not be shown, if any. It
+	// is redacted wherever it appears in the finding's excerpt.
+	Secret string
+}
+
+// LintDetector checks the string values of schemas. Check is called for
+// every string value and returns the matches found in it, if any.
+type LintDetector struct {
+	Name     string
+	Severity LintSeverity
+	Check    func(v LintValue) []LintMatch
+}
+
+var (
+	lintMu        sync.RWMutex
+	lintDetectors = []LintDetector{
+		{Name: "private_key", Severity: LintSeverityHigh, Check: checkPrivateKey},
+		{Name: "aws_access_key", Severity: LintSeverityHigh, Check: checkAWSAccessKey},
+		{Name: "bearer_token", Severity: LintSeverityHigh, Check: checkBearerToken},
+		{Name: "high_entropy", Severity: LintSeverityMedium, Check: checkHighEntropy},
+		{Name: "suspicious_url", Severity: LintSeverityMedium, Check: checkSuspiciousURL},
+		{Name: "long_description", Severity: LintSeverityLow, Check: checkLongDescription},
+	}
+)
+
+// RegisterLintDetector adds d to the detectors LintSchema runs, e.g. for
+// an organization's own token formats. It returns an error if d has no
+// name or check, or a detector of that name is already registered.
+func RegisterLintDetector(d LintDetector) error {
+	if d.Name == "" || d.Check == nil {
+		return fmt.Errorf("lint detector needs a name and a check")
+	}
+	if d.Severity == "" {
+		d.Severity = LintSeverityMedium
+	}
+	lintMu.Lock()
+	defer lintMu.Unlock()
+	for _, existing := range lintDetectors {
+		if existing.Name == d.Name {
+			return fmt.Errorf("lint detector %q is already registered", d.Name)
+		}
+	}
+	lintDetectors = append(lintDetectors, d)
+	return nil
+}
+
+// LintDetectors returns the names of the registered detectors, built-in
+// ones first.
+func LintDetectors() []string {
+	lintMu.RLock()
+	defer lintMu.RUnlock()
+	names := make([]string, len(lintDetectors))
+	for i, d := range lintDetectors {
+		names[i] = d.Name
+	}
+	return names
+}
+
+// LintSchema runs every registered detector over the string values of
+// schema and returns the findings, value by value with object keys in
+// sorted order, and for each value in detector order. It looks
+// for secrets and dangerous content before a schema is signed and
+// published: credentials and high-entropy strings anywhere, suspicious
+// URLs in defaults, and descriptions longer than MaxLintDescriptionLength.
+func LintSchema(schema map[string]interface{}) []LintFinding {
+	lintMu.RLock()
+	detectors := append([]LintDetector(nil), lintDetectors...)
+	lintMu.RUnlock()
+
+	var findings []LintFinding
+	walkLintValues("", "", false, schema, func(v LintValue) {
+		var found []LintFinding
+		var matches []LintMatch
+		var secrets []string
+		for _, d := range detectors {
+			for _, m := range d.Check(v) {
+				found = append(found, LintFinding{Detector: d.Name, Path: v.Path, Severity: d.Severity, Message: m.Message})
+				matches = append(matches, m)
+				if m.Secret != "" {
+					secrets = append(secrets, m.Secret)
+				}
+			}
+		}
+		// Every secret found in the value is redacted in every excerpt,
+		// so that one finding's excerpt cannot show another's.
+		for i := range found {
+			found[i].Excerpt = lintExcerpt(v.Value, secrets, matches[i].Secret)
+		}
+		findings = append(findings, found...)
+	})
+	return findings
+}
+
+// walkLintValues calls visit for every string in value, visiting object
+// keys in sorted order so that findings are reported in a stable order.
+func walkLintValues(path, key string, inDefault bool, value interface{}, visit func(LintValue)) {
+	switch v := value.(type) {
+	case string:
+		visit(LintValue{Path: path, Key: key, InDefault: inDefault, Value: v})
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			walkLintValues(path+"/"+escapePointerToken(k), k, inDefault || k == "default", v[k], visit)
+		}
+	case []interface{}:
+		for i, item := range v {
+			walkLintValues(fmt.Sprintf("%s/%d", path, i), key, inDefault, item, visit)
+		}
+	}
+}
+
+// lintExcerptContext is the number of characters shown on each side of a
+// secret, and half the length of excerpts of other values.
+const lintExcerptContext = 24
+
+// lintExcerpt returns a short part of value around secret, or its start
+// if secret is empty, with every one of secrets redacted. Each secret is
+// first replaced by a single private-use character, longest first so that
+// a secret containing another is hidden whole, so that the excerpt is cut
+// without splitting a secret.
+func lintExcerpt(value string, secrets []string, secret string) string {
+	sorted := append([]string(nil), secrets...)
+	sort.SliceStable(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+	marker := func(i int) string { return string(rune(0xE000 + i)) }
+	for i, s := range sorted {
+		value = strings.ReplaceAll(value, s, marker(i))
+	}
+
+	runes := []rune(value)
+	start, end := 0, min(len(runes), 2*lintExcerptContext)
+	for i, s := range sorted {
+		if s != secret {
+			continue
+		}
+		if at := strings.Index(value, marker(i)); at >= 0 {
+			at = utf8.RuneCountInString(value[:at])
+			start, end = max(0, at-lintExcerptContext), min(len(runes), at+1+lintExcerptContext)
+		}
+		break
+	}
+	excerpt := string(runes[start:end])
+	if start > 0 {
+		excerpt = "..." + excerpt
+	}
+	if end < len(runes) {
+		excerpt += "..."
+	}
+	for i, s := range sorted {
+		excerpt = strings.ReplaceAll(excerpt, marker(i), redactSecret(s))
+	}
+	return excerpt
+}
+
+// redactSecret keeps the first four characters of a long secret, enough
+// to tell which credential it was, and hides the rest.
+func redactSecret(secret string) string {
+	if utf8.RuneCountInString(secret) < 12 {
+		return "[REDACTED]"
+	}
+	return string([]rune(secret)[:4]) + "[REDACTED]"
+}
+
+var (
+	privateKeyPattern = regexp.MustCompile(`-----BEGIN ((?:[A-Z0-9]+ )*PRIVATE KEY)-----((?s:.*?))(?:-----END [A-Z0-9 ]*PRIVATE KEY-----|$)`)
+	awsKeyPattern     = regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)
+	bearerPattern     = regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9\-._~+/]{16,}=*)`)
+	tokenPattern      = regexp.MustCompile(`[A-Za-z0-9+/=_\-]{20,}`)
+	urlPattern        = regexp.MustCompile(`(?i)\b(?:(?:https?|ftp|file)://|(?:javascript|data|vbscript):)[^\s"'<>]*`)
+	hexPattern        = regexp.MustCompile(`^[0-9a-fA-F]+$`)
+)
+
+func checkPrivateKey(v LintValue) []LintMatch {
+	var matches []LintMatch
+	for _, m := range privateKeyPattern.FindAllStringSubmatch(v.Value, -1) {
+		matches = append(matches, LintMatch{Message: fmt.Sprintf("contains a private key (%s block)", m[1]), Secret: strings.TrimSpace(m[2])})
+	}
+	return matches
+}
+
+func checkAWSAccessKey(v LintValue) []LintMatch {
+	var matches []LintMatch
+	for _, key := range awsKeyPattern.FindAllString(v.Value, -1) {
+		matches = append(matches, LintMatch{Message: "contains an AWS access key ID", Secret: key})
+	}
+	return matches
+}
+
+func checkBearerToken(v LintValue) []LintMatch {
+	var matches []LintMatch
+	for _, m := range bearerPattern.FindAllStringSubmatch(v.Value, -1) {
+		matches = append(matches, LintMatch{Message: "contains a bearer token", Secret: m[1]})
+	}
+	return matches
+}
+
+// checkHighEntropy reports tokens random enough to be keys or passwords:
+// at least 20 characters mixing letters and digits, with more than 4 bits
+// of entropy per character, or 3 for hexadecimal strings of 32 or more.
+// Tokens within what the credential detectors report are skipped.
+func checkHighEntropy(v LintValue) []LintMatch {
+	var credentials []string
+	for _, check := range []func(LintValue) []LintMatch{checkPrivateKey, checkAWSAccessKey, checkBearerToken} {
+		for _, m := range check(v) {
+			credentials = append(credentials, m.Secret)
+		}
+	}
+	var matches []LintMatch
+	for _, token := range tokenPattern.FindAllString(v.Value, -1) {
+		if containedIn(token, credentials) {
+			continue
+		}
+		if !strings.ContainsAny(token, "0123456789") || !strings.ContainsAny(token, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ") {
+			continue
+		}
+		entropy := shannonEntropy(token)
+		threshold := 4.0
+		if hexPattern.MatchString(token) {
+			if len(token) < 32 {
+				continue
+			}
+			threshold = 3.0
+		}
+		if entropy > threshold {
+			matches = append(matches, LintMatch{
+				Message: fmt.Sprintf("contains a high-entropy string (%.1f bits per character) that may be a secret", entropy),
+				Secret:  token,
+			})
+		}
+	}
+	return matches
+}
+
+func containedIn(token string, secrets []string) bool {
+	for _, secret := range secrets {
+		if strings.Contains(secret, token) {
+			return true
+		}
+	}
+	return false
+}
+
+func shannonEntropy(s string) float64 {
+	counts := make(map[rune]int)
+	n := 0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+	entropy := 0.0
+	for _, c := range counts {
+		p := float64(c) / float64(n)
+		entropy -= p * math.Log2(p)
+	}
+	return entropy
+}
+
+// checkSuspiciousURL reports URLs in defaults that a client could be
+// led to by accepting the default: script and file schemes, plain HTTP,
+// embedded credentials, and IP address, internal or punycode hosts.
+func checkSuspiciousURL(v LintValue) []LintMatch {
+	if !v.InDefault {
+		return nil
+	}
+	var matches []LintMatch
+	for _, raw := range urlPattern.FindAllString(v.Value, -1) {
+		if m, ok := suspiciousURL(raw); ok {
+			matches = append(matches, m)
+		}
+	}
+	return matches
+}
+
+func suspiciousURL(raw string) (LintMatch, bool) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return LintMatch{Message: fmt.Sprintf("default contains a malformed URL: %v", err)}, true
+	}
+	scheme := strings.ToLower(u.Scheme)
+	switch scheme {
+	case "javascript", "data", "vbscript", "file":
+		return LintMatch{Message: fmt.Sprintf("default contains a %s: URL", scheme)}, true
+	}
+	if u.User != nil {
+		return LintMatch{Message: "default URL embeds credentials", Secret: u.User.String()}, true
+	}
+	host := strings.ToLower(u.Hostname())
+	switch {
+	case scheme != "https":
+		return LintMatch{Message: fmt.Sprintf("default URL uses %s instead of https", scheme)}, true
+	case net.ParseIP(host) != nil:
+		return LintMatch{Message: "default URL points at an IP address"}, true
+	case host == "localhost" || strings.HasSuffix(host, ".localhost") || strings.HasSuffix(host, ".local") || strings.HasSuffix(host, ".internal"):
+		return LintMatch{Message: "default URL points at an internal host"}, true
+	case strings.HasPrefix(host, "xn--") || strings.Contains(host, ".xn--"):
+		return LintMatch{Message: "default URL has a punycode host, which may imitate another domain"}, true
+	}
+	return LintMatch{}, false
+}
+
+func checkLongDescription(v LintValue) []LintMatch {
+	if v.Key != "description" {
+		return nil
+	}
+	if n := utf8.RuneCountInString(v.Value); n > MaxLintDescriptionLength {
+		return []LintMatch{{Message: fmt.Sprintf("description is %d characters long (limit %d); check it for injected instructions", n, MaxLintDescriptionLength)}}
+	}
+	return nil
+}
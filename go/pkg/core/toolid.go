@@ -0,0 +1,34 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrToolNameMissing is returned by DeriveToolID for a schema without a
+// usable name field.
+var ErrToolNameMissing = errors.New("schema has no name to derive a tool ID from")
+
+// DeriveToolID returns the canonical tool ID for a schema served by domain,
+// "<domain>/<name>", so that callers without an ID of their own pin the same
+// tool under the same key. The domain is reduced to its identity with
+// NormalizeDomain, which keeps a tenant's path prefix, so tools of two
+// tenants on one host derive different IDs. The schema's name field is
+// trimmed, lower-cased and has each run of whitespace collapsed to a single
+// space: "Example.com" and " Web  Search" derive "example.com/web search".
+func DeriveToolID(domain string, schema map[string]interface{}) (string, error) {
+	if strings.TrimSpace(domain) == "" {
+		return "", fmt.Errorf("cannot derive a tool ID without a domain")
+	}
+	identity, err := NormalizeDomain(domain)
+	if err != nil {
+		return "", err
+	}
+	name, _ := schema["name"].(string)
+	name = strings.ToLower(strings.Join(strings.Fields(name), " "))
+	if name == "" {
+		return "", ErrToolNameMissing
+	}
+	return identity + "/" + name, nil
+}
@@ -0,0 +1,49 @@
+package core
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDeriveToolID(t *testing.T) {
+	tests := []struct {
+		name     string
+		domain   string
+		schema   map[string]interface{}
+		expected string
+	}{
+		{"plain", "example.com", map[string]interface{}{"name": "search"}, "example.com/search"},
+		{"lower-cased", "Example.COM", map[string]interface{}{"name": "WebSearch"}, "example.com/websearch"},
+		{"whitespace collapsed", " example.com ", map[string]interface{}{"name": "  Web \t Search\n"}, "example.com/web search"},
+		{"domain as URL", "https://example.com:8443/", map[string]interface{}{"name": "search"}, "example.com/search"},
+		{"tenant prefix", "https://Platform.Example/tenants/acme/", map[string]interface{}{"name": "search"}, "platform.example/tenants/acme/search"},
+		{"trailing dot", "example.com.", map[string]interface{}{"name": "search"}, "example.com/search"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			toolID, err := DeriveToolID(tt.domain, tt.schema)
+			if err != nil {
+				t.Fatalf("DeriveToolID failed: %v", err)
+			}
+			if toolID != tt.expected {
+				t.Errorf("DeriveToolID = %q, want %q", toolID, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDeriveToolIDErrors(t *testing.T) {
+	for _, schema := range []map[string]interface{}{
+		nil,
+		{"description": "no name"},
+		{"name": "   "},
+		{"name": 42},
+	} {
+		if _, err := DeriveToolID("example.com", schema); !errors.Is(err, ErrToolNameMissing) {
+			t.Errorf("Expected ErrToolNameMissing for %v, got %v", schema, err)
+		}
+	}
+	if _, err := DeriveToolID("", map[string]interface{}{"name": "search"}); err == nil {
+		t.Error("Expected an error without a domain")
+	}
+}
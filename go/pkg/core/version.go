@@ -0,0 +1,69 @@
+package core
+
+import "fmt"
+
+// Signature format versions carried in the schemapin_version field of signed
+// documents (signed schemas and skill signatures). Sign, verify and skill
+// code share these constants so that producers and consumers agree on which
+// rules a document was written under.
+const (
+	SchemapinVersion10 = "1.0"
+	SchemapinVersion11 = "1.1"
+	SchemapinVersion12 = "1.2"
+	SchemapinVersion13 = "1.3"
+	SchemapinVersion14 = "1.4"
+
+	// CurrentSchemapinVersion is the version stamped on newly signed schema
+	// documents.
+	CurrentSchemapinVersion = SchemapinVersion14
+)
+
+// VersionRules describes how documents of a given schemapin_version are
+// canonicalized and verified.
+type VersionRules struct {
+	// Version is the schemapin_version these rules apply to. It is empty for
+	// legacy documents that carry no version field.
+	Version string
+	// Canonicalization is the algorithm used to produce the signing input.
+	Canonicalization string
+}
+
+// versionRules is the compatibility matrix of every version this
+// implementation can verify. Documents without a version use the legacy
+// (v1.0) rules.
+var versionRules = map[string]VersionRules{
+	"":                 {Version: "", Canonicalization: CanonicalizationV1},
+	SchemapinVersion10: {Version: SchemapinVersion10, Canonicalization: CanonicalizationV1},
+	SchemapinVersion11: {Version: SchemapinVersion11, Canonicalization: CanonicalizationV1},
+	SchemapinVersion12: {Version: SchemapinVersion12, Canonicalization: CanonicalizationV1},
+	SchemapinVersion13: {Version: SchemapinVersion13, Canonicalization: CanonicalizationV1},
+	SchemapinVersion14: {Version: SchemapinVersion14, Canonicalization: CanonicalizationV1},
+}
+
+// UnsupportedVersionError is returned for documents whose schemapin_version
+// is not in the compatibility matrix, typically because they were produced
+// by a newer signer.
+type UnsupportedVersionError struct {
+	Version string
+}
+
+func (e *UnsupportedVersionError) Error() string {
+	return fmt.Sprintf("unsupported schemapin_version %q (this verifier supports up to %s)", e.Version, CurrentSchemapinVersion)
+}
+
+// RulesForVersion returns the verification rules for version. An empty
+// version selects the legacy rules; unknown versions return an
+// *UnsupportedVersionError.
+func RulesForVersion(version string) (VersionRules, error) {
+	rules, ok := versionRules[version]
+	if !ok {
+		return VersionRules{}, &UnsupportedVersionError{Version: version}
+	}
+	return rules, nil
+}
+
+// CanonicalizeAndHashForVersion hashes schema using the canonicalization
+// rules of the given schemapin_version.
+func (s *SchemaPinCore) CanonicalizeAndHashForVersion(schema map[string]interface{}, version string) ([]byte, error) {
+	return s.CanonicalizeAndHashForSignature(schema, version, "")
+}
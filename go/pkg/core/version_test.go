@@ -0,0 +1,101 @@
+package core
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// signedDocument mirrors the signed schema JSON written by schemapin-sign.
+type signedDocument struct {
+	SchemapinVersion string                 `json:"schemapin_version,omitempty"`
+	Schema           map[string]interface{} `json:"schema"`
+	Signature        []byte                 `json:"signature"`
+}
+
+func TestRulesForVersion(t *testing.T) {
+	for _, version := range []string{"", SchemapinVersion10, SchemapinVersion12, SchemapinVersion13, CurrentSchemapinVersion} {
+		rules, err := RulesForVersion(version)
+		if err != nil {
+			t.Errorf("RulesForVersion(%q) error = %v", version, err)
+			continue
+		}
+		if rules.Version != version || rules.Canonicalization != CanonicalizationV1 {
+			t.Errorf("RulesForVersion(%q) = %+v", version, rules)
+		}
+	}
+
+	for _, version := range []string{"2.0", "1.5", "v1.4", "latest"} {
+		_, err := RulesForVersion(version)
+		var unsupported *UnsupportedVersionError
+		if !errors.As(err, &unsupported) {
+			t.Errorf("RulesForVersion(%q) expected UnsupportedVersionError, got %v", version, err)
+			continue
+		}
+		if unsupported.Version != version {
+			t.Errorf("UnsupportedVersionError.Version = %q, want %q", unsupported.Version, version)
+		}
+	}
+}
+
+func TestVersionedDocuments(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	c := NewSchemaPinCore()
+	schema := map[string]interface{}{"name": "calculator", "type": "object"}
+
+	// Legacy documents carry no schemapin_version but were signed over the
+	// same canonical form.
+	legacyHash, err := c.CanonicalizeAndHash(schema)
+	if err != nil {
+		t.Fatalf("CanonicalizeAndHash failed: %v", err)
+	}
+	signature, err := ecdsa.SignASN1(rand.Reader, key, legacyHash)
+	if err != nil {
+		t.Fatalf("SignASN1 failed: %v", err)
+	}
+	legacy, _ := json.Marshal(signedDocument{Schema: schema, Signature: signature})
+
+	future := []byte(`{"schemapin_version":"9.0","schema":{"name":"calculator","type":"object"},"signature":"AAAA"}`)
+
+	tests := []struct {
+		name        string
+		data        []byte
+		wantVersion string
+	}{
+		{"legacy", legacy, ""},
+		{"future", future, "9.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var doc signedDocument
+			if err := json.Unmarshal(tt.data, &doc); err != nil {
+				t.Fatalf("Unmarshal failed: %v", err)
+			}
+
+			hash, err := c.CanonicalizeAndHashForVersion(doc.Schema, doc.SchemapinVersion)
+			if tt.wantVersion != "" {
+				var unsupported *UnsupportedVersionError
+				if !errors.As(err, &unsupported) || unsupported.Version != tt.wantVersion {
+					t.Fatalf("expected UnsupportedVersionError for %q, got %v", tt.wantVersion, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("CanonicalizeAndHashForVersion failed: %v", err)
+			}
+			if !ecdsa.VerifyASN1(&key.PublicKey, hash, doc.Signature) {
+				t.Error("legacy document should verify under the legacy rules")
+			}
+			if want := sha256.Sum256([]byte(`{"name":"calculator","type":"object"}`)); string(hash) != string(want[:]) {
+				t.Errorf("legacy hash = %x, want %x", hash, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package core
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxYAMLNodes bounds the number of nodes produced while expanding aliases,
+// so that nested alias chains cannot blow up memory.
+const maxYAMLNodes = 1 << 20
+
+// YAMLError reports YAML input that has no equivalent in the JSON data model.
+type YAMLError struct {
+	Line    int
+	Message string
+}
+
+func (e *YAMLError) Error() string {
+	return fmt.Sprintf("yaml line %d: %s", e.Line, e.Message)
+}
+
+// ParseYAMLSchema parses a single YAML document into the same data model
+// json.Unmarshal produces (map[string]interface{}, []interface{}, string,
+// float64, bool, nil), so that a schema authored in YAML canonicalizes,
+// hashes and signs exactly like its JSON equivalent. Anchors, aliases and
+// merge keys are expanded. Non-string mapping keys, duplicate keys, custom
+// tags, binary values and non-finite numbers are rejected.
+func ParseYAMLSchema(data []byte) (map[string]interface{}, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+
+	var doc yaml.Node
+	if err := decoder.Decode(&doc); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("empty YAML document")
+		}
+		return nil, fmt.Errorf("failed to parse YAML: %w", err)
+	}
+	var extra yaml.Node
+	if err := decoder.Decode(&extra); !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("expected a single YAML document")
+	}
+
+	c := &yamlConverter{}
+	value, err := c.convert(&doc)
+	if err != nil {
+		return nil, err
+	}
+	schema, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, &YAMLError{Line: doc.Line, Message: "top-level value must be a mapping"}
+	}
+	return schema, nil
+}
+
+// CanonicalizeYAML parses a YAML schema with ParseYAMLSchema and returns its
+// canonical JSON form.
+func CanonicalizeYAML(data []byte) (string, error) {
+	schema, err := ParseYAMLSchema(data)
+	if err != nil {
+		return "", err
+	}
+	return NewSchemaPinCore().CanonicalizeSchema(schema)
+}
+
+type yamlConverter struct {
+	nodes int
+}
+
+func (c *yamlConverter) convert(n *yaml.Node) (interface{}, error) {
+	c.nodes++
+	if c.nodes > maxYAMLNodes {
+		return nil, &YAMLError{Line: n.Line, Message: "document expands to too many nodes"}
+	}
+
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) == 0 {
+			return nil, nil
+		}
+		return c.convert(n.Content[0])
+	case yaml.AliasNode:
+		return c.convert(n.Alias)
+	case yaml.MappingNode:
+		if tag := n.ShortTag(); tag != "!!map" {
+			return nil, &YAMLError{Line: n.Line, Message: fmt.Sprintf("unsupported tag %s", tag)}
+		}
+		return c.convertMapping(n)
+	case yaml.SequenceNode:
+		if tag := n.ShortTag(); tag != "!!seq" {
+			return nil, &YAMLError{Line: n.Line, Message: fmt.Sprintf("unsupported tag %s", tag)}
+		}
+		items := make([]interface{}, 0, len(n.Content))
+		for _, item := range n.Content {
+			value, err := c.convert(item)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, value)
+		}
+		return items, nil
+	case yaml.ScalarNode:
+		return convertYAMLScalar(n)
+	default:
+		return nil, &YAMLError{Line: n.Line, Message: "unsupported YAML node"}
+	}
+}
+
+func (c *yamlConverter) convertMapping(n *yaml.Node) (map[string]interface{}, error) {
+	result := make(map[string]interface{}, len(n.Content)/2)
+	var merges []*yaml.Node
+
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		keyNode, valueNode := n.Content[i], n.Content[i+1]
+		if keyNode.Kind == yaml.AliasNode {
+			keyNode = keyNode.Alias
+		}
+		if keyNode.Kind == yaml.ScalarNode && keyNode.ShortTag() == "!!merge" {
+			merges = append(merges, valueNode)
+			continue
+		}
+		if keyNode.Kind != yaml.ScalarNode || keyNode.ShortTag() != "!!str" {
+			return nil, &YAMLError{Line: keyNode.Line, Message: fmt.Sprintf("mapping key must be a string, got %s", keyNode.ShortTag())}
+		}
+		if _, exists := result[keyNode.Value]; exists {
+			return nil, &YAMLError{Line: keyNode.Line, Message: fmt.Sprintf("duplicate mapping key %q", keyNode.Value)}
+		}
+
+		value, err := c.convert(valueNode)
+		if err != nil {
+			return nil, err
+		}
+		result[keyNode.Value] = value
+	}
+
+	// Merged keys never override keys set explicitly; in a merge sequence
+	// earlier mappings take precedence over later ones.
+	for _, merge := range merges {
+		sources := []*yaml.Node{merge}
+		if resolved := resolveAlias(merge); resolved.Kind == yaml.SequenceNode {
+			sources = resolved.Content
+		}
+		for _, source := range sources {
+			if resolveAlias(source).Kind != yaml.MappingNode {
+				return nil, &YAMLError{Line: source.Line, Message: "merge key value must be a mapping or sequence of mappings"}
+			}
+			value, err := c.convert(source)
+			if err != nil {
+				return nil, err
+			}
+			for key, item := range value.(map[string]interface{}) {
+				if _, exists := result[key]; !exists {
+					result[key] = item
+				}
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func resolveAlias(n *yaml.Node) *yaml.Node {
+	for n.Kind == yaml.AliasNode {
+		n = n.Alias
+	}
+	return n
+}
+
+func convertYAMLScalar(n *yaml.Node) (interface{}, error) {
+	switch tag := n.ShortTag(); tag {
+	case "!!str", "!!timestamp":
+		// Timestamps stay in their literal form, as a JSON string would.
+		return n.Value, nil
+	case "!!null":
+		return nil, nil
+	case "!!bool":
+		var b bool
+		if err := n.Decode(&b); err != nil {
+			return nil, &YAMLError{Line: n.Line, Message: err.Error()}
+		}
+		return b, nil
+	case "!!int", "!!float":
+		// Numbers use float64 like encoding/json, so 1 and 1.0 canonicalize
+		// identically in YAML and JSON input.
+		var f float64
+		if err := n.Decode(&f); err != nil {
+			return nil, &YAMLError{Line: n.Line, Message: fmt.Sprintf("invalid number %q", n.Value)}
+		}
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			return nil, &YAMLError{Line: n.Line, Message: fmt.Sprintf("number %q has no JSON representation", n.Value)}
+		}
+		return f, nil
+	default:
+		return nil, &YAMLError{Line: n.Line, Message: fmt.Sprintf("unsupported tag %s", tag)}
+	}
+}
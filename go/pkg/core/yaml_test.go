@@ -0,0 +1,124 @@
+package core
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestCanonicalizeYAMLMatchesJSON(t *testing.T) {
+	yamlInput := `
+type: object
+description: "Search tool"
+properties:
+  limit:
+    type: integer
+    default: 10
+    maximum: 1.0e2
+  query: {type: string, minLength: 1}
+required: [query]
+additionalProperties: false
+nullable: ~
+`
+	jsonInput := `{"type":"object","description":"Search tool","properties":{"limit":{"type":"integer","default":10,"maximum":100},"query":{"type":"string","minLength":1}},"required":["query"],"additionalProperties":false,"nullable":null}`
+
+	var schema map[string]interface{}
+	if err := json.Unmarshal([]byte(jsonInput), &schema); err != nil {
+		t.Fatal(err)
+	}
+	expected, err := NewSchemaPinCore().CanonicalizeSchema(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := CanonicalizeYAML([]byte(yamlInput))
+	if err != nil {
+		t.Fatalf("CanonicalizeYAML failed: %v", err)
+	}
+	if got != expected {
+		t.Errorf("YAML and JSON canonical forms differ:\n yaml: %s\n json: %s", got, expected)
+	}
+}
+
+func TestCanonicalizeYAMLAnchorsAndMerge(t *testing.T) {
+	input := `
+definitions:
+  base: &base
+    type: string
+    maxLength: 64
+  name: *base
+  label:
+    <<: *base
+    maxLength: 32
+  combined:
+    <<: [{a: 1}, {a: 2, b: 2}]
+`
+	got, err := CanonicalizeYAML([]byte(input))
+	if err != nil {
+		t.Fatalf("CanonicalizeYAML failed: %v", err)
+	}
+	expected := `{"definitions":{"base":{"maxLength":64,"type":"string"},"combined":{"a":1,"b":2},"label":{"maxLength":32,"type":"string"},"name":{"maxLength":64,"type":"string"}}}`
+	if got != expected {
+		t.Errorf("got %s\nwant %s", got, expected)
+	}
+}
+
+func TestCanonicalizeYAMLNumbers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"v: 1", `{"v":1}`},
+		{"v: 1.0", `{"v":1}`},
+		{"v: -0.5", `{"v":-0.5}`},
+		{"v: 0x1F", `{"v":31}`},
+		{"v: 1e21", `{"v":1e+21}`},
+		{"v: 0.0000001", `{"v":1e-7}`},
+		{"v: '1.0'", `{"v":"1.0"}`},
+		{"v: !!str 10", `{"v":"10"}`},
+		{"v: 2001-12-14", `{"v":"2001-12-14"}`},
+		{"v: yes", `{"v":"yes"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := CanonicalizeYAML([]byte(tt.input))
+			if err != nil {
+				t.Fatalf("CanonicalizeYAML failed: %v", err)
+			}
+			if got != tt.expected {
+				t.Errorf("got %s, want %s", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCanonicalizeYAMLRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr string
+	}{
+		{"integer key", "1: one", "mapping key must be a string"},
+		{"boolean key", "true: yes", "mapping key must be a string"},
+		{"complex key", "? [a, b]\n: value", "mapping key must be a string"},
+		{"custom tag", "v: !secret value", "unsupported tag !secret"},
+		{"custom mapping tag", "v: !thing {a: 1}", "unsupported tag !thing"},
+		{"binary", "v: !!binary aGVsbG8=", "unsupported tag !!binary"},
+		{"infinity", "v: .inf", "no JSON representation"},
+		{"nan", "v: .nan", "no JSON representation"},
+		{"duplicate key", "a: 1\na: 2", "duplicate mapping key"},
+		{"sequence root", "- a\n- b", "top-level value must be a mapping"},
+		{"multiple documents", "a: 1\n---\nb: 2", "single YAML document"},
+		{"empty", "", "empty YAML document"},
+		{"bad merge", "a:\n  <<: 5", "merge key value"},
+		{"syntax", "a: [1, 2", "failed to parse YAML"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := CanonicalizeYAML([]byte(tt.input))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package crypto
+
+import (
+	"crypto/subtle"
+	"strings"
+)
+
+// NormalizeFingerprint returns fingerprint in the form CalculateKeyFingerprint
+// produces: without surrounding whitespace and in lower case.
+func NormalizeFingerprint(fingerprint string) string {
+	return strings.ToLower(strings.TrimSpace(fingerprint))
+}
+
+// FingerprintEqual reports whether two key fingerprints or signer kids name
+// the same key, after NormalizeFingerprint. The comparison takes the same
+// time wherever the fingerprints differ, so timing it does not reveal a
+// prefix of a pinned or revoked fingerprint. Fingerprints of different
+// lengths compare unequal at once; their length is not secret.
+func FingerprintEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(NormalizeFingerprint(a)), []byte(NormalizeFingerprint(b))) == 1
+}
+
+// PublicKeyPEMEqual reports whether two PEM-encoded public keys are the same
+// text, in constant time like FingerprintEqual. Different encodings of one
+// key compare unequal; compare their fingerprints to match those.
+func PublicKeyPEMEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
@@ -0,0 +1,118 @@
+package crypto
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFingerprintEqual(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want bool
+	}{
+		{"equal", seededFingerprint, seededFingerprint, true},
+		{"case and whitespace", seededFingerprint, " " + strings.ToUpper(seededFingerprint) + "\n", true},
+		{"last digit differs", seededFingerprint, seededFingerprint[:len(seededFingerprint)-1] + "4", false},
+		{"first digit differs", seededFingerprint, "sha256:3" + seededFingerprint[8:], false},
+		{"prefix", seededFingerprint, seededFingerprint[:20], false},
+		{"longer", seededFingerprint, seededFingerprint + "00", false},
+		{"empty", seededFingerprint, "", false},
+		{"both empty", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FingerprintEqual(tt.a, tt.b); got != tt.want {
+				t.Errorf("FingerprintEqual(%q, %q) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+			if got := FingerprintEqual(tt.b, tt.a); got != tt.want {
+				t.Errorf("FingerprintEqual(%q, %q) = %v, want %v", tt.b, tt.a, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPublicKeyPEMEqual(t *testing.T) {
+	keyManager := NewKeyManager()
+	privateKey, err := keyManager.GenerateKeypair()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	publicKeyPEM, err := keyManager.ExportPublicKeyPEM(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatalf("Failed to export key: %v", err)
+	}
+
+	if !PublicKeyPEMEqual(publicKeyPEM, publicKeyPEM) {
+		t.Error("Expected a PEM to equal itself")
+	}
+	if PublicKeyPEMEqual(publicKeyPEM, strings.TrimSpace(publicKeyPEM)) || PublicKeyPEMEqual(publicKeyPEM, "") {
+		t.Error("Expected PEMs of different lengths to differ")
+	}
+	if PublicKeyPEMEqual(publicKeyPEM, strings.ToLower(publicKeyPEM)) {
+		t.Error("Expected PEMs of the same length but other text to differ")
+	}
+}
+
+// securityPackages compare fingerprints, signer kids and pinned keys
+// attackers can present, so they must use FingerprintEqual and
+// PublicKeyPEMEqual.
+var securityPackages = []string{"bundle", "discovery", "dns", "doctor", "pinning", "revocation", "skill", "utils", "verification"}
+
+// TestNoRawFingerprintComparisons fails on ==, != and strings.EqualFold
+// between fingerprints, kids or PEMs in securityPackages. Comparisons
+// with a string literal, e.g. checks for "", are allowed.
+func TestNoRawFingerprintComparisons(t *testing.T) {
+	sensitive := func(expr ast.Expr) bool {
+		var name string
+		switch e := expr.(type) {
+		case *ast.Ident:
+			name = e.Name
+		case *ast.SelectorExpr:
+			name = e.Sel.Name
+		default:
+			return false
+		}
+		name = strings.ToLower(name)
+		return strings.Contains(name, "fingerprint") || strings.Contains(name, "pem") ||
+			strings.HasSuffix(name, "kid") || name == "pinned" || name == "revoked" || name == "existingkey" || name == "revokedkey"
+	}
+	literal := func(expr ast.Expr) bool {
+		_, ok := expr.(*ast.BasicLit)
+		return ok
+	}
+
+	fset := token.NewFileSet()
+	for _, pkg := range securityPackages {
+		files, err := filepath.Glob(filepath.Join("..", pkg, "*.go"))
+		if err != nil || len(files) == 0 {
+			t.Fatalf("Failed to list package %s: %v", pkg, err)
+		}
+		for _, path := range files {
+			if strings.HasSuffix(path, "_test.go") {
+				continue
+			}
+			file, err := parser.ParseFile(fset, path, nil, 0)
+			if err != nil {
+				t.Fatalf("Failed to parse %s: %v", path, err)
+			}
+			ast.Inspect(file, func(n ast.Node) bool {
+				switch n := n.(type) {
+				case *ast.BinaryExpr:
+					if (n.Op == token.EQL || n.Op == token.NEQ) && !literal(n.X) && !literal(n.Y) && (sensitive(n.X) || sensitive(n.Y)) {
+						t.Errorf("%s: compare with crypto.FingerprintEqual or crypto.PublicKeyPEMEqual instead of %s", fset.Position(n.Pos()), n.Op)
+					}
+				case *ast.CallExpr:
+					if sel, ok := n.Fun.(*ast.SelectorExpr); ok && sel.Sel.Name == "EqualFold" && len(n.Args) == 2 && (sensitive(n.Args[0]) || sensitive(n.Args[1])) {
+						t.Errorf("%s: compare with crypto.FingerprintEqual instead of strings.EqualFold", fset.Position(n.Pos()))
+					}
+				}
+				return true
+			})
+		}
+	}
+}
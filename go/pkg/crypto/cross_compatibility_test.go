@@ -1,8 +1,12 @@
 package crypto
 
 import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/json"
 	"strings"
 	"testing"
 
@@ -226,6 +230,26 @@ func TestKnownTestVectors(t *testing.T) {
 					break
 				}
 			}
+
+			// The streaming encoder must match the json.Marshal output
+			legacy, err := json.Marshal(tv.schema)
+			if err != nil {
+				t.Fatalf("json.Marshal() error = %v", err)
+			}
+			var streamed bytes.Buffer
+			if err := schemaPinCore.CanonicalizeToWriter(tv.schema, &streamed); err != nil {
+				t.Fatalf("CanonicalizeToWriter() error = %v", err)
+			}
+			if streamed.String() != string(legacy) || canonical != string(legacy) {
+				t.Errorf("Test vector %s differs from json.Marshal output %s", tv.name, legacy)
+			}
+			hash, err := schemaPinCore.CanonicalizeAndHash(tv.schema)
+			if err != nil {
+				t.Fatalf("CanonicalizeAndHash() error = %v", err)
+			}
+			if !bytes.Equal(hash, hash1) {
+				t.Errorf("CanonicalizeAndHash() differs from HashCanonical for test vector %s", tv.name)
+			}
 		})
 	}
 }
@@ -295,3 +319,49 @@ func TestEdgeCases(t *testing.T) {
 		})
 	}
 }
+
+// TestSignatureMessageConvention checks that SignHash signs the hash as an
+// ECDSA-with-SHA256 message, as the Python, JavaScript and Rust
+// implementations do, and that signatures over the raw hash made by earlier
+// Go releases still verify.
+func TestSignatureMessageConvention(t *testing.T) {
+	km := NewKeyManager()
+	sm := NewSignatureManager()
+	privateKey, err := km.GenerateKeypairFromSeed([]byte("signature-message-convention"), ForTesting)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := sha256.Sum256([]byte("canonical schema"))
+
+	signature, err := sm.SignHash(hash[:], privateKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest := sha256.Sum256(hash[:])
+	if !ecdsa.VerifyASN1(&privateKey.PublicKey, digest[:], der) {
+		t.Error("expected SignHash to sign SHA-256 of the hash")
+	}
+
+	legacy, err := ecdsa.SignASN1(rand.Reader, privateKey, hash[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacyB64 := base64.StdEncoding.EncodeToString(legacy)
+	if sm.VerifySignature(hash[:], legacyB64, &privateKey.PublicKey) {
+		t.Error("expected VerifySignature to reject a legacy signature over the raw hash")
+	}
+	if !sm.VerifyLegacySignature(hash[:], legacyB64, &privateKey.PublicKey) {
+		t.Error("expected VerifyLegacySignature to accept a legacy signature over the raw hash")
+	}
+	if sm.VerifyLegacySignature(hash[:], signature, &privateKey.PublicKey) {
+		t.Error("expected VerifyLegacySignature to reject a current signature")
+	}
+	other := sha256.Sum256([]byte("other schema"))
+	if sm.VerifyLegacySignature(other[:], legacyB64, &privateKey.PublicKey) {
+		t.Error("expected a legacy signature not to verify another hash")
+	}
+}
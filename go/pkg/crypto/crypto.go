@@ -63,10 +63,13 @@ func (k *KeyManager) ExportPublicKeyPEM(key *ecdsa.PublicKey) (string, error) {
 
 // LoadPrivateKeyPEM loads private key from PEM format
 func (k *KeyManager) LoadPrivateKeyPEM(pemData string) (*ecdsa.PrivateKey, error) {
-	block, _ := pem.Decode([]byte(pemData))
+	block, _ := pem.Decode(normalizePEM(pemData))
 	if block == nil {
 		return nil, fmt.Errorf("failed to decode PEM block")
 	}
+	if IsEncryptedPrivateKeyPEM(pemData) {
+		return nil, ErrPassphraseRequired
+	}
 
 	// Try PKCS#8 format first (preferred)
 	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
@@ -85,28 +88,27 @@ func (k *KeyManager) LoadPrivateKeyPEM(pemData string) (*ecdsa.PrivateKey, error
 	return key, nil
 }
 
-// LoadPublicKeyPEM loads public key from PEM format
+// LoadPublicKeyPEM loads a P-256 public key from PEM format. Line endings
+// and whitespace around lines are normalized first. Explicit curve
+// parameters equal to P-256 and compressed points are accepted; keys on
+// other curves fail with ErrUnsupportedCurve.
 func (k *KeyManager) LoadPublicKeyPEM(pemData string) (*ecdsa.PublicKey, error) {
-	block, _ := pem.Decode([]byte(pemData))
+	block, _ := pem.Decode(normalizePEM(pemData))
 	if block == nil {
 		return nil, fmt.Errorf("failed to decode PEM block")
 	}
-
-	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse public key: %w", err)
-	}
-
-	ecdsaKey, ok := pub.(*ecdsa.PublicKey)
-	if !ok {
-		return nil, fmt.Errorf("not an ECDSA public key")
-	}
-
-	return ecdsaKey, nil
+	return parsePublicKeyDER(block.Bytes)
 }
 
-// CalculateKeyFingerprint computes SHA-256 fingerprint of public key
+// CalculateKeyFingerprint computes the SHA-256 fingerprint of a public key
+// as "sha256:<hex>". The key is always re-encoded as a DER
+// SubjectPublicKeyInfo with the P-256 named curve OID and an uncompressed
+// point, the form Python's public_bytes(DER, SubjectPublicKeyInfo)
+// produces, so every encoding of the same key has the same fingerprint.
 func (k *KeyManager) CalculateKeyFingerprint(key *ecdsa.PublicKey) (string, error) {
+	if key == nil || key.Curve != elliptic.P256() {
+		return "", ErrUnsupportedCurve
+	}
 	keyBytes, err := x509.MarshalPKIXPublicKey(key)
 	if err != nil {
 		return "", fmt.Errorf("failed to marshal public key for fingerprint: %w", err)
@@ -138,9 +140,15 @@ type ecdsaSignature struct {
 	R, S *big.Int
 }
 
-// SignHash signs a hash with the private key and returns base64-encoded signature
+// SignHash signs a hash with the private key and returns base64-encoded signature.
+//
+// The hash is the message of an ECDSA-with-SHA256 signature, so the curve
+// operation runs over SHA-256(hashBytes). This matches the Python,
+// JavaScript and Rust implementations, which sign the hash bytes with
+// ECDSA(SHA256).
 func (s *SignatureManager) SignHash(hashBytes []byte, privateKey *ecdsa.PrivateKey) (string, error) {
-	r, sig, err := ecdsa.Sign(rand.Reader, privateKey, hashBytes)
+	digest := sha256.Sum256(hashBytes)
+	r, sig, err := ecdsa.Sign(rand.Reader, privateKey, digest[:])
 	if err != nil {
 		return "", fmt.Errorf("failed to sign hash: %w", err)
 	}
@@ -155,22 +163,47 @@ func (s *SignatureManager) SignHash(hashBytes []byte, privateKey *ecdsa.PrivateK
 	return base64.StdEncoding.EncodeToString(derBytes), nil
 }
 
-// VerifySignature verifies a base64-encoded signature against a hash
+// VerifySignature verifies a base64-encoded signature against a hash.
+//
+// Signatures made by SignHash and the other implementations are over
+// SHA-256(hashBytes). Earlier Go releases signed hashBytes directly; those
+// signatures are rejected here and can only be checked, by callers that
+// explicitly opt in, with VerifyLegacySignature.
 func (s *SignatureManager) VerifySignature(hashBytes []byte, signatureB64 string, publicKey *ecdsa.PublicKey) bool {
-	signature, err := base64.StdEncoding.DecodeString(signatureB64)
-	if err != nil {
+	sig, ok := decodeSignature(signatureB64)
+	if !ok {
 		return false
 	}
+	digest := sha256.Sum256(hashBytes)
+	return ecdsa.Verify(publicKey, digest[:], sig.R, sig.S)
+}
 
-	// Decode ASN.1 DER signature
-	var sig ecdsaSignature
-	if _, err := asn1.Unmarshal(signature, &sig); err != nil {
+// VerifyLegacySignature verifies a signature made by Go releases before
+// v1.4, which used hashBytes itself rather than SHA-256(hashBytes) as the
+// ECDSA message. It accepts only that form. A signature that verifies only
+// this way is a downgrade from the current scheme, which callers should
+// report, e.g. as a warning, and re-sign.
+func (s *SignatureManager) VerifyLegacySignature(hashBytes []byte, signatureB64 string, publicKey *ecdsa.PublicKey) bool {
+	sig, ok := decodeSignature(signatureB64)
+	if !ok {
 		return false
 	}
-
 	return ecdsa.Verify(publicKey, hashBytes, sig.R, sig.S)
 }
 
+// decodeSignature decodes a base64 ASN.1 DER ECDSA signature.
+func decodeSignature(signatureB64 string) (ecdsaSignature, bool) {
+	var sig ecdsaSignature
+	signature, err := base64.StdEncoding.DecodeString(signatureB64)
+	if err != nil {
+		return sig, false
+	}
+	if _, err := asn1.Unmarshal(signature, &sig); err != nil {
+		return sig, false
+	}
+	return sig, sig.R != nil && sig.S != nil
+}
+
 // SignSchemaHash signs a schema hash (convenience method)
 func (s *SignatureManager) SignSchemaHash(schemaHash []byte, privateKey *ecdsa.PrivateKey) (string, error) {
 	return s.SignHash(schemaHash, privateKey)
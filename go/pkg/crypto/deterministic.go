@@ -0,0 +1,98 @@
+package crypto
+
+import (
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// DeterministicKeyOption acknowledges that a key derived from a seed is not
+// suitable for production use.
+type DeterministicKeyOption int
+
+// ForTesting must be passed to GenerateKeypairFromSeed. Seeded keys are as
+// secret as their seed, and seeds in test code are public: use them only for
+// reproducible fixtures, golden files and demos.
+const ForTesting DeterministicKeyOption = 1
+
+// ErrDeterministicKeyNotAllowed is returned by GenerateKeypairFromSeed when
+// the ForTesting option is missing.
+var ErrDeterministicKeyNotAllowed = errors.New("deterministic key generation is insecure and requires the crypto.ForTesting option")
+
+// Fixed HKDF parameters for seeded key derivation. Changing them changes
+// every seeded key, so they are part of the fixture format.
+var (
+	seedHKDFSalt = []byte("schemapin-insecure-deterministic-keygen")
+	seedHKDFInfo = []byte("schemapin P-256 private scalar v1")
+)
+
+// GenerateKeypairFromSeed derives an ECDSA P-256 key pair from seed, so that
+// the same seed always yields the same key and fingerprint. The private
+// scalar is HKDF-SHA256(seed) reduced into [1, n-1] as in FIPS 186-4 B.4.1.
+//
+// INSECURE: anyone who knows the seed knows the private key. The call fails
+// unless ForTesting is passed. Signatures made with the key are still
+// randomized.
+func (k *KeyManager) GenerateKeypairFromSeed(seed []byte, opts ...DeterministicKeyOption) (*ecdsa.PrivateKey, error) {
+	allowed := false
+	for _, opt := range opts {
+		if opt == ForTesting {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return nil, ErrDeterministicKeyNotAllowed
+	}
+	if len(seed) == 0 {
+		return nil, fmt.Errorf("seed must not be empty")
+	}
+
+	curve := elliptic.P256()
+	n := curve.Params().N
+
+	// 64 extra bits beyond the order keep the modular bias negligible.
+	okm := hkdfSHA256(seed, seedHKDFSalt, seedHKDFInfo, (n.BitLen()+64+7)/8)
+	d := new(big.Int).SetBytes(okm)
+	d.Mod(d, new(big.Int).Sub(n, big.NewInt(1)))
+	d.Add(d, big.NewInt(1))
+
+	scalar := d.FillBytes(make([]byte, 32))
+	ecdhKey, err := ecdh.P256().NewPrivateKey(scalar)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive ECDSA key pair: %w", err)
+	}
+	// Uncompressed point: 0x04 || X || Y
+	point := ecdhKey.PublicKey().Bytes()
+
+	return &ecdsa.PrivateKey{
+		PublicKey: ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(point[1:33]),
+			Y:     new(big.Int).SetBytes(point[33:]),
+		},
+		D: d,
+	}, nil
+}
+
+// hkdfSHA256 implements RFC 5869 extract-and-expand with SHA-256.
+func hkdfSHA256(secret, salt, info []byte, length int) []byte {
+	extract := hmac.New(sha256.New, salt)
+	extract.Write(secret)
+	prk := extract.Sum(nil)
+
+	var okm, block []byte
+	for counter := byte(1); len(okm) < length; counter++ {
+		expand := hmac.New(sha256.New, prk)
+		expand.Write(block)
+		expand.Write(info)
+		expand.Write([]byte{counter})
+		block = expand.Sum(nil)
+		okm = append(okm, block...)
+	}
+	return okm[:length]
+}
@@ -0,0 +1,80 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestGenerateKeypairFromSeedRequiresForTesting(t *testing.T) {
+	km := NewKeyManager()
+	if _, err := km.GenerateKeypairFromSeed([]byte("seed")); !errors.Is(err, ErrDeterministicKeyNotAllowed) {
+		t.Errorf("Expected ErrDeterministicKeyNotAllowed without ForTesting, got %v", err)
+	}
+	if _, err := km.GenerateKeypairFromSeed(nil, ForTesting); err == nil {
+		t.Error("Expected error for empty seed")
+	}
+}
+
+func TestGenerateKeypairFromSeedIsStable(t *testing.T) {
+	km := NewKeyManager()
+
+	key, err := km.GenerateKeypairFromSeed([]byte("schemapin-test-seed"), ForTesting)
+	if err != nil {
+		t.Fatalf("GenerateKeypairFromSeed failed: %v", err)
+	}
+	again, err := km.GenerateKeypairFromSeed([]byte("schemapin-test-seed"), ForTesting)
+	if err != nil {
+		t.Fatalf("GenerateKeypairFromSeed failed: %v", err)
+	}
+	other, err := km.GenerateKeypairFromSeed([]byte("another-seed"), ForTesting)
+	if err != nil {
+		t.Fatalf("GenerateKeypairFromSeed failed: %v", err)
+	}
+
+	fingerprint, err := km.CalculateKeyFingerprint(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("CalculateKeyFingerprint failed: %v", err)
+	}
+	againFingerprint, _ := km.CalculateKeyFingerprint(&again.PublicKey)
+	otherFingerprint, _ := km.CalculateKeyFingerprint(&other.PublicKey)
+
+	if fingerprint != againFingerprint {
+		t.Errorf("Same seed produced different fingerprints: %s vs %s", fingerprint, againFingerprint)
+	}
+	if fingerprint == otherFingerprint {
+		t.Error("Different seeds produced the same fingerprint")
+	}
+
+	// Pinned value: changing the derivation breaks every committed fixture.
+	const expected = "sha256:210d8e77ff7830ac26f8cd7f0d4213e83119c648cbdddc4093ed4e4614eae953"
+	if fingerprint != expected {
+		t.Errorf("Seeded fingerprint changed: got %s, want %s", fingerprint, expected)
+	}
+
+	if !key.Curve.IsOnCurve(key.X, key.Y) {
+		t.Fatal("Derived public key is not on P-256")
+	}
+	hash := sha256.Sum256([]byte("payload"))
+	sm := NewSignatureManager()
+	signature, err := sm.SignHash(hash[:], key)
+	if err != nil {
+		t.Fatalf("SignHash failed: %v", err)
+	}
+	if !sm.VerifySignature(hash[:], signature, &again.PublicKey) {
+		t.Error("Signature from seeded key did not verify")
+	}
+}
+
+// RFC 5869 appendix A.1.
+func TestHKDFSHA256(t *testing.T) {
+	ikm, _ := hex.DecodeString("0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b")
+	salt, _ := hex.DecodeString("000102030405060708090a0b0c")
+	info, _ := hex.DecodeString("f0f1f2f3f4f5f6f7f8f9")
+	expected := "3cb25f25faacd57a90434f64d0362f2a2d2d0a90cf1a5a4c5db02d56ecc4c5bf34007208d5b887185865"
+
+	if got := hex.EncodeToString(hkdfSHA256(ikm, salt, info, 42)); got != expected {
+		t.Errorf("hkdfSHA256 = %s, want %s", got, expected)
+	}
+}
@@ -0,0 +1,346 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha1" // #nosec G505 -- hmacWithSHA1 is the RFC 8018 default PRF for PBKDF2
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+)
+
+var (
+	// ErrPassphraseRequired is returned by LoadPrivateKeyPEM for an
+	// encrypted key; use LoadPrivateKeyPEMWithPassphrase.
+	ErrPassphraseRequired = errors.New("private key is encrypted; a passphrase is required")
+	// ErrIncorrectPassphrase is returned when an encrypted key does not
+	// decrypt with the given passphrase.
+	ErrIncorrectPassphrase = errors.New("incorrect passphrase for encrypted private key")
+	// ErrKeyNotEncrypted is returned by LoadPrivateKeyPEMWithPassphrase for
+	// a key that is stored unencrypted, so a passphrase the caller believed
+	// was protecting it is not silently ignored.
+	ErrKeyNotEncrypted = errors.New("private key is not encrypted but a passphrase was given")
+)
+
+// Parameters of ExportPrivateKeyPEMEncrypted: the scrypt defaults of
+// `openssl pkcs8 -topk8 -scrypt`, which OpenSSL-based loaders such as
+// Python's cryptography accept without raising their memory limits.
+const (
+	exportScryptN    = 1 << 14
+	exportScryptR    = 8
+	exportScryptP    = 1
+	exportSaltLength = 16
+)
+
+// pbkdf2MaxIterations caps the PBKDF2 iteration count accepted from a key
+// file.
+const pbkdf2MaxIterations = 10_000_000
+
+var (
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidScrypt         = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11591, 4, 11}
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA224 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 8}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+	oidAES128CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// encryptedPrivateKeyInfo is the PKCS#8 EncryptedPrivateKeyInfo structure
+// (RFC 5958 section 3).
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+// pbes2Params is PBES2-params (RFC 8018 appendix A.4).
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+// pbkdf2Params is PBKDF2-params (RFC 8018 appendix A.2). Only the
+// "specified" salt choice is supported.
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// scryptParams is scrypt-params (RFC 7914 section 7.1).
+type scryptParams struct {
+	Salt                     []byte
+	CostParameter            int
+	BlockSize                int
+	ParallelizationParameter int
+	KeyLength                int `asn1:"optional"`
+}
+
+// LoadPrivateKeyPEMWithPassphrase loads an encrypted private key: PKCS#8
+// "ENCRYPTED PRIVATE KEY" PEM with PBES2 (PBKDF2 or scrypt, AES-CBC), as
+// written by ExportPrivateKeyPEMEncrypted, OpenSSL and Python's
+// cryptography, or a legacy OpenSSL "EC PRIVATE KEY" PEM with a
+// Proc-Type: 4,ENCRYPTED header.
+//
+// It returns ErrIncorrectPassphrase when the key does not decrypt and
+// ErrKeyNotEncrypted when the key is stored in the clear.
+func (k *KeyManager) LoadPrivateKeyPEMWithPassphrase(pemData string, passphrase []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode([]byte(pemData))
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode PEM block")
+	}
+
+	switch {
+	case block.Type == "ENCRYPTED PRIVATE KEY":
+		der, err := decryptPKCS8(block.Bytes, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		key, err := x509.ParsePKCS8PrivateKey(der)
+		if err != nil {
+			return nil, ErrIncorrectPassphrase
+		}
+		ecdsaKey, ok := key.(*ecdsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("not an ECDSA private key")
+		}
+		return ecdsaKey, nil
+
+	case x509.IsEncryptedPEMBlock(block): //nolint:staticcheck // legacy OpenSSL encryption is deprecated but still in use
+		der, err := x509.DecryptPEMBlock(block, passphrase) //nolint:staticcheck // see above
+		if err != nil {
+			if errors.Is(err, x509.IncorrectPasswordError) {
+				return nil, ErrIncorrectPassphrase
+			}
+			return nil, fmt.Errorf("failed to decrypt private key: %w", err)
+		}
+		// Legacy encryption has no integrity check, so a wrong passphrase
+		// can survive unpadding and only fail here.
+		key, err := x509.ParseECPrivateKey(der)
+		if err != nil {
+			return nil, ErrIncorrectPassphrase
+		}
+		return key, nil
+
+	default:
+		return nil, ErrKeyNotEncrypted
+	}
+}
+
+// ExportPrivateKeyPEMEncrypted exports key as a PKCS#8 "ENCRYPTED PRIVATE
+// KEY" PEM protected by passphrase, using PBES2 with scrypt (N=2^14, r=8,
+// p=1) and AES-256-CBC. PKCS#8 has no AEAD encryption scheme that OpenSSL
+// reads, so CBC is used to keep keys loadable by OpenSSL and by Python's
+// cryptography (load_pem_private_key) as well as by
+// LoadPrivateKeyPEMWithPassphrase.
+func (k *KeyManager) ExportPrivateKeyPEMEncrypted(key *ecdsa.PrivateKey, passphrase []byte) (string, error) {
+	if len(passphrase) == 0 {
+		return "", fmt.Errorf("passphrase cannot be empty")
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal private key: %w", err)
+	}
+
+	salt := make([]byte, exportSaltLength)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+	if _, err := rand.Read(iv); err != nil {
+		return "", fmt.Errorf("failed to generate IV: %w", err)
+	}
+
+	derivedKey, err := scryptKey(passphrase, salt, exportScryptN, exportScryptR, exportScryptP, 32)
+	if err != nil {
+		return "", err
+	}
+	blockCipher, err := aes.NewCipher(derivedKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to create cipher: %w", err)
+	}
+	padded := pkcs7Pad(der, aes.BlockSize)
+	encrypted := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(blockCipher, iv).CryptBlocks(encrypted, padded)
+
+	kdfParams, err := asn1.Marshal(scryptParams{
+		Salt:                     salt,
+		CostParameter:            exportScryptN,
+		BlockSize:                exportScryptR,
+		ParallelizationParameter: exportScryptP,
+		KeyLength:                32,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode scrypt parameters: %w", err)
+	}
+	ivParams, err := asn1.Marshal(iv)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode IV: %w", err)
+	}
+	schemeParams, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{Algorithm: oidScrypt, Parameters: asn1.RawValue{FullBytes: kdfParams}},
+		EncryptionScheme:  pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivParams}},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode PBES2 parameters: %w", err)
+	}
+	info, err := asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm:     pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: schemeParams}},
+		EncryptedData: encrypted,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode encrypted private key: %w", err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: info})), nil
+}
+
+// IsEncryptedPrivateKeyPEM reports whether pemData holds a private key that
+// LoadPrivateKeyPEMWithPassphrase must decrypt.
+func IsEncryptedPrivateKeyPEM(pemData string) bool {
+	block, _ := pem.Decode([]byte(pemData))
+	return block != nil && (block.Type == "ENCRYPTED PRIVATE KEY" || x509.IsEncryptedPEMBlock(block)) //nolint:staticcheck // detection only
+}
+
+// decryptPKCS8 decrypts a PBES2 EncryptedPrivateKeyInfo to the DER of the
+// inner PrivateKeyInfo.
+func decryptPKCS8(der, passphrase []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if rest, err := asn1.Unmarshal(der, &info); err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("failed to parse encrypted private key")
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported private key encryption %s (only PBES2 is supported)", info.Algorithm.Algorithm)
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, fmt.Errorf("failed to parse PBES2 parameters: %w", err)
+	}
+
+	var keyLen int
+	switch scheme := params.EncryptionScheme.Algorithm; {
+	case scheme.Equal(oidAES128CBC):
+		keyLen = 16
+	case scheme.Equal(oidAES192CBC):
+		keyLen = 24
+	case scheme.Equal(oidAES256CBC):
+		keyLen = 32
+	default:
+		return nil, fmt.Errorf("unsupported private key cipher %s", scheme)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil || len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("invalid AES-CBC IV in encrypted private key")
+	}
+
+	derivedKey, err := deriveKey(params.KeyDerivationFunc, passphrase, keyLen)
+	if err != nil {
+		return nil, err
+	}
+
+	blockCipher, err := aes.NewCipher(derivedKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	if len(info.EncryptedData) == 0 || len(info.EncryptedData)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("encrypted private key has an invalid length")
+	}
+	decrypted := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(blockCipher, iv).CryptBlocks(decrypted, info.EncryptedData)
+
+	plaintext, ok := pkcs7Unpad(decrypted, aes.BlockSize)
+	if !ok {
+		return nil, ErrIncorrectPassphrase
+	}
+	return plaintext, nil
+}
+
+// deriveKey runs the PBES2 key derivation function kdf.
+func deriveKey(kdf pkix.AlgorithmIdentifier, passphrase []byte, keyLen int) ([]byte, error) {
+	switch {
+	case kdf.Algorithm.Equal(oidPBKDF2):
+		var params pbkdf2Params
+		if _, err := asn1.Unmarshal(kdf.Parameters.FullBytes, &params); err != nil {
+			return nil, fmt.Errorf("failed to parse PBKDF2 parameters: %w", err)
+		}
+		if params.KeyLength != 0 && params.KeyLength != keyLen {
+			return nil, fmt.Errorf("PBKDF2 key length %d does not match the cipher", params.KeyLength)
+		}
+		if params.IterationCount <= 0 || params.IterationCount > pbkdf2MaxIterations {
+			return nil, fmt.Errorf("PBKDF2 iteration count %d is out of range", params.IterationCount)
+		}
+		prf, err := pbkdf2PRF(params.PRF.Algorithm)
+		if err != nil {
+			return nil, err
+		}
+		return pbkdf2Key(passphrase, params.Salt, params.IterationCount, keyLen, prf), nil
+
+	case kdf.Algorithm.Equal(oidScrypt):
+		var params scryptParams
+		if _, err := asn1.Unmarshal(kdf.Parameters.FullBytes, &params); err != nil {
+			return nil, fmt.Errorf("failed to parse scrypt parameters: %w", err)
+		}
+		if params.KeyLength != 0 && params.KeyLength != keyLen {
+			return nil, fmt.Errorf("scrypt key length %d does not match the cipher", params.KeyLength)
+		}
+		return scryptKey(passphrase, params.Salt, params.CostParameter, params.BlockSize, params.ParallelizationParameter, keyLen)
+
+	default:
+		return nil, fmt.Errorf("unsupported private key derivation function %s", kdf.Algorithm)
+	}
+}
+
+// pbkdf2PRF maps a PBKDF2 PRF identifier to its hash; an absent PRF means
+// the RFC 8018 default, hmacWithSHA1.
+func pbkdf2PRF(oid asn1.ObjectIdentifier) (func() hash.Hash, error) {
+	switch {
+	case len(oid) == 0, oid.Equal(oidHMACWithSHA1):
+		return sha1.New, nil
+	case oid.Equal(oidHMACWithSHA224):
+		return sha256.New224, nil
+	case oid.Equal(oidHMACWithSHA256):
+		return sha256.New, nil
+	case oid.Equal(oidHMACWithSHA384):
+		return sha512.New384, nil
+	case oid.Equal(oidHMACWithSHA512):
+		return sha512.New, nil
+	default:
+		return nil, fmt.Errorf("unsupported PBKDF2 PRF %s", oid)
+	}
+}
+
+func pkcs7Pad(data []byte, blockSize int) []byte {
+	padding := blockSize - len(data)%blockSize
+	return append(append([]byte{}, data...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+}
+
+func pkcs7Unpad(data []byte, blockSize int) ([]byte, bool) {
+	if len(data) == 0 {
+		return nil, false
+	}
+	padding := int(data[len(data)-1])
+	if padding == 0 || padding > blockSize || padding > len(data) {
+		return nil, false
+	}
+	for _, b := range data[len(data)-padding:] {
+		if int(b) != padding {
+			return nil, false
+		}
+	}
+	return data[:len(data)-padding], true
+}
@@ -0,0 +1,141 @@
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"math/bits"
+)
+
+// pbkdf2Key derives keyLen bytes from password as in RFC 8018 section 5.2.
+// It is implemented here, like HKDF in deterministic.go, to avoid a
+// dependency for one function.
+func pbkdf2Key(password, salt []byte, iterations, keyLen int, h func() hash.Hash) []byte {
+	prf := hmac.New(h, password)
+	hashLen := prf.Size()
+	numBlocks := (keyLen + hashLen - 1) / hashLen
+
+	var counter [4]byte
+	derived := make([]byte, 0, numBlocks*hashLen)
+	u := make([]byte, hashLen)
+	for block := 1; block <= numBlocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(counter[:], uint32(block))
+		prf.Write(counter[:])
+		derived = prf.Sum(derived)
+
+		t := derived[len(derived)-hashLen:]
+		copy(u, t)
+		for n := 2; n <= iterations; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for i := range u {
+				t[i] ^= u[i]
+			}
+		}
+	}
+	return derived[:keyLen]
+}
+
+// scryptMaxMemory caps the memory an scrypt parameter set may demand
+// (128 * N * r bytes per lane), so that a crafted key file cannot exhaust
+// memory before the passphrase is even checked.
+const scryptMaxMemory = 256 << 20
+
+// scryptKey derives keyLen bytes from password as in RFC 7914.
+func scryptKey(password, salt []byte, n, r, p, keyLen int) ([]byte, error) {
+	if n <= 1 || n&(n-1) != 0 {
+		return nil, fmt.Errorf("scrypt cost parameter %d is not a power of two greater than 1", n)
+	}
+	if r <= 0 || p <= 0 || p > 16 || r > scryptMaxMemory/128/n {
+		return nil, fmt.Errorf("scrypt parameters N=%d r=%d p=%d exceed the supported limits", n, r, p)
+	}
+
+	b := pbkdf2Key(password, salt, 1, p*128*r, sha256.New)
+	xy := make([]uint32, 64*r)
+	v := make([]uint32, 32*n*r)
+	for i := 0; i < p; i++ {
+		scryptROMix(b[i*128*r:], r, n, v, xy)
+	}
+	return pbkdf2Key(password, b, 1, keyLen, sha256.New), nil
+}
+
+// scryptROMix is scryptROMix from RFC 7914 section 5, operating on the
+// 128*r byte block b in place.
+func scryptROMix(b []byte, r, n int, v, xy []uint32) {
+	var tmp [16]uint32
+	words := 32 * r
+	x, y := xy[:words], xy[words:]
+
+	for i := range x {
+		x[i] = binary.LittleEndian.Uint32(b[4*i:])
+	}
+	for i := 0; i < n; i += 2 {
+		copy(v[i*words:], x)
+		scryptBlockMix(&tmp, x, y, r)
+		copy(v[(i+1)*words:], y)
+		scryptBlockMix(&tmp, y, x, r)
+	}
+	for i := 0; i < n; i += 2 {
+		j := int(x[words-16] & uint32(n-1))
+		xorWords(x, v[j*words:(j+1)*words])
+		scryptBlockMix(&tmp, x, y, r)
+		j = int(y[words-16] & uint32(n-1))
+		xorWords(y, v[j*words:(j+1)*words])
+		scryptBlockMix(&tmp, y, x, r)
+	}
+	for i, w := range x {
+		binary.LittleEndian.PutUint32(b[4*i:], w)
+	}
+}
+
+func xorWords(dst, src []uint32) {
+	for i := range dst {
+		dst[i] ^= src[i]
+	}
+}
+
+// scryptBlockMix is scryptBlockMix from RFC 7914 section 4: even output
+// blocks go to the first half of out and odd ones to the second.
+func scryptBlockMix(tmp *[16]uint32, in, out []uint32, r int) {
+	copy(tmp[:], in[(2*r-1)*16:])
+	for i := 0; i < 2*r; i += 2 {
+		salsa208XOR(tmp, in[i*16:], out[i*8:])
+		salsa208XOR(tmp, in[i*16+16:], out[i*8+r*16:])
+	}
+}
+
+// salsa208XOR sets tmp to Salsa20/8(tmp XOR in) and copies it to out.
+func salsa208XOR(tmp *[16]uint32, in, out []uint32) {
+	var w [16]uint32
+	for i := range w {
+		w[i] = tmp[i] ^ in[i]
+	}
+
+	x := w
+	quarter := func(a, b, c, d int) {
+		x[b] ^= bits.RotateLeft32(x[a]+x[d], 7)
+		x[c] ^= bits.RotateLeft32(x[b]+x[a], 9)
+		x[d] ^= bits.RotateLeft32(x[c]+x[b], 13)
+		x[a] ^= bits.RotateLeft32(x[d]+x[c], 18)
+	}
+	for round := 0; round < 8; round += 2 {
+		quarter(0, 4, 8, 12)
+		quarter(5, 9, 13, 1)
+		quarter(10, 14, 2, 6)
+		quarter(15, 3, 7, 11)
+		quarter(0, 1, 2, 3)
+		quarter(5, 6, 7, 4)
+		quarter(10, 11, 8, 9)
+		quarter(15, 12, 13, 14)
+	}
+
+	for i := range x {
+		tmp[i] = x[i] + w[i]
+		out[i] = tmp[i]
+	}
+}
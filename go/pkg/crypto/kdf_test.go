@@ -0,0 +1,59 @@
+package crypto
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+)
+
+// Test vectors from RFC 7914 sections 11 and 12.
+func TestPBKDF2SHA256Vectors(t *testing.T) {
+	tests := []struct {
+		password, salt string
+		iterations     int
+		want           string
+	}{
+		{"passwd", "salt", 1, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783"},
+		{"Password", "NaCl", 80000, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d"},
+	}
+	for _, tt := range tests {
+		got := pbkdf2Key([]byte(tt.password), []byte(tt.salt), tt.iterations, 64, sha256.New)
+		if hex.EncodeToString(got) != tt.want {
+			t.Errorf("pbkdf2Key(%q, %q, %d) = %x, want %s", tt.password, tt.salt, tt.iterations, got, tt.want)
+		}
+	}
+}
+
+func TestScryptVectors(t *testing.T) {
+	tests := []struct {
+		password, salt string
+		n, r, p        int
+		want           string
+	}{
+		{"", "", 16, 1, 1, "77d6576238657b203b19ca42c18a0497f16b4844e3074ae8dfdffa3fede21442fcd0069ded0948f8326a753a0fc81f17e8d3e0fb2e0d3628cf35e20c38d18906"},
+		{"password", "NaCl", 1024, 8, 16, "fdbabe1c9d3472007856e7190d01e9fe7c6ad7cbc8237830e77376634b3731622eaf30d92e22a3886ff109279d9830dac727afb94a83ee6d8360cbdfa2cc0640"},
+	}
+	for _, tt := range tests {
+		got, err := scryptKey([]byte(tt.password), []byte(tt.salt), tt.n, tt.r, tt.p, 64)
+		if err != nil {
+			t.Fatalf("scryptKey failed: %v", err)
+		}
+		if hex.EncodeToString(got) != tt.want {
+			t.Errorf("scryptKey(%q, %q, N=%d) = %x, want %s", tt.password, tt.salt, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestScryptRejectsBadParameters(t *testing.T) {
+	tests := map[string][3]int{
+		"N not a power of two": {1000, 8, 1},
+		"N of one":             {1, 8, 1},
+		"memory over limit":    {1 << 20, 8, 1},
+		"too many lanes":       {1024, 8, 64},
+	}
+	for name, params := range tests {
+		if _, err := scryptKey([]byte("p"), []byte("s"), params[0], params[1], params[2], 32); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
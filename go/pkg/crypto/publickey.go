@@ -0,0 +1,167 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/x509"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// ErrUnsupportedCurve is returned for public keys on a curve other than
+// P-256. SchemaPin keys are P-256 only, so a fingerprint of such a key
+// would match nothing another implementation produces.
+var ErrUnsupportedCurve = errors.New("unsupported elliptic curve: SchemaPin keys must be P-256")
+
+var (
+	oidPublicKeyECDSA = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidNamedCurveP256 = asn1.ObjectIdentifier{1, 2, 840, 10045, 3, 1, 7}
+	oidPrimeField     = asn1.ObjectIdentifier{1, 2, 840, 10045, 1, 1}
+)
+
+// subjectPublicKeyInfo is the SPKI structure of RFC 5280.
+type subjectPublicKeyInfo struct {
+	Algorithm struct {
+		Algorithm  asn1.ObjectIdentifier
+		Parameters asn1.RawValue `asn1:"optional"`
+	}
+	PublicKey asn1.BitString
+}
+
+// specifiedECDomain is the explicit form of EC parameters (RFC 3279).
+type specifiedECDomain struct {
+	Version int
+	FieldID struct {
+		FieldType asn1.ObjectIdentifier
+		Prime     *big.Int
+	}
+	Curve struct {
+		A, B []byte
+		Seed asn1.BitString `asn1:"optional"`
+	}
+	Base     []byte
+	Order    *big.Int
+	Cofactor *big.Int `asn1:"optional"`
+}
+
+// normalizePEM strips a byte order mark, converts CRLF and CR line endings
+// to LF and trims the whitespace around every line, so a key copied from a
+// Windows editor or an indented config block decodes like the original.
+func normalizePEM(pemData string) []byte {
+	pemData = strings.TrimPrefix(pemData, "\ufeff")
+	pemData = strings.ReplaceAll(pemData, "\r\n", "\n")
+	pemData = strings.ReplaceAll(pemData, "\r", "\n")
+
+	var buf bytes.Buffer
+	for _, line := range strings.Split(pemData, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			buf.WriteString(line)
+			buf.WriteByte('\n')
+		}
+	}
+	return buf.Bytes()
+}
+
+// parsePublicKeyDER parses a DER SubjectPublicKeyInfo into a P-256 key.
+// Besides the named-curve, uncompressed form x509 handles, it accepts
+// explicit curve parameters that equal P-256 and compressed points.
+func parsePublicKeyDER(der []byte) (*ecdsa.PublicKey, error) {
+	if pub, err := x509.ParsePKIXPublicKey(der); err == nil {
+		ecdsaKey, ok := pub.(*ecdsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("not an ECDSA public key")
+		}
+		if ecdsaKey.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("%w (got %s)", ErrUnsupportedCurve, ecdsaKey.Curve.Params().Name)
+		}
+		return ecdsaKey, nil
+	}
+
+	var spki subjectPublicKeyInfo
+	rest, err := asn1.Unmarshal(der, &spki)
+	if err != nil || len(rest) > 0 {
+		return nil, fmt.Errorf("failed to parse public key: malformed SubjectPublicKeyInfo")
+	}
+	if !spki.Algorithm.Algorithm.Equal(oidPublicKeyECDSA) {
+		return nil, fmt.Errorf("not an ECDSA public key")
+	}
+	if err := checkP256Parameters(spki.Algorithm.Parameters); err != nil {
+		return nil, err
+	}
+	return unmarshalP256Point(spki.PublicKey.RightAlign())
+}
+
+// checkP256Parameters accepts the P-256 named curve OID or explicit
+// parameters equal to P-256.
+func checkP256Parameters(params asn1.RawValue) error {
+	switch {
+	case params.Tag == asn1.TagOID:
+		var oid asn1.ObjectIdentifier
+		if _, err := asn1.Unmarshal(params.FullBytes, &oid); err != nil {
+			return fmt.Errorf("failed to parse public key: malformed curve OID")
+		}
+		if !oid.Equal(oidNamedCurveP256) {
+			return fmt.Errorf("%w (got curve %s)", ErrUnsupportedCurve, oid)
+		}
+		return nil
+	case params.Tag == asn1.TagSequence && params.IsCompound:
+		var domain specifiedECDomain
+		if _, err := asn1.Unmarshal(params.FullBytes, &domain); err != nil {
+			return fmt.Errorf("failed to parse public key: malformed explicit curve parameters")
+		}
+		if !isP256Domain(&domain) {
+			return fmt.Errorf("%w (explicit parameters of another curve)", ErrUnsupportedCurve)
+		}
+		return nil
+	default:
+		return fmt.Errorf("failed to parse public key: missing curve parameters")
+	}
+}
+
+func isP256Domain(domain *specifiedECDomain) bool {
+	p256 := elliptic.P256().Params()
+	if !domain.FieldID.FieldType.Equal(oidPrimeField) || domain.FieldID.Prime == nil || domain.FieldID.Prime.Cmp(p256.P) != 0 {
+		return false
+	}
+	a := new(big.Int).Sub(p256.P, big.NewInt(3))
+	if new(big.Int).SetBytes(domain.Curve.A).Cmp(a) != 0 || new(big.Int).SetBytes(domain.Curve.B).Cmp(p256.B) != 0 {
+		return false
+	}
+	if domain.Order == nil || domain.Order.Cmp(p256.N) != 0 {
+		return false
+	}
+	if domain.Cofactor != nil && domain.Cofactor.Cmp(big.NewInt(1)) != 0 {
+		return false
+	}
+	base, err := unmarshalP256Point(domain.Base)
+	return err == nil && base.X.Cmp(p256.Gx) == 0 && base.Y.Cmp(p256.Gy) == 0
+}
+
+// unmarshalP256Point decodes an uncompressed or compressed SEC 1 point and
+// checks that it is on P-256.
+func unmarshalP256Point(point []byte) (*ecdsa.PublicKey, error) {
+	switch {
+	case len(point) == 65 && point[0] == 4:
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return nil, fmt.Errorf("failed to parse public key: point is not on P-256")
+		}
+		return &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(point[1:33]),
+			Y:     new(big.Int).SetBytes(point[33:]),
+		}, nil
+	case len(point) == 33 && (point[0] == 2 || point[0] == 3):
+		x, y := elliptic.UnmarshalCompressed(elliptic.P256(), point)
+		if x == nil {
+			return nil, fmt.Errorf("failed to parse public key: point is not on P-256")
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("failed to parse public key: unsupported point encoding")
+	}
+}
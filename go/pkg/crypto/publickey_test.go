@@ -0,0 +1,140 @@
+package crypto
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type fingerprintFixture struct {
+	Vectors []struct {
+		Name         string `json:"name"`
+		PublicKeyPEM string `json:"public_key_pem"`
+		Fingerprint  string `json:"fingerprint"`
+	} `json:"vectors"`
+	Rejected []struct {
+		Name         string `json:"name"`
+		PublicKeyPEM string `json:"public_key_pem"`
+		Reason       string `json:"reason"`
+	} `json:"rejected"`
+}
+
+// loadFingerprintFixture reads tests/cross-language/key_fingerprints.json,
+// walking up from the test working directory to the repo root.
+func loadFingerprintFixture(t testing.TB) *fingerprintFixture {
+	t.Helper()
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getwd: %v", err)
+	}
+	for {
+		candidate := filepath.Join(dir, "tests", "cross-language", "key_fingerprints.json")
+		if raw, err := os.ReadFile(candidate); err == nil { //nolint:gosec // test fixture path
+			var fixture fingerprintFixture
+			if err := json.Unmarshal(raw, &fixture); err != nil {
+				t.Fatalf("unmarshal fixture: %v", err)
+			}
+			return &fixture
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			t.Fatal("could not locate tests/cross-language/key_fingerprints.json")
+		}
+		dir = parent
+	}
+}
+
+func TestFingerprintCrossLanguageVectors(t *testing.T) {
+	fixture := loadFingerprintFixture(t)
+	km := NewKeyManager()
+
+	for _, v := range fixture.Vectors {
+		t.Run(v.Name, func(t *testing.T) {
+			got, err := km.CalculateKeyFingerprintFromPEM(v.PublicKeyPEM)
+			if err != nil {
+				t.Fatalf("CalculateKeyFingerprintFromPEM() error = %v", err)
+			}
+			if got != v.Fingerprint {
+				t.Errorf("fingerprint = %s, want %s", got, v.Fingerprint)
+			}
+		})
+	}
+	for _, v := range fixture.Rejected {
+		t.Run(v.Name, func(t *testing.T) {
+			_, err := km.CalculateKeyFingerprintFromPEM(v.PublicKeyPEM)
+			if v.Reason == "unsupported_curve" && !errors.Is(err, ErrUnsupportedCurve) {
+				t.Errorf("expected ErrUnsupportedCurve, got %v", err)
+			}
+		})
+	}
+}
+
+func TestCalculateKeyFingerprintRejectsOtherCurves(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewKeyManager().CalculateKeyFingerprint(&key.PublicKey); !errors.Is(err, ErrUnsupportedCurve) {
+		t.Errorf("expected ErrUnsupportedCurve, got %v", err)
+	}
+}
+
+func TestLoadPublicKeyPEMRejectsOffCurvePoint(t *testing.T) {
+	fixture := loadFingerprintFixture(t)
+	km := NewKeyManager()
+	key, err := km.LoadPublicKeyPEM(fixture.Vectors[0].PublicKeyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	point := elliptic.Marshal(elliptic.P256(), key.X, key.Y)
+	point[64] ^= 1
+	if _, err := unmarshalP256Point(point); err == nil {
+		t.Error("expected a point off the curve to be rejected")
+	}
+}
+
+// pemVariants returns encodings of pemData that must load as the same key.
+func pemVariants(pemData string) []string {
+	return []string{
+		strings.ReplaceAll(pemData, "\n", "\r\n"),
+		"\ufeff" + pemData,
+		"\n\n    " + strings.ReplaceAll(pemData, "\n", "\n    ") + "\n\n",
+		strings.ReplaceAll(pemData, "\n", " \t\n"),
+	}
+}
+
+// FuzzFingerprintFromPEM checks that fingerprinting never panics and that a
+// key's fingerprint does not depend on line endings or whitespace.
+func FuzzFingerprintFromPEM(f *testing.F) {
+	fixture := loadFingerprintFixture(f)
+	for _, v := range fixture.Vectors {
+		f.Add(v.PublicKeyPEM)
+	}
+	for _, v := range fixture.Rejected {
+		f.Add(v.PublicKeyPEM)
+	}
+	f.Add("-----BEGIN PUBLIC KEY-----\nMAA=\n-----END PUBLIC KEY-----\n")
+
+	km := NewKeyManager()
+	f.Fuzz(func(t *testing.T, pemData string) {
+		fingerprint, err := km.CalculateKeyFingerprintFromPEM(pemData)
+		if err != nil {
+			return
+		}
+		for _, variant := range pemVariants(pemData) {
+			got, err := km.CalculateKeyFingerprintFromPEM(variant)
+			if err != nil {
+				t.Fatalf("variant %q failed to load: %v", variant, err)
+			}
+			if got != fingerprint {
+				t.Fatalf("variant %q fingerprint = %s, want %s", variant, got, fingerprint)
+			}
+		}
+	})
+}
@@ -0,0 +1,243 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
+)
+
+// Self-test checks, in the order SelfTest runs them.
+const (
+	SelfTestEntropy          = "entropy"
+	SelfTestEphemeralKey     = "ephemeral_key"
+	SelfTestPEMRoundTrip     = "pem_round_trip"
+	SelfTestCanonicalization = "canonicalization"
+	SelfTestStaticVector     = "static_vector"
+	SelfTestFingerprint      = "fingerprint"
+)
+
+// SelfTestError is a failed self-test check. SelfTest joins one per failed
+// check with errors.Join, so each can be found with errors.As on the
+// joined error's Unwrap() []error.
+type SelfTestError struct {
+	// Check is one of the SelfTest* constants.
+	Check string
+	Err   error
+}
+
+func (e *SelfTestError) Error() string {
+	return fmt.Sprintf("self-test %s: %v", e.Check, e.Err)
+}
+
+func (e *SelfTestError) Unwrap() error {
+	return e.Err
+}
+
+// selfTestVector is a schema signed once with a fixed key, with the
+// canonical form, hash and key fingerprint every SchemaPin implementation
+// computes for it.
+type selfTestVector struct {
+	publicKeyPEM string
+	fingerprint  string
+	schemaJSON   string
+	canonical    string
+	schemaHash   string
+	signature    string
+}
+
+// builtinVector is the vector SelfTest verifies. Its description is not
+// ASCII and its keys are out of order, so canonicalization has to sort
+// keys and write UTF-8 unescaped to reproduce the hash.
+var builtinVector = selfTestVector{
+	publicKeyPEM: `-----BEGIN PUBLIC KEY-----
+MFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAE+agLwkSMzlPt4fCd8bXuK2vaXFUJ
+n6sLV32B0/H009lW5l7PzG96ESsaincRWr6LLs9m25f8kQ9jffm40umTCA==
+-----END PUBLIC KEY-----
+`,
+	fingerprint: "sha256:f9217a370d441750200eb845ce7c4265a9def5b12f045e5ce2b7c037771bb710",
+	schemaJSON: `{
+  "name": "self_test",
+  "parameters": {
+    "type": "object",
+    "required": ["count"],
+    "properties": {
+      "tags": {"uniqueItems": true, "type": "array", "items": {"type": "string"}},
+      "count": {"type": "integer", "minimum": 1, "maximum": 100}
+    }
+  },
+  "description": "SchemaPin self-test vector é中"
+}`,
+	canonical:  `{"description":"SchemaPin self-test vector é中","name":"self_test","parameters":{"properties":{"count":{"maximum":100,"minimum":1,"type":"integer"},"tags":{"items":{"type":"string"},"type":"array","uniqueItems":true}},"required":["count"],"type":"object"}}`,
+	schemaHash: "3b7f51bdeba24e05dd75318d872c4015bbd29c3e68309a2ddbba16e21231a737",
+	signature:  "MEQCIF1/SkEfbmG/a08SwHe9gFlVmADk2VIdwFnFLxeKthmGAiBuPe2KPjnv5N4puxFMXAay+Rx+UaPrBCtZpFC27svOSA==",
+}
+
+// SelfTest checks that the crypto stack behaves as SchemaPin expects, for
+// running at startup before any verification result is trusted, e.g. on a
+// FIPS-patched toolchain, an unusual architecture or a container whose
+// entropy source is not ready. It checks that crypto/rand returns
+// non-degenerate output; that an ephemeral P-256 key signs and verifies a
+// known hash; that the key survives a PEM round trip; that a built-in
+// schema canonicalizes and hashes to known values and its committed
+// signature verifies; and that the vector key's fingerprint is computed
+// as expected. It takes a few milliseconds.
+//
+// It returns nil, or a *SelfTestError for every failed check, joined with
+// errors.Join.
+func SelfTest() error {
+	return runSelfTest(builtinVector, rand.Reader)
+}
+
+// runSelfTest runs every check against vector, with random as the entropy
+// source checked.
+func runSelfTest(vector selfTestVector, random io.Reader) error {
+	var errs []error
+	check := func(name string, err error) {
+		if err != nil {
+			errs = append(errs, &SelfTestError{Check: name, Err: err})
+		}
+	}
+	check(SelfTestEntropy, checkEntropy(random))
+	check(SelfTestEphemeralKey, checkEphemeralKey())
+	check(SelfTestPEMRoundTrip, checkPEMRoundTrip())
+	schemaHash, err := checkCanonicalization(vector)
+	check(SelfTestCanonicalization, err)
+	check(SelfTestStaticVector, checkStaticVector(vector, schemaHash))
+	check(SelfTestFingerprint, checkFingerprint(vector))
+	return errors.Join(errs...)
+}
+
+// checkEntropy reads two blocks from random and fails if either read
+// fails, a block is a single repeated byte, or both blocks are equal.
+func checkEntropy(random io.Reader) error {
+	var first, second [32]byte
+	if _, err := io.ReadFull(random, first[:]); err != nil {
+		return fmt.Errorf("failed to read random bytes: %w", err)
+	}
+	if _, err := io.ReadFull(random, second[:]); err != nil {
+		return fmt.Errorf("failed to read random bytes: %w", err)
+	}
+	for _, block := range [][32]byte{first, second} {
+		if bytes.Count(block[:], block[:1]) == len(block) {
+			return fmt.Errorf("random source returned %d copies of byte %#02x", len(block), block[0])
+		}
+	}
+	if first == second {
+		return fmt.Errorf("random source returned the same %d bytes twice", len(first))
+	}
+	return nil
+}
+
+// checkEphemeralKey signs a known hash with a new key and checks that the
+// signature verifies for that hash only.
+func checkEphemeralKey() error {
+	privateKey, err := NewKeyManager().GenerateKeypair()
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256([]byte("schemapin self-test"))
+	signatures := NewSignatureManager()
+	signature, err := signatures.SignSchemaHash(hash[:], privateKey)
+	if err != nil {
+		return err
+	}
+	if !signatures.VerifySchemaSignature(hash[:], signature, &privateKey.PublicKey) {
+		return fmt.Errorf("signature by an ephemeral key does not verify")
+	}
+	hash[0] ^= 0xff
+	if signatures.VerifySchemaSignature(hash[:], signature, &privateKey.PublicKey) {
+		return fmt.Errorf("signature verifies for a different hash")
+	}
+	return nil
+}
+
+// checkPEMRoundTrip exports a new key pair to PEM and checks that it loads
+// back unchanged.
+func checkPEMRoundTrip() error {
+	keyManager := NewKeyManager()
+	privateKey, err := keyManager.GenerateKeypair()
+	if err != nil {
+		return err
+	}
+	privatePEM, err := keyManager.ExportPrivateKeyPEM(privateKey)
+	if err != nil {
+		return err
+	}
+	publicPEM, err := keyManager.ExportPublicKeyPEM(&privateKey.PublicKey)
+	if err != nil {
+		return err
+	}
+	loadedPrivate, err := keyManager.LoadPrivateKeyPEM(privatePEM)
+	if err != nil {
+		return err
+	}
+	loadedPublic, err := keyManager.LoadPublicKeyPEM(publicPEM)
+	if err != nil {
+		return err
+	}
+	if !loadedPrivate.Equal(privateKey) || !loadedPublic.Equal(&privateKey.PublicKey) {
+		return fmt.Errorf("key pair changed in a PEM round trip")
+	}
+	return nil
+}
+
+// checkCanonicalization canonicalizes the vector's schema and returns its
+// hash once both match the vector.
+func checkCanonicalization(vector selfTestVector) ([]byte, error) {
+	var schema map[string]interface{}
+	if err := json.Unmarshal([]byte(vector.schemaJSON), &schema); err != nil {
+		return nil, fmt.Errorf("failed to parse vector schema: %w", err)
+	}
+	schemaCore := core.NewSchemaPinCore()
+	canonical, err := schemaCore.CanonicalizeSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+	if canonical != vector.canonical {
+		return nil, fmt.Errorf("canonical form %q, want %q", canonical, vector.canonical)
+	}
+	schemaHash := schemaCore.HashCanonical(canonical)
+	if got := hex.EncodeToString(schemaHash); got != vector.schemaHash {
+		return nil, fmt.Errorf("schema hash %s, want %s", got, vector.schemaHash)
+	}
+	return schemaHash, nil
+}
+
+// checkStaticVector verifies the vector's committed signature over
+// schemaHash, which is nil if canonicalization failed, in which case the
+// vector's own hash is used.
+func checkStaticVector(vector selfTestVector, schemaHash []byte) error {
+	if schemaHash == nil {
+		var err error
+		if schemaHash, err = hex.DecodeString(vector.schemaHash); err != nil {
+			return fmt.Errorf("invalid vector schema hash: %w", err)
+		}
+	}
+	publicKey, err := NewKeyManager().LoadPublicKeyPEM(vector.publicKeyPEM)
+	if err != nil {
+		return fmt.Errorf("failed to load vector public key: %w", err)
+	}
+	if !NewSignatureManager().VerifySchemaSignature(schemaHash, vector.signature, publicKey) {
+		return fmt.Errorf("committed signature does not verify")
+	}
+	return nil
+}
+
+// checkFingerprint computes the fingerprint of the vector's key.
+func checkFingerprint(vector selfTestVector) error {
+	fingerprint, err := NewKeyManager().CalculateKeyFingerprintFromPEM(vector.publicKeyPEM)
+	if err != nil {
+		return err
+	}
+	if fingerprint != vector.fingerprint {
+		return fmt.Errorf("fingerprint %s, want %s", fingerprint, vector.fingerprint)
+	}
+	return nil
+}
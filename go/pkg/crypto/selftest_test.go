@@ -0,0 +1,102 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// failedChecks returns the checks named by the *SelfTestErrors joined in
+// err, in order.
+func failedChecks(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		t.Fatalf("Expected a joined error, got %T: %v", err, err)
+	}
+	var checks []string
+	for _, e := range joined.Unwrap() {
+		var failed *SelfTestError
+		if !errors.As(e, &failed) {
+			t.Fatalf("Expected a *SelfTestError, got %T: %v", e, e)
+		}
+		checks = append(checks, failed.Check)
+	}
+	return checks
+}
+
+func TestSelfTest(t *testing.T) {
+	start := time.Now()
+	if err := SelfTest(); err != nil {
+		t.Fatalf("SelfTest() = %v", err)
+	}
+	// The budget is 50ms; the bound leaves room for slow CI machines
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("SelfTest took %s", elapsed)
+	}
+}
+
+// repeatReader returns the same bytes on every read.
+type repeatReader struct{}
+
+func (repeatReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(i)
+	}
+	return len(p), nil
+}
+
+func TestSelfTestInjectedFailures(t *testing.T) {
+	corrupt := func(edit func(*selfTestVector)) selfTestVector {
+		vector := builtinVector
+		edit(&vector)
+		return vector
+	}
+	tests := []struct {
+		name   string
+		vector selfTestVector
+		random io.Reader
+		want   []string
+	}{
+		{name: "zero entropy", vector: builtinVector, random: bytes.NewReader(make([]byte, 64)), want: []string{SelfTestEntropy}},
+		{name: "repeated entropy", vector: builtinVector, random: repeatReader{}, want: []string{SelfTestEntropy}},
+		{name: "failing entropy", vector: builtinVector, random: iotest.ErrReader(errors.New("not ready")), want: []string{SelfTestEntropy}},
+		{name: "schema changed",
+			vector: corrupt(func(v *selfTestVector) { v.schemaJSON = strings.Replace(v.schemaJSON, "100", "101", 1) }),
+			random: rand.Reader, want: []string{SelfTestCanonicalization}},
+		{name: "signature changed",
+			vector: corrupt(func(v *selfTestVector) {
+				v.signature = builtinVector.signature[:10] + "A" + builtinVector.signature[11:]
+			}),
+			random: rand.Reader, want: []string{SelfTestStaticVector}},
+		{name: "fingerprint changed",
+			vector: corrupt(func(v *selfTestVector) { v.fingerprint = "sha256:" + strings.Repeat("0", 64) }),
+			random: rand.Reader, want: []string{SelfTestFingerprint}},
+		{name: "several checks", vector: corrupt(func(v *selfTestVector) {
+			v.canonical = "{}"
+			v.fingerprint = ""
+		}), random: bytes.NewReader(nil), want: []string{SelfTestEntropy, SelfTestCanonicalization, SelfTestFingerprint}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := runSelfTest(tt.vector, tt.random)
+			if got := failedChecks(t, err); !slices.Equal(got, tt.want) {
+				t.Errorf("Expected failed checks %v, got %v (%v)", tt.want, got, err)
+			}
+			for _, check := range tt.want {
+				if !strings.Contains(err.Error(), "self-test "+check+": ") {
+					t.Errorf("Expected the error to name %s, got %q", check, err)
+				}
+			}
+		})
+	}
+}
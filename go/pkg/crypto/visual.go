@@ -0,0 +1,141 @@
+package crypto
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// The visual fingerprint encoding is published by vendors next to their
+// keys, so every constant below is part of the format: changing one changes
+// the art of every key.
+const (
+	randomartWidth  = 17
+	randomartHeight = 9
+	// randomartSymbols are drawn for cells visited 0, 1, 2... times; cells
+	// visited more often than the table covers use its last symbol.
+	randomartSymbols = " .o+=*BOX@%&#/^"
+	randomartTop     = "+---[SchemaPin]---+"
+	randomartBottom  = "+----[SHA256]-----+"
+
+	// FingerprintEmojiCount is the number of emoji FingerprintEmoji
+	// returns. Each encodes 6 bits, covering the first 6 digest bytes.
+	FingerprintEmojiCount = 8
+)
+
+// fingerprintEmoji is indexed by 6-bit groups of the digest. All are single
+// code points with a default emoji presentation.
+var fingerprintEmoji = [64]string{
+	"🐶", "🐱", "🐭", "🐹", "🐰", "🦊", "🐻", "🐼", "🐨", "🐯", "🦁", "🐮", "🐷", "🐸", "🐵", "🐔",
+	"🐧", "🐦", "🐤", "🦆", "🦅", "🦉", "🦇", "🐺", "🐗", "🐴", "🦄", "🐝", "🐛", "🦋", "🐌", "🐞",
+	"🐢", "🐍", "🦎", "🐙", "🦑", "🦀", "🐡", "🐠", "🐟", "🐬", "🐳", "🐊", "🐘", "🦒", "🐪", "🐄",
+	"🌵", "🌲", "🌴", "🍀", "🍁", "🍄", "🌻", "🌙", "🍎", "🍋", "🍌", "🍉", "🍇", "🍓", "🍒", "🍍",
+}
+
+// FingerprintVisual renders a "sha256:<hex>" key fingerprint as a
+// FingerprintRandomart grid followed by a line of FingerprintEmoji, for
+// people comparing keys by eye. The output is deterministic.
+func FingerprintVisual(fingerprint string) (string, error) {
+	art, err := FingerprintRandomart(fingerprint)
+	if err != nil {
+		return "", err
+	}
+	emoji, err := FingerprintEmoji(fingerprint)
+	if err != nil {
+		return "", err
+	}
+	return art + "\n" + emoji, nil
+}
+
+// FingerprintRandomart draws the fingerprint's digest with the OpenSSH
+// "drunken bishop" algorithm. A bishop starts in the centre of a 17x9 field
+// and, for each digest byte and each 2-bit pair of it from the least
+// significant, moves diagonally: bit 0 set moves right, clear moves left;
+// bit 1 set moves down, clear moves up. Moves into a wall slide along it.
+// Each cell shows how often it was visited using " .o+=*BOX@%&#/^"; the
+// start is marked S and the end E. The grid is framed with [SchemaPin] and
+// [SHA256] labels.
+func FingerprintRandomart(fingerprint string) (string, error) {
+	digest, err := fingerprintDigest(fingerprint)
+	if err != nil {
+		return "", err
+	}
+
+	var field [randomartWidth][randomartHeight]int
+	startX, startY := randomartWidth/2, randomartHeight/2
+	x, y := startX, startY
+	for _, b := range digest {
+		for i := 0; i < 4; i++ {
+			if b&0x1 != 0 {
+				x++
+			} else {
+				x--
+			}
+			if b&0x2 != 0 {
+				y++
+			} else {
+				y--
+			}
+			x = clamp(x, 0, randomartWidth-1)
+			y = clamp(y, 0, randomartHeight-1)
+			field[x][y]++
+			b >>= 2
+		}
+	}
+
+	var sb strings.Builder
+	sb.WriteString(randomartTop)
+	sb.WriteByte('\n')
+	for row := 0; row < randomartHeight; row++ {
+		sb.WriteByte('|')
+		for col := 0; col < randomartWidth; col++ {
+			switch {
+			case col == startX && row == startY:
+				sb.WriteByte('S')
+			case col == x && row == y:
+				sb.WriteByte('E')
+			default:
+				sb.WriteByte(randomartSymbols[min(field[col][row], len(randomartSymbols)-1)])
+			}
+		}
+		sb.WriteString("|\n")
+	}
+	sb.WriteString(randomartBottom)
+	return sb.String(), nil
+}
+
+// FingerprintEmoji encodes the first 48 bits of the fingerprint's digest as
+// FingerprintEmojiCount space-separated emoji, 6 bits each, most significant
+// first, from a fixed table of 64.
+func FingerprintEmoji(fingerprint string) (string, error) {
+	digest, err := fingerprintDigest(fingerprint)
+	if err != nil {
+		return "", err
+	}
+	var bits uint64
+	for _, b := range digest[:FingerprintEmojiCount*6/8] {
+		bits = bits<<8 | uint64(b)
+	}
+	emoji := make([]string, FingerprintEmojiCount)
+	for i := range emoji {
+		shift := uint(6 * (FingerprintEmojiCount - 1 - i))
+		emoji[i] = fingerprintEmoji[(bits>>shift)&0x3f]
+	}
+	return strings.Join(emoji, " "), nil
+}
+
+func fingerprintDigest(fingerprint string) ([]byte, error) {
+	encoded, ok := strings.CutPrefix(fingerprint, "sha256:")
+	if !ok {
+		return nil, fmt.Errorf("fingerprint %q must start with sha256:", fingerprint)
+	}
+	digest, err := hex.DecodeString(encoded)
+	if err != nil || len(digest) != 32 {
+		return nil, fmt.Errorf("fingerprint %q must be sha256: followed by 64 hex digits", fingerprint)
+	}
+	return digest, nil
+}
+
+func clamp(v, lo, hi int) int {
+	return max(lo, min(v, hi))
+}
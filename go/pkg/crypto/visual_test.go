@@ -0,0 +1,77 @@
+package crypto
+
+import (
+	"strings"
+	"testing"
+)
+
+// seededFingerprint is the fingerprint of the key derived from
+// "schemapin-test-seed", see TestGenerateKeypairFromSeedIsStable.
+const seededFingerprint = "sha256:210d8e77ff7830ac26f8cd7f0d4213e83119c648cbdddc4093ed4e4614eae953"
+
+// Pinned value: vendors publish this art, so it must never change.
+const seededVisual = `+---[SchemaPin]---+
+|     .ooo=++o.   |
+|     +.**oo=o    |
+|    . *.=o++.    |
+|     . o.=o.+    |
+|        S.B=E    |
+|     .   o.*o    |
+|    . . o +.oo   |
+|     . =   o. .  |
+|      . o...     |
++----[SHA256]-----+
+🐨 🐧 🌻 🐵 🦋 🍍 🍓 🍎`
+
+func TestFingerprintVisualGolden(t *testing.T) {
+	for i := 0; i < 3; i++ {
+		visual, err := FingerprintVisual(seededFingerprint)
+		if err != nil {
+			t.Fatalf("FingerprintVisual failed: %v", err)
+		}
+		if visual != seededVisual {
+			t.Fatalf("Visual fingerprint changed:\n%s\nwant:\n%s", visual, seededVisual)
+		}
+	}
+
+	// Upper-case hex names the same key
+	visual, err := FingerprintVisual("sha256:" + strings.ToUpper(strings.TrimPrefix(seededFingerprint, "sha256:")))
+	if err != nil || visual != seededVisual {
+		t.Errorf("Expected upper-case hex to render the same art, got %v", err)
+	}
+}
+
+func TestFingerprintVisualOneByteDiffers(t *testing.T) {
+	art, _ := FingerprintRandomart(seededFingerprint)
+	emoji, _ := FingerprintEmoji(seededFingerprint)
+
+	// Flip the first and the last digest byte in turn
+	first := "sha256:de" + seededFingerprint[len("sha256:21"):]
+	last := seededFingerprint[:len(seededFingerprint)-2] + "ac"
+	for _, other := range []string{first, last} {
+		otherArt, err := FingerprintRandomart(other)
+		if err != nil {
+			t.Fatalf("FingerprintRandomart failed: %v", err)
+		}
+		if otherArt == art {
+			t.Errorf("Expected %s to draw a different grid", other)
+		}
+	}
+	if otherEmoji, _ := FingerprintEmoji(first); otherEmoji == emoji {
+		t.Error("Expected a different first byte to change the emoji")
+	}
+}
+
+func TestFingerprintVisualInvalid(t *testing.T) {
+	for _, fingerprint := range []string{
+		"",
+		"210d8e77ff7830ac26f8cd7f0d4213e83119c648cbdddc4093ed4e4614eae953",
+		"sha256:210d8e77",
+		"sha256:zz0d8e77ff7830ac26f8cd7f0d4213e83119c648cbdddc4093ed4e4614eae953",
+		"sha1:210d8e77ff7830ac26f8cd7f0d4213e83119c648cbdddc4093ed4e4614eae953",
+	} {
+		if _, err := FingerprintVisual(fingerprint); err == nil {
+			t.Errorf("Expected %q to be rejected", fingerprint)
+		}
+	}
+}
@@ -0,0 +1,262 @@
+// Building .well-known/schemapin.json documents for a chosen schema_version.
+
+package discovery
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+)
+
+// Discovery schema versions a WellKnownBuilder writes.
+const (
+	WellKnownVersion11 = "1.1"
+	WellKnownVersion12 = "1.2"
+	WellKnownVersion13 = "1.3"
+
+	// LatestWellKnownVersion is the version a WellKnownBuilder writes
+	// unless SetSchemaVersion says otherwise.
+	LatestWellKnownVersion = WellKnownVersion13
+)
+
+// wellKnownVersions are the versions a WellKnownBuilder writes. 1.3 adds
+// no discovery fields over 1.2; it is accepted so that documents can name
+// the version of the signatures they serve keys for.
+var wellKnownVersions = []string{WellKnownVersion11, WellKnownVersion12, WellKnownVersion13}
+
+// fieldVersions is the first schema_version that carries each optional
+// field. revoked_keys is part of 1.1; contact needs no version.
+var fieldVersions = map[string]string{
+	"revocation_endpoint": WellKnownVersion12,
+	"tools":               WellKnownVersion12,
+	"contact_proof":       WellKnownVersion12,
+}
+
+// WellKnownBuilder assembles a .well-known/schemapin.json document and
+// checks that the fields used are consistent with its schema_version, e.g.
+// that a document with a revocation_endpoint declares 1.2 or later.
+// Setters return the builder for chaining; their errors are reported by
+// Build and JSON.
+type WellKnownBuilder struct {
+	version       string
+	developerName string
+	publicKeyPEM  string
+	contact       string
+	contactProof  string
+	revokedKeys   []string
+	revocationURL string
+	tools         map[string]ToolKey
+	minSignedAt   string
+	errs          []error
+}
+
+// NewWellKnownBuilder returns a builder for developerName's document,
+// written as LatestWellKnownVersion.
+func NewWellKnownBuilder(developerName string) *WellKnownBuilder {
+	return &WellKnownBuilder{version: LatestWellKnownVersion, developerName: developerName}
+}
+
+// SetSchemaVersion sets the schema_version written, one of
+// WellKnownVersion11, WellKnownVersion12 and WellKnownVersion13. An empty
+// version selects LatestWellKnownVersion.
+func (b *WellKnownBuilder) SetSchemaVersion(version string) *WellKnownBuilder {
+	if version == "" {
+		version = LatestWellKnownVersion
+	}
+	b.version = version
+	return b
+}
+
+// SetPrimaryKey sets the domain-wide public key, used for every tool
+// without a key of its own.
+func (b *WellKnownBuilder) SetPrimaryKey(publicKeyPEM string) *WellKnownBuilder {
+	b.publicKeyPEM = publicKeyPEM
+	return b
+}
+
+// AddToolKey adds a key scoped to the tools under prefix (see
+// WellKnownResponse.Tools), for domains serving several publishers.
+// developerName may be empty. Tool keys need schema_version 1.2.
+func (b *WellKnownBuilder) AddToolKey(prefix, publicKeyPEM, developerName string) *WellKnownBuilder {
+	if b.tools == nil {
+		b.tools = make(map[string]ToolKey)
+	}
+	if _, ok := b.tools[prefix]; ok {
+		b.errs = append(b.errs, fmt.Errorf("tool key %q added twice", prefix))
+	}
+	b.tools[prefix] = ToolKey{PublicKeyPEM: publicKeyPEM, DeveloperName: developerName}
+	return b
+}
+
+// AddRevokedFingerprint adds a revoked key fingerprint, "sha256:<hex>", to
+// the domain-wide revoked_keys.
+func (b *WellKnownBuilder) AddRevokedFingerprint(fingerprint string) *WellKnownBuilder {
+	fingerprint = crypto.NormalizeFingerprint(fingerprint)
+	encoded, ok := strings.CutPrefix(fingerprint, "sha256:")
+	if digest, err := hex.DecodeString(encoded); !ok || err != nil || len(digest) != 32 {
+		b.errs = append(b.errs, fmt.Errorf("revoked fingerprint %q must be sha256: followed by 64 hex digits", fingerprint))
+		return b
+	}
+	b.revokedKeys = append(b.revokedKeys, fingerprint)
+	return b
+}
+
+// SetRevocationURL sets the revocation_endpoint serving the domain's
+// standalone revocation document. It needs schema_version 1.2.
+func (b *WellKnownBuilder) SetRevocationURL(revocationURL string) *WellKnownBuilder {
+	u, err := url.Parse(revocationURL)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		b.errs = append(b.errs, fmt.Errorf("revocation URL %q must be an absolute http or https URL", revocationURL))
+		return b
+	}
+	b.revocationURL = revocationURL
+	return b
+}
+
+// SetMinimumSignedAt sets minimum_signed_at, superseding every signature
+// made before t (see WellKnownResponse.Supersedes). Verifiers that predate
+// the field ignore it.
+func (b *WellKnownBuilder) SetMinimumSignedAt(t time.Time) *WellKnownBuilder {
+	b.minSignedAt = clock.Format(t)
+	return b
+}
+
+// SetContact sets the security contact, e.g. an email address.
+func (b *WellKnownBuilder) SetContact(contact string) *WellKnownBuilder {
+	b.contact = contact
+	return b
+}
+
+// SignContact adds a contact_proof for the contact, signed with the
+// private key of the primary key for domain, the domain the document is
+// served from (see CreateContactProof). Call it after SetContact. Contact
+// proofs need schema_version 1.2.
+func (b *WellKnownBuilder) SignContact(privateKeyPEM, domain string) *WellKnownBuilder {
+	if b.contact == "" {
+		b.errs = append(b.errs, fmt.Errorf("cannot sign an empty contact; call SetContact first"))
+		return b
+	}
+	proof, err := CreateContactProof(privateKeyPEM, b.contact, domain)
+	if err != nil {
+		b.errs = append(b.errs, fmt.Errorf("failed to sign contact proof: %w", err))
+		return b
+	}
+	b.contactProof = proof
+	return b
+}
+
+// Build returns the document, or every error found in it: errors from the
+// setters, a missing or malformed key, and fields newer than the
+// schema_version. Revoked fingerprints are sorted and deduplicated.
+func (b *WellKnownBuilder) Build() (*WellKnownResponse, error) {
+	errs := append([]error(nil), b.errs...)
+	if !b.versionKnown() {
+		errs = append(errs, fmt.Errorf("unsupported schema_version %q (supported: %s)", b.version, strings.Join(wellKnownVersions, ", ")))
+	}
+
+	keyManager := crypto.NewKeyManager()
+	if b.publicKeyPEM == "" {
+		errs = append(errs, fmt.Errorf("no primary key set"))
+	} else if _, err := keyManager.LoadPublicKeyPEM(b.publicKeyPEM); err != nil {
+		errs = append(errs, fmt.Errorf("invalid primary key: %w", err))
+	}
+	for _, prefix := range sortedToolPrefixes(b.tools) {
+		if _, err := keyManager.LoadPublicKeyPEM(b.tools[prefix].PublicKeyPEM); err != nil {
+			errs = append(errs, fmt.Errorf("invalid key for tools %q: %w", prefix, err))
+		}
+	}
+	if err := ValidateToolKeys(b.tools); err != nil {
+		errs = append(errs, err)
+	}
+
+	for field, set := range map[string]bool{
+		"revocation_endpoint": b.revocationURL != "",
+		"tools":               len(b.tools) > 0,
+		"contact_proof":       b.contactProof != "",
+	} {
+		if set && b.versionKnown() && CompareSchemaVersions(b.version, fieldVersions[field]) < 0 {
+			errs = append(errs, fmt.Errorf("%s requires schema_version %s or later, got %s", field, fieldVersions[field], b.version))
+		}
+	}
+	if len(errs) > 0 {
+		sortErrors(errs)
+		return nil, errors.Join(errs...)
+	}
+
+	response := &WellKnownResponse{
+		SchemaVersion:      b.version,
+		DeveloperName:      b.developerName,
+		PublicKeyPEM:       b.publicKeyPEM,
+		Contact:            b.contact,
+		ContactProof:       b.contactProof,
+		RevokedKeys:        sortedUnique(b.revokedKeys),
+		RevocationEndpoint: b.revocationURL,
+		Tools:              b.tools,
+		MinimumSignedAt:    b.minSignedAt,
+	}
+	if !ValidateWellKnownResponse(response) {
+		return nil, fmt.Errorf("built an invalid .well-known response")
+	}
+	return response, nil
+}
+
+// JSON returns the document built by Build as indented JSON with a
+// trailing newline. The same builder calls always produce the same bytes.
+func (b *WellKnownBuilder) JSON() ([]byte, error) {
+	response, err := b.Build()
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(response, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal .well-known response: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+func (b *WellKnownBuilder) versionKnown() bool {
+	for _, version := range wellKnownVersions {
+		if b.version == version {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedToolPrefixes(tools map[string]ToolKey) []string {
+	prefixes := make([]string, 0, len(tools))
+	for prefix := range tools {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	return prefixes
+}
+
+func sortedUnique(values []string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+	sorted := append([]string(nil), values...)
+	sort.Strings(sorted)
+	unique := sorted[:1]
+	for _, v := range sorted[1:] {
+		if v != unique[len(unique)-1] {
+			unique = append(unique, v)
+		}
+	}
+	return unique
+}
+
+// sortErrors orders errs by message, so that errors found while ranging
+// over a map are reported the same way every time.
+func sortErrors(errs []error) {
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+}
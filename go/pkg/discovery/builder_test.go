@@ -0,0 +1,148 @@
+package discovery
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testRevokedFingerprint = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func TestWellKnownBuilderRoundTrip(t *testing.T) {
+	privateKeyPEM, publicKeyPEM := generateContactKeys(t)
+	_, toolKeyPEM := generateContactKeys(t)
+
+	for _, version := range []string{WellKnownVersion11, WellKnownVersion12, WellKnownVersion13} {
+		t.Run(version, func(t *testing.T) {
+			builder := NewWellKnownBuilder("Acme").
+				SetSchemaVersion(version).
+				SetPrimaryKey(publicKeyPEM).
+				SetContact("security@acme.example").
+				AddRevokedFingerprint(testRevokedFingerprint)
+			newer := CompareSchemaVersions(version, WellKnownVersion12) >= 0
+			if newer {
+				builder.SetRevocationURL("https://acme.example/.well-known/schemapin-revocations.json").
+					AddToolKey("acme/search", toolKeyPEM, "Acme Search").
+					SignContact(privateKeyPEM, "acme.example")
+			}
+			want, err := builder.Build()
+			if err != nil {
+				t.Fatalf("Build failed: %v", err)
+			}
+			data, err := builder.JSON()
+			if err != nil {
+				t.Fatalf("JSON failed: %v", err)
+			}
+
+			var got WellKnownResponse
+			if err := json.Unmarshal(data, &got); err != nil {
+				t.Fatalf("Failed to parse built JSON: %v", err)
+			}
+			if !ValidateWellKnownResponse(&got) {
+				t.Fatalf("Expected the built document to validate:\n%s", data)
+			}
+			if !reflect.DeepEqual(&got, want) {
+				t.Errorf("Round trip changed the document:\ngot  %+v\nwant %+v", got, *want)
+			}
+			if got.SchemaVersion != version {
+				t.Errorf("Expected schema_version %s, got %s", version, got.SchemaVersion)
+			}
+			if newer {
+				if !got.ContactVerified("acme.example") {
+					t.Error("Expected the signed contact to verify")
+				}
+				if scoped := got.KeyForTool("acme/search/query"); scoped.Scope != "acme/search" {
+					t.Errorf("Expected the tool key to be selected, got scope %q", scoped.Scope)
+				}
+			}
+		})
+	}
+}
+
+func TestWellKnownBuilderDefaultsToLatest(t *testing.T) {
+	_, publicKeyPEM := generateContactKeys(t)
+	response, err := NewWellKnownBuilder("Acme").SetPrimaryKey(publicKeyPEM).Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if response.SchemaVersion != LatestWellKnownVersion {
+		t.Errorf("Expected schema_version %s, got %s", LatestWellKnownVersion, response.SchemaVersion)
+	}
+}
+
+func TestWellKnownBuilderDeterministic(t *testing.T) {
+	_, publicKeyPEM := generateContactKeys(t)
+	_, keyA := generateContactKeys(t)
+	_, keyB := generateContactKeys(t)
+	other := "sha256:" + strings.Repeat("f", 64)
+
+	first, err := NewWellKnownBuilder("Acme").SetPrimaryKey(publicKeyPEM).
+		AddToolKey("a", keyA, "").AddToolKey("b", keyB, "").
+		AddRevokedFingerprint(testRevokedFingerprint).AddRevokedFingerprint(other).
+		JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewWellKnownBuilder("Acme").SetPrimaryKey(publicKeyPEM).
+		AddRevokedFingerprint(strings.ToUpper(other)).AddRevokedFingerprint(testRevokedFingerprint).
+		AddRevokedFingerprint(other).
+		AddToolKey("b", keyB, "").AddToolKey("a", keyA, "").
+		JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first, second) {
+		t.Errorf("Expected identical JSON:\n%s\n%s", first, second)
+	}
+}
+
+func TestWellKnownBuilderErrors(t *testing.T) {
+	privateKeyPEM, publicKeyPEM := generateContactKeys(t)
+	_, toolKeyPEM := generateContactKeys(t)
+
+	tests := []struct {
+		name    string
+		builder *WellKnownBuilder
+		wantErr string
+	}{
+		{"no key", NewWellKnownBuilder("Acme"), "no primary key"},
+		{"bad key", NewWellKnownBuilder("Acme").SetPrimaryKey("not a key"), "invalid primary key"},
+		{"unknown version", NewWellKnownBuilder("Acme").SetPrimaryKey(publicKeyPEM).SetSchemaVersion("2.0"), "unsupported schema_version"},
+		{"bad fingerprint", NewWellKnownBuilder("Acme").SetPrimaryKey(publicKeyPEM).AddRevokedFingerprint("sha256:abc"), "64 hex digits"},
+		{"bad revocation URL", NewWellKnownBuilder("Acme").SetPrimaryKey(publicKeyPEM).SetRevocationURL("/revocations.json"), "absolute http or https URL"},
+		{"unsigned contact", NewWellKnownBuilder("Acme").SetPrimaryKey(publicKeyPEM).SignContact(privateKeyPEM, "acme.example"), "empty contact"},
+		{"duplicate tool key", NewWellKnownBuilder("Acme").SetPrimaryKey(publicKeyPEM).AddToolKey("acme", toolKeyPEM, "").AddToolKey("acme", toolKeyPEM, ""), "added twice"},
+		{"bad tool key", NewWellKnownBuilder("Acme").SetPrimaryKey(publicKeyPEM).AddToolKey("acme", "not a key", ""), "invalid key for tools"},
+		{
+			"revocation URL in 1.1",
+			NewWellKnownBuilder("Acme").SetSchemaVersion(WellKnownVersion11).SetPrimaryKey(publicKeyPEM).
+				SetRevocationURL("https://acme.example/revocations.json"),
+			"revocation_endpoint requires schema_version 1.2 or later, got 1.1",
+		},
+		{
+			"tool keys in 1.1",
+			NewWellKnownBuilder("Acme").SetSchemaVersion(WellKnownVersion11).SetPrimaryKey(publicKeyPEM).
+				AddToolKey("acme", toolKeyPEM, ""),
+			"tools requires schema_version 1.2",
+		},
+		{
+			"contact proof in 1.1",
+			NewWellKnownBuilder("Acme").SetSchemaVersion(WellKnownVersion11).SetPrimaryKey(publicKeyPEM).
+				SetContact("security@acme.example").SignContact(privateKeyPEM, "acme.example"),
+			"contact_proof requires schema_version 1.2",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.builder.Build()
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected an error containing %q, got %v", tt.wantErr, err)
+			}
+			if _, err := tt.builder.JSON(); err == nil {
+				t.Error("Expected JSON to fail too")
+			}
+		})
+	}
+}
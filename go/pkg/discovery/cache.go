@@ -0,0 +1,42 @@
+package discovery
+
+import (
+	"time"
+)
+
+// CachedDocument is the last .well-known document fetched for a domain,
+// as kept by a DocumentCache.
+type CachedDocument struct {
+	Domain string `json:"domain"`
+	// SourceURL is the URL the document was finally served from.
+	SourceURL string             `json:"source_url,omitempty"`
+	FetchedAt time.Time          `json:"fetched_at"`
+	Document  *WellKnownResponse `json:"document"`
+}
+
+// DocumentCache keeps the last .well-known document fetched for each
+// domain, so that operators can later see what a domain served.
+// pinning.KeyPinning implements it in the pinning database.
+type DocumentCache interface {
+	// LoadDiscoveryDocument returns the document cached for domain, or nil.
+	LoadDiscoveryDocument(domain string) (*CachedDocument, error)
+	// StoreDiscoveryDocument replaces the document cached for its domain.
+	StoreDiscoveryDocument(doc CachedDocument) error
+}
+
+// DocumentLister is implemented by document caches that can list the
+// documents they hold.
+type DocumentLister interface {
+	// ListDiscoveryDocuments returns every cached document, ordered by
+	// domain.
+	ListDiscoveryDocuments() ([]CachedDocument, error)
+}
+
+// WithDocumentCache records every .well-known document fetched in cache,
+// with the time it was fetched. Failing to record one is logged and does
+// not fail discovery. By default documents are not kept.
+func WithDocumentCache(cache DocumentCache) Option {
+	return func(p *PublicKeyDiscovery) {
+		p.documents = cache
+	}
+}
@@ -0,0 +1,161 @@
+package discovery
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+)
+
+// CircuitBreakerPolicy stops discovery from contacting a host that keeps
+// failing, so that verifications against a domain that is down fail fast
+// instead of each waiting out the full timeout.
+//
+// After FailureThreshold consecutive failures the host's circuit opens and
+// requests fail with a *CircuitOpenError for CoolDown. The next request is
+// then let through as a trial (half-open): success closes the circuit,
+// failure opens it for another CoolDown. Only outages count as failures:
+// network errors and 408, 429 and 5xx responses. A 404 or an invalid
+// document is an answer from a working server.
+type CircuitBreakerPolicy struct {
+	// FailureThreshold is the number of consecutive failures that open a
+	// host's circuit.
+	FailureThreshold int
+	// CoolDown is how long an open circuit refuses requests.
+	CoolDown time.Duration
+}
+
+// WithCircuitBreaker enables a per-host circuit breaker. By default
+// discovery has none.
+func WithCircuitBreaker(policy CircuitBreakerPolicy) Option {
+	return func(p *PublicKeyDiscovery) {
+		if policy.FailureThreshold <= 0 {
+			p.breaker = nil
+			return
+		}
+		p.breaker = &circuitBreaker{policy: policy, circuits: make(map[string]*circuit)}
+	}
+}
+
+// CircuitOpenError is returned, without contacting the domain, while the
+// domain's circuit is open.
+type CircuitOpenError struct {
+	Domain string
+	// RetryAfter is how long until a trial request is let through. It is
+	// zero while a trial request is already in flight.
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	if e.RetryAfter <= 0 {
+		return fmt.Sprintf("discovery circuit for %s is open; a trial request is in progress", e.Domain)
+	}
+	return fmt.Sprintf("discovery circuit for %s is open after repeated failures; retry after %s", e.Domain, e.RetryAfter.Round(time.Millisecond))
+}
+
+// Is matches schemaerr.ErrDiscoveryCircuitOpen.
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == schemaerr.ErrDiscoveryCircuitOpen
+}
+
+// CircuitState is the state of a host's circuit.
+type CircuitState string
+
+const (
+	CircuitClosed   CircuitState = "closed"
+	CircuitOpen     CircuitState = "open"
+	CircuitHalfOpen CircuitState = "half_open"
+)
+
+type circuitBreaker struct {
+	policy   CircuitBreakerPolicy
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+type circuit struct {
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	trial    bool
+}
+
+// allow reports whether a request to host may be made at now. When an
+// open circuit's cool-down has passed, the caller's request becomes the
+// half-open trial. Otherwise retryAfter is the time left in the cool-down.
+func (b *circuitBreaker) allow(host string, now time.Time) (retryAfter time.Duration, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.circuits[host]
+	if c == nil {
+		return 0, true
+	}
+	switch c.state {
+	case CircuitOpen:
+		if remaining := c.openedAt.Add(b.policy.CoolDown).Sub(now); remaining > 0 {
+			return remaining, false
+		}
+		c.state, c.trial = CircuitHalfOpen, true
+		return 0, true
+	case CircuitHalfOpen:
+		if c.trial {
+			return 0, false
+		}
+		c.trial = true
+		return 0, true
+	}
+	return 0, true
+}
+
+// record updates host's circuit with the outcome of a request allowed at
+// now and returns the state it moved to, or "" if it did not change.
+func (b *circuitBreaker) record(host string, failed bool, now time.Time) CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.circuits[host]
+	if !failed {
+		if c == nil {
+			return ""
+		}
+		// Forget healthy hosts so the map only holds failing ones
+		delete(b.circuits, host)
+		if c.state == CircuitClosed {
+			return ""
+		}
+		return CircuitClosed
+	}
+
+	if c == nil {
+		c = &circuit{state: CircuitClosed}
+		b.circuits[host] = c
+	}
+	c.failures++
+	if c.state == CircuitHalfOpen || c.failures >= b.policy.FailureThreshold {
+		c.state, c.openedAt, c.trial, c.failures = CircuitOpen, now, false, 0
+		return CircuitOpen
+	}
+	return ""
+}
+
+// release gives up a half-open trial whose outcome says nothing about the
+// host, such as one canceled by the caller, so that another may be made.
+func (b *circuitBreaker) release(host string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c := b.circuits[host]; c != nil && c.state == CircuitHalfOpen {
+		c.trial = false
+	}
+}
+
+// state returns host's current circuit state.
+func (b *circuitBreaker) state(host string) CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if c := b.circuits[host]; c != nil {
+		return c.state
+	}
+	return CircuitClosed
+}
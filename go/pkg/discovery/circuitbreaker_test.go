@@ -0,0 +1,138 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+)
+
+func TestCircuitBreakerTransitions(t *testing.T) {
+	var failing atomic.Bool
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(WellKnownResponse{SchemaVersion: "1.2", PublicKeyPEM: "-----BEGIN PUBLIC KEY-----"})
+	}))
+	defer server.Close()
+
+	fake := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	d := NewPublicKeyDiscovery(WithClock(fake), WithCircuitBreaker(CircuitBreakerPolicy{FailureThreshold: 3, CoolDown: time.Minute}))
+	fetch := func() error {
+		_, err := d.FetchDiscovery(context.Background(), server.URL)
+		return err
+	}
+	expectState := func(step string, want CircuitState) {
+		t.Helper()
+		if got := d.CircuitState(server.URL); got != want {
+			t.Fatalf("%s: expected circuit %s, got %s", step, want, got)
+		}
+	}
+
+	// Consecutive failures below the threshold reach the server
+	failing.Store(true)
+	for i := 0; i < 3; i++ {
+		if err := fetch(); !errors.Is(err, schemaerr.ErrDiscoveryFailed) {
+			t.Fatalf("Expected ErrDiscoveryFailed from the server, got %v", err)
+		}
+	}
+	expectState("after threshold", CircuitOpen)
+
+	// Open: requests fail fast without contacting the server
+	fake.Advance(30 * time.Second)
+	err := fetch()
+	var openErr *CircuitOpenError
+	if !errors.Is(err, schemaerr.ErrDiscoveryCircuitOpen) || !errors.As(err, &openErr) {
+		t.Fatalf("Expected CircuitOpenError, got %v", err)
+	}
+	if openErr.RetryAfter != 30*time.Second {
+		t.Errorf("Expected RetryAfter 30s, got %s", openErr.RetryAfter)
+	}
+	if requests.Load() != 3 {
+		t.Errorf("Expected no request while open, got %d requests", requests.Load())
+	}
+
+	// Half-open: one trial after the cool-down; its failure reopens
+	fake.Advance(30 * time.Second)
+	if err := fetch(); !errors.Is(err, schemaerr.ErrDiscoveryFailed) {
+		t.Fatalf("Expected the trial request to reach the server, got %v", err)
+	}
+	expectState("after failed trial", CircuitOpen)
+	if err := fetch(); !errors.Is(err, schemaerr.ErrDiscoveryCircuitOpen) {
+		t.Fatalf("Expected the circuit to reopen, got %v", err)
+	}
+
+	// A successful trial closes the circuit
+	fake.Advance(time.Minute)
+	failing.Store(false)
+	if err := fetch(); err != nil {
+		t.Fatalf("Expected the trial request to succeed, got %v", err)
+	}
+	expectState("after successful trial", CircuitClosed)
+	if err := fetch(); err != nil {
+		t.Fatalf("Expected requests to flow once closed, got %v", err)
+	}
+
+	stats := d.ProtectionStats()
+	if stats.CircuitOpened != 2 || stats.CircuitClosed != 1 || stats.CircuitRejected != 2 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	if requests.Load() != 6 {
+		t.Errorf("Expected 6 requests to reach the server, got %d", requests.Load())
+	}
+}
+
+func TestCircuitBreakerHalfOpenAllowsOneTrial(t *testing.T) {
+	b := &circuitBreaker{policy: CircuitBreakerPolicy{FailureThreshold: 1, CoolDown: time.Second}, circuits: make(map[string]*circuit)}
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	if state := b.record("example.com", true, now); state != CircuitOpen {
+		t.Fatalf("Expected the circuit to open, got %q", state)
+	}
+	now = now.Add(time.Second)
+	if _, ok := b.allow("example.com", now); !ok {
+		t.Fatal("Expected a trial request after the cool-down")
+	}
+	if _, ok := b.allow("example.com", now); ok {
+		t.Fatal("Expected a second request to wait for the trial")
+	}
+
+	// A trial canceled by the caller lets another through
+	b.release("example.com")
+	if _, ok := b.allow("example.com", now); !ok {
+		t.Fatal("Expected a new trial after the first was released")
+	}
+	if _, ok := b.allow("other.example", now); !ok {
+		t.Error("Expected other hosts to be unaffected")
+	}
+}
+
+func TestCircuitBreakerIgnoresAnswers(t *testing.T) {
+	for _, status := range []int{http.StatusNotFound, http.StatusForbidden} {
+		var requests atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests.Add(1)
+			w.WriteHeader(status)
+		}))
+
+		d := NewPublicKeyDiscovery(WithCircuitBreaker(CircuitBreakerPolicy{FailureThreshold: 1, CoolDown: time.Hour}))
+		for i := 0; i < 3; i++ {
+			_, _ = d.FetchDiscovery(context.Background(), server.URL)
+		}
+		if requests.Load() != 3 || d.CircuitState(server.URL) != CircuitClosed {
+			t.Errorf("Expected %d responses not to open the circuit, got %d requests and state %s", status, requests.Load(), d.CircuitState(server.URL))
+		}
+		server.Close()
+	}
+}
@@ -0,0 +1,54 @@
+// Contact proofs: a developer's signature binding the contact published in
+// .well-known/schemapin.json to the signing key and domain.
+
+package discovery
+
+import (
+	"strings"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+)
+
+// ContactProofMessage returns the string a contact_proof signs:
+// "schemapin-contact:<contact>:<domain>", where domain is the lowercase
+// host name the document is served from, without scheme or port, followed
+// by the path prefix of a tenant's document (see core.NormalizeDomain).
+func ContactProofMessage(contact, domain string) string {
+	return "schemapin-contact:" + contact + ":" + contactProofDomain(domain)
+}
+
+// contactProofDomain reduces a domain as passed to FetchDiscovery, which
+// may carry a scheme and port, to its identity.
+func contactProofDomain(domain string) string {
+	identity, err := core.NormalizeDomain(domain)
+	if err != nil {
+		return strings.ToLower(domain)
+	}
+	return identity
+}
+
+// CreateContactProof signs ContactProofMessage(contact, domain) with the
+// developer's private key, for the contact_proof field.
+func CreateContactProof(privateKeyPEM, contact, domain string) (string, error) {
+	privateKey, err := crypto.NewKeyManager().LoadPrivateKeyPEM(privateKeyPEM)
+	if err != nil {
+		return "", err
+	}
+	return crypto.NewSignatureManager().SignHash([]byte(ContactProofMessage(contact, domain)), privateKey)
+}
+
+// ContactVerified reports whether the document's contact_proof is a valid
+// signature by its domain-wide public key over its contact for domain. A
+// document without a contact or proof is not verified; callers should
+// treat that as a warning, not a failure.
+func (w *WellKnownResponse) ContactVerified(domain string) bool {
+	if w.Contact == "" || w.ContactProof == "" {
+		return false
+	}
+	publicKey, err := crypto.NewKeyManager().LoadPublicKeyPEM(w.PublicKeyPEM)
+	if err != nil {
+		return false
+	}
+	return crypto.NewSignatureManager().VerifySignature([]byte(ContactProofMessage(w.Contact, domain)), w.ContactProof, publicKey)
+}
@@ -0,0 +1,102 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+)
+
+func generateContactKeys(t *testing.T) (string, string) {
+	t.Helper()
+	keyManager := crypto.NewKeyManager()
+	privateKey, err := keyManager.GenerateKeypair()
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	privateKeyPEM, _ := keyManager.ExportPrivateKeyPEM(privateKey)
+	publicKeyPEM, _ := keyManager.ExportPublicKeyPEM(&privateKey.PublicKey)
+	return privateKeyPEM, publicKeyPEM
+}
+
+func TestContactProofMessage(t *testing.T) {
+	for _, domain := range []string{"example.com", "EXAMPLE.com", "https://example.com", "example.com:8443"} {
+		if got := ContactProofMessage("dev@example.com", domain); got != "schemapin-contact:dev@example.com:example.com" {
+			t.Errorf("ContactProofMessage(%q) = %q", domain, got)
+		}
+	}
+}
+
+func TestContactVerified(t *testing.T) {
+	privateKeyPEM, publicKeyPEM := generateContactKeys(t)
+	_, otherPublicKeyPEM := generateContactKeys(t)
+	proof, err := CreateContactProof(privateKeyPEM, "dev@example.com", "example.com")
+	if err != nil {
+		t.Fatalf("Failed to create contact proof: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		response WellKnownResponse
+		domain   string
+		expected bool
+	}{
+		{"valid proof", WellKnownResponse{PublicKeyPEM: publicKeyPEM, Contact: "dev@example.com", ContactProof: proof}, "example.com", true},
+		{"tampered contact", WellKnownResponse{PublicKeyPEM: publicKeyPEM, Contact: "attacker@example.net", ContactProof: proof}, "example.com", false},
+		{"other domain", WellKnownResponse{PublicKeyPEM: publicKeyPEM, Contact: "dev@example.com", ContactProof: proof}, "example.org", false},
+		{"other key", WellKnownResponse{PublicKeyPEM: otherPublicKeyPEM, Contact: "dev@example.com", ContactProof: proof}, "example.com", false},
+		{"legacy document without proof", WellKnownResponse{PublicKeyPEM: publicKeyPEM, Contact: "dev@example.com"}, "example.com", false},
+		{"malformed proof", WellKnownResponse{PublicKeyPEM: publicKeyPEM, Contact: "dev@example.com", ContactProof: "not-base64!"}, "example.com", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.response.ContactVerified(tt.domain); got != tt.expected {
+				t.Errorf("ContactVerified() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDeveloperInfoContactVerified(t *testing.T) {
+	privateKeyPEM, publicKeyPEM := generateContactKeys(t)
+
+	var response WellKnownResponse
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	defer server.Close()
+
+	proof, err := CreateContactProof(privateKeyPEM, "dev@example.com", server.URL)
+	if err != nil {
+		t.Fatalf("Failed to create contact proof: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		response WellKnownResponse
+		expected string
+	}{
+		{"valid proof", WellKnownResponse{PublicKeyPEM: publicKeyPEM, Contact: "dev@example.com", ContactProof: proof}, "true"},
+		{"tampered contact", WellKnownResponse{PublicKeyPEM: publicKeyPEM, Contact: "attacker@example.net", ContactProof: proof}, "false"},
+		{"legacy document", WellKnownResponse{PublicKeyPEM: publicKeyPEM, Contact: "dev@example.com"}, "false"},
+		{"no contact", WellKnownResponse{PublicKeyPEM: publicKeyPEM}, ""},
+	}
+	discovery := NewPublicKeyDiscovery()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response = tt.response
+			response.SchemaVersion, response.DeveloperName = "1.2", "Contact Dev"
+			wellKnown, err := discovery.FetchWellKnown(context.Background(), server.URL)
+			if err != nil {
+				t.Fatalf("Failed to fetch .well-known: %v", err)
+			}
+			if got := wellKnown.DeveloperInfo()["contact_verified"]; got != tt.expected {
+				t.Errorf("contact_verified = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
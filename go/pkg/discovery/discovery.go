@@ -4,52 +4,289 @@ package discovery
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/ThirdKeyAi/schemapin/go/internal/logging"
+	"github.com/ThirdKeyAi/schemapin/go/internal/version"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/requestid"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/revocation"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
 )
 
 // WellKnownResponse represents .well-known/schemapin.json structure
 type WellKnownResponse struct {
-	SchemaVersion      string   `json:"schema_version"`
-	DeveloperName      string   `json:"developer_name"`
-	PublicKeyPEM       string   `json:"public_key_pem"`
-	Contact            string   `json:"contact,omitempty"`
+	SchemaVersion string `json:"schema_version"`
+	DeveloperName string `json:"developer_name"`
+	PublicKeyPEM  string `json:"public_key_pem"`
+	Contact       string `json:"contact,omitempty"`
+	// ContactProof is the developer's signature over Contact (see
+	// ContactProofMessage), showing that whoever holds the key published
+	// the contact.
+	ContactProof       string   `json:"contact_proof,omitempty"`
 	RevokedKeys        []string `json:"revoked_keys,omitempty"`
 	RevocationEndpoint string   `json:"revocation_endpoint,omitempty"`
+	// Tools optionally maps tool-path prefixes (e.g. "acme" or
+	// "acme/search") to keys scoped to the tools under that path, so that
+	// independent publishers sharing a domain cannot sign for each other.
+	Tools map[string]ToolKey `json:"tools,omitempty"`
+	// MinimumSignedAt optionally declares, as an RFC 3339 timestamp, that
+	// every signature the developer made before it is superseded, e.g.
+	// after withdrawing schemas with a dangerous parameter. See
+	// Supersedes.
+	MinimumSignedAt string `json:"minimum_signed_at,omitempty"`
+	// SourceURL is the URL the document was finally fetched from, after
+	// any redirects. It is empty for documents not fetched over HTTP.
+	SourceURL string `json:"-"`
+	// Domain is the domain the document was fetched for, which its
+	// contact_proof is checked against. FetchDiscovery sets it.
+	Domain string `json:"-"`
 }
 
-// PublicKeyDiscovery handles .well-known endpoint discovery
+// ToolKey is a per-tool key block in WellKnownResponse.Tools.
+type ToolKey struct {
+	PublicKeyPEM  string   `json:"public_key_pem"`
+	DeveloperName string   `json:"developer_name,omitempty"`
+	RevokedKeys   []string `json:"revoked_keys,omitempty"`
+}
+
+// ScopedKey is the key selected for a tool by KeyForTool.
+type ScopedKey struct {
+	PublicKeyPEM  string
+	DeveloperName string
+	// RevokedKeys combines the domain-wide revocation list with the
+	// tool-scoped one; a key revoked at either level is revoked.
+	RevokedKeys []string
+	// Scope is the matching Tools prefix, or empty for the domain-wide key.
+	Scope string
+}
+
+// normalizeToolPath trims surrounding slashes so that "/acme/" and "acme"
+// name the same scope.
+func normalizeToolPath(path string) string {
+	return strings.Trim(path, "/")
+}
+
+// KeyForTool selects the key for toolID: the Tools entry with the longest
+// prefix matching toolID on path-segment boundaries ("acme" matches
+// "acme/search" but not "acmecorp"), falling back to the domain-wide key.
+func (w *WellKnownResponse) KeyForTool(toolID string) *ScopedKey {
+	toolPath := normalizeToolPath(toolID)
+
+	bestPrefix := ""
+	var best ToolKey
+	for prefix, key := range w.Tools {
+		prefix = normalizeToolPath(prefix)
+		if prefix == "" || len(prefix) <= len(bestPrefix) {
+			continue
+		}
+		if toolPath == prefix || strings.HasPrefix(toolPath, prefix+"/") {
+			bestPrefix, best = prefix, key
+		}
+	}
+
+	if bestPrefix == "" {
+		return &ScopedKey{
+			PublicKeyPEM:  w.PublicKeyPEM,
+			DeveloperName: w.DeveloperName,
+			RevokedKeys:   w.RevokedKeys,
+		}
+	}
+
+	developerName := best.DeveloperName
+	if developerName == "" {
+		developerName = w.DeveloperName
+	}
+	revoked := make([]string, 0, len(w.RevokedKeys)+len(best.RevokedKeys))
+	revoked = append(revoked, w.RevokedKeys...)
+	revoked = append(revoked, best.RevokedKeys...)
+	return &ScopedKey{
+		PublicKeyPEM:  best.PublicKeyPEM,
+		DeveloperName: developerName,
+		RevokedKeys:   revoked,
+		Scope:         bestPrefix,
+	}
+}
+
+// HTTPStatusError is returned when a .well-known endpoint answers with a
+// non-200 status. Callers can use errors.As to inspect StatusCode, e.g. to
+// treat 404 as "domain does not publish SchemaPin" rather than a hard failure.
+//
+// RetryAfter carries the server's Retry-After hint (delta-seconds or
+// HTTP-date) for 429 and 503 responses; it is zero when absent or invalid.
+type HTTPStatusError struct {
+	StatusCode int
+	RetryAfter time.Duration
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d", e.StatusCode)
+}
+
+// Is matches schemaerr.ErrDiscoveryNotFound for 404 and 410 responses and
+// schemaerr.ErrDiscoveryFailed for any other status.
+func (e *HTTPStatusError) Is(target error) bool {
+	if e.StatusCode == http.StatusNotFound || e.StatusCode == http.StatusGone {
+		return target == schemaerr.ErrDiscoveryNotFound
+	}
+	return target == schemaerr.ErrDiscoveryFailed
+}
+
+// Discoverer is the discovery a verification workflow consumes: fetching
+// a domain's .well-known document and the revocation document it points
+// to. PublicKeyDiscovery implements it over HTTP; package discoverytest
+// provides an in-memory stub for tests. Implementations must be safe for
+// concurrent use, and errors should be *schemaerr.Error values of the
+// discovery kinds so that workflows can classify them.
+type Discoverer interface {
+	// FetchDiscovery returns domain's .well-known document.
+	FetchDiscovery(ctx context.Context, domain string) (*WellKnownResponse, error)
+	// RevocationDocument returns the document at wellKnown's
+	// revocation_endpoint, or nil if it names none.
+	RevocationDocument(ctx context.Context, wellKnown *WellKnownResponse) (*revocation.RevocationDocument, error)
+}
+
+var _ Discoverer = (*PublicKeyDiscovery)(nil)
+
+// PublicKeyDiscovery handles .well-known endpoint discovery. It is safe for
+// concurrent use: its options are fixed when it is created, and the rate
+// limiter, circuit breaker and counters synchronize their own state.
 type PublicKeyDiscovery struct {
-	client     *http.Client
-	keyManager *crypto.KeyManager
+	client         *http.Client
+	keyManager     *crypto.KeyManager
+	logger         *slog.Logger
+	clock          clock.Clock
+	redirectPolicy RedirectPolicy
+	tlsPins        tlsPinSet
+	rateLimiter    *rateLimiter
+	breaker        *circuitBreaker
+	stats          protectionCounters
+	userAgent      string
+	revocations    revocation.Cache
+	documents      DocumentCache
+	transport      transportConfig
+	// maxResponseBytes caps the documents read, see WithMaxResponseBytes
+	maxResponseBytes int64
 }
 
-// NewPublicKeyDiscovery creates a new PublicKeyDiscovery instance
-func NewPublicKeyDiscovery() *PublicKeyDiscovery {
-	return &PublicKeyDiscovery{
-		client: &http.Client{
-			Timeout: 10 * time.Second,
-		},
-		keyManager: crypto.NewKeyManager(),
+// Option configures a PublicKeyDiscovery.
+type Option func(*PublicKeyDiscovery)
+
+// WithLogger routes discovery diagnostics to logger. By default nothing is
+// logged.
+func WithLogger(logger *slog.Logger) Option {
+	return func(p *PublicKeyDiscovery) {
+		p.logger = logging.OrDiscard(logger)
+	}
+}
+
+// WithClock sets the time source for rate limiting and circuit breaking.
+// The default is clock.Real.
+func WithClock(c clock.Clock) Option {
+	return func(p *PublicKeyDiscovery) {
+		p.clock = clock.OrReal(c)
+	}
+}
+
+// WithHTTPClient makes discovery use a copy of client, e.g. to route
+// requests through a proxy or a custom transport. The copy's CheckRedirect
+// is replaced by the redirect policy, and with WithTLSPins its transport is
+// wrapped so the pins still apply. A client without a transport gets
+// discovery's own (see WithMaxIdleConnsPerHost), and one without a timeout
+// gets discovery's, so no request can hang indefinitely.
+func WithHTTPClient(client *http.Client) Option {
+	return func(p *PublicKeyDiscovery) {
+		if client == nil {
+			return
+		}
+		c := *client
+		p.client = &c
 	}
 }
 
+// WithUserAgentSuffix appends suffix to the User-Agent sent on discovery
+// requests, e.g. "acme-gateway/2.1" for
+// "schemapin-go/<version> acme-gateway/2.1", so that domains can tell
+// embedders apart in their logs.
+func WithUserAgentSuffix(suffix string) Option {
+	return func(p *PublicKeyDiscovery) {
+		if suffix = strings.TrimSpace(suffix); suffix != "" {
+			p.userAgent = version.UserAgent() + " " + suffix
+		}
+	}
+}
+
+// WithRevocationCache keeps the documents fetched from revocation
+// endpoints in cache, e.g. a pinning.KeyPinning so that they outlive the
+// process. By default they are kept in memory.
+func WithRevocationCache(cache revocation.Cache) Option {
+	return func(p *PublicKeyDiscovery) {
+		if cache != nil {
+			p.revocations = cache
+		}
+	}
+}
+
+// UserAgent returns the User-Agent sent on discovery requests, for other
+// requests made on the same verification's behalf.
+func (p *PublicKeyDiscovery) UserAgent() string {
+	return p.userAgent
+}
+
+// NewPublicKeyDiscovery creates a new PublicKeyDiscovery instance
+func NewPublicKeyDiscovery(opts ...Option) *PublicKeyDiscovery {
+	return NewPublicKeyDiscoveryWithTimeout(10*time.Second, opts...)
+}
+
 // NewPublicKeyDiscoveryWithTimeout creates a new PublicKeyDiscovery instance with custom timeout
-func NewPublicKeyDiscoveryWithTimeout(timeout time.Duration) *PublicKeyDiscovery {
-	return &PublicKeyDiscovery{
+func NewPublicKeyDiscoveryWithTimeout(timeout time.Duration, opts ...Option) *PublicKeyDiscovery {
+	p := &PublicKeyDiscovery{
 		client: &http.Client{
 			Timeout: timeout,
 		},
-		keyManager: crypto.NewKeyManager(),
+		keyManager:     crypto.NewKeyManager(),
+		logger:         logging.Discard(),
+		clock:          clock.Real,
+		redirectPolicy: DefaultRedirectPolicy(),
+		userAgent:      version.UserAgent(),
+		revocations:    revocation.NewMemoryCache(),
+		transport:      defaultTransportConfig,
+
+		maxResponseBytes: DefaultMaxResponseBytes,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	p.client.CheckRedirect = p.redirectPolicy.CheckRedirect
+	if p.client.Timeout <= 0 {
+		p.client.Timeout = timeout
+	}
+	if p.client.Transport == nil {
+		p.client.Transport = p.transport.newOrShared()
+	}
+	if len(p.tlsPins) > 0 {
+		p.client.Transport = p.tlsPins.transport(p.client.Transport)
 	}
+	return p
 }
 
-// ConstructWellKnownURL constructs the .well-known URL for a domain
+// ConstructWellKnownURL constructs the .well-known URL for a domain. A
+// domain with a path prefix, such as "platform.example/tenants/acme", has
+// its document under the prefix:
+// https://platform.example/tenants/acme/.well-known/schemapin.json. The
+// domain is not validated; FetchDiscovery rejects one that
+// core.NormalizeDomain does not accept.
 func ConstructWellKnownURL(domain string) string {
 	// Handle domains with or without protocol
 	if !strings.HasPrefix(domain, "http://") && !strings.HasPrefix(domain, "https://") {
@@ -62,7 +299,8 @@ func ConstructWellKnownURL(domain string) string {
 		return fmt.Sprintf("https://%s/.well-known/schemapin.json", strings.TrimPrefix(strings.TrimPrefix(domain, "https://"), "http://"))
 	}
 
-	baseURL.Path = "/.well-known/schemapin.json"
+	baseURL.Path = strings.TrimRight(baseURL.Path, "/") + "/.well-known/schemapin.json"
+	baseURL.RawPath, baseURL.RawQuery, baseURL.Fragment = "", "", ""
 	return baseURL.String()
 }
 
@@ -75,59 +313,304 @@ func (p *PublicKeyDiscovery) ConstructWellKnownURL(domain string) string {
 func ValidateWellKnownResponse(response *WellKnownResponse) bool {
 	return response != nil &&
 		response.SchemaVersion != "" &&
-		response.PublicKeyPEM != ""
+		response.PublicKeyPEM != "" &&
+		ValidateToolKeys(response.Tools) == nil &&
+		validMinimumSignedAt(response.MinimumSignedAt)
 }
 
-// FetchWellKnown fetches and validates .well-known/schemapin.json from domain
-func (p *PublicKeyDiscovery) FetchWellKnown(ctx context.Context, domain string) (*WellKnownResponse, error) {
+// validMinimumSignedAt reports whether minimum_signed_at is absent or an
+// RFC 3339 timestamp. A cutoff that cannot be read invalidates the
+// document rather than being ignored.
+func validMinimumSignedAt(minimumSignedAt string) bool {
+	if minimumSignedAt == "" {
+		return true
+	}
+	_, err := time.Parse(time.RFC3339, minimumSignedAt)
+	return err == nil
+}
+
+// Supersedes reports whether a signature made at signedAt, an RFC 3339
+// timestamp, is before the document's minimum_signed_at. A signature made
+// exactly at the cutoff is not superseded. Without a minimum_signed_at or
+// a readable signedAt nothing is superseded.
+func (w *WellKnownResponse) Supersedes(signedAt string) bool {
+	if w == nil || w.MinimumSignedAt == "" || signedAt == "" {
+		return false
+	}
+	minimum, err := time.Parse(time.RFC3339, w.MinimumSignedAt)
+	if err != nil {
+		return false
+	}
+	ts, err := time.Parse(time.RFC3339, signedAt)
+	return err == nil && ts.Before(minimum)
+}
+
+// CompareSchemaVersions compares two dotted discovery schema versions such
+// as "1.0" and "1.2" numerically, returning -1, 0 or +1. Missing components
+// count as zero, so "1" equals "1.0", and an empty version is treated as
+// "1.0", the version DeveloperInfo assumes.
+func CompareSchemaVersions(a, b string) int {
+	if a == "" {
+		a = "1.0"
+	}
+	if b == "" {
+		b = "1.0"
+	}
+	as := strings.Split(a, ".")
+	bs := strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
+
+// ValidateToolKeys checks the optional per-tool key map: every prefix must
+// be non-empty and unique once surrounding slashes are removed, and every
+// entry must carry a public key.
+func ValidateToolKeys(tools map[string]ToolKey) error {
+	seen := make(map[string]string, len(tools))
+	for prefix, key := range tools {
+		normalized := normalizeToolPath(prefix)
+		if normalized == "" {
+			return fmt.Errorf("tools entry %q has an empty path prefix", prefix)
+		}
+		if other, ok := seen[normalized]; ok {
+			return fmt.Errorf("tools entries %q and %q name the same path prefix", other, prefix)
+		}
+		seen[normalized] = prefix
+		if key.PublicKeyPEM == "" {
+			return fmt.Errorf("tools entry %q is missing public_key_pem", prefix)
+		}
+	}
+	return nil
+}
+
+// LoadWellKnownFile reads and validates a saved copy of a domain's
+// .well-known/schemapin.json, for verification without network access.
+func LoadWellKnownFile(path string) (*WellKnownResponse, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- path is supplied by the operator
+	if err != nil {
+		return nil, fmt.Errorf("failed to read .well-known file: %w", err)
+	}
+
+	var wellKnown WellKnownResponse
+	if err := json.Unmarshal(data, &wellKnown); err != nil {
+		return nil, &schemaerr.Error{Kind: schemaerr.ErrDiscoveryInvalid, Err: fmt.Errorf("failed to parse .well-known file %s: %w", path, err)}
+	}
+
+	if err := ValidateToolKeys(wellKnown.Tools); err != nil {
+		return nil, &schemaerr.Error{Kind: schemaerr.ErrDiscoveryInvalid, Err: fmt.Errorf("invalid .well-known file %s: %w", path, err)}
+	}
+	if !ValidateWellKnownResponse(&wellKnown) {
+		return nil, &schemaerr.Error{Kind: schemaerr.ErrDiscoveryInvalid, Message: fmt.Sprintf("invalid .well-known file %s: schema_version and public_key_pem are required, and minimum_signed_at must be RFC 3339", path)}
+	}
+
+	return &wellKnown, nil
+}
+
+// FetchDiscovery fetches and validates .well-known/schemapin.json from
+// domain. Callers needing several pieces of discovery data should fetch once
+// and use the WellKnownResponse accessors (PublicKey, DeveloperInfo,
+// KeyNotRevoked, KeyForTool) rather than the Get* methods, each of which
+// fetches the document again.
+//
+// With WithCircuitBreaker or WithRateLimit, a request may be refused
+// without contacting the domain, with ErrDiscoveryCircuitOpen or
+// ErrDiscoveryRateLimited.
+//
+// The request carries the discovery User-Agent and, when ctx has one (see
+// package requestid), the request ID in the X-SchemaPin-Request-ID header.
+// With WithDocumentCache the document fetched is recorded in the cache.
+//
+// domain may carry a path prefix for a tenant of a multi-tenant platform
+// (see ConstructWellKnownURL). One core.NormalizeDomain rejects fails with
+// ErrDiscoveryFailed wrapping core.ErrInvalidDomain, without a request.
+func (p *PublicKeyDiscovery) FetchDiscovery(ctx context.Context, domain string) (*WellKnownResponse, error) {
+	if _, err := core.NormalizeDomain(domain); err != nil {
+		return nil, &schemaerr.Error{Kind: schemaerr.ErrDiscoveryFailed, Domain: domain, Err: err}
+	}
 	url := p.ConstructWellKnownURL(domain)
+	host := protectionKey(url)
+	logger := p.logger
+	if id, ok := requestid.FromContext(ctx); ok {
+		logger = logger.With(logging.KeyRequestID, id)
+	}
+	if err := p.admit(ctx, domain, host); err != nil {
+		logger.WarnContext(ctx, "discovery refused",
+			logging.KeyDomain, domain,
+			logging.KeyError, err)
+		return nil, err
+	}
+	start := time.Now()
+	logger.DebugContext(ctx, "fetching .well-known document", logging.KeyDomain, domain, "url", url)
 
+	wellKnown, err := p.fetchWellKnown(ctx, domain, url)
+	p.recordOutcome(ctx, domain, host, err)
+	if err != nil {
+		logger.WarnContext(ctx, "discovery failed",
+			logging.KeyDomain, domain,
+			"url", url,
+			logging.KeyError, err,
+			logging.KeyDuration, time.Since(start))
+		return nil, err
+	}
+
+	logger.DebugContext(ctx, "discovery succeeded",
+		logging.KeyDomain, domain,
+		"schema_version", wellKnown.SchemaVersion,
+		"source_url", wellKnown.SourceURL,
+		logging.KeyDuration, time.Since(start))
+	if p.documents != nil {
+		cached := CachedDocument{
+			Domain:    domain,
+			SourceURL: wellKnown.SourceURL,
+			FetchedAt: clock.Timestamp(p.clock.Now()),
+			Document:  wellKnown,
+		}
+		if err := p.documents.StoreDiscoveryDocument(cached); err != nil {
+			logger.WarnContext(ctx, "failed to cache discovery document",
+				logging.KeyDomain, domain,
+				logging.KeyError, err)
+		}
+	}
+	return wellKnown, nil
+}
+
+// FetchWellKnown is FetchDiscovery under its original name.
+func (p *PublicKeyDiscovery) FetchWellKnown(ctx context.Context, domain string) (*WellKnownResponse, error) {
+	return p.FetchDiscovery(ctx, domain)
+}
+
+// fetchWellKnown fetches the document at url. Every error is a
+// *schemaerr.Error for domain: ErrDiscoveryNotFound for a 404 or 410,
+// ErrDiscoveryRedirectBlocked or ErrDiscoveryTLSPinMismatch when the
+// connection was refused by policy, ErrDiscoveryInvalid for a malformed
+// document, ErrDiscoveryResponseTooLarge for one over the size limit and
+// ErrDiscoveryFailed otherwise.
+func (p *PublicKeyDiscovery) fetchWellKnown(ctx context.Context, domain, url string) (*WellKnownResponse, error) {
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, &schemaerr.Error{Kind: schemaerr.ErrDiscoveryFailed, Domain: domain, Err: fmt.Errorf("failed to create request: %w", err)}
 	}
+	req.Header.Set("User-Agent", p.userAgent)
+	requestid.SetHeader(req)
 
 	resp, err := p.client.Do(req) // #nosec G704 -- URL constructed from ConstructWellKnownURL with domain validation
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch .well-known file: %w", err)
+		kind := schemaerr.KindOf(err)
+		if kind != schemaerr.ErrDiscoveryRedirectBlocked && kind != schemaerr.ErrDiscoveryTLSPinMismatch {
+			kind = schemaerr.ErrDiscoveryFailed
+		}
+		return nil, &schemaerr.Error{Kind: kind, Domain: domain, Err: fmt.Errorf("failed to fetch .well-known file: %w", err)}
 	}
-	defer resp.Body.Close()
+	defer drainAndClose(resp.Body)
 
 	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		statusErr := &HTTPStatusError{StatusCode: resp.StatusCode}
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+			statusErr.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		}
+		return nil, &schemaerr.Error{Kind: schemaerr.KindOf(statusErr), Domain: domain, Err: statusErr}
 	}
 
 	var wellKnown WellKnownResponse
-	if err := json.NewDecoder(resp.Body).Decode(&wellKnown); err != nil {
-		return nil, fmt.Errorf("failed to decode .well-known response: %w", err)
+	if err := json.NewDecoder(http.MaxBytesReader(nil, resp.Body, p.maxResponseBytes)).Decode(&wellKnown); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, &schemaerr.Error{Kind: schemaerr.ErrDiscoveryResponseTooLarge, Domain: domain,
+				Err: fmt.Errorf(".well-known response exceeds %d bytes: %w", tooLarge.Limit, err)}
+		}
+		// A body still arriving at the timeout is an outage, not a
+		// malformed document
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return nil, &schemaerr.Error{Kind: schemaerr.ErrDiscoveryFailed, Domain: domain, Err: fmt.Errorf("failed to read .well-known response: %w", err)}
+		}
+		return nil, &schemaerr.Error{Kind: schemaerr.ErrDiscoveryInvalid, Domain: domain, Err: fmt.Errorf("failed to decode .well-known response: %w", err)}
 	}
 
 	if !ValidateWellKnownResponse(&wellKnown) {
-		return nil, fmt.Errorf("invalid .well-known response structure")
+		return nil, &schemaerr.Error{Kind: schemaerr.ErrDiscoveryInvalid, Domain: domain, Message: "invalid .well-known response structure"}
 	}
 
+	wellKnown.SourceURL = resp.Request.URL.String()
+	wellKnown.Domain = domain
 	return &wellKnown, nil
 }
 
+// parseRetryAfter parses a Retry-After header value, which is either a
+// number of seconds or an HTTP-date.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
 // FetchWellKnownWithTimeout fetches .well-known with custom timeout
 func (p *PublicKeyDiscovery) FetchWellKnownWithTimeout(domain string, timeout time.Duration) (*WellKnownResponse, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
-	return p.FetchWellKnown(ctx, domain)
+	return p.FetchDiscovery(ctx, domain)
 }
 
 // GetPublicKeyPEM retrieves the public key PEM from .well-known endpoint
 func (p *PublicKeyDiscovery) GetPublicKeyPEM(ctx context.Context, domain string) (string, error) {
-	wellKnown, err := p.FetchWellKnown(ctx, domain)
+	wellKnown, err := p.FetchDiscovery(ctx, domain)
 	if err != nil {
 		return "", err
 	}
+	return wellKnown.PublicKey()
+}
+
+// PublicKey returns the domain-wide public key PEM.
+func (w *WellKnownResponse) PublicKey() (string, error) {
+	if w.PublicKeyPEM == "" {
+		return "", &schemaerr.Error{Kind: schemaerr.ErrKeyNotFound, Message: "no public key found in .well-known response"}
+	}
+	return w.PublicKeyPEM, nil
+}
 
-	if wellKnown.PublicKeyPEM == "" {
-		return "", fmt.Errorf("no public key found in .well-known response")
+// ResolveToolKey fetches .well-known for domain and selects the key scoped
+// to toolID, falling back to the domain-wide key.
+func (p *PublicKeyDiscovery) ResolveToolKey(ctx context.Context, domain, toolID string) (*ScopedKey, error) {
+	wellKnown, err := p.FetchDiscovery(ctx, domain)
+	if err != nil {
+		return nil, err
 	}
+	return wellKnown.KeyForTool(toolID), nil
+}
 
-	return wellKnown.PublicKeyPEM, nil
+// GetPublicKeyPEMForTool retrieves the public key PEM for toolID: the
+// longest-prefix match in the tools map, or the domain key if none matches.
+func (p *PublicKeyDiscovery) GetPublicKeyPEMForTool(ctx context.Context, domain, toolID string) (string, error) {
+	scoped, err := p.ResolveToolKey(ctx, domain, toolID)
+	if err != nil {
+		return "", err
+	}
+	return scoped.PublicKeyPEM, nil
 }
 
 // GetPublicKeyPEMWithTimeout retrieves public key PEM with custom timeout
@@ -137,29 +620,39 @@ func (p *PublicKeyDiscovery) GetPublicKeyPEMWithTimeout(domain string, timeout t
 	return p.GetPublicKeyPEM(ctx, domain)
 }
 
-// CheckKeyRevocation checks if a public key is in the revocation list
+// CheckKeyRevocation checks if a public key is in the revocation list.
+// Entries are fingerprints or PEM-encoded keys. PEM entries are compared by
+// fingerprint, so a revoked key matches in any encoding LoadPublicKeyPEM
+// accepts, e.g. with CRLF line endings or explicit curve parameters.
 func CheckKeyRevocation(publicKeyPEM string, revokedKeys []string) bool {
 	if len(revokedKeys) == 0 {
 		return false
 	}
 
-	// Try direct PEM comparison first
-	for _, revokedKey := range revokedKeys {
-		if revokedKey == publicKeyPEM {
-			return true
-		}
-	}
-
-	// Try fingerprint comparison
 	keyManager := crypto.NewKeyManager()
 	fingerprint, err := keyManager.CalculateKeyFingerprintFromPEM(publicKeyPEM)
 	if err != nil {
-		// If we can't calculate fingerprint, assume not revoked
+		// Without a fingerprint only the exact text can match
+		for _, revokedKey := range revokedKeys {
+			if crypto.PublicKeyPEMEqual(revokedKey, publicKeyPEM) {
+				return true
+			}
+		}
 		return false
 	}
 
 	for _, revokedKey := range revokedKeys {
-		if revokedKey == fingerprint {
+		if !strings.Contains(revokedKey, "-----BEGIN") {
+			if crypto.FingerprintEqual(revokedKey, fingerprint) {
+				return true
+			}
+			continue
+		}
+		revokedFingerprint, err := keyManager.CalculateKeyFingerprintFromPEM(revokedKey)
+		if err != nil {
+			continue
+		}
+		if crypto.FingerprintEqual(revokedFingerprint, fingerprint) {
 			return true
 		}
 	}
@@ -169,7 +662,7 @@ func CheckKeyRevocation(publicKeyPEM string, revokedKeys []string) bool {
 
 // GetRevokedKeys retrieves revoked keys list from domain's .well-known endpoint
 func (p *PublicKeyDiscovery) GetRevokedKeys(ctx context.Context, domain string) ([]string, error) {
-	wellKnown, err := p.FetchWellKnown(ctx, domain)
+	wellKnown, err := p.FetchDiscovery(ctx, domain)
 	if err != nil {
 		return nil, err
 	}
@@ -190,13 +683,73 @@ func (p *PublicKeyDiscovery) GetRevokedKeysWithTimeout(domain string, timeout ti
 
 // ValidateKeyNotRevoked validates that a public key is not revoked
 func (p *PublicKeyDiscovery) ValidateKeyNotRevoked(ctx context.Context, publicKeyPEM, domain string) (bool, error) {
-	revokedKeys, err := p.GetRevokedKeys(ctx, domain)
+	wellKnown, err := p.FetchDiscovery(ctx, domain)
 	if err != nil {
 		// If we can't fetch revocation list, assume not revoked
+		p.logger.WarnContext(ctx, "revocation list unavailable; assuming key is not revoked",
+			logging.KeyDomain, domain,
+			logging.KeyError, err)
 		return true, nil
 	}
+	if !wellKnown.KeyNotRevoked(publicKeyPEM) {
+		return false, nil
+	}
 
-	return !CheckKeyRevocation(publicKeyPEM, revokedKeys), nil
+	doc, err := p.RevocationDocument(ctx, wellKnown)
+	if err != nil {
+		p.logger.WarnContext(ctx, "revocation endpoint unavailable; using cached revocations",
+			logging.KeyDomain, domain,
+			logging.KeyError, err)
+	}
+	if doc == nil {
+		return true, nil
+	}
+	fingerprint, err := p.keyManager.CalculateKeyFingerprintFromPEM(publicKeyPEM)
+	if err != nil {
+		return true, nil
+	}
+	return revocation.CheckRevocationCombined(wellKnown.RevokedKeys, doc, fingerprint) == nil, nil
+}
+
+// RevocationDocument returns the document published at wellKnown's
+// revocation_endpoint, or nil if it names none. The endpoint is only
+// fetched when this is called, and the document is kept in the revocation
+// cache (see WithRevocationCache) so that later calls only fetch what
+// changed. If the endpoint cannot be reached, the cached document, if
+// any, is returned along with the error.
+func (p *PublicKeyDiscovery) RevocationDocument(ctx context.Context, wellKnown *WellKnownResponse) (*revocation.RevocationDocument, error) {
+	endpoint := wellKnown.RevocationEndpoint
+	if endpoint == "" {
+		return nil, nil
+	}
+	cached, err := p.revocations.LoadRevocationDocument(endpoint)
+	if err != nil {
+		p.logger.DebugContext(ctx, "failed to load cached revocations",
+			"endpoint", endpoint,
+			logging.KeyError, err)
+		cached = nil
+	}
+	doc, err := revocation.FetchRevocationUpdate(ctx, endpoint, cached,
+		revocation.WithUserAgent(p.userAgent), revocation.WithHTTPClient(p.client),
+		revocation.WithMaxBytes(p.maxResponseBytes))
+	if err != nil {
+		return cached, err
+	}
+	if doc != cached {
+		if err := p.revocations.StoreRevocationDocument(endpoint, doc); err != nil {
+			p.logger.WarnContext(ctx, "failed to cache revocations",
+				"endpoint", endpoint,
+				logging.KeyError, err)
+		}
+	}
+	return doc, nil
+}
+
+// KeyNotRevoked reports whether publicKeyPEM is absent from the
+// domain-wide revoked_keys list. Tool-scoped lists are checked through
+// KeyForTool.
+func (w *WellKnownResponse) KeyNotRevoked(publicKeyPEM string) bool {
+	return !CheckKeyRevocation(publicKeyPEM, w.RevokedKeys)
 }
 
 // ValidateKeyNotRevokedWithTimeout validates key revocation with custom timeout
@@ -208,18 +761,26 @@ func (p *PublicKeyDiscovery) ValidateKeyNotRevokedWithTimeout(publicKeyPEM, doma
 
 // GetDeveloperInfo retrieves developer information from .well-known endpoint
 func (p *PublicKeyDiscovery) GetDeveloperInfo(ctx context.Context, domain string) (map[string]string, error) {
-	wellKnown, err := p.FetchWellKnown(ctx, domain)
+	wellKnown, err := p.FetchDiscovery(ctx, domain)
 	if err != nil {
 		return nil, err
 	}
+	return wellKnown.DeveloperInfo(), nil
+}
 
+// DeveloperInfo returns the developer_name, schema_version and contact
+// fields, defaulting the name to "Unknown" and the version to "1.0". With a
+// contact, "contact_verified" is "true" or "false" as reported by
+// ContactVerified for the document's Domain.
+func (w *WellKnownResponse) DeveloperInfo() map[string]string {
 	info := map[string]string{
-		"developer_name": wellKnown.DeveloperName,
-		"schema_version": wellKnown.SchemaVersion,
+		"developer_name": w.DeveloperName,
+		"schema_version": w.SchemaVersion,
 	}
 
-	if wellKnown.Contact != "" {
-		info["contact"] = wellKnown.Contact
+	if w.Contact != "" {
+		info["contact"] = w.Contact
+		info["contact_verified"] = strconv.FormatBool(w.ContactVerified(w.Domain))
 	}
 
 	// Set defaults for missing fields
@@ -230,7 +791,7 @@ func (p *PublicKeyDiscovery) GetDeveloperInfo(ctx context.Context, domain string
 		info["schema_version"] = "1.0"
 	}
 
-	return info, nil
+	return info
 }
 
 // GetDeveloperInfoWithTimeout retrieves developer info with custom timeout
@@ -1,12 +1,26 @@
 package discovery
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/internal/version"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/requestid"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/revocation"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
 )
 
 func TestConstructWellKnownURL(t *testing.T) {
@@ -35,6 +49,16 @@ func TestConstructWellKnownURL(t *testing.T) {
 			domain:   "example.com:8080",
 			expected: "https://example.com:8080/.well-known/schemapin.json",
 		},
+		{
+			name:     "tenant path prefix",
+			domain:   "platform.example/tenants/acme",
+			expected: "https://platform.example/tenants/acme/.well-known/schemapin.json",
+		},
+		{
+			name:     "tenant path prefix with trailing slash",
+			domain:   "https://platform.example:8443/tenants/acme/",
+			expected: "https://platform.example:8443/tenants/acme/.well-known/schemapin.json",
+		},
 	}
 
 	for _, tt := range tests {
@@ -78,6 +102,15 @@ func TestValidateWellKnownResponse(t *testing.T) {
 			},
 			expected: false,
 		},
+		{
+			name: "unreadable minimum_signed_at",
+			response: &WellKnownResponse{
+				SchemaVersion:   "1.2",
+				PublicKeyPEM:    "-----BEGIN PUBLIC KEY-----\nMFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAE...\n-----END PUBLIC KEY-----",
+				MinimumSignedAt: "last tuesday",
+			},
+			expected: false,
+		},
 		{
 			name:     "nil response",
 			response: nil,
@@ -95,6 +128,29 @@ func TestValidateWellKnownResponse(t *testing.T) {
 	}
 }
 
+func TestSupersedes(t *testing.T) {
+	wellKnown := &WellKnownResponse{MinimumSignedAt: "2026-06-01T00:00:00Z"}
+	tests := []struct {
+		signedAt string
+		want     bool
+	}{
+		{"2026-05-31T23:59:59Z", true},
+		{"2026-06-01T00:00:00Z", false},
+		{"2026-06-01T02:00:00+02:00", false},
+		{"2026-06-01T00:00:01Z", false},
+		{"", false},
+		{"not a timestamp", false},
+	}
+	for _, tt := range tests {
+		if got := wellKnown.Supersedes(tt.signedAt); got != tt.want {
+			t.Errorf("Supersedes(%q) = %v, want %v", tt.signedAt, got, tt.want)
+		}
+	}
+	if (&WellKnownResponse{}).Supersedes("2020-01-01T00:00:00Z") {
+		t.Error("Expected nothing to be superseded without minimum_signed_at")
+	}
+}
+
 func TestCheckKeyRevocation(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -138,6 +194,45 @@ func TestCheckKeyRevocation(t *testing.T) {
 	}
 }
 
+// TestCheckKeyRevocationKeyEncodings revokes the key of the shared
+// fingerprint vectors in other encodings than the one presented.
+func TestCheckKeyRevocationKeyEncodings(t *testing.T) {
+	namedCurvePEM := "-----BEGIN PUBLIC KEY-----\nMFkwEwYHKoZIzj0CAQYIKoZIzj0DAQcDQgAEsU01joIPuiJBwB987bADYlfiTsp4\na5bwVBxfZgU0HRSfF9C32bJFG/eaeuhDkEVk87NygaJCQuuiQVJe1yTxIA==\n-----END PUBLIC KEY-----\n"
+	explicitParamsPEM := "-----BEGIN PUBLIC KEY-----\nMIIBSzCCAQMGByqGSM49AgEwgfcCAQEwLAYHKoZIzj0BAQIhAP////8AAAABAAAA\nAAAAAAAAAAAA////////////////MFsEIP////8AAAABAAAAAAAAAAAAAAAA////\n///////////8BCBaxjXYqjqT57PrvVV2mIa8ZR0GsMxTsPY7zjw+J9JgSwMVAMSd\nNgiG5wSTamZ44ROdJreBn36QBEEEaxfR8uEsQkf4vOblY6RA8ncDfYEt6zOg9KE5\nRdiYwpZP40Li/hp/m47n60p8D54WK84zV2sxXs7LtkBoN79R9QIhAP////8AAAAA\n//////////+85vqtpxeehPO5ysL8YyVRAgEBA0IABLFNNY6CD7oiQcAffO2wA2JX\n4k7KeGuW8FQcX2YFNB0UnxfQt9myRRv3mnroQ5BFZPOzcoGiQkLrokFSXtck8SA=\n-----END PUBLIC KEY-----\n"
+	crlfPEM := strings.ReplaceAll(namedCurvePEM, "\n", "\r\n")
+
+	keyManager := crypto.NewKeyManager()
+	otherKey, err := keyManager.GenerateKeypair()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	otherPEM, err := keyManager.ExportPublicKeyPEM(&otherKey.PublicKey)
+	if err != nil {
+		t.Fatalf("Failed to export key: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		publicKey   string
+		revokedKeys []string
+		expected    bool
+	}{
+		{"CRLF revoked entry", namedCurvePEM, []string{otherPEM, crlfPEM}, true},
+		{"explicit parameters revoked entry", namedCurvePEM, []string{explicitParamsPEM}, true},
+		{"CRLF presented key", crlfPEM, []string{namedCurvePEM}, true},
+		{"explicit parameters presented key", explicitParamsPEM, []string{crlfPEM}, true},
+		{"other key revoked", namedCurvePEM, []string{otherPEM, "not a key"}, false},
+		{"malformed PEM entry", namedCurvePEM, []string{"-----BEGIN PUBLIC KEY-----\ngarbage\n-----END PUBLIC KEY-----\n"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CheckKeyRevocation(tt.publicKey, tt.revokedKeys); got != tt.expected {
+				t.Errorf("CheckKeyRevocation() = %v, want %v", got, tt.expected)
+			}
+		})
+	}
+}
+
 func TestPublicKeyDiscoveryFetchWellKnown(t *testing.T) {
 	// Create a test server
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -205,6 +300,179 @@ func TestPublicKeyDiscoveryFetchWellKnown(t *testing.T) {
 	_ = originalURL // Avoid unused variable error
 }
 
+func TestValidateKeyNotRevokedUsesRevocationEndpoint(t *testing.T) {
+	keyManager := crypto.NewKeyManager()
+	privateKey, err := keyManager.GenerateKeypair()
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	publicKeyPEM, err := keyManager.ExportPublicKeyPEM(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatalf("Failed to export public key: %v", err)
+	}
+	fingerprint, err := keyManager.CalculateKeyFingerprintFromPEM(publicKeyPEM)
+	if err != nil {
+		t.Fatalf("Failed to fingerprint key: %v", err)
+	}
+
+	doc := revocation.BuildRevocationDocument("example.com")
+	revocation.StartSequence(doc)
+	revocation.AddRevokedKey(doc, fingerprint, revocation.ReasonKeyCompromise)
+	revocations := revocation.NewHandler(func() *revocation.RevocationDocument { return doc })
+	fetches := 0
+	endpointDown := false
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/revocations.json" {
+			fetches++
+			if endpointDown {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			revocations.ServeHTTP(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(WellKnownResponse{
+			SchemaVersion:      "1.2",
+			PublicKeyPEM:       publicKeyPEM,
+			RevocationEndpoint: server.URL + "/revocations.json",
+		})
+	}))
+	defer server.Close()
+
+	d := NewPublicKeyDiscovery()
+	ctx := context.Background()
+
+	// Discovery alone leaves the revocation endpoint alone
+	if _, err := d.FetchDiscovery(ctx, server.URL); err != nil {
+		t.Fatalf("FetchDiscovery failed: %v", err)
+	}
+	if fetches != 0 {
+		t.Fatalf("Expected no revocation fetch during discovery, got %d", fetches)
+	}
+
+	notRevoked, err := d.ValidateKeyNotRevoked(ctx, publicKeyPEM, server.URL)
+	if err != nil || notRevoked || fetches != 1 {
+		t.Fatalf("Expected the key revoked by the endpoint, got %v, %v after %d fetches", notRevoked, err, fetches)
+	}
+
+	// An unreachable endpoint falls back to the cached document
+	endpointDown = true
+	notRevoked, err = d.ValidateKeyNotRevoked(ctx, publicKeyPEM, server.URL)
+	if err != nil || notRevoked || fetches != 2 {
+		t.Errorf("Expected the cached revocation to apply, got %v, %v after %d fetches", notRevoked, err, fetches)
+	}
+}
+
+func TestFetchDiscoverySendsTraceHeaders(t *testing.T) {
+	var userAgent, requestID string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent, requestID = r.Header.Get("User-Agent"), r.Header.Get(requestid.Header)
+		_ = json.NewEncoder(w).Encode(WellKnownResponse{SchemaVersion: "1.2", PublicKeyPEM: "-----BEGIN PUBLIC KEY-----"})
+	}))
+	defer server.Close()
+
+	if _, err := NewPublicKeyDiscovery().FetchDiscovery(context.Background(), server.URL); err != nil {
+		t.Fatalf("FetchDiscovery failed: %v", err)
+	}
+	if want := "schemapin-go/" + version.Version; userAgent != want {
+		t.Errorf("Expected User-Agent %q, got %q", want, userAgent)
+	}
+	if requestID != "" {
+		t.Errorf("Expected no request ID without one in the context, got %q", requestID)
+	}
+
+	d := NewPublicKeyDiscovery(WithUserAgentSuffix("acme-gateway/2.1"))
+	ctx := requestid.NewContext(context.Background(), "req-123")
+	if _, err := d.FetchDiscovery(ctx, server.URL); err != nil {
+		t.Fatalf("FetchDiscovery failed: %v", err)
+	}
+	if want := version.UserAgent() + " acme-gateway/2.1"; userAgent != want || d.UserAgent() != want {
+		t.Errorf("Expected User-Agent %q, got %q (client reports %q)", want, userAgent, d.UserAgent())
+	}
+	if requestID != "req-123" {
+		t.Errorf("Expected request ID req-123, got %q", requestID)
+	}
+}
+
+func TestFetchDiscoveryPathPrefix(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		_ = json.NewEncoder(w).Encode(WellKnownResponse{SchemaVersion: "1.2", PublicKeyPEM: "-----BEGIN PUBLIC KEY-----"})
+	}))
+	defer server.Close()
+
+	d := NewPublicKeyDiscovery()
+	if _, err := d.FetchDiscovery(context.Background(), server.URL+"/tenants/acme"); err != nil {
+		t.Fatalf("FetchDiscovery failed: %v", err)
+	}
+	if len(paths) != 1 || paths[0] != "/tenants/acme/.well-known/schemapin.json" {
+		t.Errorf("Expected the document under the tenant prefix, got %v", paths)
+	}
+
+	for _, prefix := range []string{"/tenants/../globex", "/tenants/acme?tenant=globex", "/tenants/acme#globex", "/tenants/%2e%2e/globex"} {
+		_, err := d.FetchDiscovery(context.Background(), server.URL+prefix)
+		if !errors.Is(err, core.ErrInvalidDomain) || !errors.Is(err, schemaerr.ErrDiscoveryFailed) {
+			t.Errorf("Expected %q to be rejected as an invalid domain, got %v", prefix, err)
+		}
+	}
+	if len(paths) != 1 {
+		t.Errorf("Expected no request for a malformed prefix, got %v", paths)
+	}
+}
+
+// documentCache is a DocumentCache in a map.
+type documentCache map[string]CachedDocument
+
+func (c documentCache) LoadDiscoveryDocument(domain string) (*CachedDocument, error) {
+	if doc, ok := c[domain]; ok {
+		return &doc, nil
+	}
+	return nil, nil
+}
+
+func (c documentCache) StoreDiscoveryDocument(doc CachedDocument) error {
+	c[doc.Domain] = doc
+	return nil
+}
+
+func TestFetchDiscoveryCachesDocument(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(WellKnownResponse{SchemaVersion: "1.2", PublicKeyPEM: "-----BEGIN PUBLIC KEY-----"})
+	}))
+	defer server.Close()
+
+	fake := clock.NewFake(time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC))
+	cache := documentCache{}
+	d := NewPublicKeyDiscovery(WithDocumentCache(cache), WithClock(fake))
+	if _, err := d.FetchDiscovery(context.Background(), server.URL); err != nil {
+		t.Fatalf("FetchDiscovery failed: %v", err)
+	}
+	cached, _ := cache.LoadDiscoveryDocument(server.URL)
+	if cached == nil || cached.Document == nil || cached.Document.SchemaVersion != "1.2" {
+		t.Fatalf("Expected the document to be cached, got %+v", cached)
+	}
+	if !cached.FetchedAt.Equal(fake.Now()) || cached.SourceURL != server.URL+"/.well-known/schemapin.json" {
+		t.Errorf("Unexpected fetch time or source: %+v", cached)
+	}
+
+	// A failed fetch keeps the last document
+	status = http.StatusServiceUnavailable
+	fake.Advance(time.Hour)
+	if _, err := d.FetchDiscovery(context.Background(), server.URL); err == nil {
+		t.Fatal("Expected FetchDiscovery to fail")
+	}
+	if again, _ := cache.LoadDiscoveryDocument(server.URL); !again.FetchedAt.Equal(cached.FetchedAt) {
+		t.Errorf("Expected the cached document to be kept, got %+v", again)
+	}
+}
+
 func TestPublicKeyDiscoveryErrorHandling(t *testing.T) {
 	// Test server that returns 404
 	server404 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -300,6 +568,156 @@ func TestPublicKeyDiscoveryErrorHandling(t *testing.T) {
 	}
 }
 
+func TestFetchWellKnownErrorKinds(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		kind    *schemaerr.Kind
+	}{
+		{"404", func(w http.ResponseWriter, r *http.Request) { http.NotFound(w, r) }, schemaerr.ErrDiscoveryNotFound},
+		{"410", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusGone) }, schemaerr.ErrDiscoveryNotFound},
+		{"500", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusInternalServerError) }, schemaerr.ErrDiscoveryFailed},
+		{"invalid JSON", func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte("invalid json")) }, schemaerr.ErrDiscoveryInvalid},
+		{"invalid structure", func(w http.ResponseWriter, r *http.Request) { _, _ = w.Write([]byte(`{"invalid": "response"}`)) }, schemaerr.ErrDiscoveryInvalid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+
+			_, err := NewPublicKeyDiscovery().FetchWellKnown(context.Background(), server.URL)
+			if !errors.Is(err, tt.kind) {
+				t.Fatalf("Expected errors.Is(%v, %v)", err, tt.kind)
+			}
+			var e *schemaerr.Error
+			if !errors.As(err, &e) || e.Domain != server.URL {
+				t.Errorf("Expected a *schemaerr.Error for domain %s, got %#v", server.URL, err)
+			}
+			if tt.kind != schemaerr.ErrDiscoveryNotFound && errors.Is(err, schemaerr.ErrDiscoveryNotFound) {
+				t.Errorf("Did not expect %v to match ErrDiscoveryNotFound", err)
+			}
+		})
+	}
+}
+
+// streamingHandler answers with a .well-known document whose
+// developer_name never ends, counting the bytes written until the client
+// goes away.
+func streamingHandler(written *atomic.Int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		n, _ := w.Write([]byte(`{"schema_version":"1.2","developer_name":"`))
+		written.Add(int64(n))
+		chunk := bytes.Repeat([]byte("a"), 32<<10)
+		for written.Load() < 256<<20 {
+			n, err := w.Write(chunk)
+			written.Add(int64(n))
+			if err != nil {
+				return
+			}
+		}
+	}
+}
+
+func TestFetchDiscoveryResponseTooLarge(t *testing.T) {
+	var written atomic.Int64
+	server := httptest.NewServer(streamingHandler(&written))
+	defer server.Close()
+
+	d := NewPublicKeyDiscovery(WithMaxResponseBytes(64 << 10))
+	_, err := d.FetchDiscovery(context.Background(), server.URL)
+	if !errors.Is(err, schemaerr.ErrDiscoveryResponseTooLarge) {
+		t.Fatalf("Expected ErrDiscoveryResponseTooLarge, got %v", err)
+	}
+	var tooLarge *http.MaxBytesError
+	if !errors.As(err, &tooLarge) || tooLarge.Limit != 64<<10 {
+		t.Errorf("Expected the size limit on the error, got %#v", err)
+	}
+	server.CloseClientConnections()
+	server.Close()
+	// The server stops once the connection is dropped, well short of the
+	// whole response
+	if n := written.Load(); n >= 32<<20 {
+		t.Errorf("Expected the response to be abandoned, %d bytes were written", n)
+	}
+
+	// Documents within the default limit are read as before
+	small := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(WellKnownResponse{SchemaVersion: "1.2", PublicKeyPEM: strings.Repeat("k", 512<<10)})
+	}))
+	defer small.Close()
+	if _, err := NewPublicKeyDiscovery().FetchDiscovery(context.Background(), small.URL); err != nil {
+		t.Errorf("Expected a 512 KiB document to be accepted, got %v", err)
+	}
+}
+
+func TestRevocationDocumentTooLarge(t *testing.T) {
+	var written atomic.Int64
+	server := httptest.NewServer(streamingHandler(&written))
+	defer server.Close()
+
+	d := NewPublicKeyDiscovery(WithMaxResponseBytes(64 << 10))
+	_, err := d.RevocationDocument(context.Background(), &WellKnownResponse{RevocationEndpoint: server.URL + "/revocations.json"})
+	if !errors.Is(err, schemaerr.ErrDiscoveryResponseTooLarge) {
+		t.Fatalf("Expected ErrDiscoveryResponseTooLarge, got %v", err)
+	}
+}
+
+func TestFetchDiscoverySlowServers(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		timeout time.Duration
+		opts    []Option
+	}{
+		{
+			// Accepts the request but never sends headers
+			name: "no headers",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				<-r.Context().Done()
+			},
+			timeout: 30 * time.Second,
+			opts:    []Option{WithResponseHeaderTimeout(100 * time.Millisecond)},
+		},
+		{
+			// Sends headers, then trickles the body a byte at a time
+			name: "trickled body",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				for {
+					if _, err := w.Write([]byte(" ")); err != nil {
+						return
+					}
+					w.(http.Flusher).Flush()
+					select {
+					case <-r.Context().Done():
+						return
+					case <-time.After(20 * time.Millisecond):
+					}
+				}
+			},
+			timeout: 300 * time.Millisecond,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+
+			d := NewPublicKeyDiscoveryWithTimeout(tt.timeout, tt.opts...)
+			start := time.Now()
+			_, err := d.FetchDiscovery(context.Background(), server.URL)
+			if !errors.Is(err, schemaerr.ErrDiscoveryFailed) {
+				t.Fatalf("Expected ErrDiscoveryFailed, got %v", err)
+			}
+			if elapsed := time.Since(start); elapsed > 2*time.Second {
+				t.Errorf("Expected the fetch to give up promptly, took %v", elapsed)
+			}
+		})
+	}
+}
+
 func TestPublicKeyDiscoveryTimeout(t *testing.T) {
 	// Create a server that delays response
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -428,3 +846,137 @@ func TestGetDeveloperInfo(t *testing.T) {
 		})
 	}
 }
+
+func TestFetchWellKnownRetryAfter(t *testing.T) {
+	tests := []struct {
+		name       string
+		status     int
+		retryAfter string
+		want       time.Duration
+	}{
+		{"429 with seconds", http.StatusTooManyRequests, "7", 7 * time.Second},
+		{"503 with HTTP-date", http.StatusServiceUnavailable, time.Now().Add(2 * time.Minute).UTC().Format(http.TimeFormat), 2 * time.Minute},
+		{"503 without header", http.StatusServiceUnavailable, "", 0},
+		{"404 ignores header", http.StatusNotFound, "7", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(tt.status)
+			}))
+			defer server.Close()
+
+			_, err := NewPublicKeyDiscovery().FetchWellKnown(context.Background(), server.URL)
+			var statusErr *HTTPStatusError
+			if !errors.As(err, &statusErr) {
+				t.Fatalf("Expected HTTPStatusError, got %v", err)
+			}
+			if statusErr.StatusCode != tt.status {
+				t.Errorf("Expected status %d, got %d", tt.status, statusErr.StatusCode)
+			}
+			// HTTP-dates have one-second resolution
+			if diff := statusErr.RetryAfter - tt.want; diff > time.Second || diff < -2*time.Second {
+				t.Errorf("Expected RetryAfter ~%v, got %v", tt.want, statusErr.RetryAfter)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"0", 0},
+		{"120", 2 * time.Minute},
+		{"-5", 0},
+		{"soon", 0},
+		{"Wed, 01 Jan 2025 12:00:30 GMT", 30 * time.Second},
+		{"Wed, 01 Jan 2025 11:00:00 GMT", 0},
+	}
+
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestCompareSchemaVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.0", "1.2", -1},
+		{"1.2", "1.0", 1},
+		{"1.2", "1.2", 0},
+		{"1", "1.0", 0},
+		{"1.10", "1.9", 1},
+		{"2.0", "1.3", 1},
+		{"", "1.0", 0},
+		{"", "1.1", -1},
+	}
+
+	for _, tt := range tests {
+		if got := CompareSchemaVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("CompareSchemaVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestLoadWellKnownFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		return path
+	}
+
+	valid := write("valid.json", `{
+		"schema_version": "1.2",
+		"developer_name": "Vendor",
+		"public_key_pem": "-----BEGIN PUBLIC KEY-----\ntest\n-----END PUBLIC KEY-----",
+		"revoked_keys": ["sha256:old"],
+		"tools": {"acme": {"public_key_pem": "-----BEGIN PUBLIC KEY-----\nacme\n-----END PUBLIC KEY-----"}}
+	}`)
+	wellKnown, err := LoadWellKnownFile(valid)
+	if err != nil {
+		t.Fatalf("LoadWellKnownFile failed: %v", err)
+	}
+	if wellKnown.DeveloperName != "Vendor" || len(wellKnown.RevokedKeys) != 1 {
+		t.Errorf("Unexpected document: %+v", wellKnown)
+	}
+	if scoped := wellKnown.KeyForTool("acme/search"); scoped.Scope != "acme" {
+		t.Errorf("Expected tools map to be loaded, got scope %q", scoped.Scope)
+	}
+	if info := wellKnown.DeveloperInfo(); info["developer_name"] != "Vendor" || info["schema_version"] != "1.2" {
+		t.Errorf("Unexpected developer info: %v", info)
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr string
+	}{
+		{"missing file", filepath.Join(dir, "missing.json"), "failed to read"},
+		{"malformed json", write("bad.json", `{"schema_version":`), "failed to parse"},
+		{"missing key", write("nokey.json", `{"schema_version": "1.2"}`), "public_key_pem"},
+		{"bad tools", write("tools.json", `{"schema_version": "1.2", "public_key_pem": "pem", "tools": {"acme": {}}}`), "tools entry"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadWellKnownFile(tt.path)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+// Package discoverytest provides an in-memory discovery.Discoverer for
+// tests and local development, so that verification workflows can be
+// exercised without serving .well-known documents over HTTP:
+//
+//	stub := discoverytest.New()
+//	key, err := stub.GenerateDomain("example.com", "Example Corp")
+//	...
+//	workflow := utils.NewSchemaVerificationWorkflowWithPinning(keyPinning,
+//		utils.WithDiscovery(stub))
+package discoverytest
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/revocation"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+)
+
+// Stub serves .well-known documents from memory. It is safe for concurrent
+// use, including changing its documents, errors and latencies while
+// workflows are fetching from it.
+type Stub struct {
+	mu          sync.Mutex
+	domains     map[string]*discovery.WellKnownResponse
+	revocations map[string]*revocation.RevocationDocument
+	errs        map[string]error
+	latencies   map[string]time.Duration
+	calls       map[string]int
+}
+
+var _ discovery.Discoverer = (*Stub)(nil)
+
+// New returns a Stub serving no domains.
+func New() *Stub {
+	return &Stub{
+		domains:     make(map[string]*discovery.WellKnownResponse),
+		revocations: make(map[string]*revocation.RevocationDocument),
+		errs:        make(map[string]error),
+		latencies:   make(map[string]time.Duration),
+		calls:       make(map[string]int),
+	}
+}
+
+// Key is a keypair generated by GenerateDomain.
+type Key struct {
+	PrivateKey    *ecdsa.PrivateKey
+	PrivateKeyPEM string
+	PublicKeyPEM  string
+	// Fingerprint is the public key's "sha256:<hex>" fingerprint.
+	Fingerprint string
+}
+
+// GenerateDomain generates a keypair and serves a .well-known document for
+// domain with its public key, replacing any document domain had.
+func (s *Stub) GenerateDomain(domain, developerName string) (*Key, error) {
+	keyManager := crypto.NewKeyManager()
+	privateKey, err := keyManager.GenerateKeypair()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key pair: %w", err)
+	}
+	key := &Key{PrivateKey: privateKey}
+	if key.PrivateKeyPEM, err = keyManager.ExportPrivateKeyPEM(privateKey); err != nil {
+		return nil, fmt.Errorf("failed to export private key: %w", err)
+	}
+	if key.PublicKeyPEM, err = keyManager.ExportPublicKeyPEM(&privateKey.PublicKey); err != nil {
+		return nil, fmt.Errorf("failed to export public key: %w", err)
+	}
+	if key.Fingerprint, err = keyManager.CalculateKeyFingerprint(&privateKey.PublicKey); err != nil {
+		return nil, fmt.Errorf("failed to calculate key fingerprint: %w", err)
+	}
+	s.SetDomain(domain, &discovery.WellKnownResponse{
+		SchemaVersion: discovery.LatestWellKnownVersion,
+		DeveloperName: developerName,
+		PublicKeyPEM:  key.PublicKeyPEM,
+	})
+	return key, nil
+}
+
+// SetDomain serves a copy of wellKnown for domain, replacing any document
+// domain had. A nil wellKnown removes the domain, which is then not found.
+func (s *Stub) SetDomain(domain string, wellKnown *discovery.WellKnownResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if wellKnown == nil {
+		delete(s.domains, domain)
+		return
+	}
+	s.domains[domain] = copyWellKnown(wellKnown)
+}
+
+// Revoke adds the fingerprint of publicKeyPEM to the revoked_keys of
+// domain's document.
+func (s *Stub) Revoke(domain, publicKeyPEM string) error {
+	fingerprint, err := crypto.NewKeyManager().CalculateKeyFingerprintFromPEM(publicKeyPEM)
+	if err != nil {
+		return fmt.Errorf("failed to calculate key fingerprint: %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	wellKnown, ok := s.domains[domain]
+	if !ok {
+		return fmt.Errorf("no document for domain %s", domain)
+	}
+	wellKnown.RevokedKeys = append(wellKnown.RevokedKeys, fingerprint)
+	return nil
+}
+
+// SetRevocationDocument serves doc as domain's standalone revocation
+// document, pointing the revocation_endpoint of domain's document at it.
+// A nil doc removes the endpoint.
+func (s *Stub) SetRevocationDocument(domain string, doc *revocation.RevocationDocument) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	wellKnown, ok := s.domains[domain]
+	if !ok {
+		return fmt.Errorf("no document for domain %s", domain)
+	}
+	endpoint := revocationEndpoint(domain)
+	if doc == nil {
+		wellKnown.RevocationEndpoint = ""
+		delete(s.revocations, endpoint)
+		return nil
+	}
+	wellKnown.RevocationEndpoint = endpoint
+	s.revocations[endpoint] = doc
+	return nil
+}
+
+// SetError makes fetches for domain fail with err, whether or not the
+// domain has a document, until SetError is called again with nil. Use a
+// *schemaerr.Error to fail with a particular kind; other errors are
+// classified as schemaerr.ErrDiscoveryFailed by workflows.
+func (s *Stub) SetError(domain string, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err == nil {
+		delete(s.errs, domain)
+		return
+	}
+	s.errs[domain] = err
+}
+
+// SetLatency delays fetches for domain by d, or until the context of the
+// fetch is done. A zero d removes the delay.
+func (s *Stub) SetLatency(domain string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if d <= 0 {
+		delete(s.latencies, domain)
+		return
+	}
+	s.latencies[domain] = d
+}
+
+// Calls returns the number of times FetchDiscovery was called for domain,
+// including calls that failed.
+func (s *Stub) Calls(domain string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[domain]
+}
+
+// FetchDiscovery returns a copy of domain's document, after any latency set
+// with SetLatency. It fails with the error set with SetError, if any, and
+// otherwise with schemaerr.ErrDiscoveryNotFound for a domain it does not
+// serve.
+func (s *Stub) FetchDiscovery(ctx context.Context, domain string) (*discovery.WellKnownResponse, error) {
+	s.mu.Lock()
+	s.calls[domain]++
+	latency := s.latencies[domain]
+	s.mu.Unlock()
+
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return nil, &schemaerr.Error{Kind: schemaerr.ErrDiscoveryFailed, Domain: domain,
+				Err: fmt.Errorf("failed to fetch .well-known file: %w", ctx.Err())}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err, ok := s.errs[domain]; ok {
+		return nil, err
+	}
+	wellKnown, ok := s.domains[domain]
+	if !ok {
+		return nil, &schemaerr.Error{Kind: schemaerr.ErrDiscoveryNotFound, Domain: domain,
+			Message: fmt.Sprintf("no .well-known document for %s", domain)}
+	}
+	response := copyWellKnown(wellKnown)
+	response.SourceURL = discovery.ConstructWellKnownURL(domain)
+	response.Domain = domain
+	return response, nil
+}
+
+// RevocationDocument returns the document set with SetRevocationDocument
+// for wellKnown's revocation_endpoint, or nil if it names none. An
+// endpoint the stub does not serve fails with schemaerr.ErrDiscoveryNotFound.
+func (s *Stub) RevocationDocument(ctx context.Context, wellKnown *discovery.WellKnownResponse) (*revocation.RevocationDocument, error) {
+	endpoint := wellKnown.RevocationEndpoint
+	if endpoint == "" {
+		return nil, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	doc, ok := s.revocations[endpoint]
+	if !ok {
+		return nil, &schemaerr.Error{Kind: schemaerr.ErrDiscoveryNotFound, Domain: wellKnown.Domain,
+			Message: fmt.Sprintf("no revocation document at %s", endpoint)}
+	}
+	return doc, nil
+}
+
+func revocationEndpoint(domain string) string {
+	return "https://" + domain + "/.well-known/schemapin-revocations.json"
+}
+
+// copyWellKnown copies wellKnown deeply enough that the copy can be handed
+// out while the stub goes on changing the original.
+func copyWellKnown(wellKnown *discovery.WellKnownResponse) *discovery.WellKnownResponse {
+	c := *wellKnown
+	c.RevokedKeys = append([]string(nil), wellKnown.RevokedKeys...)
+	if wellKnown.Tools != nil {
+		c.Tools = make(map[string]discovery.ToolKey, len(wellKnown.Tools))
+		for prefix, key := range wellKnown.Tools {
+			key.RevokedKeys = append([]string(nil), key.RevokedKeys...)
+			c.Tools[prefix] = key
+		}
+	}
+	return &c
+}
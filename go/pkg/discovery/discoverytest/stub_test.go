@@ -0,0 +1,158 @@
+package discoverytest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/revocation"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+)
+
+func TestStubFetchDiscovery(t *testing.T) {
+	stub := New()
+	key, err := stub.GenerateDomain("example.com", "Example Corp")
+	if err != nil {
+		t.Fatalf("GenerateDomain failed: %v", err)
+	}
+	ctx := context.Background()
+
+	wellKnown, err := stub.FetchDiscovery(ctx, "example.com")
+	if err != nil {
+		t.Fatalf("FetchDiscovery failed: %v", err)
+	}
+	if wellKnown.PublicKeyPEM != key.PublicKeyPEM || wellKnown.DeveloperName != "Example Corp" {
+		t.Errorf("Expected the generated key and developer, got %+v", wellKnown)
+	}
+	if wellKnown.Domain != "example.com" || wellKnown.SourceURL != discovery.ConstructWellKnownURL("example.com") {
+		t.Errorf("Expected domain and source URL to be set, got %q %q", wellKnown.Domain, wellKnown.SourceURL)
+	}
+	if !discovery.ValidateWellKnownResponse(wellKnown) {
+		t.Error("Expected the generated document to validate")
+	}
+
+	// Documents handed out are copies
+	wellKnown.RevokedKeys = append(wellKnown.RevokedKeys, key.Fingerprint)
+	if again, _ := stub.FetchDiscovery(ctx, "example.com"); len(again.RevokedKeys) != 0 {
+		t.Errorf("Expected the stub's document to be unchanged, got %v", again.RevokedKeys)
+	}
+
+	if err := stub.Revoke("example.com", key.PublicKeyPEM); err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+	wellKnown, _ = stub.FetchDiscovery(ctx, "example.com")
+	if wellKnown.KeyNotRevoked(key.PublicKeyPEM) {
+		t.Error("Expected the key to be revoked")
+	}
+
+	if _, err := stub.FetchDiscovery(ctx, "unknown.example"); !errors.Is(err, schemaerr.ErrDiscoveryNotFound) {
+		t.Errorf("Expected ErrDiscoveryNotFound for an unknown domain, got %v", err)
+	}
+	if err := stub.Revoke("unknown.example", key.PublicKeyPEM); err == nil {
+		t.Error("Expected Revoke to fail for an unknown domain")
+	}
+
+	if calls := stub.Calls("example.com"); calls != 3 {
+		t.Errorf("Expected 3 calls for example.com, got %d", calls)
+	}
+	if calls := stub.Calls("unknown.example"); calls != 1 {
+		t.Errorf("Expected 1 call for unknown.example, got %d", calls)
+	}
+}
+
+func TestStubErrorsAndLatency(t *testing.T) {
+	stub := New()
+	if _, err := stub.GenerateDomain("example.com", "Example Corp"); err != nil {
+		t.Fatal(err)
+	}
+
+	injected := &schemaerr.Error{Kind: schemaerr.ErrDiscoveryFailed, Domain: "example.com", Message: "connection refused"}
+	stub.SetError("example.com", injected)
+	if _, err := stub.FetchDiscovery(context.Background(), "example.com"); err != injected {
+		t.Errorf("Expected the injected error, got %v", err)
+	}
+	stub.SetError("example.com", nil)
+	if _, err := stub.FetchDiscovery(context.Background(), "example.com"); err != nil {
+		t.Errorf("Expected the error to be cleared, got %v", err)
+	}
+
+	stub.SetLatency("example.com", time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := stub.FetchDiscovery(ctx, "example.com"); !errors.Is(err, context.DeadlineExceeded) || !errors.Is(err, schemaerr.ErrDiscoveryFailed) {
+		t.Errorf("Expected a failed discovery on timeout, got %v", err)
+	}
+
+	stub.SetLatency("example.com", 20*time.Millisecond)
+	start := time.Now()
+	if _, err := stub.FetchDiscovery(context.Background(), "example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("Expected the fetch to take at least 20ms, took %v", elapsed)
+	}
+}
+
+func TestStubRevocationDocument(t *testing.T) {
+	stub := New()
+	key, err := stub.GenerateDomain("example.com", "Example Corp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	wellKnown, _ := stub.FetchDiscovery(ctx, "example.com")
+	if doc, err := stub.RevocationDocument(ctx, wellKnown); doc != nil || err != nil {
+		t.Errorf("Expected no revocation document, got %v, %v", doc, err)
+	}
+
+	doc := revocation.BuildRevocationDocument("example.com")
+	revocation.AddRevokedKey(doc, key.Fingerprint, revocation.ReasonKeyCompromise)
+	if err := stub.SetRevocationDocument("example.com", doc); err != nil {
+		t.Fatal(err)
+	}
+	wellKnown, _ = stub.FetchDiscovery(ctx, "example.com")
+	got, err := stub.RevocationDocument(ctx, wellKnown)
+	if err != nil {
+		t.Fatalf("RevocationDocument failed: %v", err)
+	}
+	if revocation.CheckRevocation(got, key.Fingerprint) == nil {
+		t.Error("Expected the key to be revoked by the document")
+	}
+}
+
+// Stubs are shared by concurrent verifications; run with -race.
+func TestStubConcurrentUse(t *testing.T) {
+	stub := New()
+	key, err := stub.GenerateDomain("example.com", "Example Corp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				if _, err := stub.FetchDiscovery(context.Background(), "example.com"); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				_ = stub.Revoke("example.com", key.PublicKeyPEM)
+				stub.SetLatency("example.com", time.Microsecond)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls := stub.Calls("example.com"); calls != 200 {
+		t.Errorf("Expected 200 calls, got %d", calls)
+	}
+}
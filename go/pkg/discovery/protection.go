@@ -0,0 +1,154 @@
+package discovery
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/internal/logging"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+)
+
+// ProtectionStats counts the activity of the rate limiter and circuit
+// breaker since the PublicKeyDiscovery was created.
+type ProtectionStats struct {
+	// RateLimited counts requests refused by the rate limiter.
+	RateLimited int64 `json:"rate_limited"`
+	// RateLimitDelayed counts requests the rate limiter delayed.
+	RateLimitDelayed int64 `json:"rate_limit_delayed"`
+	// CircuitRejected counts requests refused by an open circuit.
+	CircuitRejected int64 `json:"circuit_rejected"`
+	// CircuitOpened counts circuits opening, including reopening after a
+	// failed trial request.
+	CircuitOpened int64 `json:"circuit_opened"`
+	// CircuitClosed counts circuits closing after a successful trial.
+	CircuitClosed int64 `json:"circuit_closed"`
+}
+
+type protectionCounters struct {
+	rateLimited      atomic.Int64
+	rateLimitDelayed atomic.Int64
+	circuitRejected  atomic.Int64
+	circuitOpened    atomic.Int64
+	circuitClosed    atomic.Int64
+}
+
+// ProtectionStats returns the rate limiter and circuit breaker counters.
+func (p *PublicKeyDiscovery) ProtectionStats() ProtectionStats {
+	return ProtectionStats{
+		RateLimited:      p.stats.rateLimited.Load(),
+		RateLimitDelayed: p.stats.rateLimitDelayed.Load(),
+		CircuitRejected:  p.stats.circuitRejected.Load(),
+		CircuitOpened:    p.stats.circuitOpened.Load(),
+		CircuitClosed:    p.stats.circuitClosed.Load(),
+	}
+}
+
+// CircuitState returns the state of domain's circuit. It is always
+// CircuitClosed without WithCircuitBreaker.
+func (p *PublicKeyDiscovery) CircuitState(domain string) CircuitState {
+	if p.breaker == nil {
+		return CircuitClosed
+	}
+	return p.breaker.state(protectionKey(p.ConstructWellKnownURL(domain)))
+}
+
+// protectionKey is the host that rate limits and circuits apply to.
+func protectionKey(wellKnownURL string) string {
+	u, err := url.Parse(wellKnownURL)
+	if err != nil {
+		return wellKnownURL
+	}
+	return strings.ToLower(u.Host)
+}
+
+// admit applies the circuit breaker and then the rate limiter to a request
+// for domain, waiting if the rate limiter delays it. A refused request
+// returns a *schemaerr.Error of kind ErrDiscoveryCircuitOpen or
+// ErrDiscoveryRateLimited.
+func (p *PublicKeyDiscovery) admit(ctx context.Context, domain, host string) error {
+	if p.breaker != nil {
+		if retryAfter, ok := p.breaker.allow(host, p.clock.Now()); !ok {
+			p.stats.circuitRejected.Add(1)
+			return &schemaerr.Error{Kind: schemaerr.ErrDiscoveryCircuitOpen, Domain: domain, Err: &CircuitOpenError{Domain: domain, RetryAfter: retryAfter}}
+		}
+	}
+	if p.rateLimiter == nil {
+		return nil
+	}
+
+	wait, ok := p.rateLimiter.reserve(host, p.clock.Now())
+	if !ok {
+		p.stats.rateLimited.Add(1)
+		p.releaseTrial(host)
+		return &schemaerr.Error{Kind: schemaerr.ErrDiscoveryRateLimited, Domain: domain, Err: &RateLimitedError{Domain: domain, RetryAfter: wait}}
+	}
+	if wait <= 0 {
+		return nil
+	}
+
+	p.stats.rateLimitDelayed.Add(1)
+	p.logger.DebugContext(ctx, "discovery delayed by rate limit",
+		logging.KeyDomain, domain,
+		logging.KeyDuration, wait)
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		p.releaseTrial(host)
+		return &schemaerr.Error{Kind: schemaerr.ErrDiscoveryFailed, Domain: domain, Err: ctx.Err()}
+	}
+}
+
+func (p *PublicKeyDiscovery) releaseTrial(host string) {
+	if p.breaker != nil {
+		p.breaker.release(host)
+	}
+}
+
+// recordOutcome feeds the result of a request to the circuit breaker.
+func (p *PublicKeyDiscovery) recordOutcome(ctx context.Context, domain, host string, err error) {
+	if p.breaker == nil {
+		return
+	}
+	if err != nil && ctx.Err() != nil {
+		// Canceled or timed out by the caller, not the host
+		p.breaker.release(host)
+		return
+	}
+
+	switch p.breaker.record(host, isOutage(err), p.clock.Now()) {
+	case CircuitOpen:
+		p.stats.circuitOpened.Add(1)
+		p.logger.WarnContext(ctx, "discovery circuit opened",
+			logging.KeyDomain, domain,
+			logging.KeyError, err,
+			"cool_down", p.breaker.policy.CoolDown)
+	case CircuitClosed:
+		p.stats.circuitClosed.Add(1)
+		p.logger.InfoContext(ctx, "discovery circuit closed", logging.KeyDomain, domain)
+	}
+}
+
+// isOutage reports whether err means the host is unavailable, as opposed
+// to a server that answered, however unhelpfully.
+func isOutage(err error) bool {
+	if err == nil {
+		return false
+	}
+	var statusErr *HTTPStatusError
+	if errors.As(err, &statusErr) {
+		switch code := statusErr.StatusCode; {
+		case code == http.StatusRequestTimeout, code == http.StatusTooManyRequests, code >= 500:
+			return true
+		}
+		return false
+	}
+	return schemaerr.KindOf(err) == schemaerr.ErrDiscoveryFailed
+}
@@ -0,0 +1,101 @@
+package discovery
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+)
+
+// RateLimitPolicy limits how often discovery contacts each domain, so that
+// a verification loop or a large batch from one vendor cannot flood that
+// vendor's web server. Each host has a token bucket that refills at
+// RequestsPerSecond and holds up to Burst requests.
+type RateLimitPolicy struct {
+	// RequestsPerSecond is the sustained request rate allowed per host.
+	RequestsPerSecond float64
+	// Burst is the number of requests a host may receive at once. Values
+	// below 1 are treated as 1.
+	Burst int
+	// MaxWait is how long a request may be delayed waiting for its host's
+	// bucket to refill. Requests that would wait longer fail at once with
+	// a *RateLimitedError. Zero never delays.
+	MaxWait time.Duration
+}
+
+// WithRateLimit enables per-host rate limiting. By default discovery is
+// not rate limited.
+func WithRateLimit(policy RateLimitPolicy) Option {
+	return func(p *PublicKeyDiscovery) {
+		if policy.RequestsPerSecond <= 0 {
+			p.rateLimiter = nil
+			return
+		}
+		if policy.Burst < 1 {
+			policy.Burst = 1
+		}
+		p.rateLimiter = &rateLimiter{policy: policy, buckets: make(map[string]*tokenBucket)}
+	}
+}
+
+// RateLimitedError is returned, without contacting the domain, when a
+// discovery request exceeds the RateLimitPolicy.
+type RateLimitedError struct {
+	Domain string
+	// RetryAfter is how long until the domain's bucket has room again.
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitedError) Error() string {
+	return fmt.Sprintf("discovery for %s is rate limited; retry after %s", e.Domain, e.RetryAfter.Round(time.Millisecond))
+}
+
+// Is matches schemaerr.ErrDiscoveryRateLimited.
+func (e *RateLimitedError) Is(target error) bool {
+	return target == schemaerr.ErrDiscoveryRateLimited
+}
+
+type rateLimiter struct {
+	policy  RateLimitPolicy
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// reserve takes a token from host's bucket at now and returns how long the
+// caller must wait before using it. If that is longer than MaxWait, no
+// token is taken and ok is false; wait is then the time until a token
+// would be available without waiting.
+func (l *rateLimiter) reserve(host string, now time.Time) (wait time.Duration, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	burst := float64(l.policy.Burst)
+	b, found := l.buckets[host]
+	if !found {
+		b = &tokenBucket{tokens: burst, last: now}
+		l.buckets[host] = b
+	}
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = min(burst, b.tokens+elapsed.Seconds()*l.policy.RequestsPerSecond)
+		b.last = now
+	}
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	// Reserving against a negative balance queues waiting requests behind
+	// each other.
+	wait = time.Duration((1 - b.tokens) / l.policy.RequestsPerSecond * float64(time.Second))
+	if wait > l.policy.MaxWait {
+		return wait, false
+	}
+	b.tokens--
+	return wait, true
+}
@@ -0,0 +1,93 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+)
+
+func TestRateLimitFailsFast(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		_ = json.NewEncoder(w).Encode(WellKnownResponse{SchemaVersion: "1.2", PublicKeyPEM: "-----BEGIN PUBLIC KEY-----"})
+	}))
+	defer server.Close()
+
+	fake := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	d := NewPublicKeyDiscovery(WithClock(fake), WithRateLimit(RateLimitPolicy{RequestsPerSecond: 2, Burst: 2}))
+
+	for i := 0; i < 2; i++ {
+		if _, err := d.FetchDiscovery(context.Background(), server.URL); err != nil {
+			t.Fatalf("Expected request %d within the burst to succeed, got %v", i+1, err)
+		}
+	}
+
+	_, err := d.FetchDiscovery(context.Background(), server.URL)
+	var limitedErr *RateLimitedError
+	if !errors.Is(err, schemaerr.ErrDiscoveryRateLimited) || !errors.As(err, &limitedErr) {
+		t.Fatalf("Expected RateLimitedError, got %v", err)
+	}
+	if limitedErr.RetryAfter != 500*time.Millisecond {
+		t.Errorf("Expected RetryAfter 500ms, got %s", limitedErr.RetryAfter)
+	}
+	if requests.Load() != 2 {
+		t.Errorf("Expected the limited request not to reach the server, got %d requests", requests.Load())
+	}
+
+	// The bucket refills at RequestsPerSecond
+	fake.Advance(500 * time.Millisecond)
+	if _, err := d.FetchDiscovery(context.Background(), server.URL); err != nil {
+		t.Fatalf("Expected a request after refill to succeed, got %v", err)
+	}
+	if stats := d.ProtectionStats(); stats.RateLimited != 1 {
+		t.Errorf("Expected 1 rate-limited request, got %+v", stats)
+	}
+}
+
+func TestRateLimiterReserve(t *testing.T) {
+	l := &rateLimiter{policy: RateLimitPolicy{RequestsPerSecond: 10, Burst: 1, MaxWait: 250 * time.Millisecond}, buckets: make(map[string]*tokenBucket)}
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	// Waiting requests queue behind each other until MaxWait is exceeded
+	for i, want := range []time.Duration{0, 100 * time.Millisecond, 200 * time.Millisecond} {
+		if wait, ok := l.reserve("example.com", now); !ok || wait != want {
+			t.Fatalf("Reservation %d: expected wait %s, got %s (ok=%v)", i+1, want, wait, ok)
+		}
+	}
+	if wait, ok := l.reserve("example.com", now); ok || wait != 300*time.Millisecond {
+		t.Errorf("Expected a refusal with wait 300ms, got %s (ok=%v)", wait, ok)
+	}
+	if _, ok := l.reserve("other.example", now); !ok {
+		t.Error("Expected other hosts to have their own bucket")
+	}
+}
+
+func TestRateLimitDelays(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(WellKnownResponse{SchemaVersion: "1.2", PublicKeyPEM: "-----BEGIN PUBLIC KEY-----"})
+	}))
+	defer server.Close()
+
+	d := NewPublicKeyDiscovery(WithRateLimit(RateLimitPolicy{RequestsPerSecond: 50, Burst: 1, MaxWait: time.Second}))
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := d.FetchDiscovery(context.Background(), server.URL); err != nil {
+			t.Fatalf("Expected delayed request %d to succeed, got %v", i+1, err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 30*time.Millisecond {
+		t.Errorf("Expected requests to be spaced by the rate limit, took %s", elapsed)
+	}
+	if stats := d.ProtectionStats(); stats.RateLimitDelayed != 2 || stats.RateLimited != 0 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
@@ -0,0 +1,99 @@
+package discovery
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+)
+
+// DefaultMaxRedirects is the redirect chain limit of DefaultRedirectPolicy.
+const DefaultMaxRedirects = 3
+
+// RedirectPolicy controls which HTTP redirects discovery follows. Without
+// one, a .well-known request could be redirected to a host the domain's
+// owner does not control and the body would be trusted as that domain's
+// key.
+type RedirectPolicy struct {
+	// MaxRedirects caps the redirect chain. Zero follows no redirects.
+	MaxRedirects int
+	// AllowCrossDomain permits redirects to a different registrable domain
+	// than the one discovery started from.
+	AllowCrossDomain bool
+	// AllowInsecure permits redirects from HTTPS to plain HTTP.
+	AllowInsecure bool
+}
+
+// DefaultRedirectPolicy follows at most DefaultMaxRedirects redirects, only
+// within the starting registrable domain (so tools.example.com may redirect
+// to cdn.example.com) and never from HTTPS to HTTP.
+func DefaultRedirectPolicy() RedirectPolicy {
+	return RedirectPolicy{MaxRedirects: DefaultMaxRedirects}
+}
+
+// WithRedirectPolicy replaces DefaultRedirectPolicy.
+func WithRedirectPolicy(policy RedirectPolicy) Option {
+	return func(p *PublicKeyDiscovery) {
+		p.redirectPolicy = policy
+	}
+}
+
+// RedirectBlockedError is returned when a discovery redirect violates the
+// RedirectPolicy.
+type RedirectBlockedError struct {
+	From   string
+	To     string
+	Reason string
+}
+
+func (e *RedirectBlockedError) Error() string {
+	return fmt.Sprintf("redirect from %s to %s blocked: %s", e.From, e.To, e.Reason)
+}
+
+// Is matches schemaerr.ErrDiscoveryRedirectBlocked.
+func (e *RedirectBlockedError) Is(target error) bool {
+	return target == schemaerr.ErrDiscoveryRedirectBlocked
+}
+
+// CheckRedirect is an http.Client CheckRedirect function enforcing the
+// policy, for clients that fetch discovery documents themselves. via[0] is
+// the original request, whose host every hop is compared against.
+func (policy RedirectPolicy) CheckRedirect(req *http.Request, via []*http.Request) error {
+	origin := via[0].URL
+	previous := via[len(via)-1].URL
+	blocked := func(reason string) error {
+		return &RedirectBlockedError{From: previous.String(), To: req.URL.String(), Reason: reason}
+	}
+
+	if len(via) > policy.MaxRedirects {
+		return blocked(fmt.Sprintf("more than %d redirects", policy.MaxRedirects))
+	}
+	if previous.Scheme == "https" && req.URL.Scheme != "https" && !policy.AllowInsecure {
+		return blocked("downgrade from HTTPS to " + req.URL.Scheme)
+	}
+	if !policy.AllowCrossDomain && registrableDomain(req.URL.Hostname()) != registrableDomain(origin.Hostname()) {
+		return blocked("target is outside " + registrableDomain(origin.Hostname()))
+	}
+	return nil
+}
+
+// registrableDomain returns the registrable domain (eTLD+1) of host per
+// the public suffix list, including its private section, so tenants of
+// shared hosts such as vendor.github.io and attacker.github.io are
+// different sites. IP addresses, single-label hosts and public suffixes
+// themselves are returned unchanged.
+func registrableDomain(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if net.ParseIP(host) != nil {
+		return host
+	}
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return domain
+}
@@ -0,0 +1,199 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// newRedirectTestServer serves a .well-known document at final and
+// redirects each key of redirects to its value. Every host name resolves
+// to the test server.
+func newRedirectTestServer(t *testing.T, redirects map[string]string, final string) func(...Option) *PublicKeyDiscovery {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := "http://" + r.Host + r.URL.Path
+		if target, ok := redirects[current]; ok {
+			http.Redirect(w, r, target, http.StatusFound)
+			return
+		}
+		if current != final {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(WellKnownResponse{
+			SchemaVersion: "1.2",
+			DeveloperName: "Vendor",
+			PublicKeyPEM:  "-----BEGIN PUBLIC KEY-----\ntest\n-----END PUBLIC KEY-----",
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	addr := server.Listener.Addr().String()
+	return func(opts ...Option) *PublicKeyDiscovery {
+		p := NewPublicKeyDiscovery(opts...)
+		p.client.Transport = &http.Transport{
+			DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, addr)
+			},
+		}
+		return p
+	}
+}
+
+func TestFetchWellKnownRedirectPolicy(t *testing.T) {
+	const (
+		origin = "http://tools.example.com/.well-known/schemapin.json"
+		cdn    = "http://cdn.example.com/.well-known/schemapin.json"
+		evil   = "http://keys.example.net/.well-known/schemapin.json"
+	)
+
+	tests := []struct {
+		name      string
+		redirects map[string]string
+		final     string
+		opts      []Option
+		blocked   bool
+	}{
+		{"no redirect", nil, origin, nil, false},
+		{"same registrable domain", map[string]string{origin: cdn}, cdn, nil, false},
+		{"cross domain", map[string]string{origin: evil}, evil, nil, true},
+		{"cross domain via same-domain hop", map[string]string{origin: cdn, cdn: evil}, evil, nil, true},
+		{
+			"cross domain allowed by policy",
+			map[string]string{origin: evil}, evil,
+			[]Option{WithRedirectPolicy(RedirectPolicy{MaxRedirects: 3, AllowCrossDomain: true})},
+			false,
+		},
+		{
+			"redirects disabled",
+			map[string]string{origin: cdn}, cdn,
+			[]Option{WithRedirectPolicy(RedirectPolicy{})},
+			true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newDiscovery := newRedirectTestServer(t, tt.redirects, tt.final)
+			wellKnown, err := newDiscovery(tt.opts...).FetchWellKnown(context.Background(), "http://tools.example.com")
+
+			var redirectErr *RedirectBlockedError
+			if tt.blocked {
+				if !errors.As(err, &redirectErr) {
+					t.Fatalf("Expected *RedirectBlockedError, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FetchWellKnown failed: %v", err)
+			}
+			if wellKnown.SourceURL != tt.final {
+				t.Errorf("Expected source URL %s, got %s", tt.final, wellKnown.SourceURL)
+			}
+		})
+	}
+}
+
+func TestFetchWellKnownRedirectLimit(t *testing.T) {
+	hops := []string{"http://tools.example.com/.well-known/schemapin.json"}
+	for _, host := range []string{"a", "b", "c", "d"} {
+		hops = append(hops, "http://"+host+".example.com/.well-known/schemapin.json")
+	}
+	redirects := make(map[string]string)
+	for i := 0; i < len(hops)-1; i++ {
+		redirects[hops[i]] = hops[i+1]
+	}
+
+	// Four redirects exceed the default limit of three
+	newDiscovery := newRedirectTestServer(t, redirects, hops[len(hops)-1])
+	_, err := newDiscovery().FetchWellKnown(context.Background(), "http://tools.example.com")
+	var redirectErr *RedirectBlockedError
+	if !errors.As(err, &redirectErr) {
+		t.Fatalf("Expected *RedirectBlockedError, got %v", err)
+	}
+
+	wellKnown, err := newDiscovery(WithRedirectPolicy(RedirectPolicy{MaxRedirects: 4})).FetchWellKnown(context.Background(), "http://tools.example.com")
+	if err != nil {
+		t.Fatalf("Expected four redirects to be followed with MaxRedirects 4, got %v", err)
+	}
+	if wellKnown.SourceURL != hops[len(hops)-1] {
+		t.Errorf("Expected source URL %s, got %s", hops[len(hops)-1], wellKnown.SourceURL)
+	}
+}
+
+func TestRedirectPolicyInsecure(t *testing.T) {
+	request := func(rawURL string) *http.Request {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			t.Fatalf("Failed to parse URL: %v", err)
+		}
+		return &http.Request{URL: u}
+	}
+	via := []*http.Request{request("https://tools.example.com/.well-known/schemapin.json")}
+	target := request("http://tools.example.com/.well-known/schemapin.json")
+
+	if err := DefaultRedirectPolicy().CheckRedirect(target, via); err == nil {
+		t.Error("Expected an HTTPS to HTTP redirect to be blocked")
+	}
+	policy := RedirectPolicy{MaxRedirects: 3, AllowInsecure: true}
+	if err := policy.CheckRedirect(target, via); err != nil {
+		t.Errorf("Expected AllowInsecure to permit the downgrade, got %v", err)
+	}
+}
+
+func TestRegistrableDomain(t *testing.T) {
+	tests := map[string]string{
+		"example.com":          "example.com",
+		"tools.example.com":    "example.com",
+		"a.b.example.com":      "example.com",
+		"Tools.Example.COM.":   "example.com",
+		"tools.example.co.uk":  "example.co.uk",
+		"example.co.uk":        "example.co.uk",
+		"tools.example.com.au": "example.com.au",
+		"tools.example.io":     "example.io",
+		"127.0.0.1":            "127.0.0.1",
+		"localhost":            "localhost",
+		"::1":                  "::1",
+		"deep.sub.example.org": "example.org",
+		"vendor.github.io":     "vendor.github.io",
+		"cdn.vendor.github.io": "vendor.github.io",
+		"app.herokuapp.com":    "app.herokuapp.com",
+		"site.netlify.app":     "site.netlify.app",
+		"proj.pages.dev":       "proj.pages.dev",
+		"d111.cloudfront.net":  "d111.cloudfront.net",
+		"github.io":            "github.io",
+	}
+	for host, want := range tests {
+		if got := registrableDomain(host); got != want {
+			t.Errorf("registrableDomain(%q) = %q, want %q", host, got, want)
+		}
+	}
+}
+
+func TestRedirectPolicySharedHostTenants(t *testing.T) {
+	request := func(rawURL string) *http.Request {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			t.Fatalf("Failed to parse URL: %v", err)
+		}
+		return &http.Request{URL: u}
+	}
+
+	via := []*http.Request{request("https://vendor.github.io/.well-known/schemapin.json")}
+	target := request("https://attacker.github.io/.well-known/schemapin.json")
+	var redirectErr *RedirectBlockedError
+	if err := DefaultRedirectPolicy().CheckRedirect(target, via); !errors.As(err, &redirectErr) {
+		t.Errorf("Expected a redirect to another github.io tenant to be blocked, got %v", err)
+	}
+
+	target = request("https://docs.vendor.github.io/.well-known/schemapin.json")
+	if err := DefaultRedirectPolicy().CheckRedirect(target, via); err != nil {
+		t.Errorf("Expected a redirect within the tenant to be allowed, got %v", err)
+	}
+}
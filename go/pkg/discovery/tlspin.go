@@ -0,0 +1,169 @@
+package discovery
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+)
+
+// TLSPinMismatchError is returned when a pinned discovery host presents a
+// certificate chain in which no certificate matches its SPKI pins, or when
+// its pins cannot be checked at all, such as for a plain HTTP request.
+type TLSPinMismatchError struct {
+	Host string
+	// Reason explains why the pins could not be checked; it is empty for
+	// a certificate that matched no pin.
+	Reason string
+}
+
+func (e *TLSPinMismatchError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("TLS pins for %s cannot be enforced: %s", e.Host, e.Reason)
+	}
+	return fmt.Sprintf("TLS certificate for %s matches none of its configured SPKI pins", e.Host)
+}
+
+// Is matches schemaerr.ErrDiscoveryTLSPinMismatch.
+func (e *TLSPinMismatchError) Is(target error) bool {
+	return target == schemaerr.ErrDiscoveryTLSPinMismatch
+}
+
+// SPKIPin returns the pin of cert in the HPKP format (RFC 7469): the
+// base64 SHA-256 digest of its DER SubjectPublicKeyInfo.
+func SPKIPin(cert *x509.Certificate) string {
+	digest := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+	return base64.StdEncoding.EncodeToString(digest[:])
+}
+
+// ValidateTLSPin checks that pin is a base64 SHA-256 digest.
+func ValidateTLSPin(pin string) error {
+	digest, err := base64.StdEncoding.DecodeString(pin)
+	if err != nil || len(digest) != sha256.Size {
+		return fmt.Errorf("invalid TLS pin %q: expected a base64 SHA-256 digest", pin)
+	}
+	return nil
+}
+
+// WithTLSPins pins the TLS certificates of specific discovery hosts. pins
+// maps a host name to SPKI pins (see SPKIPin); a connection to a listed
+// host succeeds only if the certificate chain passes normal verification
+// and one of its certificates matches a pin, so a pin on an intermediate
+// or root also works. Hosts not listed are verified as usual. A host may be
+// given as a domain or URL; scheme, port and case are ignored.
+//
+// Pins are checked per connection, so they also apply to the target of a
+// redirect if that host is listed. Requests to a pinned host over anything
+// but HTTPS fail with a TLSPinMismatchError, since no pin could be checked.
+func WithTLSPins(pins map[string][]string) Option {
+	return func(p *PublicKeyDiscovery) {
+		p.tlsPins = make(tlsPinSet, len(pins))
+		for host, hostPins := range pins {
+			host = pinnedHost(host)
+			p.tlsPins[host] = append(p.tlsPins[host], hostPins...)
+		}
+	}
+}
+
+// tlsPinSet maps normalized host names to their SPKI pins.
+type tlsPinSet map[string][]string
+
+// transport wraps next, or http.DefaultTransport if nil, in a transport
+// enforcing the pins. Each pinned host gets its own clone of next whose
+// VerifyPeerCertificate knows which host it is checking; the server name
+// is not available to the callback itself. The clones keep no session
+// cache, so every connection performs a full handshake and the callback
+// always runs. A next that is not an *http.Transport cannot be cloned, so
+// requests to pinned hosts through it are refused.
+func (pins tlsPinSet) transport(next http.RoundTripper) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	t := &pinningTransport{base: next, hosts: make(map[string]http.RoundTripper, len(pins))}
+	base, ok := next.(*http.Transport)
+	if !ok {
+		for host := range pins {
+			t.hosts[host] = nil
+		}
+		return t
+	}
+
+	for host, want := range pins {
+		hostTransport := base.Clone()
+		if hostTransport.TLSClientConfig == nil {
+			hostTransport.TLSClientConfig = &tls.Config{}
+		}
+		if hostTransport.TLSClientConfig.MinVersion < tls.VersionTLS12 {
+			hostTransport.TLSClientConfig.MinVersion = tls.VersionTLS12
+		}
+		hostTransport.TLSClientConfig.ClientSessionCache = nil
+		hostTransport.TLSClientConfig.VerifyPeerCertificate = verifyPins(host, want)
+		t.hosts[host] = hostTransport
+	}
+	return t
+}
+
+// verifyPins returns a VerifyPeerCertificate callback accepting a chain
+// in which any presented certificate matches one of want. It runs after
+// normal chain verification, which it does not replace.
+func verifyPins(host string, want []string) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		for _, raw := range rawCerts {
+			cert, err := x509.ParseCertificate(raw)
+			if err != nil {
+				continue
+			}
+			presented := SPKIPin(cert)
+			for _, pin := range want {
+				if pin == presented {
+					return nil
+				}
+			}
+		}
+		return &TLSPinMismatchError{Host: host}
+	}
+}
+
+// pinningTransport routes requests for pinned hosts to their transports.
+// A nil host transport marks a pinned host that cannot be reached.
+type pinningTransport struct {
+	base  http.RoundTripper
+	hosts map[string]http.RoundTripper
+}
+
+func (t *pinningTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := pinnedHost(req.URL.Host)
+	hostTransport, ok := t.hosts[host]
+	if !ok {
+		return t.base.RoundTrip(req)
+	}
+	if req.URL.Scheme != "https" {
+		return nil, &TLSPinMismatchError{Host: host, Reason: req.URL.Scheme + " request has no TLS handshake"}
+	}
+	if hostTransport == nil {
+		return nil, &TLSPinMismatchError{Host: host, Reason: fmt.Sprintf("custom transport %T does not expose TLS settings", t.base)}
+	}
+	return hostTransport.RoundTrip(req)
+}
+
+// pinnedHost reduces a domain or URL to a lower-case host name without
+// scheme, path, port or trailing dot.
+func pinnedHost(domain string) string {
+	host := strings.ToLower(strings.TrimSpace(domain))
+	if i := strings.Index(host, "://"); i >= 0 {
+		host = host[i+3:]
+	}
+	if i := strings.IndexByte(host, '/'); i >= 0 {
+		host = host[:i]
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(host, ".")
+}
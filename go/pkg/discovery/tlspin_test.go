@@ -0,0 +1,154 @@
+package discovery
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// newPinnedTestServer serves a .well-known document over TLS and returns it
+// with a constructor for discovery clients that trust its certificate.
+func newPinnedTestServer(t *testing.T) (*httptest.Server, func(...Option) *PublicKeyDiscovery) {
+	t.Helper()
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(WellKnownResponse{
+			SchemaVersion: "1.2",
+			DeveloperName: "Vendor",
+			PublicKeyPEM:  "-----BEGIN PUBLIC KEY-----\ntest\n-----END PUBLIC KEY-----",
+		})
+	}))
+	t.Cleanup(server.Close)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+	return server, func(opts ...Option) *PublicKeyDiscovery {
+		p := NewPublicKeyDiscovery(append([]Option{WithHTTPClient(client)}, opts...)...)
+		if _, ok := p.client.Transport.(*pinningTransport); !ok {
+			t.Fatalf("Expected a pinning transport, got %T", p.client.Transport)
+		}
+		return p
+	}
+}
+
+func TestFetchDiscoveryTLSPins(t *testing.T) {
+	server, newDiscovery := newPinnedTestServer(t)
+	serverPin := SPKIPin(server.Certificate())
+	otherDigest := sha256.Sum256([]byte("some other key"))
+	otherPin := base64.StdEncoding.EncodeToString(otherDigest[:])
+
+	tests := []struct {
+		name     string
+		pins     map[string][]string
+		mismatch bool
+	}{
+		{"matching pin", map[string][]string{"127.0.0.1": {otherPin, serverPin}}, false},
+		{"matching pin with scheme and port", map[string][]string{server.URL: {serverPin}}, false},
+		{"mismatching pin", map[string][]string{"127.0.0.1": {otherPin}}, true},
+		{"unpinned domain", map[string][]string{"tools.criticalvendor.com": {otherPin}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newDiscovery(WithTLSPins(tt.pins))
+			wellKnown, err := p.FetchDiscovery(context.Background(), server.URL)
+
+			var pinErr *TLSPinMismatchError
+			if tt.mismatch {
+				if !errors.As(err, &pinErr) {
+					t.Fatalf("Expected TLSPinMismatchError, got %v", err)
+				}
+				if pinErr.Host != "127.0.0.1" {
+					t.Errorf("Expected host 127.0.0.1, got %s", pinErr.Host)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected discovery to succeed, got %v", err)
+			}
+			if wellKnown.DeveloperName != "Vendor" {
+				t.Errorf("Unexpected document: %+v", wellKnown)
+			}
+		})
+	}
+}
+
+func TestFetchDiscoveryTLSPinsKeepChainVerification(t *testing.T) {
+	server, _ := newPinnedTestServer(t)
+
+	// A matching pin does not stand in for an untrusted chain
+	p := NewPublicKeyDiscovery(WithTLSPins(map[string][]string{"127.0.0.1": {SPKIPin(server.Certificate())}}))
+	_, err := p.FetchDiscovery(context.Background(), server.URL)
+	var unknownAuthority x509.UnknownAuthorityError
+	if !errors.As(err, &unknownAuthority) {
+		t.Fatalf("Expected an unknown authority error, got %v", err)
+	}
+}
+
+func TestFetchDiscoveryTLSPinsRejectPlainHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("Expected no request to reach a pinned host over plain HTTP")
+	}))
+	defer server.Close()
+
+	digest := sha256.Sum256([]byte("key"))
+	p := NewPublicKeyDiscovery(WithTLSPins(map[string][]string{"127.0.0.1": {base64.StdEncoding.EncodeToString(digest[:])}}))
+	_, err := p.FetchDiscovery(context.Background(), server.URL)
+	var pinErr *TLSPinMismatchError
+	if !errors.As(err, &pinErr) {
+		t.Fatalf("Expected TLSPinMismatchError, got %v", err)
+	}
+	if pinErr.Reason == "" {
+		t.Error("Expected the error to explain why the pins were not checked")
+	}
+}
+
+// roundTripFunc is an opaque http.RoundTripper.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestFetchDiscoveryTLSPinsCustomTransport(t *testing.T) {
+	server, _ := newPinnedTestServer(t)
+	var used bool
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		used = true
+		return nil, errors.New("unreachable")
+	})}
+
+	// Unpinned hosts go through the caller's transport
+	p := NewPublicKeyDiscovery(WithHTTPClient(client), WithTLSPins(map[string][]string{"tools.criticalvendor.com": {SPKIPin(server.Certificate())}}))
+	_, _ = p.FetchDiscovery(context.Background(), server.URL)
+	if !used {
+		t.Error("Expected the caller's transport to be used for unpinned hosts")
+	}
+
+	// Pinned hosts cannot be checked through an opaque transport
+	p = NewPublicKeyDiscovery(WithHTTPClient(client), WithTLSPins(map[string][]string{"127.0.0.1": {SPKIPin(server.Certificate())}}))
+	_, err := p.FetchDiscovery(context.Background(), server.URL)
+	var pinErr *TLSPinMismatchError
+	if !errors.As(err, &pinErr) {
+		t.Fatalf("Expected TLSPinMismatchError, got %v", err)
+	}
+}
+
+func TestValidateTLSPin(t *testing.T) {
+	digest := sha256.Sum256([]byte("key"))
+	if err := ValidateTLSPin(base64.StdEncoding.EncodeToString(digest[:])); err != nil {
+		t.Errorf("Expected valid pin, got %v", err)
+	}
+	for _, pin := range []string{"", "not base64!", base64.StdEncoding.EncodeToString(digest[:16])} {
+		if err := ValidateTLSPin(pin); err == nil {
+			t.Errorf("Expected %q to be rejected", pin)
+		}
+	}
+}
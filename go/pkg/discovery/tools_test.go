@@ -0,0 +1,147 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type toolKeyFixture struct {
+	WellKnown WellKnownResponse `json:"well_known"`
+	Cases     []struct {
+		ToolID        string `json:"tool_id"`
+		Scope         string `json:"scope"`
+		Key           string `json:"key"`
+		DeveloperName string `json:"developer_name"`
+	} `json:"cases"`
+}
+
+// loadToolKeyFixture reads tests/cross-language/per_tool_well_known.json,
+// walking up from the test working directory to the repo root.
+func loadToolKeyFixture(t *testing.T) *toolKeyFixture {
+	t.Helper()
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getwd: %v", err)
+	}
+	for {
+		candidate := filepath.Join(dir, "tests", "cross-language", "per_tool_well_known.json")
+		if raw, err := os.ReadFile(candidate); err == nil { //nolint:gosec // test fixture path
+			var fixture toolKeyFixture
+			if err := json.Unmarshal(raw, &fixture); err != nil {
+				t.Fatalf("unmarshal fixture: %v", err)
+			}
+			return &fixture
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			t.Fatal("could not locate tests/cross-language/per_tool_well_known.json")
+		}
+		dir = parent
+	}
+}
+
+func TestKeyForToolCrossLanguageFixture(t *testing.T) {
+	fixture := loadToolKeyFixture(t)
+	if !ValidateWellKnownResponse(&fixture.WellKnown) {
+		t.Fatal("fixture well-known document should validate")
+	}
+
+	for _, tc := range fixture.Cases {
+		t.Run(tc.ToolID, func(t *testing.T) {
+			scoped := fixture.WellKnown.KeyForTool(tc.ToolID)
+
+			wantKey := fixture.WellKnown.PublicKeyPEM
+			if tc.Key != "" {
+				wantKey = fixture.WellKnown.Tools[tc.Key].PublicKeyPEM
+			}
+			if scoped.Scope != tc.Scope {
+				t.Errorf("Scope = %q, want %q", scoped.Scope, tc.Scope)
+			}
+			if scoped.PublicKeyPEM != wantKey {
+				t.Errorf("selected key for %q does not match %q", tc.ToolID, tc.Key)
+			}
+			if scoped.DeveloperName != tc.DeveloperName {
+				t.Errorf("DeveloperName = %q, want %q", scoped.DeveloperName, tc.DeveloperName)
+			}
+		})
+	}
+}
+
+func TestKeyForToolRevocationInheritance(t *testing.T) {
+	wellKnown := &WellKnownResponse{
+		SchemaVersion: "1.2",
+		PublicKeyPEM:  "domain-key",
+		RevokedKeys:   []string{"domain-revoked"},
+		Tools: map[string]ToolKey{
+			"/acme/": {PublicKeyPEM: "acme-key", RevokedKeys: []string{"acme-revoked"}},
+		},
+	}
+
+	scoped := wellKnown.KeyForTool("acme/search")
+	if scoped.Scope != "acme" {
+		t.Fatalf("Scope = %q, want acme", scoped.Scope)
+	}
+	if !CheckKeyRevocation("domain-revoked", scoped.RevokedKeys) || !CheckKeyRevocation("acme-revoked", scoped.RevokedKeys) {
+		t.Errorf("tool scope should inherit domain revocations, got %v", scoped.RevokedKeys)
+	}
+	if domainScoped := wellKnown.KeyForTool("other"); CheckKeyRevocation("acme-revoked", domainScoped.RevokedKeys) {
+		t.Error("tool-scoped revocations must not apply to the domain key")
+	}
+}
+
+func TestValidateToolKeys(t *testing.T) {
+	tests := []struct {
+		name  string
+		tools map[string]ToolKey
+		valid bool
+	}{
+		{"none", nil, true},
+		{"valid", map[string]ToolKey{"acme": {PublicKeyPEM: "pem"}, "acme/search": {PublicKeyPEM: "pem"}}, true},
+		{"empty prefix", map[string]ToolKey{"/": {PublicKeyPEM: "pem"}}, false},
+		{"missing key", map[string]ToolKey{"acme": {DeveloperName: "Acme"}}, false},
+		{"duplicate prefix", map[string]ToolKey{"acme": {PublicKeyPEM: "a"}, "/acme/": {PublicKeyPEM: "b"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateToolKeys(tt.tools)
+			if (err == nil) != tt.valid {
+				t.Errorf("ValidateToolKeys() error = %v, want valid %v", err, tt.valid)
+			}
+			response := &WellKnownResponse{SchemaVersion: "1.2", PublicKeyPEM: "pem", Tools: tt.tools}
+			if ValidateWellKnownResponse(response) != tt.valid {
+				t.Errorf("ValidateWellKnownResponse() = %v, want %v", !tt.valid, tt.valid)
+			}
+		})
+	}
+}
+
+func TestGetPublicKeyPEMForTool(t *testing.T) {
+	wellKnown := WellKnownResponse{
+		SchemaVersion: "1.2",
+		PublicKeyPEM:  "domain-key",
+		Tools: map[string]ToolKey{
+			"acme": {PublicKeyPEM: "acme-key"},
+		},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(wellKnown)
+	}))
+	defer server.Close()
+
+	d := NewPublicKeyDiscovery()
+	for toolID, want := range map[string]string{"acme/search": "acme-key", "globex/search": "domain-key"} {
+		got, err := d.GetPublicKeyPEMForTool(context.Background(), server.URL, toolID)
+		if err != nil {
+			t.Fatalf("GetPublicKeyPEMForTool(%q) error = %v", toolID, err)
+		}
+		if got != want {
+			t.Errorf("GetPublicKeyPEMForTool(%q) = %q, want %q", toolID, got, want)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package discovery
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMaxIdleConnsPerHost is the number of idle connections kept
+	// open per discovery host. It is higher than net/http's default of 2 so
+	// that a batch verifying many tools of one vendor concurrently reuses
+	// its connections instead of repeating TLS handshakes.
+	DefaultMaxIdleConnsPerHost = 16
+	// DefaultIdleConnTimeout is how long an idle discovery connection is
+	// kept open.
+	DefaultIdleConnTimeout = 90 * time.Second
+	// DefaultResponseHeaderTimeout is how long discovery waits for a
+	// server's response headers once the request is sent.
+	DefaultResponseHeaderTimeout = 10 * time.Second
+	// DefaultMaxResponseBytes caps the size of .well-known and revocation
+	// documents.
+	DefaultMaxResponseBytes = 1 << 20
+)
+
+// transportConfig tunes the transport discovery creates when the caller
+// does not supply one with WithHTTPClient.
+type transportConfig struct {
+	maxIdleConnsPerHost   int
+	idleConnTimeout       time.Duration
+	responseHeaderTimeout time.Duration
+	disableHTTP2          bool
+	rootCAs               *x509.CertPool
+}
+
+var defaultTransportConfig = transportConfig{
+	maxIdleConnsPerHost:   DefaultMaxIdleConnsPerHost,
+	idleConnTimeout:       DefaultIdleConnTimeout,
+	responseHeaderTimeout: DefaultResponseHeaderTimeout,
+}
+
+// sharedTransport is used by every PublicKeyDiscovery with the default
+// transport settings, so that clients created per verification still share
+// connections.
+var sharedTransport = sync.OnceValue(func() *http.Transport {
+	return defaultTransportConfig.transport()
+})
+
+// WithMaxIdleConnsPerHost sets how many idle connections are kept open per
+// discovery host (default DefaultMaxIdleConnsPerHost). Lower it where open
+// sockets are scarce; n below 1 keeps none, so every request connects anew.
+// It does not apply to a client given with WithHTTPClient that has its own
+// transport.
+func WithMaxIdleConnsPerHost(n int) Option {
+	return func(p *PublicKeyDiscovery) {
+		if n < 1 {
+			n = -1
+		}
+		p.transport.maxIdleConnsPerHost = n
+	}
+}
+
+// WithIdleConnTimeout sets how long idle discovery connections are kept
+// open (default DefaultIdleConnTimeout). It does not apply to a client
+// given with WithHTTPClient that has its own transport.
+func WithIdleConnTimeout(timeout time.Duration) Option {
+	return func(p *PublicKeyDiscovery) {
+		if timeout > 0 {
+			p.transport.idleConnTimeout = timeout
+		}
+	}
+}
+
+// WithResponseHeaderTimeout sets how long discovery waits for response
+// headers after sending a request (default DefaultResponseHeaderTimeout),
+// so that a server that accepts connections but never answers fails
+// before the overall timeout. It does not apply to a client given with
+// WithHTTPClient that has its own transport.
+func WithResponseHeaderTimeout(timeout time.Duration) Option {
+	return func(p *PublicKeyDiscovery) {
+		if timeout > 0 {
+			p.transport.responseHeaderTimeout = timeout
+		}
+	}
+}
+
+// WithMaxResponseBytes caps the size of the .well-known and revocation
+// documents read (default DefaultMaxResponseBytes). A larger response
+// fails with schemaerr.ErrDiscoveryResponseTooLarge after at most n bytes
+// are read.
+func WithMaxResponseBytes(n int64) Option {
+	return func(p *PublicKeyDiscovery) {
+		if n > 0 {
+			p.maxResponseBytes = n
+		}
+	}
+}
+
+// WithDisableHTTP2 makes discovery use HTTP/1.1 only, for servers or
+// middleboxes that mishandle HTTP/2. By default HTTP/2 is negotiated with
+// servers that offer it, so that concurrent requests to a host share one
+// connection. It does not apply to a client given with WithHTTPClient that
+// has its own transport.
+func WithDisableHTTP2(disable bool) Option {
+	return func(p *PublicKeyDiscovery) {
+		p.transport.disableHTTP2 = disable
+	}
+}
+
+// WithRootCAs verifies discovery servers against pool instead of the
+// system roots, e.g. for vendors behind an internal certificate authority.
+// It does not apply to a client given with WithHTTPClient that has its own
+// transport.
+func WithRootCAs(pool *x509.CertPool) Option {
+	return func(p *PublicKeyDiscovery) {
+		p.transport.rootCAs = pool
+	}
+}
+
+// newOrShared returns a new transport with c's settings, or the shared one
+// for the default settings.
+func (c transportConfig) newOrShared() *http.Transport {
+	if c == defaultTransportConfig {
+		return sharedTransport()
+	}
+	return c.transport()
+}
+
+// transport creates a transport with c's settings. Proxies, dial and
+// handshake timeouts are those of http.DefaultTransport.
+func (c transportConfig) transport() *http.Transport {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	t := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     !c.disableHTTP2,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   c.maxIdleConnsPerHost,
+		IdleConnTimeout:       c.idleConnTimeout,
+		ResponseHeaderTimeout: c.responseHeaderTimeout,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+	if c.rootCAs != nil {
+		t.TLSClientConfig = &tls.Config{RootCAs: c.rootCAs, MinVersion: tls.VersionTLS12}
+	}
+	if c.disableHTTP2 {
+		// A non-nil empty map keeps net/http from enabling HTTP/2
+		t.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	}
+	return t
+}
+
+// drainAndClose reads what is left of a response body, up to a limit,
+// before closing it, so that its connection can be reused.
+func drainAndClose(body io.ReadCloser) {
+	_, _ = io.Copy(io.Discard, io.LimitReader(body, 64<<10))
+	_ = body.Close()
+}
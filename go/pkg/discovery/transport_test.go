@@ -0,0 +1,180 @@
+package discovery
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/revocation"
+)
+
+// newTransportTestServer serves a .well-known document with a revocation
+// endpoint over TLS, with HTTP/2 enabled. It returns the server, the
+// roots trusting it and a counter of the connections it accepted.
+func newTransportTestServer(t *testing.T) (*httptest.Server, *x509.CertPool, *atomic.Int64) {
+	t.Helper()
+	var server *httptest.Server
+	server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Proto", r.Proto)
+		if r.URL.Path == "/revocations.json" {
+			_ = json.NewEncoder(w).Encode(revocation.BuildRevocationDocument("example.com"))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(WellKnownResponse{
+			SchemaVersion:      "1.2",
+			DeveloperName:      "Vendor",
+			PublicKeyPEM:       "-----BEGIN PUBLIC KEY-----\ntest\n-----END PUBLIC KEY-----",
+			RevocationEndpoint: server.URL + "/revocations.json",
+		})
+	}))
+	var conns atomic.Int64
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	return server, roots, &conns
+}
+
+// traceConns returns a context recording, for each connection obtained,
+// whether it was reused.
+func traceConns(ctx context.Context) (context.Context, func() (reused, fresh int)) {
+	var mu sync.Mutex
+	var reused, fresh int
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			if info.Reused {
+				reused++
+			} else {
+				fresh++
+			}
+		},
+	})
+	return ctx, func() (int, int) {
+		mu.Lock()
+		defer mu.Unlock()
+		return reused, fresh
+	}
+}
+
+func TestDiscoveryReusesConnections(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      []Option
+		wantProto string
+		wantConns int
+	}{
+		{"http2", nil, "HTTP/2.0", 1},
+		{"http1", []Option{WithDisableHTTP2(true)}, "HTTP/1.1", 1},
+		{"no idle connections", []Option{WithDisableHTTP2(true), WithMaxIdleConnsPerHost(0)}, "HTTP/1.1", 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, roots, conns := newTransportTestServer(t)
+			p := NewPublicKeyDiscovery(append([]Option{WithRootCAs(roots)}, tt.opts...)...)
+			ctx, counts := traceConns(context.Background())
+
+			var protos []string
+			p.client.Transport = &protoRecorder{next: p.client.Transport, protos: &protos}
+			for i := 0; i < 5; i++ {
+				wellKnown, err := p.FetchDiscovery(ctx, server.URL)
+				if err != nil {
+					t.Fatalf("FetchDiscovery failed: %v", err)
+				}
+				if _, err := p.RevocationDocument(ctx, wellKnown); err != nil {
+					t.Fatalf("RevocationDocument failed: %v", err)
+				}
+			}
+
+			for _, proto := range protos {
+				if proto != tt.wantProto {
+					t.Fatalf("Expected %s, got %q", tt.wantProto, protos)
+				}
+			}
+			// Ten requests: five discoveries and five revocation fetches
+			reused, fresh := counts()
+			if fresh != tt.wantConns || reused != 10-tt.wantConns || conns.Load() != int64(tt.wantConns) {
+				t.Errorf("Expected %d connection(s) for 10 requests, got %d fresh, %d reused, %d accepted", tt.wantConns, fresh, reused, conns.Load())
+			}
+		})
+	}
+}
+
+// protoRecorder records the protocol each response was served with.
+type protoRecorder struct {
+	next   http.RoundTripper
+	protos *[]string
+}
+
+func (r *protoRecorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := r.next.RoundTrip(req)
+	if err == nil {
+		*r.protos = append(*r.protos, resp.Header.Get("X-Proto"))
+	}
+	return resp, err
+}
+
+func TestDiscoverySharesDefaultTransport(t *testing.T) {
+	a, b := NewPublicKeyDiscovery(), NewPublicKeyDiscovery(WithLogger(nil))
+	if a.client.Transport != b.client.Transport || a.client.Transport != http.RoundTripper(sharedTransport()) {
+		t.Error("Expected clients with default settings to share one transport")
+	}
+	shared := sharedTransport()
+	if shared.MaxIdleConnsPerHost != DefaultMaxIdleConnsPerHost || shared.IdleConnTimeout != DefaultIdleConnTimeout || !shared.ForceAttemptHTTP2 {
+		t.Errorf("Unexpected shared transport settings: %+v", shared)
+	}
+
+	tuned := NewPublicKeyDiscovery(WithMaxIdleConnsPerHost(4), WithIdleConnTimeout(time.Minute))
+	transport, ok := tuned.client.Transport.(*http.Transport)
+	if !ok || transport == shared || transport.MaxIdleConnsPerHost != 4 || transport.IdleConnTimeout != time.Minute {
+		t.Errorf("Expected a dedicated tuned transport, got %+v", tuned.client.Transport)
+	}
+
+	custom := &http.Transport{}
+	withClient := NewPublicKeyDiscovery(WithHTTPClient(&http.Client{Transport: custom}), WithMaxIdleConnsPerHost(4))
+	if withClient.client.Transport != custom {
+		t.Errorf("Expected the caller's transport to be kept, got %T", withClient.client.Transport)
+	}
+}
+
+func TestDiscoveryCancellationClosesRequest(t *testing.T) {
+	closed := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		close(closed)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	start := time.Now()
+	_, err := NewPublicKeyDiscovery().FetchDiscovery(ctx, server.URL)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the request to end promptly, took %v", elapsed)
+	}
+	select {
+	case <-closed:
+	case <-time.After(2 * time.Second):
+		t.Error("Expected the server to see the request closed")
+	}
+}
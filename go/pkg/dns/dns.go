@@ -128,9 +128,8 @@ func VerifyDnsMatch(disc *discovery.WellKnownResponse, txt *DnsTxtRecord) error
 	if err != nil {
 		return fmt.Errorf("DNS TXT match: failed to compute fingerprint: %w", err)
 	}
-	computed = strings.ToLower(computed)
-	if computed != txt.Fingerprint {
-		return fmt.Errorf("DNS TXT fingerprint mismatch: discovery=%s, dns=%s", computed, txt.Fingerprint)
+	if !crypto.FingerprintEqual(computed, txt.Fingerprint) {
+		return fmt.Errorf("DNS TXT fingerprint mismatch: discovery=%s, dns=%s", crypto.NormalizeFingerprint(computed), txt.Fingerprint)
 	}
 	return nil
 }
@@ -1,7 +1,9 @@
 package dns
 
 import (
+	"fmt"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
@@ -127,10 +129,32 @@ func TestParseFieldWithoutEqualsFails(t *testing.T) {
 
 // --- VerifyDnsMatch tests ---
 
+// keysIssued counts the keys makeKeypair has handed to each running test,
+// so that every test gets distinct keys that are identical from run to run.
+var (
+	keysIssuedMu sync.Mutex
+	keysIssued   = map[string]int{}
+)
+
+// makeKeypair returns a seeded (deterministic, test-only) key pair. Repeated
+// calls within a test return different keys.
 func makeKeypair(t *testing.T) (string, string) {
 	t.Helper()
+	keysIssuedMu.Lock()
+	if keysIssued[t.Name()] == 0 {
+		name := t.Name()
+		t.Cleanup(func() {
+			keysIssuedMu.Lock()
+			delete(keysIssued, name)
+			keysIssuedMu.Unlock()
+		})
+	}
+	keysIssued[t.Name()]++
+	seed := fmt.Sprintf("dns-test/%s/%d", t.Name(), keysIssued[t.Name()])
+	keysIssuedMu.Unlock()
+
 	km := crypto.NewKeyManager()
-	priv, err := km.GenerateKeypair()
+	priv, err := km.GenerateKeypairFromSeed([]byte(seed), crypto.ForTesting)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -165,6 +189,12 @@ func TestVerifyMatch(t *testing.T) {
 	if err := VerifyDnsMatch(disc, txt); err != nil {
 		t.Errorf("expected match, got error: %v", err)
 	}
+
+	// A record built by hand rather than parsed is normalized too
+	txt.Fingerprint = " " + strings.ToUpper(fp) + " "
+	if err := VerifyDnsMatch(disc, txt); err != nil {
+		t.Errorf("expected match for an unnormalized fingerprint, got error: %v", err)
+	}
 }
 
 func TestVerifyMismatch(t *testing.T) {
@@ -0,0 +1,603 @@
+// Package doctor checks a domain's SchemaPin deployment: that its
+// .well-known/schemapin.json is reachable, valid and consistent with its
+// revocation data, and optionally that a schema signed with the developer's
+// private key verifies against what the domain publishes.
+//
+// The checks are independent of any CLI so hosting providers can run them
+// against the domains they serve.
+package doctor
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/internal/version"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/revocation"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+// CheckID identifies a check. IDs are stable so CI can match on them.
+type CheckID string
+
+const (
+	// CheckHTTPS — .well-known is served over HTTPS with a valid certificate.
+	CheckHTTPS CheckID = "https"
+	// CheckWellKnown — the document parses and passes discovery validation.
+	CheckWellKnown CheckID = "well_known"
+	// CheckPublicKey — the domain and per-tool public keys parse.
+	CheckPublicKey CheckID = "public_key"
+	// CheckRevokedKeys — revoked_keys entries are well formed and none
+	// revokes an active key.
+	CheckRevokedKeys CheckID = "revoked_keys"
+	// CheckRevocationDocument — the revocation_endpoint document, if any, is
+	// reachable and consistent with the discovery document.
+	CheckRevocationDocument CheckID = "revocation_document"
+	// CheckResponseSize — the document is small enough for verifiers.
+	CheckResponseSize CheckID = "response_size"
+	// CheckContentType — the document is served as JSON.
+	CheckContentType CheckID = "content_type"
+	// CheckCacheHeaders — Cache-Control lets verifiers cache the document
+	// without hiding revocations for long.
+	CheckCacheHeaders CheckID = "cache_headers"
+	// CheckRoundTrip — a sample schema signed with the private key verifies
+	// against the published key.
+	CheckRoundTrip CheckID = "round_trip"
+)
+
+// Status is the outcome of a check.
+type Status string
+
+const (
+	StatusPass Status = "pass"
+	StatusWarn Status = "warn"
+	StatusFail Status = "fail"
+	StatusSkip Status = "skip"
+)
+
+const (
+	// MaxResponseSize is the largest .well-known document accepted.
+	MaxResponseSize = 1 << 20
+	// WarnResponseSize is the size above which a document is reported as
+	// unusually large.
+	WarnResponseSize = 64 << 10
+	// MaxCacheAge is the longest Cache-Control max-age that does not delay
+	// revocations noticeably.
+	MaxCacheAge = 24 * time.Hour
+	// CertificateExpiryWarning is how close to expiry a TLS certificate is
+	// reported.
+	CertificateExpiryWarning = 14 * 24 * time.Hour
+)
+
+// CheckResult is the outcome of one check.
+type CheckResult struct {
+	ID      CheckID `json:"id"`
+	Status  Status  `json:"status"`
+	Message string  `json:"message"`
+}
+
+// Report is the outcome of Run.
+type Report struct {
+	Domain string `json:"domain"`
+	URL    string `json:"url"`
+	// SourceURL is the URL the document was served from after redirects.
+	SourceURL   string        `json:"source_url,omitempty"`
+	Fingerprint string        `json:"fingerprint,omitempty"`
+	OK          bool          `json:"ok"`
+	Checks      []CheckResult `json:"checks"`
+}
+
+// Count returns the number of checks with status.
+func (r *Report) Count(status Status) int {
+	n := 0
+	for _, check := range r.Checks {
+		if check.Status == status {
+			n++
+		}
+	}
+	return n
+}
+
+func (r *Report) add(id CheckID, status Status, format string, args ...interface{}) {
+	r.Checks = append(r.Checks, CheckResult{ID: id, Status: status, Message: fmt.Sprintf(format, args...)})
+}
+
+// Doctor runs deployment checks.
+type Doctor struct {
+	client        *http.Client
+	clock         clock.Clock
+	privateKeyPEM string
+	schema        map[string]interface{}
+	toolID        string
+}
+
+// Option configures a Doctor.
+type Option func(*Doctor)
+
+// WithHTTPClient replaces the default client, which times out after ten
+// seconds and follows redirects under discovery.DefaultRedirectPolicy.
+func WithHTTPClient(client *http.Client) Option {
+	return func(d *Doctor) {
+		d.client = client
+	}
+}
+
+// WithClock sets the clock certificate expiry is measured against.
+func WithClock(c clock.Clock) Option {
+	return func(d *Doctor) {
+		d.clock = clock.OrReal(c)
+	}
+}
+
+// WithRoundTrip enables CheckRoundTrip: schema is signed with privateKeyPEM
+// and verified against the discovered key.
+func WithRoundTrip(privateKeyPEM string, schema map[string]interface{}) Option {
+	return func(d *Doctor) {
+		d.privateKeyPEM = privateKeyPEM
+		d.schema = schema
+	}
+}
+
+// WithToolID sets the tool the round trip verifies as, so a key scoped in
+// the tools map is selected. The default is the domain-wide key.
+func WithToolID(toolID string) Option {
+	return func(d *Doctor) {
+		d.toolID = toolID
+	}
+}
+
+// New creates a Doctor.
+func New(opts ...Option) *Doctor {
+	d := &Doctor{
+		client: &http.Client{
+			Timeout:       10 * time.Second,
+			CheckRedirect: discovery.DefaultRedirectPolicy().CheckRedirect,
+		},
+		clock: clock.Real,
+	}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
+}
+
+// run holds what earlier checks fetched for later ones.
+type run struct {
+	*Doctor
+	domain        string
+	report        *Report
+	resp          *http.Response
+	body          []byte
+	wellKnown     *discovery.WellKnownResponse
+	revocationDoc *revocation.RevocationDocument
+}
+
+// Run checks domain's deployment. Every check appears in the report, as
+// StatusSkip when an earlier failure or a missing option prevents it.
+func (d *Doctor) Run(ctx context.Context, domain string) *Report {
+	r := &run{
+		Doctor: d,
+		domain: domain,
+		report: &Report{Domain: domain, URL: discovery.ConstructWellKnownURL(domain)},
+	}
+
+	r.checkHTTPS(ctx)
+	r.checkWellKnown()
+	r.checkPublicKey()
+	r.checkRevokedKeys()
+	r.checkRevocationDocument(ctx)
+	r.checkResponseSize()
+	r.checkContentType()
+	r.checkCacheHeaders()
+	r.checkRoundTrip()
+
+	r.report.OK = r.report.Count(StatusFail) == 0
+	return r.report
+}
+
+func (r *run) checkHTTPS(ctx context.Context) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.report.URL, nil)
+	if err != nil {
+		r.report.add(CheckHTTPS, StatusFail, "invalid domain: %v", err)
+		return
+	}
+	req.Header.Set("User-Agent", version.UserAgent())
+	resp, err := r.client.Do(req) // #nosec G704 -- URL constructed from ConstructWellKnownURL
+	if err != nil {
+		r.report.add(CheckHTTPS, StatusFail, "could not fetch %s: %v", r.report.URL, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxResponseSize+1))
+	if err != nil {
+		r.report.add(CheckHTTPS, StatusFail, "could not read %s: %v", r.report.URL, err)
+		return
+	}
+	r.report.SourceURL = resp.Request.URL.String()
+	if resp.StatusCode != http.StatusOK {
+		r.report.add(CheckHTTPS, StatusFail, "%s returned HTTP %d", r.report.SourceURL, resp.StatusCode)
+		return
+	}
+	r.resp, r.body = resp, body
+
+	if resp.TLS == nil {
+		r.report.add(CheckHTTPS, StatusFail, "%s is served over plain HTTP; verifiers require HTTPS", r.report.SourceURL)
+		return
+	}
+	if len(resp.TLS.PeerCertificates) == 0 {
+		r.report.add(CheckHTTPS, StatusPass, "served over %s", tls.VersionName(resp.TLS.Version))
+		return
+	}
+	notAfter := resp.TLS.PeerCertificates[0].NotAfter
+	if notAfter.Sub(r.clock.Now()) < CertificateExpiryWarning {
+		r.report.add(CheckHTTPS, StatusWarn, "TLS certificate expires %s", clock.Format(notAfter))
+		return
+	}
+	r.report.add(CheckHTTPS, StatusPass, "served over %s, certificate valid until %s",
+		tls.VersionName(resp.TLS.Version), clock.Format(notAfter))
+}
+
+func (r *run) checkWellKnown() {
+	if r.body == nil {
+		r.report.add(CheckWellKnown, StatusSkip, "document was not fetched")
+		return
+	}
+
+	var wellKnown discovery.WellKnownResponse
+	if err := json.Unmarshal(r.body, &wellKnown); err != nil {
+		r.report.add(CheckWellKnown, StatusFail, "document is not valid JSON: %v", err)
+		return
+	}
+	var missing []string
+	if wellKnown.SchemaVersion == "" {
+		missing = append(missing, "schema_version")
+	}
+	if wellKnown.PublicKeyPEM == "" {
+		missing = append(missing, "public_key_pem")
+	}
+	if len(missing) > 0 {
+		r.report.add(CheckWellKnown, StatusFail, "missing required fields: %s", strings.Join(missing, ", "))
+		return
+	}
+	if err := discovery.ValidateToolKeys(wellKnown.Tools); err != nil {
+		r.report.add(CheckWellKnown, StatusFail, "invalid tools map: %v", err)
+		return
+	}
+	wellKnown.SourceURL = r.report.SourceURL
+	r.wellKnown = &wellKnown
+
+	if wellKnown.DeveloperName == "" {
+		r.report.add(CheckWellKnown, StatusWarn, "developer_name is empty; verifiers will show \"Unknown\"")
+		return
+	}
+	if discovery.CompareSchemaVersions(wellKnown.SchemaVersion, "1.2") < 0 {
+		r.report.add(CheckWellKnown, StatusWarn, "schema_version %s predates 1.2; consider upgrading", wellKnown.SchemaVersion)
+		return
+	}
+	r.report.add(CheckWellKnown, StatusPass, "schema_version %s, developer %s", wellKnown.SchemaVersion, wellKnown.DeveloperName)
+}
+
+func (r *run) checkPublicKey() {
+	if r.wellKnown == nil {
+		r.report.add(CheckPublicKey, StatusSkip, "no valid document")
+		return
+	}
+
+	keyManager := crypto.NewKeyManager()
+	fingerprint, err := keyManager.CalculateKeyFingerprintFromPEM(r.wellKnown.PublicKeyPEM)
+	if err != nil {
+		r.report.add(CheckPublicKey, StatusFail, "public_key_pem does not parse: %v", err)
+		return
+	}
+	r.report.Fingerprint = fingerprint
+	for prefix, key := range r.wellKnown.Tools {
+		if _, err := keyManager.LoadPublicKeyPEM(key.PublicKeyPEM); err != nil {
+			r.report.add(CheckPublicKey, StatusFail, "tools entry %q key does not parse: %v", prefix, err)
+			return
+		}
+	}
+
+	if len(r.wellKnown.Tools) > 0 {
+		r.report.add(CheckPublicKey, StatusPass, "%s (and %d tool-scoped keys)", fingerprint, len(r.wellKnown.Tools))
+		return
+	}
+	r.report.add(CheckPublicKey, StatusPass, "%s", fingerprint)
+}
+
+func (r *run) checkRevokedKeys() {
+	if r.report.Fingerprint == "" {
+		r.report.add(CheckRevokedKeys, StatusSkip, "no valid public key")
+		return
+	}
+
+	var malformed []string
+	entries := 0
+	check := func(revoked []string) {
+		for _, entry := range revoked {
+			entries++
+			if !wellFormedRevokedKey(entry) {
+				malformed = append(malformed, fmt.Sprintf("%q", truncate(entry)))
+			}
+		}
+	}
+	check(r.wellKnown.RevokedKeys)
+	for _, key := range r.wellKnown.Tools {
+		check(key.RevokedKeys)
+	}
+	if len(malformed) > 0 {
+		r.report.add(CheckRevokedKeys, StatusFail, "entries are neither sha256 fingerprints nor public keys: %s", strings.Join(malformed, ", "))
+		return
+	}
+
+	if discovery.CheckKeyRevocation(r.wellKnown.PublicKeyPEM, r.wellKnown.RevokedKeys) {
+		r.report.add(CheckRevokedKeys, StatusFail, "the active public key %s is listed in revoked_keys", r.report.Fingerprint)
+		return
+	}
+	for prefix := range r.wellKnown.Tools {
+		scoped := r.wellKnown.KeyForTool(prefix)
+		if discovery.CheckKeyRevocation(scoped.PublicKeyPEM, scoped.RevokedKeys) {
+			r.report.add(CheckRevokedKeys, StatusFail, "the active key for tools entry %q is revoked", prefix)
+			return
+		}
+	}
+
+	r.report.add(CheckRevokedKeys, StatusPass, "%d revoked keys listed, none active", entries)
+}
+
+// wellFormedRevokedKey reports whether entry is a sha256:<hex> fingerprint
+// or a parseable public key PEM, the two forms CheckKeyRevocation matches.
+func wellFormedRevokedKey(entry string) bool {
+	if isFingerprint(entry) {
+		return true
+	}
+	_, err := crypto.NewKeyManager().LoadPublicKeyPEM(entry)
+	return err == nil
+}
+
+func isFingerprint(s string) bool {
+	digest, ok := strings.CutPrefix(s, "sha256:")
+	if !ok || len(digest) != 64 {
+		return false
+	}
+	_, err := hex.DecodeString(digest)
+	return err == nil
+}
+
+func truncate(s string) string {
+	if len(s) > 40 {
+		return s[:40] + "..."
+	}
+	return s
+}
+
+func (r *run) checkRevocationDocument(ctx context.Context) {
+	if r.report.Fingerprint == "" {
+		r.report.add(CheckRevocationDocument, StatusSkip, "no valid public key")
+		return
+	}
+	endpoint := r.wellKnown.RevocationEndpoint
+	if endpoint == "" {
+		r.report.add(CheckRevocationDocument, StatusSkip, "no revocation_endpoint published")
+		return
+	}
+	if u, err := url.Parse(endpoint); err != nil || u.Scheme != "https" {
+		r.report.add(CheckRevocationDocument, StatusFail, "revocation_endpoint %s is not an HTTPS URL", endpoint)
+		return
+	}
+
+	doc, err := r.fetchRevocationDocument(ctx, endpoint)
+	if err != nil {
+		r.report.add(CheckRevocationDocument, StatusFail, "%v", err)
+		return
+	}
+	r.revocationDoc = doc
+
+	if host := domainHost(r.domain); doc.Domain != host && doc.Domain != r.domain {
+		r.report.add(CheckRevocationDocument, StatusFail, "document is for domain %q, expected %q", doc.Domain, host)
+		return
+	}
+	for _, key := range doc.RevokedKeys {
+		if !isFingerprint(key.Fingerprint) {
+			r.report.add(CheckRevocationDocument, StatusFail, "revoked key %q is not a sha256 fingerprint", truncate(key.Fingerprint))
+			return
+		}
+		if _, err := time.Parse(time.RFC3339, key.RevokedAt); err != nil {
+			r.report.add(CheckRevocationDocument, StatusFail, "revoked key %s has invalid revoked_at %q", key.Fingerprint, key.RevokedAt)
+			return
+		}
+	}
+	if err := revocation.CheckRevocation(doc, r.report.Fingerprint); err != nil {
+		r.report.add(CheckRevocationDocument, StatusFail, "the active public key is revoked: %v", err)
+		return
+	}
+
+	// Keys revoked in the discovery document should also be in the
+	// standalone document, which some verifiers consult exclusively.
+	inDoc := make(map[string]bool, len(doc.RevokedKeys))
+	for _, key := range doc.RevokedKeys {
+		inDoc[key.Fingerprint] = true
+	}
+	var missing []string
+	for _, entry := range r.wellKnown.RevokedKeys {
+		fingerprint := entry
+		if !isFingerprint(entry) {
+			fingerprint, _ = crypto.NewKeyManager().CalculateKeyFingerprintFromPEM(entry)
+		}
+		if !inDoc[fingerprint] {
+			missing = append(missing, fingerprint)
+		}
+	}
+	if len(missing) > 0 {
+		r.report.add(CheckRevocationDocument, StatusWarn, "revoked_keys not in the revocation document: %s", strings.Join(missing, ", "))
+		return
+	}
+
+	r.report.add(CheckRevocationDocument, StatusPass, "%d revoked keys, updated %s", len(doc.RevokedKeys), doc.UpdatedAt)
+}
+
+func (r *run) fetchRevocationDocument(ctx context.Context, endpoint string) (*revocation.RevocationDocument, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid revocation_endpoint: %w", err)
+	}
+	req.Header.Set("User-Agent", version.UserAgent())
+	resp, err := r.client.Do(req) // #nosec G704 -- URL is from discovery document's revocation_endpoint
+	if err != nil {
+		return nil, fmt.Errorf("could not fetch %s: %w", endpoint, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned HTTP %d", endpoint, resp.StatusCode)
+	}
+
+	var doc revocation.RevocationDocument
+	if err := json.NewDecoder(io.LimitReader(resp.Body, MaxResponseSize)).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("revocation document is not valid JSON: %w", err)
+	}
+	if doc.SchemapinVersion == "" || doc.Domain == "" {
+		return nil, fmt.Errorf("revocation document is missing schemapin_version or domain")
+	}
+	return &doc, nil
+}
+
+// domainHost returns the host name of domain, which may carry a scheme and
+// port.
+func domainHost(domain string) string {
+	u, err := url.Parse(discovery.ConstructWellKnownURL(domain))
+	if err != nil {
+		return domain
+	}
+	return u.Hostname()
+}
+
+func (r *run) checkResponseSize() {
+	if r.body == nil {
+		r.report.add(CheckResponseSize, StatusSkip, "document was not fetched")
+		return
+	}
+	switch size := len(r.body); {
+	case size > MaxResponseSize:
+		r.report.add(CheckResponseSize, StatusFail, "document exceeds %d bytes", MaxResponseSize)
+	case size > WarnResponseSize:
+		r.report.add(CheckResponseSize, StatusWarn, "document is %d bytes; keep it under %d", size, WarnResponseSize)
+	default:
+		r.report.add(CheckResponseSize, StatusPass, "%d bytes", size)
+	}
+}
+
+func (r *run) checkContentType() {
+	if r.resp == nil {
+		r.report.add(CheckContentType, StatusSkip, "document was not fetched")
+		return
+	}
+	contentType := r.resp.Header.Get("Content-Type")
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "application/json" {
+		r.report.add(CheckContentType, StatusWarn, "served as %q, expected application/json", contentType)
+		return
+	}
+	r.report.add(CheckContentType, StatusPass, "%s", contentType)
+}
+
+func (r *run) checkCacheHeaders() {
+	if r.resp == nil {
+		r.report.add(CheckCacheHeaders, StatusSkip, "document was not fetched")
+		return
+	}
+	cacheControl := r.resp.Header.Get("Cache-Control")
+	if cacheControl == "" {
+		r.report.add(CheckCacheHeaders, StatusWarn, "no Cache-Control header; caching is left to client heuristics")
+		return
+	}
+
+	for _, directive := range strings.Split(cacheControl, ",") {
+		name, value, _ := strings.Cut(strings.TrimSpace(strings.ToLower(directive)), "=")
+		switch name {
+		case "no-store":
+			r.report.add(CheckCacheHeaders, StatusWarn, "Cache-Control %q prevents caching; every verification refetches", cacheControl)
+			return
+		case "max-age":
+			var seconds int64
+			if _, err := fmt.Sscan(value, &seconds); err != nil {
+				r.report.add(CheckCacheHeaders, StatusWarn, "Cache-Control %q has an invalid max-age", cacheControl)
+				return
+			}
+			if time.Duration(seconds)*time.Second > MaxCacheAge {
+				r.report.add(CheckCacheHeaders, StatusWarn, "Cache-Control max-age %ds delays revocations by more than %s", seconds, MaxCacheAge)
+				return
+			}
+		}
+	}
+	r.report.add(CheckCacheHeaders, StatusPass, "Cache-Control: %s", cacheControl)
+}
+
+func (r *run) checkRoundTrip() {
+	if r.privateKeyPEM == "" || r.schema == nil {
+		r.report.add(CheckRoundTrip, StatusSkip, "requires a private key and a sample schema")
+		return
+	}
+	if r.report.Fingerprint == "" {
+		r.report.add(CheckRoundTrip, StatusSkip, "no valid public key")
+		return
+	}
+
+	keyManager := crypto.NewKeyManager()
+	privateKey, err := keyManager.LoadPrivateKeyPEM(r.privateKeyPEM)
+	if err != nil {
+		r.report.add(CheckRoundTrip, StatusFail, "private key does not parse: %v", err)
+		return
+	}
+	schemaHash, err := core.NewSchemaPinCore().CanonicalizeAndHash(r.schema)
+	if err != nil {
+		r.report.add(CheckRoundTrip, StatusFail, "sample schema cannot be canonicalized: %v", err)
+		return
+	}
+	signature, err := crypto.NewSignatureManager().SignSchemaHash(schemaHash, privateKey)
+	if err != nil {
+		r.report.add(CheckRoundTrip, StatusFail, "failed to sign sample schema: %v", err)
+		return
+	}
+
+	result := verification.VerifySchemaWithResolver(r.schema, signature, r.domain, r.toolID,
+		&fetchedResolver{wellKnown: r.wellKnown, revocationDoc: r.revocationDoc}, verification.NewKeyPinStore())
+	if result.Valid {
+		r.report.add(CheckRoundTrip, StatusPass, "schema signed with the private key verifies against the published key")
+		return
+	}
+
+	signingFingerprint, _ := keyManager.CalculateKeyFingerprint(&privateKey.PublicKey)
+	published, _ := keyManager.CalculateKeyFingerprintFromPEM(r.wellKnown.KeyForTool(r.toolID).PublicKeyPEM)
+	if !crypto.FingerprintEqual(signingFingerprint, published) {
+		r.report.add(CheckRoundTrip, StatusFail, "private key %s does not match the published key %s", signingFingerprint, published)
+		return
+	}
+	r.report.add(CheckRoundTrip, StatusFail, "verification failed: %s: %s", result.ErrorCode, result.ErrorMessage)
+}
+
+// fetchedResolver serves the documents Run already fetched, so the round
+// trip verifies against exactly what the domain published.
+type fetchedResolver struct {
+	wellKnown     *discovery.WellKnownResponse
+	revocationDoc *revocation.RevocationDocument
+}
+
+func (f *fetchedResolver) ResolveDiscovery(domain string) (*discovery.WellKnownResponse, error) {
+	return f.wellKnown, nil
+}
+
+func (f *fetchedResolver) ResolveRevocation(domain string, disc *discovery.WellKnownResponse) (*revocation.RevocationDocument, error) {
+	return f.revocationDoc, nil
+}
@@ -0,0 +1,296 @@
+package doctor
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/revocation"
+)
+
+// deployment is a test domain: its keys and the documents it serves.
+type deployment struct {
+	privateKeyPEM string
+	publicKeyPEM  string
+	fingerprint   string
+	wellKnown     map[string]interface{}
+	revocationDoc *revocation.RevocationDocument
+	cacheControl  string
+}
+
+func newDeployment(t *testing.T) *deployment {
+	t.Helper()
+	keyManager := crypto.NewKeyManager()
+	privateKey, err := keyManager.GenerateKeypair()
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	privateKeyPEM, _ := keyManager.ExportPrivateKeyPEM(privateKey)
+	publicKeyPEM, _ := keyManager.ExportPublicKeyPEM(&privateKey.PublicKey)
+	fingerprint, _ := keyManager.CalculateKeyFingerprint(&privateKey.PublicKey)
+
+	return &deployment{
+		privateKeyPEM: privateKeyPEM,
+		publicKeyPEM:  publicKeyPEM,
+		fingerprint:   fingerprint,
+		wellKnown: map[string]interface{}{
+			"schema_version": "1.2",
+			"developer_name": "Example Tools",
+			"public_key_pem": publicKeyPEM,
+		},
+		cacheControl: "max-age=3600",
+	}
+}
+
+// serve starts a TLS server for d and returns a Doctor configured to trust
+// it, along with the domain to check.
+func (d *deployment) serve(t *testing.T, opts ...Option) (*Doctor, string) {
+	t.Helper()
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/schemapin.json":
+			if d.cacheControl != "" {
+				w.Header().Set("Cache-Control", d.cacheControl)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			if d.revocationDoc != nil {
+				d.wellKnown["revocation_endpoint"] = server.URL + "/revocations.json"
+			}
+			_ = json.NewEncoder(w).Encode(d.wellKnown)
+		case "/revocations.json":
+			_ = json.NewEncoder(w).Encode(d.revocationDoc)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	opts = append([]Option{WithHTTPClient(server.Client())}, opts...)
+	return New(opts...), server.URL
+}
+
+func checkStatus(t *testing.T, report *Report, id CheckID) CheckResult {
+	t.Helper()
+	for _, check := range report.Checks {
+		if check.ID == id {
+			return check
+		}
+	}
+	t.Fatalf("Report has no %s check: %+v", id, report.Checks)
+	return CheckResult{}
+}
+
+func expectStatus(t *testing.T, report *Report, id CheckID, want Status) {
+	t.Helper()
+	if check := checkStatus(t, report, id); check.Status != want {
+		t.Errorf("Expected %s to be %s, got %s: %s", id, want, check.Status, check.Message)
+	}
+}
+
+func TestRunHealthyDeployment(t *testing.T) {
+	d := newDeployment(t)
+	d.revocationDoc = revocation.BuildRevocationDocument("127.0.0.1")
+	schema := map[string]interface{}{"name": "search", "description": "Searches"}
+
+	doctor, domain := d.serve(t, WithRoundTrip(d.privateKeyPEM, schema))
+	report := doctor.Run(context.Background(), domain)
+
+	if !report.OK {
+		t.Errorf("Expected a healthy deployment to pass, got %+v", report.Checks)
+	}
+	for _, check := range report.Checks {
+		if check.Status != StatusPass {
+			t.Errorf("Expected %s to pass, got %s: %s", check.ID, check.Status, check.Message)
+		}
+	}
+	if len(report.Checks) != 9 {
+		t.Errorf("Expected every check in the report, got %d", len(report.Checks))
+	}
+	if report.Fingerprint != d.fingerprint {
+		t.Errorf("Expected fingerprint %s, got %s", d.fingerprint, report.Fingerprint)
+	}
+	if report.SourceURL != domain+"/.well-known/schemapin.json" {
+		t.Errorf("Unexpected source URL %s", report.SourceURL)
+	}
+}
+
+func TestRunSkipsOptionalChecks(t *testing.T) {
+	doctor, domain := newDeployment(t).serve(t)
+	report := doctor.Run(context.Background(), domain)
+
+	if !report.OK {
+		t.Errorf("Expected skipped checks not to fail the report, got %+v", report.Checks)
+	}
+	expectStatus(t, report, CheckRevocationDocument, StatusSkip)
+	expectStatus(t, report, CheckRoundTrip, StatusSkip)
+}
+
+func TestRunProblems(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(d *deployment)
+		opts   func(d *deployment) []Option
+		id     CheckID
+		status Status
+	}{
+		{
+			name:   "missing public key",
+			modify: func(d *deployment) { delete(d.wellKnown, "public_key_pem") },
+			id:     CheckWellKnown,
+			status: StatusFail,
+		},
+		{
+			name:   "old schema version",
+			modify: func(d *deployment) { d.wellKnown["schema_version"] = "1.0" },
+			id:     CheckWellKnown,
+			status: StatusWarn,
+		},
+		{
+			name:   "unparseable key",
+			modify: func(d *deployment) { d.wellKnown["public_key_pem"] = "not a key" },
+			id:     CheckPublicKey,
+			status: StatusFail,
+		},
+		{
+			name:   "malformed revoked key",
+			modify: func(d *deployment) { d.wellKnown["revoked_keys"] = []string{"sha256:abc"} },
+			id:     CheckRevokedKeys,
+			status: StatusFail,
+		},
+		{
+			name:   "active key revoked",
+			modify: func(d *deployment) { d.wellKnown["revoked_keys"] = []string{d.fingerprint} },
+			id:     CheckRevokedKeys,
+			status: StatusFail,
+		},
+		{
+			name: "revocation document for another domain",
+			modify: func(d *deployment) {
+				d.revocationDoc = revocation.BuildRevocationDocument("example.com")
+			},
+			id:     CheckRevocationDocument,
+			status: StatusFail,
+		},
+		{
+			name: "active key in revocation document",
+			modify: func(d *deployment) {
+				d.revocationDoc = revocation.BuildRevocationDocument("127.0.0.1")
+				revocation.AddRevokedKey(d.revocationDoc, d.fingerprint, revocation.ReasonKeyCompromise)
+			},
+			id:     CheckRevocationDocument,
+			status: StatusFail,
+		},
+		{
+			name: "revoked key missing from revocation document",
+			modify: func(d *deployment) {
+				d.wellKnown["revoked_keys"] = []string{"sha256:" + strings.Repeat("ab", 32)}
+				d.revocationDoc = revocation.BuildRevocationDocument("127.0.0.1")
+			},
+			id:     CheckRevocationDocument,
+			status: StatusWarn,
+		},
+		{
+			name:   "no cache headers",
+			modify: func(d *deployment) { d.cacheControl = "" },
+			id:     CheckCacheHeaders,
+			status: StatusWarn,
+		},
+		{
+			name:   "long max-age",
+			modify: func(d *deployment) { d.cacheControl = "public, max-age=604800" },
+			id:     CheckCacheHeaders,
+			status: StatusWarn,
+		},
+		{
+			name: "wrong private key",
+			opts: func(d *deployment) []Option {
+				other := newDeployment(t)
+				return []Option{WithRoundTrip(other.privateKeyPEM, map[string]interface{}{"name": "search"})}
+			},
+			id:     CheckRoundTrip,
+			status: StatusFail,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDeployment(t)
+			if tt.modify != nil {
+				tt.modify(d)
+			}
+			var opts []Option
+			if tt.opts != nil {
+				opts = tt.opts(d)
+			}
+			doctor, domain := d.serve(t, opts...)
+			report := doctor.Run(context.Background(), domain)
+
+			expectStatus(t, report, tt.id, tt.status)
+			if report.OK != (tt.status != StatusFail) {
+				t.Errorf("Expected OK=%v, got %v", tt.status != StatusFail, report.OK)
+			}
+		})
+	}
+}
+
+func TestRunPlainHTTP(t *testing.T) {
+	d := newDeployment(t)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(d.wellKnown)
+	}))
+	defer server.Close()
+
+	report := New().Run(context.Background(), server.URL)
+	expectStatus(t, report, CheckHTTPS, StatusFail)
+	// The document is still checked so every problem is reported at once
+	expectStatus(t, report, CheckWellKnown, StatusPass)
+	expectStatus(t, report, CheckContentType, StatusWarn)
+}
+
+func TestRunUnreachable(t *testing.T) {
+	server := httptest.NewTLSServer(http.NotFoundHandler())
+	defer server.Close()
+
+	report := New(WithHTTPClient(server.Client())).Run(context.Background(), server.URL)
+	if report.OK {
+		t.Error("Expected a 404 to fail the report")
+	}
+	expectStatus(t, report, CheckHTTPS, StatusFail)
+	for _, check := range report.Checks[1:] {
+		if check.Status != StatusSkip {
+			t.Errorf("Expected %s to be skipped, got %s", check.ID, check.Status)
+		}
+	}
+}
+
+func TestRunCertificateExpiry(t *testing.T) {
+	d := newDeployment(t)
+	// httptest certificates expire in 2084
+	doctor, domain := d.serve(t, WithClock(clock.NewFake(time.Date(2084, 1, 20, 0, 0, 0, 0, time.UTC))))
+	report := doctor.Run(context.Background(), domain)
+	expectStatus(t, report, CheckHTTPS, StatusWarn)
+}
+
+func TestRunRedirectPolicy(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://keys.example.net"+r.URL.Path, http.StatusFound)
+	}))
+	defer server.Close()
+
+	report := New().Run(context.Background(), server.URL)
+	check := checkStatus(t, report, CheckHTTPS)
+	if check.Status != StatusFail || !strings.Contains(check.Message, "blocked") {
+		t.Errorf("Expected the cross-domain redirect to be blocked, got %s: %s", check.Status, check.Message)
+	}
+	if _, err := discovery.NewPublicKeyDiscovery().FetchWellKnown(context.Background(), server.URL); err == nil {
+		t.Error("Expected discovery to block the same redirect")
+	}
+}
@@ -0,0 +1,275 @@
+// Package httpmw provides net/http middleware that verifies signed tool
+// schemas uploaded to a service before its handlers see them.
+//
+//	mw := httpmw.VerifyUploadMiddleware(workflow, httpmw.Options{
+//	    Paths: []string{"/schemas"},
+//	})
+//	http.Handle("/schemas", mw(uploadHandler))
+//
+// Handlers read the verification outcome with ResultFromContext. The request
+// body is left intact for them to decode again.
+package httpmw
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/utils"
+)
+
+// DefaultMaxBodyBytes is the upload size limit when Options.MaxBodyBytes is
+// zero.
+const DefaultMaxBodyBytes = 1 << 20
+
+// Default header names for detached signatures.
+const (
+	DefaultSignatureHeader = "X-SchemaPin-Signature"
+	DefaultDomainHeader    = "X-SchemaPin-Domain"
+	DefaultToolIDHeader    = "X-SchemaPin-Tool-ID"
+)
+
+// Error codes for requests rejected before verification. Failed
+// verifications use the utils error codes, such as utils.ErrSignatureInvalid.
+const (
+	ErrBodyTooLarge     = "BODY_TOO_LARGE"
+	ErrUnsupportedMedia = "UNSUPPORTED_MEDIA_TYPE"
+	ErrMalformedUpload  = "MALFORMED_UPLOAD"
+	ErrMissingSignature = "MISSING_SIGNATURE"
+	ErrMissingDomain    = "MISSING_DOMAIN"
+	ErrMissingToolID    = "MISSING_TOOL_ID"
+)
+
+// Upload is a signed schema extracted from a request.
+//
+// The body is either an envelope carrying the signature,
+//
+//	{"schema": {...}, "signature": "<base64>", "domain": "example.com", "tool_id": "search"}
+//
+// or the bare schema, with the signature, domain and tool ID in the
+// SignatureHeader, DomainHeader and ToolIDHeader headers.
+type Upload struct {
+	Schema    map[string]interface{} `json:"schema"`
+	Signature string                 `json:"signature"`
+	Domain    string                 `json:"domain,omitempty"`
+	ToolID    string                 `json:"tool_id,omitempty"`
+	// Detached is true when the signature came from a header.
+	Detached bool `json:"-"`
+}
+
+// Options configures VerifyUploadMiddleware. The zero value verifies every
+// POST and PUT with a JSON body of up to DefaultMaxBodyBytes.
+type Options struct {
+	// Paths restricts verification to these request paths. A path ending
+	// in "/" also matches everything below it. Empty matches all paths.
+	Paths []string
+	// Methods restricts verification to these methods. Defaults to POST
+	// and PUT.
+	Methods []string
+	// ContentTypes are the media types accepted on matching requests;
+	// others are rejected with 415. Defaults to application/json.
+	ContentTypes []string
+	// MaxBodyBytes limits the upload size; larger bodies are rejected with
+	// 413. Defaults to DefaultMaxBodyBytes.
+	MaxBodyBytes int64
+	// Bypass, if set, passes matching requests to the next handler without
+	// verification, e.g. for trusted internal callers.
+	Bypass func(r *http.Request) bool
+	// DomainExtractor, if set, supplies the signing domain instead of the
+	// upload's domain field, e.g. from an authenticated claim so that an
+	// uploader can only submit schemas for its own domain. An error rejects
+	// the request with 403.
+	DomainExtractor func(r *http.Request, upload *Upload) (string, error)
+	// AutoPin pins keys on first use. See utils.SchemaVerificationWorkflow.
+	AutoPin bool
+	// SignatureHeader, DomainHeader and ToolIDHeader name the headers of
+	// a detached upload. They default to DefaultSignatureHeader,
+	// DefaultDomainHeader and DefaultToolIDHeader.
+	SignatureHeader string
+	DomainHeader    string
+	ToolIDHeader    string
+}
+
+// ErrorResponse is the JSON body of a rejected request.
+type ErrorResponse struct {
+	ErrorCode string   `json:"error_code"`
+	Error     string   `json:"error"`
+	Warnings  []string `json:"warnings,omitempty"`
+}
+
+type contextKey struct{}
+
+// ResultFromContext returns the verification result the middleware stored
+// in a request's context. ok is false for requests it did not verify.
+func ResultFromContext(ctx context.Context) (result *utils.VerificationResult, ok bool) {
+	result, ok = ctx.Value(contextKey{}).(*utils.VerificationResult)
+	return result, ok
+}
+
+// VerifyUploadMiddleware returns middleware that verifies the signed schema
+// in matching requests with workflow. Requests that fail are answered with
+// a 4xx ErrorResponse and never reach the next handler; verified requests
+// carry their result in the context (see ResultFromContext) and an
+// unconsumed copy of the body.
+//
+// Failed verifications are answered with 422 and the workflow's error code,
+// except that a domain rejected by DomainExtractor is 403.
+func VerifyUploadMiddleware(workflow *utils.SchemaVerificationWorkflow, opts Options) func(http.Handler) http.Handler {
+	opts = opts.withDefaults()
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !opts.matches(r) || (opts.Bypass != nil && opts.Bypass(r)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if !opts.acceptsContentType(r.Header.Get("Content-Type")) {
+				writeError(w, http.StatusUnsupportedMediaType, ErrorResponse{ErrorCode: ErrUnsupportedMedia, Error: "unsupported content type"})
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, opts.MaxBodyBytes))
+			if err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					writeError(w, http.StatusRequestEntityTooLarge, ErrorResponse{ErrorCode: ErrBodyTooLarge, Error: fmt.Sprintf("body exceeds %d bytes", opts.MaxBodyBytes)})
+					return
+				}
+				writeError(w, http.StatusBadRequest, ErrorResponse{ErrorCode: ErrMalformedUpload, Error: fmt.Sprintf("failed to read body: %v", err)})
+				return
+			}
+
+			upload, status, failure := opts.extract(r, body)
+			if failure != nil {
+				writeError(w, status, *failure)
+				return
+			}
+
+			result, err := workflow.VerifySchema(r.Context(), upload.Schema, upload.Signature, upload.ToolID, upload.Domain, opts.AutoPin)
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, ErrorResponse{ErrorCode: utils.ErrVerificationFailed, Error: "verification could not be completed"})
+				return
+			}
+			if !result.Valid {
+				message := result.Error
+				if message == "" && result.Err() != nil {
+					message = result.Err().Error()
+				}
+				writeError(w, http.StatusUnprocessableEntity, ErrorResponse{ErrorCode: result.ErrorCode, Error: message, Warnings: result.Warnings})
+				return
+			}
+
+			r = r.WithContext(context.WithValue(r.Context(), contextKey{}, result))
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			r.ContentLength = int64(len(body))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (o Options) withDefaults() Options {
+	if len(o.Methods) == 0 {
+		o.Methods = []string{http.MethodPost, http.MethodPut}
+	}
+	if len(o.ContentTypes) == 0 {
+		o.ContentTypes = []string{"application/json"}
+	}
+	if o.MaxBodyBytes <= 0 {
+		o.MaxBodyBytes = DefaultMaxBodyBytes
+	}
+	if o.SignatureHeader == "" {
+		o.SignatureHeader = DefaultSignatureHeader
+	}
+	if o.DomainHeader == "" {
+		o.DomainHeader = DefaultDomainHeader
+	}
+	if o.ToolIDHeader == "" {
+		o.ToolIDHeader = DefaultToolIDHeader
+	}
+	return o
+}
+
+// matches reports whether r is a request the middleware verifies.
+func (o Options) matches(r *http.Request) bool {
+	methodMatched := false
+	for _, method := range o.Methods {
+		if strings.EqualFold(r.Method, method) {
+			methodMatched = true
+			break
+		}
+	}
+	if !methodMatched {
+		return false
+	}
+	if len(o.Paths) == 0 {
+		return true
+	}
+	for _, path := range o.Paths {
+		if r.URL.Path == path || (strings.HasSuffix(path, "/") && strings.HasPrefix(r.URL.Path, path)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (o Options) acceptsContentType(header string) bool {
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return false
+	}
+	for _, accepted := range o.ContentTypes {
+		if strings.EqualFold(mediaType, accepted) {
+			return true
+		}
+	}
+	return false
+}
+
+// extract decodes the upload in body. On failure it returns the status and
+// response to reject the request with.
+func (o Options) extract(r *http.Request, body []byte) (*Upload, int, *ErrorResponse) {
+	var upload Upload
+	if signature := r.Header.Get(o.SignatureHeader); signature != "" {
+		if err := json.Unmarshal(body, &upload.Schema); err != nil {
+			return nil, http.StatusBadRequest, &ErrorResponse{ErrorCode: ErrMalformedUpload, Error: fmt.Sprintf("invalid JSON schema: %v", err)}
+		}
+		upload.Signature = signature
+		upload.Domain = r.Header.Get(o.DomainHeader)
+		upload.ToolID = r.Header.Get(o.ToolIDHeader)
+		upload.Detached = true
+	} else if err := json.Unmarshal(body, &upload); err != nil {
+		return nil, http.StatusBadRequest, &ErrorResponse{ErrorCode: ErrMalformedUpload, Error: fmt.Sprintf("invalid JSON upload: %v", err)}
+	}
+
+	switch {
+	case upload.Schema == nil:
+		return nil, http.StatusBadRequest, &ErrorResponse{ErrorCode: ErrMalformedUpload, Error: "upload has no schema"}
+	case upload.Signature == "":
+		return nil, http.StatusBadRequest, &ErrorResponse{ErrorCode: ErrMissingSignature, Error: "upload has no signature"}
+	case upload.ToolID == "":
+		return nil, http.StatusBadRequest, &ErrorResponse{ErrorCode: ErrMissingToolID, Error: "upload has no tool ID"}
+	}
+
+	if o.DomainExtractor != nil {
+		domain, err := o.DomainExtractor(r, &upload)
+		if err != nil {
+			return nil, http.StatusForbidden, &ErrorResponse{ErrorCode: utils.ErrDomainBlocked, Error: err.Error()}
+		}
+		upload.Domain = domain
+	}
+	if upload.Domain == "" {
+		return nil, http.StatusBadRequest, &ErrorResponse{ErrorCode: ErrMissingDomain, Error: "upload has no domain"}
+	}
+	return &upload, 0, nil
+}
+
+func writeError(w http.ResponseWriter, status int, response ErrorResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(response)
+}
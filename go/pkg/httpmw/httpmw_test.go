@@ -0,0 +1,246 @@
+package httpmw
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/utils"
+)
+
+// uploadFixture is a registry behind the middleware, verifying against a
+// discovery server for a signing key.
+type uploadFixture struct {
+	registry  *httptest.Server
+	domain    string
+	schema    map[string]interface{}
+	signature string
+	// received is the body the registry's handler read after verification
+	received []byte
+}
+
+func newUploadFixture(t *testing.T, revoked bool, opts Options) *uploadFixture {
+	t.Helper()
+	privateKeyPEM, publicKeyPEM, err := utils.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	signer, err := utils.NewSchemaSigningWorkflow(privateKeyPEM)
+	if err != nil {
+		t.Fatalf("Failed to create signing workflow: %v", err)
+	}
+	f := &uploadFixture{schema: map[string]interface{}{"type": "object", "description": "search tool"}}
+	if f.signature, err = signer.SignSchema(f.schema); err != nil {
+		t.Fatalf("Failed to sign schema: %v", err)
+	}
+
+	var revokedKeys []string
+	if revoked {
+		fingerprint, err := crypto.NewKeyManager().CalculateKeyFingerprintFromPEM(publicKeyPEM)
+		if err != nil {
+			t.Fatalf("Failed to fingerprint key: %v", err)
+		}
+		revokedKeys = []string{fingerprint}
+	}
+	discoveryServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(utils.CreateWellKnownResponse(publicKeyPEM, "Search Corp", "", revokedKeys, "1.2", ""))
+	}))
+	t.Cleanup(discoveryServer.Close)
+	f.domain = discoveryServer.URL
+
+	workflow, err := utils.NewSchemaVerificationWorkflow(filepath.Join(t.TempDir(), "pins.db"))
+	if err != nil {
+		t.Fatalf("Failed to create verification workflow: %v", err)
+	}
+	t.Cleanup(func() { workflow.Close() })
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result, ok := ResultFromContext(r.Context())
+		f.received, _ = io.ReadAll(r.Body)
+		if !ok {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(result)
+	})
+	f.registry = httptest.NewServer(VerifyUploadMiddleware(workflow, opts)(handler))
+	t.Cleanup(f.registry.Close)
+	return f
+}
+
+func (f *uploadFixture) envelope(t *testing.T) []byte {
+	t.Helper()
+	body, err := json.Marshal(Upload{Schema: f.schema, Signature: f.signature, Domain: f.domain, ToolID: "search"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func (f *uploadFixture) post(t *testing.T, body []byte, header http.Header) (int, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, f.registry.URL+"/schemas", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Upload failed: %v", err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, respBody
+}
+
+func expectRejected(t *testing.T, status int, body []byte, wantStatus int, wantCode string) {
+	t.Helper()
+	if status != wantStatus {
+		t.Fatalf("Expected status %d, got %d: %s", wantStatus, status, body)
+	}
+	var response ErrorResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		t.Fatalf("Expected a JSON error body, got %s", body)
+	}
+	if response.ErrorCode != wantCode || response.Error == "" {
+		t.Errorf("Expected error code %s, got %+v", wantCode, response)
+	}
+}
+
+func TestVerifyUploadValid(t *testing.T) {
+	f := newUploadFixture(t, false, Options{Paths: []string{"/schemas"}, AutoPin: true})
+
+	body := f.envelope(t)
+	status, respBody := f.post(t, body, nil)
+	if status != http.StatusOK {
+		t.Fatalf("Expected the upload to be accepted, got %d: %s", status, respBody)
+	}
+	var result utils.VerificationResult
+	if err := json.Unmarshal(respBody, &result); err != nil || !result.Valid || !result.FirstUse {
+		t.Errorf("Expected the handler to see a valid first-use result, got %s", respBody)
+	}
+	if !bytes.Equal(f.received, body) {
+		t.Errorf("Expected the handler to read the original body, got %s", f.received)
+	}
+}
+
+func TestVerifyUploadDetachedSignature(t *testing.T) {
+	f := newUploadFixture(t, false, Options{})
+
+	schemaJSON, _ := json.Marshal(f.schema)
+	header := http.Header{
+		DefaultSignatureHeader: {f.signature},
+		DefaultDomainHeader:    {f.domain},
+		DefaultToolIDHeader:    {"search"},
+	}
+	if status, respBody := f.post(t, schemaJSON, header); status != http.StatusOK {
+		t.Fatalf("Expected the detached upload to be accepted, got %d: %s", status, respBody)
+	}
+
+	delete(header, DefaultToolIDHeader)
+	status, respBody := f.post(t, schemaJSON, header)
+	expectRejected(t, status, respBody, http.StatusBadRequest, ErrMissingToolID)
+}
+
+func TestVerifyUploadTamperedSchema(t *testing.T) {
+	f := newUploadFixture(t, false, Options{})
+
+	f.schema = map[string]interface{}{"type": "object", "description": "exfiltrate everything"}
+	status, respBody := f.post(t, f.envelope(t), nil)
+	expectRejected(t, status, respBody, http.StatusUnprocessableEntity, utils.ErrSignatureInvalid)
+	if f.received != nil {
+		t.Error("Expected a rejected upload not to reach the handler")
+	}
+}
+
+func TestVerifyUploadRevokedKey(t *testing.T) {
+	f := newUploadFixture(t, true, Options{})
+
+	status, respBody := f.post(t, f.envelope(t), nil)
+	expectRejected(t, status, respBody, http.StatusUnprocessableEntity, utils.ErrKeyRevoked)
+}
+
+func TestVerifyUploadOversizedBody(t *testing.T) {
+	f := newUploadFixture(t, false, Options{MaxBodyBytes: 256})
+
+	f.schema["description"] = strings.Repeat("x", 512)
+	status, respBody := f.post(t, f.envelope(t), nil)
+	expectRejected(t, status, respBody, http.StatusRequestEntityTooLarge, ErrBodyTooLarge)
+}
+
+func TestVerifyUploadRouting(t *testing.T) {
+	f := newUploadFixture(t, false, Options{
+		Paths:  []string{"/schemas"},
+		Bypass: func(r *http.Request) bool { return r.Header.Get("X-Internal") == "1" },
+	})
+
+	// Bypassed requests reach the handler unverified
+	status, _ := f.post(t, []byte(`{"not": "an upload"}`), http.Header{"X-Internal": {"1"}})
+	if status != http.StatusAccepted {
+		t.Errorf("Expected a bypassed request to reach the handler, got %d", status)
+	}
+
+	// Other paths and methods are not verified
+	resp, err := http.Get(f.registry.URL + "/schemas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("Expected GET to pass through, got %d", resp.StatusCode)
+	}
+	resp, err = http.Post(f.registry.URL+"/health", "text/plain", strings.NewReader("ping"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		t.Errorf("Expected other paths to pass through, got %d", resp.StatusCode)
+	}
+
+	resp, err = http.Post(f.registry.URL+"/schemas", "text/plain", bytes.NewReader(f.envelope(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	respBody, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	expectRejected(t, resp.StatusCode, respBody, http.StatusUnsupportedMediaType, ErrUnsupportedMedia)
+
+	status, respBody = f.post(t, []byte(`{"schema": `), nil)
+	expectRejected(t, status, respBody, http.StatusBadRequest, ErrMalformedUpload)
+}
+
+func TestVerifyUploadDomainExtractor(t *testing.T) {
+	var claimed string
+	f := newUploadFixture(t, false, Options{
+		DomainExtractor: func(r *http.Request, upload *Upload) (string, error) {
+			if r.Header.Get("Authorization") != "Bearer search-corp" {
+				return "", errors.New("caller may not upload schemas")
+			}
+			return claimed, nil
+		},
+	})
+	claimed = f.domain
+
+	// The authenticated claim wins over the domain in the upload
+	var upload Upload
+	_ = json.Unmarshal(f.envelope(t), &upload)
+	upload.Domain = "attacker.example"
+	body, _ := json.Marshal(upload)
+	if status, respBody := f.post(t, body, http.Header{"Authorization": {"Bearer search-corp"}}); status != http.StatusOK {
+		t.Fatalf("Expected the claimed domain to be used, got %d: %s", status, respBody)
+	}
+
+	status, respBody := f.post(t, body, nil)
+	expectRejected(t, status, respBody, http.StatusForbidden, utils.ErrDomainBlocked)
+}
@@ -0,0 +1,499 @@
+package inspect
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/bundle"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/pinning"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/provenance"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/revocation"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/skill"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+// signedSchema is the document schemapin-sign writes.
+type signedSchema struct {
+	SchemapinVersion string                        `json:"schemapin_version"`
+	Canonicalization string                        `json:"canonicalization"`
+	Schema           map[string]interface{}        `json:"schema"`
+	Signature        string                        `json:"signature"`
+	SignedAt         string                        `json:"signed_at"`
+	Metadata         map[string]interface{}        `json:"metadata"`
+	Signatures       []verification.SignatureEntry `json:"signatures"`
+	SchemaHash       string                        `json:"schema_hash"`
+	Provenance       *provenance.Envelope          `json:"provenance"`
+}
+
+func inspectSignedSchema(ctx context.Context, data []byte, opts Options) (*Report, error) {
+	var doc signedSchema
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid signed schema: %w", err)
+	}
+	r := &Report{Type: TypeSignedSchema, FormatVersion: doc.SchemapinVersion}
+	now := opts.Clock.Now()
+
+	canonicalization := doc.Canonicalization
+	if rules, err := core.RulesForVersion(doc.SchemapinVersion); err != nil {
+		r.warn("%v", err)
+	} else if canonicalization == "" {
+		canonicalization = rules.Canonicalization
+	}
+	r.Hash = &HashCheck{Subject: "canonical schema", Canonicalization: canonicalization, Embedded: doc.SchemaHash}
+	hash, err := core.NewSchemaPinCore().CanonicalizeAndHashForSignature(doc.Schema, doc.SchemapinVersion, doc.Canonicalization)
+	if err != nil {
+		r.warn("schema hash not computed: %v", err)
+	} else {
+		r.Hash.Computed = core.FormatSchemaHash(hash)
+	}
+	compareHashes(r.Hash)
+	if r.Hash.Match != nil && !*r.Hash.Match {
+		r.warn("schema_hash does not match the schema")
+	}
+	if doc.Schema == nil {
+		r.warn("schema is missing")
+	} else if err := core.NewSchemaPinCore().ValidateSchema(doc.Schema); err != nil {
+		r.warn("invalid schema: %v", err)
+	}
+	for _, finding := range core.LintSchema(doc.Schema) {
+		r.warn("lint: %s", finding)
+	}
+
+	entries := verification.SignatureEntries(doc.Signature, doc.Signatures)
+	if len(entries) == 0 {
+		r.warn("no signature")
+	}
+	for i, entry := range entries {
+		label := "signature"
+		if len(doc.Signatures) > 0 {
+			label = fmt.Sprintf("signatures[%d]", i)
+		}
+		r.Signatures = append(r.Signatures, describeSignature(label, entry.Signature, entry.SignerKid))
+	}
+
+	r.timestamp(now, "signed_at", doc.SignedAt)
+	for i, entry := range doc.Signatures {
+		r.timestamp(now, fmt.Sprintf("signatures[%d].signed_at", i), entry.SignedAt)
+	}
+
+	for _, key := range []string{"name", "title", "description"} {
+		if value, ok := doc.Schema[key].(string); ok {
+			r.field("schema."+key, value)
+		}
+	}
+	for _, key := range sortedKeys(doc.Metadata) {
+		r.field("metadata."+key, formatValue(doc.Metadata[key]))
+	}
+	if doc.Provenance != nil {
+		inspectProvenance(r, doc.Provenance, hash)
+	}
+
+	if opts.Discoverer != nil {
+		domain := opts.Domain
+		if domain == "" {
+			domain, _ = doc.Metadata["domain"].(string)
+		}
+		if domain == "" {
+			r.warn("not resolved: the schema's domain is unknown")
+		} else if hash != nil {
+			r.Resolution = resolveSchema(ctx, r, domain, hash, entries, opts)
+		}
+	}
+	return r, nil
+}
+
+// resolveSchema checks the signatures of a schema with hash against
+// domain's key, marking the signatures of r that verify.
+func resolveSchema(ctx context.Context, r *Report, domain string, hash []byte, entries []verification.SignatureEntry, opts Options) *Resolution {
+	res, key := resolve(ctx, domain, opts.ToolID, opts)
+	if key == nil {
+		return &res.Resolution
+	}
+	publicKey, err := crypto.NewKeyManager().LoadPublicKeyPEM(key.PublicKeyPEM)
+	if err != nil {
+		res.Error = fmt.Sprintf("invalid discovered key: %v", err)
+		return &res.Resolution
+	}
+	sm := crypto.NewSignatureManager()
+	verified := false
+	for i, entry := range entries {
+		ok := sm.VerifySchemaSignature(hash, entry.Signature, publicKey)
+		r.Signatures[i].Verified = boolPtr(ok)
+		verified = verified || ok
+	}
+	res.Verified = boolPtr(verified)
+
+	if res.Error == "" && !res.Revoked {
+		rev, err := opts.Discoverer.RevocationDocument(ctx, res.wellKnown)
+		switch {
+		case err != nil:
+			res.Error = fmt.Sprintf("failed to fetch revocation document: %v", err)
+		case rev != nil:
+			res.Revoked = revocation.CheckRevocation(rev, res.Fingerprint) != nil
+			if err := revocation.CheckSignatureRevocation(rev, core.FormatSchemaHash(hash)); err != nil {
+				r.warn("%v", err)
+			}
+		}
+	}
+	return &res.Resolution
+}
+
+// resolve fetches domain's discovery document and returns the key for
+// toolID, or nil with the failure in the resolution.
+func resolve(ctx context.Context, domain, toolID string, opts Options) (*resolution, *discovery.ScopedKey) {
+	res := &resolution{Resolution: Resolution{Domain: domain}}
+	wellKnown, err := opts.Discoverer.FetchDiscovery(ctx, domain)
+	if err != nil {
+		res.Error = err.Error()
+		return res, nil
+	}
+	res.wellKnown = wellKnown
+	key := wellKnown.KeyForTool(toolID)
+	res.DeveloperName, res.Scope = key.DeveloperName, key.Scope
+	if res.Fingerprint, err = crypto.NewKeyManager().CalculateKeyFingerprintFromPEM(key.PublicKeyPEM); err != nil {
+		res.Error = fmt.Sprintf("invalid discovered key: %v", err)
+		return res, nil
+	}
+	res.Revoked = discovery.CheckKeyRevocation(key.PublicKeyPEM, key.RevokedKeys)
+	return res, key
+}
+
+// resolution is a Resolution with the document it was made from.
+type resolution struct {
+	Resolution
+	wellKnown *discovery.WellKnownResponse
+}
+
+// inspectProvenance describes a DSSE provenance envelope whose subject
+// should be digest, if known.
+func inspectProvenance(r *Report, envelope *provenance.Envelope, digest []byte) {
+	for i, sig := range envelope.Signatures {
+		r.Signatures = append(r.Signatures, describeSignature(fmt.Sprintf("provenance.signatures[%d]", i), sig.Sig, sig.KeyID))
+	}
+	statement, err := envelope.Statement()
+	if err != nil {
+		r.warn("provenance: %v", err)
+		return
+	}
+	r.field("provenance.predicate_type", statement.PredicateType)
+	if digest != nil {
+		if err := provenance.CheckSubject(envelope, digest); err != nil {
+			r.warn("provenance: %v", err)
+		}
+	}
+}
+
+func inspectDetachedSignature(data []byte) *Report {
+	r := &Report{Type: TypeDetachedSignature}
+	r.Signatures = []Signature{describeSignature("signature", strings.TrimSpace(string(data)), "")}
+	r.warn("a detached signature does not name the schema it signs; verify it with schemapin-verify --signature")
+	return r
+}
+
+// inspectSkill describes sig, checking the files of dir against its
+// manifest unless dir is empty.
+func inspectSkill(ctx context.Context, sig *skill.SkillSignature, dir string, opts Options) *Report {
+	r := &Report{Type: TypeSkillSignature, FormatVersion: sig.SchemapinVersion}
+	now := opts.Clock.Now()
+
+	canonicalization := sig.Canonicalization
+	if canonicalization == "" {
+		canonicalization = core.CanonicalizationV1
+	}
+	r.Hash = &HashCheck{Subject: "skill file manifest", Canonicalization: canonicalization, Embedded: sig.SkillHash}
+	alg, err := core.LookupCanonicalization(sig.Canonicalization)
+	switch {
+	case err != nil:
+		r.warn("%v", err)
+	case len(sig.FileManifest) > 0:
+		r.Hash.Computed = core.FormatSchemaHash(alg.SkillRootHash(sig.FileManifest))
+	case sig.ManifestHash != "":
+		r.warn("the file manifest is in %s next to the signature; inspect the skill directory to check it", skill.ManifestFilename)
+	default:
+		r.warn("the signature has no file manifest")
+	}
+	compareHashes(r.Hash)
+	if r.Hash.Match != nil && !*r.Hash.Match {
+		r.warn("skill_hash does not match file_manifest")
+	}
+	if dir != "" && alg != nil {
+		checkSkillFiles(r, dir, sig)
+	}
+
+	r.Signatures = []Signature{describeSignature("signature", sig.Signature, sig.SignerKid)}
+	r.Keys = []Key{{Label: "signer", Kid: sig.SignerKid}}
+	r.timestamp(now, "signed_at", sig.SignedAt)
+	if expires, ok := r.timestamp(now, "expires_at", sig.ExpiresAt); ok && now.After(expires) {
+		r.warn("the signature expired %s", Age(now, expires))
+	}
+
+	r.field("skill_name", sig.SkillName)
+	r.field("domain", sig.Domain)
+	r.field("schema_version", sig.SchemaVersion)
+	r.field("previous_hash", sig.PreviousHash)
+	r.field("manifest_hash", sig.ManifestHash)
+	if len(sig.FileManifest) > 0 {
+		r.field("files", strconv.Itoa(len(sig.FileManifest)))
+	}
+	r.field("mutable_paths", strings.Join(sig.MutablePaths, ", "))
+	r.field("nested_skills", strings.Join(sortedKeys(sig.NestedSkills), ", "))
+	if sig.Provenance != nil {
+		root, _ := core.ParseSchemaHash(sig.SkillHash)
+		inspectProvenance(r, sig.Provenance, root)
+	}
+
+	if opts.Discoverer != nil {
+		r.Resolution = resolveSkill(ctx, r, sig, dir, opts)
+	}
+	return r
+}
+
+// checkSkillFiles compares the files of dir with sig's manifest.
+func checkSkillFiles(r *Report, dir string, sig *skill.SkillSignature) {
+	_, current, err := skill.CanonicalizeSkillWith(dir, sig.Canonicalization)
+	if err != nil {
+		r.warn("files not checked: %v", err)
+		return
+	}
+	// Nested skills are signed separately and left out of the manifest
+	for relPath := range current {
+		for nested := range sig.NestedSkills {
+			if strings.HasPrefix(relPath, strings.TrimSuffix(nested, "/")+"/") {
+				delete(current, relPath)
+			}
+		}
+	}
+	tampered := skill.DetectTamperedFiles(current, sig.FileManifest)
+	for _, change := range []struct {
+		what  string
+		paths []string
+	}{
+		{"modified", tampered.Modified},
+		{"added", tampered.Added},
+		{"removed", tampered.Removed},
+		{"with changed permissions", tampered.PermissionChanged},
+	} {
+		if len(change.paths) > 0 {
+			r.warn("files %s since signing: %s", change.what, strings.Join(change.paths, ", "))
+		}
+	}
+	if len(sig.MutablePaths) > 0 && len(tampered.Modified)+len(tampered.Added)+len(tampered.Removed) > 0 {
+		r.warn("changes to files matching mutable_paths are allowed")
+	}
+}
+
+// resolveSkill checks sig against its domain's key: fully for a skill
+// directory, otherwise by its signer_kid.
+func resolveSkill(ctx context.Context, r *Report, sig *skill.SkillSignature, dir string, opts Options) *Resolution {
+	toolID := opts.ToolID
+	if toolID == "" {
+		toolID = sig.SkillName
+	}
+	res, key := resolve(ctx, sig.Domain, toolID, opts)
+	if key == nil {
+		return &res.Resolution
+	}
+	if sig.SignerKid != "" && !crypto.FingerprintEqual(sig.SignerKid, res.Fingerprint) {
+		r.warn("signer_kid %s is not the fingerprint of the discovered key", sig.SignerKid)
+	}
+	if dir == "" {
+		return &res.Resolution
+	}
+	rev, err := opts.Discoverer.RevocationDocument(ctx, res.wellKnown)
+	if err != nil {
+		res.Error = fmt.Sprintf("failed to fetch revocation document: %v", err)
+		return &res.Resolution
+	}
+	result := skill.VerifySkillOffline(dir, res.wellKnown, sig, rev, verification.NewKeyPinStore(), toolID)
+	res.Verified = boolPtr(result.Valid)
+	r.Signatures[0].Verified = res.Verified
+	if !result.Valid {
+		res.Error = fmt.Sprintf("%s: %s", result.ErrorCode, result.ErrorMessage)
+		res.Revoked = res.Revoked || result.ErrorCode == verification.ErrKeyRevoked
+	}
+	return &res.Resolution
+}
+
+func inspectWellKnown(data []byte, opts Options) (*Report, error) {
+	var doc discovery.WellKnownResponse
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid discovery document: %w", err)
+	}
+	r := &Report{Type: TypeWellKnown, FormatVersion: doc.SchemaVersion}
+	if doc.SchemaVersion == "" {
+		r.warn("schema_version is missing")
+	}
+	if doc.PublicKeyPEM == "" {
+		r.warn("public_key_pem is missing")
+	} else {
+		r.Keys = append(r.Keys, describeKey("public_key_pem", "", doc.PublicKeyPEM))
+		if discovery.CheckKeyRevocation(doc.PublicKeyPEM, doc.RevokedKeys) {
+			r.warn("the published key is listed in its own revoked_keys")
+		}
+	}
+	for _, prefix := range sortedKeys(doc.Tools) {
+		key := doc.Tools[prefix]
+		r.Keys = append(r.Keys, describeKey("tools["+prefix+"]", "", key.PublicKeyPEM))
+		if discovery.CheckKeyRevocation(key.PublicKeyPEM, append(doc.RevokedKeys, key.RevokedKeys...)) {
+			r.warn("the key of tools[%s] is revoked", prefix)
+		}
+	}
+	if err := discovery.ValidateToolKeys(doc.Tools); err != nil {
+		r.warn("%v", err)
+	}
+	for _, key := range r.Keys {
+		if key.Error != "" {
+			r.warn("%s: %s", key.Label, key.Error)
+		}
+	}
+
+	if doc.ContactProof != "" {
+		proof := describeSignature("contact_proof", doc.ContactProof, "")
+		if opts.Domain != "" {
+			doc.Domain = opts.Domain
+			proof.Verified = boolPtr(doc.ContactVerified(opts.Domain))
+		}
+		r.Signatures = append(r.Signatures, proof)
+	}
+
+	r.field("developer_name", doc.DeveloperName)
+	r.field("contact", doc.Contact)
+	r.field("revocation_endpoint", doc.RevocationEndpoint)
+	for i, revoked := range doc.RevokedKeys {
+		r.field(fmt.Sprintf("revoked_keys[%d]", i), revoked)
+	}
+	return r, nil
+}
+
+func inspectRevocation(data []byte, opts Options) (*Report, error) {
+	var doc revocation.RevocationDocument
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid revocation document: %w", err)
+	}
+	r := &Report{Type: TypeRevocation, FormatVersion: doc.SchemapinVersion}
+	now := opts.Clock.Now()
+	if doc.Domain == "" {
+		r.warn("domain is missing")
+	}
+	r.timestamp(now, "updated_at", doc.UpdatedAt)
+	r.field("domain", doc.Domain)
+	if doc.Sequence > 0 {
+		r.field("sequence", strconv.FormatUint(doc.Sequence, 10))
+	}
+	if doc.Since > 0 {
+		r.field("delta_since", strconv.FormatUint(doc.Since, 10))
+	}
+	for i, key := range doc.RevokedKeys {
+		label := fmt.Sprintf("revoked_keys[%d]", i)
+		r.field(label, fmt.Sprintf("%s (%s)", key.Fingerprint, key.Reason))
+		r.timestamp(now, label+".revoked_at", key.RevokedAt)
+		if _, err := core.ParseSchemaHash(key.Fingerprint); err != nil {
+			r.warn("%s: fingerprint %q is not sha256:<hex>", label, key.Fingerprint)
+		}
+		checkReason(r, label, key.Reason)
+	}
+	for i, sig := range doc.RevokedSignatures {
+		label := fmt.Sprintf("revoked_signatures[%d]", i)
+		r.field(label, fmt.Sprintf("%s (%s)", sig.SchemaHash, sig.Reason))
+		r.timestamp(now, label+".revoked_at", sig.RevokedAt)
+		if _, err := core.ParseSchemaHash(sig.SchemaHash); err != nil {
+			r.warn("%s: %v", label, err)
+		}
+		checkReason(r, label, sig.Reason)
+	}
+	return r, nil
+}
+
+// checkReason warns about a revocation reason outside the specification.
+func checkReason(r *Report, label string, reason revocation.RevocationReason) {
+	switch reason {
+	case revocation.ReasonKeyCompromise, revocation.ReasonSuperseded,
+		revocation.ReasonCessationOfOperation, revocation.ReasonPrivilegeWithdrawn:
+	default:
+		r.warn("%s: unknown reason %q", label, reason)
+	}
+}
+
+func inspectTrustBundle(data []byte, opts Options) (*Report, error) {
+	b, err := bundle.ParseTrustBundle(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid trust bundle: %w", err)
+	}
+	r := &Report{Type: TypeTrustBundle, FormatVersion: b.SchemapinBundleVersion}
+	now := opts.Clock.Now()
+
+	r.timestamp(now, "created_at", b.CreatedAt)
+	r.timestamp(now, "signed_at", b.SignedAt)
+	if expires, ok := r.timestamp(now, "expires_at", b.ExpiresAt); ok && now.After(expires) {
+		r.warn("the bundle expired %s", Age(now, expires))
+	}
+
+	if b.BundleAuthority != nil {
+		r.Keys = append(r.Keys, describeKey("bundle_authority", b.BundleAuthority.Kid, b.BundleAuthority.PublicKeyPEM))
+	}
+	for i, doc := range b.Documents {
+		r.Keys = append(r.Keys, describeKey("documents["+doc.Domain+"]", "", doc.WellKnown.PublicKeyPEM))
+		if !discovery.ValidateWellKnownResponse(&b.Documents[i].WellKnown) {
+			r.warn("documents[%s] is not a valid discovery document", doc.Domain)
+		}
+	}
+
+	if b.Signature == "" {
+		r.warn("the bundle is unsigned")
+	} else {
+		sig := describeSignature("signature", b.Signature, "")
+		if b.BundleAuthority != nil {
+			// A fresh pin store checks the signature against the embedded
+			// authority only; whether to trust the authority is up to the
+			// verifier's own pins
+			err := bundle.VerifyTrustBundle(b, bundle.NewAuthorityPinStore(), bundle.WithClock(opts.Clock))
+			sig.Verified = boolPtr(err == nil)
+			if err != nil {
+				r.warn("%v", err)
+			}
+		}
+		r.Signatures = append(r.Signatures, sig)
+	}
+
+	domains := make([]string, 0, len(b.Documents))
+	for _, doc := range b.Documents {
+		domains = append(domains, doc.Domain)
+	}
+	r.field("documents", fmt.Sprintf("%d (%s)", len(b.Documents), strings.Join(domains, ", ")))
+	for _, rev := range b.Revocations {
+		r.field("revocations["+rev.Domain+"]", plural(len(rev.RevokedKeys), "key")+", "+plural(len(rev.RevokedSignatures), "signature"))
+	}
+	return r, nil
+}
+
+func inspectPinExport(data []byte, opts Options) (*Report, error) {
+	var pins []pinning.PinnedKeyInfo
+	if err := json.Unmarshal(data, &pins); err != nil {
+		return nil, fmt.Errorf("invalid pin export: %w", err)
+	}
+	r := &Report{Type: TypePinExport}
+	now := opts.Clock.Now()
+	r.field("pins", strconv.Itoa(len(pins)))
+	for _, pin := range pins {
+		key := describeKey(pin.ToolID, "", pin.PublicKeyPEM)
+		switch {
+		case key.Error != "":
+			r.warn("%s: %s", pin.ToolID, key.Error)
+		case pin.Fingerprint != "" && !crypto.FingerprintEqual(pin.Fingerprint, key.Fingerprint):
+			r.warn("%s: recorded fingerprint %s does not match its public key", pin.ToolID, pin.Fingerprint)
+		}
+		r.Keys = append(r.Keys, key)
+		r.field(pin.ToolID, strings.TrimSpace(fmt.Sprintf("%s %s", pin.Domain, pin.Provenance)))
+		if !pin.PinnedAt.IsZero() {
+			r.timestamp(now, pin.ToolID+".pinned_at", pin.PinnedAt.Format(time.RFC3339))
+		}
+	}
+	return r, nil
+}
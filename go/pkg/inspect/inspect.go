@@ -0,0 +1,463 @@
+// Package inspect decodes SchemaPin artifacts for people reading them: it
+// detects what a file is, recomputes the hash it binds to where it can,
+// and describes its signatures, keys, timestamps and validation problems.
+// Nothing is fetched unless Options.Discoverer is set. schemapin-inspect
+// prints its reports.
+package inspect
+
+import (
+	"bytes"
+	"context"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/skill"
+)
+
+// MaxFileBytes is the largest file Inspect reads.
+const MaxFileBytes = 16 << 20
+
+// Type is the kind of a SchemaPin artifact.
+type Type string
+
+const (
+	// TypeSignedSchema is a schema with its signature, as written by
+	// schemapin-sign.
+	TypeSignedSchema Type = "signed_schema"
+	// TypeDetachedSignature is a bare base64 signature, as given to
+	// schemapin-verify --signature.
+	TypeDetachedSignature Type = "detached_signature"
+	// TypeSkillSignature is a skill's .schemapin.sig, alone or in its
+	// skill directory.
+	TypeSkillSignature Type = "skill_signature"
+	// TypeWellKnown is a .well-known/schemapin.json discovery document.
+	TypeWellKnown Type = "well_known"
+	// TypeRevocation is a standalone revocation document.
+	TypeRevocation Type = "revocation_document"
+	// TypeTrustBundle is a trust bundle for offline verification.
+	TypeTrustBundle Type = "trust_bundle"
+	// TypePinExport is a list of pinned keys from ExportPinnedKeys.
+	TypePinExport Type = "pin_export"
+)
+
+var typeNames = map[Type]string{
+	TypeSignedSchema:      "signed schema",
+	TypeDetachedSignature: "detached signature",
+	TypeSkillSignature:    "skill signature",
+	TypeWellKnown:         "discovery document (.well-known/schemapin.json)",
+	TypeRevocation:        "revocation document",
+	TypeTrustBundle:       "trust bundle",
+	TypePinExport:         "pin export",
+}
+
+// String returns the type's description, e.g. "signed schema".
+func (t Type) String() string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return string(t)
+}
+
+// ErrUnrecognized is returned for input that is not a SchemaPin artifact.
+var ErrUnrecognized = errors.New("not a recognized SchemaPin artifact")
+
+// Report describes one artifact. Sections that do not apply to its type
+// are empty.
+type Report struct {
+	Path string `json:"path,omitempty"`
+	Type Type   `json:"type"`
+	// FormatVersion is the artifact's own format version, e.g. its
+	// schemapin_version, or empty if it has none.
+	FormatVersion string `json:"format_version,omitempty"`
+	// Hash is the hash the artifact's signature binds to.
+	Hash       *HashCheck  `json:"hash,omitempty"`
+	Signatures []Signature `json:"signatures,omitempty"`
+	Keys       []Key       `json:"keys,omitempty"`
+	Timestamps []Timestamp `json:"timestamps,omitempty"`
+	// Fields are the artifact's other notable fields, in order.
+	Fields []Field `json:"fields,omitempty"`
+	// Resolution is the result of checking the artifact against its
+	// domain's discovery document, with Options.Discoverer.
+	Resolution *Resolution `json:"resolution,omitempty"`
+	// Warnings are problems found by the validators of the artifact's
+	// type. A report without warnings may still fail verification, e.g.
+	// for a key that is not pinned.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// HashCheck is the hash an artifact binds to, recomputed and compared with
+// the hash it records.
+type HashCheck struct {
+	// Subject says what was hashed, e.g. "canonical schema".
+	Subject          string `json:"subject"`
+	Canonicalization string `json:"canonicalization,omitempty"`
+	// Computed is the recomputed sha256:<hex> hash, or empty if it could
+	// not be computed.
+	Computed string `json:"computed,omitempty"`
+	// Embedded is the hash the artifact records, or empty if none.
+	Embedded string `json:"embedded,omitempty"`
+	// Match compares them, when both are known.
+	Match *bool `json:"match,omitempty"`
+}
+
+// Signature describes one signature of an artifact.
+type Signature struct {
+	// Label names the field the signature is in, e.g. "signatures[1]".
+	Label     string `json:"label"`
+	Algorithm string `json:"algorithm,omitempty"`
+	// Bytes is the length of the decoded signature.
+	Bytes     int    `json:"bytes,omitempty"`
+	SignerKid string `json:"signer_kid,omitempty"`
+	// Verified reports whether the signature checked out, when it could
+	// be checked offline or was checked with Options.Discoverer.
+	Verified *bool `json:"verified,omitempty"`
+	// Error says why the signature could not be decoded.
+	Error string `json:"error,omitempty"`
+}
+
+// Key describes a public key an artifact carries or names.
+type Key struct {
+	Label       string `json:"label"`
+	Kid         string `json:"kid,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// Timestamp is a timestamp of an artifact with its age.
+type Timestamp struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
+	// Age is the time since (or until) Value, e.g. "3 days ago", or empty
+	// if Value does not parse.
+	Age string `json:"age,omitempty"`
+}
+
+// Field is a named value of an artifact.
+type Field struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Resolution is an artifact checked against its domain's discovery
+// document.
+type Resolution struct {
+	Domain        string `json:"domain"`
+	DeveloperName string `json:"developer_name,omitempty"`
+	// Fingerprint is the fingerprint of the key discovery returned for the
+	// artifact.
+	Fingerprint string `json:"fingerprint,omitempty"`
+	// Scope is the .well-known tools prefix the key came from, or empty
+	// for the domain-wide key.
+	Scope string `json:"scope,omitempty"`
+	// Verified reports whether the artifact's signature verified with the
+	// key, when it could be checked.
+	Verified *bool  `json:"verified,omitempty"`
+	Revoked  bool   `json:"revoked,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// Options configure Inspect.
+type Options struct {
+	// Clock is the time ages and expiry are measured against. The default
+	// is clock.Real.
+	Clock clock.Clock
+	// Discoverer, when set, fetches the signing domain's discovery
+	// document to check signatures against its key. Without it nothing
+	// is fetched.
+	Discoverer discovery.Discoverer
+	// Domain is the domain of a signed schema or discovery document,
+	// which they do not record themselves. Signed schemas fall back to a
+	// "domain" metadata value.
+	Domain string
+	// ToolID selects a tool-scoped key when resolving. Skill signatures
+	// default to the skill's name.
+	ToolID string
+}
+
+// Inspect reports on the artifact at path: a file of any Type, or a
+// signed skill directory.
+func Inspect(ctx context.Context, path string, opts Options) (*Report, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	var report *Report
+	if info.IsDir() {
+		report, err = inspectSkillDir(ctx, path, opts)
+	} else {
+		var data []byte
+		if data, err = readFile(path); err != nil {
+			return nil, err
+		}
+		report, err = InspectBytes(ctx, data, opts)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	report.Path = path
+	return report, nil
+}
+
+// readFile reads up to MaxFileBytes of path.
+func readFile(path string) ([]byte, error) {
+	f, err := os.Open(path) // #nosec G304 -- path is supplied by the operator
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, MaxFileBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxFileBytes {
+		return nil, fmt.Errorf("%s is larger than %d bytes", path, MaxFileBytes)
+	}
+	return data, nil
+}
+
+// InspectBytes reports on the artifact in data. Skill signatures are
+// described without their files.
+func InspectBytes(ctx context.Context, data []byte, opts Options) (*Report, error) {
+	t, err := Detect(data)
+	if err != nil {
+		return nil, err
+	}
+	opts.Clock = clock.OrReal(opts.Clock)
+	switch t {
+	case TypeSignedSchema:
+		return inspectSignedSchema(ctx, data, opts)
+	case TypeDetachedSignature:
+		return inspectDetachedSignature(data), nil
+	case TypeSkillSignature:
+		var sig skill.SkillSignature
+		if err := json.Unmarshal(data, &sig); err != nil {
+			return nil, fmt.Errorf("invalid skill signature: %w", err)
+		}
+		return inspectSkill(ctx, &sig, "", opts), nil
+	case TypeWellKnown:
+		return inspectWellKnown(data, opts)
+	case TypeRevocation:
+		return inspectRevocation(data, opts)
+	case TypeTrustBundle:
+		return inspectTrustBundle(data, opts)
+	default:
+		return inspectPinExport(data, opts)
+	}
+}
+
+// inspectSkillDir reports on the signature of a skill directory, checking
+// its files against the signed manifest.
+func inspectSkillDir(ctx context.Context, dir string, opts Options) (*Report, error) {
+	if _, err := os.Stat(filepath.Join(dir, skill.SignatureFilename)); err != nil {
+		return nil, fmt.Errorf("%w: directory has no %s", ErrUnrecognized, skill.SignatureFilename)
+	}
+	sig, err := skill.LoadSignature(dir)
+	if err != nil {
+		return nil, err
+	}
+	opts.Clock = clock.OrReal(opts.Clock)
+	return inspectSkill(ctx, sig, dir, opts), nil
+}
+
+// Detect returns the type of the artifact in data from its shape.
+func Detect(data []byte) (Type, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return "", fmt.Errorf("%w: empty input", ErrUnrecognized)
+	}
+	switch trimmed[0] {
+	case '{':
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(trimmed, &fields); err != nil {
+			return "", fmt.Errorf("%w: invalid JSON: %v", ErrUnrecognized, err)
+		}
+		has := func(names ...string) bool {
+			for _, name := range names {
+				if _, ok := fields[name]; !ok {
+					return false
+				}
+			}
+			return true
+		}
+		switch {
+		case has("schemapin_bundle_version"):
+			return TypeTrustBundle, nil
+		case has("skill_hash"):
+			return TypeSkillSignature, nil
+		case has("schema", "signature"), has("schema", "signatures"):
+			return TypeSignedSchema, nil
+		case has("public_key_pem"):
+			return TypeWellKnown, nil
+		case has("revoked_keys", "updated_at"), has("revoked_signatures", "updated_at"):
+			return TypeRevocation, nil
+		}
+	case '[':
+		var entries []map[string]json.RawMessage
+		if err := json.Unmarshal(trimmed, &entries); err != nil {
+			return "", fmt.Errorf("%w: invalid JSON: %v", ErrUnrecognized, err)
+		}
+		for _, entry := range entries {
+			if _, ok := entry["tool_id"]; !ok {
+				return "", fmt.Errorf("%w: array entries are not pinned keys", ErrUnrecognized)
+			}
+		}
+		return TypePinExport, nil
+	default:
+		if _, err := decodeSignature(string(trimmed)); err == nil {
+			return TypeDetachedSignature, nil
+		}
+	}
+	return "", ErrUnrecognized
+}
+
+// decodeSignature decodes a base64 ASN.1 DER ECDSA signature, returning
+// its length.
+func decodeSignature(signatureB64 string) (int, error) {
+	der, err := base64.StdEncoding.DecodeString(signatureB64)
+	if err != nil {
+		return 0, fmt.Errorf("not base64: %v", err)
+	}
+	var sig struct{ R, S *big.Int }
+	rest, err := asn1.Unmarshal(der, &sig)
+	if err != nil || len(rest) > 0 || sig.R == nil || sig.S == nil {
+		return len(der), fmt.Errorf("%d bytes, not an ASN.1 DER ECDSA signature", len(der))
+	}
+	return len(der), nil
+}
+
+// signatureAlgorithm is the algorithm of every SchemaPin signature.
+const signatureAlgorithm = "ECDSA P-256 SHA-256"
+
+// describeSignature describes the base64 signature in field label.
+func describeSignature(label, signatureB64, kid string) Signature {
+	s := Signature{Label: label, SignerKid: kid}
+	n, err := decodeSignature(signatureB64)
+	s.Bytes = n
+	if err != nil {
+		s.Error = err.Error()
+		return s
+	}
+	s.Algorithm = signatureAlgorithm
+	return s
+}
+
+// describeKey fingerprints the public key PEM in field label.
+func describeKey(label, kid, publicKeyPEM string) Key {
+	k := Key{Label: label, Kid: kid}
+	fingerprint, err := crypto.NewKeyManager().CalculateKeyFingerprintFromPEM(publicKeyPEM)
+	if err != nil {
+		k.Error = err.Error()
+		return k
+	}
+	k.Fingerprint = fingerprint
+	return k
+}
+
+// compareHashes sets check.Match when both of its hashes are known.
+func compareHashes(check *HashCheck) {
+	if check.Computed == "" || check.Embedded == "" {
+		return
+	}
+	computed, _ := core.ParseSchemaHash(check.Computed)
+	embedded, err := core.ParseSchemaHash(check.Embedded)
+	match := err == nil && bytes.Equal(computed, embedded)
+	check.Match = &match
+}
+
+// warn adds a warning to r.
+func (r *Report) warn(format string, args ...interface{}) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, args...))
+}
+
+// field adds a field to r unless value is empty.
+func (r *Report) field(name, value string) {
+	if value != "" {
+		r.Fields = append(r.Fields, Field{Name: name, Value: value})
+	}
+}
+
+// timestamp adds an RFC 3339 timestamp to r unless value is empty, and
+// returns it parsed. A timestamp that does not parse is a warning.
+func (r *Report) timestamp(now time.Time, label, value string) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		r.Timestamps = append(r.Timestamps, Timestamp{Label: label, Value: value})
+		r.warn("%s %q is not an RFC 3339 timestamp", label, value)
+		return time.Time{}, false
+	}
+	r.Timestamps = append(r.Timestamps, Timestamp{Label: label, Value: value, Age: Age(now, t)})
+	return t, true
+}
+
+// Age describes t relative to now, e.g. "3 days ago" or "in 2 hours".
+func Age(now, t time.Time) string {
+	d := now.Sub(t)
+	future := d < 0
+	if future {
+		d = -d
+	}
+	var amount string
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		amount = plural(int(d/time.Minute), "minute")
+	case d < 24*time.Hour:
+		amount = plural(int(d/time.Hour), "hour")
+	default:
+		amount = plural(int(d/(24*time.Hour)), "day")
+	}
+	if future {
+		return "in " + amount
+	}
+	return amount + " ago"
+}
+
+func plural(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
+
+// formatValue renders a decoded JSON value for a field.
+func formatValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
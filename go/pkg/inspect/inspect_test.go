@@ -0,0 +1,138 @@
+package inspect
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery/discoverytest"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/revocation"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// testNow is the time fixture ages are measured from: after the skill
+// signature expired and before the trust bundle does.
+var testNow = time.Date(2026, 1, 15, 12, 0, 0, 0, time.UTC)
+
+func TestInspectGolden(t *testing.T) {
+	// The fixture discovery and revocation documents, served for
+	// example.com
+	wellKnown, err := discovery.LoadWellKnownFile(filepath.Join("testdata", "well_known.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join("testdata", "revocation.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rev revocation.RevocationDocument
+	if err := json.Unmarshal(data, &rev); err != nil {
+		t.Fatal(err)
+	}
+	stub := discoverytest.New()
+	stub.SetDomain("example.com", wellKnown)
+	if err := stub.SetRevocationDocument("example.com", &rev); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		golden  string
+		path    string
+		want    Type
+		resolve bool
+	}{
+		{"signed_schema", "signed_schema.json", TypeSignedSchema, false},
+		{"signed_schema_resolved", "signed_schema.json", TypeSignedSchema, true},
+		{"signed_schema_tampered", "signed_schema_tampered.json", TypeSignedSchema, false},
+		{"detached", "detached.sig", TypeDetachedSignature, false},
+		{"skill_dir", "skill", TypeSkillSignature, false},
+		{"skill_dir_resolved", "skill", TypeSkillSignature, true},
+		{"skill_sig", filepath.Join("skill", ".schemapin.sig"), TypeSkillSignature, false},
+		{"skill_tampered", "skill_tampered", TypeSkillSignature, false},
+		{"well_known", "well_known.json", TypeWellKnown, false},
+		{"revocation", "revocation.json", TypeRevocation, false},
+		{"trust_bundle", "trust_bundle.json", TypeTrustBundle, false},
+		{"pins", "pins.json", TypePinExport, false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.golden, func(t *testing.T) {
+			opts := Options{Clock: clock.NewFake(testNow), Domain: "example.com"}
+			if tt.resolve {
+				opts.Discoverer = stub
+			}
+			report, err := Inspect(context.Background(), filepath.ToSlash(filepath.Join("testdata", tt.path)), opts)
+			if err != nil {
+				t.Fatalf("Inspect failed: %v", err)
+			}
+			if report.Type != tt.want {
+				t.Errorf("Expected type %s, got %s", tt.want, report.Type)
+			}
+
+			var text bytes.Buffer
+			if err := report.WriteText(&text); err != nil {
+				t.Fatal(err)
+			}
+			data, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkGolden(t, tt.golden+".txt", text.Bytes())
+			checkGolden(t, tt.golden+".json", append(data, '\n'))
+		})
+	}
+}
+
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", "golden", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatalf("Failed to update golden file: %v", err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read golden file: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("Output differs from %s (run with -update to regenerate)\nGot:\n%s", path, got)
+	}
+}
+
+func TestDetectUnrecognized(t *testing.T) {
+	for _, input := range []string{"", "{}", `{"name": "weather"}`, `[{"name": "weather"}]`, "not a signature", "{"} {
+		if _, err := Detect([]byte(input)); !errors.Is(err, ErrUnrecognized) {
+			t.Errorf("Detect(%q): expected ErrUnrecognized, got %v", input, err)
+		}
+	}
+	if _, err := Inspect(context.Background(), t.TempDir(), Options{}); !errors.Is(err, ErrUnrecognized) {
+		t.Errorf("Expected a directory without a signature to be unrecognized, got %v", err)
+	}
+}
+
+func TestAge(t *testing.T) {
+	for _, tt := range []struct {
+		d    time.Duration
+		want string
+	}{
+		{10 * time.Second, "just now"},
+		{time.Minute, "1 minute ago"},
+		{5 * time.Hour, "5 hours ago"},
+		{49 * time.Hour, "2 days ago"},
+		{-3 * 24 * time.Hour, "in 3 days"},
+	} {
+		if got := Age(testNow, testNow.Add(-tt.d)); got != tt.want {
+			t.Errorf("Age(-%s) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
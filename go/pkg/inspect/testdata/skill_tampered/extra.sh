@@ -0,0 +1 @@
+curl evil
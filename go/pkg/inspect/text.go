@@ -0,0 +1,145 @@
+package inspect
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// WriteText writes r for people, one section per part of the report.
+func (r *Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	row := func(cells ...string) {
+		fmt.Fprintf(tw, "  %s\n", strings.Join(cells, "\t"))
+	}
+	section := func(title string) {
+		fmt.Fprintf(tw, "\n%s\n", title)
+	}
+
+	fmt.Fprintf(tw, "Type:\t%s\n", r.Type)
+	if r.Path != "" {
+		fmt.Fprintf(tw, "Path:\t%s\n", r.Path)
+	}
+	if r.FormatVersion != "" {
+		fmt.Fprintf(tw, "Format version:\t%s\n", r.FormatVersion)
+	}
+
+	if h := r.Hash; h != nil {
+		title := "Hash: " + h.Subject
+		if h.Canonicalization != "" {
+			title += " (" + h.Canonicalization + ")"
+		}
+		section(title)
+		row("computed", orNone(h.Computed, "not computed"))
+		embedded := orNone(h.Embedded, "none recorded")
+		switch {
+		case h.Match == nil:
+		case *h.Match:
+			embedded += "  MATCH"
+		default:
+			embedded += "  MISMATCH"
+		}
+		row("embedded", embedded)
+	}
+
+	if len(r.Signatures) > 0 {
+		section("Signatures")
+		for _, s := range r.Signatures {
+			var desc string
+			if s.Error != "" {
+				desc = "undecodable: " + s.Error
+			} else {
+				desc = fmt.Sprintf("%s, %d bytes DER", s.Algorithm, s.Bytes)
+			}
+			if s.SignerKid != "" {
+				desc += ", kid " + s.SignerKid
+			}
+			row(s.Label, desc+verifiedSuffix(s.Verified))
+		}
+	}
+
+	if len(r.Keys) > 0 {
+		section("Keys")
+		for _, k := range r.Keys {
+			var parts []string
+			if k.Kid != "" {
+				parts = append(parts, "kid "+k.Kid)
+			}
+			if k.Fingerprint != "" {
+				parts = append(parts, k.Fingerprint)
+			}
+			if k.Error != "" {
+				parts = append(parts, "invalid: "+k.Error)
+			}
+			row(k.Label, strings.Join(parts, ", "))
+		}
+	}
+
+	if len(r.Timestamps) > 0 {
+		section("Timestamps")
+		for _, t := range r.Timestamps {
+			value := t.Value
+			if t.Age != "" {
+				value += " (" + t.Age + ")"
+			}
+			row(t.Label, value)
+		}
+	}
+
+	if len(r.Fields) > 0 {
+		section("Fields")
+		for _, f := range r.Fields {
+			row(f.Name, f.Value)
+		}
+	}
+
+	if res := r.Resolution; res != nil {
+		section("Resolved from " + res.Domain)
+		if res.DeveloperName != "" {
+			row("developer", res.DeveloperName)
+		}
+		if res.Fingerprint != "" {
+			key := res.Fingerprint
+			if res.Scope != "" {
+				key += " (tools[" + res.Scope + "])"
+			}
+			if res.Revoked {
+				key += "  REVOKED"
+			}
+			row("key", key)
+		}
+		if res.Verified != nil {
+			row("signature", strings.TrimSpace(verifiedSuffix(res.Verified)))
+		}
+		if res.Error != "" {
+			row("error", res.Error)
+		}
+	}
+
+	if len(r.Warnings) > 0 {
+		section("Warnings")
+		for _, warning := range r.Warnings {
+			fmt.Fprintf(tw, "  - %s\n", warning)
+		}
+	}
+	return tw.Flush()
+}
+
+func orNone(value, none string) string {
+	if value == "" {
+		return "(" + none + ")"
+	}
+	return value
+}
+
+func verifiedSuffix(verified *bool) string {
+	switch {
+	case verified == nil:
+		return ""
+	case *verified:
+		return "  VERIFIED"
+	default:
+		return "  NOT VERIFIED"
+	}
+}
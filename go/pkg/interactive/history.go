@@ -0,0 +1,86 @@
+package interactive
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DomainHistoryToolLimit is the number of tool IDs a DomainHistory lists.
+const DomainHistoryToolLimit = 5
+
+// DomainHistory summarizes the pins of the other tools of a prompt's
+// domain, so that a decision about a key can be made knowing what is
+// already trusted from the domain.
+type DomainHistory struct {
+	// PinnedTools is the number of other tools of the domain with a pin;
+	// namespace pins count once.
+	PinnedTools int `json:"pinned_tools"`
+	// MatchingKey is the number of them pinned to the key offered.
+	MatchingKey int `json:"matching_key"`
+	// CurrentKey is, for a key change, the number of them still pinned to
+	// the key being replaced.
+	CurrentKey int `json:"current_key,omitempty"`
+	// FirstPinnedAt and LastPinnedAt bound the times they were pinned.
+	FirstPinnedAt time.Time `json:"first_pinned_at,omitempty"`
+	LastPinnedAt  time.Time `json:"last_pinned_at,omitempty"`
+	// ToolIDs are up to DomainHistoryToolLimit of them, ordered by tool ID.
+	ToolIDs []string `json:"tool_ids,omitempty"`
+}
+
+// AllMatch reports whether every other pinned tool of the domain is pinned
+// to the key offered. It is false when there are none.
+func (h *DomainHistory) AllMatch() bool {
+	return h != nil && h.PinnedTools > 0 && h.MatchingKey == h.PinnedTools
+}
+
+// domainHistoryText renders history for a prompt of type promptType, or
+// returns "" when there is nothing to render.
+func domainHistoryText(history *DomainHistory, promptType PromptType) string {
+	if history == nil {
+		return ""
+	}
+	if history.PinnedTools == 0 {
+		if promptType == PromptTypeFirstTimeKey {
+			return "No other tools from this domain are pinned."
+		}
+		return ""
+	}
+
+	noun := "tools"
+	if history.PinnedTools == 1 {
+		noun = "tool"
+	}
+	var lines []string
+	lines = append(lines, fmt.Sprintf("You already trust %d other %s from this domain, pinned %s:",
+		history.PinnedTools, noun, pinnedPeriod(history.FirstPinnedAt, history.LastPinnedAt)))
+	tools := "  " + strings.Join(history.ToolIDs, ", ")
+	if more := history.PinnedTools - len(history.ToolIDs); more > 0 {
+		tools += fmt.Sprintf(" and %d more", more)
+	}
+	lines = append(lines, tools)
+
+	switch {
+	case history.AllMatch():
+		lines = append(lines, "All of them are pinned to the offered key.")
+	case history.MatchingKey > 0:
+		lines = append(lines, fmt.Sprintf("%d of them are pinned to the offered key, %d to other keys.", history.MatchingKey, history.PinnedTools-history.MatchingKey))
+	default:
+		lines = append(lines, "None of them are pinned to the offered key.")
+	}
+	if promptType == PromptTypeKeyChange && history.CurrentKey > 0 {
+		lines = append(lines, fmt.Sprintf("⚠️  %d of them still pin the key being replaced. A rotation by the developer would normally reach every tool of the domain, so this is inconsistent.", history.CurrentKey))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// pinnedPeriod renders the dates of first and last as "on <date>" or
+// "between <date> and <date>".
+func pinnedPeriod(first, last time.Time) string {
+	const layout = "2006-01-02"
+	from, to := first.UTC().Format(layout), last.UTC().Format(layout)
+	if from == to {
+		return "on " + from
+	}
+	return fmt.Sprintf("between %s and %s", from, to)
+}
@@ -3,12 +3,14 @@ package interactive
 
 import (
 	"bufio"
-	"context"
 	"fmt"
+	"io"
 	"os"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
 )
 
@@ -31,28 +33,52 @@ const (
 	UserDecisionAlwaysTrust     UserDecision = "always_trust"
 	UserDecisionNeverTrust      UserDecision = "never_trust"
 	UserDecisionTemporaryAccept UserDecision = "temporary_accept"
+	// UserDecisionAcceptNamespace accepts the key for every tool under the
+	// prompt's namespace (see PromptContext.Namespace).
+	UserDecisionAcceptNamespace UserDecision = "accept_namespace"
 )
 
+// ToolNamespace returns the namespace of a hierarchical tool ID: the ID up
+// to and including its last "/", e.g. "example.com/payments/" for
+// "example.com/payments/refund". It is empty for a tool ID without "/".
+func ToolNamespace(toolID string) string {
+	i := strings.LastIndex(toolID, "/")
+	if i <= 0 {
+		return ""
+	}
+	return toolID[:i+1]
+}
+
 // KeyInfo represents key information for display
 type KeyInfo struct {
-	Fingerprint   string
-	PEMData       string
-	Domain        string
-	DeveloperName string
-	PinnedAt      *time.Time
-	LastVerified  *time.Time
-	IsRevoked     bool
+	Fingerprint   string     `json:"fingerprint"`
+	PEMData       string     `json:"public_key_pem"`
+	Domain        string     `json:"domain"`
+	DeveloperName string     `json:"developer_name,omitempty"`
+	PinnedAt      *time.Time `json:"pinned_at,omitempty"`
+	LastVerified  *time.Time `json:"last_verified,omitempty"`
+	IsRevoked     bool       `json:"is_revoked,omitempty"`
+	// PriorRejections is the number of times the key was rejected for
+	// tools of the domain.
+	PriorRejections int `json:"prior_rejections,omitempty"`
 }
 
 // PromptContext provides context for interactive prompts
 type PromptContext struct {
-	PromptType      PromptType
-	ToolID          string
-	Domain          string
-	CurrentKey      *KeyInfo
-	NewKey          *KeyInfo
-	DeveloperInfo   map[string]string
-	SecurityWarning string
+	PromptType      PromptType        `json:"prompt_type"`
+	ToolID          string            `json:"tool_id"`
+	Domain          string            `json:"domain"`
+	CurrentKey      *KeyInfo          `json:"current_key,omitempty"`
+	NewKey          *KeyInfo          `json:"new_key,omitempty"`
+	DeveloperInfo   map[string]string `json:"developer_info,omitempty"`
+	SecurityWarning string            `json:"security_warning,omitempty"`
+	// Namespace, when set, is the tool ID prefix the key may be accepted
+	// for with UserDecisionAcceptNamespace. For a key change under a
+	// namespace pin it is the pinned namespace.
+	Namespace string `json:"namespace,omitempty"`
+	// DomainHistory, when set, summarizes the pins of the domain's other
+	// tools, for first-time and key change prompts.
+	DomainHistory *DomainHistory `json:"domain_history,omitempty"`
 }
 
 // InteractiveHandler interface for user interaction
@@ -62,33 +88,145 @@ type InteractiveHandler interface {
 	DisplaySecurityWarning(warning string)
 }
 
+// EnvInteractiveDefault names the environment variable that sets the
+// decision applied to first-time keys when no terminal is attached. Accepted
+// values are "accept", "reject" and "temporary_accept".
+const EnvInteractiveDefault = "SCHEMAPIN_INTERACTIVE_DEFAULT"
+
+// ConsoleHandlerOptions configures a ConsoleInteractiveHandler.
+type ConsoleHandlerOptions struct {
+	// Input is read for answers. Defaults to os.Stdin.
+	Input io.Reader
+	// Output receives prompts and messages. Defaults to os.Stdout.
+	Output io.Writer
+	// Timeout bounds one prompt session: the time from the first prompt to
+	// a valid answer, including any re-prompts after invalid input. When it
+	// expires the prompt is rejected. Defaults to 30 seconds.
+	Timeout time.Duration
+	// DefaultDecision is applied to first-time keys when Input is not a
+	// terminal. Key changes, revoked keys and expired keys are always
+	// rejected without a terminal. When empty, EnvInteractiveDefault is
+	// consulted, falling back to reject.
+	DefaultDecision UserDecision
+	// AssumeFirstUseAccept accepts first-time keys without prompting. Key
+	// changes are still prompted for, or rejected without a terminal.
+	AssumeFirstUseAccept bool
+}
+
 // ConsoleInteractiveHandler implements console-based interaction
 type ConsoleInteractiveHandler struct {
-	reader  *bufio.Reader
-	timeout time.Duration
+	reader               *bufio.Reader
+	out                  io.Writer
+	timeout              time.Duration
+	interactive          bool
+	defaultDecision      UserDecision
+	assumeFirstUseAccept bool
+
+	// lines is fed by a single reader goroutine shared by all prompt
+	// sessions, so an answer typed after a timeout is not lost to an
+	// abandoned read.
+	startReader sync.Once
+	lines       chan string
+	readErr     chan error
 }
 
 // NewConsoleInteractiveHandler creates a new console handler
 func NewConsoleInteractiveHandler() *ConsoleInteractiveHandler {
-	return &ConsoleInteractiveHandler{
-		reader:  bufio.NewReader(os.Stdin),
-		timeout: 30 * time.Second, // Default 30 second timeout
-	}
+	return NewConsoleInteractiveHandlerWithOptions(ConsoleHandlerOptions{})
 }
 
 // NewConsoleInteractiveHandlerWithTimeout creates a new console handler with custom timeout
 func NewConsoleInteractiveHandlerWithTimeout(timeout time.Duration) *ConsoleInteractiveHandler {
+	return NewConsoleInteractiveHandlerWithOptions(ConsoleHandlerOptions{Timeout: timeout})
+}
+
+// NewConsoleInteractiveHandlerWithOptions creates a console handler from
+// options. An *os.File input that is not a character device (a pipe or
+// regular file) is treated as non-interactive; any other reader is assumed
+// to be answered by a person or test harness.
+func NewConsoleInteractiveHandlerWithOptions(opts ConsoleHandlerOptions) *ConsoleInteractiveHandler {
+	input := opts.Input
+	if input == nil {
+		input = os.Stdin
+	}
+	out := opts.Output
+	if out == nil {
+		out = os.Stdout
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second // Default 30 second timeout
+	}
+	defaultDecision := opts.DefaultDecision
+	if defaultDecision == "" {
+		defaultDecision = DefaultDecisionFromEnv()
+	}
+
 	return &ConsoleInteractiveHandler{
-		reader:  bufio.NewReader(os.Stdin),
-		timeout: timeout,
+		reader:               bufio.NewReader(input),
+		out:                  out,
+		timeout:              timeout,
+		interactive:          isTerminal(input),
+		defaultDecision:      defaultDecision,
+		assumeFirstUseAccept: opts.AssumeFirstUseAccept,
+	}
+}
+
+// ParseDefaultDecision validates a non-interactive default decision.
+func ParseDefaultDecision(value string) (UserDecision, error) {
+	switch decision := UserDecision(strings.ToLower(strings.TrimSpace(value))); decision {
+	case UserDecisionAccept, UserDecisionReject, UserDecisionTemporaryAccept:
+		return decision, nil
+	default:
+		return "", fmt.Errorf("invalid interactive default %q (expected accept, reject or temporary_accept)", value)
+	}
+}
+
+// DefaultDecisionFromEnv returns the decision named by EnvInteractiveDefault,
+// or reject when it is unset or invalid.
+func DefaultDecisionFromEnv() UserDecision {
+	value := os.Getenv(EnvInteractiveDefault)
+	if value == "" {
+		return UserDecisionReject
+	}
+	decision, err := ParseDefaultDecision(value)
+	if err != nil {
+		return UserDecisionReject
+	}
+	return decision
+}
+
+func isTerminal(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	if !ok {
+		return true
 	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
 }
 
 // PromptUser prompts the user for a decision via console
 func (c *ConsoleInteractiveHandler) PromptUser(context *PromptContext) (UserDecision, error) {
-	fmt.Println("\n" + strings.Repeat("=", 60))
-	fmt.Println("SCHEMAPIN SECURITY PROMPT")
-	fmt.Println(strings.Repeat("=", 60))
+	if context.PromptType == PromptTypeFirstTimeKey && c.assumeFirstUseAccept {
+		fmt.Fprintf(c.out, "Accepting first-time key for tool %s (assume first-use accept)\n", context.ToolID)
+		return UserDecisionAccept, nil
+	}
+	if !c.interactive {
+		decision := UserDecisionReject
+		if context.PromptType == PromptTypeFirstTimeKey {
+			decision = c.defaultDecision
+		}
+		fmt.Fprintf(c.out, "Input is not a terminal; applying non-interactive decision %q to %s prompt for tool %s (set %s or --assume-first-use-accept to change)\n",
+			decision, context.PromptType, context.ToolID, EnvInteractiveDefault)
+		return decision, nil
+	}
+
+	fmt.Fprintln(c.out, "\n"+strings.Repeat("=", 60))
+	fmt.Fprintln(c.out, "SCHEMAPIN SECURITY PROMPT")
+	fmt.Fprintln(c.out, strings.Repeat("=", 60))
 
 	switch context.PromptType {
 	case PromptTypeFirstTimeKey:
@@ -101,11 +239,21 @@ func (c *ConsoleInteractiveHandler) PromptUser(context *PromptContext) (UserDeci
 		c.displayExpiredKeyPrompt(context)
 	}
 
-	return c.getUserChoice(context.PromptType)
+	return c.getUserChoice(context)
 }
 
-// DisplayKeyInfo formats key information for console display
+// DisplayKeyInfo formats key information for console display, followed by
+// the key's visual fingerprint (see crypto.FingerprintVisual) when the
+// fingerprint is well-formed.
 func (c *ConsoleInteractiveHandler) DisplayKeyInfo(keyInfo *KeyInfo) string {
+	text := keyInfoText(keyInfo)
+	if visual, err := crypto.FingerprintVisual(keyInfo.Fingerprint); err == nil {
+		text += "\n" + visual
+	}
+	return text
+}
+
+func keyInfoText(keyInfo *KeyInfo) string {
 	var lines []string
 	lines = append(lines, fmt.Sprintf("Fingerprint: %s", keyInfo.Fingerprint))
 	lines = append(lines, fmt.Sprintf("Domain: %s", keyInfo.Domain))
@@ -115,73 +263,146 @@ func (c *ConsoleInteractiveHandler) DisplayKeyInfo(keyInfo *KeyInfo) string {
 	}
 
 	if keyInfo.PinnedAt != nil {
-		lines = append(lines, fmt.Sprintf("Pinned: %s", keyInfo.PinnedAt.Format(time.RFC3339)))
+		lines = append(lines, fmt.Sprintf("Pinned: %s", clock.Format(*keyInfo.PinnedAt)))
 	}
 
 	if keyInfo.LastVerified != nil {
-		lines = append(lines, fmt.Sprintf("Last Verified: %s", keyInfo.LastVerified.Format(time.RFC3339)))
+		lines = append(lines, fmt.Sprintf("Last Verified: %s", clock.Format(*keyInfo.LastVerified)))
 	}
 
 	if keyInfo.IsRevoked {
 		lines = append(lines, "⚠️  STATUS: REVOKED")
 	}
 
+	if keyInfo.PriorRejections > 0 {
+		lines = append(lines, fmt.Sprintf("⚠️  Previously rejected %d time(s) for tools of this domain", keyInfo.PriorRejections))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// sideBySideVisual draws the randomart of two fingerprints in columns
+// headed "Pinned" and "New", with each key's emoji line below, or returns
+// "" if either fingerprint is malformed.
+func sideBySideVisual(current, next string) string {
+	currentArt, err := crypto.FingerprintRandomart(current)
+	if err != nil {
+		return ""
+	}
+	nextArt, err := crypto.FingerprintRandomart(next)
+	if err != nil {
+		return ""
+	}
+	currentEmoji, _ := crypto.FingerprintEmoji(current)
+	nextEmoji, _ := crypto.FingerprintEmoji(next)
+
+	left := strings.Split(currentArt, "\n")
+	right := strings.Split(nextArt, "\n")
+	width := len(left[0])
+	lines := []string{fmt.Sprintf("%-*s   %s", width, "Pinned", "New")}
+	for i := range left {
+		lines = append(lines, left[i]+"   "+right[i])
+	}
+	lines = append(lines, "Pinned: "+currentEmoji, "New:    "+nextEmoji)
 	return strings.Join(lines, "\n")
 }
 
 // DisplaySecurityWarning displays a security warning
 func (c *ConsoleInteractiveHandler) DisplaySecurityWarning(warning string) {
-	fmt.Printf("\n⚠️  SECURITY WARNING: %s\n", warning)
+	fmt.Fprintf(c.out, "\n⚠️  SECURITY WARNING: %s\n", warning)
+}
+
+// ContactLine renders the contact in developer info, as returned by
+// discovery, as "Contact (verified): ..." or "Contact (unverified): ...",
+// or "" without a contact.
+func ContactLine(developerInfo map[string]string) string {
+	contact := developerInfo["contact"]
+	if contact == "" {
+		return ""
+	}
+	if developerInfo["contact_verified"] == "true" {
+		return "Contact (verified): " + contact
+	}
+	return "Contact (unverified): " + contact
 }
 
 func (c *ConsoleInteractiveHandler) displayFirstTimePrompt(context *PromptContext) {
-	fmt.Printf("\nFirst-time key encounter for tool: %s\n", context.ToolID)
-	fmt.Printf("Domain: %s\n", context.Domain)
+	fmt.Fprintf(c.out, "\nFirst-time key encounter for tool: %s\n", context.ToolID)
+	fmt.Fprintf(c.out, "Domain: %s\n", context.Domain)
 
 	if context.DeveloperInfo != nil {
 		if devName, ok := context.DeveloperInfo["developer_name"]; ok {
-			fmt.Printf("Developer: %s\n", devName)
+			fmt.Fprintf(c.out, "Developer: %s\n", devName)
 		}
 	}
+	if line := ContactLine(context.DeveloperInfo); line != "" {
+		fmt.Fprintln(c.out, line)
+	}
 
 	if context.NewKey != nil {
-		fmt.Println("\nNew Key Information:")
-		fmt.Println(c.DisplayKeyInfo(context.NewKey))
+		fmt.Fprintln(c.out, "\nNew Key Information:")
+		fmt.Fprintln(c.out, c.DisplayKeyInfo(context.NewKey))
+	}
+
+	if text := domainHistoryText(context.DomainHistory, context.PromptType); text != "" {
+		fmt.Fprintln(c.out, "\n"+text)
 	}
 
-	fmt.Println("\nThis is the first time you're encountering this tool.")
-	fmt.Println("Do you want to pin this key for future verification?")
+	fmt.Fprintln(c.out, "\nThis is the first time you're encountering this tool.")
+	fmt.Fprintln(c.out, "Do you want to pin this key for future verification?")
 }
 
 func (c *ConsoleInteractiveHandler) displayKeyChangePrompt(context *PromptContext) {
-	fmt.Printf("\n⚠️  KEY CHANGE DETECTED for tool: %s\n", context.ToolID)
-	fmt.Printf("Domain: %s\n", context.Domain)
+	fmt.Fprintf(c.out, "\n⚠️  KEY CHANGE DETECTED for tool: %s\n", context.ToolID)
+	fmt.Fprintf(c.out, "Domain: %s\n", context.Domain)
+	if line := ContactLine(context.DeveloperInfo); line != "" {
+		fmt.Fprintln(c.out, line)
+	}
+
+	// With both keys known, their art is drawn next to each other below
+	// so differences stand out
+	visual := ""
+	if context.CurrentKey != nil && context.NewKey != nil {
+		visual = sideBySideVisual(context.CurrentKey.Fingerprint, context.NewKey.Fingerprint)
+	}
+	display := c.DisplayKeyInfo
+	if visual != "" {
+		display = keyInfoText
+	}
 
 	if context.CurrentKey != nil {
-		fmt.Println("\nCurrently Pinned Key:")
-		fmt.Println(c.DisplayKeyInfo(context.CurrentKey))
+		fmt.Fprintln(c.out, "\nCurrently Pinned Key:")
+		fmt.Fprintln(c.out, display(context.CurrentKey))
 	}
 
 	if context.NewKey != nil {
-		fmt.Println("\nNew Key Being Offered:")
-		fmt.Println(c.DisplayKeyInfo(context.NewKey))
+		fmt.Fprintln(c.out, "\nNew Key Being Offered:")
+		fmt.Fprintln(c.out, display(context.NewKey))
 	}
 
-	fmt.Println("\n⚠️  The tool is using a different key than previously pinned!")
-	fmt.Println("This could indicate a legitimate key rotation or a security compromise.")
+	if visual != "" {
+		fmt.Fprintln(c.out, "\n"+visual)
+	}
+
+	if text := domainHistoryText(context.DomainHistory, context.PromptType); text != "" {
+		fmt.Fprintln(c.out, "\n"+text)
+	}
+
+	fmt.Fprintln(c.out, "\n⚠️  The tool is using a different key than previously pinned!")
+	fmt.Fprintln(c.out, "This could indicate a legitimate key rotation or a security compromise.")
 }
 
 func (c *ConsoleInteractiveHandler) displayRevokedKeyPrompt(context *PromptContext) {
-	fmt.Printf("\n🚨 REVOKED KEY DETECTED for tool: %s\n", context.ToolID)
-	fmt.Printf("Domain: %s\n", context.Domain)
+	fmt.Fprintf(c.out, "\n🚨 REVOKED KEY DETECTED for tool: %s\n", context.ToolID)
+	fmt.Fprintf(c.out, "Domain: %s\n", context.Domain)
 
 	if context.CurrentKey != nil {
-		fmt.Println("\nRevoked Key Information:")
-		fmt.Println(c.DisplayKeyInfo(context.CurrentKey))
+		fmt.Fprintln(c.out, "\nRevoked Key Information:")
+		fmt.Fprintln(c.out, c.DisplayKeyInfo(context.CurrentKey))
 	}
 
-	fmt.Println("\n🚨 This key has been marked as revoked by the developer!")
-	fmt.Println("Using this tool is NOT RECOMMENDED.")
+	fmt.Fprintln(c.out, "\n🚨 This key has been marked as revoked by the developer!")
+	fmt.Fprintln(c.out, "Using this tool is NOT RECOMMENDED.")
 
 	if context.SecurityWarning != "" {
 		c.DisplaySecurityWarning(context.SecurityWarning)
@@ -189,23 +410,23 @@ func (c *ConsoleInteractiveHandler) displayRevokedKeyPrompt(context *PromptConte
 }
 
 func (c *ConsoleInteractiveHandler) displayExpiredKeyPrompt(context *PromptContext) {
-	fmt.Printf("\n⚠️  EXPIRED KEY DETECTED for tool: %s\n", context.ToolID)
-	fmt.Printf("Domain: %s\n", context.Domain)
+	fmt.Fprintf(c.out, "\n⚠️  EXPIRED KEY DETECTED for tool: %s\n", context.ToolID)
+	fmt.Fprintf(c.out, "Domain: %s\n", context.Domain)
 
 	if context.CurrentKey != nil {
-		fmt.Println("\nExpired Key Information:")
-		fmt.Println(c.DisplayKeyInfo(context.CurrentKey))
+		fmt.Fprintln(c.out, "\nExpired Key Information:")
+		fmt.Fprintln(c.out, c.DisplayKeyInfo(context.CurrentKey))
 	}
 
-	fmt.Println("\n⚠️  This key has expired and should be updated.")
+	fmt.Fprintln(c.out, "\n⚠️  This key has expired and should be updated.")
 }
 
-func (c *ConsoleInteractiveHandler) getUserChoice(promptType PromptType) (UserDecision, error) {
+func (c *ConsoleInteractiveHandler) getUserChoice(context *PromptContext) (UserDecision, error) {
 	var choices map[string]UserDecision
 	var prompt string
 	var defaultChoice UserDecision
 
-	if promptType == PromptTypeRevokedKey {
+	if context.PromptType == PromptTypeRevokedKey {
 		choices = map[string]UserDecision{
 			"r": UserDecisionReject,
 			"n": UserDecisionNeverTrust,
@@ -221,8 +442,12 @@ func (c *ConsoleInteractiveHandler) getUserChoice(promptType PromptType) (UserDe
 			"o": UserDecisionTemporaryAccept,
 		}
 		prompt = "\nChoices:\n" +
-			"  a) Accept and pin this key\n" +
-			"  r) Reject this key\n" +
+			"  a) Accept and pin this key\n"
+		if context.Namespace != "" {
+			choices["s"] = UserDecisionAcceptNamespace
+			prompt += fmt.Sprintf("  s) Accept for all tools under %s\n", context.Namespace)
+		}
+		prompt += "  r) Reject this key\n" +
 			"  t) Always trust this domain\n" +
 			"  n) Never trust this domain\n" +
 			"  o) Accept once (temporary)\n" +
@@ -230,46 +455,46 @@ func (c *ConsoleInteractiveHandler) getUserChoice(promptType PromptType) (UserDe
 		defaultChoice = UserDecisionReject
 	}
 
-	// Create a channel to handle timeout
-	resultChan := make(chan UserDecision, 1)
-	errorChan := make(chan error, 1)
-
-	go func() {
-		for {
-			fmt.Print(prompt)
-			input, err := c.reader.ReadString('\n')
-			if err != nil {
-				errorChan <- err
-				return
+	c.startReader.Do(func() {
+		c.lines = make(chan string)
+		c.readErr = make(chan error, 1)
+		go func() {
+			for {
+				input, err := c.reader.ReadString('\n')
+				if err != nil {
+					c.readErr <- err
+					return
+				}
+				c.lines <- input
 			}
-
+		}()
+	})
+
+	// The deadline covers the whole session, so invalid answers re-prompt
+	// within the remaining time rather than extending it.
+	timer := time.NewTimer(c.timeout)
+	defer timer.Stop()
+
+	for {
+		fmt.Fprint(c.out, prompt)
+		select {
+		case input := <-c.lines:
 			choice := strings.ToLower(strings.TrimSpace(input))
 			if choice == "" {
-				resultChan <- defaultChoice
-				return
+				return defaultChoice, nil
 			}
-
 			if decision, ok := choices[choice]; ok {
-				resultChan <- decision
-				return
+				return decision, nil
 			}
-
-			fmt.Println("Invalid choice. Please try again.")
+			fmt.Fprintln(c.out, "Invalid choice. Please try again.")
+		case err := <-c.readErr:
+			// Keep the error visible to later sessions
+			c.readErr <- err
+			return UserDecisionReject, err
+		case <-timer.C:
+			fmt.Fprintln(c.out, "\nTimeout reached. Defaulting to reject.")
+			return UserDecisionReject, nil
 		}
-	}()
-
-	// Handle timeout
-	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
-	defer cancel()
-
-	select {
-	case decision := <-resultChan:
-		return decision, nil
-	case err := <-errorChan:
-		return UserDecisionReject, err
-	case <-ctx.Done():
-		fmt.Println("\nTimeout reached. Defaulting to reject.")
-		return UserDecisionReject, nil
 	}
 }
 
@@ -320,6 +545,10 @@ func (c *CallbackInteractiveHandler) DisplayKeyInfo(keyInfo *KeyInfo) string {
 		infoParts = append(infoParts, "STATUS: REVOKED")
 	}
 
+	if keyInfo.PriorRejections > 0 {
+		infoParts = append(infoParts, fmt.Sprintf("PREVIOUSLY REJECTED: %d", keyInfo.PriorRejections))
+	}
+
 	return strings.Join(infoParts, " | ")
 }
 
@@ -367,6 +596,12 @@ func (i *InteractivePinningManager) CreateKeyInfo(publicKeyPEM, domain string, d
 
 // PromptFirstTimeKey prompts for first-time key pinning
 func (i *InteractivePinningManager) PromptFirstTimeKey(toolID, domain, publicKeyPEM string, developerInfo map[string]string) (UserDecision, error) {
+	return i.PromptFirstTimeKeyWithHistory(toolID, domain, publicKeyPEM, developerInfo, nil)
+}
+
+// PromptFirstTimeKeyWithHistory is PromptFirstTimeKey, with history
+// summarizing the domain's other pinned tools in the prompt.
+func (i *InteractivePinningManager) PromptFirstTimeKeyWithHistory(toolID, domain, publicKeyPEM string, developerInfo map[string]string, history *DomainHistory) (UserDecision, error) {
 	newKey, err := i.CreateKeyInfo(publicKeyPEM, domain, "", nil, nil, false)
 	if err != nil {
 		return UserDecisionReject, err
@@ -384,16 +619,25 @@ func (i *InteractivePinningManager) PromptFirstTimeKey(toolID, domain, publicKey
 		Domain:        domain,
 		NewKey:        newKey,
 		DeveloperInfo: developerInfo,
+		Namespace:     ToolNamespace(toolID),
+		DomainHistory: history,
 	}
 
 	return i.handler.PromptUser(context)
 }
 
-// PromptKeyChange prompts for key change confirmation
+// PromptKeyChange prompts for key change confirmation. currentKeyInfo may
+// carry "prior_rejections", the number of times the current key was
+// rejected for tools of the domain, "namespace", the namespace of the pin
+// when the current key was pinned for a namespace rather than the tool, and
+// "domain_history", a *DomainHistory of the domain's other pinned tools.
 func (i *InteractivePinningManager) PromptKeyChange(toolID, domain, currentKeyPEM, newKeyPEM string, currentKeyInfo map[string]interface{}, developerInfo map[string]string) (UserDecision, error) {
 	// Create current key info
 	var pinnedAt, lastVerified *time.Time
 	var currentDeveloperName string
+	var priorRejections int
+	var history *DomainHistory
+	namespace := ToolNamespace(toolID)
 
 	if currentKeyInfo != nil {
 		if devName, ok := currentKeyInfo["developer_name"].(string); ok {
@@ -409,12 +653,20 @@ func (i *InteractivePinningManager) PromptKeyChange(toolID, domain, currentKeyPE
 				lastVerified = &t
 			}
 		}
+		if n, ok := currentKeyInfo["prior_rejections"].(int); ok {
+			priorRejections = n
+		}
+		if pinned, ok := currentKeyInfo["namespace"].(string); ok && pinned != "" {
+			namespace = pinned
+		}
+		history, _ = currentKeyInfo["domain_history"].(*DomainHistory)
 	}
 
 	currentKey, err := i.CreateKeyInfo(currentKeyPEM, domain, currentDeveloperName, pinnedAt, lastVerified, false)
 	if err != nil {
 		return UserDecisionReject, err
 	}
+	currentKey.PriorRejections = priorRejections
 
 	// Create new key info
 	var newDeveloperName string
@@ -437,6 +689,8 @@ func (i *InteractivePinningManager) PromptKeyChange(toolID, domain, currentKeyPE
 		NewKey:          newKey,
 		DeveloperInfo:   developerInfo,
 		SecurityWarning: "Key has changed! This could indicate a security issue.",
+		Namespace:       namespace,
+		DomainHistory:   history,
 	}
 
 	return i.handler.PromptUser(context)
@@ -1,7 +1,11 @@
 package interactive
 
 import (
+	"bytes"
+	"io"
+	"os"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -132,6 +136,24 @@ func TestConsoleInteractiveHandler_DisplayKeyInfoRevoked(t *testing.T) {
 	}
 }
 
+func TestConsoleInteractiveHandler_DisplayKeyInfoPriorRejections(t *testing.T) {
+	handler := NewConsoleInteractiveHandler()
+
+	keyInfo := &KeyInfo{
+		Fingerprint:     "sha256:abcd1234",
+		Domain:          "example.com",
+		PriorRejections: 2,
+	}
+
+	if result := handler.DisplayKeyInfo(keyInfo); !strings.Contains(result, "Previously rejected 2 time(s)") {
+		t.Errorf("Expected prior rejections in output, got %q", result)
+	}
+	keyInfo.PriorRejections = 0
+	if result := handler.DisplayKeyInfo(keyInfo); strings.Contains(result, "rejected") {
+		t.Errorf("Expected no rejection line, got %q", result)
+	}
+}
+
 func TestCallbackInteractiveHandler(t *testing.T) {
 	var promptCalled bool
 	var displayCalled bool
@@ -495,3 +517,366 @@ func BenchmarkDisplayKeyInfo(b *testing.B) {
 		_ = handler.DisplayKeyInfo(keyInfo)
 	}
 }
+
+func firstTimeContext() *PromptContext {
+	return &PromptContext{PromptType: PromptTypeFirstTimeKey, ToolID: "calculator", Domain: "example.com"}
+}
+
+func keyChangeContext() *PromptContext {
+	return &PromptContext{PromptType: PromptTypeKeyChange, ToolID: "calculator", Domain: "example.com"}
+}
+
+// nonTerminalInput returns the read end of an OS pipe, which is how stdin
+// looks under CI or `cmd | schemapin-verify`.
+func nonTerminalInput(t *testing.T) *os.File {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Failed to create pipe: %v", err)
+	}
+	t.Cleanup(func() {
+		r.Close()
+		w.Close()
+	})
+	return r
+}
+
+func TestConsoleInteractiveHandler_PipedAnswers(t *testing.T) {
+	var out bytes.Buffer
+	handler := NewConsoleInteractiveHandlerWithOptions(ConsoleHandlerOptions{
+		Input:  strings.NewReader("x\nmaybe\nA\n\n"),
+		Output: &out,
+	})
+
+	decision, err := handler.PromptUser(firstTimeContext())
+	if err != nil {
+		t.Fatalf("PromptUser failed: %v", err)
+	}
+	if decision != UserDecisionAccept {
+		t.Errorf("Expected accept, got %s", decision)
+	}
+	if n := strings.Count(out.String(), "Invalid choice"); n != 2 {
+		t.Errorf("Expected 2 re-prompts, got %d", n)
+	}
+
+	// An empty answer selects the default
+	decision, err = handler.PromptUser(keyChangeContext())
+	if err != nil {
+		t.Fatalf("PromptUser failed: %v", err)
+	}
+	if decision != UserDecisionReject {
+		t.Errorf("Expected default reject, got %s", decision)
+	}
+
+	// Input exhausted
+	if decision, err := handler.PromptUser(firstTimeContext()); err == nil || decision != UserDecisionReject {
+		t.Errorf("Expected reject with EOF error, got %s, %v", decision, err)
+	}
+}
+
+func TestConsoleInteractiveHandler_SessionTimeout(t *testing.T) {
+	r, w := io.Pipe()
+	defer w.Close()
+
+	var out safeBuffer
+	handler := NewConsoleInteractiveHandlerWithOptions(ConsoleHandlerOptions{
+		Input:   r,
+		Output:  &out,
+		Timeout: 200 * time.Millisecond,
+	})
+
+	// Invalid answers keep arriving but do not extend the session
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(20 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if _, err := io.WriteString(w, "bogus\n"); err != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	start := time.Now()
+	decision, err := handler.PromptUser(firstTimeContext())
+	close(stop)
+	if err != nil {
+		t.Fatalf("PromptUser failed: %v", err)
+	}
+	if decision != UserDecisionReject {
+		t.Errorf("Expected reject on timeout, got %s", decision)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Invalid input extended the session to %v", elapsed)
+	}
+	if !strings.Contains(out.String(), "Timeout reached") {
+		t.Error("Expected timeout message")
+	}
+
+	// An answer typed after the timeout is delivered to the next session
+	go io.WriteString(w, "a\n")
+	for {
+		decision, err = handler.PromptUser(firstTimeContext())
+		if err != nil {
+			t.Fatalf("PromptUser failed: %v", err)
+		}
+		if decision == UserDecisionAccept {
+			break
+		}
+		if !strings.Contains(out.String(), "Invalid choice") {
+			t.Fatalf("Expected accept, got %s", decision)
+		}
+	}
+}
+
+func TestConsoleInteractiveHandler_NonTerminal(t *testing.T) {
+	t.Setenv(EnvInteractiveDefault, "")
+
+	tests := []struct {
+		name       string
+		opts       ConsoleHandlerOptions
+		env        string
+		firstTime  UserDecision
+		keyChanged UserDecision
+	}{
+		{"default rejects", ConsoleHandlerOptions{}, "", UserDecisionReject, UserDecisionReject},
+		{"option accepts first use", ConsoleHandlerOptions{DefaultDecision: UserDecisionAccept}, "", UserDecisionAccept, UserDecisionReject},
+		{"env accepts first use", ConsoleHandlerOptions{}, "ACCEPT", UserDecisionAccept, UserDecisionReject},
+		{"env temporary accept", ConsoleHandlerOptions{}, "temporary_accept", UserDecisionTemporaryAccept, UserDecisionReject},
+		{"invalid env rejects", ConsoleHandlerOptions{}, "always_trust", UserDecisionReject, UserDecisionReject},
+		{"option overrides env", ConsoleHandlerOptions{DefaultDecision: UserDecisionReject}, "accept", UserDecisionReject, UserDecisionReject},
+		{"assume first-use accept", ConsoleHandlerOptions{AssumeFirstUseAccept: true}, "", UserDecisionAccept, UserDecisionReject},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(EnvInteractiveDefault, tt.env)
+
+			var out bytes.Buffer
+			opts := tt.opts
+			opts.Input = nonTerminalInput(t)
+			opts.Output = &out
+			handler := NewConsoleInteractiveHandlerWithOptions(opts)
+
+			// Nothing is ever written to the pipe, so any read would block
+			// until the 30s default timeout.
+			start := time.Now()
+			if decision, err := handler.PromptUser(firstTimeContext()); err != nil || decision != tt.firstTime {
+				t.Errorf("First-time key: expected %s, got %s (%v)", tt.firstTime, decision, err)
+			}
+			if decision, err := handler.PromptUser(keyChangeContext()); err != nil || decision != tt.keyChanged {
+				t.Errorf("Key change: expected %s, got %s (%v)", tt.keyChanged, decision, err)
+			}
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("Non-terminal prompts should return immediately, took %v", elapsed)
+			}
+			if strings.Contains(out.String(), "Choice [") {
+				t.Error("Non-terminal handler should not print an interactive prompt")
+			}
+		})
+	}
+}
+
+func TestConsoleInteractiveHandler_AssumeFirstUseAcceptPromptsKeyChange(t *testing.T) {
+	var out bytes.Buffer
+	handler := NewConsoleInteractiveHandlerWithOptions(ConsoleHandlerOptions{
+		Input:                strings.NewReader("r\n"),
+		Output:               &out,
+		AssumeFirstUseAccept: true,
+	})
+
+	if decision, _ := handler.PromptUser(firstTimeContext()); decision != UserDecisionAccept {
+		t.Errorf("Expected first-time key to be accepted, got %s", decision)
+	}
+	if decision, _ := handler.PromptUser(keyChangeContext()); decision != UserDecisionReject {
+		t.Errorf("Expected key change to be prompted and rejected, got %s", decision)
+	}
+	if !strings.Contains(out.String(), "KEY CHANGE DETECTED") {
+		t.Error("Expected key change prompt to be displayed")
+	}
+}
+
+func TestConsoleInteractiveHandler_AcceptNamespace(t *testing.T) {
+	var out bytes.Buffer
+	handler := NewConsoleInteractiveHandlerWithOptions(ConsoleHandlerOptions{
+		Input:  strings.NewReader("s\ns\n"),
+		Output: &out,
+	})
+
+	prompt := firstTimeContext()
+	prompt.ToolID = "example.com/payments/charge"
+	prompt.Namespace = ToolNamespace(prompt.ToolID)
+	decision, err := handler.PromptUser(prompt)
+	if err != nil || decision != UserDecisionAcceptNamespace {
+		t.Fatalf("Expected accept namespace, got %s, %v", decision, err)
+	}
+	if !strings.Contains(out.String(), "s) Accept for all tools under example.com/payments/") {
+		t.Errorf("Expected the namespace choice to be offered, got:\n%s", out.String())
+	}
+
+	// Without a namespace the choice is not offered
+	out.Reset()
+	if decision, _ := handler.PromptUser(firstTimeContext()); decision != UserDecisionReject {
+		t.Errorf("Expected s to be an invalid choice, got %s", decision)
+	}
+	if strings.Contains(out.String(), "Accept for all tools") || !strings.Contains(out.String(), "Invalid choice") {
+		t.Errorf("Expected no namespace choice, got:\n%s", out.String())
+	}
+}
+
+func TestToolNamespace(t *testing.T) {
+	for toolID, want := range map[string]string{
+		"example.com/payments/charge": "example.com/payments/",
+		"example.com/search":          "example.com/",
+		"calculator":                  "",
+		"/calculator":                 "",
+	} {
+		if got := ToolNamespace(toolID); got != want {
+			t.Errorf("ToolNamespace(%q) = %q, expected %q", toolID, got, want)
+		}
+	}
+}
+
+func TestInteractivePinningManager_PromptNamespace(t *testing.T) {
+	var prompts []*PromptContext
+	manager := NewInteractivePinningManager(NewCallbackInteractiveHandler(func(ctx *PromptContext) (UserDecision, error) {
+		prompts = append(prompts, ctx)
+		return UserDecisionReject, nil
+	}, nil, nil))
+
+	_, _ = manager.PromptFirstTimeKey("example.com/payments/charge", "example.com", "key", nil)
+	_, _ = manager.PromptKeyChange("example.com/payments/charge", "example.com", "old", "new", nil, nil)
+	_, _ = manager.PromptKeyChange("example.com/payments/charge", "example.com", "old", "new", map[string]interface{}{"namespace": "example.com/"}, nil)
+	want := []string{"example.com/payments/", "example.com/payments/", "example.com/"}
+	for i, prompt := range prompts {
+		if prompt.Namespace != want[i] {
+			t.Errorf("Prompt %d: expected namespace %q, got %q", i, want[i], prompt.Namespace)
+		}
+	}
+}
+
+func TestConsoleInteractiveHandler_VisualFingerprint(t *testing.T) {
+	current := &KeyInfo{Fingerprint: "sha256:210d8e77ff7830ac26f8cd7f0d4213e83119c648cbdddc4093ed4e4614eae953", Domain: "example.com"}
+	next := &KeyInfo{Fingerprint: "sha256:de0d8e77ff7830ac26f8cd7f0d4213e83119c648cbdddc4093ed4e4614eae953", Domain: "example.com"}
+
+	var out bytes.Buffer
+	handler := NewConsoleInteractiveHandlerWithOptions(ConsoleHandlerOptions{
+		Input:  strings.NewReader("a\nr\n"),
+		Output: &out,
+	})
+	handler.PromptUser(&PromptContext{PromptType: PromptTypeFirstTimeKey, ToolID: "tool", Domain: "example.com", NewKey: current})
+	art, _ := crypto.FingerprintRandomart(current.Fingerprint)
+	if !strings.Contains(out.String(), art) {
+		t.Errorf("Expected the first-time prompt to draw the key's art, got:\n%s", out.String())
+	}
+
+	out.Reset()
+	handler.PromptUser(&PromptContext{PromptType: PromptTypeKeyChange, ToolID: "tool", Domain: "example.com", CurrentKey: current, NewKey: next})
+	output := out.String()
+	if strings.Count(output, "+---[SchemaPin]---+   +---[SchemaPin]---+") != 1 {
+		t.Errorf("Expected both keys' art side by side, got:\n%s", output)
+	}
+	currentEmoji, _ := crypto.FingerprintEmoji(current.Fingerprint)
+	nextEmoji, _ := crypto.FingerprintEmoji(next.Fingerprint)
+	if !strings.Contains(output, "Pinned: "+currentEmoji) || !strings.Contains(output, "New:    "+nextEmoji) {
+		t.Errorf("Expected both keys' emoji, got:\n%s", output)
+	}
+
+	// Malformed fingerprints are shown without art
+	if display := handler.DisplayKeyInfo(&KeyInfo{Fingerprint: "sha256:abcd1234"}); strings.Contains(display, "SchemaPin") {
+		t.Errorf("Expected no art for a malformed fingerprint, got:\n%s", display)
+	}
+}
+
+func TestConsoleInteractiveHandler_DomainHistory(t *testing.T) {
+	history := &DomainHistory{
+		PinnedTools:   6,
+		MatchingKey:   2,
+		CurrentKey:    4,
+		FirstPinnedAt: time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC),
+		LastPinnedAt:  time.Date(2026, 5, 14, 9, 0, 0, 0, time.UTC),
+		ToolIDs:       []string{"a", "b", "c", "d", "e"},
+	}
+	var out bytes.Buffer
+	handler := NewConsoleInteractiveHandlerWithOptions(ConsoleHandlerOptions{
+		Input:  strings.NewReader("r\nr\nr\n"),
+		Output: &out,
+	})
+
+	handler.PromptUser(&PromptContext{PromptType: PromptTypeFirstTimeKey, ToolID: "tool", Domain: "vendor.com", DomainHistory: history})
+	output := out.String()
+	for _, want := range []string{
+		"You already trust 6 other tools from this domain, pinned between 2026-03-02 and 2026-05-14:",
+		"  a, b, c, d, e and 1 more",
+		"2 of them are pinned to the offered key, 4 to other keys.",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Expected the first-time prompt to contain %q, got:\n%s", want, output)
+		}
+	}
+	if strings.Contains(output, "still pin the key being replaced") {
+		t.Errorf("Expected no key change warning in a first-time prompt, got:\n%s", output)
+	}
+
+	out.Reset()
+	handler.PromptUser(&PromptContext{PromptType: PromptTypeKeyChange, ToolID: "tool", Domain: "vendor.com", DomainHistory: history})
+	if !strings.Contains(out.String(), "4 of them still pin the key being replaced") {
+		t.Errorf("Expected the key change prompt to flag tools on the old key, got:\n%s", out.String())
+	}
+
+	out.Reset()
+	handler.PromptUser(&PromptContext{PromptType: PromptTypeFirstTimeKey, ToolID: "tool", Domain: "new.com", DomainHistory: &DomainHistory{}})
+	if !strings.Contains(out.String(), "No other tools from this domain are pinned.") {
+		t.Errorf("Expected an empty history to be stated, got:\n%s", out.String())
+	}
+}
+
+func TestParseDefaultDecision(t *testing.T) {
+	if decision, err := ParseDefaultDecision(" Accept "); err != nil || decision != UserDecisionAccept {
+		t.Errorf("Expected accept, got %s (%v)", decision, err)
+	}
+	if _, err := ParseDefaultDecision("always_trust"); err == nil {
+		t.Error("Expected error for always_trust")
+	}
+}
+
+// safeBuffer is a bytes.Buffer safe for concurrent writes and reads.
+type safeBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *safeBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *safeBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestContactLine(t *testing.T) {
+	tests := []struct {
+		info     map[string]string
+		expected string
+	}{
+		{map[string]string{"contact": "dev@example.com", "contact_verified": "true"}, "Contact (verified): dev@example.com"},
+		{map[string]string{"contact": "dev@example.com", "contact_verified": "false"}, "Contact (unverified): dev@example.com"},
+		{map[string]string{"contact": "dev@example.com"}, "Contact (unverified): dev@example.com"},
+		{map[string]string{"developer_name": "Dev"}, ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := ContactLine(tt.info); got != tt.expected {
+			t.Errorf("ContactLine(%v) = %q, want %q", tt.info, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package interactive
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NotificationAction is a button offered by a notification.
+type NotificationAction struct {
+	// ID is returned by the Notifier when the action is chosen.
+	ID string
+	// Label is the text shown on the button.
+	Label string
+}
+
+// Notification is a key decision rendered for display outside a terminal.
+type Notification struct {
+	Title string
+	Body  string
+	// Actions are offered in order; the first is the safe default.
+	Actions []NotificationAction
+	// Critical marks key changes, revoked and expired keys, which notifiers
+	// should show with their most prominent urgency.
+	Critical bool
+}
+
+// Notifier shows notifications to the user. Notify blocks until an action
+// is chosen or ctx is done, and returns the ID of the chosen action, or an
+// empty ID when the notification was dismissed or expired. A notification
+// without actions is informational and Notify may return as soon as it is
+// shown.
+type Notifier interface {
+	Notify(ctx context.Context, n *Notification) (string, error)
+}
+
+// NotifyingHandlerOptions configures a NotifyingHandler.
+type NotifyingHandlerOptions struct {
+	// Notifier shows the prompts. Defaults to NewSystemNotifier().
+	Notifier Notifier
+	// Timeout bounds how long one prompt waits for an answer. Defaults to
+	// 60 seconds.
+	Timeout time.Duration
+	// DefaultDecision is applied to first-time keys when the notifier fails
+	// or no action is chosen in time. Key changes, revoked keys and expired
+	// keys are rejected instead. When empty, EnvInteractiveDefault is
+	// consulted, falling back to reject.
+	DefaultDecision UserDecision
+	// AssumeFirstUseAccept accepts first-time keys without a notification.
+	AssumeFirstUseAccept bool
+}
+
+// NotifyingHandler implements InteractiveHandler with desktop
+// notifications or dialogs, for agents that run without a terminal.
+// Prompts are shown one at a time; concurrent callers wait their turn.
+type NotifyingHandler struct {
+	notifier             Notifier
+	timeout              time.Duration
+	defaultDecision      UserDecision
+	assumeFirstUseAccept bool
+
+	// mu serializes prompts so that only one dialog is shown at a time.
+	mu sync.Mutex
+}
+
+// NewNotifyingHandler creates a handler that prompts through notifications.
+func NewNotifyingHandler(opts NotifyingHandlerOptions) *NotifyingHandler {
+	notifier := opts.Notifier
+	if notifier == nil {
+		notifier = NewSystemNotifier()
+	}
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = 60 * time.Second
+	}
+	defaultDecision := opts.DefaultDecision
+	if defaultDecision == "" {
+		defaultDecision = DefaultDecisionFromEnv()
+	}
+	return &NotifyingHandler{
+		notifier:             notifier,
+		timeout:              timeout,
+		defaultDecision:      defaultDecision,
+		assumeFirstUseAccept: opts.AssumeFirstUseAccept,
+	}
+}
+
+// Actions offered by the notifications. Always-trust and never-trust
+// answers change domain policy and are left to the console handler, as are
+// namespace pins, which would exceed the buttons some dialogs can show.
+var (
+	actionAccept     = NotificationAction{ID: string(UserDecisionAccept), Label: "Accept"}
+	actionAcceptOnce = NotificationAction{ID: string(UserDecisionTemporaryAccept), Label: "Accept once"}
+	actionReject     = NotificationAction{ID: string(UserDecisionReject), Label: "Reject"}
+	actionAcceptNew  = NotificationAction{ID: string(UserDecisionAccept), Label: "Accept new key"}
+)
+
+// PromptUser shows a notification for the prompt and maps the chosen action
+// to a decision. When the notifier fails, the notification is dismissed or
+// the timeout expires, first-time keys get the default decision and every
+// other prompt is rejected.
+func (n *NotifyingHandler) PromptUser(prompt *PromptContext) (UserDecision, error) {
+	if prompt.PromptType == PromptTypeFirstTimeKey && n.assumeFirstUseAccept {
+		return UserDecisionAccept, nil
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	notification := n.notification(prompt)
+	ctx, cancel := context.WithTimeout(context.Background(), n.timeout)
+	defer cancel()
+	choice, err := n.notifier.Notify(ctx, notification)
+	if err == nil {
+		for _, action := range notification.Actions {
+			if action.ID == choice {
+				return UserDecision(choice), nil
+			}
+		}
+	}
+
+	if prompt.PromptType == PromptTypeFirstTimeKey {
+		return n.defaultDecision, nil
+	}
+	return UserDecisionReject, nil
+}
+
+// DisplayKeyInfo formats key information for a notification body.
+func (n *NotifyingHandler) DisplayKeyInfo(keyInfo *KeyInfo) string {
+	lines := []string{fmt.Sprintf("Fingerprint: %s", keyInfo.Fingerprint)}
+	if keyInfo.DeveloperName != "" {
+		lines = append(lines, fmt.Sprintf("Developer: %s", keyInfo.DeveloperName))
+	}
+	if keyInfo.IsRevoked {
+		lines = append(lines, "STATUS: REVOKED")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// DisplaySecurityWarning shows the warning as an informational
+// notification.
+func (n *NotifyingHandler) DisplaySecurityWarning(warning string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), n.timeout)
+	defer cancel()
+	_, _ = n.notifier.Notify(ctx, &Notification{
+		Title:    "SchemaPin security warning",
+		Body:     warning,
+		Critical: true,
+	})
+}
+
+// notification renders a prompt. Key changes, revoked and expired keys are
+// worded as alarms and offer Reject first.
+func (n *NotifyingHandler) notification(prompt *PromptContext) *Notification {
+	var body []string
+	switch prompt.PromptType {
+	case PromptTypeKeyChange:
+		body = append(body, fmt.Sprintf("The key for tool %s from %s has CHANGED since it was pinned.", prompt.ToolID, prompt.Domain),
+			"This may be a legitimate key rotation, or the tool may have been compromised. Only accept if the developer announced a new key.")
+		if prompt.CurrentKey != nil {
+			body = append(body, "Pinned key:\n"+n.DisplayKeyInfo(prompt.CurrentKey))
+		}
+		if prompt.NewKey != nil {
+			body = append(body, "New key:\n"+n.DisplayKeyInfo(prompt.NewKey))
+		}
+		return &Notification{
+			Title:    fmt.Sprintf("⚠️ SchemaPin: key changed for %s", prompt.ToolID),
+			Body:     strings.Join(body, "\n\n"),
+			Actions:  []NotificationAction{actionReject, actionAcceptNew},
+			Critical: true,
+		}
+
+	case PromptTypeRevokedKey:
+		body = append(body, fmt.Sprintf("The key for tool %s from %s has been REVOKED by its developer.", prompt.ToolID, prompt.Domain),
+			"Do not use this tool. It has been blocked.")
+		if prompt.CurrentKey != nil {
+			body = append(body, "Revoked key:\n"+n.DisplayKeyInfo(prompt.CurrentKey))
+		}
+		return &Notification{
+			Title:    fmt.Sprintf("🚨 SchemaPin: revoked key for %s", prompt.ToolID),
+			Body:     strings.Join(body, "\n\n"),
+			Actions:  []NotificationAction{actionReject},
+			Critical: true,
+		}
+
+	case PromptTypeExpiredKey:
+		body = append(body, fmt.Sprintf("The key for tool %s from %s has EXPIRED.", prompt.ToolID, prompt.Domain),
+			"The developer should publish a new key. Accept only if you trust the tool until then.")
+		if prompt.CurrentKey != nil {
+			body = append(body, "Expired key:\n"+n.DisplayKeyInfo(prompt.CurrentKey))
+		}
+		return &Notification{
+			Title:    fmt.Sprintf("⚠️ SchemaPin: expired key for %s", prompt.ToolID),
+			Body:     strings.Join(body, "\n\n"),
+			Actions:  []NotificationAction{actionReject, actionAcceptOnce},
+			Critical: true,
+		}
+
+	default:
+		body = append(body, fmt.Sprintf("Tool %s from %s is being used for the first time.", prompt.ToolID, prompt.Domain),
+			"Pin its key for future verification?")
+		if prompt.NewKey != nil {
+			body = append(body, n.DisplayKeyInfo(prompt.NewKey))
+		}
+		return &Notification{
+			Title:   fmt.Sprintf("SchemaPin: new tool %s", prompt.ToolID),
+			Body:    strings.Join(body, "\n\n"),
+			Actions: []NotificationAction{actionReject, actionAccept, actionAcceptOnce},
+		}
+	}
+}
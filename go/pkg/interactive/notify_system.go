@@ -0,0 +1,212 @@
+package interactive
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrNotifierUnsupported is returned by SystemNotifier on platforms without
+// a supported notifier.
+var ErrNotifierUnsupported = errors.New("desktop notifications are not supported on this platform")
+
+// CommandRunner runs an external program and returns its standard output.
+// The program is killed when ctx is done.
+type CommandRunner interface {
+	Run(ctx context.Context, name string, args ...string) (string, error)
+}
+
+type execRunner struct{}
+
+func (execRunner) Run(ctx context.Context, name string, args ...string) (string, error) {
+	out, err := exec.CommandContext(ctx, name, args...).Output()
+	return string(out), err
+}
+
+// SystemNotifier shows notifications with the platform's own notifier:
+// an osascript dialog on macOS, notify-send on Linux and the BSDs, and a
+// toast shown through PowerShell on Windows. A notifier that is missing,
+// fails or is dismissed yields no action, so the handler falls back to its
+// default decision.
+type SystemNotifier struct {
+	goos   string
+	runner CommandRunner
+}
+
+// NewSystemNotifier returns a notifier for the running platform.
+func NewSystemNotifier() *SystemNotifier {
+	return NewSystemNotifierWithRunner(runtime.GOOS, execRunner{})
+}
+
+// NewSystemNotifierWithRunner returns a notifier that builds the commands
+// for goos and runs them with runner.
+func NewSystemNotifierWithRunner(goos string, runner CommandRunner) *SystemNotifier {
+	return &SystemNotifier{goos: goos, runner: runner}
+}
+
+// Notify shows n and returns the ID of the chosen action.
+func (s *SystemNotifier) Notify(ctx context.Context, n *Notification) (string, error) {
+	timeout := 60 * time.Second
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = time.Until(deadline)
+	}
+
+	switch s.goos {
+	case "darwin":
+		out, err := s.runner.Run(ctx, "osascript", "-e", appleScript(n, timeout))
+		if err != nil {
+			return "", fmt.Errorf("osascript: %w", err)
+		}
+		return actionForLabel(n, parseDialogButton(out)), nil
+	case "linux", "freebsd", "openbsd", "netbsd":
+		out, err := s.runner.Run(ctx, "notify-send", notifySendArgs(n, timeout)...)
+		if err != nil {
+			return "", fmt.Errorf("notify-send: %w", err)
+		}
+		return strings.TrimSpace(out), nil
+	case "windows":
+		out, err := s.runner.Run(ctx, "powershell", "-NoProfile", "-NonInteractive", "-Command", toastScript(n, timeout))
+		if err != nil {
+			return "", fmt.Errorf("powershell: %w", err)
+		}
+		return strings.TrimSpace(out), nil
+	default:
+		return "", fmt.Errorf("%w: %s", ErrNotifierUnsupported, s.goos)
+	}
+}
+
+// appleScript shows a notification, or for prompts a dialog with one button
+// per action that gives up when the timeout expires.
+func appleScript(n *Notification, timeout time.Duration) string {
+	if len(n.Actions) == 0 {
+		return fmt.Sprintf("display notification %s with title %s", appleString(n.Body), appleString(n.Title))
+	}
+	buttons := make([]string, len(n.Actions))
+	for i, action := range n.Actions {
+		buttons[i] = appleString(action.Label)
+	}
+	icon := "note"
+	if n.Critical {
+		icon = "caution"
+	}
+	return fmt.Sprintf("display dialog %s with title %s buttons {%s} default button %s with icon %s giving up after %d",
+		appleString(n.Body), appleString(n.Title), strings.Join(buttons, ", "),
+		buttons[0], icon, timeoutSeconds(timeout))
+}
+
+func appleString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// parseDialogButton extracts the label from osascript output such as
+// "button returned:Accept, gave up:false".
+func parseDialogButton(out string) string {
+	const prefix = "button returned:"
+	out = strings.TrimSpace(out)
+	i := strings.Index(out, prefix)
+	if i < 0 {
+		return ""
+	}
+	label := out[i+len(prefix):]
+	if j := strings.LastIndex(label, ", gave up:"); j >= 0 {
+		label = label[:j]
+	}
+	return label
+}
+
+func actionForLabel(n *Notification, label string) string {
+	for _, action := range n.Actions {
+		if action.Label == label {
+			return action.ID
+		}
+	}
+	return ""
+}
+
+// notifySendArgs waits for a click on one of the actions; notify-send
+// prints the ID of the action clicked.
+func notifySendArgs(n *Notification, timeout time.Duration) []string {
+	urgency := "normal"
+	if n.Critical {
+		urgency = "critical"
+	}
+	args := []string{
+		"--app-name=SchemaPin",
+		"--urgency=" + urgency,
+		"--expire-time=" + strconv.FormatInt(timeout.Milliseconds(), 10),
+	}
+	if len(n.Actions) > 0 {
+		args = append(args, "--wait")
+		for _, action := range n.Actions {
+			args = append(args, "--action="+action.ID+"="+action.Label)
+		}
+	}
+	return append(args, "--", n.Title, n.Body)
+}
+
+// powerShellAppID is the application the toast is shown for. Toasts from
+// unregistered applications are not displayed, so PowerShell's own ID is
+// used.
+const powerShellAppID = `{1AC14E77-02E7-4E5D-B744-2EB1AE5198B7}\WindowsPowerShell\v1.0\powershell.exe`
+
+// toastScript shows a toast with one button per action and prints the ID
+// of the button clicked, if any, before the timeout.
+func toastScript(n *Notification, timeout time.Duration) string {
+	var doc strings.Builder
+	scenario := ""
+	if len(n.Actions) > 0 {
+		scenario = ` scenario="reminder"`
+	}
+	fmt.Fprintf(&doc, `<toast%s><visual><binding template="ToastGeneric"><text>%s</text><text>%s</text></binding></visual>`,
+		scenario, xmlText(n.Title), xmlText(n.Body))
+	if len(n.Actions) > 0 {
+		doc.WriteString("<actions>")
+		for _, action := range n.Actions {
+			fmt.Fprintf(&doc, `<action content="%s" arguments="%s" activationType="foreground"/>`,
+				xmlText(action.Label), xmlText(action.ID))
+		}
+		doc.WriteString("</actions>")
+	}
+	doc.WriteString("</toast>")
+
+	lines := []string{
+		`$ErrorActionPreference = 'Stop'`,
+		`[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null`,
+		`[Windows.Data.Xml.Dom.XmlDocument, Windows.Data.Xml.Dom.XmlDocument, ContentType = WindowsRuntime] > $null`,
+		`$xml = New-Object Windows.Data.Xml.Dom.XmlDocument`,
+		`$xml.LoadXml(` + powerShellString(doc.String()) + `)`,
+		`$toast = New-Object Windows.UI.Notifications.ToastNotification $xml`,
+		`Register-ObjectEvent -InputObject $toast -EventName Activated -SourceIdentifier SchemaPinToast > $null`,
+		`[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier(` + powerShellString(powerShellAppID) + `).Show($toast)`,
+	}
+	if len(n.Actions) > 0 {
+		lines = append(lines,
+			`$e = Wait-Event -SourceIdentifier SchemaPinToast -Timeout `+strconv.Itoa(timeoutSeconds(timeout)),
+			`if ($e) { [Windows.UI.Notifications.ToastActivatedEventArgs]$e.SourceArgs[1] | ForEach-Object { $_.Arguments } }`)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func xmlText(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+func powerShellString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func timeoutSeconds(timeout time.Duration) int {
+	seconds := int(timeout / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	return seconds
+}
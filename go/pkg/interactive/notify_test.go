@@ -0,0 +1,246 @@
+package interactive
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeNotifier records notifications and answers them from a script.
+type fakeNotifier struct {
+	mu            sync.Mutex
+	notifications []*Notification
+	responses     []string
+	err           error
+	delay         time.Duration
+
+	active    atomic.Int32
+	maxActive atomic.Int32
+}
+
+func (f *fakeNotifier) Notify(ctx context.Context, n *Notification) (string, error) {
+	if active := f.active.Add(1); active > f.maxActive.Load() {
+		f.maxActive.Store(active)
+	}
+	defer f.active.Add(-1)
+
+	f.mu.Lock()
+	f.notifications = append(f.notifications, n)
+	var response string
+	if len(f.responses) > 0 {
+		response, f.responses = f.responses[0], f.responses[1:]
+	}
+	f.mu.Unlock()
+
+	if f.delay > 0 {
+		select {
+		case <-time.After(f.delay):
+		case <-ctx.Done():
+			return "", nil
+		}
+	}
+	return response, f.err
+}
+
+func TestNotifyingHandler_Decisions(t *testing.T) {
+	tests := []struct {
+		name     string
+		prompt   PromptType
+		response string
+		err      error
+		defaults UserDecision
+		expected UserDecision
+	}{
+		{"first-time accept", PromptTypeFirstTimeKey, "accept", nil, UserDecisionReject, UserDecisionAccept},
+		{"first-time accept once", PromptTypeFirstTimeKey, "temporary_accept", nil, UserDecisionReject, UserDecisionTemporaryAccept},
+		{"first-time dismissed", PromptTypeFirstTimeKey, "", nil, UserDecisionTemporaryAccept, UserDecisionTemporaryAccept},
+		{"first-time notifier error", PromptTypeFirstTimeKey, "", errors.New("no display"), UserDecisionAccept, UserDecisionAccept},
+		{"key change accept", PromptTypeKeyChange, "accept", nil, UserDecisionReject, UserDecisionAccept},
+		{"key change dismissed", PromptTypeKeyChange, "", nil, UserDecisionAccept, UserDecisionReject},
+		{"revoked reject", PromptTypeRevokedKey, "reject", nil, UserDecisionAccept, UserDecisionReject},
+		{"revoked unoffered action", PromptTypeRevokedKey, "accept", nil, UserDecisionAccept, UserDecisionReject},
+		{"expired notifier error", PromptTypeExpiredKey, "", errors.New("no display"), UserDecisionAccept, UserDecisionReject},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notifier := &fakeNotifier{responses: []string{tt.response}, err: tt.err}
+			handler := NewNotifyingHandler(NotifyingHandlerOptions{Notifier: notifier, DefaultDecision: tt.defaults})
+
+			decision, err := handler.PromptUser(&PromptContext{PromptType: tt.prompt, ToolID: "tool", Domain: "example.com"})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if decision != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, decision)
+			}
+			if len(notifier.notifications) != 1 {
+				t.Errorf("Expected one notification, got %d", len(notifier.notifications))
+			}
+		})
+	}
+}
+
+func TestNotifyingHandler_Wording(t *testing.T) {
+	notifier := &fakeNotifier{responses: []string{"", "", ""}}
+	handler := NewNotifyingHandler(NotifyingHandlerOptions{Notifier: notifier})
+
+	current := &KeyInfo{Fingerprint: "sha256:old", Domain: "example.com"}
+	newKey := &KeyInfo{Fingerprint: "sha256:new", Domain: "example.com", DeveloperName: "Dev"}
+	_, _ = handler.PromptUser(&PromptContext{PromptType: PromptTypeFirstTimeKey, ToolID: "tool", Domain: "example.com", NewKey: newKey})
+	_, _ = handler.PromptUser(&PromptContext{PromptType: PromptTypeKeyChange, ToolID: "tool", Domain: "example.com", CurrentKey: current, NewKey: newKey})
+	_, _ = handler.PromptUser(&PromptContext{PromptType: PromptTypeRevokedKey, ToolID: "tool", Domain: "example.com", CurrentKey: current})
+
+	firstTime, keyChange, revoked := notifier.notifications[0], notifier.notifications[1], notifier.notifications[2]
+	if firstTime.Critical || !strings.Contains(firstTime.Body, "sha256:new") {
+		t.Errorf("Unexpected first-time notification: %+v", firstTime)
+	}
+	if !keyChange.Critical || !strings.Contains(keyChange.Title, "key changed") ||
+		!strings.Contains(keyChange.Body, "sha256:old") || !strings.Contains(keyChange.Body, "compromised") {
+		t.Errorf("Unexpected key change notification: %+v", keyChange)
+	}
+	if !revoked.Critical || !strings.Contains(revoked.Body, "REVOKED") {
+		t.Errorf("Unexpected revoked key notification: %+v", revoked)
+	}
+	for _, n := range notifier.notifications {
+		if n.Actions[0].ID != string(UserDecisionReject) {
+			t.Errorf("Expected reject as the first action of %q, got %+v", n.Title, n.Actions)
+		}
+	}
+	if len(revoked.Actions) != 1 {
+		t.Errorf("Expected a revoked key to offer only reject, got %+v", revoked.Actions)
+	}
+}
+
+func TestNotifyingHandler_SerializesPrompts(t *testing.T) {
+	notifier := &fakeNotifier{responses: []string{"accept", "accept", "accept", "accept"}, delay: 20 * time.Millisecond}
+	handler := NewNotifyingHandler(NotifyingHandlerOptions{Notifier: notifier})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if decision, _ := handler.PromptUser(&PromptContext{PromptType: PromptTypeFirstTimeKey, ToolID: "tool"}); decision != UserDecisionAccept {
+				t.Errorf("Expected accept, got %s", decision)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if max := notifier.maxActive.Load(); max != 1 {
+		t.Errorf("Expected one notification at a time, got %d concurrently", max)
+	}
+}
+
+func TestNotifyingHandler_Timeout(t *testing.T) {
+	notifier := &fakeNotifier{responses: []string{"accept"}, delay: time.Minute}
+	handler := NewNotifyingHandler(NotifyingHandlerOptions{
+		Notifier:        notifier,
+		Timeout:         10 * time.Millisecond,
+		DefaultDecision: UserDecisionReject,
+	})
+
+	start := time.Now()
+	decision, err := handler.PromptUser(&PromptContext{PromptType: PromptTypeFirstTimeKey, ToolID: "tool"})
+	if err != nil || decision != UserDecisionReject {
+		t.Errorf("Expected the default decision on timeout, got %s, %v", decision, err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the prompt to time out promptly, took %v", elapsed)
+	}
+}
+
+func TestNotifyingHandler_AssumeFirstUseAccept(t *testing.T) {
+	notifier := &fakeNotifier{}
+	handler := NewNotifyingHandler(NotifyingHandlerOptions{Notifier: notifier, AssumeFirstUseAccept: true})
+
+	decision, err := handler.PromptUser(&PromptContext{PromptType: PromptTypeFirstTimeKey, ToolID: "tool"})
+	if err != nil || decision != UserDecisionAccept {
+		t.Errorf("Expected accept, got %s, %v", decision, err)
+	}
+	if len(notifier.notifications) != 0 {
+		t.Error("Expected no notification for an assumed first use")
+	}
+}
+
+// fakeRunner records the command run and returns scripted output.
+type fakeRunner struct {
+	name string
+	args []string
+	out  string
+	err  error
+}
+
+func (f *fakeRunner) Run(_ context.Context, name string, args ...string) (string, error) {
+	f.name, f.args = name, args
+	return f.out, f.err
+}
+
+func TestSystemNotifier(t *testing.T) {
+	prompt := &Notification{
+		Title:    `Key "changed"`,
+		Body:     "Body",
+		Actions:  []NotificationAction{actionReject, actionAcceptNew},
+		Critical: true,
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tests := []struct {
+		goos     string
+		out      string
+		command  string
+		contains []string
+		expected string
+	}{
+		{"darwin", "button returned:Accept new key, gave up:false\n", "osascript",
+			[]string{`with title "Key \"changed\""`, `buttons {"Reject", "Accept new key"} default button "Reject"`, "with icon caution", "giving up after"}, "accept"},
+		{"darwin", "button returned:, gave up:true\n", "osascript", nil, ""},
+		{"linux", "reject\n", "notify-send",
+			[]string{"--urgency=critical", "--wait", "--action=reject=Reject", "--action=accept=Accept new key"}, "reject"},
+		{"windows", "accept\r\n", "powershell",
+			[]string{`<action content="Accept new key" arguments="accept"`, "Wait-Event -SourceIdentifier SchemaPinToast"}, "accept"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.goos, func(t *testing.T) {
+			runner := &fakeRunner{out: tt.out}
+			choice, err := NewSystemNotifierWithRunner(tt.goos, runner).Notify(ctx, prompt)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if choice != tt.expected {
+				t.Errorf("Expected action %q, got %q", tt.expected, choice)
+			}
+			if runner.name != tt.command {
+				t.Errorf("Expected %s to be run, got %s", tt.command, runner.name)
+			}
+			command := strings.Join(runner.args, " ")
+			for _, want := range tt.contains {
+				if !strings.Contains(command, want) {
+					t.Errorf("Expected command to contain %q, got %s", want, command)
+				}
+			}
+		})
+	}
+}
+
+func TestSystemNotifier_Failures(t *testing.T) {
+	prompt := &Notification{Title: "Title", Actions: []NotificationAction{actionReject}}
+
+	_, err := NewSystemNotifierWithRunner("plan9", &fakeRunner{}).Notify(context.Background(), prompt)
+	if !errors.Is(err, ErrNotifierUnsupported) {
+		t.Errorf("Expected ErrNotifierUnsupported, got %v", err)
+	}
+
+	runErr := errors.New("executable file not found")
+	_, err = NewSystemNotifierWithRunner("linux", &fakeRunner{err: runErr}).Notify(context.Background(), prompt)
+	if !errors.Is(err, runErr) {
+		t.Errorf("Expected the runner error, got %v", err)
+	}
+}
@@ -0,0 +1,404 @@
+package interactive
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/requestid"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+)
+
+// DefaultPendingTTL is how long a queued prompt waits for an answer when
+// PendingStoreOptions.TTL is zero.
+const DefaultPendingTTL = time.Hour
+
+var (
+	// ErrPendingNotFound is returned by Resolve for an unknown ID.
+	ErrPendingNotFound = errors.New("pending decision not found")
+	// ErrPendingResolved is returned by Resolve for a prompt that was
+	// already answered or has expired.
+	ErrPendingResolved = errors.New("pending decision already resolved")
+)
+
+// PendingDecision is a prompt queued by a PendingDecisionStore until it is
+// answered.
+type PendingDecision struct {
+	ID        string         `json:"id"`
+	Prompt    *PromptContext `json:"prompt"`
+	QueuedAt  time.Time      `json:"queued_at"`
+	ExpiresAt time.Time      `json:"expires_at"`
+	// Decision is the answer, empty while the prompt is unanswered.
+	Decision   UserDecision `json:"decision,omitempty"`
+	ResolvedAt time.Time    `json:"resolved_at,omitempty"`
+	// Expired reports that nobody answered in time and Decision is the
+	// default reject.
+	Expired bool `json:"expired,omitempty"`
+}
+
+// key identifies the prompt the decision answers: duplicate prompts for
+// the same tool, prompt type and key are collapsed into one decision.
+func (p *PendingDecision) key() string {
+	return pendingKey(p.Prompt)
+}
+
+func pendingKey(prompt *PromptContext) string {
+	var fingerprint string
+	switch {
+	case prompt.NewKey != nil:
+		fingerprint = prompt.NewKey.Fingerprint
+	case prompt.CurrentKey != nil:
+		fingerprint = prompt.CurrentKey.Fingerprint
+	}
+	return prompt.ToolID + "\x00" + string(prompt.PromptType) + "\x00" + fingerprint
+}
+
+// PendingEventType is what happened to a pending decision.
+type PendingEventType string
+
+const (
+	PendingEventQueued   PendingEventType = "queued"
+	PendingEventResolved PendingEventType = "resolved"
+	PendingEventExpired  PendingEventType = "expired"
+	// PendingEventConsumed is a decision applied by a re-verification.
+	PendingEventConsumed PendingEventType = "consumed"
+)
+
+// PendingEvent is the audit record of a change to a pending decision.
+type PendingEvent struct {
+	Type     PendingEventType `json:"type"`
+	Decision PendingDecision  `json:"decision"`
+	At       time.Time        `json:"at"`
+}
+
+// PendingStorage persists the decisions of a PendingDecisionStore. Both
+// methods pass fn every stored decision keyed by ID; UpdatePending then
+// stores the map as fn left it, atomically with the read.
+type PendingStorage interface {
+	ViewPending(fn func(items map[string]*PendingDecision) error) error
+	UpdatePending(fn func(items map[string]*PendingDecision) error) error
+}
+
+// PendingStoreOptions configures a PendingDecisionStore.
+type PendingStoreOptions struct {
+	// TTL is how long a prompt waits for an answer before it is rejected.
+	// Defaults to DefaultPendingTTL.
+	TTL time.Duration
+	// Clock is the time source for queuing and expiry. Defaults to
+	// clock.Real.
+	Clock clock.Clock
+	// OnEvent, if set, receives an audit event for every prompt queued,
+	// resolved, expired or consumed, after the change is stored.
+	OnEvent func(PendingEvent)
+}
+
+// PendingDecisionStore queues prompts for an asynchronous answer, for user
+// interfaces that cannot block a verification while the user decides,
+// such as web dashboards. A QueuedHandler records each prompt here and
+// fails the verification with a *DecisionPendingError; the UI lists the
+// prompts with ListPending and answers them with Resolve; a later
+// verification of the same tool consumes the answer. Prompts left
+// unanswered past their TTL are rejected.
+//
+// A store is safe for concurrent use. NewMemoryPendingStorage keeps the
+// decisions in memory; pinning.KeyPinning.PendingDecisions keeps them in
+// the pinning database.
+type PendingDecisionStore struct {
+	storage PendingStorage
+	ttl     time.Duration
+	clock   clock.Clock
+	onEvent func(PendingEvent)
+}
+
+// NewPendingDecisionStore returns a store keeping its decisions in
+// storage.
+func NewPendingDecisionStore(storage PendingStorage, opts PendingStoreOptions) *PendingDecisionStore {
+	ttl := opts.TTL
+	if ttl <= 0 {
+		ttl = DefaultPendingTTL
+	}
+	return &PendingDecisionStore{
+		storage: storage,
+		ttl:     ttl,
+		clock:   clock.OrReal(opts.Clock),
+		onEvent: opts.OnEvent,
+	}
+}
+
+// NewMemoryPendingStore returns a store keeping its decisions in memory,
+// for processes whose prompts need not survive a restart.
+func NewMemoryPendingStore(opts PendingStoreOptions) *PendingDecisionStore {
+	return NewPendingDecisionStore(NewMemoryPendingStorage(), opts)
+}
+
+// Take returns the answer to prompt, if one was given, and removes it from
+// the store. Otherwise it queues prompt, or finds the decision already
+// queued for the same tool, prompt type and key, and returns it unanswered.
+// A queued prompt past its expiry is answered with reject.
+func (s *PendingDecisionStore) Take(prompt *PromptContext) (UserDecision, *PendingDecision, error) {
+	now := s.clock.Now()
+	key := pendingKey(prompt)
+	var (
+		decision UserDecision
+		pending  *PendingDecision
+		events   []PendingEvent
+	)
+	err := s.storage.UpdatePending(func(items map[string]*PendingDecision) error {
+		for id, item := range items {
+			if item.key() != key {
+				continue
+			}
+			if item.Decision == "" && !now.Before(item.ExpiresAt) {
+				expire(item, now)
+				events = append(events, PendingEvent{Type: PendingEventExpired, Decision: *item, At: now})
+			}
+			if item.Decision == "" {
+				copied := *item
+				pending = &copied
+				return nil
+			}
+			decision = item.Decision
+			delete(items, id)
+			events = append(events, PendingEvent{Type: PendingEventConsumed, Decision: *item, At: now})
+			return nil
+		}
+
+		item := &PendingDecision{
+			ID:        requestid.New(),
+			Prompt:    prompt,
+			QueuedAt:  now,
+			ExpiresAt: now.Add(s.ttl),
+		}
+		items[item.ID] = item
+		copied := *item
+		pending = &copied
+		events = append(events, PendingEvent{Type: PendingEventQueued, Decision: *item, At: now})
+		return nil
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to queue decision: %w", err)
+	}
+	s.emit(events)
+	return decision, pending, nil
+}
+
+// ListPending returns the unanswered prompts that have not expired, oldest
+// first.
+func (s *PendingDecisionStore) ListPending() ([]PendingDecision, error) {
+	now := s.clock.Now()
+	var pending []PendingDecision
+	err := s.storage.ViewPending(func(items map[string]*PendingDecision) error {
+		for _, item := range items {
+			if item.Decision == "" && now.Before(item.ExpiresAt) {
+				pending = append(pending, *item)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pending decisions: %w", err)
+	}
+	sort.Slice(pending, func(i, j int) bool {
+		if !pending[i].QueuedAt.Equal(pending[j].QueuedAt) {
+			return pending[i].QueuedAt.Before(pending[j].QueuedAt)
+		}
+		return pending[i].ID < pending[j].ID
+	})
+	return pending, nil
+}
+
+// Resolve answers the prompt with id. The answer is applied by the next
+// verification of the tool. Unknown IDs fail with ErrPendingNotFound, and
+// prompts already answered or expired with ErrPendingResolved.
+func (s *PendingDecisionStore) Resolve(id string, decision UserDecision) error {
+	now := s.clock.Now()
+	var events []PendingEvent
+	err := s.storage.UpdatePending(func(items map[string]*PendingDecision) error {
+		item, ok := items[id]
+		if !ok {
+			return ErrPendingNotFound
+		}
+		if item.Decision == "" && !now.Before(item.ExpiresAt) {
+			expire(item, now)
+			events = append(events, PendingEvent{Type: PendingEventExpired, Decision: *item, At: now})
+			return nil
+		}
+		if item.Decision != "" {
+			return ErrPendingResolved
+		}
+		if err := checkDecision(item.Prompt, decision); err != nil {
+			return err
+		}
+		item.Decision = decision
+		item.ResolvedAt = now
+		events = append(events, PendingEvent{Type: PendingEventResolved, Decision: *item, At: now})
+		return nil
+	})
+	s.emit(events)
+	if err != nil {
+		return err
+	}
+	if len(events) > 0 && events[0].Type == PendingEventExpired {
+		return fmt.Errorf("%w: the prompt expired at %s", ErrPendingResolved, clock.Format(events[0].Decision.ExpiresAt))
+	}
+	return nil
+}
+
+// Expire rejects every unanswered prompt past its expiry and returns them.
+// Expiry is also applied whenever a prompt is taken or resolved, so
+// calling Expire is only needed to have the events recorded promptly.
+func (s *PendingDecisionStore) Expire() ([]PendingDecision, error) {
+	now := s.clock.Now()
+	var expired []PendingDecision
+	err := s.storage.UpdatePending(func(items map[string]*PendingDecision) error {
+		for _, item := range items {
+			if item.Decision == "" && !now.Before(item.ExpiresAt) {
+				expire(item, now)
+				expired = append(expired, *item)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to expire pending decisions: %w", err)
+	}
+	events := make([]PendingEvent, 0, len(expired))
+	for _, item := range expired {
+		events = append(events, PendingEvent{Type: PendingEventExpired, Decision: item, At: now})
+	}
+	s.emit(events)
+	return expired, nil
+}
+
+func (s *PendingDecisionStore) emit(events []PendingEvent) {
+	if s.onEvent == nil {
+		return
+	}
+	for _, event := range events {
+		s.onEvent(event)
+	}
+}
+
+// expire answers an unanswered item with the default reject.
+func expire(item *PendingDecision, now time.Time) {
+	item.Decision = UserDecisionReject
+	item.ResolvedAt = now
+	item.Expired = true
+}
+
+// checkDecision reports whether decision is an answer the prompt offers:
+// revoked keys can only be rejected, and namespace pins need a namespace.
+func checkDecision(prompt *PromptContext, decision UserDecision) error {
+	switch decision {
+	case UserDecisionReject, UserDecisionNeverTrust:
+		return nil
+	case UserDecisionAccept, UserDecisionAlwaysTrust, UserDecisionTemporaryAccept:
+	case UserDecisionAcceptNamespace:
+		if prompt.Namespace == "" {
+			return fmt.Errorf("tool %s is not under a namespace", prompt.ToolID)
+		}
+	default:
+		return fmt.Errorf("unknown decision %q", decision)
+	}
+	if prompt.PromptType == PromptTypeRevokedKey {
+		return fmt.Errorf("a revoked key can only be rejected")
+	}
+	return nil
+}
+
+// DecisionPendingError is returned by QueuedHandler.PromptUser while the
+// prompt waits for an answer. It matches schemaerr.ErrDecisionPending with
+// errors.Is.
+type DecisionPendingError struct {
+	Pending PendingDecision
+}
+
+func (e *DecisionPendingError) Error() string {
+	return fmt.Sprintf("%s decision for tool %s is pending (id %s)", e.Pending.Prompt.PromptType, e.Pending.Prompt.ToolID, e.Pending.ID)
+}
+
+// Is reports whether target is schemaerr.ErrDecisionPending.
+func (e *DecisionPendingError) Is(target error) bool {
+	return target == schemaerr.ErrDecisionPending
+}
+
+// QueuedHandler implements InteractiveHandler with a PendingDecisionStore:
+// PromptUser returns an answer given through the store, or queues the
+// prompt and fails with a *DecisionPendingError without waiting.
+type QueuedHandler struct {
+	store *PendingDecisionStore
+}
+
+// NewQueuedHandler creates a handler queuing its prompts in store.
+func NewQueuedHandler(store *PendingDecisionStore) *QueuedHandler {
+	return &QueuedHandler{store: store}
+}
+
+// Store returns the store the handler queues its prompts in.
+func (q *QueuedHandler) Store() *PendingDecisionStore {
+	return q.store
+}
+
+// PromptUser returns the answer to the prompt if one was given, and
+// otherwise fails with a *DecisionPendingError.
+func (q *QueuedHandler) PromptUser(context *PromptContext) (UserDecision, error) {
+	decision, pending, err := q.store.Take(context)
+	if err != nil {
+		return UserDecisionReject, err
+	}
+	if pending != nil {
+		return UserDecisionReject, &DecisionPendingError{Pending: *pending}
+	}
+	return decision, nil
+}
+
+// DisplayKeyInfo formats key information as the console handler does,
+// without the visual fingerprint.
+func (q *QueuedHandler) DisplayKeyInfo(keyInfo *KeyInfo) string {
+	return keyInfoText(keyInfo)
+}
+
+// DisplaySecurityWarning does nothing: warnings reach the user in the
+// queued prompt's SecurityWarning.
+func (q *QueuedHandler) DisplaySecurityWarning(warning string) {}
+
+// memoryPendingStorage is the PendingStorage of NewMemoryPendingStorage.
+type memoryPendingStorage struct {
+	mu    sync.Mutex
+	items map[string]*PendingDecision
+}
+
+// NewMemoryPendingStorage returns a PendingStorage kept in memory.
+func NewMemoryPendingStorage() PendingStorage {
+	return &memoryPendingStorage{items: make(map[string]*PendingDecision)}
+}
+
+func (m *memoryPendingStorage) ViewPending(fn func(items map[string]*PendingDecision) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return fn(m.copyItems())
+}
+
+func (m *memoryPendingStorage) UpdatePending(fn func(items map[string]*PendingDecision) error) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// fn works on a copy, so a failed update leaves the store unchanged
+	items := m.copyItems()
+	if err := fn(items); err != nil {
+		return err
+	}
+	m.items = items
+	return nil
+}
+
+func (m *memoryPendingStorage) copyItems() map[string]*PendingDecision {
+	items := make(map[string]*PendingDecision, len(m.items))
+	for id, item := range m.items {
+		copied := *item
+		items[id] = &copied
+	}
+	return items
+}
@@ -0,0 +1,161 @@
+package interactive
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+)
+
+func firstTimePrompt(toolID, fingerprint string) *PromptContext {
+	return &PromptContext{
+		PromptType: PromptTypeFirstTimeKey,
+		ToolID:     toolID,
+		Domain:     "example.com",
+		NewKey:     &KeyInfo{Fingerprint: fingerprint, Domain: "example.com"},
+	}
+}
+
+func TestQueuedHandlerResolve(t *testing.T) {
+	for _, decision := range []UserDecision{UserDecisionAccept, UserDecisionReject} {
+		t.Run(string(decision), func(t *testing.T) {
+			var events []PendingEventType
+			store := NewMemoryPendingStore(PendingStoreOptions{
+				OnEvent: func(e PendingEvent) { events = append(events, e.Type) },
+			})
+			handler := NewQueuedHandler(store)
+			prompt := firstTimePrompt("example.com/weather", "sha256:aa")
+
+			_, err := handler.PromptUser(prompt)
+			var pendingErr *DecisionPendingError
+			if !errors.As(err, &pendingErr) || !errors.Is(err, schemaerr.ErrDecisionPending) {
+				t.Fatalf("Expected a DecisionPendingError, got %v", err)
+			}
+			pending, err := store.ListPending()
+			if err != nil || len(pending) != 1 || pending[0].ID != pendingErr.Pending.ID {
+				t.Fatalf("Expected the prompt to be listed, got %+v, %v", pending, err)
+			}
+
+			if err := store.Resolve(pending[0].ID, decision); err != nil {
+				t.Fatalf("Resolve failed: %v", err)
+			}
+			if err := store.Resolve(pending[0].ID, decision); !errors.Is(err, ErrPendingResolved) {
+				t.Errorf("Expected a second answer to fail with ErrPendingResolved, got %v", err)
+			}
+			if pending, _ := store.ListPending(); len(pending) != 0 {
+				t.Errorf("Expected nothing pending after the answer, got %+v", pending)
+			}
+
+			got, err := handler.PromptUser(prompt)
+			if err != nil || got != decision {
+				t.Errorf("Expected the answer %s, got %s, %v", decision, got, err)
+			}
+			// The answer is consumed, so the next prompt queues again
+			if _, err := handler.PromptUser(prompt); !errors.Is(err, schemaerr.ErrDecisionPending) {
+				t.Errorf("Expected the answer to apply once, got %v", err)
+			}
+
+			want := []PendingEventType{PendingEventQueued, PendingEventResolved, PendingEventConsumed, PendingEventQueued}
+			if len(events) != len(want) {
+				t.Fatalf("Expected events %v, got %v", want, events)
+			}
+			for i := range want {
+				if events[i] != want[i] {
+					t.Errorf("Expected events %v, got %v", want, events)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestQueuedHandlerCollapsesDuplicates(t *testing.T) {
+	store := NewMemoryPendingStore(PendingStoreOptions{})
+	handler := NewQueuedHandler(store)
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		_, err := handler.PromptUser(firstTimePrompt("example.com/weather", "sha256:aa"))
+		var pendingErr *DecisionPendingError
+		if !errors.As(err, &pendingErr) {
+			t.Fatalf("Expected a DecisionPendingError, got %v", err)
+		}
+		ids = append(ids, pendingErr.Pending.ID)
+	}
+	if ids[0] != ids[1] || ids[1] != ids[2] {
+		t.Errorf("Expected duplicate prompts to share one ID, got %v", ids)
+	}
+
+	// Another key or tool is another decision
+	_, _ = handler.PromptUser(firstTimePrompt("example.com/weather", "sha256:bb"))
+	_, _ = handler.PromptUser(firstTimePrompt("example.com/search", "sha256:aa"))
+	if pending, _ := store.ListPending(); len(pending) != 3 {
+		t.Errorf("Expected 3 pending decisions, got %d", len(pending))
+	}
+}
+
+func TestPendingDecisionExpiry(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+	var expired []PendingDecision
+	store := NewMemoryPendingStore(PendingStoreOptions{
+		TTL:   10 * time.Minute,
+		Clock: fake,
+		OnEvent: func(e PendingEvent) {
+			if e.Type == PendingEventExpired {
+				expired = append(expired, e.Decision)
+			}
+		},
+	})
+	handler := NewQueuedHandler(store)
+	prompt := firstTimePrompt("example.com/weather", "sha256:aa")
+	if _, err := handler.PromptUser(prompt); !errors.Is(err, schemaerr.ErrDecisionPending) {
+		t.Fatalf("Expected the prompt to be queued, got %v", err)
+	}
+	pending, _ := store.ListPending()
+
+	fake.Advance(10 * time.Minute)
+	if pending, _ := store.ListPending(); len(pending) != 0 {
+		t.Errorf("Expected an expired prompt not to be listed, got %+v", pending)
+	}
+	got, err := store.Expire()
+	if err != nil || len(got) != 1 || got[0].Decision != UserDecisionReject || !got[0].Expired {
+		t.Fatalf("Expected one prompt expired as reject, got %+v, %v", got, err)
+	}
+	if len(expired) != 1 {
+		t.Errorf("Expected one expired event, got %d", len(expired))
+	}
+	if err := store.Resolve(pending[0].ID, UserDecisionAccept); !errors.Is(err, ErrPendingResolved) {
+		t.Errorf("Expected an expired prompt to refuse an answer, got %v", err)
+	}
+	if decision, err := handler.PromptUser(prompt); err != nil || decision != UserDecisionReject {
+		t.Errorf("Expected the expired prompt to reject, got %s, %v", decision, err)
+	}
+}
+
+func TestPendingDecisionResolveErrors(t *testing.T) {
+	store := NewMemoryPendingStore(PendingStoreOptions{})
+	if err := store.Resolve("missing", UserDecisionAccept); !errors.Is(err, ErrPendingNotFound) {
+		t.Errorf("Expected ErrPendingNotFound, got %v", err)
+	}
+
+	revoked := &PromptContext{
+		PromptType: PromptTypeRevokedKey,
+		ToolID:     "example.com/weather",
+		Domain:     "example.com",
+		CurrentKey: &KeyInfo{Fingerprint: "sha256:aa", IsRevoked: true},
+	}
+	_, pending, err := store.Take(revoked)
+	if err != nil || pending == nil {
+		t.Fatalf("Expected the prompt to be queued, got %+v, %v", pending, err)
+	}
+	for _, decision := range []UserDecision{UserDecisionAccept, UserDecisionAcceptNamespace, "maybe"} {
+		if err := store.Resolve(pending.ID, decision); err == nil {
+			t.Errorf("Expected %q to be refused for a revoked key", decision)
+		}
+	}
+	if err := store.Resolve(pending.ID, UserDecisionNeverTrust); err != nil {
+		t.Errorf("Expected never trust to be accepted, got %v", err)
+	}
+}
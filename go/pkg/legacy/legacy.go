@@ -0,0 +1,340 @@
+// Package legacy reads and verifies signed schemas written by early
+// SchemaPin releases, which the current verifiers reject, and migrates them
+// to the current format.
+//
+// Two legacy variants are supported, alone or together:
+//
+//   - The v0 envelope of releases before 1.1, which names the schema
+//     "signed_schema" and the signature "sig":
+//
+//     {"signed_schema": {...}, "sig": "<base64>", "signed_at": "...", "metadata": {...}}
+//
+//     signed_at and metadata are optional. The envelope has no
+//     schemapin_version or canonicalization field, so the schema is hashed
+//     under the legacy rules, schemapin-v1 canonicalization and SHA-256, as
+//     any unversioned document is.
+//
+//   - The v0 hash construction of Go releases before v1.4, which used the
+//     SHA-256 of the canonical schema itself as the ECDSA message instead
+//     of the SHA-256 of that hash (see
+//     crypto.SignatureManager.VerifyLegacySignature). It is found in both
+//     the v0 and the current envelope.
+//
+// Nothing else is treated as legacy. A document mixing the two envelopes'
+// field names, signed with anything but an ECDSA P-256 key, or hashed under
+// another canonicalization does not verify here either.
+//
+// Documents written by Migrate without a key, marked migrated_unsigned, are
+// read back as the legacy document they came from.
+package legacy
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+)
+
+// Envelope is the shape of a signed schema document.
+type Envelope string
+
+const (
+	// EnvelopeCurrent is the {"schema", "signature"} envelope of release 1.1
+	// onwards.
+	EnvelopeCurrent Envelope = "current"
+	// EnvelopeV0 is the {"signed_schema", "sig"} envelope of releases before
+	// 1.1.
+	EnvelopeV0 Envelope = "v0"
+)
+
+// HashConstruction is how the ECDSA message of a signature is derived from
+// the schema hash.
+type HashConstruction string
+
+const (
+	// HashCurrent signs the SHA-256 of the schema hash, as every current
+	// implementation does.
+	HashCurrent HashConstruction = "current"
+	// HashV0 signs the schema hash itself, as Go releases before v1.4 did.
+	HashV0 HashConstruction = "v0"
+)
+
+// ErrNotLegacy is returned by Migrate for a document that already verifies
+// under the current rules.
+var ErrNotLegacy = errors.New("document is already in the current format")
+
+// Document is a signed schema in either envelope.
+type Document struct {
+	Envelope  Envelope
+	Schema    map[string]interface{}
+	Signature string
+	SignedAt  string
+	Metadata  map[string]interface{}
+	// SchemapinVersion and Canonicalization are those of a current
+	// envelope; the v0 envelope has neither.
+	SchemapinVersion string
+	Canonicalization string
+	// Migrated is set for a migrated_unsigned document, whose Envelope and
+	// Signature are those of the legacy document it was migrated from.
+	Migrated bool
+}
+
+// v0Document is the JSON form of the v0 envelope.
+type v0Document struct {
+	SignedSchema map[string]interface{} `json:"signed_schema"`
+	Sig          string                 `json:"sig"`
+	SignedAt     string                 `json:"signed_at,omitempty"`
+	Metadata     map[string]interface{} `json:"metadata,omitempty"`
+}
+
+// Sniff reports the envelope of the signed schema document data: EnvelopeV0
+// if it has a signed_schema or sig field, EnvelopeCurrent if it has a schema
+// field, and "" otherwise or if data is not a JSON object.
+func Sniff(data []byte) Envelope {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return ""
+	}
+	_, signedSchema := fields["signed_schema"]
+	_, sig := fields["sig"]
+	_, schema := fields["schema"]
+	switch {
+	case signedSchema || sig:
+		return EnvelopeV0
+	case schema:
+		return EnvelopeCurrent
+	}
+	return ""
+}
+
+// Parse decodes a signed schema document in either envelope, or a
+// migrated_unsigned document written by Migrate.
+func Parse(data []byte) (*Document, error) {
+	switch Sniff(data) {
+	case EnvelopeV0:
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return nil, err
+		}
+		for _, name := range []string{"schema", "signature", "schemapin_version", "canonicalization"} {
+			if _, ok := fields[name]; ok {
+				return nil, fmt.Errorf("v0 envelope has a %s field of the current envelope", name)
+			}
+		}
+		var v0 v0Document
+		if err := json.Unmarshal(data, &v0); err != nil {
+			return nil, fmt.Errorf("invalid v0 envelope: %w", err)
+		}
+		if v0.SignedSchema == nil || v0.Sig == "" {
+			return nil, fmt.Errorf("v0 envelope is missing signed_schema or sig")
+		}
+		return &Document{
+			Envelope:  EnvelopeV0,
+			Schema:    v0.SignedSchema,
+			Signature: v0.Sig,
+			SignedAt:  v0.SignedAt,
+			Metadata:  v0.Metadata,
+		}, nil
+
+	case EnvelopeCurrent:
+		var migrated MigratedSchema
+		if err := json.Unmarshal(data, &migrated); err != nil {
+			return nil, fmt.Errorf("invalid signed schema: %w", err)
+		}
+		if migrated.Schema == nil {
+			return nil, fmt.Errorf("signed schema is missing schema")
+		}
+		doc := &Document{
+			Envelope:         EnvelopeCurrent,
+			Schema:           migrated.Schema,
+			Signature:        migrated.Signature,
+			SignedAt:         migrated.SignedAt,
+			Metadata:         migrated.Metadata,
+			SchemapinVersion: migrated.SchemapinVersion,
+			Canonicalization: migrated.Canonicalization,
+		}
+		if migrated.MigratedUnsigned {
+			evidence := migrated.LegacySignature
+			if evidence == nil || evidence.Signature == "" {
+				return nil, fmt.Errorf("migrated_unsigned document is missing its legacy_signature")
+			}
+			doc.Envelope, doc.Signature, doc.SignedAt, doc.Migrated = evidence.Envelope, evidence.Signature, evidence.SignedAt, true
+		}
+		if doc.Signature == "" {
+			return nil, fmt.Errorf("signed schema is missing signature")
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("not a signed schema document")
+}
+
+// Result is the outcome of verifying a Document.
+type Result struct {
+	Valid    bool
+	Envelope Envelope
+	// Hash is the construction the signature verified under, empty when
+	// it did not verify.
+	Hash       HashConstruction
+	SchemaHash []byte
+	// Migrated is set for a migrated_unsigned document.
+	Migrated bool
+}
+
+// Legacy reports whether the document verified only under legacy rules.
+func (r *Result) Legacy() bool {
+	return r.Valid && (r.Envelope != EnvelopeCurrent || r.Hash != HashCurrent)
+}
+
+// Warning describes the legacy variants a valid result used, for
+// verification warnings, or returns "" for a current document.
+func (r *Result) Warning() string {
+	if !r.Legacy() {
+		return ""
+	}
+	if r.Migrated {
+		return "migrated_unsigned document with a " + Describe(r.Envelope, r.Hash) + " signature"
+	}
+	return Describe(r.Envelope, r.Hash)
+}
+
+// Describe names a combination of envelope and hash construction, e.g.
+// "v0 envelope (signed_schema/sig), v0 hash construction (Go releases
+// before v1.4)".
+func Describe(envelope Envelope, hash HashConstruction) string {
+	var parts []string
+	if envelope == EnvelopeV0 {
+		parts = append(parts, "v0 envelope (signed_schema/sig)")
+	}
+	if hash == HashV0 {
+		parts = append(parts, "v0 hash construction (Go releases before v1.4)")
+	}
+	if len(parts) == 0 {
+		return "current format"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Verify verifies doc against publicKey under the rules of its envelope,
+// accepting either hash construction. The error is for a schema that cannot
+// be canonicalized; a signature that does not verify is an invalid result.
+func Verify(doc *Document, publicKey *ecdsa.PublicKey) (*Result, error) {
+	schemaHash, err := core.NewSchemaPinCore().CanonicalizeAndHashForSignature(doc.Schema, doc.SchemapinVersion, doc.Canonicalization)
+	if err != nil {
+		return nil, fmt.Errorf("failed to canonicalize schema: %w", err)
+	}
+	hash, valid := VerifySignature(schemaHash, doc.Signature, publicKey)
+	return &Result{Valid: valid, Envelope: doc.Envelope, Hash: hash, SchemaHash: schemaHash, Migrated: doc.Migrated}, nil
+}
+
+// VerifySignature verifies signatureB64 over schemaHash under the current
+// hash construction, then the v0 one, and returns the one that verified.
+func VerifySignature(schemaHash []byte, signatureB64 string, publicKey *ecdsa.PublicKey) (HashConstruction, bool) {
+	sigManager := crypto.NewSignatureManager()
+	switch {
+	case sigManager.VerifySignature(schemaHash, signatureB64, publicKey):
+		return HashCurrent, true
+	case sigManager.VerifyLegacySignature(schemaHash, signatureB64, publicKey):
+		return HashV0, true
+	}
+	return "", false
+}
+
+// MigratedSchema is a legacy document re-emitted in the current envelope.
+// Its fields are those of a signed schema, plus the evidence kept when no
+// key was at hand to re-sign it.
+type MigratedSchema struct {
+	SchemapinVersion string                 `json:"schemapin_version"`
+	Canonicalization string                 `json:"canonicalization"`
+	Schema           map[string]interface{} `json:"schema"`
+	Signature        string                 `json:"signature,omitempty"`
+	SignedAt         string                 `json:"signed_at,omitempty"`
+	Metadata         map[string]interface{} `json:"metadata,omitempty"`
+	// MigratedUnsigned marks a document that carries no current signature,
+	// only the LegacySignature it was verified with.
+	MigratedUnsigned bool      `json:"migrated_unsigned,omitempty"`
+	LegacySignature  *Evidence `json:"legacy_signature,omitempty"`
+}
+
+// Evidence is the legacy signature a migrated_unsigned document was
+// verified with before migration, which still verifies under the legacy
+// rules it names.
+type Evidence struct {
+	Envelope         Envelope         `json:"envelope"`
+	HashConstruction HashConstruction `json:"hash_construction"`
+	Signature        string           `json:"signature"`
+	SignedAt         string           `json:"signed_at,omitempty"`
+	// KeyFingerprint is the fingerprint of the key the signature verified
+	// with.
+	KeyFingerprint string `json:"key_fingerprint"`
+	// MigratedAt is when the document was migrated.
+	MigratedAt string `json:"migrated_at"`
+}
+
+// Migrate verifies doc against publicKey and re-emits it in the current
+// format. With a privateKey the schema is re-signed under the current
+// version and canonicalization at now. Without one the document is marked
+// migrated_unsigned and keeps the verified legacy signature as evidence.
+//
+// A signature that does not verify is a schemaerr.ErrSignatureInvalid
+// error; a document that needs no migration is ErrNotLegacy.
+func Migrate(doc *Document, publicKey *ecdsa.PublicKey, privateKey *ecdsa.PrivateKey, now time.Time) (*MigratedSchema, error) {
+	result, err := Verify(doc, publicKey)
+	if err != nil {
+		return nil, err
+	}
+	if !result.Valid {
+		return nil, &schemaerr.Error{Kind: schemaerr.ErrSignatureInvalid, Message: "legacy signature does not verify with the given public key"}
+	}
+	if !result.Legacy() {
+		return nil, ErrNotLegacy
+	}
+
+	migrated := &MigratedSchema{
+		SchemapinVersion: core.CurrentSchemapinVersion,
+		Canonicalization: core.DefaultCanonicalization,
+		Schema:           doc.Schema,
+		Metadata:         doc.Metadata,
+	}
+	if privateKey != nil {
+		schemaHash, err := core.NewSchemaPinCore().CanonicalizeAndHashForSignature(doc.Schema, migrated.SchemapinVersion, migrated.Canonicalization)
+		if err != nil {
+			return nil, fmt.Errorf("failed to canonicalize schema: %w", err)
+		}
+		signature, err := crypto.NewSignatureManager().SignSchemaHash(schemaHash, privateKey)
+		if err != nil {
+			return nil, err
+		}
+		migrated.Signature, migrated.SignedAt = signature, clock.Format(now)
+		return migrated, nil
+	}
+
+	// The schema hash is unchanged, since every version so far hashes
+	// under the legacy rules
+	current, err := core.NewSchemaPinCore().CanonicalizeAndHashForSignature(doc.Schema, migrated.SchemapinVersion, migrated.Canonicalization)
+	if err != nil || !bytes.Equal(current, result.SchemaHash) {
+		return nil, fmt.Errorf("schema hashes differently under schemapin_version %s; re-sign it with a key", migrated.SchemapinVersion)
+	}
+	fingerprint, err := crypto.NewKeyManager().CalculateKeyFingerprint(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	migrated.SignedAt = doc.SignedAt
+	migrated.MigratedUnsigned = true
+	migrated.LegacySignature = &Evidence{
+		Envelope:         doc.Envelope,
+		HashConstruction: result.Hash,
+		Signature:        doc.Signature,
+		SignedAt:         doc.SignedAt,
+		KeyFingerprint:   fingerprint,
+		MigratedAt:       clock.Format(now),
+	}
+	return migrated, nil
+}
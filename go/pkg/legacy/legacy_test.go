@@ -0,0 +1,239 @@
+package legacy
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+)
+
+// The fixtures in testdata are signed with the key in public.pem, one per
+// supported legacy variant.
+var fixtures = []struct {
+	file     string
+	envelope Envelope
+	hash     HashConstruction
+}{
+	{"v0_envelope.json", EnvelopeV0, HashCurrent},
+	{"v0_envelope_v0_hash.json", EnvelopeV0, HashV0},
+	{"v0_hash.json", EnvelopeCurrent, HashV0},
+}
+
+func loadFixture(t *testing.T, name string) *Document {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := Parse(data)
+	if err != nil {
+		t.Fatalf("Parse(%s) failed: %v", name, err)
+	}
+	return doc
+}
+
+func fixtureKey(t *testing.T) *ecdsa.PublicKey {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "public.pem"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := crypto.NewKeyManager().LoadPublicKeyPEM(string(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return publicKey
+}
+
+func TestVerifyLegacyFixtures(t *testing.T) {
+	publicKey := fixtureKey(t)
+	otherKey, _ := crypto.NewKeyManager().GenerateKeypair()
+
+	for _, fx := range fixtures {
+		t.Run(fx.file, func(t *testing.T) {
+			doc := loadFixture(t, fx.file)
+			if doc.Envelope != fx.envelope {
+				t.Errorf("Expected envelope %s, got %s", fx.envelope, doc.Envelope)
+			}
+
+			result, err := Verify(doc, publicKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !result.Valid || result.Hash != fx.hash || !result.Legacy() {
+				t.Fatalf("Expected a valid legacy result with hash construction %s, got %+v", fx.hash, result)
+			}
+			if result.Warning() == "" {
+				t.Error("Expected a warning for a legacy signature")
+			}
+
+			// The current hash construction accepts only the fixtures that
+			// differ in their envelope alone
+			current := crypto.NewSignatureManager().VerifySchemaSignature(result.SchemaHash, doc.Signature, publicKey)
+			if current != (fx.hash == HashCurrent) {
+				t.Errorf("Expected the current hash construction to verify: %v, got %v", fx.hash == HashCurrent, current)
+			}
+
+			// Another key, or a changed schema, does not verify
+			if result, _ := Verify(doc, &otherKey.PublicKey); result.Valid {
+				t.Error("Expected the fixture not to verify with another key")
+			}
+			doc.Schema["description"] = "changed"
+			if result, _ := Verify(doc, publicKey); result.Valid {
+				t.Error("Expected a changed schema not to verify")
+			}
+		})
+	}
+}
+
+func TestSniff(t *testing.T) {
+	tests := []struct {
+		data string
+		want Envelope
+	}{
+		{`{"signed_schema": {}, "sig": "x"}`, EnvelopeV0},
+		{`{"sig": "x"}`, EnvelopeV0},
+		{`{"schema": {}, "signature": "x"}`, EnvelopeCurrent},
+		{`{"type": "object"}`, ""},
+		{`[1]`, ""},
+		{`not json`, ""},
+	}
+	for _, tt := range tests {
+		if got := Sniff([]byte(tt.data)); got != tt.want {
+			t.Errorf("Sniff(%s) = %q, want %q", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestParseRejectsMixedAndIncompleteEnvelopes(t *testing.T) {
+	for _, data := range []string{
+		`{"signed_schema": {"type": "object"}, "sig": "x", "signature": "y"}`,
+		`{"signed_schema": {"type": "object"}, "schema": {}, "sig": "x"}`,
+		`{"signed_schema": {"type": "object"}, "sig": "x", "schemapin_version": "1.4"}`,
+		`{"signed_schema": {"type": "object"}}`,
+		`{"sig": "x"}`,
+		`{"schema": {"type": "object"}}`,
+		`{"schema": {"type": "object"}, "migrated_unsigned": true}`,
+		`{"type": "object"}`,
+	} {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("Expected Parse(%s) to fail", data)
+		}
+	}
+}
+
+func TestMigrateWithKey(t *testing.T) {
+	publicKey := fixtureKey(t)
+	newKey, err := crypto.NewKeyManager().GenerateKeypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+
+	for _, fx := range fixtures {
+		t.Run(fx.file, func(t *testing.T) {
+			doc := loadFixture(t, fx.file)
+			migrated, err := Migrate(doc, publicKey, newKey, now)
+			if err != nil {
+				t.Fatalf("Migrate failed: %v", err)
+			}
+			if migrated.MigratedUnsigned || migrated.LegacySignature != nil {
+				t.Error("Expected a re-signed document without legacy evidence")
+			}
+			if migrated.SchemapinVersion != core.CurrentSchemapinVersion || migrated.SignedAt != "2026-10-16T12:00:00Z" {
+				t.Errorf("Expected version %s signed at now, got %s at %s", core.CurrentSchemapinVersion, migrated.SchemapinVersion, migrated.SignedAt)
+			}
+
+			// The output verifies under the current rules with the new key
+			data, err := json.Marshal(migrated)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reread, err := Parse(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			schemaHash, err := core.NewSchemaPinCore().CanonicalizeAndHashForSignature(reread.Schema, reread.SchemapinVersion, reread.Canonicalization)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !crypto.NewSignatureManager().VerifySchemaSignature(schemaHash, reread.Signature, &newKey.PublicKey) {
+				t.Error("Expected the migrated signature to verify under the current rules")
+			}
+		})
+	}
+}
+
+func TestMigrateWithoutKey(t *testing.T) {
+	publicKey := fixtureKey(t)
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	fingerprint, _ := crypto.NewKeyManager().CalculateKeyFingerprint(publicKey)
+
+	for _, fx := range fixtures {
+		t.Run(fx.file, func(t *testing.T) {
+			doc := loadFixture(t, fx.file)
+			migrated, err := Migrate(doc, publicKey, nil, now)
+			if err != nil {
+				t.Fatalf("Migrate failed: %v", err)
+			}
+			if !migrated.MigratedUnsigned || migrated.Signature != "" {
+				t.Fatal("Expected an unsigned document marked migrated_unsigned")
+			}
+			evidence := migrated.LegacySignature
+			want := Evidence{
+				Envelope:         fx.envelope,
+				HashConstruction: fx.hash,
+				Signature:        doc.Signature,
+				SignedAt:         doc.SignedAt,
+				KeyFingerprint:   fingerprint,
+				MigratedAt:       "2026-10-16T12:00:00Z",
+			}
+			if evidence == nil || *evidence != want {
+				t.Fatalf("Expected evidence %+v, got %+v", want, evidence)
+			}
+
+			// The evidence still verifies once read back, and again migrates
+			data, err := json.Marshal(migrated)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reread, err := Parse(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := Verify(reread, publicKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !result.Valid || !result.Migrated || result.Hash != fx.hash || result.Envelope != fx.envelope {
+				t.Errorf("Expected the evidence to verify as %s/%s, got %+v", fx.envelope, fx.hash, result)
+			}
+			if _, err := Migrate(reread, publicKey, nil, now); err != nil {
+				t.Errorf("Expected a migrated_unsigned document to migrate again: %v", err)
+			}
+		})
+	}
+}
+
+func TestMigrateRefusesInvalidAndCurrentDocuments(t *testing.T) {
+	keyManager := crypto.NewKeyManager()
+	otherKey, _ := keyManager.GenerateKeypair()
+	if _, err := Migrate(loadFixture(t, "v0_envelope.json"), &otherKey.PublicKey, nil, time.Now()); !errors.Is(err, schemaerr.ErrSignatureInvalid) {
+		t.Errorf("Expected ErrSignatureInvalid for another key, got %v", err)
+	}
+
+	schema := map[string]interface{}{"name": "current_tool"}
+	schemaHash, _ := core.NewSchemaPinCore().CanonicalizeAndHashForSignature(schema, core.CurrentSchemapinVersion, "")
+	signature, _ := crypto.NewSignatureManager().SignSchemaHash(schemaHash, otherKey)
+	current := &Document{Envelope: EnvelopeCurrent, Schema: schema, Signature: signature, SchemapinVersion: core.CurrentSchemapinVersion}
+	if _, err := Migrate(current, &otherKey.PublicKey, nil, time.Now()); !errors.Is(err, ErrNotLegacy) {
+		t.Errorf("Expected ErrNotLegacy for a current document, got %v", err)
+	}
+}
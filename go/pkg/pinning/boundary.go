@@ -0,0 +1,213 @@
+package pinning
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+)
+
+// TrustBoundary is a centrally managed allow/deny list of domains. It is
+// enforced before discovery, before an existing pin is honored and before
+// any interactive prompt, so neither the pinning database nor a user's
+// answer can widen it.
+//
+// Patterns are either an exact domain ("tools.example.com") or a wildcard
+// subdomain ("*.corp.example.com", which matches a.corp.example.com and
+// a.b.corp.example.com but not corp.example.com itself). Matching ignores
+// case, a URL scheme, a port and a trailing dot. A pattern without a path
+// covers every tenant prefix on its hosts; an exact domain with a path
+// prefix ("platform.example/tenants/acme") matches only that prefix and
+// the prefixes below it, case-sensitively (see core.NormalizeDomain).
+//
+// TLSPins optionally pins the TLS certificates of discovery hosts, in the
+// format of discovery.WithTLSPins.
+//
+// Example (YAML):
+//
+//	allow:
+//	  - tools.example.com
+//	  - "*.corp.example.com"
+//	deny:
+//	  - legacy.corp.example.com
+//	tls_pins:
+//	  tools.example.com:
+//	    - "base64 SPKI SHA-256"
+type TrustBoundary struct {
+	Allow   []string            `json:"allow,omitempty" yaml:"allow,omitempty"`
+	Deny    []string            `json:"deny,omitempty" yaml:"deny,omitempty"`
+	TLSPins map[string][]string `json:"tls_pins,omitempty" yaml:"tls_pins,omitempty"`
+}
+
+// DomainBlockedError reports a domain outside the trust boundary.
+type DomainBlockedError struct {
+	Domain string
+	// Pattern is the deny pattern that matched, or empty when the domain
+	// was blocked for not matching the allowlist.
+	Pattern string
+}
+
+func (e *DomainBlockedError) Error() string {
+	if e.Pattern != "" {
+		return fmt.Sprintf("domain %s is blocked by trust boundary pattern %q", e.Domain, e.Pattern)
+	}
+	return fmt.Sprintf("domain %s is not in the trust boundary allowlist", e.Domain)
+}
+
+// Is matches schemaerr.ErrDomainBlocked.
+func (e *DomainBlockedError) Is(target error) bool {
+	return target == schemaerr.ErrDomainBlocked
+}
+
+// BoundaryViolation is an existing pin whose domain the trust boundary
+// now blocks.
+type BoundaryViolation struct {
+	ToolID string `json:"tool_id"`
+	Domain string `json:"domain"`
+	Reason string `json:"reason"`
+}
+
+// NewTrustBoundary validates allow and deny patterns and returns the
+// boundary.
+func NewTrustBoundary(allow, deny []string) (*TrustBoundary, error) {
+	b := &TrustBoundary{Allow: allow, Deny: deny}
+	if err := b.Validate(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// LoadTrustBoundaryFile reads and validates a trust boundary. Files ending
+// in .yaml or .yml are parsed as YAML; anything else as JSON.
+func LoadTrustBoundaryFile(path string) (*TrustBoundary, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- path is supplied by the operator
+	if err != nil {
+		return nil, fmt.Errorf("failed to read trust boundary file: %w", err)
+	}
+
+	var b TrustBoundary
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &b)
+	default:
+		err = json.Unmarshal(data, &b)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse trust boundary file: %w", err)
+	}
+
+	if err := b.Validate(); err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// Validate checks that every pattern is an exact domain or a "*." wildcard
+// and that every TLS pin is well formed.
+func (b *TrustBoundary) Validate() error {
+	for _, list := range []struct {
+		name     string
+		patterns []string
+	}{{"allow", b.Allow}, {"deny", b.Deny}} {
+		for i, pattern := range list.patterns {
+			name, wildcard := strings.CutPrefix(normalizeBoundaryDomain(pattern), "*.")
+			if name == "" || strings.ContainsAny(name, "* ") || (wildcard && strings.Contains(name, "/")) {
+				return fmt.Errorf("invalid trust boundary %s[%d] pattern %q", list.name, i, pattern)
+			}
+		}
+	}
+	for host, pins := range b.TLSPins {
+		if name := normalizeBoundaryDomain(host); name == "" || strings.ContainsAny(name, "*/ ") {
+			return fmt.Errorf("invalid trust boundary tls_pins host %q", host)
+		}
+		if len(pins) == 0 {
+			return fmt.Errorf("trust boundary tls_pins for %s is empty", host)
+		}
+		for _, pin := range pins {
+			if err := discovery.ValidateTLSPin(pin); err != nil {
+				return fmt.Errorf("trust boundary tls_pins for %s: %w", host, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Check returns a *DomainBlockedError if domain is denied, or if an
+// allowlist is configured and domain does not match it. Deny patterns take
+// precedence over allow patterns. A nil boundary allows every domain.
+func (b *TrustBoundary) Check(domain string) error {
+	if b == nil {
+		return nil
+	}
+	identity := normalizeBoundaryDomain(domain)
+	for _, pattern := range b.Deny {
+		if matchBoundaryPattern(pattern, identity) {
+			return &DomainBlockedError{Domain: domain, Pattern: pattern}
+		}
+	}
+	if len(b.Allow) == 0 {
+		return nil
+	}
+	for _, pattern := range b.Allow {
+		if matchBoundaryPattern(pattern, identity) {
+			return nil
+		}
+	}
+	return &DomainBlockedError{Domain: domain}
+}
+
+// PinViolations lists the pins in k whose domains the boundary blocks. The
+// pins are reported, not removed.
+func (b *TrustBoundary) PinViolations(k *KeyPinning) ([]BoundaryViolation, error) {
+	if b == nil {
+		return nil, nil
+	}
+	keys, err := k.ListPinnedKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	var violations []BoundaryViolation
+	for _, key := range keys {
+		toolID, _ := key["tool_id"].(string)
+		domain, _ := key["domain"].(string)
+		if err := b.Check(domain); err != nil {
+			violations = append(violations, BoundaryViolation{ToolID: toolID, Domain: domain, Reason: err.Error()})
+		}
+	}
+	return violations, nil
+}
+
+// normalizeBoundaryDomain reduces a domain, URL or pattern to its identity
+// per core.NormalizeDomain: a lower-case host name without scheme, port or
+// trailing dot, followed by any path prefix. It returns "" for a domain
+// core.NormalizeDomain rejects.
+func normalizeBoundaryDomain(domain string) string {
+	identity, err := core.NormalizeDomain(domain)
+	if err != nil {
+		return ""
+	}
+	return identity
+}
+
+func matchBoundaryPattern(pattern, identity string) bool {
+	pattern = normalizeBoundaryDomain(pattern)
+	if pattern == "" || identity == "" {
+		return false
+	}
+	host, _, _ := strings.Cut(identity, "/")
+	if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+		return strings.HasSuffix(host, "."+suffix)
+	}
+	if !strings.Contains(pattern, "/") {
+		return host == pattern
+	}
+	return identity == pattern || strings.HasPrefix(identity, pattern+"/")
+}
@@ -0,0 +1,235 @@
+package pinning
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/interactive"
+)
+
+func TestTrustBoundaryCheck(t *testing.T) {
+	boundary, err := NewTrustBoundary(
+		[]string{"tools.example.com", "*.corp.example.com"},
+		[]string{"legacy.corp.example.com", "*.sandbox.corp.example.com"},
+	)
+	if err != nil {
+		t.Fatalf("NewTrustBoundary failed: %v", err)
+	}
+
+	tests := []struct {
+		domain  string
+		allowed bool
+		pattern string // deny pattern expected to match, if any
+	}{
+		{"tools.example.com", true, ""},
+		{"TOOLS.example.com.", true, ""},
+		{"https://tools.example.com:8443/path", true, ""},
+		{"api.corp.example.com", true, ""},
+		{"a.b.corp.example.com", true, ""},
+		{"corp.example.com", false, ""},
+		{"evilcorp.example.com", false, ""},
+		{"other.example.com", false, ""},
+		// Deny beats allow
+		{"legacy.corp.example.com", false, "legacy.corp.example.com"},
+		{"x.sandbox.corp.example.com", false, "*.sandbox.corp.example.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.domain, func(t *testing.T) {
+			err := boundary.Check(tt.domain)
+			if (err == nil) != tt.allowed {
+				t.Fatalf("Expected allowed=%v, got %v", tt.allowed, err)
+			}
+			if err == nil {
+				return
+			}
+			var blocked *DomainBlockedError
+			if !errors.As(err, &blocked) {
+				t.Fatalf("Expected *DomainBlockedError, got %T", err)
+			}
+			if blocked.Pattern != tt.pattern {
+				t.Errorf("Expected pattern %q, got %q", tt.pattern, blocked.Pattern)
+			}
+		})
+	}
+}
+
+func TestTrustBoundaryDenyOnly(t *testing.T) {
+	boundary, err := NewTrustBoundary(nil, []string{"*.example.net"})
+	if err != nil {
+		t.Fatalf("NewTrustBoundary failed: %v", err)
+	}
+	if err := boundary.Check("anything.example.org"); err != nil {
+		t.Errorf("Expected domains outside the denylist to be allowed without an allowlist, got %v", err)
+	}
+	if err := boundary.Check("tools.example.net"); err == nil {
+		t.Error("Expected denied wildcard domain to be blocked")
+	}
+
+	var none *TrustBoundary
+	if err := none.Check("tools.example.net"); err != nil {
+		t.Errorf("Expected nil boundary to allow every domain, got %v", err)
+	}
+}
+
+func TestTrustBoundaryPathPrefixes(t *testing.T) {
+	boundary, err := NewTrustBoundary(
+		[]string{"platform.example/tenants/acme", "tools.example.com"},
+		[]string{"tools.example.com/sandbox"},
+	)
+	if err != nil {
+		t.Fatalf("NewTrustBoundary failed: %v", err)
+	}
+	for _, tt := range []struct {
+		domain  string
+		allowed bool
+	}{
+		{"platform.example/tenants/acme", true},
+		{"https://Platform.Example/tenants/acme/", true},
+		{"platform.example/tenants/acme/eu", true},
+		{"platform.example/tenants/acme-evil", false},
+		{"platform.example/tenants/Acme", false},
+		{"platform.example/tenants/globex", false},
+		{"platform.example", false},
+		// A host pattern covers every prefix on the host but one denied
+		{"tools.example.com/team-a", true},
+		{"tools.example.com/sandbox/x", false},
+		{"tools.example.com/tenants/../sandbox", false},
+	} {
+		if err := boundary.Check(tt.domain); (err == nil) != tt.allowed {
+			t.Errorf("Check(%q): expected allowed=%v, got %v", tt.domain, tt.allowed, err)
+		}
+	}
+}
+
+func TestTrustBoundaryInvalidPatterns(t *testing.T) {
+	for _, pattern := range []string{"", "*", "*.", "a.*.example.com", "exa mple.com", "*.example.com/tenants", "platform.example/../acme", "platform.example/acme?x=1"} {
+		if _, err := NewTrustBoundary([]string{pattern}, nil); err == nil {
+			t.Errorf("Expected pattern %q to be rejected", pattern)
+		}
+	}
+}
+
+func TestLoadTrustBoundaryFile(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"boundary.json": `{"allow": ["*.corp.example.com"], "deny": ["legacy.corp.example.com"]}`,
+		"boundary.yaml": "allow:\n  - \"*.corp.example.com\"\ndeny:\n  - legacy.corp.example.com\n",
+	}
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+				t.Fatalf("Failed to write boundary file: %v", err)
+			}
+			boundary, err := LoadTrustBoundaryFile(path)
+			if err != nil {
+				t.Fatalf("LoadTrustBoundaryFile failed: %v", err)
+			}
+			if err := boundary.Check("api.corp.example.com"); err != nil {
+				t.Errorf("Expected allowlisted domain to pass, got %v", err)
+			}
+			if err := boundary.Check("legacy.corp.example.com"); err == nil {
+				t.Error("Expected denied domain to be blocked")
+			}
+		})
+	}
+}
+
+func TestLoadTrustBoundaryFileTLSPins(t *testing.T) {
+	const pin = "47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="
+	path := filepath.Join(t.TempDir(), "boundary.yaml")
+	content := "tls_pins:\n  tools.criticalvendor.com:\n    - \"" + pin + "\"\n"
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write boundary file: %v", err)
+	}
+	boundary, err := LoadTrustBoundaryFile(path)
+	if err != nil {
+		t.Fatalf("LoadTrustBoundaryFile failed: %v", err)
+	}
+	if pins := boundary.TLSPins["tools.criticalvendor.com"]; len(pins) != 1 || pins[0] != pin {
+		t.Errorf("Expected the configured pin, got %v", boundary.TLSPins)
+	}
+	if err := boundary.Check("other.example.com"); err != nil {
+		t.Errorf("Expected pins alone not to restrict domains, got %v", err)
+	}
+
+	for _, pins := range []map[string][]string{
+		{"tools.criticalvendor.com": {"not-a-pin"}},
+		{"tools.criticalvendor.com": {}},
+		{"*.criticalvendor.com": {pin}},
+	} {
+		if err := (&TrustBoundary{TLSPins: pins}).Validate(); err == nil {
+			t.Errorf("Expected TLS pins %v to be rejected", pins)
+		}
+	}
+}
+
+func TestTrustBoundaryOverridesPinsAndPrompts(t *testing.T) {
+	publicKeyPEM, _ := generateTestKeyPEM(t)
+	dbPath := createTempDB(t)
+
+	// Pin keys before the boundary is configured
+	k, err := NewKeyPinning(dbPath, PinningModeInteractive, nil)
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	if err := k.PinKey("allowed-tool", publicKeyPEM, "tools.example.com", "Example"); err != nil {
+		t.Fatalf("Failed to pin key: %v", err)
+	}
+	if err := k.PinKey("blocked-tool", publicKeyPEM, "legacy.example.com", "Legacy"); err != nil {
+		t.Fatalf("Failed to pin key: %v", err)
+	}
+	if err := k.SetDomainPolicy("legacy.example.com", PinningPolicyAlwaysTrust); err != nil {
+		t.Fatalf("Failed to set domain policy: %v", err)
+	}
+	k.Close()
+
+	boundary, err := NewTrustBoundary([]string{"tools.example.com", "legacy.example.com"}, []string{"legacy.example.com"})
+	if err != nil {
+		t.Fatalf("NewTrustBoundary failed: %v", err)
+	}
+	handler := &mockInteractiveHandler{decision: interactive.UserDecisionAccept}
+	k, err = NewKeyPinning(dbPath, PinningModeInteractive, handler, WithTrustBoundary(boundary))
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	defer k.Close()
+
+	t.Run("pinned but now blocked", func(t *testing.T) {
+		decision, err := k.InteractivePinKeyWithDecision("blocked-tool", publicKeyPEM, "legacy.example.com", "Legacy")
+		var blocked *DomainBlockedError
+		if !errors.As(err, &blocked) {
+			t.Fatalf("Expected *DomainBlockedError, got %v", err)
+		}
+		if decision.Accepted {
+			t.Error("Expected a pinned key on a blocked domain to be rejected")
+		}
+	})
+
+	t.Run("first use on blocked domain", func(t *testing.T) {
+		decision, err := k.InteractivePinKeyWithDecision("new-tool", publicKeyPEM, "other.example.com", "Other")
+		if err == nil || decision.Accepted {
+			t.Fatalf("Expected non-allowlisted domain to be rejected, got %+v, %v", decision, err)
+		}
+		if k.IsKeyPinned("new-tool") {
+			t.Error("Expected no pin for a blocked domain")
+		}
+	})
+
+	if handler.prompts != 0 {
+		t.Errorf("Expected no prompts for blocked domains, got %d", handler.prompts)
+	}
+
+	violations, err := k.CheckBoundaryViolations()
+	if err != nil {
+		t.Fatalf("CheckBoundaryViolations failed: %v", err)
+	}
+	if len(violations) != 1 || violations[0].ToolID != "blocked-tool" || violations[0].Domain != "legacy.example.com" {
+		t.Errorf("Expected one violation for blocked-tool, got %+v", violations)
+	}
+	if !k.IsKeyPinned("blocked-tool") {
+		t.Error("Expected the violating pin to be kept")
+	}
+}
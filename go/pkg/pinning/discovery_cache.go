@@ -0,0 +1,64 @@
+package pinning
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"go.etcd.io/bbolt"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+)
+
+// KeyPinning implements discovery.DocumentCache, keeping the last
+// .well-known document fetched for each domain in the pinning database.
+var (
+	_ discovery.DocumentCache  = (*KeyPinning)(nil)
+	_ discovery.DocumentLister = (*KeyPinning)(nil)
+)
+
+// LoadDiscoveryDocument returns the .well-known document cached for
+// domain, or nil if none is cached.
+func (k *KeyPinning) LoadDiscoveryDocument(domain string) (*discovery.CachedDocument, error) {
+	var cached *discovery.CachedDocument
+	err := k.db.View(func(tx *bbolt.Tx) error {
+		data, err := k.sealed(tx, discoveryCacheBucket).get([]byte(domain))
+		if err != nil || data == nil {
+			return err
+		}
+		cached = &discovery.CachedDocument{}
+		if err := json.Unmarshal(data, cached); err != nil {
+			return fmt.Errorf("failed to unmarshal cached discovery document: %w", err)
+		}
+		return nil
+	})
+	return cached, err
+}
+
+// StoreDiscoveryDocument replaces the .well-known document cached for
+// doc.Domain.
+func (k *KeyPinning) StoreDiscoveryDocument(doc discovery.CachedDocument) error {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("failed to marshal discovery document: %w", err)
+	}
+	return k.update(func(tx *bbolt.Tx) error {
+		return k.sealed(tx, discoveryCacheBucket).put([]byte(doc.Domain), data)
+	})
+}
+
+// ListDiscoveryDocuments returns every cached .well-known document,
+// ordered by domain.
+func (k *KeyPinning) ListDiscoveryDocuments() ([]discovery.CachedDocument, error) {
+	var cached []discovery.CachedDocument
+	err := k.db.View(func(tx *bbolt.Tx) error {
+		return k.sealed(tx, discoveryCacheBucket).forEach(func(domain, v []byte) error {
+			var doc discovery.CachedDocument
+			if err := json.Unmarshal(v, &doc); err != nil {
+				return fmt.Errorf("failed to unmarshal cached discovery document for %s: %w", domain, err)
+			}
+			cached = append(cached, doc)
+			return nil
+		})
+	})
+	return cached, err
+}
@@ -0,0 +1,131 @@
+package pinning
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.etcd.io/bbolt"
+
+	"github.com/ThirdKeyAi/schemapin/go/internal/logging"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+)
+
+// DiscoveryVersion is the highest .well-known schema_version seen for a
+// domain.
+type DiscoveryVersion struct {
+	Domain        string    `json:"domain"`
+	SchemaVersion string    `json:"schema_version"`
+	SeenAt        time.Time `json:"seen_at"`
+}
+
+// DiscoveryDowngradeError reports a domain serving a lower .well-known
+// schema_version than one previously seen for it. A downgrade can strip
+// fields newer versions carry, such as revoked_keys or
+// revocation_endpoint, so callers should at least warn about it.
+type DiscoveryDowngradeError struct {
+	Domain   string
+	Recorded string
+	Served   string
+}
+
+func (e *DiscoveryDowngradeError) Error() string {
+	return fmt.Sprintf("domain %s served discovery schema version %s, previously %s", e.Domain, e.Served, e.Recorded)
+}
+
+// Is matches schemaerr.ErrDiscoveryDowngrade.
+func (e *DiscoveryDowngradeError) Is(target error) bool {
+	return target == schemaerr.ErrDiscoveryDowngrade
+}
+
+// GetDiscoveryVersion returns the recorded discovery version for domain,
+// or nil if none has been recorded.
+func (k *KeyPinning) GetDiscoveryVersion(domain string) (*DiscoveryVersion, error) {
+	var version *DiscoveryVersion
+	err := k.db.View(func(tx *bbolt.Tx) error {
+		data, err := k.sealed(tx, discoveryVersionsBucket).get([]byte(domain))
+		if err != nil || data == nil {
+			return err
+		}
+		version = &DiscoveryVersion{}
+		if err := json.Unmarshal(data, version); err != nil {
+			return fmt.Errorf("failed to unmarshal discovery version: %w", err)
+		}
+		return nil
+	})
+	return version, err
+}
+
+// ListDiscoveryVersions returns every recorded discovery version, ordered
+// by domain.
+func (k *KeyPinning) ListDiscoveryVersions() ([]DiscoveryVersion, error) {
+	var versions []DiscoveryVersion
+	err := k.db.View(func(tx *bbolt.Tx) error {
+		return k.sealed(tx, discoveryVersionsBucket).forEach(func(domain, v []byte) error {
+			var version DiscoveryVersion
+			if err := json.Unmarshal(v, &version); err != nil {
+				return fmt.Errorf("corrupt discovery version for %s: %w", domain, err)
+			}
+			versions = append(versions, version)
+			return nil
+		})
+	})
+	return versions, err
+}
+
+// CheckDiscoveryVersion is RecordDiscoveryVersion without recording: it
+// returns a *DiscoveryDowngradeError if served is lower than the version
+// recorded for domain.
+func (k *KeyPinning) CheckDiscoveryVersion(domain, served string) error {
+	if served == "" {
+		return nil
+	}
+	recorded, err := k.GetDiscoveryVersion(domain)
+	if err != nil || recorded == nil {
+		return err
+	}
+	if discovery.CompareSchemaVersions(served, recorded.SchemaVersion) < 0 {
+		return &DiscoveryDowngradeError{Domain: domain, Recorded: recorded.SchemaVersion, Served: served}
+	}
+	return nil
+}
+
+// RecordDiscoveryVersion compares served against the version recorded for
+// domain. If served is lower it returns a *DiscoveryDowngradeError and
+// keeps the recorded version, so every later downgraded response is
+// reported too; otherwise it records served. An empty served version is
+// ignored.
+func (k *KeyPinning) RecordDiscoveryVersion(domain, served string) error {
+	if served == "" {
+		return nil
+	}
+	return k.update(func(tx *bbolt.Tx) error {
+		bucket := k.sealed(tx, discoveryVersionsBucket)
+		if data, err := bucket.get([]byte(domain)); err != nil {
+			return err
+		} else if data != nil {
+			var recorded DiscoveryVersion
+			if err := json.Unmarshal(data, &recorded); err == nil {
+				if discovery.CompareSchemaVersions(served, recorded.SchemaVersion) < 0 {
+					k.logger.Warn("discovery schema version downgrade",
+						logging.KeyDomain, domain,
+						"recorded", recorded.SchemaVersion,
+						"served", served)
+					return &DiscoveryDowngradeError{Domain: domain, Recorded: recorded.SchemaVersion, Served: served}
+				}
+			}
+		}
+
+		data, err := json.Marshal(DiscoveryVersion{
+			Domain:        domain,
+			SchemaVersion: served,
+			SeenAt:        clock.Timestamp(k.clock.Now()),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to marshal discovery version: %w", err)
+		}
+		return bucket.put([]byte(domain), data)
+	})
+}
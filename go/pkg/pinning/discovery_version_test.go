@@ -0,0 +1,52 @@
+package pinning
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+)
+
+func TestRecordDiscoveryVersion(t *testing.T) {
+	dbPath := createTempDB(t)
+	fake := clock.NewFake(time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC))
+	k, err := NewKeyPinning(dbPath, PinningModeAutomatic, nil, WithClock(fake))
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	defer k.Close()
+
+	if v, err := k.GetDiscoveryVersion("example.com"); err != nil || v != nil {
+		t.Fatalf("Expected no recorded version, got %+v, %v", v, err)
+	}
+
+	for _, served := range []string{"1.1", "1.2", "1.2", ""} {
+		if err := k.RecordDiscoveryVersion("example.com", served); err != nil {
+			t.Fatalf("RecordDiscoveryVersion(%q) failed: %v", served, err)
+		}
+	}
+
+	fake.Advance(time.Hour)
+	err = k.RecordDiscoveryVersion("example.com", "1.0")
+	var downgrade *DiscoveryDowngradeError
+	if !errors.As(err, &downgrade) {
+		t.Fatalf("Expected *DiscoveryDowngradeError, got %v", err)
+	}
+	if downgrade.Recorded != "1.2" || downgrade.Served != "1.0" {
+		t.Errorf("Expected downgrade from 1.2 to 1.0, got %+v", downgrade)
+	}
+
+	v, err := k.GetDiscoveryVersion("example.com")
+	if err != nil {
+		t.Fatalf("GetDiscoveryVersion failed: %v", err)
+	}
+	if v.SchemaVersion != "1.2" || !v.SeenAt.Equal(time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected 1.2 to stay recorded after the downgrade, got %+v", v)
+	}
+
+	// Other domains are tracked separately
+	if err := k.RecordDiscoveryVersion("other.example.com", "1.0"); err != nil {
+		t.Errorf("Expected first version for another domain to be recorded, got %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package pinning
+
+import (
+	"sort"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/revocation"
+)
+
+// DomainReport is everything the pinning database knows about a domain,
+// as returned by QueryByDomain.
+type DomainReport struct {
+	Domain string `json:"domain"`
+	// Policy is the domain policy, or nil when the domain has the default.
+	Policy     *DomainPolicy   `json:"policy,omitempty"`
+	PinnedKeys []PinnedKeyInfo `json:"pinned_keys"`
+	// DiscoveryVersion is the highest .well-known schema_version seen.
+	DiscoveryVersion *DiscoveryVersion `json:"discovery_version,omitempty"`
+	// Discovery is the last .well-known document fetched for the domain,
+	// and PublishedKeys the keys it publishes.
+	Discovery     *discovery.CachedDocument `json:"discovery,omitempty"`
+	PublishedKeys []PublishedKey            `json:"published_keys,omitempty"`
+	// Revocations are the cached revocation documents for the domain or
+	// from the revocation endpoint of its .well-known document.
+	Revocations []revocation.CachedDocument `json:"revocations,omitempty"`
+	Rejections  []RejectedKey               `json:"rejections,omitempty"`
+}
+
+// PublishedKey is a key published in a cached .well-known document.
+type PublishedKey struct {
+	// Scope is the tools prefix the key is scoped to, or empty for the
+	// domain-wide key.
+	Scope       string `json:"scope,omitempty"`
+	Fingerprint string `json:"fingerprint"`
+	// Revoked reports whether the document lists the key as revoked.
+	Revoked bool `json:"revoked,omitempty"`
+}
+
+// QueryByDomain gathers the pins of the tools on domain, ordered by tool
+// ID and each with its fingerprint, with the domain policy, the cached .well-known and revocation
+// documents and the recorded rejections.
+func (k *KeyPinning) QueryByDomain(domain string) (*DomainReport, error) {
+	report := &DomainReport{Domain: domain, PinnedKeys: []PinnedKeyInfo{}}
+
+	keys, err := k.ListPinnedKeyInfo()
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range keys {
+		if info.Domain != domain {
+			continue
+		}
+		// Pins made from a public key store no fingerprint
+		if info.Fingerprint == "" {
+			info.Fingerprint = fingerprintOf(info.PublicKeyPEM)
+		}
+		report.PinnedKeys = append(report.PinnedKeys, info)
+	}
+
+	policies, err := k.ListDomainPolicies()
+	if err != nil {
+		return nil, err
+	}
+	for i := range policies {
+		if policies[i].Domain == domain {
+			report.Policy = &policies[i]
+		}
+	}
+
+	if report.DiscoveryVersion, err = k.GetDiscoveryVersion(domain); err != nil {
+		return nil, err
+	}
+	if report.Discovery, err = k.LoadDiscoveryDocument(domain); err != nil {
+		return nil, err
+	}
+	endpoint := ""
+	if report.Discovery != nil && report.Discovery.Document != nil {
+		endpoint = report.Discovery.Document.RevocationEndpoint
+		report.PublishedKeys = publishedKeys(report.Discovery.Document)
+	}
+
+	revocations, err := k.ListRevocationDocuments()
+	if err != nil {
+		return nil, err
+	}
+	for _, cached := range revocations {
+		if cached.URL == endpoint || (cached.Document != nil && cached.Document.Domain == domain) {
+			report.Revocations = append(report.Revocations, cached)
+		}
+	}
+
+	rejections, err := k.ListRejectedKeys()
+	if err != nil {
+		return nil, err
+	}
+	for _, rejected := range rejections {
+		if rejected.Domain == domain {
+			report.Rejections = append(report.Rejections, rejected)
+		}
+	}
+	return report, nil
+}
+
+// publishedKeys lists the domain-wide key and the tool-scoped keys of
+// wellKnown, ordered by scope. Keys that cannot be parsed are skipped.
+func publishedKeys(wellKnown *discovery.WellKnownResponse) []PublishedKey {
+	keyManager := crypto.NewKeyManager()
+	var keys []PublishedKey
+	add := func(scope, publicKeyPEM string, revokedKeys []string) {
+		fingerprint, err := keyManager.CalculateKeyFingerprintFromPEM(publicKeyPEM)
+		if err != nil {
+			return
+		}
+		keys = append(keys, PublishedKey{
+			Scope:       scope,
+			Fingerprint: fingerprint,
+			Revoked:     discovery.CheckKeyRevocation(publicKeyPEM, revokedKeys),
+		})
+	}
+	add("", wellKnown.PublicKeyPEM, wellKnown.RevokedKeys)
+	scopes := make([]string, 0, len(wellKnown.Tools))
+	for scope := range wellKnown.Tools {
+		scopes = append(scopes, scope)
+	}
+	sort.Strings(scopes)
+	for _, scope := range scopes {
+		scoped := wellKnown.KeyForTool(scope)
+		add(scope, scoped.PublicKeyPEM, scoped.RevokedKeys)
+	}
+	return keys
+}
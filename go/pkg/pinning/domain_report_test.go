@@ -0,0 +1,153 @@
+package pinning
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/revocation"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+// seededKeyPEM returns the public key PEM of a key derived from seed, so
+// that golden files stay stable.
+func seededKeyPEM(t *testing.T, seed string) string {
+	t.Helper()
+	keyManager := crypto.NewKeyManager()
+	key, err := keyManager.GenerateKeypairFromSeed([]byte(seed), crypto.ForTesting)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	publicKeyPEM, err := keyManager.ExportPublicKeyPEM(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("Failed to export key: %v", err)
+	}
+	return publicKeyPEM
+}
+
+// populateDomains fills a database with pins, policies, cached documents
+// and rejections for tools.example.com and other.example.org.
+func populateDomains(t *testing.T, k *KeyPinning, fake *clock.Fake) {
+	t.Helper()
+	domainKey := seededKeyPEM(t, "domain-report/domain")
+	searchKey := seededKeyPEM(t, "domain-report/search")
+	oldKey := seededKeyPEM(t, "domain-report/old")
+	otherKey := seededKeyPEM(t, "domain-report/other")
+	rejectedKey := seededKeyPEM(t, "domain-report/rejected")
+
+	for _, domain := range []struct {
+		name, key, endpoint string
+		policy              PinningPolicy
+		tools               map[string]discovery.ToolKey
+		revoked             []string
+	}{
+		{
+			name: "tools.example.com", key: domainKey, policy: PinningPolicyAlwaysTrust,
+			endpoint: "https://tools.example.com/revocations.json",
+			tools: map[string]discovery.ToolKey{
+				"search": {PublicKeyPEM: searchKey},
+				"legacy": {PublicKeyPEM: oldKey},
+			},
+			revoked: []string{fingerprintOf(oldKey)},
+		},
+		{
+			name: "other.example.org", key: otherKey, policy: PinningPolicyNeverTrust,
+			endpoint: "https://other.example.org/revocations.json",
+		},
+	} {
+		if err := k.PinKeyWithOptions(domain.name+"/calculator", domain.key, domain.name, "Developer of "+domain.name, PinOptions{
+			Provenance:   ProvenanceDiscovery,
+			SourceDetail: "https://" + domain.name + "/.well-known/schemapin.json",
+		}); err != nil {
+			t.Fatalf("Failed to pin key: %v", err)
+		}
+		fake.Advance(time.Minute)
+		if err := k.UpdateLastVerified(domain.name+"/calculator", true); err != nil {
+			t.Fatalf("UpdateLastVerified failed: %v", err)
+		}
+		if err := k.SetDomainPolicy(domain.name, domain.policy); err != nil {
+			t.Fatalf("Failed to set domain policy: %v", err)
+		}
+		if err := k.RecordDiscoveryVersion(domain.name, "1.2"); err != nil {
+			t.Fatalf("Failed to record discovery version: %v", err)
+		}
+		if err := k.StoreDiscoveryDocument(discovery.CachedDocument{
+			Domain:    domain.name,
+			SourceURL: "https://" + domain.name + "/.well-known/schemapin.json",
+			FetchedAt: fake.Now(),
+			Document: &discovery.WellKnownResponse{
+				SchemaVersion:      "1.2",
+				DeveloperName:      "Developer of " + domain.name,
+				PublicKeyPEM:       domain.key,
+				RevokedKeys:        domain.revoked,
+				RevocationEndpoint: domain.endpoint,
+				Tools:              domain.tools,
+			},
+		}); err != nil {
+			t.Fatalf("Failed to store discovery document: %v", err)
+		}
+		doc := revocation.BuildRevocationDocument(domain.name)
+		doc.UpdatedAt = "2026-03-01T09:00:00Z"
+		if err := k.StoreRevocationDocument(domain.endpoint, doc); err != nil {
+			t.Fatalf("Failed to store revocation document: %v", err)
+		}
+		if err := k.RecordRejection(domain.name+"/calculator", domain.name, fingerprintOf(rejectedKey), RejectionReasonUser); err != nil {
+			t.Fatalf("Failed to record rejection: %v", err)
+		}
+	}
+	if err := k.PinKey("tools.example.com/search", searchKey, "tools.example.com", "Search Team"); err != nil {
+		t.Fatalf("Failed to pin key: %v", err)
+	}
+}
+
+func TestQueryByDomain(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC))
+	pinning, err := NewKeyPinning(createTempDB(t), PinningModeAutomatic, nil, WithClock(fake))
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	defer pinning.Close()
+	populateDomains(t, pinning, fake)
+
+	report, err := pinning.QueryByDomain("tools.example.com")
+	if err != nil {
+		t.Fatalf("QueryByDomain failed: %v", err)
+	}
+	got, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		t.Fatalf("Failed to marshal report: %v", err)
+	}
+	got = append(got, '\n')
+
+	path := filepath.Join("testdata", "domain_report.json")
+	if *update {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatalf("Failed to update golden file: %v", err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read golden file: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("Domain report differs from %s (run with -update to regenerate)\nGot:\n%s", path, got)
+	}
+
+	// A domain with nothing recorded has an empty report
+	report, err = pinning.QueryByDomain("unknown.example.net")
+	if err != nil {
+		t.Fatalf("QueryByDomain failed: %v", err)
+	}
+	if len(report.PinnedKeys) != 0 || report.Policy != nil || report.Discovery != nil ||
+		len(report.Revocations) != 0 || len(report.Rejections) != 0 {
+		t.Errorf("Expected an empty report, got %+v", report)
+	}
+}
@@ -0,0 +1,142 @@
+package pinning
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.etcd.io/bbolt"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/interactive"
+)
+
+// dumpDB returns every row of the known buckets, keyed by bucket and row.
+func dumpDB(t *testing.T, k *KeyPinning) map[string]string {
+	t.Helper()
+	rows := map[string]string{}
+	err := k.db.View(func(tx *bbolt.Tx) error {
+		for _, name := range knownBuckets {
+			err := tx.Bucket(name).ForEach(func(key, value []byte) error {
+				rows[string(name)+"/"+string(key)] = string(value)
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to dump database: %v", err)
+	}
+	return rows
+}
+
+func TestDryRunDecisions(t *testing.T) {
+	pinnedKey, _ := generateTestKeyPEM(t)
+	newKey, newFingerprint := generateTestKeyPEM(t)
+	revokedKey, revokedFingerprint := generateTestKeyPEM(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(discovery.WellKnownResponse{
+			SchemaVersion: "1.2",
+			DeveloperName: "Dev",
+			PublicKeyPEM:  newKey,
+			RevokedKeys:   []string{revokedFingerprint},
+		})
+	}))
+	defer server.Close()
+	domain := server.URL
+
+	dbPath := createTempDB(t)
+	setup, err := NewKeyPinning(dbPath, PinningModeAutomatic, nil)
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	if err := setup.PinKey("pinned-tool", pinnedKey, domain, "Dev"); err != nil {
+		t.Fatalf("Failed to pin key: %v", err)
+	}
+	if err := setup.UpdateLastVerified("pinned-tool", true); err != nil {
+		t.Fatalf("Failed to record verification: %v", err)
+	}
+	setup.Close()
+
+	tests := []struct {
+		name          string
+		mode          PinningMode
+		toolID        string
+		key           string
+		wantAccepted  bool
+		wantPrompt    interactive.PromptType
+		wantWouldHave string
+	}{
+		{"first use prompt", PinningModeInteractive, "new-tool", newKey, false, interactive.PromptTypeFirstTimeKey, "would prompt user: first_time_key for tool new-tool"},
+		{"first use automatic", PinningModeAutomatic, "new-tool", newKey, true, "", "would pin key " + newFingerprint + " for tool new-tool"},
+		{"key change prompt", PinningModeInteractive, "pinned-tool", newKey, false, interactive.PromptTypeKeyChange, "would prompt user: key_change for tool pinned-tool"},
+		{"key change strict", PinningModeStrict, "pinned-tool", newKey, false, "", "would record a policy rejection of key " + newFingerprint + " for tool pinned-tool"},
+		{"revoked key prompt", PinningModeInteractive, "new-tool", revokedKey, false, interactive.PromptTypeRevokedKey, "would prompt user: revoked_key for tool new-tool"},
+		{"same key", PinningModeInteractive, "pinned-tool", pinnedKey, true, "", "would record a successful verification of tool pinned-tool"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var handler *mockInteractiveHandler
+			var h interactive.InteractiveHandler
+			if tt.mode == PinningModeInteractive {
+				handler = &mockInteractiveHandler{decision: interactive.UserDecisionAccept}
+				h = handler
+			}
+			k, err := NewKeyPinning(dbPath, tt.mode, h, WithDryRun(true))
+			if err != nil {
+				t.Fatalf("Failed to create KeyPinning: %v", err)
+			}
+			defer k.Close()
+			before := dumpDB(t, k)
+
+			decision, err := k.InteractivePinKeyWithDecision(tt.toolID, tt.key, domain, "Dev")
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if decision.Accepted != tt.wantAccepted || decision.WouldPrompt != tt.wantPrompt {
+				t.Errorf("Expected accepted=%v prompt=%q, got %+v", tt.wantAccepted, tt.wantPrompt, decision)
+			}
+			if len(decision.WouldHave) != 1 || decision.WouldHave[0] != tt.wantWouldHave {
+				t.Errorf("Expected would have %q, got %q", tt.wantWouldHave, decision.WouldHave)
+			}
+			if handler != nil && handler.prompts != 0 {
+				t.Errorf("Expected no prompts, got %d", handler.prompts)
+			}
+			if after := dumpDB(t, k); !reflect.DeepEqual(after, before) {
+				t.Errorf("Expected no database changes, got\n%v\nwant\n%v", after, before)
+			}
+		})
+	}
+}
+
+func TestDryRunUserDecision(t *testing.T) {
+	k, err := NewKeyPinning(createTempDB(t), PinningModeInteractive, nil, WithDryRun(true))
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	defer k.Close()
+	publicKeyPEM, _ := generateTestKeyPEM(t)
+	before := dumpDB(t, k)
+
+	decision, err := k.ApplyUserDecision("tool", "example.com", publicKeyPEM, "Dev", "", interactive.UserDecisionNeverTrust)
+	if err != nil {
+		t.Fatalf("ApplyUserDecision failed: %v", err)
+	}
+	if decision.PolicyUpdated != PinningPolicyNeverTrust || len(decision.WouldHave) != 3 ||
+		!strings.HasPrefix(decision.WouldHave[0], "would set domain policy never_trust") {
+		t.Errorf("Expected the policy, rejection and removal to be reported, got %+v", decision)
+	}
+	if k.GetDomainPolicy("example.com") != PinningPolicyDefault {
+		t.Errorf("Expected no domain policy, got %s", k.GetDomainPolicy("example.com"))
+	}
+	if after := dumpDB(t, k); !reflect.DeepEqual(after, before) {
+		t.Errorf("Expected no database changes, got %v", after)
+	}
+}
@@ -0,0 +1,603 @@
+package pinning
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"go.etcd.io/bbolt"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
+)
+
+// StoreKeySize is the size in bytes of a pin store encryption key.
+const StoreKeySize = 32
+
+var (
+	// ErrPinStoreEncrypted is returned when an encrypted pinning database
+	// is opened without WithStoreEncryption.
+	ErrPinStoreEncrypted = errors.New("pin store is encrypted")
+	// ErrPinStoreKeyMismatch is returned when the key given to
+	// WithStoreEncryption is not the one the pinning database was
+	// encrypted with.
+	ErrPinStoreKeyMismatch = errors.New("store key does not match the key the pin store was encrypted with")
+	// ErrPinStoreNotEncrypted is returned when a pinning database holding
+	// plaintext rows is opened with WithStoreEncryption. EncryptPinStore
+	// encrypts it.
+	ErrPinStoreNotEncrypted = errors.New("pin store is not encrypted; encrypt it with EncryptPinStore first")
+)
+
+// storeEncryptionKey is the settings row recording that, and with which
+// key, the database is encrypted.
+var storeEncryptionKey = []byte("store_encryption")
+
+// storeEncryption is the value of the storeEncryptionKey row.
+type storeEncryption struct {
+	Algorithm string `json:"algorithm"`
+	Index     string `json:"index"`
+	// KeyCheck is derived from the key, so that a wrong key is refused
+	// when the database is opened rather than on the first read.
+	KeyCheck string `json:"key_check"`
+}
+
+// pinIndexBucket maps the HMAC of a tool ID to the row of its pin in an
+// encrypted database. It is empty in a plaintext one.
+var pinIndexBucket = []byte("pin_index")
+
+// sealedBuckets are the buckets whose rows are encrypted: every bucket
+// whose keys or values name a tool, domain, developer or key. Only the
+// settings bucket is stored as is.
+var sealedBuckets = [][]byte{pinnedKeysBucket, domainPoliciesBucket, discoveryVersionsBucket, rejectedKeysBucket, revocationCacheBucket, discoveryCacheBucket, pendingDecisionsBucket}
+
+// sealedRowVersion is the first byte of an encrypted row.
+const sealedRowVersion = 1
+
+// WithStoreEncryption encrypts the database at rest with key, which must
+// be StoreKeySize bytes, e.g. from a StoreKeyProvider. Every row naming a
+// tool, domain, developer or key, that is pins, domain policies,
+// rejections, discovery versions, cached documents and pending decisions,
+// is sealed with AES-256-GCM under a nonce of its own, together with its
+// key. Rows are stored under an HMAC-SHA256 of their key instead of the
+// key itself; a pin under an HMAC of its tool ID and normalized domain,
+// found through an index keyed by an HMAC of the tool ID, so GetPinnedKey
+// remains two lookups. Keys are derived from key for each purpose.
+//
+// A new database is encrypted from the start; an existing plaintext one
+// fails to open with ErrPinStoreNotEncrypted until it is encrypted with
+// EncryptPinStore. An encrypted database fails to open with
+// ErrPinStoreEncrypted without this option, and with
+// ErrPinStoreKeyMismatch with another key.
+//
+// ExportPinnedKeys, ExportSignedSnapshot and the other read methods return
+// plaintext, and the import methods encrypt what they import. Lists are
+// sorted after decryption, so they keep their documented order.
+func WithStoreEncryption(key []byte) Option {
+	return func(k *KeyPinning) {
+		k.storeKey = append([]byte(nil), key...)
+	}
+}
+
+// Encrypted reports whether the database is encrypted at rest (see
+// WithStoreEncryption).
+func (k *KeyPinning) Encrypted() bool {
+	return k.cipher != nil
+}
+
+// storeCipher encrypts the rows of an encrypted database. A nil
+// *storeCipher stores them in plaintext under their own keys.
+type storeCipher struct {
+	aead     cipher.AEAD
+	indexKey []byte
+	keyCheck string
+}
+
+// newStoreCipher derives the encryption, index and check keys from key.
+func newStoreCipher(key []byte) (*storeCipher, error) {
+	if len(key) != StoreKeySize {
+		return nil, fmt.Errorf("store key must be %d bytes, got %d", StoreKeySize, len(key))
+	}
+	block, err := aes.NewCipher(deriveStoreKey(key, "encryption"))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &storeCipher{
+		aead:     aead,
+		indexKey: deriveStoreKey(key, "index"),
+		keyCheck: hex.EncodeToString(deriveStoreKey(key, "key check")),
+	}, nil
+}
+
+// deriveStoreKey derives the key for purpose from the store key.
+func deriveStoreKey(key []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("schemapin pin store " + purpose))
+	return mac.Sum(nil)
+}
+
+// index returns the key an encrypted row identified by parts is stored
+// under: the hex HMAC-SHA256 of the length-prefixed parts.
+func (c *storeCipher) index(parts ...string) []byte {
+	mac := hmac.New(sha256.New, c.indexKey)
+	for _, part := range parts {
+		mac.Write(binary.AppendUvarint(nil, uint64(len(part))))
+		mac.Write([]byte(part))
+	}
+	return []byte(hex.EncodeToString(mac.Sum(nil)))
+}
+
+// pinIndex returns the row of the pin of toolID on domain. The domain is
+// normalized per core.NormalizeDomain, or taken as is if it does not
+// normalize; the tool ID is matched exactly, as it is looked up.
+func (c *storeCipher) pinIndex(toolID, domain string) []byte {
+	if identity, err := core.NormalizeDomain(domain); err == nil {
+		domain = identity
+	}
+	return c.index(string(pinnedKeysBucket), toolID, domain)
+}
+
+// seal encrypts the key and value of the row stored under index. The
+// index is authenticated with the row, so a row cannot be moved to
+// another.
+func (c *storeCipher) seal(index, key, value []byte) ([]byte, error) {
+	data := binary.AppendUvarint(make([]byte, 0, binary.MaxVarintLen64+len(key)+len(value)), uint64(len(key)))
+	data = append(append(data, key...), value...)
+	nonceSize := c.aead.NonceSize()
+	sealed := make([]byte, 1+nonceSize, 1+nonceSize+len(data)+c.aead.Overhead())
+	sealed[0] = sealedRowVersion
+	if _, err := rand.Read(sealed[1:]); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	return c.aead.Seal(sealed, sealed[1:], data, index), nil
+}
+
+// open decrypts the row stored under index and returns its key and value.
+func (c *storeCipher) open(index, sealed []byte) (key, value []byte, err error) {
+	nonceSize := c.aead.NonceSize()
+	if len(sealed) < 1+nonceSize || sealed[0] != sealedRowVersion {
+		return nil, nil, fmt.Errorf("row is not encrypted")
+	}
+	data, err := c.aead.Open(nil, sealed[1:1+nonceSize], sealed[1+nonceSize:], index)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decrypt row: %w", err)
+	}
+	n, size := binary.Uvarint(data)
+	if size <= 0 || n > uint64(len(data)-size) {
+		return nil, nil, fmt.Errorf("malformed encrypted row")
+	}
+	return data[size : size+int(n)], data[size+int(n):], nil
+}
+
+// sealedBucket reads and writes the rows of one of sealedBuckets through
+// the database's cipher.
+type sealedBucket struct {
+	name   []byte
+	bucket *bbolt.Bucket
+	cipher *storeCipher
+}
+
+// sealed returns the bucket name of tx.
+func (k *KeyPinning) sealed(tx *bbolt.Tx, name []byte) sealedBucket {
+	return sealedBucketOf(tx, name, k.cipher)
+}
+
+// sealedBucketOf returns the bucket name of tx, or with a nil tx a
+// sealedBucket that can only decode rows.
+func sealedBucketOf(tx *bbolt.Tx, name []byte, c *storeCipher) sealedBucket {
+	b := sealedBucket{name: name, cipher: c}
+	if tx != nil {
+		b.bucket = tx.Bucket(name)
+	}
+	return b
+}
+
+// isSealedBucket reports whether name is one of sealedBuckets.
+func isSealedBucket(name []byte) bool {
+	for _, sealed := range sealedBuckets {
+		if bytes.Equal(name, sealed) {
+			return true
+		}
+	}
+	return false
+}
+
+// index returns the key the row for key is stored under.
+func (b sealedBucket) index(key []byte) []byte {
+	if b.cipher == nil {
+		return key
+	}
+	return b.cipher.index(string(b.name), string(key))
+}
+
+// get returns the value of the row for key, or nil if there is none.
+func (b sealedBucket) get(key []byte) ([]byte, error) {
+	return b.getAt(b.index(key), key)
+}
+
+// getAt returns the value of the row for key stored under index.
+func (b sealedBucket) getAt(index, key []byte) ([]byte, error) {
+	data := b.bucket.Get(index)
+	if data == nil {
+		return nil, nil
+	}
+	stored, value, err := b.openRow(index, data)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(stored, key) {
+		return nil, fmt.Errorf("%s row of %q holds %q", b.name, key, stored)
+	}
+	return value, nil
+}
+
+// openRow returns the key and value of the row stored under index.
+func (b sealedBucket) openRow(index, data []byte) (key, value []byte, err error) {
+	if b.cipher == nil {
+		return index, data, nil
+	}
+	return b.cipher.open(index, data)
+}
+
+// put stores value as the row for key.
+func (b sealedBucket) put(key, value []byte) error {
+	return b.putAt(b.index(key), key, value)
+}
+
+// putAt stores key and value under index.
+func (b sealedBucket) putAt(index, key, value []byte) error {
+	if b.cipher == nil {
+		return b.bucket.Put(index, value)
+	}
+	data, err := b.cipher.seal(index, key, value)
+	if err != nil {
+		return err
+	}
+	return b.bucket.Put(index, data)
+}
+
+// delete removes the row for key.
+func (b sealedBucket) delete(key []byte) error {
+	return b.bucket.Delete(b.index(key))
+}
+
+// forEach calls fn with the key and value of every row in key order,
+// stopping at the first row that cannot be decrypted. The rows are read
+// before fn is called, so fn may modify the bucket.
+func (b sealedBucket) forEach(fn func(key, value []byte) error) error {
+	type row struct{ key, value []byte }
+	var rows []row
+	err := b.bucket.ForEach(func(index, data []byte) error {
+		key, value, err := b.openRow(index, data)
+		if err != nil {
+			return fmt.Errorf("%s row %s: %w", b.name, index, err)
+		}
+		rows = append(rows, row{append([]byte(nil), key...), append([]byte(nil), value...)})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// Encrypted rows are stored in the order of their index
+	sort.Slice(rows, func(i, j int) bool { return bytes.Compare(rows[i].key, rows[j].key) < 0 })
+	for _, r := range rows {
+		if err := fn(r.key, r.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isEmpty reports whether the bucket holds no rows.
+func (b sealedBucket) isEmpty() bool {
+	key, _ := b.bucket.Cursor().First()
+	return key == nil
+}
+
+// pinBucket reads and writes pins in the pinned_keys bucket through the
+// database's cipher. Encrypted pins are stored under an HMAC of their tool
+// ID and domain, and found through the pin_index bucket.
+type pinBucket struct {
+	rows     sealedBucket
+	pinIndex *bbolt.Bucket
+}
+
+// pins returns the pinned_keys bucket of tx.
+func (k *KeyPinning) pins(tx *bbolt.Tx) pinBucket {
+	return pinBucketOf(tx, k.cipher)
+}
+
+// pinBucketOf returns the pins of tx, or with a nil tx a pinBucket that
+// can only decode pins.
+func pinBucketOf(tx *bbolt.Tx, c *storeCipher) pinBucket {
+	b := pinBucket{rows: sealedBucketOf(tx, pinnedKeysBucket, c)}
+	if tx != nil {
+		b.pinIndex = tx.Bucket(pinIndexBucket)
+	}
+	return b
+}
+
+// row returns the key the pin of toolID is stored under, or nil if an
+// encrypted database has none.
+func (b pinBucket) row(toolID string) []byte {
+	if b.rows.cipher == nil {
+		return []byte(toolID)
+	}
+	return b.pinIndex.Get(b.rows.cipher.index(string(pinIndexBucket), toolID))
+}
+
+// get returns the pin stored for toolID, or nil if there is none.
+func (b pinBucket) get(toolID string) (*PinnedKeyInfo, error) {
+	row := b.row(toolID)
+	if row == nil {
+		return nil, nil
+	}
+	data, err := b.rows.getAt(row, []byte(toolID))
+	if err != nil {
+		return nil, corruptPinError(toolID, err)
+	}
+	if data == nil {
+		if b.rows.cipher != nil {
+			return nil, corruptPinError(toolID, fmt.Errorf("pin index refers to a missing pin"))
+		}
+		return nil, nil
+	}
+	var info PinnedKeyInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, corruptPinError(toolID, err)
+	}
+	return &info, nil
+}
+
+// put stores info as the pin of toolID, moving an encrypted pin to the
+// row of its new domain.
+func (b pinBucket) put(toolID string, info *PinnedKeyInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return fmt.Errorf("failed to marshal key info: %w", err)
+	}
+	c := b.rows.cipher
+	if c == nil {
+		return b.rows.putAt([]byte(toolID), []byte(toolID), data)
+	}
+	row := c.pinIndex(toolID, info.Domain)
+	if old := b.row(toolID); old != nil && !bytes.Equal(old, row) {
+		if err := b.rows.bucket.Delete(old); err != nil {
+			return err
+		}
+	}
+	if err := b.rows.putAt(row, []byte(toolID), data); err != nil {
+		return err
+	}
+	return b.pinIndex.Put(c.index(string(pinIndexBucket), toolID), row)
+}
+
+// delete removes the pin of toolID.
+func (b pinBucket) delete(toolID string) error {
+	row := b.row(toolID)
+	if row == nil {
+		return nil
+	}
+	if err := b.rows.bucket.Delete(row); err != nil {
+		return err
+	}
+	if b.rows.cipher == nil {
+		return nil
+	}
+	return b.pinIndex.Delete(b.rows.cipher.index(string(pinIndexBucket), toolID))
+}
+
+// decode returns the tool ID and pin stored under row. An encrypted pin
+// must be stored under the row of its tool ID and domain.
+func (b pinBucket) decode(row, data []byte) (string, PinnedKeyInfo, error) {
+	var info PinnedKeyInfo
+	toolID, value, err := b.rows.openRow(row, data)
+	if err != nil {
+		return "", info, err
+	}
+	if err := json.Unmarshal(value, &info); err != nil {
+		return "", info, err
+	}
+	if c := b.rows.cipher; c != nil && (info.ToolID != string(toolID) || !bytes.Equal(row, c.pinIndex(info.ToolID, info.Domain))) {
+		return "", info, fmt.Errorf("pin of %s does not match its row", info.ToolID)
+	}
+	return string(toolID), info, nil
+}
+
+// forEach calls fn with every pin in tool ID order, stopping at the first
+// that cannot be decoded.
+func (b pinBucket) forEach(fn func(PinnedKeyInfo) error) error {
+	return b.rows.forEach(func(toolID, value []byte) error {
+		var info PinnedKeyInfo
+		if err := json.Unmarshal(value, &info); err != nil {
+			return corruptPinError(string(toolID), err)
+		}
+		return fn(info)
+	})
+}
+
+// checkPinIndex reports the pin index entries of an encrypted database
+// that refer to no pin, and the pins that cannot be found through the
+// index.
+func checkPinIndex(tx *bbolt.Tx, c *storeCipher) []IntegrityProblem {
+	pins, index := tx.Bucket(pinnedKeysBucket), tx.Bucket(pinIndexBucket)
+	if pins == nil || index == nil {
+		return nil
+	}
+	var problems []IntegrityProblem
+	_ = index.ForEach(func(key, row []byte) error {
+		if pins.Get(row) == nil {
+			problems = append(problems, IntegrityProblem{Bucket: string(pinIndexBucket), Key: string(key), Reason: "index entry refers to a missing pin"})
+		}
+		return nil
+	})
+	_ = pins.ForEach(func(row, value []byte) error {
+		toolID, _, err := c.open(row, value)
+		if err == nil && !bytes.Equal(index.Get(c.index(string(pinIndexBucket), string(toolID))), row) {
+			problems = append(problems, IntegrityProblem{Bucket: string(pinnedKeysBucket), Key: string(row), Reason: "pin is missing from the pin index"})
+		}
+		return nil
+	})
+	return problems
+}
+
+// checkStoreEncryption compares the encryption recorded in the database
+// with c. A database whose sealed buckets are empty and which has no
+// record of encryption is marked encrypted with c if write is set, since
+// there is nothing to migrate.
+func checkStoreEncryption(tx *bbolt.Tx, c *storeCipher, write bool) error {
+	var recorded *storeEncryption
+	if settings := tx.Bucket(settingsBucket); settings != nil {
+		if data := settings.Get(storeEncryptionKey); data != nil {
+			recorded = &storeEncryption{}
+			if err := json.Unmarshal(data, recorded); err != nil {
+				return fmt.Errorf("undecodable store encryption settings: %w", err)
+			}
+		}
+	}
+	switch {
+	case recorded == nil && c == nil:
+		return nil
+	case recorded == nil:
+		if write && sealedBucketsEmpty(tx) {
+			return recordStoreEncryption(tx, c)
+		}
+		return ErrPinStoreNotEncrypted
+	case c == nil:
+		return fmt.Errorf("%w; a store key is required", ErrPinStoreEncrypted)
+	case !hmac.Equal([]byte(recorded.KeyCheck), []byte(c.keyCheck)):
+		return ErrPinStoreKeyMismatch
+	}
+	return nil
+}
+
+// sealedBucketsEmpty reports whether every sealed bucket exists and is
+// empty.
+func sealedBucketsEmpty(tx *bbolt.Tx) bool {
+	for _, name := range sealedBuckets {
+		if tx.Bucket(name) == nil || !sealedBucketOf(tx, name, nil).isEmpty() {
+			return false
+		}
+	}
+	return true
+}
+
+// recordStoreEncryption marks the database encrypted with c.
+func recordStoreEncryption(tx *bbolt.Tx, c *storeCipher) error {
+	data, err := json.Marshal(storeEncryption{Algorithm: "AES-256-GCM", Index: "HMAC-SHA256", KeyCheck: c.keyCheck})
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(settingsBucket).Put(storeEncryptionKey, data)
+}
+
+// EncryptPinStore encrypts the plaintext database at dbPath with key, so
+// that it can be opened with WithStoreEncryption(key). Every row of the
+// sealed buckets is rewritten in one transaction: if any pin cannot be
+// decoded, nothing is changed and the database should be repaired first.
+// The file is then compacted, so that the pages that held the plaintext
+// rows are not left in it; copies made earlier, such as backups, are not
+// affected. It returns the number of pins encrypted. A database that is
+// already encrypted fails with ErrPinStoreEncrypted. The database must not
+// be open elsewhere.
+func EncryptPinStore(dbPath string, key []byte) (int, error) {
+	c, err := newStoreCipher(key)
+	if err != nil {
+		return 0, err
+	}
+	db, err := openDB(dbPath, nil)
+	if err != nil {
+		if errors.Is(err, ErrPinStoreEncrypted) {
+			return 0, fmt.Errorf("pinning database %s: %w already", dbPath, ErrPinStoreEncrypted)
+		}
+		return 0, err
+	}
+
+	var count int
+	err = safeUpdate(db, func(tx *bbolt.Tx) error {
+		pins := make(map[string]PinnedKeyInfo)
+		plaintext := pinBucketOf(tx, nil)
+		err := plaintext.rows.bucket.ForEach(func(row, data []byte) error {
+			toolID, info, err := plaintext.decode(row, data)
+			if err != nil {
+				return corruptPinError(string(row), err)
+			}
+			pins[toolID] = info
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, name := range sealedBuckets {
+			if err := encryptBucket(tx, name, c); err != nil {
+				return err
+			}
+		}
+		encrypted := pinBucketOf(tx, c)
+		for toolID, info := range pins {
+			info := info
+			if err := encrypted.put(toolID, &info); err != nil {
+				return err
+			}
+		}
+		count = len(pins)
+		return recordStoreEncryption(tx, c)
+	})
+	if err != nil {
+		_ = db.Close()
+		return 0, fmt.Errorf("failed to encrypt pinning database: %w", err)
+	}
+
+	k := &KeyPinning{db: db, dbPath: dbPath, cipher: c, clock: clock.Real}
+	_, err = k.Vacuum()
+	if closeErr := k.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return count, fmt.Errorf("pins encrypted, but the database could not be compacted: %w", err)
+	}
+	return count, nil
+}
+
+// encryptBucket seals every plaintext row of the bucket name with c. The
+// plaintext rows are removed before the encrypted ones are written, so
+// that no row key of one kind is mistaken for the other. Pins are removed
+// and left for the caller to write, along with their index.
+func encryptBucket(tx *bbolt.Tx, name []byte, c *storeCipher) error {
+	bucket := tx.Bucket(name)
+	rows := make(map[string][]byte)
+	err := bucket.ForEach(func(key, value []byte) error {
+		rows[string(key)] = append([]byte(nil), value...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for key := range rows {
+		if err := bucket.Delete([]byte(key)); err != nil {
+			return err
+		}
+	}
+	if string(name) == string(pinnedKeysBucket) {
+		return nil
+	}
+	encrypted := sealedBucketOf(tx, name, c)
+	for key, value := range rows {
+		if err := encrypted.put([]byte(key), value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,475 @@
+package pinning
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.etcd.io/bbolt"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/interactive"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/revocation"
+)
+
+func testStoreKey(t testing.TB, seed byte) []byte {
+	t.Helper()
+	return bytes.Repeat([]byte{seed}, StoreKeySize)
+}
+
+// assertNoPlaintext fails if the database file contains any of secrets.
+func assertNoPlaintext(t *testing.T, dbPath string, secrets ...string) {
+	t.Helper()
+	data, err := os.ReadFile(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range secrets {
+		if bytes.Contains(data, []byte(secret)) {
+			t.Errorf("Database file contains %q in plaintext", secret)
+		}
+	}
+}
+
+func TestStoreEncryptionRoundTrip(t *testing.T) {
+	publicKeyPEM, _ := generateTestKeyPEM(t)
+	namespaceKeyPEM, _ := generateTestKeyPEM(t)
+	dbPath := createTempDB(t)
+	key := testStoreKey(t, 1)
+
+	k, err := NewKeyPinning(dbPath, PinningModeAutomatic, nil, WithStoreEncryption(key))
+	if err != nil {
+		t.Fatalf("Failed to create encrypted KeyPinning: %v", err)
+	}
+	if !k.Encrypted() {
+		t.Fatal("Expected a new database opened with a key to be encrypted")
+	}
+	if err := k.PinKey("secret.example/weather", publicKeyPEM, "secret.example", "Secret Developer"); err != nil {
+		t.Fatalf("PinKey failed: %v", err)
+	}
+	if err := k.PinKeyForNamespace("vendor.example/payments", namespaceKeyPEM, "vendor.example", "Vendor"); err != nil {
+		t.Fatalf("PinKeyForNamespace failed: %v", err)
+	}
+	if err := k.UpdateLastVerified("secret.example/weather", true); err != nil {
+		t.Fatalf("UpdateLastVerified failed: %v", err)
+	}
+
+	if got, err := k.GetPinnedKey("secret.example/weather"); err != nil || got != publicKeyPEM {
+		t.Errorf("GetPinnedKey = %q, %v; want the pinned key", got, err)
+	}
+	info, match, err := k.ResolvePin("vendor.example/payments/refund")
+	if err != nil || info == nil || match != PinMatchNamespace || info.PublicKeyPEM != namespaceKeyPEM {
+		t.Errorf("Expected the namespace pin to resolve, got %+v, %s, %v", info, match, err)
+	}
+	info, err = k.GetKeyInfo("secret.example/weather")
+	if err != nil || info == nil || info.DeveloperName != "Secret Developer" || info.SuccessCount != 1 {
+		t.Errorf("Expected the pin with its statistics, got %+v, %v", info, err)
+	}
+	if got, err := k.GetPinnedKey("secret.example/other"); err != nil || got != "" {
+		t.Errorf("Expected no pin for an unpinned tool, got %q, %v", got, err)
+	}
+	keys, err := k.ListPinnedKeyInfo()
+	if err != nil || len(keys) != 2 {
+		t.Fatalf("Expected 2 pins, got %d, %v", len(keys), err)
+	}
+	report, err := k.IntegrityCheck()
+	if err != nil || !report.OK() {
+		t.Errorf("Expected an encrypted database to pass the integrity check, got %+v, %v", report, err)
+	}
+
+	if err := k.RemovePinnedKey("secret.example/weather"); err != nil {
+		t.Fatalf("RemovePinnedKey failed: %v", err)
+	}
+	if k.IsKeyPinned("secret.example/weather") {
+		t.Error("Expected the removed pin to be gone")
+	}
+	if err := k.PinKey("secret.example/weather", publicKeyPEM, "secret.example", "Secret Developer"); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Close(); err != nil {
+		t.Fatal(err)
+	}
+	assertNoPlaintext(t, dbPath, "secret.example", "vendor.example", "Secret Developer", "BEGIN PUBLIC KEY")
+
+	// Reopened with the key, read-write and read-only
+	for _, opts := range [][]Option{{WithStoreEncryption(key)}, {WithStoreEncryption(key), WithReadOnly(true)}} {
+		k, err := NewKeyPinning(dbPath, PinningModeAutomatic, nil, opts...)
+		if err != nil {
+			t.Fatalf("Failed to reopen encrypted database: %v", err)
+		}
+		if got, err := k.GetPinnedKey("secret.example/weather"); err != nil || got != publicKeyPEM {
+			t.Errorf("After reopening, GetPinnedKey = %q, %v", got, err)
+		}
+		k.Close()
+	}
+}
+
+func TestStoreEncryptionCoversEveryBucket(t *testing.T) {
+	publicKeyPEM, _ := generateTestKeyPEM(t)
+	dbPath := createTempDB(t)
+	key := testStoreKey(t, 8)
+	k, err := NewKeyPinning(dbPath, PinningModeAutomatic, nil, WithStoreEncryption(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, domain := range []string{"zulu.example", "alpha.example"} {
+		if err := k.SetDomainPolicy(domain, PinningPolicyAlwaysTrust); err != nil {
+			t.Fatal(err)
+		}
+		if err := k.RecordDiscoveryVersion(domain, "1.2"); err != nil {
+			t.Fatal(err)
+		}
+		if err := k.StoreDiscoveryDocument(discovery.CachedDocument{
+			Domain:   domain,
+			Document: &discovery.WellKnownResponse{DeveloperName: "Developer of " + domain, PublicKeyPEM: publicKeyPEM},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if err := k.StoreRevocationDocument("https://"+domain+"/revocations.json", revocation.BuildRevocationDocument(domain)); err != nil {
+			t.Fatal(err)
+		}
+		if err := k.RecordRejection(domain+"/calculator", domain, fingerprintOf(publicKeyPEM), RejectionReasonUser); err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = pendingBucket{k}.UpdatePending(func(items map[string]*interactive.PendingDecision) error {
+		items["pending-1"] = &interactive.PendingDecision{
+			ID:        "pending-1",
+			ExpiresAt: time.Now().Add(time.Hour),
+			Prompt:    &interactive.PromptContext{ToolID: "pending.example/tool", Domain: "pending.example", NewKey: &interactive.KeyInfo{PEMData: publicKeyPEM}},
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.Close()
+	assertNoPlaintext(t, dbPath, "zulu.example", "alpha.example", "calculator", "pending.example", "BEGIN PUBLIC KEY", "always_trust")
+
+	k, err = NewKeyPinning(dbPath, PinningModeAutomatic, nil, WithStoreEncryption(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer k.Close()
+	if got := k.GetDomainPolicy("zulu.example"); got != PinningPolicyAlwaysTrust {
+		t.Errorf("GetDomainPolicy = %s", got)
+	}
+	policies, err := k.ListDomainPolicies()
+	if err != nil || len(policies) != 2 || policies[0].Domain != "alpha.example" {
+		t.Errorf("Expected the domain policies ordered by domain, got %+v, %v", policies, err)
+	}
+	if version, err := k.GetDiscoveryVersion("zulu.example"); err != nil || version == nil || version.SchemaVersion != "1.2" {
+		t.Errorf("GetDiscoveryVersion = %+v, %v", version, err)
+	}
+	if err := k.RecordDiscoveryVersion("zulu.example", "1.1"); err == nil {
+		t.Error("Expected a downgrade to be detected in an encrypted database")
+	}
+	docs, err := k.ListDiscoveryDocuments()
+	if err != nil || len(docs) != 2 || docs[0].Domain != "alpha.example" {
+		t.Errorf("Expected the cached documents ordered by domain, got %+v, %v", docs, err)
+	}
+	if doc, err := k.LoadRevocationDocument("https://zulu.example/revocations.json"); err != nil || doc == nil {
+		t.Errorf("LoadRevocationDocument = %+v, %v", doc, err)
+	}
+	rejections, err := k.ListRejectedKeys()
+	if err != nil || len(rejections) != 2 || rejections[0].ToolID != "alpha.example/calculator" {
+		t.Errorf("Expected the rejections ordered by tool ID, got %+v, %v", rejections, err)
+	}
+	if err := k.CheckRejection("zulu.example/calculator", "zulu.example", publicKeyPEM); err == nil {
+		t.Error("Expected the rejection to be found in an encrypted database")
+	}
+	pending, err := k.PendingDecisions().ListPending()
+	if err != nil || len(pending) != 1 || pending[0].Prompt.ToolID != "pending.example/tool" {
+		t.Errorf("Expected the pending decision, got %+v, %v", pending, err)
+	}
+	report, err := k.IntegrityCheck()
+	if err != nil || !report.OK() {
+		t.Errorf("Expected the integrity check to pass, got %+v, %v", report, err)
+	}
+}
+
+func TestStoreEncryptionPinRowFollowsDomain(t *testing.T) {
+	publicKeyPEM, _ := generateTestKeyPEM(t)
+	k, err := NewKeyPinning(createTempDB(t), PinningModeAutomatic, nil, WithStoreEncryption(testStoreKey(t, 9)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer k.Close()
+	if err := k.PinKey("tool", publicKeyPEM, "one.example", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.PinKey("tool", publicKeyPEM, "Two.Example.", ""); err != nil {
+		t.Fatal(err)
+	}
+	err = k.db.View(func(tx *bbolt.Tx) error {
+		row := k.pins(tx).row("tool")
+		if !bytes.Equal(row, k.cipher.pinIndex("tool", "two.example")) {
+			t.Errorf("Expected the pin stored under its tool ID and normalized domain, got row %s", row)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := k.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Rows["pinned_keys"] != 1 || stats.Rows["pin_index"] != 1 {
+		t.Errorf("Expected the old row to be removed, got %v", stats.Rows)
+	}
+	if info, err := k.GetKeyInfo("tool"); err != nil || info == nil || info.Domain != "Two.Example." {
+		t.Errorf("GetKeyInfo = %+v, %v", info, err)
+	}
+	if err := k.RemovePinnedKey("tool"); err != nil {
+		t.Fatal(err)
+	}
+	if stats, err := k.Stats(); err != nil || stats.Rows["pinned_keys"] != 0 || stats.Rows["pin_index"] != 0 {
+		t.Errorf("Expected the pin and its index entry removed, got %+v, %v", stats, err)
+	}
+}
+
+func TestStoreEncryptionOpenErrors(t *testing.T) {
+	publicKeyPEM, _ := generateTestKeyPEM(t)
+	encryptedPath := createTempDB(t)
+	k, err := NewKeyPinning(encryptedPath, PinningModeAutomatic, nil, WithStoreEncryption(testStoreKey(t, 1)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := k.PinKey("tool", publicKeyPEM, "example.com", ""); err != nil {
+		t.Fatal(err)
+	}
+	k.Close()
+
+	plaintextPath := createTempDB(t)
+	k, err = NewKeyPinning(plaintextPath, PinningModeAutomatic, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := k.PinKey("tool", publicKeyPEM, "example.com", ""); err != nil {
+		t.Fatal(err)
+	}
+	k.Close()
+
+	tests := []struct {
+		name string
+		path string
+		opts []Option
+		want error
+	}{
+		{"no key", encryptedPath, nil, ErrPinStoreEncrypted},
+		{"no key read-only", encryptedPath, []Option{WithReadOnly(true)}, ErrPinStoreEncrypted},
+		{"wrong key", encryptedPath, []Option{WithStoreEncryption(testStoreKey(t, 2))}, ErrPinStoreKeyMismatch},
+		{"wrong key read-only", encryptedPath, []Option{WithStoreEncryption(testStoreKey(t, 2)), WithReadOnly(true)}, ErrPinStoreKeyMismatch},
+		{"plaintext with key", plaintextPath, []Option{WithStoreEncryption(testStoreKey(t, 1))}, ErrPinStoreNotEncrypted},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			k, err := NewKeyPinning(tt.path, PinningModeAutomatic, nil, tt.opts...)
+			if err == nil {
+				k.Close()
+			}
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+
+	if _, err := NewKeyPinning(createTempDB(t), PinningModeAutomatic, nil, WithStoreEncryption([]byte("short"))); err == nil {
+		t.Error("Expected a key of the wrong size to be refused")
+	}
+	if _, err := RepairDatabase(encryptedPath); !errors.Is(err, ErrPinStoreEncrypted) {
+		t.Errorf("Expected repairing without the key to fail, got %v", err)
+	}
+}
+
+func TestEncryptPinStore(t *testing.T) {
+	publicKeyPEM, _ := generateTestKeyPEM(t)
+	namespaceKeyPEM, _ := generateTestKeyPEM(t)
+	dbPath := createTempDB(t)
+	key := testStoreKey(t, 3)
+
+	k, err := NewKeyPinning(dbPath, PinningModeAutomatic, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := k.PinKey("internal.example/deploy", publicKeyPEM, "internal.example", "Platform Team"); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.PinKeyForNamespace("internal.example/billing", namespaceKeyPEM, "internal.example", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.UpdateLastVerified("internal.example/deploy", true); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.SetDomainPolicy("other.example", PinningPolicyAlwaysTrust); err != nil {
+		t.Fatal(err)
+	}
+	before, err := k.ListPinnedKeyInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.Close()
+
+	n, err := EncryptPinStore(dbPath, key)
+	if err != nil {
+		t.Fatalf("EncryptPinStore failed: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("Expected 2 pins encrypted, got %d", n)
+	}
+	assertNoPlaintext(t, dbPath, "Platform Team", "BEGIN PUBLIC KEY", "internal.example", "other.example")
+
+	if _, err := EncryptPinStore(dbPath, key); !errors.Is(err, ErrPinStoreEncrypted) {
+		t.Errorf("Expected encrypting twice to fail with ErrPinStoreEncrypted, got %v", err)
+	}
+
+	k, err = NewKeyPinning(dbPath, PinningModeAutomatic, nil, WithStoreEncryption(key))
+	if err != nil {
+		t.Fatalf("Failed to open the migrated database: %v", err)
+	}
+	defer k.Close()
+	after, err := k.ListPinnedKeyInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(after) != fmt.Sprint(before) {
+		t.Errorf("Pins changed in migration:\nbefore %+v\nafter  %+v", before, after)
+	}
+	if got, err := k.GetPinnedKey("internal.example/deploy"); err != nil || got != publicKeyPEM {
+		t.Errorf("GetPinnedKey after migration = %q, %v", got, err)
+	}
+	if got, err := k.GetPinnedKey("internal.example/billing/invoice"); err != nil || got != namespaceKeyPEM {
+		t.Errorf("Expected the namespace pin to apply after migration, got %q, %v", got, err)
+	}
+	if got := k.GetDomainPolicy("other.example"); got != PinningPolicyAlwaysTrust {
+		t.Errorf("Expected the domain policy to survive, got %s", got)
+	}
+}
+
+func TestEncryptPinStoreIsTransactional(t *testing.T) {
+	publicKeyPEM, _ := generateTestKeyPEM(t)
+	dbPath := createTempDB(t)
+	k, err := NewKeyPinning(dbPath, PinningModeAutomatic, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := k.PinKey("tool", publicKeyPEM, "example.com", ""); err != nil {
+		t.Fatal(err)
+	}
+	k.Close()
+	putRaw(t, dbPath, pinnedKeysBucket, "garbled", "{not json")
+
+	if _, err := EncryptPinStore(dbPath, testStoreKey(t, 4)); err == nil {
+		t.Fatal("Expected a database with an undecodable pin not to be encrypted")
+	}
+	k, err = NewKeyPinning(dbPath, PinningModeAutomatic, nil)
+	if err != nil {
+		t.Fatalf("Expected the database to remain plaintext, got %v", err)
+	}
+	defer k.Close()
+	if got, err := k.GetPinnedKey("tool"); err != nil || got != publicKeyPEM {
+		t.Errorf("Expected the plaintext pin to be intact, got %q, %v", got, err)
+	}
+}
+
+func TestStoreEncryptionExportImport(t *testing.T) {
+	publicKeyPEM, _ := generateTestKeyPEM(t)
+	src, err := NewKeyPinning(createTempDB(t), PinningModeAutomatic, nil, WithStoreEncryption(testStoreKey(t, 5)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer src.Close()
+	if err := src.PinKey("export.example/tool", publicKeyPEM, "export.example", "Exporter"); err != nil {
+		t.Fatal(err)
+	}
+	exported, err := src.ExportPinnedKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains([]byte(exported), []byte(`"tool_id": "export.example/tool"`)) {
+		t.Errorf("Expected a plaintext export, got %s", exported)
+	}
+
+	dstPath := createTempDB(t)
+	dst, err := NewKeyPinning(dstPath, PinningModeAutomatic, nil, WithStoreEncryption(testStoreKey(t, 6)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := dst.ImportPinnedKeysFrom(exported, false, "export.json")
+	if err != nil || n != 1 {
+		t.Fatalf("Import = %d, %v", n, err)
+	}
+	if got, err := dst.GetPinnedKey("export.example/tool"); err != nil || got != publicKeyPEM {
+		t.Errorf("GetPinnedKey after import = %q, %v", got, err)
+	}
+	dst.Close()
+	assertNoPlaintext(t, dstPath, "export.example", "Exporter")
+}
+
+func TestStoreEncryptionRepair(t *testing.T) {
+	publicKeyPEM, _ := generateTestKeyPEM(t)
+	dbPath := createTempDB(t)
+	key := testStoreKey(t, 7)
+	k, err := NewKeyPinning(dbPath, PinningModeAutomatic, nil, WithStoreEncryption(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := k.PinKey("tool", publicKeyPEM, "example.com", ""); err != nil {
+		t.Fatal(err)
+	}
+	k.Close()
+
+	report, err := RepairDatabase(dbPath, WithStoreEncryption(key))
+	if err != nil {
+		t.Fatalf("RepairDatabase failed: %v", err)
+	}
+	if report.Recovered[string(pinnedKeysBucket)] != 1 || report.Recovered[string(pinIndexBucket)] != 1 || len(report.Lost) != 0 {
+		t.Errorf("Expected the encrypted pin to be recovered, got %+v", report)
+	}
+	k, err = NewKeyPinning(dbPath, PinningModeAutomatic, nil, WithStoreEncryption(key))
+	if err != nil {
+		t.Fatalf("Failed to open the repaired database: %v", err)
+	}
+	defer k.Close()
+	if got, err := k.GetPinnedKey("tool"); err != nil || got != publicKeyPEM {
+		t.Errorf("GetPinnedKey after repair = %q, %v", got, err)
+	}
+}
+
+// BenchmarkGetPinnedKey measures a pin lookup among 1000 pins in a
+// plaintext and an encrypted database.
+func BenchmarkGetPinnedKey(b *testing.B) {
+	publicKeyPEM, _ := generateTestKeyPEM(b)
+	for _, bm := range []struct {
+		name string
+		opts []Option
+	}{
+		{"plaintext", nil},
+		{"encrypted", []Option{WithStoreEncryption(testStoreKey(b, 1))}},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			k, err := NewKeyPinning(filepath.Join(b.TempDir(), "bench.db"), PinningModeAutomatic, nil, bm.opts...)
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer k.Close()
+			for i := 0; i < 1000; i++ {
+				if err := k.PinKey(fmt.Sprintf("example.com/tool-%d", i), publicKeyPEM, "example.com", "Dev"); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := k.GetPinnedKey("example.com/tool-500"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package pinning
+
+import (
+	"sort"
+	"strings"
+
+	"go.etcd.io/bbolt"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/interactive"
+)
+
+// DomainHistory summarizes the pins of domain's tools other than toolID
+// for a prompt about publicKeyPEM: how many there are, how many are pinned
+// to publicKeyPEM and, when currentKeyPEM is the key a key change would
+// replace, how many still pin it. A namespace pin covering toolID is the
+// tool's own pin and is left out. The pins are read in one transaction.
+func (k *KeyPinning) DomainHistory(domain, toolID, publicKeyPEM, currentKeyPEM string) (*interactive.DomainHistory, error) {
+	fingerprint := fingerprintOf(publicKeyPEM)
+	currentFingerprint := fingerprintOf(currentKeyPEM)
+	history := &interactive.DomainHistory{}
+	var toolIDs []string
+
+	err := k.db.View(func(tx *bbolt.Tx) error {
+		return k.pins(tx).forEach(func(info PinnedKeyInfo) error {
+			if info.Domain != domain || info.ToolID == toolID || (info.Namespace && strings.HasPrefix(toolID, info.ToolID)) {
+				return nil
+			}
+			history.PinnedTools++
+			if pinMatchesKey(info, publicKeyPEM, fingerprint) {
+				history.MatchingKey++
+			}
+			if currentKeyPEM != "" && pinMatchesKey(info, currentKeyPEM, currentFingerprint) {
+				history.CurrentKey++
+			}
+			if history.FirstPinnedAt.IsZero() || info.PinnedAt.Before(history.FirstPinnedAt) {
+				history.FirstPinnedAt = info.PinnedAt
+			}
+			if info.PinnedAt.After(history.LastPinnedAt) {
+				history.LastPinnedAt = info.PinnedAt
+			}
+			toolIDs = append(toolIDs, info.ToolID)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Encrypted pins are stored in the order of their index
+	sort.Strings(toolIDs)
+	if len(toolIDs) > interactive.DomainHistoryToolLimit {
+		toolIDs = toolIDs[:interactive.DomainHistoryToolLimit]
+	}
+	history.ToolIDs = toolIDs
+	return history, nil
+}
+
+// pinMatchesKey reports whether info pins publicKeyPEM, whose fingerprint
+// is fingerprint: by its key, or for a fingerprint-only pin by fingerprint.
+func pinMatchesKey(info PinnedKeyInfo, publicKeyPEM, fingerprint string) bool {
+	if info.PublicKeyPEM != "" {
+		return crypto.PublicKeyPEMEqual(info.PublicKeyPEM, publicKeyPEM)
+	}
+	return fingerprint != "" && crypto.FingerprintEqual(info.Fingerprint, fingerprint)
+}
@@ -0,0 +1,147 @@
+package pinning
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/interactive"
+)
+
+// historyPinning opens a database in interactive mode whose prompts are
+// recorded in prompts and rejected, with three tools of vendor.invalid
+// pinned to vendorKey a day apart from March 2 and one tool of
+// other.invalid.
+func historyPinning(t *testing.T, vendorKey, otherKey string, prompts *[]*interactive.PromptContext) *KeyPinning {
+	t.Helper()
+	handler := interactive.NewCallbackInteractiveHandler(func(ctx *interactive.PromptContext) (interactive.UserDecision, error) {
+		*prompts = append(*prompts, ctx)
+		return interactive.UserDecisionReject, nil
+	}, nil, nil)
+	fake := clock.NewFake(time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC))
+	k, err := NewKeyPinning(createTempDB(t), PinningModeInteractive, handler, WithClock(fake))
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	t.Cleanup(func() { k.Close() })
+
+	for _, toolID := range []string{"search", "fetch", "crawl"} {
+		if err := k.PinKey(toolID, vendorKey, "vendor.invalid", "Vendor"); err != nil {
+			t.Fatal(err)
+		}
+		fake.Advance(24 * time.Hour)
+	}
+	if err := k.PinKey("other-tool", otherKey, "other.invalid", "Other"); err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+func TestPromptDomainHistory(t *testing.T) {
+	vendorKey := seededKeyPEM(t, "history/vendor")
+	otherKey := seededKeyPEM(t, "history/other")
+	first := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	last := first.Add(48 * time.Hour)
+
+	tests := []struct {
+		name       string
+		toolID     string
+		key        string
+		domain     string
+		promptType interactive.PromptType
+		want       interactive.DomainHistory
+	}{
+		{
+			name:       "first use with the domain's key",
+			toolID:     "summarize",
+			key:        vendorKey,
+			domain:     "vendor.invalid",
+			promptType: interactive.PromptTypeFirstTimeKey,
+			want: interactive.DomainHistory{
+				PinnedTools: 3, MatchingKey: 3, FirstPinnedAt: first, LastPinnedAt: last,
+				ToolIDs: []string{"crawl", "fetch", "search"},
+			},
+		},
+		{
+			name:       "first use with another key",
+			toolID:     "summarize",
+			key:        otherKey,
+			domain:     "vendor.invalid",
+			promptType: interactive.PromptTypeFirstTimeKey,
+			want: interactive.DomainHistory{
+				PinnedTools: 3, FirstPinnedAt: first, LastPinnedAt: last,
+				ToolIDs: []string{"crawl", "fetch", "search"},
+			},
+		},
+		{
+			name:       "key change while other tools pin the old key",
+			toolID:     "search",
+			key:        otherKey,
+			domain:     "vendor.invalid",
+			promptType: interactive.PromptTypeKeyChange,
+			want: interactive.DomainHistory{
+				PinnedTools: 2, CurrentKey: 2, FirstPinnedAt: first.Add(24 * time.Hour), LastPinnedAt: last,
+				ToolIDs: []string{"crawl", "fetch"},
+			},
+		},
+		{
+			name:       "first use on a domain without pins",
+			toolID:     "new-tool",
+			key:        vendorKey,
+			domain:     "new.invalid",
+			promptType: interactive.PromptTypeFirstTimeKey,
+			want:       interactive.DomainHistory{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var prompts []*interactive.PromptContext
+			k := historyPinning(t, vendorKey, otherKey, &prompts)
+
+			if accepted, err := k.InteractivePinKey(tt.toolID, tt.key, tt.domain, "Vendor"); err != nil || accepted {
+				t.Fatalf("Expected the key to be rejected, got %v, %v", accepted, err)
+			}
+			if len(prompts) != 1 || prompts[0].PromptType != tt.promptType {
+				t.Fatalf("Expected one %s prompt, got %+v", tt.promptType, prompts)
+			}
+			history := prompts[0].DomainHistory
+			if history == nil {
+				t.Fatal("Expected the prompt to carry a domain history")
+			}
+			if !reflect.DeepEqual(*history, tt.want) {
+				t.Errorf("Expected history %+v, got %+v", tt.want, *history)
+			}
+		})
+	}
+}
+
+func TestDomainHistoryLimitsToolIDs(t *testing.T) {
+	key := seededKeyPEM(t, "history/vendor")
+	k, err := NewKeyPinning(createTempDB(t), PinningModeAutomatic, nil)
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	defer k.Close()
+
+	for _, toolID := range []string{"g", "f", "e", "d", "c", "b", "a"} {
+		if err := k.PinKey(toolID, key, "vendor.invalid", "Vendor"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := k.PinKeyForNamespace("ns/", key, "vendor.invalid", "Vendor"); err != nil {
+		t.Fatal(err)
+	}
+
+	// The namespace pin covering the tool is its own and not counted
+	history, err := k.DomainHistory("vendor.invalid", "ns/tool", key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history.PinnedTools != 7 || !history.AllMatch() {
+		t.Errorf("Expected 7 tools all pinned to the key, got %+v", history)
+	}
+	if want := []string{"a", "b", "c", "d", "e"}; !reflect.DeepEqual(history.ToolIDs, want) {
+		t.Errorf("Expected tool IDs %v, got %v", want, history.ToolIDs)
+	}
+}
@@ -0,0 +1,413 @@
+package pinning
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.etcd.io/bbolt"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+)
+
+// ImportLimits bounds what ImportPinnedKeys accepts from an export file.
+// Zero fields take the value from DefaultImportLimits.
+type ImportLimits struct {
+	// MaxBytes is the maximum size of the export document.
+	MaxBytes int
+	// MaxEntries is the maximum number of pins in the document.
+	MaxEntries int
+	// MaxFieldLength is the maximum length of the tool ID, domain,
+	// developer name and key scope of an entry.
+	MaxFieldLength int
+	// MaxPEMLength is the maximum length of an entry's public key PEM.
+	MaxPEMLength int
+}
+
+// DefaultImportLimits are the limits used for fields left zero in
+// ImportOptions.Limits.
+var DefaultImportLimits = ImportLimits{
+	MaxBytes:       16 << 20,
+	MaxEntries:     10000,
+	MaxFieldLength: 512,
+	MaxPEMLength:   4096,
+}
+
+// ImportOptions configures ImportPinnedKeys.
+type ImportOptions struct {
+	Limits ImportLimits
+	// Overwrite lists the tool IDs whose existing pin may be replaced by a
+	// different key from the file. Conflicts for other tools are reported
+	// and left alone.
+	Overwrite []string
+	// Source is recorded as the source detail of every imported pin,
+	// typically the path of the export file.
+	Source string
+	// DryRun validates the file and reports what would be imported without
+	// writing anything.
+	DryRun bool
+}
+
+// ImportIssue describes an entry of an export file that was skipped,
+// rejected or adjusted. Index is the position of the entry in the file.
+type ImportIssue struct {
+	Index  int    `json:"index"`
+	ToolID string `json:"tool_id,omitempty"`
+	Reason string `json:"reason"`
+}
+
+// ImportConflict is an entry whose key differs from the key already pinned
+// for the tool.
+type ImportConflict struct {
+	Index               int    `json:"index"`
+	ToolID              string `json:"tool_id"`
+	Domain              string `json:"domain,omitempty"`
+	ExistingFingerprint string `json:"existing_fingerprint"`
+	ImportedFingerprint string `json:"imported_fingerprint"`
+	// Overwritten reports whether the tool was listed in
+	// ImportOptions.Overwrite and the existing pin replaced.
+	Overwritten bool `json:"overwritten"`
+}
+
+// ImportReport is the outcome of ImportPinnedKeys. Imported lists the tool
+// IDs pinned from the file, including overwritten conflicts; Errors lists
+// entries rejected as invalid and Warnings entries imported with
+// sanitized values.
+type ImportReport struct {
+	DryRun    bool             `json:"dry_run,omitempty"`
+	Imported  []string         `json:"imported"`
+	Skipped   []ImportIssue    `json:"skipped"`
+	Conflicts []ImportConflict `json:"conflicts"`
+	Errors    []ImportIssue    `json:"errors"`
+	Warnings  []ImportIssue    `json:"warnings"`
+}
+
+// ImportLimitError is returned when an export file exceeds ImportLimits as
+// a whole. Nothing is imported.
+type ImportLimitError struct {
+	Limit string
+	Max   int
+}
+
+func (e *ImportLimitError) Error() string {
+	return fmt.Sprintf("import file exceeds the limit of %d %s", e.Max, e.Limit)
+}
+
+// importEntry is an entry of an export file. Only the identity of the pin
+// is read: provenance and verification statistics start afresh, and
+// pinned_at is kept as text so that it can be sanitized.
+type importEntry struct {
+	ToolID        string `json:"tool_id"`
+	Namespace     bool   `json:"namespace"`
+	PublicKeyPEM  string `json:"public_key_pem"`
+	Fingerprint   string `json:"fingerprint"`
+	Domain        string `json:"domain"`
+	DeveloperName string `json:"developer_name"`
+	KeyScope      string `json:"key_scope"`
+	PinnedAt      string `json:"pinned_at"`
+}
+
+var fingerprintPattern = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+
+// ImportPinnedKeysFrom is ImportPinnedKeys with source as the source
+// detail, returning the number of keys imported. With overwrite, every
+// tool in the document may replace its existing pin; without it,
+// conflicting pins are left alone.
+func (k *KeyPinning) ImportPinnedKeysFrom(jsonData string, overwrite bool, source string) (int, error) {
+	opts := ImportOptions{Source: source}
+	if overwrite && len(jsonData) <= DefaultImportLimits.MaxBytes {
+		// A malformed document is reported by ImportPinnedKeys
+		var entries []importEntry
+		_ = json.Unmarshal([]byte(jsonData), &entries)
+		for _, entry := range entries {
+			opts.Overwrite = append(opts.Overwrite, entry.ToolID)
+		}
+	}
+	report, err := k.ImportPinnedKeys(jsonData, opts)
+	if err != nil {
+		return 0, err
+	}
+	return len(report.Imported), nil
+}
+
+// ImportPinnedKeys imports pins from a document produced by
+// ExportPinnedKeys. The document is rejected as a whole if it exceeds the
+// configured limits or is not a JSON array; otherwise each entry is
+// validated on its own:
+//
+//   - fields must be within length limits and free of control characters
+//   - the public key PEM must parse, and a fingerprint given with it must
+//     match; an entry without a PEM needs a well-formed fingerprint
+//   - a namespace pin needs a public key PEM and a tool ID ending in "/"
+//   - entries repeating a tool ID with the same key are skipped, and all
+//     entries of a tool listed with different keys are rejected
+//   - a tool already pinned to the same key is skipped, and one pinned to a
+//     different key is a conflict, replaced only if listed in opts.Overwrite
+//
+// A pinned_at that is missing, malformed or in the future is replaced by
+// the current time, with a warning unless it was missing. Imported pins
+// are recorded as ProvenanceImport with opts.Source as their source detail
+// and start with fresh verification statistics. All accepted entries are
+// written in one transaction.
+func (k *KeyPinning) ImportPinnedKeys(jsonData string, opts ImportOptions) (*ImportReport, error) {
+	if k.readOnly && !opts.DryRun {
+		return nil, ErrReadOnlyPinStore
+	}
+	limits := opts.Limits.withDefaults()
+	if len(jsonData) > limits.MaxBytes {
+		return nil, &ImportLimitError{Limit: "bytes", Max: limits.MaxBytes}
+	}
+	raw, err := decodeImportEntries(jsonData, limits.MaxEntries)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ImportReport{DryRun: opts.DryRun}
+	now := clock.Timestamp(k.clock.Now())
+
+	// Validate every entry, then group them by tool to find duplicates
+	valid := make(map[int]PinnedKeyInfo)
+	byTool := make(map[string][]int)
+	var order []string
+	for i, data := range raw {
+		var entry importEntry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			report.Errors = append(report.Errors, ImportIssue{Index: i, Reason: fmt.Sprintf("invalid entry: %v", err)})
+			continue
+		}
+		keyInfo, reason := entry.validate(limits)
+		if reason != "" {
+			report.Errors = append(report.Errors, ImportIssue{Index: i, ToolID: printableToolID(entry.ToolID, limits), Reason: reason})
+			continue
+		}
+		keyInfo.PinnedAt, reason = sanitizeImportTime("pinned_at", entry.PinnedAt, now)
+		if reason != "" {
+			report.Warnings = append(report.Warnings, ImportIssue{Index: i, ToolID: keyInfo.ToolID, Reason: reason})
+		}
+		keyInfo.Provenance = ProvenanceImport
+		keyInfo.SourceDetail = opts.Source
+		valid[i] = keyInfo
+		if _, seen := byTool[keyInfo.ToolID]; !seen {
+			order = append(order, keyInfo.ToolID)
+		}
+		byTool[keyInfo.ToolID] = append(byTool[keyInfo.ToolID], i)
+	}
+
+	overwrite := make(map[string]bool, len(opts.Overwrite))
+	for _, toolID := range opts.Overwrite {
+		overwrite[toolID] = true
+	}
+
+	var accepted []PinnedKeyInfo
+	for _, toolID := range order {
+		indexes := byTool[toolID]
+		first := valid[indexes[0]]
+		if conflictingEntries(valid, indexes) {
+			for _, i := range indexes {
+				report.Errors = append(report.Errors, ImportIssue{Index: i, ToolID: toolID, Reason: "tool is listed with different keys in the import file"})
+			}
+			continue
+		}
+		for _, i := range indexes[1:] {
+			report.Skipped = append(report.Skipped, ImportIssue{Index: i, ToolID: toolID, Reason: "duplicate entry in the import file"})
+		}
+
+		existing, err := k.GetKeyInfo(toolID)
+		if err != nil {
+			return nil, err
+		}
+		if existing != nil {
+			existingFingerprint := existing.Fingerprint
+			if existingFingerprint == "" {
+				existingFingerprint = fingerprintOf(existing.PublicKeyPEM)
+			}
+			if crypto.FingerprintEqual(existingFingerprint, first.Fingerprint) {
+				report.Skipped = append(report.Skipped, ImportIssue{Index: indexes[0], ToolID: toolID, Reason: "already pinned to the same key"})
+				continue
+			}
+			conflict := ImportConflict{
+				Index:               indexes[0],
+				ToolID:              toolID,
+				Domain:              first.Domain,
+				ExistingFingerprint: existingFingerprint,
+				ImportedFingerprint: first.Fingerprint,
+				Overwritten:         overwrite[toolID],
+			}
+			report.Conflicts = append(report.Conflicts, conflict)
+			if !conflict.Overwritten {
+				continue
+			}
+		}
+		accepted = append(accepted, first)
+		report.Imported = append(report.Imported, toolID)
+	}
+
+	if opts.DryRun || len(accepted) == 0 {
+		return report, nil
+	}
+	err = k.update(func(tx *bbolt.Tx) error {
+		pins := k.pins(tx)
+		for _, keyInfo := range accepted {
+			keyInfo := keyInfo
+			if err := pins.put(keyInfo.ToolID, &keyInfo); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to import pinned keys: %w", err)
+	}
+	k.logger.Info("pinned keys imported",
+		"source_detail", opts.Source,
+		"imported", len(report.Imported),
+		"skipped", len(report.Skipped),
+		"conflicts", len(report.Conflicts),
+		"errors", len(report.Errors))
+	return report, nil
+}
+
+func (l ImportLimits) withDefaults() ImportLimits {
+	if l.MaxBytes <= 0 {
+		l.MaxBytes = DefaultImportLimits.MaxBytes
+	}
+	if l.MaxEntries <= 0 {
+		l.MaxEntries = DefaultImportLimits.MaxEntries
+	}
+	if l.MaxFieldLength <= 0 {
+		l.MaxFieldLength = DefaultImportLimits.MaxFieldLength
+	}
+	if l.MaxPEMLength <= 0 {
+		l.MaxPEMLength = DefaultImportLimits.MaxPEMLength
+	}
+	return l
+}
+
+// decodeImportEntries splits the export array into its entries, stopping
+// as soon as there are more than maxEntries.
+func decodeImportEntries(jsonData string, maxEntries int) ([]json.RawMessage, error) {
+	dec := json.NewDecoder(strings.NewReader(jsonData))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+		return nil, fmt.Errorf("failed to unmarshal JSON data: expected an array of pinned keys")
+	}
+	var entries []json.RawMessage
+	for dec.More() {
+		if len(entries) == maxEntries {
+			return nil, &ImportLimitError{Limit: "entries", Max: maxEntries}
+		}
+		var entry json.RawMessage
+		if err := dec.Decode(&entry); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal JSON data: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if _, err := dec.Token(); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON data: %w", err)
+	}
+	if _, err := dec.Token(); err == nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON data: unexpected data after the array")
+	}
+	return entries, nil
+}
+
+// validate checks an entry and returns the pin it describes, with its
+// fingerprint filled in, or the reason it was rejected.
+func (e importEntry) validate(limits ImportLimits) (PinnedKeyInfo, string) {
+	if e.ToolID == "" {
+		return PinnedKeyInfo{}, "tool_id is required"
+	}
+	fields := []struct{ name, value string }{
+		{"tool_id", e.ToolID},
+		{"domain", e.Domain},
+		{"developer_name", e.DeveloperName},
+		{"key_scope", e.KeyScope},
+	}
+	for _, field := range fields {
+		if len(field.value) > limits.MaxFieldLength {
+			return PinnedKeyInfo{}, fmt.Sprintf("%s exceeds %d bytes", field.name, limits.MaxFieldLength)
+		}
+		if strings.IndexFunc(field.value, unicode.IsControl) >= 0 {
+			return PinnedKeyInfo{}, fmt.Sprintf("%s contains control characters", field.name)
+		}
+	}
+
+	if e.Namespace && (!strings.HasSuffix(e.ToolID, "/") || strings.Trim(e.ToolID, "/") == "") {
+		return PinnedKeyInfo{}, "tool_id of a namespace pin must end in \"/\""
+	}
+	if e.Namespace && e.PublicKeyPEM == "" {
+		return PinnedKeyInfo{}, "public_key_pem is required for a namespace pin"
+	}
+
+	keyInfo := PinnedKeyInfo{
+		ToolID:        e.ToolID,
+		Namespace:     e.Namespace,
+		Domain:        e.Domain,
+		DeveloperName: e.DeveloperName,
+		KeyScope:      e.KeyScope,
+	}
+	fingerprint := strings.ToLower(e.Fingerprint)
+	switch {
+	case e.PublicKeyPEM != "":
+		if len(e.PublicKeyPEM) > limits.MaxPEMLength {
+			return PinnedKeyInfo{}, fmt.Sprintf("public_key_pem exceeds %d bytes", limits.MaxPEMLength)
+		}
+		computed, err := crypto.NewKeyManager().CalculateKeyFingerprintFromPEM(e.PublicKeyPEM)
+		if err != nil {
+			return PinnedKeyInfo{}, fmt.Sprintf("invalid public_key_pem: %v", err)
+		}
+		if fingerprint != "" && !crypto.FingerprintEqual(fingerprint, computed) {
+			return PinnedKeyInfo{}, "fingerprint does not match public_key_pem"
+		}
+		keyInfo.PublicKeyPEM = e.PublicKeyPEM
+		keyInfo.Fingerprint = computed
+	case fingerprint != "":
+		if !fingerprintPattern.MatchString(fingerprint) {
+			return PinnedKeyInfo{}, "fingerprint must be \"sha256:\" followed by 64 hex digits"
+		}
+		keyInfo.Fingerprint = fingerprint
+	default:
+		return PinnedKeyInfo{}, "one of public_key_pem or fingerprint is required"
+	}
+	return keyInfo, ""
+}
+
+// sanitizeImportTime returns the time recorded in the file for field, or
+// now and the reason a bad one was replaced.
+func sanitizeImportTime(field, value string, now time.Time) (time.Time, string) {
+	if value == "" {
+		return now, ""
+	}
+	recorded, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil || recorded.IsZero() {
+		return now, field + " malformed, set to the import time"
+	}
+	if recorded.After(now) {
+		return now, field + " in the future, set to the import time"
+	}
+	return clock.Timestamp(recorded), ""
+}
+
+// conflictingEntries reports whether the entries at indexes disagree on the
+// key or domain of their tool, or on whether it is a namespace.
+func conflictingEntries(valid map[int]PinnedKeyInfo, indexes []int) bool {
+	first := valid[indexes[0]]
+	for _, i := range indexes[1:] {
+		other := valid[i]
+		if !crypto.FingerprintEqual(other.Fingerprint, first.Fingerprint) || other.Domain != first.Domain || other.Namespace != first.Namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// printableToolID returns toolID for a report if it is safe to display.
+func printableToolID(toolID string, limits ImportLimits) string {
+	if len(toolID) > limits.MaxFieldLength || strings.IndexFunc(toolID, unicode.IsControl) >= 0 {
+		return ""
+	}
+	return toolID
+}
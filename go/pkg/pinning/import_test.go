@@ -0,0 +1,291 @@
+package pinning
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+)
+
+func TestImportPinnedKeysRoundTrip(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC))
+	source, err := NewKeyPinning(createTempDB(t), PinningModeAutomatic, nil, WithClock(fake))
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	defer source.Close()
+
+	key1, fingerprint1 := generateTestKeyPEM(t)
+	key2, _ := generateTestKeyPEM(t)
+	if err := source.PinKeyWithScope("tool1", key1, "example.com", "Dev 1", "tools/a"); err != nil {
+		t.Fatalf("Failed to pin key: %v", err)
+	}
+	if err := source.PinKey("tool2", key2, "test.com", "Dev 2"); err != nil {
+		t.Fatalf("Failed to pin key: %v", err)
+	}
+	if err := source.UpdateLastVerified("tool1", true); err != nil {
+		t.Fatalf("Failed to record verification: %v", err)
+	}
+	exported, err := source.ExportPinnedKeys()
+	if err != nil {
+		t.Fatalf("Failed to export keys: %v", err)
+	}
+
+	fake.Advance(time.Hour)
+	target, err := NewKeyPinning(createTempDB(t), PinningModeAutomatic, nil, WithClock(fake))
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	defer target.Close()
+
+	// A dry run reports the import without writing it
+	report, err := target.ImportPinnedKeys(exported, ImportOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("Failed to import keys: %v", err)
+	}
+	if !report.DryRun || len(report.Imported) != 2 {
+		t.Errorf("Expected a dry run importing two keys, got %+v", report)
+	}
+	if target.IsKeyPinned("tool1") {
+		t.Fatal("Expected the dry run not to pin anything")
+	}
+
+	report, err = target.ImportPinnedKeys(exported, ImportOptions{Source: "pins.json"})
+	if err != nil {
+		t.Fatalf("Failed to import keys: %v", err)
+	}
+	if strings.Join(report.Imported, ",") != "tool1,tool2" {
+		t.Errorf("Expected tool1 and tool2 imported, got %v", report.Imported)
+	}
+	if len(report.Skipped)+len(report.Conflicts)+len(report.Errors)+len(report.Warnings) != 0 {
+		t.Errorf("Expected a clean report, got %+v", report)
+	}
+
+	info, err := target.GetKeyInfo("tool1")
+	if err != nil || info == nil {
+		t.Fatalf("Expected tool1 to be pinned, got %v, %v", info, err)
+	}
+	if info.PublicKeyPEM != key1 || info.Fingerprint != fingerprint1 || info.KeyScope != "tools/a" {
+		t.Errorf("Unexpected imported key: %+v", info)
+	}
+	if !info.PinnedAt.Equal(clock.Timestamp(fake.Now().Add(-time.Hour))) {
+		t.Errorf("Expected the exported pin time to be kept, got %v", info.PinnedAt)
+	}
+	if info.VerificationCount != 0 || !info.LastVerified.IsZero() {
+		t.Errorf("Expected verification statistics to start afresh, got %+v", info)
+	}
+
+	// Importing the same file again changes nothing
+	report, err = target.ImportPinnedKeys(exported, ImportOptions{})
+	if err != nil {
+		t.Fatalf("Failed to import keys: %v", err)
+	}
+	if len(report.Imported) != 0 || len(report.Skipped) != 2 {
+		t.Errorf("Expected both keys skipped as already pinned, got %+v", report)
+	}
+}
+
+func TestImportPinnedKeysConflicts(t *testing.T) {
+	pinning, err := NewKeyPinning(createTempDB(t), PinningModeAutomatic, nil)
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	defer pinning.Close()
+
+	pinnedKey, pinnedFingerprint := generateTestKeyPEM(t)
+	otherKey, otherFingerprint := generateTestKeyPEM(t)
+	thirdKey, _ := generateTestKeyPEM(t)
+	for _, toolID := range []string{"tool1", "tool2"} {
+		if err := pinning.PinKey(toolID, pinnedKey, "example.com", "Dev"); err != nil {
+			t.Fatalf("Failed to pin key: %v", err)
+		}
+	}
+
+	entries := []map[string]string{
+		{"tool_id": "tool1", "public_key_pem": otherKey, "domain": "example.com"},
+		{"tool_id": "tool2", "public_key_pem": otherKey, "domain": "example.com"},
+		{"tool_id": "dup", "public_key_pem": otherKey, "domain": "example.com"},
+		{"tool_id": "dup", "public_key_pem": thirdKey, "domain": "example.com"},
+	}
+	data, _ := json.Marshal(entries)
+
+	report, err := pinning.ImportPinnedKeys(string(data), ImportOptions{Overwrite: []string{"tool2"}})
+	if err != nil {
+		t.Fatalf("Failed to import keys: %v", err)
+	}
+	if len(report.Conflicts) != 2 {
+		t.Fatalf("Expected two conflicts, got %+v", report.Conflicts)
+	}
+	for _, conflict := range report.Conflicts {
+		if conflict.ExistingFingerprint != pinnedFingerprint || conflict.ImportedFingerprint != otherFingerprint {
+			t.Errorf("Unexpected fingerprints in conflict: %+v", conflict)
+		}
+		if conflict.Overwritten != (conflict.ToolID == "tool2") {
+			t.Errorf("Expected only tool2 to be overwritten, got %+v", conflict)
+		}
+	}
+	if strings.Join(report.Imported, ",") != "tool2" {
+		t.Errorf("Expected only tool2 imported, got %v", report.Imported)
+	}
+	if len(report.Errors) != 2 || report.Errors[0].ToolID != "dup" || report.Errors[1].ToolID != "dup" {
+		t.Errorf("Expected both conflicting dup entries rejected, got %+v", report.Errors)
+	}
+
+	if key, _ := pinning.GetPinnedKey("tool1"); key != pinnedKey {
+		t.Error("Expected tool1 to keep its pinned key")
+	}
+	if key, _ := pinning.GetPinnedKey("tool2"); key != otherKey {
+		t.Error("Expected tool2 to be overwritten")
+	}
+	if pinning.IsKeyPinned("dup") {
+		t.Error("Expected dup not to be pinned")
+	}
+}
+
+func TestImportPinnedKeysFrom(t *testing.T) {
+	pinning, err := NewKeyPinning(createTempDB(t), PinningModeAutomatic, nil)
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	defer pinning.Close()
+
+	pinnedKey, _ := generateTestKeyPEM(t)
+	otherKey, _ := generateTestKeyPEM(t)
+	if err := pinning.PinKey("tool1", pinnedKey, "example.com", "Dev"); err != nil {
+		t.Fatalf("Failed to pin key: %v", err)
+	}
+	entries := []map[string]string{
+		{"tool_id": "tool1", "public_key_pem": otherKey, "domain": "example.com"},
+		{"tool_id": "tool2", "public_key_pem": otherKey, "domain": "example.com"},
+	}
+	data, _ := json.Marshal(entries)
+
+	if n, err := pinning.ImportPinnedKeysFrom(string(data), false, "pins.json"); err != nil || n != 1 {
+		t.Fatalf("Expected one key imported without overwrite, got %d, %v", n, err)
+	}
+	if key, _ := pinning.GetPinnedKey("tool1"); key != pinnedKey {
+		t.Error("Expected tool1 to keep its pinned key without overwrite")
+	}
+
+	if n, err := pinning.ImportPinnedKeysFrom(string(data), true, "pins.json"); err != nil || n != 1 {
+		t.Fatalf("Expected the conflicting key imported with overwrite, got %d, %v", n, err)
+	}
+	if key, _ := pinning.GetPinnedKey("tool1"); key != otherKey {
+		t.Error("Expected tool1 to be overwritten")
+	}
+	info, _ := pinning.GetKeyInfo("tool2")
+	if info == nil || info.Provenance != ProvenanceImport || info.SourceDetail != "pins.json" {
+		t.Errorf("Expected tool2 imported from pins.json, got %+v", info)
+	}
+
+	if _, err := pinning.ImportPinnedKeysFrom("not json", true, ""); err == nil {
+		t.Error("Expected a malformed document to be rejected")
+	}
+}
+
+func TestImportPinnedKeysInvalidEntries(t *testing.T) {
+	pinning, err := NewKeyPinning(createTempDB(t), PinningModeAutomatic, nil)
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	defer pinning.Close()
+
+	key, fingerprint := generateTestKeyPEM(t)
+	_, otherFingerprint := generateTestKeyPEM(t)
+	future := clock.Format(time.Now().Add(24 * time.Hour))
+	data := fmt.Sprintf(`[
+		{"tool_id": "", "public_key_pem": %[1]q},
+		{"tool_id": "bad-pem", "public_key_pem": "not a key"},
+		{"tool_id": "mismatch", "public_key_pem": %[1]q, "fingerprint": %[2]q},
+		{"tool_id": "bad-fingerprint", "fingerprint": "sha256:abcd"},
+		{"tool_id": "control\u0007", "public_key_pem": %[1]q},
+		{"tool_id": %[3]q, "public_key_pem": %[1]q},
+		{"tool_id": 42},
+		{"tool_id": "fingerprint-only", "fingerprint": %[4]q, "domain": "example.com", "pinned_at": "yesterday"},
+		{"tool_id": "future", "public_key_pem": %[1]q, "pinned_at": %[5]q},
+		{"tool_id": "dup", "public_key_pem": %[1]q},
+		{"tool_id": "dup", "public_key_pem": %[1]q}
+	]`, key, otherFingerprint, strings.Repeat("x", 600), strings.ToUpper(fingerprint), future)
+
+	report, err := pinning.ImportPinnedKeys(data, ImportOptions{})
+	if err != nil {
+		t.Fatalf("Failed to import keys: %v", err)
+	}
+	if strings.Join(report.Imported, ",") != "fingerprint-only,future,dup" {
+		t.Errorf("Unexpected imports: %v", report.Imported)
+	}
+	if len(report.Errors) != 7 {
+		t.Errorf("Expected seven rejected entries, got %+v", report.Errors)
+	}
+	for _, issue := range report.Errors {
+		if issue.Index == 5 && issue.ToolID != "" {
+			t.Errorf("Expected the oversized tool ID to be left out of the report, got %+v", issue)
+		}
+	}
+	if len(report.Skipped) != 1 || report.Skipped[0].Index != 10 {
+		t.Errorf("Expected the duplicate entry skipped, got %+v", report.Skipped)
+	}
+	if len(report.Warnings) != 2 {
+		t.Errorf("Expected pinned_at warnings for two entries, got %+v", report.Warnings)
+	}
+
+	info, err := pinning.GetKeyInfo("fingerprint-only")
+	if err != nil || info == nil || info.Fingerprint != fingerprint {
+		t.Errorf("Expected a normalized fingerprint-only pin, got %+v, %v", info, err)
+	}
+	info, err = pinning.GetKeyInfo("future")
+	if err != nil || info == nil || info.PinnedAt.After(time.Now()) {
+		t.Errorf("Expected the future pinned_at to be replaced, got %+v, %v", info, err)
+	}
+}
+
+func TestImportPinnedKeysLimits(t *testing.T) {
+	pinning, err := NewKeyPinning(createTempDB(t), PinningModeAutomatic, nil)
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	defer pinning.Close()
+
+	key, _ := generateTestKeyPEM(t)
+	entries := make([]map[string]string, 5)
+	for i := range entries {
+		entries[i] = map[string]string{"tool_id": fmt.Sprintf("tool%d", i), "public_key_pem": key}
+	}
+	data, _ := json.Marshal(entries)
+
+	tests := []struct {
+		name   string
+		limits ImportLimits
+		limit  string
+	}{
+		{"too many entries", ImportLimits{MaxEntries: 4}, "entries"},
+		{"too many bytes", ImportLimits{MaxBytes: len(data) - 1}, "bytes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := pinning.ImportPinnedKeys(string(data), ImportOptions{Limits: tt.limits})
+			var limitErr *ImportLimitError
+			if !errors.As(err, &limitErr) || limitErr.Limit != tt.limit {
+				t.Fatalf("Expected an ImportLimitError for %s, got %v", tt.limit, err)
+			}
+			if pinning.IsKeyPinned("tool0") {
+				t.Error("Expected nothing to be imported")
+			}
+		})
+	}
+
+	for _, doc := range []string{`{"tool_id": "tool"}`, `[{"tool_id": "tool"}] []`, `[{"tool_id": "tool"}`} {
+		if _, err := pinning.ImportPinnedKeys(doc, ImportOptions{}); err == nil {
+			t.Errorf("Expected %s to be rejected", doc)
+		}
+	}
+
+	report, err := pinning.ImportPinnedKeys(string(data), ImportOptions{Limits: ImportLimits{MaxEntries: 5}})
+	if err != nil || len(report.Imported) != 5 {
+		t.Errorf("Expected all five keys imported at the limit, got %+v, %v", report, err)
+	}
+}
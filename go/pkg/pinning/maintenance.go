@@ -0,0 +1,542 @@
+package pinning
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"go.etcd.io/bbolt"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/interactive"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/revocation"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+)
+
+// knownBuckets are the buckets IntegrityCheck validates row by row and
+// Repair salvages, in the order they are processed.
+var knownBuckets = [][]byte{pinnedKeysBucket, domainPoliciesBucket, discoveryVersionsBucket, settingsBucket, rejectedKeysBucket, revocationCacheBucket, discoveryCacheBucket, pendingDecisionsBucket, pinIndexBucket}
+
+// IntegrityProblem is one defect found in the pinning database. Bucket and
+// Key are empty for defects in the file structure itself.
+type IntegrityProblem struct {
+	Bucket string `json:"bucket,omitempty"`
+	Key    string `json:"key,omitempty"`
+	Reason string `json:"reason"`
+}
+
+func (p IntegrityProblem) String() string {
+	switch {
+	case p.Key != "":
+		return fmt.Sprintf("%s/%s: %s", p.Bucket, p.Key, p.Reason)
+	case p.Bucket != "":
+		return fmt.Sprintf("%s: %s", p.Bucket, p.Reason)
+	default:
+		return p.Reason
+	}
+}
+
+// IntegrityReport is the result of IntegrityCheck.
+type IntegrityReport struct {
+	// Rows is the number of rows checked per bucket.
+	Rows     map[string]int     `json:"rows"`
+	Problems []IntegrityProblem `json:"problems"`
+}
+
+// OK reports whether no problems were found.
+func (r *IntegrityReport) OK() bool {
+	return len(r.Problems) == 0
+}
+
+// Err returns nil if the report is OK and otherwise a
+// schemaerr.ErrPinStoreCorrupt error naming the first problem.
+func (r *IntegrityReport) Err() error {
+	if r.OK() {
+		return nil
+	}
+	return &schemaerr.Error{
+		Kind: schemaerr.ErrPinStoreCorrupt,
+		Err:  fmt.Errorf("pinning database has %d integrity problem(s), first: %s", len(r.Problems), r.Problems[0]),
+	}
+}
+
+// StoreStats describes the size of the pinning database.
+type StoreStats struct {
+	Path string `json:"path"`
+	// FileSize is the size of the database file in bytes.
+	FileSize int64 `json:"file_size"`
+	// FreeBytes is the space held by free pages, which Vacuum returns to
+	// the file system.
+	FreeBytes int64 `json:"free_bytes"`
+	// Rows is the number of rows per bucket.
+	Rows map[string]int `json:"rows"`
+	// Rotations are the rotations of the store key, oldest first (see
+	// RotateStoreSecret).
+	Rotations []StoreRotation `json:"rotations,omitempty"`
+}
+
+// VacuumResult reports the file size before and after Vacuum.
+type VacuumResult struct {
+	SizeBefore int64 `json:"size_before"`
+	SizeAfter  int64 `json:"size_after"`
+}
+
+// RepairReport is the result of a repair.
+type RepairReport struct {
+	// BackupPath is where the original file was moved.
+	BackupPath string `json:"backup_path"`
+	// Recovered is the number of rows copied per bucket.
+	Recovered map[string]int `json:"recovered"`
+	// Lost lists the rows, or whole parts of the file, that could not be
+	// salvaged.
+	Lost []IntegrityProblem `json:"lost"`
+}
+
+// IntegrityCheck decodes every row of the database and then checks the
+// file structure with bbolt's consistency check: pins must parse as JSON
+// and carry a parseable public key with a matching fingerprint, or a bare
+// fingerprint; domain policies and discovery versions must parse as JSON,
+// and a stored default mode must be a known mode.
+// Problems are reported, not returned as errors; the error is non-nil only
+// when the check itself cannot run.
+func (k *KeyPinning) IntegrityCheck() (*IntegrityReport, error) {
+	report := &IntegrityReport{Rows: make(map[string]int), Problems: []IntegrityProblem{}}
+	err := safeView(k.db, func(tx *bbolt.Tx) error {
+		for _, name := range knownBuckets {
+			bucket := tx.Bucket(name)
+			if bucket == nil {
+				report.Problems = append(report.Problems, IntegrityProblem{Bucket: string(name), Reason: "bucket missing"})
+				continue
+			}
+			report.Rows[string(name)] = 0
+			err := bucket.ForEach(func(key, value []byte) error {
+				report.Rows[string(name)]++
+				if err := validateRow(k.cipher, name, key, value); err != nil {
+					report.Problems = append(report.Problems, IntegrityProblem{Bucket: string(name), Key: string(key), Reason: err.Error()})
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if k.cipher != nil {
+			report.Problems = append(report.Problems, checkPinIndex(tx, k.cipher)...)
+		}
+		return nil
+	})
+	if err != nil {
+		var corrupt *schemaerr.Error
+		if errors.As(err, &corrupt) {
+			report.Problems = append(report.Problems, IntegrityProblem{Reason: err.Error()})
+			return report, nil
+		}
+		return nil, err
+	}
+
+	// tx.Check walks the pages in a goroutine of its own, where a panic on
+	// an unreadable page cannot be recovered, so it only runs once every
+	// page has been read above.
+	err = k.db.View(func(tx *bbolt.Tx) error {
+		for err := range tx.Check() {
+			report.Problems = append(report.Problems, IntegrityProblem{Reason: err.Error()})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// Stats returns the row count of every bucket, the database file size and
+// the rotations of the store key.
+func (k *KeyPinning) Stats() (*StoreStats, error) {
+	stats := &StoreStats{Path: k.dbPath, Rows: make(map[string]int)}
+	err := safeView(k.db, func(tx *bbolt.Tx) error {
+		// Undecodable rotations are left for IntegrityCheck to report
+		stats.Rotations, _ = storeRotations(tx)
+		return tx.ForEach(func(name []byte, bucket *bbolt.Bucket) error {
+			stats.Rows[string(name)] = bucket.Stats().KeyN
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	dbStats := k.db.Stats()
+	stats.FreeBytes = int64(dbStats.FreePageN+dbStats.PendingPageN) * int64(k.db.Info().PageSize)
+	if info, err := os.Stat(k.dbPath); err == nil {
+		stats.FileSize = info.Size()
+	}
+	return stats, nil
+}
+
+// Vacuum rewrites the database into a new file without free pages and
+// replaces the original with it. The KeyPinning must not be used
+// concurrently while Vacuum runs.
+func (k *KeyPinning) Vacuum() (*VacuumResult, error) {
+	if k.readOnly {
+		return nil, ErrReadOnlyPinStore
+	}
+	before, err := fileSize(k.dbPath)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpPath := k.dbPath + ".vacuum"
+	_ = os.Remove(tmpPath)
+	dst, err := bbolt.Open(tmpPath, 0600, &bbolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create compacted database: %w", err)
+	}
+	err = safeCompact(dst, k.db)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return nil, fmt.Errorf("failed to compact database: %w", err)
+	}
+
+	if err := k.replaceFile(func() error { return os.Rename(tmpPath, k.dbPath) }); err != nil {
+		return nil, err
+	}
+
+	after, err := fileSize(k.dbPath)
+	if err != nil {
+		return nil, err
+	}
+	return &VacuumResult{SizeBefore: before, SizeAfter: after}, nil
+}
+
+// Repair salvages every readable, valid row into a fresh database file,
+// moves the original aside and reopens the fresh file. See RepairDatabase.
+// The KeyPinning must not be used concurrently while Repair runs.
+func (k *KeyPinning) Repair() (*RepairReport, error) {
+	if k.readOnly {
+		return nil, ErrReadOnlyPinStore
+	}
+	var report *RepairReport
+	err := k.replaceFile(func() error {
+		var err error
+		report, err = repairDatabase(k.dbPath, k.clock.Now(), k.cipher)
+		return err
+	})
+	return report, err
+}
+
+// replaceFile closes the database, runs swap to replace the file at
+// k.dbPath and reopens it. The database is reopened even if swap fails.
+func (k *KeyPinning) replaceFile(swap func() error) error {
+	if err := k.db.Close(); err != nil {
+		return fmt.Errorf("failed to close database: %w", err)
+	}
+	swapErr := swap()
+	db, err := openDB(k.dbPath, k.cipher)
+	if err != nil {
+		return err
+	}
+	k.db = db
+	return swapErr
+}
+
+// RepairDatabase salvages the database at dbPath, which must not be open.
+// Rows that can be read and pass IntegrityCheck's validation are copied
+// into a fresh file; the original is kept next to it as
+// <dbPath>.corrupt-<timestamp> and the fresh file takes its place. Rows
+// that could not be salvaged are listed in RepairReport.Lost. A file that
+// bbolt cannot open at all is replaced by an empty database.
+//
+// Of opts, only WithStoreEncryption applies: an encrypted database is
+// repaired with its key, which is needed to validate the pins, and fails
+// like NewKeyPinning without it.
+func RepairDatabase(dbPath string, opts ...Option) (*RepairReport, error) {
+	k := &KeyPinning{}
+	for _, opt := range opts {
+		opt(k)
+	}
+	var c *storeCipher
+	if k.storeKey != nil {
+		var err error
+		if c, err = newStoreCipher(k.storeKey); err != nil {
+			return nil, err
+		}
+	}
+	return repairDatabase(dbPath, clock.Real.Now(), c)
+}
+
+func repairDatabase(dbPath string, now time.Time, c *storeCipher) (*RepairReport, error) {
+	report := &RepairReport{
+		BackupPath: fmt.Sprintf("%s.corrupt-%s", dbPath, now.UTC().Format("20060102T150405Z")),
+		Recovered:  make(map[string]int),
+		Lost:       []IntegrityProblem{},
+	}
+	for _, name := range knownBuckets {
+		report.Recovered[string(name)] = 0
+	}
+
+	tmpPath := dbPath + ".repair"
+	_ = os.Remove(tmpPath)
+	dst, err := bbolt.Open(tmpPath, 0600, &bbolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create repaired database: %w", err)
+	}
+
+	src, err := bbolt.Open(dbPath, 0600, &bbolt.Options{Timeout: 1 * time.Second, ReadOnly: true})
+	if err != nil {
+		if !isCorruptFileError(err) {
+			_ = dst.Close()
+			_ = os.Remove(tmpPath)
+			return nil, fmt.Errorf("failed to open database: %w", err)
+		}
+		report.Lost = append(report.Lost, IntegrityProblem{Reason: fmt.Sprintf("database unreadable: %v", err)})
+	} else {
+		// Salvaging pins with the wrong key, or none, would lose them all.
+		// Damage to the settings bucket is left for salvage to report.
+		err = safeView(src, func(tx *bbolt.Tx) error {
+			return checkStoreEncryption(tx, c, false)
+		})
+		var corrupt *schemaerr.Error
+		if err == nil || errors.As(err, &corrupt) {
+			err = salvage(src, dst, report, c)
+		} else {
+			err = fmt.Errorf("pinning database %s: %w", dbPath, err)
+		}
+		_ = src.Close()
+		if err != nil {
+			_ = dst.Close()
+			_ = os.Remove(tmpPath)
+			return nil, err
+		}
+	}
+
+	if err := dst.Close(); err != nil {
+		_ = os.Remove(tmpPath)
+		return nil, fmt.Errorf("failed to write repaired database: %w", err)
+	}
+	if err := os.Rename(dbPath, report.BackupPath); err != nil {
+		_ = os.Remove(tmpPath)
+		return nil, fmt.Errorf("failed to move corrupt database aside: %w", err)
+	}
+	if err := os.Rename(tmpPath, dbPath); err != nil {
+		return nil, fmt.Errorf("failed to install repaired database: %w", err)
+	}
+	return report, nil
+}
+
+// salvage copies the valid rows of every known bucket from src to dst. A
+// bucket whose pages cannot be read is salvaged up to the failure.
+func salvage(src, dst *bbolt.DB, report *RepairReport, c *storeCipher) error {
+	var pins map[string][]byte
+	for _, name := range knownBuckets {
+		rows := make(map[string][]byte)
+		if string(name) == string(pinIndexBucket) && c != nil {
+			// The index is rebuilt from the recovered pins rather than
+			// copied, so that it refers to none that were lost
+			for row, value := range pins {
+				toolID, _, _ := c.open([]byte(row), value)
+				rows[string(c.index(string(pinIndexBucket), string(toolID)))] = []byte(row)
+			}
+		}
+		err := safeView(src, func(tx *bbolt.Tx) error {
+			bucket := tx.Bucket(name)
+			if bucket == nil || (string(name) == string(pinIndexBucket) && c != nil) {
+				return nil
+			}
+			cursor := bucket.Cursor()
+			for key, value := cursor.First(); key != nil; key, value = cursor.Next() {
+				if value == nil {
+					continue // nested bucket
+				}
+				if err := validateRow(c, name, key, value); err != nil {
+					report.Lost = append(report.Lost, IntegrityProblem{Bucket: string(name), Key: string(key), Reason: err.Error()})
+					continue
+				}
+				rows[string(key)] = append([]byte(nil), value...)
+			}
+			return nil
+		})
+		if err != nil {
+			report.Lost = append(report.Lost, IntegrityProblem{Bucket: string(name), Reason: fmt.Sprintf("rows after the last one recovered are unreadable: %v", err)})
+		}
+		if string(name) == string(pinnedKeysBucket) {
+			pins = rows
+		}
+
+		err = dst.Update(func(tx *bbolt.Tx) error {
+			bucket, err := tx.CreateBucketIfNotExists(name)
+			if err != nil {
+				return err
+			}
+			for key, value := range rows {
+				if err := bucket.Put([]byte(key), value); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to write repaired database: %w", err)
+		}
+		report.Recovered[string(name)] = len(rows)
+	}
+	sort.SliceStable(report.Lost, func(i, j int) bool {
+		return report.Lost[i].Bucket < report.Lost[j].Bucket
+	})
+	return nil
+}
+
+// validateRow decodes one row of a known bucket, decrypting the rows of
+// the sealed buckets with c.
+func validateRow(c *storeCipher, bucket, key, value []byte) error {
+	if c != nil && string(bucket) != string(pinnedKeysBucket) && isSealedBucket(bucket) {
+		var err error
+		if key, value, err = c.open(key, value); err != nil {
+			return fmt.Errorf("undecodable row: %w", err)
+		}
+	}
+	switch string(bucket) {
+	case string(pinnedKeysBucket):
+		_, keyInfo, err := pinBucketOf(nil, c).decode(key, value)
+		if err != nil {
+			return fmt.Errorf("undecodable pin: %w", err)
+		}
+		if keyInfo.PublicKeyPEM == "" {
+			// Fingerprint-only pins from a policy file
+			if keyInfo.Fingerprint == "" {
+				return fmt.Errorf("pin has neither a public key nor a fingerprint")
+			}
+			return nil
+		}
+		fingerprint, err := crypto.NewKeyManager().CalculateKeyFingerprintFromPEM(keyInfo.PublicKeyPEM)
+		if err != nil {
+			return fmt.Errorf("unparseable public key: %w", err)
+		}
+		if keyInfo.Fingerprint != "" && !crypto.FingerprintEqual(keyInfo.Fingerprint, fingerprint) {
+			return fmt.Errorf("fingerprint %s does not match key %s", keyInfo.Fingerprint, fingerprint)
+		}
+	case string(domainPoliciesBucket):
+		var policy DomainPolicy
+		if err := json.Unmarshal(value, &policy); err != nil {
+			return fmt.Errorf("undecodable domain policy: %w", err)
+		}
+	case string(discoveryVersionsBucket):
+		var version DiscoveryVersion
+		if err := json.Unmarshal(value, &version); err != nil {
+			return fmt.Errorf("undecodable discovery version: %w", err)
+		}
+	case string(rejectedKeysBucket):
+		var rejected RejectedKey
+		if err := json.Unmarshal(value, &rejected); err != nil {
+			return fmt.Errorf("undecodable rejected key: %w", err)
+		}
+		if string(key) != string(rejectionKey(rejected.ToolID, rejected.Domain, rejected.Fingerprint)) {
+			return fmt.Errorf("rejected key does not match its row")
+		}
+	case string(revocationCacheBucket):
+		var doc revocation.RevocationDocument
+		if err := json.Unmarshal(value, &doc); err != nil {
+			return fmt.Errorf("undecodable revocation document: %w", err)
+		}
+	case string(discoveryCacheBucket):
+		var cached discovery.CachedDocument
+		if err := json.Unmarshal(value, &cached); err != nil {
+			return fmt.Errorf("undecodable discovery document: %w", err)
+		}
+		if cached.Domain != string(key) {
+			return fmt.Errorf("discovery document for %s does not match its row", cached.Domain)
+		}
+	case string(pendingDecisionsBucket):
+		var pending interactive.PendingDecision
+		if err := json.Unmarshal(value, &pending); err != nil {
+			return fmt.Errorf("undecodable pending decision: %w", err)
+		}
+		if pending.ID != string(key) || pending.Prompt == nil {
+			return fmt.Errorf("pending decision %s does not match its row", pending.ID)
+		}
+	case string(pinIndexBucket):
+		if c == nil {
+			return fmt.Errorf("pin index entry in an unencrypted database")
+		}
+		if _, err := hex.DecodeString(string(value)); err != nil || len(value) != 2*sha256.Size {
+			return fmt.Errorf("undecodable pin index entry")
+		}
+	case string(settingsBucket):
+		if string(key) == string(defaultModeKey) {
+			var mode PinningMode
+			if err := json.Unmarshal(value, &mode); err != nil {
+				return fmt.Errorf("undecodable default mode: %w", err)
+			}
+			if err := (&PolicyDocument{DefaultMode: mode}).Validate(); err != nil {
+				return err
+			}
+		}
+		if string(key) == string(storeEncryptionKey) {
+			var encryption storeEncryption
+			if err := json.Unmarshal(value, &encryption); err != nil {
+				return fmt.Errorf("undecodable store encryption settings: %w", err)
+			}
+		}
+		if string(key) == string(storeRotationsKey) {
+			var rotations []StoreRotation
+			if err := json.Unmarshal(value, &rotations); err != nil {
+				return fmt.Errorf("undecodable store rotations: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// safeView runs fn in a read transaction and reports a panic, which bbolt
+// raises on some corrupted pages, as a schemaerr.ErrPinStoreCorrupt error.
+func safeView(db *bbolt.DB, fn func(*bbolt.Tx) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &schemaerr.Error{Kind: schemaerr.ErrPinStoreCorrupt, Err: fmt.Errorf("database page unreadable: %v", r)}
+		}
+	}()
+	return db.View(fn)
+}
+
+// safeUpdate is safeView for a read-write transaction, which is rolled
+// back on panic.
+func safeUpdate(db *bbolt.DB, fn func(*bbolt.Tx) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &schemaerr.Error{Kind: schemaerr.ErrPinStoreCorrupt, Err: fmt.Errorf("database page unreadable: %v", r)}
+		}
+	}()
+	return db.Update(fn)
+}
+
+// safeCompact is bbolt.Compact with panics reported like safeView.
+func safeCompact(dst, src *bbolt.DB) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &schemaerr.Error{Kind: schemaerr.ErrPinStoreCorrupt, Err: fmt.Errorf("database page unreadable: %v", r)}
+		}
+	}()
+	return bbolt.Compact(dst, src, 0)
+}
+
+// isCorruptFileError reports whether err from bbolt.Open means the file is
+// not a usable database, as opposed to e.g. a lock timeout.
+func isCorruptFileError(err error) bool {
+	return errors.Is(err, bbolt.ErrInvalid) || errors.Is(err, bbolt.ErrChecksum) || errors.Is(err, bbolt.ErrVersionMismatch)
+}
+
+func fileSize(path string) (int64, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat database: %w", err)
+	}
+	return info.Size(), nil
+}
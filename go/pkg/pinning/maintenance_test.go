@@ -0,0 +1,321 @@
+package pinning
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.etcd.io/bbolt"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+)
+
+// buildMaintenanceDB creates a database with n valid pins, a domain policy
+// and a discovery version, and returns its path after closing it.
+func buildMaintenanceDB(t *testing.T, n int) string {
+	t.Helper()
+	keyManager := crypto.NewKeyManager()
+	privateKey, err := keyManager.GenerateKeypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeyPEM, err := keyManager.ExportPublicKeyPEM(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dbPath := createTempDB(t)
+	k, err := NewKeyPinning(dbPath, PinningModeAutomatic, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		if err := k.PinKey(fmt.Sprintf("example.com/tool-%03d", i), publicKeyPEM, "example.com", "Example"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := k.SetDomainPolicy("example.com", PinningPolicyAlwaysTrust); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.RecordDiscoveryVersion("example.com", "1.3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return dbPath
+}
+
+// putRaw writes value under key in bucket, bypassing validation.
+func putRaw(t *testing.T, dbPath string, bucket []byte, key, value string) {
+	t.Helper()
+	db, err := bbolt.Open(dbPath, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	err = db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(bucket).Put([]byte(key), []byte(value))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIntegrityCheckHealthy(t *testing.T) {
+	k, err := NewKeyPinning(buildMaintenanceDB(t, 3), PinningModeAutomatic, nil, WithIntegrityCheck())
+	if err != nil {
+		t.Fatalf("expected a healthy database to open, got %v", err)
+	}
+	defer k.Close()
+
+	report, err := k.IntegrityCheck()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.OK() || report.Err() != nil {
+		t.Fatalf("expected no problems, got %v", report.Problems)
+	}
+	if report.Rows["pinned_keys"] != 3 || report.Rows["domain_policies"] != 1 || report.Rows["discovery_versions"] != 1 {
+		t.Errorf("unexpected row counts: %v", report.Rows)
+	}
+}
+
+func TestIntegrityCheckCorruptRows(t *testing.T) {
+	dbPath := buildMaintenanceDB(t, 3)
+	putRaw(t, dbPath, pinnedKeysBucket, "garbled", "{not json")
+	putRaw(t, dbPath, pinnedKeysBucket, "bad-pem", `{"tool_id":"bad-pem","public_key_pem":"-----BEGIN PUBLIC KEY-----\nAAAA\n-----END PUBLIC KEY-----\n"}`)
+	putRaw(t, dbPath, pinnedKeysBucket, "fingerprint-only", `{"tool_id":"fingerprint-only","fingerprint":"sha256:00"}`)
+	putRaw(t, dbPath, domainPoliciesBucket, "broken.example", "\x00\x01")
+
+	k, err := NewKeyPinning(dbPath, PinningModeAutomatic, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := k.IntegrityCheck()
+	k.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]bool)
+	for _, problem := range report.Problems {
+		got[problem.Bucket+"/"+problem.Key] = true
+	}
+	want := map[string]bool{"pinned_keys/garbled": true, "pinned_keys/bad-pem": true, "domain_policies/broken.example": true}
+	if len(got) != len(want) {
+		t.Fatalf("expected problems %v, got %v", want, report.Problems)
+	}
+	for key := range want {
+		if !got[key] {
+			t.Errorf("expected a problem for %s, got %v", key, report.Problems)
+		}
+	}
+	if !errors.Is(report.Err(), schemaerr.ErrPinStoreCorrupt) {
+		t.Errorf("expected ErrPinStoreCorrupt, got %v", report.Err())
+	}
+
+	_, err = NewKeyPinning(dbPath, PinningModeAutomatic, nil, WithIntegrityCheck())
+	if !errors.Is(err, schemaerr.ErrPinStoreCorrupt) {
+		t.Fatalf("expected the open-time check to fail with ErrPinStoreCorrupt, got %v", err)
+	}
+}
+
+func TestRepairCorruptRows(t *testing.T) {
+	dbPath := buildMaintenanceDB(t, 3)
+	putRaw(t, dbPath, pinnedKeysBucket, "garbled", "{not json")
+
+	k, err := NewKeyPinning(dbPath, PinningModeAutomatic, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer k.Close()
+
+	report, err := k.Repair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Recovered["pinned_keys"] != 3 || report.Recovered["domain_policies"] != 1 || report.Recovered["discovery_versions"] != 1 {
+		t.Errorf("unexpected recovered counts: %v", report.Recovered)
+	}
+	if len(report.Lost) != 1 || report.Lost[0].Key != "garbled" {
+		t.Errorf("expected only the garbled pin to be lost, got %v", report.Lost)
+	}
+	if _, err := os.Stat(report.BackupPath); err != nil {
+		t.Errorf("expected the original to be kept at %s: %v", report.BackupPath, err)
+	}
+
+	// The repaired database is reopened in place
+	check, err := k.IntegrityCheck()
+	if err != nil || !check.OK() {
+		t.Fatalf("expected the repaired database to be healthy, got %v, %v", check, err)
+	}
+	if !k.IsKeyPinned("example.com/tool-001") {
+		t.Error("expected a valid pin to survive the repair")
+	}
+	if policy := k.GetDomainPolicy("example.com"); policy != PinningPolicyAlwaysTrust {
+		t.Errorf("expected the domain policy to survive, got %s", policy)
+	}
+}
+
+// corruptPage overwrites the page header flags of the page holding marker,
+// so bbolt sees a page of invalid type.
+func corruptPage(t *testing.T, dbPath string, marker []byte) {
+	t.Helper()
+	data, err := os.ReadFile(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset := bytes.Index(data, marker)
+	if offset < 0 {
+		t.Fatalf("marker %q not found in database", marker)
+	}
+	pageSize := os.Getpagesize()
+	pageStart := offset / pageSize * pageSize
+	data[pageStart+8], data[pageStart+9] = 0xff, 0xff // page.flags
+	if err := os.WriteFile(dbPath, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIntegrityCheckCorruptPage(t *testing.T) {
+	dbPath := buildMaintenanceDB(t, 1)
+	for i := 0; i < 100; i++ {
+		putRaw(t, dbPath, domainPoliciesBucket, fmt.Sprintf("domain-%03d.example", i), `{"policy":"always_trust"}`)
+	}
+	corruptPage(t, dbPath, []byte("domain-099.example"))
+
+	k, err := NewKeyPinning(dbPath, PinningModeAutomatic, nil)
+	if err != nil {
+		t.Fatalf("expected bbolt to open the file, got %v", err)
+	}
+	report, err := k.IntegrityCheck()
+	k.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.OK() {
+		t.Fatal("expected a corrupted page to be detected")
+	}
+
+	repair, err := RepairDatabase(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repair.Lost) == 0 {
+		t.Error("expected the repair to report lost rows")
+	}
+	if repair.Recovered["pinned_keys"] != 1 || repair.Recovered["discovery_versions"] != 1 {
+		t.Errorf("expected rows in other buckets to be recovered, got %v", repair.Recovered)
+	}
+
+	k, err = NewKeyPinning(dbPath, PinningModeAutomatic, nil, WithIntegrityCheck())
+	if err != nil {
+		t.Fatalf("expected the repaired database to pass the open-time check, got %v", err)
+	}
+	k.Close()
+}
+
+func TestOpenCorruptPinPage(t *testing.T) {
+	dbPath := buildMaintenanceDB(t, 60)
+	corruptPage(t, dbPath, []byte("example.com/tool-059"))
+
+	// Opening reads every pin to run migrations
+	_, err := NewKeyPinning(dbPath, PinningModeAutomatic, nil)
+	if !errors.Is(err, schemaerr.ErrPinStoreCorrupt) {
+		t.Fatalf("expected ErrPinStoreCorrupt, got %v", err)
+	}
+
+	repair, err := RepairDatabase(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(repair.Lost) == 0 || repair.Recovered["domain_policies"] != 1 {
+		t.Errorf("unexpected repair report: %+v", repair)
+	}
+	k, err := NewKeyPinning(dbPath, PinningModeAutomatic, nil, WithIntegrityCheck())
+	if err != nil {
+		t.Fatalf("expected the repaired database to open, got %v", err)
+	}
+	k.Close()
+}
+
+func TestRepairUnreadableFile(t *testing.T) {
+	dbPath := buildMaintenanceDB(t, 1)
+	garbage := bytes.Repeat([]byte{0xab}, 4*os.Getpagesize())
+	if err := os.WriteFile(dbPath, garbage, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := NewKeyPinning(dbPath, PinningModeAutomatic, nil)
+	if !errors.Is(err, schemaerr.ErrPinStoreCorrupt) {
+		t.Fatalf("expected ErrPinStoreCorrupt for an unreadable file, got %v", err)
+	}
+
+	report, err := RepairDatabase(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Lost) != 1 || report.Lost[0].Bucket != "" {
+		t.Errorf("expected the whole file to be reported lost, got %v", report.Lost)
+	}
+	backup, err := os.Open(report.BackupPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backup.Close()
+	kept, _ := io.ReadAll(backup)
+	if !bytes.Equal(kept, garbage) {
+		t.Error("expected the original bytes to be kept in the backup")
+	}
+
+	k, err := NewKeyPinning(dbPath, PinningModeAutomatic, nil, WithIntegrityCheck())
+	if err != nil {
+		t.Fatalf("expected an empty usable database after repair, got %v", err)
+	}
+	k.Close()
+}
+
+func TestStatsAndVacuum(t *testing.T) {
+	dbPath := buildMaintenanceDB(t, 200)
+	k, err := NewKeyPinning(dbPath, PinningModeAutomatic, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer k.Close()
+
+	for i := 0; i < 190; i++ {
+		if err := k.RemovePinnedKey(fmt.Sprintf("example.com/tool-%03d", i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := k.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Rows["pinned_keys"] != 10 || stats.Rows["domain_policies"] != 1 {
+		t.Errorf("unexpected row counts: %v", stats.Rows)
+	}
+	if stats.Path != dbPath || stats.FileSize == 0 || stats.FreeBytes == 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+
+	result, err := k.Vacuum()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.SizeAfter >= result.SizeBefore {
+		t.Errorf("expected vacuum to shrink the file, got %d -> %d", result.SizeBefore, result.SizeAfter)
+	}
+	if !k.IsKeyPinned("example.com/tool-195") {
+		t.Error("expected pins to survive vacuum")
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(dbPath), filepath.Base(dbPath)+".vacuum")); !os.IsNotExist(err) {
+		t.Errorf("expected no temporary file left behind, got %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package pinning
+
+import (
+	"fmt"
+	"strings"
+
+	"go.etcd.io/bbolt"
+
+	"github.com/ThirdKeyAi/schemapin/go/internal/logging"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+)
+
+// PinMatch is how a tool ID was matched to its pin.
+type PinMatch string
+
+const (
+	// PinMatchExact is a pin made for the tool ID itself.
+	PinMatchExact PinMatch = "exact"
+	// PinMatchNamespace is a pin made for a namespace the tool ID is under.
+	PinMatchNamespace PinMatch = "namespace"
+)
+
+// NormalizeNamespace returns namespace with a trailing "/", the form
+// namespace pins are stored under, so that "example.com/payments" covers
+// "example.com/payments/refund" but not "example.com/payments-v2/refund".
+func NormalizeNamespace(namespace string) (string, error) {
+	if strings.Trim(namespace, "/") == "" {
+		return "", fmt.Errorf("namespace must not be empty")
+	}
+	if !strings.HasSuffix(namespace, "/") {
+		namespace += "/"
+	}
+	return namespace, nil
+}
+
+// PinKeyForNamespace pins publicKeyPEM for every tool ID under namespace,
+// recorded as ProvenanceManual. Tools pinned on their own keep their pin:
+// an exact pin takes precedence, and otherwise the longest namespace
+// containing the tool ID applies (see ResolvePin). The pin is stored and
+// removed under the normalized namespace (see NormalizeNamespace).
+func (k *KeyPinning) PinKeyForNamespace(namespace, publicKeyPEM, domain, developerName string) error {
+	return k.PinKeyForNamespaceWithOptions(namespace, publicKeyPEM, domain, developerName, PinOptions{})
+}
+
+// PinKeyForNamespaceWithOptions is PinKeyForNamespace with the scope and
+// provenance of the key.
+func (k *KeyPinning) PinKeyForNamespaceWithOptions(namespace, publicKeyPEM, domain, developerName string, opts PinOptions) error {
+	namespace, err := NormalizeNamespace(namespace)
+	if err != nil {
+		return err
+	}
+	if opts.Provenance == "" {
+		opts.Provenance = ProvenanceManual
+	}
+	keyInfo := PinnedKeyInfo{
+		ToolID:        namespace,
+		Namespace:     true,
+		PublicKeyPEM:  publicKeyPEM,
+		Domain:        domain,
+		DeveloperName: developerName,
+		KeyScope:      opts.KeyScope,
+		Provenance:    opts.Provenance,
+		SourceDetail:  opts.SourceDetail,
+		PinnedAt:      clock.Timestamp(k.clock.Now()),
+	}
+
+	err = k.update(func(tx *bbolt.Tx) error {
+		return k.pins(tx).put(namespace, &keyInfo)
+	})
+	if err == nil {
+		k.logger.Info("namespace key pinned",
+			"namespace", namespace,
+			logging.KeyDomain, domain,
+			"fingerprint", fingerprintOf(publicKeyPEM),
+			"key_scope", opts.KeyScope,
+			"provenance", opts.Provenance,
+			"source_detail", opts.SourceDetail)
+	}
+	return err
+}
+
+// ResolvePin returns the pin that applies to toolID and how it matched: the
+// tool's own pin if there is one, otherwise the pin of the longest
+// namespace containing the tool ID. The pin is nil if none applies.
+func (k *KeyPinning) ResolvePin(toolID string) (*PinnedKeyInfo, PinMatch, error) {
+	var keyInfo *PinnedKeyInfo
+	var match PinMatch
+	err := k.db.View(func(tx *bbolt.Tx) error {
+		var err error
+		keyInfo, match, err = resolvePin(k.pins(tx), toolID)
+		return err
+	})
+	return keyInfo, match, err
+}
+
+// resolvePin is ResolvePin within a transaction.
+func resolvePin(pins pinBucket, toolID string) (*PinnedKeyInfo, PinMatch, error) {
+	info, err := pins.get(toolID)
+	if err != nil {
+		return nil, "", err
+	}
+	if info != nil && !info.Namespace {
+		return info, PinMatchExact, nil
+	}
+	// Shorten the tool ID one segment at a time, longest namespace first
+	for prefix := toolID; ; {
+		i := strings.LastIndex(strings.TrimSuffix(prefix, "/"), "/")
+		if i <= 0 {
+			return nil, "", nil
+		}
+		prefix = prefix[:i+1]
+		info, err := pins.get(prefix)
+		if err != nil {
+			return nil, "", err
+		}
+		if info != nil && info.Namespace {
+			return info, PinMatchNamespace, nil
+		}
+	}
+}
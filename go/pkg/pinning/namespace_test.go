@@ -0,0 +1,271 @@
+package pinning
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/interactive"
+)
+
+func TestNormalizeNamespace(t *testing.T) {
+	for input, want := range map[string]string{
+		"example.com/payments":  "example.com/payments/",
+		"example.com/payments/": "example.com/payments/",
+		"example.com":           "example.com/",
+	} {
+		if got, err := NormalizeNamespace(input); err != nil || got != want {
+			t.Errorf("NormalizeNamespace(%q) = %q, %v; expected %q", input, got, err, want)
+		}
+	}
+	for _, input := range []string{"", "/", "//"} {
+		if _, err := NormalizeNamespace(input); err == nil {
+			t.Errorf("Expected %q to be rejected", input)
+		}
+	}
+}
+
+func TestResolvePinPrecedence(t *testing.T) {
+	pinning, err := NewKeyPinning(createTempDB(t), PinningModeAutomatic, nil)
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	defer pinning.Close()
+
+	if err := pinning.PinKeyForNamespace("example.com", "domain-key", "example.com", "Dev"); err != nil {
+		t.Fatalf("Failed to pin namespace: %v", err)
+	}
+	if err := pinning.PinKeyForNamespace("example.com/payments", "payments-key", "example.com", "Dev"); err != nil {
+		t.Fatalf("Failed to pin namespace: %v", err)
+	}
+	if err := pinning.PinKey("example.com/payments/refund", "refund-key", "example.com", "Dev"); err != nil {
+		t.Fatalf("Failed to pin key: %v", err)
+	}
+
+	tests := []struct {
+		toolID    string
+		wantKey   string
+		wantMatch PinMatch
+	}{
+		{"example.com/payments/refund", "refund-key", PinMatchExact},
+		{"example.com/payments/charge", "payments-key", PinMatchNamespace},
+		{"example.com/payments/cards/issue", "payments-key", PinMatchNamespace},
+		{"example.com/payments-v2/charge", "domain-key", PinMatchNamespace},
+		{"example.com/search", "domain-key", PinMatchNamespace},
+		{"example.com", "", ""},
+		{"other.com/payments/charge", "", ""},
+	}
+	for _, tt := range tests {
+		info, match, err := pinning.ResolvePin(tt.toolID)
+		if err != nil {
+			t.Fatalf("ResolvePin(%s) failed: %v", tt.toolID, err)
+		}
+		var key string
+		if info != nil {
+			key = info.PublicKeyPEM
+		}
+		if key != tt.wantKey || match != tt.wantMatch {
+			t.Errorf("ResolvePin(%s) = %q (%s); expected %q (%s)", tt.toolID, key, match, tt.wantKey, tt.wantMatch)
+		}
+		if pinned, _ := pinning.GetPinnedKey(tt.toolID); pinned != tt.wantKey {
+			t.Errorf("GetPinnedKey(%s) = %q; expected %q", tt.toolID, pinned, tt.wantKey)
+		}
+		if pinning.IsKeyPinned(tt.toolID) != (tt.wantKey != "") {
+			t.Errorf("IsKeyPinned(%s) = %v", tt.toolID, !(tt.wantKey != ""))
+		}
+	}
+
+	// A namespace pin is not an exact pin for its tools
+	if info, err := pinning.GetKeyInfo("example.com/payments/charge"); err != nil || info != nil {
+		t.Errorf("Expected no exact pin, got %+v, %v", info, err)
+	}
+
+	// Removing the narrower namespace falls back to the wider one
+	if err := pinning.RemovePinnedKey("example.com/payments/"); err != nil {
+		t.Fatalf("Failed to remove namespace pin: %v", err)
+	}
+	if key, _ := pinning.GetPinnedKey("example.com/payments/charge"); key != "domain-key" {
+		t.Errorf("Expected the domain namespace key after removal, got %q", key)
+	}
+}
+
+func TestNamespacePinRecordsVerifications(t *testing.T) {
+	pinning, err := NewKeyPinning(createTempDB(t), PinningModeAutomatic, nil)
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	defer pinning.Close()
+
+	if err := pinning.PinKeyForNamespace("example.com/payments/", "payments-key", "example.com", "Dev"); err != nil {
+		t.Fatalf("Failed to pin namespace: %v", err)
+	}
+	for _, toolID := range []string{"example.com/payments/charge", "example.com/payments/refund"} {
+		if err := pinning.UpdateLastVerified(toolID, true); err != nil {
+			t.Fatalf("Failed to record verification of %s: %v", toolID, err)
+		}
+	}
+	info, err := pinning.GetKeyInfo("example.com/payments/")
+	if err != nil || info == nil {
+		t.Fatalf("Failed to get namespace pin: %v", err)
+	}
+	if !info.Namespace || info.VerificationCount != 2 {
+		t.Errorf("Expected 2 verifications on the namespace pin, got %+v", info)
+	}
+
+	keys, err := pinning.ListPinnedKeys()
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("Expected one listed pin, got %v, %v", keys, err)
+	}
+	if keys[0]["namespace"] != true || keys[0]["tool_id"] != "example.com/payments/" {
+		t.Errorf("Expected the namespace pin to be listed as one, got %v", keys[0])
+	}
+}
+
+func TestKeyChangeUnderNamespacePin(t *testing.T) {
+	var prompts []*interactive.PromptContext
+	decision := interactive.UserDecisionAccept
+	handler := interactive.NewCallbackInteractiveHandler(func(ctx *interactive.PromptContext) (interactive.UserDecision, error) {
+		prompts = append(prompts, ctx)
+		return decision, nil
+	}, nil, nil)
+	pinning, err := NewKeyPinning(createTempDB(t), PinningModeInteractive, handler)
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	defer pinning.Close()
+
+	if err := pinning.PinKeyForNamespace("example.com/", "old-key", "example.com", "Dev"); err != nil {
+		t.Fatalf("Failed to pin namespace: %v", err)
+	}
+
+	// The pinned key is accepted for any tool of the namespace
+	accepted, err := pinning.InteractivePinKey("example.com/payments/charge", "old-key", "example.com", "Dev")
+	if err != nil || !accepted || len(prompts) != 0 {
+		t.Fatalf("Expected the namespace key to be accepted without a prompt, got %v, %v, %d prompts", accepted, err, len(prompts))
+	}
+
+	// A rejected key change leaves the namespace pin alone
+	decision = interactive.UserDecisionReject
+	accepted, err = pinning.InteractivePinKey("example.com/payments/charge", "new-key", "example.com", "Dev")
+	if err != nil || accepted {
+		t.Fatalf("Expected the new key to be rejected, got %v, %v", accepted, err)
+	}
+	if len(prompts) != 1 || prompts[0].PromptType != interactive.PromptTypeKeyChange || prompts[0].Namespace != "example.com/" {
+		t.Fatalf("Expected a key change prompt for the namespace, got %+v", prompts)
+	}
+	if key, _ := pinning.GetPinnedKey("example.com/search"); key != "old-key" {
+		t.Errorf("Expected the namespace to keep its key, got %q", key)
+	}
+
+	// Accepting the change re-pins the namespace, not just the tool
+	decision = interactive.UserDecisionAccept
+	accepted, err = pinning.InteractivePinKey("example.com/payments/refund", "new-key", "example.com", "Dev")
+	if err != nil || !accepted {
+		t.Fatalf("Expected the new key to be accepted, got %v, %v", accepted, err)
+	}
+	if info, _ := pinning.GetKeyInfo("example.com/payments/refund"); info != nil {
+		t.Errorf("Expected no pin for the tool itself, got %+v", info)
+	}
+	info, match, err := pinning.ResolvePin("example.com/search")
+	if err != nil || info == nil || info.PublicKeyPEM != "new-key" || match != PinMatchNamespace {
+		t.Errorf("Expected the namespace to be re-pinned to the new key, got %+v (%s), %v", info, match, err)
+	}
+}
+
+func TestKeyChangeUnderNamespacePinStrict(t *testing.T) {
+	pinning, err := NewKeyPinning(createTempDB(t), PinningModeStrict, nil)
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	defer pinning.Close()
+
+	if err := pinning.PinKeyForNamespace("example.com/payments/", "old-key", "example.com", "Dev"); err != nil {
+		t.Fatalf("Failed to pin namespace: %v", err)
+	}
+	accepted, err := pinning.InteractivePinKey("example.com/payments/charge", "new-key", "example.com", "Dev")
+	if err != nil || accepted {
+		t.Fatalf("Expected strict mode to reject the key change, got %v, %v", accepted, err)
+	}
+	if key, _ := pinning.GetPinnedKey("example.com/payments/refund"); key != "old-key" {
+		t.Errorf("Expected the namespace to keep its key, got %q", key)
+	}
+}
+
+func TestAcceptNamespaceDecision(t *testing.T) {
+	handler := &mockInteractiveHandler{decision: interactive.UserDecisionAcceptNamespace}
+	pinning, err := NewKeyPinning(createTempDB(t), PinningModeInteractive, handler)
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	defer pinning.Close()
+
+	accepted, err := pinning.InteractivePinKey("example.com/payments/charge", "payments-key", "example.com", "Dev")
+	if err != nil || !accepted {
+		t.Fatalf("Expected the key to be accepted, got %v, %v", accepted, err)
+	}
+	info, err := pinning.GetKeyInfo("example.com/payments/")
+	if err != nil || info == nil || !info.Namespace || info.PublicKeyPEM != "payments-key" {
+		t.Fatalf("Expected a namespace pin, got %+v, %v", info, err)
+	}
+	if info.Provenance != ProvenanceInteractive {
+		t.Errorf("Expected provenance %s, got %s", ProvenanceInteractive, info.Provenance)
+	}
+
+	// Other tools of the namespace are now pinned without a prompt
+	accepted, err = pinning.InteractivePinKey("example.com/payments/refund", "payments-key", "example.com", "Dev")
+	if err != nil || !accepted || handler.prompts != 1 {
+		t.Errorf("Expected a sibling tool to be accepted without a prompt, got %v, %v, %d prompts", accepted, err, handler.prompts)
+	}
+
+	// A flat tool ID has no namespace to pin
+	if _, err := pinning.ApplyUserDecision("calculator", "example.com", "key", "Dev", "", interactive.UserDecisionAcceptNamespace); err == nil {
+		t.Error("Expected accept namespace to fail for a tool without a namespace")
+	}
+}
+
+func TestImportNamespacePins(t *testing.T) {
+	source, err := NewKeyPinning(createTempDB(t), PinningModeAutomatic, nil)
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	defer source.Close()
+
+	key, _ := generateTestKeyPEM(t)
+	if err := source.PinKeyForNamespace("example.com/payments", key, "example.com", "Dev"); err != nil {
+		t.Fatalf("Failed to pin namespace: %v", err)
+	}
+	exported, err := source.ExportPinnedKeys()
+	if err != nil {
+		t.Fatalf("Failed to export keys: %v", err)
+	}
+	if !strings.Contains(exported, `"namespace": true`) {
+		t.Errorf("Expected the export to mark the namespace pin, got %s", exported)
+	}
+
+	target, err := NewKeyPinning(createTempDB(t), PinningModeAutomatic, nil)
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	defer target.Close()
+	report, err := target.ImportPinnedKeys(exported, ImportOptions{})
+	if err != nil || len(report.Imported) != 1 {
+		t.Fatalf("Expected the namespace pin to be imported, got %+v, %v", report, err)
+	}
+	if _, match, _ := target.ResolvePin("example.com/payments/charge"); match != PinMatchNamespace {
+		t.Errorf("Expected the imported pin to cover the namespace, got %q", match)
+	}
+
+	keyJSON, err := json.Marshal(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	invalid := `[{"tool_id": "example.com/payments", "namespace": true, "public_key_pem": ` + string(keyJSON) + `},
+		{"tool_id": "example.com/search/", "namespace": true, "fingerprint": "sha256:` + strings.Repeat("a", 64) + `"}]`
+	report, err = target.ImportPinnedKeys(invalid, ImportOptions{})
+	if err != nil {
+		t.Fatalf("ImportPinnedKeys failed: %v", err)
+	}
+	if len(report.Errors) != 2 || len(report.Imported) != 0 {
+		t.Errorf("Expected both invalid namespace entries to be rejected, got %+v", report)
+	}
+}
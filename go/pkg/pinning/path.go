@@ -0,0 +1,49 @@
+package pinning
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// DBFilename is the file name of the pinning database inside its data
+// directory.
+const DBFilename = "pinned_keys.db"
+
+// DefaultDBPath returns the platform default location of the pinning
+// database:
+//
+//   - Windows: %APPDATA%\SchemaPin\pinned_keys.db
+//   - macOS: ~/Library/Application Support/SchemaPin/pinned_keys.db
+//   - other Unix: $XDG_DATA_HOME/schemapin/pinned_keys.db, falling back to
+//     ~/.local/share/schemapin/pinned_keys.db
+//
+// A database already present at the legacy ~/.schemapin/pinned_keys.db
+// location takes precedence so that existing pins survive upgrades.
+func DefaultDBPath() (string, error) {
+	if homeDir, err := os.UserHomeDir(); err == nil {
+		legacy := filepath.Join(homeDir, ".schemapin", DBFilename)
+		if _, err := os.Stat(legacy); err == nil {
+			return legacy, nil
+		}
+	}
+
+	switch runtime.GOOS {
+	case "windows", "darwin":
+		configDir, err := os.UserConfigDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to locate user config directory: %w", err)
+		}
+		return filepath.Join(configDir, "SchemaPin", DBFilename), nil
+	default:
+		if dataHome := os.Getenv("XDG_DATA_HOME"); filepath.IsAbs(dataHome) {
+			return filepath.Join(dataHome, "schemapin", DBFilename), nil
+		}
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Errorf("failed to get home directory: %w", err)
+		}
+		return filepath.Join(homeDir, ".local", "share", "schemapin", DBFilename), nil
+	}
+}
@@ -0,0 +1,117 @@
+package pinning
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"go.etcd.io/bbolt"
+
+	"github.com/ThirdKeyAi/schemapin/go/internal/logging"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/interactive"
+)
+
+// pendingDecisionsBucket holds the prompts queued in PinningModeQueued,
+// keyed by ID.
+var pendingDecisionsBucket = []byte("pending_decisions")
+
+// WithPendingDecisionStore queues the prompts of PinningModeQueued in
+// store instead of the pinning database, e.g. in an
+// interactive.NewMemoryPendingStore.
+func WithPendingDecisionStore(store *interactive.PendingDecisionStore) Option {
+	return func(k *KeyPinning) {
+		k.pending = store
+	}
+}
+
+// PendingDecisions returns the store prompts are queued in with
+// PinningModeQueued: the one given to WithPendingDecisionStore, or else
+// one kept in the pending_decisions bucket of the pinning database, which
+// logs every change as an audit record.
+func (k *KeyPinning) PendingDecisions() *interactive.PendingDecisionStore {
+	return k.pending
+}
+
+// newPendingStore returns the store of the pinning database.
+func (k *KeyPinning) newPendingStore() *interactive.PendingDecisionStore {
+	return interactive.NewPendingDecisionStore(pendingBucket{k}, interactive.PendingStoreOptions{
+		Clock:   k.clock,
+		OnEvent: k.logPendingEvent,
+	})
+}
+
+// logPendingEvent logs a change to a queued prompt.
+func (k *KeyPinning) logPendingEvent(event interactive.PendingEvent) {
+	prompt := event.Decision.Prompt
+	k.logger.Info("pending decision "+string(event.Type),
+		logging.KeyToolID, prompt.ToolID,
+		logging.KeyDomain, prompt.Domain,
+		"id", event.Decision.ID,
+		"prompt", prompt.PromptType,
+		"decision", event.Decision.Decision)
+}
+
+// pendingBucket stores queued prompts in the pinning database.
+type pendingBucket struct {
+	k *KeyPinning
+}
+
+func (p pendingBucket) ViewPending(fn func(items map[string]*interactive.PendingDecision) error) error {
+	return safeView(p.k.db, func(tx *bbolt.Tx) error {
+		items, err := readPending(p.k.sealed(tx, pendingDecisionsBucket))
+		if err != nil {
+			return err
+		}
+		return fn(items)
+	})
+}
+
+func (p pendingBucket) UpdatePending(fn func(items map[string]*interactive.PendingDecision) error) error {
+	return p.k.update(func(tx *bbolt.Tx) error {
+		bucket := p.k.sealed(tx, pendingDecisionsBucket)
+		items, err := readPending(bucket)
+		if err != nil {
+			return err
+		}
+		if err := fn(items); err != nil {
+			return err
+		}
+		var removed [][]byte
+		err = bucket.forEach(func(id, _ []byte) error {
+			if _, ok := items[string(id)]; !ok {
+				removed = append(removed, id)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, id := range removed {
+			if err := bucket.delete(id); err != nil {
+				return err
+			}
+		}
+		for id, item := range items {
+			data, err := json.Marshal(item)
+			if err != nil {
+				return fmt.Errorf("failed to marshal pending decision: %w", err)
+			}
+			if err := bucket.put([]byte(id), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func readPending(bucket sealedBucket) (map[string]*interactive.PendingDecision, error) {
+	items := make(map[string]*interactive.PendingDecision)
+	err := bucket.forEach(func(id, data []byte) error {
+		var item interactive.PendingDecision
+		if err := json.Unmarshal(data, &item); err != nil {
+			return fmt.Errorf("undecodable pending decision %s: %w", id, err)
+		}
+		items[string(id)] = &item
+		return nil
+	})
+	return items, err
+}
@@ -2,16 +2,29 @@
 package pinning
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"go.etcd.io/bbolt"
 
+	"github.com/ThirdKeyAi/schemapin/go/internal/logging"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/interactive"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/requestid"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
 )
 
 // PinningMode defines the key pinning behavior
@@ -21,6 +34,11 @@ const (
 	PinningModeInteractive PinningMode = "interactive"
 	PinningModeAutomatic   PinningMode = "automatic"
 	PinningModeStrict      PinningMode = "strict"
+	// PinningModeQueued puts the decisions of interactive mode to a
+	// PendingDecisionStore (see PendingDecisions) instead of a handler: a
+	// prompt is queued and the pin decision fails with an
+	// *interactive.DecisionPendingError until it is answered.
+	PinningModeQueued PinningMode = "queued"
 )
 
 // PinningPolicy defines domain-specific pinning policies
@@ -35,12 +53,33 @@ const (
 
 // PinnedKeyInfo represents stored key information
 type PinnedKeyInfo struct {
-	ToolID        string    `json:"tool_id"`
-	PublicKeyPEM  string    `json:"public_key_pem"`
-	Domain        string    `json:"domain"`
-	DeveloperName string    `json:"developer_name,omitempty"`
-	PinnedAt      time.Time `json:"pinned_at"`
-	LastVerified  time.Time `json:"last_verified,omitempty"`
+	ToolID string `json:"tool_id"`
+	// Namespace reports that the pin was made with PinKeyForNamespace for
+	// every tool under ToolID, a prefix ending in "/".
+	Namespace     bool   `json:"namespace,omitempty"`
+	PublicKeyPEM  string `json:"public_key_pem"`
+	Fingerprint   string `json:"fingerprint,omitempty"`
+	Domain        string `json:"domain"`
+	DeveloperName string `json:"developer_name,omitempty"`
+	// KeyScope is the discovery scope the key was resolved from: empty for
+	// the domain-wide key, otherwise the matching .well-known tools prefix.
+	KeyScope string `json:"key_scope,omitempty"`
+	// Provenance is how the key was obtained and SourceDetail, when set,
+	// the discovery URL, bundle ID, policy file or import file it came from.
+	Provenance   Provenance `json:"provenance,omitempty"`
+	SourceDetail string     `json:"source_detail,omitempty"`
+	PinnedAt     time.Time  `json:"pinned_at"`
+	// LastVerified is the time of the last successful verification.
+	LastVerified time.Time `json:"last_verified,omitempty"`
+	// Verification statistics, maintained by UpdateLastVerified.
+	// FirstVerified is the first verification of either outcome, and
+	// RecentVerifications holds the last RecentVerificationLimit of them,
+	// oldest first.
+	VerificationCount   int64               `json:"verification_count,omitempty"`
+	SuccessCount        int64               `json:"success_count,omitempty"`
+	FailureCount        int64               `json:"failure_count,omitempty"`
+	FirstVerified       time.Time           `json:"first_verified,omitempty"`
+	RecentVerifications []VerificationEvent `json:"recent_verifications,omitempty"`
 }
 
 // DomainPolicy represents a domain-specific policy
@@ -50,69 +89,310 @@ type DomainPolicy struct {
 	CreatedAt time.Time     `json:"created_at"`
 }
 
-// KeyPinning manages TOFU key storage with BoltDB
+// KeyPinning manages TOFU key storage with BoltDB. It is safe for
+// concurrent use: every read and write of a pin is a single database
+// transaction, and the mode is guarded by a mutex.
 type KeyPinning struct {
-	db                 *bbolt.DB
-	dbPath             string
+	db      *bbolt.DB
+	dbPath  string
+	handler interactive.InteractiveHandler
+
+	// mu guards mode and interactiveManager, which ApplyPolicy can change
+	mu                 sync.RWMutex
 	mode               PinningMode
 	interactiveManager *interactive.InteractivePinningManager
-	discovery          *discovery.PublicKeyDiscovery
+	// storedMode is set when NewKeyPinning was given no mode, so the mode
+	// follows the default_mode stored by ApplyPolicy
+	storedMode bool
+
+	discovery   *discovery.PublicKeyDiscovery
+	logger      *slog.Logger
+	boundary    *TrustBoundary
+	clock       clock.Clock
+	checkAtOpen bool
+	dryRun      bool
+	readOnly    bool
+	pending     *interactive.PendingDecisionStore
+	storeKey    []byte
+	cipher      *storeCipher
+}
+
+// ErrReadOnlyPinStore is returned by every method that would write to a
+// pinning database opened read-only (see WithReadOnly), before anything is
+// attempted.
+var ErrReadOnlyPinStore = errors.New("pin store is read-only")
+
+// Option configures a KeyPinning.
+type Option func(*KeyPinning)
+
+// WithLogger routes pinning diagnostics, such as pin decisions and key
+// changes, to logger. By default nothing is logged.
+func WithLogger(logger *slog.Logger) Option {
+	return func(k *KeyPinning) {
+		k.logger = logging.OrDiscard(logger)
+	}
+}
+
+// WithClock sets the time source for pinned_at, last_verified and policy
+// timestamps. The default is clock.Real.
+func WithClock(c clock.Clock) Option {
+	return func(k *KeyPinning) {
+		k.clock = clock.OrReal(c)
+	}
+}
+
+// WithDryRun makes every write to the pinning database a no-op: writes run
+// in a transaction that is rolled back, so methods behave and log as they
+// otherwise would, with a dry_run attribute, but nothing is stored. Pin
+// decisions are never put to the interactive handler; PinDecision reports
+// the prompt that would have been shown and the writes that were
+// suppressed instead.
+func WithDryRun(dryRun bool) Option {
+	return func(k *KeyPinning) {
+		k.dryRun = dryRun
+	}
+}
+
+// WithReadOnly opens the pinning database read-only, for hosts that verify
+// against a database provisioned elsewhere, e.g. on a read-only volume.
+// The file must already exist; it is opened without write access and is
+// never created, migrated or modified. Every method that would write,
+// including pinning, policies, verification statistics, rejections,
+// imports and maintenance, fails with ErrReadOnlyPinStore instead, and
+// fetched documents are not cached. It cannot be combined with
+// WithDryRun.
+func WithReadOnly(readOnly bool) Option {
+	return func(k *KeyPinning) {
+		k.readOnly = readOnly
+	}
+}
+
+// WithIntegrityCheck runs IntegrityCheck when the database is opened.
+// NewKeyPinning then fails with a schemaerr.ErrPinStoreCorrupt error if
+// any problem is found, so callers can start a repair instead of hitting
+// errors later during verification. Off by default.
+func WithIntegrityCheck() Option {
+	return func(k *KeyPinning) {
+		k.checkAtOpen = true
+	}
+}
+
+// WithTrustBoundary rejects keys for domains outside boundary before any
+// domain policy, existing pin or prompt is consulted.
+func WithTrustBoundary(boundary *TrustBoundary) Option {
+	return func(k *KeyPinning) {
+		k.boundary = boundary
+	}
 }
 
 var (
 	// Bucket names
-	pinnedKeysBucket     = []byte("pinned_keys")
-	domainPoliciesBucket = []byte("domain_policies")
+	pinnedKeysBucket        = []byte("pinned_keys")
+	domainPoliciesBucket    = []byte("domain_policies")
+	discoveryVersionsBucket = []byte("discovery_versions")
+	settingsBucket          = []byte("settings")
+	rejectedKeysBucket      = []byte("rejected_keys")
+	revocationCacheBucket   = []byte("revocation_cache")
+	discoveryCacheBucket    = []byte("discovery_cache")
+
+	// defaultModeKey is the settings row holding the default_mode of the
+	// last applied policy document.
+	defaultModeKey = []byte("default_mode")
 )
 
-// NewKeyPinning creates a new KeyPinning instance
-func NewKeyPinning(dbPath string, mode PinningMode, handler interactive.InteractiveHandler) (*KeyPinning, error) {
+// NewKeyPinning creates a new KeyPinning instance. An empty dbPath selects
+// DefaultDBPath. Missing parent directories are created readable only by
+// the current user. An empty mode selects the default_mode stored in the
+// database by ApplyPolicy, or PinningModeInteractive if none is stored; a
+// mode given explicitly is always used.
+func NewKeyPinning(dbPath string, mode PinningMode, handler interactive.InteractiveHandler, opts ...Option) (*KeyPinning, error) {
 	if dbPath == "" {
-		homeDir, err := os.UserHomeDir()
+		defaultPath, err := DefaultDBPath()
 		if err != nil {
-			return nil, fmt.Errorf("failed to get home directory: %w", err)
+			return nil, err
 		}
-		dbPath = filepath.Join(homeDir, ".schemapin", "pinned_keys.db")
+		dbPath = defaultPath
 	}
 
-	// Ensure directory exists
-	if err := os.MkdirAll(filepath.Dir(dbPath), 0750); err != nil {
-		return nil, fmt.Errorf("failed to create database directory: %w", err)
+	k := &KeyPinning{
+		dbPath:  dbPath,
+		handler: handler,
+		logger:  logging.Discard(),
+		clock:   clock.Real,
+	}
+	for _, opt := range opts {
+		opt(k)
+	}
+	if k.readOnly && k.dryRun {
+		return nil, fmt.Errorf("a read-only pinning database cannot be opened for a dry run")
+	}
+	if k.storeKey != nil {
+		c, err := newStoreCipher(k.storeKey)
+		if err != nil {
+			return nil, err
+		}
+		k.cipher = c
 	}
 
-	// Open BoltDB
+	if k.readOnly {
+		db, err := openDBReadOnly(dbPath, k.cipher)
+		if err != nil {
+			return nil, err
+		}
+		k.db = db
+	} else {
+		// Ensure directory exists
+		if err := os.MkdirAll(filepath.Dir(dbPath), 0700); err != nil {
+			return nil, fmt.Errorf("failed to create database directory: %w", err)
+		}
+		db, err := openDB(dbPath, k.cipher)
+		if err != nil {
+			return nil, err
+		}
+		k.db = db
+	}
+
+	if k.dryRun {
+		k.logger = k.logger.With("dry_run", true)
+	}
+	if k.readOnly {
+		k.logger = k.logger.With("read_only", true)
+	}
+	if k.pending == nil {
+		k.pending = k.newPendingStore()
+	}
+	if mode == "" {
+		k.storedMode = true
+		mode = PinningModeInteractive
+		if stored, err := k.storedDefaultMode(); err == nil && stored != "" {
+			mode = stored
+		}
+	}
+	k.setMode(mode)
+	discoveryOpts := []discovery.Option{discovery.WithLogger(k.logger)}
+	if !k.readOnly {
+		discoveryOpts = append(discoveryOpts, discovery.WithRevocationCache(k), discovery.WithDocumentCache(k))
+	}
+	k.discovery = discovery.NewPublicKeyDiscovery(discoveryOpts...)
+
+	if k.checkAtOpen {
+		report, err := k.IntegrityCheck()
+		if err == nil {
+			err = report.Err()
+		}
+		if err != nil {
+			_ = k.db.Close()
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// NewKeyPinningReadOnly opens the existing pinning database at dbPath
+// read-only, in automatic mode without an interactive handler. See
+// WithReadOnly.
+func NewKeyPinningReadOnly(dbPath string, opts ...Option) (*KeyPinning, error) {
+	return NewKeyPinning(dbPath, PinningModeAutomatic, nil, append(opts, WithReadOnly(true))...)
+}
+
+// openDB opens the BoltDB file at dbPath, creating the buckets, checking
+// the pins are encrypted with c, or not if c is nil, and running
+// migrations. Files bbolt rejects as invalid, or whose pages cannot be
+// read by the migrations, are reported as schemaerr.ErrPinStoreCorrupt.
+func openDB(dbPath string, c *storeCipher) (*bbolt.DB, error) {
 	db, err := bbolt.Open(dbPath, 0600, &bbolt.Options{Timeout: 1 * time.Second})
 	if err != nil {
+		if isCorruptFileError(err) {
+			return nil, &schemaerr.Error{
+				Kind: schemaerr.ErrPinStoreCorrupt,
+				Err:  fmt.Errorf("failed to open database: %w", err),
+			}
+		}
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 
 	// Create buckets
-	err = db.Update(func(tx *bbolt.Tx) error {
+	err = safeUpdate(db, func(tx *bbolt.Tx) error {
 		if _, err := tx.CreateBucketIfNotExists(pinnedKeysBucket); err != nil {
 			return fmt.Errorf("failed to create pinned_keys bucket: %w", err)
 		}
 		if _, err := tx.CreateBucketIfNotExists(domainPoliciesBucket); err != nil {
 			return fmt.Errorf("failed to create domain_policies bucket: %w", err)
 		}
-		return nil
+		if _, err := tx.CreateBucketIfNotExists(discoveryVersionsBucket); err != nil {
+			return fmt.Errorf("failed to create discovery_versions bucket: %w", err)
+		}
+		if _, err := tx.CreateBucketIfNotExists(settingsBucket); err != nil {
+			return fmt.Errorf("failed to create settings bucket: %w", err)
+		}
+		if _, err := tx.CreateBucketIfNotExists(rejectedKeysBucket); err != nil {
+			return fmt.Errorf("failed to create rejected_keys bucket: %w", err)
+		}
+		if _, err := tx.CreateBucketIfNotExists(revocationCacheBucket); err != nil {
+			return fmt.Errorf("failed to create revocation_cache bucket: %w", err)
+		}
+		if _, err := tx.CreateBucketIfNotExists(discoveryCacheBucket); err != nil {
+			return fmt.Errorf("failed to create discovery_cache bucket: %w", err)
+		}
+		if _, err := tx.CreateBucketIfNotExists(pendingDecisionsBucket); err != nil {
+			return fmt.Errorf("failed to create pending_decisions bucket: %w", err)
+		}
+		if _, err := tx.CreateBucketIfNotExists(pinIndexBucket); err != nil {
+			return fmt.Errorf("failed to create pin_index bucket: %w", err)
+		}
+		if err := checkStoreEncryption(tx, c, true); err != nil {
+			return fmt.Errorf("pinning database %s: %w", dbPath, err)
+		}
+		if err := migrateProvenance(tx, c); err != nil {
+			return err
+		}
+		return migrateVerificationStats(tx, c)
 	})
 	if err != nil {
 		_ = db.Close()
 		return nil, err
 	}
+	return db, nil
+}
 
-	var interactiveManager *interactive.InteractivePinningManager
-	if mode == PinningModeInteractive && handler != nil {
-		interactiveManager = interactive.NewInteractivePinningManager(handler)
+// openDBReadOnly opens the existing BoltDB file at dbPath without write
+// access. A missing file is an error wrapping os.ErrNotExist rather than
+// being created, and a file without the buckets of a pinning database is
+// refused, since they cannot be created. The pins must be encrypted with
+// c, or not if c is nil.
+func openDBReadOnly(dbPath string, c *storeCipher) (*bbolt.DB, error) {
+	if _, err := os.Stat(dbPath); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("pinning database %s does not exist; a read-only database must be provisioned in advance: %w", dbPath, err)
+		}
+		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
-
-	return &KeyPinning{
-		db:                 db,
-		dbPath:             dbPath,
-		mode:               mode,
-		interactiveManager: interactiveManager,
-		discovery:          discovery.NewPublicKeyDiscovery(),
-	}, nil
+	db, err := bbolt.Open(dbPath, 0400, &bbolt.Options{Timeout: 1 * time.Second, ReadOnly: true})
+	if err != nil {
+		if isCorruptFileError(err) {
+			return nil, &schemaerr.Error{
+				Kind: schemaerr.ErrPinStoreCorrupt,
+				Err:  fmt.Errorf("failed to open database: %w", err),
+			}
+		}
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	err = safeView(db, func(tx *bbolt.Tx) error {
+		for _, name := range knownBuckets {
+			if tx.Bucket(name) == nil {
+				return fmt.Errorf("%s is not an up-to-date pinning database: missing %s bucket; open it read-write once to create them", dbPath, name)
+			}
+		}
+		if err := checkStoreEncryption(tx, c, false); err != nil {
+			return fmt.Errorf("pinning database %s: %w", dbPath, err)
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return db, nil
 }
 
 // Close closes the database connection
@@ -123,84 +403,272 @@ func (k *KeyPinning) Close() error {
 	return nil
 }
 
-// PinKey stores a public key for a tool
+// DBPath returns the path of the database backing this instance.
+func (k *KeyPinning) DBPath() string {
+	return k.dbPath
+}
+
+// PinKey stores a public key for a tool, recorded as ProvenanceManual
 func (k *KeyPinning) PinKey(toolID, publicKeyPEM, domain, developerName string) error {
+	return k.PinKeyWithOptions(toolID, publicKeyPEM, domain, developerName, PinOptions{})
+}
+
+// PinKeyWithScope stores a public key for a tool along with the discovery
+// scope it came from (see discovery.ScopedKey), so that a later switch
+// between a tool-scoped and the domain-wide key is detected as a key change.
+func (k *KeyPinning) PinKeyWithScope(toolID, publicKeyPEM, domain, developerName, keyScope string) error {
+	return k.PinKeyWithOptions(toolID, publicKeyPEM, domain, developerName, PinOptions{KeyScope: keyScope})
+}
+
+// PinKeyWithOptions stores a public key for a tool along with its scope and
+// provenance.
+func (k *KeyPinning) PinKeyWithOptions(toolID, publicKeyPEM, domain, developerName string, opts PinOptions) error {
+	if opts.Provenance == "" {
+		opts.Provenance = ProvenanceManual
+	}
 	keyInfo := PinnedKeyInfo{
 		ToolID:        toolID,
 		PublicKeyPEM:  publicKeyPEM,
 		Domain:        domain,
 		DeveloperName: developerName,
-		PinnedAt:      time.Now().UTC(),
+		KeyScope:      opts.KeyScope,
+		Provenance:    opts.Provenance,
+		SourceDetail:  opts.SourceDetail,
+		PinnedAt:      clock.Timestamp(k.clock.Now()),
 	}
 
-	data, err := json.Marshal(keyInfo)
-	if err != nil {
-		return fmt.Errorf("failed to marshal key info: %w", err)
+	err := k.update(func(tx *bbolt.Tx) error {
+		return k.pins(tx).put(toolID, &keyInfo)
+	})
+	if err == nil {
+		k.logger.Info("key pinned",
+			logging.KeyToolID, toolID,
+			logging.KeyDomain, domain,
+			"fingerprint", fingerprintOf(publicKeyPEM),
+			"key_scope", opts.KeyScope,
+			"provenance", opts.Provenance,
+			"source_detail", opts.SourceDetail)
+	}
+	return err
+}
+
+// PinKeyIfAbsent pins publicKeyPEM for toolID unless the tool already has
+// a pin, checking and writing in one transaction so that concurrent
+// first uses of a tool cannot overwrite each other's pin. A fingerprint-only
+// pin matching the key is completed. When a pin is left in place it is
+// returned; the result is nil if the key was pinned.
+func (k *KeyPinning) PinKeyIfAbsent(toolID, publicKeyPEM, domain, developerName string, opts PinOptions) (*PinnedKeyInfo, error) {
+	if opts.Provenance == "" {
+		opts.Provenance = ProvenanceManual
+	}
+	keyInfo := PinnedKeyInfo{
+		ToolID:        toolID,
+		PublicKeyPEM:  publicKeyPEM,
+		Domain:        domain,
+		DeveloperName: developerName,
+		KeyScope:      opts.KeyScope,
+		Provenance:    opts.Provenance,
+		SourceDetail:  opts.SourceDetail,
+		PinnedAt:      clock.Timestamp(k.clock.Now()),
 	}
 
-	return k.db.Update(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket(pinnedKeysBucket)
-		return bucket.Put([]byte(toolID), data)
+	var existing *PinnedKeyInfo
+	err := k.update(func(tx *bbolt.Tx) error {
+		pins := k.pins(tx)
+		info, err := pins.get(toolID)
+		if err != nil {
+			return err
+		}
+		if info != nil {
+			if info.PublicKeyPEM != "" || !crypto.FingerprintEqual(info.Fingerprint, fingerprintOf(publicKeyPEM)) {
+				existing = info
+				return nil
+			}
+			// The completed pin keeps the provenance of the fingerprint pin
+			keyInfo.Provenance, keyInfo.SourceDetail = info.Provenance, info.SourceDetail
+		}
+		return pins.put(toolID, &keyInfo)
 	})
+	if err != nil || existing != nil {
+		return existing, err
+	}
+	k.logger.Info("key pinned",
+		logging.KeyToolID, toolID,
+		logging.KeyDomain, domain,
+		"fingerprint", fingerprintOf(publicKeyPEM),
+		"key_scope", opts.KeyScope,
+		"provenance", keyInfo.Provenance,
+		"source_detail", keyInfo.SourceDetail)
+	return nil, nil
 }
 
-// GetPinnedKey retrieves the pinned public key for a tool
-func (k *KeyPinning) GetPinnedKey(toolID string) (string, error) {
-	var publicKeyPEM string
-	err := k.db.View(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket(pinnedKeysBucket)
-		data := bucket.Get([]byte(toolID))
-		if data == nil {
-			return nil // Not found
-		}
+// pinFingerprint stores a fingerprint-only pin for a tool. The pin is
+// completed with the full key the first time a matching key is presented.
+func (k *KeyPinning) pinFingerprint(toolID, fingerprint, domain, developerName string, opts PinOptions) error {
+	keyInfo := PinnedKeyInfo{
+		ToolID:        toolID,
+		Fingerprint:   fingerprint,
+		Domain:        domain,
+		DeveloperName: developerName,
+		Provenance:    opts.Provenance,
+		SourceDetail:  opts.SourceDetail,
+		PinnedAt:      clock.Timestamp(k.clock.Now()),
+	}
 
-		var keyInfo PinnedKeyInfo
-		if err := json.Unmarshal(data, &keyInfo); err != nil {
-			return fmt.Errorf("failed to unmarshal key info: %w", err)
-		}
+	err := k.update(func(tx *bbolt.Tx) error {
+		return k.pins(tx).put(toolID, &keyInfo)
+	})
+	if err == nil {
+		k.logger.Info("fingerprint pinned",
+			logging.KeyToolID, toolID,
+			logging.KeyDomain, domain,
+			"fingerprint", fingerprint,
+			"provenance", opts.Provenance,
+			"source_detail", opts.SourceDetail)
+	}
+	return err
+}
 
-		publicKeyPEM = keyInfo.PublicKeyPEM
+// migratePinnedKeys rewrites every pin for which update reports a change,
+// through the cipher c. Entries that cannot be decoded are left for the
+// readers to report.
+func migratePinnedKeys(tx *bbolt.Tx, c *storeCipher, name string, update func(*PinnedKeyInfo) bool) error {
+	pins := pinBucketOf(tx, c)
+	updates := make(map[string]PinnedKeyInfo)
+	err := pins.rows.bucket.ForEach(func(row, v []byte) error {
+		toolID, keyInfo, err := pins.decode(row, v)
+		if err != nil {
+			return nil
+		}
+		if update(&keyInfo) {
+			updates[toolID] = keyInfo
+		}
 		return nil
 	})
+	if err == nil {
+		for toolID, keyInfo := range updates {
+			keyInfo := keyInfo
+			if err = pins.put(toolID, &keyInfo); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to migrate pinned key %s: %w", name, err)
+	}
+	return nil
+}
+
+// fingerprintOf returns the fingerprint of publicKeyPEM for log records, or
+// an empty string if the key cannot be parsed.
+func fingerprintOf(publicKeyPEM string) string {
+	fingerprint, err := crypto.NewKeyManager().CalculateKeyFingerprintFromPEM(publicKeyPEM)
+	if err != nil {
+		return ""
+	}
+	return fingerprint
+}
+
+// update runs fn in a read-write transaction, which in dry run is rolled
+// back instead of committed. A read-only database fails with
+// ErrReadOnlyPinStore without running fn.
+func (k *KeyPinning) update(fn func(*bbolt.Tx) error) error {
+	if k.readOnly {
+		return ErrReadOnlyPinStore
+	}
+	if !k.dryRun {
+		return k.db.Update(fn)
+	}
+	tx, err := k.db.Begin(true)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+	return fn(tx)
+}
+
+// DryRun reports whether the pinning database was opened with WithDryRun.
+func (k *KeyPinning) DryRun() bool {
+	return k.dryRun
+}
 
+// ReadOnly reports whether the pinning database was opened with
+// WithReadOnly.
+func (k *KeyPinning) ReadOnly() bool {
+	return k.readOnly
+}
+
+// logDecision records the outcome of an interactive pinning decision.
+func (k *KeyPinning) logDecision(toolID, domain string, trust TrustDecision, reason string) {
+	attrs := []any{
+		logging.KeyToolID, toolID,
+		logging.KeyDomain, domain,
+		"accepted", trust != "",
+		"reason", reason,
+	}
+	if trust != "" {
+		attrs = append(attrs, "trust_decision", trust)
+	}
+	k.logger.Info("pin decision", attrs...)
+}
+
+// GetPinnedKey retrieves the pinned public key for a tool, from the tool's
+// own pin or a namespace pin covering it (see ResolvePin)
+func (k *KeyPinning) GetPinnedKey(toolID string) (string, error) {
+	keyInfo, _, err := k.ResolvePin(toolID)
 	if err != nil {
 		return "", err
 	}
-	if publicKeyPEM == "" {
+	if keyInfo == nil {
 		return "", nil // Not found
 	}
+	return keyInfo.PublicKeyPEM, nil
+}
 
-	return publicKeyPEM, nil
+// corruptPinError reports a pinned key record that cannot be decoded.
+func corruptPinError(toolID string, err error) error {
+	return &schemaerr.Error{
+		Kind:   schemaerr.ErrPinStoreCorrupt,
+		ToolID: toolID,
+		Err:    fmt.Errorf("failed to unmarshal key info: %w", err),
+	}
 }
 
-// IsKeyPinned checks if a key is pinned for a tool
+// IsKeyPinned checks if a key is pinned for a tool, by its own pin or a
+// namespace pin covering it
 func (k *KeyPinning) IsKeyPinned(toolID string) bool {
-	key, err := k.GetPinnedKey(toolID)
-	return err == nil && key != ""
+	info, _, err := k.ResolvePin(toolID)
+	return err == nil && info != nil && (info.PublicKeyPEM != "" || info.Fingerprint != "")
 }
 
-// UpdateLastVerified updates the last verification timestamp
-func (k *KeyPinning) UpdateLastVerified(toolID string) error {
-	return k.db.Update(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket(pinnedKeysBucket)
-		data := bucket.Get([]byte(toolID))
-		if data == nil {
-			return fmt.Errorf("tool not found: %s", toolID)
-		}
-
-		var keyInfo PinnedKeyInfo
-		if err := json.Unmarshal(data, &keyInfo); err != nil {
-			return fmt.Errorf("failed to unmarshal key info: %w", err)
-		}
-
-		keyInfo.LastVerified = time.Now().UTC()
+// UpdateLastVerified records a verification of toolID's pinned key with the
+// given outcome. It updates the verification counters and recent history,
+// and on success also the last verification timestamp. A tool covered by a
+// namespace pin records its verifications in that pin.
+func (k *KeyPinning) UpdateLastVerified(toolID string, success bool) error {
+	return k.UpdateLastVerifiedContext(context.Background(), toolID, success)
+}
 
-		updatedData, err := json.Marshal(keyInfo)
+// UpdateLastVerifiedContext is UpdateLastVerified for a verification whose
+// context may carry a request ID, which is recorded with the event.
+func (k *KeyPinning) UpdateLastVerifiedContext(ctx context.Context, toolID string, success bool) error {
+	requestID, _ := requestid.FromContext(ctx)
+	return k.update(func(tx *bbolt.Tx) error {
+		pins := k.pins(tx)
+		keyInfo, _, err := resolvePin(pins, toolID)
 		if err != nil {
-			return fmt.Errorf("failed to marshal updated key info: %w", err)
+			return err
+		}
+		if keyInfo == nil {
+			return &schemaerr.Error{
+				Kind:    schemaerr.ErrKeyNotFound,
+				ToolID:  toolID,
+				Message: fmt.Sprintf("tool not found: %s", toolID),
+			}
 		}
 
-		return bucket.Put([]byte(toolID), updatedData)
+		keyInfo.recordVerification(clock.Timestamp(k.clock.Now()), success, requestID)
+		return pins.put(keyInfo.ToolID, keyInfo)
 	})
 }
 
@@ -209,7 +677,7 @@ func (k *KeyPinning) SetDomainPolicy(domain string, policy PinningPolicy) error
 	domainPolicy := DomainPolicy{
 		Domain:    domain,
 		Policy:    policy,
-		CreatedAt: time.Now().UTC(),
+		CreatedAt: clock.Timestamp(k.clock.Now()),
 	}
 
 	data, err := json.Marshal(domainPolicy)
@@ -217,9 +685,8 @@ func (k *KeyPinning) SetDomainPolicy(domain string, policy PinningPolicy) error
 		return fmt.Errorf("failed to marshal domain policy: %w", err)
 	}
 
-	return k.db.Update(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket(domainPoliciesBucket)
-		return bucket.Put([]byte(domain), data)
+	return k.update(func(tx *bbolt.Tx) error {
+		return k.sealed(tx, domainPoliciesBucket).put([]byte(domain), data)
 	})
 }
 
@@ -228,9 +695,8 @@ func (k *KeyPinning) GetDomainPolicy(domain string) PinningPolicy {
 	var policy PinningPolicy = PinningPolicyDefault
 
 	_ = k.db.View(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket(domainPoliciesBucket)
-		data := bucket.Get([]byte(domain))
-		if data == nil {
+		data, err := k.sealed(tx, domainPoliciesBucket).get([]byte(domain))
+		if err != nil || data == nil {
 			return nil // Use default
 		}
 
@@ -246,23 +712,24 @@ func (k *KeyPinning) GetDomainPolicy(domain string) PinningPolicy {
 	return policy
 }
 
-// GetKeyInfo retrieves complete information about a pinned key
+// RemoveDomainPolicy removes the pinning policy of a domain, which then
+// falls back to PinningPolicyDefault. Removing a policy that does not
+// exist is not an error.
+func (k *KeyPinning) RemoveDomainPolicy(domain string) error {
+	return k.update(func(tx *bbolt.Tx) error {
+		return k.sealed(tx, domainPoliciesBucket).delete([]byte(domain))
+	})
+}
+
+// GetKeyInfo retrieves complete information about the pin stored for
+// toolID, or for a namespace pin its normalized namespace. Unlike
+// ResolvePin it does not fall back to namespace pins.
 func (k *KeyPinning) GetKeyInfo(toolID string) (*PinnedKeyInfo, error) {
 	var keyInfo *PinnedKeyInfo
 	err := k.db.View(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket(pinnedKeysBucket)
-		data := bucket.Get([]byte(toolID))
-		if data == nil {
-			return nil // Not found
-		}
-
-		var info PinnedKeyInfo
-		if err := json.Unmarshal(data, &info); err != nil {
-			return fmt.Errorf("failed to unmarshal key info: %w", err)
-		}
-
-		keyInfo = &info
-		return nil
+		var err error
+		keyInfo, err = k.pins(tx).get(toolID)
+		return err
 	})
 
 	return keyInfo, err
@@ -273,56 +740,94 @@ func (k *KeyPinning) ListPinnedKeys() ([]map[string]interface{}, error) {
 	var keys []map[string]interface{}
 
 	err := k.db.View(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket(pinnedKeysBucket)
-		return bucket.ForEach(func(k, v []byte) error {
-			var keyInfo PinnedKeyInfo
-			if err := json.Unmarshal(v, &keyInfo); err != nil {
-				return err
-			}
-
+		return k.pins(tx).forEach(func(keyInfo PinnedKeyInfo) error {
 			keyMap := map[string]interface{}{
 				"tool_id":        keyInfo.ToolID,
 				"domain":         keyInfo.Domain,
 				"developer_name": keyInfo.DeveloperName,
-				"pinned_at":      keyInfo.PinnedAt.Format(time.RFC3339),
+				"pinned_at":      clock.Format(keyInfo.PinnedAt),
 			}
 
 			if !keyInfo.LastVerified.IsZero() {
-				keyMap["last_verified"] = keyInfo.LastVerified.Format(time.RFC3339)
+				keyMap["last_verified"] = clock.Format(keyInfo.LastVerified)
+			}
+
+			keyMap["verification_count"] = keyInfo.VerificationCount
+			keyMap["success_count"] = keyInfo.SuccessCount
+			keyMap["failure_count"] = keyInfo.FailureCount
+			if !keyInfo.FirstVerified.IsZero() {
+				keyMap["first_verified"] = clock.Format(keyInfo.FirstVerified)
+			}
+
+			if keyInfo.Namespace {
+				keyMap["namespace"] = true
+			}
+			if keyInfo.KeyScope != "" {
+				keyMap["key_scope"] = keyInfo.KeyScope
+			}
+
+			keyMap["provenance"] = string(keyInfo.Provenance)
+			if keyInfo.SourceDetail != "" {
+				keyMap["source_detail"] = keyInfo.SourceDetail
 			}
 
 			keys = append(keys, keyMap)
 			return nil
 		})
 	})
+	sort.Slice(keys, func(i, j int) bool { return keys[i]["tool_id"].(string) < keys[j]["tool_id"].(string) })
 
 	return keys, err
 }
 
-// RemovePinnedKey removes a pinned key for a tool
+// RemovePinnedKey removes a pinned key for a tool, or a namespace pin given
+// its normalized namespace. Tools under a namespace are not affected by
+// removing their own pins.
 func (k *KeyPinning) RemovePinnedKey(toolID string) error {
-	return k.db.Update(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket(pinnedKeysBucket)
-		return bucket.Delete([]byte(toolID))
+	err := k.update(func(tx *bbolt.Tx) error {
+		return k.pins(tx).delete(toolID)
 	})
+	if err == nil {
+		k.logger.Info("pinned key removed", logging.KeyToolID, toolID)
+	}
+	return err
 }
 
-// ExportPinnedKeys exports all pinned keys to JSON format
-func (k *KeyPinning) ExportPinnedKeys() (string, error) {
+// ListPinnedKeyInfo returns complete information about every pinned key,
+// ordered by tool ID.
+func (k *KeyPinning) ListPinnedKeyInfo() ([]PinnedKeyInfo, error) {
 	var keys []PinnedKeyInfo
 
 	err := k.db.View(func(tx *bbolt.Tx) error {
-		bucket := tx.Bucket(pinnedKeysBucket)
-		return bucket.ForEach(func(k, v []byte) error {
-			var keyInfo PinnedKeyInfo
-			if err := json.Unmarshal(v, &keyInfo); err != nil {
-				return err
-			}
+		return k.pins(tx).forEach(func(keyInfo PinnedKeyInfo) error {
 			keys = append(keys, keyInfo)
 			return nil
 		})
 	})
+	return keys, err
+}
 
+// PinSetHash returns a hash of every pin's tool ID, domain and key, as
+// "sha256:<hex>". It changes when a pin is added, removed or re-keyed, but
+// not when verification statistics are updated, so callers can tell
+// whether results obtained earlier still reflect the pinned keys.
+func (k *KeyPinning) PinSetHash() (string, error) {
+	keys, err := k.ListPinnedKeyInfo()
+	if err != nil {
+		return "", err
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ToolID < keys[j].ToolID })
+	h := sha256.New()
+	for _, info := range keys {
+		fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s\n", info.ToolID, info.Domain, info.Fingerprint, strings.TrimSpace(info.PublicKeyPEM))
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ExportPinnedKeys exports all pinned keys to JSON format. The export is
+// plaintext, also from an encrypted database (see WithStoreEncryption).
+func (k *KeyPinning) ExportPinnedKeys() (string, error) {
+	keys, err := k.ListPinnedKeyInfo()
 	if err != nil {
 		return "", err
 	}
@@ -335,61 +840,135 @@ func (k *KeyPinning) ExportPinnedKeys() (string, error) {
 	return string(data), nil
 }
 
-// ImportPinnedKeys imports pinned keys from JSON format
-func (k *KeyPinning) ImportPinnedKeys(jsonData string, overwrite bool) (int, error) {
-	var keys []PinnedKeyInfo
-	if err := json.Unmarshal([]byte(jsonData), &keys); err != nil {
-		return 0, fmt.Errorf("failed to unmarshal JSON data: %w", err)
-	}
+// PinDecision is the outcome of an interactive pinning decision.
+type PinDecision struct {
+	// Accepted reports whether the key may be used.
+	Accepted bool
+	// PolicyUpdated is the domain policy recorded because of the user's
+	// answer ("always trust" or "never trust"), or empty if none was.
+	PolicyUpdated PinningPolicy
+	// WouldPrompt, in dry run (see WithDryRun), is the prompt the user
+	// would have been shown. The decision is then not Accepted.
+	WouldPrompt interactive.PromptType
+	// WouldHave describes, in dry run, the writes and prompts that were
+	// suppressed, e.g. "would pin key sha256:... for tool weather".
+	WouldHave []string
+	// TrustDecision is why an Accepted key was trusted.
+	TrustDecision TrustDecision
+}
 
-	imported := 0
-	for _, keyInfo := range keys {
-		if !overwrite && k.IsKeyPinned(keyInfo.ToolID) {
-			continue
-		}
+// wouldHave notes a suppressed write or prompt in d when in dry run.
+func (k *KeyPinning) wouldHave(d *PinDecision, format string, args ...interface{}) {
+	if k.dryRun {
+		d.WouldHave = append(d.WouldHave, fmt.Sprintf(format, args...))
+	}
+}
 
-		if overwrite {
-			_ = k.RemovePinnedKey(keyInfo.ToolID)
-		}
+// wouldPrompt is the decision, in dry run, for a key the user would have
+// been asked about with prompt.
+func (k *KeyPinning) wouldPrompt(toolID, domain string, prompt interactive.PromptType) PinDecision {
+	var d PinDecision
+	d.WouldPrompt = prompt
+	k.wouldHave(&d, "would prompt user: %s for tool %s", prompt, toolID)
+	k.logger.Info("pin decision deferred to user",
+		logging.KeyToolID, toolID,
+		logging.KeyDomain, domain,
+		"prompt", prompt)
+	return d
+}
 
-		if err := k.PinKey(keyInfo.ToolID, keyInfo.PublicKeyPEM, keyInfo.Domain, keyInfo.DeveloperName); err == nil {
-			imported++
-		}
+// pinForDecision pins the key as decided, for toolID or, when set, for
+// namespace, setting d.Accepted and, if the key was pinned, d.TrustDecision
+// to trust.
+func (k *KeyPinning) pinForDecision(d *PinDecision, trust TrustDecision, toolID, namespace, publicKeyPEM, domain, developerName string, opts PinOptions) {
+	if namespace != "" {
+		d.Accepted = k.PinKeyForNamespaceWithOptions(namespace, publicKeyPEM, domain, developerName, opts) == nil
+	} else {
+		d.Accepted = k.PinKeyWithOptions(toolID, publicKeyPEM, domain, developerName, opts) == nil
+	}
+	if d.Accepted {
+		d.TrustDecision = trust
 	}
+	k.wouldHave(d, "would pin key %s for %s", fingerprintOf(publicKeyPEM), describePin(toolID, namespace))
+}
 
-	return imported, nil
+// describePin names the pin of toolID, or of namespace when set, for dry
+// run notes.
+func describePin(toolID, namespace string) string {
+	if namespace != "" {
+		return "namespace " + namespace
+	}
+	return "tool " + toolID
 }
 
 // InteractivePinKey handles interactive key pinning with user prompts
 func (k *KeyPinning) InteractivePinKey(toolID, publicKeyPEM, domain, developerName string) (bool, error) {
+	decision, err := k.interactivePinKeyWithOptions(toolID, publicKeyPEM, domain, developerName, false)
+	return decision.Accepted, err
+}
+
+// InteractivePinKeyWithDecision is InteractivePinKey, but also reports any
+// domain policy the user's answer recorded.
+func (k *KeyPinning) InteractivePinKeyWithDecision(toolID, publicKeyPEM, domain, developerName string) (PinDecision, error) {
 	return k.interactivePinKeyWithOptions(toolID, publicKeyPEM, domain, developerName, false)
 }
 
 // interactivePinKeyWithOptions handles interactive key pinning with force prompt option
-func (k *KeyPinning) interactivePinKeyWithOptions(toolID, publicKeyPEM, domain, developerName string, forcePrompt bool) (bool, error) {
-	// Check domain policy first
+func (k *KeyPinning) interactivePinKeyWithOptions(toolID, publicKeyPEM, domain, developerName string, forcePrompt bool) (PinDecision, error) {
+	// The trust boundary overrides pins, policies and the user
+	if err := k.boundary.Check(domain); err != nil {
+		k.logDecision(toolID, domain, "", "outside trust boundary")
+		return PinDecision{}, err
+	}
+
+	// Check domain policy
 	domainPolicy := k.GetDomainPolicy(domain)
 
 	if domainPolicy == PinningPolicyNeverTrust {
-		return false, nil
+		k.logDecision(toolID, domain, "", "domain policy never_trust")
+		var d PinDecision
+		k.recordKeyRejection(&d, toolID, domain, publicKeyPEM, RejectionReasonPolicy)
+		return d, nil
 	} else if domainPolicy == PinningPolicyAlwaysTrust {
-		return k.PinKey(toolID, publicKeyPEM, domain, developerName) == nil, nil
+		k.logDecision(toolID, domain, TrustPolicyAlwaysTrust, "domain policy always_trust")
+		var d PinDecision
+		k.pinForDecision(&d, TrustPolicyAlwaysTrust, toolID, "", publicKeyPEM, domain, developerName, PinOptions{Provenance: ProvenancePolicy, SourceDetail: "domain policy always_trust"})
+		return d, nil
+	}
+
+	// Complete a fingerprint-only pin, or reject a key that does not match it
+	if info, err := k.GetKeyInfo(toolID); err == nil && info != nil && info.PublicKeyPEM == "" && info.Fingerprint != "" {
+		fingerprint, err := crypto.NewKeyManager().CalculateKeyFingerprintFromPEM(publicKeyPEM)
+		if err != nil || !crypto.FingerprintEqual(fingerprint, info.Fingerprint) {
+			k.logDecision(toolID, domain, "", "key does not match pinned fingerprint")
+			var d PinDecision
+			k.recordKeyRejection(&d, toolID, domain, publicKeyPEM, RejectionReasonPolicy)
+			return d, nil
+		}
+		k.logDecision(toolID, domain, TrustPrePinned, "key matches pinned fingerprint")
+		// The completed pin keeps the provenance of the fingerprint pin
+		var d PinDecision
+		k.pinForDecision(&d, TrustPrePinned, toolID, "", publicKeyPEM, domain, developerName, PinOptions{Provenance: info.Provenance, SourceDetail: info.SourceDetail})
+		return d, nil
 	}
 
-	// Check if key is already pinned
-	existingKey, err := k.GetPinnedKey(toolID)
+	// Check if key is already pinned, for the tool or its namespace
+	existing, match, err := k.ResolvePin(toolID)
 	if err != nil {
-		return false, fmt.Errorf("failed to check existing key: %w", err)
+		return PinDecision{}, fmt.Errorf("failed to check existing key: %w", err)
 	}
 
-	if existingKey != "" {
-		if existingKey == publicKeyPEM {
+	if existing != nil && existing.PublicKeyPEM != "" {
+		if crypto.PublicKeyPEMEqual(existing.PublicKeyPEM, publicKeyPEM) {
 			// Same key, just update verification time
-			_ = k.UpdateLastVerified(toolID)
-			return true, nil
+			k.logger.Debug("presented key matches pin", logging.KeyToolID, toolID, logging.KeyDomain, domain)
+			_ = k.UpdateLastVerified(toolID, true)
+			d := PinDecision{Accepted: true, TrustDecision: TrustForPinMatch(match)}
+			k.wouldHave(&d, "would record a successful verification of tool %s", toolID)
+			return d, nil
 		} else {
 			// Different key - handle key change
-			return k.handleKeyChange(toolID, domain, existingKey, publicKeyPEM, developerName)
+			return k.handleKeyChange(toolID, domain, existing, publicKeyPEM, developerName)
 		}
 	}
 
@@ -398,7 +977,11 @@ func (k *KeyPinning) interactivePinKeyWithOptions(toolID, publicKeyPEM, domain,
 }
 
 // handleFirstTimeKey handles first-time key encounter
-func (k *KeyPinning) handleFirstTimeKey(toolID, domain, publicKeyPEM, developerName string, forcePrompt bool) (bool, error) {
+func (k *KeyPinning) handleFirstTimeKey(toolID, domain, publicKeyPEM, developerName string, forcePrompt bool) (PinDecision, error) {
+	if err := k.checkRejection(toolID, domain, publicKeyPEM); err != nil {
+		return PinDecision{}, err
+	}
+
 	// Check if key is revoked
 	isNotRevoked, err := k.discovery.ValidateKeyNotRevokedWithTimeout(publicKeyPEM, domain, 10*time.Second)
 	if err != nil {
@@ -407,25 +990,24 @@ func (k *KeyPinning) handleFirstTimeKey(toolID, domain, publicKeyPEM, developerN
 	}
 
 	if !isNotRevoked {
-		if k.interactiveManager != nil {
-			decision, err := k.interactiveManager.PromptRevokedKey(toolID, domain, publicKeyPEM, map[string]string{
-				"developer_name": developerName,
-			})
-			if err != nil {
-				return false, err
-			}
-			return decision == interactive.UserDecisionAccept, nil // Temporary accept for revoked keys
-		}
-		return false, nil
+		return k.handleRevokedKey(toolID, domain, publicKeyPEM, developerName)
 	}
 
+	mode, manager := k.modeAndManager()
+
 	// Automatic mode without force prompt
-	if k.mode == PinningModeAutomatic && !forcePrompt {
-		return k.PinKey(toolID, publicKeyPEM, domain, developerName) == nil, nil
+	if mode == PinningModeAutomatic && !forcePrompt {
+		k.logDecision(toolID, domain, TrustAutoPinned, "automatic mode")
+		var d PinDecision
+		k.pinForDecision(&d, TrustAutoPinned, toolID, "", publicKeyPEM, domain, developerName, PinOptions{Provenance: ProvenanceDiscovery, SourceDetail: discovery.ConstructWellKnownURL(domain)})
+		return d, nil
 	}
 
 	// Interactive mode or forced prompt
-	if k.interactiveManager != nil {
+	if manager != nil && k.dryRun {
+		return k.wouldPrompt(toolID, domain, interactive.PromptTypeFirstTimeKey), nil
+	}
+	if manager != nil {
 		developerInfo, err := k.discovery.GetDeveloperInfoWithTimeout(domain, 10*time.Second)
 		if err != nil {
 			// Use provided developer name if discovery fails
@@ -435,30 +1017,42 @@ func (k *KeyPinning) handleFirstTimeKey(toolID, domain, publicKeyPEM, developerN
 			}
 		}
 
-		decision, err := k.interactiveManager.PromptFirstTimeKey(toolID, domain, publicKeyPEM, developerInfo)
+		// Without a history the prompt is still shown, only less informed
+		history, err := k.DomainHistory(domain, toolID, publicKeyPEM, "")
 		if err != nil {
-			return false, err
+			k.logger.Warn("failed to read domain history", logging.KeyDomain, domain, logging.KeyError, err)
 		}
 
-		switch decision {
-		case interactive.UserDecisionAccept:
-			return k.PinKey(toolID, publicKeyPEM, domain, developerName) == nil, nil
-		case interactive.UserDecisionAlwaysTrust:
-			_ = k.SetDomainPolicy(domain, PinningPolicyAlwaysTrust)
-			return k.PinKey(toolID, publicKeyPEM, domain, developerName) == nil, nil
-		case interactive.UserDecisionNeverTrust:
-			_ = k.SetDomainPolicy(domain, PinningPolicyNeverTrust)
-			return false, nil
-		default:
-			return false, nil
+		decision, err := manager.PromptFirstTimeKeyWithHistory(toolID, domain, publicKeyPEM, developerInfo, history)
+		if err != nil {
+			return PinDecision{}, err
 		}
+		return k.ApplyUserDecision(toolID, domain, publicKeyPEM, developerName, "", decision)
 	}
 
-	return false, nil
+	return PinDecision{}, nil
 }
 
-// handleKeyChange handles key change scenario
-func (k *KeyPinning) handleKeyChange(toolID, domain, currentKeyPEM, newKeyPEM, developerName string) (bool, error) {
+// handleKeyChange handles key change scenario. A key change under a
+// namespace pin is a change for the whole namespace: the prompt describes
+// the namespace pin, and accepting the new key re-pins the namespace.
+func (k *KeyPinning) handleKeyChange(toolID, domain string, current *PinnedKeyInfo, newKeyPEM, developerName string) (PinDecision, error) {
+	currentKeyPEM := current.PublicKeyPEM
+	var namespace string
+	if current.Namespace {
+		namespace = current.ToolID
+	}
+	k.logger.Warn("pinned key changed",
+		logging.KeyToolID, toolID,
+		logging.KeyDomain, domain,
+		"namespace", namespace,
+		"pinned_fingerprint", fingerprintOf(currentKeyPEM),
+		"presented_fingerprint", fingerprintOf(newKeyPEM))
+
+	if err := k.checkRejection(toolID, domain, newKeyPEM); err != nil {
+		return PinDecision{}, err
+	}
+
 	// Check if new key is revoked
 	isNotRevoked, err := k.discovery.ValidateKeyNotRevokedWithTimeout(newKeyPEM, domain, 10*time.Second)
 	if err != nil {
@@ -466,35 +1060,44 @@ func (k *KeyPinning) handleKeyChange(toolID, domain, currentKeyPEM, newKeyPEM, d
 	}
 
 	if !isNotRevoked {
-		if k.interactiveManager != nil {
-			decision, err := k.interactiveManager.PromptRevokedKey(toolID, domain, newKeyPEM, map[string]string{
-				"developer_name": developerName,
-			})
-			if err != nil {
-				return false, err
-			}
-			return decision == interactive.UserDecisionAccept, nil // Temporary accept for revoked keys
-		}
-		return false, nil
+		return k.handleRevokedKey(toolID, domain, newKeyPEM, developerName)
 	}
 
+	mode, manager := k.modeAndManager()
+
 	// In strict mode, always reject key changes
-	if k.mode == PinningModeStrict {
-		return false, nil
+	if mode == PinningModeStrict {
+		k.logDecision(toolID, domain, "", "strict mode rejects key changes")
+		var d PinDecision
+		k.recordKeyRejection(&d, toolID, domain, newKeyPEM, RejectionReasonPolicy)
+		return d, nil
 	}
 
 	// Interactive prompt for key change
-	if k.interactiveManager != nil {
-		currentKeyInfo, _ := k.GetKeyInfo(toolID)
-		currentKeyInfoMap := make(map[string]interface{})
-		if currentKeyInfo != nil {
-			currentKeyInfoMap["tool_id"] = currentKeyInfo.ToolID
-			currentKeyInfoMap["domain"] = currentKeyInfo.Domain
-			currentKeyInfoMap["developer_name"] = currentKeyInfo.DeveloperName
-			currentKeyInfoMap["pinned_at"] = currentKeyInfo.PinnedAt.Format(time.RFC3339)
-			if !currentKeyInfo.LastVerified.IsZero() {
-				currentKeyInfoMap["last_verified"] = currentKeyInfo.LastVerified.Format(time.RFC3339)
-			}
+	if manager != nil && k.dryRun {
+		return k.wouldPrompt(toolID, domain, interactive.PromptTypeKeyChange), nil
+	}
+	if manager != nil {
+		currentKeyInfoMap := map[string]interface{}{
+			"tool_id":        current.ToolID,
+			"domain":         current.Domain,
+			"developer_name": current.DeveloperName,
+			"pinned_at":      clock.Format(current.PinnedAt),
+		}
+		if !current.LastVerified.IsZero() {
+			currentKeyInfoMap["last_verified"] = clock.Format(current.LastVerified)
+		}
+		if namespace != "" {
+			currentKeyInfoMap["namespace"] = namespace
+		}
+		// Rejections of the pinned key by other tools of the domain are
+		// worth knowing before trusting a replacement
+		if rejections, err := k.RejectionsOfKey(domain, fingerprintOf(currentKeyPEM)); err == nil && len(rejections) > 0 {
+			currentKeyInfoMap["prior_rejections"] = len(rejections)
+		}
+		// So are other tools of the domain still pinned to the current key
+		if history, err := k.DomainHistory(domain, toolID, newKeyPEM, currentKeyPEM); err == nil {
+			currentKeyInfoMap["domain_history"] = history
 		}
 
 		developerInfo, err := k.discovery.GetDeveloperInfoWithTimeout(domain, 10*time.Second)
@@ -505,29 +1108,117 @@ func (k *KeyPinning) handleKeyChange(toolID, domain, currentKeyPEM, newKeyPEM, d
 			}
 		}
 
-		decision, err := k.interactiveManager.PromptKeyChange(toolID, domain, currentKeyPEM, newKeyPEM, currentKeyInfoMap, developerInfo)
+		decision, err := manager.PromptKeyChange(toolID, domain, currentKeyPEM, newKeyPEM, currentKeyInfoMap, developerInfo)
 		if err != nil {
-			return false, err
+			return PinDecision{}, err
 		}
+		return k.applyUserDecision(toolID, namespace, domain, newKeyPEM, developerName, "", decision, RejectionReasonUser)
+	}
+
+	return PinDecision{}, nil
+}
+
+// ApplyUserDecision carries out the user's answer for toolID's key. Accept
+// pins the key (replacing any previous pin); accept namespace pins it for
+// every tool under the tool's namespace (see interactive.ToolNamespace);
+// always trust also records the domain policy; never trust records the
+// policy and removes any existing pin for the tool; temporary accept allows
+// this one use without pinning or changing policies. Reject and never trust
+// record the key as rejected (see RecordRejection). keyScope is recorded
+// with the pin as in PinKeyWithScope.
+func (k *KeyPinning) ApplyUserDecision(toolID, domain, publicKeyPEM, developerName, keyScope string, decision interactive.UserDecision) (PinDecision, error) {
+	return k.applyUserDecision(toolID, "", domain, publicKeyPEM, developerName, keyScope, decision, RejectionReasonUser)
+}
 
-		switch decision {
-		case interactive.UserDecisionAccept:
-			// Remove old key and pin new one
-			_ = k.RemovePinnedKey(toolID)
-			return k.PinKey(toolID, newKeyPEM, domain, developerName) == nil, nil
-		case interactive.UserDecisionAlwaysTrust:
-			_ = k.SetDomainPolicy(domain, PinningPolicyAlwaysTrust)
-			_ = k.RemovePinnedKey(toolID)
-			return k.PinKey(toolID, newKeyPEM, domain, developerName) == nil, nil
-		case interactive.UserDecisionNeverTrust:
-			_ = k.SetDomainPolicy(domain, PinningPolicyNeverTrust)
-			return false, nil
-		default:
-			return false, nil
+// applyUserDecision is ApplyUserDecision, recording a rejection with reason.
+// When namespace is set the decision is about the namespace pin covering
+// toolID, which is re-pinned or removed in place of the tool's own pin.
+func (k *KeyPinning) applyUserDecision(toolID, namespace, domain, publicKeyPEM, developerName, keyScope string, decision interactive.UserDecision, reason RejectionReason) (PinDecision, error) {
+	var result PinDecision
+	opts := PinOptions{KeyScope: keyScope, Provenance: ProvenanceInteractive, SourceDetail: "user decision " + string(decision)}
+	trust := TrustForUserDecision(decision)
+	pinID := toolID
+	if namespace != "" {
+		pinID = namespace
+	}
+	switch decision {
+	case interactive.UserDecisionAccept:
+		k.pinForDecision(&result, trust, toolID, namespace, publicKeyPEM, domain, developerName, opts)
+	case interactive.UserDecisionAcceptNamespace:
+		if namespace == "" {
+			namespace = interactive.ToolNamespace(toolID)
+		}
+		if namespace == "" {
+			return PinDecision{}, fmt.Errorf("tool %s is not under a namespace", toolID)
+		}
+		k.pinForDecision(&result, trust, toolID, namespace, publicKeyPEM, domain, developerName, opts)
+	case interactive.UserDecisionAlwaysTrust:
+		if err := k.SetDomainPolicy(domain, PinningPolicyAlwaysTrust); err != nil {
+			return PinDecision{}, fmt.Errorf("failed to record domain policy: %w", err)
+		}
+		result.PolicyUpdated = PinningPolicyAlwaysTrust
+		k.wouldHave(&result, "would set domain policy %s for %s", PinningPolicyAlwaysTrust, domain)
+		k.pinForDecision(&result, trust, toolID, namespace, publicKeyPEM, domain, developerName, opts)
+	case interactive.UserDecisionNeverTrust:
+		if err := k.SetDomainPolicy(domain, PinningPolicyNeverTrust); err != nil {
+			return PinDecision{}, fmt.Errorf("failed to record domain policy: %w", err)
 		}
+		result.PolicyUpdated = PinningPolicyNeverTrust
+		k.wouldHave(&result, "would set domain policy %s for %s", PinningPolicyNeverTrust, domain)
+		k.recordKeyRejection(&result, toolID, domain, publicKeyPEM, reason)
+		if err := k.RemovePinnedKey(pinID); err != nil {
+			return result, fmt.Errorf("failed to remove pinned key: %w", err)
+		}
+		k.wouldHave(&result, "would remove the pin of %s", describePin(toolID, namespace))
+	case interactive.UserDecisionReject:
+		k.recordKeyRejection(&result, toolID, domain, publicKeyPEM, reason)
+	case interactive.UserDecisionTemporaryAccept:
+		result.Accepted, result.TrustDecision = true, trust
 	}
 
-	return false, nil
+	k.logDecision(toolID, domain, result.TrustDecision, "user decision "+string(decision))
+	return result, nil
+}
+
+// handleRevokedKey asks whether to temporarily accept a revoked key; without
+// an interactive handler the key is rejected. A revoked key is never pinned,
+// but the user may still mark the domain as never trusted.
+func (k *KeyPinning) handleRevokedKey(toolID, domain, publicKeyPEM, developerName string) (PinDecision, error) {
+	_, manager := k.modeAndManager()
+	if manager == nil {
+		k.logDecision(toolID, domain, "", "key is revoked")
+		var d PinDecision
+		k.recordKeyRejection(&d, toolID, domain, publicKeyPEM, RejectionReasonRevoked)
+		return d, nil
+	}
+	if k.dryRun {
+		return k.wouldPrompt(toolID, domain, interactive.PromptTypeRevokedKey), nil
+	}
+	decision, err := manager.PromptRevokedKey(toolID, domain, publicKeyPEM, map[string]string{
+		"developer_name": developerName,
+	})
+	if err != nil {
+		return PinDecision{}, err
+	}
+	switch decision {
+	case interactive.UserDecisionNeverTrust:
+		return k.applyUserDecision(toolID, "", domain, publicKeyPEM, developerName, "", decision, RejectionReasonRevoked)
+	case interactive.UserDecisionAccept:
+		// Temporary accept for revoked keys
+		k.logDecision(toolID, domain, TrustTemporaryAccept, "revoked key, user decision "+string(decision))
+		return PinDecision{Accepted: true, TrustDecision: TrustTemporaryAccept}, nil
+	default:
+		k.logDecision(toolID, domain, "", "revoked key, user decision "+string(decision))
+		var d PinDecision
+		k.recordKeyRejection(&d, toolID, domain, publicKeyPEM, RejectionReasonRevoked)
+		return d, nil
+	}
+}
+
+// CheckBoundaryViolations lists pinned keys whose domains the configured
+// trust boundary blocks. The pins are left in place.
+func (k *KeyPinning) CheckBoundaryViolations() ([]BoundaryViolation, error) {
+	return k.boundary.PinViolations(k)
 }
 
 // VerifyWithInteractivePinning verifies and potentially pins a key with interactive prompts
@@ -1,15 +1,21 @@
 package pinning
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/interactive"
 )
@@ -18,9 +24,11 @@ import (
 type mockInteractiveHandler struct {
 	decision interactive.UserDecision
 	err      error
+	prompts  int
 }
 
 func (m *mockInteractiveHandler) PromptUser(context *interactive.PromptContext) (interactive.UserDecision, error) {
+	m.prompts++
 	return m.decision, m.err
 }
 
@@ -62,26 +70,87 @@ func TestNewKeyPinning(t *testing.T) {
 }
 
 func TestNewKeyPinningDefaultPath(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		t.Skip("XDG data directory only applies on Linux and other Unix systems")
+	}
 	handler := &mockInteractiveHandler{decision: interactive.UserDecisionAccept}
 
-	// Use a temporary directory for the test
 	tmpDir := t.TempDir()
-	defaultPath := filepath.Join(tmpDir, ".schemapin", "pinned_keys.db")
+	t.Setenv("HOME", filepath.Join(tmpDir, "home"))
+	t.Setenv("XDG_DATA_HOME", filepath.Join(tmpDir, "data"))
 
-	// Create the directory structure
-	err := os.MkdirAll(filepath.Dir(defaultPath), 0755)
+	pinning, err := NewKeyPinning("", PinningModeAutomatic, handler)
 	if err != nil {
-		t.Fatalf("Failed to create test directory: %v", err)
+		t.Fatalf("Failed to create KeyPinning with default path: %v", err)
+	}
+	defer pinning.Close()
+
+	expected := filepath.Join(tmpDir, "data", "schemapin", DBFilename)
+	if pinning.DBPath() != expected {
+		t.Errorf("Expected default dbPath %s, got %s", expected, pinning.DBPath())
+	}
+}
+
+func TestDefaultDBPath(t *testing.T) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		t.Skip("XDG data directory only applies on Linux and other Unix systems")
 	}
+	home := t.TempDir()
+	t.Setenv("HOME", home)
 
-	pinning, err := NewKeyPinning(defaultPath, PinningModeAutomatic, handler)
+	t.Setenv("XDG_DATA_HOME", "")
+	path, err := DefaultDBPath()
 	if err != nil {
-		t.Fatalf("Failed to create KeyPinning with default path: %v", err)
+		t.Fatalf("DefaultDBPath failed: %v", err)
+	}
+	if expected := filepath.Join(home, ".local", "share", "schemapin", DBFilename); path != expected {
+		t.Errorf("Expected %s without XDG_DATA_HOME, got %s", expected, path)
+	}
+
+	// Relative XDG_DATA_HOME values are invalid and ignored
+	t.Setenv("XDG_DATA_HOME", "relative/data")
+	if path, _ := DefaultDBPath(); path != filepath.Join(home, ".local", "share", "schemapin", DBFilename) {
+		t.Errorf("Expected relative XDG_DATA_HOME to be ignored, got %s", path)
+	}
+
+	// An existing legacy database is preferred
+	legacy := filepath.Join(home, ".schemapin", DBFilename)
+	if err := os.MkdirAll(filepath.Dir(legacy), 0700); err != nil {
+		t.Fatalf("Failed to create legacy directory: %v", err)
+	}
+	if err := os.WriteFile(legacy, nil, 0600); err != nil {
+		t.Fatalf("Failed to create legacy database: %v", err)
+	}
+	if path, _ := DefaultDBPath(); path != legacy {
+		t.Errorf("Expected legacy path %s, got %s", legacy, path)
+	}
+}
+
+func TestNewKeyPinningCreatesDirectories(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "nested", "pins", DBFilename)
+
+	pinning, err := NewKeyPinning(dbPath, PinningModeAutomatic, nil)
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning in a missing directory: %v", err)
 	}
 	defer pinning.Close()
 
-	if pinning.dbPath == "" {
-		t.Errorf("Expected default dbPath to be set")
+	if runtime.GOOS == "windows" {
+		return
+	}
+	dirInfo, err := os.Stat(filepath.Dir(dbPath))
+	if err != nil {
+		t.Fatalf("Failed to stat database directory: %v", err)
+	}
+	if perm := dirInfo.Mode().Perm(); perm != 0700 {
+		t.Errorf("Expected directory permissions 0700, got %o", perm)
+	}
+	dbInfo, err := os.Stat(dbPath)
+	if err != nil {
+		t.Fatalf("Failed to stat database: %v", err)
+	}
+	if perm := dbInfo.Mode().Perm(); perm != 0600 {
+		t.Errorf("Expected database permissions 0600, got %o", perm)
 	}
 }
 
@@ -121,6 +190,42 @@ func TestPinKey(t *testing.T) {
 	}
 }
 
+func TestPinKeyIfAbsent(t *testing.T) {
+	kp, err := NewKeyPinning(createTempDB(t), PinningModeAutomatic, nil)
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	defer kp.Close()
+	firstPEM, firstFingerprint := generateTestKeyPEM(t)
+	secondPEM, _ := generateTestKeyPEM(t)
+	opts := PinOptions{Provenance: ProvenanceDiscovery}
+
+	if existing, err := kp.PinKeyIfAbsent("tool", firstPEM, "example.com", "", opts); err != nil || existing != nil {
+		t.Fatalf("Expected the first key to be pinned, got %+v, %v", existing, err)
+	}
+	existing, err := kp.PinKeyIfAbsent("tool", secondPEM, "example.com", "", opts)
+	if err != nil || existing == nil || existing.PublicKeyPEM != firstPEM {
+		t.Fatalf("Expected the existing pin to be kept and returned, got %+v, %v", existing, err)
+	}
+	if key, _ := kp.GetPinnedKey("tool"); key != firstPEM {
+		t.Error("Expected the first pin to be left in place")
+	}
+
+	// A matching fingerprint-only pin is completed, keeping its provenance
+	if err := kp.pinFingerprint("policy-tool", firstFingerprint, "example.com", "", PinOptions{Provenance: ProvenancePolicy}); err != nil {
+		t.Fatal(err)
+	}
+	if existing, err := kp.PinKeyIfAbsent("policy-tool", secondPEM, "example.com", "", opts); err != nil || existing == nil {
+		t.Fatalf("Expected a key not matching the fingerprint to be refused, got %+v, %v", existing, err)
+	}
+	if existing, err := kp.PinKeyIfAbsent("policy-tool", firstPEM, "example.com", "", opts); err != nil || existing != nil {
+		t.Fatalf("Expected the fingerprint pin to be completed, got %+v, %v", existing, err)
+	}
+	if info, _ := kp.GetKeyInfo("policy-tool"); info.PublicKeyPEM != firstPEM || info.Provenance != ProvenancePolicy {
+		t.Errorf("Expected a completed policy pin, got %+v", info)
+	}
+}
+
 func TestGetPinnedKeyNotFound(t *testing.T) {
 	dbPath := createTempDB(t)
 	defer os.Remove(dbPath)
@@ -166,7 +271,7 @@ func TestUpdateLastVerified(t *testing.T) {
 	}
 
 	// Update last verified
-	err = pinning.UpdateLastVerified(toolID)
+	err = pinning.UpdateLastVerified(toolID, true)
 	if err != nil {
 		t.Fatalf("Failed to update last verified: %v", err)
 	}
@@ -192,7 +297,7 @@ func TestUpdateLastVerifiedNotFound(t *testing.T) {
 	}
 	defer pinning.Close()
 
-	err = pinning.UpdateLastVerified("nonexistent-tool")
+	err = pinning.UpdateLastVerified("nonexistent-tool", true)
 	if err == nil {
 		t.Errorf("Expected error for nonexistent tool")
 	}
@@ -379,14 +484,16 @@ func TestExportImportPinnedKeys(t *testing.T) {
 	defer pinning.Close()
 
 	// Pin some keys
+	key1, _ := generateTestKeyPEM(t)
+	key2, _ := generateTestKeyPEM(t)
 	testKeys := []struct {
 		toolID        string
 		publicKeyPEM  string
 		domain        string
 		developerName string
 	}{
-		{"tool1", "key1", "example.com", "Developer 1"},
-		{"tool2", "key2", "test.com", "Developer 2"},
+		{"tool1", key1, "example.com", "Developer 1"},
+		{"tool2", key2, "test.com", "Developer 2"},
 	}
 
 	for _, tk := range testKeys {
@@ -424,13 +531,13 @@ func TestExportImportPinnedKeys(t *testing.T) {
 	defer pinning2.Close()
 
 	// Import keys
-	imported, err := pinning2.ImportPinnedKeys(exportData, false)
+	report, err := pinning2.ImportPinnedKeys(exportData, ImportOptions{})
 	if err != nil {
 		t.Fatalf("Failed to import keys: %v", err)
 	}
 
-	if imported != len(testKeys) {
-		t.Errorf("Expected %d imported keys, got %d", len(testKeys), imported)
+	if len(report.Imported) != len(testKeys) {
+		t.Errorf("Expected %d imported keys, got %v", len(testKeys), report)
 	}
 
 	// Verify imported keys
@@ -675,7 +782,8 @@ func TestSameKeyUpdateVerification(t *testing.T) {
 	dbPath := createTempDB(t)
 	defer os.Remove(dbPath)
 
-	pinning, err := NewKeyPinning(dbPath, PinningModeAutomatic, nil)
+	fake := clock.NewFake(time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC))
+	pinning, err := NewKeyPinning(dbPath, PinningModeAutomatic, nil, WithClock(fake))
 	if err != nil {
 		t.Fatalf("Failed to create KeyPinning: %v", err)
 	}
@@ -702,8 +810,11 @@ func TestSameKeyUpdateVerification(t *testing.T) {
 		t.Fatalf("Failed to get key info: %v", err)
 	}
 
-	// Wait a bit to ensure timestamp difference
-	time.Sleep(10 * time.Millisecond)
+	if !keyInfo1.PinnedAt.Equal(fake.Now()) {
+		t.Errorf("Expected pinned_at %v, got %v", fake.Now(), keyInfo1.PinnedAt)
+	}
+
+	fake.Advance(time.Hour)
 
 	// Pin same key again (should update last verified)
 	result, err = pinning.InteractivePinKey(toolID, publicKeyPEM, domain, developerName)
@@ -722,7 +833,198 @@ func TestSameKeyUpdateVerification(t *testing.T) {
 	}
 
 	// Verify last verified was updated
-	if !keyInfo2.LastVerified.After(keyInfo1.LastVerified) {
-		t.Errorf("Expected last verified to be updated")
+	if !keyInfo2.LastVerified.Equal(fake.Now()) {
+		t.Errorf("Expected last verified %v, got %v", fake.Now(), keyInfo2.LastVerified)
+	}
+	if !keyInfo2.PinnedAt.Equal(keyInfo1.PinnedAt) {
+		t.Errorf("Expected pinned_at to be unchanged")
+	}
+}
+
+// recordingHandler is a slog.Handler that keeps every record it handles.
+type recordingHandler struct {
+	mu      sync.Mutex
+	records []slog.Record
+}
+
+func (h *recordingHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *recordingHandler) Handle(_ context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, r)
+	return nil
+}
+
+func (h *recordingHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h *recordingHandler) WithGroup(string) slog.Handler      { return h }
+
+// find returns the attributes of the first record with message msg.
+func (h *recordingHandler) find(msg string) (slog.Level, map[string]slog.Value, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, r := range h.records {
+		if r.Message != msg {
+			continue
+		}
+		attrs := make(map[string]slog.Value)
+		r.Attrs(func(a slog.Attr) bool {
+			attrs[a.Key] = a.Value
+			return true
+		})
+		return r.Level, attrs, true
+	}
+	return 0, nil, false
+}
+
+func TestKeyChangeLogging(t *testing.T) {
+	// Revocation checks go to a closed server so they fail fast
+	server := httptest.NewServer(http.NotFoundHandler())
+	domain := server.URL
+	server.Close()
+
+	keyManager := crypto.NewKeyManager()
+	var keys, fingerprints [2]string
+	for i := range keys {
+		privateKey, err := keyManager.GenerateKeypair()
+		if err != nil {
+			t.Fatalf("Failed to generate key: %v", err)
+		}
+		if keys[i], err = keyManager.ExportPublicKeyPEM(&privateKey.PublicKey); err != nil {
+			t.Fatalf("Failed to export key: %v", err)
+		}
+		if fingerprints[i], err = keyManager.CalculateKeyFingerprintFromPEM(keys[i]); err != nil {
+			t.Fatalf("Failed to fingerprint key: %v", err)
+		}
+	}
+
+	handler := &recordingHandler{}
+	pinning, err := NewKeyPinning(createTempDB(t), PinningModeStrict, nil, WithLogger(slog.New(handler)))
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	defer pinning.Close()
+
+	if err := pinning.PinKey("test-tool", keys[0], domain, "Test Developer"); err != nil {
+		t.Fatalf("Failed to pin key: %v", err)
+	}
+	accepted, err := pinning.VerifyWithInteractivePinning("test-tool", domain, keys[1], "Test Developer")
+	if err != nil {
+		t.Fatalf("VerifyWithInteractivePinning failed: %v", err)
+	}
+	if accepted {
+		t.Fatal("Expected strict mode to reject the key change")
+	}
+
+	level, attrs, ok := handler.find("pinned key changed")
+	if !ok {
+		t.Fatal("Expected a pinned key changed record")
+	}
+	if level != slog.LevelWarn {
+		t.Errorf("Expected WARN level, got %v", level)
+	}
+	for key, want := range map[string]string{
+		"tool_id":               "test-tool",
+		"domain":                domain,
+		"pinned_fingerprint":    fingerprints[0],
+		"presented_fingerprint": fingerprints[1],
+	} {
+		if got := attrs[key].String(); got != want {
+			t.Errorf("Expected %s=%q, got %q", key, want, got)
+		}
+	}
+
+	_, attrs, ok = handler.find("pin decision")
+	if !ok {
+		t.Fatal("Expected a pin decision record")
+	}
+	if attrs["accepted"].Bool() || attrs["reason"].String() != "strict mode rejects key changes" {
+		t.Errorf("Unexpected pin decision attributes: %v", attrs)
+	}
+	if _, _, ok := handler.find("revocation list unavailable; assuming key is not revoked"); !ok {
+		t.Error("Expected the failed revocation check to be logged through the pinning logger")
+	}
+}
+
+func TestInteractiveDecisionsPersistDomainPolicy(t *testing.T) {
+	// Revocation and developer info lookups go to a closed server
+	server := httptest.NewServer(http.NotFoundHandler())
+	domain := server.URL
+	server.Close()
+
+	tests := []struct {
+		decision      interactive.UserDecision
+		pinnedBefore  bool // prompt as a key change rather than first use
+		wantAccepted  bool
+		wantPolicy    PinningPolicy
+		wantPinned    bool
+		wantReprompts bool
+	}{
+		{interactive.UserDecisionAlwaysTrust, false, true, PinningPolicyAlwaysTrust, true, false},
+		{interactive.UserDecisionAlwaysTrust, true, true, PinningPolicyAlwaysTrust, true, false},
+		{interactive.UserDecisionNeverTrust, false, false, PinningPolicyNeverTrust, false, false},
+		{interactive.UserDecisionNeverTrust, true, false, PinningPolicyNeverTrust, false, false},
+		{interactive.UserDecisionTemporaryAccept, false, true, "", false, true},
+	}
+	for _, tt := range tests {
+		name := string(tt.decision)
+		if tt.pinnedBefore {
+			name += "/key change"
+		}
+		t.Run(name, func(t *testing.T) {
+			dbPath := createTempDB(t)
+			handler := &mockInteractiveHandler{decision: tt.decision}
+			pinning, err := NewKeyPinning(dbPath, PinningModeInteractive, handler)
+			if err != nil {
+				t.Fatalf("Failed to create KeyPinning: %v", err)
+			}
+			if tt.pinnedBefore {
+				if err := pinning.PinKey("test-tool", "old-key", domain, "Test Developer"); err != nil {
+					t.Fatalf("Failed to pin key: %v", err)
+				}
+			}
+
+			decision, err := pinning.InteractivePinKeyWithDecision("test-tool", "new-key", domain, "Test Developer")
+			if err != nil {
+				t.Fatalf("InteractivePinKeyWithDecision failed: %v", err)
+			}
+			if decision.Accepted != tt.wantAccepted || decision.PolicyUpdated != tt.wantPolicy {
+				t.Errorf("Expected accepted=%v policy=%q, got %+v", tt.wantAccepted, tt.wantPolicy, decision)
+			}
+			if pinned := pinning.IsKeyPinned("test-tool"); pinned != tt.wantPinned {
+				t.Errorf("Expected pinned=%v, got %v", tt.wantPinned, pinned)
+			}
+
+			// The policy survives reopening the database
+			if err := pinning.Close(); err != nil {
+				t.Fatalf("Failed to close KeyPinning: %v", err)
+			}
+			pinning, err = NewKeyPinning(dbPath, PinningModeInteractive, handler)
+			if err != nil {
+				t.Fatalf("Failed to reopen KeyPinning: %v", err)
+			}
+			defer pinning.Close()
+
+			wantStored := tt.wantPolicy
+			if wantStored == "" {
+				wantStored = PinningPolicyDefault
+			}
+			if policy := pinning.GetDomainPolicy(domain); policy != wantStored {
+				t.Errorf("Expected stored domain policy %q, got %q", wantStored, policy)
+			}
+
+			// Another tool on the same domain is decided by the stored
+			// policy without prompting; a temporary accept asks again
+			decision, err = pinning.InteractivePinKeyWithDecision("other-tool", "other-key", domain, "Test Developer")
+			if err != nil {
+				t.Fatalf("InteractivePinKeyWithDecision failed: %v", err)
+			}
+			if decision.Accepted != tt.wantAccepted || decision.PolicyUpdated != "" {
+				t.Errorf("Expected accepted=%v without a policy update, got %+v", tt.wantAccepted, decision)
+			}
+			if tt.wantReprompts != (handler.prompts == 2) {
+				t.Errorf("Expected reprompt=%v, got %d prompts", tt.wantReprompts, handler.prompts)
+			}
+		})
 	}
 }
@@ -0,0 +1,344 @@
+package pinning
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.etcd.io/bbolt"
+	"gopkg.in/yaml.v3"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/interactive"
+)
+
+// PolicyDocument is a declarative trust policy that can be applied to a
+// pinning database, typically shipped alongside an agent image.
+//
+// Example (YAML):
+//
+//	default_mode: interactive
+//	domain_policies:
+//	  - domain: tools.example.com
+//	    policy: always_trust
+//	  - domain: untrusted.example.net
+//	    policy: never_trust
+//	pinned_keys:
+//	  - tool_id: calculator
+//	    domain: tools.example.com
+//	    fingerprint: sha256:...
+type PolicyDocument struct {
+	DefaultMode PinningMode `json:"default_mode,omitempty" yaml:"default_mode,omitempty"`
+	// OverwriteDefaultMode replaces a different default_mode stored by an
+	// earlier document instead of reporting a conflict.
+	OverwriteDefaultMode bool `json:"overwrite_default_mode,omitempty" yaml:"overwrite_default_mode,omitempty"`
+
+	DomainPolicies []DomainPolicyEntry `json:"domain_policies,omitempty" yaml:"domain_policies,omitempty"`
+	PinnedKeys     []PinnedKeyEntry    `json:"pinned_keys,omitempty" yaml:"pinned_keys,omitempty"`
+
+	// Source is the file the document was loaded from, recorded as the
+	// source detail of the keys it pins. LoadPolicyFile sets it.
+	Source string `json:"-" yaml:"-"`
+}
+
+// DomainPolicyEntry sets the pinning policy for a single domain.
+type DomainPolicyEntry struct {
+	Domain    string        `json:"domain" yaml:"domain"`
+	Policy    PinningPolicy `json:"policy" yaml:"policy"`
+	Overwrite bool          `json:"overwrite,omitempty" yaml:"overwrite,omitempty"`
+}
+
+// PinnedKeyEntry pre-pins a key for a tool, either by full PEM or by
+// fingerprint. A fingerprint-only pin is completed with the PEM the first
+// time a matching key is presented.
+type PinnedKeyEntry struct {
+	ToolID        string `json:"tool_id" yaml:"tool_id"`
+	Domain        string `json:"domain" yaml:"domain"`
+	DeveloperName string `json:"developer_name,omitempty" yaml:"developer_name,omitempty"`
+	PublicKeyPEM  string `json:"public_key_pem,omitempty" yaml:"public_key_pem,omitempty"`
+	Fingerprint   string `json:"fingerprint,omitempty" yaml:"fingerprint,omitempty"`
+	Overwrite     bool   `json:"overwrite,omitempty" yaml:"overwrite,omitempty"`
+}
+
+// PolicyValidationError identifies the policy entry that failed validation.
+type PolicyValidationError struct {
+	Entry   string
+	Message string
+}
+
+func (e *PolicyValidationError) Error() string {
+	return fmt.Sprintf("invalid policy entry %s: %s", e.Entry, e.Message)
+}
+
+// PolicyConflict describes an entry that was not applied because it
+// disagrees with existing state and does not set overwrite.
+type PolicyConflict struct {
+	Entry   string `json:"entry"`
+	Message string `json:"message"`
+}
+
+// PolicyReport summarizes the effect of applying a policy document.
+type PolicyReport struct {
+	DomainPoliciesApplied int              `json:"domain_policies_applied"`
+	KeysPinned            int              `json:"keys_pinned"`
+	Unchanged             int              `json:"unchanged"`
+	Conflicts             []PolicyConflict `json:"conflicts,omitempty"`
+}
+
+// LoadPolicyFile reads and validates a policy document. Files ending in
+// .yaml or .yml are parsed as YAML; anything else as JSON.
+func LoadPolicyFile(path string) (*PolicyDocument, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+
+	var doc PolicyDocument
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse policy file: %w", err)
+		}
+	default:
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse policy file: %w", err)
+		}
+	}
+
+	if err := doc.Validate(); err != nil {
+		return nil, err
+	}
+	doc.Source = path
+	return &doc, nil
+}
+
+// Validate checks every entry in the document, returning a
+// *PolicyValidationError for the first offending entry.
+func (d *PolicyDocument) Validate() error {
+	switch d.DefaultMode {
+	case "", PinningModeInteractive, PinningModeAutomatic, PinningModeStrict, PinningModeQueued:
+	default:
+		return &PolicyValidationError{Entry: "default_mode", Message: fmt.Sprintf("unknown mode %q", d.DefaultMode)}
+	}
+
+	seenDomains := make(map[string]bool)
+	for i, entry := range d.DomainPolicies {
+		name := fmt.Sprintf("domain_policies[%d]", i)
+		if entry.Domain == "" {
+			return &PolicyValidationError{Entry: name, Message: "domain is required"}
+		}
+		name = fmt.Sprintf("%s (domain=%s)", name, entry.Domain)
+		switch entry.Policy {
+		case PinningPolicyDefault, PinningPolicyAlwaysTrust, PinningPolicyNeverTrust, PinningPolicyInteractiveOnly:
+		default:
+			return &PolicyValidationError{Entry: name, Message: fmt.Sprintf("unknown policy %q", entry.Policy)}
+		}
+		if seenDomains[entry.Domain] {
+			return &PolicyValidationError{Entry: name, Message: "duplicate domain"}
+		}
+		seenDomains[entry.Domain] = true
+	}
+
+	keyManager := crypto.NewKeyManager()
+	seenTools := make(map[string]bool)
+	for i, entry := range d.PinnedKeys {
+		name := fmt.Sprintf("pinned_keys[%d]", i)
+		if entry.ToolID == "" {
+			return &PolicyValidationError{Entry: name, Message: "tool_id is required"}
+		}
+		name = fmt.Sprintf("%s (tool_id=%s)", name, entry.ToolID)
+		if entry.Domain == "" {
+			return &PolicyValidationError{Entry: name, Message: "domain is required"}
+		}
+		if entry.PublicKeyPEM == "" && entry.Fingerprint == "" {
+			return &PolicyValidationError{Entry: name, Message: "one of public_key_pem or fingerprint is required"}
+		}
+		if entry.Fingerprint != "" && !strings.HasPrefix(entry.Fingerprint, "sha256:") {
+			return &PolicyValidationError{Entry: name, Message: "fingerprint must start with \"sha256:\""}
+		}
+		if entry.PublicKeyPEM != "" {
+			fingerprint, err := keyManager.CalculateKeyFingerprintFromPEM(entry.PublicKeyPEM)
+			if err != nil {
+				return &PolicyValidationError{Entry: name, Message: fmt.Sprintf("invalid public_key_pem: %v", err)}
+			}
+			if entry.Fingerprint != "" && !crypto.FingerprintEqual(entry.Fingerprint, fingerprint) {
+				return &PolicyValidationError{Entry: name, Message: "fingerprint does not match public_key_pem"}
+			}
+		}
+		if seenTools[entry.ToolID] {
+			return &PolicyValidationError{Entry: name, Message: "duplicate tool_id"}
+		}
+		seenTools[entry.ToolID] = true
+	}
+
+	return nil
+}
+
+// ApplyPolicyFile loads the policy document at path and applies it.
+func (k *KeyPinning) ApplyPolicyFile(path string) (*PolicyReport, error) {
+	doc, err := LoadPolicyFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return k.ApplyPolicy(doc)
+}
+
+// ApplyPolicy applies a validated policy document to the pinning database.
+// Applying the same document twice is a no-op. Entries that disagree with
+// existing state are reported as conflicts and left untouched unless they
+// set overwrite. A default_mode is stored in the database, like the domain
+// policies, and replaces a different stored one only with
+// overwrite_default_mode. It is the mode of every KeyPinning opened
+// without an explicit mode, including k if it was.
+func (k *KeyPinning) ApplyPolicy(doc *PolicyDocument) (*PolicyReport, error) {
+	if k.readOnly {
+		return nil, ErrReadOnlyPinStore
+	}
+	if err := doc.Validate(); err != nil {
+		return nil, err
+	}
+
+	report := &PolicyReport{}
+	if doc.DefaultMode != "" {
+		existing, err := k.storedDefaultMode()
+		if err != nil {
+			return report, fmt.Errorf("failed to read default mode: %w", err)
+		}
+		switch {
+		case existing == doc.DefaultMode:
+			report.Unchanged++
+		case existing != "" && !doc.OverwriteDefaultMode:
+			report.Conflicts = append(report.Conflicts, PolicyConflict{
+				Entry:   "default_mode",
+				Message: fmt.Sprintf("existing default mode %q differs from %q", existing, doc.DefaultMode),
+			})
+		default:
+			if err := k.storeDefaultMode(doc.DefaultMode); err != nil {
+				return report, fmt.Errorf("failed to store default mode: %w", err)
+			}
+			if k.storedMode {
+				k.setMode(doc.DefaultMode)
+			}
+		}
+	}
+
+	for i, entry := range doc.DomainPolicies {
+		existing := k.GetDomainPolicy(entry.Domain)
+		switch {
+		case existing == entry.Policy:
+			report.Unchanged++
+			continue
+		case existing != PinningPolicyDefault && !entry.Overwrite:
+			report.Conflicts = append(report.Conflicts, PolicyConflict{
+				Entry:   fmt.Sprintf("domain_policies[%d] (domain=%s)", i, entry.Domain),
+				Message: fmt.Sprintf("existing policy %q differs from %q", existing, entry.Policy),
+			})
+			continue
+		}
+		if err := k.SetDomainPolicy(entry.Domain, entry.Policy); err != nil {
+			return report, fmt.Errorf("failed to set policy for domain %s: %w", entry.Domain, err)
+		}
+		report.DomainPoliciesApplied++
+	}
+
+	keyManager := crypto.NewKeyManager()
+	for i, entry := range doc.PinnedKeys {
+		name := fmt.Sprintf("pinned_keys[%d] (tool_id=%s)", i, entry.ToolID)
+
+		wantFingerprint := entry.Fingerprint
+		if entry.PublicKeyPEM != "" {
+			wantFingerprint, _ = keyManager.CalculateKeyFingerprintFromPEM(entry.PublicKeyPEM)
+		}
+
+		existing, err := k.GetKeyInfo(entry.ToolID)
+		if err != nil {
+			return report, fmt.Errorf("failed to read pin for %s: %w", entry.ToolID, err)
+		}
+		if existing != nil {
+			existingFingerprint := existing.Fingerprint
+			if existing.PublicKeyPEM != "" {
+				existingFingerprint, _ = keyManager.CalculateKeyFingerprintFromPEM(existing.PublicKeyPEM)
+			}
+			if crypto.FingerprintEqual(existingFingerprint, wantFingerprint) && existing.Domain == entry.Domain {
+				report.Unchanged++
+				continue
+			}
+			if !entry.Overwrite {
+				report.Conflicts = append(report.Conflicts, PolicyConflict{
+					Entry:   name,
+					Message: fmt.Sprintf("existing pin %s (domain %s) differs from %s (domain %s)", existingFingerprint, existing.Domain, wantFingerprint, entry.Domain),
+				})
+				continue
+			}
+		}
+
+		opts := PinOptions{Provenance: ProvenancePolicy, SourceDetail: doc.Source}
+		if entry.PublicKeyPEM != "" {
+			err = k.PinKeyWithOptions(entry.ToolID, entry.PublicKeyPEM, entry.Domain, entry.DeveloperName, opts)
+		} else {
+			err = k.pinFingerprint(entry.ToolID, strings.ToLower(entry.Fingerprint), entry.Domain, entry.DeveloperName, opts)
+		}
+		if err != nil {
+			return report, fmt.Errorf("failed to pin key for %s: %w", entry.ToolID, err)
+		}
+		report.KeysPinned++
+	}
+
+	return report, nil
+}
+
+// setMode switches the pinning mode. Prompts are only shown in interactive
+// mode, with the handler passed to NewKeyPinning, and queued in queued
+// mode.
+func (k *KeyPinning) setMode(mode PinningMode) {
+	var manager *interactive.InteractivePinningManager
+	switch {
+	case mode == PinningModeInteractive && k.handler != nil:
+		manager = interactive.NewInteractivePinningManager(k.handler)
+	case mode == PinningModeQueued:
+		manager = interactive.NewInteractivePinningManager(interactive.NewQueuedHandler(k.pending))
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.mode, k.interactiveManager = mode, manager
+}
+
+// modeAndManager returns the current mode and, in interactive mode with a
+// handler, the manager to prompt with.
+func (k *KeyPinning) modeAndManager() (PinningMode, *interactive.InteractivePinningManager) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.mode, k.interactiveManager
+}
+
+// storedDefaultMode returns the default_mode stored by ApplyPolicy, or ""
+// if none has been applied.
+func (k *KeyPinning) storedDefaultMode() (PinningMode, error) {
+	var mode PinningMode
+	err := safeView(k.db, func(tx *bbolt.Tx) error {
+		data := tx.Bucket(settingsBucket).Get(defaultModeKey)
+		if data == nil {
+			return nil
+		}
+		if err := json.Unmarshal(data, &mode); err != nil {
+			return err
+		}
+		return (&PolicyDocument{DefaultMode: mode}).Validate()
+	})
+	if err != nil {
+		return "", err
+	}
+	return mode, nil
+}
+
+func (k *KeyPinning) storeDefaultMode(mode PinningMode) error {
+	data, err := json.Marshal(mode)
+	if err != nil {
+		return err
+	}
+	return k.update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(settingsBucket).Put(defaultModeKey, data)
+	})
+}
@@ -0,0 +1,331 @@
+package pinning
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+)
+
+func generateTestKeyPEM(t testing.TB) (string, string) {
+	t.Helper()
+	keyManager := crypto.NewKeyManager()
+	privateKey, err := keyManager.GenerateKeypair()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	publicKeyPEM, err := keyManager.ExportPublicKeyPEM(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatalf("Failed to export public key: %v", err)
+	}
+	fingerprint, err := keyManager.CalculateKeyFingerprint(&privateKey.PublicKey)
+	if err != nil {
+		t.Fatalf("Failed to fingerprint key: %v", err)
+	}
+	return publicKeyPEM, fingerprint
+}
+
+func indent(s, prefix string) string {
+	lines := strings.Split(strings.TrimRight(s, "\n"), "\n")
+	return prefix + strings.Join(lines, "\n"+prefix)
+}
+
+func TestApplyPolicyFileRoundTrip(t *testing.T) {
+	calcPEM, _ := generateTestKeyPEM(t)
+	searchPEM, searchFingerprint := generateTestKeyPEM(t)
+
+	policy := `default_mode: strict
+domain_policies:
+  - domain: tools.example.com
+    policy: always_trust
+  - domain: untrusted.example.net
+    policy: never_trust
+  - domain: partner.example.org
+    policy: interactive_only
+pinned_keys:
+  - tool_id: calculator
+    domain: tools.example.com
+    developer_name: Example Tools
+    public_key_pem: |
+` + indent(calcPEM, "      ") + `
+  - tool_id: search
+    domain: partner.example.org
+    fingerprint: ` + searchFingerprint + `
+`
+	policyPath := filepath.Join(t.TempDir(), "policy.yaml")
+	if err := os.WriteFile(policyPath, []byte(policy), 0600); err != nil {
+		t.Fatalf("Failed to write policy: %v", err)
+	}
+
+	kp, err := NewKeyPinning(createTempDB(t), "", nil)
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	defer kp.Close()
+
+	report, err := kp.ApplyPolicyFile(policyPath)
+	if err != nil {
+		t.Fatalf("ApplyPolicyFile failed: %v", err)
+	}
+	if report.DomainPoliciesApplied != 3 || report.KeysPinned != 2 || len(report.Conflicts) != 0 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+	if kp.mode != PinningModeStrict {
+		t.Errorf("Expected mode strict, got %s", kp.mode)
+	}
+
+	if policy := kp.GetDomainPolicy("untrusted.example.net"); policy != PinningPolicyNeverTrust {
+		t.Errorf("Expected never_trust, got %s", policy)
+	}
+	if key, _ := kp.GetPinnedKey("calculator"); key != calcPEM {
+		t.Error("Calculator key not pinned from policy")
+	}
+	if !kp.IsKeyPinned("search") {
+		t.Error("Fingerprint pin should count as pinned")
+	}
+
+	// Re-applying the same policy is a no-op
+	report, err = kp.ApplyPolicyFile(policyPath)
+	if err != nil {
+		t.Fatalf("Second ApplyPolicyFile failed: %v", err)
+	}
+	if report.DomainPoliciesApplied != 0 || report.KeysPinned != 0 || report.Unchanged != 6 {
+		t.Errorf("Expected idempotent apply, got %+v", report)
+	}
+
+	// A fingerprint pin is completed by the matching key and rejects others
+	otherPEM, _ := generateTestKeyPEM(t)
+	if accepted, _ := kp.InteractivePinKey("search", otherPEM, "partner.example.org", ""); accepted {
+		t.Error("Key not matching the pinned fingerprint should be rejected")
+	}
+	if accepted, _ := kp.InteractivePinKey("search", searchPEM, "partner.example.org", ""); !accepted {
+		t.Error("Key matching the pinned fingerprint should be accepted")
+	}
+	if key, _ := kp.GetPinnedKey("search"); key != searchPEM {
+		t.Error("Fingerprint pin should be completed with the presented key")
+	}
+}
+
+func TestApplyPolicyConflictingPin(t *testing.T) {
+	existingPEM, _ := generateTestKeyPEM(t)
+	policyPEM, _ := generateTestKeyPEM(t)
+
+	kp, err := NewKeyPinning(createTempDB(t), PinningModeAutomatic, nil)
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	defer kp.Close()
+
+	if err := kp.PinKey("calculator", existingPEM, "tools.example.com", ""); err != nil {
+		t.Fatalf("Failed to pin key: %v", err)
+	}
+	if err := kp.SetDomainPolicy("tools.example.com", PinningPolicyNeverTrust); err != nil {
+		t.Fatalf("Failed to set policy: %v", err)
+	}
+
+	doc := &PolicyDocument{
+		DomainPolicies: []DomainPolicyEntry{
+			{Domain: "tools.example.com", Policy: PinningPolicyAlwaysTrust},
+		},
+		PinnedKeys: []PinnedKeyEntry{
+			{ToolID: "calculator", Domain: "tools.example.com", PublicKeyPEM: policyPEM},
+		},
+	}
+
+	report, err := kp.ApplyPolicy(doc)
+	if err != nil {
+		t.Fatalf("ApplyPolicy failed: %v", err)
+	}
+	if len(report.Conflicts) != 2 {
+		t.Fatalf("Expected 2 conflicts, got %+v", report.Conflicts)
+	}
+	if !strings.Contains(report.Conflicts[1].Entry, "pinned_keys[0] (tool_id=calculator)") {
+		t.Errorf("Conflict should identify the entry, got %q", report.Conflicts[1].Entry)
+	}
+	if key, _ := kp.GetPinnedKey("calculator"); key != existingPEM {
+		t.Error("Conflicting pin must not overwrite the existing key")
+	}
+	if policy := kp.GetDomainPolicy("tools.example.com"); policy != PinningPolicyNeverTrust {
+		t.Error("Conflicting policy must not overwrite the existing policy")
+	}
+
+	doc.DomainPolicies[0].Overwrite = true
+	doc.PinnedKeys[0].Overwrite = true
+	report, err = kp.ApplyPolicy(doc)
+	if err != nil {
+		t.Fatalf("ApplyPolicy with overwrite failed: %v", err)
+	}
+	if len(report.Conflicts) != 0 || report.KeysPinned != 1 || report.DomainPoliciesApplied != 1 {
+		t.Errorf("Unexpected report with overwrite: %+v", report)
+	}
+	if key, _ := kp.GetPinnedKey("calculator"); key != policyPEM {
+		t.Error("Overwrite should replace the existing key")
+	}
+}
+
+func TestPolicyValidation(t *testing.T) {
+	validPEM, validFingerprint := generateTestKeyPEM(t)
+
+	tests := []struct {
+		name  string
+		doc   PolicyDocument
+		entry string
+	}{
+		{
+			name:  "unknown mode",
+			doc:   PolicyDocument{DefaultMode: "lenient"},
+			entry: "default_mode",
+		},
+		{
+			name:  "unknown domain policy",
+			doc:   PolicyDocument{DomainPolicies: []DomainPolicyEntry{{Domain: "a.com", Policy: "always_trust"}, {Domain: "b.com", Policy: "sometimes"}}},
+			entry: "domain_policies[1] (domain=b.com)",
+		},
+		{
+			name:  "missing key material",
+			doc:   PolicyDocument{PinnedKeys: []PinnedKeyEntry{{ToolID: "calc", Domain: "a.com"}}},
+			entry: "pinned_keys[0] (tool_id=calc)",
+		},
+		{
+			name:  "invalid PEM",
+			doc:   PolicyDocument{PinnedKeys: []PinnedKeyEntry{{ToolID: "calc", Domain: "a.com", PublicKeyPEM: "not a key"}}},
+			entry: "pinned_keys[0] (tool_id=calc)",
+		},
+		{
+			name:  "fingerprint disagrees with PEM",
+			doc:   PolicyDocument{PinnedKeys: []PinnedKeyEntry{{ToolID: "calc", Domain: "a.com", PublicKeyPEM: validPEM, Fingerprint: "sha256:00"}}},
+			entry: "pinned_keys[0] (tool_id=calc)",
+		},
+		{
+			name: "duplicate tool",
+			doc: PolicyDocument{PinnedKeys: []PinnedKeyEntry{
+				{ToolID: "calc", Domain: "a.com", Fingerprint: validFingerprint},
+				{ToolID: "calc", Domain: "a.com", Fingerprint: validFingerprint},
+			}},
+			entry: "pinned_keys[1] (tool_id=calc)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.doc.Validate()
+			var validationErr *PolicyValidationError
+			if !errors.As(err, &validationErr) {
+				t.Fatalf("Expected PolicyValidationError, got %v", err)
+			}
+			if validationErr.Entry != tt.entry {
+				t.Errorf("Expected entry %q, got %q", tt.entry, validationErr.Entry)
+			}
+		})
+	}
+}
+
+func TestLoadPolicyFileJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	data := `{"default_mode": "automatic", "domain_policies": [{"domain": "a.com", "policy": "never_trust"}]}`
+	if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+		t.Fatalf("Failed to write policy: %v", err)
+	}
+
+	doc, err := LoadPolicyFile(path)
+	if err != nil {
+		t.Fatalf("LoadPolicyFile failed: %v", err)
+	}
+	if doc.DefaultMode != PinningModeAutomatic || len(doc.DomainPolicies) != 1 {
+		t.Errorf("Unexpected document: %+v", doc)
+	}
+}
+
+func TestApplyPolicyDefaultModePersists(t *testing.T) {
+	dbPath := createTempDB(t)
+	kp, err := NewKeyPinning(dbPath, "", nil)
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	if kp.mode != PinningModeInteractive {
+		t.Errorf("Expected interactive without a stored default mode, got %s", kp.mode)
+	}
+	if _, err := kp.ApplyPolicy(&PolicyDocument{DefaultMode: PinningModeStrict}); err != nil {
+		t.Fatalf("ApplyPolicy failed: %v", err)
+	}
+	if kp.mode != PinningModeStrict {
+		t.Errorf("Expected the applied default mode strict, got %s", kp.mode)
+	}
+	if err := kp.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	kp, err = NewKeyPinning(dbPath, "", nil, WithIntegrityCheck())
+	if err != nil {
+		t.Fatalf("Failed to reopen KeyPinning: %v", err)
+	}
+	if kp.mode != PinningModeStrict {
+		t.Errorf("Expected the stored default mode strict after reopening, got %s", kp.mode)
+	}
+
+	// A document without default_mode leaves the stored mode alone
+	if _, err := kp.ApplyPolicy(&PolicyDocument{}); err != nil {
+		t.Fatalf("ApplyPolicy failed: %v", err)
+	}
+	if mode, err := kp.storedDefaultMode(); err != nil || mode != PinningModeStrict {
+		t.Errorf("Expected stored mode strict, got %q, %v", mode, err)
+	}
+	if err := kp.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// An explicit mode is not replaced by the stored one
+	kp, err = NewKeyPinning(dbPath, PinningModeAutomatic, nil)
+	if err != nil {
+		t.Fatalf("Failed to reopen KeyPinning: %v", err)
+	}
+	defer kp.Close()
+	if kp.mode != PinningModeAutomatic {
+		t.Errorf("Expected the explicit mode automatic, got %s", kp.mode)
+	}
+	if _, err := kp.ApplyPolicy(&PolicyDocument{DefaultMode: PinningModeQueued, OverwriteDefaultMode: true}); err != nil {
+		t.Fatalf("ApplyPolicy failed: %v", err)
+	}
+	if kp.mode != PinningModeAutomatic {
+		t.Errorf("Expected the explicit mode automatic after applying a policy, got %s", kp.mode)
+	}
+}
+
+func TestApplyPolicyDefaultModeConflict(t *testing.T) {
+	kp, err := NewKeyPinning(createTempDB(t), "", nil)
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	defer kp.Close()
+
+	if _, err := kp.ApplyPolicy(&PolicyDocument{DefaultMode: PinningModeStrict}); err != nil {
+		t.Fatalf("ApplyPolicy failed: %v", err)
+	}
+
+	report, err := kp.ApplyPolicy(&PolicyDocument{DefaultMode: PinningModeStrict})
+	if err != nil || report.Unchanged != 1 || len(report.Conflicts) != 0 {
+		t.Errorf("Expected the same default mode unchanged, got %+v, %v", report, err)
+	}
+
+	report, err = kp.ApplyPolicy(&PolicyDocument{DefaultMode: PinningModeAutomatic})
+	if err != nil {
+		t.Fatalf("ApplyPolicy failed: %v", err)
+	}
+	if len(report.Conflicts) != 1 || report.Conflicts[0].Entry != "default_mode" {
+		t.Fatalf("Expected a default_mode conflict, got %+v", report.Conflicts)
+	}
+	if mode, _ := kp.storedDefaultMode(); mode != PinningModeStrict || kp.mode != PinningModeStrict {
+		t.Errorf("Expected strict to be kept, got stored %q, mode %s", mode, kp.mode)
+	}
+
+	report, err = kp.ApplyPolicy(&PolicyDocument{DefaultMode: PinningModeAutomatic, OverwriteDefaultMode: true})
+	if err != nil || len(report.Conflicts) != 0 {
+		t.Fatalf("Expected the overwrite to apply, got %+v, %v", report, err)
+	}
+	if mode, _ := kp.storedDefaultMode(); mode != PinningModeAutomatic || kp.mode != PinningModeAutomatic {
+		t.Errorf("Expected automatic, got stored %q, mode %s", mode, kp.mode)
+	}
+}
@@ -0,0 +1,65 @@
+package pinning
+
+import "go.etcd.io/bbolt"
+
+// Provenance records how a pinned key came to be pinned.
+type Provenance string
+
+const (
+	// ProvenanceUnknown marks pins recorded before provenance was tracked.
+	ProvenanceUnknown Provenance = "unknown"
+	// ProvenanceDiscovery is a key pinned from live .well-known discovery
+	// without a prompt, e.g. auto-pin or automatic mode.
+	ProvenanceDiscovery Provenance = "discovery"
+	// ProvenanceBundle is a key pinned from a trust bundle.
+	ProvenanceBundle Provenance = "bundle"
+	// ProvenancePolicy is a key pre-seeded by a policy document or accepted
+	// because of an always_trust domain policy.
+	ProvenancePolicy Provenance = "policy"
+	// ProvenanceImport is a key pinned by ImportPinnedKeys.
+	ProvenanceImport Provenance = "import"
+	// ProvenanceInteractive is a key the user accepted at a prompt.
+	ProvenanceInteractive Provenance = "interactive"
+	// ProvenanceManual is a key pinned directly through PinKey or
+	// PinKeyWithScope.
+	ProvenanceManual Provenance = "manual"
+)
+
+// PinOptions describes where a key being pinned came from.
+type PinOptions struct {
+	// KeyScope is the discovery scope of the key (see PinKeyWithScope).
+	KeyScope string
+	// Provenance is how the key was obtained. Empty means ProvenanceManual.
+	Provenance Provenance
+	// SourceDetail optionally names the source: a discovery URL, bundle ID,
+	// policy file path or import file.
+	SourceDetail string
+}
+
+// ListPinnedKeysByProvenance returns the pinned keys recorded with
+// provenance, e.g. to find every key a given policy file pre-seeded.
+func (k *KeyPinning) ListPinnedKeysByProvenance(provenance Provenance) ([]PinnedKeyInfo, error) {
+	var keys []PinnedKeyInfo
+	err := k.db.View(func(tx *bbolt.Tx) error {
+		return k.pins(tx).forEach(func(keyInfo PinnedKeyInfo) error {
+			if keyInfo.Provenance == provenance {
+				keys = append(keys, keyInfo)
+			}
+			return nil
+		})
+	})
+	return keys, err
+}
+
+// migrateProvenance marks pins written before provenance was tracked as
+// ProvenanceUnknown. Pins that already carry a provenance are left alone,
+// so the migration is safe to run on every open.
+func migrateProvenance(tx *bbolt.Tx, c *storeCipher) error {
+	return migratePinnedKeys(tx, c, "provenance", func(keyInfo *PinnedKeyInfo) bool {
+		if keyInfo.Provenance != "" {
+			return false
+		}
+		keyInfo.Provenance = ProvenanceUnknown
+		return true
+	})
+}
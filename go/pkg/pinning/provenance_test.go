@@ -0,0 +1,150 @@
+package pinning
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.etcd.io/bbolt"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/interactive"
+)
+
+func assertProvenance(t *testing.T, k *KeyPinning, toolID string, want Provenance, wantDetail string) {
+	t.Helper()
+	info, err := k.GetKeyInfo(toolID)
+	if err != nil || info == nil {
+		t.Fatalf("Expected pinned key info for %s, got %v, %v", toolID, info, err)
+	}
+	if info.Provenance != want {
+		t.Errorf("Expected provenance %q for %s, got %q", want, toolID, info.Provenance)
+	}
+	if info.SourceDetail != wantDetail {
+		t.Errorf("Expected source detail %q for %s, got %q", wantDetail, toolID, info.SourceDetail)
+	}
+}
+
+func TestProvenanceAutomaticPin(t *testing.T) {
+	pinning, err := NewKeyPinning(createTempDB(t), PinningModeAutomatic, nil)
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	defer pinning.Close()
+
+	if accepted, err := pinning.InteractivePinKey("tool", "test-key", "example.invalid", "Dev"); err != nil || !accepted {
+		t.Fatalf("Expected automatic pin, got %v, %v", accepted, err)
+	}
+	assertProvenance(t, pinning, "tool", ProvenanceDiscovery, "https://example.invalid/.well-known/schemapin.json")
+}
+
+func TestProvenanceInteractiveAccept(t *testing.T) {
+	handler := &mockInteractiveHandler{decision: interactive.UserDecisionAccept}
+	pinning, err := NewKeyPinning(createTempDB(t), PinningModeInteractive, handler)
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	defer pinning.Close()
+
+	if accepted, err := pinning.InteractivePinKey("tool", "test-key", "example.invalid", "Dev"); err != nil || !accepted {
+		t.Fatalf("Expected accepted key, got %v, %v", accepted, err)
+	}
+	assertProvenance(t, pinning, "tool", ProvenanceInteractive, "user decision accept")
+}
+
+func TestProvenanceImport(t *testing.T) {
+	source, err := NewKeyPinning(createTempDB(t), PinningModeAutomatic, nil)
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	defer source.Close()
+	publicKeyPEM, _ := generateTestKeyPEM(t)
+	if err := source.PinKey("tool", publicKeyPEM, "example.com", "Dev"); err != nil {
+		t.Fatalf("Failed to pin key: %v", err)
+	}
+	assertProvenance(t, source, "tool", ProvenanceManual, "")
+
+	exported, err := source.ExportPinnedKeys()
+	if err != nil {
+		t.Fatalf("Failed to export keys: %v", err)
+	}
+	var entries []map[string]interface{}
+	if err := json.Unmarshal([]byte(exported), &entries); err != nil || len(entries) != 1 {
+		t.Fatalf("Expected one exported key, got %s", exported)
+	}
+	if entries[0]["provenance"] != string(ProvenanceManual) {
+		t.Errorf("Expected provenance in the export, got %v", entries[0])
+	}
+
+	target, err := NewKeyPinning(createTempDB(t), PinningModeAutomatic, nil)
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	defer target.Close()
+	if report, err := target.ImportPinnedKeys(exported, ImportOptions{Source: "pins.json"}); err != nil || len(report.Imported) != 1 {
+		t.Fatalf("Expected one imported key, got %v, %v", report, err)
+	}
+	assertProvenance(t, target, "tool", ProvenanceImport, "pins.json")
+
+	keys, err := target.ListPinnedKeys()
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("Expected one listed key, got %v, %v", keys, err)
+	}
+	if keys[0]["provenance"] != "import" || keys[0]["source_detail"] != "pins.json" {
+		t.Errorf("Expected provenance in the listing, got %v", keys[0])
+	}
+}
+
+func TestProvenancePolicyFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	doc := `{"pinned_keys": [{"tool_id": "tool", "domain": "example.com", "fingerprint": "sha256:abcd"}]}`
+	if err := os.WriteFile(path, []byte(doc), 0600); err != nil {
+		t.Fatalf("Failed to write policy: %v", err)
+	}
+
+	pinning, err := NewKeyPinning(createTempDB(t), PinningModeAutomatic, nil)
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	defer pinning.Close()
+	if _, err := pinning.ApplyPolicyFile(path); err != nil {
+		t.Fatalf("Failed to apply policy: %v", err)
+	}
+	assertProvenance(t, pinning, "tool", ProvenancePolicy, path)
+
+	keys, err := pinning.ListPinnedKeysByProvenance(ProvenancePolicy)
+	if err != nil || len(keys) != 1 || keys[0].ToolID != "tool" {
+		t.Errorf("Expected the policy pin by provenance, got %v, %v", keys, err)
+	}
+	if keys, _ := pinning.ListPinnedKeysByProvenance(ProvenanceImport); len(keys) != 0 {
+		t.Errorf("Expected no imported pins, got %v", keys)
+	}
+}
+
+func TestProvenanceMigration(t *testing.T) {
+	dbPath := createTempDB(t)
+	pinning, err := NewKeyPinning(dbPath, PinningModeAutomatic, nil)
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	// Write a record in the format used before provenance was tracked
+	legacy := `{"tool_id":"old-tool","public_key_pem":"test-key","domain":"example.com","pinned_at":"2024-01-01T00:00:00Z"}`
+	err = pinning.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(pinnedKeysBucket).Put([]byte("old-tool"), []byte(legacy))
+	})
+	if err != nil {
+		t.Fatalf("Failed to write legacy record: %v", err)
+	}
+	if err := pinning.PinKey("new-tool", "test-key", "example.com", "Dev"); err != nil {
+		t.Fatalf("Failed to pin key: %v", err)
+	}
+	pinning.Close()
+
+	pinning, err = NewKeyPinning(dbPath, PinningModeAutomatic, nil)
+	if err != nil {
+		t.Fatalf("Failed to reopen KeyPinning: %v", err)
+	}
+	defer pinning.Close()
+	assertProvenance(t, pinning, "old-tool", ProvenanceUnknown, "")
+	assertProvenance(t, pinning, "new-tool", ProvenanceManual, "")
+}
@@ -0,0 +1,135 @@
+package pinning
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"go.etcd.io/bbolt"
+)
+
+// readOnlyDB returns the path of a pinning database holding a pin for
+// "pinned-tool", left readable only by its owner.
+func readOnlyDB(t *testing.T, publicKeyPEM string) string {
+	t.Helper()
+	dbPath := createTempDB(t)
+	setup, err := NewKeyPinning(dbPath, PinningModeAutomatic, nil)
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	if err := setup.PinKey("pinned-tool", publicKeyPEM, "example.com", "Dev"); err != nil {
+		t.Fatalf("Failed to pin key: %v", err)
+	}
+	if err := setup.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(dbPath, 0400); err != nil {
+		t.Fatal(err)
+	}
+	return dbPath
+}
+
+func TestReadOnlyRefusesWrites(t *testing.T) {
+	pinnedKey, _ := generateTestKeyPEM(t)
+	newKey, newFingerprint := generateTestKeyPEM(t)
+	dbPath := readOnlyDB(t, pinnedKey)
+	before, err := os.ReadFile(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k, err := NewKeyPinningReadOnly(dbPath)
+	if err != nil {
+		t.Fatalf("NewKeyPinningReadOnly failed: %v", err)
+	}
+	if !k.ReadOnly() {
+		t.Error("Expected ReadOnly to be true")
+	}
+	rows := dumpDB(t, k)
+	pemJSON, _ := json.Marshal(newKey)
+	importDoc := `[{"tool_id":"new-tool","domain":"example.com","public_key_pem":` + string(pemJSON) + `}]`
+
+	// Reads work as usual
+	info, err := k.GetKeyInfo("pinned-tool")
+	if err != nil || info == nil || info.PublicKeyPEM != pinnedKey {
+		t.Fatalf("Expected the pinned key to be readable, got %+v, %v", info, err)
+	}
+
+	writes := map[string]func() error{
+		"PinKey":             func() error { return k.PinKey("new-tool", newKey, "example.com", "Dev") },
+		"SetDomainPolicy":    func() error { return k.SetDomainPolicy("example.com", PinningPolicyAlwaysTrust) },
+		"UpdateLastVerified": func() error { return k.UpdateLastVerified("pinned-tool", true) },
+		"RemovePinnedKey":    func() error { return k.RemovePinnedKey("pinned-tool") },
+		"RecordRejection": func() error {
+			return k.RecordRejection("new-tool", "example.com", newFingerprint, RejectionReasonUser)
+		},
+		"ImportPinnedKeys": func() error {
+			_, err := k.ImportPinnedKeys(importDoc, ImportOptions{})
+			return err
+		},
+		"ApplyPolicy": func() error {
+			_, err := k.ApplyPolicy(&PolicyDocument{DefaultMode: PinningModeStrict})
+			return err
+		},
+		"Vacuum": func() error {
+			_, err := k.Vacuum()
+			return err
+		},
+	}
+	for name, write := range writes {
+		if err := write(); !errors.Is(err, ErrReadOnlyPinStore) {
+			t.Errorf("Expected %s to fail with ErrReadOnlyPinStore, got %v", name, err)
+		}
+	}
+
+	// A dry-run import only reads
+	report, err := k.ImportPinnedKeys(importDoc, ImportOptions{DryRun: true})
+	if err != nil || len(report.Imported) != 1 {
+		t.Errorf("Expected a dry-run import to report one key, got %+v, %v", report, err)
+	}
+
+	if after := dumpDB(t, k); !reflect.DeepEqual(rows, after) {
+		t.Errorf("Expected the database to be unchanged, got %v, want %v", after, rows)
+	}
+	if err := k.Close(); err != nil {
+		t.Fatal(err)
+	}
+	after, err := os.ReadFile(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(before, after) {
+		t.Error("Expected the database file to be unchanged")
+	}
+}
+
+func TestReadOnlyOpenErrors(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing", "pins.db")
+	if _, err := NewKeyPinningReadOnly(missing); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected a missing database to fail with os.ErrNotExist, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Dir(missing)); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected nothing to be created for a missing database")
+	}
+
+	// A bbolt file that was never opened as a pinning database has none of
+	// its buckets, which cannot be created read-only
+	empty := filepath.Join(t.TempDir(), "empty.db")
+	db, err := bbolt.Open(empty, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = db.Close()
+	if _, err := NewKeyPinningReadOnly(empty); err == nil {
+		t.Error("Expected a database without pinning buckets to be refused")
+	}
+
+	pinnedKey, _ := generateTestKeyPEM(t)
+	dbPath := readOnlyDB(t, pinnedKey)
+	if _, err := NewKeyPinningReadOnly(dbPath, WithDryRun(true)); err == nil {
+		t.Error("Expected read-only and dry run to be refused together")
+	}
+}
@@ -0,0 +1,333 @@
+package pinning
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.etcd.io/bbolt"
+
+	"github.com/ThirdKeyAi/schemapin/go/internal/logging"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+)
+
+// RejectionReason records why a key was rejected.
+type RejectionReason string
+
+const (
+	// RejectionReasonUser is a key the user rejected at a prompt, or
+	// rejected by marking its domain never trusted.
+	RejectionReasonUser RejectionReason = "user"
+	// RejectionReasonPolicy is a key rejected by a never_trust domain
+	// policy, a fingerprint pin it does not match, or strict mode.
+	RejectionReasonPolicy RejectionReason = "policy"
+	// RejectionReasonRevoked is a revoked key that was not accepted.
+	RejectionReasonRevoked RejectionReason = "revoked"
+)
+
+// RejectedKey is a key rejected for a tool. Once recorded, presenting the
+// same key for the same tool and domain fails with
+// schemaerr.ErrKeyPreviouslyRejected instead of prompting again, until the
+// rejection is cleared with ClearRejection.
+type RejectedKey struct {
+	ToolID      string          `json:"tool_id"`
+	Domain      string          `json:"domain"`
+	Fingerprint string          `json:"fingerprint"`
+	RejectedAt  time.Time       `json:"rejected_at"`
+	Reason      RejectionReason `json:"reason"`
+}
+
+// rejectionKey is the rejected_keys row of a tool, domain and fingerprint.
+func rejectionKey(toolID, domain, fingerprint string) []byte {
+	return []byte(toolID + "\x00" + domain + "\x00" + strings.ToLower(fingerprint))
+}
+
+// RecordRejection records that the key with fingerprint was rejected for
+// toolID on domain, replacing any earlier rejection of the same key.
+func (k *KeyPinning) RecordRejection(toolID, domain, fingerprint string, reason RejectionReason) error {
+	rejected := RejectedKey{
+		ToolID:      toolID,
+		Domain:      domain,
+		Fingerprint: strings.ToLower(fingerprint),
+		RejectedAt:  clock.Timestamp(k.clock.Now()),
+		Reason:      reason,
+	}
+	data, err := json.Marshal(rejected)
+	if err != nil {
+		return fmt.Errorf("failed to marshal rejected key: %w", err)
+	}
+	err = k.update(func(tx *bbolt.Tx) error {
+		return k.sealed(tx, rejectedKeysBucket).put(rejectionKey(toolID, domain, fingerprint), data)
+	})
+	if err == nil {
+		k.logger.Warn("key rejection recorded",
+			logging.KeyToolID, toolID,
+			logging.KeyDomain, domain,
+			"fingerprint", rejected.Fingerprint,
+			"reason", reason)
+	}
+	return err
+}
+
+// recordKeyRejection records the rejection of publicKeyPEM. Keys that do
+// not parse have no fingerprint to remember and are skipped; a failure to
+// record is logged, since the key is rejected either way. In dry run the
+// suppressed record is noted in d.
+func (k *KeyPinning) recordKeyRejection(d *PinDecision, toolID, domain, publicKeyPEM string, reason RejectionReason) {
+	fingerprint := fingerprintOf(publicKeyPEM)
+	if fingerprint == "" {
+		return
+	}
+	if err := k.RecordRejection(toolID, domain, fingerprint, reason); err != nil {
+		k.logger.Warn("failed to record key rejection",
+			logging.KeyToolID, toolID,
+			logging.KeyDomain, domain,
+			logging.KeyError, err)
+	}
+	k.wouldHave(d, "would record a %s rejection of key %s for tool %s", reason, fingerprint, toolID)
+}
+
+// GetRejection returns the rejection of the key with fingerprint for
+// toolID on domain, or nil if there is none.
+func (k *KeyPinning) GetRejection(toolID, domain, fingerprint string) (*RejectedKey, error) {
+	var rejected *RejectedKey
+	err := k.db.View(func(tx *bbolt.Tx) error {
+		data, err := k.sealed(tx, rejectedKeysBucket).get(rejectionKey(toolID, domain, fingerprint))
+		if data == nil && err == nil {
+			return nil
+		}
+		rejected = &RejectedKey{}
+		if err == nil {
+			err = json.Unmarshal(data, rejected)
+		}
+		if err != nil {
+			return &schemaerr.Error{
+				Kind:   schemaerr.ErrPinStoreCorrupt,
+				ToolID: toolID,
+				Err:    fmt.Errorf("failed to unmarshal rejected key: %w", err),
+			}
+		}
+		return nil
+	})
+	return rejected, err
+}
+
+// CheckRejection returns a schemaerr.ErrKeyPreviouslyRejected error if
+// publicKeyPEM was rejected for toolID on domain, and nil otherwise or if
+// the key does not parse.
+func (k *KeyPinning) CheckRejection(toolID, domain, publicKeyPEM string) error {
+	fingerprint := fingerprintOf(publicKeyPEM)
+	if fingerprint == "" {
+		return nil
+	}
+	rejected, err := k.GetRejection(toolID, domain, fingerprint)
+	if err != nil || rejected == nil {
+		return err
+	}
+	return &schemaerr.Error{
+		Kind:        schemaerr.ErrKeyPreviouslyRejected,
+		Domain:      domain,
+		ToolID:      toolID,
+		Fingerprint: fingerprint,
+		Message: fmt.Sprintf("key %s for tool %s was rejected (%s) on %s",
+			fingerprint, toolID, rejected.Reason, clock.Format(rejected.RejectedAt)),
+	}
+}
+
+// ClearRejection forgets the rejection of the key with fingerprint for
+// toolID on domain, so that the key is prompted for again. Clearing a
+// rejection that does not exist is not an error.
+func (k *KeyPinning) ClearRejection(toolID, domain, fingerprint string) error {
+	var found bool
+	err := k.update(func(tx *bbolt.Tx) error {
+		bucket := k.sealed(tx, rejectedKeysBucket)
+		key := rejectionKey(toolID, domain, fingerprint)
+		found = bucket.bucket.Get(bucket.index(key)) != nil
+		return bucket.delete(key)
+	})
+	if err == nil && found {
+		k.logger.Info("key rejection cleared",
+			logging.KeyToolID, toolID,
+			logging.KeyDomain, domain,
+			"fingerprint", strings.ToLower(fingerprint))
+	}
+	return err
+}
+
+// ListRejectedKeys returns every recorded rejection, ordered by tool ID,
+// domain and fingerprint.
+func (k *KeyPinning) ListRejectedKeys() ([]RejectedKey, error) {
+	var rejections []RejectedKey
+	err := k.db.View(func(tx *bbolt.Tx) error {
+		return k.sealed(tx, rejectedKeysBucket).forEach(func(_, v []byte) error {
+			var rejected RejectedKey
+			if err := json.Unmarshal(v, &rejected); err != nil {
+				return err
+			}
+			rejections = append(rejections, rejected)
+			return nil
+		})
+	})
+	return rejections, err
+}
+
+// RejectionsOfKey returns the rejections of the key with fingerprint by
+// any tool on domain.
+func (k *KeyPinning) RejectionsOfKey(domain, fingerprint string) ([]RejectedKey, error) {
+	rejections, err := k.ListRejectedKeys()
+	if err != nil {
+		return nil, err
+	}
+	var matching []RejectedKey
+	for _, rejected := range rejections {
+		if rejected.Domain == domain && crypto.FingerprintEqual(rejected.Fingerprint, fingerprint) {
+			matching = append(matching, rejected)
+		}
+	}
+	return matching, nil
+}
+
+// ExportRejectedKeys exports every recorded rejection as a JSON array that
+// ImportRejectedKeys accepts.
+func (k *KeyPinning) ExportRejectedKeys() (string, error) {
+	rejections, err := k.ListRejectedKeys()
+	if err != nil {
+		return "", err
+	}
+	if rejections == nil {
+		rejections = []RejectedKey{}
+	}
+	data, err := json.MarshalIndent(rejections, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal rejected keys: %w", err)
+	}
+	return string(data), nil
+}
+
+// ImportRejectedKeys imports rejections from a document produced by
+// ExportRejectedKeys. Like ImportPinnedKeys, it rejects a document over the
+// configured limits as a whole and validates each entry on its own: the
+// tool ID, domain and fingerprint are required and the reason must be
+// known. A rejected_at that is missing, malformed or in the future is
+// replaced by the current time. Rejections already recorded are skipped.
+// Only opts.Limits and opts.DryRun apply.
+func (k *KeyPinning) ImportRejectedKeys(jsonData string, opts ImportOptions) (*ImportReport, error) {
+	if k.readOnly && !opts.DryRun {
+		return nil, ErrReadOnlyPinStore
+	}
+	limits := opts.Limits.withDefaults()
+	if len(jsonData) > limits.MaxBytes {
+		return nil, &ImportLimitError{Limit: "bytes", Max: limits.MaxBytes}
+	}
+	raw, err := decodeImportEntries(jsonData, limits.MaxEntries)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ImportReport{DryRun: opts.DryRun}
+	now := clock.Timestamp(k.clock.Now())
+	var accepted []RejectedKey
+	seen := make(map[string]bool)
+	for i, data := range raw {
+		var entry struct {
+			RejectedKey
+			RejectedAt string `json:"rejected_at"`
+		}
+		if err := json.Unmarshal(data, &entry); err != nil {
+			report.Errors = append(report.Errors, ImportIssue{Index: i, Reason: fmt.Sprintf("invalid entry: %v", err)})
+			continue
+		}
+		rejected := entry.RejectedKey
+		if reason := validateRejection(&rejected, limits); reason != "" {
+			report.Errors = append(report.Errors, ImportIssue{Index: i, ToolID: printableToolID(rejected.ToolID, limits), Reason: reason})
+			continue
+		}
+		var reason string
+		if rejected.RejectedAt, reason = sanitizeImportTime("rejected_at", entry.RejectedAt, now); reason != "" {
+			report.Warnings = append(report.Warnings, ImportIssue{Index: i, ToolID: rejected.ToolID, Reason: reason})
+		}
+
+		key := string(rejectionKey(rejected.ToolID, rejected.Domain, rejected.Fingerprint))
+		existing, err := k.GetRejection(rejected.ToolID, rejected.Domain, rejected.Fingerprint)
+		if err != nil {
+			return nil, err
+		}
+		if seen[key] || existing != nil {
+			report.Skipped = append(report.Skipped, ImportIssue{Index: i, ToolID: rejected.ToolID, Reason: "rejection already recorded"})
+			continue
+		}
+		seen[key] = true
+		accepted = append(accepted, rejected)
+		report.Imported = append(report.Imported, rejected.ToolID)
+	}
+
+	if opts.DryRun || len(accepted) == 0 {
+		return report, nil
+	}
+	err = k.update(func(tx *bbolt.Tx) error {
+		bucket := k.sealed(tx, rejectedKeysBucket)
+		for _, rejected := range accepted {
+			data, err := json.Marshal(rejected)
+			if err != nil {
+				return fmt.Errorf("failed to marshal rejected key: %w", err)
+			}
+			if err := bucket.put(rejectionKey(rejected.ToolID, rejected.Domain, rejected.Fingerprint), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to import rejected keys: %w", err)
+	}
+	k.logger.Info("rejected keys imported",
+		"imported", len(report.Imported),
+		"skipped", len(report.Skipped),
+		"errors", len(report.Errors))
+	return report, nil
+}
+
+// validateRejection checks an imported rejection, normalizing its
+// fingerprint, and returns the reason it is invalid.
+func validateRejection(rejected *RejectedKey, limits ImportLimits) string {
+	fields := []struct{ name, value string }{
+		{"tool_id", rejected.ToolID},
+		{"domain", rejected.Domain},
+	}
+	for _, field := range fields {
+		if field.value == "" {
+			return field.name + " is required"
+		}
+		if len(field.value) > limits.MaxFieldLength {
+			return fmt.Sprintf("%s exceeds %d bytes", field.name, limits.MaxFieldLength)
+		}
+		if strings.IndexFunc(field.value, unicode.IsControl) >= 0 {
+			return fmt.Sprintf("%s contains control characters", field.name)
+		}
+	}
+	rejected.Fingerprint = strings.ToLower(rejected.Fingerprint)
+	if !fingerprintPattern.MatchString(rejected.Fingerprint) {
+		return "fingerprint must be \"sha256:\" followed by 64 hex digits"
+	}
+	switch rejected.Reason {
+	case RejectionReasonUser, RejectionReasonPolicy, RejectionReasonRevoked:
+		return ""
+	default:
+		return fmt.Sprintf("unknown reason %q", rejected.Reason)
+	}
+}
+
+// checkRejection is CheckRejection, logging the decision when the key was
+// rejected before.
+func (k *KeyPinning) checkRejection(toolID, domain, publicKeyPEM string) error {
+	err := k.CheckRejection(toolID, domain, publicKeyPEM)
+	if errors.Is(err, schemaerr.ErrKeyPreviouslyRejected) {
+		k.logDecision(toolID, domain, "", "key previously rejected")
+	}
+	return err
+}
@@ -0,0 +1,203 @@
+package pinning
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/interactive"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+)
+
+func TestRejectedKeyFailsFast(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC))
+	handler := &mockInteractiveHandler{decision: interactive.UserDecisionReject}
+	pinning, err := NewKeyPinning(createTempDB(t), PinningModeInteractive, handler, WithClock(fake))
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	defer pinning.Close()
+
+	publicKeyPEM, fingerprint := generateTestKeyPEM(t)
+	if accepted, err := pinning.InteractivePinKey("tool", publicKeyPEM, "example.com", "Dev"); err != nil || accepted {
+		t.Fatalf("Expected the key to be rejected, got %v, %v", accepted, err)
+	}
+	rejections, err := pinning.ListRejectedKeys()
+	if err != nil {
+		t.Fatalf("Failed to list rejected keys: %v", err)
+	}
+	want := []RejectedKey{{ToolID: "tool", Domain: "example.com", Fingerprint: fingerprint, RejectedAt: fake.Now(), Reason: RejectionReasonUser}}
+	if !reflect.DeepEqual(rejections, want) {
+		t.Fatalf("Expected %+v, got %+v", want, rejections)
+	}
+
+	// The same key is not prompted for again
+	_, err = pinning.InteractivePinKey("tool", publicKeyPEM, "example.com", "Dev")
+	if !errors.Is(err, schemaerr.ErrKeyPreviouslyRejected) || handler.prompts != 1 {
+		t.Fatalf("Expected %v without a prompt, got %v after %d prompts", schemaerr.ErrKeyPreviouslyRejected, err, handler.prompts)
+	}
+	var e *schemaerr.Error
+	if !errors.As(err, &e) || e.Fingerprint != fingerprint || e.ToolID != "tool" {
+		t.Errorf("Expected the error to name the tool and key, got %+v", e)
+	}
+
+	// Other tools and domains are still asked
+	if _, err := pinning.InteractivePinKey("other-tool", publicKeyPEM, "example.com", "Dev"); err != nil || handler.prompts != 2 {
+		t.Errorf("Expected a prompt for another tool, got %v after %d prompts", err, handler.prompts)
+	}
+
+	// Clearing the rejection reconsiders the key
+	if err := pinning.ClearRejection("tool", "example.com", strings.ToUpper(fingerprint)); err != nil {
+		t.Fatalf("Failed to clear rejection: %v", err)
+	}
+	handler.decision = interactive.UserDecisionAccept
+	if accepted, err := pinning.InteractivePinKey("tool", publicKeyPEM, "example.com", "Dev"); err != nil || !accepted {
+		t.Fatalf("Expected the reconsidered key to be accepted, got %v, %v", accepted, err)
+	}
+	if handler.prompts != 3 || !pinning.IsKeyPinned("tool") {
+		t.Errorf("Expected a prompt and a pin, got %d prompts", handler.prompts)
+	}
+}
+
+func TestRejectionReasons(t *testing.T) {
+	pinning, err := NewKeyPinning(createTempDB(t), PinningModeStrict, nil)
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	defer pinning.Close()
+
+	// Strict mode rejects a key change
+	pinnedKey, _ := generateTestKeyPEM(t)
+	newKey, newFingerprint := generateTestKeyPEM(t)
+	if err := pinning.PinKey("tool", pinnedKey, "example.com", "Dev"); err != nil {
+		t.Fatalf("Failed to pin key: %v", err)
+	}
+	if accepted, err := pinning.InteractivePinKey("tool", newKey, "example.com", "Dev"); err != nil || accepted {
+		t.Fatalf("Expected the key change to be rejected, got %v, %v", accepted, err)
+	}
+
+	// A never_trust domain rejects every key
+	if err := pinning.SetDomainPolicy("untrusted.com", PinningPolicyNeverTrust); err != nil {
+		t.Fatalf("Failed to set domain policy: %v", err)
+	}
+	if accepted, err := pinning.InteractivePinKey("tool2", newKey, "untrusted.com", "Dev"); err != nil || accepted {
+		t.Fatalf("Expected the key to be rejected, got %v, %v", accepted, err)
+	}
+
+	for _, r := range []struct{ toolID, domain string }{{"tool", "example.com"}, {"tool2", "untrusted.com"}} {
+		rejected, err := pinning.GetRejection(r.toolID, r.domain, newFingerprint)
+		if err != nil || rejected == nil || rejected.Reason != RejectionReasonPolicy {
+			t.Errorf("%s: expected a policy rejection, got %+v, %v", r.toolID, rejected, err)
+		}
+	}
+}
+
+func TestKeyChangePromptShowsPriorRejections(t *testing.T) {
+	var prompted *interactive.PromptContext
+	handler := interactive.NewCallbackInteractiveHandler(func(context *interactive.PromptContext) (interactive.UserDecision, error) {
+		prompted = context
+		return interactive.UserDecisionReject, nil
+	}, nil, nil)
+	pinning, err := NewKeyPinning(createTempDB(t), PinningModeInteractive, handler)
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	defer pinning.Close()
+
+	pinnedKey, pinnedFingerprint := generateTestKeyPEM(t)
+	newKey, _ := generateTestKeyPEM(t)
+	if err := pinning.PinKey("tool", pinnedKey, "example.com", "Dev"); err != nil {
+		t.Fatalf("Failed to pin key: %v", err)
+	}
+	if err := pinning.RecordRejection("other-tool", "example.com", pinnedFingerprint, RejectionReasonUser); err != nil {
+		t.Fatalf("Failed to record rejection: %v", err)
+	}
+
+	if _, err := pinning.InteractivePinKey("tool", newKey, "example.com", "Dev"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if prompted == nil || prompted.PromptType != interactive.PromptTypeKeyChange || prompted.CurrentKey.PriorRejections != 1 {
+		t.Fatalf("Expected a key change prompt noting one prior rejection, got %+v", prompted)
+	}
+	if prompted.NewKey.PriorRejections != 0 {
+		t.Errorf("Expected no prior rejections of the new key, got %d", prompted.NewKey.PriorRejections)
+	}
+}
+
+func TestExportImportRejectedKeys(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC))
+	source, err := NewKeyPinning(createTempDB(t), PinningModeAutomatic, nil, WithClock(fake))
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	defer source.Close()
+
+	_, fingerprint1 := generateTestKeyPEM(t)
+	_, fingerprint2 := generateTestKeyPEM(t)
+	if err := source.RecordRejection("tool1", "example.com", fingerprint1, RejectionReasonUser); err != nil {
+		t.Fatalf("Failed to record rejection: %v", err)
+	}
+	fake.Advance(time.Hour)
+	if err := source.RecordRejection("tool2", "test.com", fingerprint2, RejectionReasonRevoked); err != nil {
+		t.Fatalf("Failed to record rejection: %v", err)
+	}
+	exported, err := source.ExportRejectedKeys()
+	if err != nil {
+		t.Fatalf("Failed to export rejected keys: %v", err)
+	}
+
+	fake.Advance(time.Hour)
+	target, err := NewKeyPinning(createTempDB(t), PinningModeAutomatic, nil, WithClock(fake))
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	defer target.Close()
+
+	report, err := target.ImportRejectedKeys(exported, ImportOptions{})
+	if err != nil || len(report.Imported) != 2 || len(report.Errors) != 0 {
+		t.Fatalf("Expected two rejections imported, got %+v, %v", report, err)
+	}
+	want, _ := source.ListRejectedKeys()
+	got, _ := target.ListRejectedKeys()
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v, got %+v", want, got)
+	}
+	if check, err := target.IntegrityCheck(); err != nil || !check.OK() {
+		t.Errorf("Expected imported rejections to pass the integrity check, got %+v, %v", check, err)
+	}
+
+	// Importing again skips what is already recorded
+	report, err = target.ImportRejectedKeys(exported, ImportOptions{})
+	if err != nil || len(report.Imported) != 0 || len(report.Skipped) != 2 {
+		t.Errorf("Expected both rejections skipped, got %+v, %v", report, err)
+	}
+}
+
+func TestImportRejectedKeysInvalidEntries(t *testing.T) {
+	pinning, err := NewKeyPinning(createTempDB(t), PinningModeAutomatic, nil)
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	defer pinning.Close()
+
+	_, fingerprint := generateTestKeyPEM(t)
+	data := `[
+		{"tool_id": "", "domain": "example.com", "fingerprint": "` + fingerprint + `", "reason": "user"},
+		{"tool_id": "tool", "domain": "example.com", "fingerprint": "sha256:zz", "reason": "user"},
+		{"tool_id": "tool", "domain": "example.com", "fingerprint": "` + fingerprint + `", "reason": "bored"},
+		{"tool_id": "tool", "domain": "example.com", "fingerprint": "` + fingerprint + `", "reason": "policy", "rejected_at": "yesterday"}
+	]`
+	report, err := pinning.ImportRejectedKeys(data, ImportOptions{})
+	if err != nil {
+		t.Fatalf("Failed to import rejected keys: %v", err)
+	}
+	if len(report.Errors) != 3 || len(report.Imported) != 1 || len(report.Warnings) != 1 {
+		t.Fatalf("Expected three errors, one import and one warning, got %+v", report)
+	}
+	if !strings.Contains(report.Warnings[0].Reason, "rejected_at") {
+		t.Errorf("Expected a rejected_at warning, got %q", report.Warnings[0].Reason)
+	}
+}
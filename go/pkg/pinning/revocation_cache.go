@@ -0,0 +1,65 @@
+package pinning
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"go.etcd.io/bbolt"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/revocation"
+)
+
+// KeyPinning implements revocation.Cache, keeping the revocation documents
+// merged from revocation endpoints in the pinning database so that delta
+// updates continue across restarts.
+var (
+	_ revocation.Cache  = (*KeyPinning)(nil)
+	_ revocation.Lister = (*KeyPinning)(nil)
+)
+
+// LoadRevocationDocument returns the revocation document cached for the
+// endpoint url, or nil if none is cached.
+func (k *KeyPinning) LoadRevocationDocument(url string) (*revocation.RevocationDocument, error) {
+	var doc *revocation.RevocationDocument
+	err := k.db.View(func(tx *bbolt.Tx) error {
+		data, err := k.sealed(tx, revocationCacheBucket).get([]byte(url))
+		if err != nil || data == nil {
+			return err
+		}
+		doc = &revocation.RevocationDocument{}
+		if err := json.Unmarshal(data, doc); err != nil {
+			return fmt.Errorf("failed to unmarshal cached revocation document: %w", err)
+		}
+		return nil
+	})
+	return doc, err
+}
+
+// StoreRevocationDocument replaces the revocation document cached for the
+// endpoint url.
+func (k *KeyPinning) StoreRevocationDocument(url string, doc *revocation.RevocationDocument) error {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("failed to marshal revocation document: %w", err)
+	}
+	return k.update(func(tx *bbolt.Tx) error {
+		return k.sealed(tx, revocationCacheBucket).put([]byte(url), data)
+	})
+}
+
+// ListRevocationDocuments returns every cached revocation document,
+// ordered by endpoint URL.
+func (k *KeyPinning) ListRevocationDocuments() ([]revocation.CachedDocument, error) {
+	var cached []revocation.CachedDocument
+	err := k.db.View(func(tx *bbolt.Tx) error {
+		return k.sealed(tx, revocationCacheBucket).forEach(func(url, v []byte) error {
+			doc := &revocation.RevocationDocument{}
+			if err := json.Unmarshal(v, doc); err != nil {
+				return fmt.Errorf("failed to unmarshal cached revocation document for %s: %w", url, err)
+			}
+			cached = append(cached, revocation.CachedDocument{URL: string(url), Document: doc})
+			return nil
+		})
+	})
+	return cached, err
+}
@@ -0,0 +1,214 @@
+package pinning
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.etcd.io/bbolt"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+)
+
+// storeRotationsKey is the settings row recording every rotation of the
+// store key.
+var storeRotationsKey = []byte("store_rotations")
+
+// StoreRotation records a rotation of the store key (see
+// RotateStoreSecret).
+type StoreRotation struct {
+	RotatedAt time.Time `json:"rotated_at"`
+	// OldKeyFingerprint and NewKeyFingerprint identify the keys, see
+	// StoreKeyFingerprint.
+	OldKeyFingerprint string `json:"old_key_fingerprint"`
+	NewKeyFingerprint string `json:"new_key_fingerprint"`
+	// Rows is the number of rows re-encrypted per bucket.
+	Rows map[string]int `json:"rows"`
+}
+
+// RotationError is returned by RotateStoreSecret when rows of the database
+// do not validate under the old key. Nothing is rotated, so that tampered
+// rows are not re-encrypted as if they were genuine.
+type RotationError struct {
+	Invalid []IntegrityProblem
+}
+
+func (e *RotationError) Error() string {
+	problems := make([]string, len(e.Invalid))
+	for i, problem := range e.Invalid {
+		problems[i] = problem.String()
+	}
+	return fmt.Sprintf("%d row(s) do not validate under the old store key, nothing was rotated: %s", len(e.Invalid), strings.Join(problems, "; "))
+}
+
+// StoreKeyFingerprint returns a fingerprint identifying a store key, for
+// rotation records and logs. It is derived from the key and reveals
+// nothing about it.
+func StoreKeyFingerprint(key []byte) string {
+	return hex.EncodeToString(deriveStoreKey(key, "fingerprint")[:16])
+}
+
+// RotateStoreSecret re-encrypts the database at dbPath, encrypted with
+// oldSecret, with newSecret, so that the pins survive the rotation of a
+// leaked or departing operator's key without establishing trust anew.
+//
+// Every row is first decrypted and checked under oldSecret: a row that
+// fails to decrypt, is stored under the wrong index, or a pin index entry
+// that leads to no pin, fails the rotation with a *RotationError listing
+// them, and nothing is changed. Otherwise every row and index entry is
+// rewritten under newSecret in one transaction, which also records the
+// rotation in the settings bucket, reported by Stats. The file is then
+// compacted, so that the pages that held rows under the old key are not
+// left in it; copies made earlier, such as backups, are not affected.
+//
+// Of opts, WithDryRun and WithClock apply: in dry run the rotation is
+// checked and rolled back, and the returned record reports what would be
+// rewritten. The database must not be open elsewhere.
+func RotateStoreSecret(dbPath string, oldSecret, newSecret []byte, opts ...Option) (*StoreRotation, error) {
+	k := &KeyPinning{dbPath: dbPath, clock: clock.Real}
+	for _, opt := range opts {
+		opt(k)
+	}
+	oldCipher, err := newStoreCipher(oldSecret)
+	if err != nil {
+		return nil, fmt.Errorf("old store key: %w", err)
+	}
+	newCipher, err := newStoreCipher(newSecret)
+	if err != nil {
+		return nil, fmt.Errorf("new store key: %w", err)
+	}
+	if hmac.Equal(oldSecret, newSecret) {
+		return nil, fmt.Errorf("the new store key is the old one")
+	}
+	if k.db, err = openDB(dbPath, oldCipher); err != nil {
+		return nil, err
+	}
+	k.cipher = oldCipher
+
+	rotation := &StoreRotation{
+		RotatedAt:         clock.Timestamp(k.clock.Now()),
+		OldKeyFingerprint: StoreKeyFingerprint(oldSecret),
+		NewKeyFingerprint: StoreKeyFingerprint(newSecret),
+		Rows:              make(map[string]int),
+	}
+	err = k.update(func(tx *bbolt.Tx) error {
+		return rotateStore(tx, oldCipher, newCipher, rotation)
+	})
+	if err != nil || k.dryRun {
+		_ = k.Close()
+		if err != nil {
+			return nil, err
+		}
+		return rotation, nil
+	}
+
+	k.cipher = newCipher
+	_, err = k.Vacuum()
+	if closeErr := k.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return rotation, fmt.Errorf("store key rotated, but the database could not be compacted: %w", err)
+	}
+	return rotation, nil
+}
+
+// rotateStore checks every sealed row and the pin index under from, then
+// rewrites them under to and records rotation.
+func rotateStore(tx *bbolt.Tx, from, to *storeCipher, rotation *StoreRotation) error {
+	type row struct{ key, value []byte }
+	rows := make(map[string][]row)
+	pins := make(map[string]PinnedKeyInfo)
+	var invalid []IntegrityProblem
+	for _, name := range sealedBuckets {
+		err := tx.Bucket(name).ForEach(func(index, data []byte) error {
+			if string(name) == string(pinnedKeysBucket) {
+				toolID, info, err := pinBucketOf(nil, from).decode(index, data)
+				if err != nil {
+					invalid = append(invalid, IntegrityProblem{Bucket: string(name), Key: string(index), Reason: err.Error()})
+					return nil
+				}
+				pins[toolID] = info
+				return nil
+			}
+			key, value, err := from.open(index, data)
+			if err == nil && !bytes.Equal(index, from.index(string(name), string(key))) {
+				err = fmt.Errorf("row does not match its key")
+			}
+			if err != nil {
+				invalid = append(invalid, IntegrityProblem{Bucket: string(name), Key: string(index), Reason: err.Error()})
+				return nil
+			}
+			rows[string(name)] = append(rows[string(name)], row{append([]byte(nil), key...), append([]byte(nil), value...)})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	invalid = append(invalid, checkPinIndex(tx, from)...)
+	if len(invalid) > 0 {
+		return &RotationError{Invalid: invalid}
+	}
+
+	for _, name := range append([][]byte{pinIndexBucket}, sealedBuckets...) {
+		if err := tx.DeleteBucket(name); err != nil {
+			return err
+		}
+		if _, err := tx.CreateBucket(name); err != nil {
+			return err
+		}
+	}
+	for _, name := range sealedBuckets {
+		bucket := sealedBucketOf(tx, name, to)
+		for _, r := range rows[string(name)] {
+			if err := bucket.put(r.key, r.value); err != nil {
+				return err
+			}
+		}
+		rotation.Rows[string(name)] = len(rows[string(name)])
+	}
+	encrypted := pinBucketOf(tx, to)
+	for toolID, info := range pins {
+		info := info
+		if err := encrypted.put(toolID, &info); err != nil {
+			return err
+		}
+	}
+	rotation.Rows[string(pinnedKeysBucket)] = len(pins)
+
+	if err := recordStoreEncryption(tx, to); err != nil {
+		return err
+	}
+	rotations, err := storeRotations(tx)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(append(rotations, *rotation))
+	if err != nil {
+		return fmt.Errorf("failed to marshal store rotation: %w", err)
+	}
+	return tx.Bucket(settingsBucket).Put(storeRotationsKey, data)
+}
+
+// storeRotations returns the recorded rotations of the store key, oldest
+// first.
+func storeRotations(tx *bbolt.Tx) ([]StoreRotation, error) {
+	settings := tx.Bucket(settingsBucket)
+	if settings == nil {
+		return nil, nil
+	}
+	data := settings.Get(storeRotationsKey)
+	if data == nil {
+		return nil, nil
+	}
+	var rotations []StoreRotation
+	if err := json.Unmarshal(data, &rotations); err != nil {
+		return nil, fmt.Errorf("undecodable store rotations: %w", err)
+	}
+	return rotations, nil
+}
@@ -0,0 +1,176 @@
+package pinning
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go.etcd.io/bbolt"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+)
+
+// buildEncryptedDB returns an encrypted database with a pin, a namespace
+// pin, a domain policy and a rejection.
+func buildEncryptedDB(t *testing.T, key []byte) (dbPath, publicKeyPEM string) {
+	t.Helper()
+	publicKeyPEM, _ = generateTestKeyPEM(t)
+	namespaceKeyPEM, _ := generateTestKeyPEM(t)
+	dbPath = createTempDB(t)
+	k, err := NewKeyPinning(dbPath, PinningModeAutomatic, nil, WithStoreEncryption(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer k.Close()
+	if err := k.PinKey("rotate.example/tool", publicKeyPEM, "rotate.example", "Rotation Team"); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.PinKeyForNamespace("rotate.example/suite", namespaceKeyPEM, "rotate.example", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.SetDomainPolicy("policy.example", PinningPolicyAlwaysTrust); err != nil {
+		t.Fatal(err)
+	}
+	if err := k.RecordRejection("rotate.example/other", "rotate.example", fingerprintOf(namespaceKeyPEM), RejectionReasonUser); err != nil {
+		t.Fatal(err)
+	}
+	return dbPath, publicKeyPEM
+}
+
+func TestRotateStoreSecret(t *testing.T) {
+	oldKey, newKey := testStoreKey(t, 10), testStoreKey(t, 11)
+	dbPath, publicKeyPEM := buildEncryptedDB(t, oldKey)
+	fake := clock.NewFake(time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC))
+
+	// A dry run reports the rows and leaves the database under the old key
+	rotation, err := RotateStoreSecret(dbPath, oldKey, newKey, WithDryRun(true))
+	if err != nil {
+		t.Fatalf("Dry run failed: %v", err)
+	}
+	if rotation.Rows["pinned_keys"] != 2 || rotation.Rows["domain_policies"] != 1 || rotation.Rows["rejected_keys"] != 1 {
+		t.Errorf("Unexpected dry run rows %v", rotation.Rows)
+	}
+	k, err := NewKeyPinning(dbPath, PinningModeAutomatic, nil, WithStoreEncryption(oldKey))
+	if err != nil {
+		t.Fatalf("Expected the dry run to leave the old key in place, got %v", err)
+	}
+	k.Close()
+
+	rotation, err = RotateStoreSecret(dbPath, oldKey, newKey, WithClock(fake))
+	if err != nil {
+		t.Fatalf("RotateStoreSecret failed: %v", err)
+	}
+	if rotation.OldKeyFingerprint != StoreKeyFingerprint(oldKey) || rotation.NewKeyFingerprint != StoreKeyFingerprint(newKey) {
+		t.Errorf("Unexpected fingerprints in %+v", rotation)
+	}
+
+	k, err = NewKeyPinning(dbPath, PinningModeAutomatic, nil, WithStoreEncryption(newKey))
+	if err != nil {
+		t.Fatalf("Failed to open the rotated database: %v", err)
+	}
+	defer k.Close()
+	if got, err := k.GetPinnedKey("rotate.example/tool"); err != nil || got != publicKeyPEM {
+		t.Errorf("GetPinnedKey after rotation = %q, %v", got, err)
+	}
+	if _, match, err := k.ResolvePin("rotate.example/suite/report"); err != nil || match != PinMatchNamespace {
+		t.Errorf("Expected the namespace pin to resolve after rotation, got %s, %v", match, err)
+	}
+	if got := k.GetDomainPolicy("policy.example"); got != PinningPolicyAlwaysTrust {
+		t.Errorf("GetDomainPolicy after rotation = %s", got)
+	}
+	if rejections, err := k.ListRejectedKeys(); err != nil || len(rejections) != 1 {
+		t.Errorf("Expected the rejection to survive, got %+v, %v", rejections, err)
+	}
+	if report, err := k.IntegrityCheck(); err != nil || !report.OK() {
+		t.Errorf("Expected the rotated database to pass the integrity check, got %+v, %v", report, err)
+	}
+	stats, err := k.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stats.Rotations) != 1 || !stats.Rotations[0].RotatedAt.Equal(fake.Now()) || stats.Rotations[0].NewKeyFingerprint != StoreKeyFingerprint(newKey) {
+		t.Errorf("Expected the rotation in Stats, got %+v", stats.Rotations)
+	}
+	assertNoPlaintext(t, dbPath, "rotate.example", "policy.example", "Rotation Team", "BEGIN PUBLIC KEY")
+}
+
+func TestRotateStoreSecretAbortsOnTamperedRow(t *testing.T) {
+	oldKey, newKey := testStoreKey(t, 12), testStoreKey(t, 13)
+	dbPath, publicKeyPEM := buildEncryptedDB(t, oldKey)
+
+	// Flip a bit in the ciphertext of the domain policy
+	db, err := bbolt.Open(dbPath, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tampered string
+	err = db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(domainPoliciesBucket)
+		key, value := bucket.Cursor().First()
+		value = append([]byte(nil), value...)
+		value[len(value)-1] ^= 1
+		tampered = string(key)
+		return bucket.Put(append([]byte(nil), key...), value)
+	})
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = RotateStoreSecret(dbPath, oldKey, newKey)
+	var rotationErr *RotationError
+	if !errors.As(err, &rotationErr) {
+		t.Fatalf("Expected a RotationError, got %v", err)
+	}
+	if len(rotationErr.Invalid) != 1 || rotationErr.Invalid[0].Bucket != "domain_policies" || rotationErr.Invalid[0].Key != tampered {
+		t.Errorf("Expected the tampered row to be listed, got %+v", rotationErr.Invalid)
+	}
+
+	if _, err := NewKeyPinning(dbPath, PinningModeAutomatic, nil, WithStoreEncryption(newKey)); !errors.Is(err, ErrPinStoreKeyMismatch) {
+		t.Errorf("Expected the aborted rotation not to install the new key, got %v", err)
+	}
+	k, err := NewKeyPinning(dbPath, PinningModeAutomatic, nil, WithStoreEncryption(oldKey))
+	if err != nil {
+		t.Fatalf("Expected the database to remain under the old key, got %v", err)
+	}
+	defer k.Close()
+	if got, err := k.GetPinnedKey("rotate.example/tool"); err != nil || got != publicKeyPEM {
+		t.Errorf("Expected the pins to be untouched, got %q, %v", got, err)
+	}
+	if stats, err := k.Stats(); err != nil || len(stats.Rotations) != 0 {
+		t.Errorf("Expected no rotation to be recorded, got %+v, %v", stats, err)
+	}
+}
+
+func TestRotateStoreSecretReplacesOldKey(t *testing.T) {
+	oldKey, newKey := testStoreKey(t, 14), testStoreKey(t, 15)
+	dbPath, publicKeyPEM := buildEncryptedDB(t, oldKey)
+	if _, err := RotateStoreSecret(dbPath, oldKey, newKey); err != nil {
+		t.Fatal(err)
+	}
+
+	// The pin verifies under the new key
+	k, err := NewKeyPinning(dbPath, PinningModeAutomatic, nil, WithStoreEncryption(newKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ok, err := k.VerifyWithInteractivePinning("rotate.example/tool", "rotate.example", publicKeyPEM, "Rotation Team")
+	if err != nil || !ok {
+		t.Errorf("Expected the pinned key to verify with the new store key, got %v, %v", ok, err)
+	}
+	otherKeyPEM, _ := generateTestKeyPEM(t)
+	if ok, _ := k.VerifyWithInteractivePinning("rotate.example/tool", "rotate.example", otherKeyPEM, "Rotation Team"); ok {
+		t.Error("Expected another key to be refused after rotation")
+	}
+	k.Close()
+
+	// and not at all under the old one
+	for _, opts := range [][]Option{{WithStoreEncryption(oldKey)}, {WithStoreEncryption(oldKey), WithReadOnly(true)}} {
+		if _, err := NewKeyPinning(dbPath, PinningModeAutomatic, nil, opts...); !errors.Is(err, ErrPinStoreKeyMismatch) {
+			t.Errorf("Expected the old store key to be refused, got %v", err)
+		}
+	}
+	if _, err := RotateStoreSecret(dbPath, oldKey, testStoreKey(t, 16)); !errors.Is(err, ErrPinStoreKeyMismatch) {
+		t.Errorf("Expected rotating from the old store key to fail, got %v", err)
+	}
+}
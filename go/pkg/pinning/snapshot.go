@@ -0,0 +1,315 @@
+package pinning
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"go.etcd.io/bbolt"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+)
+
+// SnapshotVersion is the snapshot_version written by ExportSignedSnapshot.
+const SnapshotVersion = "1.0"
+
+// SnapshotDocument is a signed, timestamped record of every pinned key and
+// domain policy, for audits. Signature covers the canonical form of the
+// rest of the document, so any edit after export fails VerifySnapshot.
+type SnapshotDocument struct {
+	SnapshotVersion string `json:"snapshot_version"`
+	ExportedAt      string `json:"exported_at"`
+	// Host identifies the machine the snapshot was exported on.
+	Host string `json:"host"`
+	// SignerFingerprint is the fingerprint of the operator key that signed
+	// the snapshot.
+	SignerFingerprint string           `json:"signer_fingerprint"`
+	Pins              []SnapshotPin    `json:"pins"`
+	DomainPolicies    []SnapshotPolicy `json:"domain_policies"`
+	Signature         string           `json:"signature,omitempty"`
+}
+
+// SnapshotPin is a pinned key as recorded in a snapshot. Recent
+// verification events are left out; the counters summarize them.
+type SnapshotPin struct {
+	ToolID            string     `json:"tool_id"`
+	Domain            string     `json:"domain"`
+	Fingerprint       string     `json:"fingerprint"`
+	PublicKeyPEM      string     `json:"public_key_pem"`
+	DeveloperName     string     `json:"developer_name,omitempty"`
+	KeyScope          string     `json:"key_scope,omitempty"`
+	Provenance        Provenance `json:"provenance,omitempty"`
+	SourceDetail      string     `json:"source_detail,omitempty"`
+	PinnedAt          string     `json:"pinned_at"`
+	LastVerified      string     `json:"last_verified,omitempty"`
+	VerificationCount int64      `json:"verification_count"`
+	SuccessCount      int64      `json:"success_count"`
+	FailureCount      int64      `json:"failure_count"`
+}
+
+// SnapshotPolicy is a domain policy as recorded in a snapshot.
+type SnapshotPolicy struct {
+	Domain    string        `json:"domain"`
+	Policy    PinningPolicy `json:"policy"`
+	CreatedAt string        `json:"created_at"`
+}
+
+// ListDomainPolicies returns every domain policy, ordered by domain.
+func (k *KeyPinning) ListDomainPolicies() ([]DomainPolicy, error) {
+	var policies []DomainPolicy
+	err := k.db.View(func(tx *bbolt.Tx) error {
+		return k.sealed(tx, domainPoliciesBucket).forEach(func(domain, v []byte) error {
+			var policy DomainPolicy
+			if err := json.Unmarshal(v, &policy); err != nil {
+				return fmt.Errorf("corrupt domain policy for %s: %w", domain, err)
+			}
+			policies = append(policies, policy)
+			return nil
+		})
+	})
+	return policies, err
+}
+
+// ExportSignedSnapshot exports every pin and domain policy as a snapshot
+// signed with signingKeyPEM, an operator-held private key.
+func (k *KeyPinning) ExportSignedSnapshot(signingKeyPEM string) (SnapshotDocument, error) {
+	keyManager := crypto.NewKeyManager()
+	privateKey, err := keyManager.LoadPrivateKeyPEM(signingKeyPEM)
+	if err != nil {
+		return SnapshotDocument{}, fmt.Errorf("failed to load signing key: %w", err)
+	}
+	signerFingerprint, err := keyManager.CalculateKeyFingerprint(&privateKey.PublicKey)
+	if err != nil {
+		return SnapshotDocument{}, fmt.Errorf("failed to calculate key fingerprint: %w", err)
+	}
+
+	keys, err := k.ListPinnedKeyInfo()
+	if err != nil {
+		return SnapshotDocument{}, fmt.Errorf("failed to list pinned keys: %w", err)
+	}
+	policies, err := k.ListDomainPolicies()
+	if err != nil {
+		return SnapshotDocument{}, fmt.Errorf("failed to list domain policies: %w", err)
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+
+	doc := SnapshotDocument{
+		SnapshotVersion:   SnapshotVersion,
+		ExportedAt:        clock.Format(k.clock.Now()),
+		Host:              host,
+		SignerFingerprint: signerFingerprint,
+		Pins:              make([]SnapshotPin, 0, len(keys)),
+		DomainPolicies:    make([]SnapshotPolicy, 0, len(policies)),
+	}
+	for _, info := range keys {
+		doc.Pins = append(doc.Pins, snapshotPin(info))
+	}
+	for _, policy := range policies {
+		doc.DomainPolicies = append(doc.DomainPolicies, SnapshotPolicy{
+			Domain:    policy.Domain,
+			Policy:    policy.Policy,
+			CreatedAt: formatSnapshotTime(policy.CreatedAt),
+		})
+	}
+
+	hash, err := snapshotHash(doc)
+	if err != nil {
+		return SnapshotDocument{}, err
+	}
+	if doc.Signature, err = crypto.NewSignatureManager().SignSchemaHash(hash, privateKey); err != nil {
+		return SnapshotDocument{}, fmt.Errorf("failed to sign snapshot: %w", err)
+	}
+	return doc, nil
+}
+
+func snapshotPin(info PinnedKeyInfo) SnapshotPin {
+	fingerprint := info.Fingerprint
+	if fingerprint == "" {
+		fingerprint = fingerprintOf(info.PublicKeyPEM)
+	}
+	return SnapshotPin{
+		ToolID:            info.ToolID,
+		Domain:            info.Domain,
+		Fingerprint:       fingerprint,
+		PublicKeyPEM:      info.PublicKeyPEM,
+		DeveloperName:     info.DeveloperName,
+		KeyScope:          info.KeyScope,
+		Provenance:        info.Provenance,
+		SourceDetail:      info.SourceDetail,
+		PinnedAt:          formatSnapshotTime(info.PinnedAt),
+		LastVerified:      formatSnapshotTime(info.LastVerified),
+		VerificationCount: info.VerificationCount,
+		SuccessCount:      info.SuccessCount,
+		FailureCount:      info.FailureCount,
+	}
+}
+
+// formatSnapshotTime formats t with clock.Format, or returns an empty
+// string for the zero time.
+func formatSnapshotTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return clock.Format(t)
+}
+
+// snapshotHash canonicalizes doc without its signature and hashes it.
+func snapshotHash(doc SnapshotDocument) ([]byte, error) {
+	doc.Signature = ""
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal snapshot: %w", err)
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, fmt.Errorf("failed to marshal snapshot: %w", err)
+	}
+	return core.NewSchemaPinCore().CanonicalizeAndHash(body)
+}
+
+// VerifySnapshot checks that doc is signed by publicKeyPEM and unchanged
+// since it was signed.
+func VerifySnapshot(doc SnapshotDocument, publicKeyPEM string) error {
+	if doc.Signature == "" {
+		return fmt.Errorf("snapshot is not signed")
+	}
+	keyManager := crypto.NewKeyManager()
+	publicKey, err := keyManager.LoadPublicKeyPEM(publicKeyPEM)
+	if err != nil {
+		return fmt.Errorf("failed to load public key: %w", err)
+	}
+	fingerprint, err := keyManager.CalculateKeyFingerprint(publicKey)
+	if err != nil {
+		return fmt.Errorf("failed to calculate key fingerprint: %w", err)
+	}
+	if !crypto.FingerprintEqual(doc.SignerFingerprint, fingerprint) {
+		return fmt.Errorf("snapshot names signer %s, expected %s", doc.SignerFingerprint, fingerprint)
+	}
+
+	hash, err := snapshotHash(doc)
+	if err != nil {
+		return err
+	}
+	if !crypto.NewSignatureManager().VerifySchemaSignature(hash, doc.Signature, publicKey) {
+		return fmt.Errorf("snapshot signature is invalid")
+	}
+	return nil
+}
+
+// SnapshotDiff lists how the pins and domain policies of two snapshots
+// differ. Verification counters are not compared.
+type SnapshotDiff struct {
+	Added         []SnapshotPin          `json:"added"`
+	Removed       []SnapshotPin          `json:"removed"`
+	Changed       []SnapshotPinChange    `json:"changed"`
+	PolicyChanges []SnapshotPolicyChange `json:"policy_changes"`
+}
+
+// SnapshotPinChange is a tool pinned in both snapshots whose pin differs.
+// Fields names the differing fields by their JSON names, e.g.
+// "fingerprint" for a re-keyed tool.
+type SnapshotPinChange struct {
+	ToolID string      `json:"tool_id"`
+	Fields []string    `json:"fields"`
+	Old    SnapshotPin `json:"old"`
+	New    SnapshotPin `json:"new"`
+}
+
+// SnapshotPolicyChange is a domain policy added, removed or changed. Old
+// is empty for an added policy and New for a removed one.
+type SnapshotPolicyChange struct {
+	Domain string        `json:"domain"`
+	Old    PinningPolicy `json:"old,omitempty"`
+	New    PinningPolicy `json:"new,omitempty"`
+}
+
+// Empty reports whether the snapshots agree.
+func (d SnapshotDiff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0 && len(d.PolicyChanges) == 0
+}
+
+// CompareSnapshots reports the pins added, removed and changed from old to
+// new, by tool ID, and the domain policies that changed. Results are
+// ordered by tool ID and domain. Signatures are not checked; use
+// VerifySnapshot first.
+func CompareSnapshots(old, new SnapshotDocument) SnapshotDiff {
+	diff := SnapshotDiff{
+		Added:         []SnapshotPin{},
+		Removed:       []SnapshotPin{},
+		Changed:       []SnapshotPinChange{},
+		PolicyChanges: []SnapshotPolicyChange{},
+	}
+
+	oldPins := make(map[string]SnapshotPin, len(old.Pins))
+	for _, pin := range old.Pins {
+		oldPins[pin.ToolID] = pin
+	}
+	newPins := make(map[string]SnapshotPin, len(new.Pins))
+	for _, pin := range new.Pins {
+		newPins[pin.ToolID] = pin
+		before, ok := oldPins[pin.ToolID]
+		if !ok {
+			diff.Added = append(diff.Added, pin)
+		} else if fields := changedPinFields(before, pin); len(fields) > 0 {
+			diff.Changed = append(diff.Changed, SnapshotPinChange{ToolID: pin.ToolID, Fields: fields, Old: before, New: pin})
+		}
+	}
+	for _, pin := range old.Pins {
+		if _, ok := newPins[pin.ToolID]; !ok {
+			diff.Removed = append(diff.Removed, pin)
+		}
+	}
+
+	oldPolicies := make(map[string]PinningPolicy, len(old.DomainPolicies))
+	for _, policy := range old.DomainPolicies {
+		oldPolicies[policy.Domain] = policy.Policy
+	}
+	newPolicies := make(map[string]PinningPolicy, len(new.DomainPolicies))
+	for _, policy := range new.DomainPolicies {
+		newPolicies[policy.Domain] = policy.Policy
+		if before := oldPolicies[policy.Domain]; before != policy.Policy {
+			diff.PolicyChanges = append(diff.PolicyChanges, SnapshotPolicyChange{Domain: policy.Domain, Old: before, New: policy.Policy})
+		}
+	}
+	for _, policy := range old.DomainPolicies {
+		if _, ok := newPolicies[policy.Domain]; !ok {
+			diff.PolicyChanges = append(diff.PolicyChanges, SnapshotPolicyChange{Domain: policy.Domain, Old: policy.Policy})
+		}
+	}
+
+	sort.Slice(diff.Added, func(i, j int) bool { return diff.Added[i].ToolID < diff.Added[j].ToolID })
+	sort.Slice(diff.Removed, func(i, j int) bool { return diff.Removed[i].ToolID < diff.Removed[j].ToolID })
+	sort.Slice(diff.Changed, func(i, j int) bool { return diff.Changed[i].ToolID < diff.Changed[j].ToolID })
+	sort.Slice(diff.PolicyChanges, func(i, j int) bool { return diff.PolicyChanges[i].Domain < diff.PolicyChanges[j].Domain })
+	return diff
+}
+
+// changedPinFields returns the JSON names of the fields that differ
+// between two pins of the same tool, ignoring verification counters.
+func changedPinFields(old, new SnapshotPin) []string {
+	var fields []string
+	for _, field := range []struct {
+		name     string
+		old, new string
+	}{
+		{"fingerprint", old.Fingerprint, new.Fingerprint},
+		{"domain", old.Domain, new.Domain},
+		{"key_scope", old.KeyScope, new.KeyScope},
+		{"developer_name", old.DeveloperName, new.DeveloperName},
+		{"provenance", string(old.Provenance), string(new.Provenance)},
+		{"source_detail", old.SourceDetail, new.SourceDetail},
+		{"pinned_at", old.PinnedAt, new.PinnedAt},
+	} {
+		if field.old != field.new {
+			fields = append(fields, field.name)
+		}
+	}
+	return fields
+}
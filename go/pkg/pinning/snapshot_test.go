@@ -0,0 +1,190 @@
+package pinning
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+)
+
+func TestSignedSnapshotRoundTrip(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC))
+	pinning, err := NewKeyPinning(createTempDB(t), PinningModeAutomatic, nil, WithClock(fake))
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	defer pinning.Close()
+
+	keyManager := crypto.NewKeyManager()
+	toolKey, err := keyManager.GenerateKeypair()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	toolKeyPEM, err := keyManager.ExportPublicKeyPEM(&toolKey.PublicKey)
+	if err != nil {
+		t.Fatalf("Failed to export key: %v", err)
+	}
+	operatorKey, err := keyManager.GenerateKeypair()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	operatorPrivatePEM, err := keyManager.ExportPrivateKeyPEM(operatorKey)
+	if err != nil {
+		t.Fatalf("Failed to export key: %v", err)
+	}
+	operatorPublicPEM, err := keyManager.ExportPublicKeyPEM(&operatorKey.PublicKey)
+	if err != nil {
+		t.Fatalf("Failed to export key: %v", err)
+	}
+
+	if err := pinning.PinKeyWithOptions("calculator", toolKeyPEM, "tools.example.com", "Example Tools", PinOptions{
+		Provenance:   ProvenanceDiscovery,
+		SourceDetail: "https://tools.example.com/.well-known/schemapin.json",
+	}); err != nil {
+		t.Fatalf("Failed to pin key: %v", err)
+	}
+	fake.Advance(time.Minute)
+	if err := pinning.UpdateLastVerified("calculator", true); err != nil {
+		t.Fatalf("UpdateLastVerified failed: %v", err)
+	}
+	if err := pinning.SetDomainPolicy("untrusted.example.com", PinningPolicyNeverTrust); err != nil {
+		t.Fatalf("Failed to set domain policy: %v", err)
+	}
+
+	doc, err := pinning.ExportSignedSnapshot(operatorPrivatePEM)
+	if err != nil {
+		t.Fatalf("ExportSignedSnapshot failed: %v", err)
+	}
+	if doc.SnapshotVersion != SnapshotVersion || doc.ExportedAt != "2026-03-01T09:01:00Z" || doc.Host == "" {
+		t.Errorf("Unexpected snapshot header: %+v", doc)
+	}
+	if len(doc.Pins) != 1 || len(doc.DomainPolicies) != 1 {
+		t.Fatalf("Expected 1 pin and 1 policy, got %d and %d", len(doc.Pins), len(doc.DomainPolicies))
+	}
+	pin := doc.Pins[0]
+	if pin.Fingerprint != fingerprintOf(toolKeyPEM) || pin.Provenance != ProvenanceDiscovery ||
+		pin.PinnedAt != "2026-03-01T09:00:00Z" || pin.VerificationCount != 1 || pin.SuccessCount != 1 {
+		t.Errorf("Unexpected snapshot pin: %+v", pin)
+	}
+	if doc.DomainPolicies[0].Policy != PinningPolicyNeverTrust {
+		t.Errorf("Unexpected snapshot policy: %+v", doc.DomainPolicies[0])
+	}
+
+	// The document survives a JSON round trip
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatalf("Failed to marshal snapshot: %v", err)
+	}
+	var decoded SnapshotDocument
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal snapshot: %v", err)
+	}
+	if err := VerifySnapshot(decoded, operatorPublicPEM); err != nil {
+		t.Errorf("Expected snapshot to verify, got %v", err)
+	}
+	if err := VerifySnapshot(decoded, toolKeyPEM); err == nil {
+		t.Error("Expected verification with another key to fail")
+	}
+
+	if diff := CompareSnapshots(doc, decoded); !diff.Empty() {
+		t.Errorf("Expected no differences, got %+v", diff)
+	}
+}
+
+func TestVerifySnapshotRejectsTampering(t *testing.T) {
+	pinning, err := NewKeyPinning(createTempDB(t), PinningModeAutomatic, nil)
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	defer pinning.Close()
+
+	keyManager := crypto.NewKeyManager()
+	operatorKey, err := keyManager.GenerateKeypair()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	operatorPrivatePEM, _ := keyManager.ExportPrivateKeyPEM(operatorKey)
+	operatorPublicPEM, _ := keyManager.ExportPublicKeyPEM(&operatorKey.PublicKey)
+
+	if err := pinning.PinKey("calculator", "test-key", "tools.example.com", "Example Tools"); err != nil {
+		t.Fatalf("Failed to pin key: %v", err)
+	}
+	doc, err := pinning.ExportSignedSnapshot(operatorPrivatePEM)
+	if err != nil {
+		t.Fatalf("ExportSignedSnapshot failed: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		tamper func(*SnapshotDocument)
+	}{
+		{"fingerprint", func(d *SnapshotDocument) { d.Pins[0].Fingerprint = "sha256:00" }},
+		{"added pin", func(d *SnapshotDocument) { d.Pins = append(d.Pins, SnapshotPin{ToolID: "extra"}) }},
+		{"removed pin", func(d *SnapshotDocument) { d.Pins = d.Pins[:0] }},
+		{"policy", func(d *SnapshotDocument) {
+			d.DomainPolicies = append(d.DomainPolicies, SnapshotPolicy{Domain: "x", Policy: PinningPolicyAlwaysTrust})
+		}},
+		{"exported_at", func(d *SnapshotDocument) { d.ExportedAt = "2020-01-01T00:00:00Z" }},
+		{"signature removed", func(d *SnapshotDocument) { d.Signature = "" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tampered := doc
+			tampered.Pins = append([]SnapshotPin(nil), doc.Pins...)
+			tampered.DomainPolicies = append([]SnapshotPolicy(nil), doc.DomainPolicies...)
+			tt.tamper(&tampered)
+			if err := VerifySnapshot(tampered, operatorPublicPEM); err == nil {
+				t.Error("Expected tampered snapshot to fail verification")
+			}
+		})
+	}
+	if err := VerifySnapshot(doc, operatorPublicPEM); err != nil {
+		t.Errorf("Expected original snapshot to verify, got %v", err)
+	}
+}
+
+func TestCompareSnapshots(t *testing.T) {
+	load := func(name string) SnapshotDocument {
+		data, err := os.ReadFile(filepath.Join("testdata", name))
+		if err != nil {
+			t.Fatalf("Failed to read fixture: %v", err)
+		}
+		var doc SnapshotDocument
+		if err := json.Unmarshal(data, &doc); err != nil {
+			t.Fatalf("Failed to parse fixture: %v", err)
+		}
+		return doc
+	}
+	oldDoc, newDoc := load("snapshot_old.json"), load("snapshot_new.json")
+
+	diff := CompareSnapshots(oldDoc, newDoc)
+	if len(diff.Added) != 1 || diff.Added[0].ToolID != "translator" {
+		t.Errorf("Expected translator added, got %+v", diff.Added)
+	}
+	if len(diff.Removed) != 1 || diff.Removed[0].ToolID != "legacy-search" {
+		t.Errorf("Expected legacy-search removed, got %+v", diff.Removed)
+	}
+	// calculator's counters changed, which is not a pin change
+	if len(diff.Changed) != 1 || diff.Changed[0].ToolID != "weather" {
+		t.Fatalf("Expected only weather changed, got %+v", diff.Changed)
+	}
+	if want := []string{"fingerprint", "provenance", "pinned_at"}; !reflect.DeepEqual(diff.Changed[0].Fields, want) {
+		t.Errorf("Expected changed fields %v, got %v", want, diff.Changed[0].Fields)
+	}
+	wantPolicies := []SnapshotPolicyChange{
+		{Domain: "search.example.org", Old: PinningPolicyInteractiveOnly},
+		{Domain: "weather.example.com", New: PinningPolicyNeverTrust},
+	}
+	if !reflect.DeepEqual(diff.PolicyChanges, wantPolicies) {
+		t.Errorf("Expected policy changes %+v, got %+v", wantPolicies, diff.PolicyChanges)
+	}
+
+	if diff := CompareSnapshots(newDoc, newDoc); !diff.Empty() {
+		t.Errorf("Expected a snapshot to equal itself, got %+v", diff)
+	}
+}
@@ -0,0 +1,86 @@
+package pinning
+
+import (
+	"sort"
+	"time"
+
+	"go.etcd.io/bbolt"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+)
+
+// RecentVerificationLimit is the number of verifications kept in
+// PinnedKeyInfo.RecentVerifications.
+const RecentVerificationLimit = 10
+
+// VerificationEvent is one verification of a pinned key.
+type VerificationEvent struct {
+	At      time.Time `json:"at"`
+	Success bool      `json:"success"`
+	// RequestID is the verification's request ID (see package requestid),
+	// if it had one.
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// recordVerification updates the statistics of info for a verification at
+// the given time.
+func (info *PinnedKeyInfo) recordVerification(at time.Time, success bool, requestID string) {
+	info.VerificationCount++
+	if success {
+		info.SuccessCount++
+		info.LastVerified = at
+	} else {
+		info.FailureCount++
+	}
+	if info.FirstVerified.IsZero() {
+		info.FirstVerified = at
+	}
+	info.RecentVerifications = append(info.RecentVerifications, VerificationEvent{At: at, Success: success, RequestID: requestID})
+	if excess := len(info.RecentVerifications) - RecentVerificationLimit; excess > 0 {
+		info.RecentVerifications = append([]VerificationEvent(nil), info.RecentVerifications[excess:]...)
+	}
+}
+
+// FindStalePins returns the pins not successfully verified within olderThan,
+// oldest first, as candidates for removal. A pin that was never verified
+// counts from the time it was pinned.
+func (k *KeyPinning) FindStalePins(olderThan time.Duration) ([]PinnedKeyInfo, error) {
+	cutoff := k.clock.Now().Add(-olderThan)
+
+	var stale []PinnedKeyInfo
+	err := k.db.View(func(tx *bbolt.Tx) error {
+		return k.pins(tx).forEach(func(keyInfo PinnedKeyInfo) error {
+			if lastActivity(keyInfo).Before(cutoff) {
+				stale = append(stale, keyInfo)
+			}
+			return nil
+		})
+	})
+	sort.Slice(stale, func(i, j int) bool {
+		return lastActivity(stale[i]).Before(lastActivity(stale[j]))
+	})
+	return stale, err
+}
+
+// lastActivity is the last successful verification of a pin, or the time
+// it was pinned if it was never verified.
+func lastActivity(info PinnedKeyInfo) time.Time {
+	if !info.LastVerified.IsZero() {
+		return info.LastVerified
+	}
+	return info.PinnedAt
+}
+
+// migrateVerificationStats seeds the statistics of pins written before they
+// were tracked: a pin with a last_verified time has been verified
+// successfully at least once, so it starts with one success at that time.
+// Pins that already carry statistics are left alone.
+func migrateVerificationStats(tx *bbolt.Tx, c *storeCipher) error {
+	return migratePinnedKeys(tx, c, "verification statistics", func(keyInfo *PinnedKeyInfo) bool {
+		if keyInfo.VerificationCount != 0 || keyInfo.LastVerified.IsZero() {
+			return false
+		}
+		keyInfo.recordVerification(clock.Timestamp(keyInfo.LastVerified), true, "")
+		return true
+	})
+}
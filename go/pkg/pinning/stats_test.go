@@ -0,0 +1,226 @@
+package pinning
+
+import (
+	"testing"
+	"time"
+
+	"go.etcd.io/bbolt"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+)
+
+func TestVerificationCounters(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+	pinning, err := NewKeyPinning(createTempDB(t), PinningModeAutomatic, nil, WithClock(fake))
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	defer pinning.Close()
+
+	if err := pinning.PinKey("tool", "test-key", "example.com", "Dev"); err != nil {
+		t.Fatalf("Failed to pin key: %v", err)
+	}
+
+	outcomes := []bool{true, false, true, true, false}
+	for _, success := range outcomes {
+		fake.Advance(time.Minute)
+		if err := pinning.UpdateLastVerified("tool", success); err != nil {
+			t.Fatalf("UpdateLastVerified failed: %v", err)
+		}
+	}
+
+	info, err := pinning.GetKeyInfo("tool")
+	if err != nil || info == nil {
+		t.Fatalf("Expected key info, got %v, %v", info, err)
+	}
+	if info.VerificationCount != 5 || info.SuccessCount != 3 || info.FailureCount != 2 {
+		t.Errorf("Expected 5 verifications (3 ok, 2 failed), got %d (%d, %d)",
+			info.VerificationCount, info.SuccessCount, info.FailureCount)
+	}
+	if want := start.Add(time.Minute); !info.FirstVerified.Equal(want) {
+		t.Errorf("Expected first_verified %v, got %v", want, info.FirstVerified)
+	}
+	// The last verification failed; last_verified is the last success
+	if want := start.Add(4 * time.Minute); !info.LastVerified.Equal(want) {
+		t.Errorf("Expected last_verified %v, got %v", want, info.LastVerified)
+	}
+	if len(info.RecentVerifications) != len(outcomes) {
+		t.Fatalf("Expected %d recent verifications, got %d", len(outcomes), len(info.RecentVerifications))
+	}
+	for i, event := range info.RecentVerifications {
+		if event.Success != outcomes[i] || !event.At.Equal(start.Add(time.Duration(i+1)*time.Minute)) {
+			t.Errorf("Unexpected recent verification %d: %+v", i, event)
+		}
+	}
+
+	keys, err := pinning.ListPinnedKeys()
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("Expected one listed key, got %v, %v", keys, err)
+	}
+	if keys[0]["verification_count"] != int64(5) || keys[0]["failure_count"] != int64(2) {
+		t.Errorf("Expected counters in the listing, got %v", keys[0])
+	}
+}
+
+func TestRecentVerificationsAreBounded(t *testing.T) {
+	fake := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	pinning, err := NewKeyPinning(createTempDB(t), PinningModeAutomatic, nil, WithClock(fake))
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	defer pinning.Close()
+
+	if err := pinning.PinKey("tool", "test-key", "example.com", "Dev"); err != nil {
+		t.Fatalf("Failed to pin key: %v", err)
+	}
+	total := RecentVerificationLimit + 5
+	for i := 0; i < total; i++ {
+		fake.Advance(time.Second)
+		if err := pinning.UpdateLastVerified("tool", true); err != nil {
+			t.Fatalf("UpdateLastVerified failed: %v", err)
+		}
+	}
+
+	info, _ := pinning.GetKeyInfo("tool")
+	if info.VerificationCount != int64(total) {
+		t.Errorf("Expected %d verifications, got %d", total, info.VerificationCount)
+	}
+	if len(info.RecentVerifications) != RecentVerificationLimit {
+		t.Fatalf("Expected %d recent verifications, got %d", RecentVerificationLimit, len(info.RecentVerifications))
+	}
+	if last := info.RecentVerifications[RecentVerificationLimit-1]; !last.At.Equal(info.LastVerified) {
+		t.Errorf("Expected the newest verification last, got %v", last.At)
+	}
+}
+
+func TestFindStalePins(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+	pinning, err := NewKeyPinning(createTempDB(t), PinningModeAutomatic, nil, WithClock(fake))
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	defer pinning.Close()
+
+	for _, toolID := range []string{"never-verified", "verified-early", "failing", "active"} {
+		if err := pinning.PinKey(toolID, "test-key", "example.com", "Dev"); err != nil {
+			t.Fatalf("Failed to pin key: %v", err)
+		}
+	}
+	fake.Advance(10 * 24 * time.Hour)
+	_ = pinning.UpdateLastVerified("verified-early", true)
+	_ = pinning.UpdateLastVerified("failing", true)
+
+	fake.Advance(85 * 24 * time.Hour)
+	_ = pinning.UpdateLastVerified("active", true)
+	// Failed verifications do not keep a pin fresh
+	_ = pinning.UpdateLastVerified("failing", false)
+
+	stale, err := pinning.FindStalePins(90 * 24 * time.Hour)
+	if err != nil {
+		t.Fatalf("FindStalePins failed: %v", err)
+	}
+	var got []string
+	for _, info := range stale {
+		got = append(got, info.ToolID)
+	}
+	// never-verified counts from pinned_at, so it is the oldest
+	want := []string{"never-verified"}
+	if len(got) != len(want) || got[0] != want[0] {
+		t.Fatalf("Expected stale pins %v, got %v", want, got)
+	}
+
+	fake.Advance(10 * 24 * time.Hour)
+	stale, _ = pinning.FindStalePins(90 * 24 * time.Hour)
+	got = got[:0]
+	for _, info := range stale {
+		got = append(got, info.ToolID)
+	}
+	if len(got) != 3 || got[0] != "never-verified" {
+		t.Errorf("Expected never-verified first among three stale pins, got %v", got)
+	}
+	for _, toolID := range got {
+		if toolID == "active" {
+			t.Errorf("Expected recently verified pin not to be stale, got %v", got)
+		}
+	}
+}
+
+func TestVerificationStatsMigration(t *testing.T) {
+	dbPath := createTempDB(t)
+	pinning, err := NewKeyPinning(dbPath, PinningModeAutomatic, nil)
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	// Records in the format used before statistics were tracked
+	legacy := map[string]string{
+		"verified":   `{"tool_id":"verified","public_key_pem":"k","domain":"example.com","pinned_at":"2024-01-01T00:00:00Z","last_verified":"2024-03-01T00:00:00Z"}`,
+		"unverified": `{"tool_id":"unverified","public_key_pem":"k","domain":"example.com","pinned_at":"2024-01-01T00:00:00Z"}`,
+	}
+	err = pinning.db.Update(func(tx *bbolt.Tx) error {
+		for toolID, record := range legacy {
+			if err := tx.Bucket(pinnedKeysBucket).Put([]byte(toolID), []byte(record)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Failed to write legacy records: %v", err)
+	}
+	pinning.Close()
+
+	pinning, err = NewKeyPinning(dbPath, PinningModeAutomatic, nil)
+	if err != nil {
+		t.Fatalf("Failed to reopen KeyPinning: %v", err)
+	}
+	defer pinning.Close()
+
+	verified, _ := pinning.GetKeyInfo("verified")
+	lastVerified := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	if verified.VerificationCount != 1 || verified.SuccessCount != 1 || !verified.FirstVerified.Equal(lastVerified) {
+		t.Errorf("Expected one success at last_verified, got %+v", verified)
+	}
+	unverified, _ := pinning.GetKeyInfo("unverified")
+	if unverified.VerificationCount != 0 || !unverified.FirstVerified.IsZero() {
+		t.Errorf("Expected no statistics for a never-verified pin, got %+v", unverified)
+	}
+}
+
+func TestPinSetHash(t *testing.T) {
+	pinning, err := NewKeyPinning(createTempDB(t), PinningModeAutomatic, nil)
+	if err != nil {
+		t.Fatalf("Failed to create KeyPinning: %v", err)
+	}
+	defer pinning.Close()
+
+	empty, err := pinning.PinSetHash()
+	if err != nil {
+		t.Fatalf("PinSetHash failed: %v", err)
+	}
+	if err := pinning.PinKey("tool", "test-key", "example.com", "Dev"); err != nil {
+		t.Fatalf("Failed to pin key: %v", err)
+	}
+	pinned, _ := pinning.PinSetHash()
+	if pinned == empty {
+		t.Error("Expected a new pin to change the hash")
+	}
+
+	if err := pinning.UpdateLastVerified("tool", true); err != nil {
+		t.Fatalf("UpdateLastVerified failed: %v", err)
+	}
+	if got, _ := pinning.PinSetHash(); got != pinned {
+		t.Error("Expected verification statistics not to change the hash")
+	}
+
+	if err := pinning.RemovePinnedKey("tool"); err != nil {
+		t.Fatalf("Failed to remove key: %v", err)
+	}
+	if err := pinning.PinKey("tool", "other-key", "example.com", "Dev"); err != nil {
+		t.Fatalf("Failed to pin key: %v", err)
+	}
+	if got, _ := pinning.PinSetHash(); got == pinned || got == empty {
+		t.Error("Expected a re-keyed pin to change the hash")
+	}
+}
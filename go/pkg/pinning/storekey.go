@@ -0,0 +1,157 @@
+package pinning
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// StoreKeyProvider supplies the key of an encrypted pinning database (see
+// WithStoreEncryption).
+type StoreKeyProvider interface {
+	StoreKey() ([]byte, error)
+}
+
+// EnvStoreKey is the name of an environment variable holding the store
+// key, encoded as by ParseStoreKey.
+type EnvStoreKey string
+
+// StoreKey reads the variable.
+func (e EnvStoreKey) StoreKey() ([]byte, error) {
+	value, ok := os.LookupEnv(string(e))
+	if !ok || value == "" {
+		return nil, fmt.Errorf("environment variable %s is not set", string(e))
+	}
+	key, err := ParseStoreKey(value)
+	if err != nil {
+		return nil, fmt.Errorf("environment variable %s: %w", string(e), err)
+	}
+	return key, nil
+}
+
+// FileStoreKey is the path of a file holding the store key, either as
+// StoreKeySize raw bytes or encoded as by ParseStoreKey.
+type FileStoreKey string
+
+// StoreKey reads the file.
+func (f FileStoreKey) StoreKey() ([]byte, error) {
+	data, err := os.ReadFile(string(f)) // #nosec G304 -- path is supplied by the operator
+	if err != nil {
+		return nil, fmt.Errorf("failed to read store key: %w", err)
+	}
+	// Neither encoding of a key is StoreKeySize bytes long
+	if len(data) == StoreKeySize {
+		return data, nil
+	}
+	key, err := ParseStoreKey(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("store key file %s: %w", string(f), err)
+	}
+	return key, nil
+}
+
+// KeychainStoreKey is a generic password in the OS keychain holding the
+// store key, encoded as by ParseStoreKey. It is read with security(1) on
+// macOS and with secret-tool(1) from libsecret elsewhere, looking up the
+// attributes service and account. Windows is not supported.
+type KeychainStoreKey struct {
+	Service string
+	Account string
+}
+
+// StoreKey looks up the password.
+func (k KeychainStoreKey) StoreKey() ([]byte, error) {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "darwin":
+		cmd = exec.Command("security", "find-generic-password", "-s", k.Service, "-a", k.Account, "-w") // #nosec G204 -- fixed program, arguments are not interpreted by a shell
+	case "windows":
+		return nil, fmt.Errorf("reading the store key from the keychain is not supported on Windows")
+	default:
+		cmd = exec.Command("secret-tool", "lookup", "service", k.Service, "account", k.Account) // #nosec G204 -- fixed program, arguments are not interpreted by a shell
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			err = fmt.Errorf("%w: %s", err, msg)
+		}
+		return nil, fmt.Errorf("failed to read store key %s from the keychain: %w", k, err)
+	}
+	key, err := ParseStoreKey(string(out))
+	if err != nil {
+		return nil, fmt.Errorf("store key %s in the keychain: %w", k, err)
+	}
+	return key, nil
+}
+
+func (k KeychainStoreKey) String() string {
+	return k.Service + "/" + k.Account
+}
+
+// DefaultKeychainAccount is the account of a KeychainStoreKey parsed from
+// a source without one.
+const DefaultKeychainAccount = "pin-store"
+
+// ParseStoreKeySource parses a store key source as given on the command
+// line: "env:NAME", "file:PATH" or "keychain:SERVICE[/ACCOUNT]", the
+// account defaulting to DefaultKeychainAccount. Errors do not repeat the
+// source, which may be the key itself given by mistake.
+func ParseStoreKeySource(source string) (StoreKeyProvider, error) {
+	kind, value, _ := strings.Cut(source, ":")
+	if value == "" {
+		return nil, fmt.Errorf("invalid store key source: want env:NAME, file:PATH or keychain:SERVICE[/ACCOUNT]")
+	}
+	switch kind {
+	case "env":
+		return EnvStoreKey(value), nil
+	case "file":
+		return FileStoreKey(value), nil
+	case "keychain":
+		service, account, _ := strings.Cut(value, "/")
+		if service == "" {
+			return nil, fmt.Errorf("invalid keychain store key source: no keychain service")
+		}
+		if account == "" {
+			account = DefaultKeychainAccount
+		}
+		return KeychainStoreKey{Service: service, Account: account}, nil
+	}
+	return nil, fmt.Errorf("unknown store key source: want env:NAME, file:PATH or keychain:SERVICE[/ACCOUNT]")
+}
+
+// ParseStoreKey decodes a store key written in hex or base64, ignoring
+// surrounding whitespace. The key must be StoreKeySize bytes.
+func ParseStoreKey(text string) ([]byte, error) {
+	text = strings.TrimSpace(text)
+	key, err := hex.DecodeString(text)
+	if err != nil {
+		key, err = base64.StdEncoding.DecodeString(text)
+	}
+	if err != nil {
+		key, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(text, "="))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("store key is neither hex nor base64")
+	}
+	if len(key) != StoreKeySize {
+		return nil, fmt.Errorf("store key must be %d bytes, got %d", StoreKeySize, len(key))
+	}
+	return key, nil
+}
+
+// GenerateStoreKey returns a new random store key.
+func GenerateStoreKey() ([]byte, error) {
+	key := make([]byte, StoreKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate store key: %w", err)
+	}
+	return key, nil
+}
@@ -0,0 +1,87 @@
+package pinning
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStoreKeyProviders(t *testing.T) {
+	key := testStoreKey(t, 9)
+	dir := t.TempDir()
+	rawFile := filepath.Join(dir, "raw.key")
+	hexFile := filepath.Join(dir, "hex.key")
+	if err := os.WriteFile(rawFile, key, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(hexFile, []byte(hex.EncodeToString(key)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SCHEMAPIN_TEST_STORE_KEY", base64.StdEncoding.EncodeToString(key))
+
+	for _, source := range []string{"env:SCHEMAPIN_TEST_STORE_KEY", "file:" + rawFile, "file:" + hexFile} {
+		provider, err := ParseStoreKeySource(source)
+		if err != nil {
+			t.Fatalf("ParseStoreKeySource(%q) failed: %v", source, err)
+		}
+		got, err := provider.StoreKey()
+		if err != nil {
+			t.Fatalf("%s: %v", source, err)
+		}
+		if !bytes.Equal(got, key) {
+			t.Errorf("%s: got key %x", source, got)
+		}
+	}
+
+	provider, err := ParseStoreKeySource("keychain:schemapin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (KeychainStoreKey{Service: "schemapin", Account: DefaultKeychainAccount}); provider != want {
+		t.Errorf("Expected %+v, got %+v", want, provider)
+	}
+
+	// A key given in place of a source must not end up in the error
+	secret := hex.EncodeToString(key)
+	for _, source := range []string{"", "env:", "vault:path", "keychain:/account", secret, secret + ":x", "keychain:/" + secret} {
+		_, err := ParseStoreKeySource(source)
+		if err == nil {
+			t.Errorf("Expected ParseStoreKeySource(%q) to fail", source)
+			continue
+		}
+		if strings.Contains(err.Error(), secret) || strings.Contains(err.Error(), "vault") {
+			t.Errorf("Expected the error not to repeat the source, got %v", err)
+		}
+	}
+	if _, err := EnvStoreKey("SCHEMAPIN_TEST_UNSET_STORE_KEY").StoreKey(); err == nil {
+		t.Error("Expected an unset variable to fail")
+	}
+}
+
+func TestParseStoreKey(t *testing.T) {
+	key := testStoreKey(t, 10)
+	for _, text := range []string{
+		hex.EncodeToString(key),
+		base64.StdEncoding.EncodeToString(key),
+		"  " + base64.RawURLEncoding.EncodeToString(key) + "\n",
+	} {
+		got, err := ParseStoreKey(text)
+		if err != nil || !bytes.Equal(got, key) {
+			t.Errorf("ParseStoreKey(%q) = %x, %v", text, got, err)
+		}
+	}
+	for _, text := range []string{"", "not a key", hex.EncodeToString(key[:16])} {
+		if _, err := ParseStoreKey(text); err == nil {
+			t.Errorf("Expected ParseStoreKey(%q) to fail", text)
+		}
+	}
+
+	generated, err := GenerateStoreKey()
+	if err != nil || len(generated) != StoreKeySize {
+		t.Errorf("GenerateStoreKey = %x, %v", generated, err)
+	}
+}
@@ -0,0 +1,57 @@
+package pinning
+
+import "github.com/ThirdKeyAi/schemapin/go/pkg/interactive"
+
+// TrustDecision is why a key was trusted for a verification: the pin it
+// matched, or how it came to be pinned or accepted just then. The values
+// describe different trust stories, e.g. a key a user approved against one
+// pinned only because auto-pinning was on.
+type TrustDecision string
+
+const (
+	// TrustPrePinned is a key matching a pin made before the verification,
+	// by any earlier decision or provisioned in advance.
+	TrustPrePinned TrustDecision = "pre_pinned"
+	// TrustAutoPinned is a key pinned on first use without asking, in
+	// automatic mode or with auto-pinning requested.
+	TrustAutoPinned TrustDecision = "auto_pinned"
+	// TrustPolicyAlwaysTrust is a key pinned because its domain has the
+	// always_trust policy.
+	TrustPolicyAlwaysTrust TrustDecision = "policy_always_trust"
+	// TrustInteractiveAccept is a key the user accepted when prompted.
+	TrustInteractiveAccept TrustDecision = "interactive_accept"
+	// TrustInteractiveAlwaysTrust is a key the user accepted when prompted
+	// while marking its domain always trusted.
+	TrustInteractiveAlwaysTrust TrustDecision = "interactive_always_trust"
+	// TrustNamespacePin is a key matching, or just pinned as, a namespace
+	// pin covering the tool rather than a pin of the tool itself.
+	TrustNamespacePin TrustDecision = "namespace_pin"
+	// TrustTemporaryAccept is a key the user accepted for this
+	// verification only, without pinning it.
+	TrustTemporaryAccept TrustDecision = "temporary_accept"
+)
+
+// TrustForUserDecision returns the trust decision of a user's answer to a
+// prompt, or "" for an answer that does not trust the key.
+func TrustForUserDecision(decision interactive.UserDecision) TrustDecision {
+	switch decision {
+	case interactive.UserDecisionAccept:
+		return TrustInteractiveAccept
+	case interactive.UserDecisionAcceptNamespace:
+		return TrustNamespacePin
+	case interactive.UserDecisionAlwaysTrust:
+		return TrustInteractiveAlwaysTrust
+	case interactive.UserDecisionTemporaryAccept:
+		return TrustTemporaryAccept
+	}
+	return ""
+}
+
+// TrustForPinMatch returns the trust decision of a key matching an existing
+// pin found as match (see ResolvePin).
+func TrustForPinMatch(match PinMatch) TrustDecision {
+	if match == PinMatchNamespace {
+		return TrustNamespacePin
+	}
+	return TrustPrePinned
+}
@@ -0,0 +1,78 @@
+package pinning
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/interactive"
+)
+
+func TestInteractivePinKeyTrustDecision(t *testing.T) {
+	// Revocation and developer info lookups go to a closed server
+	server := httptest.NewServer(http.NotFoundHandler())
+	domain := server.URL
+	server.Close()
+
+	const toolID = "example.com/payments/refund"
+	tests := []struct {
+		name     string
+		mode     PinningMode
+		decision interactive.UserDecision
+		setup    func(k *KeyPinning) error
+		want     TrustDecision
+	}{
+		{name: "policy always_trust", mode: PinningModeInteractive, want: TrustPolicyAlwaysTrust,
+			setup: func(k *KeyPinning) error { return k.SetDomainPolicy(domain, PinningPolicyAlwaysTrust) }},
+		{name: "automatic mode", mode: PinningModeAutomatic, want: TrustAutoPinned},
+		{name: "interactive accept", mode: PinningModeInteractive, decision: interactive.UserDecisionAccept, want: TrustInteractiveAccept},
+		{name: "interactive always trust", mode: PinningModeInteractive, decision: interactive.UserDecisionAlwaysTrust, want: TrustInteractiveAlwaysTrust},
+		{name: "interactive namespace", mode: PinningModeInteractive, decision: interactive.UserDecisionAcceptNamespace, want: TrustNamespacePin},
+		{name: "temporary accept", mode: PinningModeInteractive, decision: interactive.UserDecisionTemporaryAccept, want: TrustTemporaryAccept},
+		{name: "interactive reject", mode: PinningModeInteractive, decision: interactive.UserDecisionReject, want: ""},
+		{name: "pre-pinned", mode: PinningModeStrict, want: TrustPrePinned,
+			setup: func(k *KeyPinning) error { return k.PinKey(toolID, "key", domain, "Test Developer") }},
+		{name: "pre-pinned namespace", mode: PinningModeStrict, want: TrustNamespacePin,
+			setup: func(k *KeyPinning) error {
+				return k.PinKeyForNamespace("example.com/payments/", "key", domain, "Test Developer")
+			}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var handler interactive.InteractiveHandler
+			if tt.decision != "" {
+				handler = &mockInteractiveHandler{decision: tt.decision}
+			}
+			logs := &recordingHandler{}
+			k, err := NewKeyPinning(createTempDB(t), tt.mode, handler, WithLogger(slog.New(logs)))
+			if err != nil {
+				t.Fatalf("Failed to create KeyPinning: %v", err)
+			}
+			defer k.Close()
+			if tt.setup != nil {
+				if err := tt.setup(k); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			decision, err := k.InteractivePinKeyWithDecision(toolID, "key", domain, "Test Developer")
+			if err != nil {
+				t.Fatalf("InteractivePinKeyWithDecision failed: %v", err)
+			}
+			if decision.TrustDecision != tt.want {
+				t.Errorf("Expected trust decision %q, got %q", tt.want, decision.TrustDecision)
+			}
+			if decision.Accepted != (tt.want != "") {
+				t.Errorf("Expected accepted=%v with trust decision %q", tt.want != "", tt.want)
+			}
+
+			// The pin decision log record carries the same value
+			if _, attrs, ok := logs.find("pin decision"); ok && tt.want != "" {
+				if got := attrs["trust_decision"].String(); got != string(tt.want) {
+					t.Errorf("Expected the pin decision record to carry %q, got %q", tt.want, got)
+				}
+			}
+		})
+	}
+}
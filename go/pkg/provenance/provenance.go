@@ -0,0 +1,294 @@
+// Package provenance verifies in-toto provenance attestations, such as SLSA
+// build provenance, carried in DSSE envelopes next to SchemaPin signatures.
+//
+// A signed schema or skill may carry a "provenance" field holding a DSSE
+// envelope whose payload is an in-toto statement. The statement names the
+// signed artifact as a subject by its SHA-256 digest: the canonical schema
+// hash, or the skill root hash. Check verifies the envelope's signature,
+// that the artifact is one of its subjects, and reads the builder and
+// source fields of the predicate, so that a verifier learns which pipeline
+// built the artifact from which commit.
+package provenance
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+)
+
+// PayloadType is the DSSE payload type of in-toto statements.
+const PayloadType = "application/vnd.in-toto+json"
+
+// In-toto statement types accepted by Check.
+const (
+	StatementTypeV1  = "https://in-toto.io/Statement/v1"
+	StatementTypeV01 = "https://in-toto.io/Statement/v0.1"
+)
+
+// SLSA provenance predicate types whose fields Check reads.
+const (
+	PredicateSLSAV1  = "https://slsa.dev/provenance/v1"
+	PredicateSLSAV02 = "https://slsa.dev/provenance/v0.2"
+)
+
+// Metadata keys under which AddMetadata reports a Summary.
+const (
+	MetadataPredicateType = "provenance_predicate_type"
+	MetadataBuilderID     = "provenance_builder_id"
+	MetadataSourceRepo    = "provenance_source_repo"
+	MetadataCommit        = "provenance_commit"
+)
+
+// Envelope is a DSSE envelope. Payload is the base64-encoded statement.
+type Envelope struct {
+	PayloadType string      `json:"payloadType"`
+	Payload     string      `json:"payload"`
+	Signatures  []Signature `json:"signatures"`
+}
+
+// Signature is one signature of an Envelope: a base64 ASN.1 DER ECDSA
+// P-256 signature over the SHA-256 of the envelope's PAE encoding.
+type Signature struct {
+	KeyID string `json:"keyid,omitempty"`
+	Sig   string `json:"sig"`
+}
+
+// Statement is an in-toto statement.
+type Statement struct {
+	Type          string          `json:"_type"`
+	Subject       []Subject       `json:"subject"`
+	PredicateType string          `json:"predicateType"`
+	Predicate     json.RawMessage `json:"predicate,omitempty"`
+}
+
+// Subject is an artifact a Statement is about, named by its digests.
+type Subject struct {
+	Name   string            `json:"name,omitempty"`
+	Digest map[string]string `json:"digest"`
+}
+
+// Summary holds the predicate fields Check reports. Fields missing from
+// the predicate, or from predicate types other than SLSA provenance, are
+// empty.
+type Summary struct {
+	PredicateType string `json:"predicate_type"`
+	BuilderID     string `json:"builder_id,omitempty"`
+	SourceRepo    string `json:"source_repo,omitempty"`
+	Commit        string `json:"commit,omitempty"`
+}
+
+// AddMetadata records the non-empty fields of s in metadata under the
+// Metadata* keys.
+func (s *Summary) AddMetadata(metadata map[string]interface{}) {
+	for key, value := range map[string]string{
+		MetadataPredicateType: s.PredicateType,
+		MetadataBuilderID:     s.BuilderID,
+		MetadataSourceRepo:    s.SourceRepo,
+		MetadataCommit:        s.Commit,
+	} {
+		if value != "" {
+			metadata[key] = value
+		}
+	}
+}
+
+// Config enables provenance verification. A nil *Config disables it:
+// provenance is then neither checked nor reported.
+type Config struct {
+	// Keys are trusted to sign provenance in addition to the key that
+	// signed the artifact, e.g. the key of a CI builder.
+	Keys []*ecdsa.PublicKey
+}
+
+// PAE returns the DSSE pre-authentication encoding of a payload, which is
+// what envelope signatures are made over.
+func PAE(payloadType string, payload []byte) []byte {
+	var b bytes.Buffer
+	b.WriteString("DSSEv1 ")
+	b.WriteString(strconv.Itoa(len(payloadType)))
+	b.WriteByte(' ')
+	b.WriteString(payloadType)
+	b.WriteByte(' ')
+	b.WriteString(strconv.Itoa(len(payload)))
+	b.WriteByte(' ')
+	b.Write(payload)
+	return b.Bytes()
+}
+
+// Sign returns an envelope holding statement, signed with privateKey and
+// labelled with keyID, which may be empty.
+func Sign(statement *Statement, privateKey *ecdsa.PrivateKey, keyID string) (*Envelope, error) {
+	payload, err := json.Marshal(statement)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal statement: %w", err)
+	}
+	sig, err := crypto.NewSignatureManager().SignHash(PAE(PayloadType, payload), privateKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Envelope{
+		PayloadType: PayloadType,
+		Payload:     base64.StdEncoding.EncodeToString(payload),
+		Signatures:  []Signature{{KeyID: keyID, Sig: sig}},
+	}, nil
+}
+
+// Statement decodes the envelope's statement without verifying any
+// signature. It fails for payload types and statement types other than
+// in-toto's.
+func (e *Envelope) Statement() (*Statement, error) {
+	if e.PayloadType != PayloadType {
+		return nil, fmt.Errorf("unsupported payload type %q", e.PayloadType)
+	}
+	payload, err := base64.StdEncoding.DecodeString(e.Payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid payload encoding: %w", err)
+	}
+	var statement Statement
+	if err := json.Unmarshal(payload, &statement); err != nil {
+		return nil, fmt.Errorf("invalid statement: %w", err)
+	}
+	if statement.Type != StatementTypeV1 && statement.Type != StatementTypeV01 {
+		return nil, fmt.Errorf("unsupported statement type %q", statement.Type)
+	}
+	return &statement, nil
+}
+
+// VerifySignature reports whether one of the envelope's signatures was
+// made by one of keys.
+func (e *Envelope) VerifySignature(keys ...*ecdsa.PublicKey) bool {
+	payload, err := base64.StdEncoding.DecodeString(e.Payload)
+	if err != nil {
+		return false
+	}
+	pae := PAE(e.PayloadType, payload)
+	sigManager := crypto.NewSignatureManager()
+	for _, sig := range e.Signatures {
+		for _, key := range keys {
+			if key != nil && sigManager.VerifySignature(pae, sig.Sig, key) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HasSubject reports whether digest, a SHA-256 digest, names one of the
+// statement's subjects.
+func (s *Statement) HasSubject(digest []byte) bool {
+	want := hex.EncodeToString(digest)
+	for _, subject := range s.Subject {
+		if strings.EqualFold(subject.Digest["sha256"], want) {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckSubject decodes the envelope's statement and checks that digest is
+// one of its subjects, as signers do before attaching provenance. It does
+// not verify the envelope's signature.
+func CheckSubject(e *Envelope, digest []byte) error {
+	statement, err := e.Statement()
+	if err != nil {
+		return &schemaerr.Error{Kind: schemaerr.ErrProvenanceInvalid, Message: "provenance: " + err.Error(), Err: err}
+	}
+	if !statement.HasSubject(digest) {
+		return subjectMismatch(digest)
+	}
+	return nil
+}
+
+// Check verifies e as the provenance of an artifact with SHA-256 digest
+// digest, signed by signer. The envelope must be signed by signer or one
+// of c.Keys and name digest as a subject. Failures are *schemaerr.Error
+// values of kind schemaerr.ErrProvenanceInvalid, or
+// schemaerr.ErrProvenanceSubjectMismatch when the signature is valid but
+// the statement is about other artifacts.
+func (c *Config) Check(e *Envelope, digest []byte, signer *ecdsa.PublicKey) (*Summary, error) {
+	statement, err := e.Statement()
+	if err != nil {
+		return nil, &schemaerr.Error{Kind: schemaerr.ErrProvenanceInvalid, Message: "provenance: " + err.Error(), Err: err}
+	}
+	if !e.VerifySignature(append([]*ecdsa.PublicKey{signer}, c.Keys...)...) {
+		return nil, &schemaerr.Error{Kind: schemaerr.ErrProvenanceInvalid, Message: "provenance signature verification failed"}
+	}
+	if !statement.HasSubject(digest) {
+		return nil, subjectMismatch(digest)
+	}
+	return summarize(statement), nil
+}
+
+func subjectMismatch(digest []byte) error {
+	return &schemaerr.Error{
+		Kind:    schemaerr.ErrProvenanceSubjectMismatch,
+		Message: fmt.Sprintf("provenance has no subject with digest sha256:%x", digest),
+	}
+}
+
+// slsaPredicate holds the fields read from SLSA v1 and v0.2 predicates.
+type slsaPredicate struct {
+	// v1
+	RunDetails struct {
+		Builder struct {
+			ID string `json:"id"`
+		} `json:"builder"`
+	} `json:"runDetails"`
+	BuildDefinition struct {
+		ResolvedDependencies []struct {
+			URI    string            `json:"uri"`
+			Digest map[string]string `json:"digest"`
+		} `json:"resolvedDependencies"`
+	} `json:"buildDefinition"`
+
+	// v0.2
+	Builder struct {
+		ID string `json:"id"`
+	} `json:"builder"`
+	Invocation struct {
+		ConfigSource struct {
+			URI    string            `json:"uri"`
+			Digest map[string]string `json:"digest"`
+		} `json:"configSource"`
+	} `json:"invocation"`
+}
+
+// summarize reads the builder and source of a SLSA provenance statement.
+// The source is the first resolved dependency in v1, which SLSA builders
+// record as the repository built from, and the config source in v0.2.
+func summarize(statement *Statement) *Summary {
+	summary := &Summary{PredicateType: statement.PredicateType}
+	var predicate slsaPredicate
+	if len(statement.Predicate) == 0 || json.Unmarshal(statement.Predicate, &predicate) != nil {
+		return summary
+	}
+	var uri string
+	var digest map[string]string
+	switch statement.PredicateType {
+	case PredicateSLSAV1:
+		summary.BuilderID = predicate.RunDetails.Builder.ID
+		if deps := predicate.BuildDefinition.ResolvedDependencies; len(deps) > 0 {
+			uri, digest = deps[0].URI, deps[0].Digest
+		}
+	case PredicateSLSAV02:
+		summary.BuilderID = predicate.Builder.ID
+		uri, digest = predicate.Invocation.ConfigSource.URI, predicate.Invocation.ConfigSource.Digest
+	default:
+		return summary
+	}
+	// Sources are recorded as e.g. git+https://github.com/org/repo@refs/heads/main
+	summary.SourceRepo, _, _ = strings.Cut(uri, "@")
+	summary.Commit = digest["gitCommit"]
+	if summary.Commit == "" {
+		summary.Commit = digest["sha1"]
+	}
+	return summary
+}
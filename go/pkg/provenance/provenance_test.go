@@ -0,0 +1,159 @@
+package provenance
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+)
+
+func testKey(t *testing.T, seed string) *ecdsa.PrivateKey {
+	t.Helper()
+	key, err := crypto.NewKeyManager().GenerateKeypairFromSeed([]byte(seed), crypto.ForTesting)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	return key
+}
+
+// slsaStatement returns SLSA v1 provenance for an artifact with digest.
+func slsaStatement(digest []byte) *Statement {
+	return &Statement{
+		Type:          StatementTypeV1,
+		Subject:       []Subject{{Name: "schema.json", Digest: map[string]string{"sha256": hex.EncodeToString(digest)}}},
+		PredicateType: PredicateSLSAV1,
+		Predicate: json.RawMessage(`{
+			"buildDefinition": {
+				"buildType": "https://actions.github.io/buildtypes/workflow/v1",
+				"resolvedDependencies": [{
+					"uri": "git+https://github.com/example/tools@refs/heads/main",
+					"digest": {"gitCommit": "0123456789abcdef0123456789abcdef01234567"}
+				}]
+			},
+			"runDetails": {"builder": {"id": "https://github.com/actions/runner/github-hosted"}}
+		}`),
+	}
+}
+
+func TestPAE(t *testing.T) {
+	// The example from the DSSE protocol specification
+	got := string(PAE("http://example.com/HelloWorld", []byte("hello world")))
+	want := "DSSEv1 29 http://example.com/HelloWorld 11 hello world"
+	if got != want {
+		t.Errorf("PAE = %q, want %q", got, want)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	signer := testKey(t, "provenance-signer")
+	builder := testKey(t, "provenance-builder")
+	other := testKey(t, "provenance-other")
+	digest := sha256.Sum256([]byte("artifact"))
+
+	signedBy := func(key *ecdsa.PrivateKey, statement *Statement) *Envelope {
+		env, err := Sign(statement, key, "")
+		if err != nil {
+			t.Fatalf("Sign failed: %v", err)
+		}
+		return env
+	}
+	otherDigest := sha256.Sum256([]byte("other artifact"))
+	tampered := signedBy(signer, slsaStatement(digest[:]))
+	tampered.Payload = signedBy(signer, slsaStatement(otherDigest[:])).Payload
+
+	tests := []struct {
+		name   string
+		env    *Envelope
+		config Config
+		want   *schemaerr.Kind
+	}{
+		{"signed by signer", signedBy(signer, slsaStatement(digest[:])), Config{}, nil},
+		{"signed by provenance key", signedBy(builder, slsaStatement(digest[:])), Config{Keys: []*ecdsa.PublicKey{&builder.PublicKey}}, nil},
+		{"untrusted key", signedBy(other, slsaStatement(digest[:])), Config{Keys: []*ecdsa.PublicKey{&builder.PublicKey}}, schemaerr.ErrProvenanceInvalid},
+		{"tampered payload", tampered, Config{}, schemaerr.ErrProvenanceInvalid},
+		{"wrong subject", signedBy(signer, slsaStatement(otherDigest[:])), Config{}, schemaerr.ErrProvenanceSubjectMismatch},
+		{"wrong payload type", &Envelope{PayloadType: "text/plain", Payload: "aGVsbG8="}, Config{}, schemaerr.ErrProvenanceInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summary, err := tt.config.Check(tt.env, digest[:], &signer.PublicKey)
+			if tt.want != nil {
+				if !errors.Is(err, tt.want) {
+					t.Fatalf("Expected %v, got %v", tt.want, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Check failed: %v", err)
+			}
+			want := Summary{
+				PredicateType: PredicateSLSAV1,
+				BuilderID:     "https://github.com/actions/runner/github-hosted",
+				SourceRepo:    "git+https://github.com/example/tools",
+				Commit:        "0123456789abcdef0123456789abcdef01234567",
+			}
+			if *summary != want {
+				t.Errorf("Summary = %+v, want %+v", *summary, want)
+			}
+		})
+	}
+}
+
+func TestCheckSLSAV02(t *testing.T) {
+	signer := testKey(t, "provenance-signer")
+	digest := sha256.Sum256([]byte("artifact"))
+	statement := &Statement{
+		Type:          StatementTypeV01,
+		Subject:       []Subject{{Digest: map[string]string{"sha256": hex.EncodeToString(digest[:])}}},
+		PredicateType: PredicateSLSAV02,
+		Predicate: json.RawMessage(`{
+			"builder": {"id": "https://ci.example.com/builder@v2"},
+			"invocation": {"configSource": {
+				"uri": "git+https://git.example.com/tools@refs/tags/v1.0.0",
+				"digest": {"sha1": "89abcdef0123456789abcdef0123456789abcdef"}
+			}}
+		}`),
+	}
+	env, err := Sign(statement, signer, "builder")
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	summary, err := (&Config{}).Check(env, digest[:], &signer.PublicKey)
+	if err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	metadata := make(map[string]interface{})
+	summary.AddMetadata(metadata)
+	want := map[string]interface{}{
+		MetadataPredicateType: PredicateSLSAV02,
+		MetadataBuilderID:     "https://ci.example.com/builder@v2",
+		MetadataSourceRepo:    "git+https://git.example.com/tools",
+		MetadataCommit:        "89abcdef0123456789abcdef0123456789abcdef",
+	}
+	for key, value := range want {
+		if metadata[key] != value {
+			t.Errorf("metadata[%s] = %v, want %v", key, metadata[key], value)
+		}
+	}
+}
+
+func TestCheckSubject(t *testing.T) {
+	signer := testKey(t, "provenance-signer")
+	digest := sha256.Sum256([]byte("artifact"))
+	env, err := Sign(slsaStatement(digest[:]), signer, "")
+	if err != nil {
+		t.Fatalf("Sign failed: %v", err)
+	}
+	if err := CheckSubject(env, digest[:]); err != nil {
+		t.Errorf("CheckSubject failed for the subject: %v", err)
+	}
+	other := sha256.Sum256([]byte("other artifact"))
+	if err := CheckSubject(env, other[:]); !errors.Is(err, schemaerr.ErrProvenanceSubjectMismatch) {
+		t.Errorf("Expected a subject mismatch, got %v", err)
+	}
+}
@@ -0,0 +1,180 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+// Severity ranks verification failures for aggregated reports.
+type Severity int
+
+const (
+	// SeverityLow covers failures to check at all, e.g. discovery that
+	// could not be reached.
+	SeverityLow Severity = iota
+	// SeverityMedium covers failures of configuration or trust policy,
+	// e.g. a key that is not pinned or a domain outside the boundary.
+	SeverityMedium
+	// SeverityHigh covers keys that differ from the trusted one, e.g. a
+	// pin mismatch after a key rotation.
+	SeverityHigh
+	// SeverityCritical covers signed content that does not match its
+	// signature or was revoked: likely tampering.
+	SeverityCritical
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityCritical:
+		return "critical"
+	case SeverityHigh:
+		return "high"
+	case SeverityMedium:
+		return "medium"
+	}
+	return "low"
+}
+
+// MarshalText encodes the severity as its name.
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// severities ranks the error codes that are not SeverityMedium.
+var severities = map[verification.ErrorCode]Severity{
+	verification.ErrSignatureInvalid:             SeverityCritical,
+	verification.ErrKeyRevoked:                   SeverityCritical,
+	verification.ErrSignatureRevoked:             SeverityCritical,
+	verification.ErrSchemaCanonicalizationFailed: SeverityCritical,
+	verification.ErrPermissionChanged:            SeverityCritical,
+	verification.ErrProvenanceInvalid:            SeverityCritical,
+	verification.ErrProvenanceSubjectMismatch:    SeverityCritical,
+	verification.ErrContentPolicyViolation:       SeverityCritical,
+	verification.ErrIndexSignatureInvalid:        SeverityCritical,
+	verification.ErrEntryHashMismatch:            SeverityCritical,
+	verification.ErrEntrySignatureInvalid:        SeverityCritical,
+	verification.ErrKeyPinMismatch:               SeverityHigh,
+	verification.ErrSignerKidMismatch:            SeverityHigh,
+	verification.ErrDomainMismatch:               SeverityHigh,
+	verification.ErrDiscoveryDowngrade:           SeverityHigh,
+	verification.ErrDiscoveryTLSPinMismatch:      SeverityHigh,
+	verification.ErrKeyPreviouslyRejected:        SeverityHigh,
+	verification.ErrBaselineKeyChanged:           SeverityHigh,
+	verification.ErrDiscoveryFetchFailed:         SeverityLow,
+	verification.ErrDiscoveryResponseTooLarge:    SeverityLow,
+	verification.ErrDiscoveryRateLimited:         SeverityLow,
+	verification.ErrDiscoveryCircuitOpen:         SeverityLow,
+}
+
+// SeverityOf returns the severity of failures with the error code code.
+// Codes not ranked otherwise, including failures without a code, are
+// SeverityMedium.
+func SeverityOf(code verification.ErrorCode) Severity {
+	if severity, ok := severities[code]; ok {
+		return severity
+	}
+	return SeverityMedium
+}
+
+// Group is a set of failed verifications sharing an error code, domain
+// and key fingerprint, such as every schema of a vendor that rotated its
+// key.
+type Group struct {
+	ErrorCode      verification.ErrorCode `json:"error_code,omitempty"`
+	Domain         string                 `json:"domain,omitempty"`
+	KeyFingerprint string                 `json:"key_fingerprint,omitempty"`
+	Severity       Severity               `json:"severity"`
+	// Message is the error message of the group's first result.
+	Message string `json:"error_message,omitempty"`
+	// Count is the number of results in the group, and Examples the
+	// artifacts of the first of them, up to the limit given to Aggregate.
+	Count    int      `json:"count"`
+	Examples []string `json:"examples,omitempty"`
+}
+
+// Aggregate groups the failed results by error code, domain and key
+// fingerprint, keeping up to maxExamples artifact URIs of each group in
+// input order. Groups are ordered by severity, then by count, most first;
+// successful results are left out.
+func Aggregate(results []Result, maxExamples int) []Group {
+	type key struct {
+		code                verification.ErrorCode
+		domain, fingerprint string
+	}
+	var groups []*Group
+	index := make(map[key]*Group)
+	for _, result := range results {
+		if result.Valid {
+			continue
+		}
+		k := key{result.ErrorCode, result.Domain, result.KeyFingerprint}
+		group, ok := index[k]
+		if !ok {
+			group = &Group{
+				ErrorCode:      result.ErrorCode,
+				Domain:         result.Domain,
+				KeyFingerprint: result.KeyFingerprint,
+				Severity:       SeverityOf(result.ErrorCode),
+				Message:        result.ErrorMessage,
+			}
+			index[k] = group
+			groups = append(groups, group)
+		}
+		group.Count++
+		if len(group.Examples) < maxExamples && result.ArtifactURI != "" {
+			group.Examples = append(group.Examples, filepath.ToSlash(result.ArtifactURI))
+		}
+	}
+
+	// Groups of equal severity and count keep their first-seen order
+	sort.SliceStable(groups, func(i, j int) bool {
+		if groups[i].Severity != groups[j].Severity {
+			return groups[i].Severity > groups[j].Severity
+		}
+		return groups[i].Count > groups[j].Count
+	})
+	aggregated := make([]Group, len(groups))
+	for i, group := range groups {
+		aggregated[i] = *group
+	}
+	return aggregated
+}
+
+// WriteGroups writes groups to w as text, one block per group with its
+// count and examples.
+func WriteGroups(w io.Writer, groups []Group) error {
+	var b strings.Builder
+	for _, group := range groups {
+		code := string(group.ErrorCode)
+		if code == "" {
+			code = RuleVerificationFailed
+		}
+		noun := "results"
+		if group.Count == 1 {
+			noun = "result"
+		}
+		fmt.Fprintf(&b, "❌ %s [%s]: %d %s\n", code, group.Severity, group.Count, noun)
+		if group.Domain != "" {
+			fmt.Fprintf(&b, "   Domain: %s\n", group.Domain)
+		}
+		if group.KeyFingerprint != "" {
+			fmt.Fprintf(&b, "   Key fingerprint: %s\n", group.KeyFingerprint)
+		}
+		if group.Message != "" {
+			fmt.Fprintf(&b, "   Error: %s\n", group.Message)
+		}
+		for _, example := range group.Examples {
+			fmt.Fprintf(&b, "   - %s\n", example)
+		}
+		if more := group.Count - len(group.Examples); more > 0 && len(group.Examples) > 0 {
+			fmt.Fprintf(&b, "   ... and %d more\n", more)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
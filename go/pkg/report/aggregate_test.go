@@ -0,0 +1,126 @@
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+// batchResults is a batch after a vendor rotated its key: three groups of
+// repeated failures, passes, and one schema that was actually tampered with.
+func batchResults() []Result {
+	var results []Result
+	failed := func(uri, domain, fingerprint string, code verification.ErrorCode, message string) {
+		results = append(results, Result{
+			ArtifactURI:    uri,
+			KeyFingerprint: fingerprint,
+			VerificationResult: verification.VerificationResult{
+				Domain:       domain,
+				ErrorCode:    code,
+				ErrorMessage: message,
+			},
+		})
+	}
+	for i := 0; i < 6; i++ {
+		failed(fmt.Sprintf("schemas/vendor/tool%d.json", i), "vendor.example", "sha256:bbbb", verification.ErrKeyPinMismatch, "Key fingerprint changed since last use")
+		results = append(results, Result{
+			ArtifactURI:        fmt.Sprintf("schemas/ok/tool%d.json", i),
+			VerificationResult: verification.VerificationResult{Valid: true, Domain: "example.com"},
+		})
+	}
+	for i := 0; i < 2; i++ {
+		failed(fmt.Sprintf("schemas/offline/tool%d.json", i), "offline.example", "", verification.ErrDiscoveryFetchFailed, "Failed to fetch discovery document")
+	}
+	failed("schemas/example/search.json", "example.com", "sha256:aaaa", verification.ErrSignatureInvalid, "Signature verification failed")
+	for i := 0; i < 3; i++ {
+		failed(fmt.Sprintf("schemas/new/tool%d.json", i), "new.example", "sha256:cccc", verification.ErrKeyNotPinned, "No key is pinned")
+	}
+	return results
+}
+
+func TestAggregateGolden(t *testing.T) {
+	tests := []struct {
+		golden      string
+		maxExamples int
+	}{
+		{"aggregate.txt", 3},
+		{"aggregate_no_examples.txt", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteGroups(&buf, Aggregate(batchResults(), tt.maxExamples)); err != nil {
+				t.Fatal(err)
+			}
+
+			path := filepath.Join("testdata", tt.golden)
+			if *update {
+				if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+					t.Fatalf("Failed to update golden file: %v", err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read golden file: %v", err)
+			}
+			if !bytes.Equal(buf.Bytes(), want) {
+				t.Errorf("output differs from %s (run with -update to regenerate)\nGot:\n%s", path, buf.String())
+			}
+		})
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	groups := Aggregate(batchResults(), 3)
+	want := []struct {
+		code  verification.ErrorCode
+		count int
+	}{
+		{verification.ErrSignatureInvalid, 1},
+		{verification.ErrKeyPinMismatch, 6},
+		{verification.ErrKeyNotPinned, 3},
+		{verification.ErrDiscoveryFetchFailed, 2},
+	}
+	if len(groups) != len(want) {
+		t.Fatalf("expected %d groups, got %+v", len(want), groups)
+	}
+	for i, w := range want {
+		if groups[i].ErrorCode != w.code || groups[i].Count != w.count {
+			t.Errorf("group %d: expected %s x%d, got %s x%d", i, w.code, w.count, groups[i].ErrorCode, groups[i].Count)
+		}
+	}
+	if got := groups[1].Examples; len(got) != 3 || got[0] != "schemas/vendor/tool0.json" {
+		t.Errorf("expected the first three examples, got %v", got)
+	}
+
+	// A different key for the same code and domain is a separate group
+	results := append(batchResults(), Result{
+		ArtifactURI:        "schemas/vendor/other.json",
+		KeyFingerprint:     "sha256:dddd",
+		VerificationResult: verification.VerificationResult{Domain: "vendor.example", ErrorCode: verification.ErrKeyPinMismatch},
+	})
+	if groups := Aggregate(results, 3); len(groups) != 5 {
+		t.Errorf("expected 5 groups, got %d", len(groups))
+	}
+
+	if groups := Aggregate(nil, 3); len(groups) != 0 {
+		t.Errorf("expected no groups, got %+v", groups)
+	}
+}
+
+func TestSeverityOf(t *testing.T) {
+	if SeverityOf(verification.ErrSignatureInvalid) <= SeverityOf(verification.ErrKeyPinMismatch) {
+		t.Error("expected tampering to outrank a pin mismatch")
+	}
+	if got := SeverityOf(""); got != SeverityMedium {
+		t.Errorf("expected failures without a code to be medium, got %s", got)
+	}
+	text, err := SeverityHigh.MarshalText()
+	if err != nil || string(text) != "high" {
+		t.Errorf("expected high, got %s, %v", text, err)
+	}
+}
@@ -0,0 +1,91 @@
+package report
+
+import "github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+
+// Outcome classifies verification results by what a caller should do
+// about them: nothing, retry, fix the input, or treat the artifact as
+// untrusted. Outcomes are ordered by precedence, so the outcome of a set
+// of results is the greatest outcome of any of them.
+type Outcome int
+
+const (
+	// OutcomeValid is a result that verified.
+	OutcomeValid Outcome = iota
+	// OutcomeTransient is a failure to check at all, e.g. discovery that
+	// could not be reached, was rate limited or timed out. Retrying may
+	// succeed.
+	OutcomeTransient
+	// OutcomeInputError is a failure without an error code, e.g. a file
+	// that could not be read or parsed.
+	OutcomeInputError
+	// OutcomeTrustFailure is any other failure, e.g. signature_invalid,
+	// key_revoked, key_pin_mismatch or domain_blocked.
+	OutcomeTrustFailure
+)
+
+// Exit codes of schemapin-verify --exit-code-detail, one per Outcome.
+const (
+	ExitValid        = 0
+	ExitTrustFailure = 2
+	ExitTransient    = 3
+	ExitInputError   = 4
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case OutcomeValid:
+		return "valid"
+	case OutcomeTransient:
+		return "transient"
+	case OutcomeInputError:
+		return "input_error"
+	}
+	return "trust_failure"
+}
+
+// MarshalText encodes the outcome as its name.
+func (o Outcome) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+// ExitCode returns the process exit code for the outcome.
+func (o Outcome) ExitCode() int {
+	switch o {
+	case OutcomeValid:
+		return ExitValid
+	case OutcomeTransient:
+		return ExitTransient
+	case OutcomeInputError:
+		return ExitInputError
+	}
+	return ExitTrustFailure
+}
+
+// OutcomeOf returns the outcome of a failure with the error code code.
+// Codes of SeverityLow, which covers failures to check at all, are
+// OutcomeTransient, and failures without a code OutcomeInputError.
+func OutcomeOf(code verification.ErrorCode) Outcome {
+	switch {
+	case code == "":
+		return OutcomeInputError
+	case SeverityOf(code) == SeverityLow:
+		return OutcomeTransient
+	}
+	return OutcomeTrustFailure
+}
+
+// Classify returns the outcome of results: OutcomeValid if every result
+// verified, or else that of the failure of highest precedence. A trust
+// failure anywhere in a batch outranks input errors, and both outrank
+// transient failures, so OutcomeTransient means that every failure was
+// transient. An empty batch is OutcomeValid.
+func Classify(results []Result) Outcome {
+	outcome := OutcomeValid
+	for _, result := range results {
+		if result.Valid {
+			continue
+		}
+		outcome = max(outcome, OutcomeOf(result.ErrorCode))
+	}
+	return outcome
+}
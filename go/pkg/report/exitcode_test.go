@@ -0,0 +1,70 @@
+package report
+
+import (
+	"testing"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+func TestOutcomeOf(t *testing.T) {
+	tests := []struct {
+		code verification.ErrorCode
+		want Outcome
+	}{
+		{verification.ErrSignatureInvalid, OutcomeTrustFailure},
+		{verification.ErrKeyRevoked, OutcomeTrustFailure},
+		{verification.ErrKeyPinMismatch, OutcomeTrustFailure},
+		{verification.ErrDomainBlocked, OutcomeTrustFailure},
+		{verification.ErrKeyNotPinned, OutcomeTrustFailure},
+		{verification.ErrDiscoveryTLSPinMismatch, OutcomeTrustFailure},
+		{verification.ErrDiscoveryFetchFailed, OutcomeTransient},
+		{verification.ErrDiscoveryRateLimited, OutcomeTransient},
+		{verification.ErrDiscoveryCircuitOpen, OutcomeTransient},
+		{"", OutcomeInputError},
+	}
+	for _, tt := range tests {
+		if got := OutcomeOf(tt.code); got != tt.want {
+			t.Errorf("OutcomeOf(%q) = %s, want %s", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestClassifyPrecedence(t *testing.T) {
+	valid := Result{VerificationResult: verification.VerificationResult{Valid: true}}
+	failed := func(code verification.ErrorCode) Result {
+		return Result{VerificationResult: verification.VerificationResult{ErrorCode: code, ErrorMessage: "failed"}}
+	}
+	trust := failed(verification.ErrSignatureInvalid)
+	revoked := failed(verification.ErrKeyRevoked)
+	transient := failed(verification.ErrDiscoveryFetchFailed)
+	rateLimited := failed(verification.ErrDiscoveryRateLimited)
+	input := failed("")
+
+	tests := []struct {
+		name     string
+		results  []Result
+		want     Outcome
+		wantExit int
+	}{
+		{"empty", nil, OutcomeValid, ExitValid},
+		{"all valid", []Result{valid, valid}, OutcomeValid, ExitValid},
+		{"trust", []Result{valid, trust, revoked}, OutcomeTrustFailure, ExitTrustFailure},
+		{"transient only", []Result{transient, valid, rateLimited}, OutcomeTransient, ExitTransient},
+		{"input", []Result{valid, input}, OutcomeInputError, ExitInputError},
+		{"trust and transient", []Result{transient, trust, transient}, OutcomeTrustFailure, ExitTrustFailure},
+		{"trust and input", []Result{input, trust}, OutcomeTrustFailure, ExitTrustFailure},
+		{"input and transient", []Result{transient, input, rateLimited}, OutcomeInputError, ExitInputError},
+		{"every class", []Result{valid, transient, input, revoked}, OutcomeTrustFailure, ExitTrustFailure},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Classify(tt.results)
+			if got != tt.want {
+				t.Fatalf("Classify = %s, want %s", got, tt.want)
+			}
+			if exit := got.ExitCode(); exit != tt.wantExit {
+				t.Errorf("ExitCode = %d, want %d", exit, tt.wantExit)
+			}
+		})
+	}
+}
@@ -0,0 +1,272 @@
+// Package report renders SchemaPin verification results for external tooling.
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+// SARIF 2.1.0 identifiers.
+const (
+	SARIFVersion   = "2.1.0"
+	SARIFSchemaURI = "https://json.schemastore.org/sarif-2.1.0.json"
+)
+
+// Rule IDs used in addition to the verification error codes.
+const (
+	// RuleVerificationPassed is the informational rule for successful
+	// verifications, reported only when IncludePasses is set.
+	RuleVerificationPassed = "verification_passed"
+	// RuleVerificationFailed covers failures that carry no error code.
+	RuleVerificationFailed = "verification_failed"
+)
+
+// ruleCatalog lists one rule per verification error code, in the order the
+// rules appear in the SARIF driver so that rule indices are stable.
+var ruleCatalog = []struct {
+	id          string
+	description string
+}{
+	{string(verification.ErrSignatureInvalid), "Signature does not match the signed content"},
+	{string(verification.ErrKeyNotFound), "Signing key could not be found or loaded"},
+	{string(verification.ErrKeyRevoked), "Signing key has been revoked"},
+	{string(verification.ErrKeyPinMismatch), "Signing key differs from the pinned key"},
+	{string(verification.ErrDiscoveryFetchFailed), "Key discovery document could not be fetched"},
+	{string(verification.ErrDiscoveryInvalid), "Key discovery document is invalid"},
+	{string(verification.ErrDomainMismatch), "Signing domain does not match the expected domain"},
+	{string(verification.ErrSchemaCanonicalizationFailed), "Content could not be canonicalized"},
+	{string(verification.ErrCanonicalizationUnsupported), "Signature uses an unsupported canonicalization algorithm"},
+	{string(verification.ErrA2AScopeViolation), "Agent-to-agent scope violation"},
+	{string(verification.ErrBundleUnsigned), "Trust bundle is not signed"},
+	{string(verification.ErrBundleExpired), "Trust bundle has expired"},
+	{string(verification.ErrUnsupportedVersion), "Signed document uses an unsupported schemapin_version"},
+	{string(verification.ErrSignatureRevoked), "Signature over this schema has been revoked"},
+	{string(verification.ErrSignerKidMismatch), "Signature names a different signing key than the one published"},
+	{string(verification.ErrDomainBlocked), "Signing domain is outside the trust boundary"},
+	{string(verification.ErrDiscoveryDowngrade), "Key discovery document was downgraded to an older schema version"},
+	{string(verification.ErrDiscoveryRedirectBlocked), "Key discovery was redirected outside the redirect policy"},
+	{string(verification.ErrDiscoveryTLSPinMismatch), "Key discovery host presented a certificate matching none of its TLS pins"},
+	{string(verification.ErrDiscoveryResponseTooLarge), "Key discovery or revocation response exceeded the size limit"},
+	{string(verification.ErrDiscoveryRateLimited), "Key discovery was refused by the client-side rate limit"},
+	{string(verification.ErrDiscoveryCircuitOpen), "Key discovery was skipped because the domain's circuit breaker is open"},
+	{string(verification.ErrKeyNotPinned), "No key is pinned for the tool and pre-pinned keys are required"},
+	{string(verification.ErrSignatureThresholdNotMet), "Too few valid signatures, or required signers missing, for a multi-signature schema"},
+	{string(verification.ErrPermissionChanged), "A skill file's executable bit differs from the signed one"},
+	{string(verification.ErrKeyPreviouslyRejected), "The key was rejected for the tool before and has not been reconsidered"},
+	{string(verification.ErrProvenanceInvalid), "Attached provenance is malformed or not signed by a trusted key"},
+	{string(verification.ErrProvenanceSubjectMismatch), "Attached provenance does not name the verified artifact as a subject"},
+	{string(verification.ErrContentPolicyViolation), "Skill contents violate the content policy"},
+	{string(verification.ErrContentChanged), "Schema content differs from the reviewed baseline"},
+	{string(verification.ErrBaselineKeyChanged), "Schema was verified with a different key than the reviewed baseline"},
+	{string(verification.ErrIndexSignatureInvalid), "Tool index signature does not verify"},
+	{string(verification.ErrEntryHashMismatch), "Schema served for a tool index entry differs from the declared hash"},
+	{string(verification.ErrEntrySignatureInvalid), "Signature of a tool index entry does not verify"},
+	{string(verification.ErrSchemaTooComplex), "Schema exceeds the size or complexity limits"},
+	{RuleVerificationFailed, "Verification failed"},
+	{RuleVerificationPassed, "Verification passed"},
+}
+
+// Result is a verification outcome together with the artifact it applies
+// to, which verification.VerificationResult does not record.
+type Result struct {
+	// ArtifactURI is the schema file or skill directory that was verified.
+	ArtifactURI string
+	// KeyFingerprint is the fingerprint of the key used, if known.
+	KeyFingerprint string
+	verification.VerificationResult
+}
+
+// SARIFOptions configures SARIF output.
+type SARIFOptions struct {
+	// ToolName is the driver name. Defaults to "schemapin".
+	ToolName string
+	// ToolVersion is the driver version, omitted when empty.
+	ToolVersion string
+	// IncludePasses adds a note-level result for every successful
+	// verification.
+	IncludePasses bool
+}
+
+// SARIFLog is the top-level SARIF document.
+type SARIFLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []SARIFRun `json:"runs"`
+}
+
+// SARIFRun is a single analysis run.
+type SARIFRun struct {
+	Tool    SARIFTool     `json:"tool"`
+	Results []SARIFResult `json:"results"`
+}
+
+// SARIFTool describes the producing tool.
+type SARIFTool struct {
+	Driver SARIFDriver `json:"driver"`
+}
+
+// SARIFDriver is the tool component that produced the results.
+type SARIFDriver struct {
+	Name           string      `json:"name"`
+	Version        string      `json:"version,omitempty"`
+	InformationURI string      `json:"informationUri,omitempty"`
+	Rules          []SARIFRule `json:"rules"`
+}
+
+// SARIFRule is a reportingDescriptor for one error code.
+type SARIFRule struct {
+	ID                   string             `json:"id"`
+	ShortDescription     SARIFMessage       `json:"shortDescription"`
+	DefaultConfiguration SARIFConfiguration `json:"defaultConfiguration"`
+}
+
+// SARIFConfiguration is a rule's default reporting configuration.
+type SARIFConfiguration struct {
+	Level string `json:"level"`
+}
+
+// SARIFMessage is a plain-text message.
+type SARIFMessage struct {
+	Text string `json:"text"`
+}
+
+// SARIFResult is one finding.
+type SARIFResult struct {
+	RuleID     string                 `json:"ruleId"`
+	RuleIndex  int                    `json:"ruleIndex"`
+	Level      string                 `json:"level"`
+	Message    SARIFMessage           `json:"message"`
+	Locations  []SARIFLocation        `json:"locations,omitempty"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+// SARIFLocation points at the verified artifact.
+type SARIFLocation struct {
+	PhysicalLocation SARIFPhysicalLocation `json:"physicalLocation"`
+}
+
+// SARIFPhysicalLocation wraps an artifact location.
+type SARIFPhysicalLocation struct {
+	ArtifactLocation SARIFArtifactLocation `json:"artifactLocation"`
+}
+
+// SARIFArtifactLocation identifies an artifact by URI.
+type SARIFArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+// BuildSARIF converts results into a SARIF 2.1.0 log with one rule per
+// error code and one result per failed artifact. Failures without an error
+// code are reported under RuleVerificationFailed.
+func BuildSARIF(results []Result, opts SARIFOptions) *SARIFLog {
+	toolName := opts.ToolName
+	if toolName == "" {
+		toolName = "schemapin"
+	}
+
+	driver := SARIFDriver{
+		Name:           toolName,
+		Version:        opts.ToolVersion,
+		InformationURI: "https://docs.schemapin.org",
+	}
+	ruleIndex := make(map[string]int, len(ruleCatalog))
+	for i, rule := range ruleCatalog {
+		level := "error"
+		if rule.id == RuleVerificationPassed {
+			level = "note"
+		}
+		driver.Rules = append(driver.Rules, SARIFRule{
+			ID:                   rule.id,
+			ShortDescription:     SARIFMessage{Text: rule.description},
+			DefaultConfiguration: SARIFConfiguration{Level: level},
+		})
+		ruleIndex[rule.id] = i
+	}
+
+	sarifResults := make([]SARIFResult, 0, len(results))
+	for _, result := range results {
+		if result.Valid && !opts.IncludePasses {
+			continue
+		}
+
+		ruleID := RuleVerificationPassed
+		level := "note"
+		message := "Verification passed"
+		if !result.Valid {
+			ruleID = string(result.ErrorCode)
+			if _, known := ruleIndex[ruleID]; !known {
+				ruleID = RuleVerificationFailed
+			}
+			level = "error"
+			message = result.ErrorMessage
+			if message == "" {
+				message = "Verification failed"
+			}
+		}
+
+		sarifResult := SARIFResult{
+			RuleID:     ruleID,
+			RuleIndex:  ruleIndex[ruleID],
+			Level:      level,
+			Message:    SARIFMessage{Text: message},
+			Properties: resultProperties(result),
+		}
+		if result.ArtifactURI != "" {
+			sarifResult.Locations = []SARIFLocation{{
+				PhysicalLocation: SARIFPhysicalLocation{
+					ArtifactLocation: SARIFArtifactLocation{URI: filepath.ToSlash(result.ArtifactURI)},
+				},
+			}}
+		}
+		sarifResults = append(sarifResults, sarifResult)
+	}
+
+	return &SARIFLog{
+		Schema:  SARIFSchemaURI,
+		Version: SARIFVersion,
+		Runs: []SARIFRun{{
+			Tool:    SARIFTool{Driver: driver},
+			Results: sarifResults,
+		}},
+	}
+}
+
+func resultProperties(result Result) map[string]interface{} {
+	properties := make(map[string]interface{})
+	if result.ErrorCode != "" {
+		properties["error_code"] = string(result.ErrorCode)
+	}
+	if result.ErrorMessage != "" {
+		properties["error_message"] = result.ErrorMessage
+	}
+	if result.Domain != "" {
+		properties["domain"] = result.Domain
+	}
+	if result.KeyFingerprint != "" {
+		properties["key_fingerprint"] = result.KeyFingerprint
+	}
+	if result.DeveloperName != "" {
+		properties["developer_name"] = result.DeveloperName
+	}
+	if len(result.Warnings) > 0 {
+		properties["warnings"] = result.Warnings
+	}
+	if len(properties) == 0 {
+		return nil
+	}
+	return properties
+}
+
+// WriteSARIF writes the SARIF log for results to w as indented JSON.
+func WriteSARIF(w io.Writer, results []Result, opts SARIFOptions) error {
+	data, err := json.MarshalIndent(BuildSARIF(results, opts), "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal SARIF: %w", err)
+	}
+	_, err = fmt.Fprintln(w, string(data))
+	return err
+}
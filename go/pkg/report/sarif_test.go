@@ -0,0 +1,198 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func sampleResults() []Result {
+	return []Result{
+		{
+			ArtifactURI:    "schemas/calculator.json",
+			KeyFingerprint: "sha256:1111",
+			VerificationResult: verification.VerificationResult{
+				Valid:  true,
+				Domain: "example.com",
+			},
+		},
+		{
+			ArtifactURI:    "schemas/search.json",
+			KeyFingerprint: "sha256:2222",
+			VerificationResult: verification.VerificationResult{
+				Valid:        false,
+				Domain:       "example.com",
+				ErrorCode:    verification.ErrSignatureInvalid,
+				ErrorMessage: "Signature verification failed",
+			},
+		},
+		{
+			ArtifactURI: filepath.Join("skills", "weather"),
+			VerificationResult: verification.VerificationResult{
+				Valid:        false,
+				Domain:       "tools.example.org",
+				ErrorCode:    verification.ErrKeyRevoked,
+				ErrorMessage: "Key has been revoked",
+				Warnings:     []string{"signature_expired"},
+			},
+		},
+		{
+			ArtifactURI: "schemas/legacy.json",
+			VerificationResult: verification.VerificationResult{
+				Valid:        false,
+				ErrorMessage: "failed to discover public key",
+			},
+		},
+	}
+}
+
+func TestBuildSARIFGolden(t *testing.T) {
+	tests := []struct {
+		name   string
+		golden string
+		opts   SARIFOptions
+	}{
+		{"failures only", "failures.sarif.json", SARIFOptions{ToolName: "schemapin-verify", ToolVersion: "1.0.0"}},
+		{"include passes", "with_passes.sarif.json", SARIFOptions{ToolName: "schemapin-verify", ToolVersion: "1.0.0", IncludePasses: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteSARIF(&buf, sampleResults(), tt.opts); err != nil {
+				t.Fatalf("WriteSARIF failed: %v", err)
+			}
+			validateSARIF(t, buf.Bytes())
+
+			path := filepath.Join("testdata", tt.golden)
+			if *update {
+				if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+					t.Fatalf("Failed to update golden file: %v", err)
+				}
+			}
+			want, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read golden file: %v", err)
+			}
+			if !bytes.Equal(buf.Bytes(), want) {
+				t.Errorf("SARIF output differs from %s (run with -update to regenerate)\nGot:\n%s", path, buf.String())
+			}
+		})
+	}
+}
+
+func TestBuildSARIFResults(t *testing.T) {
+	log := BuildSARIF(sampleResults(), SARIFOptions{})
+	run := log.Runs[0]
+
+	if run.Tool.Driver.Name != "schemapin" {
+		t.Errorf("Expected default tool name, got %q", run.Tool.Driver.Name)
+	}
+	if len(run.Results) != 3 {
+		t.Fatalf("Expected 3 failed results, got %d", len(run.Results))
+	}
+
+	revoked := run.Results[1]
+	if revoked.RuleID != "key_revoked" || revoked.Level != "error" {
+		t.Errorf("Unexpected revoked result: %+v", revoked)
+	}
+	if got := revoked.Locations[0].PhysicalLocation.ArtifactLocation.URI; got != "skills/weather" {
+		t.Errorf("Expected forward-slash artifact URI, got %q", got)
+	}
+	if revoked.Properties["domain"] != "tools.example.org" {
+		t.Errorf("Expected domain property, got %v", revoked.Properties)
+	}
+	if run.Results[2].RuleID != RuleVerificationFailed {
+		t.Errorf("Failure without error code should use %s, got %s", RuleVerificationFailed, run.Results[2].RuleID)
+	}
+}
+
+// validateSARIF checks a document against the constraints of the SARIF
+// 2.1.0 schema that this package relies on: required properties, the level
+// enumeration, and that every result references a rule of its driver.
+func validateSARIF(t *testing.T, data []byte) {
+	t.Helper()
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("SARIF is not valid JSON: %v", err)
+	}
+	fail := func(format string, args ...interface{}) {
+		t.Helper()
+		t.Fatalf("invalid SARIF: %s", fmt.Sprintf(format, args...))
+	}
+
+	if doc["version"] != "2.1.0" {
+		fail("version must be 2.1.0, got %v", doc["version"])
+	}
+	if doc["$schema"] != SARIFSchemaURI {
+		fail("unexpected $schema %v", doc["$schema"])
+	}
+	runs, ok := doc["runs"].([]interface{})
+	if !ok {
+		fail("runs must be an array")
+	}
+
+	levels := map[string]bool{"none": true, "note": true, "warning": true, "error": true}
+	for i, r := range runs {
+		run, _ := r.(map[string]interface{})
+		tool, _ := run["tool"].(map[string]interface{})
+		driver, _ := tool["driver"].(map[string]interface{})
+		if name, _ := driver["name"].(string); name == "" {
+			fail("runs[%d].tool.driver.name is required", i)
+		}
+
+		rules, _ := driver["rules"].([]interface{})
+		ruleIDs := make([]string, len(rules))
+		seen := make(map[string]bool)
+		for j, r := range rules {
+			rule, _ := r.(map[string]interface{})
+			id, _ := rule["id"].(string)
+			if id == "" || seen[id] {
+				fail("runs[%d] rule %d has a missing or duplicate id %q", i, j, id)
+			}
+			seen[id] = true
+			ruleIDs[j] = id
+			config, _ := rule["defaultConfiguration"].(map[string]interface{})
+			if level, _ := config["level"].(string); !levels[level] {
+				fail("rule %s has invalid level %q", id, level)
+			}
+		}
+
+		results, ok := run["results"].([]interface{})
+		if !ok {
+			fail("runs[%d].results must be an array", i)
+		}
+		for j, r := range results {
+			result, _ := r.(map[string]interface{})
+			message, _ := result["message"].(map[string]interface{})
+			if text, _ := message["text"].(string); text == "" {
+				fail("results[%d].message.text is required", j)
+			}
+			if level, _ := result["level"].(string); !levels[level] {
+				fail("results[%d] has invalid level %q", j, level)
+			}
+			index, ok := result["ruleIndex"].(float64)
+			if !ok || int(index) < 0 || int(index) >= len(ruleIDs) || ruleIDs[int(index)] != result["ruleId"] {
+				fail("results[%d] ruleIndex %v does not reference ruleId %v", j, result["ruleIndex"], result["ruleId"])
+			}
+			locations, _ := result["locations"].([]interface{})
+			for _, l := range locations {
+				location, _ := l.(map[string]interface{})
+				physical, _ := location["physicalLocation"].(map[string]interface{})
+				artifact, _ := physical["artifactLocation"].(map[string]interface{})
+				if uri, _ := artifact["uri"].(string); uri == "" {
+					fail("results[%d] artifactLocation.uri is required", j)
+				}
+			}
+		}
+	}
+}
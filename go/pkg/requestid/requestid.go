@@ -0,0 +1,56 @@
+// Package requestid carries a per-verification request ID through a
+// context, so that a verification can be correlated with the discovery
+// and revocation requests it made, on both the client and the server.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+)
+
+// Header is the HTTP header the request ID is sent in.
+const Header = "X-SchemaPin-Request-ID"
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying id.
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID carried by ctx, if any.
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(contextKey{}).(string)
+	return id, ok && id != ""
+}
+
+// Ensure returns ctx and its request ID, first attaching a new one from New
+// if ctx carries none.
+func Ensure(ctx context.Context) (context.Context, string) {
+	if id, ok := FromContext(ctx); ok {
+		return ctx, id
+	}
+	id := New()
+	return NewContext(ctx, id), id
+}
+
+// New returns a random (version 4) UUID.
+func New() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("requestid: failed to read random bytes: %v", err))
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// SetHeader sets Header on req to the request ID of req's context, if it
+// carries one.
+func SetHeader(req *http.Request) {
+	if id, ok := FromContext(req.Context()); ok {
+		req.Header.Set(Header, id)
+	}
+}
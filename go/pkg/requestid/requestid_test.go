@@ -0,0 +1,52 @@
+package requestid
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"testing"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestNew(t *testing.T) {
+	first, second := New(), New()
+	if !uuidPattern.MatchString(first) {
+		t.Errorf("Expected a version 4 UUID, got %q", first)
+	}
+	if first == second {
+		t.Errorf("Expected distinct IDs, got %q twice", first)
+	}
+}
+
+func TestEnsure(t *testing.T) {
+	ctx, id := Ensure(context.Background())
+	if !uuidPattern.MatchString(id) {
+		t.Errorf("Expected a generated UUID, got %q", id)
+	}
+	if got, ok := FromContext(ctx); !ok || got != id {
+		t.Errorf("Expected the context to carry %q, got %q", id, got)
+	}
+
+	ctx = NewContext(context.Background(), "caller-id")
+	if _, id := Ensure(ctx); id != "caller-id" {
+		t.Errorf("Expected the caller's ID to be kept, got %q", id)
+	}
+	if _, ok := FromContext(NewContext(context.Background(), "")); ok {
+		t.Error("Expected an empty ID to count as absent")
+	}
+}
+
+func TestSetHeader(t *testing.T) {
+	req, _ := http.NewRequestWithContext(NewContext(context.Background(), "abc"), http.MethodGet, "https://example.com", nil)
+	SetHeader(req)
+	if got := req.Header.Get(Header); got != "abc" {
+		t.Errorf("Expected header abc, got %q", got)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "https://example.com", nil)
+	SetHeader(req)
+	if _, ok := req.Header[Header]; ok {
+		t.Error("Expected no header without a request ID")
+	}
+}
@@ -4,11 +4,16 @@ package resolver
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
+	"sync"
+	"time"
 
 	"github.com/ThirdKeyAi/schemapin/go/pkg/bundle"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/revocation"
 )
@@ -19,21 +24,90 @@ type SchemaResolver interface {
 	ResolveRevocation(domain string, disc *discovery.WellKnownResponse) (*revocation.RevocationDocument, error)
 }
 
+// ErrNotFound is matched (via errors.Is) by errors from resolvers that simply
+// have no discovery document for a domain. ChainResolver only falls through to
+// the next resolver on this error; anything else is a hard failure.
+var ErrNotFound = errors.New("discovery not found")
+
+// notFoundError carries a resolver-specific message while matching ErrNotFound.
+type notFoundError struct {
+	msg string
+}
+
+func (e *notFoundError) Error() string {
+	return e.msg
+}
+
+func (e *notFoundError) Is(target error) bool {
+	return target == ErrNotFound
+}
+
+func newNotFoundError(format string, args ...interface{}) error {
+	return &notFoundError{msg: fmt.Sprintf(format, args...)}
+}
+
+// Discovery source identifiers reported by ResolveDiscoveryWithSource.
+const (
+	SourceBundle = "bundle"
+	SourceLive   = "live"
+	SourceCache  = "cache"
+	SourceLocal  = "local"
+)
+
+// SourcedResolver is implemented by resolvers that can report which source
+// answered a discovery lookup (one of the Source* constants).
+type SourcedResolver interface {
+	ResolveDiscoveryWithSource(domain string) (*discovery.WellKnownResponse, string, error)
+}
+
+// ResolveDiscoveryWithSource resolves discovery through r and reports the
+// source that answered. Resolvers that do not implement SourcedResolver
+// report an empty source.
+func ResolveDiscoveryWithSource(r SchemaResolver, domain string) (*discovery.WellKnownResponse, string, error) {
+	if sr, ok := r.(SourcedResolver); ok {
+		return sr.ResolveDiscoveryWithSource(domain)
+	}
+	disc, err := r.ResolveDiscovery(domain)
+	if err != nil {
+		return nil, "", err
+	}
+	return disc, "", nil
+}
+
 // WellKnownResolver resolves discovery via standard .well-known HTTPS endpoints.
 type WellKnownResolver struct {
 	discovery *discovery.PublicKeyDiscovery
 }
 
-// NewWellKnownResolver creates a new WellKnownResolver.
-func NewWellKnownResolver() *WellKnownResolver {
+// NewWellKnownResolver creates a new WellKnownResolver. opts configure its
+// discovery client, e.g. discovery.WithTLSPins.
+func NewWellKnownResolver(opts ...discovery.Option) *WellKnownResolver {
 	return &WellKnownResolver{
-		discovery: discovery.NewPublicKeyDiscovery(),
+		discovery: discovery.NewPublicKeyDiscovery(opts...),
 	}
 }
 
 // ResolveDiscovery fetches discovery from the .well-known endpoint.
+// A 404 from the endpoint is reported as ErrNotFound.
 func (r *WellKnownResolver) ResolveDiscovery(domain string) (*discovery.WellKnownResponse, error) {
-	return r.discovery.FetchWellKnown(context.Background(), domain)
+	disc, err := r.discovery.FetchDiscovery(context.Background(), domain)
+	if err != nil {
+		var statusErr *discovery.HTTPStatusError
+		if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+			return nil, newNotFoundError("no .well-known document for domain %s: %v", domain, err)
+		}
+		return nil, err
+	}
+	return disc, nil
+}
+
+// ResolveDiscoveryWithSource implements SourcedResolver.
+func (r *WellKnownResolver) ResolveDiscoveryWithSource(domain string) (*discovery.WellKnownResponse, string, error) {
+	disc, err := r.ResolveDiscovery(domain)
+	if err != nil {
+		return nil, "", err
+	}
+	return disc, SourceLive, nil
 }
 
 // ResolveRevocation fetches revocation from the discovery's revocation_endpoint.
@@ -41,7 +115,8 @@ func (r *WellKnownResolver) ResolveRevocation(domain string, disc *discovery.Wel
 	if disc == nil || disc.RevocationEndpoint == "" {
 		return nil, nil
 	}
-	doc, err := revocation.FetchRevocationDocument(context.Background(), disc.RevocationEndpoint)
+	doc, err := revocation.FetchRevocationDocument(context.Background(), disc.RevocationEndpoint,
+		revocation.WithUserAgent(r.discovery.UserAgent()))
 	if err != nil {
 		return nil, err
 	}
@@ -67,6 +142,9 @@ func (r *LocalFileResolver) ResolveDiscovery(domain string) (*discovery.WellKnow
 	path := filepath.Join(r.discoveryDir, domain+".json")
 	data, err := os.ReadFile(path) // #nosec G304 -- path constructed from trusted config directory + domain
 	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, newNotFoundError("failed to read discovery file: %v", err)
+		}
 		return nil, fmt.Errorf("failed to read discovery file: %w", err)
 	}
 
@@ -78,6 +156,15 @@ func (r *LocalFileResolver) ResolveDiscovery(domain string) (*discovery.WellKnow
 	return &resp, nil
 }
 
+// ResolveDiscoveryWithSource implements SourcedResolver.
+func (r *LocalFileResolver) ResolveDiscoveryWithSource(domain string) (*discovery.WellKnownResponse, string, error) {
+	disc, err := r.ResolveDiscovery(domain)
+	if err != nil {
+		return nil, "", err
+	}
+	return disc, SourceLocal, nil
+}
+
 // ResolveRevocation reads {domain}.revocations.json from the revocation directory.
 func (r *LocalFileResolver) ResolveRevocation(domain string, disc *discovery.WellKnownResponse) (*revocation.RevocationDocument, error) {
 	if r.revocationDir == "" {
@@ -117,21 +204,44 @@ func FromJSON(jsonStr string) (*TrustBundleResolver, error) {
 	return NewTrustBundleResolver(b), nil
 }
 
+// FromBytes creates a TrustBundleResolver from a trust bundle in either
+// encoding (see bundle.Parse).
+func FromBytes(data []byte) (*TrustBundleResolver, error) {
+	b, err := bundle.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	return NewTrustBundleResolver(b), nil
+}
+
 // ResolveDiscovery looks up discovery in the bundle.
 func (r *TrustBundleResolver) ResolveDiscovery(domain string) (*discovery.WellKnownResponse, error) {
 	disc := r.bundle.FindDiscovery(domain)
 	if disc == nil {
-		return nil, fmt.Errorf("domain %s not found in trust bundle", domain)
+		return nil, newNotFoundError("domain %s not found in trust bundle", domain)
 	}
 	return disc, nil
 }
 
+// ResolveDiscoveryWithSource implements SourcedResolver.
+func (r *TrustBundleResolver) ResolveDiscoveryWithSource(domain string) (*discovery.WellKnownResponse, string, error) {
+	disc, err := r.ResolveDiscovery(domain)
+	if err != nil {
+		return nil, "", err
+	}
+	return disc, SourceBundle, nil
+}
+
 // ResolveRevocation looks up revocation in the bundle.
 func (r *TrustBundleResolver) ResolveRevocation(domain string, disc *discovery.WellKnownResponse) (*revocation.RevocationDocument, error) {
 	return r.bundle.FindRevocation(domain), nil
 }
 
 // ChainResolver tries multiple resolvers in order, returning the first success.
+//
+// Only ErrNotFound falls through to the next resolver; any other error (a
+// malformed bundle entry, a TLS failure on live discovery, ...) stops the
+// chain and is returned as-is so misconfiguration is not masked.
 type ChainResolver struct {
 	resolvers []SchemaResolver
 }
@@ -141,20 +251,36 @@ func NewChainResolver(resolvers []SchemaResolver) *ChainResolver {
 	return &ChainResolver{resolvers: resolvers}
 }
 
+// Chain is a variadic convenience for NewChainResolver, e.g.
+// Chain(NewTrustBundleResolver(b), NewCachingResolver(NewWellKnownResolver(), time.Hour)).
+func Chain(resolvers ...SchemaResolver) *ChainResolver {
+	return NewChainResolver(resolvers)
+}
+
 // ResolveDiscovery tries each resolver in order.
 func (r *ChainResolver) ResolveDiscovery(domain string) (*discovery.WellKnownResponse, error) {
+	disc, _, err := r.ResolveDiscoveryWithSource(domain)
+	return disc, err
+}
+
+// ResolveDiscoveryWithSource implements SourcedResolver, reporting the source
+// of whichever resolver answered.
+func (r *ChainResolver) ResolveDiscoveryWithSource(domain string) (*discovery.WellKnownResponse, string, error) {
 	var lastErr error
 	for _, resolver := range r.resolvers {
-		disc, err := resolver.ResolveDiscovery(domain)
+		disc, source, err := ResolveDiscoveryWithSource(resolver, domain)
 		if err == nil {
-			return disc, nil
+			return disc, source, nil
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return nil, "", err
 		}
 		lastErr = err
 	}
 	if lastErr != nil {
-		return nil, lastErr
+		return nil, "", lastErr
 	}
-	return nil, fmt.Errorf("no resolvers available")
+	return nil, "", newNotFoundError("no resolvers available")
 }
 
 // ResolveRevocation tries each resolver in order.
@@ -167,3 +293,106 @@ func (r *ChainResolver) ResolveRevocation(domain string, disc *discovery.WellKno
 	}
 	return nil, nil
 }
+
+// CachingResolver memoizes successful lookups of an inner resolver for a TTL.
+// Failed lookups are never cached. Safe for concurrent use.
+type CachingResolver struct {
+	inner SchemaResolver
+	ttl   time.Duration
+	clock clock.Clock
+
+	mu          sync.Mutex
+	discoveries map[string]cachedDiscovery
+	revocations map[string]cachedRevocation
+}
+
+type cachedDiscovery struct {
+	disc      *discovery.WellKnownResponse
+	expiresAt time.Time
+}
+
+type cachedRevocation struct {
+	doc       *revocation.RevocationDocument
+	expiresAt time.Time
+}
+
+// CachingOption configures a CachingResolver.
+type CachingOption func(*CachingResolver)
+
+// WithClock sets the time source used to expire cache entries. The default
+// is clock.Real.
+func WithClock(c clock.Clock) CachingOption {
+	return func(r *CachingResolver) {
+		r.clock = clock.OrReal(c)
+	}
+}
+
+// NewCachingResolver wraps inner so successful lookups are reused for ttl.
+func NewCachingResolver(inner SchemaResolver, ttl time.Duration, opts ...CachingOption) *CachingResolver {
+	r := &CachingResolver{
+		inner:       inner,
+		ttl:         ttl,
+		clock:       clock.Real,
+		discoveries: make(map[string]cachedDiscovery),
+		revocations: make(map[string]cachedRevocation),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// ResolveDiscovery returns a cached discovery document or consults the inner resolver.
+func (r *CachingResolver) ResolveDiscovery(domain string) (*discovery.WellKnownResponse, error) {
+	disc, _, err := r.ResolveDiscoveryWithSource(domain)
+	return disc, err
+}
+
+// ResolveDiscoveryWithSource implements SourcedResolver. Cache hits report
+// SourceCache; misses report the inner resolver's source.
+func (r *CachingResolver) ResolveDiscoveryWithSource(domain string) (*discovery.WellKnownResponse, string, error) {
+	r.mu.Lock()
+	entry, ok := r.discoveries[domain]
+	r.mu.Unlock()
+	if ok && r.clock.Now().Before(entry.expiresAt) {
+		return entry.disc, SourceCache, nil
+	}
+
+	disc, source, err := ResolveDiscoveryWithSource(r.inner, domain)
+	if err != nil {
+		return nil, "", err
+	}
+
+	r.mu.Lock()
+	r.discoveries[domain] = cachedDiscovery{disc: disc, expiresAt: r.clock.Now().Add(r.ttl)}
+	r.mu.Unlock()
+	return disc, source, nil
+}
+
+// ResolveRevocation returns a cached revocation document or consults the inner resolver.
+func (r *CachingResolver) ResolveRevocation(domain string, disc *discovery.WellKnownResponse) (*revocation.RevocationDocument, error) {
+	r.mu.Lock()
+	entry, ok := r.revocations[domain]
+	r.mu.Unlock()
+	if ok && r.clock.Now().Before(entry.expiresAt) {
+		return entry.doc, nil
+	}
+
+	doc, err := r.inner.ResolveRevocation(domain, disc)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	r.revocations[domain] = cachedRevocation{doc: doc, expiresAt: r.clock.Now().Add(r.ttl)}
+	r.mu.Unlock()
+	return doc, nil
+}
+
+// Invalidate drops any cached entries for domain.
+func (r *CachingResolver) Invalidate(domain string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.discoveries, domain)
+	delete(r.revocations, domain)
+}
@@ -2,11 +2,17 @@ package resolver
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/ThirdKeyAi/schemapin/go/pkg/bundle"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/revocation"
 )
@@ -84,6 +90,32 @@ func TestTrustBundleResolverFromJSON(t *testing.T) {
 	}
 }
 
+func TestTrustBundleResolverFromBytes(t *testing.T) {
+	b := makeBundle()
+	jsonData, err := json.Marshal(b)
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+
+	for name, data := range map[string][]byte{"json": jsonData, "compact": bundle.EncodeCompact(b)} {
+		resolver, err := FromBytes(data)
+		if err != nil {
+			t.Fatalf("%s: failed to create resolver: %v", name, err)
+		}
+		disc, err := resolver.ResolveDiscovery("example.com")
+		if err != nil || disc.DeveloperName != "Test Dev" {
+			t.Errorf("%s: expected Test Dev, got %+v (%v)", name, disc, err)
+		}
+		rev, err := resolver.ResolveRevocation("example.com", disc)
+		if err != nil || rev == nil || len(rev.RevokedKeys) != 1 {
+			t.Errorf("%s: expected one revoked key, got %+v (%v)", name, rev, err)
+		}
+		if _, err := resolver.ResolveDiscovery("unknown.com"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: expected ErrNotFound for an unknown domain, got %v", name, err)
+		}
+	}
+}
+
 func TestLocalFileResolverDiscovery(t *testing.T) {
 	tmpDir := t.TempDir()
 	wellKnown := discovery.WellKnownResponse{
@@ -229,3 +261,159 @@ func TestChainResolverAllMiss(t *testing.T) {
 		t.Error("expected error when all resolvers miss")
 	}
 }
+
+// errResolver always fails discovery with a fixed error.
+type errResolver struct {
+	err   error
+	calls int
+}
+
+func (r *errResolver) ResolveDiscovery(domain string) (*discovery.WellKnownResponse, error) {
+	r.calls++
+	return nil, r.err
+}
+
+func (r *errResolver) ResolveRevocation(domain string, disc *discovery.WellKnownResponse) (*revocation.RevocationDocument, error) {
+	return nil, nil
+}
+
+// countingResolver serves a fixed discovery document and counts lookups.
+type countingResolver struct {
+	disc  *discovery.WellKnownResponse
+	calls int
+}
+
+func (r *countingResolver) ResolveDiscovery(domain string) (*discovery.WellKnownResponse, error) {
+	r.calls++
+	return r.disc, nil
+}
+
+func (r *countingResolver) ResolveRevocation(domain string, disc *discovery.WellKnownResponse) (*revocation.RevocationDocument, error) {
+	return nil, nil
+}
+
+func (r *countingResolver) ResolveDiscoveryWithSource(domain string) (*discovery.WellKnownResponse, string, error) {
+	disc, err := r.ResolveDiscovery(domain)
+	return disc, SourceLive, err
+}
+
+func TestTrustBundleResolverMissIsNotFound(t *testing.T) {
+	_, err := NewTrustBundleResolver(makeBundle()).ResolveDiscovery("unknown.com")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestLocalFileResolverMissingIsNotFound(t *testing.T) {
+	_, err := NewLocalFileResolver(t.TempDir(), "").ResolveDiscovery("missing.com")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestWellKnownResolverNotFound(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	_, err := NewWellKnownResolver().ResolveDiscovery(server.URL)
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for 404, got %v", err)
+	}
+}
+
+func TestWellKnownResolverServerErrorIsHard(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	_, err := NewWellKnownResolver().ResolveDiscovery(server.URL)
+	if err == nil || errors.Is(err, ErrNotFound) {
+		t.Errorf("expected hard error for 500, got %v", err)
+	}
+}
+
+func TestChainResolverReportsSource(t *testing.T) {
+	live := &countingResolver{disc: &discovery.WellKnownResponse{SchemaVersion: "1.2", DeveloperName: "Live"}}
+	chain := Chain(NewTrustBundleResolver(makeBundle()), live)
+
+	disc, source, err := ResolveDiscoveryWithSource(chain, "example.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if source != SourceBundle || disc.DeveloperName != "Test Dev" {
+		t.Errorf("expected bundle hit, got source=%q dev=%q", source, disc.DeveloperName)
+	}
+	if live.calls != 0 {
+		t.Errorf("live resolver should not be consulted on bundle hit, got %d calls", live.calls)
+	}
+
+	disc, source, err = ResolveDiscoveryWithSource(chain, "other.com")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if source != SourceLive || disc.DeveloperName != "Live" {
+		t.Errorf("expected live fallback, got source=%q dev=%q", source, disc.DeveloperName)
+	}
+}
+
+func TestChainResolverHardErrorStopsChain(t *testing.T) {
+	hard := &errResolver{err: fmt.Errorf("tls handshake failed")}
+	next := &countingResolver{disc: &discovery.WellKnownResponse{SchemaVersion: "1.2"}}
+	chain := Chain(hard, next)
+
+	_, err := chain.ResolveDiscovery("example.com")
+	if err == nil || err.Error() != "tls handshake failed" {
+		t.Fatalf("expected hard error to propagate, got %v", err)
+	}
+	if next.calls != 0 {
+		t.Errorf("expected chain to stop on hard error, next resolver called %d times", next.calls)
+	}
+}
+
+func TestChainResolverEmptyIsNotFound(t *testing.T) {
+	_, err := Chain().ResolveDiscovery("example.com")
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound from empty chain, got %v", err)
+	}
+}
+
+func TestCachingResolverMemoizesUntilTTL(t *testing.T) {
+	inner := &countingResolver{disc: &discovery.WellKnownResponse{SchemaVersion: "1.2"}}
+	fake := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	cache := NewCachingResolver(inner, time.Minute, WithClock(fake))
+
+	if _, source, _ := cache.ResolveDiscoveryWithSource("example.com"); source != SourceLive {
+		t.Errorf("expected first lookup from live, got %q", source)
+	}
+	if _, source, _ := cache.ResolveDiscoveryWithSource("example.com"); source != SourceCache {
+		t.Errorf("expected second lookup from cache, got %q", source)
+	}
+	if inner.calls != 1 {
+		t.Errorf("expected 1 inner call, got %d", inner.calls)
+	}
+
+	fake.Advance(59 * time.Second)
+	if _, source, _ := cache.ResolveDiscoveryWithSource("example.com"); source != SourceCache {
+		t.Errorf("expected lookup just before TTL from cache, got %q", source)
+	}
+
+	fake.Advance(time.Second)
+	if _, source, _ := cache.ResolveDiscoveryWithSource("example.com"); source != SourceLive {
+		t.Errorf("expected refetch after TTL, got %q", source)
+	}
+	if inner.calls != 2 {
+		t.Errorf("expected 2 inner calls after expiry, got %d", inner.calls)
+	}
+}
+
+func TestCachingResolverDoesNotCacheFailures(t *testing.T) {
+	inner := &errResolver{err: fmt.Errorf("connection refused")}
+	cache := NewCachingResolver(inner, time.Minute)
+
+	_, _ = cache.ResolveDiscovery("example.com")
+	_, _ = cache.ResolveDiscovery("example.com")
+	if inner.calls != 2 {
+		t.Errorf("expected failures to be retried, got %d inner calls", inner.calls)
+	}
+}
@@ -0,0 +1,232 @@
+package revocation
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// StartSequence makes doc a sequenced document, so that it can be served
+// with delta updates: from then on every entry added advances Sequence and
+// is stamped with it. Entries already in doc keep sequence zero and are
+// only served in full documents. It does nothing to a sequenced document.
+func StartSequence(doc *RevocationDocument) {
+	if doc.Sequence == 0 {
+		doc.Sequence = 1
+	}
+}
+
+// nextSequence advances the sequence of a sequenced document and returns
+// it, or returns zero for a document that is not sequenced.
+func (doc *RevocationDocument) nextSequence() uint64 {
+	if doc.Sequence == 0 {
+		return 0
+	}
+	doc.Sequence++
+	return doc.Sequence
+}
+
+// Delta returns the entries of doc added after sequence since, as a
+// document with Since set. A client holding doc as of since merges it with
+// MergeDelta. since must be between 1 and doc.Sequence; for any other
+// value the full document is the only valid answer.
+func Delta(doc *RevocationDocument, since uint64) *RevocationDocument {
+	delta := &RevocationDocument{
+		SchemapinVersion: doc.SchemapinVersion,
+		Domain:           doc.Domain,
+		UpdatedAt:        doc.UpdatedAt,
+		RevokedKeys:      []RevokedKey{},
+		Sequence:         doc.Sequence,
+		Since:            since,
+	}
+	for _, key := range doc.RevokedKeys {
+		if key.Sequence > since {
+			delta.RevokedKeys = append(delta.RevokedKeys, key)
+		}
+	}
+	for _, sig := range doc.RevokedSignatures {
+		if sig.Sequence > since {
+			delta.RevokedSignatures = append(delta.RevokedSignatures, sig)
+		}
+	}
+	return delta
+}
+
+// MergeDelta returns a copy of base with the entries of delta added,
+// skipping fingerprints and schema hashes base already revokes. The delta
+// must be for base's domain and continue from a sequence base has reached.
+// base is not modified.
+func MergeDelta(base, delta *RevocationDocument) (*RevocationDocument, error) {
+	if base.Domain != "" && delta.Domain != "" && base.Domain != delta.Domain {
+		return nil, fmt.Errorf("revocation delta is for domain %s, cached document for %s", delta.Domain, base.Domain)
+	}
+	if delta.Since > base.Sequence {
+		return nil, fmt.Errorf("revocation delta since sequence %d does not continue cached sequence %d", delta.Since, base.Sequence)
+	}
+	if delta.Sequence < base.Sequence {
+		return nil, fmt.Errorf("revocation delta at sequence %d is older than cached sequence %d", delta.Sequence, base.Sequence)
+	}
+
+	merged := *base
+	merged.RevokedKeys = append([]RevokedKey{}, base.RevokedKeys...)
+	merged.RevokedSignatures = append([]RevokedSignature(nil), base.RevokedSignatures...)
+	for _, key := range delta.RevokedKeys {
+		if CheckRevocation(&merged, key.Fingerprint) == nil {
+			merged.RevokedKeys = append(merged.RevokedKeys, key)
+		}
+	}
+	for _, sig := range delta.RevokedSignatures {
+		if CheckSignatureRevocation(&merged, sig.SchemaHash) == nil {
+			merged.RevokedSignatures = append(merged.RevokedSignatures, sig)
+		}
+	}
+	merged.Sequence = delta.Sequence
+	merged.Since = 0
+	if delta.UpdatedAt != "" {
+		merged.UpdatedAt = delta.UpdatedAt
+	}
+	return &merged, nil
+}
+
+// sequenceETag is the entity tag of a document at sequence.
+func sequenceETag(sequence uint64) string {
+	return `"` + strconv.FormatUint(sequence, 10) + `"`
+}
+
+// withSince adds the since query parameter to rawURL.
+func withSince(rawURL string, since uint64) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	query := u.Query()
+	query.Set("since", strconv.FormatUint(since, 10))
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// NewHandler serves the document returned by source at a revocation
+// endpoint. A sequenced document is served with an ETag of its sequence.
+// A request with ?since=N, or an If-None-Match of an earlier sequence, is
+// answered with only the entries added after N (see Delta), and one that
+// is already current with 304 Not Modified. Anything else gets the full
+// document.
+func NewHandler(source func() *RevocationDocument) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var since uint64
+		if raw := r.URL.Query().Get("since"); raw != "" {
+			n, err := strconv.ParseUint(raw, 10, 64)
+			if err != nil {
+				http.Error(w, "invalid since parameter", http.StatusBadRequest)
+				return
+			}
+			since = n
+		}
+
+		doc := source()
+		body := doc
+		if doc.Sequence > 0 {
+			etag := sequenceETag(doc.Sequence)
+			w.Header().Set("ETag", etag)
+			if since == 0 {
+				since, _ = strconv.ParseUint(trimETag(r.Header.Get("If-None-Match")), 10, 64)
+			}
+			switch {
+			case since == doc.Sequence:
+				w.WriteHeader(http.StatusNotModified)
+				return
+			case since > 0 && since < doc.Sequence:
+				body = Delta(doc, since)
+			}
+		}
+
+		data, err := json.Marshal(body)
+		if err != nil {
+			http.Error(w, "failed to encode revocation document", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	})
+}
+
+// trimETag strips the quotes and weak prefix of an entity tag.
+func trimETag(etag string) string {
+	if len(etag) > 2 && etag[:2] == "W/" {
+		etag = etag[2:]
+	}
+	if len(etag) >= 2 && etag[0] == '"' && etag[len(etag)-1] == '"' {
+		etag = etag[1 : len(etag)-1]
+	}
+	return etag
+}
+
+// Cache holds the revocation documents fetched from revocation endpoints,
+// keyed by endpoint URL, so that later fetches only transfer what changed.
+// pinning.KeyPinning implements it in the pinning database.
+type Cache interface {
+	// LoadRevocationDocument returns the document cached for url, or nil.
+	LoadRevocationDocument(url string) (*RevocationDocument, error)
+	// StoreRevocationDocument replaces the document cached for url.
+	StoreRevocationDocument(url string, doc *RevocationDocument) error
+}
+
+// CachedDocument is a revocation document held by a Cache, with the
+// endpoint URL it was fetched from.
+type CachedDocument struct {
+	URL      string              `json:"url"`
+	Document *RevocationDocument `json:"document"`
+}
+
+// Lister is implemented by caches that can list the documents they hold,
+// e.g. to report what is known about a domain.
+type Lister interface {
+	// ListRevocationDocuments returns every cached document, ordered by
+	// URL.
+	ListRevocationDocuments() ([]CachedDocument, error)
+}
+
+// memoryCache is a Cache that lasts as long as the process.
+type memoryCache struct {
+	mu   sync.Mutex
+	docs map[string]*RevocationDocument
+}
+
+// NewMemoryCache returns a Cache kept in memory, which also implements
+// Lister. It is safe for concurrent use.
+func NewMemoryCache() Cache {
+	return &memoryCache{docs: make(map[string]*RevocationDocument)}
+}
+
+func (c *memoryCache) LoadRevocationDocument(url string) (*RevocationDocument, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.docs[url], nil
+}
+
+func (c *memoryCache) StoreRevocationDocument(url string, doc *RevocationDocument) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.docs[url] = doc
+	return nil
+}
+
+func (c *memoryCache) ListRevocationDocuments() ([]CachedDocument, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached := make([]CachedDocument, 0, len(c.docs))
+	for url, doc := range c.docs {
+		cached = append(cached, CachedDocument{URL: url, Document: doc})
+	}
+	sort.Slice(cached, func(i, j int) bool { return cached[i].URL < cached[j].URL })
+	return cached, nil
+}
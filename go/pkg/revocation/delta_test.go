@@ -0,0 +1,162 @@
+package revocation
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStartSequence(t *testing.T) {
+	doc := BuildRevocationDocument("example.com")
+	AddRevokedKey(doc, "sha256:aaa", ReasonSuperseded)
+	if doc.Sequence != 0 || doc.RevokedKeys[0].Sequence != 0 {
+		t.Fatalf("Expected an unsequenced document, got %+v", doc)
+	}
+
+	StartSequence(doc)
+	AddRevokedKey(doc, "sha256:bbb", ReasonKeyCompromise)
+	AddRevokedSignature(doc, "sha256:ccc", ReasonSuperseded)
+	if doc.Sequence != 3 || doc.RevokedKeys[1].Sequence != 2 || doc.RevokedSignatures[0].Sequence != 3 {
+		t.Errorf("Expected entries stamped 2 and 3, got %+v", doc)
+	}
+	StartSequence(doc)
+	if doc.Sequence != 3 {
+		t.Errorf("Expected StartSequence to keep sequence 3, got %d", doc.Sequence)
+	}
+}
+
+func TestDeltaAndMergeDelta(t *testing.T) {
+	doc := BuildRevocationDocument("example.com")
+	AddRevokedKey(doc, "sha256:aaa", ReasonSuperseded)
+	StartSequence(doc)
+	AddRevokedKey(doc, "sha256:bbb", ReasonSuperseded)
+	cached := *doc
+	cached.RevokedKeys = append([]RevokedKey{}, doc.RevokedKeys...)
+
+	AddRevokedKey(doc, "sha256:ccc", ReasonKeyCompromise)
+	AddRevokedSignature(doc, "sha256:ddd", ReasonSuperseded)
+	delta := Delta(doc, cached.Sequence)
+	if delta.Since != 2 || delta.Sequence != 4 || len(delta.RevokedKeys) != 1 || len(delta.RevokedSignatures) != 1 {
+		t.Fatalf("Expected one key and one signature since 2, got %+v", delta)
+	}
+
+	merged, err := MergeDelta(&cached, delta)
+	if err != nil {
+		t.Fatalf("MergeDelta failed: %v", err)
+	}
+	if !reflect.DeepEqual(merged, doc) {
+		t.Errorf("Expected the merged document to equal the full one:\n got %+v\nwant %+v", merged, doc)
+	}
+	if len(cached.RevokedKeys) != 2 {
+		t.Errorf("Expected MergeDelta to leave the base alone, got %+v", cached.RevokedKeys)
+	}
+
+	// Merging the same delta again adds nothing
+	again, err := MergeDelta(merged, delta)
+	if err != nil || len(again.RevokedKeys) != 3 || len(again.RevokedSignatures) != 1 {
+		t.Errorf("Expected no duplicates, got %+v, %v", again, err)
+	}
+}
+
+func TestMergeDeltaRejectsMismatches(t *testing.T) {
+	base := &RevocationDocument{Domain: "example.com", Sequence: 5, RevokedKeys: []RevokedKey{}}
+	tests := []struct {
+		name  string
+		delta *RevocationDocument
+		want  string
+	}{
+		{"gap", &RevocationDocument{Domain: "example.com", Since: 7, Sequence: 9}, "does not continue"},
+		{"older", &RevocationDocument{Domain: "example.com", Since: 3, Sequence: 4}, "older"},
+		{"domain", &RevocationDocument{Domain: "other.com", Since: 5, Sequence: 6}, "other.com"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := MergeDelta(base, tt.delta); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Expected an error mentioning %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestFetchRevocationUpdate(t *testing.T) {
+	doc := BuildRevocationDocument("example.com")
+	StartSequence(doc)
+	AddRevokedKey(doc, "sha256:aaa", ReasonSuperseded)
+
+	var queries []string
+	handler := NewHandler(func() *RevocationDocument { return doc })
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries = append(queries, r.URL.RawQuery)
+		handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	// Initial full fetch
+	cached, err := FetchRevocationUpdate(ctx, server.URL, nil)
+	if err != nil || cached.Sequence != 2 || len(cached.RevokedKeys) != 1 {
+		t.Fatalf("Expected the full document, got %+v, %v", cached, err)
+	}
+
+	// Unchanged
+	unchanged, err := FetchRevocationUpdate(ctx, server.URL, cached)
+	if err != nil || unchanged != cached {
+		t.Fatalf("Expected the cached document back, got %+v, %v", unchanged, err)
+	}
+
+	// Delta merge
+	AddRevokedKey(doc, "sha256:bbb", ReasonKeyCompromise)
+	updated, err := FetchRevocationUpdate(ctx, server.URL, cached)
+	if err != nil || updated.Sequence != 3 || CheckRevocation(updated, "sha256:bbb") == nil || CheckRevocation(updated, "sha256:aaa") == nil {
+		t.Fatalf("Expected both keys revoked at sequence 3, got %+v, %v", updated, err)
+	}
+
+	if want := []string{"", "since=2", "since=2"}; !reflect.DeepEqual(queries, want) {
+		t.Errorf("Expected queries %q, got %q", want, queries)
+	}
+}
+
+func TestNewHandler(t *testing.T) {
+	doc := BuildRevocationDocument("example.com")
+	StartSequence(doc)
+	AddRevokedKey(doc, "sha256:aaa", ReasonSuperseded)
+	AddRevokedKey(doc, "sha256:bbb", ReasonSuperseded)
+	handler := NewHandler(func() *RevocationDocument { return doc })
+
+	tests := []struct {
+		name        string
+		query       string
+		ifNoneMatch string
+		wantStatus  int
+		wantBody    string
+	}{
+		{"full", "", "", http.StatusOK, `"sha256:aaa"`},
+		{"delta", "?since=2", "", http.StatusOK, `"since":2`},
+		{"current", "?since=3", "", http.StatusNotModified, ""},
+		{"etag", "", `"3"`, http.StatusNotModified, ""},
+		{"ahead", "?since=9", "", http.StatusOK, `"sha256:aaa"`},
+		{"invalid", "?since=x", "", http.StatusBadRequest, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/revocations.json"+tt.query, nil)
+			if tt.ifNoneMatch != "" {
+				req.Header.Set("If-None-Match", tt.ifNoneMatch)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			if recorder.Code != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d", tt.wantStatus, recorder.Code)
+			}
+			if !strings.Contains(recorder.Body.String(), tt.wantBody) {
+				t.Errorf("Expected body containing %s, got %s", tt.wantBody, recorder.Body.String())
+			}
+			if tt.wantStatus != http.StatusBadRequest && recorder.Header().Get("ETag") != `"3"` {
+				t.Errorf(`Expected ETag "3", got %q`, recorder.Header().Get("ETag"))
+			}
+		})
+	}
+}
@@ -4,9 +4,17 @@ package revocation
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/internal/version"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/requestid"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
 )
 
 // RevocationReason represents why a key was revoked.
@@ -24,14 +32,37 @@ type RevokedKey struct {
 	Fingerprint string           `json:"fingerprint"`
 	RevokedAt   string           `json:"revoked_at"`
 	Reason      RevocationReason `json:"reason"`
+	// Sequence is the document sequence the entry was added at, or zero
+	// for entries added before the document was sequenced.
+	Sequence uint64 `json:"sequence,omitempty"`
+}
+
+// RevokedSignature represents a single revoked schema signature. The key
+// that produced it remains trusted for every other schema.
+type RevokedSignature struct {
+	// SchemaHash is sha256:<hex> of the schema's canonical form.
+	SchemaHash string           `json:"schema_hash"`
+	RevokedAt  string           `json:"revoked_at"`
+	Reason     RevocationReason `json:"reason"`
+	// Sequence is the document sequence the entry was added at, or zero
+	// for entries added before the document was sequenced.
+	Sequence uint64 `json:"sequence,omitempty"`
 }
 
 // RevocationDocument represents a standalone revocation document.
 type RevocationDocument struct {
-	SchemapinVersion string       `json:"schemapin_version"`
-	Domain           string       `json:"domain"`
-	UpdatedAt        string       `json:"updated_at"`
-	RevokedKeys      []RevokedKey `json:"revoked_keys"`
+	SchemapinVersion  string             `json:"schemapin_version"`
+	Domain            string             `json:"domain"`
+	UpdatedAt         string             `json:"updated_at"`
+	RevokedKeys       []RevokedKey       `json:"revoked_keys"`
+	RevokedSignatures []RevokedSignature `json:"revoked_signatures,omitempty"`
+	// Sequence increases with every entry added to a sequenced document
+	// (see StartSequence), so clients can ask for only what changed. It is
+	// zero for documents that are always served whole.
+	Sequence uint64 `json:"sequence,omitempty"`
+	// Since is set on a delta (see Delta) to the sequence it continues
+	// from; the delta holds only the entries added after it.
+	Since uint64 `json:"since,omitempty"`
 }
 
 // BuildRevocationDocument creates an empty revocation document for a domain.
@@ -39,18 +70,34 @@ func BuildRevocationDocument(domain string) *RevocationDocument {
 	return &RevocationDocument{
 		SchemapinVersion: "1.2",
 		Domain:           domain,
-		UpdatedAt:        time.Now().UTC().Format(time.RFC3339),
+		UpdatedAt:        clock.Format(time.Now()),
 		RevokedKeys:      []RevokedKey{},
 	}
 }
 
-// AddRevokedKey adds a revoked key entry to the document.
+// AddRevokedKey adds a revoked key entry to the document. In a sequenced
+// document the entry is stamped with the next sequence.
 func AddRevokedKey(doc *RevocationDocument, fingerprint string, reason RevocationReason) {
-	now := time.Now().UTC().Format(time.RFC3339)
+	now := clock.Format(time.Now())
 	doc.RevokedKeys = append(doc.RevokedKeys, RevokedKey{
 		Fingerprint: fingerprint,
 		RevokedAt:   now,
 		Reason:      reason,
+		Sequence:    doc.nextSequence(),
+	})
+	doc.UpdatedAt = now
+}
+
+// AddRevokedSignature adds a revoked signature entry for the schema with the
+// given canonical hash (sha256:<hex>) to the document. In a sequenced
+// document the entry is stamped with the next sequence.
+func AddRevokedSignature(doc *RevocationDocument, schemaHash string, reason RevocationReason) {
+	now := clock.Format(time.Now())
+	doc.RevokedSignatures = append(doc.RevokedSignatures, RevokedSignature{
+		SchemaHash: schemaHash,
+		RevokedAt:  now,
+		Reason:     reason,
+		Sequence:   doc.nextSequence(),
 	})
 	doc.UpdatedAt = now
 }
@@ -58,7 +105,7 @@ func AddRevokedKey(doc *RevocationDocument, fingerprint string, reason Revocatio
 // CheckRevocation checks if a fingerprint is revoked in the standalone document.
 func CheckRevocation(doc *RevocationDocument, fingerprint string) error {
 	for _, key := range doc.RevokedKeys {
-		if key.Fingerprint == fingerprint {
+		if crypto.FingerprintEqual(key.Fingerprint, fingerprint) {
 			return fmt.Errorf("key %s is revoked: %s", fingerprint, key.Reason)
 		}
 	}
@@ -68,7 +115,7 @@ func CheckRevocation(doc *RevocationDocument, fingerprint string) error {
 // CheckRevocationCombined checks revocation against both simple list and standalone document.
 func CheckRevocationCombined(simpleRevoked []string, doc *RevocationDocument, fingerprint string) error {
 	for _, revoked := range simpleRevoked {
-		if revoked == fingerprint {
+		if crypto.FingerprintEqual(revoked, fingerprint) {
 			return fmt.Errorf("key %s is in simple revocation list", fingerprint)
 		}
 	}
@@ -80,29 +127,133 @@ func CheckRevocationCombined(simpleRevoked []string, doc *RevocationDocument, fi
 	return nil
 }
 
-// FetchRevocationDocument fetches a standalone revocation document from a URL.
-func FetchRevocationDocument(ctx context.Context, url string) (*RevocationDocument, error) {
-	client := &http.Client{Timeout: 10 * time.Second}
+// CheckSignatureRevocation checks if the signature over the schema with the
+// given canonical hash (sha256:<hex>) is revoked. A nil document revokes
+// nothing.
+func CheckSignatureRevocation(doc *RevocationDocument, schemaHash string) error {
+	if doc == nil {
+		return nil
+	}
+	for _, sig := range doc.RevokedSignatures {
+		if sig.SchemaHash == schemaHash {
+			return fmt.Errorf("signature for schema %s is revoked: %s", schemaHash, sig.Reason)
+		}
+	}
+	return nil
+}
+
+// FetchOption configures FetchRevocationDocument and FetchRevocationUpdate.
+type FetchOption func(*fetchConfig)
+
+type fetchConfig struct {
+	userAgent string
+	client    *http.Client
+	maxBytes  int64
+}
+
+// DefaultMaxDocumentBytes caps the size of a fetched revocation document.
+const DefaultMaxDocumentBytes = 1 << 20
+
+// WithUserAgent sets the User-Agent of the request, e.g. to the discovery
+// client's so that both requests of a verification identify the same
+// embedder. The default is schemapin-go/<version>.
+func WithUserAgent(userAgent string) FetchOption {
+	return func(c *fetchConfig) {
+		if userAgent != "" {
+			c.userAgent = userAgent
+		}
+	}
+}
+
+// WithHTTPClient makes the request with client, e.g. the discovery
+// client's so that its timeout, redirect policy and TLS pins apply. The
+// default is a client with a 10 second timeout.
+func WithHTTPClient(client *http.Client) FetchOption {
+	return func(c *fetchConfig) {
+		if client != nil {
+			c.client = client
+		}
+	}
+}
+
+// WithMaxBytes caps the size of the document read (default
+// DefaultMaxDocumentBytes). A larger response fails with
+// schemaerr.ErrDiscoveryResponseTooLarge after at most n bytes are read.
+func WithMaxBytes(n int64) FetchOption {
+	return func(c *fetchConfig) {
+		if n > 0 {
+			c.maxBytes = n
+		}
+	}
+}
+
+// FetchRevocationDocument fetches a standalone revocation document from a
+// URL. The request carries the request ID of ctx, if any, in the
+// X-SchemaPin-Request-ID header (see package requestid).
+func FetchRevocationDocument(ctx context.Context, url string, opts ...FetchOption) (*RevocationDocument, error) {
+	return FetchRevocationUpdate(ctx, url, nil, opts...)
+}
+
+// FetchRevocationUpdate brings cached, a document previously fetched from
+// url, up to date. For a sequenced cached document it asks only for what
+// changed since its sequence: an unchanged document is answered with 304
+// and cached is returned as is, and a delta is merged into a copy of
+// cached with MergeDelta. Otherwise, and when cached is nil, the full
+// document is fetched.
+func FetchRevocationUpdate(ctx context.Context, url string, cached *RevocationDocument, opts ...FetchOption) (*RevocationDocument, error) {
+	config := fetchConfig{userAgent: version.UserAgent(), maxBytes: DefaultMaxDocumentBytes}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	client := config.client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
 
+	if cached != nil && cached.Sequence > 0 {
+		url = withSince(url, cached.Sequence)
+	}
 	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
+	req.Header.Set("User-Agent", config.userAgent)
+	if cached != nil && cached.Sequence > 0 {
+		req.Header.Set("If-None-Match", sequenceETag(cached.Sequence))
+	}
+	requestid.SetHeader(req)
 
 	resp, err := client.Do(req) // #nosec G704 -- URL is from discovery document's revocation_endpoint
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch revocation document: %w", err)
 	}
-	defer resp.Body.Close()
+	defer func() {
+		// Drain the body so that the connection can be reused
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+		_ = resp.Body.Close()
+	}()
 
+	if resp.StatusCode == http.StatusNotModified && cached != nil && cached.Sequence > 0 {
+		return cached, nil
+	}
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
 	var doc RevocationDocument
-	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+	if err := json.NewDecoder(http.MaxBytesReader(nil, resp.Body, config.maxBytes)).Decode(&doc); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, &schemaerr.Error{Kind: schemaerr.ErrDiscoveryResponseTooLarge,
+				Err: fmt.Errorf("revocation document exceeds %d bytes: %w", tooLarge.Limit, err)}
+		}
 		return nil, fmt.Errorf("failed to decode revocation document: %w", err)
 	}
-
-	return &doc, nil
+	if doc.Since == 0 {
+		return &doc, nil
+	}
+	if cached == nil {
+		return nil, fmt.Errorf("received a revocation delta since sequence %d without a cached document", doc.Since)
+	}
+	return MergeDelta(cached, &doc)
 }
@@ -1,8 +1,17 @@
 package revocation
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+
+	"github.com/ThirdKeyAi/schemapin/go/internal/version"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/requestid"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
 )
 
 func TestBuildRevocationDocument(t *testing.T) {
@@ -66,6 +75,18 @@ func TestCheckRevocationRevoked(t *testing.T) {
 	}
 }
 
+func TestCheckRevocationNormalizesFingerprint(t *testing.T) {
+	doc := BuildRevocationDocument("example.com")
+	AddRevokedKey(doc, "sha256:ABC123", ReasonKeyCompromise)
+
+	if err := CheckRevocation(doc, " sha256:abc123"); err == nil {
+		t.Error("expected error for revoked key in another case")
+	}
+	if err := CheckRevocationCombined([]string{"SHA256:DEF456"}, nil, "sha256:def456"); err == nil {
+		t.Error("expected error for key in simple list in another case")
+	}
+}
+
 func TestCheckRevocationEmptyDoc(t *testing.T) {
 	doc := BuildRevocationDocument("example.com")
 	if err := CheckRevocation(doc, "sha256:anything"); err != nil {
@@ -150,3 +171,79 @@ func TestDocumentJSONRoundtrip(t *testing.T) {
 		t.Errorf("expected reason superseded, got %s", restored.RevokedKeys[1].Reason)
 	}
 }
+
+func TestRevokedSignatures(t *testing.T) {
+	doc := BuildRevocationDocument("example.com")
+	if err := CheckSignatureRevocation(doc, "sha256:aaa"); err != nil {
+		t.Errorf("expected no revocation, got %v", err)
+	}
+
+	AddRevokedSignature(doc, "sha256:aaa", ReasonSuperseded)
+	if len(doc.RevokedSignatures) != 1 || doc.RevokedSignatures[0].RevokedAt == "" {
+		t.Fatalf("expected one dated entry, got %+v", doc.RevokedSignatures)
+	}
+	if err := CheckSignatureRevocation(doc, "sha256:aaa"); err == nil {
+		t.Error("expected signature to be revoked")
+	}
+	if err := CheckSignatureRevocation(doc, "sha256:bbb"); err != nil {
+		t.Errorf("expected other schema unaffected, got %v", err)
+	}
+	if err := CheckSignatureRevocation(nil, "sha256:aaa"); err != nil {
+		t.Errorf("expected nil doc to revoke nothing, got %v", err)
+	}
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed RevocationDocument
+	if err := json.Unmarshal(data, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed.RevokedSignatures) != 1 || parsed.RevokedSignatures[0].SchemaHash != "sha256:aaa" {
+		t.Errorf("expected revoked_signatures to round-trip, got %s", data)
+	}
+}
+
+func TestFetchRevocationDocumentSendsTraceHeaders(t *testing.T) {
+	var userAgent, requestID string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgent, requestID = r.Header.Get("User-Agent"), r.Header.Get(requestid.Header)
+		_ = json.NewEncoder(w).Encode(BuildRevocationDocument("example.com"))
+	}))
+	defer server.Close()
+
+	if _, err := FetchRevocationDocument(context.Background(), server.URL); err != nil {
+		t.Fatalf("FetchRevocationDocument failed: %v", err)
+	}
+	if userAgent != version.UserAgent() || requestID != "" {
+		t.Errorf("Expected default User-Agent and no request ID, got %q and %q", userAgent, requestID)
+	}
+
+	ctx := requestid.NewContext(context.Background(), "req-456")
+	if _, err := FetchRevocationDocument(ctx, server.URL, WithUserAgent("custom/1.0")); err != nil {
+		t.Fatalf("FetchRevocationDocument failed: %v", err)
+	}
+	if userAgent != "custom/1.0" || requestID != "req-456" {
+		t.Errorf("Expected custom/1.0 and req-456, got %q and %q", userAgent, requestID)
+	}
+}
+
+func TestFetchRevocationDocumentSizeLimit(t *testing.T) {
+	doc := BuildRevocationDocument("example.com")
+	for i := 0; i < 200; i++ {
+		AddRevokedKey(doc, fmt.Sprintf("sha256:%064x", i), ReasonSuperseded)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(doc)
+	}))
+	defer server.Close()
+
+	if _, err := FetchRevocationDocument(context.Background(), server.URL); err != nil {
+		t.Fatalf("Expected the document to fit the default limit, got %v", err)
+	}
+	_, err := FetchRevocationDocument(context.Background(), server.URL, WithMaxBytes(4<<10))
+	if !errors.Is(err, schemaerr.ErrDiscoveryResponseTooLarge) {
+		t.Errorf("Expected ErrDiscoveryResponseTooLarge, got %v", err)
+	}
+}
@@ -0,0 +1,165 @@
+// Package schemaerr defines the error kinds shared by the SchemaPin
+// packages, so that callers can classify failures with errors.Is and
+// errors.As instead of matching message text.
+//
+// Every failure that discovery, pinning or the verification workflow
+// reports carries one of the Kind values below in its error chain:
+//
+//	if errors.Is(result.Err(), schemaerr.ErrKeyRevoked) { ... }
+//
+//	var e *schemaerr.Error
+//	if errors.As(err, &e) {
+//	    log.Printf("%s failed for %s", e.ToolID, e.Domain)
+//	}
+//
+// Each Kind also names the error codes it is reported under in
+// verification.VerificationResult and utils.VerificationResult, so the two
+// result types classify an error the same way.
+package schemaerr
+
+import "errors"
+
+// Kind is a class of failure. Kinds are sentinel errors for errors.Is.
+type Kind struct {
+	name         string
+	code         string
+	workflowCode string
+}
+
+func (k *Kind) Error() string {
+	return k.name
+}
+
+// Code returns the verification.ErrorCode the kind is reported as, or an
+// empty string for kinds the verification package does not report.
+func (k *Kind) Code() string {
+	return k.code
+}
+
+// WorkflowCode returns the utils.VerificationResult error code the kind is
+// reported as.
+func (k *Kind) WorkflowCode() string {
+	return k.workflowCode
+}
+
+// The error kinds. Several discovery kinds share a workflow code because
+// utils reports every discovery failure as DISCOVERY_FAILED.
+var (
+	ErrSchemaInvalid             = &Kind{"schema invalid", "schema_canonicalization_failed", "SCHEMA_INVALID"}
+	ErrSchemaTooComplex          = &Kind{"schema too complex", "schema_too_complex", "SCHEMA_TOO_COMPLEX"}
+	ErrSignatureInvalid          = &Kind{"signature invalid", "signature_invalid", "SIGNATURE_INVALID"}
+	ErrSignatureRevoked          = &Kind{"signature revoked", "signature_revoked", "SIGNATURE_REVOKED"}
+	ErrSignatureStale            = &Kind{"signature stale", "signature_stale", "SIGNATURE_STALE"}
+	ErrSignatureSuperseded       = &Kind{"signature superseded", "signature_superseded", "SIGNATURE_SUPERSEDED"}
+	ErrKeyNotFound               = &Kind{"key not found", "key_not_found", "KEY_NOT_FOUND"}
+	ErrKeyRevoked                = &Kind{"key revoked", "key_revoked", "KEY_REVOKED"}
+	ErrKeyPinMismatch            = &Kind{"key does not match pin", "key_pin_mismatch", "KEY_CHANGED"}
+	ErrKeyRejected               = &Kind{"key rejected", "", "KEY_REJECTED"}
+	ErrKeyNotPinned              = &Kind{"key not pinned", "key_not_pinned", "KEY_NOT_PINNED"}
+	ErrKeyPreviouslyRejected     = &Kind{"key previously rejected", "key_previously_rejected", "KEY_PREVIOUSLY_REJECTED"}
+	ErrDecisionPending           = &Kind{"decision pending", "", "DECISION_PENDING"}
+	ErrSignatureThresholdNotMet  = &Kind{"signature threshold not met", "signature_threshold_not_met", "SIGNATURE_THRESHOLD_NOT_MET"}
+	ErrPermissionChanged         = &Kind{"file permissions changed", "permission_changed", "PERMISSION_CHANGED"}
+	ErrProvenanceInvalid         = &Kind{"provenance invalid", "provenance_invalid", "PROVENANCE_INVALID"}
+	ErrProvenanceSubjectMismatch = &Kind{"provenance subject mismatch", "provenance_subject_mismatch", "PROVENANCE_SUBJECT_MISMATCH"}
+	ErrDiscoveryNotFound         = &Kind{"discovery document not found", "discovery_fetch_failed", "DISCOVERY_FAILED"}
+	ErrDiscoveryFailed           = &Kind{"discovery failed", "discovery_fetch_failed", "DISCOVERY_FAILED"}
+	ErrDiscoveryInvalid          = &Kind{"discovery document invalid", "discovery_invalid", "DISCOVERY_FAILED"}
+	ErrDiscoveryRedirectBlocked  = &Kind{"discovery redirect blocked", "discovery_redirect_blocked", "DISCOVERY_REDIRECT_BLOCKED"}
+	ErrDiscoveryTLSPinMismatch   = &Kind{"discovery TLS pin mismatch", "discovery_tls_pin_mismatch", "DISCOVERY_FAILED"}
+	ErrDiscoveryResponseTooLarge = &Kind{"discovery response too large", "discovery_response_too_large", "DISCOVERY_FAILED"}
+	ErrDiscoveryDowngrade        = &Kind{"discovery schema version downgraded", "discovery_downgrade", "DISCOVERY_DOWNGRADE"}
+	ErrDiscoveryRateLimited      = &Kind{"discovery rate limited", "discovery_rate_limited", "DISCOVERY_RATE_LIMITED"}
+	ErrDiscoveryCircuitOpen      = &Kind{"discovery circuit open", "discovery_circuit_open", "DISCOVERY_CIRCUIT_OPEN"}
+	ErrDomainBlocked             = &Kind{"domain blocked", "domain_blocked", "DOMAIN_BLOCKED"}
+	ErrRevocationCheckFailed     = &Kind{"revocation check failed", "", "REVOCATION_CHECK_FAILED"}
+	ErrPinStoreCorrupt           = &Kind{"pin store corrupt", "", "PINNING_FAILED"}
+	ErrPolicyViolation           = &Kind{"policy violation", "policy_violation", "POLICY_VIOLATION"}
+)
+
+// kinds lists every Kind, most specific first, for KindOf.
+var kinds = []*Kind{
+	ErrKeyRevoked,
+	ErrSignatureRevoked,
+	ErrSignatureSuperseded,
+	ErrSignatureStale,
+	ErrKeyPinMismatch,
+	ErrKeyPreviouslyRejected,
+	ErrDecisionPending,
+	ErrKeyRejected,
+	ErrKeyNotPinned,
+	ErrSignatureThresholdNotMet,
+	ErrPermissionChanged,
+	ErrProvenanceSubjectMismatch,
+	ErrProvenanceInvalid,
+	ErrDomainBlocked,
+	ErrPolicyViolation,
+	ErrDiscoveryDowngrade,
+	ErrDiscoveryRedirectBlocked,
+	ErrDiscoveryTLSPinMismatch,
+	ErrDiscoveryResponseTooLarge,
+	ErrDiscoveryRateLimited,
+	ErrDiscoveryCircuitOpen,
+	ErrDiscoveryNotFound,
+	ErrDiscoveryInvalid,
+	ErrDiscoveryFailed,
+	ErrRevocationCheckFailed,
+	ErrPinStoreCorrupt,
+	ErrKeyNotFound,
+	ErrSignatureInvalid,
+	ErrSchemaTooComplex,
+	ErrSchemaInvalid,
+}
+
+// Error is a failure of a given Kind, with the context it occurred in.
+type Error struct {
+	Kind        *Kind
+	Domain      string
+	ToolID      string
+	Fingerprint string
+	// Message is the error text. When empty, the text of Err is used.
+	Message string
+	// Err is the underlying cause, if any.
+	Err error
+}
+
+func (e *Error) Error() string {
+	switch {
+	case e.Message != "":
+		return e.Message
+	case e.Err != nil:
+		return e.Err.Error()
+	default:
+		return e.Kind.Error()
+	}
+}
+
+// Is reports whether target is the error's Kind.
+func (e *Error) Is(target error) bool {
+	kind, ok := target.(*Kind)
+	return ok && kind == e.Kind
+}
+
+// Unwrap returns the underlying cause.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// KindOf returns the Kind of err: that of the outermost *Error in its
+// chain, or else the most specific Kind it matches with errors.Is. It
+// returns nil if err is nil or matches no Kind.
+func KindOf(err error) *Kind {
+	if err == nil {
+		return nil
+	}
+	var e *Error
+	if errors.As(err, &e) && e.Kind != nil {
+		return e.Kind
+	}
+	for _, kind := range kinds {
+		if errors.Is(err, kind) {
+			return kind
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package schemaerr
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestError(t *testing.T) {
+	cause := errors.New("connection refused")
+	err := fmt.Errorf("verify: %w", &Error{Kind: ErrDiscoveryFailed, Domain: "example.com", ToolID: "tool", Err: cause})
+
+	if !errors.Is(err, ErrDiscoveryFailed) || !errors.Is(err, cause) {
+		t.Errorf("Expected %v to match its kind and cause", err)
+	}
+	if errors.Is(err, ErrDiscoveryNotFound) {
+		t.Errorf("Did not expect %v to match another kind", err)
+	}
+	var e *Error
+	if !errors.As(err, &e) || e.Domain != "example.com" || e.ToolID != "tool" {
+		t.Fatalf("Expected errors.As to find the *Error, got %#v", e)
+	}
+
+	tests := []struct {
+		err      *Error
+		expected string
+	}{
+		{&Error{Kind: ErrKeyRevoked, Message: "pinned public key has been revoked", Err: cause}, "pinned public key has been revoked"},
+		{&Error{Kind: ErrKeyRevoked, Err: cause}, "connection refused"},
+		{&Error{Kind: ErrKeyRevoked}, "key revoked"},
+	}
+	for _, tt := range tests {
+		if got := tt.err.Error(); got != tt.expected {
+			t.Errorf("Expected %q, got %q", tt.expected, got)
+		}
+	}
+}
+
+// kindError matches a Kind through an Is method, as the package's own
+// error types do.
+type kindError struct{ kind *Kind }
+
+func (e kindError) Error() string        { return "kind error" }
+func (e kindError) Is(target error) bool { return target == e.kind }
+
+func TestKindOf(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected *Kind
+	}{
+		{"nil", nil, nil},
+		{"unclassified", errors.New("boom"), nil},
+		{"kind", ErrKeyRevoked, ErrKeyRevoked},
+		{"error", &Error{Kind: ErrKeyPinMismatch}, ErrKeyPinMismatch},
+		{"outermost error wins", &Error{Kind: ErrRevocationCheckFailed, Err: &Error{Kind: ErrDiscoveryNotFound}}, ErrRevocationCheckFailed},
+		{"Is method", fmt.Errorf("wrapped: %w", kindError{ErrDomainBlocked}), ErrDomainBlocked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := KindOf(tt.err); got != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
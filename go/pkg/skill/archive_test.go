@@ -0,0 +1,543 @@
+package skill
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+var archiveFormats = []ArchiveFormat{ArchiveZip, ArchiveTarGz}
+
+// archiveEntry is one entry of a hand-built test archive.
+type archiveEntry struct {
+	name     string
+	body     string
+	typeflag byte        // tar.TypeReg, tar.TypeDir, tar.TypeSymlink or tar.TypeLink
+	perm     os.FileMode // of regular files; zero means 0644
+}
+
+func (e archiveEntry) filePerm() os.FileMode {
+	if e.perm == 0 {
+		return 0644
+	}
+	return e.perm
+}
+
+// buildArchive writes entries, in order, to an archive of the given format.
+func buildArchive(t *testing.T, format ArchiveFormat, entries []archiveEntry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	switch format {
+	case ArchiveZip:
+		zw := zip.NewWriter(&buf)
+		for _, e := range entries {
+			header := &zip.FileHeader{Name: e.name, Method: zip.Deflate}
+			switch e.typeflag {
+			case tar.TypeDir:
+				header.SetMode(os.ModeDir | 0755)
+			case tar.TypeSymlink, tar.TypeLink:
+				header.SetMode(os.ModeSymlink | 0777)
+			default:
+				header.SetMode(e.filePerm())
+			}
+			w, err := zw.CreateHeader(header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := io.WriteString(w, e.body); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	case ArchiveTarGz:
+		gw := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gw)
+		for _, e := range entries {
+			header := &tar.Header{Name: e.name, Typeflag: e.typeflag, Mode: int64(e.filePerm())}
+			switch e.typeflag {
+			case tar.TypeReg:
+				header.Size = int64(len(e.body))
+			case tar.TypeSymlink, tar.TypeLink:
+				header.Linkname = e.body
+			}
+			if err := tw.WriteHeader(header); err != nil {
+				t.Fatal(err)
+			}
+			if e.typeflag == tar.TypeReg {
+				if _, err := io.WriteString(tw, e.body); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		if err := tw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		if err := gw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+// packDir archives every regular file under dir, including .schemapin.sig,
+// into a file in a new temporary directory and returns its path.
+func packDir(t *testing.T, dir string, format ArchiveFormat) string {
+	t.Helper()
+	return packDirUnder(t, dir, format, "")
+}
+
+// packDirUnder is packDir with every entry name prefixed by root.
+func packDirUnder(t *testing.T, dir string, format ArchiveFormat, root string) string {
+	t.Helper()
+	var entries []archiveEntry
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || !info.Mode().IsRegular() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, archiveEntry{name: root + filepath.ToSlash(rel), body: string(data), typeflag: tar.TypeReg, perm: info.Mode().Perm()})
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archivePath := filepath.Join(t.TempDir(), "skill."+string(format))
+	if err := os.WriteFile(archivePath, buildArchive(t, format, entries), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return archivePath
+}
+
+// unpackArchive extracts the regular files of a trusted test archive.
+func unpackArchive(t *testing.T, archivePath string, format ArchiveFormat) string {
+	t.Helper()
+	data, err := os.ReadFile(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	err = walkArchive(bytes.NewReader(data), int64(len(data)), format, ArchiveLimits{}, nil, func(f archiveFile) error {
+		body, err := f.open()
+		if err != nil {
+			return err
+		}
+		defer body.Close()
+		content, err := io.ReadAll(body)
+		files[f.name] = string(content)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return createSkillDir(t, files)
+}
+
+func openArchive(t *testing.T, archivePath string) (*bytes.Reader, int64) {
+	t.Helper()
+	data, err := os.ReadFile(archivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(data), int64(len(data))
+}
+
+func archiveSkillFiles() map[string]string {
+	return map[string]string{
+		"SKILL.md":              "---\nname: archived-skill\n---\n# Archived",
+		"scripts/run.sh":        "#!/bin/sh\necho hi\n",
+		"assets/data/table.csv": "a,b\n1,2\n",
+	}
+}
+
+func TestCanonicalizeSkillArchiveMatchesDirectory(t *testing.T) {
+	files := archiveSkillFiles()
+	files["nested/.schemapin.sig"] = "ignored like any other signature file"
+	dir := createSkillDir(t, files)
+	wantHash, wantManifest, err := CanonicalizeSkill(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range archiveFormats {
+		t.Run(string(format), func(t *testing.T) {
+			r, size := openArchive(t, packDir(t, dir, format))
+			gotHash, gotManifest, err := CanonicalizeSkillArchive(r, size, format)
+			if err != nil {
+				t.Fatalf("CanonicalizeSkillArchive failed: %v", err)
+			}
+			if !bytes.Equal(gotHash, wantHash) {
+				t.Errorf("Root hash mismatch: archive %s, directory %s", hex.EncodeToString(gotHash), hex.EncodeToString(wantHash))
+			}
+			if !reflect.DeepEqual(gotManifest, wantManifest) {
+				t.Errorf("Manifest mismatch:\narchive   %v\ndirectory %v", gotManifest, wantManifest)
+			}
+		})
+	}
+}
+
+func TestSignDirectoryVerifyArchive(t *testing.T) {
+	privPEM, pubPEM := makeKeypair(t)
+	dir := createSkillDir(t, archiveSkillFiles())
+	sig, err := SignSkill(dir, privPEM, "example.com", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range archiveFormats {
+		t.Run(string(format), func(t *testing.T) {
+			r, size := openArchive(t, packDir(t, dir, format))
+			result := VerifySkillArchiveOffline(r, size, format, makeDiscovery(pubPEM), nil, nil, nil, "")
+			if !result.Valid {
+				t.Fatalf("Expected valid archive, got %s: %s", result.ErrorCode, result.ErrorMessage)
+			}
+
+			loaded, err := LoadArchiveSignature(r, size, format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if loaded.SkillHash != sig.SkillHash {
+				t.Errorf("Expected skill hash %s, got %s", sig.SkillHash, loaded.SkillHash)
+			}
+		})
+	}
+}
+
+func TestSignArchiveVerifyDirectory(t *testing.T) {
+	privPEM, pubPEM := makeKeypair(t)
+	dir := createSkillDir(t, archiveSkillFiles())
+	wantHash, _, err := CanonicalizeSkill(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range archiveFormats {
+		t.Run(string(format), func(t *testing.T) {
+			archivePath := packDir(t, dir, format)
+			if _, err := SignSkillArchive(archivePath, privPEM, "example.com", SignOptions{}); err != nil {
+				t.Fatalf("SignSkillArchive failed: %v", err)
+			}
+			// Re-signing replaces the signature entry rather than adding a
+			// duplicate
+			sig, err := SignSkillArchive(archivePath, privPEM, "example.com", SignOptions{RecordFileSizes: true})
+			if err != nil {
+				t.Fatalf("SignSkillArchive (re-sign) failed: %v", err)
+			}
+			if sig.SkillName != "archived-skill" {
+				t.Errorf("Expected skill name from SKILL.md, got %q", sig.SkillName)
+			}
+			if sig.SkillHash != "sha256:"+hex.EncodeToString(wantHash) {
+				t.Errorf("Expected archive signature over the directory hash, got %s", sig.SkillHash)
+			}
+			if sig.FileSizes["scripts/run.sh"] != int64(len("#!/bin/sh\necho hi\n")) {
+				t.Errorf("Expected recorded file sizes, got %v", sig.FileSizes)
+			}
+
+			r, size := openArchive(t, archivePath)
+			if result := VerifySkillArchiveOffline(r, size, format, makeDiscovery(pubPEM), nil, nil, nil, ""); !result.Valid {
+				t.Fatalf("Expected signed archive to verify, got %s: %s", result.ErrorCode, result.ErrorMessage)
+			}
+
+			extracted := unpackArchive(t, archivePath, format)
+			result := VerifySkillOffline(extracted, makeDiscovery(pubPEM), nil, nil, nil, "")
+			if !result.Valid {
+				t.Fatalf("Expected extracted archive to verify, got %s: %s", result.ErrorCode, result.ErrorMessage)
+			}
+		})
+	}
+}
+
+func TestSignArchiveExpectedHash(t *testing.T) {
+	privPEM, _ := makeKeypair(t)
+	dir := createSkillDir(t, archiveSkillFiles())
+	rootHash, _, err := CanonicalizeSkill(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	built := "sha256:" + hex.EncodeToString(rootHash)
+
+	for _, format := range archiveFormats {
+		t.Run(string(format), func(t *testing.T) {
+			archivePath := packDir(t, dir, format)
+			before, err := os.ReadFile(archivePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = SignSkillArchive(archivePath, privPEM, "example.com", SignOptions{ExpectedHash: "sha256:" + strings.Repeat("0", 64)})
+			var mismatch *core.HashMismatchError
+			if !errors.As(err, &mismatch) || mismatch.Actual != built {
+				t.Fatalf("expected HashMismatchError, got %v", err)
+			}
+			if after, _ := os.ReadFile(archivePath); !bytes.Equal(before, after) {
+				t.Error("expected the archive to be left unchanged on a mismatch")
+			}
+
+			if _, err := SignSkillArchive(archivePath, privPEM, "example.com", SignOptions{ExpectedHash: built}); err != nil {
+				t.Fatalf("expected signing with the built hash to succeed, got %v", err)
+			}
+		})
+	}
+}
+
+func TestVerifySkillArchiveTampered(t *testing.T) {
+	privPEM, pubPEM := makeKeypair(t)
+	dir := createSkillDir(t, archiveSkillFiles())
+	if _, err := SignSkill(dir, privPEM, "example.com", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "scripts", "run.sh"), []byte("#!/bin/sh\nrm -rf ~\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range archiveFormats {
+		t.Run(string(format), func(t *testing.T) {
+			r, size := openArchive(t, packDir(t, dir, format))
+			result := VerifySkillArchiveOffline(r, size, format, makeDiscovery(pubPEM), nil, nil, nil, "")
+			if result.Valid || result.ErrorCode != verification.ErrSignatureInvalid {
+				t.Errorf("Expected signature_invalid for a tampered archive, got %+v", result)
+			}
+		})
+	}
+}
+
+func TestSkillArchiveRejectsUnsafeEntries(t *testing.T) {
+	skillMD := archiveEntry{name: "SKILL.md", body: "# Skill", typeflag: tar.TypeReg}
+	tests := []struct {
+		name    string
+		entries []archiveEntry
+		formats []ArchiveFormat
+		wantErr string
+	}{
+		{"parent traversal", []archiveEntry{skillMD, {name: "../evil.sh", body: "x", typeflag: tar.TypeReg}}, archiveFormats, "escapes"},
+		{"nested traversal", []archiveEntry{skillMD, {name: "scripts/../../evil.sh", body: "x", typeflag: tar.TypeReg}}, archiveFormats, "escapes"},
+		{"absolute path", []archiveEntry{skillMD, {name: "/etc/passwd", body: "x", typeflag: tar.TypeReg}}, archiveFormats, "absolute"},
+		{"duplicate entry", []archiveEntry{skillMD, {name: "./SKILL.md", body: "# Other", typeflag: tar.TypeReg}}, archiveFormats, "duplicate"},
+		{"symlink", []archiveEntry{skillMD, {name: "link", body: "/etc/passwd", typeflag: tar.TypeSymlink}}, archiveFormats, "symlink"},
+		{"hard link", []archiveEntry{skillMD, {name: "link", body: "SKILL.md", typeflag: tar.TypeLink}}, []ArchiveFormat{ArchiveTarGz}, "hard link"},
+	}
+	for _, tt := range tests {
+		for _, format := range tt.formats {
+			t.Run(tt.name+"/"+string(format), func(t *testing.T) {
+				data := buildArchive(t, format, tt.entries)
+				_, _, err := CanonicalizeSkillArchive(bytes.NewReader(data), int64(len(data)), format)
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("Expected error containing %q, got %v", tt.wantErr, err)
+				}
+			})
+		}
+	}
+}
+
+func TestCanonicalizeSkillArchiveSkipsDirectories(t *testing.T) {
+	entries := []archiveEntry{
+		{name: "./", typeflag: tar.TypeDir},
+		{name: "scripts/", typeflag: tar.TypeDir},
+		{name: "./scripts/run.sh", body: "echo", typeflag: tar.TypeReg},
+	}
+	for _, format := range archiveFormats {
+		data := buildArchive(t, format, entries)
+		_, manifest, err := CanonicalizeSkillArchive(bytes.NewReader(data), int64(len(data)), format)
+		if err != nil {
+			t.Fatalf("%s: CanonicalizeSkillArchive failed: %v", format, err)
+		}
+		keys := make([]string, 0, len(manifest))
+		for k := range manifest {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		if !reflect.DeepEqual(keys, []string{"scripts/run.sh"}) {
+			t.Errorf("%s: expected only scripts/run.sh, got %v", format, keys)
+		}
+	}
+}
+
+func TestSkillArchiveSingleRootFolder(t *testing.T) {
+	privPEM, pubPEM := makeKeypair(t)
+	dir := createSkillDir(t, archiveSkillFiles())
+	wantHash, wantManifest, err := CanonicalizeSkill(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range archiveFormats {
+		t.Run(string(format), func(t *testing.T) {
+			archivePath := packDirUnder(t, dir, format, "myskill/")
+			r, size := openArchive(t, archivePath)
+			gotHash, gotManifest, err := CanonicalizeSkillArchive(r, size, format)
+			if err != nil {
+				t.Fatalf("CanonicalizeSkillArchive failed: %v", err)
+			}
+			if !bytes.Equal(gotHash, wantHash) || !reflect.DeepEqual(gotManifest, wantManifest) {
+				t.Errorf("Expected the root folder to be stripped, got manifest %v", gotManifest)
+			}
+
+			if _, err := SignSkillArchive(archivePath, privPEM, "example.com", SignOptions{}); err != nil {
+				t.Fatalf("SignSkillArchive failed: %v", err)
+			}
+			r, size = openArchive(t, archivePath)
+			names := map[string]bool{}
+			err = scanArchive(r, size, format, func(f archiveFile) error {
+				names[f.name] = true
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !names["myskill/"+SignatureFilename] || names[SignatureFilename] {
+				t.Errorf("Expected the signature inside the root folder, got entries %v", names)
+			}
+			if result := VerifySkillArchiveOffline(r, size, format, makeDiscovery(pubPEM), nil, nil, nil, ""); !result.Valid {
+				t.Fatalf("Expected signed archive to verify, got %s: %s", result.ErrorCode, result.ErrorMessage)
+			}
+		})
+	}
+}
+
+func TestSkillArchiveRootFolderNeedsSkillMD(t *testing.T) {
+	entries := []archiveEntry{
+		{name: "docs/SKILL.txt", body: "# Not a skill root", typeflag: tar.TypeReg},
+		{name: "docs/run.sh", body: "echo", typeflag: tar.TypeReg},
+	}
+	for _, format := range archiveFormats {
+		data := buildArchive(t, format, entries)
+		_, manifest, err := CanonicalizeSkillArchive(bytes.NewReader(data), int64(len(data)), format)
+		if err != nil {
+			t.Fatalf("%s: CanonicalizeSkillArchive failed: %v", format, err)
+		}
+		if _, ok := manifest["docs/run.sh"]; !ok {
+			t.Errorf("%s: expected a folder without SKILL.md to be kept, got %v", format, manifest)
+		}
+	}
+}
+
+func TestSkillArchiveLimits(t *testing.T) {
+	privPEM, pubPEM := makeKeypair(t)
+	bomb := []archiveEntry{
+		{name: "SKILL.md", body: "# Skill", typeflag: tar.TypeReg},
+		{name: "zeros.bin", body: strings.Repeat("\x00", 1<<20), typeflag: tar.TypeReg},
+	}
+	tests := []struct {
+		name   string
+		limits ArchiveLimits
+		want   string
+	}{
+		{"entries", ArchiveLimits{MaxEntries: 1}, "entries"},
+		{"total size", ArchiveLimits{MaxTotalSize: 64 << 10}, "bytes"},
+	}
+	for _, tt := range tests {
+		for _, format := range archiveFormats {
+			t.Run(tt.name+"/"+string(format), func(t *testing.T) {
+				archivePath := filepath.Join(t.TempDir(), "skill."+string(format))
+				if err := os.WriteFile(archivePath, buildArchive(t, format, bomb), 0644); err != nil {
+					t.Fatal(err)
+				}
+				_, err := SignSkillArchive(archivePath, privPEM, "example.com", SignOptions{ArchiveLimits: tt.limits})
+				var limitErr *ArchiveLimitError
+				if !errors.As(err, &limitErr) || limitErr.Limit != tt.want {
+					t.Fatalf("Expected ArchiveLimitError for %s, got %v", tt.want, err)
+				}
+
+				if _, err := SignSkillArchive(archivePath, privPEM, "example.com", SignOptions{}); err != nil {
+					t.Fatalf("SignSkillArchive within the default limits failed: %v", err)
+				}
+				r, size := openArchive(t, archivePath)
+				result := VerifySkillArchiveOfflineWithOptions(r, size, format, makeDiscovery(pubPEM), nil, nil, nil, "", VerifyOptions{ArchiveLimits: tt.limits})
+				if result.Valid || !strings.Contains(result.ErrorMessage, "exceeds the limit") {
+					t.Errorf("Expected verification to fail on the archive limit, got %+v", result)
+				}
+			})
+		}
+	}
+}
+
+func TestDetectArchiveFormat(t *testing.T) {
+	for name, want := range map[string]ArchiveFormat{"skill.zip": ArchiveZip, "Skill.TAR.GZ": ArchiveTarGz, "skill.tgz": ArchiveTarGz} {
+		if got, err := DetectArchiveFormat(name); err != nil || got != want {
+			t.Errorf("DetectArchiveFormat(%q) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+	if _, err := DetectArchiveFormat("skill.rar"); err == nil {
+		t.Error("Expected an error for an unsupported extension")
+	}
+}
+
+func TestVerifyTimings(t *testing.T) {
+	privPEM, pubPEM := makeKeypair(t)
+	files := archiveSkillFiles()
+	var wantBytes int64
+	for _, content := range files {
+		wantBytes += int64(len(content))
+	}
+	dir := createSkillDir(t, files)
+	if _, err := SignSkill(dir, privPEM, "example.com", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	options := VerifyOptions{Timings: true}
+
+	check := func(t *testing.T, result *verification.VerificationResult) {
+		t.Helper()
+		if !result.Valid {
+			t.Fatalf("Expected valid skill, got %s: %s", result.ErrorCode, result.ErrorMessage)
+		}
+		timings, ok := result.Metadata[verification.MetadataTimings].(map[string]int64)
+		if !ok {
+			t.Fatalf("Expected timings in metadata, got %v", result.Metadata)
+		}
+		for _, key := range []string{
+			verification.TimingRevocationCheck,
+			verification.TimingCanonicalizeWalk,
+			verification.TimingSignatureVerify,
+			verification.TimingTotal,
+		} {
+			if _, ok := timings[key]; !ok {
+				t.Errorf("Expected a %s timing, got %v", key, timings)
+			}
+		}
+		if timings[verification.TimingCanonicalizeWalk]+timings[verification.TimingSignatureVerify] > timings[verification.TimingTotal] {
+			t.Errorf("Expected the steps to fit in the total, got %v", timings)
+		}
+		if got := result.Metadata[MetadataFilesHashed]; got != len(files) {
+			t.Errorf("Expected %d files hashed, got %v", len(files), got)
+		}
+		if got := result.Metadata[MetadataBytesHashed]; got != wantBytes {
+			t.Errorf("Expected %d bytes hashed, got %v", wantBytes, got)
+		}
+	}
+
+	t.Run("directory", func(t *testing.T) {
+		check(t, VerifySkillOfflineWithOptions(dir, makeDiscovery(pubPEM), nil, nil, nil, "", options))
+	})
+	for _, format := range archiveFormats {
+		t.Run(string(format), func(t *testing.T) {
+			r, size := openArchive(t, packDir(t, dir, format))
+			check(t, VerifySkillArchiveOfflineWithOptions(r, size, format, makeDiscovery(pubPEM), nil, nil, nil, "", options))
+		})
+	}
+
+	result := VerifySkillOfflineWithOptions(dir, makeDiscovery(pubPEM), nil, nil, nil, "", VerifyOptions{})
+	if _, ok := result.Metadata[verification.MetadataTimings]; ok {
+		t.Errorf("Expected no timings unless requested, got %v", result.Metadata)
+	}
+}
@@ -0,0 +1,174 @@
+// Skill verification with optional content policy enforcement.
+
+package skill
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/provenance"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/revocation"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+// VerifyOptions are optional verify-time parameters for
+// VerifySkillOfflineWithOptions.
+type VerifyOptions struct {
+	// ContentPolicy, when set, is evaluated against the skill's files after
+	// the signature has been validated.
+	ContentPolicy *verification.ContentPolicy
+	// Concurrency is the number of skills VerifyInstalledSkills verifies
+	// in parallel. Ignored for single-skill verification.
+	Concurrency int
+	// AllowNewMutableFiles accepts files that were added after signing
+	// when they match one of the signature's mutable paths. By default
+	// such files fail verification.
+	AllowNewMutableFiles bool
+	// AllowLegacySignature accepts signatures made by Go releases before
+	// v1.4 over the root hash itself (see
+	// crypto.SignatureManager.VerifyLegacySignature), with a
+	// verification.WarningLegacySignature warning. Off by default.
+	AllowLegacySignature bool
+	// ArchiveLimits bounds the archives verified by
+	// VerifySkillArchiveOfflineWithOptions. Zero fields take the value
+	// from DefaultArchiveLimits.
+	ArchiveLimits ArchiveLimits
+	// Policy configures the verification checks (see verification.Policy).
+	// Its content policy applies when ContentPolicy is nil. Nil verifies
+	// without a policy.
+	Policy *verification.Policy
+	// ManifestLimits bounds the signature, manifest and skill directory
+	// read by VerifySkillOfflineWithOptions. Zero fields take the value
+	// from DefaultManifestLimits.
+	ManifestLimits ManifestLimits
+	// StrictPermissions fails verification with
+	// verification.ErrPermissionChanged when a file's executable bit
+	// differs from the one signed with SignOptions.TrackExecBit. By
+	// default the change is a verification.WarningPermissionChanged
+	// warning. Skill directories on Windows are not compared either way.
+	StrictPermissions bool
+	// Provenance enables checking the provenance attached to signatures
+	// (see SkillSignature.Provenance). It must be signed by the skill's
+	// key or one of Provenance.Keys and name the skill root hash, or
+	// verification fails with verification.ErrProvenanceInvalid or
+	// verification.ErrProvenanceSubjectMismatch; its builder and source
+	// are reported in VerificationResult.Metadata. Signatures without
+	// provenance verify as before. Nil, the default, ignores provenance.
+	Provenance *provenance.Config
+	// Timings adds a breakdown of where verification spent its time to
+	// VerificationResult.Metadata, under verification.MetadataTimings in
+	// microseconds, with the files and bytes hashed under
+	// MetadataFilesHashed and MetadataBytesHashed. Walking and hashing the
+	// skill is reported as canonicalize_walk, apart from signature_verify.
+	Timings bool
+	// Progress, when set, is called as the skill's files are hashed (see
+	// ProgressFunc). VerifyInstalledSkills serializes its calls and sets
+	// Progress.Skill.
+	Progress ProgressFunc
+}
+
+// Result metadata keys of the work counted with VerifyOptions.Timings.
+const (
+	MetadataFilesHashed = "files_hashed"
+	MetadataBytesHashed = "bytes_hashed"
+)
+
+// VerifySkillOfflineWithOptions performs the standard offline verification
+// flow and then applies any checks enabled in options.
+//
+// The content policy is evaluated against the manifest and file sizes
+// recomputed from disk, since neither the file_manifest nor the file_sizes
+// field is covered by the signature. Sizes recorded in file_sizes are only
+// cross-checked against the files on disk, so removing them from a
+// signature cannot skip the max_file_size check.
+func VerifySkillOfflineWithOptions(
+	skillDir string,
+	disc *discovery.WellKnownResponse,
+	sig *SkillSignature,
+	rev *revocation.RevocationDocument,
+	pinStore *verification.KeyPinStore,
+	toolID string,
+	options VerifyOptions,
+) *verification.VerificationResult {
+	if sig == nil {
+		loaded, err := LoadSignatureWithLimits(skillDir, options.ManifestLimits)
+		if err != nil {
+			return &verification.VerificationResult{
+				Valid:        false,
+				ErrorCode:    verification.ErrSignatureInvalid,
+				ErrorMessage: "No .schemapin.sig found in skill directory",
+			}
+		}
+		sig = loaded
+	}
+	// Resolve a split manifest once, for both the signature and the
+	// file_sizes cross-check
+	if resolved, err := resolveManifest(skillDir, sig, options.ManifestLimits); err == nil {
+		sig = resolved
+	}
+
+	fromPolicy := options.ContentPolicy == nil && options.Policy != nil && options.Policy.ContentPolicy != nil
+	if fromPolicy {
+		options.ContentPolicy = options.Policy.ContentPolicy
+	}
+
+	result := verifySkillDir(skillDir, disc, sig, rev, pinStore, toolID, options)
+	if !result.Valid || options.ContentPolicy == nil {
+		return result
+	}
+
+	manifest, err := signedManifest(skillDir, sig, options.ManifestLimits)
+	if err != nil {
+		return &verification.VerificationResult{
+			Valid:        false,
+			Domain:       result.Domain,
+			ErrorCode:    verification.ErrSchemaCanonicalizationFailed,
+			ErrorMessage: fmt.Sprintf("Failed to canonicalize skill: %v", err),
+		}
+	}
+
+	sizes, err := manifestFileSizes(skillDir, manifest)
+	if err != nil {
+		return &verification.VerificationResult{
+			Valid:        false,
+			Domain:       result.Domain,
+			ErrorCode:    verification.ErrContentPolicyViolation,
+			ErrorMessage: fmt.Sprintf("Failed to read skill file sizes: %v", err),
+		}
+	}
+
+	if sig.FileSizes != nil {
+		if mismatched := mismatchedFileSizes(sizes, sig.FileSizes, sig.MutablePaths); len(mismatched) > 0 {
+			return &verification.VerificationResult{
+				Valid:        false,
+				Domain:       result.Domain,
+				ErrorCode:    verification.ErrContentPolicyViolation,
+				ErrorMessage: fmt.Sprintf("Recorded file sizes do not match skill contents: %v", mismatched),
+			}
+		}
+	}
+
+	result = result.WithContentPolicy(options.ContentPolicy, manifest, sizes)
+	if !result.Valid && fromPolicy {
+		result.PolicyRule = verification.RuleContentPolicy
+	}
+	return result
+}
+
+// mismatchedFileSizes returns the paths whose recorded size is missing or
+// differs from their actual size on disk. Files matching mutablePaths are
+// not checked.
+func mismatchedFileSizes(actual, recorded map[string]int64, mutablePaths []string) []string {
+	var mismatched []string
+	for relPath, size := range actual {
+		if isMutablePath(mutablePaths, relPath) {
+			continue
+		}
+		if recordedSize, ok := recorded[relPath]; !ok || recordedSize != size {
+			mismatched = append(mismatched, relPath)
+		}
+	}
+	sort.Strings(mismatched)
+	return mismatched
+}
@@ -0,0 +1,223 @@
+package skill
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+func signContentSkill(t *testing.T, recordSizes bool) (string, string) {
+	t.Helper()
+	privPEM, pubPEM := makeKeypair(t)
+	dir := createSkillDir(t, map[string]string{
+		"SKILL.md":        "---\nname: content\n---\n",
+		"bin/helper.so":   strings.Repeat("x", 2048),
+		"scripts/run.sh":  "#!/bin/sh\necho hi\n",
+		"docs/readme.txt": "docs",
+	})
+	if _, err := SignSkillWithOptions(dir, privPEM, "example.com", SignOptions{RecordFileSizes: recordSizes}); err != nil {
+		t.Fatal(err)
+	}
+	return dir, pubPEM
+}
+
+// TestSignRecordsFileSizes confirms sizes are written only when requested.
+func TestSignRecordsFileSizes(t *testing.T) {
+	dir, _ := signContentSkill(t, true)
+	sig, err := LoadSignature(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig.FileSizes["bin/helper.so"] != 2048 {
+		t.Errorf("expected size 2048 for bin/helper.so, got %d", sig.FileSizes["bin/helper.so"])
+	}
+	if len(sig.FileSizes) != len(sig.FileManifest) {
+		t.Errorf("expected a size for every manifest entry, got %d/%d", len(sig.FileSizes), len(sig.FileManifest))
+	}
+	if sig.SchemapinVersion != "1.4" {
+		t.Errorf("expected schemapin_version '1.4', got %q", sig.SchemapinVersion)
+	}
+
+	legacyDir, _ := signContentSkill(t, false)
+	raw, err := os.ReadFile(filepath.Join(legacyDir, SignatureFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "file_sizes") {
+		t.Errorf("on-disk JSON must not contain 'file_sizes' by default; got: %s", raw)
+	}
+}
+
+func TestVerifyContentPolicy(t *testing.T) {
+	dir, pubPEM := signContentSkill(t, true)
+
+	tests := []struct {
+		name      string
+		policy    *verification.ContentPolicy
+		valid     bool
+		errorCode verification.ErrorCode
+		warning   string
+	}{
+		{
+			name:   "no policy",
+			policy: nil,
+			valid:  true,
+		},
+		{
+			name:   "permissive policy",
+			policy: &verification.ContentPolicy{DeniedExtensions: []string{".exe"}, MaxFileCount: 10, MaxFileSize: 4096},
+			valid:  true,
+		},
+		{
+			name:      "denied extension",
+			policy:    &verification.ContentPolicy{DeniedExtensions: []string{".SO", ".dll"}},
+			errorCode: verification.ErrContentPolicyViolation,
+		},
+		{
+			name:      "denied glob",
+			policy:    &verification.ContentPolicy{DeniedGlobs: []string{"scripts/*"}},
+			errorCode: verification.ErrContentPolicyViolation,
+		},
+		{
+			name:      "max file count",
+			policy:    &verification.ContentPolicy{MaxFileCount: 3},
+			errorCode: verification.ErrContentPolicyViolation,
+		},
+		{
+			name:      "max file size",
+			policy:    &verification.ContentPolicy{MaxFileSize: 1024},
+			errorCode: verification.ErrContentPolicyViolation,
+		},
+		{
+			name:    "warn severity",
+			policy:  &verification.ContentPolicy{DeniedExtensions: []string{".so"}, Severity: verification.ContentPolicySeverityWarn},
+			valid:   true,
+			warning: "content_policy: bin/helper.so has denied extension .so",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := VerifySkillOfflineWithOptions(dir, makeDiscovery(pubPEM), nil, nil, nil, "", VerifyOptions{ContentPolicy: tt.policy})
+			if result.Valid != tt.valid {
+				t.Fatalf("expected valid=%v, got %v (%s)", tt.valid, result.Valid, result.ErrorMessage)
+			}
+			if result.ErrorCode != tt.errorCode {
+				t.Errorf("expected error code %q, got %q", tt.errorCode, result.ErrorCode)
+			}
+			if tt.warning != "" && !containsString(result.Warnings, tt.warning) {
+				t.Errorf("expected warning %q, got %v", tt.warning, result.Warnings)
+			}
+		})
+	}
+}
+
+// TestVerifyContentPolicyLegacyManifest ensures signatures without
+// file_sizes still verify and have max_file_size enforced from the files
+// on disk.
+func TestVerifyContentPolicyLegacyManifest(t *testing.T) {
+	dir, pubPEM := signContentSkill(t, false)
+
+	policy := &verification.ContentPolicy{MaxFileSize: 4096, MaxFileCount: 10}
+	result := VerifySkillOfflineWithOptions(dir, makeDiscovery(pubPEM), nil, nil, nil, "", VerifyOptions{ContentPolicy: policy})
+	if !result.Valid {
+		t.Fatalf("expected valid result, got %s: %s", result.ErrorCode, result.ErrorMessage)
+	}
+
+	policy.MaxFileSize = 1024
+	result = VerifySkillOfflineWithOptions(dir, makeDiscovery(pubPEM), nil, nil, nil, "", VerifyOptions{ContentPolicy: policy})
+	if result.Valid || result.ErrorCode != verification.ErrContentPolicyViolation {
+		t.Errorf("expected content_policy_violation for an oversized file on legacy manifest, got valid=%v code=%q", result.Valid, result.ErrorCode)
+	}
+
+	policy.MaxFileSize = 0
+	policy.DeniedExtensions = []string{".so"}
+	result = VerifySkillOfflineWithOptions(dir, makeDiscovery(pubPEM), nil, nil, nil, "", VerifyOptions{ContentPolicy: policy})
+	if result.Valid || result.ErrorCode != verification.ErrContentPolicyViolation {
+		t.Errorf("expected content_policy_violation on legacy manifest, got valid=%v code=%q", result.Valid, result.ErrorCode)
+	}
+}
+
+// TestVerifyContentPolicyStrippedSizes ensures deleting file_sizes from a
+// signature does not bypass max_file_size.
+func TestVerifyContentPolicyStrippedSizes(t *testing.T) {
+	dir, pubPEM := signContentSkill(t, true)
+	sig, err := LoadSignature(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig.FileSizes = nil
+
+	policy := &verification.ContentPolicy{MaxFileSize: 1024}
+	result := VerifySkillOfflineWithOptions(dir, makeDiscovery(pubPEM), sig, nil, nil, "", VerifyOptions{ContentPolicy: policy})
+	if result.Valid || result.ErrorCode != verification.ErrContentPolicyViolation {
+		t.Errorf("expected content_policy_violation with file_sizes removed, got valid=%v code=%q", result.Valid, result.ErrorCode)
+	}
+}
+
+// TestVerifyContentPolicyForgedSizes rejects recorded sizes that disagree
+// with the verified files, since file_sizes is not covered by the signature.
+func TestVerifyContentPolicyForgedSizes(t *testing.T) {
+	dir, pubPEM := signContentSkill(t, true)
+	sig, err := LoadSignature(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig.FileSizes["bin/helper.so"] = 10
+
+	policy := &verification.ContentPolicy{MaxFileSize: 1024}
+	result := VerifySkillOfflineWithOptions(dir, makeDiscovery(pubPEM), sig, nil, nil, "", VerifyOptions{ContentPolicy: policy})
+	if result.Valid || result.ErrorCode != verification.ErrContentPolicyViolation {
+		t.Errorf("expected content_policy_violation for forged sizes, got valid=%v code=%q", result.Valid, result.ErrorCode)
+	}
+}
+
+func containsString(values []string, want string) bool {
+	for _, v := range values {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
+
+// TestVerifyPolicy checks a verification.Policy that downgrades revocation
+// to a warning, requires pinned keys and carries a content policy.
+func TestVerifyPolicy(t *testing.T) {
+	dir, pubPEM := signContentSkill(t, true)
+	fingerprint, err := crypto.NewKeyManager().CalculateKeyFingerprintFromPEM(pubPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	disc := makeDiscovery(pubPEM)
+	disc.RevokedKeys = []string{fingerprint}
+	policy := &verification.Policy{Revocation: verification.SeverityWarn, RequirePinned: verification.SeverityFail}
+
+	pinStore := verification.NewKeyPinStore()
+	result := VerifySkillOfflineWithOptions(dir, disc, nil, nil, pinStore, "tool", VerifyOptions{Policy: policy})
+	if result.Valid || result.PolicyRule != verification.RuleRequirePinned {
+		t.Fatalf("expected a require_pinned failure, got %+v", result)
+	}
+	if pinStore.GetPinned("tool", "example.com") != "" {
+		t.Error("expected the rejected key not to be pinned")
+	}
+
+	pinStore.CheckAndPin("tool", "example.com", fingerprint)
+	result = VerifySkillOfflineWithOptions(dir, disc, nil, nil, pinStore, "tool", VerifyOptions{Policy: policy})
+	if !result.Valid {
+		t.Fatalf("expected the revoked key to only warn, got %s: %s", result.ErrorCode, result.ErrorMessage)
+	}
+	if len(result.PolicyFindings) != 1 || result.PolicyFindings[0].Rule != verification.RuleRevocation {
+		t.Errorf("expected one revocation finding, got %+v", result.PolicyFindings)
+	}
+
+	policy.ContentPolicy = &verification.ContentPolicy{DeniedExtensions: []string{".so"}}
+	result = VerifySkillOfflineWithOptions(dir, disc, nil, nil, pinStore, "tool", VerifyOptions{Policy: policy})
+	if result.Valid || result.ErrorCode != verification.ErrContentPolicyViolation || result.PolicyRule != verification.RuleContentPolicy {
+		t.Errorf("expected the policy's content policy to fail, got %+v", result)
+	}
+}
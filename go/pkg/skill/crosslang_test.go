@@ -0,0 +1,162 @@
+package skill
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+// crossLanguageFixtures are the skill folders signed by the other SDKs under
+// testdata/crosslang. See testdata/crosslang/README.md to regenerate them.
+var crossLanguageFixtures = []struct {
+	sdk     string
+	domain  string
+	version string
+}{
+	{sdk: "python", domain: "python.crosslang.example", version: "1.3"},
+	{sdk: "js", domain: "js.crosslang.example", version: "1.4"},
+}
+
+func loadCrossLanguageFixture(t *testing.T, sdk string) (string, *discovery.WellKnownResponse) {
+	t.Helper()
+	base := filepath.Join("testdata", "crosslang", sdk)
+	data, err := os.ReadFile(filepath.Join(base, "well_known.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var disc discovery.WellKnownResponse
+	if err := json.Unmarshal(data, &disc); err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(base, "skill"), &disc
+}
+
+// copyDir copies the regular files under src to a new temporary directory.
+func copyDir(t *testing.T, src string) string {
+	t.Helper()
+	dst := t.TempDir()
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, data, 0644)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dst
+}
+
+func TestCrossLanguageFixturesVerify(t *testing.T) {
+	for _, fixture := range crossLanguageFixtures {
+		t.Run(fixture.sdk, func(t *testing.T) {
+			dir, disc := loadCrossLanguageFixture(t, fixture.sdk)
+			sig, err := LoadSignature(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sig.SchemapinVersion != fixture.version {
+				t.Errorf("expected a %s signature, got %q", fixture.version, sig.SchemapinVersion)
+			}
+
+			// The manifest pins down which file diverges if the root hash does
+			rootHash, manifest, err := CanonicalizeSkill(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for relPath, digest := range sig.FileManifest {
+				if manifest[relPath] != digest {
+					t.Errorf("%s: signed digest %s, Go computed %q", relPath, digest, manifest[relPath])
+				}
+			}
+			if len(manifest) != len(sig.FileManifest) {
+				t.Errorf("expected %d manifest entries, got %d: %v", len(sig.FileManifest), len(manifest), manifest)
+			}
+			if got := "sha256:" + hex.EncodeToString(rootHash); got != sig.SkillHash {
+				t.Errorf("expected root hash %s, got %s", sig.SkillHash, got)
+			}
+
+			result := VerifySkillOffline(dir, disc, nil, nil, verification.NewKeyPinStore(), "")
+			if !result.Valid {
+				t.Fatalf("expected the %s-signed skill to verify, got %s: %s", fixture.sdk, result.ErrorCode, result.ErrorMessage)
+			}
+			if result.Domain != fixture.domain {
+				t.Errorf("expected domain %q, got %q", fixture.domain, result.Domain)
+			}
+		})
+	}
+}
+
+func TestCrossLanguageFixturesDetectTampering(t *testing.T) {
+	for _, fixture := range crossLanguageFixtures {
+		t.Run(fixture.sdk, func(t *testing.T) {
+			src, disc := loadCrossLanguageFixture(t, fixture.sdk)
+			dir := copyDir(t, src)
+
+			binPath := filepath.Join(dir, "assets", "icons", "logo.bin")
+			data, err := os.ReadFile(binPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data[0] ^= 0xff
+			if err := os.WriteFile(binPath, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			result := VerifySkillOffline(dir, disc, nil, nil, nil, "")
+			if result.Valid || result.ErrorCode != verification.ErrSignatureInvalid {
+				t.Fatalf("expected a tampered binary file to fail, got valid=%v code=%s", result.Valid, result.ErrorCode)
+			}
+
+			sig, err := LoadSignature(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, manifest, err := CanonicalizeSkill(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tampered := DetectTamperedFiles(manifest, sig.FileManifest)
+			if len(tampered.Modified) != 1 || tampered.Modified[0] != "assets/icons/logo.bin" {
+				t.Errorf("expected only logo.bin to be modified, got %+v", tampered)
+			}
+		})
+	}
+}
+
+// TestCrossLanguageSourceHash checks that Go hashes the unsigned source tree
+// to the same root the other SDKs signed, so Go-signed copies verify there.
+func TestCrossLanguageSourceHash(t *testing.T) {
+	rootHash, _, err := CanonicalizeSkill(filepath.Join("testdata", "crosslang", "source"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fixture := range crossLanguageFixtures {
+		dir, _ := loadCrossLanguageFixture(t, fixture.sdk)
+		sig, err := LoadSignature(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := "sha256:" + hex.EncodeToString(rootHash); got != sig.SkillHash {
+			t.Errorf("%s: expected source root hash %s, got %s", fixture.sdk, sig.SkillHash, got)
+		}
+	}
+}
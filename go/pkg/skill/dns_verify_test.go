@@ -106,8 +106,8 @@ func TestVerifyWithDNSDoesNotPromoteFailure(t *testing.T) {
 	disc.SchemaVersion = "1.4"
 
 	// Even with a matching DNS record (matching the wrong key), the
-	// underlying signature failure should win and DNS should not be
-	// consulted.
+	// underlying failure (here the signer_kid no longer matching the
+	// discovered key) should win and DNS should not be consulted.
 	km := crypto.NewKeyManager()
 	fp, err := km.CalculateKeyFingerprintFromPEM(otherPubPEM)
 	if err != nil {
@@ -122,7 +122,7 @@ func TestVerifyWithDNSDoesNotPromoteFailure(t *testing.T) {
 	if result.Valid {
 		t.Error("expected underlying verification to fail")
 	}
-	if result.ErrorCode != verification.ErrSignatureInvalid {
-		t.Errorf("expected ErrorCode %s, got %s", verification.ErrSignatureInvalid, result.ErrorCode)
+	if result.ErrorCode != verification.ErrSignerKidMismatch {
+		t.Errorf("expected ErrorCode %s, got %s", verification.ErrSignerKidMismatch, result.ErrorCode)
 	}
 }
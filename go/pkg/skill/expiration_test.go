@@ -8,6 +8,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
 )
 
@@ -51,8 +52,32 @@ func TestSignWithTTLWritesExpiresAt(t *testing.T) {
 	}
 }
 
-// TestSignWithoutTTLOmitsExpiresAt ensures that the v1.3 default behaviour
-// is byte-compatible: no expires_at field, schemapin_version stays at "1.3".
+// TestSignWithClock confirms signed_at and expires_at come from
+// SignOptions.Clock, normalized to whole seconds in UTC.
+func TestSignWithClock(t *testing.T) {
+	privPEM, _ := makeKeypair(t)
+	dir := createSkillDir(t, map[string]string{
+		"SKILL.md": "---\nname: clocked\n---\n",
+	})
+	fake := clock.NewFake(time.Date(2026, 2, 3, 4, 5, 6, 789000000, time.FixedZone("CET", 3600)))
+
+	sig, err := SignSkillWithOptions(dir, privPEM, "example.com", SignOptions{
+		ExpiresIn: 48 * time.Hour,
+		Clock:     fake,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig.SignedAt != "2026-02-03T03:05:06Z" {
+		t.Errorf("signed_at = %q, want 2026-02-03T03:05:06Z", sig.SignedAt)
+	}
+	if sig.ExpiresAt != "2026-02-05T03:05:06Z" {
+		t.Errorf("expires_at = %q, want 2026-02-05T03:05:06Z", sig.ExpiresAt)
+	}
+}
+
+// TestSignWithoutTTLOmitsExpiresAt ensures that signing without a TTL
+// writes no expires_at field.
 func TestSignWithoutTTLOmitsExpiresAt(t *testing.T) {
 	privPEM, _ := makeKeypair(t)
 	dir := createSkillDir(t, map[string]string{
@@ -66,8 +91,8 @@ func TestSignWithoutTTLOmitsExpiresAt(t *testing.T) {
 	if sig.ExpiresAt != "" {
 		t.Errorf("expected ExpiresAt to be empty, got %q", sig.ExpiresAt)
 	}
-	if sig.SchemapinVersion != "1.3" {
-		t.Errorf("expected schemapin_version '1.3', got %q", sig.SchemapinVersion)
+	if sig.SchemapinVersion != "1.4" {
+		t.Errorf("expected schemapin_version '1.4', got %q", sig.SchemapinVersion)
 	}
 
 	raw, err := os.ReadFile(filepath.Join(dir, SignatureFilename))
@@ -0,0 +1,204 @@
+package skill
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// MaxFrontmatterBytes bounds how much of a SKILL.md is scanned for
+// frontmatter: the opening and closing "---" must both lie within it.
+const MaxFrontmatterBytes = 64 << 10
+
+// ParseFrontmatter parses the YAML-style frontmatter at the start of a
+// SKILL.md into its top-level "key: value" pairs. It reports false if text
+// has none.
+//
+// Frontmatter opens with a "---" line as the very first line, after an
+// optional UTF-8 byte order mark, and closes at the next "---" line, both
+// within MaxFrontmatterBytes. Lines may end in CRLF. Values may be double-
+// or single-quoted, in which case they can hold colons and "#"; otherwise a
+// trailing " # comment" is dropped. Indented lines, list items and
+// comments are skipped, and for a repeated key the first value wins.
+func ParseFrontmatter(text string) (map[string]string, bool) {
+	if len(text) > MaxFrontmatterBytes {
+		// Only complete lines count, so a cut line cannot pass for "---"
+		text = text[:MaxFrontmatterBytes]
+		text = text[:strings.LastIndexByte(text, '\n')+1]
+	}
+	text = strings.TrimPrefix(text, "\ufeff")
+
+	line, rest, _ := strings.Cut(text, "\n")
+	if !isFrontmatterDelimiter(line) {
+		return nil, false
+	}
+	fields := make(map[string]string)
+	for rest != "" {
+		line, rest, _ = strings.Cut(rest, "\n")
+		if isFrontmatterDelimiter(line) {
+			return fields, true
+		}
+		key, value, ok := frontmatterField(strings.TrimSuffix(line, "\r"))
+		if !ok {
+			continue
+		}
+		if _, seen := fields[key]; !seen {
+			fields[key] = value
+		}
+	}
+	return nil, false
+}
+
+// ParseSkillFrontmatter reads the frontmatter of skillDir's SKILL.md with
+// ParseFrontmatter. It returns a nil map without error if SKILL.md has
+// none, and an error wrapping fs.ErrNotExist if there is no SKILL.md.
+func ParseSkillFrontmatter(skillDir string) (map[string]string, error) {
+	file, err := os.Open(filepath.Join(skillDir, "SKILL.md")) // #nosec G304 -- path constructed from user-provided skill directory
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	// Frontmatter lies within the first MaxFrontmatterBytes, however large
+	// the file
+	data, err := io.ReadAll(io.LimitReader(file, MaxFrontmatterBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	fields, _ := ParseFrontmatter(string(data))
+	return fields, nil
+}
+
+// parseFrontmatterName returns the name field from SKILL.md frontmatter,
+// or "" if there is none (see frontmatterName).
+func parseFrontmatterName(text string) string {
+	fields, _ := ParseFrontmatter(text)
+	return frontmatterName(fields)
+}
+
+// frontmatterName returns the trimmed name field of fields, or "" if there
+// is none or it contains control characters. A double-quoted name can
+// spell those with escapes such as \n and \0, and they would otherwise
+// reach signatures, logs and terminals as the skill name.
+func frontmatterName(fields map[string]string) string {
+	name := strings.TrimSpace(fields["name"])
+	if strings.IndexFunc(name, unicode.IsControl) >= 0 {
+		return ""
+	}
+	return name
+}
+
+// isFrontmatterDelimiter reports whether line is a standalone "---".
+func isFrontmatterDelimiter(line string) bool {
+	return strings.TrimRight(line, " \t\r") == "---"
+}
+
+// frontmatterField parses a top-level "key: value" line.
+func frontmatterField(line string) (key, value string, ok bool) {
+	if line == "" || strings.ContainsAny(line[:1], " \t#-") {
+		return "", "", false
+	}
+	// The key ends at the first colon followed by a space or the end of
+	// the line, so that a value can hold colons
+	for i := 0; i < len(line); i++ {
+		if line[i] != ':' {
+			continue
+		}
+		if i+1 < len(line) && line[i+1] != ' ' && line[i+1] != '\t' {
+			continue
+		}
+		key = strings.TrimSpace(line[:i])
+		if key == "" {
+			return "", "", false
+		}
+		return key, frontmatterValue(line[i+1:]), true
+	}
+	return "", "", false
+}
+
+// frontmatterValue decodes a scalar value: double-quoted with backslash
+// escapes, single-quoted with a doubled quote for a quote, or plain with
+// any trailing comment removed. An unterminated quote is taken as part of
+// the value.
+func frontmatterValue(raw string) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return ""
+	}
+	switch raw[0] {
+	case '"':
+		if value, err := unquoteDouble(raw[1:]); err == nil {
+			return value
+		}
+		return strings.TrimSpace(stripComment(raw[1:]))
+	case '\'':
+		if value, err := unquoteSingle(raw[1:]); err == nil {
+			return value
+		}
+		return strings.TrimSpace(stripComment(raw[1:]))
+	}
+	return strings.TrimSpace(stripComment(raw))
+}
+
+var errUnterminatedQuote = errors.New("unterminated quote")
+
+// unquoteDouble decodes a double-quoted value after its opening quote.
+func unquoteDouble(s string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"':
+			return b.String(), nil
+		case c == '\\' && i+1 < len(s):
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case '0':
+				b.WriteByte(0)
+			default:
+				b.WriteByte(s[i])
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", errUnterminatedQuote
+}
+
+// unquoteSingle decodes a single-quoted value after its opening quote.
+func unquoteSingle(s string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\'' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+1 < len(s) && s[i+1] == '\'' {
+			b.WriteByte('\'')
+			i++
+			continue
+		}
+		return b.String(), nil
+	}
+	return "", errUnterminatedQuote
+}
+
+// stripComment removes a " # comment" from a plain value.
+func stripComment(s string) string {
+	if strings.HasPrefix(s, "#") {
+		return ""
+	}
+	for i := 1; i < len(s); i++ {
+		if s[i] == '#' && (s[i-1] == ' ' || s[i-1] == '\t') {
+			return s[:i]
+		}
+	}
+	return s
+}
@@ -0,0 +1,178 @@
+package skill
+
+import (
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode"
+)
+
+func TestParseFrontmatter(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want map[string]string
+	}{
+		{
+			name: "plain",
+			text: "---\nname: My Skill\nversion: 1.0\n---\n# Body\n",
+			want: map[string]string{"name": "My Skill", "version": "1.0"},
+		},
+		{
+			name: "byte order mark",
+			text: "\ufeff---\nname: BOM Skill\n---\n",
+			want: map[string]string{"name": "BOM Skill"},
+		},
+		{
+			name: "CRLF",
+			text: "---\r\nname: CRLF Skill\r\ndescription: Windows\r\n---\r\n# Body\r\n",
+			want: map[string]string{"name": "CRLF Skill", "description": "Windows"},
+		},
+		{
+			name: "quoted values with colons",
+			text: "---\nname: \"Skill: The Sequel\"\ntitle: 'It''s: here # not a comment'\nurl: https://example.com/a:b\n---\n",
+			want: map[string]string{"name": "Skill: The Sequel", "title": "It's: here # not a comment", "url": "https://example.com/a:b"},
+		},
+		{
+			name: "escapes and comments",
+			text: "---\nname: \"say \\\"hi\\\"\"\nplain: value # comment\nhash: a#b\n---\n",
+			want: map[string]string{"name": `say "hi"`, "plain": "value", "hash": "a#b"},
+		},
+		{
+			name: "nested and list lines skipped",
+			text: "---\nname: top\nmetadata:\n  name: nested\ntags:\n  - a\n- b\n# name: commented\n---\n",
+			want: map[string]string{"name": "top", "metadata": "", "tags": ""},
+		},
+		{
+			name: "first repeated key wins",
+			text: "---\nname: first\nname: second\n---\n",
+			want: map[string]string{"name": "first"},
+		},
+		{
+			name: "empty frontmatter",
+			text: "---\n---\n",
+			want: map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseFrontmatter(tt.text)
+			if !ok {
+				t.Fatal("Expected frontmatter")
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseFrontmatterAbsent(t *testing.T) {
+	huge := strings.Repeat("- - - ---- --\n", (4*MaxFrontmatterBytes)/14)
+	tests := []struct {
+		name string
+		text string
+	}{
+		{"no frontmatter", "# Title\n\nname: body\n"},
+		{"fake frontmatter mid-document", "# Title\n\n---\nname: Fake\n---\n"},
+		{"blank first line", "\n---\nname: Late\n---\n"},
+		{"longer opening rule", "----\nname: Rule\n----\n"},
+		{"opening rule with text", "--- name: Inline\nname: x\n---\n"},
+		{"unterminated", "---\nname: Open\n# Body\n```\nname: code\n```\n"},
+		{"closing beyond the limit", "---\nname: Far\n" + huge + "---\n"},
+		{"huge dashes", "---\n" + huge},
+		{"empty", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, ok := ParseFrontmatter(tt.text); ok || got != nil {
+				t.Errorf("Expected no frontmatter, got %q", got)
+			}
+		})
+	}
+}
+
+func TestParseFrontmatterStopsAtClosingRule(t *testing.T) {
+	// A later "---" pair in the body, e.g. around a code block, is not
+	// frontmatter
+	text := "---\ndescription: no name\n---\n# Usage\n\n---\n```yaml\nname: fake\n```\n---\n"
+	got, ok := ParseFrontmatter(text)
+	if !ok || got["name"] != "" || got["description"] != "no name" {
+		t.Errorf("Expected only the description, got %q, %v", got, ok)
+	}
+}
+
+func TestParseSkillNameLargeFile(t *testing.T) {
+	body := strings.Repeat("name: not this one\n---\n", (8<<20)/23)
+	dir := createSkillDir(t, map[string]string{
+		"SKILL.md": "\ufeff---\r\nname: \"Big: Skill\"\r\n---\r\n" + body,
+	})
+	if name := ParseSkillName(dir); name != "Big: Skill" {
+		t.Errorf("Expected 'Big: Skill', got %q", name)
+	}
+
+	fields, err := ParseSkillFrontmatter(dir)
+	if err != nil || !reflect.DeepEqual(fields, map[string]string{"name": "Big: Skill"}) {
+		t.Errorf("Expected the frontmatter fields, got %q, %v", fields, err)
+	}
+}
+
+func TestParseSkillNameControlCharacters(t *testing.T) {
+	tests := []struct {
+		name    string
+		skillMD string
+	}{
+		{"escaped newline and NUL", "---\nname: \"a\\nb\\0\"\n---\n"},
+		{"escaped tab", "---\nname: \"a\\tb\"\n---\n"},
+		{"raw escape character", "---\nname: a\x1b[31mb\n---\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := createSkillDir(t, map[string]string{"SKILL.md": tt.skillMD})
+			if name := ParseSkillName(dir); name != filepath.Base(dir) {
+				t.Errorf("Expected the directory name %q, got %q", filepath.Base(dir), name)
+			}
+			if name := parseFrontmatterName(tt.skillMD); name != "" {
+				t.Errorf("Expected no name, got %q", name)
+			}
+		})
+	}
+}
+
+// FuzzParseFrontmatter checks that the parser never panics, only finds
+// frontmatter opened on the first line, and that the name it finds is the
+// one ParseSkillName would use and holds no control characters.
+func FuzzParseFrontmatter(f *testing.F) {
+	f.Add("---\nname: Skill\n---\n")
+	f.Add("\ufeff---\r\nname: \"a: b\"\r\n---\r\n")
+	f.Add("---\nname: 'it''s'\ntags:\n  - x\n---\nbody")
+	f.Add("---\nname: \"unterminated\n---\n")
+	f.Add("# Title\n---\nname: fake\n---\n")
+	f.Add("---\nname: \"a\\nb\\0\"\n---\n")
+
+	f.Fuzz(func(t *testing.T, text string) {
+		fields, ok := ParseFrontmatter(text)
+		if ok != (fields != nil) {
+			t.Fatalf("ok = %v with fields %q", ok, fields)
+		}
+		if !ok {
+			return
+		}
+		if !strings.HasPrefix(strings.TrimPrefix(text, "\ufeff"), "---") {
+			t.Fatalf("frontmatter found without an opening rule in %q", text)
+		}
+		for key := range fields {
+			if key == "" || strings.ContainsAny(key, "\n") {
+				t.Fatalf("invalid key %q", key)
+			}
+		}
+		name := parseFrontmatterName(text)
+		if name != frontmatterName(fields) {
+			t.Fatalf("name %q, fields %q", name, fields)
+		}
+		if strings.IndexFunc(name, unicode.IsControl) >= 0 {
+			t.Fatalf("name %q holds control characters", name)
+		}
+	})
+}
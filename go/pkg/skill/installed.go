@@ -0,0 +1,200 @@
+// Batch verification of skills installed under a common root directory.
+
+package skill
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/provenance"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/resolver"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+// SkillStatus summarizes the verification outcome for one installed skill.
+type SkillStatus string
+
+const (
+	// SkillStatusValid means the skill's signature verified.
+	SkillStatusValid SkillStatus = "valid"
+	// SkillStatusTampered means verification failed and the files on disk
+	// differ from the signed manifest.
+	SkillStatusTampered SkillStatus = "tampered"
+	// SkillStatusInvalid means verification failed for another reason
+	// (unknown key, revoked key, unreadable signature, ...).
+	SkillStatusInvalid SkillStatus = "invalid"
+	// SkillStatusUnsigned means the directory has no .schemapin.sig.
+	SkillStatusUnsigned SkillStatus = "unsigned"
+)
+
+// SkillReport is the per-skill result of VerifyInstalledSkills.
+type SkillReport struct {
+	Name     string                           `json:"name"`
+	Path     string                           `json:"path"`
+	Status   SkillStatus                      `json:"status"`
+	Result   *verification.VerificationResult `json:"result,omitempty"`
+	Tampered *TamperedFiles                   `json:"tampered,omitempty"`
+}
+
+// VerifyOption configures VerifyInstalledSkills.
+type VerifyOption func(*VerifyOptions)
+
+// WithConcurrency sets how many skills are verified in parallel. Values
+// below 1 are treated as 1.
+func WithConcurrency(n int) VerifyOption {
+	return func(o *VerifyOptions) {
+		o.Concurrency = n
+	}
+}
+
+// WithContentPolicy applies policy to every signed skill.
+func WithContentPolicy(policy *verification.ContentPolicy) VerifyOption {
+	return func(o *VerifyOptions) {
+		o.ContentPolicy = policy
+	}
+}
+
+// WithAllowNewMutableFiles accepts files added after signing that match a
+// signature's mutable paths.
+func WithAllowNewMutableFiles(allow bool) VerifyOption {
+	return func(o *VerifyOptions) {
+		o.AllowNewMutableFiles = allow
+	}
+}
+
+// WithStrictPermissions fails skills whose files' executable bits differ
+// from the signed ones, instead of only reporting them.
+func WithStrictPermissions(strict bool) VerifyOption {
+	return func(o *VerifyOptions) {
+		o.StrictPermissions = strict
+	}
+}
+
+// WithProvenance checks the provenance attached to signatures (see
+// VerifyOptions.Provenance).
+func WithProvenance(config *provenance.Config) VerifyOption {
+	return func(o *VerifyOptions) {
+		o.Provenance = config
+	}
+}
+
+// WithProgress calls progress as each skill's files are hashed, with
+// Progress.Skill naming the skill. Calls are serialized, but reports of
+// skills verified in parallel interleave.
+func WithProgress(progress ProgressFunc) VerifyOption {
+	return func(o *VerifyOptions) {
+		o.Progress = progress
+	}
+}
+
+// VerifyInstalledSkills verifies every immediate subdirectory of root as a
+// skill, resolving each skill's signing domain through r. Directories
+// without a .schemapin.sig are reported as unsigned rather than treated as
+// errors; failed verifications are diffed against the signed manifest to
+// distinguish tampering from other failures. Reports are sorted by name.
+// A valid skill whose executable bits changed since signing keeps its
+// status and lists the files in Tampered.PermissionChanged.
+//
+// The returned error is non-nil only when root itself cannot be read.
+func VerifyInstalledSkills(root string, r resolver.SchemaResolver, pinStore *verification.KeyPinStore, opts ...VerifyOption) ([]SkillReport, error) {
+	var options VerifyOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	concurrency := options.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read skills root %s: %w", root, err)
+	}
+
+	var dirs []string
+	for _, entry := range entries {
+		if entry.IsDir() {
+			dirs = append(dirs, entry.Name())
+		}
+	}
+	sort.Strings(dirs)
+
+	var progressMu sync.Mutex
+	progress := options.Progress
+	reports := make([]SkillReport, len(dirs))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, name := range dirs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, name string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			options := options
+			if progress != nil {
+				options.Progress = func(p Progress) {
+					progressMu.Lock()
+					defer progressMu.Unlock()
+					p.Skill = name
+					progress(p)
+				}
+			}
+			reports[i] = verifyInstalledSkill(filepath.Join(root, name), name, r, pinStore, options)
+		}(i, name)
+	}
+	wg.Wait()
+
+	return reports, nil
+}
+
+func verifyInstalledSkill(skillDir, name string, r resolver.SchemaResolver, pinStore *verification.KeyPinStore, options VerifyOptions) SkillReport {
+	report := SkillReport{Name: name, Path: skillDir}
+
+	if _, err := os.Stat(filepath.Join(skillDir, SignatureFilename)); os.IsNotExist(err) {
+		report.Status = SkillStatusUnsigned
+		return report
+	}
+
+	sig, err := LoadSignatureWithLimits(skillDir, options.ManifestLimits)
+	if err != nil {
+		report.Status = SkillStatusInvalid
+		report.Result = &verification.VerificationResult{
+			Valid:        false,
+			ErrorCode:    verification.ErrSignatureInvalid,
+			ErrorMessage: err.Error(),
+		}
+		return report
+	}
+
+	report.Result = verifySkillWithResolver(skillDir, sig.Domain, sig, r, pinStore, "", options)
+	if report.Result.Valid {
+		report.Status = SkillStatusValid
+		if len(report.Result.PermissionChanged) > 0 {
+			report.Tampered = &TamperedFiles{
+				Modified:          []string{},
+				Added:             []string{},
+				Removed:           []string{},
+				PermissionChanged: report.Result.PermissionChanged,
+			}
+		}
+		return report
+	}
+
+	report.Status = SkillStatusInvalid
+	if current, err := signedManifest(skillDir, sig, options.ManifestLimits); err == nil {
+		if tracksExecBits(sig.FileManifest) {
+			if executable, err := manifestExecBits(skillDir, current); err == nil {
+				current = withExecBits(current, executable)
+			}
+		}
+		tampered := withoutMutablePaths(DetectTamperedFiles(current, sig.FileManifest), sig.MutablePaths, options.AllowNewMutableFiles)
+		if len(tampered.Modified)+len(tampered.Added)+len(tampered.Removed)+len(tampered.PermissionChanged) > 0 {
+			report.Status = SkillStatusTampered
+			report.Tampered = tampered
+		}
+	}
+	return report
+}
@@ -0,0 +1,125 @@
+package skill
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/bundle"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/resolver"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+func writeSkill(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for relPath, content := range files {
+		full := filepath.Join(dir, filepath.FromSlash(relPath))
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// buildInstalledRoot creates a skills root with one valid, one tampered,
+// and one unsigned skill, plus a stray file that must be ignored.
+func buildInstalledRoot(t *testing.T) (string, resolver.SchemaResolver) {
+	t.Helper()
+	privPEM, pubPEM := makeKeypair(t)
+	root := t.TempDir()
+
+	for _, name := range []string{"alpha", "beta"} {
+		dir := filepath.Join(root, name)
+		writeSkill(t, dir, map[string]string{
+			"SKILL.md": "---\nname: " + name + "\n---\n",
+			"main.py":  "print('" + name + "')",
+		})
+		if _, err := SignSkill(dir, privPEM, "example.com", "", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeSkill(t, filepath.Join(root, "beta"), map[string]string{
+		"main.py":  "print('pwned')",
+		"extra.sh": "rm -rf /",
+	})
+	writeSkill(t, filepath.Join(root, "gamma"), map[string]string{"SKILL.md": "unsigned"})
+	writeSkill(t, root, map[string]string{"README.txt": "not a skill"})
+
+	b, err := bundle.ParseTrustBundle(buildTrustBundleJSON(t, pubPEM, "example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root, resolver.NewTrustBundleResolver(b)
+}
+
+func TestVerifyInstalledSkills(t *testing.T) {
+	root, r := buildInstalledRoot(t)
+
+	for _, concurrency := range []int{1, 4} {
+		reports, err := VerifyInstalledSkills(root, r, verification.NewKeyPinStore(), WithConcurrency(concurrency))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(reports) != 3 {
+			t.Fatalf("expected 3 reports, got %d", len(reports))
+		}
+
+		want := map[string]SkillStatus{
+			"alpha": SkillStatusValid,
+			"beta":  SkillStatusTampered,
+			"gamma": SkillStatusUnsigned,
+		}
+		for _, report := range reports {
+			if report.Status != want[report.Name] {
+				t.Errorf("concurrency %d: %s: expected status %q, got %q", concurrency, report.Name, want[report.Name], report.Status)
+			}
+		}
+
+		valid, tampered, unsigned := reports[0], reports[1], reports[2]
+		if valid.Result == nil || !valid.Result.Valid || valid.Result.DiscoverySource != resolver.SourceBundle {
+			t.Errorf("expected valid result from bundle for alpha, got %+v", valid.Result)
+		}
+		if tampered.Tampered == nil || len(tampered.Tampered.Modified) != 1 || tampered.Tampered.Modified[0] != "main.py" {
+			t.Errorf("expected main.py modified for beta, got %+v", tampered.Tampered)
+		}
+		if len(tampered.Tampered.Added) != 1 || tampered.Tampered.Added[0] != "extra.sh" {
+			t.Errorf("expected extra.sh added for beta, got %+v", tampered.Tampered.Added)
+		}
+		if tampered.Result == nil || tampered.Result.ErrorCode != verification.ErrSignatureInvalid {
+			t.Errorf("expected signature_invalid for beta, got %+v", tampered.Result)
+		}
+		if unsigned.Result != nil || unsigned.Tampered != nil {
+			t.Errorf("expected no result for unsigned gamma, got %+v", unsigned)
+		}
+	}
+}
+
+func TestVerifyInstalledSkillsUnknownDomain(t *testing.T) {
+	root := t.TempDir()
+	privPEM, _ := makeKeypair(t)
+	dir := filepath.Join(root, "orphan")
+	writeSkill(t, dir, map[string]string{"main.py": "print('x')"})
+	if _, err := SignSkill(dir, privPEM, "unknown.example", "", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	_, r := buildInstalledRoot(t)
+	reports, err := VerifyInstalledSkills(root, r, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reports) != 1 || reports[0].Status != SkillStatusInvalid {
+		t.Fatalf("expected one invalid report, got %+v", reports)
+	}
+	if reports[0].Result.ErrorCode != verification.ErrDiscoveryFetchFailed {
+		t.Errorf("expected discovery_fetch_failed, got %q", reports[0].Result.ErrorCode)
+	}
+}
+
+func TestVerifyInstalledSkillsMissingRoot(t *testing.T) {
+	if _, err := VerifyInstalledSkills(filepath.Join(t.TempDir(), "missing"), nil, nil); err == nil {
+		t.Error("expected error for missing root")
+	}
+}
@@ -0,0 +1,252 @@
+// Size limits for skill file manifests and the split manifest layout, where
+// the manifest is written to .schemapin.manifest next to the signature.
+
+package skill
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ManifestFilename is the name of the file a split-manifest signature
+// (SignOptions.SplitManifest) keeps its file manifest in. Like
+// SignatureFilename, it is never part of the manifest itself.
+const ManifestFilename = ".schemapin.manifest"
+
+// ManifestLimits bounds the file manifests read by LoadSignature and built
+// by CanonicalizeSkill. Zero fields take the value from
+// DefaultManifestLimits.
+type ManifestLimits struct {
+	// MaxFiles is the maximum number of files in a manifest.
+	MaxFiles int
+	// MaxManifestBytes is the maximum size of a .schemapin.sig or
+	// .schemapin.manifest file, and of the paths and digests of a
+	// canonicalized skill.
+	MaxManifestBytes int64
+}
+
+// DefaultManifestLimits are the limits used for fields left zero in
+// ManifestLimits.
+var DefaultManifestLimits = ManifestLimits{
+	MaxFiles:         200000,
+	MaxManifestBytes: 64 << 20,
+}
+
+func (l ManifestLimits) withDefaults() ManifestLimits {
+	if l.MaxFiles <= 0 {
+		l.MaxFiles = DefaultManifestLimits.MaxFiles
+	}
+	if l.MaxManifestBytes <= 0 {
+		l.MaxManifestBytes = DefaultManifestLimits.MaxManifestBytes
+	}
+	return l
+}
+
+// ManifestLimitError is returned for a signature or skill directory whose
+// manifest exceeds ManifestLimits.
+type ManifestLimitError struct {
+	Limit string
+	Max   int64
+}
+
+func (e *ManifestLimitError) Error() string {
+	return fmt.Sprintf("skill manifest exceeds the limit of %d %s", e.Max, e.Limit)
+}
+
+// manifestBuilder collects a manifest during a directory walk, failing as
+// soon as it outgrows its limits.
+type manifestBuilder struct {
+	manifest map[string]string
+	limits   ManifestLimits
+	size     int64
+	hashed   hashStats
+	progress *progressReporter
+}
+
+// hashStats counts the files and bytes a canonicalization hashed,
+// including those of nested skills.
+type hashStats struct {
+	files int
+	bytes int64
+}
+
+func (h *hashStats) add(size int64) {
+	h.files++
+	h.bytes += size
+}
+
+func newManifestBuilder(limits ManifestLimits) *manifestBuilder {
+	return &manifestBuilder{manifest: make(map[string]string), limits: limits.withDefaults()}
+}
+
+// reserve checks that one more file fits before it is hashed.
+func (b *manifestBuilder) reserve() error {
+	if len(b.manifest) >= b.limits.MaxFiles {
+		return &ManifestLimitError{Limit: "files", Max: int64(b.limits.MaxFiles)}
+	}
+	return nil
+}
+
+func (b *manifestBuilder) add(relPath, digest string) error {
+	b.size += int64(len(relPath) + len(digest))
+	if b.size > b.limits.MaxManifestBytes {
+		return &ManifestLimitError{Limit: "bytes", Max: b.limits.MaxManifestBytes}
+	}
+	b.manifest[relPath] = digest
+	return nil
+}
+
+// skillManifest is the content of a .schemapin.manifest file.
+type skillManifest struct {
+	FileManifest map[string]string `json:"file_manifest"`
+	FileSizes    map[string]int64  `json:"file_sizes,omitempty"`
+}
+
+// splitManifest moves the manifest and file sizes of sig into the encoded
+// .schemapin.manifest content, recording its hash in sig.ManifestHash.
+func splitManifest(sig *SkillSignature) ([]byte, error) {
+	data, err := json.Marshal(skillManifest{FileManifest: sig.FileManifest, FileSizes: sig.FileSizes})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+	data = append(data, '\n')
+	digest := sha256.Sum256(data)
+	sig.ManifestHash = "sha256:" + hex.EncodeToString(digest[:])
+	sig.FileManifest, sig.FileSizes = nil, nil
+	return data, nil
+}
+
+// readLimited reads a file of at most max bytes.
+func readLimited(filePath string, max int64) ([]byte, error) {
+	f, err := os.Open(filePath) // #nosec G304 -- path constructed from user-provided skill directory
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, max+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > max {
+		return nil, &ManifestLimitError{Limit: "bytes", Max: max}
+	}
+	return data, nil
+}
+
+// resolveManifest returns sig with the manifest of a split-manifest
+// signature read from skillDir and checked against sig.ManifestHash.
+// Inline signatures, and split ones already resolved, are returned as is.
+func resolveManifest(skillDir string, sig *SkillSignature, limits ManifestLimits) (*SkillSignature, error) {
+	limits = limits.withDefaults()
+	if sig.ManifestHash != "" && sig.FileManifest == nil {
+		data, err := readLimited(filepath.Join(skillDir, ManifestFilename), limits.MaxManifestBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read manifest file: %w", err)
+		}
+		digest := sha256.Sum256(data)
+		if got := "sha256:" + hex.EncodeToString(digest[:]); got != sig.ManifestHash {
+			return nil, fmt.Errorf("%s does not match the signature's manifest_hash: got %s, want %s", ManifestFilename, got, sig.ManifestHash)
+		}
+		var manifest skillManifest
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return nil, fmt.Errorf("failed to parse manifest file: %w", err)
+		}
+		if manifest.FileManifest == nil {
+			return nil, fmt.Errorf("%s has no file_manifest", ManifestFilename)
+		}
+		resolved := *sig
+		resolved.FileManifest, resolved.FileSizes = manifest.FileManifest, manifest.FileSizes
+		sig = &resolved
+	}
+	if len(sig.FileManifest) > limits.MaxFiles {
+		return nil, &ManifestLimitError{Limit: "files", Max: int64(limits.MaxFiles)}
+	}
+	return sig, nil
+}
+
+// writeManifestFile writes the .schemapin.manifest content of a
+// split-manifest signature, or removes a stale one when data is nil.
+func writeManifestFile(skillDir string, data []byte) error {
+	manifestPath := filepath.Join(skillDir, ManifestFilename)
+	if data == nil {
+		if err := os.Remove(manifestPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove stale manifest file: %w", err)
+		}
+		return nil
+	}
+	if err := os.WriteFile(manifestPath, data, 0600); err != nil { // #nosec G306
+		return fmt.Errorf("failed to write manifest file: %w", err)
+	}
+	return nil
+}
+
+// FileChange is how a file differs between a current and a signed
+// manifest.
+type FileChange int
+
+const (
+	FileModified FileChange = iota + 1
+	FileAdded
+	FileRemoved
+	// FilePermissionChanged is a file with unchanged content whose
+	// executable bit differs, when both manifests record one.
+	FilePermissionChanged
+)
+
+// WalkTamperedFiles calls visit, in path order, for every file that was
+// modified, added, removed or had its executable bit changed in current
+// relative to signed, stopping at the first error. It sorts each
+// manifest's paths once and merges them, so huge manifests are not
+// collected into per-change slices.
+func WalkTamperedFiles(current, signed map[string]string, visit func(path string, change FileChange) error) error {
+	currentPaths, signedPaths := sortedKeys(current), sortedKeys(signed)
+	i, j := 0, 0
+	for i < len(currentPaths) || j < len(signedPaths) {
+		var (
+			name   string
+			change FileChange
+		)
+		switch {
+		case j == len(signedPaths) || (i < len(currentPaths) && currentPaths[i] < signedPaths[j]):
+			name, change = currentPaths[i], FileAdded
+			i++
+		case i == len(currentPaths) || signedPaths[j] < currentPaths[i]:
+			name, change = signedPaths[j], FileRemoved
+			j++
+		default:
+			name = currentPaths[i]
+			i++
+			j++
+			currentDigest, currentMode := splitManifestEntry(current[name])
+			signedDigest, signedMode := splitManifestEntry(signed[name])
+			switch {
+			case currentDigest != signedDigest:
+				change = FileModified
+			case currentMode != "" && signedMode != "" && currentMode != signedMode:
+				change = FilePermissionChanged
+			default:
+				continue
+			}
+		}
+		if err := visit(name, change); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
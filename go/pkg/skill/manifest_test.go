@@ -0,0 +1,358 @@
+package skill
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+// signBothLayouts signs two copies of the same tree, inline and split,
+// with the same key and time.
+func signBothLayouts(t *testing.T, files map[string]string, options SignOptions) (inline, split, pubPEM string) {
+	t.Helper()
+	privPEM, pubPEM := makeKeypair(t)
+	options.Clock = clock.NewFake(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC))
+	options.RecordFileSizes = true
+	inline, split = createSkillDir(t, files), createSkillDir(t, files)
+	if _, err := SignSkillWithOptions(inline, privPEM, "example.com", options); err != nil {
+		t.Fatal(err)
+	}
+	options.SplitManifest = true
+	if _, err := SignSkillWithOptions(split, privPEM, "example.com", options); err != nil {
+		t.Fatal(err)
+	}
+	return inline, split, pubPEM
+}
+
+func TestSplitManifestLayout(t *testing.T) {
+	inline, split, _ := signBothLayouts(t, mutableSkillFiles(), SignOptions{})
+
+	var raw map[string]interface{}
+	data, err := os.ReadFile(filepath.Join(split, SignatureFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := raw["file_manifest"]; ok {
+		t.Error("expected no file_manifest in a split signature")
+	}
+	if _, ok := raw["file_sizes"]; ok {
+		t.Error("expected no file_sizes in a split signature")
+	}
+	if _, err := os.Stat(filepath.Join(inline, ManifestFilename)); !os.IsNotExist(err) {
+		t.Errorf("expected no %s for an inline signature", ManifestFilename)
+	}
+
+	inlineSig, err := LoadSignature(inline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	splitSig, err := LoadSignature(split)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(splitSig.ManifestHash, "sha256:") {
+		t.Errorf("expected a manifest_hash, got %q", splitSig.ManifestHash)
+	}
+	if !reflect.DeepEqual(inlineSig.FileManifest, splitSig.FileManifest) || !reflect.DeepEqual(inlineSig.FileSizes, splitSig.FileSizes) {
+		t.Error("expected LoadSignature to return the same manifest for both layouts")
+	}
+	if inlineSig.SkillHash != splitSig.SkillHash {
+		t.Errorf("expected the same skill_hash, got %s and %s", inlineSig.SkillHash, splitSig.SkillHash)
+	}
+}
+
+func TestSplitManifestVerificationMatchesInline(t *testing.T) {
+	tests := []struct {
+		name    string
+		options VerifyOptions
+		mutate  func(t *testing.T, dir string)
+		valid   bool
+	}{
+		{name: "unchanged", valid: true},
+		{name: "modified file", mutate: func(t *testing.T, dir string) {
+			writeSkillFile(t, dir, "scripts/run.sh", "#!/bin/sh\nrm -rf /\n")
+		}},
+		{name: "added file", mutate: func(t *testing.T, dir string) {
+			writeSkillFile(t, dir, "extra.txt", "x")
+		}},
+		{name: "removed file", mutate: func(t *testing.T, dir string) {
+			if err := os.Remove(filepath.Join(dir, "scripts/run.sh")); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{name: "mutable file changed", valid: true, mutate: func(t *testing.T, dir string) {
+			writeSkillFile(t, dir, "state/db.json", `{"count": 1}`)
+		}},
+		{name: "new mutable file", valid: true, options: VerifyOptions{AllowNewMutableFiles: true}, mutate: func(t *testing.T, dir string) {
+			writeSkillFile(t, dir, "state/new.json", "{}")
+		}},
+		{name: "content policy", options: VerifyOptions{ContentPolicy: &verification.ContentPolicy{MaxFileSize: 4}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inline, split, pubPEM := signBothLayouts(t, mutableSkillFiles(), SignOptions{MutablePaths: []string{"state/**"}})
+			if tt.mutate != nil {
+				tt.mutate(t, inline)
+				tt.mutate(t, split)
+			}
+
+			inlineResult := VerifySkillOfflineWithOptions(inline, makeDiscovery(pubPEM), nil, nil, nil, "tool", tt.options)
+			splitResult := VerifySkillOfflineWithOptions(split, makeDiscovery(pubPEM), nil, nil, nil, "tool", tt.options)
+			if inlineResult.Valid != tt.valid {
+				t.Errorf("expected valid=%v, got %+v", tt.valid, inlineResult)
+			}
+			if !reflect.DeepEqual(inlineResult, splitResult) {
+				t.Errorf("results differ:\ninline: %+v\nsplit:  %+v", inlineResult, splitResult)
+			}
+
+			inlineSig, _ := LoadSignature(inline)
+			splitSig, _ := LoadSignature(split)
+			_, inlineCurrent, _ := CanonicalizeSkill(inline)
+			_, splitCurrent, _ := CanonicalizeSkill(split)
+			if !reflect.DeepEqual(DetectTamperedFiles(inlineCurrent, inlineSig.FileManifest), DetectTamperedFiles(splitCurrent, splitSig.FileManifest)) {
+				t.Error("expected the same tampered files for both layouts")
+			}
+		})
+	}
+}
+
+func writeSkillFile(t *testing.T, dir, relPath, content string) {
+	t.Helper()
+	full := filepath.Join(dir, filepath.FromSlash(relPath))
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSplitManifestTampered(t *testing.T) {
+	_, split, pubPEM := signBothLayouts(t, mutableSkillFiles(), SignOptions{})
+	manifestPath := filepath.Join(split, ManifestFilename)
+	data, err := os.ReadFile(manifestPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(manifestPath, []byte(strings.Replace(string(data), "sha256:", "sha256:0", 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadSignature(split); err == nil || !strings.Contains(err.Error(), "manifest_hash") {
+		t.Errorf("expected a manifest_hash mismatch, got %v", err)
+	}
+	result := VerifySkillOfflineWithOptions(split, makeDiscovery(pubPEM), nil, nil, nil, "tool", VerifyOptions{})
+	if result.Valid || result.ErrorCode != verification.ErrSignatureInvalid {
+		t.Errorf("expected SIGNATURE_INVALID, got %+v", result)
+	}
+
+	if err := os.Remove(manifestPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadSignature(split); err == nil {
+		t.Error("expected an error for a missing manifest file")
+	}
+}
+
+func TestSignInlineRemovesStaleManifest(t *testing.T) {
+	_, split, _ := signBothLayouts(t, mutableSkillFiles(), SignOptions{})
+	privPEM, pubPEM := makeKeypair(t)
+	if _, err := SignSkill(split, privPEM, "example.com", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(split, ManifestFilename)); !os.IsNotExist(err) {
+		t.Errorf("expected %s to be removed", ManifestFilename)
+	}
+	if result := VerifySkillOffline(split, makeDiscovery(pubPEM), nil, nil, nil, "tool"); !result.Valid {
+		t.Errorf("expected a valid inline signature, got %+v", result)
+	}
+}
+
+func TestManifestLimits(t *testing.T) {
+	files := map[string]string{"SKILL.md": "# s"}
+	for i := 0; i < 10; i++ {
+		files[fmt.Sprintf("f%02d.txt", i)] = "x"
+	}
+	dir := createSkillDir(t, files)
+
+	var limitErr *ManifestLimitError
+	if _, _, err := CanonicalizeSkillWithLimits(dir, "", ManifestLimits{MaxFiles: 5}); !errors.As(err, &limitErr) || limitErr.Limit != "files" {
+		t.Errorf("expected a files limit error, got %v", err)
+	}
+	if _, _, err := CanonicalizeSkillWithLimits(dir, "", ManifestLimits{MaxManifestBytes: 200}); !errors.As(err, &limitErr) || limitErr.Limit != "bytes" {
+		t.Errorf("expected a bytes limit error, got %v", err)
+	}
+	if _, manifest, err := CanonicalizeSkillWithLimits(dir, "", ManifestLimits{MaxFiles: 11}); err != nil || len(manifest) != 11 {
+		t.Errorf("expected 11 files within the limit, got %d, %v", len(manifest), err)
+	}
+
+	privPEM, pubPEM := makeKeypair(t)
+	if _, err := SignSkillWithOptions(dir, privPEM, "example.com", SignOptions{ManifestLimits: ManifestLimits{MaxFiles: 5}}); !errors.As(err, &limitErr) {
+		t.Errorf("expected signing to fail with a limit error, got %v", err)
+	}
+	for _, split := range []bool{false, true} {
+		if _, err := SignSkillWithOptions(dir, privPEM, "example.com", SignOptions{SplitManifest: split}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadSignatureWithLimits(dir, ManifestLimits{MaxFiles: 5}); !errors.As(err, &limitErr) || limitErr.Limit != "files" {
+			t.Errorf("split=%v: expected a files limit error, got %v", split, err)
+		}
+		if _, err := LoadSignatureWithLimits(dir, ManifestLimits{MaxManifestBytes: 300}); !errors.As(err, &limitErr) || limitErr.Limit != "bytes" {
+			t.Errorf("split=%v: expected a bytes limit error, got %v", split, err)
+		}
+		result := VerifySkillOfflineWithOptions(dir, makeDiscovery(pubPEM), nil, nil, nil, "tool", VerifyOptions{ManifestLimits: ManifestLimits{MaxFiles: 5}})
+		if result.Valid {
+			t.Errorf("split=%v: expected verification over the limit to fail", split)
+		}
+	}
+}
+
+func TestWalkTamperedFiles(t *testing.T) {
+	signed := map[string]string{"a": "1", "b": "2", "c": "3", "e": "5"}
+	current := map[string]string{"a": "1", "b": "x", "d": "4", "e": "5", "f": "6"}
+
+	var got []string
+	err := WalkTamperedFiles(current, signed, func(path string, change FileChange) error {
+		got = append(got, fmt.Sprintf("%s:%d", path, change))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		fmt.Sprintf("b:%d", FileModified),
+		fmt.Sprintf("c:%d", FileRemoved),
+		fmt.Sprintf("d:%d", FileAdded),
+		fmt.Sprintf("f:%d", FileAdded),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	if err := WalkTamperedFiles(current, signed, func(string, FileChange) error { calls++; return stop }); err != stop || calls != 1 {
+		t.Errorf("expected the walk to stop at the first error, got %v after %d calls", err, calls)
+	}
+}
+
+// --- Benchmarks on synthetic trees ---
+
+// benchmarkTree writes a skill with n small files spread over directories
+// of 100 files each.
+func benchmarkTree(b *testing.B, n int) string {
+	b.Helper()
+	dir := b.TempDir()
+	writeFile := func(relPath, content string) {
+		full := filepath.Join(dir, filepath.FromSlash(relPath))
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			b.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			b.Fatal(err)
+		}
+	}
+	writeFile("SKILL.md", "---\nname: bench\n---\n")
+	for i := 1; i < n; i++ {
+		writeFile(fmt.Sprintf("d%04d/f%03d.txt", i/100, i%100), fmt.Sprintf("file %d", i))
+	}
+	return dir
+}
+
+func benchmarkKeys(b *testing.B) (string, string) {
+	b.Helper()
+	km := crypto.NewKeyManager()
+	priv, err := km.GenerateKeypairFromSeed([]byte("skill-bench"), crypto.ForTesting)
+	if err != nil {
+		b.Fatal(err)
+	}
+	privPEM, _ := km.ExportPrivateKeyPEM(priv)
+	pubPEM, _ := km.ExportPublicKeyPEM(&priv.PublicKey)
+	return privPEM, pubPEM
+}
+
+var benchmarkSizes = []int{1000, 10000, 100000}
+
+func BenchmarkCanonicalizeSkill(b *testing.B) {
+	for _, n := range benchmarkSizes {
+		b.Run(fmt.Sprintf("files=%d", n), func(b *testing.B) {
+			dir := benchmarkTree(b, n)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, _, err := CanonicalizeSkill(dir); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkSignSkill(b *testing.B) {
+	privPEM, _ := benchmarkKeys(b)
+	for _, n := range benchmarkSizes {
+		for _, split := range []bool{false, true} {
+			b.Run(fmt.Sprintf("files=%d/split=%v", n, split), func(b *testing.B) {
+				dir := benchmarkTree(b, n)
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if _, err := SignSkillWithOptions(dir, privPEM, "example.com", SignOptions{SplitManifest: split}); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkVerifySkill(b *testing.B) {
+	privPEM, pubPEM := benchmarkKeys(b)
+	disc := makeDiscovery(pubPEM)
+	for _, n := range benchmarkSizes {
+		for _, split := range []bool{false, true} {
+			b.Run(fmt.Sprintf("files=%d/split=%v", n, split), func(b *testing.B) {
+				dir := benchmarkTree(b, n)
+				if _, err := SignSkillWithOptions(dir, privPEM, "example.com", SignOptions{SplitManifest: split}); err != nil {
+					b.Fatal(err)
+				}
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if result := VerifySkillOffline(dir, disc, nil, nil, nil, "bench"); !result.Valid {
+						b.Fatal(result.ErrorMessage)
+					}
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkDetectTamperedFiles(b *testing.B) {
+	for _, n := range benchmarkSizes {
+		b.Run(fmt.Sprintf("files=%d", n), func(b *testing.B) {
+			signed := make(map[string]string, n)
+			current := make(map[string]string, n)
+			for i := 0; i < n; i++ {
+				name := fmt.Sprintf("d%04d/f%03d.txt", i/100, i%100)
+				signed[name] = fmt.Sprintf("sha256:%064x", i)
+				current[name] = signed[name]
+			}
+			current["d0000/f000.txt"] = "sha256:changed"
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				DetectTamperedFiles(current, signed)
+			}
+		})
+	}
+}
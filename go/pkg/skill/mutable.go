@@ -0,0 +1,157 @@
+// Signed declarations of skill files that may change after signing.
+
+package skill
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// matchMutablePath reports whether the slash-separated relPath matches
+// pattern. A "**" segment matches zero or more path segments; every other
+// segment is matched with path.Match.
+func matchMutablePath(pattern, relPath string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(relPath, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// isMutablePath reports whether relPath matches any of patterns.
+func isMutablePath(patterns []string, relPath string) bool {
+	for _, pattern := range patterns {
+		if matchMutablePath(pattern, relPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// validateMutablePaths checks that every pattern is a relative,
+// slash-separated glob and returns them sorted with duplicates removed.
+func validateMutablePaths(patterns []string) ([]string, error) {
+	seen := make(map[string]bool, len(patterns))
+	var out []string
+	for _, pattern := range patterns {
+		if pattern == "" || strings.HasPrefix(pattern, "/") {
+			return nil, fmt.Errorf("invalid mutable path %q: must be a non-empty relative path", pattern)
+		}
+		for _, segment := range strings.Split(pattern, "/") {
+			if segment == "" || segment == "." || segment == ".." {
+				return nil, fmt.Errorf("invalid mutable path %q: empty, . or .. segment", pattern)
+			}
+			if strings.Contains(segment, "**") && segment != "**" {
+				return nil, fmt.Errorf("invalid mutable path %q: ** must be a whole path segment", pattern)
+			}
+			if _, err := path.Match(segment, ""); err != nil {
+				return nil, fmt.Errorf("invalid mutable path %q: %w", pattern, err)
+			}
+		}
+		if !seen[pattern] {
+			seen[pattern] = true
+			out = append(out, pattern)
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+// mutableSigningHash is the hash a skill signature is made over. Without
+// mutable paths it is the root hash itself, so such signatures are
+// unchanged; with them it is SHA-256(root hash || JSON pattern list), which
+// binds the declared patterns to the signature.
+func mutableSigningHash(rootHash []byte, patterns []string) ([]byte, error) {
+	if len(patterns) == 0 {
+		return rootHash, nil
+	}
+	encoded, err := json.Marshal(patterns)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode mutable paths: %w", err)
+	}
+	h := sha256.New()
+	h.Write(rootHash)
+	h.Write(encoded)
+	return h.Sum(nil), nil
+}
+
+// applyMutablePaths returns the manifest the root hash is recomputed from:
+// current with every file matching patterns replaced by its signed digest.
+// Signed mutable files that have been removed are restored from signed.
+// New files matching patterns are dropped when allowNew is set and are an
+// error otherwise. skipped lists every matching path, sorted.
+func applyMutablePaths(current, signed map[string]string, patterns []string, allowNew bool) (effective map[string]string, skipped []string, err error) {
+	if len(patterns) == 0 {
+		return current, nil, nil
+	}
+
+	effective = make(map[string]string, len(current))
+	for relPath, digest := range current {
+		if !isMutablePath(patterns, relPath) {
+			effective[relPath] = digest
+			continue
+		}
+		signedDigest, ok := signed[relPath]
+		if !ok {
+			if !allowNew {
+				return nil, nil, fmt.Errorf("new file %s matches a mutable path but new mutable files are not allowed", relPath)
+			}
+			skipped = append(skipped, relPath)
+			continue
+		}
+		effective[relPath] = signedDigest
+		skipped = append(skipped, relPath)
+	}
+	for relPath, digest := range signed {
+		if _, ok := current[relPath]; !ok && isMutablePath(patterns, relPath) {
+			effective[relPath] = digest
+			skipped = append(skipped, relPath)
+		}
+	}
+	sort.Strings(skipped)
+	return effective, skipped, nil
+}
+
+// withoutMutablePaths drops the paths matching patterns from tampered.
+// Added files are only dropped when allowNew is set.
+func withoutMutablePaths(tampered *TamperedFiles, patterns []string, allowNew bool) *TamperedFiles {
+	if len(patterns) == 0 {
+		return tampered
+	}
+	keep := func(paths []string, drop bool) []string {
+		out := []string{}
+		for _, relPath := range paths {
+			if !drop || !isMutablePath(patterns, relPath) {
+				out = append(out, relPath)
+			}
+		}
+		return out
+	}
+	return &TamperedFiles{
+		Modified:          keep(tampered.Modified, true),
+		Added:             keep(tampered.Added, allowNew),
+		Removed:           keep(tampered.Removed, true),
+		PermissionChanged: keep(tampered.PermissionChanged, true),
+	}
+}
@@ -0,0 +1,246 @@
+package skill
+
+import (
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/bundle"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/resolver"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+func TestMatchMutablePath(t *testing.T) {
+	tests := []struct {
+		pattern string
+		relPath string
+		want    bool
+	}{
+		{"state/**", "state/db.json", true},
+		{"state/**", "state/a/b/c.json", true},
+		{"state/**", "stateful/db.json", false},
+		{"state/*.json", "state/db.json", true},
+		{"state/*.json", "state/a/db.json", false},
+		{"**/cache.bin", "cache.bin", true},
+		{"**/cache.bin", "a/b/cache.bin", true},
+		{"a/**/b.txt", "a/b.txt", true},
+		{"a/**/b.txt", "a/x/y/b.txt", true},
+		{"a/**/b.txt", "x/a/b.txt", false},
+		{"SKILL.md", "SKILL.md", true},
+		{"SKILL.md", "docs/SKILL.md", false},
+	}
+	for _, tt := range tests {
+		if got := matchMutablePath(tt.pattern, tt.relPath); got != tt.want {
+			t.Errorf("matchMutablePath(%q, %q) = %v, want %v", tt.pattern, tt.relPath, got, tt.want)
+		}
+	}
+}
+
+func TestValidateMutablePaths(t *testing.T) {
+	got, err := validateMutablePaths([]string{"state/**", "cache/*.bin", "state/**"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"cache/*.bin", "state/**"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+
+	for _, pattern := range []string{"", "/state/**", "../state", "state//x", "state/a**", "state/["} {
+		if _, err := validateMutablePaths([]string{pattern}); err == nil {
+			t.Errorf("expected %q to be rejected", pattern)
+		}
+	}
+}
+
+func signMutableSkill(t *testing.T, files map[string]string, patterns ...string) (string, string) {
+	t.Helper()
+	privPEM, pubPEM := makeKeypair(t)
+	dir := createSkillDir(t, files)
+	if _, err := SignSkillWithOptions(dir, privPEM, "example.com", SignOptions{MutablePaths: patterns}); err != nil {
+		t.Fatal(err)
+	}
+	return dir, pubPEM
+}
+
+func mutableSkillFiles() map[string]string {
+	return map[string]string{
+		"SKILL.md":          "---\nname: stateful\n---\n# Stateful",
+		"scripts/run.sh":    "#!/bin/sh\n",
+		"state/db.json":     "{}",
+		"state/logs/a.log":  "",
+		"cache/results.bin": "x",
+	}
+}
+
+func TestSignMutablePathsRecorded(t *testing.T) {
+	dir, _ := signMutableSkill(t, mutableSkillFiles(), "state/**", "cache/*.bin", "state/**")
+	sig, err := LoadSignature(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"cache/*.bin", "state/**"}; !reflect.DeepEqual(sig.MutablePaths, want) {
+		t.Errorf("expected mutable_paths %v, got %v", want, sig.MutablePaths)
+	}
+
+	// The skill hash is still the plain root hash
+	rootHash, _, err := CanonicalizeSkill(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig.SkillHash != "sha256:"+hex.EncodeToString(rootHash) {
+		t.Errorf("expected skill_hash to be the root hash, got %s", sig.SkillHash)
+	}
+
+	privPEM, _ := makeKeypair(t)
+	if _, err := SignSkillWithOptions(dir, privPEM, "example.com", SignOptions{MutablePaths: []string{"../escape"}}); err == nil {
+		t.Error("expected an invalid mutable path to be rejected")
+	}
+}
+
+func TestVerifyMutableFileChanged(t *testing.T) {
+	dir, pubPEM := signMutableSkill(t, mutableSkillFiles(), "state/**")
+	writeSkill(t, dir, map[string]string{"state/db.json": `{"runs": 3}`})
+	if err := os.Remove(filepath.Join(dir, "state", "logs", "a.log")); err != nil {
+		t.Fatal(err)
+	}
+
+	result := VerifySkillOffline(dir, makeDiscovery(pubPEM), nil, nil, nil, "")
+	if !result.Valid {
+		t.Fatalf("expected a changed mutable file to verify, got %s: %s", result.ErrorCode, result.ErrorMessage)
+	}
+	if want := []string{"state/db.json", "state/logs/a.log"}; !reflect.DeepEqual(result.MutableSkipped, want) {
+		t.Errorf("expected mutable_skipped %v, got %v", want, result.MutableSkipped)
+	}
+}
+
+func TestVerifyUndeclaredFileChanged(t *testing.T) {
+	dir, pubPEM := signMutableSkill(t, mutableSkillFiles(), "state/**")
+	writeSkill(t, dir, map[string]string{"cache/results.bin": "y"})
+
+	result := VerifySkillOffline(dir, makeDiscovery(pubPEM), nil, nil, nil, "")
+	if result.Valid || result.ErrorCode != verification.ErrSignatureInvalid {
+		t.Fatalf("expected a changed undeclared file to fail, got valid=%v code=%s", result.Valid, result.ErrorCode)
+	}
+}
+
+func TestVerifyMutablePathsTampered(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+	}{
+		{"widened", []string{"**"}},
+		{"added", []string{"cache/*.bin", "state/**"}},
+		{"removed", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, pubPEM := signMutableSkill(t, mutableSkillFiles(), "state/**")
+			sig, err := LoadSignature(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sig.MutablePaths = tt.patterns
+
+			result := VerifySkillOffline(dir, makeDiscovery(pubPEM), sig, nil, nil, "")
+			if result.Valid || result.ErrorCode != verification.ErrSignatureInvalid {
+				t.Fatalf("expected a tampered mutable_paths list to fail, got valid=%v code=%s", result.Valid, result.ErrorCode)
+			}
+		})
+	}
+}
+
+func TestVerifyMutableSignedDigestTampered(t *testing.T) {
+	dir, pubPEM := signMutableSkill(t, mutableSkillFiles(), "state/**")
+	sig, err := LoadSignature(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig.FileManifest["state/db.json"] = "sha256:" + hex.EncodeToString(make([]byte, 32))
+
+	result := VerifySkillOffline(dir, makeDiscovery(pubPEM), sig, nil, nil, "")
+	if result.Valid {
+		t.Fatal("expected a rewritten file_manifest digest for a mutable file to fail")
+	}
+}
+
+func TestVerifyNewMutableFile(t *testing.T) {
+	dir, pubPEM := signMutableSkill(t, mutableSkillFiles(), "state/**")
+	writeSkill(t, dir, map[string]string{"state/new.json": "{}"})
+
+	result := VerifySkillOffline(dir, makeDiscovery(pubPEM), nil, nil, nil, "")
+	if result.Valid || result.ErrorCode != verification.ErrSignatureInvalid {
+		t.Fatalf("expected a new mutable file to fail by default, got valid=%v code=%s", result.Valid, result.ErrorCode)
+	}
+
+	result = VerifySkillOfflineWithOptions(dir, makeDiscovery(pubPEM), nil, nil, nil, "", VerifyOptions{AllowNewMutableFiles: true})
+	if !result.Valid {
+		t.Fatalf("expected a new mutable file to be allowed, got %s: %s", result.ErrorCode, result.ErrorMessage)
+	}
+	if want := []string{"state/db.json", "state/logs/a.log", "state/new.json"}; !reflect.DeepEqual(result.MutableSkipped, want) {
+		t.Errorf("expected mutable_skipped %v, got %v", want, result.MutableSkipped)
+	}
+
+	// A new file outside the mutable paths still fails
+	writeSkill(t, dir, map[string]string{"scripts/extra.sh": "#!/bin/sh\n"})
+	result = VerifySkillOfflineWithOptions(dir, makeDiscovery(pubPEM), nil, nil, nil, "", VerifyOptions{AllowNewMutableFiles: true})
+	if result.Valid {
+		t.Fatal("expected a new undeclared file to fail")
+	}
+}
+
+func TestVerifyMutableFileSizes(t *testing.T) {
+	privPEM, pubPEM := makeKeypair(t)
+	dir := createSkillDir(t, mutableSkillFiles())
+	_, err := SignSkillWithOptions(dir, privPEM, "example.com", SignOptions{MutablePaths: []string{"state/**"}, RecordFileSizes: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeSkill(t, dir, map[string]string{"state/db.json": `{"grown": "considerably larger than before"}`})
+
+	policy := &verification.ContentPolicy{MaxFileSize: 1024}
+	result := VerifySkillOfflineWithOptions(dir, makeDiscovery(pubPEM), nil, nil, nil, "", VerifyOptions{ContentPolicy: policy})
+	if !result.Valid {
+		t.Fatalf("expected a resized mutable file to pass the size cross-check, got %s: %s", result.ErrorCode, result.ErrorMessage)
+	}
+}
+
+func TestVerifyMutableArchive(t *testing.T) {
+	for _, format := range archiveFormats {
+		t.Run(string(format), func(t *testing.T) {
+			privPEM, pubPEM := makeKeypair(t)
+			archivePath := packDir(t, createSkillDir(t, archiveSkillFiles()), format)
+			if _, err := SignSkillArchive(archivePath, privPEM, "example.com", SignOptions{MutablePaths: []string{"assets/**"}}); err != nil {
+				t.Fatal(err)
+			}
+
+			r, size := openArchive(t, archivePath)
+			result := VerifySkillArchiveOffline(r, size, format, makeDiscovery(pubPEM), nil, nil, nil, "")
+			if !result.Valid {
+				t.Fatalf("expected archive to verify, got %s: %s", result.ErrorCode, result.ErrorMessage)
+			}
+			if want := []string{"assets/data/table.csv"}; !reflect.DeepEqual(result.MutableSkipped, want) {
+				t.Errorf("expected mutable_skipped %v, got %v", want, result.MutableSkipped)
+			}
+		})
+	}
+}
+
+func TestInstalledSkillIgnoresMutableTampering(t *testing.T) {
+	dir, pubPEM := signMutableSkill(t, mutableSkillFiles(), "state/**")
+	writeSkill(t, dir, map[string]string{"state/db.json": "changed"})
+	writeSkill(t, dir, map[string]string{"scripts/run.sh": "#!/bin/sh\nrm -rf /\n"})
+
+	b, err := bundle.ParseTrustBundle(buildTrustBundleJSON(t, pubPEM, "example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := verifyInstalledSkill(dir, "stateful", resolver.NewTrustBundleResolver(b), nil, VerifyOptions{})
+	if report.Status != SkillStatusTampered {
+		t.Fatalf("expected tampered, got %s", report.Status)
+	}
+	if want := []string{"scripts/run.sh"}; !reflect.DeepEqual(report.Tampered.Modified, want) {
+		t.Errorf("expected only %v modified, got %+v", want, report.Tampered)
+	}
+}
@@ -0,0 +1,256 @@
+// Nested skills: subdirectories of a skill holding their own signature
+// (SignOptions.Nested).
+
+package skill
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
+)
+
+// NestedMode selects how signing treats nested skills: subdirectories
+// below the skill root that hold their own .schemapin.sig.
+type NestedMode string
+
+const (
+	// NestedFail refuses to sign a skill with nested skills, returning a
+	// *NestedSkillsError that lists their signatures. It is the default.
+	NestedFail NestedMode = "fail"
+	// NestedInclude hashes the files of nested skills into the parent's
+	// manifest like any other file, skipping their signature files, as
+	// signers did before nested skills were detected. Re-signing a child
+	// then leaves the parent valid only if the child's files are unchanged.
+	NestedInclude NestedMode = "include"
+	// NestedExclude leaves nested skill subtrees out of the parent's
+	// manifest and records each one's root hash in the signature's
+	// nested_skills field instead, which the signature covers. Verifiers
+	// recompute the recorded hashes, so the parent still binds to specific
+	// child versions.
+	NestedExclude NestedMode = "exclude"
+)
+
+// ParseNestedMode parses a NestedMode name; the empty string is NestedFail.
+func ParseNestedMode(name string) (NestedMode, error) {
+	switch mode := NestedMode(name); mode {
+	case "":
+		return NestedFail, nil
+	case NestedFail, NestedInclude, NestedExclude:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid nested skill mode %q (expected include, exclude or fail)", name)
+}
+
+// NestedSkillsError is returned when signing a skill containing nested
+// skills with NestedFail.
+type NestedSkillsError struct {
+	// Signatures are the nested signature files, relative to the skill
+	// root, in path order.
+	Signatures []string
+}
+
+func (e *NestedSkillsError) Error() string {
+	return fmt.Sprintf("skill contains nested skill signatures: %s (choose to include or exclude nested skills)", strings.Join(e.Signatures, ", "))
+}
+
+// nestedWalk collects nested skills while a skill is canonicalized. The
+// zero value only records the nested signature files found.
+type nestedWalk struct {
+	// exclude holds the relative paths of subdirectories to leave out of
+	// the manifest; skills receives the root hash of each one found.
+	exclude map[string]bool
+	skills  map[string]string
+	// signatures are the signature files found below the skill root,
+	// excluded subtrees aside.
+	signatures []string
+}
+
+// newNestedWalk returns a walk leaving out dirs.
+func newNestedWalk(dirs []string) *nestedWalk {
+	walk := &nestedWalk{exclude: make(map[string]bool, len(dirs)), skills: make(map[string]string, len(dirs))}
+	for _, dir := range dirs {
+		walk.exclude[dir] = true
+	}
+	return walk
+}
+
+// excludedDir returns the left-out subdirectory holding the file relPath,
+// or "".
+func (w *nestedWalk) excludedDir(relPath string) string {
+	if w == nil || len(w.exclude) == 0 {
+		return ""
+	}
+	for dir := path.Dir(relPath); dir != "."; dir = path.Dir(dir) {
+		if w.exclude[dir] {
+			return dir
+		}
+	}
+	return ""
+}
+
+// addSkill records the root hash of the left-out subdirectory dir,
+// computed with alg from its manifest relative to dir.
+func (w *nestedWalk) addSkill(dir string, manifest map[string]string, alg *core.Canonicalization) error {
+	if len(manifest) == 0 {
+		return fmt.Errorf("nested skill %s is empty or contains no signable files", dir)
+	}
+	w.skills[dir] = "sha256:" + hex.EncodeToString(alg.SkillRootHash(manifest))
+	return nil
+}
+
+// checkFound fails unless every left-out subdirectory was found.
+func (w *nestedWalk) checkFound() error {
+	for _, dir := range sortedDirs(w.exclude) {
+		if _, ok := w.skills[dir]; !ok {
+			return fmt.Errorf("nested skill %s not found", dir)
+		}
+	}
+	return nil
+}
+
+// nestedSkillDirs returns the outermost directories holding signatures,
+// sorted: nested skills inside another nested skill belong to it.
+func nestedSkillDirs(signatures []string) []string {
+	var dirs []string
+	seen := make(map[string]bool)
+	for _, sigPath := range signatures {
+		seen[path.Dir(sigPath)] = true
+	}
+	for _, dir := range sortedDirs(seen) {
+		outermost := true
+		for parent := path.Dir(dir); parent != "."; parent = path.Dir(parent) {
+			if seen[parent] {
+				outermost = false
+				break
+			}
+		}
+		if outermost {
+			dirs = append(dirs, dir)
+		}
+	}
+	return dirs
+}
+
+func sortedDirs(set map[string]bool) []string {
+	dirs := make([]string, 0, len(set))
+	for dir := range set {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// validateNestedSkills checks that the nested_skills of a signature name
+// distinct relative subdirectories, none inside another, and returns them
+// sorted.
+func validateNestedSkills(nested map[string]string) ([]string, error) {
+	dirs := make(map[string]bool, len(nested))
+	for dir := range nested {
+		if dir == "" || strings.HasPrefix(dir, "/") {
+			return nil, fmt.Errorf("invalid nested skill %q: must be a non-empty relative path", dir)
+		}
+		for _, segment := range strings.Split(dir, "/") {
+			if segment == "" || segment == "." || segment == ".." {
+				return nil, fmt.Errorf("invalid nested skill %q: empty, . or .. segment", dir)
+			}
+		}
+		dirs[dir] = true
+	}
+	sorted := sortedDirs(dirs)
+	for _, dir := range sorted {
+		for parent := path.Dir(dir); parent != "."; parent = path.Dir(parent) {
+			if dirs[parent] {
+				return nil, fmt.Errorf("invalid nested skill %q: inside nested skill %q", dir, parent)
+			}
+		}
+	}
+	return sorted, nil
+}
+
+// nestedSigningHash extends the hash a skill signature is made over with
+// the root hashes of its nested skills. Without nested skills it is hash
+// itself; with them it is SHA-256(hash || JSON object of the hashes by
+// directory), which binds the parent to those child versions.
+func nestedSigningHash(hash []byte, nested map[string]string) ([]byte, error) {
+	if len(nested) == 0 {
+		return hash, nil
+	}
+	encoded, err := json.Marshal(nested)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode nested skills: %w", err)
+	}
+	h := sha256.New()
+	h.Write(hash)
+	h.Write(encoded)
+	return h.Sum(nil), nil
+}
+
+// changedNestedSkill returns the first nested skill, in path order, whose
+// current root hash differs from the signed one, or "".
+func changedNestedSkill(current, signed map[string]string) string {
+	dirs := make(map[string]bool, len(signed))
+	for dir := range signed {
+		dirs[dir] = true
+	}
+	for _, dir := range sortedDirs(dirs) {
+		if current[dir] != signed[dir] {
+			return dir
+		}
+	}
+	return ""
+}
+
+// canonicalizeForSigning runs canonicalize, which canonicalizes the skill
+// being signed with walk, handling nested skills as mode says: it fails for
+// NestedFail, and for NestedExclude runs canonicalize again leaving the
+// nested skills out. It returns their root hashes, or nil if none are left
+// out.
+func canonicalizeForSigning(mode NestedMode, canonicalize func(walk *nestedWalk) error) (map[string]string, error) {
+	mode, err := ParseNestedMode(string(mode))
+	if err != nil {
+		return nil, err
+	}
+	walk := &nestedWalk{}
+	if err := canonicalize(walk); err != nil {
+		return nil, err
+	}
+	if len(walk.signatures) == 0 {
+		return nil, nil
+	}
+	switch mode {
+	case NestedInclude:
+		return nil, nil
+	case NestedExclude:
+		walk = newNestedWalk(nestedSkillDirs(walk.signatures))
+		if err := canonicalize(walk); err != nil {
+			return nil, err
+		}
+		return walk.skills, nil
+	}
+	return nil, &NestedSkillsError{Signatures: walk.signatures}
+}
+
+// signedManifest canonicalizes skillDir the way sig was made: with its
+// algorithm and with its nested skills left out of the manifest.
+func signedManifest(skillDir string, sig *SkillSignature, limits ManifestLimits) (map[string]string, error) {
+	alg, err := core.LookupCanonicalization(sig.Canonicalization)
+	if err != nil {
+		return nil, err
+	}
+	var nested *nestedWalk
+	if len(sig.NestedSkills) > 0 {
+		dirs, err := validateNestedSkills(sig.NestedSkills)
+		if err != nil {
+			return nil, err
+		}
+		nested = newNestedWalk(dirs)
+	}
+	_, manifest, err := canonicalizeSkillNested(skillDir, alg, limits, nested, nil)
+	return manifest, err
+}
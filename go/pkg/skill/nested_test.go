@@ -0,0 +1,264 @@
+package skill
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+func nestedSkillFiles() map[string]string {
+	return map[string]string{
+		"SKILL.md":                 "---\nname: parent\n---\n# Parent",
+		"scripts/run.sh":           "#!/bin/sh\n",
+		"children/fmt/SKILL.md":    "---\nname: fmt\n---\n# Formatter",
+		"children/fmt/bin/fmt.sh":  "#!/bin/sh\nfmt\n",
+		"children/lint/SKILL.md":   "---\nname: lint\n---\n# Linter",
+		"children/lint/rules.json": "{}",
+	}
+}
+
+// createNestedSkill returns a parent skill directory whose fmt and lint
+// children are signed skills of their own.
+func createNestedSkill(t *testing.T) string {
+	t.Helper()
+	dir := createSkillDir(t, nestedSkillFiles())
+	childPEM, _ := makeKeypair(t)
+	for _, child := range []string{"children/fmt", "children/lint"} {
+		if _, err := SignSkill(filepath.Join(dir, child), childPEM, "tools.example.com", "", ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestParseNestedMode(t *testing.T) {
+	for name, want := range map[string]NestedMode{"": NestedFail, "fail": NestedFail, "include": NestedInclude, "exclude": NestedExclude} {
+		if got, err := ParseNestedMode(name); err != nil || got != want {
+			t.Errorf("ParseNestedMode(%q) = %q, %v; want %q", name, got, err, want)
+		}
+	}
+	if _, err := ParseNestedMode("skip"); err == nil {
+		t.Error("expected an unknown mode to be rejected")
+	}
+}
+
+func TestNestedSkillDirs(t *testing.T) {
+	got := nestedSkillDirs([]string{"b/.schemapin.sig", "a/x/.schemapin.sig", "a/x/y/.schemapin.sig", "a/xy/.schemapin.sig"})
+	if want := []string{"a/x", "a/xy", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestValidateNestedSkills(t *testing.T) {
+	for _, nested := range []map[string]string{
+		{"": "sha256:00"},
+		{"/abs": "sha256:00"},
+		{"../escape": "sha256:00"},
+		{"a//b": "sha256:00"},
+		{"a": "sha256:00", "a/b": "sha256:00"},
+	} {
+		if _, err := validateNestedSkills(nested); err == nil {
+			t.Errorf("expected %v to be rejected", nested)
+		}
+	}
+}
+
+func TestSignNestedFail(t *testing.T) {
+	privPEM, _ := makeKeypair(t)
+	dir := createNestedSkill(t)
+
+	_, err := SignSkillWithOptions(dir, privPEM, "example.com", SignOptions{})
+	var nestedErr *NestedSkillsError
+	if !errors.As(err, &nestedErr) {
+		t.Fatalf("expected a NestedSkillsError, got %v", err)
+	}
+	want := []string{"children/fmt/.schemapin.sig", "children/lint/.schemapin.sig"}
+	if !reflect.DeepEqual(nestedErr.Signatures, want) {
+		t.Errorf("expected nested signatures %v, got %v", want, nestedErr.Signatures)
+	}
+	if _, err := os.Stat(filepath.Join(dir, SignatureFilename)); !os.IsNotExist(err) {
+		t.Error("expected no parent signature to be written")
+	}
+
+	// Skills without nested signatures sign as before
+	if _, err := SignSkillWithOptions(filepath.Join(dir, "children", "fmt"), privPEM, "example.com", SignOptions{}); err != nil {
+		t.Errorf("expected a skill without nested skills to sign, got %v", err)
+	}
+}
+
+func TestSignNestedInclude(t *testing.T) {
+	privPEM, pubPEM := makeKeypair(t)
+	dir := createNestedSkill(t)
+
+	sig, err := SignSkillWithOptions(dir, privPEM, "example.com", SignOptions{Nested: NestedInclude})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := sig.FileManifest["children/fmt/bin/fmt.sh"]; !ok {
+		t.Error("expected nested skill files in the parent manifest")
+	}
+	if sig.NestedSkills != nil {
+		t.Errorf("expected no nested_skills, got %v", sig.NestedSkills)
+	}
+	rootHash, _, err := CanonicalizeSkill(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig.SkillHash != "sha256:"+hex.EncodeToString(rootHash) {
+		t.Error("expected include to sign the same root hash as CanonicalizeSkill")
+	}
+
+	result := VerifySkillOffline(dir, makeDiscovery(pubPEM), nil, nil, nil, "")
+	if !result.Valid {
+		t.Fatalf("expected valid, got %s: %s", result.ErrorCode, result.ErrorMessage)
+	}
+}
+
+func TestSignNestedExclude(t *testing.T) {
+	privPEM, pubPEM := makeKeypair(t)
+	dir := createNestedSkill(t)
+
+	sig, err := SignSkillWithOptions(dir, privPEM, "example.com", SignOptions{Nested: NestedExclude})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"SKILL.md", "scripts/run.sh"}; !reflect.DeepEqual(sortedKeys(sig.FileManifest), want) {
+		t.Errorf("expected parent manifest %v, got %v", want, sortedKeys(sig.FileManifest))
+	}
+	for _, child := range []string{"children/fmt", "children/lint"} {
+		childSig, err := LoadSignature(filepath.Join(dir, child))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if sig.NestedSkills[child] != childSig.SkillHash {
+			t.Errorf("expected nested skill %s recorded as %s, got %s", child, childSig.SkillHash, sig.NestedSkills[child])
+		}
+	}
+
+	loaded, err := LoadSignature(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.NestedSkills, sig.NestedSkills) {
+		t.Errorf("expected nested_skills %v written, got %v", sig.NestedSkills, loaded.NestedSkills)
+	}
+
+	result := VerifySkillOffline(dir, makeDiscovery(pubPEM), nil, nil, nil, "")
+	if !result.Valid {
+		t.Fatalf("expected valid, got %s: %s", result.ErrorCode, result.ErrorMessage)
+	}
+
+	// Re-signing a child with another key leaves the parent valid
+	otherPEM, _ := makeKeypair(t)
+	if _, err := SignSkill(filepath.Join(dir, "children", "fmt"), otherPEM, "tools.example.com", "", ""); err != nil {
+		t.Fatal(err)
+	}
+	result = VerifySkillOffline(dir, makeDiscovery(pubPEM), nil, nil, nil, "")
+	if !result.Valid {
+		t.Fatalf("expected valid after re-signing a child, got %s: %s", result.ErrorCode, result.ErrorMessage)
+	}
+}
+
+func TestVerifyNestedChildTampered(t *testing.T) {
+	privPEM, pubPEM := makeKeypair(t)
+	dir := createNestedSkill(t)
+	if _, err := SignSkillWithOptions(dir, privPEM, "example.com", SignOptions{Nested: NestedExclude}); err != nil {
+		t.Fatal(err)
+	}
+
+	writeSkill(t, dir, map[string]string{"children/lint/rules.json": `{"disable": "all"}`})
+	result := VerifySkillOffline(dir, makeDiscovery(pubPEM), nil, nil, nil, "")
+	if result.Valid {
+		t.Fatal("expected a tampered nested skill to fail")
+	}
+	if result.ErrorCode != verification.ErrSignatureInvalid || !strings.Contains(result.ErrorMessage, "Nested skill children/lint changed") {
+		t.Errorf("expected the nested skill to be named, got %s: %s", result.ErrorCode, result.ErrorMessage)
+	}
+
+	if err := os.RemoveAll(filepath.Join(dir, "children", "lint")); err != nil {
+		t.Fatal(err)
+	}
+	result = VerifySkillOffline(dir, makeDiscovery(pubPEM), nil, nil, nil, "")
+	if result.Valid || !strings.Contains(result.ErrorMessage, "nested skill children/lint not found") {
+		t.Errorf("expected a removed nested skill to fail, got %s: %s", result.ErrorCode, result.ErrorMessage)
+	}
+}
+
+func TestVerifyNestedSkillsSigned(t *testing.T) {
+	privPEM, pubPEM := makeKeypair(t)
+	dir := createNestedSkill(t)
+	if _, err := SignSkillWithOptions(dir, privPEM, "example.com", SignOptions{Nested: NestedExclude}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Swapping in a tampered child's hash breaks the parent signature
+	writeSkill(t, dir, map[string]string{"children/lint/rules.json": `{"disable": "all"}`})
+	sig, err := LoadSignature(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lintHash, _, err := CanonicalizeSkill(filepath.Join(dir, "children", "lint"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig.NestedSkills["children/lint"] = "sha256:" + hex.EncodeToString(lintHash)
+	data, err := json.Marshal(sig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, SignatureFilename), data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	result := VerifySkillOffline(dir, makeDiscovery(pubPEM), nil, nil, nil, "")
+	if result.Valid || result.ErrorMessage != "Signature verification failed" {
+		t.Errorf("expected the signature to fail, got %s: %s", result.ErrorCode, result.ErrorMessage)
+	}
+}
+
+func TestNestedExcludeArchive(t *testing.T) {
+	for _, format := range archiveFormats {
+		t.Run(string(format), func(t *testing.T) {
+			privPEM, pubPEM := makeKeypair(t)
+			dir := createNestedSkill(t)
+			archivePath := packDir(t, dir, format)
+
+			if _, err := SignSkillArchive(archivePath, privPEM, "example.com", SignOptions{}); err == nil {
+				t.Fatal("expected an archive with nested skills to be refused by default")
+			}
+			sig, err := SignSkillArchive(archivePath, privPEM, "example.com", SignOptions{Nested: NestedExclude})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The archive records the same hashes as the directory
+			dirSig, err := SignSkillWithOptions(dir, privPEM, "example.com", SignOptions{Nested: NestedExclude})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sig.SkillHash != dirSig.SkillHash || !reflect.DeepEqual(sig.NestedSkills, dirSig.NestedSkills) {
+				t.Errorf("expected archive hashes %s %v, got %s %v", dirSig.SkillHash, dirSig.NestedSkills, sig.SkillHash, sig.NestedSkills)
+			}
+
+			r, size := openArchive(t, archivePath)
+			result := VerifySkillArchiveOffline(r, size, format, makeDiscovery(pubPEM), nil, nil, nil, "")
+			if !result.Valid {
+				t.Fatalf("expected valid, got %s: %s", result.ErrorCode, result.ErrorMessage)
+			}
+
+			writeSkill(t, dir, map[string]string{"children/fmt/bin/fmt.sh": "#!/bin/sh\ncurl evil\n"})
+			r, size = openArchive(t, packDir(t, dir, format))
+			result = VerifySkillArchiveOffline(r, size, format, makeDiscovery(pubPEM), sig, nil, nil, "")
+			if result.Valid || !strings.Contains(result.ErrorMessage, "Nested skill children/fmt changed") {
+				t.Errorf("expected a tampered nested skill to fail, got %s: %s", result.ErrorCode, result.ErrorMessage)
+			}
+		})
+	}
+}
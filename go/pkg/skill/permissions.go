@@ -0,0 +1,119 @@
+// Executable-bit tracking for skill files (SignOptions.TrackExecBit).
+
+package skill
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Mode suffixes of the manifest entries of a skill signed with
+// SignOptions.TrackExecBit. Every entry carries one, "sha256:<hex>;x" for
+// an executable file and "sha256:<hex>;-" otherwise. The root hash
+// concatenates the entries' text after "sha256:", suffix included, so the
+// signature covers the bits; manifests without suffixes hash as before.
+const (
+	modeExecutable    = ";x"
+	modeNotExecutable = ";-"
+)
+
+// execBitsSupported reports whether the files of a skill directory have
+// executable bits to record and compare. Windows has none.
+var execBitsSupported = runtime.GOOS != "windows"
+
+// splitManifestEntry splits a manifest entry into its digest and its mode
+// suffix, which is empty for entries signed without executable bits.
+func splitManifestEntry(entry string) (digest, mode string) {
+	if i := strings.LastIndexByte(entry, ';'); i >= 0 {
+		return entry[:i], entry[i:]
+	}
+	return entry, ""
+}
+
+// tracksExecBits reports whether manifest was signed with executable bits.
+func tracksExecBits(manifest map[string]string) bool {
+	for _, entry := range manifest {
+		if _, mode := splitManifestEntry(entry); mode != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// withExecBits returns manifest with the mode suffix of every entry set
+// from executable.
+func withExecBits(manifest map[string]string, executable map[string]bool) map[string]string {
+	tracked := make(map[string]string, len(manifest))
+	for relPath, entry := range manifest {
+		digest, _ := splitManifestEntry(entry)
+		if executable[relPath] {
+			tracked[relPath] = digest + modeExecutable
+		} else {
+			tracked[relPath] = digest + modeNotExecutable
+		}
+	}
+	return tracked
+}
+
+// withSignedModes returns current with each file's mode suffix taken from
+// its signed entry, so the root hash is recomputed over the signed bits.
+// Files not in signed keep their entry as is.
+func withSignedModes(current, signed map[string]string) map[string]string {
+	effective := make(map[string]string, len(current))
+	for relPath, entry := range current {
+		if _, mode := splitManifestEntry(signed[relPath]); mode != "" {
+			digest, _ := splitManifestEntry(entry)
+			entry = digest + mode
+		}
+		effective[relPath] = entry
+	}
+	return effective
+}
+
+// manifestExecBits returns whether each file in manifest is executable in
+// skillDir.
+func manifestExecBits(skillDir string, manifest map[string]string) (map[string]bool, error) {
+	if !execBitsSupported {
+		return nil, fmt.Errorf("executable bits are not available on %s", runtime.GOOS)
+	}
+	absDir, err := filepath.Abs(skillDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve skill directory: %w", err)
+	}
+	absDir, err = filepath.EvalSymlinks(absDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to eval symlinks: %w", err)
+	}
+
+	executable := make(map[string]bool, len(manifest))
+	for relPath := range manifest {
+		info, err := os.Lstat(filepath.Join(absDir, filepath.FromSlash(relPath)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat %s: %w", relPath, err)
+		}
+		executable[relPath] = isExecutable(info.Mode())
+	}
+	return executable, nil
+}
+
+// isExecutable reports whether any executable bit of mode is set.
+func isExecutable(mode os.FileMode) bool {
+	return mode.Perm()&0111 != 0
+}
+
+// execBitChanges returns, in path order, the files of current whose
+// executable bit in executable differs from the one in their signed entry.
+// Files matching mutablePaths are not compared.
+func execBitChanges(current, signed map[string]string, executable map[string]bool, mutablePaths []string) []string {
+	changed := []string{}
+	_ = WalkTamperedFiles(withExecBits(current, executable), signed, func(path string, change FileChange) error {
+		if change == FilePermissionChanged && !isMutablePath(mutablePaths, path) {
+			changed = append(changed, path)
+		}
+		return nil
+	})
+	return changed
+}
@@ -0,0 +1,251 @@
+package skill
+
+import (
+	"archive/tar"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/bundle"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/resolver"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+// signExecSkill signs a skill whose scripts/run.sh is executable, with
+// executable bits tracked.
+func signExecSkill(t *testing.T) (string, string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("executable bits are not available on windows")
+	}
+	privPEM, pubPEM := makeKeypair(t)
+	dir := createSkillDir(t, mutableSkillFiles())
+	chmodSkillFile(t, dir, "scripts/run.sh", 0755)
+	if _, err := SignSkillWithOptions(dir, privPEM, "example.com", SignOptions{TrackExecBit: true, MutablePaths: []string{"state/**"}}); err != nil {
+		t.Fatal(err)
+	}
+	return dir, pubPEM
+}
+
+func chmodSkillFile(t *testing.T, dir, relPath string, mode os.FileMode) {
+	t.Helper()
+	if err := os.Chmod(filepath.Join(dir, filepath.FromSlash(relPath)), mode); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSignTrackExecBit(t *testing.T) {
+	dir, pubPEM := signExecSkill(t)
+	sig, err := LoadSignature(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry := sig.FileManifest["scripts/run.sh"]; !strings.HasSuffix(entry, ";x") {
+		t.Errorf("expected scripts/run.sh to be recorded as executable, got %s", entry)
+	}
+	if entry := sig.FileManifest["SKILL.md"]; !strings.HasSuffix(entry, ";-") {
+		t.Errorf("expected SKILL.md to be recorded as not executable, got %s", entry)
+	}
+
+	// The bits are part of the signed root hash
+	contentHash, _, err := CanonicalizeSkill(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig.SkillHash == fmt.Sprintf("sha256:%x", contentHash) {
+		t.Error("expected the skill hash to cover the executable bits")
+	}
+
+	result := VerifySkillOffline(dir, makeDiscovery(pubPEM), nil, nil, nil, "")
+	if !result.Valid || len(result.Warnings) != 0 {
+		t.Fatalf("expected a clean verification, got valid=%v code=%s warnings=%v", result.Valid, result.ErrorCode, result.Warnings)
+	}
+}
+
+func TestVerifyExecBitChanged(t *testing.T) {
+	tests := []struct {
+		name    string
+		relPath string
+		mode    os.FileMode
+	}{
+		{"executable bit removed", "scripts/run.sh", 0644},
+		{"executable bit added", "SKILL.md", 0755},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, pubPEM := signExecSkill(t)
+			chmodSkillFile(t, dir, tt.relPath, tt.mode)
+			// Mutable files are not compared
+			chmodSkillFile(t, dir, "state/db.json", 0755)
+
+			result := VerifySkillOffline(dir, makeDiscovery(pubPEM), nil, nil, nil, "")
+			if !result.Valid {
+				t.Fatalf("expected a warning only, got %s: %s", result.ErrorCode, result.ErrorMessage)
+			}
+			if !reflect.DeepEqual(result.Warnings, []string{verification.WarningPermissionChanged}) {
+				t.Errorf("expected a permission_changed warning, got %v", result.Warnings)
+			}
+			if want := []string{tt.relPath}; !reflect.DeepEqual(result.PermissionChanged, want) {
+				t.Errorf("expected permission_changed %v, got %v", want, result.PermissionChanged)
+			}
+
+			strict := VerifySkillOfflineWithOptions(dir, makeDiscovery(pubPEM), nil, nil, nil, "", VerifyOptions{StrictPermissions: true})
+			if strict.Valid || strict.ErrorCode != verification.ErrPermissionChanged {
+				t.Fatalf("expected %s with strict permissions, got valid=%v code=%s", verification.ErrPermissionChanged, strict.Valid, strict.ErrorCode)
+			}
+		})
+	}
+}
+
+func TestVerifyExecBitSignedModeTampered(t *testing.T) {
+	dir, pubPEM := signExecSkill(t)
+	chmodSkillFile(t, dir, "scripts/run.sh", 0644)
+
+	// Rewriting the signed bit to match the file breaks the signature
+	sig, err := LoadSignature(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig.FileManifest["scripts/run.sh"] = strings.TrimSuffix(sig.FileManifest["scripts/run.sh"], ";x") + ";-"
+
+	result := VerifySkillOffline(dir, makeDiscovery(pubPEM), sig, nil, nil, "")
+	if result.Valid || result.ErrorCode != verification.ErrSignatureInvalid {
+		t.Fatalf("expected %s, got valid=%v code=%s", verification.ErrSignatureInvalid, result.Valid, result.ErrorCode)
+	}
+}
+
+func TestVerifyLegacyManifestIgnoresExecBit(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("executable bits are not available on windows")
+	}
+	dir, pubPEM := signMutableSkill(t, mutableSkillFiles())
+	sig, err := LoadSignature(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for relPath, entry := range sig.FileManifest {
+		if strings.Contains(entry, ";") {
+			t.Errorf("expected no executable bit for %s without TrackExecBit, got %s", relPath, entry)
+		}
+	}
+
+	chmodSkillFile(t, dir, "scripts/run.sh", 0755)
+	result := VerifySkillOfflineWithOptions(dir, makeDiscovery(pubPEM), nil, nil, nil, "", VerifyOptions{StrictPermissions: true})
+	if !result.Valid || len(result.Warnings) != 0 || result.PermissionChanged != nil {
+		t.Fatalf("expected a legacy manifest to verify as before, got valid=%v code=%s warnings=%v", result.Valid, result.ErrorCode, result.Warnings)
+	}
+}
+
+func TestVerifyExecBitsUnsupported(t *testing.T) {
+	dir, pubPEM := signExecSkill(t)
+	chmodSkillFile(t, dir, "scripts/run.sh", 0644)
+
+	execBitsSupported = false
+	t.Cleanup(func() { execBitsSupported = true })
+
+	result := VerifySkillOfflineWithOptions(dir, makeDiscovery(pubPEM), nil, nil, nil, "", VerifyOptions{StrictPermissions: true})
+	if !result.Valid {
+		t.Fatalf("expected the bits to be skipped, got %s: %s", result.ErrorCode, result.ErrorMessage)
+	}
+	if !reflect.DeepEqual(result.Warnings, []string{verification.WarningPermissionsUnchecked}) {
+		t.Errorf("expected a permissions_unchecked warning, got %v", result.Warnings)
+	}
+
+	privPEM, _ := makeKeypair(t)
+	if _, err := SignSkillWithOptions(dir, privPEM, "example.com", SignOptions{TrackExecBit: true}); err == nil {
+		t.Error("expected signing with executable bits to fail without them")
+	}
+}
+
+func TestVerifyExecBitArchive(t *testing.T) {
+	for _, format := range archiveFormats {
+		t.Run(string(format), func(t *testing.T) {
+			privPEM, pubPEM := makeKeypair(t)
+			archivePath := buildArchiveFile(t, format, 0755)
+			sig, err := SignSkillArchive(archivePath, privPEM, "example.com", SignOptions{TrackExecBit: true})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if entry := sig.FileManifest["scripts/run.sh"]; !strings.HasSuffix(entry, ";x") {
+				t.Fatalf("expected scripts/run.sh to be recorded as executable, got %s", entry)
+			}
+
+			r, size := openArchive(t, archivePath)
+			result := VerifySkillArchiveOffline(r, size, format, makeDiscovery(pubPEM), nil, nil, nil, "")
+			if !result.Valid || len(result.Warnings) != 0 {
+				t.Fatalf("expected a clean verification, got valid=%v code=%s warnings=%v", result.Valid, result.ErrorCode, result.Warnings)
+			}
+
+			// Repack the signed archive without the executable bit
+			repacked := packDir(t, unpackArchive(t, archivePath, format), format)
+			r, size = openArchive(t, repacked)
+			result = VerifySkillArchiveOffline(r, size, format, makeDiscovery(pubPEM), nil, nil, nil, "")
+			if !result.Valid || !reflect.DeepEqual(result.PermissionChanged, []string{"scripts/run.sh"}) {
+				t.Fatalf("expected a permission change warning, got valid=%v code=%s changed=%v", result.Valid, result.ErrorCode, result.PermissionChanged)
+			}
+			result = VerifySkillArchiveOfflineWithOptions(r, size, format, makeDiscovery(pubPEM), nil, nil, nil, "", VerifyOptions{StrictPermissions: true})
+			if result.Valid || result.ErrorCode != verification.ErrPermissionChanged {
+				t.Fatalf("expected %s with strict permissions, got valid=%v code=%s", verification.ErrPermissionChanged, result.Valid, result.ErrorCode)
+			}
+		})
+	}
+}
+
+// buildArchiveFile writes archiveSkillFiles to a new archive, with
+// scripts/run.sh given perm, and returns its path.
+func buildArchiveFile(t *testing.T, format ArchiveFormat, perm os.FileMode) string {
+	t.Helper()
+	var entries []archiveEntry
+	for name, body := range archiveSkillFiles() {
+		entry := archiveEntry{name: name, body: body, typeflag: tar.TypeReg}
+		if name == "scripts/run.sh" {
+			entry.perm = perm
+		}
+		entries = append(entries, entry)
+	}
+	archivePath := filepath.Join(t.TempDir(), "skill."+string(format))
+	if err := os.WriteFile(archivePath, buildArchive(t, format, entries), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return archivePath
+}
+
+func TestInstalledSkillPermissionChanged(t *testing.T) {
+	dir, pubPEM := signExecSkill(t)
+	chmodSkillFile(t, dir, "scripts/run.sh", 0644)
+
+	b, err := bundle.ParseTrustBundle(buildTrustBundleJSON(t, pubPEM, "example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"scripts/run.sh"}
+
+	report := verifyInstalledSkill(dir, "stateful", resolver.NewTrustBundleResolver(b), nil, VerifyOptions{})
+	if report.Status != SkillStatusValid || report.Tampered == nil || !reflect.DeepEqual(report.Tampered.PermissionChanged, want) {
+		t.Fatalf("expected a valid skill reporting %v, got %s %+v", want, report.Status, report.Tampered)
+	}
+
+	report = verifyInstalledSkill(dir, "stateful", resolver.NewTrustBundleResolver(b), nil, VerifyOptions{StrictPermissions: true})
+	if report.Status != SkillStatusTampered || !reflect.DeepEqual(report.Tampered.PermissionChanged, want) || len(report.Tampered.Modified) != 0 {
+		t.Fatalf("expected a tampered skill reporting %v, got %s %+v", want, report.Status, report.Tampered)
+	}
+}
+
+func TestWalkTamperedFilesExecBits(t *testing.T) {
+	signed := map[string]string{"a": "sha256:01;x", "b": "sha256:02;-", "c": "sha256:03;-"}
+	current := map[string]string{"a": "sha256:01;-", "b": "sha256:02;-", "c": "sha256:04;x"}
+	tampered := DetectTamperedFiles(current, signed)
+	if !reflect.DeepEqual(tampered.PermissionChanged, []string{"a"}) || !reflect.DeepEqual(tampered.Modified, []string{"c"}) {
+		t.Errorf("expected a permission change for a and c modified, got %+v", tampered)
+	}
+
+	// A manifest without bits only compares digests
+	current = map[string]string{"a": "sha256:01", "b": "sha256:02", "c": "sha256:03"}
+	if tampered := DetectTamperedFiles(current, signed); len(tampered.Modified)+len(tampered.PermissionChanged) != 0 {
+		t.Errorf("expected no changes, got %+v", tampered)
+	}
+}
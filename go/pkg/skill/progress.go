@@ -0,0 +1,147 @@
+// Progress reporting while a skill directory or archive is hashed.
+
+package skill
+
+import (
+	"io/fs"
+	"path/filepath"
+	"time"
+)
+
+// ProgressInterval is the least time between two calls of a ProgressFunc,
+// apart from the first and last.
+const ProgressInterval = 100 * time.Millisecond
+
+// progressInterval is ProgressInterval, shortened by tests.
+var progressInterval = ProgressInterval
+
+// Progress describes how far the hashing of a skill has got. Totals come
+// from a pass over the directory entries or archive headers before any file
+// is read; they are zero when that pass fails, in which case hashing
+// reports the error. The last report of a completed walk has the totals of
+// what was actually hashed.
+type Progress struct {
+	// Skill is the name of the skill directory, set by
+	// VerifyInstalledSkills, which verifies several.
+	Skill          string `json:"skill,omitempty"`
+	FilesProcessed int    `json:"files_processed"`
+	TotalFiles     int    `json:"total_files"`
+	BytesHashed    int64  `json:"bytes_hashed"`
+	TotalBytes     int64  `json:"total_bytes"`
+	// CurrentPath is the skill-relative path of the file last hashed, empty
+	// in the first and last report.
+	CurrentPath string `json:"current_path"`
+}
+
+// ProgressFunc receives Progress reports: one before the first file is
+// hashed, then at most one per ProgressInterval, then one when the walk
+// completes. It is called on the goroutine doing the hashing and should
+// return quickly. A ProgressFunc that panics is not called again; the walk
+// continues as if it had returned.
+//
+// With NestedExclude, a skill holding nested skills is walked twice when
+// signed, and reports start over for the second walk.
+type ProgressFunc func(Progress)
+
+// progressReporter rate-limits the calls of a ProgressFunc during one
+// walk. A nil *progressReporter reports nothing, so walks without a
+// ProgressFunc pay for a nil check per file.
+type progressReporter struct {
+	fn       ProgressFunc
+	root     string
+	interval time.Duration
+	last     time.Time
+	progress Progress
+	panicked bool
+}
+
+// newProgressReporter returns a reporter for a walk of the directory or
+// archive root, or nil when fn is nil.
+func newProgressReporter(root string, fn ProgressFunc) *progressReporter {
+	if fn == nil {
+		return nil
+	}
+	return &progressReporter{fn: fn, root: root, interval: progressInterval}
+}
+
+// start records the totals and sends the first report.
+func (r *progressReporter) start(totals hashStats) {
+	if r == nil {
+		return
+	}
+	r.progress.TotalFiles, r.progress.TotalBytes = totals.files, totals.bytes
+	r.report()
+}
+
+// file counts a hashed file. fullPath is its path, relative to the skill
+// root for archives.
+func (r *progressReporter) file(fullPath string, size int64) {
+	if r == nil {
+		return
+	}
+	r.progress.FilesProcessed++
+	r.progress.BytesHashed += size
+	if time.Since(r.last) < r.interval {
+		return
+	}
+	r.progress.CurrentPath = fullPath
+	if rel, err := filepath.Rel(r.root, fullPath); err == nil && filepath.IsAbs(fullPath) {
+		r.progress.CurrentPath = filepath.ToSlash(rel)
+	}
+	r.report()
+}
+
+// done sends the last report, with the totals of what was hashed.
+func (r *progressReporter) done() {
+	if r == nil {
+		return
+	}
+	r.progress.TotalFiles, r.progress.TotalBytes = r.progress.FilesProcessed, r.progress.BytesHashed
+	r.progress.CurrentPath = ""
+	r.report()
+}
+
+func (r *progressReporter) report() {
+	if r.panicked {
+		return
+	}
+	defer func() {
+		if recover() != nil {
+			r.panicked = true
+		}
+	}()
+	r.last = time.Now()
+	r.fn(r.progress)
+}
+
+// countSkillFiles counts the files and bytes a walk of the skill directory
+// root hashes, stopping after limits.MaxFiles files. Only directory entries
+// are read. It returns zero totals if the directory cannot be walked.
+func countSkillFiles(root string, limits ManifestLimits) hashStats {
+	var totals hashStats
+	maxFiles := limits.withDefaults().MaxFiles
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || d.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+		if name := d.Name(); name == SignatureFilename || name == ManifestFilename {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		totals.add(info.Size())
+		if totals.files >= maxFiles {
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	if err != nil {
+		return hashStats{}
+	}
+	return totals
+}
@@ -0,0 +1,161 @@
+package skill
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+// manyFileSkill creates a skill of 300 files of different sizes across
+// nested directories and returns its directory, manifest size in bytes and
+// file count.
+func manyFileSkill(t *testing.T) (string, int64, int) {
+	t.Helper()
+	files := map[string]string{"SKILL.md": "---\nname: many\n---\n"}
+	for i := 1; i < 300; i++ {
+		files[fmt.Sprintf("data/%02d/file%03d.txt", i%7, i)] = strings.Repeat("x", i)
+	}
+	var total int64
+	for _, content := range files {
+		total += int64(len(content))
+	}
+	return createSkillDir(t, files), total, len(files)
+}
+
+// recordProgress reports on every file, recording the reports.
+func recordProgress(t *testing.T) (*[]Progress, ProgressFunc) {
+	t.Helper()
+	saved := progressInterval
+	progressInterval = 0
+	t.Cleanup(func() { progressInterval = saved })
+
+	var mu sync.Mutex
+	var reports []Progress
+	return &reports, func(p Progress) {
+		mu.Lock()
+		defer mu.Unlock()
+		reports = append(reports, p)
+	}
+}
+
+// checkProgress checks that reports count up monotonically to the totals
+// of a skill of files files and total bytes.
+func checkProgress(t *testing.T, reports []Progress, files int, total int64) {
+	t.Helper()
+	if len(reports) != files+2 {
+		t.Fatalf("Expected a report before, for each of %d files and after the walk, got %d", files, len(reports))
+	}
+	first, last := reports[0], reports[len(reports)-1]
+	if first.FilesProcessed != 0 || first.BytesHashed != 0 || first.TotalFiles != files || first.TotalBytes != total {
+		t.Errorf("Expected the first report to carry the counted totals, got %+v", first)
+	}
+	if last.FilesProcessed != files || last.TotalFiles != files || last.BytesHashed != total || last.TotalBytes != total || last.CurrentPath != "" {
+		t.Errorf("Expected the last report to match the manifest, got %+v", last)
+	}
+	for i := 1; i < len(reports); i++ {
+		prev, cur := reports[i-1], reports[i]
+		if cur.FilesProcessed < prev.FilesProcessed || cur.BytesHashed < prev.BytesHashed {
+			t.Fatalf("Progress went backwards: %+v after %+v", cur, prev)
+		}
+		if cur.FilesProcessed > cur.TotalFiles || cur.BytesHashed > cur.TotalBytes {
+			t.Fatalf("Progress beyond its totals: %+v", cur)
+		}
+		if i < len(reports)-1 && (cur.CurrentPath == "" || strings.Contains(cur.CurrentPath, `\`) || filepath.IsAbs(cur.CurrentPath)) {
+			t.Fatalf("Expected a skill-relative current path, got %+v", cur)
+		}
+	}
+}
+
+func TestCanonicalizeSkillWithProgress(t *testing.T) {
+	dir, total, files := manyFileSkill(t)
+	reports, progress := recordProgress(t)
+
+	hash, manifest, err := CanonicalizeSkillWithProgress(dir, progress)
+	if err != nil {
+		t.Fatalf("CanonicalizeSkillWithProgress failed: %v", err)
+	}
+	if len(manifest) != files {
+		t.Fatalf("Expected %d files in the manifest, got %d", files, len(manifest))
+	}
+	checkProgress(t, *reports, files, total)
+	for _, p := range (*reports)[1 : len(*reports)-1] {
+		if _, ok := manifest[p.CurrentPath]; !ok {
+			t.Fatalf("Expected current paths from the manifest, got %q", p.CurrentPath)
+		}
+	}
+
+	want, _, err := CanonicalizeSkill(dir)
+	if err != nil || string(hash) != string(want) {
+		t.Errorf("Expected the same root hash as CanonicalizeSkill, got %x and %x (%v)", hash, want, err)
+	}
+}
+
+func TestProgressPanicDoesNotCorruptResult(t *testing.T) {
+	dir, _, files := manyFileSkill(t)
+	_, _ = recordProgress(t)
+	calls := 0
+	hash, manifest, err := CanonicalizeSkillWithProgress(dir, func(Progress) {
+		calls++
+		panic("progress bar crashed")
+	})
+	if err != nil {
+		t.Fatalf("Expected a panicking callback not to fail the walk, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("Expected a panicking callback not to be called again, got %d calls", calls)
+	}
+	want, _, _ := CanonicalizeSkill(dir)
+	if string(hash) != string(want) || len(manifest) != files {
+		t.Errorf("Expected the result of CanonicalizeSkill, got %x with %d files", hash, len(manifest))
+	}
+}
+
+func TestSignAndVerifyWithProgress(t *testing.T) {
+	privPEM, pubPEM := makeKeypair(t)
+	dir, total, files := manyFileSkill(t)
+
+	reports, progress := recordProgress(t)
+	if _, err := SignSkillWithOptions(dir, privPEM, "example.com", SignOptions{Progress: progress}); err != nil {
+		t.Fatalf("SignSkillWithOptions failed: %v", err)
+	}
+	checkProgress(t, *reports, files, total)
+
+	*reports = nil
+	result := VerifySkillOfflineWithOptions(dir, makeDiscovery(pubPEM), nil, nil, nil, "", VerifyOptions{Progress: progress})
+	if !result.Valid {
+		t.Fatalf("Expected valid skill, got %s: %s", result.ErrorCode, result.ErrorMessage)
+	}
+	checkProgress(t, *reports, files, total)
+
+	for _, format := range archiveFormats {
+		t.Run(string(format), func(t *testing.T) {
+			*reports = nil
+			r, size := openArchive(t, packDir(t, dir, format))
+			result := VerifySkillArchiveOfflineWithOptions(r, size, format, makeDiscovery(pubPEM), nil, nil, nil, "", VerifyOptions{Progress: progress})
+			if !result.Valid {
+				t.Fatalf("Expected valid skill, got %s: %s", result.ErrorCode, result.ErrorMessage)
+			}
+			checkProgress(t, *reports, files, total)
+		})
+	}
+}
+
+func TestVerifyInstalledSkillsProgress(t *testing.T) {
+	root, r := buildInstalledRoot(t)
+	reports, progress := recordProgress(t)
+	if _, err := VerifyInstalledSkills(root, r, verification.NewKeyPinStore(), WithConcurrency(2), WithProgress(progress)); err != nil {
+		t.Fatal(err)
+	}
+	done := make(map[string]Progress)
+	for _, p := range *reports {
+		done[p.Skill] = p
+	}
+	// gamma is unsigned and never hashed
+	if len(done) != 2 || done["alpha"].FilesProcessed != 2 || done["beta"].FilesProcessed != 3 {
+		t.Errorf("Expected final reports for alpha and beta, got %+v", done)
+	}
+}
@@ -14,20 +14,22 @@
 package skill
 
 import (
+	"bytes"
 	"crypto/ecdsa"
-	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
-	"regexp"
 	"sort"
 	"strings"
 	"time"
 
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/provenance"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/resolver"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/revocation"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
@@ -36,14 +38,6 @@ import (
 // SignatureFilename is the name of the signature file written into skill directories.
 const SignatureFilename = ".schemapin.sig"
 
-// Version constants written into the SchemapinVersion field of new
-// signatures. v1.3 signatures lack expires_at; v1.4 signatures may carry
-// it. Verifiers handle both transparently.
-const (
-	schemapinVersionV13 = "1.3"
-	schemapinVersionV14 = "1.4"
-)
-
 // SkillSignature represents the JSON structure of a .schemapin.sig file.
 //
 // Optional v1.4 fields:
@@ -63,12 +57,37 @@ type SkillSignature struct {
 	SchemaVersion    string `json:"schema_version,omitempty"`
 	PreviousHash     string `json:"previous_hash,omitempty"`
 	// Canonicalization (v1.4 alpha.3) names the algorithm used to produce
-	// the signing input. Absence is wire-equivalent to "schemapin-v1".
-	// Verifiers MUST reject any other value as ErrCanonicalizationUnsupported.
+	// the signing input. Signers always write it; absence (legacy
+	// signatures) is wire-equivalent to "schemapin-v1". Verifiers MUST
+	// reject unknown values as ErrCanonicalizationUnsupported.
 	Canonicalization string            `json:"canonicalization,omitempty"`
 	Domain           string            `json:"domain"`
 	SignerKid        string            `json:"signer_kid"`
-	FileManifest     map[string]string `json:"file_manifest"`
+	FileManifest     map[string]string `json:"file_manifest,omitempty"`
+	// ManifestHash (optional) is the sha256:<hex> of the .schemapin.manifest
+	// file holding the file manifest and sizes of a split-manifest
+	// signature (SignOptions.SplitManifest), which then has no
+	// file_manifest. LoadSignature reads and checks the manifest file.
+	ManifestHash string `json:"manifest_hash,omitempty"`
+	// FileSizes (optional) records each manifest file's size in bytes. It
+	// is not signed, so content policies measure the files on disk and only
+	// cross-check these values. Older verifiers ignore it.
+	FileSizes map[string]int64 `json:"file_sizes,omitempty"`
+	// MutablePaths (optional) are sorted glob patterns ("state/**") naming
+	// files that may change after signing. The signature covers the list:
+	// it is made over SHA-256(skill_hash || JSON list) instead of the root
+	// hash. Verifiers skip content comparison for matching files.
+	MutablePaths []string `json:"mutable_paths,omitempty"`
+	// NestedSkills (optional) maps the nested skill subdirectories left out
+	// of the manifest (SignOptions.Nested NestedExclude) to their root
+	// hashes. The signature covers them: it is made over SHA-256(hash ||
+	// JSON object), where hash is what it would be made over without them.
+	NestedSkills map[string]string `json:"nested_skills,omitempty"`
+	// Provenance (optional) is a DSSE envelope with an in-toto statement,
+	// e.g. SLSA build provenance, naming skill_hash as a subject. It is
+	// signed separately and checked only when VerifyOptions.Provenance is
+	// set.
+	Provenance *provenance.Envelope `json:"provenance,omitempty"`
 }
 
 // SignOptions are optional sign-time parameters for SignSkillWithOptions.
@@ -86,8 +105,7 @@ type SignOptions struct {
 	SkillName string
 	// ExpiresIn sets a TTL relative to signing time. When > 0, the
 	// signature carries an RFC 3339 expires_at field and the version is
-	// bumped to "1.4". A zero value (the default) writes no expires_at and
-	// keeps the version at "1.3".
+	// bumped to "1.4". A zero value (the default) writes no expires_at.
 	ExpiresIn time.Duration
 	// SchemaVersion is a caller-supplied semver string identifying *this*
 	// version of the signed artifact (v1.4 alpha.2). Empty omits the field.
@@ -96,10 +114,56 @@ type SignOptions struct {
 	// forming a hash chain (v1.4 alpha.2). Pair with VerifyChain at verify
 	// time. Empty omits the field.
 	PreviousHash string
-	// Canonicalization (v1.4 alpha.3) is the algorithm identifier to write
-	// into the signature. Empty omits the field on the wire (== implicit
-	// "schemapin-v1"); pass "schemapin-v1" to declare it explicitly.
+	// Canonicalization (v1.4 alpha.3) is the algorithm the skill is
+	// canonicalized with and whose identifier is written into the
+	// signature. Empty selects core.DefaultCanonicalization.
 	Canonicalization string
+	// RecordFileSizes writes per-file sizes into the signature's file_sizes
+	// field for use by content policies. Off by default.
+	RecordFileSizes bool
+	// ExpectedHash, when set, is the sha256:<hex> root hash the skill must
+	// have, e.g. one recorded by a build job with `schemapin-sign hash`.
+	// Signing fails with a *core.HashMismatchError, and no signature is
+	// written, if the content has changed since.
+	ExpectedHash string
+	// ArchiveLimits bounds the archives signed by SignSkillArchive. Zero
+	// fields take the value from DefaultArchiveLimits.
+	ArchiveLimits ArchiveLimits
+	// MutablePaths are glob patterns, relative to the skill root, of files
+	// that may change after signing, such as state or cache files. "**"
+	// matches any number of path segments. The patterns are signed; empty
+	// writes no mutable_paths field.
+	MutablePaths []string
+	// Clock supplies signed_at and the base for ExpiresIn. Nil means
+	// clock.Real; a fixed clock makes signatures reproducible.
+	Clock clock.Clock
+	// SplitManifest writes the file manifest and sizes to a separate
+	// .schemapin.manifest file, referenced by hash from .schemapin.sig,
+	// keeping the signature small for skills with many files. Not
+	// supported by SignSkillArchive.
+	SplitManifest bool
+	// ManifestLimits bounds the skill directory signed by
+	// SignSkillWithOptions. Zero fields take the value from
+	// DefaultManifestLimits.
+	ManifestLimits ManifestLimits
+	// TrackExecBit records whether each file is executable in its
+	// file_manifest entry ("sha256:<hex>;x" or "sha256:<hex>;-"), covered
+	// by the signature. Verifiers report files whose bit has changed since.
+	// ExpectedHash is still compared with the hash of the contents alone.
+	// Not supported for skill directories on Windows.
+	TrackExecBit bool
+	// Provenance is attached to the signature as its provenance field.
+	// Signing fails, and no signature is written, unless it names the
+	// skill's root hash as a subject. Its signature is not checked.
+	Provenance *provenance.Envelope
+	// Nested selects how subdirectories holding their own .schemapin.sig
+	// are signed. Empty means NestedFail: signing fails with a
+	// *NestedSkillsError listing them. With NestedExclude, ExpectedHash
+	// and Provenance refer to the root hash of the parent's own files.
+	Nested NestedMode
+	// Progress, when set, is called as the skill's files are hashed (see
+	// ProgressFunc).
+	Progress ProgressFunc
 }
 
 // TamperedFiles holds the result of comparing two file manifests.
@@ -107,10 +171,15 @@ type TamperedFiles struct {
 	Modified []string
 	Added    []string
 	Removed  []string
+	// PermissionChanged lists files whose content is unchanged but whose
+	// executable bit differs from the signed one.
+	PermissionChanged []string
 }
 
-// walkSorted recursively walks a directory in sorted order, building the manifest.
-func walkSorted(dir, baseDir string, manifest map[string]string) error {
+// walkSorted recursively walks a directory in sorted order, building the
+// manifest with alg's file digests. A non-nil nested records the signature
+// files below baseDir and hashes the subdirectories it excludes separately.
+func walkSorted(dir, baseDir string, manifest *manifestBuilder, alg *core.Canonicalization, nested *nestedWalk) error {
 	entries, err := os.ReadDir(dir)
 	if err != nil {
 		return fmt.Errorf("failed to read directory %s: %w", dir, err)
@@ -133,132 +202,212 @@ func walkSorted(dir, baseDir string, manifest map[string]string) error {
 			continue
 		}
 
+		relPath, err := filepath.Rel(baseDir, fullPath)
+		if err != nil {
+			return fmt.Errorf("failed to compute relative path: %w", err)
+		}
+		// Normalize to forward slashes
+		relStr := filepath.ToSlash(relPath)
+
 		if info.IsDir() {
-			if err := walkSorted(fullPath, baseDir, manifest); err != nil {
+			if nested != nil && nested.exclude[relStr] {
+				child := newManifestBuilder(manifest.limits)
+				child.progress = manifest.progress
+				if err := walkSorted(fullPath, fullPath, child, alg, nil); err != nil {
+					return err
+				}
+				if err := nested.addSkill(relStr, child.manifest, alg); err != nil {
+					return err
+				}
+				manifest.hashed.files += child.hashed.files
+				manifest.hashed.bytes += child.hashed.bytes
+				continue
+			}
+			if err := walkSorted(fullPath, baseDir, manifest, alg, nested); err != nil {
 				return err
 			}
 			continue
 		}
 
 		// Regular file
-		if entry.Name() == SignatureFilename {
+		if entry.Name() == SignatureFilename && nested != nil && dir != baseDir {
+			nested.signatures = append(nested.signatures, relStr)
+		}
+		if entry.Name() == SignatureFilename || entry.Name() == ManifestFilename {
 			continue
 		}
-
-		relPath, err := filepath.Rel(baseDir, fullPath)
-		if err != nil {
-			return fmt.Errorf("failed to compute relative path: %w", err)
+		if err := manifest.reserve(); err != nil {
+			return err
 		}
-		// Normalize to forward slashes
-		relStr := filepath.ToSlash(relPath)
 
 		fileBytes, err := os.ReadFile(fullPath) // #nosec G304 -- path constructed from trusted directory walk
 		if err != nil {
 			return fmt.Errorf("failed to read file %s: %w", fullPath, err)
 		}
 
-		h := sha256.New()
-		h.Write([]byte(relStr))
-		h.Write(fileBytes)
-		digest := hex.EncodeToString(h.Sum(nil))
-		manifest[relStr] = "sha256:" + digest
+		digest, err := alg.SkillFileDigest(relStr, bytes.NewReader(fileBytes))
+		if err != nil {
+			return fmt.Errorf("failed to hash file %s: %w", fullPath, err)
+		}
+		if err := manifest.add(relStr, digest); err != nil {
+			return err
+		}
+		manifest.hashed.add(int64(len(fileBytes)))
+		manifest.progress.file(fullPath, int64(len(fileBytes)))
 	}
 
 	return nil
 }
 
+// manifestFileSizes returns the size in bytes of every file in manifest.
+func manifestFileSizes(skillDir string, manifest map[string]string) (map[string]int64, error) {
+	absDir, err := filepath.Abs(skillDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve skill directory: %w", err)
+	}
+	absDir, err = filepath.EvalSymlinks(absDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to eval symlinks: %w", err)
+	}
+
+	sizes := make(map[string]int64, len(manifest))
+	for relPath := range manifest {
+		info, err := os.Lstat(filepath.Join(absDir, filepath.FromSlash(relPath)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat %s: %w", relPath, err)
+		}
+		sizes[relPath] = info.Size()
+	}
+	return sizes, nil
+}
+
 // CanonicalizeSkill walks a skill directory deterministically and computes a root hash.
 //
 // Algorithm:
 //  1. Recursive sorted directory walk
-//  2. Skip .schemapin.sig and symlinks
+//  2. Skip .schemapin.sig, .schemapin.manifest and symlinks
 //  3. Normalize paths to forward slashes
 //  4. Per-file: SHA-256(relative_path_utf8 + file_bytes) -> hex -> "sha256:<hex>"
 //  5. Root: sort manifest keys, extract hex digests, concatenate, SHA-256 -> raw bytes
 //
-// Returns (root_hash_bytes, manifest, error). Returns error if directory is empty.
+// This is the schemapin-v1 algorithm (core.CanonicalizationV1).
+//
+// Returns (root_hash_bytes, manifest, error). Returns error if directory is
+// empty, or a *ManifestLimitError if it exceeds DefaultManifestLimits.
 func CanonicalizeSkill(skillDir string) ([]byte, map[string]string, error) {
-	absDir, err := filepath.Abs(skillDir)
+	return CanonicalizeSkillWith(skillDir, core.CanonicalizationV1)
+}
+
+// CanonicalizeSkillWith is CanonicalizeSkill using the named
+// canonicalization algorithm. An empty name selects core.CanonicalizationV1.
+func CanonicalizeSkillWith(skillDir, canonicalization string) ([]byte, map[string]string, error) {
+	return CanonicalizeSkillWithLimits(skillDir, canonicalization, ManifestLimits{})
+}
+
+// CanonicalizeSkillWithLimits is CanonicalizeSkillWith with the manifest
+// bounded by limits instead of DefaultManifestLimits. The walk stops with
+// a *ManifestLimitError as soon as a limit is exceeded.
+func CanonicalizeSkillWithLimits(skillDir, canonicalization string, limits ManifestLimits) ([]byte, map[string]string, error) {
+	alg, err := core.LookupCanonicalization(canonicalization)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to resolve skill directory: %w", err)
+		return nil, nil, err
 	}
+	return canonicalizeSkill(skillDir, alg, limits)
+}
 
-	// Resolve any symlinks in the base directory itself
-	absDir, err = filepath.EvalSymlinks(absDir)
+// CanonicalizeSkillWithProgress is CanonicalizeSkill calling progress as
+// the files are hashed (see ProgressFunc). A nil progress reports nothing.
+func CanonicalizeSkillWithProgress(skillDir string, progress ProgressFunc) ([]byte, map[string]string, error) {
+	alg, err := core.LookupCanonicalization(core.CanonicalizationV1)
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to eval symlinks: %w", err)
+		return nil, nil, err
 	}
+	return canonicalizeSkillNested(skillDir, alg, ManifestLimits{}, nil, progress)
+}
+
+func canonicalizeSkill(skillDir string, alg *core.Canonicalization, limits ManifestLimits) ([]byte, map[string]string, error) {
+	return canonicalizeSkillNested(skillDir, alg, limits, nil, nil)
+}
 
-	manifest := make(map[string]string)
-	if err := walkSorted(absDir, absDir, manifest); err != nil {
+// canonicalizeSkillNested is canonicalizeSkill collecting nested skills in
+// nested, when it is not nil, and reporting to progress, when it is not
+// nil. Subdirectories nested excludes must exist.
+func canonicalizeSkillNested(skillDir string, alg *core.Canonicalization, limits ManifestLimits, nested *nestedWalk, progress ProgressFunc) ([]byte, map[string]string, error) {
+	builder, err := walkSkill(skillDir, alg, limits, nested, progress)
+	if err != nil {
 		return nil, nil, err
 	}
+	return alg.SkillRootHash(builder.manifest), builder.manifest, nil
+}
 
-	if len(manifest) == 0 {
-		return nil, nil, fmt.Errorf("skill directory is empty or contains no signable files: %s", skillDir)
+// walkSkill builds the manifest of skillDir, failing if it has no
+// signable files. A non-nil progress is called as files are hashed, after
+// a pass counting them.
+func walkSkill(skillDir string, alg *core.Canonicalization, limits ManifestLimits, nested *nestedWalk, progress ProgressFunc) (*manifestBuilder, error) {
+	absDir, err := filepath.Abs(skillDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve skill directory: %w", err)
 	}
 
-	// Collect sorted keys
-	keys := make([]string, 0, len(manifest))
-	for k := range manifest {
-		keys = append(keys, k)
+	// Resolve any symlinks in the base directory itself
+	absDir, err = filepath.EvalSymlinks(absDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to eval symlinks: %w", err)
 	}
-	sort.Strings(keys)
 
-	// Extract hex digests and concatenate
-	var builder strings.Builder
-	for _, k := range keys {
-		val := manifest[k]
-		// Split on ":" and take the hex part
-		parts := strings.SplitN(val, ":", 2)
-		if len(parts) == 2 {
-			builder.WriteString(parts[1])
+	builder := newManifestBuilder(limits)
+	if builder.progress = newProgressReporter(absDir, progress); builder.progress != nil {
+		builder.progress.start(countSkillFiles(absDir, limits))
+	}
+	if err := walkSorted(absDir, absDir, builder, alg, nested); err != nil {
+		return nil, err
+	}
+	if nested != nil {
+		if err := nested.checkFound(); err != nil {
+			return nil, err
 		}
 	}
 
-	rootHash := sha256.Sum256([]byte(builder.String()))
-	return rootHash[:], manifest, nil
+	if len(builder.manifest) == 0 {
+		return nil, fmt.Errorf("skill directory is empty or contains no signable files: %s", skillDir)
+	}
+	builder.progress.done()
+	return builder, nil
 }
 
-// ParseSkillName extracts the skill name from SKILL.md frontmatter.
-// Falls back to the directory basename if SKILL.md is missing or has no name field.
+// ParseSkillName extracts the skill name from SKILL.md frontmatter (see
+// ParseFrontmatter). Falls back to the directory basename if SKILL.md is
+// missing or has no name field, or the name contains control characters.
 func ParseSkillName(skillDir string) string {
 	absDir, err := filepath.Abs(skillDir)
 	if err != nil {
 		return filepath.Base(skillDir)
 	}
 
-	skillMD := filepath.Join(absDir, "SKILL.md")
-	data, err := os.ReadFile(skillMD) // #nosec G304 -- path constructed from user-provided skill directory
+	fields, err := ParseSkillFrontmatter(absDir)
 	if err != nil {
 		return filepath.Base(absDir)
 	}
-
-	text := string(data)
-
-	// Match frontmatter block: --- ... ---
-	fmRe := regexp.MustCompile(`(?s)^---\s*\n(.*?)\n---`)
-	fmMatch := fmRe.FindStringSubmatch(text)
-	if fmMatch == nil {
-		return filepath.Base(absDir)
-	}
-
-	frontmatter := fmMatch[1]
-
-	// Match name: value in frontmatter (with optional quotes)
-	nameRe := regexp.MustCompile(`(?m)^name:\s*['"]?([^'"#\n]+?)['"]?\s*$`)
-	nameMatch := nameRe.FindStringSubmatch(frontmatter)
-	if nameMatch == nil {
-		return filepath.Base(absDir)
+	if name := frontmatterName(fields); name != "" {
+		return name
 	}
-
-	return strings.TrimSpace(nameMatch[1])
+	return filepath.Base(absDir)
 }
 
-// LoadSignature reads and parses the .schemapin.sig file from a skill directory.
+// LoadSignature reads and parses the .schemapin.sig file from a skill
+// directory. For a split-manifest signature the file manifest is read
+// from .schemapin.manifest and checked against manifest_hash, so the
+// result looks the same for both layouts. Signatures exceeding
+// DefaultManifestLimits fail with a *ManifestLimitError.
 func LoadSignature(skillDir string) (*SkillSignature, error) {
+	return LoadSignatureWithLimits(skillDir, ManifestLimits{})
+}
+
+// LoadSignatureWithLimits is LoadSignature with the signature and manifest
+// files bounded by limits instead of DefaultManifestLimits.
+func LoadSignatureWithLimits(skillDir string, limits ManifestLimits) (*SkillSignature, error) {
 	sigPath := filepath.Join(skillDir, SignatureFilename)
-	data, err := os.ReadFile(sigPath) // #nosec G304 -- path constructed from user-provided skill directory
+	data, err := readLimited(sigPath, limits.withDefaults().MaxManifestBytes)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read signature file: %w", err)
 	}
@@ -268,7 +417,7 @@ func LoadSignature(skillDir string) (*SkillSignature, error) {
 		return nil, fmt.Errorf("failed to parse signature file: %w", err)
 	}
 
-	return &sig, nil
+	return resolveManifest(skillDir, &sig, limits)
 }
 
 // SignSkill canonicalizes a skill directory, signs it, and writes .schemapin.sig.
@@ -290,24 +439,123 @@ func SignSkill(skillDir, privateKeyPEM, domain string, signerKid, skillName stri
 //
 // When options.ExpiresIn > 0, an RFC 3339 expires_at timestamp is written
 // (truncated to seconds, UTC, "Z" suffix) and the schemapin_version is
-// bumped to "1.4". When ExpiresIn is zero, expires_at is omitted and the
-// version stays at "1.3" -- bytewise-identical to the v1.3 wire format.
+// bumped to "1.4". The signature always names its canonicalization
+// algorithm, options.Canonicalization or core.DefaultCanonicalization.
 func SignSkillWithOptions(skillDir, privateKeyPEM, domain string, options SignOptions) (*SkillSignature, error) {
-	keyManager := crypto.NewKeyManager()
-
-	privateKey, err := keyManager.LoadPrivateKeyPEM(privateKeyPEM)
-	if err != nil {
+	if _, err := crypto.NewKeyManager().LoadPrivateKeyPEM(privateKeyPEM); err != nil {
 		return nil, fmt.Errorf("failed to load private key: %w", err)
 	}
+	alg, err := signingCanonicalization(&options)
+	if err != nil {
+		return nil, err
+	}
 
-	rootHash, manifest, err := CanonicalizeSkill(skillDir)
+	var (
+		rootHash []byte
+		manifest map[string]string
+	)
+	nested, err := canonicalizeForSigning(options.Nested, func(walk *nestedWalk) (err error) {
+		rootHash, manifest, err = canonicalizeSkillNested(skillDir, alg, options.ManifestLimits, walk, options.Progress)
+		return err
+	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to canonicalize skill: %w", err)
 	}
 
-	skillName := options.SkillName
-	if skillName == "" {
-		skillName = ParseSkillName(skillDir)
+	var sizes map[string]int64
+	if options.RecordFileSizes {
+		sizes, err = manifestFileSizes(skillDir, manifest)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var executable map[string]bool
+	if options.TrackExecBit {
+		if executable, err = manifestExecBits(skillDir, manifest); err != nil {
+			return nil, err
+		}
+	}
+
+	if options.SkillName == "" {
+		options.SkillName = ParseSkillName(skillDir)
+	}
+
+	sig, err := newSkillSignature(rootHash, manifest, sizes, executable, nested, privateKeyPEM, domain, options)
+	if err != nil {
+		return nil, err
+	}
+
+	// The signature written is split, but the one returned keeps its
+	// manifest, as LoadSignature would return it.
+	written := *sig
+	var manifestJSON []byte
+	if options.SplitManifest {
+		if manifestJSON, err = splitManifest(&written); err != nil {
+			return nil, err
+		}
+		sig.ManifestHash = written.ManifestHash
+	}
+	sigJSON, err := marshalSignature(&written)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := writeManifestFile(skillDir, manifestJSON); err != nil {
+		return nil, err
+	}
+	sigPath := filepath.Join(skillDir, SignatureFilename)
+	if err := os.WriteFile(sigPath, sigJSON, 0600); err != nil { // #nosec G306
+		return nil, fmt.Errorf("failed to write signature file: %w", err)
+	}
+
+	return sig, nil
+}
+
+// newSkillSignature signs rootHash and builds the signature document.
+// options.SkillName and options.Canonicalization must already be resolved.
+// A non-nil executable records each file's executable bit in the manifest,
+// which changes the root hash that is signed. nested are the root hashes
+// of the nested skills left out of manifest.
+func newSkillSignature(rootHash []byte, manifest map[string]string, sizes map[string]int64, executable map[string]bool, nested map[string]string, privateKeyPEM, domain string, options SignOptions) (*SkillSignature, error) {
+	if err := core.CheckExpectedHash(options.ExpectedHash, rootHash); err != nil {
+		return nil, fmt.Errorf("refusing to sign skill: %w", err)
+	}
+	if domain != "" {
+		if _, err := core.NormalizeDomain(domain); err != nil {
+			return nil, fmt.Errorf("refusing to sign skill: %w", err)
+		}
+	}
+	if executable != nil {
+		alg, err := core.LookupCanonicalization(options.Canonicalization)
+		if err != nil {
+			return nil, err
+		}
+		manifest = withExecBits(manifest, executable)
+		rootHash = alg.SkillRootHash(manifest)
+	}
+	if options.Provenance != nil {
+		if err := provenance.CheckSubject(options.Provenance, rootHash); err != nil {
+			return nil, fmt.Errorf("refusing to sign skill: %w", err)
+		}
+	}
+	mutablePaths, err := validateMutablePaths(options.MutablePaths)
+	if err != nil {
+		return nil, err
+	}
+	signingHash, err := mutableSigningHash(rootHash, mutablePaths)
+	if err != nil {
+		return nil, err
+	}
+	if signingHash, err = nestedSigningHash(signingHash, nested); err != nil {
+		return nil, err
+	}
+
+	keyManager := crypto.NewKeyManager()
+
+	privateKey, err := keyManager.LoadPrivateKeyPEM(privateKeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load private key: %w", err)
 	}
 
 	signerKid := options.SignerKid
@@ -324,30 +572,25 @@ func SignSkillWithOptions(skillDir, privateKeyPEM, domain string, options SignOp
 	}
 
 	sigManager := crypto.NewSignatureManager()
-	signatureB64, err := sigManager.SignHash(rootHash, privateKey)
+	signatureB64, err := sigManager.SignHash(signingHash, privateKey)
 	if err != nil {
 		return nil, fmt.Errorf("failed to sign hash: %w", err)
 	}
 
-	now := time.Now().UTC().Truncate(time.Second)
+	now := clock.OrReal(options.Clock).Now()
 	expiresAt := ""
 	if options.ExpiresIn > 0 {
-		expiresAt = now.Add(options.ExpiresIn).UTC().Format(time.RFC3339)
-	}
-
-	// Any v1.4 optional field bumps the version stamp; pure v1.3 sigs stay
-	// "1.3" for byte-stable backward compatibility.
-	version := schemapinVersionV13
-	if expiresAt != "" || options.SchemaVersion != "" || options.PreviousHash != "" || options.Canonicalization != "" {
-		version = schemapinVersionV14
+		expiresAt = clock.Format(now.Add(options.ExpiresIn))
 	}
 
-	sig := &SkillSignature{
-		SchemapinVersion: version,
-		SkillName:        skillName,
+	// The canonicalization field is a v1.4 field, so every new signature
+	// is stamped "1.4".
+	return &SkillSignature{
+		SchemapinVersion: core.SchemapinVersion14,
+		SkillName:        options.SkillName,
 		SkillHash:        fmt.Sprintf("sha256:%s", hex.EncodeToString(rootHash)),
 		Signature:        signatureB64,
-		SignedAt:         now.Format(time.RFC3339),
+		SignedAt:         clock.Format(now),
 		ExpiresAt:        expiresAt,
 		SchemaVersion:    options.SchemaVersion,
 		PreviousHash:     options.PreviousHash,
@@ -355,19 +598,29 @@ func SignSkillWithOptions(skillDir, privateKeyPEM, domain string, options SignOp
 		Domain:           domain,
 		SignerKid:        signerKid,
 		FileManifest:     manifest,
+		FileSizes:        sizes,
+		MutablePaths:     mutablePaths,
+		NestedSkills:     nested,
+		Provenance:       options.Provenance,
+	}, nil
+}
+
+// signingCanonicalization resolves options.Canonicalization, filling in the
+// default, to the algorithm the skill is signed with.
+func signingCanonicalization(options *SignOptions) (*core.Canonicalization, error) {
+	if options.Canonicalization == "" {
+		options.Canonicalization = core.DefaultCanonicalization
 	}
+	return core.LookupCanonicalization(options.Canonicalization)
+}
 
+// marshalSignature encodes sig as written to .schemapin.sig.
+func marshalSignature(sig *SkillSignature) ([]byte, error) {
 	sigJSON, err := json.MarshalIndent(sig, "", "  ")
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal signature: %w", err)
 	}
-
-	sigPath := filepath.Join(skillDir, SignatureFilename)
-	if err := os.WriteFile(sigPath, append(sigJSON, '\n'), 0600); err != nil { // #nosec G306
-		return nil, fmt.Errorf("failed to write signature file: %w", err)
-	}
-
-	return sig, nil
+	return append(sigJSON, '\n'), nil
 }
 
 // VerifySkillOffline verifies a signed skill folder offline using pre-fetched
@@ -393,7 +646,20 @@ func VerifySkillOffline(
 		}
 	}
 
-	domain := sig.Domain
+	return verifySkillDir(skillDir, disc, sig, rev, pinStore, toolID, VerifyOptions{})
+}
+
+// verifySkillDir is VerifySkillOffline for a loaded signature, with the
+// signature checks of options applied.
+func verifySkillDir(
+	skillDir string,
+	disc *discovery.WellKnownResponse,
+	sig *SkillSignature,
+	rev *revocation.RevocationDocument,
+	pinStore *verification.KeyPinStore,
+	toolID string,
+	options VerifyOptions,
+) *verification.VerificationResult {
 	if toolID == "" {
 		toolID = sig.SkillName
 		if toolID == "" {
@@ -401,16 +667,117 @@ func VerifySkillOffline(
 		}
 	}
 
-	// Step 1a (v1.4 alpha.3): canonicalization algorithm check.
-	if bad := verification.CheckCanonicalization(sig.Canonicalization); bad != "" {
+	resolved, err := resolveManifest(skillDir, sig, options.ManifestLimits)
+	if err != nil {
+		return &verification.VerificationResult{
+			Valid:        false,
+			Domain:       sig.Domain,
+			ErrorCode:    verification.ErrSignatureInvalid,
+			ErrorMessage: err.Error(),
+		}
+	}
+
+	var execBits func(manifest map[string]string) (map[string]bool, error)
+	if execBitsSupported {
+		execBits = func(manifest map[string]string) (map[string]bool, error) {
+			return manifestExecBits(skillDir, manifest)
+		}
+	}
+	return verifySkillSignature(resolved, disc, rev, pinStore, toolID, options, func(alg *core.Canonicalization, nested *nestedWalk) (map[string]string, hashStats, error) {
+		builder, err := walkSkill(skillDir, alg, options.ManifestLimits, nested, options.Progress)
+		if err != nil {
+			return nil, hashStats{}, err
+		}
+		return builder.manifest, builder.hashed, nil
+	}, execBits)
+}
+
+// verifySkillSignature runs steps 1a-7 of the verification flow. The skill
+// is only canonicalized, via canonicalize with the signature's algorithm,
+// once the key has been accepted; the root hash is recomputed from the
+// returned manifest after applying sig.MutablePaths. canonicalize leaves
+// the subdirectories of a non-nil nested, sig.NestedSkills, out of the
+// manifest and records their root hashes in it; it also returns what it
+// hashed, for options.Timings. For signatures with executable bits,
+// execBits returns the current bits of the manifest's files; nil means the
+// platform has none to compare.
+func verifySkillSignature(
+	sig *SkillSignature,
+	disc *discovery.WellKnownResponse,
+	rev *revocation.RevocationDocument,
+	pinStore *verification.KeyPinStore,
+	toolID string,
+	options VerifyOptions,
+	canonicalize func(alg *core.Canonicalization, nested *nestedWalk) (map[string]string, hashStats, error),
+	execBits func(manifest map[string]string) (map[string]bool, error),
+) (result *verification.VerificationResult) {
+	domain := sig.Domain
+	eval := verification.NewPolicyEvaluation(options.Policy)
+
+	timer := verification.NewTimer(options.Timings)
+	start := timer.Start()
+	var hashed *hashStats
+	defer func() {
+		if timer == nil {
+			return
+		}
+		timer.Stop(verification.TimingTotal, start)
+		result.Metadata = timer.Record(result.Metadata)
+		if hashed != nil {
+			result.Metadata[MetadataFilesHashed] = hashed.files
+			result.Metadata[MetadataBytesHashed] = hashed.bytes
+		}
+	}()
+
+	// Once the skill is canonicalized, every result reports the recomputed
+	// root hash next to the signed one
+	var skillHash string
+	defer func() {
+		if skillHash != "" {
+			result.SkillHash, result.SignedSkillHash = skillHash, sig.SkillHash
+		}
+	}()
+
+	// Step 1a: signature format version check. Signatures written by a
+	// newer signer may use rules this verifier does not know.
+	if _, err := core.RulesForVersion(sig.SchemapinVersion); err != nil {
+		return &verification.VerificationResult{
+			Valid:        false,
+			Domain:       domain,
+			ErrorCode:    verification.ErrUnsupportedVersion,
+			ErrorMessage: err.Error(),
+		}
+	}
+
+	// Step 1b (v1.4 alpha.3): canonicalization algorithm lookup. Legacy
+	// signatures without the field use schemapin-v1.
+	alg, err := core.LookupCanonicalization(sig.Canonicalization)
+	if err != nil {
 		return &verification.VerificationResult{
 			Valid:        false,
 			Domain:       domain,
 			ErrorCode:    verification.ErrCanonicalizationUnsupported,
-			ErrorMessage: fmt.Sprintf("Unsupported canonicalization algorithm: %s", bad),
+			ErrorMessage: fmt.Sprintf("Unsupported canonicalization algorithm: %s", sig.Canonicalization),
 		}
 	}
 
+	// A domain, possibly with a tenant's path prefix, must be a trust
+	// identity before it is looked up anywhere
+	if domain != "" {
+		if _, err := core.NormalizeDomain(domain); err != nil {
+			return &verification.VerificationResult{
+				Valid:        false,
+				Domain:       domain,
+				ErrorCode:    verification.ErrDomainMismatch,
+				ErrorMessage: err.Error(),
+			}
+		}
+	}
+
+	if eval.CheckDomain(domain) {
+		return eval.Failure(domain, verification.ErrDomainBlocked, "")
+	}
+
 	// Step 2: Validate discovery document
 	if disc == nil || disc.PublicKeyPEM == "" || !strings.Contains(disc.PublicKeyPEM, "-----BEGIN PUBLIC KEY-----") {
 		return &verification.VerificationResult{
@@ -444,19 +811,27 @@ func VerifySkillOffline(
 	}
 
 	// Step 4: Check revocation
-	if err := revocation.CheckRevocationCombined(disc.RevokedKeys, rev, fingerprint); err != nil {
-		return &verification.VerificationResult{
-			Valid:        false,
-			Domain:       domain,
-			ErrorCode:    verification.ErrKeyRevoked,
-			ErrorMessage: err.Error(),
+	t := timer.Start()
+	err = revocation.CheckRevocationCombined(disc.RevokedKeys, rev, fingerprint)
+	timer.Stop(verification.TimingRevocationCheck, t)
+	if err != nil {
+		if eval.Check(verification.RuleRevocation, err.Error()) {
+			return eval.Failure(domain, verification.ErrKeyRevoked, err.Error())
 		}
 	}
 
-	// Step 5: TOFU key pinning
+	// Step 5: TOFU key pinning. Without a pin store no key counts as
+	// pinned for a policy's require_pinned.
+	if eval.Enabled() && (pinStore == nil || pinStore.GetPinned(toolID, domain) == "") {
+		if eval.Check(verification.RuleRequirePinned, fmt.Sprintf("no key is pinned for %s@%s", toolID, domain)) {
+			return eval.Failure(domain, "", "")
+		}
+	}
 	var pinResult verification.PinResult
 	if pinStore != nil {
+		t = timer.Start()
 		pinResult = pinStore.CheckAndPin(toolID, domain, fingerprint)
+		timer.Stop(verification.TimingPinLookup, t)
 		if pinResult == verification.PinChanged {
 			return &verification.VerificationResult{
 				Valid:        false,
@@ -467,8 +842,24 @@ func VerifySkillOffline(
 		}
 	}
 
-	// Step 6: Canonicalize and verify signature
-	rootHash, _, err := CanonicalizeSkill(skillDir)
+	// Step 6: Canonicalize and verify signature. Nested skills recorded in
+	// the signature are left out of the manifest and hashed on their own.
+	var nested *nestedWalk
+	if len(sig.NestedSkills) > 0 {
+		dirs, err := validateNestedSkills(sig.NestedSkills)
+		if err != nil {
+			return &verification.VerificationResult{
+				Valid:        false,
+				Domain:       domain,
+				ErrorCode:    verification.ErrSignatureInvalid,
+				ErrorMessage: err.Error(),
+			}
+		}
+		nested = newNestedWalk(dirs)
+	}
+	t = timer.Start()
+	manifest, stats, err := canonicalize(alg, nested)
+	timer.Stop(verification.TimingCanonicalizeWalk, t)
 	if err != nil {
 		return &verification.VerificationResult{
 			Valid:        false,
@@ -477,39 +868,182 @@ func VerifySkillOffline(
 			ErrorMessage: fmt.Sprintf("Failed to canonicalize skill: %v", err),
 		}
 	}
+	hashed = &stats
+
+	// A signature with executable bits is checked against its signed bits,
+	// so that a changed bit is reported rather than failing the signature.
+	// The current bits are compared once the signature has verified.
+	current := manifest
+	tracked := tracksExecBits(sig.FileManifest)
+	if tracked {
+		manifest = withSignedModes(manifest, sig.FileManifest)
+	}
 
-	sigManager := crypto.NewSignatureManager()
-	valid := sigManager.VerifySignature(rootHash, sig.Signature, publicKey)
-
-	if !valid {
+	// Files matching the signed mutable paths are hashed with their signed
+	// digests, so their current content does not affect the result.
+	manifest, mutableSkipped, err := applyMutablePaths(manifest, sig.FileManifest, sig.MutablePaths, options.AllowNewMutableFiles)
+	if err != nil {
 		return &verification.VerificationResult{
 			Valid:        false,
 			Domain:       domain,
 			ErrorCode:    verification.ErrSignatureInvalid,
-			ErrorMessage: "Signature verification failed",
+			ErrorMessage: err.Error(),
+		}
+	}
+	rootHash := alg.SkillRootHash(manifest)
+	skillHash = fmt.Sprintf("sha256:%s", hex.EncodeToString(rootHash))
+	signingHash, err := mutableSigningHash(rootHash, sig.MutablePaths)
+	if err == nil {
+		signingHash, err = nestedSigningHash(signingHash, sig.NestedSkills)
+	}
+	if err != nil {
+		return &verification.VerificationResult{
+			Valid:        false,
+			Domain:       domain,
+			ErrorCode:    verification.ErrSignatureInvalid,
+			ErrorMessage: err.Error(),
+		}
+	}
+
+	// Step 6a: signer_kid binding. A fingerprint-form kid must name the
+	// discovered key; custom kids (SignOptions.SignerKid) are opaque labels
+	// and legacy signatures without a kid are not checked.
+	if signerKidMismatch(sig.SignerKid, fingerprint) {
+		return &verification.VerificationResult{
+			Valid:          false,
+			Domain:         domain,
+			ErrorCode:      verification.ErrSignerKidMismatch,
+			ErrorMessage:   fmt.Sprintf("Signed by kid %s but domain %s now publishes kid %s", sig.SignerKid, domain, fingerprint),
+			SignerKid:      sig.SignerKid,
+			KeyFingerprint: fingerprint,
+		}
+	}
+
+	sigManager := crypto.NewSignatureManager()
+	t = timer.Start()
+	valid := sigManager.VerifySignature(signingHash, sig.Signature, publicKey)
+	legacy := !valid && options.AllowLegacySignature && sigManager.VerifyLegacySignature(signingHash, sig.Signature, publicKey)
+	timer.Stop(verification.TimingSignatureVerify, t)
+
+	if !valid && !legacy {
+		return &verification.VerificationResult{
+			Valid:          false,
+			Domain:         domain,
+			ErrorCode:      verification.ErrSignatureInvalid,
+			ErrorMessage:   "Signature verification failed",
+			SignerKid:      sig.SignerKid,
+			KeyFingerprint: fingerprint,
+		}
+	}
+
+	// Step 6b: the signature covers the recorded nested skill hashes, so a
+	// nested skill changed since is reported by name rather than as a bad
+	// signature
+	if nested != nil {
+		if dir := changedNestedSkill(nested.skills, sig.NestedSkills); dir != "" {
+			return &verification.VerificationResult{
+				Valid:          false,
+				Domain:         domain,
+				ErrorCode:      verification.ErrSignatureInvalid,
+				ErrorMessage:   fmt.Sprintf("Nested skill %s changed since signing: hash %s, signed %s", dir, nested.skills[dir], sig.NestedSkills[dir]),
+				SignerKid:      sig.SignerKid,
+				KeyFingerprint: fingerprint,
+			}
 		}
 	}
 
 	// Step 7: Return success
-	result := &verification.VerificationResult{
-		Valid:         true,
-		Domain:        domain,
-		DeveloperName: disc.DeveloperName,
-		Warnings:      []string{},
+	result = &verification.VerificationResult{
+		Valid:          true,
+		Domain:         domain,
+		DeveloperName:  disc.DeveloperName,
+		Warnings:       []string{},
+		SignerKid:      sig.SignerKid,
+		KeyFingerprint: fingerprint,
+		MutableSkipped: mutableSkipped,
+	}
+	if legacy {
+		result.Warnings = append(result.Warnings, verification.WarningLegacySignature)
+	}
+
+	switch {
+	case !tracked:
+	case execBits == nil:
+		result.Warnings = append(result.Warnings, verification.WarningPermissionsUnchecked)
+	default:
+		executable, err := execBits(current)
+		if err != nil {
+			return &verification.VerificationResult{
+				Valid:        false,
+				Domain:       domain,
+				ErrorCode:    verification.ErrSchemaCanonicalizationFailed,
+				ErrorMessage: fmt.Sprintf("Failed to read file permissions: %v", err),
+			}
+		}
+		if changed := execBitChanges(current, sig.FileManifest, executable, sig.MutablePaths); len(changed) > 0 {
+			if options.StrictPermissions {
+				return &verification.VerificationResult{
+					Valid:             false,
+					Domain:            domain,
+					ErrorCode:         verification.ErrPermissionChanged,
+					ErrorMessage:      fmt.Sprintf("Executable bit changed since signing: %s", strings.Join(changed, ", ")),
+					SignerKid:         sig.SignerKid,
+					KeyFingerprint:    fingerprint,
+					PermissionChanged: changed,
+				}
+			}
+			result.PermissionChanged = changed
+			result.Warnings = append(result.Warnings, verification.WarningPermissionChanged)
+		}
+	}
+
+	// Provenance, when enabled and attached, must be signed by the skill's
+	// key or a provenance key and name the root hash
+	if options.Provenance != nil && sig.Provenance != nil {
+		summary, err := options.Provenance.Check(sig.Provenance, rootHash, publicKey)
+		if err != nil {
+			return &verification.VerificationResult{
+				Valid:          false,
+				Domain:         domain,
+				ErrorCode:      verification.ErrorCodeOf(err),
+				ErrorMessage:   err.Error(),
+				SignerKid:      sig.SignerKid,
+				KeyFingerprint: fingerprint,
+			}
+		}
+		result.Metadata = make(map[string]interface{})
+		summary.AddMetadata(result.Metadata)
 	}
 
 	if pinStore != nil {
 		result.KeyPinning = &verification.KeyPinningStatus{
 			Status: string(pinResult),
 		}
+		result.TrustDecision = pinResult.TrustDecision()
 	}
 
 	// v1.4: apply optional signature expiration check. No-op when ExpiresAt
 	// is empty; otherwise may set Expired/ExpiresAt and append a warning.
 	result = result.WithExpirationCheck(sig.ExpiresAt)
+	if result.Expired && eval.Check(verification.RuleExpiredSignatures, fmt.Sprintf("signature expired at %s", sig.ExpiresAt)) {
+		return eval.Failure(domain, "", "")
+	}
+	if eval.CheckSignedAt(sig.SignedAt, time.Now()) {
+		return eval.Failure(domain, "", "")
+	}
 	// v1.4 alpha.2: surface lineage metadata (informational; chain enforcement
 	// is opt-in via VerifyChain).
-	return result.WithLineageMetadata(sig.SchemaVersion, sig.PreviousHash)
+	return eval.Apply(result.WithLineageMetadata(sig.SchemaVersion, sig.PreviousHash))
+}
+
+// signerKidMismatch reports whether signerKid is a key fingerprint
+// ("sha256:<hex>", the default kid written by SignSkillWithOptions) that
+// differs from fingerprint.
+func signerKidMismatch(signerKid, fingerprint string) bool {
+	if !strings.HasPrefix(strings.ToLower(signerKid), "sha256:") {
+		return false
+	}
+	return !crypto.FingerprintEqual(signerKid, fingerprint)
 }
 
 // VerifySkillWithResolver verifies a signed skill folder using a resolver
@@ -520,49 +1054,62 @@ func VerifySkillWithResolver(
 	pinStore *verification.KeyPinStore,
 	toolID string,
 ) *verification.VerificationResult {
-	disc, err := r.ResolveDiscovery(domain)
+	return verifySkillWithResolver(skillDir, domain, nil, r, pinStore, toolID, VerifyOptions{})
+}
+
+func verifySkillWithResolver(
+	skillDir, domain string,
+	sig *SkillSignature,
+	r resolver.SchemaResolver,
+	pinStore *verification.KeyPinStore,
+	toolID string,
+	options VerifyOptions,
+) *verification.VerificationResult {
+	disc, source, err := resolver.ResolveDiscoveryWithSource(r, domain)
 	if err != nil {
 		return &verification.VerificationResult{
 			Valid:        false,
 			Domain:       domain,
-			ErrorCode:    verification.ErrDiscoveryFetchFailed,
-			ErrorMessage: fmt.Sprintf("Could not resolve discovery for domain: %s", domain),
+			ErrorCode:    verification.DiscoveryErrorCode(err),
+			ErrorMessage: fmt.Sprintf("Could not resolve discovery for domain: %s: %v", domain, err),
 		}
 	}
 
 	rev, _ := r.ResolveRevocation(domain, disc)
 
-	return VerifySkillOffline(skillDir, disc, nil, rev, pinStore, toolID)
+	result := VerifySkillOfflineWithOptions(skillDir, disc, sig, rev, pinStore, toolID, options)
+	result.DiscoverySource = source
+	result.DiscoveryURL = disc.SourceURL
+	return result
 }
 
 // DetectTamperedFiles compares a current file manifest against a signed manifest.
-// Returns a TamperedFiles struct with sorted Modified, Added, and Removed slices.
+// Returns a TamperedFiles struct with sorted Modified, Added, Removed and
+// PermissionChanged slices; permission changes are only found when both
+// manifests record executable bits. For huge manifests, WalkTamperedFiles
+// visits the changes without collecting them.
 func DetectTamperedFiles(current, signed map[string]string) *TamperedFiles {
 	result := &TamperedFiles{
-		Modified: []string{},
-		Added:    []string{},
-		Removed:  []string{},
-	}
-
-	// Find added and modified
-	for k, v := range current {
-		if sv, ok := signed[k]; !ok {
-			result.Added = append(result.Added, k)
-		} else if v != sv {
-			result.Modified = append(result.Modified, k)
-		}
+		Modified:          []string{},
+		Added:             []string{},
+		Removed:           []string{},
+		PermissionChanged: []string{},
 	}
 
-	// Find removed
-	for k := range signed {
-		if _, ok := current[k]; !ok {
-			result.Removed = append(result.Removed, k)
+	// WalkTamperedFiles visits paths in order, so the slices come out sorted
+	_ = WalkTamperedFiles(current, signed, func(path string, change FileChange) error {
+		switch change {
+		case FileModified:
+			result.Modified = append(result.Modified, path)
+		case FileAdded:
+			result.Added = append(result.Added, path)
+		case FileRemoved:
+			result.Removed = append(result.Removed, path)
+		case FilePermissionChanged:
+			result.PermissionChanged = append(result.PermissionChanged, path)
 		}
-	}
-
-	sort.Strings(result.Modified)
-	sort.Strings(result.Added)
-	sort.Strings(result.Removed)
+		return nil
+	})
 
 	return result
 }
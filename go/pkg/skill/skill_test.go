@@ -1,24 +1,57 @@
 package skill
 
 import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/ThirdKeyAi/schemapin/go/pkg/bundle"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/provenance"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/resolver"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
 )
 
 // --- Test helpers ---
 
+// keysIssued counts the keys makeKeypair has handed to each running test,
+// so that every test gets distinct keys that are identical from run to run.
+var (
+	keysIssuedMu sync.Mutex
+	keysIssued   = map[string]int{}
+)
+
+// makeKeypair returns a seeded (deterministic, test-only) key pair. Repeated
+// calls within a test return different keys.
 func makeKeypair(t *testing.T) (string, string) {
 	t.Helper()
+	keysIssuedMu.Lock()
+	if keysIssued[t.Name()] == 0 {
+		name := t.Name()
+		t.Cleanup(func() {
+			keysIssuedMu.Lock()
+			delete(keysIssued, name)
+			keysIssuedMu.Unlock()
+		})
+	}
+	keysIssued[t.Name()]++
+	seed := fmt.Sprintf("skill-test/%s/%d", t.Name(), keysIssued[t.Name()])
+	keysIssuedMu.Unlock()
+
 	km := crypto.NewKeyManager()
-	priv, err := km.GenerateKeypair()
+	priv, err := km.GenerateKeypairFromSeed([]byte(seed), crypto.ForTesting)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -349,8 +382,11 @@ func TestSignCreatesFile(t *testing.T) {
 	if sig.Domain != "example.com" {
 		t.Errorf("expected domain 'example.com', got %q", sig.Domain)
 	}
-	if sig.SchemapinVersion != "1.3" {
-		t.Errorf("expected version '1.3', got %q", sig.SchemapinVersion)
+	if sig.SchemapinVersion != "1.4" {
+		t.Errorf("expected version '1.4', got %q", sig.SchemapinVersion)
+	}
+	if sig.Canonicalization != core.CanonicalizationV1 {
+		t.Errorf("expected canonicalization %q, got %q", core.CanonicalizationV1, sig.Canonicalization)
 	}
 
 	// Check file was written
@@ -380,6 +416,42 @@ func TestSignRoundtrip(t *testing.T) {
 	}
 }
 
+func TestSignExpectedHash(t *testing.T) {
+	privPEM, _ := makeKeypair(t)
+	dir := createSkillDir(t, map[string]string{
+		"main.py": "print('hello')",
+	})
+	rootHash, _, err := CanonicalizeSkill(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	built := "sha256:" + hex.EncodeToString(rootHash)
+
+	sig, err := SignSkillWithOptions(dir, privPEM, "example.com", SignOptions{ExpectedHash: built})
+	if err != nil {
+		t.Fatalf("expected signing with the built hash to succeed, got %v", err)
+	}
+	if sig.SkillHash != built {
+		t.Errorf("expected skill hash %s, got %s", built, sig.SkillHash)
+	}
+
+	// Content changed between the build and the release
+	if err := os.Remove(filepath.Join(dir, SignatureFilename)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "main.py"), []byte("print('pwned')"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = SignSkillWithOptions(dir, privPEM, "example.com", SignOptions{ExpectedHash: built})
+	var mismatch *core.HashMismatchError
+	if !errors.As(err, &mismatch) || mismatch.Expected != built {
+		t.Fatalf("expected HashMismatchError, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, SignatureFilename)); !os.IsNotExist(err) {
+		t.Error("expected no signature to be written on a mismatch")
+	}
+}
+
 // --- Verification failure tests ---
 
 func TestWrongKeyFails(t *testing.T) {
@@ -401,8 +473,72 @@ func TestWrongKeyFails(t *testing.T) {
 	if result.Valid {
 		t.Error("expected verification to fail with wrong key")
 	}
-	if result.ErrorCode != verification.ErrSignatureInvalid {
-		t.Errorf("expected error code %s, got %s", verification.ErrSignatureInvalid, result.ErrorCode)
+	// The default kid names the signing key, so the wrong key is reported
+	// as a kid mismatch rather than a bare signature failure.
+	if result.ErrorCode != verification.ErrSignerKidMismatch {
+		t.Errorf("expected error code %s, got %s", verification.ErrSignerKidMismatch, result.ErrorCode)
+	}
+}
+
+func TestSignerKidBinding(t *testing.T) {
+	privPEM, pubPEM := makeKeypair(t)
+	_, rotatedPubPEM := makeKeypair(t)
+	km := crypto.NewKeyManager()
+	signingFP, err := km.CalculateKeyFingerprintFromPEM(pubPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotatedFP, err := km.CalculateKeyFingerprintFromPEM(rotatedPubPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		kid       string
+		legacy    bool // strip the kid, as in signatures predating it
+		discPEM   string
+		wantCode  verification.ErrorCode
+		wantValid bool
+	}{
+		{"matching kid", "", false, pubPEM, "", true},
+		{"matching kid uppercase prefix", "SHA256:" + strings.TrimPrefix(signingFP, "sha256:"), false, pubPEM, "", true},
+		{"mismatched kid", "", false, rotatedPubPEM, verification.ErrSignerKidMismatch, false},
+		{"custom kid", "acme-2026-01", false, pubPEM, "", true},
+		{"empty kid", "", true, pubPEM, "", true},
+		{"empty kid with rotated key", "", true, rotatedPubPEM, verification.ErrSignatureInvalid, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := createSkillDir(t, map[string]string{"main.py": "code"})
+			sig, err := SignSkillWithOptions(dir, privPEM, "example.com", SignOptions{SignerKid: tt.kid})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.legacy {
+				sig.SignerKid = ""
+			}
+
+			result := VerifySkillOffline(dir, makeDiscovery(tt.discPEM), sig, nil, nil, "")
+			if result.Valid != tt.wantValid || result.ErrorCode != tt.wantCode {
+				t.Fatalf("expected valid=%v code=%q, got valid=%v code=%q (%s)",
+					tt.wantValid, tt.wantCode, result.Valid, result.ErrorCode, result.ErrorMessage)
+			}
+			if result.SignerKid != sig.SignerKid {
+				t.Errorf("expected SignerKid %q, got %q", sig.SignerKid, result.SignerKid)
+			}
+			wantFP := signingFP
+			if tt.discPEM == rotatedPubPEM {
+				wantFP = rotatedFP
+			}
+			if result.KeyFingerprint != wantFP {
+				t.Errorf("expected KeyFingerprint %s, got %s", wantFP, result.KeyFingerprint)
+			}
+			if tt.wantCode == verification.ErrSignerKidMismatch &&
+				(!strings.Contains(result.ErrorMessage, signingFP) || !strings.Contains(result.ErrorMessage, rotatedFP)) {
+				t.Errorf("expected both fingerprints in message, got %q", result.ErrorMessage)
+			}
+		})
 	}
 }
 
@@ -433,6 +569,121 @@ func TestTamperedFileFails(t *testing.T) {
 	}
 }
 
+func TestVerifyReportsSkillHashes(t *testing.T) {
+	privPEM, pubPEM := makeKeypair(t)
+	dir := createSkillDir(t, map[string]string{
+		"main.py": "original content",
+	})
+
+	sig, err := SignSkill(dir, privPEM, "example.com", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	disc := makeDiscovery(pubPEM)
+
+	result := VerifySkillOffline(dir, disc, sig, nil, nil, "")
+	if !result.Valid {
+		t.Fatalf("expected valid, got %s", result.ErrorMessage)
+	}
+	if result.SkillHash != sig.SkillHash || result.SignedSkillHash != sig.SkillHash {
+		t.Errorf("expected both hashes to be %s, got %s and %s", sig.SkillHash, result.SkillHash, result.SignedSkillHash)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "main.py"), []byte("tampered content"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	result = VerifySkillOffline(dir, disc, sig, nil, nil, "")
+	if result.Valid {
+		t.Fatal("expected verification to fail after tampering")
+	}
+	if result.SignedSkillHash != sig.SkillHash {
+		t.Errorf("expected signed hash %s, got %s", sig.SkillHash, result.SignedSkillHash)
+	}
+	if result.SkillHash == "" || result.SkillHash == sig.SkillHash {
+		t.Errorf("expected a computed hash differing from the signed one, got %s", result.SkillHash)
+	}
+}
+
+func TestVerifySkillProvenance(t *testing.T) {
+	privPEM, pubPEM := makeKeypair(t)
+	dir := createSkillDir(t, map[string]string{
+		"main.py": "built content",
+	})
+	rootHash, _, err := CanonicalizeSkill(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	privateKey, err := crypto.NewKeyManager().LoadPrivateKeyPEM(privPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attest := func(digest []byte) *provenance.Envelope {
+		env, err := provenance.Sign(&provenance.Statement{
+			Type:          provenance.StatementTypeV1,
+			Subject:       []provenance.Subject{{Digest: map[string]string{"sha256": hex.EncodeToString(digest)}}},
+			PredicateType: provenance.PredicateSLSAV1,
+			Predicate:     []byte(`{"runDetails": {"builder": {"id": "https://ci.example.com/builder"}}}`),
+		}, privateKey, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return env
+	}
+	wrongSubject := attest(make([]byte, 32))
+
+	if _, err := SignSkillWithOptions(dir, privPEM, "example.com", SignOptions{Provenance: wrongSubject}); !errors.Is(err, schemaerr.ErrProvenanceSubjectMismatch) {
+		t.Fatalf("expected signing to refuse provenance for another artifact, got %v", err)
+	}
+	sig, err := SignSkillWithOptions(dir, privPEM, "example.com", SignOptions{Provenance: attest(rootHash)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadSignature(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Provenance == nil {
+		t.Fatal("expected the provenance to be written to the signature file")
+	}
+	disc := makeDiscovery(pubPEM)
+	enabled := VerifyOptions{Provenance: &provenance.Config{}}
+
+	result := VerifySkillOfflineWithOptions(dir, disc, nil, nil, nil, "", enabled)
+	if !result.Valid {
+		t.Fatalf("expected valid, got %s", result.ErrorMessage)
+	}
+	if result.Metadata[provenance.MetadataBuilderID] != "https://ci.example.com/builder" {
+		t.Errorf("expected the builder in metadata, got %v", result.Metadata)
+	}
+
+	// Provenance is not covered by the skill signature, so it can be
+	// swapped without invalidating it
+	sig.Provenance = wrongSubject
+	result = VerifySkillOfflineWithOptions(dir, disc, sig, nil, nil, "", enabled)
+	if result.Valid || result.ErrorCode != verification.ErrProvenanceSubjectMismatch {
+		t.Errorf("expected %s, got %+v", verification.ErrProvenanceSubjectMismatch, result)
+	}
+	result = VerifySkillOfflineWithOptions(dir, disc, sig, nil, nil, "", VerifyOptions{})
+	if !result.Valid || result.Metadata != nil {
+		t.Errorf("expected provenance to be ignored when disabled, got %+v", result)
+	}
+
+	other, _ := makeKeypair(t)
+	otherKey, err := crypto.NewKeyManager().LoadPrivateKeyPEM(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig.Provenance = attest(rootHash)
+	sig.Provenance.Signatures[0].Sig, err = crypto.NewSignatureManager().SignHash([]byte("other"), otherKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result = VerifySkillOfflineWithOptions(dir, disc, sig, nil, nil, "", enabled)
+	if result.Valid || result.ErrorCode != verification.ErrProvenanceInvalid {
+		t.Errorf("expected %s, got %+v", verification.ErrProvenanceInvalid, result)
+	}
+}
+
 func TestAddedFileFails(t *testing.T) {
 	privPEM, pubPEM := makeKeypair(t)
 	dir := createSkillDir(t, map[string]string{
@@ -633,6 +884,83 @@ func TestVerifyOfflineMissingSig(t *testing.T) {
 	}
 }
 
+func TestVerifyOfflineUnsupportedVersion(t *testing.T) {
+	privPEM, pubPEM := makeKeypair(t)
+	dir := createSkillDir(t, map[string]string{
+		"main.py": "code",
+	})
+
+	sig, err := SignSkill(dir, privPEM, "example.com", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A signature from a future signer must not be reported as a bad signature
+	sig.SchemapinVersion = "2.0"
+	result := VerifySkillOffline(dir, makeDiscovery(pubPEM), sig, nil, nil, "")
+
+	if result.Valid {
+		t.Error("expected verification to fail for unknown schemapin_version")
+	}
+	if result.ErrorCode != verification.ErrUnsupportedVersion {
+		t.Errorf("expected error code %s, got %s", verification.ErrUnsupportedVersion, result.ErrorCode)
+	}
+	if !strings.Contains(result.ErrorMessage, `"2.0"`) {
+		t.Errorf("expected error message to include the seen version, got %q", result.ErrorMessage)
+	}
+
+	// Signatures without a version verify under the legacy rules
+	sig.SchemapinVersion = ""
+	if result := VerifySkillOffline(dir, makeDiscovery(pubPEM), sig, nil, nil, ""); !result.Valid {
+		t.Errorf("expected legacy signature to verify, got %s", result.ErrorMessage)
+	}
+}
+
+func TestVerifyOfflineCanonicalization(t *testing.T) {
+	privPEM, pubPEM := makeKeypair(t)
+	dir := createSkillDir(t, map[string]string{
+		"SKILL.md": "---\nname: canon\n---\n",
+		"main.py":  "code",
+	})
+
+	sig, err := SignSkill(dir, privPEM, "example.com", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := os.ReadFile(filepath.Join(dir, SignatureFilename))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(raw), `"canonicalization": "schemapin-v1"`) {
+		t.Errorf("expected the written signature to name its canonicalization, got: %s", raw)
+	}
+	if result := VerifySkillOffline(dir, makeDiscovery(pubPEM), sig, nil, nil, ""); !result.Valid {
+		t.Errorf("expected current signature to verify, got %s", result.ErrorMessage)
+	}
+
+	// Legacy signatures without the field use schemapin-v1
+	legacy := *sig
+	legacy.SchemapinVersion = "1.3"
+	legacy.Canonicalization = ""
+	if result := VerifySkillOffline(dir, makeDiscovery(pubPEM), &legacy, nil, nil, ""); !result.Valid {
+		t.Errorf("expected legacy signature to verify, got %s", result.ErrorMessage)
+	}
+
+	unknown := *sig
+	unknown.Canonicalization = "schemapin-v2-jcs"
+	result := VerifySkillOffline(dir, makeDiscovery(pubPEM), &unknown, nil, nil, "")
+	if result.Valid {
+		t.Error("expected verification to fail for an unknown canonicalization")
+	}
+	if result.ErrorCode != verification.ErrCanonicalizationUnsupported {
+		t.Errorf("expected error code %s, got %s", verification.ErrCanonicalizationUnsupported, result.ErrorCode)
+	}
+
+	if _, err := SignSkillWithOptions(dir, privPEM, "example.com", SignOptions{Canonicalization: "schemapin-v2-jcs"}); err == nil {
+		t.Error("expected signing with an unknown canonicalization to fail")
+	}
+}
+
 // --- DetectTamperedFiles test ---
 
 func TestDetectTamperedFiles(t *testing.T) {
@@ -714,3 +1042,42 @@ func buildTrustBundleJSON(t *testing.T, pubPEM, domain string) string {
 	}
 	return string(data)
 }
+
+// TestVerifyLegacySignatureOptIn checks that a signature over the raw root
+// hash, as written by Go releases before v1.4, verifies only when
+// AllowLegacySignature is set, and then with a warning.
+func TestVerifyLegacySignatureOptIn(t *testing.T) {
+	privPEM, pubPEM := makeKeypair(t)
+	dir := createSkillDir(t, map[string]string{"SKILL.md": "---\nname: legacy\n---\n"})
+	sig, err := SignSkill(dir, privPEM, "example.com", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	privateKey, err := crypto.NewKeyManager().LoadPrivateKeyPEM(privPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootHash, err := hex.DecodeString(strings.TrimPrefix(sig.SkillHash, "sha256:"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := ecdsa.SignASN1(rand.Reader, privateKey, rootHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig.Signature = base64.StdEncoding.EncodeToString(legacy)
+
+	result := VerifySkillOfflineWithOptions(dir, makeDiscovery(pubPEM), sig, nil, nil, "", VerifyOptions{})
+	if result.Valid || result.ErrorCode != verification.ErrSignatureInvalid {
+		t.Errorf("expected a legacy signature to be rejected by default, got valid=%v code=%q", result.Valid, result.ErrorCode)
+	}
+
+	result = VerifySkillOfflineWithOptions(dir, makeDiscovery(pubPEM), sig, nil, nil, "", VerifyOptions{AllowLegacySignature: true})
+	if !result.Valid {
+		t.Fatalf("expected a legacy signature to verify when allowed, got %s: %s", result.ErrorCode, result.ErrorMessage)
+	}
+	if !containsString(result.Warnings, verification.WarningLegacySignature) {
+		t.Errorf("expected %q warning, got %v", verification.WarningLegacySignature, result.Warnings)
+	}
+}
@@ -0,0 +1,37 @@
+#!/usr/bin/env node
+/**
+ * Regenerate the JavaScript-signed cross-language skill fixture.
+ *
+ * Copies `source/` to `js/skill/`, signs it with a fresh key using the
+ * JavaScript SDK, declaring the canonicalization explicitly (v1.4), and
+ * writes the matching `well_known.json`.
+ *
+ * Run from anywhere with Node 18 or later:
+ *
+ *     node generate.mjs
+ */
+
+import { cpSync, mkdirSync, rmSync, writeFileSync } from 'node:fs';
+import { dirname, join } from 'node:path';
+import { fileURLToPath } from 'node:url';
+
+const here = dirname(fileURLToPath(import.meta.url));
+const sdk = join(here, '..', '..', '..', '..', '..', 'javascript', 'src');
+
+const { KeyManager } = await import(join(sdk, 'crypto.js'));
+const { signSkillWithOptions } = await import(join(sdk, 'skill.js'));
+const { createWellKnownResponse } = await import(join(sdk, 'utils.js'));
+
+const out = join(here, 'js');
+rmSync(out, { recursive: true, force: true });
+mkdirSync(out);
+const skillDir = join(out, 'skill');
+cpSync(join(here, 'source'), skillDir, { recursive: true, verbatimSymlinks: true });
+
+const { privateKey, publicKey } = KeyManager.generateKeypair();
+signSkillWithOptions(skillDir, privateKey, 'js.crosslang.example', {
+    canonicalization: 'schemapin-v1'
+});
+
+const wellKnown = createWellKnownResponse(publicKey, 'SchemaPin JavaScript SDK', null, null, '1.3');
+writeFileSync(join(out, 'well_known.json'), JSON.stringify(wellKnown, null, 2) + '\n');
@@ -0,0 +1,49 @@
+#!/usr/bin/env python3
+"""Regenerate the Python-signed cross-language skill fixture.
+
+Copies ``source/`` to ``python/skill/``, signs it with a fresh key using the
+Python SDK's v1.3 entry point and writes the matching ``well_known.json``.
+
+Run from anywhere; the SDK is imported from the repository's ``python/``
+directory and needs the ``cryptography`` package:
+
+    python3 generate.py
+"""
+
+import json
+import shutil
+import sys
+from pathlib import Path
+
+HERE = Path(__file__).resolve().parent
+sys.path.insert(0, str(HERE.parents[4] / "python"))
+
+from schemapin.crypto import KeyManager  # noqa: E402
+from schemapin.skill import SkillSigner  # noqa: E402
+from schemapin.utils import create_well_known_response  # noqa: E402
+
+
+def main() -> None:
+    out = HERE / "python"
+    if out.exists():
+        shutil.rmtree(out)
+    skill_dir = out / "skill"
+    shutil.copytree(HERE / "source", skill_dir, symlinks=True)
+
+    private_key, public_key = KeyManager.generate_keypair()
+    SkillSigner.sign_skill(
+        skill_dir,
+        KeyManager.export_private_key_pem(private_key),
+        "python.crosslang.example",
+    )
+
+    well_known = create_well_known_response(
+        KeyManager.export_public_key_pem(public_key),
+        "SchemaPin Python SDK",
+        schema_version="1.3",
+    )
+    (out / "well_known.json").write_text(json.dumps(well_known, indent=2) + "\n")
+
+
+if __name__ == "__main__":
+    main()
@@ -0,0 +1,739 @@
+package truststate
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/pinning"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/revocation"
+)
+
+// Mode selects how Restore combines an archive with the existing trust
+// state.
+type Mode string
+
+const (
+	// ModeMerge adds what the existing state lacks. Pins, domain policies
+	// and pin store entries that differ from the archive are kept and
+	// reported as conflicts, and cached documents already held are kept.
+	ModeMerge Mode = "merge"
+	// ModeReplace makes the pins, namespace pins, domain policies,
+	// rejections and restored pin stores those of the archive: entries
+	// that differ are replaced and entries the archive lacks are removed.
+	// Cached documents are overwritten but not removed.
+	ModeReplace Mode = "replace"
+)
+
+// DefaultMaxArchiveBytes is the limit on the uncompressed size of an
+// archive used when RestoreOptions.MaxArchiveBytes is zero.
+const DefaultMaxArchiveBytes = 256 << 20
+
+// maxArchiveEntries bounds the number of files in an archive.
+const maxArchiveEntries = 4096
+
+var (
+	// ErrInvalidArchive is returned for an archive that cannot be read or
+	// whose manifest is malformed.
+	ErrInvalidArchive = errors.New("invalid trust-state archive")
+	// ErrUnsupportedVersion is returned for an archive or component
+	// written in a newer format than this version reads.
+	ErrUnsupportedVersion = errors.New("unsupported format version")
+	// ErrMissingComponent is returned for a component listed in the
+	// manifest but absent from the archive, or a database component the
+	// manifest does not list.
+	ErrMissingComponent = errors.New("component missing")
+	// ErrHashMismatch is returned for a component whose contents do not
+	// match the hash in the manifest.
+	ErrHashMismatch = errors.New("component hash mismatch")
+	// ErrInvalidComponent is returned for a component whose contents do
+	// not decode or contradict the manifest.
+	ErrInvalidComponent = errors.New("invalid component")
+)
+
+// ComponentError reports the component of an archive that was rejected or
+// failed to apply.
+type ComponentError struct {
+	Path string
+	Err  error
+}
+
+func (e *ComponentError) Error() string {
+	return fmt.Sprintf("trust-state component %s: %v", e.Path, e.Err)
+}
+
+func (e *ComponentError) Unwrap() error {
+	return e.Err
+}
+
+// RestoreOptions configures Restore.
+type RestoreOptions struct {
+	// Mode defaults to ModeMerge.
+	Mode Mode
+	// DryRun validates the archive and reports what would be restored
+	// without writing anything.
+	DryRun bool
+	// Source is recorded as the source detail of every restored pin,
+	// typically the path of the archive.
+	Source string
+	// PinStoreFiles are the files the archive's pin stores are restored
+	// to, matched by base name. Pin stores of the archive without a file
+	// are reported and left out.
+	PinStoreFiles []string
+	// Limits bounds the pins and rejections components as
+	// pinning.ImportOptions.Limits does export files.
+	Limits pinning.ImportLimits
+	// MaxArchiveBytes bounds the uncompressed size of the archive.
+	MaxArchiveBytes int64
+}
+
+// ComponentReport is the outcome of restoring one component.
+type ComponentReport struct {
+	Path string    `json:"path"`
+	Kind Component `json:"kind"`
+	// Imported counts entries added or replaced, Skipped entries already
+	// present and Removed, in ModeReplace, entries the archive lacks.
+	Imported int `json:"imported"`
+	Skipped  int `json:"skipped"`
+	Removed  int `json:"removed,omitempty"`
+	// Conflicts describes entries kept in ModeMerge that differ from the
+	// archive.
+	Conflicts []string `json:"conflicts,omitempty"`
+	// Errors describes entries rejected by the import APIs.
+	Errors []string `json:"errors,omitempty"`
+	// Note explains a component that was left out.
+	Note string `json:"note,omitempty"`
+}
+
+// RestoreReport is the outcome of Restore, with one report per component
+// in manifest order.
+type RestoreReport struct {
+	Mode       Mode              `json:"mode"`
+	DryRun     bool              `json:"dry_run,omitempty"`
+	Manifest   Manifest          `json:"manifest"`
+	Components []ComponentReport `json:"components"`
+}
+
+// HasErrors reports whether any entry was rejected.
+func (r *RestoreReport) HasErrors() bool {
+	for _, c := range r.Components {
+		if len(c.Errors) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Restore applies the archive read from r to k and to the pin store files
+// named in opts. The whole archive is checked first: its manifest format
+// and version, the presence, format version, size and hash of every
+// component, and that every component decodes. A problem with a component
+// is returned as a *ComponentError, and nothing is changed.
+//
+// Components are then applied one after another through the pinning
+// import APIs, in manifest order. Restored pins are recorded as
+// pinning.ProvenanceImport with opts.Source as their source detail, and
+// discovery versions are only ever raised. If applying a component fails,
+// the report covers the components applied before it.
+func Restore(k *pinning.KeyPinning, r io.Reader, opts RestoreOptions) (*RestoreReport, error) {
+	mode := opts.Mode
+	switch mode {
+	case "":
+		mode = ModeMerge
+	case ModeMerge, ModeReplace:
+	default:
+		return nil, fmt.Errorf("unknown restore mode %q", mode)
+	}
+	maxBytes := opts.MaxArchiveBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxArchiveBytes
+	}
+
+	manifest, files, err := readArchive(r, maxBytes)
+	if err != nil {
+		return nil, err
+	}
+	rs := &restorer{k: k, opts: opts, mode: mode, pinStores: make(map[string]string)}
+	if err := rs.matchPinStores(manifest); err != nil {
+		return nil, err
+	}
+
+	steps := make([]restoreStep, len(manifest.Components))
+	for i, info := range manifest.Components {
+		step, err := rs.prepare(info, files[info.Path])
+		if err != nil {
+			return nil, &ComponentError{Path: info.Path, Err: err}
+		}
+		steps[i] = step
+	}
+
+	report := &RestoreReport{Mode: mode, DryRun: opts.DryRun, Manifest: *manifest}
+	for i, info := range manifest.Components {
+		c := ComponentReport{Path: info.Path, Kind: info.Kind}
+		err := steps[i](&c)
+		report.Components = append(report.Components, c)
+		if err != nil {
+			return report, &ComponentError{Path: info.Path, Err: err}
+		}
+	}
+	return report, nil
+}
+
+// readArchive reads the files of an archive and checks them against its
+// manifest.
+func readArchive(r io.Reader, maxBytes int64) (*Manifest, map[string][]byte, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+	}
+	tr := tar.NewReader(gz)
+	files := make(map[string][]byte)
+	var total int64
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			return nil, nil, fmt.Errorf("%w: entry %q is not a regular file", ErrInvalidArchive, hdr.Name)
+		}
+		if _, ok := files[hdr.Name]; ok {
+			return nil, nil, fmt.Errorf("%w: duplicate entry %q", ErrInvalidArchive, hdr.Name)
+		}
+		if len(files) >= maxArchiveEntries {
+			return nil, nil, fmt.Errorf("%w: more than %d entries", ErrInvalidArchive, maxArchiveEntries)
+		}
+		total += hdr.Size
+		if hdr.Size < 0 || total > maxBytes {
+			return nil, nil, fmt.Errorf("%w: exceeds the limit of %d bytes", ErrInvalidArchive, maxBytes)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: failed to read %s: %v", ErrInvalidArchive, hdr.Name, err)
+		}
+		files[hdr.Name] = data
+	}
+
+	data, ok := files[ManifestPath]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: no %s", ErrInvalidArchive, ManifestPath)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, nil, fmt.Errorf("%w: malformed %s: %v", ErrInvalidArchive, ManifestPath, err)
+	}
+	if err := checkManifest(&manifest, files); err != nil {
+		return nil, nil, err
+	}
+	return &manifest, files, nil
+}
+
+// checkManifest checks manifest and every component it lists against the
+// files of the archive.
+func checkManifest(manifest *Manifest, files map[string][]byte) error {
+	if manifest.Format != Format {
+		return fmt.Errorf("%w: format %q, expected %q", ErrInvalidArchive, manifest.Format, Format)
+	}
+	if manifest.FormatVersion < 1 || manifest.FormatVersion > FormatVersion {
+		return fmt.Errorf("%w: archive format version %d, this version reads up to %d", ErrUnsupportedVersion, manifest.FormatVersion, FormatVersion)
+	}
+
+	listed := map[string]bool{ManifestPath: true}
+	for _, info := range manifest.Components {
+		if err := checkComponent(info, files, listed); err != nil {
+			return &ComponentError{Path: info.Path, Err: err}
+		}
+		listed[info.Path] = true
+	}
+	for _, kind := range databaseComponents {
+		if path := componentPath(kind); !listed[path] {
+			return &ComponentError{Path: path, Err: fmt.Errorf("%w: not listed in the manifest", ErrMissingComponent)}
+		}
+	}
+
+	var unlisted []string
+	for name := range files {
+		if !listed[name] {
+			unlisted = append(unlisted, name)
+		}
+	}
+	if len(unlisted) > 0 {
+		sort.Strings(unlisted)
+		return fmt.Errorf("%w: entry %q is not listed in the manifest", ErrInvalidArchive, unlisted[0])
+	}
+	return nil
+}
+
+// checkComponent checks the manifest entry of a component and the hash of
+// its contents. listed holds the paths of the components checked before.
+func checkComponent(info ComponentInfo, files map[string][]byte, listed map[string]bool) error {
+	supported, ok := componentFormatVersions[info.Kind]
+	if !ok {
+		return fmt.Errorf("%w: unknown component kind %q", ErrUnsupportedVersion, info.Kind)
+	}
+	if info.FormatVersion < 1 || info.FormatVersion > supported {
+		return fmt.Errorf("%w: %s format version %d, this version reads up to %d", ErrUnsupportedVersion, info.Kind, info.FormatVersion, supported)
+	}
+	if info.Kind == ComponentPinStore {
+		name, ok := strings.CutPrefix(info.Path, pinStoreDir)
+		if !ok {
+			return fmt.Errorf("%w: pin stores belong under %s", ErrInvalidArchive, pinStoreDir)
+		}
+		if err := validatePinStoreName(name); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidArchive, err)
+		}
+	} else if info.Path != componentPath(info.Kind) {
+		return fmt.Errorf("%w: %s belongs in %s", ErrInvalidArchive, info.Kind, componentPath(info.Kind))
+	}
+	if listed[info.Path] {
+		return fmt.Errorf("%w: listed twice in the manifest", ErrInvalidArchive)
+	}
+
+	data, ok := files[info.Path]
+	if !ok {
+		return fmt.Errorf("%w: listed in the manifest but not in the archive", ErrMissingComponent)
+	}
+	if got := hashOf(data); got != info.SHA256 {
+		return fmt.Errorf("%w: manifest has %s, contents hash to %s", ErrHashMismatch, info.SHA256, got)
+	}
+	if int64(len(data)) != info.Size {
+		return fmt.Errorf("%w: manifest has %d bytes, contents have %d", ErrInvalidComponent, info.Size, len(data))
+	}
+	return nil
+}
+
+// restoreStep applies a checked component, filling in its report.
+type restoreStep func(c *ComponentReport) error
+
+// restorer holds the state of a Restore.
+type restorer struct {
+	k    *pinning.KeyPinning
+	opts RestoreOptions
+	mode Mode
+	// pinStores maps the name of each pin store to the file it is
+	// restored to.
+	pinStores map[string]string
+}
+
+// matchPinStores matches the pin store files of opts to the pin stores of
+// manifest by base name.
+func (rs *restorer) matchPinStores(manifest *Manifest) error {
+	archived := make(map[string]bool)
+	for _, info := range manifest.Components {
+		if info.Kind == ComponentPinStore {
+			archived[strings.TrimPrefix(info.Path, pinStoreDir)] = true
+		}
+	}
+	for _, path := range rs.opts.PinStoreFiles {
+		name := filepath.Base(path)
+		if other, ok := rs.pinStores[name]; ok {
+			return fmt.Errorf("pin stores %s and %s have the same file name", other, path)
+		}
+		if !archived[name] {
+			return fmt.Errorf("pin store %s is not in the archive", path)
+		}
+		rs.pinStores[name] = path
+	}
+	return nil
+}
+
+// prepare decodes a component and returns the step applying it.
+func (rs *restorer) prepare(info ComponentInfo, data []byte) (restoreStep, error) {
+	switch info.Kind {
+	case ComponentPins, ComponentNamespacePins:
+		return rs.preparePins(info, data)
+	case ComponentDomainPolicies:
+		return rs.preparePolicies(info, data)
+	case ComponentRejections:
+		return rs.prepareRejections(info, data)
+	case ComponentDiscoveryVersions:
+		return rs.prepareDiscoveryVersions(info, data)
+	case ComponentDiscoveryCache:
+		return rs.prepareDiscoveryCache(info, data)
+	case ComponentRevocationCache:
+		return rs.prepareRevocationCache(info, data)
+	default:
+		return rs.preparePinStore(info, data)
+	}
+}
+
+// decodeComponent decodes data into v and checks that it holds the number
+// of entries listed in the manifest.
+func decodeComponent[T any](info ComponentInfo, data []byte, v *[]T) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidComponent, err)
+	}
+	return checkEntries(info, len(*v))
+}
+
+func checkEntries(info ComponentInfo, entries int) error {
+	if entries != info.Entries {
+		return fmt.Errorf("%w: manifest has %d entries, contents have %d", ErrInvalidComponent, info.Entries, entries)
+	}
+	return nil
+}
+
+func (rs *restorer) preparePins(info ComponentInfo, data []byte) (restoreStep, error) {
+	var entries []struct {
+		ToolID    string `json:"tool_id"`
+		Namespace bool   `json:"namespace"`
+	}
+	if err := decodeComponent(info, data, &entries); err != nil {
+		return nil, err
+	}
+	namespace := info.Kind == ComponentNamespacePins
+	tools := make(map[string]bool, len(entries))
+	var overwrite []string
+	for i, entry := range entries {
+		if entry.Namespace != namespace {
+			return nil, fmt.Errorf("%w: entry %d (%s) does not belong in %s", ErrInvalidComponent, i, entry.ToolID, info.Kind)
+		}
+		tools[entry.ToolID] = true
+		overwrite = append(overwrite, entry.ToolID)
+	}
+
+	return func(c *ComponentReport) error {
+		importOpts := pinning.ImportOptions{Limits: rs.opts.Limits, Source: rs.opts.Source, DryRun: rs.opts.DryRun}
+		if rs.mode == ModeReplace {
+			existing, err := rs.k.ListPinnedKeyInfo()
+			if err != nil {
+				return err
+			}
+			for _, pin := range existing {
+				if pin.Namespace != namespace || tools[pin.ToolID] {
+					continue
+				}
+				if !rs.opts.DryRun {
+					if err := rs.k.RemovePinnedKey(pin.ToolID); err != nil {
+						return err
+					}
+				}
+				c.Removed++
+			}
+			importOpts.Overwrite = overwrite
+		}
+		result, err := rs.k.ImportPinnedKeys(string(data), importOpts)
+		if err != nil {
+			return err
+		}
+		c.addImportReport(result)
+		for _, conflict := range result.Conflicts {
+			if !conflict.Overwritten {
+				c.Conflicts = append(c.Conflicts, fmt.Sprintf("%s is pinned to %s, the archive has %s",
+					conflict.ToolID, conflict.ExistingFingerprint, conflict.ImportedFingerprint))
+			}
+		}
+		return nil
+	}, nil
+}
+
+func (rs *restorer) preparePolicies(info ComponentInfo, data []byte) (restoreStep, error) {
+	var policies []pinning.DomainPolicy
+	if err := decodeComponent(info, data, &policies); err != nil {
+		return nil, err
+	}
+	domains := make(map[string]bool, len(policies))
+	for i, policy := range policies {
+		if policy.Domain == "" {
+			return nil, fmt.Errorf("%w: entry %d has no domain", ErrInvalidComponent, i)
+		}
+		switch policy.Policy {
+		case pinning.PinningPolicyDefault, pinning.PinningPolicyAlwaysTrust, pinning.PinningPolicyNeverTrust, pinning.PinningPolicyInteractiveOnly:
+		default:
+			return nil, fmt.Errorf("%w: entry %d (%s) has unknown policy %q", ErrInvalidComponent, i, policy.Domain, policy.Policy)
+		}
+		if domains[policy.Domain] {
+			return nil, fmt.Errorf("%w: duplicate domain %s", ErrInvalidComponent, policy.Domain)
+		}
+		domains[policy.Domain] = true
+	}
+
+	return func(c *ComponentReport) error {
+		list, err := rs.k.ListDomainPolicies()
+		if err != nil {
+			return err
+		}
+		existing := make(map[string]pinning.PinningPolicy, len(list))
+		for _, policy := range list {
+			existing[policy.Domain] = policy.Policy
+		}
+		for _, policy := range policies {
+			current, ok := existing[policy.Domain]
+			if ok && current == policy.Policy {
+				c.Skipped++
+				continue
+			}
+			if ok && rs.mode == ModeMerge {
+				c.Conflicts = append(c.Conflicts, fmt.Sprintf("%s has policy %s, the archive has %s", policy.Domain, current, policy.Policy))
+				continue
+			}
+			if !rs.opts.DryRun {
+				if err := rs.k.SetDomainPolicy(policy.Domain, policy.Policy); err != nil {
+					return err
+				}
+			}
+			c.Imported++
+		}
+		if rs.mode == ModeReplace {
+			for _, policy := range list {
+				if domains[policy.Domain] {
+					continue
+				}
+				if !rs.opts.DryRun {
+					if err := rs.k.RemoveDomainPolicy(policy.Domain); err != nil {
+						return err
+					}
+				}
+				c.Removed++
+			}
+		}
+		return nil
+	}, nil
+}
+
+func (rs *restorer) prepareRejections(info ComponentInfo, data []byte) (restoreStep, error) {
+	var entries []struct {
+		ToolID      string `json:"tool_id"`
+		Domain      string `json:"domain"`
+		Fingerprint string `json:"fingerprint"`
+	}
+	if err := decodeComponent(info, data, &entries); err != nil {
+		return nil, err
+	}
+	rejected := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		rejected[rejectionID(entry.ToolID, entry.Domain, entry.Fingerprint)] = true
+	}
+
+	return func(c *ComponentReport) error {
+		if rs.mode == ModeReplace {
+			existing, err := rs.k.ListRejectedKeys()
+			if err != nil {
+				return err
+			}
+			for _, r := range existing {
+				if rejected[rejectionID(r.ToolID, r.Domain, r.Fingerprint)] {
+					continue
+				}
+				if !rs.opts.DryRun {
+					if err := rs.k.ClearRejection(r.ToolID, r.Domain, r.Fingerprint); err != nil {
+						return err
+					}
+				}
+				c.Removed++
+			}
+		}
+		result, err := rs.k.ImportRejectedKeys(string(data), pinning.ImportOptions{Limits: rs.opts.Limits, DryRun: rs.opts.DryRun})
+		if err != nil {
+			return err
+		}
+		c.addImportReport(result)
+		return nil
+	}, nil
+}
+
+// rejectionID identifies the rejection of a key for a tool and domain.
+func rejectionID(toolID, domain, fingerprint string) string {
+	return toolID + "\x00" + domain + "\x00" + strings.ToLower(fingerprint)
+}
+
+func (rs *restorer) prepareDiscoveryVersions(info ComponentInfo, data []byte) (restoreStep, error) {
+	var versions []pinning.DiscoveryVersion
+	if err := decodeComponent(info, data, &versions); err != nil {
+		return nil, err
+	}
+	for i, version := range versions {
+		if version.Domain == "" || version.SchemaVersion == "" {
+			return nil, fmt.Errorf("%w: entry %d needs a domain and a schema version", ErrInvalidComponent, i)
+		}
+	}
+
+	return func(c *ComponentReport) error {
+		for _, version := range versions {
+			recorded, err := rs.k.GetDiscoveryVersion(version.Domain)
+			if err != nil {
+				return err
+			}
+			// A lower version is never recorded, or downgrades would go
+			// unnoticed after a restore
+			if recorded != nil && discovery.CompareSchemaVersions(version.SchemaVersion, recorded.SchemaVersion) <= 0 {
+				c.Skipped++
+				continue
+			}
+			if !rs.opts.DryRun {
+				if err := rs.k.RecordDiscoveryVersion(version.Domain, version.SchemaVersion); err != nil {
+					return err
+				}
+			}
+			c.Imported++
+		}
+		return nil
+	}, nil
+}
+
+func (rs *restorer) prepareDiscoveryCache(info ComponentInfo, data []byte) (restoreStep, error) {
+	var docs []discovery.CachedDocument
+	if err := decodeComponent(info, data, &docs); err != nil {
+		return nil, err
+	}
+	for i, doc := range docs {
+		if doc.Domain == "" || doc.Document == nil {
+			return nil, fmt.Errorf("%w: entry %d needs a domain and a document", ErrInvalidComponent, i)
+		}
+	}
+
+	return func(c *ComponentReport) error {
+		for _, doc := range docs {
+			if rs.mode == ModeMerge {
+				cached, err := rs.k.LoadDiscoveryDocument(doc.Domain)
+				if err != nil {
+					return err
+				}
+				if cached != nil {
+					c.Skipped++
+					continue
+				}
+			}
+			if !rs.opts.DryRun {
+				if err := rs.k.StoreDiscoveryDocument(doc); err != nil {
+					return err
+				}
+			}
+			c.Imported++
+		}
+		return nil
+	}, nil
+}
+
+func (rs *restorer) prepareRevocationCache(info ComponentInfo, data []byte) (restoreStep, error) {
+	var docs []revocation.CachedDocument
+	if err := decodeComponent(info, data, &docs); err != nil {
+		return nil, err
+	}
+	for i, doc := range docs {
+		if doc.URL == "" || doc.Document == nil {
+			return nil, fmt.Errorf("%w: entry %d needs a URL and a document", ErrInvalidComponent, i)
+		}
+	}
+
+	return func(c *ComponentReport) error {
+		for _, doc := range docs {
+			if rs.mode == ModeMerge {
+				cached, err := rs.k.LoadRevocationDocument(doc.URL)
+				if err != nil {
+					return err
+				}
+				if cached != nil {
+					c.Skipped++
+					continue
+				}
+			}
+			if !rs.opts.DryRun {
+				if err := rs.k.StoreRevocationDocument(doc.URL, doc.Document); err != nil {
+					return err
+				}
+			}
+			c.Imported++
+		}
+		return nil
+	}, nil
+}
+
+func (rs *restorer) preparePinStore(info ComponentInfo, data []byte) (restoreStep, error) {
+	var pins map[string]string
+	if err := json.Unmarshal(data, &pins); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidComponent, err)
+	}
+	if err := checkEntries(info, len(pins)); err != nil {
+		return nil, err
+	}
+
+	return func(c *ComponentReport) error {
+		path, ok := rs.pinStores[strings.TrimPrefix(info.Path, pinStoreDir)]
+		if !ok {
+			c.Note = "no pin store file given to restore it to"
+			return nil
+		}
+		existing, err := readPinStore(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if existing == nil {
+			existing = make(map[string]string)
+		}
+
+		keys := make([]string, 0, len(pins))
+		for key := range pins {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			current, ok := existing[key]
+			switch {
+			case ok && crypto.FingerprintEqual(current, pins[key]):
+				c.Skipped++
+			case ok && rs.mode == ModeMerge:
+				c.Conflicts = append(c.Conflicts, fmt.Sprintf("%s is pinned to %s, the archive has %s", key, current, pins[key]))
+			default:
+				existing[key] = pins[key]
+				c.Imported++
+			}
+		}
+		if rs.mode == ModeReplace {
+			for key := range existing {
+				if _, ok := pins[key]; !ok {
+					delete(existing, key)
+					c.Removed++
+				}
+			}
+		}
+		if rs.opts.DryRun || c.Imported+c.Removed == 0 {
+			return nil
+		}
+		out, err := json.Marshal(existing)
+		if err != nil {
+			return fmt.Errorf("failed to marshal pin store: %w", err)
+		}
+		return writeFileAtomic(path, out)
+	}, nil
+}
+
+// addImportReport counts the entries of an import report and describes
+// its errors.
+func (c *ComponentReport) addImportReport(result *pinning.ImportReport) {
+	c.Imported += len(result.Imported)
+	c.Skipped += len(result.Skipped)
+	for _, issue := range result.Errors {
+		c.Errors = append(c.Errors, fmt.Sprintf("entry %d (%s): %s", issue.Index, issue.ToolID, issue.Reason))
+	}
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it over path.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".schemapin-pins-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,342 @@
+// Package truststate packs the complete trust state of a SchemaPin
+// installation into a single archive and restores it elsewhere: the pins
+// and namespace pins, domain policies, rejections, recorded discovery
+// versions and cached discovery and revocation documents of a pinning
+// database, and any file-based verification.KeyPinStore documents.
+//
+// The archive is a gzip-compressed tar file holding a manifest.json and
+// one JSON document per component. The database is exported through its
+// JSON formats rather than copied, so an archive written by one version
+// can be restored by another. The manifest records the format version and
+// SHA-256 hash of every component, and Restore checks them all before
+// changing anything. The same trust state always produces the same
+// archive bytes.
+package truststate
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/ThirdKeyAi/schemapin/go/internal/version"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/pinning"
+)
+
+// Format is the format name recorded in a manifest.
+const Format = "schemapin-trust-state"
+
+// FormatVersion is the version of the archive layout and manifest written
+// by Backup. Restore accepts archives up to this version.
+const FormatVersion = 1
+
+// ManifestPath is the path of the manifest in an archive.
+const ManifestPath = "manifest.json"
+
+// pinStoreDir is the directory of file-based pin stores in an archive.
+const pinStoreDir = "pin_stores/"
+
+// Component is the kind of a piece of trust state in an archive.
+type Component string
+
+const (
+	// ComponentPins is the pins of single tools, as written by
+	// pinning.KeyPinning.ExportPinnedKeys.
+	ComponentPins Component = "pins"
+	// ComponentNamespacePins is the namespace pins, in the same format.
+	ComponentNamespacePins Component = "namespace_pins"
+	// ComponentDomainPolicies is the list of pinning.DomainPolicy.
+	ComponentDomainPolicies Component = "domain_policies"
+	// ComponentRejections is the rejected keys, as written by
+	// pinning.KeyPinning.ExportRejectedKeys.
+	ComponentRejections Component = "rejections"
+	// ComponentDiscoveryVersions is the list of pinning.DiscoveryVersion.
+	ComponentDiscoveryVersions Component = "discovery_versions"
+	// ComponentDiscoveryCache is the list of cached discovery.CachedDocument.
+	ComponentDiscoveryCache Component = "discovery_cache"
+	// ComponentRevocationCache is the list of cached
+	// revocation.CachedDocument.
+	ComponentRevocationCache Component = "revocation_cache"
+	// ComponentPinStore is a file-based verification.KeyPinStore, stored
+	// under pin_stores/ by the base name of its file.
+	ComponentPinStore Component = "pin_store"
+)
+
+// databaseComponents are the components exported from a pinning database,
+// in the order they are written and restored. Every archive has all of
+// them.
+var databaseComponents = []Component{
+	ComponentDomainPolicies,
+	ComponentPins,
+	ComponentNamespacePins,
+	ComponentRejections,
+	ComponentDiscoveryVersions,
+	ComponentDiscoveryCache,
+	ComponentRevocationCache,
+}
+
+// componentFormatVersions are the format versions of the components
+// written by Backup. Restore accepts components up to these versions.
+var componentFormatVersions = map[Component]int{
+	ComponentPins:              1,
+	ComponentNamespacePins:     1,
+	ComponentDomainPolicies:    1,
+	ComponentRejections:        1,
+	ComponentDiscoveryVersions: 1,
+	ComponentDiscoveryCache:    1,
+	ComponentRevocationCache:   1,
+	ComponentPinStore:          1,
+}
+
+// componentPath returns the archive path of a database component.
+func componentPath(kind Component) string {
+	return string(kind) + ".json"
+}
+
+// Manifest describes the components of an archive.
+type Manifest struct {
+	Format        string `json:"format"`
+	FormatVersion int    `json:"format_version"`
+	// CreatedBy is the SchemaPin version that wrote the archive.
+	CreatedBy  string          `json:"created_by,omitempty"`
+	Components []ComponentInfo `json:"components"`
+}
+
+// ComponentInfo describes one component of an archive.
+type ComponentInfo struct {
+	Path          string    `json:"path"`
+	Kind          Component `json:"kind"`
+	FormatVersion int       `json:"format_version"`
+	// Entries is the number of pins, policies, documents or other entries
+	// the component holds.
+	Entries int   `json:"entries"`
+	Size    int64 `json:"size"`
+	// SHA256 is the hash of the component, as "sha256:<hex>".
+	SHA256 string `json:"sha256"`
+}
+
+// BackupOptions configures Backup.
+type BackupOptions struct {
+	// PinStoreFiles are paths of verification.KeyPinStore JSON documents
+	// to include. Each is stored by its base name, which must be unique.
+	PinStoreFiles []string
+}
+
+// archiveEntry is a component ready to be written.
+type archiveEntry struct {
+	info ComponentInfo
+	data []byte
+}
+
+// Backup writes the trust state held by k and the pin store files named in
+// opts to w as an archive, and returns its manifest. The trust state is
+// read in full first, so an error reading it leaves w untouched.
+func Backup(k *pinning.KeyPinning, w io.Writer, opts BackupOptions) (*Manifest, error) {
+	entries, err := databaseEntries(k)
+	if err != nil {
+		return nil, err
+	}
+	stores, err := pinStoreEntries(opts.PinStoreFiles)
+	if err != nil {
+		return nil, err
+	}
+	entries = append(entries, stores...)
+
+	manifest := &Manifest{
+		Format:        Format,
+		FormatVersion: FormatVersion,
+		CreatedBy:     "schemapin-go/" + version.GetVersion(),
+	}
+	for _, entry := range entries {
+		manifest.Components = append(manifest.Components, entry.info)
+	}
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	if err := writeArchiveFile(tw, ManifestPath, manifestData); err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if err := writeArchiveFile(tw, entry.info.Path, entry.data); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gw.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// databaseEntries exports every database component of k.
+func databaseEntries(k *pinning.KeyPinning) ([]archiveEntry, error) {
+	keys, err := k.ListPinnedKeyInfo()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pinned keys: %w", err)
+	}
+	pins, namespacePins := []pinning.PinnedKeyInfo{}, []pinning.PinnedKeyInfo{}
+	for _, info := range keys {
+		if info.Namespace {
+			namespacePins = append(namespacePins, info)
+		} else {
+			pins = append(pins, info)
+		}
+	}
+	policies, err := k.ListDomainPolicies()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list domain policies: %w", err)
+	}
+	rejections, err := k.ListRejectedKeys()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rejected keys: %w", err)
+	}
+	versions, err := k.ListDiscoveryVersions()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list discovery versions: %w", err)
+	}
+	discoveryDocs, err := k.ListDiscoveryDocuments()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cached discovery documents: %w", err)
+	}
+	revocationDocs, err := k.ListRevocationDocuments()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cached revocation documents: %w", err)
+	}
+
+	values := map[Component]struct {
+		value   any
+		entries int
+	}{
+		ComponentPins:              {pins, len(pins)},
+		ComponentNamespacePins:     {namespacePins, len(namespacePins)},
+		ComponentDomainPolicies:    {nonNil(policies), len(policies)},
+		ComponentRejections:        {nonNil(rejections), len(rejections)},
+		ComponentDiscoveryVersions: {nonNil(versions), len(versions)},
+		ComponentDiscoveryCache:    {nonNil(discoveryDocs), len(discoveryDocs)},
+		ComponentRevocationCache:   {nonNil(revocationDocs), len(revocationDocs)},
+	}
+	var entries []archiveEntry
+	for _, kind := range databaseComponents {
+		v := values[kind]
+		data, err := json.MarshalIndent(v.value, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal %s: %w", kind, err)
+		}
+		entries = append(entries, newArchiveEntry(componentPath(kind), kind, v.entries, data))
+	}
+	return entries, nil
+}
+
+// pinStoreEntries reads the pin store files at paths, ordered by name.
+// Each document is re-encoded so that equal stores give equal bytes.
+func pinStoreEntries(paths []string) ([]archiveEntry, error) {
+	var entries []archiveEntry
+	seen := make(map[string]string)
+	for _, path := range paths {
+		name := filepath.Base(path)
+		if err := validatePinStoreName(name); err != nil {
+			return nil, fmt.Errorf("pin store %s: %w", path, err)
+		}
+		if other, ok := seen[name]; ok {
+			return nil, fmt.Errorf("pin stores %s and %s have the same file name", other, path)
+		}
+		seen[name] = path
+
+		pins, err := readPinStore(path)
+		if err != nil {
+			return nil, err
+		}
+		data, err := json.MarshalIndent(pins, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal pin store %s: %w", path, err)
+		}
+		entries = append(entries, newArchiveEntry(pinStoreDir+name, ComponentPinStore, len(pins), data))
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].info.Path < entries[j].info.Path })
+	return entries, nil
+}
+
+// readPinStore reads the pins of a verification.KeyPinStore document,
+// keyed by tool_id@domain.
+func readPinStore(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pin store: %w", err)
+	}
+	pins := make(map[string]string)
+	if err := json.Unmarshal(data, &pins); err != nil {
+		return nil, fmt.Errorf("invalid pin store %s: %w", path, err)
+	}
+	return pins, nil
+}
+
+// validatePinStoreName checks the name a pin store is archived under.
+func validatePinStoreName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("invalid pin store name %q", name)
+	}
+	if strings.IndexFunc(name, unicode.IsControl) >= 0 {
+		return fmt.Errorf("pin store name %q contains control characters", name)
+	}
+	return nil
+}
+
+func newArchiveEntry(path string, kind Component, entries int, data []byte) archiveEntry {
+	return archiveEntry{
+		info: ComponentInfo{
+			Path:          path,
+			Kind:          kind,
+			FormatVersion: componentFormatVersions[kind],
+			Entries:       entries,
+			Size:          int64(len(data)),
+			SHA256:        hashOf(data),
+		},
+		data: data,
+	}
+}
+
+// writeArchiveFile writes a regular file with fixed metadata, so that the
+// archive depends only on its contents.
+func writeArchiveFile(tw *tar.Writer, name string, data []byte) error {
+	header := &tar.Header{
+		Name:     name,
+		Typeflag: tar.TypeReg,
+		Mode:     0644,
+		Size:     int64(len(data)),
+		ModTime:  time.Unix(0, 0),
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+func hashOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// nonNil returns s, or an empty slice if s is nil, so that empty
+// components encode as [] rather than null.
+func nonNil[T any](s []T) []T {
+	if s == nil {
+		return []T{}
+	}
+	return s
+}
@@ -0,0 +1,483 @@
+package truststate
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/pinning"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/revocation"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+func seededKeyPEM(t *testing.T, seed string) string {
+	t.Helper()
+	keyManager := crypto.NewKeyManager()
+	key, err := keyManager.GenerateKeypairFromSeed([]byte(seed), crypto.ForTesting)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	publicKeyPEM, err := keyManager.ExportPublicKeyPEM(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("Failed to export key: %v", err)
+	}
+	return publicKeyPEM
+}
+
+func fingerprintOf(t *testing.T, publicKeyPEM string) string {
+	t.Helper()
+	fingerprint, err := crypto.NewKeyManager().CalculateKeyFingerprintFromPEM(publicKeyPEM)
+	if err != nil {
+		t.Fatalf("Failed to fingerprint key: %v", err)
+	}
+	return fingerprint
+}
+
+// fixtureKeys are the keys of the fixture workload.
+type fixtureKeys struct {
+	vendor, namespace, rejected, other string
+}
+
+func newFixtureKeys(t *testing.T) fixtureKeys {
+	return fixtureKeys{
+		vendor:    seededKeyPEM(t, "truststate/vendor"),
+		namespace: seededKeyPEM(t, "truststate/namespace"),
+		rejected:  seededKeyPEM(t, "truststate/rejected"),
+		other:     seededKeyPEM(t, "truststate/other"),
+	}
+}
+
+func openPinning(t *testing.T, path string, opts ...pinning.Option) *pinning.KeyPinning {
+	t.Helper()
+	k, err := pinning.NewKeyPinning(path, pinning.PinningModeAutomatic, nil, opts...)
+	if err != nil {
+		t.Fatalf("Failed to open pinning database: %v", err)
+	}
+	return k
+}
+
+// populate fills k with a pin, a fingerprint-only pin, a namespace pin,
+// domain policies, a rejection, a discovery version and cached discovery
+// and revocation documents.
+func populate(t *testing.T, k *pinning.KeyPinning, keys fixtureKeys) {
+	t.Helper()
+	_, err := k.ApplyPolicy(&pinning.PolicyDocument{PinnedKeys: []pinning.PinnedKeyEntry{
+		{ToolID: "vendor/fetch", Domain: "vendor.invalid", Fingerprint: fingerprintOf(t, keys.vendor)},
+	}})
+	steps := []error{
+		err,
+		k.PinKey("vendor/search", keys.vendor, "vendor.invalid", "Vendor"),
+		k.PinKeyForNamespace("tools/", keys.namespace, "tools.invalid", "Tools"),
+		k.SetDomainPolicy("trusted.invalid", pinning.PinningPolicyAlwaysTrust),
+		k.SetDomainPolicy("blocked.invalid", pinning.PinningPolicyNeverTrust),
+		k.RecordRejection("vendor/crawl", "vendor.invalid", fingerprintOf(t, keys.rejected), pinning.RejectionReasonUser),
+		k.RecordDiscoveryVersion("vendor.invalid", "1.2"),
+		k.StoreDiscoveryDocument(discovery.CachedDocument{
+			Domain:    "vendor.invalid",
+			SourceURL: "https://vendor.invalid/.well-known/schemapin.json",
+			FetchedAt: time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC),
+			Document:  &discovery.WellKnownResponse{SchemaVersion: "1.2", DeveloperName: "Vendor", PublicKeyPEM: keys.vendor},
+		}),
+		k.StoreRevocationDocument("https://vendor.invalid/revocations.json", revocation.BuildRevocationDocument("vendor.invalid")),
+	}
+	for _, err := range steps {
+		if err != nil {
+			t.Fatalf("Failed to populate database: %v", err)
+		}
+	}
+}
+
+// workload is a pin decision of the fixture workload.
+type workload struct {
+	toolID, domain, key string
+}
+
+func fixtureWorkload(keys fixtureKeys) []workload {
+	return []workload{
+		{"vendor/search", "vendor.invalid", keys.vendor},
+		{"vendor/search", "vendor.invalid", keys.other},
+		{"vendor/fetch", "vendor.invalid", keys.vendor},
+		{"vendor/fetch", "vendor.invalid", keys.other},
+		{"tools/lint", "tools.invalid", keys.namespace},
+		{"vendor/crawl", "vendor.invalid", keys.rejected},
+		{"any", "trusted.invalid", keys.other},
+		{"any", "blocked.invalid", keys.vendor},
+	}
+}
+
+// decisions closes k and returns the decisions of the fixture workload
+// against its database, taken in dry run so that they change nothing.
+func decisions(t *testing.T, k *pinning.KeyPinning, keys fixtureKeys) []string {
+	t.Helper()
+	path := k.DBPath()
+	if err := k.Close(); err != nil {
+		t.Fatal(err)
+	}
+	k, err := pinning.NewKeyPinning(path, pinning.PinningModeInteractive, nil, pinning.WithDryRun(true))
+	if err != nil {
+		t.Fatalf("Failed to open pinning database: %v", err)
+	}
+	defer k.Close()
+
+	var got []string
+	for _, w := range fixtureWorkload(keys) {
+		d, err := k.InteractivePinKeyWithDecision(w.toolID, w.key, w.domain, "Developer")
+		got = append(got, fmt.Sprintf("%s@%s: accepted=%v trust=%s prompt=%s err=%v", w.toolID, w.domain, d.Accepted, d.TrustDecision, d.WouldPrompt, err))
+	}
+	return got
+}
+
+// trustState returns what decides verification in k: the identity and
+// key of its pins, its domain policies and its rejections, leaving out the
+// provenance and timestamps set on restore.
+func trustState(t *testing.T, k *pinning.KeyPinning) ([]string, map[string]pinning.PinningPolicy, []pinning.RejectedKey) {
+	t.Helper()
+	infos, err := k.ListPinnedKeyInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var pins []string
+	for _, info := range infos {
+		fingerprint := info.Fingerprint
+		if info.PublicKeyPEM != "" {
+			fingerprint = fingerprintOf(t, info.PublicKeyPEM)
+		}
+		pins = append(pins, fmt.Sprintf("%s namespace=%v domain=%s key=%s pinned_at=%s",
+			info.ToolID, info.Namespace, info.Domain, fingerprint, info.PinnedAt.Format(time.RFC3339)))
+	}
+	list, err := k.ListDomainPolicies()
+	if err != nil {
+		t.Fatal(err)
+	}
+	policies := make(map[string]pinning.PinningPolicy)
+	for _, policy := range list {
+		policies[policy.Domain] = policy.Policy
+	}
+	rejections, err := k.ListRejectedKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pins, policies, rejections
+}
+
+func backup(t *testing.T, k *pinning.KeyPinning, opts BackupOptions) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if _, err := Backup(k, &buf, opts); err != nil {
+		t.Fatalf("Backup failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestBackupRestoreRoundTrip(t *testing.T) {
+	keys := newFixtureKeys(t)
+	dir := t.TempDir()
+	fake := clock.NewFake(time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC))
+	source := openPinning(t, filepath.Join(dir, "source.db"), pinning.WithClock(fake))
+	populate(t, source, keys)
+
+	store := verification.NewKeyPinStore()
+	store.CheckAndPin("search", "vendor.invalid", fingerprintOf(t, keys.vendor))
+	storeJSON, err := store.ToJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	storePath := filepath.Join(dir, "pins.json")
+	if err := os.WriteFile(storePath, []byte(storeJSON), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	archive := backup(t, source, BackupOptions{PinStoreFiles: []string{storePath}})
+	if again := backup(t, source, BackupOptions{PinStoreFiles: []string{storePath}}); !bytes.Equal(archive, again) {
+		t.Error("Expected backups of the same state to be identical")
+	}
+
+	restoredDir := t.TempDir()
+	restoredStore := filepath.Join(restoredDir, "pins.json")
+	target := openPinning(t, filepath.Join(restoredDir, "target.db"))
+	report, err := Restore(target, bytes.NewReader(archive), RestoreOptions{Source: "trust.tar.gz", PinStoreFiles: []string{restoredStore}})
+	if err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if report.HasErrors() {
+		t.Fatalf("Expected no errors, got %+v", report.Components)
+	}
+	imported := make(map[string]int)
+	for _, c := range report.Components {
+		imported[c.Path] = c.Imported
+	}
+	want := map[string]int{
+		"domain_policies.json": 2, "pins.json": 2, "namespace_pins.json": 1, "rejections.json": 1,
+		"discovery_versions.json": 1, "discovery_cache.json": 1, "revocation_cache.json": 1, "pin_stores/pins.json": 1,
+	}
+	if !reflect.DeepEqual(imported, want) {
+		t.Errorf("Expected imported counts %v, got %v", want, imported)
+	}
+
+	wantPins, wantPolicies, wantRejections := trustState(t, source)
+	gotPins, gotPolicies, gotRejections := trustState(t, target)
+	if !reflect.DeepEqual(gotPins, wantPins) {
+		t.Errorf("Expected pins %v, got %v", wantPins, gotPins)
+	}
+	if !reflect.DeepEqual(gotPolicies, wantPolicies) {
+		t.Errorf("Expected policies %v, got %v", wantPolicies, gotPolicies)
+	}
+	if !reflect.DeepEqual(gotRejections, wantRejections) {
+		t.Errorf("Expected rejections %+v, got %+v", wantRejections, gotRejections)
+	}
+	if version, err := target.GetDiscoveryVersion("vendor.invalid"); err != nil || version == nil || version.SchemaVersion != "1.2" {
+		t.Errorf("Expected discovery version 1.2, got %+v, %v", version, err)
+	}
+	if doc, err := target.LoadRevocationDocument("https://vendor.invalid/revocations.json"); err != nil || doc == nil {
+		t.Errorf("Expected the cached revocation document, got %v, %v", doc, err)
+	}
+	if data, err := os.ReadFile(restoredStore); err != nil || string(data) != storeJSON {
+		t.Errorf("Expected pin store %s, got %s, %v", storeJSON, data, err)
+	}
+
+	if want, got := decisions(t, source, keys), decisions(t, target, keys); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the restored decisions\n%v\nto equal\n%v", got, want)
+	}
+}
+
+func TestRestoreMergeAndReplace(t *testing.T) {
+	keys := newFixtureKeys(t)
+	source := openPinning(t, filepath.Join(t.TempDir(), "source.db"))
+	populate(t, source, keys)
+	archive := backup(t, source, BackupOptions{})
+
+	// stale adds a conflicting pin, policy and rejection and state the
+	// archive lacks to a copy of the source
+	stale := func(t *testing.T) *pinning.KeyPinning {
+		k := openPinning(t, filepath.Join(t.TempDir(), "target.db"))
+		t.Cleanup(func() { k.Close() })
+		populate(t, k, keys)
+		steps := []error{
+			k.RemovePinnedKey("vendor/search"),
+			k.PinKey("vendor/search", keys.other, "vendor.invalid", "Vendor"),
+			k.PinKey("extra", keys.other, "extra.invalid", "Extra"),
+			k.SetDomainPolicy("blocked.invalid", pinning.PinningPolicyAlwaysTrust),
+			k.SetDomainPolicy("extra.invalid", pinning.PinningPolicyNeverTrust),
+			k.RecordRejection("extra", "extra.invalid", fingerprintOf(t, keys.vendor), pinning.RejectionReasonPolicy),
+		}
+		for _, err := range steps {
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		return k
+	}
+	reports := func(report *RestoreReport) map[string]ComponentReport {
+		byPath := make(map[string]ComponentReport)
+		for _, c := range report.Components {
+			byPath[c.Path] = c
+		}
+		return byPath
+	}
+
+	t.Run("merge keeps conflicts", func(t *testing.T) {
+		k := stale(t)
+		report, err := Restore(k, bytes.NewReader(archive), RestoreOptions{Mode: ModeMerge})
+		if err != nil {
+			t.Fatal(err)
+		}
+		byPath := reports(report)
+		if c := byPath["pins.json"]; len(c.Conflicts) != 1 || c.Removed != 0 {
+			t.Errorf("Expected one pin conflict, got %+v", c)
+		}
+		if c := byPath["domain_policies.json"]; len(c.Conflicts) != 1 || c.Skipped != 1 {
+			t.Errorf("Expected one policy conflict, got %+v", c)
+		}
+		if pinned, _ := k.GetPinnedKey("vendor/search"); pinned != keys.other {
+			t.Error("Expected merge to keep the conflicting pin")
+		}
+		if !k.IsKeyPinned("extra") {
+			t.Error("Expected merge to keep pins the archive lacks")
+		}
+	})
+
+	t.Run("replace matches the archive", func(t *testing.T) {
+		k := stale(t)
+		dryRun, err := Restore(k, bytes.NewReader(archive), RestoreOptions{Mode: ModeReplace, DryRun: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c := reports(dryRun)["pins.json"]; c.Removed != 1 || !k.IsKeyPinned("extra") {
+			t.Errorf("Expected a dry run to report the removal without removing, got %+v", c)
+		}
+
+		report, err := Restore(k, bytes.NewReader(archive), RestoreOptions{Mode: ModeReplace})
+		if err != nil {
+			t.Fatal(err)
+		}
+		byPath := reports(report)
+		for path, removed := range map[string]int{"pins.json": 1, "domain_policies.json": 1, "rejections.json": 1} {
+			if c := byPath[path]; c.Removed != removed || len(c.Conflicts) != 0 {
+				t.Errorf("Expected %s to remove %d, got %+v", path, removed, c)
+			}
+		}
+		wantPins, wantPolicies, _ := trustState(t, source)
+		gotPins, gotPolicies, _ := trustState(t, k)
+		if !reflect.DeepEqual(gotPins, wantPins) || !reflect.DeepEqual(gotPolicies, wantPolicies) {
+			t.Errorf("Expected the trust state of the archive, got pins %v and policies %v", gotPins, gotPolicies)
+		}
+		if rejections, _ := k.ListRejectedKeys(); len(rejections) != 1 {
+			t.Errorf("Expected the archive's rejection only, got %+v", rejections)
+		}
+	})
+	source.Close()
+}
+
+// archiveFile is a file of an archive being rewritten.
+type archiveFile struct {
+	name string
+	data []byte
+}
+
+func readFiles(t *testing.T, archive []byte) []archiveFile {
+	t.Helper()
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	var files []archiveFile
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, archiveFile{hdr.Name, data})
+	}
+}
+
+func writeFiles(t *testing.T, files []archiveFile) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gw)
+	for _, f := range files {
+		if err := writeArchiveFile(tw, f.name, f.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestRestoreRejectsCorruptArchive(t *testing.T) {
+	keys := newFixtureKeys(t)
+	source := openPinning(t, filepath.Join(t.TempDir(), "source.db"))
+	defer source.Close()
+	populate(t, source, keys)
+	archive := backup(t, source, BackupOptions{})
+
+	rewrite := func(edit func([]archiveFile) []archiveFile) []byte {
+		return writeFiles(t, edit(readFiles(t, archive)))
+	}
+	edit := func(name string, change func([]byte) []byte) func([]archiveFile) []archiveFile {
+		return func(files []archiveFile) []archiveFile {
+			for i := range files {
+				if files[i].name == name {
+					files[i].data = change(files[i].data)
+				}
+			}
+			return files
+		}
+	}
+
+	tests := []struct {
+		name    string
+		archive []byte
+		want    error
+		path    string
+		message string
+	}{
+		{
+			name: "corrupted component",
+			archive: rewrite(edit("rejections.json", func(data []byte) []byte {
+				return bytes.Replace(data, []byte(`"user"`), []byte(`"revoked"`), 1)
+			})),
+			want:    ErrHashMismatch,
+			path:    "rejections.json",
+			message: "trust-state component rejections.json: component hash mismatch: manifest has sha256:",
+		},
+		{
+			name: "missing component",
+			archive: rewrite(func(files []archiveFile) []archiveFile {
+				var kept []archiveFile
+				for _, f := range files {
+					if f.name != "namespace_pins.json" {
+						kept = append(kept, f)
+					}
+				}
+				return kept
+			}),
+			want: ErrMissingComponent,
+			path: "namespace_pins.json",
+		},
+		{
+			name: "newer format",
+			archive: rewrite(edit(ManifestPath, func(data []byte) []byte {
+				return bytes.Replace(data, []byte(`"format_version": 1,`), []byte(`"format_version": 2,`), 1)
+			})),
+			want: ErrUnsupportedVersion,
+		},
+		{
+			name: "unlisted entry",
+			archive: rewrite(func(files []archiveFile) []archiveFile {
+				return append(files, archiveFile{"extra.json", []byte("[]")})
+			}),
+			want: ErrInvalidArchive,
+		},
+		{
+			name:    "not an archive",
+			archive: []byte("[]"),
+			want:    ErrInvalidArchive,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := openPinning(t, filepath.Join(t.TempDir(), "target.db"))
+			defer k.Close()
+
+			report, err := Restore(k, bytes.NewReader(tt.archive), RestoreOptions{})
+			if !errors.Is(err, tt.want) || report != nil {
+				t.Fatalf("Expected %v, got %v", tt.want, err)
+			}
+			var componentErr *ComponentError
+			if tt.path != "" && (!errors.As(err, &componentErr) || componentErr.Path != tt.path) {
+				t.Errorf("Expected an error for component %s, got %v", tt.path, err)
+			}
+			if tt.message != "" && !bytes.HasPrefix([]byte(err.Error()), []byte(tt.message)) {
+				t.Errorf("Expected error %q..., got %q", tt.message, err)
+			}
+			if pins, _ := k.ListPinnedKeyInfo(); len(pins) != 0 {
+				t.Errorf("Expected nothing restored, got %d pins", len(pins))
+			}
+		})
+	}
+}
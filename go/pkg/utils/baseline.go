@@ -0,0 +1,186 @@
+package utils
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+)
+
+// BaselineEntry is the snapshot of a tool's schema recorded in a
+// BaselineStore: the content an operator reviewed and the key it was
+// verified with.
+type BaselineEntry struct {
+	ToolID string `json:"tool_id"`
+	// SchemaHash is the SHA-256 of the canonical schema, as
+	// "sha256:<hex>".
+	SchemaHash     string `json:"schema_hash"`
+	KeyFingerprint string `json:"key_fingerprint,omitempty"`
+	// CanonicalSchema is the canonical schema itself, recorded on request
+	// so that later changes can be reported path by path.
+	CanonicalSchema string `json:"canonical_schema,omitempty"`
+	RecordedAt      string `json:"recorded_at"`
+}
+
+// BaselineComparison is the outcome of BaselineStore.Compare.
+type BaselineComparison struct {
+	ToolID string `json:"tool_id"`
+	// Found reports whether a baseline was recorded for the tool; the
+	// other fields but SchemaHash and KeyFingerprint are empty if not.
+	Found          bool `json:"found"`
+	ContentChanged bool `json:"content_changed,omitempty"`
+	KeyChanged     bool `json:"key_changed,omitempty"`
+	// SchemaHash and KeyFingerprint are those of the schema compared, and
+	// BaselineHash and BaselineKeyFingerprint those recorded.
+	SchemaHash             string `json:"schema_hash"`
+	KeyFingerprint         string `json:"key_fingerprint,omitempty"`
+	BaselineHash           string `json:"baseline_hash,omitempty"`
+	BaselineKeyFingerprint string `json:"baseline_key_fingerprint,omitempty"`
+	// Diff lists the changed paths when the content changed and the
+	// baseline holds the canonical schema.
+	Diff *core.Diff `json:"diff,omitempty"`
+}
+
+// BaselineStore keeps one BaselineEntry per tool ID as a JSON file in a
+// directory, for detecting schemas whose content changed since they were
+// reviewed even though they are validly signed.
+type BaselineStore struct {
+	dir string
+}
+
+// NewBaselineStore returns a store in dir, creating the directory if it
+// does not exist.
+func NewBaselineStore(dir string) (*BaselineStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create baseline directory: %w", err)
+	}
+	return &BaselineStore{dir: dir}, nil
+}
+
+// path returns the file the entry for toolID is stored in. Tool IDs are
+// escaped so that one containing "/" or ".." stays inside the directory.
+func (s *BaselineStore) path(toolID string) (string, error) {
+	if toolID == "" {
+		return "", fmt.Errorf("baseline tool ID must not be empty")
+	}
+	return filepath.Join(s.dir, url.PathEscape(toolID)+".json"), nil
+}
+
+// Get returns the entry recorded for toolID, or nil if there is none.
+func (s *BaselineStore) Get(toolID string) (*BaselineEntry, error) {
+	path, err := s.path(toolID)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path) // #nosec G304 -- path inside the baseline directory
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read baseline for %s: %w", toolID, err)
+	}
+	var entry BaselineEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.SchemaHash == "" {
+		return nil, fmt.Errorf("baseline for %s is malformed", toolID)
+	}
+	return &entry, nil
+}
+
+// Update records schema, verified with the key keyFingerprint, as the
+// baseline for toolID, replacing any earlier one. With storeCanonical the
+// canonical schema is recorded too. The file is replaced atomically, so a
+// concurrent reader sees either the old entry or the new one.
+func (s *BaselineStore) Update(toolID string, schema map[string]interface{}, keyFingerprint string, storeCanonical bool) (*BaselineEntry, error) {
+	path, err := s.path(toolID)
+	if err != nil {
+		return nil, err
+	}
+	canonical, schemaHash, err := canonicalHash(schema)
+	if err != nil {
+		return nil, err
+	}
+	entry := &BaselineEntry{
+		ToolID:         toolID,
+		SchemaHash:     schemaHash,
+		KeyFingerprint: keyFingerprint,
+		RecordedAt:     clock.Format(clock.Real.Now()),
+	}
+	if storeCanonical {
+		entry.CanonicalSchema = canonical
+	}
+	data, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode baseline for %s: %w", toolID, err)
+	}
+	if err := writeFileAtomic(path, append(data, '\n')); err != nil {
+		return nil, fmt.Errorf("failed to write baseline for %s: %w", toolID, err)
+	}
+	return entry, nil
+}
+
+// Compare compares schema, verified with the key keyFingerprint, against
+// the baseline for toolID. A changed key and changed content are reported
+// independently; an empty fingerprint on either side is not a change.
+func (s *BaselineStore) Compare(toolID string, schema map[string]interface{}, keyFingerprint string) (*BaselineComparison, error) {
+	entry, err := s.Get(toolID)
+	if err != nil {
+		return nil, err
+	}
+	_, schemaHash, err := canonicalHash(schema)
+	if err != nil {
+		return nil, err
+	}
+	comparison := &BaselineComparison{ToolID: toolID, SchemaHash: schemaHash, KeyFingerprint: keyFingerprint}
+	if entry == nil {
+		return comparison, nil
+	}
+	comparison.Found = true
+	comparison.BaselineHash = entry.SchemaHash
+	comparison.BaselineKeyFingerprint = entry.KeyFingerprint
+	comparison.ContentChanged = entry.SchemaHash != schemaHash
+	comparison.KeyChanged = entry.KeyFingerprint != "" && keyFingerprint != "" && !crypto.FingerprintEqual(entry.KeyFingerprint, keyFingerprint)
+	if comparison.ContentChanged && entry.CanonicalSchema != "" {
+		_, diff, err := core.SchemaChanged(entry.CanonicalSchema, schema)
+		if err != nil {
+			return nil, fmt.Errorf("failed to diff against baseline for %s: %w", toolID, err)
+		}
+		comparison.Diff = &diff
+	}
+	return comparison, nil
+}
+
+// canonicalHash returns the canonical form of schema and its
+// "sha256:<hex>" hash, as core.SchemaChanged computes them.
+func canonicalHash(schema map[string]interface{}) (string, string, error) {
+	c := core.NewSchemaPinCore()
+	canonical, err := c.CanonicalizeSchema(schema)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to canonicalize schema: %w", err)
+	}
+	return canonical, "sha256:" + hex.EncodeToString(c.HashCanonical(canonical)), nil
+}
+
+// writeFileAtomic writes data to a temporary file next to path and renames
+// it over path.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".schemapin-baseline-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,152 @@
+package utils
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func baselineSchema(cityType string) map[string]interface{} {
+	return map[string]interface{}{
+		"name": "get_weather",
+		"parameters": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"city": map[string]interface{}{"type": cityType},
+			},
+		},
+	}
+}
+
+func newBaselineStore(t *testing.T) *BaselineStore {
+	t.Helper()
+	store, err := NewBaselineStore(filepath.Join(t.TempDir(), "baseline"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestBaselineStoreUnchanged(t *testing.T) {
+	store := newBaselineStore(t)
+	if _, err := store.Update("example.com/get_weather", baselineSchema("string"), "sha256:aaaa", false); err != nil {
+		t.Fatal(err)
+	}
+
+	comparison, err := store.Compare("example.com/get_weather", baselineSchema("string"), "sha256:aaaa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !comparison.Found || comparison.ContentChanged || comparison.KeyChanged || comparison.Diff != nil {
+		t.Errorf("expected an unchanged schema, got %+v", comparison)
+	}
+	if comparison.SchemaHash != comparison.BaselineHash {
+		t.Errorf("expected equal hashes, got %s and %s", comparison.SchemaHash, comparison.BaselineHash)
+	}
+}
+
+func TestBaselineStoreMissing(t *testing.T) {
+	store := newBaselineStore(t)
+	comparison, err := store.Compare("example.com/get_weather", baselineSchema("string"), "sha256:aaaa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comparison.Found || comparison.ContentChanged || comparison.SchemaHash == "" {
+		t.Errorf("expected no baseline, got %+v", comparison)
+	}
+}
+
+func TestBaselineStoreContentChanged(t *testing.T) {
+	store := newBaselineStore(t)
+	if _, err := store.Update("example.com/get_weather", baselineSchema("string"), "sha256:aaaa", true); err != nil {
+		t.Fatal(err)
+	}
+
+	comparison, err := store.Compare("example.com/get_weather", baselineSchema("integer"), "sha256:aaaa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !comparison.ContentChanged || comparison.KeyChanged {
+		t.Fatalf("expected only the content to change, got %+v", comparison)
+	}
+	if comparison.Diff == nil {
+		t.Fatal("expected a diff from the stored canonical schema")
+	}
+	if want := []string{"/parameters/properties/city/type"}; !reflect.DeepEqual(comparison.Diff.Changed, want) {
+		t.Errorf("expected changed paths %v, got %v", want, comparison.Diff.Changed)
+	}
+}
+
+func TestBaselineStoreContentChangedWithoutCanonical(t *testing.T) {
+	store := newBaselineStore(t)
+	if _, err := store.Update("example.com/get_weather", baselineSchema("string"), "sha256:aaaa", false); err != nil {
+		t.Fatal(err)
+	}
+
+	comparison, err := store.Compare("example.com/get_weather", baselineSchema("integer"), "sha256:aaaa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !comparison.ContentChanged || comparison.Diff != nil {
+		t.Errorf("expected a change without a diff, got %+v", comparison)
+	}
+}
+
+func TestBaselineStoreKeyAndContentChanged(t *testing.T) {
+	store := newBaselineStore(t)
+	if _, err := store.Update("example.com/get_weather", baselineSchema("string"), "sha256:aaaa", true); err != nil {
+		t.Fatal(err)
+	}
+
+	comparison, err := store.Compare("example.com/get_weather", baselineSchema("integer"), "sha256:bbbb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !comparison.ContentChanged || !comparison.KeyChanged {
+		t.Fatalf("expected both the key and the content to change, got %+v", comparison)
+	}
+	if comparison.BaselineKeyFingerprint != "sha256:aaaa" || comparison.KeyFingerprint != "sha256:bbbb" {
+		t.Errorf("unexpected fingerprints %+v", comparison)
+	}
+
+	// Updating accepts the new snapshot
+	if _, err := store.Update("example.com/get_weather", baselineSchema("integer"), "sha256:bbbb", true); err != nil {
+		t.Fatal(err)
+	}
+	comparison, err = store.Compare("example.com/get_weather", baselineSchema("integer"), "sha256:bbbb")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if comparison.ContentChanged || comparison.KeyChanged {
+		t.Errorf("expected no change after updating, got %+v", comparison)
+	}
+}
+
+func TestBaselineStoreFiles(t *testing.T) {
+	store := newBaselineStore(t)
+	if _, err := store.Update("../escape/tool", baselineSchema("string"), "", false); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(store.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "..%2Fescape%2Ftool.json" {
+		t.Errorf("expected one escaped baseline file and no temporary files, got %v", entries)
+	}
+	entry, err := store.Get("../escape/tool")
+	if err != nil || entry == nil || entry.ToolID != "../escape/tool" {
+		t.Errorf("expected the entry back, got %+v, %v", entry, err)
+	}
+
+	if _, err := store.Update("", baselineSchema("string"), "", false); err == nil {
+		t.Error("expected an empty tool ID to be rejected")
+	}
+	if err := os.WriteFile(filepath.Join(store.dir, "broken.json"), []byte("{"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get("broken"); err == nil {
+		t.Error("expected a malformed baseline to be an error")
+	}
+}
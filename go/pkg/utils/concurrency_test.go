@@ -0,0 +1,203 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/interactive"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/pinning"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+)
+
+// concurrencyDomain is a discovery server with the key its schemas are
+// signed with.
+type concurrencyDomain struct {
+	url       string
+	publicKey string
+	signature string
+}
+
+// serializedHandler accepts every prompt and records whether two prompts
+// were ever shown at the same time.
+type serializedHandler struct {
+	prompts    atomic.Int64
+	inFlight   atomic.Int64
+	overlapped atomic.Bool
+}
+
+func (h *serializedHandler) handler() interactive.InteractiveHandler {
+	return interactive.NewCallbackInteractiveHandler(func(*interactive.PromptContext) (interactive.UserDecision, error) {
+		if h.inFlight.Add(1) > 1 {
+			h.overlapped.Store(true)
+		}
+		defer h.inFlight.Add(-1)
+		h.prompts.Add(1)
+		return interactive.UserDecisionAccept, nil
+	}, nil, nil)
+}
+
+// Run with -race: 100 verifications share one workflow, across domains,
+// pinned and unpinned tools, per-call offline mode and interactive
+// handlers.
+func TestSchemaVerificationWorkflow_ConcurrentVerifications(t *testing.T) {
+	schema := map[string]interface{}{"type": "object"}
+	domains := make([]concurrencyDomain, 4)
+	for i := range domains {
+		privateKeyPEM, publicKeyPEM, err := GenerateKeyPair()
+		if err != nil {
+			t.Fatalf("Failed to generate key pair: %v", err)
+		}
+		server, _ := newCountingDiscoveryServer(t, discovery.WellKnownResponse{
+			SchemaVersion: "1.2",
+			DeveloperName: fmt.Sprintf("Developer %d", i),
+			PublicKeyPEM:  publicKeyPEM,
+		}, 0)
+		signer, _ := NewSchemaSigningWorkflow(privateKeyPEM)
+		signature, err := signer.SignSchema(schema)
+		if err != nil {
+			t.Fatalf("Failed to sign schema: %v", err)
+		}
+		domains[i] = concurrencyDomain{url: server.URL, publicKey: publicKeyPEM, signature: signature}
+	}
+
+	workflow, err := NewSchemaVerificationWorkflow(filepath.Join(t.TempDir(), "concurrent.db"))
+	if err != nil {
+		t.Fatalf("Failed to create verification workflow: %v", err)
+	}
+	defer workflow.Close()
+
+	// Tools pinned-0..3 are pinned up front; the unpinned ones are first
+	// used by several calls at once
+	for i, d := range domains {
+		if err := workflow.pinning.PinKey(fmt.Sprintf("pinned-%d", i), d.publicKey, d.url, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	prompts := &serializedHandler{}
+	offline := true
+	var wg sync.WaitGroup
+	errs := make(chan error, 100)
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			d := domains[i%len(domains)]
+			req := VerifyRequest{Schema: schema, Signature: d.signature, Domain: d.url}
+			switch i % 5 {
+			case 0, 1:
+				req.ToolID = fmt.Sprintf("pinned-%d", i%len(domains))
+				if i%5 == 1 {
+					req.Offline = &offline
+				}
+			case 2, 3:
+				req.ToolID = fmt.Sprintf("auto-%d", i%len(domains))
+				req.AutoPin = true
+			case 4:
+				req.ToolID = fmt.Sprintf("prompted-%d", i)
+				req.Handler = prompts.handler()
+			}
+			result, err := workflow.VerifySchemaWithOptions(context.Background(), req)
+			switch {
+			case err != nil:
+				errs <- fmt.Errorf("%s: %w", req.ToolID, err)
+			case !result.Valid:
+				errs <- fmt.Errorf("%s: %s: %s", req.ToolID, result.ErrorCode, result.Error)
+			case !result.Pinned:
+				errs <- fmt.Errorf("%s: expected the key to end up pinned", req.ToolID)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if n := prompts.prompts.Load(); n != 20 {
+		t.Errorf("Expected 20 prompts, got %d", n)
+	}
+	if prompts.overlapped.Load() {
+		t.Error("Expected prompts to be shown one at a time")
+	}
+	for i, d := range domains {
+		info, err := workflow.GetPinnedKeyInfo(fmt.Sprintf("auto-%d", i))
+		if err != nil || info == nil || info.PublicKeyPEM != d.publicKey {
+			t.Errorf("auto-%d: expected the domain's key to be pinned, got %+v, %v", i, info, err)
+		}
+	}
+}
+
+func TestSchemaVerificationWorkflow_VerifySchemaWithOptions(t *testing.T) {
+	privateKeyPEM, publicKeyPEM, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	server, requests := newCountingDiscoveryServer(t, discovery.WellKnownResponse{
+		SchemaVersion: "1.2",
+		PublicKeyPEM:  publicKeyPEM,
+	}, 0)
+	signer, _ := NewSchemaSigningWorkflow(privateKeyPEM)
+	schema := map[string]interface{}{"type": "object"}
+	signature, _ := signer.SignSchema(schema)
+
+	rejecting := interactive.NewCallbackInteractiveHandler(func(*interactive.PromptContext) (interactive.UserDecision, error) {
+		return interactive.UserDecisionReject, nil
+	}, nil, nil)
+	workflow, err := NewSchemaVerificationWorkflow(filepath.Join(t.TempDir(), "options.db"), WithInteractiveHandler(rejecting))
+	if err != nil {
+		t.Fatalf("Failed to create verification workflow: %v", err)
+	}
+	defer workflow.Close()
+	ctx := context.Background()
+	req := VerifyRequest{Schema: schema, Signature: signature, ToolID: "tool", Domain: server.URL, AutoPin: true}
+
+	// The workflow's handler takes precedence over AutoPin
+	result, err := workflow.VerifySchemaWithOptions(ctx, req)
+	if err != nil || result.Valid || !errors.Is(result.Err(), schemaerr.ErrKeyRejected) {
+		t.Fatalf("Expected the workflow handler to reject the key, got %+v, %v", result, err)
+	}
+	if workflow.pinning.IsKeyPinned("tool") {
+		t.Error("Expected a rejected key not to be pinned")
+	}
+
+	// Offline mode for one call only
+	offline := true
+	requests.Store(0)
+	req.Offline = &offline
+	result, _ = workflow.VerifySchemaWithOptions(ctx, req)
+	if result.Valid || result.ErrorCode != ErrKeyNotFound || requests.Load() != 0 {
+		t.Errorf("Expected an offline failure without discovery, got %+v after %d requests", result, requests.Load())
+	}
+
+	// A per-call handler replaces the workflow's, but the key rejected
+	// above fails without a prompt until it is reconsidered
+	var prompts int
+	req.Offline = nil
+	req.Handler = interactive.NewCallbackInteractiveHandler(func(*interactive.PromptContext) (interactive.UserDecision, error) {
+		prompts++
+		return interactive.UserDecisionAccept, nil
+	}, nil, nil)
+	result, err = workflow.VerifySchemaWithOptions(ctx, req)
+	if err != nil || result.Valid || result.ErrorCode != ErrKeyPreviouslyRejected || prompts != 0 {
+		t.Fatalf("Expected the rejected key to fail without a prompt, got %+v, %v after %d prompts", result, err, prompts)
+	}
+	req.Reconsider = true
+	result, err = workflow.VerifySchemaWithOptions(ctx, req)
+	if err != nil || !result.Valid || !result.Pinned || prompts != 1 {
+		t.Fatalf("Expected the per-call handler to accept the key, got %+v, %v", result, err)
+	}
+	if rejections, _ := workflow.ListRejectedKeys(); len(rejections) != 0 {
+		t.Errorf("Expected reconsidering to clear the rejection, got %+v", rejections)
+	}
+	info, _ := workflow.GetPinnedKeyInfo("tool")
+	if info == nil || info.Provenance != pinning.ProvenanceInteractive {
+		t.Errorf("Expected an interactive pin, got %+v", info)
+	}
+}
@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"fmt"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/revocation"
+)
+
+// WithDryRun runs verification in report-only mode. Discovery, revocation,
+// pin lookups and signature checks run as usual, so results are accurate,
+// but verification writes nothing to the pinning database: keys are not
+// pinned, verification statistics and discovery versions are not
+// recorded, rejections are not cleared and revocation documents are not
+// cached.
+// Interactive handlers are never called. Each suppressed action is
+// described in VerificationResult.WouldHave instead, and the workflow's
+// logs carry a dry_run attribute. A key that would have been pinned or
+// prompted for is reported as a first use that is not Pinned.
+//
+// When the workflow opens its own pinning database, it is opened with
+// pinning.WithDryRun.
+func WithDryRun(dryRun bool) WorkflowOption {
+	return func(s *SchemaVerificationWorkflow) {
+		s.dryRun = dryRun
+	}
+}
+
+// wouldHave notes an action suppressed in dry run.
+func (r *VerificationResult) wouldHave(format string, args ...interface{}) {
+	r.WouldHave = append(r.WouldHave, fmt.Sprintf(format, args...))
+}
+
+// readOnlyRevocationCache reads revocation documents from a persistent
+// cache but keeps updates in memory, so dry runs still use and refresh
+// cached revocations without writing them.
+type readOnlyRevocationCache struct {
+	persistent revocation.Cache
+	updates    revocation.Cache
+}
+
+func newReadOnlyRevocationCache(persistent revocation.Cache) *readOnlyRevocationCache {
+	return &readOnlyRevocationCache{persistent: persistent, updates: revocation.NewMemoryCache()}
+}
+
+func (c *readOnlyRevocationCache) LoadRevocationDocument(url string) (*revocation.RevocationDocument, error) {
+	if doc, err := c.updates.LoadRevocationDocument(url); doc != nil || err != nil {
+		return doc, err
+	}
+	return c.persistent.LoadRevocationDocument(url)
+}
+
+func (c *readOnlyRevocationCache) StoreRevocationDocument(url string, doc *revocation.RevocationDocument) error {
+	return c.updates.StoreRevocationDocument(url, doc)
+}
@@ -0,0 +1,128 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.etcd.io/bbolt"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/interactive"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/pinning"
+)
+
+// dumpPinningDB returns every row of the pinning database at path, keyed
+// by bucket and row.
+func dumpPinningDB(t *testing.T, path string) map[string]string {
+	t.Helper()
+	db, err := bbolt.Open(path, 0600, &bbolt.Options{ReadOnly: true})
+	if err != nil {
+		t.Fatalf("Failed to open pinning database: %v", err)
+	}
+	defer db.Close()
+	rows := map[string]string{}
+	err = db.View(func(tx *bbolt.Tx) error {
+		return tx.ForEach(func(name []byte, b *bbolt.Bucket) error {
+			return b.ForEach(func(key, value []byte) error {
+				rows[string(name)+"/"+string(key)] = string(value)
+				return nil
+			})
+		})
+	})
+	if err != nil {
+		t.Fatalf("Failed to dump pinning database: %v", err)
+	}
+	return rows
+}
+
+func TestVerifySchemaDryRun(t *testing.T) {
+	f := newOfflineFixture(t)
+	_, otherKeyPEM, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	wellKnown := func(revokedKeys []string) *httptest.Server {
+		var server *httptest.Server
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_ = json.NewEncoder(w).Encode(CreateWellKnownResponse(f.publicKeyPEM, "Offline Corp", "", revokedKeys, "1.2", ""))
+		}))
+		t.Cleanup(server.Close)
+		return server
+	}
+	server := wellKnown(nil)
+	revokedServer := wellKnown([]string{f.fingerprint})
+
+	dbPath := filepath.Join(t.TempDir(), "dryrun.db")
+	setup, err := pinning.NewKeyPinning(dbPath, pinning.PinningModeAutomatic, nil)
+	if err != nil {
+		t.Fatalf("Failed to open pinning database: %v", err)
+	}
+	if err := setup.PinKey("pinned-tool", otherKeyPEM, server.URL, "Offline Corp"); err != nil {
+		t.Fatalf("Failed to pin key: %v", err)
+	}
+	setup.Close()
+	before := dumpPinningDB(t, dbPath)
+
+	var prompts int
+	handler := interactive.NewCallbackInteractiveHandler(func(*interactive.PromptContext) (interactive.UserDecision, error) {
+		prompts++
+		return interactive.UserDecisionAccept, nil
+	}, nil, nil)
+
+	tests := []struct {
+		name          string
+		toolID        string
+		domain        string
+		autoPin       bool
+		handler       interactive.InteractiveHandler
+		wantValid     bool
+		wantPinned    bool
+		wantErrorCode string
+		wantWouldHave string
+	}{
+		{"first use auto pin", "new-tool", server.URL, true, nil, true, false, "", "would pin key " + f.fingerprint + " for tool new-tool"},
+		{"first use prompt", "new-tool", server.URL, false, handler, true, false, "", "would prompt user: first_time_key for tool new-tool"},
+		{"key change", "pinned-tool", server.URL, true, handler, false, true, ErrSignatureInvalid, "would record a failed verification of tool pinned-tool"},
+		{"revoked key", "new-tool", revokedServer.URL, true, handler, false, false, ErrKeyRevoked, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			workflow, err := NewSchemaVerificationWorkflow(dbPath, WithDryRun(true),
+				WithLogger(slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))))
+			if err != nil {
+				t.Fatalf("Failed to create verification workflow: %v", err)
+			}
+			result, err := workflow.VerifySchemaWithOptions(context.Background(), VerifyRequest{
+				Schema: f.schema, Signature: f.signature, ToolID: tt.toolID, Domain: tt.domain, AutoPin: tt.autoPin, Handler: tt.handler,
+			})
+			workflow.Close()
+			if err != nil {
+				t.Fatalf("VerifySchema failed: %v", err)
+			}
+
+			if result.Valid != tt.wantValid || result.ErrorCode != tt.wantErrorCode || result.Pinned != tt.wantPinned {
+				t.Errorf("Expected valid=%v pinned=%v code=%q, got %+v", tt.wantValid, tt.wantPinned, tt.wantErrorCode, result)
+			}
+			if tt.wantWouldHave != "" && !strings.Contains(strings.Join(result.WouldHave, "\n"), tt.wantWouldHave) {
+				t.Errorf("Expected would have %q, got %q", tt.wantWouldHave, result.WouldHave)
+			}
+			if prompts != 0 {
+				t.Errorf("Expected no prompts, got %d", prompts)
+			}
+			if !strings.Contains(logs.String(), `"dry_run":true`) {
+				t.Errorf("Expected dry_run in every log record, got %s", logs.String())
+			}
+			if after := dumpPinningDB(t, dbPath); !reflect.DeepEqual(after, before) {
+				t.Errorf("Expected no database changes, got\n%v\nwant\n%v", after, before)
+			}
+		})
+	}
+}
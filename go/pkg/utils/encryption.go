@@ -0,0 +1,10 @@
+package utils
+
+// WithPinStoreEncryption opens the workflow's own pinning database with
+// pinning.WithStoreEncryption(key), for a database whose pins are
+// encrypted at rest. A workflow given a KeyPinning uses it as opened.
+func WithPinStoreEncryption(key []byte) WorkflowOption {
+	return func(s *SchemaVerificationWorkflow) {
+		s.storeKey = key
+	}
+}
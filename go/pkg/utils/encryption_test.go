@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/pinning"
+)
+
+func TestWorkflowPinStoreEncryption(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "pins.db")
+	key := bytes.Repeat([]byte{1}, pinning.StoreKeySize)
+
+	workflow, err := NewSchemaVerificationWorkflow(dbPath, WithPinStoreEncryption(key))
+	if err != nil {
+		t.Fatalf("Failed to create workflow: %v", err)
+	}
+	if !workflow.pinning.Encrypted() {
+		t.Error("Expected the workflow's pinning database to be encrypted")
+	}
+	workflow.Close()
+
+	if _, err := NewSchemaVerificationWorkflow(dbPath); !errors.Is(err, pinning.ErrPinStoreEncrypted) {
+		t.Errorf("Expected opening without the key to fail with ErrPinStoreEncrypted, got %v", err)
+	}
+}
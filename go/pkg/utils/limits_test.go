@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery/discoverytest"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+)
+
+func TestVerifySchemaTooComplex(t *testing.T) {
+	ctx := context.Background()
+	stub := discoverytest.New()
+	key, err := stub.GenerateDomain("example.com", "Example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := NewSchemaSigningWorkflow(key.PrivateKeyPEM, WithSigningValidationLimits(core.Unlimited()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	deep := map[string]interface{}{"type": "string"}
+	for i := 0; i < 40; i++ {
+		deep = map[string]interface{}{"items": deep}
+	}
+	signature, err := signer.SignSchema(deep)
+	if err != nil {
+		t.Fatalf("Expected unlimited signing to accept the schema, got %v", err)
+	}
+
+	strict := core.ValidationLimits{MaxDepth: 32}
+	strictSigner, err := NewSchemaSigningWorkflow(key.PrivateKeyPEM, WithSigningValidationLimits(strict))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := strictSigner.SignSchema(deep); !errors.Is(err, schemaerr.ErrSchemaTooComplex) {
+		t.Errorf("Expected signing to refuse the schema, got %v", err)
+	}
+
+	workflow, err := NewSchemaVerificationWorkflow(filepath.Join(t.TempDir(), "pins.db"),
+		WithDiscovery(stub), WithValidationLimits(strict))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer workflow.Close()
+	result, err := workflow.VerifySchema(ctx, deep, signature, "deep", "example.com", true)
+	if err != nil {
+		t.Fatalf("VerifySchema failed: %v", err)
+	}
+	if result.Valid || result.ErrorCode != ErrSchemaTooComplex || !errors.Is(result.Err(), schemaerr.ErrSchemaTooComplex) {
+		t.Fatalf("Expected %s, got %+v", ErrSchemaTooComplex, result)
+	}
+	if result.Pinned {
+		t.Errorf("Expected no key pinned for a refused schema")
+	}
+
+	// The same schema verifies under the default limits
+	lenient, err := NewSchemaVerificationWorkflow(filepath.Join(t.TempDir(), "pins.db"), WithDiscovery(stub))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lenient.Close()
+	if result, err := lenient.VerifySchema(ctx, deep, signature, "deep", "example.com", true); err != nil || !result.Valid {
+		t.Fatalf("Expected the schema to verify under the default limits, got %+v, %v", result, err)
+	}
+}
@@ -0,0 +1,227 @@
+package utils
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+)
+
+// SigningManifestVersion is the manifest_version written by
+// SigningSession.Finalize.
+const SigningManifestVersion = "1.0"
+
+// SigningMetadata describes the build a SigningSession signs for.
+type SigningMetadata struct {
+	Builder string
+	BuildID string
+	// Timestamp defaults to the time the session is created.
+	Timestamp time.Time
+}
+
+// SigningManifestEntry records one schema signed in a session.
+type SigningManifestEntry struct {
+	Name string `json:"name"`
+	// SchemaHash is the canonical schema hash in sha256:<hex> form.
+	SchemaHash string `json:"schema_hash"`
+	Signature  string `json:"signature"`
+}
+
+// SigningManifest lists every schema signed in a session. Signature covers
+// the canonical form of the rest of the manifest and is made with the same
+// key as the entries, so the manifest can be published next to the schemas
+// as a single attestation of the build.
+type SigningManifest struct {
+	ManifestVersion string                 `json:"manifest_version"`
+	KeyFingerprint  string                 `json:"key_fingerprint"`
+	Builder         string                 `json:"builder,omitempty"`
+	BuildID         string                 `json:"build_id,omitempty"`
+	Timestamp       string                 `json:"timestamp"`
+	Entries         []SigningManifestEntry `json:"entries"`
+	Signature       string                 `json:"signature,omitempty"`
+}
+
+// SigningSession signs a batch of schemas with a SchemaSigningWorkflow and
+// records each one for the signing manifest. It is safe for concurrent use.
+type SigningSession struct {
+	workflow *SchemaSigningWorkflow
+	metadata SigningMetadata
+
+	mu        sync.Mutex
+	entries   []SigningManifestEntry
+	names     map[string]bool
+	finalized bool
+}
+
+// NewSigningSession starts a signing session for workflow's key.
+func NewSigningSession(workflow *SchemaSigningWorkflow, metadata SigningMetadata) *SigningSession {
+	if metadata.Timestamp.IsZero() {
+		metadata.Timestamp = clock.Real.Now()
+	}
+	return &SigningSession{
+		workflow: workflow,
+		metadata: metadata,
+		names:    make(map[string]bool),
+	}
+}
+
+// SignSchema signs schema like SchemaSigningWorkflow.SignSchema and records
+// it in the manifest under name, which must be unique within the session.
+func (s *SigningSession) SignSchema(name string, schema map[string]interface{}) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.finalized {
+		return "", fmt.Errorf("signing session is already finalized")
+	}
+	if name == "" {
+		return "", fmt.Errorf("schema name cannot be empty")
+	}
+	if s.names[name] {
+		return "", fmt.Errorf("schema %s is already in the signing session", name)
+	}
+
+	schemaHash, signature, err := s.workflow.signSchema(schema, "")
+	if err != nil {
+		return "", err
+	}
+	s.names[name] = true
+	s.entries = append(s.entries, SigningManifestEntry{
+		Name:       name,
+		SchemaHash: core.FormatSchemaHash(schemaHash),
+		Signature:  signature,
+	})
+	return signature, nil
+}
+
+// Entries returns the schemas signed so far, in signing order.
+func (s *SigningSession) Entries() []SigningManifestEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]SigningManifestEntry(nil), s.entries...)
+}
+
+// Finalize ends the session and returns the signed manifest as indented
+// JSON. No schemas can be signed afterwards.
+func (s *SigningSession) Finalize() ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.finalized {
+		return nil, fmt.Errorf("signing session is already finalized")
+	}
+
+	fingerprint, err := s.workflow.keyManager.CalculateKeyFingerprint(&s.workflow.privateKey.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate key fingerprint: %w", err)
+	}
+	manifest := &SigningManifest{
+		ManifestVersion: SigningManifestVersion,
+		KeyFingerprint:  fingerprint,
+		Builder:         s.metadata.Builder,
+		BuildID:         s.metadata.BuildID,
+		Timestamp:       clock.Format(s.metadata.Timestamp),
+		Entries:         append([]SigningManifestEntry{}, s.entries...),
+	}
+	if err := s.workflow.signManifest(manifest); err != nil {
+		return nil, err
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal signing manifest: %w", err)
+	}
+	s.finalized = true
+	return data, nil
+}
+
+// signManifest sets manifest.Signature over the canonical form of the rest
+// of the manifest.
+func (s *SchemaSigningWorkflow) signManifest(manifest *SigningManifest) error {
+	manifest.Signature = ""
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return fmt.Errorf("failed to marshal signing manifest: %w", err)
+	}
+	manifestHash, err := documentBodyHash(data, "signing manifest")
+	if err != nil {
+		return err
+	}
+	signature, err := s.signatureManager.SignSchemaHash(manifestHash, s.privateKey)
+	if err != nil {
+		return fmt.Errorf("failed to sign manifest: %w", err)
+	}
+	manifest.Signature = signature
+	return nil
+}
+
+// documentBodyHash canonicalizes a signed JSON document, such as a signing
+// manifest or tool index, without its signature field and hashes it. what
+// names the document in errors.
+func documentBodyHash(data []byte, what string) ([]byte, error) {
+	var body map[string]interface{}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", what, err)
+	}
+	delete(body, "signature")
+	return CalculateSchemaHash(body)
+}
+
+// VerifySigningManifest checks that manifest was signed by publicKeyPEM and
+// that every entry's signature verifies against its schema hash. It returns
+// the parsed manifest. Callers comparing published schemas against the
+// manifest should also check each schema's hash against its entry.
+func VerifySigningManifest(manifest []byte, publicKeyPEM string) (*SigningManifest, error) {
+	var parsed SigningManifest
+	if err := json.Unmarshal(manifest, &parsed); err != nil {
+		return nil, fmt.Errorf("invalid signing manifest: %w", err)
+	}
+	if parsed.Signature == "" {
+		return nil, fmt.Errorf("signing manifest is not signed")
+	}
+
+	manifestHash, err := documentBodyHash(manifest, "signing manifest")
+	if err != nil {
+		return nil, err
+	}
+	valid, err := VerifySignatureOnly(manifestHash, parsed.Signature, publicKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+	if !valid {
+		return nil, fmt.Errorf("signing manifest signature is invalid")
+	}
+
+	fingerprint, err := crypto.NewKeyManager().CalculateKeyFingerprintFromPEM(publicKeyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate key fingerprint: %w", err)
+	}
+	if !crypto.FingerprintEqual(parsed.KeyFingerprint, fingerprint) {
+		return nil, fmt.Errorf("signing manifest names key %s, expected %s", parsed.KeyFingerprint, fingerprint)
+	}
+
+	for _, entry := range parsed.Entries {
+		hexHash, ok := strings.CutPrefix(entry.SchemaHash, "sha256:")
+		if !ok {
+			return nil, fmt.Errorf("manifest entry %s has an invalid schema hash %q", entry.Name, entry.SchemaHash)
+		}
+		schemaHash, err := hex.DecodeString(hexHash)
+		if err != nil {
+			return nil, fmt.Errorf("manifest entry %s has an invalid schema hash %q", entry.Name, entry.SchemaHash)
+		}
+		valid, err := VerifySignatureOnly(schemaHash, entry.Signature, publicKeyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("manifest entry %s: %w", entry.Name, err)
+		}
+		if !valid {
+			return nil, fmt.Errorf("manifest entry %s signature is invalid", entry.Name)
+		}
+	}
+	return &parsed, nil
+}
@@ -0,0 +1,146 @@
+package utils
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestSigningSession(t *testing.T) (*SigningSession, string) {
+	t.Helper()
+	privateKeyPEM, publicKeyPEM, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	workflow, err := NewSchemaSigningWorkflow(privateKeyPEM)
+	if err != nil {
+		t.Fatalf("Failed to create signing workflow: %v", err)
+	}
+	session := NewSigningSession(workflow, SigningMetadata{
+		Builder:   "ci.example.com",
+		BuildID:   "build-42",
+		Timestamp: time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC),
+	})
+
+	for _, name := range []string{"search.json", "fetch.json"} {
+		schema := map[string]interface{}{"type": "object", "description": name}
+		signature, err := session.SignSchema(name, schema)
+		if err != nil {
+			t.Fatalf("SignSchema(%s) failed: %v", name, err)
+		}
+		schemaHash, err := CalculateSchemaHash(schema)
+		if err != nil {
+			t.Fatalf("Failed to hash schema: %v", err)
+		}
+		if valid, _ := VerifySignatureOnly(schemaHash, signature, publicKeyPEM); !valid {
+			t.Fatalf("Expected session signature for %s to verify", name)
+		}
+	}
+	return session, publicKeyPEM
+}
+
+func TestSigningManifestRoundTrip(t *testing.T) {
+	session, publicKeyPEM := newTestSigningSession(t)
+
+	if _, err := session.SignSchema("search.json", map[string]interface{}{"type": "object"}); err == nil {
+		t.Error("Expected a duplicate schema name to be rejected")
+	}
+
+	data, err := session.Finalize()
+	if err != nil {
+		t.Fatalf("Finalize failed: %v", err)
+	}
+	if _, err := session.SignSchema("late.json", map[string]interface{}{"type": "object"}); err == nil {
+		t.Error("Expected signing after Finalize to fail")
+	}
+
+	manifest, err := VerifySigningManifest(data, publicKeyPEM)
+	if err != nil {
+		t.Fatalf("VerifySigningManifest failed: %v", err)
+	}
+	if manifest.Builder != "ci.example.com" || manifest.BuildID != "build-42" || manifest.Timestamp != "2026-01-01T12:00:00Z" {
+		t.Errorf("Unexpected build metadata: %+v", manifest)
+	}
+	if len(manifest.Entries) != 2 || manifest.Entries[0].Name != "search.json" || manifest.Entries[1].Name != "fetch.json" {
+		t.Fatalf("Expected entries in signing order, got %+v", manifest.Entries)
+	}
+	if !strings.HasPrefix(manifest.Entries[0].SchemaHash, "sha256:") {
+		t.Errorf("Expected sha256: schema hash, got %s", manifest.Entries[0].SchemaHash)
+	}
+
+	_, otherPublicKeyPEM, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	if _, err := VerifySigningManifest(data, otherPublicKeyPEM); err == nil {
+		t.Error("Expected manifest to fail verification with another key")
+	}
+}
+
+func TestSigningManifestTamperedEntry(t *testing.T) {
+	session, publicKeyPEM := newTestSigningSession(t)
+	data, err := session.Finalize()
+	if err != nil {
+		t.Fatalf("Finalize failed: %v", err)
+	}
+
+	var manifest SigningManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatalf("Failed to parse manifest: %v", err)
+	}
+	// Swap the entries' signatures
+	manifest.Entries[0].Signature, manifest.Entries[1].Signature = manifest.Entries[1].Signature, manifest.Entries[0].Signature
+
+	t.Run("unsigned", func(t *testing.T) {
+		tampered, _ := json.Marshal(manifest)
+		if _, err := VerifySigningManifest(tampered, publicKeyPEM); err == nil {
+			t.Error("Expected a tampered entry to break the manifest signature")
+		}
+	})
+
+	t.Run("re-signed", func(t *testing.T) {
+		// Even with a valid manifest signature each entry must verify
+		if err := session.workflow.signManifest(&manifest); err != nil {
+			t.Fatalf("signManifest failed: %v", err)
+		}
+		tampered, _ := json.Marshal(manifest)
+		_, err := VerifySigningManifest(tampered, publicKeyPEM)
+		if err == nil || !strings.Contains(err.Error(), "search.json") {
+			t.Errorf("Expected entry search.json to fail verification, got %v", err)
+		}
+	})
+}
+
+func TestSigningManifestTamperedBody(t *testing.T) {
+	session, publicKeyPEM := newTestSigningSession(t)
+	data, err := session.Finalize()
+	if err != nil {
+		t.Fatalf("Finalize failed: %v", err)
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(data, &body); err != nil {
+		t.Fatalf("Failed to parse manifest: %v", err)
+	}
+
+	tests := map[string]func(map[string]interface{}){
+		"changed build id":  func(m map[string]interface{}) { m["build_id"] = "build-43" },
+		"added field":       func(m map[string]interface{}) { m["note"] = "unsigned" },
+		"dropped entry":     func(m map[string]interface{}) { m["entries"] = m["entries"].([]interface{})[:1] },
+		"removed signature": func(m map[string]interface{}) { delete(m, "signature") },
+	}
+	for name, tamper := range tests {
+		t.Run(name, func(t *testing.T) {
+			copied := make(map[string]interface{}, len(body))
+			for k, v := range body {
+				copied[k] = v
+			}
+			tamper(copied)
+			tampered, _ := json.Marshal(copied)
+			if _, err := VerifySigningManifest(tampered, publicKeyPEM); err == nil {
+				t.Error("Expected tampered manifest to fail verification")
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+package utils
+
+import (
+	"fmt"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+// WithRequiredSignatures requires valid signatures from at least n distinct
+// signers, as verification.RequireSignatures does. The signatures are
+// taken from VerifyRequest.Signatures, or the single signature as a
+// one-element array, and checked with verification.VerifySignatureThreshold
+// against the tool's pinned or discovered key and the keys of
+// WithSignerKeys. An unmet threshold fails with
+// ErrSignatureThresholdNotMet.
+func WithRequiredSignatures(n int) WorkflowOption {
+	return func(s *SchemaVerificationWorkflow) {
+		s.requiredSignatures = n
+	}
+}
+
+// WithRequiredSigners requires a valid signature from each of kids, as
+// verification.RequireSigners does, in addition to the
+// WithRequiredSignatures threshold.
+func WithRequiredSigners(kids []string) WorkflowOption {
+	return func(s *SchemaVerificationWorkflow) {
+		s.requiredSigners = append(s.requiredSigners, kids...)
+	}
+}
+
+// WithSignerKeys adds keys whose signatures count towards the
+// WithRequiredSignatures threshold alongside the tool's pinned or
+// discovered key, e.g. those of the release engineers who co-sign a tool.
+// Discovery documents publish one key per tool, so without it only that
+// key's signatures count. The tool's key must still have signed, so that
+// co-signers alone cannot stand in for the key the tool is pinned to.
+func WithSignerKeys(keys verification.SignerKeySet) WorkflowOption {
+	return func(s *SchemaVerificationWorkflow) {
+		s.signerKeys = keys
+	}
+}
+
+// multiSignature reports whether req is verified as a multi-signature
+// schema: it carries signatures, or the workflow requires a threshold or
+// signers.
+func (s *SchemaVerificationWorkflow) multiSignature(req VerifyRequest) bool {
+	return len(req.Signatures) > 0 || s.requiredSignatures > 0 || len(s.requiredSigners) > 0
+}
+
+// verifySignatures verifies the signatures of req over schemaHash with
+// VerifySignatureThreshold, against publicKeyPEM, the tool's key, and the
+// keys of WithSignerKeys. It records the signers, failed entries and
+// missing signers in the result's metadata under "signers",
+// "signature_failures" and "missing_signers", and fails result if the
+// threshold is not met.
+func (s *SchemaVerificationWorkflow) verifySignatures(result *VerificationResult, req VerifyRequest, schemaHash []byte, publicKeyPEM string) {
+	toolKid, err := s.keyManager.CalculateKeyFingerprintFromPEM(publicKeyPEM)
+	if err != nil {
+		result.fail(schemaerr.ErrKeyNotFound, fmt.Sprintf("failed to calculate key fingerprint: %v", err), err)
+		return
+	}
+	keys := make(verification.SignerKeySet, len(s.signerKeys)+1)
+	for kid, signerKeyPEM := range s.signerKeys {
+		keys[crypto.NormalizeFingerprint(kid)] = signerKeyPEM
+	}
+	keys[toolKid] = publicKeyPEM
+	opts := []verification.ThresholdOption{
+		verification.RequireSignatures(s.requiredSignatures),
+		verification.RequireSigners(s.requiredSigners),
+	}
+	if len(s.signerKeys) > 0 {
+		opts = append(opts, verification.RequireSigners([]string{toolKid}))
+	}
+
+	entries := verification.SignatureEntries(req.Signature, req.Signatures)
+	threshold := verification.VerifySignatureThreshold(schemaHash, entries, keys, opts...)
+	result.Metadata["signers"] = threshold.Signers
+	if len(threshold.Failures) > 0 {
+		result.Metadata["signature_failures"] = threshold.Failures
+	}
+	if len(threshold.MissingSigners) > 0 {
+		result.Metadata["missing_signers"] = threshold.MissingSigners
+	}
+	result.Valid = threshold.Valid
+	switch threshold.ErrorCode {
+	case "":
+	case verification.ErrSignatureThresholdNotMet:
+		result.fail(schemaerr.ErrSignatureThresholdNotMet, threshold.ErrorMessage, nil)
+	default:
+		result.ErrorCode = ErrSignatureInvalid
+		result.Cause = &schemaerr.Error{Kind: schemaerr.ErrSignatureInvalid}
+	}
+}
@@ -0,0 +1,158 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery/discoverytest"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+// multisigSigners generates three keys, signs schema with each and returns
+// their public key PEMs and signatures entries. The first key is the
+// tool's.
+func multisigSigners(t *testing.T, schema map[string]interface{}) ([]string, []verification.SignatureEntry) {
+	t.Helper()
+	keyManager := crypto.NewKeyManager()
+	var publicKeyPEMs []string
+	var entries []verification.SignatureEntry
+	for i := 0; i < 3; i++ {
+		privateKey, err := keyManager.GenerateKeypair()
+		if err != nil {
+			t.Fatal(err)
+		}
+		publicKeyPEM, _ := keyManager.ExportPublicKeyPEM(&privateKey.PublicKey)
+		privateKeyPEM, _ := keyManager.ExportPrivateKeyPEM(privateKey)
+		signer, err := NewSchemaSigningWorkflow(privateKeyPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature, err := signer.SignSchema(schema)
+		if err != nil {
+			t.Fatal(err)
+		}
+		kid, err := keyManager.CalculateKeyFingerprintFromPEM(publicKeyPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		publicKeyPEMs = append(publicKeyPEMs, publicKeyPEM)
+		entries = append(entries, verification.SignatureEntry{SignerKid: kid, Signature: signature})
+	}
+	return publicKeyPEMs, entries
+}
+
+func TestVerifySchemaSignatureThreshold(t *testing.T) {
+	schema := map[string]interface{}{"type": "object", "name": "release"}
+	publicKeyPEMs, entries := multisigSigners(t, schema)
+	coSigners, err := verification.NewSignerKeySet(publicKeyPEMs[1:]...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kids := func(entries ...verification.SignatureEntry) []string {
+		var kids []string
+		for _, entry := range entries {
+			kids = append(kids, entry.SignerKid)
+		}
+		return kids
+	}
+
+	tests := []struct {
+		name        string
+		opts        []WorkflowOption
+		signature   string
+		signatures  []verification.SignatureEntry
+		wantCode    string
+		wantSigners []string
+		wantMissing []string
+	}{
+		{name: "2 of 3", opts: []WorkflowOption{WithRequiredSignatures(2), WithSignerKeys(coSigners)},
+			signatures: entries[:2], wantSigners: kids(entries[:2]...)},
+		{name: "3 of 3 with a required signer", opts: []WorkflowOption{WithRequiredSignatures(2), WithSignerKeys(coSigners), WithRequiredSigners([]string{strings.ToUpper(entries[2].SignerKid)})},
+			signatures: entries, wantSigners: kids(entries...)},
+		{name: "threshold not met", opts: []WorkflowOption{WithRequiredSignatures(2), WithSignerKeys(coSigners)},
+			signatures: entries[:1], wantCode: ErrSignatureThresholdNotMet, wantSigners: kids(entries[0])},
+		{name: "required signer missing", opts: []WorkflowOption{WithSignerKeys(coSigners), WithRequiredSigners(kids(entries[2]))},
+			signatures: entries[:2], wantCode: ErrSignatureThresholdNotMet, wantSigners: kids(entries[:2]...), wantMissing: kids(entries[2])},
+		{name: "co-signers without the tool key", opts: []WorkflowOption{WithRequiredSignatures(2), WithSignerKeys(coSigners)},
+			signatures: entries[1:], wantCode: ErrSignatureThresholdNotMet, wantSigners: kids(entries[1:]...), wantMissing: kids(entries[0])},
+		{name: "only the published key counts", opts: []WorkflowOption{WithRequiredSignatures(2)},
+			signatures: entries, wantCode: ErrSignatureThresholdNotMet, wantSigners: kids(entries[0])},
+		{name: "signatures array only", signatures: entries[:1], wantSigners: kids(entries[0])},
+		{name: "signatures array by another key", signatures: entries[1:2], wantCode: ErrSignatureInvalid, wantSigners: []string{}},
+		{name: "single signature under a threshold", opts: []WorkflowOption{WithRequiredSignatures(1), WithSignerKeys(coSigners)},
+			signature: entries[0].Signature, wantSigners: kids(entries[0])},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := discoverytest.New()
+			stub.SetDomain("example.com", &discovery.WellKnownResponse{SchemaVersion: "1.2", DeveloperName: "Release", PublicKeyPEM: publicKeyPEMs[0]})
+			workflow, err := NewSchemaVerificationWorkflow(filepath.Join(t.TempDir(), "pins.db"), append([]WorkflowOption{WithDiscovery(stub)}, tt.opts...)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer workflow.Close()
+
+			result, err := workflow.VerifySchemaWithOptions(context.Background(), VerifyRequest{
+				Schema: schema, Signature: tt.signature, Signatures: tt.signatures, ToolID: "release", Domain: "example.com", AutoPin: true,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantCode != "" {
+				if result.Valid || result.ErrorCode != tt.wantCode {
+					t.Fatalf("Expected %s, got %+v", tt.wantCode, result)
+				}
+			} else if !result.Valid {
+				t.Fatalf("Expected a valid result, got %s: %s", result.ErrorCode, result.Error)
+			}
+			if signers := result.Metadata["signers"]; !reflect.DeepEqual(signers, tt.wantSigners) {
+				t.Errorf("Expected signers %v, got %v", tt.wantSigners, signers)
+			}
+			missing, _ := result.Metadata["missing_signers"].([]string)
+			if !reflect.DeepEqual(missing, tt.wantMissing) {
+				t.Errorf("Expected missing signers %v, got %v", tt.wantMissing, missing)
+			}
+		})
+	}
+}
+
+func TestVerifySchemaSignatureThresholdFailures(t *testing.T) {
+	schema := map[string]interface{}{"type": "object", "name": "release"}
+	publicKeyPEMs, entries := multisigSigners(t, schema)
+	coSigners, err := verification.NewSignerKeySet(publicKeyPEMs[1:]...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stub := discoverytest.New()
+	stub.SetDomain("example.com", &discovery.WellKnownResponse{SchemaVersion: "1.2", PublicKeyPEM: publicKeyPEMs[0]})
+	workflow, err := NewSchemaVerificationWorkflow(filepath.Join(t.TempDir(), "pins.db"),
+		WithDiscovery(stub), WithRequiredSignatures(2), WithSignerKeys(coSigners))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer workflow.Close()
+
+	// Entry 1 carries the signature of entry 2's key, so only the tool's
+	// signature counts
+	signatures := []verification.SignatureEntry{entries[0], {SignerKid: entries[1].SignerKid, Signature: entries[2].Signature}}
+	result, err := workflow.VerifySchemaWithOptions(context.Background(), VerifyRequest{
+		Schema: schema, Signatures: signatures, ToolID: "release", Domain: "example.com", AutoPin: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Valid || !errors.Is(result.Err(), schemaerr.ErrSignatureThresholdNotMet) {
+		t.Fatalf("Expected the threshold to fail, got %+v", result)
+	}
+	want := []verification.SignatureFailure{{Index: 1, SignerKid: entries[1].SignerKid, Reason: "signature verification failed"}}
+	if failures := result.Metadata["signature_failures"]; !reflect.DeepEqual(failures, want) {
+		t.Errorf("Expected failures %+v, got %+v", want, failures)
+	}
+}
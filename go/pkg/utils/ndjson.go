@@ -0,0 +1,168 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// DefaultNDJSONMaxLineBytes is the longest line ProcessNDJSON accepts when
+// NDJSONOptions.MaxLineBytes is zero.
+const DefaultNDJSONMaxLineBytes = 16 << 20
+
+// NDJSONOptions configures ProcessNDJSON.
+type NDJSONOptions struct {
+	// Concurrency is the number of lines processed at once. Defaults to 1.
+	Concurrency int
+	// MaxLineBytes bounds a single line. Longer lines are skipped and
+	// reported as errors. Defaults to DefaultNDJSONMaxLineBytes.
+	MaxLineBytes int
+}
+
+// NDJSONError is written in place of the output of a line that failed.
+type NDJSONError struct {
+	Error string `json:"error"`
+	Line  int    `json:"line"`
+}
+
+// NDJSONStats counts the lines ProcessNDJSON handled. Blank lines are not
+// counted.
+type NDJSONStats struct {
+	Lines  int `json:"lines"`
+	Failed int `json:"failed"`
+}
+
+// ProcessNDJSON reads newline-delimited JSON from r, calls process for each
+// non-blank line and writes the result as one JSON line to w, in input
+// order. A line whose process call fails is written as an NDJSONError
+// naming its 1-based line number, and the stream continues.
+//
+// Input is read incrementally: at most Concurrency lines are in flight, so
+// a slow writer holds back the reader instead of buffering the stream.
+// ProcessNDJSON returns early with an error if reading r or writing w fails
+// or ctx is done.
+func ProcessNDJSON(ctx context.Context, r io.Reader, w io.Writer, process func(line []byte) (interface{}, error), opts NDJSONOptions) (NDJSONStats, error) {
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	maxLine := opts.MaxLineBytes
+	if maxLine <= 0 {
+		maxLine = DefaultNDJSONMaxLineBytes
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type output struct {
+		data []byte
+		err  error
+	}
+	type job struct {
+		line int
+		done chan output
+	}
+
+	// Jobs are queued in input order; a slot in sem is held from reading a
+	// line until its output is written.
+	queue := make(chan *job, concurrency)
+	sem := make(chan struct{}, concurrency)
+	readErr := make(chan error, 1)
+
+	go func() {
+		defer close(queue)
+		reader := bufio.NewReader(r)
+		for lineNo := 1; ; lineNo++ {
+			data, tooLong, err := readNDJSONLine(reader, maxLine)
+			if err != nil && err != io.EOF {
+				readErr <- fmt.Errorf("failed to read line %d: %w", lineNo, err)
+				return
+			}
+			if !tooLong && len(bytes.TrimSpace(data)) == 0 {
+				if err == io.EOF {
+					return
+				}
+				continue
+			}
+
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			j := &job{line: lineNo, done: make(chan output, 1)}
+			queue <- j
+			go func(data []byte) {
+				if tooLong {
+					j.done <- output{err: fmt.Errorf("line exceeds %d bytes", maxLine)}
+					return
+				}
+				value, err := process(data)
+				if err != nil {
+					j.done <- output{err: err}
+					return
+				}
+				encoded, err := json.Marshal(value)
+				j.done <- output{data: encoded, err: err}
+			}(data)
+
+			if err == io.EOF {
+				return
+			}
+		}
+	}()
+
+	var stats NDJSONStats
+	for j := range queue {
+		var out output
+		select {
+		case out = <-j.done:
+		case <-ctx.Done():
+			return stats, ctx.Err()
+		}
+		stats.Lines++
+		if out.err != nil {
+			stats.Failed++
+			out.data, _ = json.Marshal(NDJSONError{Error: out.err.Error(), Line: j.line})
+		}
+		if _, err := w.Write(append(out.data, '\n')); err != nil {
+			return stats, fmt.Errorf("failed to write output for line %d: %w", j.line, err)
+		}
+		<-sem
+	}
+
+	select {
+	case err := <-readErr:
+		return stats, err
+	default:
+	}
+	return stats, ctx.Err()
+}
+
+// readNDJSONLine reads the next line without its line ending. A line longer
+// than max is consumed and discarded, and reported with tooLong. At the end
+// of input the final line, if any, is returned with io.EOF.
+func readNDJSONLine(reader *bufio.Reader, max int) (line []byte, tooLong bool, err error) {
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if !tooLong {
+			if len(line)+len(chunk) > max+2 {
+				tooLong, line = true, nil
+			} else {
+				line = append(line, chunk...)
+			}
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		line = bytes.TrimRight(line, "\r\n")
+		if !tooLong && len(line) > max {
+			tooLong, line = true, nil
+		}
+		return line, tooLong, err
+	}
+}
@@ -0,0 +1,211 @@
+package utils
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// lineSource generates NDJSON lazily, one line per Read call, and counts
+// the lines handed out.
+type lineSource struct {
+	total   int
+	line    func(i int) string
+	emitted atomic.Int64
+	pending []byte
+}
+
+func (s *lineSource) Read(p []byte) (int, error) {
+	if len(s.pending) == 0 {
+		i := int(s.emitted.Load())
+		if i == s.total {
+			return 0, io.EOF
+		}
+		s.pending = []byte(s.line(i) + "\n")
+		s.emitted.Add(1)
+	}
+	n := copy(p, s.pending)
+	s.pending = s.pending[n:]
+	return n, nil
+}
+
+// lineSink records output lines and checks, as each is written, how far
+// the source has been read ahead of the output.
+type lineSink struct {
+	source   *lineSource
+	lines    []string
+	maxAhead int64
+}
+
+func (s *lineSink) Write(p []byte) (int, error) {
+	s.lines = append(s.lines, strings.TrimSuffix(string(p), "\n"))
+	if ahead := s.source.emitted.Load() - int64(len(s.lines)); ahead > s.maxAhead {
+		s.maxAhead = ahead
+	}
+	return len(p), nil
+}
+
+func TestProcessNDJSON_OrderAndErrors(t *testing.T) {
+	const total = 5000
+	source := &lineSource{total: total, line: func(i int) string {
+		if i%1000 == 999 {
+			return "{not json"
+		}
+		return fmt.Sprintf(`{"type": "object", "n": %d}`, i)
+	}}
+	sink := &lineSink{source: source}
+
+	process := func(line []byte) (interface{}, error) {
+		var schema map[string]interface{}
+		if err := json.Unmarshal(line, &schema); err != nil {
+			return nil, err
+		}
+		time.Sleep(time.Duration(rand.Intn(50)) * time.Microsecond)
+		return schema, nil
+	}
+
+	const concurrency = 8
+	stats, err := ProcessNDJSON(context.Background(), source, sink, process, NDJSONOptions{Concurrency: concurrency})
+	if err != nil {
+		t.Fatalf("ProcessNDJSON failed: %v", err)
+	}
+	if stats.Lines != total || stats.Failed != total/1000 {
+		t.Errorf("Expected %d lines with %d failures, got %+v", total, total/1000, stats)
+	}
+	if len(sink.lines) != total {
+		t.Fatalf("Expected %d output lines, got %d", total, len(sink.lines))
+	}
+
+	for i, line := range sink.lines {
+		if i%1000 == 999 {
+			var failure NDJSONError
+			if err := json.Unmarshal([]byte(line), &failure); err != nil || failure.Line != i+1 || failure.Error == "" {
+				t.Errorf("Expected an error record for line %d, got %s", i+1, line)
+			}
+			continue
+		}
+		var schema map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &schema); err != nil || schema["n"] != float64(i) {
+			t.Fatalf("Expected output line %d to be input %d, got %s", i+1, i, line)
+		}
+	}
+
+	// The reader stays within a few lines of the writer
+	if sink.maxAhead > concurrency+2 {
+		t.Errorf("Expected at most %d lines read ahead of the output, got %d", concurrency+2, sink.maxAhead)
+	}
+}
+
+func TestProcessNDJSON_Lines(t *testing.T) {
+	input := "{\"a\": 1}\r\n\n   \n" + `{"b": "` + strings.Repeat("x", 100) + `"}` + "\n{\"c\": 3}"
+	var out bytes.Buffer
+	echo := func(line []byte) (interface{}, error) { return json.RawMessage(line), nil }
+
+	stats, err := ProcessNDJSON(context.Background(), strings.NewReader(input), &out, echo, NDJSONOptions{MaxLineBytes: 64})
+	if err != nil {
+		t.Fatalf("ProcessNDJSON failed: %v", err)
+	}
+	if stats.Lines != 3 || stats.Failed != 1 {
+		t.Errorf("Expected 3 lines with 1 failure, got %+v", stats)
+	}
+	expected := []string{`{"a":1}`, `{"error":"line exceeds 64 bytes","line":4}`, `{"c":3}`}
+	if got := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n"); strings.Join(got, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("broken pipe") }
+
+func TestProcessNDJSON_WriteError(t *testing.T) {
+	source := &lineSource{total: 100000, line: func(int) string { return `{}` }}
+	echo := func(line []byte) (interface{}, error) { return json.RawMessage(line), nil }
+
+	_, err := ProcessNDJSON(context.Background(), source, failingWriter{}, echo, NDJSONOptions{Concurrency: 4})
+	if err == nil || !strings.Contains(err.Error(), "broken pipe") {
+		t.Fatalf("Expected the write error, got %v", err)
+	}
+	if emitted := source.emitted.Load(); emitted > 100 {
+		t.Errorf("Expected reading to stop after the write error, read %d lines", emitted)
+	}
+}
+
+func TestProcessNDJSON_SignThenVerify(t *testing.T) {
+	privateKeyPEM, publicKeyPEM, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	signer, err := NewSchemaSigningWorkflow(privateKeyPEM)
+	if err != nil {
+		t.Fatalf("Failed to create signing workflow: %v", err)
+	}
+
+	const total = 2000
+	var input strings.Builder
+	for i := 0; i < total; i++ {
+		fmt.Fprintf(&input, `{"type": "object", "description": "tool %d"}`+"\n", i)
+	}
+
+	type signed struct {
+		Schema    map[string]interface{} `json:"schema"`
+		Signature string                 `json:"signature"`
+	}
+	sign := func(line []byte) (interface{}, error) {
+		var schema map[string]interface{}
+		if err := json.Unmarshal(line, &schema); err != nil {
+			return nil, err
+		}
+		signature, err := signer.SignSchema(schema)
+		return signed{schema, signature}, err
+	}
+	verify := func(line []byte) (interface{}, error) {
+		var doc signed
+		if err := json.Unmarshal(line, &doc); err != nil {
+			return nil, err
+		}
+		hash, err := CalculateSchemaHash(doc.Schema)
+		if err != nil {
+			return nil, err
+		}
+		valid, err := VerifySignatureOnly(hash, doc.Signature, publicKeyPEM)
+		return map[string]interface{}{"valid": valid, "description": doc.Schema["description"]}, err
+	}
+
+	// Pipe the signer's output straight into the verifier
+	pr, pw := io.Pipe()
+	signErr := make(chan error, 1)
+	go func() {
+		_, err := ProcessNDJSON(context.Background(), strings.NewReader(input.String()), pw, sign, NDJSONOptions{Concurrency: 4})
+		pw.CloseWithError(err)
+		signErr <- err
+	}()
+	var out bytes.Buffer
+	stats, err := ProcessNDJSON(context.Background(), pr, &out, verify, NDJSONOptions{Concurrency: 4})
+	if err != nil || <-signErr != nil {
+		t.Fatalf("Pipeline failed: %v", err)
+	}
+	if stats.Lines != total || stats.Failed != 0 {
+		t.Fatalf("Expected %d verified lines, got %+v", total, stats)
+	}
+
+	scanner := bufio.NewScanner(&out)
+	for i := 0; scanner.Scan(); i++ {
+		var result map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			t.Fatalf("Invalid output line %d: %v", i+1, err)
+		}
+		if result["valid"] != true || result["description"] != fmt.Sprintf("tool %d", i) {
+			t.Fatalf("Unexpected result for line %d: %v", i+1, result)
+		}
+	}
+}
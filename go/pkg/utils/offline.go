@@ -0,0 +1,200 @@
+package utils
+
+import (
+	"fmt"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/bundle"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/interactive"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/pinning"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/revocation"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+)
+
+// WarningRevocationNotChecked is added to VerificationResult.Warnings when a
+// key was accepted without any revocation data: discovery was unreachable or
+// disabled by offline mode, and no local revocation data covered the domain.
+const WarningRevocationNotChecked = "revocation_not_checked"
+
+// WarningDiscoveryDowngrade is added to VerificationResult.Warnings when a
+// domain's .well-known response has a lower schema_version than one
+// previously recorded for it in the pinning database.
+const WarningDiscoveryDowngrade = "discovery_downgrade"
+
+// WarningLegacySignature is added to VerificationResult.Warnings when a
+// signature verified only in the legacy form accepted with
+// WithLegacySignatures.
+const WarningLegacySignature = "legacy_signature"
+
+// WarningContactUnverified is added to VerificationResult.Warnings on first
+// use when the domain's .well-known contact has no contact_proof, or one
+// that does not verify against the published key.
+const WarningContactUnverified = "contact_unverified"
+
+// WarningPinStoreReadOnly is added to VerificationResult.Warnings when a
+// write to a read-only pinning database, such as auto-pinning a key or
+// recording a verification, was skipped (see WithReadOnlyPins).
+const WarningPinStoreReadOnly = "pin_store_read_only"
+
+// WarningSignatureStale is added to VerificationResult.Warnings, without a
+// policy, when a signature's signed_at is older than the age set with
+// WithMaxSignatureAge.
+const WarningSignatureStale = "signature_stale"
+
+// WorkflowOption configures a SchemaVerificationWorkflow.
+type WorkflowOption func(*SchemaVerificationWorkflow)
+
+// WithOfflineMode disables all discovery and revocation fetches. Only pinned
+// keys can be verified, and revocation is checked against the data supplied
+// with WithRevocationDocument or WithTrustBundle. VerifyRequest.Offline
+// overrides it per call.
+func WithOfflineMode(offline bool) WorkflowOption {
+	return func(s *SchemaVerificationWorkflow) {
+		s.offline = offline
+	}
+}
+
+// WithInteractiveHandler asks handler whether to trust keys seen for the
+// first time, instead of pinning them only when VerifySchema's autoPin is
+// set. Accepted keys are pinned as pinning.ProvenanceInteractive; rejected
+// keys fail verification with ErrKeyRejected. The handler is never called
+// concurrently by the workflow. VerifyRequest.Handler overrides it per call.
+func WithInteractiveHandler(handler interactive.InteractiveHandler) WorkflowOption {
+	return func(s *SchemaVerificationWorkflow) {
+		s.handler = handler
+	}
+}
+
+// WithRequirePrePinned disables trust on first use. A tool without a pinned
+// key fails verification with ErrKeyNotPinned before any discovery, and no
+// key is pinned or offered to the interactive handler, whatever AutoPin is.
+// Keys must be provisioned in advance, e.g. with PinKeyForTool or
+// pinning.KeyPinning.ImportPinnedKeys. Pinned keys are verified as usual,
+// including revocation checks and, unless offline, discovery of the pinned
+// domain.
+func WithRequirePrePinned(require bool) WorkflowOption {
+	return func(s *SchemaVerificationWorkflow) {
+		s.requirePrePinned = require
+	}
+}
+
+// WithLegacySignatures accepts signatures made by Go releases before v1.4
+// over the schema hash itself (see
+// crypto.SignatureManager.VerifyLegacySignature). Such results stay valid
+// but carry WarningLegacySignature. Off by default.
+func WithLegacySignatures(allow bool) WorkflowOption {
+	return func(s *SchemaVerificationWorkflow) {
+		s.legacySignatures = allow
+	}
+}
+
+// WithStrictRevocation makes a revocation check that cannot be performed a
+// verification failure (ErrRevocationCheckFailed) instead of a
+// WarningRevocationNotChecked warning.
+func WithStrictRevocation(strict bool) WorkflowOption {
+	return func(s *SchemaVerificationWorkflow) {
+		s.strictRevocation = strict
+	}
+}
+
+// WithStrictDiscoveryVersion makes a discovery schema_version downgrade a
+// verification failure (ErrDiscoveryDowngrade) instead of a
+// WarningDiscoveryDowngrade warning.
+func WithStrictDiscoveryVersion(strict bool) WorkflowOption {
+	return func(s *SchemaVerificationWorkflow) {
+		s.strictDiscoveryVersion = strict
+	}
+}
+
+// WithRevocationDocument supplies a local revocation document, which is
+// checked for doc.Domain in addition to anything discovery returns.
+func WithRevocationDocument(doc *revocation.RevocationDocument) WorkflowOption {
+	return func(s *SchemaVerificationWorkflow) {
+		if doc == nil {
+			return
+		}
+		if s.localRevocations == nil {
+			s.localRevocations = make(map[string]*revocation.RevocationDocument)
+		}
+		s.localRevocations[doc.Domain] = doc
+	}
+}
+
+// WithTrustBundle supplies a trust bundle whose discovery documents'
+// revoked_keys lists and revocation documents are checked locally. For a
+// tool without a pin, a discovery document in the bundle for its domain
+// also supplies the key instead of live discovery, including in offline
+// mode; auto-pinned keys are then recorded as pinning.ProvenanceBundle.
+func WithTrustBundle(b *bundle.SchemaPinTrustBundle) WorkflowOption {
+	return func(s *SchemaVerificationWorkflow) {
+		s.trustBundle = b
+	}
+}
+
+// bundledDiscovery returns the trust bundle's discovery document for
+// domain, or nil.
+func (s *SchemaVerificationWorkflow) bundledDiscovery(domain string) *discovery.WellKnownResponse {
+	if s.trustBundle == nil {
+		return nil
+	}
+	return s.trustBundle.FindDiscovery(domain)
+}
+
+// bundleSourceDetail identifies b in the source detail of keys pinned from
+// it: its signing authority and time when signed, otherwise its creation
+// time.
+func bundleSourceDetail(b *bundle.SchemaPinTrustBundle) string {
+	switch {
+	case b == nil:
+		return ""
+	case b.BundleAuthority != nil:
+		return fmt.Sprintf("trust bundle %s signed %s", b.BundleAuthority.Kid, b.SignedAt)
+	default:
+		return "trust bundle created " + b.CreatedAt
+	}
+}
+
+// checkLocalRevocation checks publicKeyPEM and the schema hash against the
+// revocation data supplied via options. checked reports whether any of it
+// covers domain; kind and message are set when something is revoked.
+func (s *SchemaVerificationWorkflow) checkLocalRevocation(domain, publicKeyPEM string, schemaHash []byte) (checked bool, kind *schemaerr.Kind, message string) {
+	if doc := s.localRevocations[domain]; doc != nil {
+		checked = true
+		if kind, message = s.revocationDocumentFailure(doc, publicKeyPEM, schemaHash); kind != nil {
+			return checked, kind, message
+		}
+	}
+
+	if s.trustBundle == nil {
+		return checked, nil, ""
+	}
+	if disc := s.trustBundle.FindDiscovery(domain); disc != nil {
+		checked = true
+		if discovery.CheckKeyRevocation(publicKeyPEM, disc.RevokedKeys) {
+			return checked, schemaerr.ErrKeyRevoked, "public key has been revoked"
+		}
+	}
+	if doc := s.trustBundle.FindRevocation(domain); doc != nil {
+		checked = true
+		if kind, message = s.revocationDocumentFailure(doc, publicKeyPEM, schemaHash); kind != nil {
+			return checked, kind, message
+		}
+	}
+	return checked, nil, ""
+}
+
+// WithTrustBoundary fails verification with ErrDomainBlocked for domains
+// outside boundary, before any pinned key is used or discovery is
+// attempted. When the workflow opens its own pinning database the boundary
+// is also passed to key pinning.
+func WithTrustBoundary(boundary *pinning.TrustBoundary) WorkflowOption {
+	return func(s *SchemaVerificationWorkflow) {
+		s.boundary = boundary
+	}
+}
+
+// CheckBoundaryViolations lists pinned keys whose domains the configured
+// trust boundary blocks. The pins are reported, not removed.
+func (s *SchemaVerificationWorkflow) CheckBoundaryViolations() ([]pinning.BoundaryViolation, error) {
+	return s.boundary.PinViolations(s.pinning)
+}
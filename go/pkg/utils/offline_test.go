@@ -0,0 +1,657 @@
+package utils
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/bundle"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/interactive"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/pinning"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/requestid"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/revocation"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+)
+
+// offlineFixture is a pinned key with a schema signed by it.
+type offlineFixture struct {
+	publicKeyPEM string
+	fingerprint  string
+	schema       map[string]interface{}
+	signature    string
+}
+
+func newOfflineFixture(t *testing.T) offlineFixture {
+	t.Helper()
+	privateKeyPEM, publicKeyPEM, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	signer, err := NewSchemaSigningWorkflow(privateKeyPEM)
+	if err != nil {
+		t.Fatalf("Failed to create signing workflow: %v", err)
+	}
+	schema := map[string]interface{}{"type": "object", "description": "offline tool"}
+	signature, err := signer.SignSchema(schema)
+	if err != nil {
+		t.Fatalf("Failed to sign schema: %v", err)
+	}
+	fingerprint, err := crypto.NewKeyManager().CalculateKeyFingerprintFromPEM(publicKeyPEM)
+	if err != nil {
+		t.Fatalf("Failed to fingerprint key: %v", err)
+	}
+	return offlineFixture{publicKeyPEM, fingerprint, schema, signature}
+}
+
+// pinnedWorkflow returns a workflow with the fixture key pinned for
+// "offline-tool" on domain.
+func (f offlineFixture) pinnedWorkflow(t *testing.T, domain string, opts ...WorkflowOption) *SchemaVerificationWorkflow {
+	t.Helper()
+	workflow, err := NewSchemaVerificationWorkflow(filepath.Join(t.TempDir(), "offline.db"), opts...)
+	if err != nil {
+		t.Fatalf("Failed to create verification workflow: %v", err)
+	}
+	t.Cleanup(func() { workflow.Close() })
+	if err := workflow.pinning.PinKey("offline-tool", f.publicKeyPEM, domain, "Offline Corp"); err != nil {
+		t.Fatalf("Failed to pin key: %v", err)
+	}
+	return workflow
+}
+
+func TestVerifySchemaOfflineAndStrictRevocation(t *testing.T) {
+	fixture := newOfflineFixture(t)
+
+	type expectation struct {
+		valid     bool
+		errorCode string
+		warned    bool
+	}
+	accepted := expectation{valid: true}
+	acceptedUnchecked := expectation{valid: true, warned: true}
+	checkFailed := expectation{errorCode: ErrRevocationCheckFailed}
+	revoked := expectation{errorCode: ErrKeyRevoked}
+
+	tests := []struct {
+		server  string // "up", "down" or "revoked"
+		offline bool
+		strict  bool
+		want    expectation
+	}{
+		{"up", false, false, accepted},
+		{"up", false, true, accepted},
+		{"up", true, false, acceptedUnchecked},
+		{"up", true, true, checkFailed},
+		{"down", false, false, acceptedUnchecked},
+		{"down", false, true, checkFailed},
+		{"down", true, false, acceptedUnchecked},
+		{"down", true, true, checkFailed},
+		{"revoked", false, false, revoked},
+		{"revoked", false, true, revoked},
+		{"revoked", true, false, acceptedUnchecked},
+		{"revoked", true, true, checkFailed},
+	}
+
+	for _, tt := range tests {
+		name := tt.server
+		if tt.offline {
+			name += "/offline"
+		}
+		if tt.strict {
+			name += "/strict"
+		}
+		t.Run(name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				var revokedKeys []string
+				if tt.server == "revoked" {
+					revokedKeys = []string{fixture.fingerprint}
+				}
+				_ = json.NewEncoder(w).Encode(CreateWellKnownResponse(fixture.publicKeyPEM, "Offline Corp", "", revokedKeys, "1.2", ""))
+			}))
+			defer server.Close()
+			if tt.server == "down" {
+				server.Close()
+			}
+
+			workflow := fixture.pinnedWorkflow(t, server.URL, WithOfflineMode(tt.offline), WithStrictRevocation(tt.strict))
+			result, err := workflow.VerifySchema(context.Background(), fixture.schema, fixture.signature, "offline-tool", server.URL, false)
+			if err != nil {
+				t.Fatalf("VerifySchema failed: %v", err)
+			}
+
+			if result.Valid != tt.want.valid || result.ErrorCode != tt.want.errorCode {
+				t.Errorf("Expected valid=%v code=%q, got %+v", tt.want.valid, tt.want.errorCode, result)
+			}
+			warned := len(result.Warnings) == 1 && result.Warnings[0] == WarningRevocationNotChecked
+			if warned != tt.want.warned {
+				t.Errorf("Expected revocation warning %v, got %v", tt.want.warned, result.Warnings)
+			}
+			if tt.offline && requests.Load() != 0 {
+				t.Errorf("Expected no network requests in offline mode, got %d", requests.Load())
+			}
+		})
+	}
+}
+
+func TestVerifySchemaOfflineLocalRevocation(t *testing.T) {
+	fixture := newOfflineFixture(t)
+	const domain = "offline.example.com"
+	ctx := context.Background()
+
+	cleanDoc := revocation.BuildRevocationDocument(domain)
+	revokedDoc := revocation.BuildRevocationDocument(domain)
+	revocation.AddRevokedKey(revokedDoc, fixture.fingerprint, revocation.ReasonKeyCompromise)
+
+	revokingBundle := bundle.NewTrustBundle("2026-01-01T00:00:00Z")
+	revokingBundle.Documents = append(revokingBundle.Documents, bundle.BundledDiscovery{
+		Domain: domain,
+		WellKnown: discovery.WellKnownResponse{
+			SchemaVersion: "1.2",
+			PublicKeyPEM:  fixture.publicKeyPEM,
+			RevokedKeys:   []string{fixture.fingerprint},
+		},
+	})
+
+	tests := []struct {
+		name      string
+		option    WorkflowOption
+		valid     bool
+		errorCode string
+	}{
+		{"clean revocation document", WithRevocationDocument(cleanDoc), true, ""},
+		{"revoking revocation document", WithRevocationDocument(revokedDoc), false, ErrKeyRevoked},
+		{"revocation document for another domain", WithRevocationDocument(revocation.BuildRevocationDocument("other.example.com")), false, ErrRevocationCheckFailed},
+		{"revoking trust bundle", WithTrustBundle(revokingBundle), false, ErrKeyRevoked},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workflow := fixture.pinnedWorkflow(t, domain, WithOfflineMode(true), WithStrictRevocation(true), tt.option)
+			result, err := workflow.VerifySchema(ctx, fixture.schema, fixture.signature, "offline-tool", domain, false)
+			if err != nil {
+				t.Fatalf("VerifySchema failed: %v", err)
+			}
+			if result.Valid != tt.valid || result.ErrorCode != tt.errorCode {
+				t.Errorf("Expected valid=%v code=%q, got %+v", tt.valid, tt.errorCode, result)
+			}
+			if len(result.Warnings) != 0 {
+				t.Errorf("Expected no warnings, got %v", result.Warnings)
+			}
+		})
+	}
+
+	t.Run("unpinned tool", func(t *testing.T) {
+		workflow := fixture.pinnedWorkflow(t, domain, WithOfflineMode(true))
+		result, err := workflow.VerifySchema(ctx, fixture.schema, fixture.signature, "unpinned-tool", domain, true)
+		if err != nil {
+			t.Fatalf("VerifySchema failed: %v", err)
+		}
+		if result.Valid || result.ErrorCode != ErrKeyNotFound {
+			t.Errorf("Expected KEY_NOT_FOUND for an unpinned tool offline, got %+v", result)
+		}
+	})
+}
+
+func TestVerifySchemaTrustBundleFirstUse(t *testing.T) {
+	fixture := newOfflineFixture(t)
+	const domain = "bundled.example.com"
+	ctx := context.Background()
+
+	trustBundle := bundle.NewTrustBundle("2026-01-01T00:00:00Z")
+	trustBundle.Documents = append(trustBundle.Documents, bundle.BundledDiscovery{
+		Domain: domain,
+		WellKnown: discovery.WellKnownResponse{
+			SchemaVersion: "1.2",
+			DeveloperName: "Bundled Corp",
+			PublicKeyPEM:  fixture.publicKeyPEM,
+		},
+	})
+
+	workflow := fixture.pinnedWorkflow(t, "offline.example.com", WithOfflineMode(true), WithTrustBundle(trustBundle))
+	result, err := workflow.VerifySchema(ctx, fixture.schema, fixture.signature, "bundled-tool", domain, true)
+	if err != nil {
+		t.Fatalf("VerifySchema failed: %v", err)
+	}
+	if !result.Valid || !result.FirstUse || !result.Pinned {
+		t.Fatalf("Expected the bundle to supply and pin the key offline, got %+v", result)
+	}
+	if result.DeveloperInfo["developer_name"] != "Bundled Corp" {
+		t.Errorf("Expected developer info from the bundle, got %v", result.DeveloperInfo)
+	}
+
+	info, err := workflow.GetPinnedKeyInfo("bundled-tool")
+	if err != nil || info == nil {
+		t.Fatalf("Expected a pin for bundled-tool, got %v, %v", info, err)
+	}
+	if info.Provenance != pinning.ProvenanceBundle {
+		t.Errorf("Expected provenance %q, got %q", pinning.ProvenanceBundle, info.Provenance)
+	}
+	if info.SourceDetail != "trust bundle created 2026-01-01T00:00:00Z" {
+		t.Errorf("Unexpected source detail %q", info.SourceDetail)
+	}
+	bundled, err := workflow.pinning.ListPinnedKeysByProvenance(pinning.ProvenanceBundle)
+	if err != nil || len(bundled) != 1 || bundled[0].ToolID != "bundled-tool" {
+		t.Errorf("Expected bundled-tool listed under bundle provenance, got %v, %v", bundled, err)
+	}
+}
+
+func TestVerifySchemaTrustBoundary(t *testing.T) {
+	fixture := newOfflineFixture(t)
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		_ = json.NewEncoder(w).Encode(CreateWellKnownResponse(fixture.publicKeyPEM, "Offline Corp", "", nil, "1.2", ""))
+	}))
+	defer server.Close()
+
+	boundary, err := pinning.NewTrustBoundary(nil, []string{server.URL})
+	if err != nil {
+		t.Fatalf("NewTrustBoundary failed: %v", err)
+	}
+	workflow := fixture.pinnedWorkflow(t, server.URL, WithTrustBoundary(boundary))
+
+	for _, toolID := range []string{"offline-tool", "unpinned-tool"} {
+		result, err := workflow.VerifySchema(context.Background(), fixture.schema, fixture.signature, toolID, server.URL, true)
+		if err != nil {
+			t.Fatalf("VerifySchema failed: %v", err)
+		}
+		if result.Valid || result.ErrorCode != ErrDomainBlocked {
+			t.Errorf("Expected DOMAIN_BLOCKED for %s, got %+v", toolID, result)
+		}
+	}
+	if requests.Load() != 0 {
+		t.Errorf("Expected no discovery requests for a blocked domain, got %d", requests.Load())
+	}
+
+	violations, err := workflow.CheckBoundaryViolations()
+	if err != nil {
+		t.Fatalf("CheckBoundaryViolations failed: %v", err)
+	}
+	if len(violations) != 1 || violations[0].ToolID != "offline-tool" {
+		t.Errorf("Expected the pinned tool to be reported, got %+v", violations)
+	}
+}
+
+func TestVerifySchemaRequirePrePinned(t *testing.T) {
+	fixture := newOfflineFixture(t)
+	ctx := context.Background()
+	server, requests := newCountingDiscoveryServer(t, discovery.WellKnownResponse{
+		SchemaVersion: "1.2",
+		DeveloperName: "Offline Corp",
+		PublicKeyPEM:  fixture.publicKeyPEM,
+	}, 0)
+
+	prompted := false
+	handler := interactive.NewCallbackInteractiveHandler(func(*interactive.PromptContext) (interactive.UserDecision, error) {
+		prompted = true
+		return interactive.UserDecisionAccept, nil
+	}, nil, nil)
+	trustBundle := bundle.NewTrustBundle("2026-01-01T00:00:00Z")
+	trustBundle.Documents = append(trustBundle.Documents, bundle.BundledDiscovery{
+		Domain:    server.URL,
+		WellKnown: discovery.WellKnownResponse{SchemaVersion: "1.2", PublicKeyPEM: fixture.publicKeyPEM},
+	})
+	workflow := fixture.pinnedWorkflow(t, server.URL, WithRequirePrePinned(true),
+		WithInteractiveHandler(handler), WithTrustBundle(trustBundle))
+
+	// Unpinned tools fail without discovery, prompting or pinning, online
+	// and offline, even with a bundle covering the domain
+	for _, offline := range []bool{false, true} {
+		result, err := workflow.VerifySchemaWithOptions(ctx, VerifyRequest{
+			Schema: fixture.schema, Signature: fixture.signature,
+			ToolID: "unpinned-tool", Domain: server.URL, AutoPin: true, Offline: &offline,
+		})
+		if err != nil {
+			t.Fatalf("VerifySchema failed: %v", err)
+		}
+		if result.Valid || result.ErrorCode != ErrKeyNotPinned || !errors.Is(result.Err(), schemaerr.ErrKeyNotPinned) {
+			t.Errorf("Expected %s with offline=%v, got %+v", ErrKeyNotPinned, offline, result)
+		}
+	}
+	if requests.Load() != 0 || prompted {
+		t.Errorf("Expected no discovery requests or prompts, got %d requests, prompted=%v", requests.Load(), prompted)
+	}
+	if info, _ := workflow.GetPinnedKeyInfo("unpinned-tool"); info != nil {
+		t.Error("Expected the unpinned tool to stay unpinned")
+	}
+
+	// Pinned tools verify as usual, checking discovery for revocation
+	result, err := workflow.VerifySchema(ctx, fixture.schema, fixture.signature, "offline-tool", server.URL, false)
+	if err != nil {
+		t.Fatalf("VerifySchema failed: %v", err)
+	}
+	if !result.Valid || !result.Pinned || result.FirstUse {
+		t.Errorf("Expected the pinned key to verify, got %+v", result)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("Expected one discovery request for the pinned tool, got %d", requests.Load())
+	}
+
+	// Local revocation still applies to pinned keys
+	doc := revocation.BuildRevocationDocument(server.URL)
+	revocation.AddRevokedKey(doc, fixture.fingerprint, revocation.ReasonKeyCompromise)
+	workflow = fixture.pinnedWorkflow(t, server.URL, WithRequirePrePinned(true), WithOfflineMode(true), WithRevocationDocument(doc))
+	result, err = workflow.VerifySchema(ctx, fixture.schema, fixture.signature, "offline-tool", server.URL, false)
+	if err != nil {
+		t.Fatalf("VerifySchema failed: %v", err)
+	}
+	if result.Valid || result.ErrorCode != ErrKeyRevoked {
+		t.Errorf("Expected %s for a locally revoked pinned key, got %+v", ErrKeyRevoked, result)
+	}
+
+	// The trust boundary is checked first
+	boundary, err := pinning.NewTrustBoundary(nil, []string{server.URL})
+	if err != nil {
+		t.Fatalf("NewTrustBoundary failed: %v", err)
+	}
+	workflow = fixture.pinnedWorkflow(t, server.URL, WithRequirePrePinned(true), WithTrustBoundary(boundary))
+	result, err = workflow.VerifySchema(ctx, fixture.schema, fixture.signature, "unpinned-tool", server.URL, true)
+	if err != nil {
+		t.Fatalf("VerifySchema failed: %v", err)
+	}
+	if result.Valid || result.ErrorCode != ErrDomainBlocked {
+		t.Errorf("Expected %s for a blocked domain, got %+v", ErrDomainBlocked, result)
+	}
+}
+
+func TestVerifySchemaNamespacePin(t *testing.T) {
+	fixture := newOfflineFixture(t)
+	ctx := context.Background()
+	workflow := fixture.pinnedWorkflow(t, "example.com", WithOfflineMode(true))
+	if err := workflow.pinning.PinKeyForNamespace("example.com/payments", fixture.publicKeyPEM, "example.com", "Offline Corp"); err != nil {
+		t.Fatalf("Failed to pin namespace: %v", err)
+	}
+
+	result, err := workflow.VerifySchema(ctx, fixture.schema, fixture.signature, "example.com/payments/charge", "example.com", false)
+	if err != nil {
+		t.Fatalf("VerifySchema failed: %v", err)
+	}
+	if !result.Valid || !result.Pinned {
+		t.Fatalf("Expected the namespace key to verify, got %+v", result)
+	}
+	if result.Metadata["pin_match"] != "namespace" || result.Metadata["pin_namespace"] != "example.com/payments/" {
+		t.Errorf("Expected a namespace match, got %v", result.Metadata)
+	}
+	if info, _ := workflow.GetPinnedKeyInfo("example.com/payments/"); info == nil || info.SuccessCount != 1 {
+		t.Errorf("Expected the verification to be recorded on the namespace pin, got %+v", info)
+	}
+
+	result, err = workflow.VerifySchema(ctx, fixture.schema, fixture.signature, "offline-tool", "example.com", false)
+	if err != nil {
+		t.Fatalf("VerifySchema failed: %v", err)
+	}
+	if !result.Valid || result.Metadata["pin_match"] != "exact" {
+		t.Errorf("Expected an exact match, got %+v", result)
+	}
+
+	// A namespace pin does not vouch for another domain's tools
+	result, err = workflow.VerifySchema(ctx, fixture.schema, fixture.signature, "example.com/payments/charge", "other.example", false)
+	if err != nil {
+		t.Fatalf("VerifySchema failed: %v", err)
+	}
+	if result.Valid || result.ErrorCode != ErrKeyChanged {
+		t.Errorf("Expected %s for another domain, got %+v", ErrKeyChanged, result)
+	}
+}
+
+func TestVerifySchemaDiscoveryCircuitOpen(t *testing.T) {
+	fixture := newOfflineFixture(t)
+
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	workflow := fixture.pinnedWorkflow(t, server.URL, WithDiscoveryOptions(
+		discovery.WithCircuitBreaker(discovery.CircuitBreakerPolicy{FailureThreshold: 1, CoolDown: time.Hour})))
+
+	for _, want := range []string{ErrDiscoveryFailed, ErrDiscoveryCircuitOpen} {
+		result, err := workflow.VerifySchema(context.Background(), fixture.schema, fixture.signature, "unpinned-tool", server.URL, true)
+		if err != nil {
+			t.Fatalf("VerifySchema failed: %v", err)
+		}
+		if result.Valid || result.ErrorCode != want {
+			t.Errorf("Expected %s, got %+v", want, result)
+		}
+	}
+
+	// Pinned keys are used as during any other discovery outage
+	result, err := workflow.VerifySchema(context.Background(), fixture.schema, fixture.signature, "offline-tool", server.URL, true)
+	if err != nil {
+		t.Fatalf("VerifySchema failed: %v", err)
+	}
+	if !result.Valid {
+		t.Errorf("Expected the pinned key to verify, got %+v", result)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("Expected one discovery request, got %d", requests.Load())
+	}
+	if stats := workflow.DiscoveryProtectionStats(); stats.CircuitRejected != 2 {
+		t.Errorf("Expected 2 rejected requests, got %+v", stats)
+	}
+}
+
+func TestVerifySchemaDiscoveryDowngrade(t *testing.T) {
+	fixture := newOfflineFixture(t)
+
+	hasWarning := func(result *VerificationResult) bool {
+		for _, w := range result.Warnings {
+			if w == WarningDiscoveryDowngrade {
+				return true
+			}
+		}
+		return false
+	}
+
+	tests := []struct {
+		name     string
+		versions []string // served on successive verifications
+		strict   bool
+		pinned   bool
+		valid    bool
+		warned   bool
+	}{
+		{"downgrade warns", []string{"1.2", "1.0"}, false, false, true, true},
+		{"downgrade warns for pinned key", []string{"1.2", "1.0"}, false, true, true, true},
+		{"downgrade fails in strict mode", []string{"1.2", "1.0"}, true, false, false, false},
+		{"upgrade", []string{"1.0", "1.2"}, true, false, true, false},
+		{"repeated downgrade", []string{"1.2", "1.0", "1.0"}, false, false, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var served atomic.Value
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_ = json.NewEncoder(w).Encode(CreateWellKnownResponse(fixture.publicKeyPEM, "Offline Corp", "", nil, served.Load().(string), ""))
+			}))
+			defer server.Close()
+
+			workflow := fixture.pinnedWorkflow(t, server.URL, WithStrictDiscoveryVersion(tt.strict))
+			toolID := "unpinned-tool"
+			if tt.pinned {
+				toolID = "offline-tool"
+			}
+
+			var result *VerificationResult
+			for i, version := range tt.versions {
+				served.Store(version)
+				var err error
+				result, err = workflow.VerifySchema(context.Background(), fixture.schema, fixture.signature, toolID, server.URL, false)
+				if err != nil {
+					t.Fatalf("VerifySchema failed: %v", err)
+				}
+				if result.Metadata["discovery_schema_version"] != version {
+					t.Errorf("Expected discovery_schema_version %s, got %v", version, result.Metadata["discovery_schema_version"])
+				}
+				if i == 0 && (!result.Valid || hasWarning(result)) {
+					t.Fatalf("Expected first verification to pass without a downgrade warning, got %+v", result)
+				}
+			}
+
+			if result.Valid != tt.valid || hasWarning(result) != tt.warned {
+				t.Errorf("Expected valid=%v warned=%v, got %+v", tt.valid, tt.warned, result)
+			}
+			if tt.strict && !tt.valid && result.ErrorCode != ErrDiscoveryDowngrade {
+				t.Errorf("Expected %s, got %s", ErrDiscoveryDowngrade, result.ErrorCode)
+			}
+
+			recorded, err := workflow.pinning.GetDiscoveryVersion(server.URL)
+			if err != nil {
+				t.Fatalf("GetDiscoveryVersion failed: %v", err)
+			}
+			if recorded == nil || recorded.SchemaVersion != "1.2" {
+				t.Errorf("Expected the highest served version 1.2 to stay recorded, got %+v", recorded)
+			}
+		})
+	}
+}
+
+func TestVerifySchemaDiscoveryRedirect(t *testing.T) {
+	fixture := newOfflineFixture(t)
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Host != "localhost" && !strings.HasPrefix(r.Host, "localhost:") {
+			// Redirect to the same server under another host name
+			http.Redirect(w, r, strings.Replace(server.URL, "127.0.0.1", "localhost", 1)+r.URL.Path, http.StatusFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(CreateWellKnownResponse(fixture.publicKeyPEM, "Offline Corp", "", nil, "1.2", ""))
+	}))
+	defer server.Close()
+
+	workflow := fixture.pinnedWorkflow(t, server.URL)
+	for _, toolID := range []string{"offline-tool", "unpinned-tool"} {
+		result, err := workflow.VerifySchema(context.Background(), fixture.schema, fixture.signature, toolID, server.URL, false)
+		if err != nil {
+			t.Fatalf("VerifySchema failed: %v", err)
+		}
+		if result.Valid || result.ErrorCode != ErrDiscoveryRedirectBlocked {
+			t.Errorf("Expected %s for %s, got %+v", ErrDiscoveryRedirectBlocked, toolID, result)
+		}
+		if IsTemporaryError(result.Cause) {
+			t.Errorf("Expected a blocked redirect not to be retried")
+		}
+	}
+
+	// Served without a redirect, the source URL is recorded
+	direct := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	workflow = fixture.pinnedWorkflow(t, direct)
+	result, err := workflow.VerifySchema(context.Background(), fixture.schema, fixture.signature, "offline-tool", direct, false)
+	if err != nil {
+		t.Fatalf("VerifySchema failed: %v", err)
+	}
+	if !result.Valid || result.Metadata["discovery_source_url"] != direct+"/.well-known/schemapin.json" {
+		t.Errorf("Expected valid result with discovery_source_url, got %+v", result)
+	}
+}
+
+func TestVerifySchemaLegacySignature(t *testing.T) {
+	fixture := newOfflineFixture(t)
+	privateKeyPEM, publicKeyPEM, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	fixture.publicKeyPEM = publicKeyPEM
+	privateKey, err := crypto.NewKeyManager().LoadPrivateKeyPEM(privateKeyPEM)
+	if err != nil {
+		t.Fatalf("Failed to load private key: %v", err)
+	}
+	schemaHash, err := CalculateSchemaHash(fixture.schema)
+	if err != nil {
+		t.Fatalf("Failed to hash schema: %v", err)
+	}
+	// Go releases before v1.4 signed the schema hash itself
+	legacy, err := ecdsa.SignASN1(rand.Reader, privateKey, schemaHash)
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	signature := base64.StdEncoding.EncodeToString(legacy)
+
+	workflow := fixture.pinnedWorkflow(t, "legacy.example.com", WithOfflineMode(true))
+	result, err := workflow.VerifySchema(context.Background(), fixture.schema, signature, "offline-tool", "legacy.example.com", false)
+	if err != nil {
+		t.Fatalf("VerifySchema failed: %v", err)
+	}
+	if result.Valid || result.ErrorCode != ErrSignatureInvalid {
+		t.Errorf("Expected a legacy signature to be rejected by default, got %+v", result)
+	}
+
+	workflow = fixture.pinnedWorkflow(t, "legacy.example.com", WithOfflineMode(true), WithLegacySignatures(true))
+	result, err = workflow.VerifySchema(context.Background(), fixture.schema, signature, "offline-tool", "legacy.example.com", false)
+	if err != nil {
+		t.Fatalf("VerifySchema failed: %v", err)
+	}
+	if !result.Valid {
+		t.Fatalf("Expected a legacy signature to verify when allowed, got %+v", result)
+	}
+	found := false
+	for _, warning := range result.Warnings {
+		found = found || warning == WarningLegacySignature
+	}
+	if !found {
+		t.Errorf("Expected %q warning, got %v", WarningLegacySignature, result.Warnings)
+	}
+}
+
+func TestVerifyHashMatchesSchema(t *testing.T) {
+	fixture := newOfflineFixture(t)
+	const domain = "bundled.example.com"
+	ctx := context.Background()
+
+	trustBundle := bundle.NewTrustBundle("2026-01-01T00:00:00Z")
+	trustBundle.Documents = append(trustBundle.Documents, bundle.BundledDiscovery{
+		Domain:    domain,
+		WellKnown: discovery.WellKnownResponse{SchemaVersion: "1.2", DeveloperName: "Bundled Corp", PublicKeyPEM: fixture.publicKeyPEM},
+	})
+	hash, err := core.NewSchemaPinCore().CanonicalizeAndHash(fixture.schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Each path gets its own database, so both see a first use followed by
+	// a pinned verification
+	fromSchema := fixture.pinnedWorkflow(t, "offline.example.com", WithOfflineMode(true), WithTrustBundle(trustBundle))
+	fromHash := fixture.pinnedWorkflow(t, "offline.example.com", WithOfflineMode(true), WithTrustBundle(trustBundle))
+	for i, signature := range []string{fixture.signature, fixture.signature, "bm90IGEgc2lnbmF0dXJl"} {
+		// Both calls share a request ID, which is part of the result
+		callCtx := requestid.NewContext(ctx, fmt.Sprintf("call-%d", i))
+		want, err := fromSchema.VerifySchema(callCtx, fixture.schema, signature, "bundled-tool", domain, true)
+		if err != nil {
+			t.Fatalf("VerifySchema failed: %v", err)
+		}
+		got, err := fromHash.VerifyHash(callCtx, hash, signature, "bundled-tool", domain, true)
+		if err != nil {
+			t.Fatalf("VerifyHash failed: %v", err)
+		}
+		wantJSON, _ := json.Marshal(want)
+		gotJSON, _ := json.Marshal(got)
+		if string(gotJSON) != string(wantJSON) || (got.Err() == nil) != (want.Err() == nil) {
+			t.Errorf("Call %d: expected the hash path to match the schema path:\n got %s\nwant %s", i, gotJSON, wantJSON)
+		}
+	}
+
+	result, err := fromHash.VerifyHash(ctx, hash[:31], fixture.signature, "bundled-tool", domain, false)
+	if err != nil {
+		t.Fatalf("VerifyHash failed: %v", err)
+	}
+	if result.Valid || result.ErrorCode != ErrSchemaInvalid {
+		t.Errorf("Expected a 31-byte hash to fail with SCHEMA_INVALID, got %+v", result)
+	}
+}
@@ -0,0 +1,521 @@
+// Per-operation signatures embedded in OpenAPI documents.
+
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+)
+
+// OpenAPIExtension is the specification extension an operation's signature
+// is embedded under.
+const OpenAPIExtension = "x-schemapin"
+
+// maxOpenAPIRefNodes bounds the number of nodes produced while inlining
+// $refs, so that refs shared many times over cannot blow up memory.
+const maxOpenAPIRefNodes = 1 << 20
+
+// openAPIMethods are the operation keys of an OpenAPI path item, in the
+// order operations are listed.
+var openAPIMethods = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+// ErrCyclicRef is returned, wrapped, for a $ref that refers back to itself
+// directly or through other refs.
+var ErrCyclicRef = errors.New("cyclic $ref")
+
+// OpenAPISignature is the value of an operation's x-schemapin extension.
+type OpenAPISignature struct {
+	// SchemaHash is the canonical hash of the signing input in
+	// sha256:<hex> form.
+	SchemaHash string `json:"schema_hash"`
+	Signature  string `json:"signature"`
+}
+
+// OpenAPIOperation is one operation of an OpenAPI document.
+type OpenAPIOperation struct {
+	Path string
+	// Method is the upper-case HTTP method, e.g. GET.
+	Method string
+	// Schema is the signing input: an object with the path, the method, the
+	// operation without its x-schemapin extension under "operation" and the
+	// path item's parameters under "path_parameters" if it has any, with
+	// every local $ref inlined. Binding the path and method means a signed
+	// operation cannot be moved to another route.
+	Schema map[string]interface{}
+	// Signature is the embedded signature, or nil for an unsigned
+	// operation.
+	Signature *OpenAPISignature
+	// Err is set when the extension is malformed or the signing input
+	// cannot be built, e.g. for an external or cyclic $ref. Schema is nil
+	// in the latter case.
+	Err error
+}
+
+// Key identifies the operation as "METHOD path", e.g. "GET /tools/search".
+func (o OpenAPIOperation) Key() string {
+	return o.Method + " " + o.Path
+}
+
+// OpenAPIOperations lists the operations of an OpenAPI document, JSON or
+// YAML, sorted by path and then method.
+//
+// $refs are resolved against the document with every x-schemapin extension
+// removed. Only local refs ("#" followed by a JSON pointer, which may be
+// percent-encoded) are supported. A ref object is replaced by its target
+// and any sibling keys are dropped, as in OpenAPI 3.0. Refs are followed
+// recursively; a ref reached again while it is still being expanded is an
+// error wrapping ErrCyclicRef, while a target shared by several refs is
+// simply inlined at each of them. Path items that are themselves refs are
+// not supported.
+func OpenAPIOperations(doc []byte) ([]OpenAPIOperation, error) {
+	document, err := core.ParseYAMLSchema(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse OpenAPI document: %w", err)
+	}
+	paths, ok := document["paths"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("not an OpenAPI document: paths must be an object")
+	}
+
+	type rawOperation struct {
+		op        OpenAPIOperation
+		item      map[string]interface{}
+		operation map[string]interface{}
+	}
+	var raw []rawOperation
+	for _, p := range sortedKeys(paths) {
+		item, ok := paths[p].(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("path item %s must be an object", p)
+		}
+		for _, method := range openAPIMethods {
+			value, ok := item[method]
+			if !ok {
+				continue
+			}
+			op := OpenAPIOperation{Path: p, Method: strings.ToUpper(method)}
+			operation, ok := value.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("operation %s must be an object", op.Key())
+			}
+			if extension, ok := operation[OpenAPIExtension]; ok {
+				op.Signature, op.Err = decodeOpenAPISignature(extension)
+				delete(operation, OpenAPIExtension)
+			}
+			raw = append(raw, rawOperation{op, item, operation})
+		}
+	}
+
+	operations := make([]OpenAPIOperation, 0, len(raw))
+	for _, r := range raw {
+		op := r.op
+		schema, err := openAPISigningInput(document, op, r.item, r.operation)
+		if err != nil {
+			op.Err = err
+		} else {
+			op.Schema = schema
+		}
+		if op.Err != nil {
+			op.Err = fmt.Errorf("%s: %w", op.Key(), op.Err)
+		}
+		operations = append(operations, op)
+	}
+	return operations, nil
+}
+
+func decodeOpenAPISignature(extension interface{}) (*OpenAPISignature, error) {
+	fields, ok := extension.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s must be an object", OpenAPIExtension)
+	}
+	schemaHash, _ := fields["schema_hash"].(string)
+	signature, _ := fields["signature"].(string)
+	if signature == "" {
+		return nil, fmt.Errorf("%s has no signature", OpenAPIExtension)
+	}
+	return &OpenAPISignature{SchemaHash: schemaHash, Signature: signature}, nil
+}
+
+func openAPISigningInput(document map[string]interface{}, op OpenAPIOperation, item, operation map[string]interface{}) (map[string]interface{}, error) {
+	if _, ok := item["$ref"]; ok {
+		return nil, fmt.Errorf("path item $ref is not supported")
+	}
+	r := &refResolver{document: document, expanding: make(map[string]bool)}
+	resolved, err := r.resolve(operation)
+	if err != nil {
+		return nil, err
+	}
+	input := map[string]interface{}{
+		"path":      op.Path,
+		"method":    op.Method,
+		"operation": resolved,
+	}
+	if parameters, ok := item["parameters"]; ok {
+		if input["path_parameters"], err = r.resolve(parameters); err != nil {
+			return nil, err
+		}
+	}
+	return input, nil
+}
+
+// refResolver inlines local $refs; see OpenAPIOperations.
+type refResolver struct {
+	document map[string]interface{}
+	// expanding holds the JSON pointers of the refs being expanded
+	expanding map[string]bool
+	nodes     int
+}
+
+func (r *refResolver) resolve(value interface{}) (interface{}, error) {
+	r.nodes++
+	if r.nodes > maxOpenAPIRefNodes {
+		return nil, fmt.Errorf("$refs expand to too many nodes")
+	}
+
+	switch value := value.(type) {
+	case map[string]interface{}:
+		if ref, ok := value["$ref"]; ok {
+			s, ok := ref.(string)
+			if !ok {
+				return nil, fmt.Errorf("$ref must be a string")
+			}
+			return r.resolveRef(s)
+		}
+		out := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			resolved, err := r.resolve(item)
+			if err != nil {
+				return nil, err
+			}
+			out[key] = resolved
+		}
+		return out, nil
+	case []interface{}:
+		out := make([]interface{}, len(value))
+		for i, item := range value {
+			resolved, err := r.resolve(item)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = resolved
+		}
+		return out, nil
+	default:
+		return value, nil
+	}
+}
+
+func (r *refResolver) resolveRef(ref string) (interface{}, error) {
+	if !strings.HasPrefix(ref, "#") {
+		return nil, fmt.Errorf("external $ref %q is not supported", ref)
+	}
+	pointer, err := url.PathUnescape(ref[1:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid $ref %q: %w", ref, err)
+	}
+	if r.expanding[pointer] {
+		return nil, fmt.Errorf("%w %q", ErrCyclicRef, ref)
+	}
+	target, err := lookupJSONPointer(r.document, pointer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid $ref %q: %w", ref, err)
+	}
+
+	r.expanding[pointer] = true
+	defer delete(r.expanding, pointer)
+	return r.resolve(target)
+}
+
+// lookupJSONPointer returns the value pointer (RFC 6901) refers to in
+// document.
+func lookupJSONPointer(document map[string]interface{}, pointer string) (interface{}, error) {
+	if pointer == "" {
+		return document, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("fragment is not a JSON pointer")
+	}
+
+	var current interface{} = document
+	for _, token := range strings.Split(pointer[1:], "/") {
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		switch node := current.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("%q not found", token)
+			}
+			current = value
+		case []interface{}:
+			index, err := strconv.Atoi(token)
+			if err != nil || index < 0 || index >= len(node) || strconv.Itoa(index) != token {
+				return nil, fmt.Errorf("invalid array index %q", token)
+			}
+			current = node[index]
+		default:
+			return nil, fmt.Errorf("cannot descend into a scalar at %q", token)
+		}
+	}
+	return current, nil
+}
+
+// OpenAPIPathSelector returns a selector for SignOpenAPIOperations and
+// OpenAPIVerifyOptions that matches operations whose path matches any of
+// patterns with path.Match, so "*" matches within one path segment:
+// "/tools/*" selects /tools/search but not /tools/a/b. It returns nil, which
+// selects every operation, when patterns is empty.
+func OpenAPIPathSelector(patterns []string) (func(p, method string) bool, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid path pattern %q: %w", pattern, err)
+		}
+	}
+	return func(p, method string) bool {
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, p); ok {
+				return true
+			}
+		}
+		return false
+	}, nil
+}
+
+// SignOpenAPIOperations signs every operation of doc for which selector
+// returns true (every operation when selector is nil) and embeds the
+// signatures under the x-schemapin extension, replacing any existing ones.
+// selector is given the path and the upper-case method. The signed
+// document is returned in the input's format: JSON input is re-encoded as
+// indented JSON, while YAML input keeps its key order and comments. The
+// signed operations are returned with their Signature set.
+func SignOpenAPIOperations(doc []byte, selector func(path, method string) bool, workflow *SchemaSigningWorkflow) ([]byte, []OpenAPIOperation, error) {
+	operations, err := OpenAPIOperations(doc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var signed []OpenAPIOperation
+	for _, op := range operations {
+		if selector != nil && !selector(op.Path, op.Method) {
+			continue
+		}
+		// A malformed extension is replaced; only a missing signing input
+		// stops signing
+		if op.Schema == nil {
+			return nil, nil, op.Err
+		}
+		schemaHash, signature, err := workflow.signSchema(op.Schema, "")
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to sign %s: %w", op.Key(), err)
+		}
+		op.Signature = &OpenAPISignature{SchemaHash: core.FormatSchemaHash(schemaHash), Signature: signature}
+		op.Err = nil
+		signed = append(signed, op)
+	}
+	if len(signed) == 0 {
+		return nil, nil, fmt.Errorf("no operations selected for signing")
+	}
+
+	out, err := embedOpenAPISignatures(doc, signed)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, signed, nil
+}
+
+// embedOpenAPISignatures writes the signatures of operations into doc.
+func embedOpenAPISignatures(doc []byte, operations []OpenAPIOperation) ([]byte, error) {
+	if trimmed := bytes.TrimSpace(doc); len(trimmed) > 0 && trimmed[0] == '{' {
+		decoder := json.NewDecoder(bytes.NewReader(doc))
+		decoder.UseNumber()
+		var document map[string]interface{}
+		if err := decoder.Decode(&document); err != nil {
+			return nil, fmt.Errorf("invalid JSON: %w", err)
+		}
+		paths := document["paths"].(map[string]interface{})
+		for _, op := range operations {
+			operation := paths[op.Path].(map[string]interface{})[strings.ToLower(op.Method)].(map[string]interface{})
+			operation[OpenAPIExtension] = op.Signature
+		}
+		out, err := json.MarshalIndent(document, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode OpenAPI document: %w", err)
+		}
+		return append(out, '\n'), nil
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(doc, &root); err != nil {
+		return nil, fmt.Errorf("failed to parse YAML: %w", err)
+	}
+	for _, op := range operations {
+		operation := yamlMappingValue(yamlMappingValue(yamlMappingValue(root.Content[0], "paths"), op.Path), strings.ToLower(op.Method))
+		if operation == nil || operation.Kind != yaml.MappingNode {
+			return nil, fmt.Errorf("cannot embed the signature of %s: the operation is not a plain YAML mapping", op.Key())
+		}
+		setYAMLMappingValue(operation, OpenAPIExtension, &yaml.Node{
+			Kind: yaml.MappingNode,
+			Tag:  "!!map",
+			Content: []*yaml.Node{
+				yamlString("schema_hash"), yamlString(op.Signature.SchemaHash),
+				yamlString("signature"), yamlString(op.Signature.Signature),
+			},
+		})
+	}
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&root); err != nil {
+		return nil, fmt.Errorf("failed to encode OpenAPI document: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode OpenAPI document: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// yamlMappingValue returns the value node of key in mapping, or nil. Merge
+// keys and aliases are not followed.
+func yamlMappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if k := mapping.Content[i]; k.Kind == yaml.ScalarNode && k.Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func setYAMLMappingValue(mapping *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if k := mapping.Content[i]; k.Kind == yaml.ScalarNode && k.Value == key {
+			mapping.Content[i+1] = value
+			return
+		}
+	}
+	mapping.Content = append(mapping.Content, yamlString(key), value)
+}
+
+func yamlString(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: value}
+}
+
+// OpenAPIVerifyOptions configures VerifyOpenAPIOperations.
+type OpenAPIVerifyOptions struct {
+	// Selector limits verification to the operations for which it returns
+	// true. Nil selects every operation.
+	Selector func(path, method string) bool
+	// Strict fails unsigned operations. Otherwise they are only listed in
+	// the report's Unsigned field.
+	Strict bool
+	// AutoPin pins the key on first use, as in VerifySchema.
+	AutoPin bool
+}
+
+// OpenAPIOperationResult is the verification result of one operation.
+type OpenAPIOperationResult struct {
+	Path   string `json:"path"`
+	Method string `json:"method"`
+	Signed bool   `json:"signed"`
+	// Result is nil for an unsigned operation outside strict mode.
+	Result *VerificationResult `json:"result,omitempty"`
+}
+
+// OpenAPIVerificationReport is the outcome of VerifyOpenAPIOperations.
+type OpenAPIVerificationReport struct {
+	// Valid is true when every operation with a result verified.
+	Valid bool `json:"valid"`
+	// Operations is keyed by OpenAPIOperation.Key, e.g. "GET /tools/search".
+	Operations map[string]*OpenAPIOperationResult `json:"operations"`
+	// Unsigned lists the keys of the selected operations without a
+	// signature, sorted.
+	Unsigned []string `json:"unsigned,omitempty"`
+}
+
+// VerifyOpenAPIOperations verifies the x-schemapin signature of every
+// selected operation of doc with workflow, as VerifySchema does for a
+// schema signed for toolID on domain. An operation whose signing input
+// cannot be built, e.g. because of a cyclic $ref, fails on its own; only an
+// unparseable document is an error.
+func VerifyOpenAPIOperations(ctx context.Context, doc []byte, workflow *SchemaVerificationWorkflow, toolID, domain string, opts OpenAPIVerifyOptions) (*OpenAPIVerificationReport, error) {
+	operations, err := OpenAPIOperations(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &OpenAPIVerificationReport{Valid: true, Operations: make(map[string]*OpenAPIOperationResult)}
+	for _, op := range operations {
+		if opts.Selector != nil && !opts.Selector(op.Path, op.Method) {
+			continue
+		}
+		opResult := &OpenAPIOperationResult{Path: op.Path, Method: op.Method, Signed: op.Signature != nil}
+		report.Operations[op.Key()] = opResult
+
+		switch {
+		case op.Err != nil:
+			opResult.Result = &VerificationResult{}
+			opResult.Result.fail(schemaerr.ErrSchemaInvalid, op.Err.Error(), op.Err)
+		case op.Signature == nil:
+			report.Unsigned = append(report.Unsigned, op.Key())
+			if opts.Strict {
+				opResult.Result = &VerificationResult{}
+				opResult.Result.fail(schemaerr.ErrSignatureInvalid, fmt.Sprintf("%s has no %s signature", op.Key(), OpenAPIExtension), nil)
+			}
+		default:
+			opResult.Result, err = workflow.VerifySchema(ctx, op.Schema, op.Signature.Signature, toolID, domain, opts.AutoPin)
+			if err != nil {
+				return nil, fmt.Errorf("failed to verify %s: %w", op.Key(), err)
+			}
+			if opResult.Result.Valid && op.Signature.SchemaHash != "" {
+				checkOpenAPISchemaHash(workflow.core, op, opResult.Result)
+			}
+		}
+		if opResult.Result != nil && !opResult.Result.Valid {
+			report.Valid = false
+		}
+	}
+	sort.Strings(report.Unsigned)
+	return report, nil
+}
+
+// checkOpenAPISchemaHash fails result when the embedded schema_hash does
+// not match the operation. The signature already covers the operation, so
+// a mismatch means the extension itself was edited.
+func checkOpenAPISchemaHash(c *core.SchemaPinCore, op OpenAPIOperation, result *VerificationResult) {
+	schemaHash, err := c.CanonicalizeAndHash(op.Schema)
+	if err != nil {
+		result.Valid = false
+		result.fail(schemaerr.ErrSchemaInvalid, fmt.Sprintf("failed to canonicalize %s: %v", op.Key(), err), err)
+		return
+	}
+	if core.FormatSchemaHash(schemaHash) != op.Signature.SchemaHash {
+		result.Valid = false
+		result.fail(schemaerr.ErrSignatureInvalid, fmt.Sprintf("%s schema_hash does not match the operation", op.Key()), nil)
+	}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
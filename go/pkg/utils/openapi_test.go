@@ -0,0 +1,372 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testOpenAPIDocument = `openapi: 3.0.3
+info:
+  title: Tool API
+  version: 1.0.0
+paths:
+  /health:
+    get:
+      operationId: health
+      responses:
+        "200":
+          description: OK
+  /tools/search:
+    post:
+      operationId: search
+      requestBody:
+        content:
+          application/json:
+            schema:
+              $ref: '#/components/schemas/Query'
+      responses:
+        "200":
+          $ref: '#/components/responses/Results'
+  /tools/{id}:
+    parameters:
+      - $ref: '#/components/parameters/ToolID'
+    get:
+      operationId: getTool
+      responses:
+        "200":
+          $ref: '#/components/responses/Results'
+    delete:
+      operationId: deleteTool
+      responses:
+        "204":
+          description: Deleted
+components:
+  parameters:
+    ToolID:
+      name: id
+      in: path
+      required: true
+      schema:
+        type: string
+  schemas:
+    Query:
+      type: object
+      properties:
+        q:
+          type: string
+        limit:
+          $ref: '#/components/schemas/Limit'
+    Limit:
+      type: integer
+      maximum: 100
+    Result:
+      type: object
+      properties:
+        name:
+          type: string
+  responses:
+    Results:
+      description: Matching tools
+      content:
+        application/json:
+          schema:
+            type: array
+            items:
+              $ref: '#/components/schemas/Result'
+`
+
+// openAPIFixture is a signing workflow and a verification workflow with the
+// signer's key pinned for "api-tool" on example.com.
+type openAPIFixture struct {
+	signer   *SchemaSigningWorkflow
+	verifier *SchemaVerificationWorkflow
+}
+
+func newOpenAPIFixture(t *testing.T) openAPIFixture {
+	t.Helper()
+	privateKeyPEM, publicKeyPEM, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	signer, err := NewSchemaSigningWorkflow(privateKeyPEM)
+	if err != nil {
+		t.Fatalf("Failed to create signing workflow: %v", err)
+	}
+	verifier, err := NewSchemaVerificationWorkflow(filepath.Join(t.TempDir(), "openapi.db"), WithOfflineMode(true))
+	if err != nil {
+		t.Fatalf("Failed to create verification workflow: %v", err)
+	}
+	t.Cleanup(func() { verifier.Close() })
+	if err := verifier.pinning.PinKey("api-tool", publicKeyPEM, "example.com", "Example"); err != nil {
+		t.Fatalf("Failed to pin key: %v", err)
+	}
+	return openAPIFixture{signer, verifier}
+}
+
+func (f openAPIFixture) verify(t *testing.T, doc []byte, opts OpenAPIVerifyOptions) *OpenAPIVerificationReport {
+	t.Helper()
+	report, err := VerifyOpenAPIOperations(context.Background(), doc, f.verifier, "api-tool", "example.com", opts)
+	if err != nil {
+		t.Fatalf("VerifyOpenAPIOperations failed: %v", err)
+	}
+	return report
+}
+
+func toolsSelector(path, method string) bool {
+	return strings.HasPrefix(path, "/tools/")
+}
+
+func TestOpenAPIOperationsResolvesRefs(t *testing.T) {
+	operations, err := OpenAPIOperations([]byte(testOpenAPIDocument))
+	if err != nil {
+		t.Fatalf("OpenAPIOperations failed: %v", err)
+	}
+	var keys []string
+	for _, op := range operations {
+		if op.Err != nil {
+			t.Fatalf("Unexpected error for %s: %v", op.Key(), op.Err)
+		}
+		keys = append(keys, op.Key())
+	}
+	want := []string{"GET /health", "POST /tools/search", "GET /tools/{id}", "DELETE /tools/{id}"}
+	if !reflect.DeepEqual(keys, want) {
+		t.Fatalf("Expected operations %v, got %v", want, keys)
+	}
+
+	search := operations[1].Schema
+	if search["path"] != "/tools/search" || search["method"] != "POST" {
+		t.Errorf("Expected the signing input to bind path and method, got %v", search)
+	}
+	schema := search["operation"].(map[string]interface{})["requestBody"].(map[string]interface{})["content"].(map[string]interface{})["application/json"].(map[string]interface{})["schema"].(map[string]interface{})
+	limit := schema["properties"].(map[string]interface{})["limit"].(map[string]interface{})
+	if limit["maximum"] != float64(100) {
+		t.Errorf("Expected nested refs to be inlined, got %v", schema)
+	}
+
+	parameters, ok := operations[2].Schema["path_parameters"].([]interface{})
+	if !ok || parameters[0].(map[string]interface{})["name"] != "id" {
+		t.Errorf("Expected path item parameters in the signing input, got %v", operations[2].Schema)
+	}
+}
+
+func TestOpenAPISignAndVerify(t *testing.T) {
+	f := newOpenAPIFixture(t)
+	signedDoc, signed, err := SignOpenAPIOperations([]byte(testOpenAPIDocument), toolsSelector, f.signer)
+	if err != nil {
+		t.Fatalf("SignOpenAPIOperations failed: %v", err)
+	}
+	if len(signed) != 3 {
+		t.Fatalf("Expected 3 signed operations, got %d", len(signed))
+	}
+	if !strings.HasPrefix(string(signedDoc), "openapi: 3.0.3\ninfo:") {
+		t.Errorf("Expected YAML key order to be kept, got:\n%s", signedDoc)
+	}
+	if n := strings.Count(string(signedDoc), OpenAPIExtension+":"); n != 3 {
+		t.Errorf("Expected 3 embedded signatures, got %d", n)
+	}
+
+	report := f.verify(t, signedDoc, OpenAPIVerifyOptions{})
+	if !report.Valid {
+		t.Fatalf("Expected the signed operations to verify, got %+v", report.Operations)
+	}
+	if len(report.Operations) != 4 {
+		t.Errorf("Expected 4 operation results, got %d", len(report.Operations))
+	}
+	for _, key := range []string{"POST /tools/search", "GET /tools/{id}", "DELETE /tools/{id}"} {
+		if op := report.Operations[key]; op == nil || !op.Signed || !op.Result.Valid {
+			t.Errorf("Expected %s to be signed and valid, got %+v", key, op)
+		}
+	}
+	if !reflect.DeepEqual(report.Unsigned, []string{"GET /health"}) || report.Operations["GET /health"].Result != nil {
+		t.Errorf("Expected GET /health to be reported unsigned, got %v", report.Unsigned)
+	}
+
+	strict := f.verify(t, signedDoc, OpenAPIVerifyOptions{Strict: true})
+	if strict.Valid || strict.Operations["GET /health"].Result.Valid {
+		t.Error("Expected the unsigned operation to fail in strict mode")
+	}
+	selected := f.verify(t, signedDoc, OpenAPIVerifyOptions{Strict: true, Selector: toolsSelector})
+	if !selected.Valid || len(selected.Operations) != 3 {
+		t.Errorf("Expected strict mode to only cover selected operations, got %+v", selected.Operations)
+	}
+
+	// Re-signing replaces the embedded signatures rather than adding more
+	resigned, _, err := SignOpenAPIOperations(signedDoc, nil, f.signer)
+	if err != nil {
+		t.Fatalf("Re-signing failed: %v", err)
+	}
+	if n := strings.Count(string(resigned), OpenAPIExtension+":"); n != 4 {
+		t.Errorf("Expected 4 embedded signatures after re-signing, got %d", n)
+	}
+	if report := f.verify(t, resigned, OpenAPIVerifyOptions{Strict: true}); !report.Valid {
+		t.Errorf("Expected every re-signed operation to verify, got %+v", report.Operations)
+	}
+}
+
+func TestOpenAPISignJSON(t *testing.T) {
+	f := newOpenAPIFixture(t)
+	doc := []byte(`{
+  "openapi": "3.1.0",
+  "paths": {
+    "/tools/echo": {
+      "post": {"operationId": "echo", "x-rate": 1.5, "responses": {"200": {"description": "OK"}}}
+    }
+  }
+}`)
+	signedDoc, _, err := SignOpenAPIOperations(doc, nil, f.signer)
+	if err != nil {
+		t.Fatalf("SignOpenAPIOperations failed: %v", err)
+	}
+	if !bytes.HasPrefix(signedDoc, []byte("{")) || !bytes.Contains(signedDoc, []byte(`"x-rate": 1.5`)) {
+		t.Errorf("Expected JSON output with numbers kept, got:\n%s", signedDoc)
+	}
+	if report := f.verify(t, signedDoc, OpenAPIVerifyOptions{Strict: true}); !report.Valid {
+		t.Errorf("Expected the JSON document to verify, got %+v", report.Operations["POST /tools/echo"].Result)
+	}
+}
+
+func TestOpenAPIVerifyDetectsChanges(t *testing.T) {
+	f := newOpenAPIFixture(t)
+	signedDoc, _, err := SignOpenAPIOperations([]byte(testOpenAPIDocument), toolsSelector, f.signer)
+	if err != nil {
+		t.Fatalf("SignOpenAPIOperations failed: %v", err)
+	}
+
+	// A shared component affects every operation that refers to it
+	changed := bytes.Replace(signedDoc, []byte("maximum: 100"), []byte("maximum: 1000"), 1)
+	report := f.verify(t, changed, OpenAPIVerifyOptions{})
+	if report.Valid || report.Operations["POST /tools/search"].Result.Valid {
+		t.Error("Expected a changed shared component to invalidate POST /tools/search")
+	}
+	if !report.Operations["GET /tools/{id}"].Result.Valid {
+		t.Error("Expected operations not using the component to stay valid")
+	}
+
+	changed = bytes.Replace(signedDoc, []byte("        type: string\n  schemas:"), []byte("        type: integer\n  schemas:"), 1)
+	report = f.verify(t, changed, OpenAPIVerifyOptions{})
+	if report.Operations["GET /tools/{id}"].Result.Valid || report.Operations["DELETE /tools/{id}"].Result.Valid {
+		t.Error("Expected a changed path-level parameter to invalidate the path's operations")
+	}
+
+	// A signed operation cannot be moved to another route
+	moved := bytes.Replace(signedDoc, []byte("  /tools/search:"), []byte("  /tools/find:"), 1)
+	report = f.verify(t, moved, OpenAPIVerifyOptions{})
+	if op := report.Operations["POST /tools/find"]; op == nil || op.Result.Valid {
+		t.Errorf("Expected a moved operation to fail, got %+v", op)
+	}
+}
+
+func TestOpenAPICyclicRef(t *testing.T) {
+	doc := []byte(`openapi: 3.0.3
+paths:
+  /tree:
+    get:
+      responses:
+        "200":
+          description: A tree
+          content:
+            application/json:
+              schema:
+                $ref: '#/components/schemas/Node'
+  /leaf:
+    get:
+      responses:
+        "200":
+          description: A leaf
+components:
+  schemas:
+    Node:
+      type: object
+      properties:
+        children:
+          type: array
+          items:
+            $ref: '#/components/schemas/Node'
+`)
+	operations, err := OpenAPIOperations(doc)
+	if err != nil {
+		t.Fatalf("OpenAPIOperations failed: %v", err)
+	}
+	if !errors.Is(operations[1].Err, ErrCyclicRef) {
+		t.Fatalf("Expected ErrCyclicRef for GET /tree, got %v", operations[1].Err)
+	}
+
+	f := newOpenAPIFixture(t)
+	if _, _, err := SignOpenAPIOperations(doc, nil, f.signer); !errors.Is(err, ErrCyclicRef) {
+		t.Fatalf("Expected signing to be refused with ErrCyclicRef, got %v", err)
+	}
+	signedDoc, _, err := SignOpenAPIOperations(doc, func(path, method string) bool { return path == "/leaf" }, f.signer)
+	if err != nil {
+		t.Fatalf("Expected operations without cycles to be signed, got %v", err)
+	}
+	report := f.verify(t, signedDoc, OpenAPIVerifyOptions{})
+	if report.Valid || report.Operations["GET /tree"].Result.Valid || !report.Operations["GET /leaf"].Result.Valid {
+		t.Errorf("Expected only the cyclic operation to fail, got %+v", report.Operations)
+	}
+}
+
+func TestOpenAPIRefRules(t *testing.T) {
+	document := map[string]interface{}{
+		"components": map[string]interface{}{
+			"a/b":  map[string]interface{}{"type": "string"},
+			"c~d":  map[string]interface{}{"type": "integer"},
+			"list": []interface{}{"zero", "one"},
+			"self": map[string]interface{}{"$ref": "#/components/self"},
+		},
+	}
+	tests := []struct {
+		ref     string
+		want    interface{}
+		wantErr string
+	}{
+		{ref: "#/components/a~1b", want: map[string]interface{}{"type": "string"}},
+		{ref: "#/components/c~0d", want: map[string]interface{}{"type": "integer"}},
+		{ref: "#/components/a%7E1b", want: map[string]interface{}{"type": "string"}},
+		{ref: "#/components/list/1", want: "one"},
+		{ref: "#/components/list/01", wantErr: "invalid array index"},
+		{ref: "#/components/missing", wantErr: "not found"},
+		{ref: "#components", wantErr: "not a JSON pointer"},
+		{ref: "other.yaml#/components/a~1b", wantErr: "external $ref"},
+		{ref: "#/components/self", wantErr: "cyclic $ref"},
+	}
+	for _, tt := range tests {
+		r := &refResolver{document: document, expanding: make(map[string]bool)}
+		got, err := r.resolve(map[string]interface{}{"$ref": tt.ref, "description": "dropped"})
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: expected error containing %q, got %v", tt.ref, tt.wantErr, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.ref, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: expected %v, got %v", tt.ref, tt.want, got)
+		}
+	}
+}
+
+func TestOpenAPIPathSelector(t *testing.T) {
+	selector, err := OpenAPIPathSelector([]string{"/tools/*", "/health"})
+	if err != nil {
+		t.Fatalf("OpenAPIPathSelector failed: %v", err)
+	}
+	for p, want := range map[string]bool{"/tools/search": true, "/tools/{id}": true, "/tools/a/b": false, "/health": true, "/healthz": false} {
+		if got := selector(p, "GET"); got != want {
+			t.Errorf("selector(%q) = %v, want %v", p, got, want)
+		}
+	}
+	if selector, err := OpenAPIPathSelector(nil); selector != nil || err != nil {
+		t.Error("Expected no patterns to select every operation")
+	}
+	if _, err := OpenAPIPathSelector([]string{"/tools/["}); err == nil {
+		t.Error("Expected an invalid pattern to be rejected")
+	}
+}
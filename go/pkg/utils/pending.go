@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/interactive"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+)
+
+// WithQueuedDecisions queues the first-use decisions the workflow would put
+// to an interactive handler, for user interfaces that answer them later,
+// such as web dashboards. A verification needing a decision queues a
+// prompt in store and fails at once with ErrDecisionPending and the
+// prompt's ID in PendingDecisionID; that is not a final failure. Once the
+// prompt is answered with store.Resolve, the next verification of the
+// tool applies the answer. A nil store keeps the prompts in the pinning
+// database (see pinning.KeyPinning.PendingDecisions). It replaces
+// WithInteractiveHandler and cannot be combined with WithReadOnlyPins.
+func WithQueuedDecisions(store *interactive.PendingDecisionStore) WorkflowOption {
+	return func(s *SchemaVerificationWorkflow) {
+		s.queuedDecisions = true
+		s.pendingStore = store
+	}
+}
+
+// PendingDecisions returns the store the workflow queues decisions in with
+// WithQueuedDecisions, or nil without it.
+func (s *SchemaVerificationWorkflow) PendingDecisions() *interactive.PendingDecisionStore {
+	if !s.queuedDecisions {
+		return nil
+	}
+	return s.pendingStore
+}
+
+// setQueuedHandler makes the workflow's handler queue its prompts, in the
+// pinning database unless WithQueuedDecisions gave a store.
+func (s *SchemaVerificationWorkflow) setQueuedHandler() {
+	if !s.queuedDecisions {
+		return
+	}
+	if s.pendingStore == nil && s.pinning != nil {
+		s.pendingStore = s.pinning.PendingDecisions()
+	}
+	s.handler = interactive.NewQueuedHandler(s.pendingStore)
+}
+
+// decisionPending fails result with ErrDecisionPending and returns true if
+// err is a prompt queued by a QueuedHandler.
+func (r *VerificationResult) decisionPending(err error) bool {
+	var pending *interactive.DecisionPendingError
+	if !errors.As(err, &pending) {
+		return false
+	}
+	prompt := pending.Pending.Prompt
+	r.fail(schemaerr.ErrDecisionPending, fmt.Sprintf("%s decision for tool %s is pending until %s", prompt.PromptType, prompt.ToolID, clock.Format(pending.Pending.ExpiresAt)), err)
+	r.PendingDecisionID = pending.Pending.ID
+	return true
+}
@@ -0,0 +1,123 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery/discoverytest"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/interactive"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+)
+
+// queuedFixture verifies a schema of example.com with decisions queued in
+// the pinning database.
+type queuedFixture struct {
+	workflow  *SchemaVerificationWorkflow
+	schema    map[string]interface{}
+	signature string
+	clock     *clock.Fake
+}
+
+func newQueuedFixture(t *testing.T) *queuedFixture {
+	t.Helper()
+	stub := discoverytest.New()
+	key, err := stub.GenerateDomain("example.com", "Example Dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := NewSchemaSigningWorkflow(key.PrivateKeyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &queuedFixture{
+		schema: map[string]interface{}{"name": "weather", "type": "object"},
+		clock:  clock.NewFake(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)),
+	}
+	if f.signature, err = signer.SignSchema(f.schema); err != nil {
+		t.Fatal(err)
+	}
+	f.workflow, err = NewSchemaVerificationWorkflow(filepath.Join(t.TempDir(), "pins.db"),
+		WithDiscovery(stub), WithQueuedDecisions(nil), WithClock(f.clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.workflow.Close() })
+	return f
+}
+
+func (f *queuedFixture) verify(t *testing.T) *VerificationResult {
+	t.Helper()
+	result, err := f.workflow.VerifySchema(context.Background(), f.schema, f.signature, "example.com/weather", "example.com", false)
+	if err != nil {
+		t.Fatalf("VerifySchema failed: %v", err)
+	}
+	return result
+}
+
+func (f *queuedFixture) pending(t *testing.T) string {
+	t.Helper()
+	result := f.verify(t)
+	if result.Valid || result.ErrorCode != ErrDecisionPending || result.PendingDecisionID == "" {
+		t.Fatalf("Expected %s with a pending decision ID, got %+v", ErrDecisionPending, result)
+	}
+	if !errors.Is(result.Err(), schemaerr.ErrDecisionPending) || IsTemporaryError(result.Err()) {
+		t.Errorf("Expected a pending, non-retryable failure, got %v", result.Err())
+	}
+	return result.PendingDecisionID
+}
+
+func TestQueuedDecisionAccept(t *testing.T) {
+	f := newQueuedFixture(t)
+	id := f.pending(t)
+
+	// A second verification before the answer collapses into the same prompt
+	if again := f.pending(t); again != id {
+		t.Errorf("Expected the same pending decision, got %s and %s", id, again)
+	}
+	store := f.workflow.PendingDecisions()
+	pending, err := store.ListPending()
+	if err != nil || len(pending) != 1 || pending[0].Prompt.ToolID != "example.com/weather" || pending[0].Prompt.NewKey == nil {
+		t.Fatalf("Expected one pending prompt with the new key, got %+v, %v", pending, err)
+	}
+
+	if err := store.Resolve(id, interactive.UserDecisionAccept); err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if result := f.verify(t); !result.Valid || !result.Pinned {
+		t.Fatalf("Expected the accepted key to be pinned, got %+v", result)
+	}
+	if result := f.verify(t); !result.Valid || result.FirstUse {
+		t.Errorf("Expected later verifications to use the pin, got %+v", result)
+	}
+}
+
+func TestQueuedDecisionReject(t *testing.T) {
+	f := newQueuedFixture(t)
+	id := f.pending(t)
+	if err := f.workflow.PendingDecisions().Resolve(id, interactive.UserDecisionReject); err != nil {
+		t.Fatalf("Resolve failed: %v", err)
+	}
+	if result := f.verify(t); result.Valid || result.ErrorCode != ErrKeyRejected {
+		t.Fatalf("Expected %s, got %+v", ErrKeyRejected, result)
+	}
+	if result := f.verify(t); result.ErrorCode != ErrKeyPreviouslyRejected {
+		t.Errorf("Expected the rejection to be remembered, got %+v", result)
+	}
+}
+
+func TestQueuedDecisionExpiry(t *testing.T) {
+	f := newQueuedFixture(t)
+	f.pending(t)
+	f.clock.Advance(interactive.DefaultPendingTTL)
+	expired, err := f.workflow.PendingDecisions().Expire()
+	if err != nil || len(expired) != 1 {
+		t.Fatalf("Expected one expired prompt, got %+v, %v", expired, err)
+	}
+	if result := f.verify(t); result.Valid || result.ErrorCode != ErrKeyRejected {
+		t.Errorf("Expected an unanswered prompt to reject, got %+v", result)
+	}
+}
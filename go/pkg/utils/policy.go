@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"fmt"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+// WithPolicy applies policy to every verification (see
+// verification.Policy). Its rules are evaluated in their documented order:
+// allowed_domains after the trust boundary, revocation for each revoked key
+// or signature found, require_pinned before a key seen for the first time
+// is prompted for or pinned, and stale_signatures (with
+// WithMaxSignatureAge) and legacy_discovery once the signature has
+// verified. expired_signatures, future_signatures and content_policy do not
+// apply to schemas verified by the workflow. VerifyRequest.Policy overrides
+// it per call.
+func WithPolicy(policy *verification.Policy) WorkflowOption {
+	return func(s *SchemaVerificationWorkflow) {
+		s.policy = policy
+	}
+}
+
+// revoked applies the revocation rule to a revoked key or signature. It
+// fails result with kind and returns true unless the policy downgrades
+// revocation, in which case verification continues with a finding.
+func revoked(result *VerificationResult, eval *verification.PolicyEvaluation, kind *schemaerr.Kind, message string) bool {
+	if !eval.Check(verification.RuleRevocation, message) {
+		return false
+	}
+	result.failPolicy(eval, kind, message)
+	return true
+}
+
+// failPolicy fails result for the rule eval just reported as failing, with
+// kind, or ErrPolicyViolation when kind is nil. An empty message describes
+// the finding.
+func (r *VerificationResult) failPolicy(eval *verification.PolicyEvaluation, kind *schemaerr.Kind, message string) {
+	failed := eval.Failure("", "", message)
+	if kind == nil {
+		kind = schemaerr.ErrPolicyViolation
+	}
+	r.fail(kind, failed.ErrorMessage, nil)
+	r.PolicyRule = string(failed.PolicyRule)
+	r.PolicyFindings = failed.PolicyFindings
+}
+
+// applyPolicy records eval's findings on a result that did not fail a
+// rule, adding each warn finding to Warnings.
+func (r *VerificationResult) applyPolicy(eval *verification.PolicyEvaluation) {
+	for _, finding := range eval.Findings {
+		if finding.Severity == verification.SeverityWarn {
+			r.Warnings = append(r.Warnings, finding.String())
+		}
+	}
+	r.PolicyFindings = eval.Findings
+}
+
+// legacyDiscoveryMessage describes a .well-known schema_version older than
+// 1.2, or returns "" for a current or unknown version.
+func legacyDiscoveryMessage(schemaVersion string) string {
+	if schemaVersion == "" || schemaVersion >= "1.2" {
+		return ""
+	}
+	return fmt.Sprintf("discovery uses schema version %s, consider upgrading to 1.2", schemaVersion)
+}
@@ -0,0 +1,101 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/bundle"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/revocation"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+func TestVerifySchemaPolicy(t *testing.T) {
+	fixture := newOfflineFixture(t)
+	const domain = "offline.example.com"
+	ctx := context.Background()
+
+	revokedDoc := revocation.BuildRevocationDocument(domain)
+	revocation.AddRevokedKey(revokedDoc, fixture.fingerprint, revocation.ReasonKeyCompromise)
+
+	// The custom policy downgrades revocation to a warning and requires
+	// keys to be pinned before use
+	custom := &verification.Policy{Revocation: verification.SeverityWarn, RequirePinned: verification.SeverityFail}
+
+	t.Run("revocation downgraded to warn", func(t *testing.T) {
+		workflow := fixture.pinnedWorkflow(t, domain, WithOfflineMode(true), WithRevocationDocument(revokedDoc), WithPolicy(custom))
+		result, err := workflow.VerifySchema(ctx, fixture.schema, fixture.signature, "offline-tool", domain, false)
+		if err != nil {
+			t.Fatalf("VerifySchema failed: %v", err)
+		}
+		if !result.Valid || !result.Pinned {
+			t.Fatalf("Expected the revoked key to verify with a warning, got %+v", result)
+		}
+		if len(result.PolicyFindings) != 1 || result.PolicyFindings[0].Rule != verification.RuleRevocation {
+			t.Errorf("Expected one revocation finding, got %+v", result.PolicyFindings)
+		}
+		if len(result.Warnings) != 1 || !strings.HasPrefix(result.Warnings[0], "policy revocation: ") {
+			t.Errorf("Expected the finding in Warnings, got %v", result.Warnings)
+		}
+
+		// A per-call policy replaces the workflow's
+		strict, err := verification.PolicyProfile(verification.PolicyProfileStrict)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result, err = workflow.VerifySchemaWithOptions(ctx, VerifyRequest{
+			Schema: fixture.schema, Signature: fixture.signature, ToolID: "offline-tool", Domain: domain, Policy: strict,
+		})
+		if err != nil {
+			t.Fatalf("VerifySchemaWithOptions failed: %v", err)
+		}
+		if result.Valid || result.ErrorCode != ErrKeyRevoked || result.PolicyRule != string(verification.RuleRevocation) {
+			t.Errorf("Expected the strict profile to fail the revoked key, got %+v", result)
+		}
+	})
+
+	t.Run("unpinned key upgraded to fail", func(t *testing.T) {
+		trustBundle := bundle.NewTrustBundle("2026-01-01T00:00:00Z")
+		trustBundle.Documents = append(trustBundle.Documents, bundle.BundledDiscovery{
+			Domain:    domain,
+			WellKnown: discovery.WellKnownResponse{SchemaVersion: "1.2", PublicKeyPEM: fixture.publicKeyPEM},
+		})
+		workflow := fixture.pinnedWorkflow(t, domain, WithOfflineMode(true), WithTrustBundle(trustBundle), WithPolicy(custom))
+
+		result, err := workflow.VerifySchema(ctx, fixture.schema, fixture.signature, "new-tool", domain, true)
+		if err != nil {
+			t.Fatalf("VerifySchema failed: %v", err)
+		}
+		if result.Valid || result.ErrorCode != ErrPolicyViolation || result.PolicyRule != string(verification.RuleRequirePinned) {
+			t.Fatalf("Expected a require_pinned failure, got %+v", result)
+		}
+		if !errors.Is(result.Err(), schemaerr.ErrPolicyViolation) {
+			t.Errorf("Expected the failure to match ErrPolicyViolation, got %v", result.Err())
+		}
+		if info, _ := workflow.GetPinnedKeyInfo("new-tool"); info != nil {
+			t.Errorf("Expected the key not to be pinned, got %+v", info)
+		}
+
+		result, err = workflow.VerifySchema(ctx, fixture.schema, fixture.signature, "offline-tool", domain, false)
+		if err != nil {
+			t.Fatalf("VerifySchema failed: %v", err)
+		}
+		if !result.Valid || len(result.PolicyFindings) != 0 {
+			t.Errorf("Expected the pinned tool to verify without findings, got %+v", result)
+		}
+	})
+
+	t.Run("allowed domains", func(t *testing.T) {
+		workflow := fixture.pinnedWorkflow(t, domain, WithOfflineMode(true), WithPolicy(&verification.Policy{AllowedDomains: []string{"tools.example.com"}}))
+		result, err := workflow.VerifySchema(ctx, fixture.schema, fixture.signature, "offline-tool", domain, false)
+		if err != nil {
+			t.Fatalf("VerifySchema failed: %v", err)
+		}
+		if result.Valid || result.ErrorCode != ErrDomainBlocked || result.PolicyRule != string(verification.RuleAllowedDomains) {
+			t.Errorf("Expected allowed_domains to block %s, got %+v", domain, result)
+		}
+	})
+}
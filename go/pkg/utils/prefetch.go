@@ -0,0 +1,192 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/internal/logging"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/revocation"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+)
+
+// DefaultPrefetchTTL is how long documents fetched by Prefetch are used
+// unless WithPrefetchTTL says otherwise.
+const DefaultPrefetchTTL = 5 * time.Minute
+
+// maxPrefetchConcurrency bounds the domains Prefetch fetches at once.
+const maxPrefetchConcurrency = 16
+
+// PrefetchResult is the outcome of prefetching one domain.
+type PrefetchResult struct {
+	Domain string `json:"domain"`
+	OK     bool   `json:"ok"`
+	// Revocations reports whether the domain's revocation document was
+	// fetched as well; it is false for domains that publish none.
+	Revocations bool `json:"revocations,omitempty"`
+	// ErrorCode and Error describe a failure with the codes of
+	// VerificationResult.
+	ErrorCode string        `json:"error_code,omitempty"`
+	Error     string        `json:"error,omitempty"`
+	Duration  time.Duration `json:"duration_ns"`
+}
+
+// WithPrefetchTTL sets how long the documents fetched by Prefetch are used
+// in place of discovery. The default is DefaultPrefetchTTL.
+func WithPrefetchTTL(ttl time.Duration) WorkflowOption {
+	return func(s *SchemaVerificationWorkflow) {
+		s.prefetchTTL = ttl
+	}
+}
+
+// Prefetch fetches the .well-known document of each domain, and the
+// revocation document it names if any, concurrently, so that the first
+// verification for the domain does not wait for discovery. Verifications
+// within the prefetch TTL (see WithPrefetchTTL) use the prefetched
+// documents without any request.
+//
+// Prefetch writes nothing to the pinning database: it pins no keys and
+// does not cache or record the documents there. It returns one result per
+// domain, in the order given. Domains outside the trust boundary are not
+// fetched and fail with ErrDomainBlocked; in offline mode every domain
+// fails with ErrDiscoveryFailed. A domain whose revocation document cannot
+// be fetched fails with ErrRevocationCheckFailed, but its .well-known
+// document is still used.
+func (s *SchemaVerificationWorkflow) Prefetch(ctx context.Context, domains []string) []PrefetchResult {
+	results := make([]PrefetchResult, len(domains))
+	sem := make(chan struct{}, maxPrefetchConcurrency)
+	var wg sync.WaitGroup
+	for i, domain := range domains {
+		wg.Add(1)
+		go func(result *PrefetchResult, domain string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			start := time.Now()
+			*result = s.prefetchDomain(ctx, domain)
+			result.Duration = time.Since(start)
+		}(&results[i], domain)
+	}
+	wg.Wait()
+	return results
+}
+
+// prefetchDomain fetches and caches the documents of one domain.
+func (s *SchemaVerificationWorkflow) prefetchDomain(ctx context.Context, domain string) PrefetchResult {
+	result := PrefetchResult{Domain: domain}
+	fail := func(kind *schemaerr.Kind, err error) PrefetchResult {
+		result.ErrorCode, result.Error = kind.WorkflowCode(), err.Error()
+		s.loggerFor(ctx).WarnContext(ctx, "prefetch failed",
+			logging.KeyDomain, domain,
+			logging.KeyErrorCode, result.ErrorCode,
+			logging.KeyError, err)
+		return result
+	}
+	if _, err := core.NormalizeDomain(domain); err != nil {
+		return fail(schemaerr.ErrDomainBlocked, err)
+	}
+	if err := s.boundary.Check(domain); err != nil {
+		return fail(schemaerr.ErrDomainBlocked, err)
+	}
+	if s.offline {
+		return fail(schemaerr.ErrDiscoveryFailed, fmt.Errorf("discovery is disabled in offline mode"))
+	}
+
+	d := s.prefetchDiscoverer()
+	wellKnown, err := d.FetchDiscovery(ctx, domain)
+	if err != nil {
+		return fail(discoveryFailureKind(err), err)
+	}
+	entry := &prefetchEntry{wellKnown: wellKnown, expires: s.clock.Now().Add(s.prefetchTTL)}
+	defer s.prefetched.store(domain, entry)
+
+	if wellKnown.RevocationEndpoint == "" {
+		result.OK = true
+		return result
+	}
+	doc, err := d.RevocationDocument(ctx, wellKnown)
+	if err != nil {
+		return fail(schemaerr.ErrRevocationCheckFailed, err)
+	}
+	entry.revocations = doc
+	result.OK, result.Revocations = true, true
+	return result
+}
+
+// prefetchDiscoverer returns the discovery client Prefetch fetches with:
+// the one given to WithDiscovery, or else one configured like the
+// workflow's own that writes no documents to the pinning database.
+func (s *SchemaVerificationWorkflow) prefetchDiscoverer() discovery.Discoverer {
+	s.prefetchOnce.Do(func() {
+		if !s.ownDiscovery || s.pinning == nil {
+			s.prefetchClient = s.discovery
+			return
+		}
+		opts := []discovery.Option{discovery.WithLogger(s.logger), discovery.WithRevocationCache(newReadOnlyRevocationCache(s.pinning))}
+		s.prefetchClient = discovery.NewPublicKeyDiscovery(append(opts, s.discoveryOpts...)...)
+	})
+	return s.prefetchClient
+}
+
+// fetchDiscovery returns domain's prefetched .well-known document while it
+// is fresh, and otherwise fetches it.
+func (s *SchemaVerificationWorkflow) fetchDiscovery(ctx context.Context, domain string) (*discovery.WellKnownResponse, error) {
+	if entry := s.prefetched.load(domain, s.clock.Now()); entry != nil {
+		s.loggerFor(ctx).DebugContext(ctx, "using prefetched .well-known document", logging.KeyDomain, domain)
+		return entry.wellKnown, nil
+	}
+	return s.discovery.FetchDiscovery(ctx, domain)
+}
+
+// revocationDocument returns the revocation document prefetched along with
+// wellKnown, if any, and otherwise fetches it.
+func (s *SchemaVerificationWorkflow) revocationDocument(ctx context.Context, wellKnown *discovery.WellKnownResponse) (*revocation.RevocationDocument, error) {
+	if entry := s.prefetched.load(wellKnown.Domain, s.clock.Now()); entry != nil && entry.wellKnown == wellKnown && entry.revocations != nil {
+		return entry.revocations, nil
+	}
+	return s.discovery.RevocationDocument(ctx, wellKnown)
+}
+
+// prefetchEntry holds the documents prefetched for a domain.
+type prefetchEntry struct {
+	wellKnown   *discovery.WellKnownResponse
+	revocations *revocation.RevocationDocument
+	expires     time.Time
+}
+
+// prefetchCache holds prefetched documents by domain identity.
+type prefetchCache struct {
+	mu      sync.Mutex
+	entries map[string]*prefetchEntry
+}
+
+func (c *prefetchCache) store(domain string, entry *prefetchEntry) {
+	identity, err := core.NormalizeDomain(domain)
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]*prefetchEntry)
+	}
+	c.entries[identity] = entry
+}
+
+// load returns domain's entry if it has not expired at now.
+func (c *prefetchCache) load(domain string, now time.Time) *prefetchEntry {
+	identity, err := core.NormalizeDomain(domain)
+	if err != nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry := c.entries[identity]
+	if entry == nil || !now.Before(entry.expires) {
+		return nil
+	}
+	return entry
+}
@@ -0,0 +1,109 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/revocation"
+)
+
+func TestPrefetch(t *testing.T) {
+	f := newOfflineFixture(t)
+	var requests int32
+	release := make(chan struct{})
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		switch r.URL.Path {
+		case "/healthy/.well-known/schemapin.json":
+			_ = json.NewEncoder(w).Encode(CreateWellKnownResponse(f.publicKeyPEM, "Prefetch Corp", "", nil, "1.2", server.URL+"/healthy/revocations.json"))
+		case "/healthy/revocations.json":
+			_ = json.NewEncoder(w).Encode(revocation.BuildRevocationDocument("healthy"))
+		case "/slow/.well-known/schemapin.json":
+			select {
+			case <-r.Context().Done():
+			case <-release:
+			}
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+	healthy, missing, slow := server.URL+"/healthy", server.URL+"/missing", server.URL+"/slow"
+
+	dbPath := filepath.Join(t.TempDir(), "prefetch.db")
+	fake := clock.NewFake(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	workflow, err := NewSchemaVerificationWorkflow(dbPath, WithClock(fake), WithPrefetchTTL(time.Minute))
+	if err != nil {
+		t.Fatalf("Failed to create verification workflow: %v", err)
+	}
+	defer workflow.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	results := workflow.Prefetch(ctx, []string{healthy, missing, slow, "platform.example/../other"})
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected prefetch to be bounded by the context deadline, took %v", elapsed)
+	}
+
+	type status struct {
+		Domain      string
+		OK          bool
+		Revocations bool
+		ErrorCode   string
+	}
+	var got []status
+	for _, r := range results {
+		got = append(got, status{r.Domain, r.OK, r.Revocations, r.ErrorCode})
+	}
+	want := []status{
+		{healthy, true, true, ""},
+		{missing, false, false, ErrDiscoveryFailed},
+		{slow, false, false, ErrDiscoveryFailed},
+		{"platform.example/../other", false, false, ErrDomainBlocked},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected prefetch results %+v, got %+v", want, got)
+	}
+	// Nothing is pinned or cached in the pinning database
+	if pins, err := workflow.ListPinnedKeys(); err != nil || len(pins) != 0 {
+		t.Errorf("Expected no pins after prefetch, got %v, %v", pins, err)
+	}
+	if doc, err := workflow.pinning.LoadDiscoveryDocument(healthy); err != nil || doc != nil {
+		t.Errorf("Expected no cached .well-known document after prefetch, got %+v, %v", doc, err)
+	}
+	if doc, err := workflow.pinning.LoadRevocationDocument(server.URL + "/healthy/revocations.json"); err != nil || doc != nil {
+		t.Errorf("Expected no cached revocation document after prefetch, got %+v, %v", doc, err)
+	}
+
+	// Verifications within the TTL make no request for the prefetched domain
+	prefetchRequests := atomic.LoadInt32(&requests)
+	for _, toolID := range []string{"first", "second"} {
+		result, err := workflow.VerifySchema(context.Background(), f.schema, f.signature, toolID, healthy, true)
+		if err != nil || !result.Valid {
+			t.Fatalf("Expected %s to verify, got %+v, %v", toolID, result, err)
+		}
+	}
+	if n := atomic.LoadInt32(&requests); n != prefetchRequests {
+		t.Errorf("Expected no requests after prefetch, got %d", n-prefetchRequests)
+	}
+
+	// Once the TTL has passed, discovery is used again
+	fake.Advance(time.Minute)
+	if result, err := workflow.VerifySchema(context.Background(), f.schema, f.signature, "first", healthy, true); err != nil || !result.Valid {
+		t.Fatalf("Expected verification after the TTL, got %+v, %v", result, err)
+	}
+	if n := atomic.LoadInt32(&requests); n == prefetchRequests {
+		t.Errorf("Expected discovery requests once the prefetched documents expired")
+	}
+}
@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/provenance"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+)
+
+// WithProvenance checks the provenance passed in VerifyRequest.Provenance
+// once the signature has verified: it must be signed by the tool's key or
+// one of config.Keys and name the schema hash as a subject, or the result
+// fails with ErrProvenanceInvalid or ErrProvenanceSubjectMismatch. The
+// builder, source repository and commit of SLSA provenance are reported
+// in the result's metadata (see provenance.Summary.AddMetadata). Requests without
+// provenance verify as before. A nil config, the default, ignores
+// provenance.
+func WithProvenance(config *provenance.Config) WorkflowOption {
+	return func(s *SchemaVerificationWorkflow) {
+		s.provenance = config
+	}
+}
+
+// checkProvenance applies WithProvenance to a result whose signature has
+// verified, failing it if env does not verify.
+func (s *SchemaVerificationWorkflow) checkProvenance(result *VerificationResult, env *provenance.Envelope, schemaHash []byte, publicKey *ecdsa.PublicKey) {
+	if s.provenance == nil || env == nil {
+		return
+	}
+	summary, err := s.provenance.Check(env, schemaHash, publicKey)
+	if err != nil {
+		result.Valid = false
+		result.fail(schemaerr.KindOf(err), err.Error(), err)
+		return
+	}
+	summary.AddMetadata(result.Metadata)
+}
@@ -0,0 +1,106 @@
+package utils
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"encoding/hex"
+	"path/filepath"
+	"testing"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/provenance"
+)
+
+func TestVerifySchemaProvenance(t *testing.T) {
+	privateKeyPEM, publicKeyPEM, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	signer, err := NewSchemaSigningWorkflow(privateKeyPEM)
+	if err != nil {
+		t.Fatalf("Failed to create signing workflow: %v", err)
+	}
+	schema := map[string]interface{}{"type": "object", "description": "built tool"}
+	signature, err := signer.SignSchema(schema)
+	if err != nil {
+		t.Fatalf("Failed to sign schema: %v", err)
+	}
+	schemaHash, err := CalculateSchemaHash(schema)
+	if err != nil {
+		t.Fatalf("Failed to hash schema: %v", err)
+	}
+	privateKey, err := crypto.NewKeyManager().LoadPrivateKeyPEM(privateKeyPEM)
+	if err != nil {
+		t.Fatalf("Failed to load private key: %v", err)
+	}
+	otherKey, err := crypto.NewKeyManager().GenerateKeypair()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	statementFor := func(digest []byte) *provenance.Statement {
+		return &provenance.Statement{
+			Type:          provenance.StatementTypeV1,
+			Subject:       []provenance.Subject{{Name: "tool", Digest: map[string]string{"sha256": hex.EncodeToString(digest)}}},
+			PredicateType: provenance.PredicateSLSAV1,
+			Predicate:     []byte(`{"runDetails": {"builder": {"id": "https://ci.example.com/builder"}}}`),
+		}
+	}
+	signed := func(key *ecdsa.PrivateKey, digest []byte) *provenance.Envelope {
+		env, err := provenance.Sign(statementFor(digest), key, "")
+		if err != nil {
+			t.Fatalf("Failed to sign provenance: %v", err)
+		}
+		return env
+	}
+	wrongSubject := signed(privateKey, make([]byte, 32))
+
+	tests := []struct {
+		name       string
+		config     *provenance.Config
+		provenance *provenance.Envelope
+		wantCode   string
+		wantBuilt  bool
+	}{
+		{"matching", &provenance.Config{}, signed(privateKey, schemaHash), "", true},
+		{"provenance key", &provenance.Config{Keys: []*ecdsa.PublicKey{&otherKey.PublicKey}}, signed(otherKey, schemaHash), "", true},
+		{"wrong subject", &provenance.Config{}, wrongSubject, ErrProvenanceSubjectMismatch, false},
+		{"bad signature", &provenance.Config{}, signed(otherKey, schemaHash), ErrProvenanceInvalid, false},
+		{"absent", &provenance.Config{}, nil, "", false},
+		{"disabled", nil, wrongSubject, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			workflow, err := NewSchemaVerificationWorkflow(filepath.Join(t.TempDir(), "provenance.db"),
+				WithOfflineMode(true), WithProvenance(tt.config))
+			if err != nil {
+				t.Fatalf("Failed to create verification workflow: %v", err)
+			}
+			defer workflow.Close()
+			if err := workflow.pinning.PinKey("built-tool", publicKeyPEM, "example.com", "Example Corp"); err != nil {
+				t.Fatalf("Failed to pin key: %v", err)
+			}
+
+			result, err := workflow.VerifySchemaWithOptions(context.Background(), VerifyRequest{
+				Schema:     schema,
+				Signature:  signature,
+				ToolID:     "built-tool",
+				Domain:     "example.com",
+				Provenance: tt.provenance,
+			})
+			if err != nil {
+				t.Fatalf("VerifySchemaWithOptions failed: %v", err)
+			}
+			if result.Valid != (tt.wantCode == "") || result.ErrorCode != tt.wantCode {
+				t.Fatalf("Expected code %q, got %+v", tt.wantCode, result)
+			}
+			builder, built := result.Metadata[provenance.MetadataBuilderID]
+			if built != tt.wantBuilt {
+				t.Errorf("Expected builder reported %v, got metadata %v", tt.wantBuilt, result.Metadata)
+			}
+			if built && builder != "https://ci.example.com/builder" {
+				t.Errorf("Unexpected builder %v", builder)
+			}
+		})
+	}
+}
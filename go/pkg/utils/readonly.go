@@ -0,0 +1,26 @@
+package utils
+
+// WithReadOnlyPins opens the workflow's own pinning database read-only,
+// with pinning.WithReadOnly; a workflow given a read-only KeyPinning
+// behaves the same. Pinned keys are used as usual, but nothing is written:
+// keys are not auto-pinned, verification statistics and discovery
+// versions are not recorded, interactive answers and
+// VerifyRequest.Reconsider apply to the current verification only, and
+// revocation documents are not cached. Each skipped write adds WarningPinStoreReadOnly to the result
+// instead of failing verification. It cannot be combined with WithDryRun.
+func WithReadOnlyPins(readOnly bool) WorkflowOption {
+	return func(s *SchemaVerificationWorkflow) {
+		s.readOnlyPins = readOnly
+	}
+}
+
+// pinStoreReadOnly notes, once, that a write to a read-only pinning
+// database was skipped.
+func (r *VerificationResult) pinStoreReadOnly() {
+	for _, warning := range r.Warnings {
+		if warning == WarningPinStoreReadOnly {
+			return
+		}
+	}
+	r.Warnings = append(r.Warnings, WarningPinStoreReadOnly)
+}
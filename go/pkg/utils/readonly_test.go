@@ -0,0 +1,150 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery/discoverytest"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/pinning"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+)
+
+func hasWarning(result *VerificationResult, warning string) bool {
+	for _, w := range result.Warnings {
+		if w == warning {
+			return true
+		}
+	}
+	return false
+}
+
+func TestReadOnlyPinsVerification(t *testing.T) {
+	stub := discoverytest.New()
+	pinnedKey, err := stub.GenerateDomain("pinned.example", "Pinned Dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unpinnedKey, err := stub.GenerateDomain("unpinned.example", "Unpinned Dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	revokedKey, err := stub.GenerateDomain("revoked.example", "Revoked Dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stub.Revoke("revoked.example", revokedKey.PublicKeyPEM); err != nil {
+		t.Fatal(err)
+	}
+
+	// Provision the database, then leave it readable only by its owner
+	dbPath := filepath.Join(t.TempDir(), "pins.db")
+	setup, err := pinning.NewKeyPinning(dbPath, pinning.PinningModeAutomatic, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := setup.PinKey("pinned-tool", pinnedKey.PublicKeyPEM, "pinned.example", "Pinned Dev"); err != nil {
+		t.Fatal(err)
+	}
+	if err := setup.PinKey("revoked-tool", revokedKey.PublicKeyPEM, "revoked.example", "Revoked Dev"); err != nil {
+		t.Fatal(err)
+	}
+	if err := setup.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(dbPath, 0400); err != nil {
+		t.Fatal(err)
+	}
+	before, err := os.ReadFile(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	workflow, err := NewSchemaVerificationWorkflow(dbPath, WithReadOnlyPins(true), WithDiscovery(stub))
+	if err != nil {
+		t.Fatalf("Failed to open read-only workflow: %v", err)
+	}
+	defer workflow.Close()
+
+	schema := map[string]interface{}{"type": "object", "description": "read-only test"}
+	sign := func(key *discoverytest.Key) string {
+		t.Helper()
+		signer, err := NewSchemaSigningWorkflow(key.PrivateKeyPEM)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature, err := signer.SignSchema(schema)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signature
+	}
+	verify := func(toolID, domain string, key *discoverytest.Key) *VerificationResult {
+		t.Helper()
+		result, err := workflow.VerifySchemaWithOptions(context.Background(), VerifyRequest{
+			Schema:    schema,
+			Signature: sign(key),
+			ToolID:    toolID,
+			Domain:    domain,
+			AutoPin:   true,
+		})
+		if err != nil {
+			t.Fatalf("VerifySchemaWithOptions failed: %v", err)
+		}
+		return result
+	}
+
+	t.Run("pinned", func(t *testing.T) {
+		result := verify("pinned-tool", "pinned.example", pinnedKey)
+		if !result.Valid || !result.Pinned {
+			t.Errorf("Expected a valid, pinned result, got %+v", result)
+		}
+		if !hasWarning(result, WarningPinStoreReadOnly) {
+			t.Errorf("Expected %s for the skipped statistics update, got %v", WarningPinStoreReadOnly, result.Warnings)
+		}
+	})
+
+	t.Run("unpinned", func(t *testing.T) {
+		result := verify("unpinned-tool", "unpinned.example", unpinnedKey)
+		if !result.Valid || result.Pinned {
+			t.Errorf("Expected a valid result without a pin, got %+v", result)
+		}
+		if !hasWarning(result, WarningPinStoreReadOnly) {
+			t.Errorf("Expected %s for the skipped auto-pin, got %v", WarningPinStoreReadOnly, result.Warnings)
+		}
+		if info, err := workflow.pinning.GetKeyInfo("unpinned-tool"); err != nil || info != nil {
+			t.Errorf("Expected no pin to be written, got %+v, %v", info, err)
+		}
+	})
+
+	t.Run("revoked", func(t *testing.T) {
+		result := verify("revoked-tool", "revoked.example", revokedKey)
+		if result.Valid || !errors.Is(result.Err(), schemaerr.ErrKeyRevoked) {
+			t.Errorf("Expected the revoked key to fail with ErrKeyRevoked, got %+v", result)
+		}
+	})
+
+	if err := workflow.Close(); err != nil {
+		t.Fatal(err)
+	}
+	after, err := os.ReadFile(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(before, after) {
+		t.Error("Expected the read-only database to be unchanged")
+	}
+}
+
+func TestReadOnlyPinsMissingDatabase(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "missing.db")
+	if _, err := NewSchemaVerificationWorkflow(dbPath, WithReadOnlyPins(true)); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected a missing database to fail with os.ErrNotExist, got %v", err)
+	}
+	if _, err := os.Stat(dbPath); !errors.Is(err, os.ErrNotExist) {
+		t.Error("Expected no database to be created")
+	}
+}
@@ -0,0 +1,199 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// BatchStateEntry is one line of a ResumableBatch state file: a file that
+// was verified, the hash of the content it had and the result.
+type BatchStateEntry struct {
+	Path string `json:"path"`
+	// ContentHash is the SHA-256 of the file, as "sha256:<hex>".
+	ContentHash string `json:"content_hash"`
+	// PinSetHash is the pinning.KeyPinning.PinSetHash the file was
+	// verified against, if the batch was given one.
+	PinSetHash string          `json:"pin_set_hash,omitempty"`
+	Valid      bool            `json:"valid"`
+	Result     json.RawMessage `json:"result,omitempty"`
+}
+
+// ResumableBatchOptions configures OpenResumableBatch.
+type ResumableBatchOptions struct {
+	// Reset discards the state file's entries and starts over.
+	Reset bool
+	// PinSetHash identifies the pins results are obtained with, usually
+	// from pinning.KeyPinning.PinSetHash. Entries recorded with a
+	// different hash are verified again.
+	PinSetHash string
+	// IgnorePinChanges resumes entries regardless of their PinSetHash.
+	IgnorePinChanges bool
+}
+
+// BatchSummary counts the files of a ResumableBatch run. Resumed files,
+// taken from the state file, are included in Valid and Invalid.
+type BatchSummary struct {
+	Total    int `json:"total"`
+	Valid    int `json:"valid"`
+	Invalid  int `json:"invalid"`
+	Resumed  int `json:"resumed"`
+	Verified int `json:"verified"`
+}
+
+// ResumableBatch verifies a list of files, appending each result to a
+// JSON-lines state file as soon as it is known. Run again with the same
+// state file, it skips files whose path and content hash match a recorded
+// entry, so a batch interrupted by a crash or a signal continues where it
+// stopped. A file that changed since it was recorded is verified again.
+type ResumableBatch struct {
+	file    *os.File
+	opts    ResumableBatchOptions
+	mu      sync.Mutex
+	entries map[string]BatchStateEntry
+}
+
+// OpenResumableBatch opens or creates the state file at statePath and
+// loads the entries it can resume. A final line cut short by a crash is
+// removed; any other malformed line is an error.
+func OpenResumableBatch(statePath string, opts ResumableBatchOptions) (*ResumableBatch, error) {
+	flags := os.O_RDWR | os.O_CREATE | os.O_APPEND
+	if opts.Reset {
+		flags |= os.O_TRUNC
+	}
+	file, err := os.OpenFile(statePath, flags, 0600) // #nosec G304 -- path supplied by the caller
+	if err != nil {
+		return nil, fmt.Errorf("failed to open batch state file: %w", err)
+	}
+	b := &ResumableBatch{file: file, opts: opts, entries: make(map[string]BatchStateEntry)}
+	if err := b.load(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *ResumableBatch) load() error {
+	data, err := io.ReadAll(b.file)
+	if err != nil {
+		return fmt.Errorf("failed to read batch state file: %w", err)
+	}
+	complete := len(data) == 0 || data[len(data)-1] == '\n'
+	lines := bytes.Split(bytes.TrimSuffix(data, []byte("\n")), []byte("\n"))
+	for i, line := range lines {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var entry BatchStateEntry
+		if err := json.Unmarshal(line, &entry); err != nil || entry.Path == "" {
+			if i == len(lines)-1 && !complete {
+				// The last write was interrupted; drop the partial line
+				// before appending to the file
+				return b.file.Truncate(int64(len(data) - len(line)))
+			}
+			return fmt.Errorf("batch state file line %d is malformed", i+1)
+		}
+		if !b.opts.IgnorePinChanges && entry.PinSetHash != b.opts.PinSetHash {
+			delete(b.entries, entry.Path)
+			continue
+		}
+		// Later entries for a path replace earlier ones
+		b.entries[entry.Path] = entry
+	}
+	return nil
+}
+
+// Close closes the state file.
+func (b *ResumableBatch) Close() error {
+	return b.file.Close()
+}
+
+// Entry returns the entry recorded for path, if the batch can resume it.
+func (b *ResumableBatch) Entry(path string) (BatchStateEntry, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	entry, ok := b.entries[path]
+	return entry, ok
+}
+
+// Run calls verify for every file in paths without a matching entry and
+// records its result, then returns the entries for all of paths in order,
+// resumed and new alike. verify reports whether the file verified; its
+// result is stored as JSON. An error from verify, or ctx being done, stops
+// the run: files verified so far stay recorded and are skipped next time.
+func (b *ResumableBatch) Run(ctx context.Context, paths []string, verify func(path string) (result interface{}, valid bool, err error)) ([]BatchStateEntry, BatchSummary, error) {
+	var summary BatchSummary
+	entries := make([]BatchStateEntry, 0, len(paths))
+	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return entries, summary, err
+		}
+		contentHash, err := hashFile(path)
+		if err != nil {
+			return entries, summary, err
+		}
+
+		entry, ok := b.Entry(path)
+		if ok && entry.ContentHash == contentHash {
+			summary.Resumed++
+		} else {
+			result, valid, err := verify(path)
+			if err != nil {
+				return entries, summary, err
+			}
+			data, err := json.Marshal(result)
+			if err != nil {
+				return entries, summary, fmt.Errorf("failed to encode result for %s: %w", path, err)
+			}
+			entry = BatchStateEntry{Path: path, ContentHash: contentHash, PinSetHash: b.opts.PinSetHash, Valid: valid, Result: data}
+			if err := b.record(entry); err != nil {
+				return entries, summary, err
+			}
+			summary.Verified++
+		}
+
+		entries = append(entries, entry)
+		summary.Total++
+		if entry.Valid {
+			summary.Valid++
+		} else {
+			summary.Invalid++
+		}
+	}
+	return entries, summary, nil
+}
+
+// record appends entry to the state file with a single write, so an
+// interrupted run loses at most the line being written.
+func (b *ResumableBatch) record(entry BatchStateEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode batch state entry: %w", err)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, err := b.file.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write batch state file: %w", err)
+	}
+	b.entries[entry.Path] = entry
+	return nil
+}
+
+func hashFile(path string) (string, error) {
+	f, err := os.Open(path) // #nosec G304 -- path supplied by the caller
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return "sha256:" + hex.EncodeToString(h.Sum(nil)), nil
+}
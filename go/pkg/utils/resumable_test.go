@@ -0,0 +1,178 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// batchFiles writes n files; those whose content contains "bad" are
+// treated as invalid by countingVerifier.
+func batchFiles(t *testing.T, n int) []string {
+	t.Helper()
+	dir := t.TempDir()
+	var paths []string
+	for i := 0; i < n; i++ {
+		content := fmt.Sprintf("schema %d", i)
+		if i%3 == 0 {
+			content += " bad"
+		}
+		path := filepath.Join(dir, fmt.Sprintf("schema-%02d.json", i))
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// countingVerifier counts calls per path and fails with errInterrupted
+// once stopAfter files have been verified, if stopAfter is positive.
+type countingVerifier struct {
+	calls     map[string]int
+	stopAfter int
+}
+
+var errInterrupted = errors.New("interrupted")
+
+func (v *countingVerifier) verify(path string) (interface{}, bool, error) {
+	if v.stopAfter > 0 && len(v.calls) == v.stopAfter {
+		return nil, false, errInterrupted
+	}
+	v.calls[path]++
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, false, err
+	}
+	valid := !strings.Contains(string(data), "bad")
+	return map[string]interface{}{"file": path, "valid": valid}, valid, nil
+}
+
+func TestResumableBatchResume(t *testing.T) {
+	paths := batchFiles(t, 10)
+	statePath := filepath.Join(t.TempDir(), "state.jsonl")
+	verifier := &countingVerifier{calls: make(map[string]int), stopAfter: 4}
+
+	batch, err := OpenResumableBatch(statePath, ResumableBatchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, summary, err := batch.Run(context.Background(), paths, verifier.verify)
+	batch.Close()
+	if !errors.Is(err, errInterrupted) {
+		t.Fatalf("Expected the run to be interrupted, got %v", err)
+	}
+	if len(entries) != 4 || summary.Verified != 4 {
+		t.Fatalf("Expected 4 files before the interruption, got %d entries, %+v", len(entries), summary)
+	}
+
+	verifier.stopAfter = 0
+	batch, err = OpenResumableBatch(statePath, ResumableBatchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer batch.Close()
+	entries, summary, err = batch.Run(context.Background(), paths, verifier.verify)
+	if err != nil {
+		t.Fatalf("Resumed run failed: %v", err)
+	}
+
+	for _, path := range paths {
+		if verifier.calls[path] != 1 {
+			t.Errorf("Expected %s to be verified once, got %d", filepath.Base(path), verifier.calls[path])
+		}
+	}
+	expected := BatchSummary{Total: 10, Valid: 6, Invalid: 4, Resumed: 4, Verified: 6}
+	if summary != expected {
+		t.Errorf("Expected summary %+v, got %+v", expected, summary)
+	}
+	if len(entries) != 10 || entries[0].Path != paths[0] || !strings.Contains(string(entries[0].Result), `"valid":false`) {
+		t.Errorf("Expected every entry with its recorded result in order, got %d entries, first %+v", len(entries), entries[0])
+	}
+}
+
+func TestResumableBatchInvalidation(t *testing.T) {
+	paths := batchFiles(t, 3)
+	statePath := filepath.Join(t.TempDir(), "state.jsonl")
+
+	run := func(opts ResumableBatchOptions) (map[string]int, BatchSummary) {
+		t.Helper()
+		verifier := &countingVerifier{calls: make(map[string]int)}
+		batch, err := OpenResumableBatch(statePath, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer batch.Close()
+		_, summary, err := batch.Run(context.Background(), paths, verifier.verify)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return verifier.calls, summary
+	}
+
+	run(ResumableBatchOptions{PinSetHash: "sha256:aa"})
+
+	if err := os.WriteFile(paths[1], []byte("changed bad"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	calls, summary := run(ResumableBatchOptions{PinSetHash: "sha256:aa"})
+	if len(calls) != 1 || calls[paths[1]] != 1 || summary.Invalid != 2 {
+		t.Errorf("Expected only the changed file to be verified again, got %v, %+v", calls, summary)
+	}
+
+	if calls, _ := run(ResumableBatchOptions{PinSetHash: "sha256:bb", IgnorePinChanges: true}); len(calls) != 0 {
+		t.Errorf("Expected pin changes to be ignored, got %v", calls)
+	}
+	if calls, _ := run(ResumableBatchOptions{PinSetHash: "sha256:cc"}); len(calls) != 3 {
+		t.Errorf("Expected a pin change to invalidate every entry, got %v", calls)
+	}
+	if calls, _ := run(ResumableBatchOptions{PinSetHash: "sha256:cc", Reset: true}); len(calls) != 3 {
+		t.Errorf("Expected a reset to verify every file again, got %v", calls)
+	}
+}
+
+func TestResumableBatchTruncatedState(t *testing.T) {
+	paths := batchFiles(t, 2)
+	statePath := filepath.Join(t.TempDir(), "state.jsonl")
+
+	batch, err := OpenResumableBatch(statePath, ResumableBatchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := batch.Run(context.Background(), paths[:1], (&countingVerifier{calls: make(map[string]int)}).verify); err != nil {
+		t.Fatal(err)
+	}
+	batch.Close()
+
+	// A crash in the middle of writing the second line
+	f, err := os.OpenFile(statePath, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = f.WriteString(`{"path":"` + paths[1] + `","content_`)
+	f.Close()
+
+	verifier := &countingVerifier{calls: make(map[string]int)}
+	batch, err = OpenResumableBatch(statePath, ResumableBatchOptions{})
+	if err != nil {
+		t.Fatalf("Expected a truncated last line to be ignored, got %v", err)
+	}
+	_, summary, err := batch.Run(context.Background(), paths, verifier.verify)
+	batch.Close()
+	if err != nil || summary.Resumed != 1 || summary.Verified != 1 {
+		t.Fatalf("Expected one resumed and one verified file, got %+v, %v", summary, err)
+	}
+
+	batch, err = OpenResumableBatch(statePath, ResumableBatchOptions{})
+	if err != nil {
+		t.Fatalf("Expected the repaired state file to load, got %v", err)
+	}
+	defer batch.Close()
+	if _, ok := batch.Entry(paths[1]); !ok {
+		t.Error("Expected the entry written after the truncated line to be resumable")
+	}
+}
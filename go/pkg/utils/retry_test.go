@@ -0,0 +1,195 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyDiscoveryServer serves a valid .well-known document after failing
+// the first failures requests with status (and optional Retry-After).
+func flakyDiscoveryServer(t *testing.T, publicKeyPEM string, failures int32, status int, retryAfter string) (*httptest.Server, *int32) {
+	t.Helper()
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= failures {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(CreateWellKnownResponse(publicKeyPEM, "Retry Corp", "", nil, "1.1", ""))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func newRetryFixture(t *testing.T) (*SchemaVerificationWorkflow, map[string]interface{}, string, string) {
+	t.Helper()
+	privateKeyPEM, publicKeyPEM, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	signer, err := NewSchemaSigningWorkflow(privateKeyPEM)
+	if err != nil {
+		t.Fatalf("Failed to create signing workflow: %v", err)
+	}
+	schema := map[string]interface{}{"type": "object", "description": "retry"}
+	signature, err := signer.SignSchema(schema)
+	if err != nil {
+		t.Fatalf("Failed to sign schema: %v", err)
+	}
+
+	workflow, err := NewSchemaVerificationWorkflow(filepath.Join(t.TempDir(), "retry.db"))
+	if err != nil {
+		t.Fatalf("Failed to create verification workflow: %v", err)
+	}
+	t.Cleanup(func() { _ = workflow.Close() })
+	return workflow, schema, signature, publicKeyPEM
+}
+
+func TestRetryVerificationSucceedsAfterFailures(t *testing.T) {
+	workflow, schema, signature, publicKeyPEM := newRetryFixture(t)
+	server, _ := flakyDiscoveryServer(t, publicKeyPEM, 2, http.StatusServiceUnavailable, "")
+
+	var attempts []int
+	opts := RetryOptions{
+		MaxRetries: 4,
+		BaseDelay:  10 * time.Millisecond,
+		MaxDelay:   40 * time.Millisecond,
+		OnAttempt: func(attempt int, result *VerificationResult, err error) {
+			attempts = append(attempts, attempt)
+		},
+	}
+
+	start := time.Now()
+	result, err := RetryVerificationWithOptions(context.Background(), workflow, schema, signature, "retry-tool", server.URL, false, opts)
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatalf("Expected success after retries, got %v", err)
+	}
+	if !result.Valid {
+		t.Fatalf("Expected valid result, got %+v", result)
+	}
+	if len(attempts) != 3 || attempts[2] != 3 {
+		t.Errorf("Expected attempts [1 2 3], got %v", attempts)
+	}
+	// Full jitter waits at most 10ms + 20ms across the two retries
+	if elapsed > 2*time.Second {
+		t.Errorf("Retries took %v, expected well under the configured delays", elapsed)
+	}
+}
+
+func TestRetryVerificationExhaustsRetries(t *testing.T) {
+	workflow, schema, signature, publicKeyPEM := newRetryFixture(t)
+	server, requests := flakyDiscoveryServer(t, publicKeyPEM, 100, http.StatusBadGateway, "")
+
+	attempts := 0
+	opts := RetryOptions{
+		MaxRetries: 2,
+		BaseDelay:  time.Millisecond,
+		OnAttempt:  func(int, *VerificationResult, error) { attempts++ },
+	}
+
+	_, err := RetryVerificationWithOptions(context.Background(), workflow, schema, signature, "retry-tool", server.URL, false, opts)
+	if err == nil {
+		t.Fatal("Expected error after exhausting retries")
+	}
+	if attempts != 3 || atomic.LoadInt32(requests) != 3 {
+		t.Errorf("Expected 3 attempts and 3 requests, got %d attempts and %d requests", attempts, atomic.LoadInt32(requests))
+	}
+}
+
+func TestRetryVerificationHonorsRetryAfter(t *testing.T) {
+	workflow, schema, signature, publicKeyPEM := newRetryFixture(t)
+	server, _ := flakyDiscoveryServer(t, publicKeyPEM, 1, http.StatusTooManyRequests, "1")
+
+	opts := RetryOptions{
+		MaxRetries: 1,
+		BaseDelay:  time.Millisecond,
+		MaxDelay:   5 * time.Second,
+	}
+
+	start := time.Now()
+	result, err := RetryVerificationWithOptions(context.Background(), workflow, schema, signature, "retry-tool", server.URL, false, opts)
+	elapsed := time.Since(start)
+	if err != nil || !result.Valid {
+		t.Fatalf("Expected success after Retry-After, got result=%+v err=%v", result, err)
+	}
+	if elapsed < time.Second {
+		t.Errorf("Expected to wait at least the 1s Retry-After, waited %v", elapsed)
+	}
+
+	// MaxDelay caps the server's hint
+	server, _ = flakyDiscoveryServer(t, publicKeyPEM, 1, http.StatusServiceUnavailable, "3600")
+	opts.MaxDelay = 20 * time.Millisecond
+	start = time.Now()
+	if _, err := RetryVerificationWithOptions(context.Background(), workflow, schema, signature, "retry-tool-2", server.URL, false, opts); err != nil {
+		t.Fatalf("Expected success, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected Retry-After to be capped by MaxDelay, waited %v", elapsed)
+	}
+}
+
+func TestRetryVerificationDoesNotRetryInvalidSignature(t *testing.T) {
+	workflow, _, signature, publicKeyPEM := newRetryFixture(t)
+	server, _ := flakyDiscoveryServer(t, publicKeyPEM, 0, http.StatusOK, "")
+
+	attempts := 0
+	opts := RetryOptions{
+		MaxRetries: 5,
+		BaseDelay:  time.Millisecond,
+		OnAttempt:  func(int, *VerificationResult, error) { attempts++ },
+	}
+
+	tampered := map[string]interface{}{"type": "object", "description": "tampered"}
+	result, err := RetryVerificationWithOptions(context.Background(), workflow, tampered, signature, "retry-tool", server.URL, false, opts)
+	if err != nil {
+		t.Fatalf("Expected a result, got error %v", err)
+	}
+	if result.Valid || result.ErrorCode != ErrSignatureInvalid {
+		t.Errorf("Expected signature-invalid result, got %+v", result)
+	}
+	if attempts != 1 {
+		t.Errorf("Expected exactly 1 attempt, got %d", attempts)
+	}
+}
+
+func TestRetryVerificationDoesNotRetryNotFound(t *testing.T) {
+	workflow, schema, signature, publicKeyPEM := newRetryFixture(t)
+	server, requests := flakyDiscoveryServer(t, publicKeyPEM, 100, http.StatusNotFound, "")
+
+	result, err := RetryVerificationWithOptions(context.Background(), workflow, schema, signature, "retry-tool", server.URL, false, RetryOptions{MaxRetries: 3, BaseDelay: time.Millisecond})
+	if err != nil {
+		t.Fatalf("Expected a result, got error %v", err)
+	}
+	if result.Valid || result.ErrorCode != ErrDiscoveryFailed {
+		t.Errorf("Expected discovery failure, got %+v", result)
+	}
+	if got := atomic.LoadInt32(requests); got != 1 {
+		t.Errorf("Expected 1 request, got %d", got)
+	}
+}
+
+func TestRetryDelayBounds(t *testing.T) {
+	opts := RetryOptions{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for attempt := 0; attempt < 40; attempt++ {
+		limit := opts.BaseDelay << uint(min(attempt, 30))
+		if limit > opts.MaxDelay || limit <= 0 {
+			limit = opts.MaxDelay
+		}
+		for i := 0; i < 20; i++ {
+			if d := retryDelay(attempt, nil, opts); d < 0 || d > limit {
+				t.Fatalf("retryDelay(%d) = %v, want within [0, %v]", attempt, d, limit)
+			}
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package utils
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+// WithMaxSignatureAge checks the signed_at of each verified signature,
+// given in VerifyRequest.SignedAt, against maxAge. An older signature gets
+// a signature_stale warning, or with a policy is evaluated under
+// stale_signatures and fails with ErrSignatureStale at fail severity. Zero,
+// the default, disables the check.
+//
+// Independently of it, a signature with a signed_at before the
+// minimum_signed_at of the domain's .well-known document fails with
+// ErrSignatureSuperseded. Both checks are skipped for requests without
+// SignedAt, and the cutoff also when no document was fetched, as for a
+// pinned key in offline mode.
+func WithMaxSignatureAge(maxAge time.Duration) WorkflowOption {
+	return func(s *SchemaVerificationWorkflow) {
+		s.maxSignatureAge = maxAge
+	}
+}
+
+// checkSignedAt applies the minimum_signed_at of wellKnown, which may be
+// nil, and the maximum signature age to a signature that verified. It
+// fails result and returns false for a superseded signature or a stale one
+// the policy fails.
+func (s *SchemaVerificationWorkflow) checkSignedAt(result *VerificationResult, eval *verification.PolicyEvaluation, domain, signedAt string, wellKnown *discovery.WellKnownResponse) bool {
+	if wellKnown.Supersedes(signedAt) {
+		result.Valid = false
+		result.fail(schemaerr.ErrSignatureSuperseded, fmt.Sprintf("signature made at %s is superseded: %s declares minimum_signed_at %s", signedAt, domain, wellKnown.MinimumSignedAt), nil)
+		return false
+	}
+	message, failed := eval.CheckSignatureAge(signedAt, s.maxSignatureAge, s.clock.Now())
+	if failed {
+		result.Valid = false
+		result.failPolicy(eval, schemaerr.ErrSignatureStale, message)
+		return false
+	}
+	if message != "" && !eval.Enabled() {
+		result.Warnings = append(result.Warnings, WarningSignatureStale+": "+message)
+	}
+	return true
+}
@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery/discoverytest"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+func TestVerifySchemaSignedAt(t *testing.T) {
+	keyManager := crypto.NewKeyManager()
+	privateKey, err := keyManager.GenerateKeypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeyPEM, _ := keyManager.ExportPublicKeyPEM(&privateKey.PublicKey)
+	privateKeyPEM, _ := keyManager.ExportPrivateKeyPEM(privateKey)
+	signer, err := NewSchemaSigningWorkflow(privateKeyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := map[string]interface{}{"type": "object", "name": "refund"}
+	signature, err := signer.SignSchema(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	cutoff := now.Add(-48 * time.Hour)
+	ago := func(d time.Duration) string { return clock.Format(now.Add(-d)) }
+	failStale := &verification.Policy{StaleSignatures: verification.SeverityFail}
+
+	tests := []struct {
+		name     string
+		signedAt string
+		maxAge   time.Duration
+		minimum  string
+		policy   *verification.Policy
+		wantCode string
+		wantWarn string
+		wantRule verification.PolicyRule
+	}{
+		{name: "fresh", signedAt: ago(time.Hour), maxAge: 720 * time.Hour},
+		{name: "stale warns", signedAt: ago(1000 * time.Hour), maxAge: 720 * time.Hour, wantWarn: WarningSignatureStale + ": "},
+		{name: "stale warns under the default policy", signedAt: ago(1000 * time.Hour), maxAge: 720 * time.Hour, policy: &verification.Policy{},
+			wantWarn: "policy stale_signatures: ", wantRule: verification.RuleStaleSignatures},
+		{name: "stale fails under the strict policy", signedAt: ago(1000 * time.Hour), maxAge: 720 * time.Hour, policy: failStale,
+			wantCode: ErrSignatureStale, wantRule: verification.RuleStaleSignatures},
+		{name: "no max age", signedAt: ago(1000 * time.Hour)},
+		{name: "no signed_at", maxAge: 720 * time.Hour, policy: failStale, minimum: clock.Format(cutoff)},
+		{name: "before cutoff", signedAt: clock.Format(cutoff.Add(-time.Second)), minimum: clock.Format(cutoff), wantCode: ErrSignatureSuperseded},
+		{name: "at cutoff", signedAt: clock.Format(cutoff), minimum: clock.Format(cutoff)},
+		{name: "after cutoff", signedAt: clock.Format(cutoff.Add(time.Second)), minimum: clock.Format(cutoff)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := discoverytest.New()
+			stub.SetDomain("example.com", &discovery.WellKnownResponse{
+				SchemaVersion:   "1.2",
+				DeveloperName:   "Test Developer",
+				PublicKeyPEM:    publicKeyPEM,
+				MinimumSignedAt: tt.minimum,
+			})
+			workflow, err := NewSchemaVerificationWorkflow(filepath.Join(t.TempDir(), "pins.db"),
+				WithDiscovery(stub), WithClock(clock.NewFake(now)), WithMaxSignatureAge(tt.maxAge), WithPolicy(tt.policy))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer workflow.Close()
+
+			result, err := workflow.VerifySchemaWithOptions(context.Background(), VerifyRequest{
+				Schema: schema, Signature: signature, SignedAt: tt.signedAt, ToolID: "refund", Domain: "example.com", AutoPin: true,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantCode != "" {
+				if result.Valid || result.ErrorCode != tt.wantCode {
+					t.Fatalf("Expected %s, got %+v", tt.wantCode, result)
+				}
+			} else if !result.Valid {
+				t.Fatalf("Expected a valid result, got %s: %s", result.ErrorCode, result.Error)
+			}
+			if tt.wantRule != "" && (len(result.PolicyFindings) != 1 || result.PolicyFindings[0].Rule != tt.wantRule) {
+				t.Errorf("Expected one %s finding, got %+v", tt.wantRule, result.PolicyFindings)
+			}
+			if tt.wantCode != "" && result.PolicyRule != string(tt.wantRule) {
+				t.Errorf("Expected the failure to name rule %q, got %q", tt.wantRule, result.PolicyRule)
+			}
+
+			var warned bool
+			for _, warning := range result.Warnings {
+				warned = warned || (tt.wantWarn != "" && strings.HasPrefix(warning, tt.wantWarn))
+			}
+			if tt.wantWarn != "" && !warned {
+				t.Errorf("Expected a warning starting %q, got %v", tt.wantWarn, result.Warnings)
+			}
+			if tt.wantWarn == "" && tt.wantCode == "" && len(result.Warnings) != 0 {
+				t.Errorf("Expected no warnings, got %v", result.Warnings)
+			}
+		})
+	}
+
+	// A superseded signature of a pinned key fails too, and matches its kind
+	stub := discoverytest.New()
+	stub.SetDomain("example.com", &discovery.WellKnownResponse{SchemaVersion: "1.2", PublicKeyPEM: publicKeyPEM, MinimumSignedAt: clock.Format(cutoff)})
+	workflow, err := NewSchemaVerificationWorkflow(filepath.Join(t.TempDir(), "pins.db"), WithDiscovery(stub))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer workflow.Close()
+	if err := workflow.pinning.PinKey("refund", publicKeyPEM, "example.com", "Test Developer"); err != nil {
+		t.Fatal(err)
+	}
+	result, err := workflow.VerifySchemaWithOptions(context.Background(), VerifyRequest{
+		Schema: schema, Signature: signature, SignedAt: ago(72 * time.Hour), ToolID: "refund", Domain: "example.com",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Valid || !result.Pinned || !errors.Is(result.Err(), schemaerr.ErrSignatureSuperseded) {
+		t.Errorf("Expected the pinned key's superseded signature to fail, got %+v", result)
+	}
+}
@@ -0,0 +1,85 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery/discoverytest"
+)
+
+// TestVerifySchemaTenantIsolation verifies schemas of two tenants of one
+// platform, each with its own .well-known document under a path prefix.
+func TestVerifySchemaTenantIsolation(t *testing.T) {
+	const acme, globex = "platform.example/tenants/acme", "platform.example/tenants/globex"
+	ctx := context.Background()
+	stub := discoverytest.New()
+	signers := make(map[string]*SchemaSigningWorkflow)
+	for _, domain := range []string{acme, globex} {
+		key, err := stub.GenerateDomain(domain, domain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if signers[domain], err = NewSchemaSigningWorkflow(key.PrivateKeyPEM); err != nil {
+			t.Fatal(err)
+		}
+	}
+	workflow, err := NewSchemaVerificationWorkflow(filepath.Join(t.TempDir(), "pins.db"),
+		WithDiscovery(stub), WithDerivedToolIDs(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer workflow.Close()
+
+	schema := map[string]interface{}{"name": "weather", "type": "object"}
+	signatures := make(map[string]string)
+	for domain, signer := range signers {
+		if signatures[domain], err = signer.SignSchema(schema); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Each tenant's schema pins its own key under its own tool ID
+	for _, domain := range []string{acme, globex} {
+		result, err := workflow.VerifySchema(ctx, schema, signatures[domain], "", domain, true)
+		if err != nil {
+			t.Fatalf("VerifySchema failed: %v", err)
+		}
+		if !result.Valid || !result.Pinned || result.Metadata["tool_id"] != domain+"/weather" {
+			t.Fatalf("Expected %s's key pinned under its own tool ID, got %+v", domain, result)
+		}
+	}
+	pins, err := workflow.ListPinnedKeys()
+	if err != nil || len(pins) != 2 {
+		t.Fatalf("Expected a pin per tenant, got %v, %v", pins, err)
+	}
+
+	// acme's pinned key does not verify a schema attributed to globex
+	result, err := workflow.VerifySchema(ctx, schema, signatures[acme], acme+"/weather", globex, false)
+	if err != nil {
+		t.Fatalf("VerifySchema failed: %v", err)
+	}
+	if result.Valid || result.ErrorCode != ErrKeyChanged {
+		t.Errorf("Expected %s for acme's pin used for globex, got %+v", ErrKeyChanged, result)
+	}
+
+	// Nor does acme's signature verify as globex's
+	result, err = workflow.VerifySchema(ctx, schema, signatures[acme], "", globex, false)
+	if err != nil {
+		t.Fatalf("VerifySchema failed: %v", err)
+	}
+	if result.Valid {
+		t.Errorf("Expected acme's signature to fail for globex, got %+v", result)
+	}
+
+	// A malformed prefix is no identity at all
+	result, err = workflow.VerifySchema(ctx, schema, signatures[acme], "", "platform.example/tenants/globex/../acme", false)
+	if err != nil {
+		t.Fatalf("VerifySchema failed: %v", err)
+	}
+	if result.Valid || result.ErrorCode != ErrDomainBlocked || !errors.Is(result.Err(), core.ErrInvalidDomain) {
+		t.Errorf("Expected a malformed prefix to be refused, got %+v", result)
+	}
+}
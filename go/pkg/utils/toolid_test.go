@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/bundle"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+)
+
+func TestVerifySchemaDerivedToolID(t *testing.T) {
+	fixture := newOfflineFixture(t)
+	const domain = "tools.example.com"
+	ctx := context.Background()
+
+	privateKeyPEM, publicKeyPEM, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := NewSchemaSigningWorkflow(privateKeyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := map[string]interface{}{"name": " Web  Search ", "description": "Searches the web"}
+	signature, err := signer.SignSchema(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	trustBundle := bundle.NewTrustBundle("2026-01-01T00:00:00Z")
+	trustBundle.Documents = append(trustBundle.Documents, bundle.BundledDiscovery{
+		Domain:    domain,
+		WellKnown: discovery.WellKnownResponse{SchemaVersion: "1.2", PublicKeyPEM: publicKeyPEM},
+	})
+	workflow := fixture.pinnedWorkflow(t, domain, WithOfflineMode(true), WithTrustBundle(trustBundle), WithDerivedToolIDs(true))
+
+	result, err := workflow.VerifySchema(ctx, schema, signature, "", domain, true)
+	if err != nil {
+		t.Fatalf("VerifySchema failed: %v", err)
+	}
+	if !result.Valid || !result.Pinned || result.Metadata["tool_id"] != "tools.example.com/web search" {
+		t.Fatalf("Expected the key pinned under the derived tool ID, got %+v", result)
+	}
+	if info, _ := workflow.GetPinnedKeyInfo("tools.example.com/web search"); info == nil {
+		t.Error("Expected a pin for the derived tool ID")
+	}
+
+	// A second call derives the same ID and finds the pin
+	result, err = workflow.VerifySchema(ctx, schema, signature, "", domain, false)
+	if err != nil || !result.Valid || result.FirstUse {
+		t.Errorf("Expected the derived pin to be reused, got %+v, %v", result, err)
+	}
+
+	// Explicit IDs are used as given
+	result, err = workflow.VerifySchema(ctx, fixture.schema, fixture.signature, "offline-tool", domain, false)
+	if err != nil || !result.Valid || result.Metadata["tool_id"] != "offline-tool" {
+		t.Errorf("Expected the explicit tool ID to be used, got %+v, %v", result, err)
+	}
+
+	// The fixture schema has no name
+	result, err = workflow.VerifySchema(ctx, fixture.schema, fixture.signature, "", domain, true)
+	if err != nil {
+		t.Fatalf("VerifySchema failed: %v", err)
+	}
+	if result.Valid || result.ErrorCode != ErrSchemaInvalid || !errors.Is(result.Err(), core.ErrToolNameMissing) {
+		t.Errorf("Expected a missing name to fail with %s, got %+v", ErrSchemaInvalid, result)
+	}
+}
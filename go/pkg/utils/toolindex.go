@@ -0,0 +1,342 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/internal/version"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/requestid"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+// ToolIndexName is the tool name a tool index is verified under: its key
+// is pinned for the tool ID core.DeriveToolID derives from the domain and
+// this name, e.g. "example.com/#tool-index".
+const ToolIndexName = "#tool-index"
+
+// DefaultMaxToolSchemaBytes caps the size of a schema downloaded by
+// VerifiedToolIndex.FetchAndVerifyEntry.
+const DefaultMaxToolSchemaBytes = 1 << 20
+
+// ToolIndexEntry is one tool listed in a tool index.
+type ToolIndexEntry struct {
+	Name string `json:"name"`
+	// SchemaURL is where the schema is published, either bare or as a
+	// signed schema document with "schema" and "signature" fields.
+	SchemaURL string `json:"schema_url"`
+	// SchemaHash is the canonical schema hash in sha256:<hex> form.
+	SchemaHash string `json:"schema_hash"`
+	// Signature is the tool's signature over SchemaHash.
+	Signature string `json:"signature"`
+}
+
+// ToolIndex lists the tools a domain publishes without shipping their
+// schemas, so that clients can check which tools are on offer and
+// download only those they need. Signature covers the canonical form of
+// the rest of the index and is made with the same key as the entries.
+type ToolIndex struct {
+	Tools     []ToolIndexEntry `json:"tools"`
+	Signature string           `json:"signature,omitempty"`
+}
+
+// NewToolIndexEntry returns the entry for schema, signed with signature
+// and published at schemaURL.
+func NewToolIndexEntry(name, schemaURL string, schema map[string]interface{}, signature string) (ToolIndexEntry, error) {
+	hash, err := CalculateSchemaHash(schema)
+	if err != nil {
+		return ToolIndexEntry{}, fmt.Errorf("failed to canonicalize schema %s: %w", name, err)
+	}
+	return ToolIndexEntry{
+		Name:       name,
+		SchemaURL:  schemaURL,
+		SchemaHash: core.FormatSchemaHash(hash),
+		Signature:  signature,
+	}, nil
+}
+
+// BuildToolIndex signs an index of entries with the workflow's key and
+// returns it as indented JSON. Every entry must have a unique name, an
+// http or https schema URL and a signature by the same key over its
+// schema hash.
+func (s *SchemaSigningWorkflow) BuildToolIndex(entries []ToolIndexEntry) ([]byte, error) {
+	publicKeyPEM, err := s.keyManager.ExportPublicKeyPEM(&s.privateKey.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export public key: %w", err)
+	}
+	names := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		if entry.Name == "" {
+			return nil, fmt.Errorf("tool index entry for %s has no name", entry.SchemaURL)
+		}
+		if names[entry.Name] {
+			return nil, fmt.Errorf("tool %s is listed twice", entry.Name)
+		}
+		names[entry.Name] = true
+		if err := checkSchemaURL(entry.SchemaURL); err != nil {
+			return nil, fmt.Errorf("tool %s: %w", entry.Name, err)
+		}
+		schemaHash, err := core.ParseSchemaHash(entry.SchemaHash)
+		if err != nil {
+			return nil, fmt.Errorf("tool %s: %w", entry.Name, err)
+		}
+		valid, err := VerifySignatureOnly(schemaHash, entry.Signature, publicKeyPEM)
+		if err != nil {
+			return nil, err
+		}
+		if !valid {
+			return nil, fmt.Errorf("tool %s is not signed by the index key", entry.Name)
+		}
+	}
+
+	index := &ToolIndex{Tools: append([]ToolIndexEntry{}, entries...)}
+	data, err := json.Marshal(index)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal tool index: %w", err)
+	}
+	indexHash, err := documentBodyHash(data, "tool index")
+	if err != nil {
+		return nil, err
+	}
+	index.Signature, err = s.signatureManager.SignSchemaHash(indexHash, s.privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign tool index: %w", err)
+	}
+	data, err = json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal tool index: %w", err)
+	}
+	return data, nil
+}
+
+// ToolIndexOption configures VerifyToolIndex.
+type ToolIndexOption func(*toolIndexConfig)
+
+type toolIndexConfig struct {
+	client   *http.Client
+	maxBytes int64
+}
+
+// WithToolIndexHTTPClient downloads entry schemas with client. The default
+// client times out after 10 seconds.
+func WithToolIndexHTTPClient(client *http.Client) ToolIndexOption {
+	return func(c *toolIndexConfig) {
+		c.client = client
+	}
+}
+
+// WithToolIndexMaxSchemaBytes caps the size of downloaded entry schemas
+// (default DefaultMaxToolSchemaBytes).
+func WithToolIndexMaxSchemaBytes(n int64) ToolIndexOption {
+	return func(c *toolIndexConfig) {
+		if n > 0 {
+			c.maxBytes = n
+		}
+	}
+}
+
+// VerifiedToolIndex is a tool index checked by VerifyToolIndex. Its
+// entries are only trusted when Valid is set; FetchAndVerifyEntry refuses
+// them otherwise.
+type VerifiedToolIndex struct {
+	Domain string
+	Tools  []ToolIndexEntry
+	Valid  bool
+	// ErrorCode is verification.ErrIndexSignatureInvalid when the index
+	// was not accepted, for whatever reason Result gives.
+	ErrorCode verification.ErrorCode
+	Error     string
+	// Result is the verification of the index's own signature.
+	Result *VerificationResult
+
+	workflow *SchemaVerificationWorkflow
+	config   toolIndexConfig
+}
+
+// ToolIndexEntryResult is the outcome of FetchAndVerifyEntry.
+type ToolIndexEntryResult struct {
+	Name  string
+	Valid bool
+	// ErrorCode tells index-level from entry-level failures:
+	// verification.ErrIndexSignatureInvalid when the index itself was not
+	// accepted and the entry was not fetched,
+	// verification.ErrEntryHashMismatch when the downloaded schema does not
+	// have the declared hash, and verification.ErrEntrySignatureInvalid
+	// when the entry's signature was not accepted.
+	ErrorCode verification.ErrorCode
+	Error     string
+	// Schema is the downloaded schema, set once it matched the declared
+	// hash.
+	Schema map[string]interface{}
+	// Result is the verification of the entry's signature, if it got that
+	// far.
+	Result *VerificationResult
+}
+
+// VerifyToolIndex parses a tool index published by domain and verifies its
+// signature with workflow, like any schema, under ToolIndexName. A
+// malformed index is an error; one whose signature is not accepted is
+// returned with Valid unset. No entry is downloaded until
+// FetchAndVerifyEntry is called for it.
+func VerifyToolIndex(ctx context.Context, indexJSON []byte, domain string, workflow *SchemaVerificationWorkflow, opts ...ToolIndexOption) (*VerifiedToolIndex, error) {
+	var index ToolIndex
+	if err := json.Unmarshal(indexJSON, &index); err != nil {
+		return nil, fmt.Errorf("invalid tool index: %w", err)
+	}
+	toolID, err := core.DeriveToolID(domain, map[string]interface{}{"name": ToolIndexName})
+	if err != nil {
+		return nil, err
+	}
+
+	verified := &VerifiedToolIndex{
+		Domain:   domain,
+		Tools:    index.Tools,
+		workflow: workflow,
+		config:   toolIndexConfig{maxBytes: DefaultMaxToolSchemaBytes},
+	}
+	for _, opt := range opts {
+		opt(&verified.config)
+	}
+	if index.Signature == "" {
+		verified.ErrorCode = verification.ErrIndexSignatureInvalid
+		verified.Error = "tool index is not signed"
+		return verified, nil
+	}
+
+	indexHash, err := documentBodyHash(indexJSON, "tool index")
+	if err != nil {
+		return nil, err
+	}
+	result, err := workflow.VerifyHash(ctx, indexHash, index.Signature, toolID, domain, false)
+	if err != nil {
+		return nil, err
+	}
+	verified.Result = result
+	verified.Valid = result.Valid
+	if !result.Valid {
+		verified.ErrorCode = verification.ErrIndexSignatureInvalid
+		verified.Error = "tool index signature was not accepted: " + result.Error
+	}
+	return verified, nil
+}
+
+// Entry returns the entry for the tool named name, if the index lists one.
+func (v *VerifiedToolIndex) Entry(name string) (ToolIndexEntry, bool) {
+	for _, entry := range v.Tools {
+		if entry.Name == name {
+			return entry, true
+		}
+	}
+	return ToolIndexEntry{}, false
+}
+
+// FetchAndVerifyEntry downloads the schema of entry, which must be listed
+// in the index, checks that its canonical hash is the declared one and
+// verifies the entry's signature with the index's workflow, under the tool
+// ID derived from the domain and the entry's name. Failures to download
+// the schema are errors; failed checks are reported in the result.
+func (v *VerifiedToolIndex) FetchAndVerifyEntry(ctx context.Context, entry ToolIndexEntry) (*ToolIndexEntryResult, error) {
+	result := &ToolIndexEntryResult{Name: entry.Name}
+	if !v.Valid {
+		result.ErrorCode = verification.ErrIndexSignatureInvalid
+		result.Error = "tool index was not accepted; its entries are not trusted"
+		return result, nil
+	}
+	if listed, ok := v.Entry(entry.Name); !ok || listed != entry {
+		return nil, fmt.Errorf("tool %s is not listed in the index as given", entry.Name)
+	}
+	toolID, err := core.DeriveToolID(v.Domain, map[string]interface{}{"name": entry.Name})
+	if err != nil {
+		return nil, err
+	}
+
+	schema, err := v.fetchSchema(ctx, entry.SchemaURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch schema of tool %s: %w", entry.Name, err)
+	}
+	schemaHash, err := CalculateSchemaHash(schema)
+	if err != nil {
+		result.ErrorCode = verification.ErrEntryHashMismatch
+		result.Error = fmt.Sprintf("schema of tool %s could not be canonicalized: %v", entry.Name, err)
+		return result, nil
+	}
+	declared, err := core.ParseSchemaHash(entry.SchemaHash)
+	if err != nil || !bytes.Equal(declared, schemaHash) {
+		result.ErrorCode = verification.ErrEntryHashMismatch
+		result.Error = fmt.Sprintf("schema of tool %s has hash %s, the index declares %s", entry.Name, core.FormatSchemaHash(schemaHash), entry.SchemaHash)
+		return result, nil
+	}
+	result.Schema = schema
+
+	verified, err := v.workflow.VerifyHash(ctx, schemaHash, entry.Signature, toolID, v.Domain, false)
+	if err != nil {
+		return nil, err
+	}
+	result.Result = verified
+	result.Valid = verified.Valid
+	if !verified.Valid {
+		result.ErrorCode = verification.ErrEntrySignatureInvalid
+		result.Error = fmt.Sprintf("signature of tool %s was not accepted: %s", entry.Name, verified.Error)
+	}
+	return result, nil
+}
+
+// fetchSchema downloads the schema at schemaURL, unwrapping a signed
+// schema document.
+func (v *VerifiedToolIndex) fetchSchema(ctx context.Context, schemaURL string) (map[string]interface{}, error) {
+	if err := checkSchemaURL(schemaURL); err != nil {
+		return nil, err
+	}
+	client := v.config.client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", schemaURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("User-Agent", version.UserAgent())
+	requestid.SetHeader(req)
+
+	resp, err := client.Do(req) // #nosec G704 -- URL is from a tool index whose signature verified
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	var schema map[string]interface{}
+	if err := json.NewDecoder(http.MaxBytesReader(nil, resp.Body, v.config.maxBytes)).Decode(&schema); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return nil, fmt.Errorf("schema exceeds %d bytes", tooLarge.Limit)
+		}
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	inner, hasSchema := schema["schema"].(map[string]interface{})
+	_, hasSignature := schema["signature"].(string)
+	if hasSchema && hasSignature {
+		return inner, nil
+	}
+	return schema, nil
+}
+
+// checkSchemaURL accepts absolute http and https URLs.
+func checkSchemaURL(schemaURL string) error {
+	u, err := url.Parse(schemaURL)
+	if err != nil {
+		return fmt.Errorf("invalid schema URL %q: %w", schemaURL, err)
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return fmt.Errorf("schema URL %q must be an absolute http or https URL", schemaURL)
+	}
+	return nil
+}
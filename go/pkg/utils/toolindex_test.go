@@ -0,0 +1,150 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery/discoverytest"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+// toolIndexFixture publishes two signed schemas and a signed index listing
+// them for example.com.
+type toolIndexFixture struct {
+	index    []byte
+	server   *httptest.Server
+	schemas  map[string][]byte
+	workflow *SchemaVerificationWorkflow
+}
+
+func newToolIndexFixture(t *testing.T) *toolIndexFixture {
+	t.Helper()
+	stub := discoverytest.New()
+	key, err := stub.GenerateDomain("example.com", "Example Dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := NewSchemaSigningWorkflow(key.PrivateKeyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := &toolIndexFixture{schemas: map[string][]byte{}}
+	mux := http.NewServeMux()
+	f.server = httptest.NewServer(mux)
+	t.Cleanup(f.server.Close)
+
+	var entries []ToolIndexEntry
+	for _, name := range []string{"add", "subtract"} {
+		name := name
+		schema := map[string]interface{}{"name": name, "type": "object"}
+		signature, err := signer.SignSchema(schema)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry, err := NewToolIndexEntry(name, f.server.URL+"/"+name+".json", schema, signature)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+		body, _ := json.Marshal(map[string]interface{}{"schema": schema, "signature": signature})
+		f.schemas[name] = body
+		mux.HandleFunc("/"+name+".json", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write(f.schemas[name])
+		})
+	}
+	if f.index, err = signer.BuildToolIndex(entries); err != nil {
+		t.Fatalf("BuildToolIndex failed: %v", err)
+	}
+
+	f.workflow, err = NewSchemaVerificationWorkflow(filepath.Join(t.TempDir(), "pins.db"), WithDiscovery(stub))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.workflow.Close() })
+	return f
+}
+
+func (f *toolIndexFixture) verify(t *testing.T, index []byte) *VerifiedToolIndex {
+	t.Helper()
+	verified, err := VerifyToolIndex(context.Background(), index, "example.com", f.workflow, WithToolIndexHTTPClient(f.server.Client()))
+	if err != nil {
+		t.Fatalf("VerifyToolIndex failed: %v", err)
+	}
+	return verified
+}
+
+func TestToolIndexValid(t *testing.T) {
+	f := newToolIndexFixture(t)
+	verified := f.verify(t, f.index)
+	if !verified.Valid || len(verified.Tools) != 2 {
+		t.Fatalf("Expected a valid index of 2 tools, got %+v", verified)
+	}
+
+	for _, entry := range verified.Tools {
+		result, err := verified.FetchAndVerifyEntry(context.Background(), entry)
+		if err != nil {
+			t.Fatalf("FetchAndVerifyEntry(%s) failed: %v", entry.Name, err)
+		}
+		if !result.Valid || result.ErrorCode != "" {
+			t.Errorf("Expected %s to verify, got %+v", entry.Name, result)
+		}
+		if result.Schema["name"] != entry.Name {
+			t.Errorf("Expected the schema of %s, got %v", entry.Name, result.Schema)
+		}
+	}
+
+	if _, err := verified.FetchAndVerifyEntry(context.Background(), ToolIndexEntry{Name: "multiply", SchemaURL: f.server.URL + "/add.json"}); err == nil {
+		t.Error("Expected an entry missing from the index to be refused")
+	}
+}
+
+func TestToolIndexSwappedSchema(t *testing.T) {
+	f := newToolIndexFixture(t)
+	verified := f.verify(t, f.index)
+
+	// The server now answers with the other tool's schema, correctly signed
+	f.schemas["add"] = f.schemas["subtract"]
+	entry, _ := verified.Entry("add")
+	result, err := verified.FetchAndVerifyEntry(context.Background(), entry)
+	if err != nil {
+		t.Fatalf("FetchAndVerifyEntry failed: %v", err)
+	}
+	if result.Valid || result.ErrorCode != verification.ErrEntryHashMismatch || result.Schema != nil {
+		t.Errorf("Expected %s, got %+v", verification.ErrEntryHashMismatch, result)
+	}
+}
+
+func TestToolIndexTampered(t *testing.T) {
+	f := newToolIndexFixture(t)
+
+	// Point an entry at another URL after the index was signed
+	var index ToolIndex
+	if err := json.Unmarshal(f.index, &index); err != nil {
+		t.Fatal(err)
+	}
+	index.Tools[0].SchemaURL = f.server.URL + "/subtract.json"
+	tampered, _ := json.Marshal(index)
+
+	verified := f.verify(t, tampered)
+	if verified.Valid || verified.ErrorCode != verification.ErrIndexSignatureInvalid {
+		t.Fatalf("Expected %s, got %+v", verification.ErrIndexSignatureInvalid, verified)
+	}
+	result, err := verified.FetchAndVerifyEntry(context.Background(), verified.Tools[0])
+	if err != nil {
+		t.Fatalf("FetchAndVerifyEntry failed: %v", err)
+	}
+	if result.Valid || result.ErrorCode != verification.ErrIndexSignatureInvalid {
+		t.Errorf("Expected entries of a tampered index to be refused, got %+v", result)
+	}
+
+	index.Signature = ""
+	unsigned, _ := json.Marshal(index)
+	if verified := f.verify(t, unsigned); verified.Valid || verified.ErrorCode != verification.ErrIndexSignatureInvalid {
+		t.Errorf("Expected an unsigned index to be refused, got %+v", verified)
+	}
+}
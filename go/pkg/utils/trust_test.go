@@ -0,0 +1,122 @@
+package utils
+
+import (
+	"context"
+	"log/slog"
+	"path/filepath"
+	"testing"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery/discoverytest"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/interactive"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/pinning"
+)
+
+func TestVerifySchemaTrustDecision(t *testing.T) {
+	keyManager := crypto.NewKeyManager()
+	privateKey, err := keyManager.GenerateKeypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeyPEM, _ := keyManager.ExportPublicKeyPEM(&privateKey.PublicKey)
+	privateKeyPEM, _ := keyManager.ExportPrivateKeyPEM(privateKey)
+	signer, err := NewSchemaSigningWorkflow(privateKeyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := map[string]interface{}{"type": "object", "name": "refund"}
+	signature, err := signer.SignSchema(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stub := discoverytest.New()
+	stub.SetDomain("example.com", &discovery.WellKnownResponse{
+		SchemaVersion: "1.2",
+		DeveloperName: "Test Developer",
+		PublicKeyPEM:  publicKeyPEM,
+	})
+	answer := func(decision interactive.UserDecision) interactive.InteractiveHandler {
+		return interactive.NewCallbackInteractiveHandler(func(*interactive.PromptContext) (interactive.UserDecision, error) {
+			return decision, nil
+		}, nil, nil)
+	}
+
+	tests := []struct {
+		name    string
+		req     VerifyRequest
+		prePin  func(*pinning.KeyPinning) error
+		want    pinning.TrustDecision
+		wantPin bool
+	}{
+		{name: "auto-pin", req: VerifyRequest{AutoPin: true}, want: pinning.TrustAutoPinned, wantPin: true},
+		{name: "interactive accept", req: VerifyRequest{Handler: answer(interactive.UserDecisionAccept)}, want: pinning.TrustInteractiveAccept, wantPin: true},
+		{name: "interactive always trust", req: VerifyRequest{Handler: answer(interactive.UserDecisionAlwaysTrust)}, want: pinning.TrustInteractiveAlwaysTrust, wantPin: true},
+		{name: "temporary accept", req: VerifyRequest{Handler: answer(interactive.UserDecisionTemporaryAccept)}, want: pinning.TrustTemporaryAccept},
+		{name: "pre-pinned", want: pinning.TrustPrePinned, wantPin: true,
+			prePin: func(k *pinning.KeyPinning) error {
+				return k.PinKey("example.com/payments/refund", publicKeyPEM, "example.com", "Test Developer")
+			}},
+		{name: "namespace pin", want: pinning.TrustNamespacePin, wantPin: true,
+			prePin: func(k *pinning.KeyPinning) error {
+				return k.PinKeyForNamespace("example.com/payments/", publicKeyPEM, "example.com", "Test Developer")
+			}},
+		{name: "no pin", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logs := &recordingHandler{}
+			workflow, err := NewSchemaVerificationWorkflow(filepath.Join(t.TempDir(), "pins.db"), WithDiscovery(stub), WithLogger(slog.New(logs)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer workflow.Close()
+			if tt.prePin != nil {
+				if err := tt.prePin(workflow.pinning); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			req := tt.req
+			req.Schema, req.Signature, req.ToolID, req.Domain = schema, signature, "example.com/payments/refund", "example.com"
+			result, err := workflow.VerifySchemaWithOptions(context.Background(), req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !result.Valid {
+				t.Fatalf("Expected a valid result, got %s: %s", result.ErrorCode, result.Error)
+			}
+			if result.TrustDecision != tt.want || result.Pinned != tt.wantPin {
+				t.Errorf("Expected trust decision %q (pinned=%v), got %q (pinned=%v)", tt.want, tt.wantPin, result.TrustDecision, result.Pinned)
+			}
+
+			// The log record of the verification carries the same value
+			attrs, ok := logs.find("schema verified")
+			if !ok {
+				t.Fatal("Expected a schema verified record")
+			}
+			if got := attrs["trust_decision"].String(); tt.want != "" && got != string(tt.want) {
+				t.Errorf("Expected the log record to carry %q, got %q", tt.want, got)
+			}
+			if _, logged := attrs["trust_decision"]; tt.want == "" && logged {
+				t.Error("Expected no trust decision to be logged")
+			}
+
+			// A later verification uses the pin made, if any
+			if tt.wantPin {
+				again, err := workflow.VerifySchema(context.Background(), schema, signature, req.ToolID, req.Domain, false)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := pinning.TrustPrePinned
+				if tt.want == pinning.TrustNamespacePin {
+					want = pinning.TrustNamespacePin
+				}
+				if again.TrustDecision != want {
+					t.Errorf("Expected %q on the next verification, got %q", want, again.TrustDecision)
+				}
+			}
+		})
+	}
+}
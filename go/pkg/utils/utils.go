@@ -4,14 +4,31 @@ package utils
 import (
 	"context"
 	"crypto/ecdsa"
+	"crypto/sha256"
+	"errors"
 	"fmt"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/ThirdKeyAi/schemapin/go/internal/logging"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/bundle"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/interactive"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/pinning"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/provenance"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/requestid"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/revocation"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
 )
 
 // SchemaSigningWorkflow provides high-level signing operations
@@ -22,8 +39,19 @@ type SchemaSigningWorkflow struct {
 	core             *core.SchemaPinCore
 }
 
+// SigningOption configures a SchemaSigningWorkflow.
+type SigningOption func(*SchemaSigningWorkflow)
+
+// WithSigningValidationLimits sets the limits schemas are checked against
+// before they are signed. The default is core.DefaultValidationLimits.
+func WithSigningValidationLimits(limits core.ValidationLimits) SigningOption {
+	return func(s *SchemaSigningWorkflow) {
+		s.core = core.NewSchemaPinCore(core.WithValidationLimits(limits))
+	}
+}
+
 // NewSchemaSigningWorkflow creates a new signing workflow
-func NewSchemaSigningWorkflow(privateKeyPEM string) (*SchemaSigningWorkflow, error) {
+func NewSchemaSigningWorkflow(privateKeyPEM string, opts ...SigningOption) (*SchemaSigningWorkflow, error) {
 	if privateKeyPEM == "" {
 		return nil, fmt.Errorf("private key PEM cannot be empty")
 	}
@@ -34,31 +62,53 @@ func NewSchemaSigningWorkflow(privateKeyPEM string) (*SchemaSigningWorkflow, err
 		return nil, fmt.Errorf("failed to load private key: %w", err)
 	}
 
-	return &SchemaSigningWorkflow{
+	s := &SchemaSigningWorkflow{
 		privateKey:       privateKey,
 		keyManager:       keyManager,
 		signatureManager: crypto.NewSignatureManager(),
 		core:             core.NewSchemaPinCore(),
-	}, nil
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s, nil
 }
 
 // SignSchema signs a schema and returns the base64-encoded signature
 func (s *SchemaSigningWorkflow) SignSchema(schema map[string]interface{}) (string, error) {
+	_, signature, err := s.signSchema(schema, "")
+	return signature, err
+}
+
+// SignSchemaExpectingHash signs schema like SignSchema, but only if its
+// canonical hash is expectedHash (sha256:<hex>), e.g. one recorded by a
+// build job. Otherwise it returns a *core.HashMismatchError.
+func (s *SchemaSigningWorkflow) SignSchemaExpectingHash(schema map[string]interface{}, expectedHash string) (string, error) {
+	_, signature, err := s.signSchema(schema, expectedHash)
+	return signature, err
+}
+
+// signSchema validates and signs schema, returning its canonical hash along
+// with the signature. A non-empty expectedHash must match the hash.
+func (s *SchemaSigningWorkflow) signSchema(schema map[string]interface{}, expectedHash string) ([]byte, string, error) {
 	if err := s.core.ValidateSchema(schema); err != nil {
-		return "", fmt.Errorf("schema validation failed: %w", err)
+		return nil, "", fmt.Errorf("schema validation failed: %w", err)
 	}
 
 	schemaHash, err := s.core.CanonicalizeAndHash(schema)
 	if err != nil {
-		return "", fmt.Errorf("failed to canonicalize and hash schema: %w", err)
+		return nil, "", fmt.Errorf("failed to canonicalize and hash schema: %w", err)
+	}
+	if err := core.CheckExpectedHash(expectedHash, schemaHash); err != nil {
+		return nil, "", fmt.Errorf("refusing to sign schema: %w", err)
 	}
 
 	signature, err := s.signatureManager.SignSchemaHash(schemaHash, s.privateKey)
 	if err != nil {
-		return "", fmt.Errorf("failed to sign schema hash: %w", err)
+		return nil, "", fmt.Errorf("failed to sign schema hash: %w", err)
 	}
 
-	return signature, nil
+	return schemaHash, signature, nil
 }
 
 // GetPublicKeyPEM returns the PEM-encoded public key for this signing workflow
@@ -66,13 +116,58 @@ func (s *SchemaSigningWorkflow) GetPublicKeyPEM() (string, error) {
 	return s.keyManager.ExportPublicKeyPEM(&s.privateKey.PublicKey)
 }
 
-// SchemaVerificationWorkflow provides high-level verification operations
+// SchemaVerificationWorkflow provides high-level verification operations.
+//
+// A workflow is safe for concurrent use and is meant to be shared, e.g. by
+// all request handlers of a server. Its configuration is fixed when it is
+// created; per-call settings go in a VerifyRequest. Pins are written in
+// single transactions of the pinning database, so concurrent first uses of
+// a tool cannot replace each other's pin, and prompts to interactive
+// handlers are shown one at a time.
 type SchemaVerificationWorkflow struct {
 	pinning          *pinning.KeyPinning
-	discovery        *discovery.PublicKeyDiscovery
+	discovery        discovery.Discoverer
 	keyManager       *crypto.KeyManager
 	signatureManager *crypto.SignatureManager
 	core             *core.SchemaPinCore
+	logger           *slog.Logger
+	clock            clock.Clock
+	discoveryOpts    []discovery.Option
+
+	offline                bool
+	strictRevocation       bool
+	strictDiscoveryVersion bool
+	legacySignatures       bool
+	localRevocations       map[string]*revocation.RevocationDocument
+	trustBundle            *bundle.SchemaPinTrustBundle
+	boundary               *pinning.TrustBoundary
+	handler                interactive.InteractiveHandler
+	policy                 *verification.Policy
+	derivedToolIDs         bool
+	requirePrePinned       bool
+	dryRun                 bool
+	readOnlyPins           bool
+	storeKey               []byte
+	queuedDecisions        bool
+	pendingStore           *interactive.PendingDecisionStore
+	provenance             *provenance.Config
+	timings                bool
+	prefetchTTL            time.Duration
+	maxSignatureAge        time.Duration
+	requiredSignatures     int
+	requiredSigners        []string
+	signerKeys             verification.SignerKeySet
+
+	// ownDiscovery is set when the workflow created its discovery client
+	ownDiscovery bool
+	// prefetched holds the documents fetched by Prefetch, and
+	// prefetchClient is the client they are fetched with
+	prefetched     prefetchCache
+	prefetchOnce   sync.Once
+	prefetchClient discovery.Discoverer
+
+	// promptMu serializes prompts to interactive handlers
+	promptMu sync.Mutex
 }
 
 // VerificationResult contains the result of schema verification
@@ -81,40 +176,219 @@ type VerificationResult struct {
 	Pinned        bool                   `json:"pinned"`
 	FirstUse      bool                   `json:"first_use"`
 	Error         string                 `json:"error,omitempty"`
+	ErrorCode     string                 `json:"error_code,omitempty"`
 	DeveloperInfo map[string]string      `json:"developer_info,omitempty"`
 	Metadata      map[string]interface{} `json:"metadata,omitempty"`
+	Warnings      []string               `json:"warnings,omitempty"`
+	// WouldHave describes, in dry run (see WithDryRun), the writes and
+	// prompts that were suppressed, e.g. "would pin key sha256:... for
+	// tool weather" or "would prompt user: first_time_key for tool
+	// weather".
+	WouldHave []string `json:"would_have,omitempty"`
+	// PolicyRule names the verification.Policy rule that failed
+	// verification, if one did.
+	PolicyRule string `json:"policy_rule,omitempty"`
+	// PolicyFindings lists the policy rules triggered, in evaluation
+	// order, with the severity applied.
+	PolicyFindings []verification.PolicyFinding `json:"policy_findings,omitempty"`
+	// SchemaHash is sha256:<hex> of the canonical schema (or the hash
+	// given to VerifyHash) that was verified. It is set on every result
+	// that got as far as hashing, including a failed signature, so that
+	// callers can key caches by exactly what was verified.
+	SchemaHash string `json:"schema_hash,omitempty"`
+	// PendingDecisionID is the ID of the prompt queued for the tool when
+	// the result failed with ErrDecisionPending (see WithQueuedDecisions).
+	PendingDecisionID string `json:"pending_decision_id,omitempty"`
+	// TrustDecision is why the key was trusted: the pin it matched, or
+	// how it was pinned or accepted on first use. It is empty when no pin
+	// was consulted or made, e.g. in dry run.
+	TrustDecision pinning.TrustDecision `json:"trust_decision,omitempty"`
+	// Cause is the error behind a failed result: a *schemaerr.Error whose
+	// Kind matches ErrorCode, wrapping the underlying failure if there is
+	// one. RetryVerification uses it to decide whether to retry.
+	Cause error `json:"-"`
+}
+
+// Err returns the error behind a failed result, or nil. It can be
+// classified with errors.Is against the schemaerr kinds:
+//
+//	if errors.Is(result.Err(), schemaerr.ErrKeyRevoked) { ... }
+func (r *VerificationResult) Err() error {
+	return r.Cause
+}
+
+// fail marks the result as failed with a kind of error, taking its error
+// code from the kind. cause is the underlying failure, if any.
+func (r *VerificationResult) fail(kind *schemaerr.Kind, message string, cause error) {
+	r.Error = message
+	r.ErrorCode = kind.WorkflowCode()
+	r.Cause = &schemaerr.Error{Kind: kind, Message: message, Err: cause}
 }
 
 // NewSchemaVerificationWorkflow creates a new verification workflow
-func NewSchemaVerificationWorkflow(pinningDBPath string) (*SchemaVerificationWorkflow, error) {
+func NewSchemaVerificationWorkflow(pinningDBPath string, opts ...WorkflowOption) (*SchemaVerificationWorkflow, error) {
 	if pinningDBPath == "" {
 		return nil, fmt.Errorf("pinning database path cannot be empty")
 	}
-	keyPinning, err := pinning.NewKeyPinning(pinningDBPath, pinning.PinningModeInteractive, nil)
+	s := newSchemaVerificationWorkflow(opts)
+	if s.queuedDecisions && s.readOnlyPins {
+		return nil, fmt.Errorf("decisions cannot be queued with a read-only pinning database")
+	}
+	pinningOpts := []pinning.Option{pinning.WithLogger(s.logger), pinning.WithTrustBoundary(s.boundary), pinning.WithClock(s.clock),
+		pinning.WithDryRun(s.dryRun), pinning.WithReadOnly(s.readOnlyPins)}
+	if s.storeKey != nil {
+		pinningOpts = append(pinningOpts, pinning.WithStoreEncryption(s.storeKey))
+	}
+	keyPinning, err := pinning.NewKeyPinning(pinningDBPath, pinning.PinningModeInteractive, nil, pinningOpts...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to initialize key pinning: %w", err)
 	}
-
-	return &SchemaVerificationWorkflow{
-		pinning:          keyPinning,
-		discovery:        discovery.NewPublicKeyDiscovery(),
-		keyManager:       crypto.NewKeyManager(),
-		signatureManager: crypto.NewSignatureManager(),
-		core:             core.NewSchemaPinCore(),
-	}, nil
+	s.setPinning(keyPinning)
+	return s, nil
 }
 
 // NewSchemaVerificationWorkflowWithPinning creates a new verification workflow with existing pinning
-func NewSchemaVerificationWorkflowWithPinning(keyPinning *pinning.KeyPinning) *SchemaVerificationWorkflow {
-	return &SchemaVerificationWorkflow{
-		pinning:          keyPinning,
-		discovery:        discovery.NewPublicKeyDiscovery(),
+func NewSchemaVerificationWorkflowWithPinning(keyPinning *pinning.KeyPinning, opts ...WorkflowOption) *SchemaVerificationWorkflow {
+	s := newSchemaVerificationWorkflow(opts)
+	s.setPinning(keyPinning)
+	return s
+}
+
+func newSchemaVerificationWorkflow(opts []WorkflowOption) *SchemaVerificationWorkflow {
+	s := &SchemaVerificationWorkflow{
 		keyManager:       crypto.NewKeyManager(),
 		signatureManager: crypto.NewSignatureManager(),
 		core:             core.NewSchemaPinCore(),
+		logger:           logging.Discard(),
+		clock:            clock.Real,
+		prefetchTTL:      DefaultPrefetchTTL,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// setPinning sets the workflow's key pinning and, unless WithDiscovery gave
+// one, creates its discovery client, which caches revocation and
+// .well-known documents in the pinning database, or in dry run and for a
+// read-only database only reads revocation documents from it.
+func (s *SchemaVerificationWorkflow) setPinning(keyPinning *pinning.KeyPinning) {
+	s.pinning = keyPinning
+	s.setQueuedHandler()
+	if s.discovery != nil {
+		return
+	}
+	discoveryOpts := []discovery.Option{discovery.WithLogger(s.logger)}
+	switch {
+	case keyPinning == nil:
+	case s.dryRun || keyPinning.ReadOnly():
+		discoveryOpts = append(discoveryOpts, discovery.WithRevocationCache(newReadOnlyRevocationCache(keyPinning)))
+	default:
+		discoveryOpts = append(discoveryOpts, discovery.WithRevocationCache(keyPinning), discovery.WithDocumentCache(keyPinning))
+	}
+	s.discovery = discovery.NewPublicKeyDiscovery(append(discoveryOpts, s.discoveryOpts...)...)
+	s.ownDiscovery = true
+}
+
+// WithDiscoveryOptions configures the workflow's discovery client, e.g.
+// with discovery.WithRateLimit or discovery.WithCircuitBreaker. Requests
+// the client refuses fail verification with ErrDiscoveryRateLimited or
+// ErrDiscoveryCircuitOpen for keys that are not yet pinned.
+func WithDiscoveryOptions(opts ...discovery.Option) WorkflowOption {
+	return func(s *SchemaVerificationWorkflow) {
+		s.discoveryOpts = append(s.discoveryOpts, opts...)
+	}
+}
+
+// WithDiscovery makes the workflow discover keys through d instead of a
+// PublicKeyDiscovery of its own, e.g. through a discoverytest.Stub in
+// tests. WithDiscoveryOptions is then ignored, and documents are cached
+// only if d caches them.
+func WithDiscovery(d discovery.Discoverer) WorkflowOption {
+	return func(s *SchemaVerificationWorkflow) {
+		s.discovery = d
+	}
+}
+
+// DiscoveryProtectionStats returns the rate limiter and circuit breaker
+// counters of the workflow's discovery client, or zero counters if the
+// client given to WithDiscovery keeps none.
+func (s *SchemaVerificationWorkflow) DiscoveryProtectionStats() discovery.ProtectionStats {
+	if p, ok := s.discovery.(interface {
+		ProtectionStats() discovery.ProtectionStats
+	}); ok {
+		return p.ProtectionStats()
+	}
+	return discovery.ProtectionStats{}
+}
+
+// WithLogger routes verification diagnostics to logger: discovery attempts,
+// pinned-key use, revocation checks, results and retries. The logger is
+// also passed to the workflow's discovery client and, when the workflow
+// opens its own pinning database, to key pinning. By default nothing is
+// logged.
+func WithLogger(logger *slog.Logger) WorkflowOption {
+	return func(s *SchemaVerificationWorkflow) {
+		s.logger = logging.OrDiscard(logger)
+	}
+}
+
+// WithClock sets the time source for pin timestamps when the workflow opens
+// its own pinning database, and for the expiry of prefetched documents.
+// The default is clock.Real.
+func WithClock(c clock.Clock) WorkflowOption {
+	return func(s *SchemaVerificationWorkflow) {
+		s.clock = clock.OrReal(c)
+	}
+}
+
+// WithDerivedToolIDs derives the tool ID of calls that pass an empty one
+// from the schema's name and the domain, with core.DeriveToolID, so that
+// pins are keyed consistently. Verification fails with ErrSchemaInvalid
+// when the schema has no name, including calls to VerifyHash. Explicit
+// tool IDs are used as given.
+func WithDerivedToolIDs(derive bool) WorkflowOption {
+	return func(s *SchemaVerificationWorkflow) {
+		s.derivedToolIDs = derive
+	}
+}
+
+// WithValidationLimits sets the size and complexity limits schemas are
+// checked against before they are canonicalized. Schemas that exceed them
+// fail with ErrSchemaTooComplex. The default is
+// core.DefaultValidationLimits; core.Unlimited() turns the checks off.
+func WithValidationLimits(limits core.ValidationLimits) WorkflowOption {
+	return func(s *SchemaVerificationWorkflow) {
+		s.core = core.NewSchemaPinCore(core.WithValidationLimits(limits))
 	}
 }
 
+// WithTimings adds a breakdown of where each verification spent its time
+// to the result's metadata under verification.MetadataTimings: a
+// map[string]int64 of microseconds per step (discovery_fetch,
+// revocation_check, pin_lookup, canonicalize, signature_verify,
+// pin_update) and the total. Steps that did not run are absent. Time spent
+// waiting on an interactive handler counts only towards the total.
+func WithTimings(enabled bool) WorkflowOption {
+	return func(s *SchemaVerificationWorkflow) {
+		s.timings = enabled
+	}
+}
+
+// loggerFor returns the workflow's logger with the request ID of ctx, if
+// any, attached to every record.
+func (s *SchemaVerificationWorkflow) loggerFor(ctx context.Context) *slog.Logger {
+	logger := s.logger
+	if s.dryRun {
+		logger = logger.With("dry_run", true)
+	}
+	if id, ok := requestid.FromContext(ctx); ok {
+		return logger.With(logging.KeyRequestID, id)
+	}
+	return logger
+}
+
 // Close closes the verification workflow and releases resources
 func (s *SchemaVerificationWorkflow) Close() error {
 	if s.pinning != nil {
@@ -123,8 +397,138 @@ func (s *SchemaVerificationWorkflow) Close() error {
 	return nil
 }
 
+// VerifyRequest is one verification by VerifySchemaWithOptions. The
+// fields after Domain override the workflow's configuration for this call
+// only.
+type VerifyRequest struct {
+	Schema map[string]interface{}
+	// SchemaHash, when non-nil, is the 32-byte SHA-256 digest of the
+	// canonical schema, verified in place of Schema (see VerifyHash).
+	SchemaHash []byte
+	// Signature is the base64-encoded signature over Schema.
+	Signature string
+	// Signatures is the signatures array of a multi-signature schema,
+	// checked in place of Signature when it has entries (see
+	// WithRequiredSignatures).
+	Signatures []verification.SignatureEntry
+	// SignedAt is the RFC 3339 signed_at of the signature, if known. It is
+	// checked against the domain's minimum_signed_at and, with
+	// WithMaxSignatureAge, the signature's age. signed_at is not covered
+	// by the signature, so these checks catch old documents re-served as
+	// they were published, not ones whose signed_at was rewritten.
+	SignedAt string
+	// ToolID names the tool its key is pinned under. When empty and the
+	// workflow has WithDerivedToolIDs, it is derived from Schema with
+	// core.DeriveToolID.
+	ToolID string
+	Domain string
+
+	// AutoPin pins a key seen for the first time without asking.
+	AutoPin bool
+	// Offline, when non-nil, replaces the workflow's WithOfflineMode
+	// setting.
+	Offline *bool
+	// Handler, when non-nil, replaces the workflow's
+	// WithInteractiveHandler. The handler is asked whether to trust a key
+	// seen for the first time, and takes precedence over AutoPin.
+	Handler interactive.InteractiveHandler
+	// Policy, when non-nil, replaces the workflow's WithPolicy.
+	Policy *verification.Policy
+	// Reconsider clears a recorded rejection of the key seen for the first
+	// time (see pinning.KeyPinning.ClearRejection), so that it is prompted
+	// for or pinned again instead of failing with ErrKeyPreviouslyRejected.
+	Reconsider bool
+	// Provenance is the provenance attached to the signed schema, checked
+	// when the workflow has WithProvenance.
+	Provenance *provenance.Envelope
+}
+
 // VerifySchema verifies a signed schema with optional auto-pinning
 func (s *SchemaVerificationWorkflow) VerifySchema(ctx context.Context, schema map[string]interface{}, signatureB64, toolID, domain string, autoPin bool) (*VerificationResult, error) {
+	return s.VerifySchemaWithOptions(ctx, VerifyRequest{
+		Schema:    schema,
+		Signature: signatureB64,
+		ToolID:    toolID,
+		Domain:    domain,
+		AutoPin:   autoPin,
+	})
+}
+
+// VerifyHash verifies a signature over a schema hash computed elsewhere,
+// e.g. by a registry that stores canonical hashes, without the schema
+// itself. It runs the same discovery, revocation, pinning and signature
+// checks as VerifySchema and returns the same result for the same hash.
+// schemaHash must be 32 bytes; anything else fails with ErrSchemaInvalid.
+func (s *SchemaVerificationWorkflow) VerifyHash(ctx context.Context, schemaHash []byte, signatureB64, toolID, domain string, autoPin bool) (*VerificationResult, error) {
+	return s.VerifySchemaWithOptions(ctx, VerifyRequest{
+		SchemaHash: schemaHash,
+		Signature:  signatureB64,
+		ToolID:     toolID,
+		Domain:     domain,
+		AutoPin:    autoPin,
+	})
+}
+
+// VerifySchemaWithOptions verifies a signed schema as VerifySchema does,
+// with the per-call settings of req. The workflow itself is not changed,
+// so calls with different settings can run concurrently.
+//
+// Each verification has a request ID: the one ctx carries (see
+// requestid.NewContext), or a new UUID. It is sent on discovery and
+// revocation requests, recorded in the pin's verification history and
+// the workflow's logs, and returned as the "request_id" metadata.
+func (s *SchemaVerificationWorkflow) VerifySchemaWithOptions(ctx context.Context, req VerifyRequest) (*VerificationResult, error) {
+	start := time.Now()
+	ctx, requestID := requestid.Ensure(ctx)
+	timer := verification.NewTimer(s.timings)
+	result, err := s.verifySchema(ctx, req, timer)
+	if err != nil || result == nil {
+		return result, err
+	}
+	elapsed := time.Since(start)
+	result.Metadata["request_id"] = requestID
+	timer.Stop(verification.TimingTotal, start)
+	result.Metadata = timer.Record(result.Metadata)
+
+	toolID, domain := req.ToolID, req.Domain
+	if derived, ok := result.Metadata["tool_id"].(string); ok {
+		toolID = derived
+	}
+	attrs := []any{
+		logging.KeyToolID, toolID,
+		logging.KeyDomain, domain,
+		"pinned", result.Pinned,
+		"first_use", result.FirstUse,
+		logging.KeyDuration, elapsed,
+	}
+	if result.TrustDecision != "" {
+		attrs = append(attrs, "trust_decision", result.TrustDecision)
+	}
+	if result.Valid {
+		s.loggerFor(ctx).InfoContext(ctx, "schema verified", attrs...)
+	} else {
+		attrs = append(attrs, logging.KeyErrorCode, result.ErrorCode, logging.KeyError, result.Error)
+		s.loggerFor(ctx).WarnContext(ctx, "schema verification failed", attrs...)
+	}
+	return result, nil
+}
+
+func (s *SchemaVerificationWorkflow) verifySchema(ctx context.Context, req VerifyRequest, timer *verification.Timer) (*VerificationResult, error) {
+	signatureB64, toolID, domain := req.Signature, req.ToolID, req.Domain
+	offline := s.offline
+	if req.Offline != nil {
+		offline = *req.Offline
+	}
+	handler := s.handler
+	if req.Handler != nil {
+		handler = req.Handler
+	}
+	policy := s.policy
+	if req.Policy != nil {
+		policy = req.Policy
+	}
+	eval := verification.NewPolicyEvaluation(policy)
+
 	result := &VerificationResult{
 		Valid:    false,
 		Pinned:   false,
@@ -132,106 +536,332 @@ func (s *SchemaVerificationWorkflow) VerifySchema(ctx context.Context, schema ma
 		Metadata: make(map[string]interface{}),
 	}
 
-	// Validate schema first
-	if err := s.core.ValidateSchema(schema); err != nil {
-		result.Error = fmt.Sprintf("schema validation failed: %v", err)
+	// candidateKeyPEM is the key being verified against, once known, so a
+	// failure can name its fingerprint
+	var candidateKeyPEM string
+	defer func() {
+		var failure *schemaerr.Error
+		if !errors.As(result.Cause, &failure) {
+			return
+		}
+		failure.Domain, failure.ToolID = domain, toolID
+		if candidateKeyPEM != "" {
+			failure.Fingerprint, _ = s.keyManager.CalculateKeyFingerprintFromPEM(candidateKeyPEM)
+		}
+	}()
+
+	// A domain that is no trust identity at all, such as one with a ".."
+	// path prefix, is refused before anything is looked up under it
+	if _, err := core.NormalizeDomain(domain); err != nil {
+		result.fail(schemaerr.ErrDomainBlocked, err.Error(), err)
 		return result, nil
 	}
 
-	// Canonicalize and hash schema
-	schemaHash, err := s.core.CanonicalizeAndHash(schema)
+	if toolID == "" && s.derivedToolIDs {
+		derived, err := core.DeriveToolID(domain, req.Schema)
+		if err != nil {
+			result.fail(schemaerr.ErrSchemaInvalid, fmt.Sprintf("cannot derive tool ID: %v", err), err)
+			return result, nil
+		}
+		toolID = derived
+		result.Metadata["tool_id"] = toolID
+	}
+
+	t := timer.Start()
+	schemaHash, err := s.schemaHash(req)
+	timer.Stop(verification.TimingCanonicalize, t)
 	if err != nil {
-		result.Error = fmt.Sprintf("failed to canonicalize schema: %v", err)
+		kind := schemaerr.ErrSchemaInvalid
+		if errors.Is(err, schemaerr.ErrSchemaTooComplex) {
+			kind = schemaerr.ErrSchemaTooComplex
+		}
+		result.fail(kind, err.Error(), err)
 		return result, nil
 	}
+	result.SchemaHash = core.FormatSchemaHash(schemaHash)
 
-	// Check for pinned key
-	pinnedKeyPEM, err := s.pinning.GetPinnedKey(toolID)
+	// The trust boundary applies before any pin or discovery
+	if err := s.boundary.Check(domain); err != nil {
+		result.fail(schemaerr.ErrDomainBlocked, err.Error(), err)
+		return result, nil
+	}
+	if eval.CheckDomain(domain) {
+		result.failPolicy(eval, schemaerr.ErrDomainBlocked, "")
+		return result, nil
+	}
+
+	// Check for a key pinned for the tool or a namespace it is under
+	t = timer.Start()
+	pinnedInfo, pinMatch, err := s.pinning.ResolvePin(toolID)
+	timer.Stop(verification.TimingPinLookup, t)
 	if err != nil {
-		result.Error = fmt.Sprintf("failed to check pinned key: %v", err)
+		result.fail(schemaerr.ErrPinStoreCorrupt, fmt.Sprintf("failed to check pinned key: %v", err), err)
+		return result, nil
+	}
+	if pinMatch != "" {
+		result.Metadata["pin_match"] = string(pinMatch)
+	}
+	if pinMatch == pinning.PinMatchNamespace {
+		result.Metadata["pin_namespace"] = pinnedInfo.ToolID
+		// A namespace pin only vouches for tools of the domain it was
+		// made for
+		if !core.SameDomain(pinnedInfo.Domain, domain) {
+			result.fail(schemaerr.ErrKeyPinMismatch, fmt.Sprintf("tool %s is under namespace %s, pinned for domain %s", toolID, pinnedInfo.ToolID, pinnedInfo.Domain), nil)
+			return result, nil
+		}
+	} else if pinnedInfo != nil && pinnedInfo.Domain != "" && !core.SameDomain(pinnedInfo.Domain, domain) {
+		// Nor does a tool's own pin: a key pinned for one tenant of a
+		// platform must not verify a schema attributed to another
+		result.fail(schemaerr.ErrKeyPinMismatch, fmt.Sprintf("tool %s is pinned for domain %s, not %s", toolID, pinnedInfo.Domain, domain), nil)
 		return result, nil
 	}
 
-	var publicKeyPEM string
+	var publicKeyPEM, keyScope string
 	var publicKey *ecdsa.PublicKey
+	// discovered is the .well-known document in use, if any, whose
+	// minimum_signed_at applies once the signature has verified
+	var discovered *discovery.WellKnownResponse
+
+	if pinnedInfo != nil && pinnedInfo.PublicKeyPEM != "" {
+		pinnedKeyPEM := pinnedInfo.PublicKeyPEM
+		keyScope = pinnedInfo.KeyScope
+		candidateKeyPEM = pinnedKeyPEM
+		result.TrustDecision = pinning.TrustForPinMatch(pinMatch)
+		// Every outcome from here on counts in the pin's statistics
+		defer func() {
+			t := timer.Start()
+			s.recordVerification(ctx, result, toolID)
+			timer.Stop(verification.TimingPinUpdate, t)
+		}()
+		s.loggerFor(ctx).DebugContext(ctx, "using pinned key",
+			logging.KeyToolID, toolID,
+			logging.KeyDomain, domain,
+			"offline", offline)
+
+		t = timer.Start()
+		revocationChecked, kind, message := s.checkLocalRevocation(domain, pinnedKeyPEM, schemaHash)
+		timer.Stop(verification.TimingRevocationCheck, t)
+		if kind != nil && revoked(result, eval, kind, message) {
+			return result, nil
+		}
 
-	if pinnedKeyPEM != "" {
-		// Use pinned key, but check if it's been revoked
-		isNotRevoked, err := s.discovery.ValidateKeyNotRevoked(ctx, pinnedKeyPEM, domain)
-		if err != nil {
-			// If we can't check revocation, proceed with caution
-			isNotRevoked = true
+		// Use pinned key, but unless offline check if it's been revoked and
+		// that discovery still resolves the tool to the scope the key was
+		// pinned from. If discovery is unavailable, proceed with caution.
+		var fetchErr error
+		if !offline {
+			t = timer.Start()
+			wellKnown, err := s.fetchDiscovery(ctx, domain)
+			timer.Stop(verification.TimingDiscoveryFetch, t)
+			if redirectBlocked(result, err) {
+				return result, nil
+			}
+			if err == nil {
+				if !s.checkDiscoveryVersion(ctx, result, domain, wellKnown) {
+					return result, nil
+				}
+				discovered = wellKnown
+
+				scoped := wellKnown.KeyForTool(toolID)
+				if scoped.Scope != pinnedInfo.KeyScope {
+					result.fail(schemaerr.ErrKeyPinMismatch, fmt.Sprintf("key scope for tool %s changed from %s to %s", toolID, describeKeyScope(pinnedInfo.KeyScope), describeKeyScope(scoped.Scope)), nil)
+					return result, nil
+				}
+
+				if discovery.CheckKeyRevocation(pinnedKeyPEM, scoped.RevokedKeys) &&
+					revoked(result, eval, schemaerr.ErrKeyRevoked, "pinned public key has been revoked") {
+					return result, nil
+				}
+
+				t = timer.Start()
+				kind, message, err = s.checkRevocationDocument(ctx, wellKnown, pinnedKeyPEM, schemaHash)
+				timer.Stop(verification.TimingRevocationCheck, t)
+				if kind != nil && revoked(result, eval, kind, message) {
+					return result, nil
+				}
+			}
+			if err == nil {
+				revocationChecked = true
+			}
+			fetchErr = err
 		}
 
-		if !isNotRevoked {
-			result.Error = "pinned public key has been revoked"
+		if !s.applyRevocationPolicy(ctx, result, toolID, domain, revocationChecked, fetchErr) {
 			return result, nil
 		}
 
 		publicKey, err = s.keyManager.LoadPublicKeyPEM(pinnedKeyPEM)
 		if err != nil {
-			result.Error = fmt.Sprintf("failed to load pinned public key: %v", err)
+			result.fail(schemaerr.ErrKeyNotFound, fmt.Sprintf("failed to load pinned public key: %v", err), err)
 			return result, nil
 		}
 
 		publicKeyPEM = pinnedKeyPEM
 		result.Pinned = true
 	} else {
-		// First use - discover key
-		discoveredKeyPEM, err := s.discovery.GetPublicKeyPEM(ctx, domain)
-		if err != nil {
-			result.Error = fmt.Sprintf("could not discover public key: %v", err)
+		// Without TOFU an unpinned tool fails before any discovery, prompt
+		// or pin
+		if s.requirePrePinned {
+			result.fail(schemaerr.ErrKeyNotPinned, fmt.Sprintf("no key is pinned for tool %s and keys must be pinned in advance", toolID), nil)
 			return result, nil
 		}
 
+		// First use - take the key scoped to this tool from the trust
+		// bundle if it covers the domain, otherwise from discovery
+		wellKnown := s.bundledDiscovery(domain)
+		provenance, sourceDetail := pinning.ProvenanceBundle, bundleSourceDetail(s.trustBundle)
+		if wellKnown == nil {
+			if offline {
+				result.fail(schemaerr.ErrKeyNotFound, fmt.Sprintf("no pinned key for tool %s and discovery is disabled in offline mode", toolID), nil)
+				return result, nil
+			}
+
+			t = timer.Start()
+			wellKnown, err = s.fetchDiscovery(ctx, domain)
+			timer.Stop(verification.TimingDiscoveryFetch, t)
+			if redirectBlocked(result, err) {
+				return result, nil
+			}
+			if err != nil {
+				result.fail(discoveryFailureKind(err), fmt.Sprintf("could not discover public key: %v", err), err)
+				return result, nil
+			}
+			if !s.checkDiscoveryVersion(ctx, result, domain, wellKnown) {
+				return result, nil
+			}
+			provenance, sourceDetail = pinning.ProvenanceDiscovery, wellKnown.SourceURL
+		}
+		discovered = wellKnown
+		scoped := wellKnown.KeyForTool(toolID)
+		candidateKeyPEM = scoped.PublicKeyPEM
+
 		// Check if key is revoked
-		isNotRevoked, err := s.discovery.ValidateKeyNotRevoked(ctx, discoveredKeyPEM, domain)
-		if err != nil {
-			// If we can't check revocation, proceed with caution
-			isNotRevoked = true
+		if discovery.CheckKeyRevocation(scoped.PublicKeyPEM, scoped.RevokedKeys) &&
+			revoked(result, eval, schemaerr.ErrKeyRevoked, "public key has been revoked") {
+			return result, nil
 		}
 
-		if !isNotRevoked {
-			result.Error = "public key has been revoked"
+		t = timer.Start()
+		_, kind, message := s.checkLocalRevocation(domain, scoped.PublicKeyPEM, schemaHash)
+		timer.Stop(verification.TimingRevocationCheck, t)
+		if kind != nil && revoked(result, eval, kind, message) {
 			return result, nil
 		}
 
-		publicKey, err = s.keyManager.LoadPublicKeyPEM(discoveredKeyPEM)
+		var fetchErr error
+		if !offline {
+			t = timer.Start()
+			kind, message, fetchErr = s.checkRevocationDocument(ctx, wellKnown, scoped.PublicKeyPEM, schemaHash)
+			timer.Stop(verification.TimingRevocationCheck, t)
+			if kind != nil && revoked(result, eval, kind, message) {
+				return result, nil
+			}
+		}
+		if !s.applyRevocationPolicy(ctx, result, toolID, domain, fetchErr == nil, fetchErr) {
+			return result, nil
+		}
+
+		publicKey, err = s.keyManager.LoadPublicKeyPEM(scoped.PublicKeyPEM)
 		if err != nil {
-			result.Error = fmt.Sprintf("failed to load discovered public key: %v", err)
+			result.fail(schemaerr.ErrKeyNotFound, fmt.Sprintf("failed to load discovered public key: %v", err), err)
 			return result, nil
 		}
 
-		publicKeyPEM = discoveredKeyPEM
+		publicKeyPEM = scoped.PublicKeyPEM
+		keyScope = scoped.Scope
 		result.FirstUse = true
 
-		// Get developer info
-		developerInfo, err := s.discovery.GetDeveloperInfo(ctx, domain)
-		if err == nil {
-			result.DeveloperInfo = developerInfo
+		// Developer info comes from the document already fetched
+		developerInfo := wellKnown.DeveloperInfo()
+		if scoped.Scope != "" && scoped.DeveloperName != "" {
+			developerInfo["developer_name"] = scoped.DeveloperName
+		}
+		result.DeveloperInfo = developerInfo
+		if developerInfo["contact_verified"] == "false" {
+			result.Warnings = append(result.Warnings, WarningContactUnverified)
 		}
 
-		// Auto-pin if requested
-		if autoPin {
-			developerName := ""
-			if result.DeveloperInfo != nil {
-				if name, ok := result.DeveloperInfo["developer_name"]; ok {
-					developerName = name
-				}
-			}
+		// A policy requiring pinned keys rejects the key before it can be
+		// trusted or pinned
+		if eval.Check(verification.RuleRequirePinned, fmt.Sprintf("no key is pinned for tool %s", toolID)) {
+			result.failPolicy(eval, nil, "")
+			return result, nil
+		}
 
-			if err := s.pinning.PinKey(toolID, publicKeyPEM, domain, developerName); err == nil {
-				result.Pinned = true
+		t = timer.Start()
+		accepted := s.checkRejection(result, toolID, domain, publicKeyPEM, req.Reconsider)
+		timer.Stop(verification.TimingPinLookup, t)
+		if !accepted {
+			return result, nil
+		}
+
+		// Ask the interactive handler, or auto-pin if requested
+		developerName := developerInfo["developer_name"]
+		switch {
+		case s.dryRun && handler != nil:
+			result.wouldHave("would prompt user: %s for tool %s", interactive.PromptTypeFirstTimeKey, toolID)
+		case s.dryRun && req.AutoPin:
+			result.wouldHave("would pin key %s for tool %s", fingerprintOrUnknown(s.keyManager, publicKeyPEM), toolID)
+		case handler != nil:
+			if !s.promptFirstUse(result, handler, toolID, domain, publicKeyPEM, developerName, keyScope) {
+				return result, nil
+			}
+		case req.AutoPin:
+			// The pin is only written if no concurrent call pinned the
+			// tool first
+			opts := pinning.PinOptions{KeyScope: keyScope, Provenance: provenance, SourceDetail: sourceDetail}
+			t = timer.Start()
+			existing, err := s.pinning.PinKeyIfAbsent(toolID, publicKeyPEM, domain, developerName, opts)
+			timer.Stop(verification.TimingPinUpdate, t)
+			switch {
+			case errors.Is(err, pinning.ErrReadOnlyPinStore):
+				result.pinStoreReadOnly()
+			case err != nil:
+			case existing == nil:
+				result.Pinned, result.TrustDecision = true, pinning.TrustAutoPinned
+			case crypto.PublicKeyPEMEqual(existing.PublicKeyPEM, publicKeyPEM):
+				result.Pinned, result.TrustDecision = true, pinning.TrustPrePinned
+			default:
+				result.fail(schemaerr.ErrKeyPinMismatch, fmt.Sprintf("tool %s is already pinned to a different key", toolID), nil)
+				return result, nil
 			}
 		}
 	}
 
 	// Verify signature
-	result.Valid = s.signatureManager.VerifySchemaSignature(schemaHash, signatureB64, publicKey)
+	t = timer.Start()
+	if s.multiSignature(req) {
+		s.verifySignatures(result, req, schemaHash, publicKeyPEM)
+	} else {
+		result.Valid = s.signatureManager.VerifySchemaSignature(schemaHash, signatureB64, publicKey)
+		if !result.Valid && s.legacySignatures && s.signatureManager.VerifyLegacySignature(schemaHash, signatureB64, publicKey) {
+			result.Valid = true
+			result.Warnings = append(result.Warnings, WarningLegacySignature)
+		}
+		if !result.Valid {
+			result.ErrorCode = ErrSignatureInvalid
+			result.Cause = &schemaerr.Error{Kind: schemaerr.ErrSignatureInvalid}
+		}
+	}
+	timer.Stop(verification.TimingSignatureVerify, t)
+	if result.Valid {
+		s.checkProvenance(result, req.Provenance, schemaHash, publicKey)
+	}
+	if result.Valid {
+		s.checkSignedAt(result, eval, domain, req.SignedAt, discovered)
+	}
+	if version, _ := result.Metadata["discovery_schema_version"].(string); result.Valid && legacyDiscoveryMessage(version) != "" {
+		if eval.Check(verification.RuleLegacyDiscovery, legacyDiscoveryMessage(version)) {
+			result.Valid = false
+			result.failPolicy(eval, nil, "")
+		}
+	}
 
-	// Update verification timestamp if valid and pinned
-	if result.Valid && result.Pinned {
-		_ = s.pinning.UpdateLastVerified(toolID)
+	// Record the first verification of a key pinned just now
+	if result.Pinned && result.FirstUse {
+		t = timer.Start()
+		s.recordVerification(ctx, result, toolID)
+		timer.Stop(verification.TimingPinUpdate, t)
 	}
 
 	// Add metadata
@@ -240,29 +870,292 @@ func (s *SchemaVerificationWorkflow) VerifySchema(ctx context.Context, schema ma
 	}
 	result.Metadata["domain"] = domain
 	result.Metadata["tool_id"] = toolID
+	if keyScope != "" {
+		result.Metadata["key_scope"] = keyScope
+	}
+	if result.PolicyRule == "" {
+		result.applyPolicy(eval)
+	}
 
 	return result, nil
 }
 
-// PinKeyForTool manually pins a key for a specific tool
-func (s *SchemaVerificationWorkflow) PinKeyForTool(ctx context.Context, toolID, domain, developerName string) error {
-	publicKeyPEM, err := s.discovery.GetPublicKeyPEM(ctx, domain)
+// schemaHash validates and hashes req.Schema, or returns req.SchemaHash
+// when it is set and 32 bytes long.
+func (s *SchemaVerificationWorkflow) schemaHash(req VerifyRequest) ([]byte, error) {
+	if req.SchemaHash != nil {
+		if len(req.SchemaHash) != sha256.Size {
+			return nil, fmt.Errorf("schema hash must be %d bytes, got %d", sha256.Size, len(req.SchemaHash))
+		}
+		return req.SchemaHash, nil
+	}
+	if err := s.core.ValidateSchema(req.Schema); err != nil {
+		return nil, fmt.Errorf("schema validation failed: %w", err)
+	}
+	schemaHash, err := s.core.CanonicalizeAndHash(req.Schema)
 	if err != nil {
-		return fmt.Errorf("failed to discover public key: %w", err)
+		return nil, fmt.Errorf("failed to canonicalize schema: %w", err)
 	}
+	return schemaHash, nil
+}
 
-	// Check if key is revoked
-	isNotRevoked, err := s.discovery.ValidateKeyNotRevoked(ctx, publicKeyPEM, domain)
+// promptFirstUse asks handler whether to trust a key seen for the first
+// time and applies the answer to the pinning database. Prompts from
+// concurrent calls are shown one at a time. A rejected key fails result
+// with ErrKeyRejected and returns false.
+func (s *SchemaVerificationWorkflow) promptFirstUse(result *VerificationResult, handler interactive.InteractiveHandler, toolID, domain, publicKeyPEM, developerName, keyScope string) bool {
+	// The prompt goes ahead without the domain history if it cannot be read
+	history, _ := s.pinning.DomainHistory(domain, toolID, publicKeyPEM, "")
+	s.promptMu.Lock()
+	decision, err := interactive.NewInteractivePinningManager(handler).PromptFirstTimeKeyWithHistory(toolID, domain, publicKeyPEM, result.DeveloperInfo, history)
+	s.promptMu.Unlock()
+	if result.decisionPending(err) {
+		return false
+	}
+	if err != nil {
+		result.fail(schemaerr.ErrKeyRejected, fmt.Sprintf("could not confirm key for tool %s: %v", toolID, err), err)
+		return false
+	}
+
+	if s.pinning.ReadOnly() {
+		// Nothing can be recorded, so the answer applies to this
+		// verification only
+		result.pinStoreReadOnly()
+		if decision == interactive.UserDecisionReject || decision == interactive.UserDecisionNeverTrust {
+			result.fail(schemaerr.ErrKeyRejected, fmt.Sprintf("key for tool %s was not trusted (%s)", toolID, decision), nil)
+			return false
+		}
+		result.TrustDecision = pinning.TrustForUserDecision(decision)
+		return true
+	}
+
+	pinDecision, err := s.pinning.ApplyUserDecision(toolID, domain, publicKeyPEM, developerName, keyScope, decision)
+	if err != nil {
+		result.fail(schemaerr.ErrPinStoreCorrupt, fmt.Sprintf("failed to apply decision for tool %s: %v", toolID, err), err)
+		return false
+	}
+	if !pinDecision.Accepted {
+		result.fail(schemaerr.ErrKeyRejected, fmt.Sprintf("key for tool %s was not trusted (%s)", toolID, decision), nil)
+		return false
+	}
+	result.Pinned = decision != interactive.UserDecisionTemporaryAccept
+	result.TrustDecision = pinDecision.TrustDecision
+	if decision == interactive.UserDecisionAcceptNamespace {
+		result.Metadata["pin_match"] = string(pinning.PinMatchNamespace)
+		result.Metadata["pin_namespace"] = interactive.ToolNamespace(toolID)
+	}
+	return true
+}
+
+// recordVerification records the outcome of result in toolID's pin
+// statistics, or in dry run notes that it would have. A read-only pinning
+// database is left alone with WarningPinStoreReadOnly.
+func (s *SchemaVerificationWorkflow) recordVerification(ctx context.Context, result *VerificationResult, toolID string) {
+	if s.pinning.ReadOnly() {
+		result.pinStoreReadOnly()
+		return
+	}
+	if !s.dryRun {
+		_ = s.pinning.UpdateLastVerifiedContext(ctx, toolID, result.Valid)
+		return
+	}
+	outcome := "failed"
+	if result.Valid {
+		outcome = "successful"
+	}
+	result.wouldHave("would record a %s verification of tool %s", outcome, toolID)
+}
+
+// fingerprintOrUnknown returns the fingerprint of publicKeyPEM, or
+// "unknown" if it does not parse.
+func fingerprintOrUnknown(keyManager *crypto.KeyManager, publicKeyPEM string) string {
+	fingerprint, err := keyManager.CalculateKeyFingerprintFromPEM(publicKeyPEM)
+	if err != nil {
+		return "unknown"
+	}
+	return fingerprint
+}
+
+// checkRejection fails result with ErrKeyPreviouslyRejected and returns
+// false if publicKeyPEM was rejected for toolID before. With reconsider,
+// the rejection is cleared instead, or with a read-only pinning database
+// ignored for this verification.
+func (s *SchemaVerificationWorkflow) checkRejection(result *VerificationResult, toolID, domain, publicKeyPEM string, reconsider bool) bool {
+	if reconsider && s.pinning.ReadOnly() {
+		result.pinStoreReadOnly()
+		return true
+	}
+	if reconsider && s.dryRun {
+		// The rejection would be cleared, so it does not apply
+		if rejected, err := s.pinning.GetRejection(toolID, domain, fingerprintOrUnknown(s.keyManager, publicKeyPEM)); err == nil && rejected != nil {
+			result.wouldHave("would clear the rejection of key %s for tool %s", rejected.Fingerprint, toolID)
+		}
+		return true
+	}
+	if reconsider {
+		if fingerprint, err := s.keyManager.CalculateKeyFingerprintFromPEM(publicKeyPEM); err == nil {
+			if err := s.pinning.ClearRejection(toolID, domain, fingerprint); err != nil {
+				result.fail(schemaerr.ErrPinStoreCorrupt, fmt.Sprintf("failed to clear rejection: %v", err), err)
+				return false
+			}
+		}
+	}
+	err := s.pinning.CheckRejection(toolID, domain, publicKeyPEM)
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, schemaerr.ErrKeyPreviouslyRejected):
+		result.fail(schemaerr.ErrKeyPreviouslyRejected, err.Error(), err)
+	default:
+		result.fail(schemaerr.ErrPinStoreCorrupt, fmt.Sprintf("failed to check rejected keys: %v", err), err)
+	}
+	return false
+}
+
+// checkDiscoveryVersion records the schema_version wellKnown was served
+// with in result's metadata and compares it with the version last recorded
+// for domain. A downgrade fails result and returns false in strict mode, and
+// otherwise adds WarningDiscoveryDowngrade.
+func (s *SchemaVerificationWorkflow) checkDiscoveryVersion(ctx context.Context, result *VerificationResult, domain string, wellKnown *discovery.WellKnownResponse) bool {
+	result.Metadata["discovery_schema_version"] = wellKnown.SchemaVersion
+	result.Metadata["discovery_source_url"] = wellKnown.SourceURL
+
+	record := s.pinning.RecordDiscoveryVersion
+	if s.dryRun || s.pinning.ReadOnly() {
+		record = s.pinning.CheckDiscoveryVersion
+	}
+	err := record(domain, wellKnown.SchemaVersion)
+	var downgrade *pinning.DiscoveryDowngradeError
+	if !errors.As(err, &downgrade) {
+		if err != nil {
+			s.loggerFor(ctx).DebugContext(ctx, "failed to record discovery version",
+				logging.KeyDomain, domain,
+				logging.KeyError, err)
+		}
+		return true
+	}
+	if s.strictDiscoveryVersion {
+		result.fail(schemaerr.ErrDiscoveryDowngrade, downgrade.Error(), downgrade)
+		return false
+	}
+	result.Warnings = append(result.Warnings, WarningDiscoveryDowngrade)
+	return true
+}
+
+// redirectBlocked fails result if err is a discovery redirect blocked by
+// the redirect policy. Unlike other discovery failures this is not
+// tolerated for pinned keys, since it points at a tampered endpoint rather
+// than an outage.
+func redirectBlocked(result *VerificationResult, err error) bool {
+	var redirectErr *discovery.RedirectBlockedError
+	if !errors.As(err, &redirectErr) {
+		return false
+	}
+	result.fail(schemaerr.ErrDiscoveryRedirectBlocked, fmt.Sprintf("could not discover public key: %v", redirectErr), err)
+	return true
+}
+
+// discoveryFailureKind classifies a failed discovery, such as
+// schemaerr.ErrDiscoveryNotFound for a missing document or
+// schemaerr.ErrDiscoveryCircuitOpen for a request the discovery client
+// refused, falling back to schemaerr.ErrDiscoveryFailed for errors that
+// carry no discovery kind.
+func discoveryFailureKind(err error) *schemaerr.Kind {
+	switch kind := schemaerr.KindOf(err); {
+	case kind == schemaerr.ErrDiscoveryRateLimited, kind == schemaerr.ErrDiscoveryCircuitOpen:
+		return kind
+	case kind != nil && kind.WorkflowCode() == ErrDiscoveryFailed:
+		return kind
+	}
+	return schemaerr.ErrDiscoveryFailed
+}
+
+// checkRevocationDocument checks the domain's standalone revocation document,
+// if it publishes one, for the key and for this schema's signature. It
+// returns the kind of failure and a message, or nil when nothing is
+// revoked, and the fetch error if the revocation endpoint is unreachable.
+// The document is merged into the copy cached in the pinning database, and
+// when the endpoint is unreachable the cached copy is still checked.
+func (s *SchemaVerificationWorkflow) checkRevocationDocument(ctx context.Context, wellKnown *discovery.WellKnownResponse, publicKeyPEM string, schemaHash []byte) (*schemaerr.Kind, string, error) {
+	doc, err := s.revocationDocument(ctx, wellKnown)
+	if doc == nil {
+		return nil, "", err
+	}
+	kind, message := s.revocationDocumentFailure(doc, publicKeyPEM, schemaHash)
+	return kind, message, err
+}
+
+// revocationDocumentFailure checks doc for the key and for this schema's
+// signature, returning the kind of failure and a message if either is
+// revoked.
+func (s *SchemaVerificationWorkflow) revocationDocumentFailure(doc *revocation.RevocationDocument, publicKeyPEM string, schemaHash []byte) (*schemaerr.Kind, string) {
+	if fingerprint, err := s.keyManager.CalculateKeyFingerprintFromPEM(publicKeyPEM); err == nil {
+		if err := revocation.CheckRevocation(doc, fingerprint); err != nil {
+			return schemaerr.ErrKeyRevoked, err.Error()
+		}
+	}
+	if err := revocation.CheckSignatureRevocation(doc, core.FormatSchemaHash(schemaHash)); err != nil {
+		return schemaerr.ErrSignatureRevoked, err.Error()
+	}
+	return nil, ""
+}
+
+// applyRevocationPolicy decides what happens when the key's revocation status
+// could not be fully established: fetchErr is the failed discovery or
+// revocation fetch, if any, and checked reports whether some revocation data
+// was consulted. In strict mode a failed fetch or a missing check fails
+// result and returns false; otherwise an unchecked key gets
+// WarningRevocationNotChecked.
+func (s *SchemaVerificationWorkflow) applyRevocationPolicy(ctx context.Context, result *VerificationResult, toolID, domain string, checked bool, fetchErr error) bool {
+	s.loggerFor(ctx).DebugContext(ctx, "revocation check",
+		logging.KeyToolID, toolID,
+		logging.KeyDomain, domain,
+		"checked", checked,
+		logging.KeyError, fetchErr)
+	if s.strictRevocation {
+		switch {
+		case fetchErr != nil:
+			result.fail(schemaerr.ErrRevocationCheckFailed, fmt.Sprintf("could not check revocation: %v", fetchErr), fetchErr)
+		case !checked:
+			result.fail(schemaerr.ErrRevocationCheckFailed, "no revocation data available in offline mode", nil)
+		default:
+			return true
+		}
+		return false
+	}
+	if !checked {
+		s.loggerFor(ctx).WarnContext(ctx, "revocation not checked",
+			logging.KeyToolID, toolID,
+			logging.KeyDomain, domain)
+		result.Warnings = append(result.Warnings, WarningRevocationNotChecked)
+	}
+	return true
+}
+
+// describeKeyScope renders a pinned or discovered key scope for messages.
+func describeKeyScope(scope string) string {
+	if scope == "" {
+		return "the domain-wide key"
+	}
+	return fmt.Sprintf("tools prefix %q", scope)
+}
+
+// PinKeyForTool manually pins the key discovery resolves for a specific tool
+func (s *SchemaVerificationWorkflow) PinKeyForTool(ctx context.Context, toolID, domain, developerName string) error {
+	wellKnown, err := s.discovery.FetchDiscovery(ctx, domain)
 	if err != nil {
-		return fmt.Errorf("failed to check key revocation: %w", err)
+		return fmt.Errorf("failed to discover public key: %w", err)
 	}
+	scoped := wellKnown.KeyForTool(toolID)
 
-	if !isNotRevoked {
+	// Check if key is revoked
+	if discovery.CheckKeyRevocation(scoped.PublicKeyPEM, scoped.RevokedKeys) {
 		return fmt.Errorf("public key has been revoked")
 	}
 
 	// Pin the key
-	if err := s.pinning.PinKey(toolID, publicKeyPEM, domain, developerName); err != nil {
+	opts := pinning.PinOptions{KeyScope: scoped.Scope, Provenance: pinning.ProvenanceDiscovery, SourceDetail: discovery.ConstructWellKnownURL(domain)}
+	if err := s.pinning.PinKeyWithOptions(toolID, scoped.PublicKeyPEM, domain, developerName, opts); err != nil {
 		return fmt.Errorf("failed to pin key: %w", err)
 	}
 
@@ -284,7 +1177,21 @@ func (s *SchemaVerificationWorkflow) RemovePinnedKey(toolID string) error {
 	return s.pinning.RemovePinnedKey(toolID)
 }
 
-// CreateWellKnownResponse creates a .well-known response structure
+// ListRejectedKeys lists all recorded key rejections
+func (s *SchemaVerificationWorkflow) ListRejectedKeys() ([]pinning.RejectedKey, error) {
+	return s.pinning.ListRejectedKeys()
+}
+
+// ClearRejection forgets a recorded key rejection
+func (s *SchemaVerificationWorkflow) ClearRejection(toolID, domain, fingerprint string) error {
+	return s.pinning.ClearRejection(toolID, domain, fingerprint)
+}
+
+// CreateWellKnownResponse creates a .well-known response structure with
+// the fields of schema_version 1.1 and revocationEndpoint. It writes
+// whatever schemaVersion it is given; discovery.WellKnownBuilder checks
+// the fields against the version and can add per-tool keys and contact
+// proofs.
 func CreateWellKnownResponse(publicKeyPEM, developerName, contact string, revokedKeys []string, schemaVersion string, revocationEndpoint string) map[string]interface{} {
 	if schemaVersion == "" {
 		schemaVersion = "1.2"
@@ -311,6 +1218,23 @@ func CreateWellKnownResponse(publicKeyPEM, developerName, contact string, revoke
 	return response
 }
 
+// AddContactProof signs the contact of a response from
+// CreateWellKnownResponse with the developer's private key and adds the
+// signature as contact_proof, so verifiers can mark the contact as
+// verified. domain is the domain the response will be served from.
+func AddContactProof(response map[string]interface{}, privateKeyPEM, domain string) error {
+	contact, _ := response["contact"].(string)
+	if contact == "" {
+		return fmt.Errorf("response has no contact to prove")
+	}
+	proof, err := discovery.CreateContactProof(privateKeyPEM, contact, domain)
+	if err != nil {
+		return fmt.Errorf("failed to sign contact proof: %w", err)
+	}
+	response["contact_proof"] = proof
+	return nil
+}
+
 // ValidateSchema performs basic schema validation
 func ValidateSchema(schema map[string]interface{}) error {
 	if schema == nil {
@@ -397,12 +1321,19 @@ type SchemaVerificationError struct {
 	Type    string `json:"type"`
 	Message string `json:"message"`
 	Code    string `json:"code"`
+	// Err is the underlying cause, if any, exposed via Unwrap.
+	Err error `json:"-"`
 }
 
 func (e *SchemaVerificationError) Error() string {
 	return fmt.Sprintf("%s: %s", e.Type, e.Message)
 }
 
+// Unwrap returns the underlying cause.
+func (e *SchemaVerificationError) Unwrap() error {
+	return e.Err
+}
+
 // NewSchemaVerificationError creates a new schema verification error
 func NewSchemaVerificationError(errorType, message, code string) *SchemaVerificationError {
 	return &SchemaVerificationError{
@@ -412,75 +1343,189 @@ func NewSchemaVerificationError(errorType, message, code string) *SchemaVerifica
 	}
 }
 
-// Common error types
+// Common error types. Codes reported in a VerificationResult come from the
+// schemaerr kinds, so they are defined there.
 var (
-	ErrSchemaInvalid      = "SCHEMA_INVALID"
-	ErrSignatureInvalid   = "SIGNATURE_INVALID"
-	ErrKeyNotFound        = "KEY_NOT_FOUND"
-	ErrKeyRevoked         = "KEY_REVOKED"
-	ErrKeyExpired         = "KEY_EXPIRED"
-	ErrDiscoveryFailed    = "DISCOVERY_FAILED"
-	ErrPinningFailed      = "PINNING_FAILED"
-	ErrVerificationFailed = "VERIFICATION_FAILED"
+	ErrSchemaInvalid             = schemaerr.ErrSchemaInvalid.WorkflowCode()
+	ErrSchemaTooComplex          = schemaerr.ErrSchemaTooComplex.WorkflowCode()
+	ErrSignatureInvalid          = schemaerr.ErrSignatureInvalid.WorkflowCode()
+	ErrSignatureRevoked          = schemaerr.ErrSignatureRevoked.WorkflowCode()
+	ErrSignatureStale            = schemaerr.ErrSignatureStale.WorkflowCode()
+	ErrSignatureSuperseded       = schemaerr.ErrSignatureSuperseded.WorkflowCode()
+	ErrSignatureThresholdNotMet  = schemaerr.ErrSignatureThresholdNotMet.WorkflowCode()
+	ErrKeyNotFound               = schemaerr.ErrKeyNotFound.WorkflowCode()
+	ErrKeyRevoked                = schemaerr.ErrKeyRevoked.WorkflowCode()
+	ErrKeyExpired                = "KEY_EXPIRED"
+	ErrKeyChanged                = schemaerr.ErrKeyPinMismatch.WorkflowCode()
+	ErrKeyRejected               = schemaerr.ErrKeyRejected.WorkflowCode()
+	ErrKeyNotPinned              = schemaerr.ErrKeyNotPinned.WorkflowCode()
+	ErrKeyPreviouslyRejected     = schemaerr.ErrKeyPreviouslyRejected.WorkflowCode()
+	ErrDecisionPending           = schemaerr.ErrDecisionPending.WorkflowCode()
+	ErrDiscoveryFailed           = schemaerr.ErrDiscoveryFailed.WorkflowCode()
+	ErrPinningFailed             = schemaerr.ErrPinStoreCorrupt.WorkflowCode()
+	ErrVerificationFailed        = "VERIFICATION_FAILED"
+	ErrRevocationCheckFailed     = schemaerr.ErrRevocationCheckFailed.WorkflowCode()
+	ErrDomainBlocked             = schemaerr.ErrDomainBlocked.WorkflowCode()
+	ErrDiscoveryDowngrade        = schemaerr.ErrDiscoveryDowngrade.WorkflowCode()
+	ErrDiscoveryRedirectBlocked  = schemaerr.ErrDiscoveryRedirectBlocked.WorkflowCode()
+	ErrDiscoveryRateLimited      = schemaerr.ErrDiscoveryRateLimited.WorkflowCode()
+	ErrDiscoveryCircuitOpen      = schemaerr.ErrDiscoveryCircuitOpen.WorkflowCode()
+	ErrPolicyViolation           = schemaerr.ErrPolicyViolation.WorkflowCode()
+	ErrProvenanceInvalid         = schemaerr.ErrProvenanceInvalid.WorkflowCode()
+	ErrProvenanceSubjectMismatch = schemaerr.ErrProvenanceSubjectMismatch.WorkflowCode()
 )
 
-// IsTemporaryError checks if an error is temporary and verification should be retried
+// IsTemporaryError reports whether err is a transient failure worth
+// retrying. Classification uses the error chain rather than message text:
+// retryable HTTP statuses from discovery (408, 425, 429, 5xx), network
+// timeouts, dial/connection errors, non-NXDOMAIN DNS failures, and
+// requests refused by the discovery rate limiter or circuit breaker.
+// Context cancellation and *SchemaVerificationError codes other than
+// ErrDiscoveryFailed are never temporary.
 func IsTemporaryError(err error) bool {
 	if err == nil {
 		return false
 	}
 
-	errorStr := err.Error()
-	temporaryIndicators := []string{
-		"timeout",
-		"connection refused",
-		"network",
-		"temporary",
-		"unavailable",
+	if errors.Is(err, context.Canceled) {
+		return false
 	}
 
-	for _, indicator := range temporaryIndicators {
-		if strings.Contains(strings.ToLower(errorStr), indicator) {
+	var verificationErr *SchemaVerificationError
+	if errors.As(err, &verificationErr) && verificationErr.Code != ErrDiscoveryFailed {
+		return false
+	}
+
+	if errors.Is(err, schemaerr.ErrDiscoveryRateLimited) || errors.Is(err, schemaerr.ErrDiscoveryCircuitOpen) {
+		return true
+	}
+
+	var statusErr *discovery.HTTPStatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusRequestTimeout, http.StatusTooEarly, http.StatusTooManyRequests,
+			http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
 			return true
 		}
+		return false
 	}
 
-	return false
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return !dnsErr.IsNotFound
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return true
+	}
+
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET)
+}
+
+// RetryOptions configures RetryVerificationWithOptions.
+type RetryOptions struct {
+	// MaxRetries is the number of retries after the first attempt.
+	MaxRetries int
+	// BaseDelay is the backoff base; attempt n waits a random duration in
+	// [0, BaseDelay*2^n) ("full jitter"). Defaults to 1s.
+	BaseDelay time.Duration
+	// MaxDelay caps any single wait, including server Retry-After hints.
+	// Defaults to 30s.
+	MaxDelay time.Duration
+	// OnAttempt, if set, is called after every attempt with the 1-based
+	// attempt number and that attempt's outcome.
+	OnAttempt func(attempt int, result *VerificationResult, err error)
 }
 
-// RetryVerification retries schema verification with exponential backoff
+// RetryVerification retries schema verification with jittered exponential
+// backoff. It is equivalent to RetryVerificationWithOptions with only
+// MaxRetries set.
 func RetryVerification(ctx context.Context, workflow *SchemaVerificationWorkflow, schema map[string]interface{}, signatureB64, toolID, domain string, autoPin bool, maxRetries int) (*VerificationResult, error) {
-	var lastErr error
+	return RetryVerificationWithOptions(ctx, workflow, schema, signatureB64, toolID, domain, autoPin, RetryOptions{MaxRetries: maxRetries})
+}
 
-	for attempt := 0; attempt <= maxRetries; attempt++ {
+// RetryVerificationWithOptions retries schema verification while the
+// failure is temporary (see IsTemporaryError). Results that fail for any
+// other reason, such as an invalid signature, are returned immediately.
+// When discovery answers 429/503 with Retry-After, that delay is used
+// instead of the computed backoff. Every attempt has the same request ID.
+func RetryVerificationWithOptions(ctx context.Context, workflow *SchemaVerificationWorkflow, schema map[string]interface{}, signatureB64, toolID, domain string, autoPin bool, opts RetryOptions) (*VerificationResult, error) {
+	ctx, _ = requestid.Ensure(ctx)
+	if opts.BaseDelay <= 0 {
+		opts.BaseDelay = time.Second
+	}
+	if opts.MaxDelay <= 0 {
+		opts.MaxDelay = 30 * time.Second
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= opts.MaxRetries; attempt++ {
 		result, err := workflow.VerifySchema(ctx, schema, signatureB64, toolID, domain, autoPin)
-		if err == nil && (result.Valid || !IsTemporaryError(fmt.Errorf(result.Error))) {
-			return result, nil
+		if opts.OnAttempt != nil {
+			opts.OnAttempt(attempt+1, result, err)
 		}
 
 		if err != nil {
-			lastErr = err
 			if !IsTemporaryError(err) {
 				return nil, err
 			}
+			lastErr = err
 		} else {
-			lastErr = fmt.Errorf(result.Error)
-			if !IsTemporaryError(lastErr) {
+			if result.Valid || !IsTemporaryError(result.Cause) {
 				return result, nil
 			}
+			lastErr = result.Cause
 		}
 
-		if attempt < maxRetries {
-			// Exponential backoff: 1s, 2s, 4s, 8s, etc.
-			backoff := time.Duration(1<<min(uint(attempt), 30)) * time.Second // #nosec G115 -- attempt is bounded by maxRetries
+		if attempt < opts.MaxRetries {
+			delay := retryDelay(attempt, lastErr, opts)
+			workflow.loggerFor(ctx).WarnContext(ctx, "retrying verification",
+				logging.KeyToolID, toolID,
+				logging.KeyDomain, domain,
+				"attempt", attempt+1,
+				"delay", delay,
+				logging.KeyError, lastErr)
 			select {
 			case <-ctx.Done():
 				return nil, ctx.Err()
-			case <-time.After(backoff):
-				continue
+			case <-time.After(delay):
 			}
 		}
 	}
 
-	return nil, fmt.Errorf("verification failed after %d retries: %w", maxRetries, lastErr)
+	return nil, fmt.Errorf("verification failed after %d retries: %w", opts.MaxRetries, lastErr)
+}
+
+// retryDelay returns the wait before the next attempt: the server's
+// Retry-After hint or the time until the discovery client will contact the
+// domain again when known, otherwise full-jitter exponential backoff.
+func retryDelay(attempt int, err error, opts RetryOptions) time.Duration {
+	var statusErr *discovery.HTTPStatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > 0 {
+		return min(statusErr.RetryAfter, opts.MaxDelay)
+	}
+	var limitedErr *discovery.RateLimitedError
+	if errors.As(err, &limitedErr) && limitedErr.RetryAfter > 0 {
+		return min(limitedErr.RetryAfter, opts.MaxDelay)
+	}
+	var circuitErr *discovery.CircuitOpenError
+	if errors.As(err, &circuitErr) && circuitErr.RetryAfter > 0 {
+		return min(circuitErr.RetryAfter, opts.MaxDelay)
+	}
+
+	backoff := opts.MaxDelay
+	if shift := uint(min(attempt, 30)); opts.BaseDelay < opts.MaxDelay>>shift { // #nosec G115 -- attempt is non-negative
+		backoff = opts.BaseDelay << shift
+	}
+	return time.Duration(rand.Int63n(int64(backoff) + 1)) // #nosec G404 -- jitter does not need a CSPRNG
 }
@@ -1,17 +1,37 @@
 package utils
 
 import (
+	"bytes"
 	"context"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/http/httptrace"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"time"
 
+	"github.com/ThirdKeyAi/schemapin/go/internal/version"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/clock"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery/discoverytest"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/pinning"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/requestid"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/revocation"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
 )
 
 func TestNewSchemaSigningWorkflow(t *testing.T) {
@@ -88,6 +108,41 @@ func TestSchemaSigningWorkflow_SignSchema(t *testing.T) {
 	}
 }
 
+func TestSchemaSigningWorkflow_SignSchemaExpectingHash(t *testing.T) {
+	privateKeyPEM, publicKeyPEM, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	workflow, err := NewSchemaSigningWorkflow(privateKeyPEM)
+	if err != nil {
+		t.Fatalf("Failed to create signing workflow: %v", err)
+	}
+
+	schema := map[string]interface{}{"type": "object", "description": "search tool"}
+	built, err := CalculateSchemaHash(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signature, err := workflow.SignSchemaExpectingHash(schema, core.FormatSchemaHash(built))
+	if err != nil {
+		t.Fatalf("Expected signing with the built hash to succeed, got %v", err)
+	}
+	if valid, err := VerifySignatureOnly(built, signature, publicKeyPEM); err != nil || !valid {
+		t.Errorf("Expected a valid signature, got valid=%v err=%v", valid, err)
+	}
+
+	schema["description"] = "exfiltrate everything"
+	signature, err = workflow.SignSchemaExpectingHash(schema, core.FormatSchemaHash(built))
+	var mismatch *core.HashMismatchError
+	if !errors.As(err, &mismatch) || signature != "" {
+		t.Fatalf("Expected HashMismatchError, got %q, %v", signature, err)
+	}
+	if mismatch.Expected != core.FormatSchemaHash(built) {
+		t.Errorf("Unexpected mismatch %+v", mismatch)
+	}
+}
+
 func TestSchemaSigningWorkflow_SignSchema_InvalidSchema(t *testing.T) {
 	// Generate a test key
 	keyManager := crypto.NewKeyManager()
@@ -187,8 +242,16 @@ func TestSchemaVerificationWorkflow_VerifySchema_AutoPin(t *testing.T) {
 		t.Fatalf("Failed to export public key: %v", err)
 	}
 
+	// Serve discovery for the revocation check
+	stub := discoverytest.New()
+	stub.SetDomain("example.com", &discovery.WellKnownResponse{
+		SchemaVersion: "1.1",
+		DeveloperName: "Test Developer",
+		PublicKeyPEM:  publicKeyPEM,
+	})
+
 	// Create verification workflow
-	workflow, err := NewSchemaVerificationWorkflow(dbPath)
+	workflow, err := NewSchemaVerificationWorkflow(dbPath, WithDiscovery(stub))
 	if err != nil {
 		t.Fatalf("Failed to create verification workflow: %v", err)
 	}
@@ -225,29 +288,8 @@ func TestSchemaVerificationWorkflow_VerifySchema_AutoPin(t *testing.T) {
 		t.Fatalf("Failed to sign schema: %v", err)
 	}
 
-	// Create mock server for revocation check
-	wellKnownResponse := discovery.WellKnownResponse{
-		SchemaVersion: "1.1",
-		DeveloperName: "Test Developer",
-		PublicKeyPEM:  publicKeyPEM,
-		RevokedKeys:   []string{},
-	}
-
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path == "/.well-known/schemapin.json" {
-			w.Header().Set("Content-Type", "application/json")
-			_ = json.NewEncoder(w).Encode(wellKnownResponse)
-		} else {
-			http.NotFound(w, r)
-		}
-	}))
-	defer server.Close()
-
-	// Extract domain from server URL
-	domain := strings.TrimPrefix(server.URL, "http://")
-
 	ctx := context.Background()
-	result, err := workflow.VerifySchema(ctx, schema, signature, "test-tool", domain, false)
+	result, err := workflow.VerifySchema(ctx, schema, signature, "test-tool", "example.com", false)
 	if err != nil {
 		t.Fatalf("Failed to verify schema: %v", err)
 	}
@@ -261,6 +303,9 @@ func TestSchemaVerificationWorkflow_VerifySchema_AutoPin(t *testing.T) {
 	if !result.Pinned {
 		t.Error("Expected key to be pinned")
 	}
+	if calls := stub.Calls("example.com"); calls != 1 {
+		t.Errorf("Expected one discovery fetch, got %d", calls)
+	}
 }
 
 func TestSchemaVerificationWorkflow_VerifySchema_PinnedKey(t *testing.T) {
@@ -280,8 +325,16 @@ func TestSchemaVerificationWorkflow_VerifySchema_PinnedKey(t *testing.T) {
 		t.Fatalf("Failed to export public key: %v", err)
 	}
 
+	// Serve discovery for the revocation check
+	stub := discoverytest.New()
+	stub.SetDomain("example.com", &discovery.WellKnownResponse{
+		SchemaVersion: "1.1",
+		DeveloperName: "Test Developer",
+		PublicKeyPEM:  publicKeyPEM,
+	})
+
 	// Create verification workflow and pin key manually
-	workflow, err := NewSchemaVerificationWorkflow(dbPath)
+	workflow, err := NewSchemaVerificationWorkflow(dbPath, WithDiscovery(stub))
 	if err != nil {
 		t.Fatalf("Failed to create verification workflow: %v", err)
 	}
@@ -318,29 +371,8 @@ func TestSchemaVerificationWorkflow_VerifySchema_PinnedKey(t *testing.T) {
 		t.Fatalf("Failed to sign schema: %v", err)
 	}
 
-	// Create mock server for revocation check
-	wellKnownResponse := discovery.WellKnownResponse{
-		SchemaVersion: "1.1",
-		DeveloperName: "Test Developer",
-		PublicKeyPEM:  publicKeyPEM,
-		RevokedKeys:   []string{},
-	}
-
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path == "/.well-known/schemapin.json" {
-			w.Header().Set("Content-Type", "application/json")
-			_ = json.NewEncoder(w).Encode(wellKnownResponse)
-		} else {
-			http.NotFound(w, r)
-		}
-	}))
-	defer server.Close()
-
-	// Extract domain from server URL
-	domain := strings.TrimPrefix(server.URL, "http://")
-
 	ctx := context.Background()
-	result, err := workflow.VerifySchema(ctx, schema, signature, "test-tool", domain, false)
+	result, err := workflow.VerifySchema(ctx, schema, signature, "test-tool", "example.com", false)
 	if err != nil {
 		t.Fatalf("Failed to verify schema: %v", err)
 	}
@@ -403,6 +435,71 @@ func TestCreateWellKnownResponse_NoOptionalFields(t *testing.T) {
 	}
 }
 
+func TestAddContactProof(t *testing.T) {
+	privateKeyPEM, publicKeyPEM, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	signer, _ := NewSchemaSigningWorkflow(privateKeyPEM)
+	schema := map[string]interface{}{"type": "object"}
+	signature, _ := signer.SignSchema(schema)
+
+	if err := AddContactProof(CreateWellKnownResponse(publicKeyPEM, "Dev", "", nil, "1.2", ""), privateKeyPEM, "example.com"); err == nil {
+		t.Error("Expected an error for a response without a contact")
+	}
+
+	tests := []struct {
+		name       string
+		prove      bool
+		contact    string
+		wantWarned bool
+	}{
+		{"valid proof", true, "", false},
+		{"tampered contact", true, "attacker@example.net", true},
+		{"legacy document", false, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var response map[string]interface{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				_ = json.NewEncoder(w).Encode(response)
+			}))
+			defer server.Close()
+
+			response = CreateWellKnownResponse(publicKeyPEM, "Dev", "dev@example.com", nil, "1.2", "")
+			if tt.prove {
+				if err := AddContactProof(response, privateKeyPEM, server.URL); err != nil {
+					t.Fatalf("Failed to add contact proof: %v", err)
+				}
+			}
+			if tt.contact != "" {
+				response["contact"] = tt.contact
+			}
+
+			workflow, err := NewSchemaVerificationWorkflow(filepath.Join(t.TempDir(), "contact.db"))
+			if err != nil {
+				t.Fatalf("Failed to create verification workflow: %v", err)
+			}
+			defer workflow.Close()
+			result, err := workflow.VerifySchema(context.Background(), schema, signature, "tool", server.URL, true)
+			if err != nil || !result.Valid {
+				t.Fatalf("Expected an unverified contact not to fail verification, got %+v, %v", result, err)
+			}
+			warned := false
+			for _, warning := range result.Warnings {
+				warned = warned || warning == WarningContactUnverified
+			}
+			if warned != tt.wantWarned {
+				t.Errorf("Expected %q warning %v, got %v", WarningContactUnverified, tt.wantWarned, result.Warnings)
+			}
+			if want := strconv.FormatBool(!tt.wantWarned); result.DeveloperInfo["contact_verified"] != want {
+				t.Errorf("Expected contact_verified %q, got %q", want, result.DeveloperInfo["contact_verified"])
+			}
+		})
+	}
+}
+
 func TestValidateSchema(t *testing.T) {
 	// Valid schema
 	validSchema := map[string]interface{}{
@@ -606,13 +703,21 @@ func TestIsTemporaryError(t *testing.T) {
 		isTemporary bool
 	}{
 		{"Nil error", nil, false},
-		{"Timeout error", fmt.Errorf("connection timeout"), true},
-		{"Network error", fmt.Errorf("network unreachable"), true},
-		{"Connection refused", fmt.Errorf("connection refused"), true},
-		{"Temporary error", fmt.Errorf("temporary failure"), true},
-		{"Unavailable error", fmt.Errorf("service unavailable"), true},
-		{"Permanent error", fmt.Errorf("invalid signature"), false},
-		{"Schema error", fmt.Errorf("schema validation failed"), false},
+		{"Service unavailable", &discovery.HTTPStatusError{StatusCode: http.StatusServiceUnavailable}, true},
+		{"Too many requests", fmt.Errorf("fetch: %w", &discovery.HTTPStatusError{StatusCode: http.StatusTooManyRequests}), true},
+		{"Not found", &discovery.HTTPStatusError{StatusCode: http.StatusNotFound}, false},
+		{"Deadline exceeded", fmt.Errorf("fetch: %w", context.DeadlineExceeded), true},
+		{"Canceled", context.Canceled, false},
+		{"Connection refused", &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}, true},
+		{"DNS not found", &net.DNSError{Err: "no such host", Name: "x.invalid", IsNotFound: true}, false},
+		{"DNS timeout", &net.DNSError{Err: "timeout", Name: "example.com", IsTimeout: true}, true},
+		{"Wrapped discovery failure", &SchemaVerificationError{Code: ErrDiscoveryFailed, Err: &discovery.HTTPStatusError{StatusCode: http.StatusBadGateway}}, true},
+		{"Signature invalid", &SchemaVerificationError{Code: ErrSignatureInvalid, Err: context.DeadlineExceeded}, false},
+		{"Rate limited", &discovery.RateLimitedError{Domain: "example.com"}, true},
+		{"Circuit open", fmt.Errorf("fetch: %w", &discovery.CircuitOpenError{Domain: "example.com"}), true},
+		// Message text alone no longer makes an error retryable
+		{"Text mentions network", fmt.Errorf("signature invalid due to network byte order"), false},
+		{"Text mentions timeout", fmt.Errorf("connection timeout"), false},
 	}
 
 	for _, tt := range tests {
@@ -625,9 +730,6 @@ func TestIsTemporaryError(t *testing.T) {
 	}
 }
 
-// TestRetryVerification removed due to CI instability issues
-// The RetryVerification function is tested indirectly through other tests
-
 // Benchmark tests
 func BenchmarkSignSchema(b *testing.B) {
 	// Generate a test key
@@ -692,3 +794,885 @@ func BenchmarkFormatKeyFingerprint(b *testing.B) {
 		_ = FormatKeyFingerprint(fingerprint)
 	}
 }
+
+func TestSchemaVerificationWorkflow_VerifySchema_ToolScopedKey(t *testing.T) {
+	toolPrivPEM, toolPubPEM, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate tool key: %v", err)
+	}
+	domainPrivPEM, domainPubPEM, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate domain key: %v", err)
+	}
+
+	wellKnown := discovery.WellKnownResponse{
+		SchemaVersion: "1.2",
+		DeveloperName: "Example Platform",
+		PublicKeyPEM:  domainPubPEM,
+		Tools: map[string]discovery.ToolKey{
+			"acme": {PublicKeyPEM: toolPubPEM, DeveloperName: "Acme Tools"},
+		},
+	}
+	stub := discoverytest.New()
+	stub.SetDomain("example.com", &wellKnown)
+
+	workflow, err := NewSchemaVerificationWorkflow(filepath.Join(t.TempDir(), "scope.db"), WithDiscovery(stub))
+	if err != nil {
+		t.Fatalf("Failed to create verification workflow: %v", err)
+	}
+	defer workflow.Close()
+
+	schema := map[string]interface{}{"type": "object", "description": "search"}
+	sign := func(privPEM string) string {
+		signer, err := NewSchemaSigningWorkflow(privPEM)
+		if err != nil {
+			t.Fatalf("Failed to create signing workflow: %v", err)
+		}
+		signature, err := signer.SignSchema(schema)
+		if err != nil {
+			t.Fatalf("Failed to sign schema: %v", err)
+		}
+		return signature
+	}
+
+	ctx := context.Background()
+
+	// The domain key cannot sign for a tool with its own scoped key
+	result, err := workflow.VerifySchema(ctx, schema, sign(domainPrivPEM), "acme/search", "example.com", false)
+	if err != nil {
+		t.Fatalf("VerifySchema failed: %v", err)
+	}
+	if result.Valid {
+		t.Error("Domain key signature should not verify for a tool-scoped key")
+	}
+
+	toolSignature := sign(toolPrivPEM)
+	result, err = workflow.VerifySchema(ctx, schema, toolSignature, "acme/search", "example.com", true)
+	if err != nil {
+		t.Fatalf("VerifySchema failed: %v", err)
+	}
+	if !result.Valid || !result.FirstUse || !result.Pinned {
+		t.Fatalf("Expected valid first-use pin, got %+v", result)
+	}
+	if result.Metadata["key_scope"] != "acme" || result.DeveloperInfo["developer_name"] != "Acme Tools" {
+		t.Errorf("Expected acme scope and developer, got %v / %v", result.Metadata["key_scope"], result.DeveloperInfo)
+	}
+	if info, _ := workflow.GetPinnedKeyInfo("acme/search"); info == nil || info.KeyScope != "acme" {
+		t.Fatalf("Expected pin to record scope acme, got %+v", info)
+	}
+
+	// Pinned and still scoped: verifies
+	result, _ = workflow.VerifySchema(ctx, schema, toolSignature, "acme/search", "example.com", false)
+	if !result.Valid || !result.Pinned {
+		t.Errorf("Expected pinned verification to succeed, got %+v", result)
+	}
+
+	// The tools entry disappears and discovery falls back to the domain key:
+	// this is a key change, even for a signature by the domain key.
+	wellKnown.Tools = nil
+	stub.SetDomain("example.com", &wellKnown)
+	for _, signature := range []string{toolSignature, sign(domainPrivPEM)} {
+		result, err = workflow.VerifySchema(ctx, schema, signature, "acme/search", "example.com", false)
+		if err != nil {
+			t.Fatalf("VerifySchema failed: %v", err)
+		}
+		if result.Valid || result.ErrorCode != ErrKeyChanged {
+			t.Errorf("Expected %s after scope fallback, got valid=%v code=%s", ErrKeyChanged, result.Valid, result.ErrorCode)
+		}
+		if !strings.Contains(result.Error, "domain-wide key") {
+			t.Errorf("Expected error to describe the scope change, got %q", result.Error)
+		}
+	}
+}
+
+func TestSchemaVerificationWorkflow_VerifySchema_RevokedSignature(t *testing.T) {
+	privateKeyPEM, publicKeyPEM, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	signer, err := NewSchemaSigningWorkflow(privateKeyPEM)
+	if err != nil {
+		t.Fatalf("Failed to create signing workflow: %v", err)
+	}
+
+	bad := map[string]interface{}{"type": "object", "description": "leaks a default"}
+	sibling := map[string]interface{}{"type": "object", "description": "fine"}
+	badSignature, err := signer.SignSchema(bad)
+	if err != nil {
+		t.Fatalf("Failed to sign schema: %v", err)
+	}
+	siblingSignature, err := signer.SignSchema(sibling)
+	if err != nil {
+		t.Fatalf("Failed to sign schema: %v", err)
+	}
+
+	c := core.NewSchemaPinCore()
+	badHash, err := c.CanonicalizeAndHash(bad)
+	if err != nil {
+		t.Fatalf("Failed to hash schema: %v", err)
+	}
+	revDoc := revocation.BuildRevocationDocument("example.com")
+	revocation.AddRevokedSignature(revDoc, core.FormatSchemaHash(badHash), revocation.ReasonSuperseded)
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/revocations.json" {
+			_ = json.NewEncoder(w).Encode(revDoc)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(CreateWellKnownResponse(publicKeyPEM, "Revoking Corp", "", nil, "1.2", server.URL+"/revocations.json"))
+	}))
+	defer server.Close()
+
+	workflow, err := NewSchemaVerificationWorkflow(filepath.Join(t.TempDir(), "revoked.db"))
+	if err != nil {
+		t.Fatalf("Failed to create verification workflow: %v", err)
+	}
+	defer workflow.Close()
+	ctx := context.Background()
+
+	result, err := workflow.VerifySchema(ctx, bad, badSignature, "bad-tool", server.URL, true)
+	if err != nil {
+		t.Fatalf("VerifySchema failed: %v", err)
+	}
+	if result.Valid || result.ErrorCode != ErrSignatureRevoked {
+		t.Errorf("Expected SIGNATURE_REVOKED on first use, got %+v", result)
+	}
+
+	result, err = workflow.VerifySchema(ctx, sibling, siblingSignature, "good-tool", server.URL, true)
+	if err != nil {
+		t.Fatalf("VerifySchema failed: %v", err)
+	}
+	if !result.Valid || !result.Pinned {
+		t.Fatalf("Expected sibling schema to verify and pin, got %+v", result)
+	}
+
+	// Pinned keys are checked against the revocation document too
+	if err := workflow.pinning.PinKey("bad-tool", publicKeyPEM, server.URL, "Revoking Corp"); err != nil {
+		t.Fatalf("Failed to pin key: %v", err)
+	}
+	result, err = workflow.VerifySchema(ctx, bad, badSignature, "bad-tool", server.URL, false)
+	if err != nil {
+		t.Fatalf("VerifySchema failed: %v", err)
+	}
+	if result.Valid || result.ErrorCode != ErrSignatureRevoked {
+		t.Errorf("Expected SIGNATURE_REVOKED for pinned key, got %+v", result)
+	}
+
+	// Revoking the key itself is reported as key revocation
+	fingerprint, err := crypto.NewKeyManager().CalculateKeyFingerprintFromPEM(publicKeyPEM)
+	if err != nil {
+		t.Fatalf("Failed to fingerprint key: %v", err)
+	}
+	revocation.AddRevokedKey(revDoc, fingerprint, revocation.ReasonKeyCompromise)
+	result, err = workflow.VerifySchema(ctx, sibling, siblingSignature, "good-tool", server.URL, false)
+	if err != nil {
+		t.Fatalf("VerifySchema failed: %v", err)
+	}
+	if result.Valid || result.ErrorCode != ErrKeyRevoked {
+		t.Errorf("Expected KEY_REVOKED once the key is revoked, got %+v", result)
+	}
+}
+
+func TestSchemaVerificationWorkflow_VerifySchema_RevocationDeltaCache(t *testing.T) {
+	privateKeyPEM, publicKeyPEM, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	signer, err := NewSchemaSigningWorkflow(privateKeyPEM)
+	if err != nil {
+		t.Fatalf("Failed to create signing workflow: %v", err)
+	}
+	schema := map[string]interface{}{"type": "object", "description": "search"}
+	signature, err := signer.SignSchema(schema)
+	if err != nil {
+		t.Fatalf("Failed to sign schema: %v", err)
+	}
+	fingerprint, err := crypto.NewKeyManager().CalculateKeyFingerprintFromPEM(publicKeyPEM)
+	if err != nil {
+		t.Fatalf("Failed to fingerprint key: %v", err)
+	}
+
+	var mu sync.Mutex
+	revDoc := revocation.BuildRevocationDocument("example.com")
+	revocation.StartSequence(revDoc)
+	revocation.AddRevokedKey(revDoc, "sha256:old", revocation.ReasonSuperseded)
+	var queries []string
+	revocations := revocation.NewHandler(func() *revocation.RevocationDocument {
+		mu.Lock()
+		defer mu.Unlock()
+		doc := *revDoc
+		return &doc
+	})
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/revocations.json" {
+			mu.Lock()
+			queries = append(queries, r.URL.RawQuery)
+			mu.Unlock()
+			revocations.ServeHTTP(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(CreateWellKnownResponse(publicKeyPEM, "Example", "", nil, "1.2", server.URL+"/revocations.json"))
+	}))
+	defer server.Close()
+
+	dbPath := filepath.Join(t.TempDir(), "delta.db")
+	verify := func() *VerificationResult {
+		t.Helper()
+		workflow, err := NewSchemaVerificationWorkflow(dbPath)
+		if err != nil {
+			t.Fatalf("Failed to create verification workflow: %v", err)
+		}
+		defer workflow.Close()
+		result, err := workflow.VerifySchema(context.Background(), schema, signature, "search", server.URL, true)
+		if err != nil {
+			t.Fatalf("VerifySchema failed: %v", err)
+		}
+		return result
+	}
+
+	// The first verification fetches the full document
+	if result := verify(); !result.Valid {
+		t.Fatalf("Expected valid verification, got %+v", result)
+	}
+	// After a restart the cached sequence is sent and nothing has changed
+	if result := verify(); !result.Valid {
+		t.Fatalf("Expected valid verification, got %+v", result)
+	}
+	// A new revocation arrives as a delta merged into the cache
+	mu.Lock()
+	revocation.AddRevokedKey(revDoc, fingerprint, revocation.ReasonKeyCompromise)
+	mu.Unlock()
+	if result := verify(); result.Valid || result.ErrorCode != ErrKeyRevoked {
+		t.Fatalf("Expected KEY_REVOKED from the delta, got %+v", result)
+	}
+
+	if got, want := strings.Join(queries, ","), ",since=2,since=2"; got != want {
+		t.Errorf("Expected revocation queries %q, got %q", want, got)
+	}
+	keyPinning, err := pinning.NewKeyPinning(dbPath, pinning.PinningModeAutomatic, nil)
+	if err != nil {
+		t.Fatalf("Failed to open pinning database: %v", err)
+	}
+	defer keyPinning.Close()
+	cached, err := keyPinning.LoadRevocationDocument(server.URL + "/revocations.json")
+	if err != nil || cached == nil || cached.Sequence != 3 || len(cached.RevokedKeys) != 2 {
+		t.Errorf("Expected the merged document cached at sequence 3, got %+v, %v", cached, err)
+	}
+}
+
+// recordingHandler is a slog.Handler that keeps every record it handles.
+type recordingHandler struct {
+	mu      sync.Mutex
+	records []slog.Record
+}
+
+func (h *recordingHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *recordingHandler) Handle(_ context.Context, r slog.Record) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, r)
+	return nil
+}
+
+func (h *recordingHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h *recordingHandler) WithGroup(string) slog.Handler      { return h }
+
+// find returns the attributes of the first record with message msg.
+func (h *recordingHandler) find(msg string) (map[string]slog.Value, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, r := range h.records {
+		if r.Message != msg {
+			continue
+		}
+		attrs := make(map[string]slog.Value)
+		r.Attrs(func(a slog.Attr) bool {
+			attrs[a.Key] = a.Value
+			return true
+		})
+		return attrs, true
+	}
+	return nil, false
+}
+
+func TestSchemaVerificationWorkflow_LogsFailedDiscovery(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	domain := server.URL
+	server.Close()
+
+	handler := &recordingHandler{}
+	workflow, err := NewSchemaVerificationWorkflow(filepath.Join(t.TempDir(), "logging.db"), WithLogger(slog.New(handler)))
+	if err != nil {
+		t.Fatalf("Failed to create verification workflow: %v", err)
+	}
+	defer workflow.Close()
+
+	schema := map[string]interface{}{"type": "object"}
+	result, err := workflow.VerifySchema(context.Background(), schema, "c2ln", "logged-tool", domain, true)
+	if err != nil {
+		t.Fatalf("VerifySchema failed: %v", err)
+	}
+	if result.ErrorCode != ErrDiscoveryFailed {
+		t.Fatalf("Expected DISCOVERY_FAILED, got %+v", result)
+	}
+
+	attrs, ok := handler.find("discovery failed")
+	if !ok {
+		t.Fatal("Expected a discovery failed record from the workflow's discovery client")
+	}
+	if attrs["domain"].String() != domain || attrs["error"].String() == "" {
+		t.Errorf("Unexpected discovery failed attributes: %v", attrs)
+	}
+	if _, ok := attrs["duration"]; !ok {
+		t.Error("Expected a duration attribute")
+	}
+
+	attrs, ok = handler.find("schema verification failed")
+	if !ok {
+		t.Fatal("Expected a schema verification failed record")
+	}
+	if attrs["error_code"].String() != ErrDiscoveryFailed || attrs["tool_id"].String() != "logged-tool" || attrs["domain"].String() != domain {
+		t.Errorf("Unexpected verification failed attributes: %v", attrs)
+	}
+}
+
+func TestSchemaVerificationWorkflow_Clock(t *testing.T) {
+	fixture := newOfflineFixture(t)
+	start := time.Date(2026, 3, 1, 9, 30, 0, 0, time.UTC)
+	fake := clock.NewFake(start)
+	workflow := fixture.pinnedWorkflow(t, "clock.example.com", WithClock(fake), WithOfflineMode(true))
+
+	fake.Advance(36 * time.Hour)
+	result, err := workflow.VerifySchema(context.Background(), fixture.schema, fixture.signature, "offline-tool", "clock.example.com", false)
+	if err != nil || !result.Valid {
+		t.Fatalf("Expected valid verification, got %+v, %v", result, err)
+	}
+
+	info, err := workflow.GetPinnedKeyInfo("offline-tool")
+	if err != nil {
+		t.Fatalf("Failed to get pinned key info: %v", err)
+	}
+	if !info.PinnedAt.Equal(start) {
+		t.Errorf("Expected pinned_at %v, got %v", start, info.PinnedAt)
+	}
+	if !info.LastVerified.Equal(fake.Now()) {
+		t.Errorf("Expected last_verified %v, got %v", fake.Now(), info.LastVerified)
+	}
+}
+
+// newCountingDiscoveryServer serves wellKnown after delay and counts the
+// requests it receives.
+func newCountingDiscoveryServer(tb testing.TB, wellKnown discovery.WellKnownResponse, delay time.Duration) (*httptest.Server, *atomic.Int64) {
+	tb.Helper()
+	requests := &atomic.Int64{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		time.Sleep(delay)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(wellKnown)
+	}))
+	tb.Cleanup(server.Close)
+	return server, requests
+}
+
+func TestSchemaVerificationWorkflow_VerifySchema_SingleDiscoveryFetch(t *testing.T) {
+	privateKeyPEM, publicKeyPEM, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	server, requests := newCountingDiscoveryServer(t, discovery.WellKnownResponse{
+		SchemaVersion: "1.2",
+		DeveloperName: "Counting Dev",
+		PublicKeyPEM:  publicKeyPEM,
+	}, 0)
+
+	signer, _ := NewSchemaSigningWorkflow(privateKeyPEM)
+	schema := map[string]interface{}{"type": "object"}
+	signature, _ := signer.SignSchema(schema)
+
+	workflow, err := NewSchemaVerificationWorkflow(filepath.Join(t.TempDir(), "count.db"))
+	if err != nil {
+		t.Fatalf("Failed to create verification workflow: %v", err)
+	}
+	defer workflow.Close()
+
+	for _, step := range []string{"first use", "pinned"} {
+		requests.Store(0)
+		result, err := workflow.VerifySchema(context.Background(), schema, signature, "tool", server.URL, true)
+		if err != nil || !result.Valid {
+			t.Fatalf("%s: expected valid result, got %+v, %v", step, result, err)
+		}
+		if n := requests.Load(); n != 1 {
+			t.Errorf("%s: expected exactly one discovery request, got %d", step, n)
+		}
+		if step == "first use" && result.DeveloperInfo["developer_name"] != "Counting Dev" {
+			t.Errorf("Expected developer info from the single fetch, got %v", result.DeveloperInfo)
+		}
+	}
+	info, err := workflow.GetPinnedKeyInfo("tool")
+	if err != nil || info == nil {
+		t.Fatalf("Expected auto-pinned key info, got %v, %v", info, err)
+	}
+	if info.Provenance != pinning.ProvenanceDiscovery {
+		t.Errorf("Expected provenance %q, got %q", pinning.ProvenanceDiscovery, info.Provenance)
+	}
+	if info.SourceDetail != server.URL+"/.well-known/schemapin.json" {
+		t.Errorf("Expected the discovery URL as source detail, got %q", info.SourceDetail)
+	}
+}
+
+func TestSchemaVerificationWorkflow_WithTimings(t *testing.T) {
+	privateKeyPEM, publicKeyPEM, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	const delay = 20 * time.Millisecond
+	server, _ := newCountingDiscoveryServer(t, discovery.WellKnownResponse{
+		SchemaVersion: "1.2",
+		DeveloperName: "Timed Dev",
+		PublicKeyPEM:  publicKeyPEM,
+	}, delay)
+
+	signer, _ := NewSchemaSigningWorkflow(privateKeyPEM)
+	schema := map[string]interface{}{"type": "object"}
+	signature, _ := signer.SignSchema(schema)
+
+	workflow, err := NewSchemaVerificationWorkflow(filepath.Join(t.TempDir(), "timings.db"), WithTimings(true))
+	if err != nil {
+		t.Fatalf("Failed to create verification workflow: %v", err)
+	}
+	defer workflow.Close()
+
+	for _, step := range []string{"first use", "pinned"} {
+		result, err := workflow.VerifySchema(context.Background(), schema, signature, "tool", server.URL, true)
+		if err != nil || !result.Valid {
+			t.Fatalf("%s: expected valid result, got %+v, %v", step, result, err)
+		}
+		timings, ok := result.Metadata[verification.MetadataTimings].(map[string]int64)
+		if !ok {
+			t.Fatalf("%s: expected timings in metadata, got %v", step, result.Metadata)
+		}
+		var sum int64
+		for _, key := range []string{
+			verification.TimingDiscoveryFetch,
+			verification.TimingRevocationCheck,
+			verification.TimingPinLookup,
+			verification.TimingCanonicalize,
+			verification.TimingSignatureVerify,
+			verification.TimingPinUpdate,
+		} {
+			d, ok := timings[key]
+			if !ok {
+				t.Errorf("%s: expected a %s timing, got %v", step, key, timings)
+			}
+			sum += d
+		}
+		total := timings[verification.TimingTotal]
+		if fetch := timings[verification.TimingDiscoveryFetch]; fetch < delay.Microseconds() {
+			t.Errorf("%s: expected discovery_fetch of at least %v, got %dus", step, delay, fetch)
+		}
+		// The steps cover all but the bookkeeping between them
+		if sum > total || sum < total*8/10 {
+			t.Errorf("%s: expected the steps (%dus) to roughly add up to the total (%dus)", step, sum, total)
+		}
+	}
+
+	untimed, err := NewSchemaVerificationWorkflow(filepath.Join(t.TempDir(), "untimed.db"))
+	if err != nil {
+		t.Fatalf("Failed to create verification workflow: %v", err)
+	}
+	defer untimed.Close()
+	result, err := untimed.VerifySchema(context.Background(), schema, signature, "tool", server.URL, true)
+	if err != nil || !result.Valid {
+		t.Fatalf("Expected valid result, got %+v, %v", result, err)
+	}
+	if _, ok := result.Metadata[verification.MetadataTimings]; ok {
+		t.Errorf("Expected no timings without WithTimings, got %v", result.Metadata)
+	}
+}
+
+// BenchmarkVerifySchemaDiscovery compares first-use verification, which
+// fetches .well-known once, with assembling the same data from the
+// per-field discovery calls, which fetch it three times. The server adds
+// 2ms of latency per request.
+func BenchmarkVerifySchemaDiscovery(b *testing.B) {
+	privateKeyPEM, publicKeyPEM, err := GenerateKeyPair()
+	if err != nil {
+		b.Fatalf("Failed to generate key pair: %v", err)
+	}
+	server, _ := newCountingDiscoveryServer(b, discovery.WellKnownResponse{
+		SchemaVersion: "1.2",
+		DeveloperName: "Bench Dev",
+		PublicKeyPEM:  publicKeyPEM,
+	}, 2*time.Millisecond)
+
+	signer, _ := NewSchemaSigningWorkflow(privateKeyPEM)
+	schema := map[string]interface{}{"type": "object"}
+	signature, _ := signer.SignSchema(schema)
+	schemaHash, _ := CalculateSchemaHash(schema)
+	ctx := context.Background()
+
+	b.Run("fetch-once", func(b *testing.B) {
+		workflow, err := NewSchemaVerificationWorkflow(filepath.Join(b.TempDir(), "bench.db"))
+		if err != nil {
+			b.Fatalf("Failed to create verification workflow: %v", err)
+		}
+		defer workflow.Close()
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			result, err := workflow.VerifySchema(ctx, schema, signature, "tool", server.URL, false)
+			if err != nil || !result.Valid {
+				b.Fatalf("Expected valid result, got %+v, %v", result, err)
+			}
+		}
+	})
+
+	b.Run("per-field-fetches", func(b *testing.B) {
+		d := discovery.NewPublicKeyDiscovery()
+		for i := 0; i < b.N; i++ {
+			keyPEM, err := d.GetPublicKeyPEM(ctx, server.URL)
+			if err != nil {
+				b.Fatalf("GetPublicKeyPEM failed: %v", err)
+			}
+			if notRevoked, _ := d.ValidateKeyNotRevoked(ctx, keyPEM, server.URL); !notRevoked {
+				b.Fatal("Expected key not to be revoked")
+			}
+			if _, err := d.GetDeveloperInfo(ctx, server.URL); err != nil {
+				b.Fatalf("GetDeveloperInfo failed: %v", err)
+			}
+			if valid, _ := VerifySignatureOnly(schemaHash, signature, keyPEM); !valid {
+				b.Fatal("Expected valid signature")
+			}
+		}
+	})
+}
+
+// BenchmarkVerifySchemaDiscoveryTLS verifies a batch of tools of one
+// vendor over HTTPS with HTTP/2, keeping connections alive as by default or
+// connecting anew for every request. It reports the TLS connections
+// accepted per verification.
+func BenchmarkVerifySchemaDiscoveryTLS(b *testing.B) {
+	privateKeyPEM, publicKeyPEM, err := GenerateKeyPair()
+	if err != nil {
+		b.Fatalf("Failed to generate key pair: %v", err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(CreateWellKnownResponse(publicKeyPEM, "Bench Dev", "", nil, "1.2", ""))
+	}))
+	var conns atomic.Int64
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+
+	signer, _ := NewSchemaSigningWorkflow(privateKeyPEM)
+	schema := map[string]interface{}{"type": "object"}
+	signature, _ := signer.SignSchema(schema)
+
+	for _, bench := range []struct {
+		name  string
+		opts  []discovery.Option
+		reuse bool
+	}{
+		{"keep-alive", nil, true},
+		{"no-idle-conns", []discovery.Option{discovery.WithDisableHTTP2(true), discovery.WithMaxIdleConnsPerHost(0)}, false},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			workflow, err := NewSchemaVerificationWorkflow(filepath.Join(b.TempDir(), "bench.db"),
+				WithDiscoveryOptions(append([]discovery.Option{discovery.WithRootCAs(roots)}, bench.opts...)...))
+			if err != nil {
+				b.Fatalf("Failed to create verification workflow: %v", err)
+			}
+			defer workflow.Close()
+			var fresh atomic.Int64
+			ctx := httptrace.WithClientTrace(context.Background(), &httptrace.ClientTrace{
+				GotConn: func(info httptrace.GotConnInfo) {
+					if !info.Reused {
+						fresh.Add(1)
+					}
+				},
+			})
+
+			conns.Store(0)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				result, err := workflow.VerifySchema(ctx, schema, signature, fmt.Sprintf("tool-%d", i), server.URL, true)
+				if err != nil || !result.Valid {
+					b.Fatalf("Expected valid result, got %+v, %v", result, err)
+				}
+			}
+			b.StopTimer()
+			b.ReportMetric(float64(conns.Load())/float64(b.N), "conns/op")
+			if bench.reuse && (fresh.Load() != 1 || conns.Load() != 1) {
+				b.Errorf("Expected every request on one connection, got %d new connections, %d accepted", fresh.Load(), conns.Load())
+			}
+		})
+	}
+}
+
+func TestSchemaVerificationWorkflow_VerifySchema_RecordsPinStatistics(t *testing.T) {
+	privateKeyPEM, publicKeyPEM, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	server, _ := newCountingDiscoveryServer(t, discovery.WellKnownResponse{
+		SchemaVersion: "1.2",
+		DeveloperName: "Stats Dev",
+		PublicKeyPEM:  publicKeyPEM,
+	}, 0)
+
+	signer, _ := NewSchemaSigningWorkflow(privateKeyPEM)
+	schema := map[string]interface{}{"type": "object"}
+	signature, _ := signer.SignSchema(schema)
+	tampered := map[string]interface{}{"type": "string"}
+
+	workflow, err := NewSchemaVerificationWorkflow(filepath.Join(t.TempDir(), "stats.db"))
+	if err != nil {
+		t.Fatalf("Failed to create verification workflow: %v", err)
+	}
+	defer workflow.Close()
+
+	ctx := context.Background()
+	// First use pins the key and counts as the first success
+	for i, s := range []map[string]interface{}{schema, schema, tampered, schema, tampered} {
+		result, err := workflow.VerifySchema(ctx, s, signature, "tool", server.URL, true)
+		if err != nil {
+			t.Fatalf("Verification %d failed: %v", i, err)
+		}
+		if want := i != 2 && i != 4; result.Valid != want {
+			t.Fatalf("Verification %d: expected valid=%v, got %+v", i, want, result)
+		}
+	}
+
+	info, err := workflow.GetPinnedKeyInfo("tool")
+	if err != nil || info == nil {
+		t.Fatalf("Expected pinned key info, got %v, %v", info, err)
+	}
+	if info.VerificationCount != 5 || info.SuccessCount != 3 || info.FailureCount != 2 {
+		t.Errorf("Expected 5 verifications (3 ok, 2 failed), got %d (%d, %d)",
+			info.VerificationCount, info.SuccessCount, info.FailureCount)
+	}
+	if info.FirstVerified.IsZero() || len(info.RecentVerifications) != 5 {
+		t.Errorf("Expected first_verified and 5 recent verifications, got %+v", info)
+	}
+}
+
+func TestSchemaVerificationWorkflow_VerifySchema_ErrorKinds(t *testing.T) {
+	privateKeyPEM, publicKeyPEM, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	signer, _ := NewSchemaSigningWorkflow(privateKeyPEM)
+	schema := map[string]interface{}{"type": "object"}
+	signature, _ := signer.SignSchema(schema)
+	fingerprint, _ := crypto.NewKeyManager().CalculateKeyFingerprintFromPEM(publicKeyPEM)
+
+	var mu sync.Mutex
+	wellKnown := discovery.WellKnownResponse{
+		SchemaVersion: "1.2",
+		PublicKeyPEM:  publicKeyPEM,
+		Tools:         map[string]discovery.ToolKey{"scoped": {PublicKeyPEM: publicKeyPEM}},
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		_ = json.NewEncoder(w).Encode(wellKnown)
+	}))
+	defer server.Close()
+	missing := httptest.NewServer(http.NotFoundHandler())
+	defer missing.Close()
+
+	workflow, err := NewSchemaVerificationWorkflow(filepath.Join(t.TempDir(), "kinds.db"))
+	if err != nil {
+		t.Fatalf("Failed to create verification workflow: %v", err)
+	}
+	defer workflow.Close()
+	ctx := context.Background()
+
+	check := func(name string, result *VerificationResult, kind *schemaerr.Kind, code string) {
+		t.Helper()
+		if result.Valid || result.ErrorCode != code {
+			t.Fatalf("%s: expected %s, got valid=%v code=%s", name, code, result.Valid, result.ErrorCode)
+		}
+		if !errors.Is(result.Err(), kind) {
+			t.Errorf("%s: expected errors.Is(%v, %v)", name, result.Err(), kind)
+		}
+		var e *schemaerr.Error
+		if !errors.As(result.Err(), &e) || e.ToolID == "" || e.Domain == "" {
+			t.Errorf("%s: expected a *schemaerr.Error with tool and domain, got %#v", name, result.Err())
+		}
+		if e != nil && e.Error() != result.Error {
+			t.Errorf("%s: expected error text %q, got %q", name, result.Error, e.Error())
+		}
+	}
+
+	// Discovery 404
+	result, _ := workflow.VerifySchema(ctx, schema, signature, "tool", missing.URL, false)
+	check("discovery 404", result, schemaerr.ErrDiscoveryNotFound, ErrDiscoveryFailed)
+	var statusErr *discovery.HTTPStatusError
+	if !errors.As(result.Err(), &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected the HTTP status error to be preserved, got %v", result.Err())
+	}
+
+	// Pin mismatch: the tool's scoped key is withdrawn after pinning
+	if result, _ = workflow.VerifySchema(ctx, schema, signature, "scoped/tool", server.URL, true); !result.Valid {
+		t.Fatalf("Expected first use to verify, got %+v", result)
+	}
+	mu.Lock()
+	wellKnown.Tools = nil
+	mu.Unlock()
+	result, _ = workflow.VerifySchema(ctx, schema, signature, "scoped/tool", server.URL, false)
+	check("pin mismatch", result, schemaerr.ErrKeyPinMismatch, ErrKeyChanged)
+
+	// Revoked key
+	mu.Lock()
+	wellKnown.RevokedKeys = []string{fingerprint}
+	mu.Unlock()
+	result, _ = workflow.VerifySchema(ctx, schema, signature, "tool", server.URL, false)
+	check("revoked key", result, schemaerr.ErrKeyRevoked, ErrKeyRevoked)
+	var e *schemaerr.Error
+	if errors.As(result.Err(), &e) && e.Fingerprint != fingerprint {
+		t.Errorf("Expected fingerprint %s on the error, got %s", fingerprint, e.Fingerprint)
+	}
+	if errors.Is(result.Err(), schemaerr.ErrDiscoveryFailed) {
+		t.Error("Revoked key should not match ErrDiscoveryFailed")
+	}
+}
+
+func TestVerifySchemaPropagatesRequestID(t *testing.T) {
+	privPEM, pubPEM, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	type seen struct{ userAgent, requestID string }
+	var mu sync.Mutex
+	requests := map[string]seen{}
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path] = seen{r.Header.Get("User-Agent"), r.Header.Get(requestid.Header)}
+		mu.Unlock()
+		if r.URL.Path == "/revocations.json" {
+			_ = json.NewEncoder(w).Encode(revocation.BuildRevocationDocument("example.com"))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(discovery.WellKnownResponse{
+			SchemaVersion:      "1.2",
+			DeveloperName:      "Example",
+			PublicKeyPEM:       pubPEM,
+			RevocationEndpoint: server.URL + "/revocations.json",
+		})
+	}))
+	defer server.Close()
+
+	var logs bytes.Buffer
+	workflow, err := NewSchemaVerificationWorkflow(filepath.Join(t.TempDir(), "trace.db"),
+		WithDiscoveryOptions(discovery.WithUserAgentSuffix("acme-gateway/2.1")),
+		WithLogger(slog.New(slog.NewJSONHandler(&logs, nil))))
+	if err != nil {
+		t.Fatalf("Failed to create verification workflow: %v", err)
+	}
+	defer workflow.Close()
+
+	signer, err := NewSchemaSigningWorkflow(privPEM)
+	if err != nil {
+		t.Fatalf("Failed to create signing workflow: %v", err)
+	}
+	schema := map[string]interface{}{"name": "search", "type": "object"}
+	signature, err := signer.SignSchema(schema)
+	if err != nil {
+		t.Fatalf("Failed to sign schema: %v", err)
+	}
+
+	// A caller-supplied ID reaches both endpoints, the result, the logs and
+	// the pin's verification history
+	ctx := requestid.NewContext(context.Background(), "req-1876")
+	result, err := workflow.VerifySchema(ctx, schema, signature, "search", server.URL, true)
+	if err != nil || !result.Valid {
+		t.Fatalf("Expected valid verification, got %+v, %v", result, err)
+	}
+	if result.Metadata["request_id"] != "req-1876" {
+		t.Errorf("Expected request_id req-1876 in metadata, got %v", result.Metadata["request_id"])
+	}
+	wantUA := "schemapin-go/" + version.Version + " acme-gateway/2.1"
+	for _, path := range []string{"/.well-known/schemapin.json", "/revocations.json"} {
+		if got := requests[path]; got.requestID != "req-1876" || got.userAgent != wantUA {
+			t.Errorf("Expected %s to receive %q and req-1876, got %+v", path, wantUA, got)
+		}
+	}
+	if !strings.Contains(logs.String(), `"msg":"schema verified","request_id":"req-1876"`) {
+		t.Errorf("Expected the request ID in the verification log, got %s", logs.String())
+	}
+	info, err := workflow.GetPinnedKeyInfo("search")
+	if err != nil || info == nil || len(info.RecentVerifications) != 1 || info.RecentVerifications[0].RequestID != "req-1876" {
+		t.Fatalf("Expected the verification event to record req-1876, got %+v, %v", info, err)
+	}
+
+	// Without one, each verification gets a fresh ID that the server sees
+	result, err = workflow.VerifySchema(context.Background(), schema, signature, "search", server.URL, false)
+	if err != nil || !result.Valid {
+		t.Fatalf("Expected valid verification, got %+v, %v", result, err)
+	}
+	generated, _ := result.Metadata["request_id"].(string)
+	if generated == "" || generated == "req-1876" {
+		t.Fatalf("Expected a generated request ID, got %q", generated)
+	}
+	if got := requests["/revocations.json"].requestID; got != generated {
+		t.Errorf("Expected the server to receive %q, got %q", generated, got)
+	}
+}
+
+func TestSchemaVerificationWorkflow_VerifySchema_SchemaHash(t *testing.T) {
+	privateKeyPEM, publicKeyPEM, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	signer, _ := NewSchemaSigningWorkflow(privateKeyPEM)
+	schema := map[string]interface{}{"type": "object", "title": "hashed"}
+	signature, _ := signer.SignSchema(schema)
+	schemaHash, err := CalculateSchemaHash(schema)
+	if err != nil {
+		t.Fatalf("Failed to calculate schema hash: %v", err)
+	}
+	want := core.FormatSchemaHash(schemaHash)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(discovery.WellKnownResponse{SchemaVersion: "1.2", PublicKeyPEM: publicKeyPEM})
+	}))
+	defer server.Close()
+
+	workflow, err := NewSchemaVerificationWorkflow(filepath.Join(t.TempDir(), "hash.db"))
+	if err != nil {
+		t.Fatalf("Failed to create verification workflow: %v", err)
+	}
+	defer workflow.Close()
+	ctx := context.Background()
+
+	result, err := workflow.VerifySchema(ctx, schema, signature, "tool", server.URL, true)
+	if err != nil || !result.Valid {
+		t.Fatalf("Expected valid result, got %+v, %v", result, err)
+	}
+	if result.SchemaHash != want {
+		t.Errorf("Expected schema hash %s, got %s", want, result.SchemaHash)
+	}
+
+	other, _ := signer.SignSchema(map[string]interface{}{"type": "object"})
+	result, _ = workflow.VerifySchema(ctx, schema, other, "tool", server.URL, false)
+	if result.Valid || result.ErrorCode != ErrSignatureInvalid {
+		t.Fatalf("Expected %s, got %+v", ErrSignatureInvalid, result)
+	}
+	if result.SchemaHash != want {
+		t.Errorf("Expected schema hash %s on a failed signature, got %s", want, result.SchemaHash)
+	}
+}
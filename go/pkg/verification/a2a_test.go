@@ -289,3 +289,45 @@ func TestVerifySchemaForA2AWildcardCallerAllowList(t *testing.T) {
 		t.Fatalf("expected valid, got %+v", result)
 	}
 }
+
+func TestVerifySchemaOfflineCanonicalizationJCS(t *testing.T) {
+	f := setupSignedSchema(t)
+	kp, err := crypto.NewKeyManager().GenerateKeypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.disc.PublicKeyPEM, err = crypto.NewKeyManager().ExportPublicKeyPEM(&kp.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// HTML and a large number canonicalize differently under JCS
+	f.schema["description"] = "Returns <a> + <b>"
+	f.schema["maximum"] = 1e21
+	schemaHash, err := core.NewSchemaPinCore().CanonicalizeAndHashForSignature(f.schema, core.CurrentSchemapinVersion, CanonicalizationJCS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := crypto.NewSignatureManager().SignHash(schemaHash, kp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := VerifySchemaOfflineWithCanonicalization(
+		f.schema, sig, "example.com", "calculate_sum",
+		f.disc, nil, NewKeyPinStore(), CanonicalizationJCS,
+	)
+	if !result.Valid {
+		t.Fatalf("expected valid, got %+v", result)
+	}
+
+	// The same signature fails under the legacy canonicalizer
+	for _, canonicalization := range []string{"", CanonicalizationV1} {
+		result := VerifySchemaOfflineWithCanonicalization(
+			f.schema, sig, "example.com", "calculate_sum",
+			f.disc, nil, NewKeyPinStore(), canonicalization,
+		)
+		if result.Valid || result.ErrorCode != ErrSignatureInvalid {
+			t.Errorf("canonicalization %q: expected %s, got %+v", canonicalization, ErrSignatureInvalid, result)
+		}
+	}
+}
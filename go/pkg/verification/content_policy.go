@@ -0,0 +1,151 @@
+package verification
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// ErrContentPolicyViolation — a verified skill's file manifest violates a
+// deny-severity ContentPolicy.
+const ErrContentPolicyViolation ErrorCode = "content_policy_violation"
+
+// ContentPolicySeverity controls whether policy violations fail verification
+// or are surfaced as warnings.
+type ContentPolicySeverity string
+
+const (
+	ContentPolicySeverityDeny ContentPolicySeverity = "deny"
+	ContentPolicySeverityWarn ContentPolicySeverity = "warn"
+)
+
+// ContentPolicy describes coarse checks applied to a skill's file manifest
+// after its signature has been validated. Zero values disable a check.
+type ContentPolicy struct {
+	// DeniedExtensions lists file extensions (e.g. ".so", ".exe") that may
+	// not appear in the skill. Matching is case-insensitive.
+	DeniedExtensions []string `json:"denied_extensions,omitempty" yaml:"denied_extensions,omitempty"`
+	// DeniedGlobs lists path.Match patterns evaluated against both the
+	// manifest path (forward slashes) and the file's base name.
+	DeniedGlobs []string `json:"denied_globs,omitempty" yaml:"denied_globs,omitempty"`
+	// MaxFileCount caps the number of files in the manifest.
+	MaxFileCount int `json:"max_file_count,omitempty" yaml:"max_file_count,omitempty"`
+	// MaxFileSize caps the size in bytes of any single file, as read from
+	// disk by the skill verifier.
+	MaxFileSize int64 `json:"max_file_size,omitempty" yaml:"max_file_size,omitempty"`
+	// Severity is "deny" (default) or "warn".
+	Severity ContentPolicySeverity `json:"severity,omitempty" yaml:"severity,omitempty"`
+}
+
+// LoadContentPolicy reads a JSON content policy from path.
+func LoadContentPolicy(path string) (*ContentPolicy, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- path supplied by the caller
+	if err != nil {
+		return nil, fmt.Errorf("failed to read content policy: %w", err)
+	}
+
+	var policy ContentPolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse content policy: %w", err)
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// Validate checks the policy's severity and glob patterns.
+func (p *ContentPolicy) Validate() error {
+	switch p.Severity {
+	case "", ContentPolicySeverityDeny, ContentPolicySeverityWarn:
+	default:
+		return fmt.Errorf("invalid content policy severity: %q", p.Severity)
+	}
+	for _, pattern := range p.DeniedGlobs {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid content policy glob %q: %w", pattern, err)
+		}
+	}
+	if p.MaxFileCount < 0 || p.MaxFileSize < 0 {
+		return fmt.Errorf("content policy limits must not be negative")
+	}
+	return nil
+}
+
+// Evaluate returns the policy violations for a file manifest, sorted for
+// stable output. MaxFileSize is not evaluated if sizes is nil.
+func (p *ContentPolicy) Evaluate(manifest map[string]string, sizes map[string]int64) []string {
+	var violations []string
+
+	if p.MaxFileCount > 0 && len(manifest) > p.MaxFileCount {
+		violations = append(violations, fmt.Sprintf("skill contains %d files, exceeding limit of %d", len(manifest), p.MaxFileCount))
+	}
+
+	paths := make([]string, 0, len(manifest))
+	for filePath := range manifest {
+		paths = append(paths, filePath)
+	}
+	sort.Strings(paths)
+
+	for _, filePath := range paths {
+		ext := strings.ToLower(path.Ext(filePath))
+		for _, denied := range p.DeniedExtensions {
+			if ext != "" && ext == strings.ToLower(denied) {
+				violations = append(violations, fmt.Sprintf("%s has denied extension %s", filePath, ext))
+				break
+			}
+		}
+
+		base := path.Base(filePath)
+		for _, pattern := range p.DeniedGlobs {
+			fullMatch, _ := path.Match(pattern, filePath)
+			baseMatch, _ := path.Match(pattern, base)
+			if fullMatch || baseMatch {
+				violations = append(violations, fmt.Sprintf("%s matches denied pattern %s", filePath, pattern))
+				break
+			}
+		}
+
+		if p.MaxFileSize > 0 && sizes != nil {
+			if size, ok := sizes[filePath]; ok && size > p.MaxFileSize {
+				violations = append(violations, fmt.Sprintf("%s is %d bytes, exceeding limit of %d", filePath, size, p.MaxFileSize))
+			}
+		}
+	}
+
+	return violations
+}
+
+// WithContentPolicy evaluates policy against a verified manifest. Deny
+// violations fail the result with ErrContentPolicyViolation; warn
+// violations are appended to Warnings. sizes are the file sizes
+// MaxFileSize is checked against, e.g. as the skill verifier reads them
+// from disk. A nil policy or an already-failed result is returned
+// unchanged.
+func (r *VerificationResult) WithContentPolicy(policy *ContentPolicy, manifest map[string]string, sizes map[string]int64) *VerificationResult {
+	if policy == nil || !r.Valid {
+		return r
+	}
+
+	violations := policy.Evaluate(manifest, sizes)
+	if len(violations) == 0 {
+		return r
+	}
+
+	if policy.Severity == ContentPolicySeverityWarn {
+		for _, violation := range violations {
+			r.Warnings = append(r.Warnings, "content_policy: "+violation)
+		}
+		return r
+	}
+
+	return &VerificationResult{
+		Valid:        false,
+		Domain:       r.Domain,
+		ErrorCode:    ErrContentPolicyViolation,
+		ErrorMessage: "Content policy violation: " + strings.Join(violations, "; "),
+	}
+}
@@ -0,0 +1,123 @@
+package verification
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestContentPolicyEvaluate(t *testing.T) {
+	manifest := map[string]string{
+		"SKILL.md":        "sha256:00",
+		"lib/native.DLL":  "sha256:01",
+		"tools/setup.exe": "sha256:02",
+		"data/big.bin":    "sha256:03",
+	}
+	sizes := map[string]int64{
+		"SKILL.md":        100,
+		"lib/native.DLL":  200,
+		"tools/setup.exe": 300,
+		"data/big.bin":    5000,
+	}
+
+	tests := []struct {
+		name   string
+		policy ContentPolicy
+		sizes  map[string]int64
+		want   []string
+	}{
+		{
+			name:   "extensions are case-insensitive",
+			policy: ContentPolicy{DeniedExtensions: []string{".dll"}},
+			want:   []string{"lib/native.DLL has denied extension .dll"},
+		},
+		{
+			name:   "glob matches base name and full path",
+			policy: ContentPolicy{DeniedGlobs: []string{"*.exe", "data/*"}},
+			want: []string{
+				"data/big.bin matches denied pattern data/*",
+				"tools/setup.exe matches denied pattern *.exe",
+			},
+		},
+		{
+			name:   "file count",
+			policy: ContentPolicy{MaxFileCount: 2},
+			want:   []string{"skill contains 4 files, exceeding limit of 2"},
+		},
+		{
+			name:   "file size",
+			policy: ContentPolicy{MaxFileSize: 1000},
+			sizes:  sizes,
+			want:   []string{"data/big.bin is 5000 bytes, exceeding limit of 1000"},
+		},
+		{
+			name:   "file size without sizes is skipped",
+			policy: ContentPolicy{MaxFileSize: 1000},
+			want:   nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.policy.Evaluate(manifest, tt.sizes)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Evaluate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithContentPolicy(t *testing.T) {
+	manifest := map[string]string{"run.exe": "sha256:00"}
+	policy := &ContentPolicy{DeniedExtensions: []string{".exe"}}
+
+	result := (&VerificationResult{Valid: true, Domain: "example.com"}).WithContentPolicy(policy, manifest, nil)
+	if result.Valid || result.ErrorCode != ErrContentPolicyViolation {
+		t.Errorf("expected content_policy_violation, got valid=%v code=%q", result.Valid, result.ErrorCode)
+	}
+	if result.Domain != "example.com" {
+		t.Errorf("expected domain to be preserved, got %q", result.Domain)
+	}
+
+	policy.Severity = ContentPolicySeverityWarn
+	result = (&VerificationResult{Valid: true}).WithContentPolicy(policy, manifest, nil)
+	if !result.Valid || len(result.Warnings) != 1 {
+		t.Errorf("expected valid result with one warning, got valid=%v warnings=%v", result.Valid, result.Warnings)
+	}
+
+	failed := &VerificationResult{Valid: false, ErrorCode: ErrSignatureInvalid}
+	if got := failed.WithContentPolicy(policy, manifest, nil); got != failed {
+		t.Error("expected failed result to be returned unchanged")
+	}
+}
+
+func TestLoadContentPolicy(t *testing.T) {
+	dir := t.TempDir()
+
+	valid := filepath.Join(dir, "policy.json")
+	if err := os.WriteFile(valid, []byte(`{"denied_extensions": [".so"], "max_file_count": 50, "severity": "warn"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := LoadContentPolicy(valid)
+	if err != nil {
+		t.Fatalf("LoadContentPolicy() error = %v", err)
+	}
+	if policy.MaxFileCount != 50 || policy.Severity != ContentPolicySeverityWarn {
+		t.Errorf("unexpected policy: %+v", policy)
+	}
+
+	for name, content := range map[string]string{
+		"severity.json": `{"severity": "block"}`,
+		"glob.json":     `{"denied_globs": ["[bad"]}`,
+		"limit.json":    `{"max_file_size": -1}`,
+	} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadContentPolicy(path); err == nil {
+			t.Errorf("expected error for %s", name)
+		}
+	}
+}
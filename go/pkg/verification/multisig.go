@@ -0,0 +1,203 @@
+package verification
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+)
+
+// SignatureEntry is one signature in the signatures array of a signed
+// schema. Every entry signs the same canonical schema hash.
+type SignatureEntry struct {
+	// SignerKid names the signing key by its fingerprint. Entries without
+	// one, such as a signature converted from the single signature field,
+	// are matched against every key in the key set.
+	SignerKid string `json:"signer_kid,omitempty"`
+	Signature string `json:"signature"`
+	SignedAt  string `json:"signed_at,omitempty"`
+}
+
+// SignatureEntries returns the signatures of a signed schema: signatures
+// when it has any, otherwise the single signature as a one-element array.
+func SignatureEntries(signature string, signatures []SignatureEntry) []SignatureEntry {
+	if len(signatures) > 0 {
+		return signatures
+	}
+	if signature == "" {
+		return nil
+	}
+	return []SignatureEntry{{Signature: signature}}
+}
+
+// SignerKeySet maps signer kids (key fingerprints) to public key PEMs. Kids
+// are compared after crypto.NormalizeFingerprint, so a set built with
+// upper-case fingerprints matches lower-case signer_kids and the reverse.
+type SignerKeySet map[string]string
+
+// NewSignerKeySet builds a key set from public key PEMs, keyed by their
+// fingerprints.
+func NewSignerKeySet(publicKeyPEMs ...string) (SignerKeySet, error) {
+	keyManager := crypto.NewKeyManager()
+	keys := make(SignerKeySet, len(publicKeyPEMs))
+	for _, publicKeyPEM := range publicKeyPEMs {
+		fingerprint, err := keyManager.CalculateKeyFingerprintFromPEM(publicKeyPEM)
+		if err != nil {
+			return nil, fmt.Errorf("failed to calculate key fingerprint: %w", err)
+		}
+		keys[fingerprint] = publicKeyPEM
+	}
+	return keys, nil
+}
+
+// PublishedKeySet returns the keys disc publishes for toolID. Discovery
+// documents publish a single key per tool, so with one published key only
+// that key's signatures count towards a threshold.
+func PublishedKeySet(disc *discovery.WellKnownResponse, toolID string) (SignerKeySet, error) {
+	return NewSignerKeySet(disc.KeyForTool(toolID).PublicKeyPEM)
+}
+
+// ThresholdOption configures VerifySignatureThreshold.
+type ThresholdOption func(*thresholdConfig)
+
+type thresholdConfig struct {
+	required int
+	signers  []string
+}
+
+// RequireSignatures requires valid signatures from at least n distinct
+// signers. The default is 1.
+func RequireSignatures(n int) ThresholdOption {
+	return func(c *thresholdConfig) {
+		if n > 0 {
+			c.required = n
+		}
+	}
+}
+
+// RequireSigners requires a valid signature from each of kids, in addition
+// to the RequireSignatures threshold. Kids are normalized with
+// crypto.NormalizeFingerprint.
+func RequireSigners(kids []string) ThresholdOption {
+	return func(c *thresholdConfig) {
+		for _, kid := range kids {
+			c.signers = append(c.signers, crypto.NormalizeFingerprint(kid))
+		}
+	}
+}
+
+// SignatureFailure is a signatures entry that did not count towards the
+// threshold.
+type SignatureFailure struct {
+	// Index is the entry's position in the signatures array.
+	Index     int    `json:"index"`
+	SignerKid string `json:"signer_kid,omitempty"`
+	Reason    string `json:"reason"`
+}
+
+// ThresholdResult is the outcome of VerifySignatureThreshold.
+type ThresholdResult struct {
+	Valid bool `json:"valid"`
+	// Required is the number of distinct valid signers needed.
+	Required int `json:"required"`
+	// Signers lists the kids with a valid signature, each once, in entry
+	// order, normalized with crypto.NormalizeFingerprint.
+	Signers []string `json:"signers"`
+	// Failures lists the entries that were invalid or signed by a key
+	// outside the key set.
+	Failures []SignatureFailure `json:"failures,omitempty"`
+	// MissingSigners lists the RequireSigners kids without a valid
+	// signature.
+	MissingSigners []string  `json:"missing_signers,omitempty"`
+	ErrorCode      ErrorCode `json:"error_code,omitempty"`
+	ErrorMessage   string    `json:"error_message,omitempty"`
+}
+
+// VerifySignatureThreshold verifies every entry against schemaHash with the
+// keys of keys and checks the threshold set by opts. An entry counts when
+// its kid is in keys and its signature verifies; several entries by the
+// same signer count once. Kids are matched after
+// crypto.NormalizeFingerprint, so that the case of a kid does not decide
+// whether it counts or is counted twice. Entries that fail are reported but only fail
+// verification if the threshold is then not met.
+//
+// With the default threshold of one and no required signers, a result
+// without any valid signature fails with ErrSignatureInvalid, as a single
+// signature would; otherwise an unmet threshold fails with
+// ErrSignatureThresholdNotMet.
+func VerifySignatureThreshold(schemaHash []byte, entries []SignatureEntry, keys SignerKeySet, opts ...ThresholdOption) *ThresholdResult {
+	config := thresholdConfig{required: 1}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	result := &ThresholdResult{Required: config.required, Signers: []string{}}
+
+	normalized := make(SignerKeySet, len(keys))
+	for kid, publicKeyPEM := range keys {
+		normalized[crypto.NormalizeFingerprint(kid)] = publicKeyPEM
+	}
+	keyManager := crypto.NewKeyManager()
+	sigManager := crypto.NewSignatureManager()
+	verifies := func(kid, signature string) bool {
+		publicKey, err := keyManager.LoadPublicKeyPEM(normalized[kid])
+		return err == nil && sigManager.VerifySchemaSignature(schemaHash, signature, publicKey)
+	}
+	kids := make([]string, 0, len(normalized))
+	for kid := range normalized {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	valid := make(map[string]bool)
+	for i, entry := range entries {
+		signer, kid := "", crypto.NormalizeFingerprint(entry.SignerKid)
+		switch {
+		case kid == "":
+			for _, kid := range kids {
+				if verifies(kid, entry.Signature) {
+					signer = kid
+					break
+				}
+			}
+			if signer == "" {
+				result.Failures = append(result.Failures, SignatureFailure{Index: i, Reason: "signature matches no key in the key set"})
+				continue
+			}
+		case normalized[kid] == "":
+			result.Failures = append(result.Failures, SignatureFailure{Index: i, SignerKid: entry.SignerKid, Reason: "signer is not in the published key set"})
+			continue
+		case !verifies(kid, entry.Signature):
+			result.Failures = append(result.Failures, SignatureFailure{Index: i, SignerKid: entry.SignerKid, Reason: "signature verification failed"})
+			continue
+		default:
+			signer = kid
+		}
+		if !valid[signer] {
+			valid[signer] = true
+			result.Signers = append(result.Signers, signer)
+		}
+	}
+
+	for _, kid := range config.signers {
+		if !valid[kid] {
+			result.MissingSigners = append(result.MissingSigners, kid)
+		}
+	}
+
+	switch {
+	case len(result.Signers) >= config.required && len(result.MissingSigners) == 0:
+		result.Valid = true
+	case len(result.Signers) == 0 && config.required == 1 && len(config.signers) == 0:
+		result.ErrorCode = ErrSignatureInvalid
+		result.ErrorMessage = "signature verification failed"
+	case len(result.MissingSigners) > 0:
+		result.ErrorCode = ErrSignatureThresholdNotMet
+		result.ErrorMessage = fmt.Sprintf("no valid signature from required signers: %s", strings.Join(result.MissingSigners, ", "))
+	default:
+		result.ErrorCode = ErrSignatureThresholdNotMet
+		result.ErrorMessage = fmt.Sprintf("%d of %d required signatures are valid", len(result.Signers), config.required)
+	}
+	return result
+}
@@ -0,0 +1,175 @@
+package verification
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
+	gocrypto "github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+)
+
+// multisigFixture signs schema with three seeded keys and returns the
+// schema hash, a key set holding all three and each key's entry.
+func multisigFixture(t *testing.T, schema map[string]interface{}) ([]byte, SignerKeySet, []SignatureEntry) {
+	t.Helper()
+	hash, err := core.NewSchemaPinCore().CanonicalizeAndHash(schema)
+	if err != nil {
+		t.Fatalf("Failed to hash schema: %v", err)
+	}
+	keys := SignerKeySet{}
+	var entries []SignatureEntry
+	for i := 0; i < 3; i++ {
+		pubPEM, sig, fp := makeKeyAndSign(schema)
+		keys[fp] = pubPEM
+		entries = append(entries, SignatureEntry{SignerKid: fp, Signature: sig, SignedAt: "2026-10-01T00:00:00Z"})
+	}
+	return hash, keys, entries
+}
+
+func TestVerifySignatureThresholdTwoOfThree(t *testing.T) {
+	schema := map[string]interface{}{"name": "multisig", "version": "1"}
+	hash, keys, entries := multisigFixture(t, schema)
+
+	result := VerifySignatureThreshold(hash, entries[:2], keys, RequireSignatures(2))
+	if !result.Valid || result.ErrorCode != "" {
+		t.Fatalf("Expected 2 of 3 to verify, got %+v", result)
+	}
+	if want := []string{entries[0].SignerKid, entries[1].SignerKid}; !reflect.DeepEqual(result.Signers, want) {
+		t.Errorf("Expected signers %v, got %v", want, result.Signers)
+	}
+
+	result = VerifySignatureThreshold(hash, entries[:2], keys, RequireSignatures(2), RequireSigners([]string{entries[1].SignerKid}))
+	if !result.Valid {
+		t.Errorf("Expected a present required signer to verify, got %+v", result)
+	}
+}
+
+func TestVerifySignatureThresholdNotMet(t *testing.T) {
+	schema := map[string]interface{}{"name": "multisig", "version": "1"}
+	hash, keys, entries := multisigFixture(t, schema)
+
+	result := VerifySignatureThreshold(hash, entries[:1], keys, RequireSignatures(2))
+	if result.Valid || result.ErrorCode != ErrSignatureThresholdNotMet {
+		t.Fatalf("Expected threshold not met, got %+v", result)
+	}
+	if len(result.Signers) != 1 || result.Required != 2 {
+		t.Errorf("Expected 1 of 2 signers, got %+v", result)
+	}
+
+	result = VerifySignatureThreshold(hash, entries[:2], keys, RequireSigners([]string{entries[2].SignerKid}))
+	if result.Valid || result.ErrorCode != ErrSignatureThresholdNotMet {
+		t.Fatalf("Expected a missing required signer to fail, got %+v", result)
+	}
+	if !reflect.DeepEqual(result.MissingSigners, []string{entries[2].SignerKid}) {
+		t.Errorf("Expected missing signer %s, got %v", entries[2].SignerKid, result.MissingSigners)
+	}
+
+	// A key outside the published key set does not count
+	published := SignerKeySet{entries[0].SignerKid: keys[entries[0].SignerKid]}
+	result = VerifySignatureThreshold(hash, entries, published, RequireSignatures(2))
+	if result.Valid || len(result.Failures) != 2 || result.Failures[0].Reason != "signer is not in the published key set" {
+		t.Errorf("Expected unpublished signers to fail, got %+v", result)
+	}
+}
+
+func TestVerifySignatureThresholdDuplicateSigners(t *testing.T) {
+	schema := map[string]interface{}{"name": "multisig", "version": "1"}
+	hash, keys, entries := multisigFixture(t, schema)
+
+	duplicated := []SignatureEntry{entries[0], entries[0], entries[0]}
+	result := VerifySignatureThreshold(hash, duplicated, keys, RequireSignatures(2))
+	if result.Valid || result.ErrorCode != ErrSignatureThresholdNotMet {
+		t.Fatalf("Expected one signer repeated to fail a threshold of 2, got %+v", result)
+	}
+	if !reflect.DeepEqual(result.Signers, []string{entries[0].SignerKid}) {
+		t.Errorf("Expected the signer to be counted once, got %v", result.Signers)
+	}
+}
+
+func TestVerifySignatureThresholdMixedCaseKids(t *testing.T) {
+	schema := map[string]interface{}{"name": "multisig", "version": "1"}
+	hash, keys, entries := multisigFixture(t, schema)
+
+	// The key set, the signer_kids and the required signers each spell
+	// the fingerprints differently
+	upper := SignerKeySet{}
+	for kid, publicKeyPEM := range keys {
+		upper["SHA256:"+strings.ToUpper(strings.TrimPrefix(kid, "sha256:"))] = publicKeyPEM
+	}
+	mixed := []SignatureEntry{entries[0], entries[1], entries[1]}
+	mixed[0].SignerKid = strings.ToUpper(mixed[0].SignerKid)
+	mixed[2].SignerKid = " " + strings.ToUpper(mixed[2].SignerKid)
+	required := RequireSigners([]string{strings.ToUpper(entries[1].SignerKid)})
+
+	result := VerifySignatureThreshold(hash, mixed, upper, RequireSignatures(2), required)
+	if !result.Valid || len(result.Failures) != 0 {
+		t.Fatalf("Expected mixed-case kids to verify, got %+v", result)
+	}
+	if want := []string{entries[0].SignerKid, entries[1].SignerKid}; !reflect.DeepEqual(result.Signers, want) {
+		t.Errorf("Expected signers %v, each once, got %v", want, result.Signers)
+	}
+
+	// Spelling one signer two ways does not make two signers
+	result = VerifySignatureThreshold(hash, mixed[1:], upper, RequireSignatures(2))
+	if result.Valid || result.ErrorCode != ErrSignatureThresholdNotMet {
+		t.Errorf("Expected one signer in two spellings to fail a threshold of 2, got %+v", result)
+	}
+}
+
+func TestVerifySignatureThresholdInvalidAmongValid(t *testing.T) {
+	schema := map[string]interface{}{"name": "multisig", "version": "1"}
+	hash, keys, entries := multisigFixture(t, schema)
+
+	// Entry 1 carries the signature of entry 2's key
+	entries[1].Signature = entries[2].Signature
+	result := VerifySignatureThreshold(hash, entries, keys, RequireSignatures(2))
+	if !result.Valid {
+		t.Fatalf("Expected 2 valid signatures to meet the threshold, got %+v", result)
+	}
+	want := []SignatureFailure{{Index: 1, SignerKid: entries[1].SignerKid, Reason: "signature verification failed"}}
+	if !reflect.DeepEqual(result.Failures, want) {
+		t.Errorf("Expected failures %+v, got %+v", want, result.Failures)
+	}
+
+	result = VerifySignatureThreshold(hash, entries, keys, RequireSignatures(3))
+	if result.Valid || result.ErrorCode != ErrSignatureThresholdNotMet {
+		t.Errorf("Expected a threshold of 3 to fail, got %+v", result)
+	}
+}
+
+func TestVerifySignatureThresholdSingleSignature(t *testing.T) {
+	schema := map[string]interface{}{"name": "single", "version": "1"}
+	pubPEM, sig, fp := makeKeyAndSign(schema)
+	hash, err := core.NewSchemaPinCore().CanonicalizeAndHash(schema)
+	if err != nil {
+		t.Fatalf("Failed to hash schema: %v", err)
+	}
+	keys, err := PublishedKeySet(&discovery.WellKnownResponse{PublicKeyPEM: pubPEM}, "single")
+	if err != nil {
+		t.Fatalf("PublishedKeySet failed: %v", err)
+	}
+
+	entries := SignatureEntries(sig, nil)
+	if len(entries) != 1 || entries[0].SignerKid != "" {
+		t.Fatalf("Expected one entry without a kid, got %+v", entries)
+	}
+	result := VerifySignatureThreshold(hash, entries, keys)
+	if !result.Valid || !reflect.DeepEqual(result.Signers, []string{fp}) {
+		t.Errorf("Expected the single signature to verify as %s, got %+v", fp, result)
+	}
+
+	otherKey, err := gocrypto.NewKeyManager().GenerateKeypair()
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+	otherSig, err := gocrypto.NewSignatureManager().SignSchemaHash(hash, otherKey)
+	if err != nil {
+		t.Fatalf("Failed to sign: %v", err)
+	}
+	result = VerifySignatureThreshold(hash, SignatureEntries(otherSig, nil), keys)
+	if result.Valid || result.ErrorCode != ErrSignatureInvalid {
+		t.Errorf("Expected signature_invalid, got %+v", result)
+	}
+}
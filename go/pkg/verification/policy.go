@@ -0,0 +1,424 @@
+package verification
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrPolicyViolation — a Policy rule with fail severity was triggered by a
+// check that has no error code of its own, such as require_pinned.
+const ErrPolicyViolation ErrorCode = "policy_violation"
+
+// Severity is what a Policy does when one of its rules is triggered.
+type Severity string
+
+const (
+	// SeverityOff ignores the rule.
+	SeverityOff Severity = "off"
+	// SeverityWarn records a warning and lets verification continue.
+	SeverityWarn Severity = "warn"
+	// SeverityFail fails verification.
+	SeverityFail Severity = "fail"
+)
+
+// PolicyRule names a check a Policy configures.
+type PolicyRule string
+
+// Policy rules, in the order they are evaluated. A rule is only evaluated
+// by verifiers that have the information it needs: expired_signatures,
+// future_signatures and stale_signatures apply to signatures that carry
+// expires_at or signed_at, content_policy to skills.
+const (
+	// RuleAllowedDomains fails signatures from domains outside
+	// Policy.AllowedDomains. It has no severity; an empty list allows
+	// every domain.
+	RuleAllowedDomains PolicyRule = "allowed_domains"
+	// RuleRevocation is triggered by a revoked key or a revoked signature.
+	RuleRevocation PolicyRule = "revocation"
+	// RuleRequirePinned is triggered when a key is used without having
+	// been pinned for the tool before, including on first use.
+	RuleRequirePinned PolicyRule = "require_pinned"
+	// RuleExpiredSignatures is triggered by a signature past expires_at.
+	RuleExpiredSignatures PolicyRule = "expired_signatures"
+	// RuleFutureSignatures is triggered by a signature whose signed_at is
+	// more than MaxClockSkew in the future.
+	RuleFutureSignatures PolicyRule = "future_signatures"
+	// RuleStaleSignatures is triggered by a signature whose signed_at is
+	// older than the maximum signature age the verifier was given.
+	RuleStaleSignatures PolicyRule = "stale_signatures"
+	// RuleLegacyDiscovery is triggered by a .well-known document with a
+	// schema_version older than 1.2.
+	RuleLegacyDiscovery PolicyRule = "legacy_discovery"
+	// RuleContentPolicy applies Policy.ContentPolicy, with its own
+	// severity, to skills.
+	RuleContentPolicy PolicyRule = "content_policy"
+)
+
+// Built-in policy profiles.
+const (
+	PolicyProfileStrict     = "strict"
+	PolicyProfileDefault    = "default"
+	PolicyProfilePermissive = "permissive"
+)
+
+// Policy declares which verification checks are enabled and at what
+// severity, so a configuration can be shared as a file instead of a set of
+// verifier options. Severities left empty take the value of the built-in
+// Profile the policy extends.
+//
+// Example (YAML):
+//
+//	profile: default
+//	revocation: warn
+//	require_pinned: fail
+//	allowed_domains:
+//	  - tools.example.com
+//	  - "*.corp.example.com"
+//
+// Rules are evaluated in the order of the Rule constants: allowed_domains,
+// revocation, require_pinned, then the signature itself, then
+// expired_signatures, future_signatures, stale_signatures,
+// legacy_discovery and content_policy. The first rule with fail severity ends verification;
+// findings of warn severity accumulate in
+// VerificationResult.PolicyFindings and Warnings.
+type Policy struct {
+	// Profile is the built-in profile ("strict", "default" or
+	// "permissive") the policy extends. Empty means "default".
+	Profile           string   `json:"profile,omitempty" yaml:"profile,omitempty"`
+	Revocation        Severity `json:"revocation,omitempty" yaml:"revocation,omitempty"`
+	RequirePinned     Severity `json:"require_pinned,omitempty" yaml:"require_pinned,omitempty"`
+	ExpiredSignatures Severity `json:"expired_signatures,omitempty" yaml:"expired_signatures,omitempty"`
+	FutureSignatures  Severity `json:"future_signatures,omitempty" yaml:"future_signatures,omitempty"`
+	StaleSignatures   Severity `json:"stale_signatures,omitempty" yaml:"stale_signatures,omitempty"`
+	LegacyDiscovery   Severity `json:"legacy_discovery,omitempty" yaml:"legacy_discovery,omitempty"`
+	// AllowedDomains restricts the signing domains accepted, as exact
+	// domains or "*." wildcards (see A2AAllows). Empty allows any domain.
+	AllowedDomains []string `json:"allowed_domains,omitempty" yaml:"allowed_domains,omitempty"`
+	// ContentPolicy is applied to verified skills.
+	ContentPolicy *ContentPolicy `json:"content_policy,omitempty" yaml:"content_policy,omitempty"`
+	// MaxClockSkew is how far in the future, as a Go duration string, a
+	// signed_at may be before future_signatures is triggered. Empty means
+	// five minutes.
+	MaxClockSkew string `json:"max_clock_skew,omitempty" yaml:"max_clock_skew,omitempty"`
+}
+
+// policyProfiles are the built-in profiles. Every severity is set.
+var policyProfiles = map[string]Policy{
+	PolicyProfileStrict: {
+		Revocation:        SeverityFail,
+		RequirePinned:     SeverityFail,
+		ExpiredSignatures: SeverityFail,
+		FutureSignatures:  SeverityFail,
+		StaleSignatures:   SeverityFail,
+		LegacyDiscovery:   SeverityFail,
+	},
+	PolicyProfileDefault: {
+		Revocation:        SeverityFail,
+		RequirePinned:     SeverityOff,
+		ExpiredSignatures: SeverityWarn,
+		FutureSignatures:  SeverityWarn,
+		StaleSignatures:   SeverityWarn,
+		LegacyDiscovery:   SeverityWarn,
+	},
+	PolicyProfilePermissive: {
+		Revocation:        SeverityWarn,
+		RequirePinned:     SeverityOff,
+		ExpiredSignatures: SeverityWarn,
+		FutureSignatures:  SeverityOff,
+		StaleSignatures:   SeverityWarn,
+		LegacyDiscovery:   SeverityOff,
+	},
+}
+
+// PolicyProfile returns a copy of the named built-in profile.
+func PolicyProfile(name string) (*Policy, error) {
+	profile, ok := policyProfiles[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown policy profile %q (expected strict, default or permissive)", name)
+	}
+	profile.Profile = name
+	return &profile, nil
+}
+
+// LoadPolicyFile reads and validates a policy. Files ending in .yaml or
+// .yml are parsed as YAML; anything else as JSON.
+func LoadPolicyFile(path string) (*Policy, error) {
+	data, err := os.ReadFile(path) // #nosec G304 -- path supplied by the caller
+	if err != nil {
+		return nil, fmt.Errorf("failed to read policy file: %w", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return ParsePolicyYAML(data)
+	default:
+		return ParsePolicyJSON(data)
+	}
+}
+
+// ParsePolicyJSON parses and validates a JSON policy. Unknown keys are
+// rejected, so a misspelled rule is an error rather than silently off.
+func ParsePolicyJSON(data []byte) (*Policy, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	var policy Policy
+	if err := decoder.Decode(&policy); err != nil {
+		return nil, fmt.Errorf("failed to parse policy: %w", err)
+	}
+	if err := decoder.Decode(&struct{}{}); err != io.EOF {
+		return nil, fmt.Errorf("failed to parse policy: trailing data after the policy object")
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// ParsePolicyYAML parses and validates a YAML policy, rejecting unknown
+// keys like ParsePolicyJSON.
+func ParsePolicyYAML(data []byte) (*Policy, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	var policy Policy
+	if err := decoder.Decode(&policy); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse policy: %w", err)
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// Validate checks the profile, every severity, the allowed domains and
+// the content policy.
+func (p *Policy) Validate() error {
+	if p.Profile != "" {
+		if _, ok := policyProfiles[p.Profile]; !ok {
+			return fmt.Errorf("invalid policy: unknown profile %q", p.Profile)
+		}
+	}
+	for _, rule := range []struct {
+		name     PolicyRule
+		severity Severity
+	}{
+		{RuleRevocation, p.Revocation},
+		{RuleRequirePinned, p.RequirePinned},
+		{RuleExpiredSignatures, p.ExpiredSignatures},
+		{RuleFutureSignatures, p.FutureSignatures},
+		{RuleStaleSignatures, p.StaleSignatures},
+		{RuleLegacyDiscovery, p.LegacyDiscovery},
+	} {
+		switch rule.severity {
+		case "", SeverityOff, SeverityWarn, SeverityFail:
+		default:
+			return fmt.Errorf("invalid policy: %s severity %q (expected off, warn or fail)", rule.name, rule.severity)
+		}
+	}
+	for i, pattern := range p.AllowedDomains {
+		name := strings.TrimPrefix(pattern, "*.")
+		if name == "" || strings.ContainsAny(name, "*/ ") {
+			return fmt.Errorf("invalid policy: allowed_domains[%d] pattern %q", i, pattern)
+		}
+	}
+	if _, err := p.clockSkew(); err != nil {
+		return err
+	}
+	if p.ContentPolicy != nil {
+		if err := p.ContentPolicy.Validate(); err != nil {
+			return fmt.Errorf("invalid policy: %w", err)
+		}
+	}
+	return nil
+}
+
+// Severity returns the severity the policy applies to rule, falling back
+// to its profile. allowed_domains and content_policy always fail; the
+// content policy's own severity decides whether its violations do.
+func (p *Policy) Severity(rule PolicyRule) Severity {
+	profile := policyProfiles[PolicyProfileDefault]
+	if named, ok := policyProfiles[p.Profile]; ok {
+		profile = named
+	}
+	pick := func(own, inherited Severity) Severity {
+		if own != "" {
+			return own
+		}
+		return inherited
+	}
+	switch rule {
+	case RuleRevocation:
+		return pick(p.Revocation, profile.Revocation)
+	case RuleRequirePinned:
+		return pick(p.RequirePinned, profile.RequirePinned)
+	case RuleExpiredSignatures:
+		return pick(p.ExpiredSignatures, profile.ExpiredSignatures)
+	case RuleFutureSignatures:
+		return pick(p.FutureSignatures, profile.FutureSignatures)
+	case RuleStaleSignatures:
+		return pick(p.StaleSignatures, profile.StaleSignatures)
+	case RuleLegacyDiscovery:
+		return pick(p.LegacyDiscovery, profile.LegacyDiscovery)
+	case RuleAllowedDomains, RuleContentPolicy:
+		return SeverityFail
+	}
+	return SeverityOff
+}
+
+// DefaultMaxClockSkew is the future_signatures tolerance of a policy
+// without max_clock_skew.
+const DefaultMaxClockSkew = 5 * time.Minute
+
+func (p *Policy) clockSkew() (time.Duration, error) {
+	if p.MaxClockSkew == "" {
+		return DefaultMaxClockSkew, nil
+	}
+	skew, err := time.ParseDuration(p.MaxClockSkew)
+	if err != nil || skew < 0 {
+		return 0, fmt.Errorf("invalid policy: max_clock_skew %q", p.MaxClockSkew)
+	}
+	return skew, nil
+}
+
+// PolicyFinding is a policy rule triggered during verification.
+type PolicyFinding struct {
+	Rule     PolicyRule `json:"rule"`
+	Severity Severity   `json:"severity"`
+	Message  string     `json:"message"`
+}
+
+// String renders the finding as it appears in VerificationResult.Warnings.
+func (f PolicyFinding) String() string {
+	return fmt.Sprintf("policy %s: %s", f.Rule, f.Message)
+}
+
+// PolicyEvaluation applies a policy during one verification and collects
+// its findings in evaluation order. Verifiers call a Check method where
+// each rule's check happens and stop with Failure when it returns true.
+//
+// An evaluation of a nil policy reproduces verification without a policy:
+// revocation fails, every other rule is off and nothing is recorded.
+type PolicyEvaluation struct {
+	policy   *Policy
+	Findings []PolicyFinding
+}
+
+// NewPolicyEvaluation starts evaluating policy, which may be nil.
+func NewPolicyEvaluation(policy *Policy) *PolicyEvaluation {
+	return &PolicyEvaluation{policy: policy}
+}
+
+// Enabled reports whether a policy is being applied.
+func (e *PolicyEvaluation) Enabled() bool {
+	return e.policy != nil
+}
+
+// Check records that rule was triggered, with message, and reports
+// whether its severity fails verification.
+func (e *PolicyEvaluation) Check(rule PolicyRule, message string) bool {
+	if e.policy == nil {
+		return rule == RuleRevocation
+	}
+	severity := e.policy.Severity(rule)
+	if severity == SeverityOff {
+		return false
+	}
+	e.Findings = append(e.Findings, PolicyFinding{Rule: rule, Severity: severity, Message: message})
+	return severity == SeverityFail
+}
+
+// CheckDomain evaluates allowed_domains for the signing domain.
+func (e *PolicyEvaluation) CheckDomain(domain string) bool {
+	if e.policy == nil || A2AAllows(e.policy.AllowedDomains, domain) {
+		return false
+	}
+	return e.Check(RuleAllowedDomains, fmt.Sprintf("domain %s is not in allowed_domains", domain))
+}
+
+// CheckSignedAt evaluates future_signatures for an RFC 3339 signed_at
+// timestamp. Empty or unparseable timestamps are not checked.
+func (e *PolicyEvaluation) CheckSignedAt(signedAt string, now time.Time) bool {
+	if e.policy == nil || signedAt == "" {
+		return false
+	}
+	ts, err := time.Parse(time.RFC3339, signedAt)
+	if err != nil {
+		return false
+	}
+	skew, _ := e.policy.clockSkew()
+	if !ts.After(now.Add(skew)) {
+		return false
+	}
+	return e.Check(RuleFutureSignatures, fmt.Sprintf("signed_at %s is in the future", signedAt))
+}
+
+// CheckSignatureAge evaluates stale_signatures for an RFC 3339 signed_at
+// timestamp more than maxAge before now. It returns a description of a
+// stale signature, and whether the policy fails it. A zero maxAge, and
+// empty or unparseable timestamps, are not checked.
+//
+// Without a policy a stale signature does not fail and is not recorded as
+// a finding; the caller reports the description as a signature_stale
+// warning instead.
+func (e *PolicyEvaluation) CheckSignatureAge(signedAt string, maxAge time.Duration, now time.Time) (string, bool) {
+	if maxAge <= 0 || signedAt == "" {
+		return "", false
+	}
+	ts, err := time.Parse(time.RFC3339, signedAt)
+	if err != nil || !ts.Before(now.Add(-maxAge)) {
+		return "", false
+	}
+	message := fmt.Sprintf("signed_at %s is more than %s old", signedAt, maxAge)
+	if e.policy == nil {
+		return message, false
+	}
+	return message, e.Check(RuleStaleSignatures, message)
+}
+
+// Failure returns the failed result for the rule a Check just reported as
+// failing. An empty code is ErrPolicyViolation. With a policy, the result
+// names the rule in PolicyRule and carries the findings so far.
+func (e *PolicyEvaluation) Failure(domain string, code ErrorCode, message string) *VerificationResult {
+	result := &VerificationResult{
+		Valid:        false,
+		Domain:       domain,
+		ErrorCode:    code,
+		ErrorMessage: message,
+	}
+	if e.policy == nil || len(e.Findings) == 0 {
+		return result
+	}
+	failed := e.Findings[len(e.Findings)-1]
+	if result.ErrorCode == "" {
+		result.ErrorCode = ErrPolicyViolation
+	}
+	if result.ErrorMessage == "" {
+		result.ErrorMessage = failed.String()
+	}
+	result.PolicyRule = failed.Rule
+	result.PolicyFindings = e.Findings
+	return result
+}
+
+// Apply records the findings on a successful result: every finding in
+// PolicyFindings, and each warn finding in Warnings. The receiver may
+// hold no findings, in which case r is returned unchanged.
+func (e *PolicyEvaluation) Apply(r *VerificationResult) *VerificationResult {
+	if r == nil || len(e.Findings) == 0 {
+		return r
+	}
+	for _, finding := range e.Findings {
+		if finding.Severity == SeverityWarn {
+			r.Warnings = append(r.Warnings, finding.String())
+		}
+	}
+	r.PolicyFindings = append(r.PolicyFindings, e.Findings...)
+	return r
+}
@@ -0,0 +1,216 @@
+package verification
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+)
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		parse   func([]byte) (*Policy, error)
+		data    string
+		wantErr string
+	}{
+		{"json", ParsePolicyJSON, `{"profile": "strict", "revocation": "warn", "allowed_domains": ["*.example.com"]}`, ""},
+		{"yaml", ParsePolicyYAML, "profile: permissive\nrequire_pinned: fail\nmax_clock_skew: 30s\n", ""},
+		{"empty yaml", ParsePolicyYAML, "", ""},
+		{"json unknown key", ParsePolicyJSON, `{"revokation": "fail"}`, "unknown field"},
+		{"yaml unknown key", ParsePolicyYAML, "revokation: fail\n", "not found"},
+		{"json trailing data", ParsePolicyJSON, `{} {}`, "trailing data"},
+		{"unknown profile", ParsePolicyJSON, `{"profile": "paranoid"}`, "unknown profile"},
+		{"bad severity", ParsePolicyYAML, "revocation: error\n", "revocation severity"},
+		{"bad domain", ParsePolicyJSON, `{"allowed_domains": ["*"]}`, "allowed_domains[0]"},
+		{"bad clock skew", ParsePolicyYAML, "max_clock_skew: soon\n", "max_clock_skew"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := tt.parse([]byte(tt.data))
+			if tt.wantErr == "" {
+				if err != nil || policy == nil {
+					t.Fatalf("Expected policy, got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("Expected error containing %q, got %v", tt.wantErr, err)
+			}
+			if policy != nil {
+				t.Error("Expected no policy with an error")
+			}
+		})
+	}
+}
+
+func TestLoadPolicyFile(t *testing.T) {
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "policy.yml")
+	if err := os.WriteFile(yamlPath, []byte("revocation: warn\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	policy, err := LoadPolicyFile(yamlPath)
+	if err != nil || policy.Revocation != SeverityWarn {
+		t.Fatalf("Expected YAML policy, got %+v, %v", policy, err)
+	}
+
+	jsonPath := filepath.Join(dir, "policy.json")
+	if err := os.WriteFile(jsonPath, []byte("revocation: warn\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadPolicyFile(jsonPath); err == nil {
+		t.Error("Expected a .json file to be parsed as JSON")
+	}
+}
+
+func TestPolicySeverity(t *testing.T) {
+	strict, err := PolicyProfile(PolicyProfileStrict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := PolicyProfile("paranoid"); err == nil {
+		t.Error("Expected an unknown profile to be rejected")
+	}
+
+	tests := []struct {
+		name     string
+		policy   *Policy
+		rule     PolicyRule
+		expected Severity
+	}{
+		{"strict profile", strict, RuleRequirePinned, SeverityFail},
+		{"empty policy uses default", &Policy{}, RuleRevocation, SeverityFail},
+		{"default profile", &Policy{}, RuleRequirePinned, SeverityOff},
+		{"permissive profile", &Policy{Profile: PolicyProfilePermissive}, RuleRevocation, SeverityWarn},
+		{"override", &Policy{Profile: PolicyProfileStrict, Revocation: SeverityOff}, RuleRevocation, SeverityOff},
+		{"allowed domains always fail", &Policy{Profile: PolicyProfilePermissive}, RuleAllowedDomains, SeverityFail},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Severity(tt.rule); got != tt.expected {
+				t.Errorf("Severity(%s) = %s, want %s", tt.rule, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestPolicyEvaluationSignedAt(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	eval := NewPolicyEvaluation(&Policy{FutureSignatures: SeverityFail, MaxClockSkew: "1m"})
+	if eval.CheckSignedAt(now.Add(30*time.Second).Format(time.RFC3339), now) {
+		t.Error("Expected a signed_at within max_clock_skew to pass")
+	}
+	if !eval.CheckSignedAt(now.Add(time.Hour).Format(time.RFC3339), now) {
+		t.Error("Expected a signed_at an hour ahead to fail")
+	}
+	if len(eval.Findings) != 1 || eval.Findings[0].Rule != RuleFutureSignatures {
+		t.Errorf("Expected one future_signatures finding, got %+v", eval.Findings)
+	}
+	if NewPolicyEvaluation(nil).CheckSignedAt(now.Add(time.Hour).Format(time.RFC3339), now) {
+		t.Error("Expected no check without a policy")
+	}
+}
+
+func TestPolicyEvaluationSignatureAge(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	old := now.Add(-31 * 24 * time.Hour).Format(time.RFC3339)
+
+	eval := NewPolicyEvaluation(&Policy{StaleSignatures: SeverityFail})
+	if message, failed := eval.CheckSignatureAge(now.Add(-time.Hour).Format(time.RFC3339), 720*time.Hour, now); message != "" || failed {
+		t.Error("Expected a fresh signature to pass")
+	}
+	if message, failed := eval.CheckSignatureAge(old, 0, now); message != "" || failed {
+		t.Error("Expected no check without a maximum age")
+	}
+	if _, failed := eval.CheckSignatureAge(old, 720*time.Hour, now); !failed {
+		t.Error("Expected a 31-day-old signature to fail")
+	}
+	if len(eval.Findings) != 1 || eval.Findings[0].Rule != RuleStaleSignatures {
+		t.Errorf("Expected one stale_signatures finding, got %+v", eval.Findings)
+	}
+
+	// Without a policy a stale signature is described but neither fails
+	// nor is recorded
+	eval = NewPolicyEvaluation(nil)
+	if message, failed := eval.CheckSignatureAge(old, 720*time.Hour, now); message == "" || failed || len(eval.Findings) != 0 {
+		t.Errorf("Expected a description only, got %q (failed=%v, findings %+v)", message, failed, eval.Findings)
+	}
+}
+
+// customPolicy downgrades revocation to a warning and requires keys to be
+// pinned before use.
+var customPolicy = &Policy{Revocation: SeverityWarn, RequirePinned: SeverityFail}
+
+func TestVerifySchemaOfflineWithPolicyRevocationWarns(t *testing.T) {
+	schema := map[string]interface{}{"name": "test_tool", "description": "A test"}
+	pubPEM, sig, fp := makeKeyAndSign(schema)
+	disc := &discovery.WellKnownResponse{SchemaVersion: "1.2", DeveloperName: "Test Dev", PublicKeyPEM: pubPEM, RevokedKeys: []string{fp}}
+
+	store := NewKeyPinStore()
+	store.CheckAndPin("tool1", "example.com", fp)
+	result := VerifySchemaOfflineWithPolicy(schema, sig, "example.com", "tool1", disc, nil, store, "", customPolicy)
+	if !result.Valid {
+		t.Fatalf("Expected a revoked key to only warn, got %s: %s", result.ErrorCode, result.ErrorMessage)
+	}
+	if len(result.PolicyFindings) != 1 || result.PolicyFindings[0].Rule != RuleRevocation || result.PolicyFindings[0].Severity != SeverityWarn {
+		t.Errorf("Expected one revocation warning finding, got %+v", result.PolicyFindings)
+	}
+	if len(result.Warnings) != 1 || !strings.HasPrefix(result.Warnings[0], "policy revocation: ") {
+		t.Errorf("Expected the finding in Warnings, got %v", result.Warnings)
+	}
+
+	// Without the policy the same key fails
+	result = VerifySchemaOffline(schema, sig, "example.com", "tool1", disc, nil, store)
+	if result.Valid || result.ErrorCode != ErrKeyRevoked || result.PolicyRule != "" {
+		t.Errorf("Expected key_revoked without a policy, got %+v", result)
+	}
+}
+
+func TestVerifySchemaOfflineWithPolicyRequirePinned(t *testing.T) {
+	schema := map[string]interface{}{"name": "test_tool", "description": "A test"}
+	pubPEM, sig, fp := makeKeyAndSign(schema)
+	disc := &discovery.WellKnownResponse{SchemaVersion: "1.2", DeveloperName: "Test Dev", PublicKeyPEM: pubPEM}
+
+	store := NewKeyPinStore()
+	result := VerifySchemaOfflineWithPolicy(schema, sig, "example.com", "tool1", disc, nil, store, "", customPolicy)
+	if result.Valid || result.ErrorCode != ErrPolicyViolation || result.PolicyRule != RuleRequirePinned {
+		t.Fatalf("Expected a require_pinned failure, got %+v", result)
+	}
+	if store.GetPinned("tool1", "example.com") != "" {
+		t.Error("Expected the rejected key not to be pinned")
+	}
+
+	store.CheckAndPin("tool1", "example.com", fp)
+	result = VerifySchemaOfflineWithPolicy(schema, sig, "example.com", "tool1", disc, nil, store, "", customPolicy)
+	if !result.Valid || len(result.PolicyFindings) != 0 {
+		t.Errorf("Expected a pinned key to verify without findings, got %+v", result)
+	}
+}
+
+func TestVerifySchemaOfflineWithPolicyOrder(t *testing.T) {
+	schema := map[string]interface{}{"name": "test_tool", "description": "A test"}
+	pubPEM, sig, fp := makeKeyAndSign(schema)
+	disc := &discovery.WellKnownResponse{SchemaVersion: "1.1", DeveloperName: "Test Dev", PublicKeyPEM: pubPEM, RevokedKeys: []string{fp}}
+
+	policy := &Policy{Profile: PolicyProfilePermissive, LegacyDiscovery: SeverityFail, AllowedDomains: []string{"*.example.com"}}
+	result := VerifySchemaOfflineWithPolicy(schema, sig, "evil.test", "tool1", disc, nil, NewKeyPinStore(), "", policy)
+	if result.ErrorCode != ErrDomainBlocked || result.PolicyRule != RuleAllowedDomains {
+		t.Fatalf("Expected allowed_domains to fail first, got %+v", result)
+	}
+
+	result = VerifySchemaOfflineWithPolicy(schema, sig, "tools.example.com", "tool1", disc, nil, NewKeyPinStore(), "", policy)
+	if result.Valid || result.PolicyRule != RuleLegacyDiscovery {
+		t.Fatalf("Expected legacy_discovery to fail, got %+v", result)
+	}
+	var rules []PolicyRule
+	for _, finding := range result.PolicyFindings {
+		rules = append(rules, finding.Rule)
+	}
+	if len(rules) != 2 || rules[0] != RuleRevocation || rules[1] != RuleLegacyDiscovery {
+		t.Errorf("Expected findings in evaluation order, got %v", rules)
+	}
+}
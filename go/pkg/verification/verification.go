@@ -2,9 +2,12 @@
 package verification
 
 import (
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ThirdKeyAi/schemapin/go/pkg/core"
@@ -12,6 +15,7 @@ import (
 	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/resolver"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/revocation"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
 )
 
 // Warning constants for v1.4 signature expiration semantics.
@@ -24,6 +28,19 @@ const (
 	// expires_at field could not be parsed as RFC 3339. The result remains
 	// Valid (fail-open) and is not marked Expired.
 	WarningSignatureExpiresAtUnparseable = "signature_expires_at_unparseable"
+	// WarningLegacySignature is appended when a signature verified only in
+	// the legacy form of Go releases before v1.4, which callers must opt
+	// into. The result remains Valid; the artifact should be re-signed.
+	WarningLegacySignature = "legacy_signature"
+	// WarningPermissionChanged is appended when a skill signed with
+	// executable bits has files whose executable bit differs from the
+	// signed one (see VerificationResult.PermissionChanged). The result
+	// remains Valid unless strict permissions are required.
+	WarningPermissionChanged = "permission_changed"
+	// WarningPermissionsUnchecked is appended when a skill signed with
+	// executable bits is verified on a platform without them (Windows),
+	// so they could not be compared.
+	WarningPermissionsUnchecked = "permissions_unchecked"
 )
 
 // ErrorCode represents structured error codes for verification results.
@@ -51,16 +68,121 @@ const (
 	// ErrBundleExpired (v1.4) — a signed trust bundle's expires_at is in the
 	// past (or unparseable).
 	ErrBundleExpired ErrorCode = "bundle_expired"
+	// ErrUnsupportedVersion — a signed document declared a schemapin_version
+	// newer than (or unknown to) this verifier.
+	ErrUnsupportedVersion ErrorCode = "unsupported_version"
+	// ErrSignatureRevoked — the signature over this particular schema was
+	// revoked in the revocation document, although the key is still valid.
+	ErrSignatureRevoked ErrorCode = "signature_revoked"
+	// ErrSignerKidMismatch — the signature names a signer key (signer_kid)
+	// other than the key discovery supplied, typically after a key rotation.
+	ErrSignerKidMismatch ErrorCode = "signer_kid_mismatch"
+	// ErrDomainBlocked — the signing domain is outside the configured trust
+	// boundary (allow/deny list).
+	ErrDomainBlocked ErrorCode = "domain_blocked"
+	// ErrDiscoveryDowngrade — the domain served a lower .well-known
+	// schema_version than one previously recorded for it.
+	ErrDiscoveryDowngrade ErrorCode = "discovery_downgrade"
+	// ErrDiscoveryRedirectBlocked — the .well-known request was redirected
+	// in violation of the discovery redirect policy.
+	ErrDiscoveryRedirectBlocked ErrorCode = "discovery_redirect_blocked"
+	// ErrDiscoveryTLSPinMismatch — the .well-known host is TLS-pinned and
+	// presented no certificate matching its pins.
+	ErrDiscoveryTLSPinMismatch ErrorCode = "discovery_tls_pin_mismatch"
+	// ErrDiscoveryResponseTooLarge — the .well-known or revocation
+	// response exceeded the discovery client's size limit.
+	ErrDiscoveryResponseTooLarge ErrorCode = "discovery_response_too_large"
+	// ErrDiscoveryRateLimited — the discovery client's per-domain rate
+	// limit refused the request; the domain was not contacted.
+	ErrDiscoveryRateLimited ErrorCode = "discovery_rate_limited"
+	// ErrDiscoveryCircuitOpen — the domain failed repeatedly and its
+	// discovery circuit is open; the domain was not contacted.
+	ErrDiscoveryCircuitOpen ErrorCode = "discovery_circuit_open"
+	// ErrKeyNotPinned — pre-pinned keys are required and no key is pinned
+	// for the tool; discovery was not attempted.
+	ErrKeyNotPinned ErrorCode = "key_not_pinned"
+	// ErrSignatureThresholdNotMet — a multi-signature schema has fewer
+	// valid signatures, or lacks signatures from required signers, than
+	// the verifier requires.
+	ErrSignatureThresholdNotMet ErrorCode = "signature_threshold_not_met"
+	// ErrPermissionChanged — strict permissions are required and a skill
+	// file's executable bit differs from the signed one.
+	ErrPermissionChanged ErrorCode = "permission_changed"
+	// ErrKeyPreviouslyRejected — the key was rejected for the tool before,
+	// by the user or a policy, and has not been reconsidered since.
+	ErrKeyPreviouslyRejected ErrorCode = "key_previously_rejected"
+	// ErrProvenanceInvalid — provenance verification is enabled and the
+	// attached provenance is malformed or not signed by a trusted key.
+	ErrProvenanceInvalid ErrorCode = "provenance_invalid"
+	// ErrProvenanceSubjectMismatch — the attached provenance is signed but
+	// names no subject with the schema hash or skill root hash.
+	ErrProvenanceSubjectMismatch ErrorCode = "provenance_subject_mismatch"
+	// ErrContentChanged — the schema verified but its content differs
+	// from the baseline snapshot recorded for the tool.
+	ErrContentChanged ErrorCode = "content_changed"
+	// ErrBaselineKeyChanged — the schema verified with a different key
+	// than the one recorded in the tool's baseline snapshot.
+	ErrBaselineKeyChanged ErrorCode = "baseline_key_changed"
+	// ErrIndexSignatureInvalid — a tool index's own signature did not
+	// verify, so none of its entries can be trusted.
+	ErrIndexSignatureInvalid ErrorCode = "index_signature_invalid"
+	// ErrEntryHashMismatch — the schema downloaded for a tool index entry
+	// does not have the hash the index declares for it.
+	ErrEntryHashMismatch ErrorCode = "entry_hash_mismatch"
+	// ErrEntrySignatureInvalid — the schema downloaded for a tool index
+	// entry has the declared hash, but the entry's signature did not
+	// verify.
+	ErrEntrySignatureInvalid ErrorCode = "entry_signature_invalid"
+	// ErrSchemaTooComplex — the schema exceeds the size, depth, key count
+	// or string length limits checked before canonicalization.
+	ErrSchemaTooComplex ErrorCode = "schema_too_complex"
+	// ErrSignatureStale — the signature's signed_at is older than the
+	// verifier's maximum signature age and the policy fails
+	// stale_signatures.
+	ErrSignatureStale ErrorCode = "signature_stale"
+	// ErrSignatureSuperseded — the signature's signed_at is before the
+	// minimum_signed_at the domain's .well-known document declares.
+	ErrSignatureSuperseded ErrorCode = "signature_superseded"
 )
 
+// ErrorCodeOf returns the error code for err from its schemaerr.Kind, or
+// an empty code if err carries no kind the verification package reports.
+func ErrorCodeOf(err error) ErrorCode {
+	if kind := schemaerr.KindOf(err); kind != nil {
+		return ErrorCode(kind.Code())
+	}
+	return ""
+}
+
+// DiscoveryErrorCode classifies a failed discovery lookup by ErrorCodeOf:
+// e.g. ErrDiscoveryRedirectBlocked for a blocked redirect,
+// ErrDiscoveryTLSPinMismatch for a TLS pin mismatch, ErrDiscoveryInvalid
+// for a malformed document, ErrDiscoveryResponseTooLarge for an oversized
+// one and ErrDiscoveryRateLimited or ErrDiscoveryCircuitOpen when the
+// request was never made. Errors without a discovery kind are
+// ErrDiscoveryFetchFailed.
+func DiscoveryErrorCode(err error) ErrorCode {
+	switch code := ErrorCodeOf(err); code {
+	case ErrDiscoveryRedirectBlocked, ErrDiscoveryTLSPinMismatch, ErrDiscoveryInvalid, ErrDomainBlocked,
+		ErrDiscoveryRateLimited, ErrDiscoveryCircuitOpen, ErrDiscoveryResponseTooLarge:
+		return code
+	}
+	return ErrDiscoveryFetchFailed
+}
+
 // CanonicalizationV1 is the algorithm identifier (v1.4 alpha.3) for the
 // sorted-key, no-whitespace, UTF-8 canonicalization implemented in
 // core.SchemaPinCore. Signatures MAY carry a "canonicalization" field
 // naming the algorithm used to produce the signing input. Absence is
 // equivalent to this identifier for backward compatibility with v1.3
-// signatures. Verifiers MUST reject any other value as
+// signatures. Verifiers MUST reject any value they do not implement as
 // ErrCanonicalizationUnsupported.
-const CanonicalizationV1 = "schemapin-v1"
+const CanonicalizationV1 = core.CanonicalizationV1
+
+// CanonicalizationJCS is the opt-in RFC 8785 canonicalization (see
+// core.CanonicalizeSchemaJCS). A signature made over the JCS form only
+// verifies when it declares this identifier.
+const CanonicalizationJCS = core.CanonicalizationJCS
 
 // CheckCanonicalization returns the empty string when `algorithm` names a
 // canonicalization algorithm this SDK supports, or the offending value
@@ -69,10 +191,10 @@ const CanonicalizationV1 = "schemapin-v1"
 // An empty string input means the field is absent and is equivalent to the
 // default schemapin-v1 algorithm (v1.3 backward compatibility).
 func CheckCanonicalization(algorithm string) string {
-	if algorithm == "" || algorithm == CanonicalizationV1 {
-		return ""
+	if _, err := core.LookupCanonicalization(algorithm); err != nil {
+		return algorithm
 	}
-	return algorithm
+	return ""
 }
 
 // KeyPinningStatus represents the pinning status in a verification result.
@@ -95,6 +217,11 @@ type VerificationResult struct {
 	ErrorCode     ErrorCode         `json:"error_code,omitempty"`
 	ErrorMessage  string            `json:"error_message,omitempty"`
 	Warnings      []string          `json:"warnings,omitempty"`
+	// TrustDecision is why the key was trusted, with the values of
+	// pinning.TrustDecision. The offline verifiers report
+	// TrustDecisionPrePinned for a key already in the KeyPinStore and
+	// TrustDecisionAutoPinned for one it pinned on first use.
+	TrustDecision string `json:"trust_decision,omitempty"`
 	// Expired is true when the signature carried an expires_at value that
 	// is in the past at verification time. Valid remains true (degraded).
 	Expired bool `json:"expired,omitempty"`
@@ -108,6 +235,43 @@ type VerificationResult struct {
 	// field when present -- sha256:<hex> of the prior signed version's
 	// SkillHash. Pair with skill.VerifyChain to confirm lineage.
 	PreviousHash string `json:"previous_hash,omitempty"`
+	// DiscoverySource records which resolver source supplied the discovery
+	// document ("bundle", "live", "cache", "local") when verification went
+	// through a resolver. Empty for offline verification.
+	DiscoverySource string `json:"discovery_source,omitempty"`
+	// DiscoveryURL is the URL the discovery document was finally fetched
+	// from, after redirects, when it was fetched over HTTP.
+	DiscoveryURL string `json:"discovery_url,omitempty"`
+	// SignerKid is the kid recorded in the signature, i.e. the key the
+	// signer claims to have used. Empty for legacy signatures without one.
+	SignerKid string `json:"signer_kid,omitempty"`
+	// KeyFingerprint is the fingerprint of the key verification used.
+	KeyFingerprint string `json:"key_fingerprint,omitempty"`
+	// MutableSkipped lists the skill files whose content was not compared
+	// because they match a mutable path declared in the signature.
+	MutableSkipped []string `json:"mutable_skipped,omitempty"`
+	// PermissionChanged lists the skill files whose executable bit differs
+	// from the one recorded in the signature.
+	PermissionChanged []string `json:"permission_changed,omitempty"`
+	// PolicyRule names the Policy rule that failed verification, if one
+	// did.
+	PolicyRule PolicyRule `json:"policy_rule,omitempty"`
+	// PolicyFindings lists the Policy rules triggered during verification,
+	// in evaluation order, with the severity applied.
+	PolicyFindings []PolicyFinding `json:"policy_findings,omitempty"`
+	// SchemaHash is sha256:<hex> of the canonical schema that was
+	// verified, set once verification has hashed the schema, including
+	// when the signature then failed. Registries can key caches by it.
+	SchemaHash string `json:"schema_hash,omitempty"`
+	// SkillHash is sha256:<hex> of the skill root hash recomputed from the
+	// files, and SignedSkillHash the skill_hash recorded in the signature,
+	// set once a skill has been canonicalized. They differ when the skill
+	// was modified after signing.
+	SkillHash       string `json:"skill_hash,omitempty"`
+	SignedSkillHash string `json:"signed_skill_hash,omitempty"`
+	// Metadata holds informational fields about the verified artifact,
+	// such as the provenance.Metadata* fields of verified provenance.
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
 }
 
 // WithExpirationCheck applies a v1.4 signature expiration check to a
@@ -169,9 +333,29 @@ const (
 	PinChanged  PinResult = "changed"
 )
 
+// The trust decisions a KeyPinStore makes (see
+// VerificationResult.TrustDecision).
+const (
+	TrustDecisionPrePinned  = "pre_pinned"
+	TrustDecisionAutoPinned = "auto_pinned"
+)
+
+// TrustDecision returns the trust decision of a key with pin result r: a
+// KeyPinStore pins every key it sees for the first time.
+func (r PinResult) TrustDecision() string {
+	switch r {
+	case PinFirstUse:
+		return TrustDecisionAutoPinned
+	case PinPinned:
+		return TrustDecisionPrePinned
+	}
+	return ""
+}
+
 // KeyPinStore is a lightweight in-memory fingerprint-based pin store.
-// Keys are stored by tool_id@domain.
+// Keys are stored by tool_id@domain. It is safe for concurrent use.
 type KeyPinStore struct {
+	mu   sync.Mutex
 	pins map[string]string
 }
 
@@ -186,13 +370,16 @@ func pinKey(toolID, domain string) string {
 
 // CheckAndPin checks and optionally pins a key fingerprint.
 func (s *KeyPinStore) CheckAndPin(toolID, domain, fingerprint string) PinResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
 	k := pinKey(toolID, domain)
 	existing, ok := s.pins[k]
 	if !ok {
 		s.pins[k] = fingerprint
 		return PinFirstUse
 	}
-	if existing == fingerprint {
+	if crypto.FingerprintEqual(existing, fingerprint) {
 		return PinPinned
 	}
 	return PinChanged
@@ -200,11 +387,15 @@ func (s *KeyPinStore) CheckAndPin(toolID, domain, fingerprint string) PinResult
 
 // GetPinned returns the pinned fingerprint for a tool@domain, or empty string.
 func (s *KeyPinStore) GetPinned(toolID, domain string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	return s.pins[pinKey(toolID, domain)]
 }
 
 // ToJSON serializes the pin store to JSON.
 func (s *KeyPinStore) ToJSON() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 	data, err := json.Marshal(s.pins)
 	if err != nil {
 		return "", err
@@ -253,9 +444,11 @@ func VerifySchemaOffline(
 // optional v1.4 alpha.3 canonicalization algorithm parameter.
 //
 // `canonicalization` mirrors the optional "canonicalization" field on
-// .schemapin.sig documents. Empty string or "schemapin-v1" are equivalent
-// and accepted; any other value fails with ErrCanonicalizationUnsupported
-// before any crypto work.
+// .schemapin.sig documents. The schema is hashed with the matching
+// algorithm from the core registry; empty string selects "schemapin-v1",
+// and unknown values fail with ErrCanonicalizationUnsupported before any
+// crypto work. Schemas beyond core.DefaultValidationLimits fail with
+// ErrSchemaTooComplex.
 func VerifySchemaOfflineWithCanonicalization(
 	schema map[string]interface{},
 	signatureB64 string,
@@ -265,15 +458,98 @@ func VerifySchemaOfflineWithCanonicalization(
 	rev *revocation.RevocationDocument,
 	pinStore *KeyPinStore,
 	canonicalization string,
+) *VerificationResult {
+	return VerifySchemaOfflineWithPolicy(schema, signatureB64, domain, toolID, disc, rev, pinStore, canonicalization, nil)
+}
+
+// VerifySchemaOfflineWithPolicy is VerifySchemaOfflineWithCanonicalization
+// with the checks configured by policy: allowed_domains before discovery
+// is used, revocation for revoked keys and signatures, require_pinned
+// before the key is pinned, and legacy_discovery for the discovery
+// document's schema_version. A nil policy verifies as
+// VerifySchemaOfflineWithCanonicalization does.
+func VerifySchemaOfflineWithPolicy(
+	schema map[string]interface{},
+	signatureB64 string,
+	domain string,
+	toolID string,
+	disc *discovery.WellKnownResponse,
+	rev *revocation.RevocationDocument,
+	pinStore *KeyPinStore,
+	canonicalization string,
+	policy *Policy,
 ) *VerificationResult {
 	// Step 0 (v1.4 alpha.3): canonicalization algorithm check.
-	if bad := CheckCanonicalization(canonicalization); bad != "" {
+	alg, err := core.LookupCanonicalization(canonicalization)
+	if err != nil {
 		return &VerificationResult{
 			Valid:        false,
 			Domain:       domain,
 			ErrorCode:    ErrCanonicalizationUnsupported,
-			ErrorMessage: fmt.Sprintf("Unsupported canonicalization algorithm: %s", bad),
+			ErrorMessage: fmt.Sprintf("Unsupported canonicalization algorithm: %s", canonicalization),
+		}
+	}
+
+	hashSchema := func() ([]byte, error) {
+		if err := core.DefaultValidationLimits().Check(schema); err != nil {
+			return nil, err
+		}
+		return alg.HashSchema(schema)
+	}
+	return verifyOffline(hashSchema, signatureB64, domain, toolID, disc, rev, pinStore, policy)
+}
+
+// VerifyHashOffline verifies a signature over a schema hash computed
+// elsewhere, e.g. by a registry that stores canonical hashes, without the
+// schema itself. It runs the same discovery, revocation, pinning and
+// signature checks as VerifySchemaOffline and returns the same result for
+// the same hash. schemaHash must be the 32-byte SHA-256 digest of the
+// canonical schema.
+func VerifyHashOffline(
+	schemaHash []byte,
+	signatureB64 string,
+	domain string,
+	toolID string,
+	disc *discovery.WellKnownResponse,
+	rev *revocation.RevocationDocument,
+	pinStore *KeyPinStore,
+) *VerificationResult {
+	if len(schemaHash) != sha256.Size {
+		return &VerificationResult{
+			Valid:        false,
+			Domain:       domain,
+			ErrorCode:    ErrSchemaCanonicalizationFailed,
+			ErrorMessage: fmt.Sprintf("Schema hash must be %d bytes, got %d", sha256.Size, len(schemaHash)),
+		}
+	}
+	hashSchema := func() ([]byte, error) { return schemaHash, nil }
+	return verifyOffline(hashSchema, signatureB64, domain, toolID, disc, rev, pinStore, nil)
+}
+
+// verifyOffline runs steps 1 to 7 of VerifySchemaOffline, taking the
+// schema hash from hashSchema at step 5.
+func verifyOffline(
+	hashSchema func() ([]byte, error),
+	signatureB64 string,
+	domain string,
+	toolID string,
+	disc *discovery.WellKnownResponse,
+	rev *revocation.RevocationDocument,
+	pinStore *KeyPinStore,
+	policy *Policy,
+) (result *VerificationResult) {
+	eval := NewPolicyEvaluation(policy)
+
+	// Every result from step 5 on reports the hash that was verified
+	var schemaHash []byte
+	defer func() {
+		if schemaHash != nil {
+			result.SchemaHash = core.FormatSchemaHash(schemaHash)
 		}
+	}()
+
+	if eval.CheckDomain(domain) {
+		return eval.Failure(domain, ErrDomainBlocked, "")
 	}
 
 	// Step 1: Validate discovery document
@@ -310,15 +586,18 @@ func VerifySchemaOfflineWithCanonicalization(
 
 	// Step 3: Check revocation
 	if err := revocation.CheckRevocationCombined(disc.RevokedKeys, rev, fingerprint); err != nil {
-		return &VerificationResult{
-			Valid:        false,
-			Domain:       domain,
-			ErrorCode:    ErrKeyRevoked,
-			ErrorMessage: err.Error(),
+		if eval.Check(RuleRevocation, err.Error()) {
+			return eval.Failure(domain, ErrKeyRevoked, err.Error())
 		}
 	}
 
-	// Step 4: TOFU key pinning
+	// Step 4: TOFU key pinning. A policy requiring pinned keys is checked
+	// first, so a rejected key is not pinned.
+	if eval.Enabled() && pinStore.GetPinned(toolID, domain) == "" {
+		if eval.Check(RuleRequirePinned, fmt.Sprintf("no key is pinned for %s@%s", toolID, domain)) {
+			return eval.Failure(domain, "", "")
+		}
+	}
 	pinResult := pinStore.CheckAndPin(toolID, domain, fingerprint)
 	if pinResult == PinChanged {
 		return &VerificationResult{
@@ -330,16 +609,27 @@ func VerifySchemaOfflineWithCanonicalization(
 	}
 
 	// Step 5: Canonicalize and hash
-	c := core.NewSchemaPinCore()
-	schemaHash, err := c.CanonicalizeAndHash(schema)
+	hash, err := hashSchema()
 	if err != nil {
+		code := ErrSchemaCanonicalizationFailed
+		if errors.Is(err, schemaerr.ErrSchemaTooComplex) {
+			code = ErrSchemaTooComplex
+		}
 		return &VerificationResult{
 			Valid:        false,
 			Domain:       domain,
-			ErrorCode:    ErrSchemaCanonicalizationFailed,
+			ErrorCode:    code,
 			ErrorMessage: fmt.Sprintf("Failed to canonicalize schema: %v", err),
 		}
 	}
+	schemaHash = hash
+
+	// Step 5a: Check signature-level revocation of this schema
+	if err := revocation.CheckSignatureRevocation(rev, core.FormatSchemaHash(schemaHash)); err != nil {
+		if eval.Check(RuleRevocation, err.Error()) {
+			return eval.Failure(domain, ErrSignatureRevoked, err.Error())
+		}
+	}
 
 	// Step 6: Verify signature
 	sigManager := crypto.NewSignatureManager()
@@ -355,22 +645,27 @@ func VerifySchemaOfflineWithCanonicalization(
 	}
 
 	// Step 7: Return success
-	result := &VerificationResult{
+	result = &VerificationResult{
 		Valid:         true,
 		Domain:        domain,
 		DeveloperName: disc.DeveloperName,
 		KeyPinning: &KeyPinningStatus{
 			Status: string(pinResult),
 		},
-		Warnings: []string{},
+		TrustDecision: pinResult.TrustDecision(),
+		Warnings:      []string{},
 	}
 
 	if disc.SchemaVersion != "" && disc.SchemaVersion < "1.2" {
-		result.Warnings = append(result.Warnings,
-			fmt.Sprintf("Discovery uses schema version %s, consider upgrading to 1.2", disc.SchemaVersion))
+		message := fmt.Sprintf("Discovery uses schema version %s, consider upgrading to 1.2", disc.SchemaVersion)
+		if !eval.Enabled() {
+			result.Warnings = append(result.Warnings, message)
+		} else if eval.Check(RuleLegacyDiscovery, message) {
+			return eval.Failure(domain, "", "")
+		}
 	}
 
-	return result
+	return eval.Apply(result)
 }
 
 // VerifySchemaWithResolver verifies a schema using a resolver for discovery and revocation.
@@ -382,19 +677,22 @@ func VerifySchemaWithResolver(
 	r resolver.SchemaResolver,
 	pinStore *KeyPinStore,
 ) *VerificationResult {
-	disc, err := r.ResolveDiscovery(domain)
+	disc, source, err := resolver.ResolveDiscoveryWithSource(r, domain)
 	if err != nil {
 		return &VerificationResult{
 			Valid:        false,
 			Domain:       domain,
-			ErrorCode:    ErrDiscoveryFetchFailed,
-			ErrorMessage: fmt.Sprintf("Could not resolve discovery for domain: %s", domain),
+			ErrorCode:    DiscoveryErrorCode(err),
+			ErrorMessage: fmt.Sprintf("Could not resolve discovery for domain: %s: %v", domain, err),
 		}
 	}
 
 	rev, _ := r.ResolveRevocation(domain, disc)
 
-	return VerifySchemaOffline(schema, signatureB64, domain, toolID, disc, rev, pinStore)
+	result := VerifySchemaOffline(schema, signatureB64, domain, toolID, disc, rev, pinStore)
+	result.DiscoverySource = source
+	result.DiscoveryURL = disc.SourceURL
+	return result
 }
 
 // VerifySchemaForA2A verifies a schema in the context of an A2A interaction
@@ -1,6 +1,13 @@
 package verification
 
 import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
 	"testing"
 
 	"github.com/ThirdKeyAi/schemapin/go/pkg/bundle"
@@ -9,14 +16,20 @@ import (
 	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/resolver"
 	"github.com/ThirdKeyAi/schemapin/go/pkg/revocation"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/schemaerr"
 )
 
+// keysIssued numbers the seeded keys made by makeKeyAndSign, so each call
+// gets a distinct key while fingerprints stay the same from run to run.
+var keysIssued int32
+
 func makeKeyAndSign(schema map[string]interface{}) (string, string, string) {
 	km := gocrypto.NewKeyManager()
 	sm := gocrypto.NewSignatureManager()
 	c := core.NewSchemaPinCore()
 
-	privKey, err := km.GenerateKeypair()
+	seed := fmt.Sprintf("verification-test/%d", atomic.AddInt32(&keysIssued, 1))
+	privKey, err := km.GenerateKeypairFromSeed([]byte(seed), gocrypto.ForTesting)
 	if err != nil {
 		panic(err)
 	}
@@ -146,6 +159,9 @@ func TestVerifySchemaOfflineHappyPath(t *testing.T) {
 	if result.KeyPinning == nil || result.KeyPinning.Status != "first_use" {
 		t.Error("expected key_pinning.status = first_use")
 	}
+	if result.TrustDecision != TrustDecisionAutoPinned {
+		t.Errorf("expected trust_decision auto_pinned, got %q", result.TrustDecision)
+	}
 }
 
 func TestVerifySchemaOfflinePinnedOnSecondCall(t *testing.T) {
@@ -167,6 +183,9 @@ func TestVerifySchemaOfflinePinnedOnSecondCall(t *testing.T) {
 	if result.KeyPinning.Status != "pinned" {
 		t.Error("expected pinned status")
 	}
+	if result.TrustDecision != TrustDecisionPrePinned {
+		t.Errorf("expected trust_decision pre_pinned, got %q", result.TrustDecision)
+	}
 }
 
 func TestVerifySchemaOfflineInvalidSignature(t *testing.T) {
@@ -189,6 +208,36 @@ func TestVerifySchemaOfflineInvalidSignature(t *testing.T) {
 	}
 }
 
+func TestVerifySchemaOfflineSchemaHash(t *testing.T) {
+	schema := map[string]interface{}{"name": "test_tool", "description": "A test"}
+	pubPEM, sig, _ := makeKeyAndSign(schema)
+	tampered := map[string]interface{}{"name": "test_tool", "description": "TAMPERED"}
+	disc := &discovery.WellKnownResponse{SchemaVersion: "1.2", PublicKeyPEM: pubPEM}
+
+	for _, tt := range []struct {
+		name   string
+		schema map[string]interface{}
+		valid  bool
+	}{
+		{"valid", schema, true},
+		{"signature invalid", tampered, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			hash, err := core.NewSchemaPinCore().CanonicalizeAndHash(tt.schema)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result := VerifySchemaOffline(tt.schema, sig, "example.com", "tool1", disc, nil, NewKeyPinStore())
+			if result.Valid != tt.valid {
+				t.Fatalf("expected valid=%v, got %+v", tt.valid, result)
+			}
+			if want := core.FormatSchemaHash(hash); result.SchemaHash != want {
+				t.Errorf("expected schema hash %s, got %s", want, result.SchemaHash)
+			}
+		})
+	}
+}
+
 func TestVerifySchemaOfflineTamperedSchema(t *testing.T) {
 	schema := map[string]interface{}{"name": "test_tool", "description": "A test"}
 	pubPEM, sig, _ := makeKeyAndSign(schema)
@@ -210,6 +259,28 @@ func TestVerifySchemaOfflineTamperedSchema(t *testing.T) {
 	}
 }
 
+func TestVerifySchemaOfflineTooComplex(t *testing.T) {
+	pubPEM, sig, _ := makeKeyAndSign(map[string]interface{}{"name": "test_tool"})
+
+	bomb := map[string]interface{}{"type": "string"}
+	for i := 0; i < core.DefaultMaxSchemaDepth; i++ {
+		bomb = map[string]interface{}{"items": bomb}
+	}
+	disc := &discovery.WellKnownResponse{
+		SchemaVersion: "1.2",
+		DeveloperName: "Test Dev",
+		PublicKeyPEM:  pubPEM,
+	}
+	result := VerifySchemaOffline(bomb, sig, "example.com", "tool1", disc, nil, NewKeyPinStore())
+
+	if result.Valid {
+		t.Error("expected invalid")
+	}
+	if result.ErrorCode != ErrSchemaTooComplex {
+		t.Errorf("expected schema_too_complex, got %s", result.ErrorCode)
+	}
+}
+
 func TestVerifySchemaOfflineRevokedKeySimpleList(t *testing.T) {
 	schema := map[string]interface{}{"name": "test_tool", "description": "A test"}
 	pubPEM, sig, fp := makeKeyAndSign(schema)
@@ -254,6 +325,65 @@ func TestVerifySchemaOfflineRevokedKeyStandaloneDoc(t *testing.T) {
 	}
 }
 
+func signWithKey(t *testing.T, privKey *ecdsa.PrivateKey, schema map[string]interface{}) (string, string) {
+	t.Helper()
+	hash, err := core.NewSchemaPinCore().CanonicalizeAndHash(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := gocrypto.NewSignatureManager().SignSchemaHash(hash, privKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sig, core.FormatSchemaHash(hash)
+}
+
+func TestVerifySchemaOfflineRevokedSignature(t *testing.T) {
+	km := gocrypto.NewKeyManager()
+	privKey, err := km.GenerateKeypair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubPEM, err := km.ExportPublicKeyPEM(&privKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp, err := km.CalculateKeyFingerprintFromPEM(pubPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bad := map[string]interface{}{"name": "bad_tool", "description": "Leaks a default"}
+	sibling := map[string]interface{}{"name": "good_tool", "description": "Fine"}
+	badSig, badHash := signWithKey(t, privKey, bad)
+	siblingSig, _ := signWithKey(t, privKey, sibling)
+
+	disc := &discovery.WellKnownResponse{SchemaVersion: "1.2", PublicKeyPEM: pubPEM}
+	rev := revocation.BuildRevocationDocument("example.com")
+	revocation.AddRevokedSignature(rev, badHash, revocation.ReasonSuperseded)
+
+	result := VerifySchemaOffline(bad, badSig, "example.com", "bad_tool", disc, rev, NewKeyPinStore())
+	if result.Valid || result.ErrorCode != ErrSignatureRevoked {
+		t.Errorf("expected signature_revoked, got valid=%v code=%s", result.Valid, result.ErrorCode)
+	}
+
+	result = VerifySchemaOffline(sibling, siblingSig, "example.com", "good_tool", disc, rev, NewKeyPinStore())
+	if !result.Valid {
+		t.Errorf("expected sibling schema under the same key to verify, got %s: %s", result.ErrorCode, result.ErrorMessage)
+	}
+
+	// Key-level revocation takes precedence over signature-level revocation.
+	revocation.AddRevokedKey(rev, fp, revocation.ReasonKeyCompromise)
+	result = VerifySchemaOffline(bad, badSig, "example.com", "bad_tool", disc, rev, NewKeyPinStore())
+	if result.ErrorCode != ErrKeyRevoked {
+		t.Errorf("expected key_revoked, got %s", result.ErrorCode)
+	}
+	result = VerifySchemaOffline(sibling, siblingSig, "example.com", "good_tool", disc, rev, NewKeyPinStore())
+	if result.ErrorCode != ErrKeyRevoked {
+		t.Errorf("expected key_revoked for sibling, got %s", result.ErrorCode)
+	}
+}
+
 func TestVerifySchemaOfflineKeyPinChangeRejected(t *testing.T) {
 	schema := map[string]interface{}{"name": "test_tool", "description": "A test"}
 	pubPEM1, sig1, _ := makeKeyAndSign(schema)
@@ -361,3 +491,159 @@ func TestVerifySchemaWithResolverMissingDomain(t *testing.T) {
 		t.Errorf("expected discovery_fetch_failed, got %s", result.ErrorCode)
 	}
 }
+
+func TestVerifySchemaWithResolverChainSources(t *testing.T) {
+	schema := map[string]interface{}{"name": "test_tool", "description": "A test"}
+	pubPEM, sig, _ := makeKeyAndSign(schema)
+	wellKnown := discovery.WellKnownResponse{
+		SchemaVersion: "1.2",
+		DeveloperName: "Live Dev",
+		PublicKeyPEM:  pubPEM,
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/.well-known/schemapin.json" {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(wellKnown)
+	}))
+	defer server.Close()
+
+	b := bundle.NewTrustBundle("2026-01-01T00:00:00Z")
+	b.Documents = append(b.Documents, bundle.BundledDiscovery{
+		Domain:    "bundled.example.com",
+		WellKnown: discovery.WellKnownResponse{SchemaVersion: "1.2", DeveloperName: "Bundle Dev", PublicKeyPEM: pubPEM},
+	})
+	chain := resolver.Chain(resolver.NewTrustBundleResolver(b), resolver.NewWellKnownResolver())
+
+	// Bundle hit
+	result := VerifySchemaWithResolver(schema, sig, "bundled.example.com", "tool1", chain, NewKeyPinStore())
+	if !result.Valid {
+		t.Fatalf("expected valid, got error: %s", result.ErrorMessage)
+	}
+	if result.DiscoverySource != resolver.SourceBundle {
+		t.Errorf("expected source bundle, got %q", result.DiscoverySource)
+	}
+
+	// Bundle miss, live hit
+	result = VerifySchemaWithResolver(schema, sig, server.URL, "tool1", chain, NewKeyPinStore())
+	if !result.Valid {
+		t.Fatalf("expected valid, got error: %s", result.ErrorMessage)
+	}
+	if result.DiscoverySource != resolver.SourceLive {
+		t.Errorf("expected source live, got %q", result.DiscoverySource)
+	}
+	if result.DeveloperName != "Live Dev" {
+		t.Errorf("expected Live Dev, got %s", result.DeveloperName)
+	}
+	if result.DiscoveryURL != server.URL+"/.well-known/schemapin.json" {
+		t.Errorf("expected discovery URL from %s, got %q", server.URL, result.DiscoveryURL)
+	}
+}
+
+func TestVerifySchemaWithResolverRedirectBlocked(t *testing.T) {
+	schema := map[string]interface{}{"name": "test_tool", "description": "A test"}
+	_, sig, _ := makeKeyAndSign(schema)
+
+	// Redirect to the same server under another registrable domain
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, strings.Replace(server.URL, "127.0.0.1", "localhost", 1)+r.URL.Path, http.StatusFound)
+	}))
+	defer server.Close()
+
+	result := VerifySchemaWithResolver(schema, sig, server.URL, "tool1", resolver.NewWellKnownResolver(), NewKeyPinStore())
+	if result.Valid || result.ErrorCode != ErrDiscoveryRedirectBlocked {
+		t.Errorf("expected discovery_redirect_blocked, got %s: %s", result.ErrorCode, result.ErrorMessage)
+	}
+}
+
+func TestVerifySchemaWithResolverChainBothMiss(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	chain := resolver.Chain(
+		resolver.NewTrustBundleResolver(bundle.NewTrustBundle("2026-01-01T00:00:00Z")),
+		resolver.NewWellKnownResolver(),
+	)
+
+	result := VerifySchemaWithResolver(
+		map[string]interface{}{"name": "test"},
+		"sig", server.URL, "tool1", chain, NewKeyPinStore(),
+	)
+	if result.Valid {
+		t.Fatal("expected invalid")
+	}
+	if result.ErrorCode != ErrDiscoveryFetchFailed {
+		t.Errorf("expected discovery_fetch_failed, got %s", result.ErrorCode)
+	}
+	if result.DiscoverySource != "" {
+		t.Errorf("expected no discovery source on failure, got %q", result.DiscoverySource)
+	}
+}
+
+func TestErrorCodeOf(t *testing.T) {
+	tests := []struct {
+		err      error
+		expected ErrorCode
+	}{
+		{schemaerr.ErrSignatureInvalid, ErrSignatureInvalid},
+		{schemaerr.ErrSignatureRevoked, ErrSignatureRevoked},
+		{schemaerr.ErrKeyNotFound, ErrKeyNotFound},
+		{schemaerr.ErrKeyRevoked, ErrKeyRevoked},
+		{schemaerr.ErrKeyPinMismatch, ErrKeyPinMismatch},
+		{schemaerr.ErrSchemaInvalid, ErrSchemaCanonicalizationFailed},
+		{schemaerr.ErrDiscoveryNotFound, ErrDiscoveryFetchFailed},
+		{schemaerr.ErrDiscoveryFailed, ErrDiscoveryFetchFailed},
+		{schemaerr.ErrDiscoveryInvalid, ErrDiscoveryInvalid},
+		{schemaerr.ErrDiscoveryRedirectBlocked, ErrDiscoveryRedirectBlocked},
+		{schemaerr.ErrDiscoveryTLSPinMismatch, ErrDiscoveryTLSPinMismatch},
+		{schemaerr.ErrDiscoveryResponseTooLarge, ErrDiscoveryResponseTooLarge},
+		{schemaerr.ErrDiscoveryDowngrade, ErrDiscoveryDowngrade},
+		{schemaerr.ErrDomainBlocked, ErrDomainBlocked},
+		{schemaerr.ErrKeyNotPinned, ErrKeyNotPinned},
+		{schemaerr.ErrSignatureThresholdNotMet, ErrSignatureThresholdNotMet},
+		{schemaerr.ErrPermissionChanged, ErrPermissionChanged},
+		{schemaerr.ErrKeyPreviouslyRejected, ErrKeyPreviouslyRejected},
+		{schemaerr.ErrProvenanceInvalid, ErrProvenanceInvalid},
+		{schemaerr.ErrProvenanceSubjectMismatch, ErrProvenanceSubjectMismatch},
+		{fmt.Errorf("wrapped: %w", &schemaerr.Error{Kind: schemaerr.ErrKeyRevoked}), ErrKeyRevoked},
+		{schemaerr.ErrPinStoreCorrupt, ""},
+		{fmt.Errorf("unclassified"), ""},
+	}
+	for _, tt := range tests {
+		if got := ErrorCodeOf(tt.err); got != tt.expected {
+			t.Errorf("ErrorCodeOf(%v): expected %q, got %q", tt.err, tt.expected, got)
+		}
+	}
+
+	if got := DiscoveryErrorCode(fmt.Errorf("unclassified")); got != ErrDiscoveryFetchFailed {
+		t.Errorf("Expected unclassified discovery errors to be %s, got %s", ErrDiscoveryFetchFailed, got)
+	}
+}
+
+func TestVerifyHashOfflineMatchesSchema(t *testing.T) {
+	schema := map[string]interface{}{"name": "test_tool", "description": "A test"}
+	pubPEM, sig, _ := makeKeyAndSign(schema)
+	disc := &discovery.WellKnownResponse{SchemaVersion: "1.1", DeveloperName: "Test Dev", PublicKeyPEM: pubPEM}
+	hash, err := core.NewSchemaPinCore().CanonicalizeAndHash(schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, signature := range []string{sig, "bm90IGEgc2lnbmF0dXJl"} {
+		fromSchema := VerifySchemaOffline(schema, signature, "example.com", "tool1", disc, nil, NewKeyPinStore())
+		fromHash := VerifyHashOffline(hash, signature, "example.com", "tool1", disc, nil, NewKeyPinStore())
+		want, _ := json.Marshal(fromSchema)
+		got, _ := json.Marshal(fromHash)
+		if string(got) != string(want) {
+			t.Errorf("Expected the hash path to match the schema path:\n got %s\nwant %s", got, want)
+		}
+	}
+
+	result := VerifyHashOffline(hash[:16], sig, "example.com", "tool1", disc, nil, NewKeyPinStore())
+	if result.Valid || result.ErrorCode != ErrSchemaCanonicalizationFailed {
+		t.Errorf("Expected a short hash to be rejected, got %+v", result)
+	}
+}
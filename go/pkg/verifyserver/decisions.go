@@ -0,0 +1,70 @@
+package verifyserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/interactive"
+)
+
+// DecisionRequest is the body of POST /v1/decisions/{id}.
+type DecisionRequest struct {
+	Decision interactive.UserDecision `json:"decision"`
+}
+
+// pendingStore returns the workflow's decision queue, answering the
+// request with 404 when it has none.
+func (s *Server) pendingStore(w http.ResponseWriter) *interactive.PendingDecisionStore {
+	store := s.workflow.PendingDecisions()
+	if store == nil {
+		writeError(w, http.StatusNotFound, ErrNotFound, "decisions are not queued by this server")
+	}
+	return store
+}
+
+func (s *Server) handleListDecisions(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	store := s.pendingStore(w)
+	if store == nil {
+		return
+	}
+	pending, err := store.ListPending()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrInternal, fmt.Sprintf("failed to list pending decisions: %v", err))
+		return
+	}
+	if pending == nil {
+		pending = []interactive.PendingDecision{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"pending": pending})
+}
+
+func (s *Server) handleResolveDecision(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	store := s.pendingStore(w)
+	if store == nil {
+		return
+	}
+	var req DecisionRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/v1/decisions/")
+	err := store.Resolve(id, req.Decision)
+	switch {
+	case err == nil:
+		w.WriteHeader(http.StatusNoContent)
+	case errors.Is(err, interactive.ErrPendingNotFound):
+		writeError(w, http.StatusNotFound, ErrNotFound, fmt.Sprintf("no pending decision %s", id))
+	case errors.Is(err, interactive.ErrPendingResolved):
+		writeError(w, http.StatusConflict, ErrDecisionResolved, err.Error())
+	default:
+		writeError(w, http.StatusBadRequest, ErrInvalidDecision, err.Error())
+	}
+}
@@ -0,0 +1,125 @@
+package verifyserver
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+)
+
+// metrics counts requests and verifications for /metrics.
+type metrics struct {
+	mu            sync.Mutex
+	requests      map[requestLabels]int64
+	durations     map[string]float64
+	verifications map[verificationLabels]int64
+}
+
+type requestLabels struct {
+	endpoint string
+	status   int
+}
+
+type verificationLabels struct {
+	kind      string
+	result    string
+	errorCode string
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		requests:      make(map[requestLabels]int64),
+		durations:     make(map[string]float64),
+		verifications: make(map[verificationLabels]int64),
+	}
+}
+
+func (m *metrics) observeRequest(endpoint string, status int, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests[requestLabels{endpoint, status}]++
+	m.durations[endpoint] += duration.Seconds()
+}
+
+func (m *metrics) observeVerification(kind string, valid bool, errorCode string) {
+	result := "valid"
+	if !valid {
+		result = "invalid"
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.verifications[verificationLabels{kind, result, errorCode}]++
+}
+
+// write writes the counters and the discovery protection stats in the
+// Prometheus text exposition format, in a stable order.
+func (m *metrics) write(w io.Writer, stats discovery.ProtectionStats) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	fmt.Fprintln(w, "# HELP schemapin_server_requests_total Requests served, by endpoint and status code.")
+	fmt.Fprintln(w, "# TYPE schemapin_server_requests_total counter")
+	requests := make([]requestLabels, 0, len(m.requests))
+	for labels := range m.requests {
+		requests = append(requests, labels)
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		if requests[i].endpoint != requests[j].endpoint {
+			return requests[i].endpoint < requests[j].endpoint
+		}
+		return requests[i].status < requests[j].status
+	})
+	for _, labels := range requests {
+		fmt.Fprintf(w, "schemapin_server_requests_total{endpoint=%q,status=%q} %d\n",
+			labels.endpoint, strconv.Itoa(labels.status), m.requests[labels])
+	}
+
+	fmt.Fprintln(w, "# HELP schemapin_server_request_duration_seconds_total Time spent serving requests, by endpoint.")
+	fmt.Fprintln(w, "# TYPE schemapin_server_request_duration_seconds_total counter")
+	endpoints := make([]string, 0, len(m.durations))
+	for endpoint := range m.durations {
+		endpoints = append(endpoints, endpoint)
+	}
+	sort.Strings(endpoints)
+	for _, endpoint := range endpoints {
+		fmt.Fprintf(w, "schemapin_server_request_duration_seconds_total{endpoint=%q} %g\n", endpoint, m.durations[endpoint])
+	}
+
+	fmt.Fprintln(w, "# HELP schemapin_server_verifications_total Completed verifications, by kind, result and error code.")
+	fmt.Fprintln(w, "# TYPE schemapin_server_verifications_total counter")
+	verifications := make([]verificationLabels, 0, len(m.verifications))
+	for labels := range m.verifications {
+		verifications = append(verifications, labels)
+	}
+	sort.Slice(verifications, func(i, j int) bool {
+		a, b := verifications[i], verifications[j]
+		if a.kind != b.kind {
+			return a.kind < b.kind
+		}
+		if a.result != b.result {
+			return a.result < b.result
+		}
+		return a.errorCode < b.errorCode
+	})
+	for _, labels := range verifications {
+		fmt.Fprintf(w, "schemapin_server_verifications_total{kind=%q,result=%q,error_code=%q} %d\n",
+			labels.kind, labels.result, labels.errorCode, m.verifications[labels])
+	}
+
+	for _, counter := range []struct {
+		name, help string
+		value      int64
+	}{
+		{"schemapin_discovery_rate_limited_total", "Discovery requests refused by the rate limiter.", stats.RateLimited},
+		{"schemapin_discovery_rate_limit_delayed_total", "Discovery requests delayed by the rate limiter.", stats.RateLimitDelayed},
+		{"schemapin_discovery_circuit_rejected_total", "Discovery requests refused by an open circuit.", stats.CircuitRejected},
+		{"schemapin_discovery_circuit_opened_total", "Discovery circuits opened.", stats.CircuitOpened},
+		{"schemapin_discovery_circuit_closed_total", "Discovery circuits closed after a successful trial.", stats.CircuitClosed},
+	} {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", counter.name, counter.help, counter.name, counter.name, counter.value)
+	}
+}
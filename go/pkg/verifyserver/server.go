@@ -0,0 +1,589 @@
+// Package verifyserver serves schema and skill verification over HTTP, so
+// that services in any language can verify against one shared pinning
+// database and discovery cache, e.g. as a sidecar:
+//
+//	srv := verifyserver.New(workflow, keyPinning, verifyserver.Options{
+//	    Token: os.Getenv("SCHEMAPIN_SERVER_TOKEN"),
+//	})
+//	http.ListenAndServe("127.0.0.1:8787", srv)
+//
+// The endpoints are:
+//
+//	POST   /v1/verify/schema     verify a signed schema (JSON)
+//	POST   /v1/verify/skill      verify a skill archive (multipart) or a
+//	                             local skill directory (JSON)
+//	GET    /v1/pins              list pinned keys
+//	GET    /v1/pins/export       export pinned keys
+//	DELETE /v1/pins/{tool_id}    remove a pinned key
+//	GET    /v1/decisions         list first-use decisions awaiting an
+//	                             answer (see utils.WithQueuedDecisions)
+//	POST   /v1/decisions/{id}    answer a pending decision
+//	GET    /healthz              liveness, never authenticated
+//	GET    /metrics              counters in the Prometheus text format
+//
+// A completed verification is answered with 200 and its result, valid or
+// not; the result's error code says why it failed. Requests rejected
+// before verification get a 4xx httpmw.ErrorResponse.
+//
+// With a workflow queuing its decisions, a schema whose key needs the
+// user's approval fails with DECISION_PENDING and a pending_decision_id.
+// A dashboard lists the decisions, answers one with a body such as
+// {"decision": "accept"}, and the next verification of the tool applies
+// the answer.
+package verifyserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ThirdKeyAi/schemapin/go/internal/logging"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/httpmw"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/pinning"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/requestid"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/resolver"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/skill"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/utils"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+// DefaultMaxArchiveBytes is the skill archive size limit when
+// Options.MaxArchiveBytes is zero.
+const DefaultMaxArchiveBytes = 32 << 20
+
+// DefaultRequestTimeout bounds each request when Options.RequestTimeout is
+// zero.
+const DefaultRequestTimeout = 30 * time.Second
+
+// Error codes for requests rejected before verification, in addition to
+// the httpmw codes.
+const (
+	ErrUnauthorized       = "UNAUTHORIZED"
+	ErrNotFound           = "NOT_FOUND"
+	ErrMethodNotAllowed   = "METHOD_NOT_ALLOWED"
+	ErrLocalPathsDisabled = "LOCAL_PATHS_DISABLED"
+	ErrDecisionResolved   = "DECISION_RESOLVED"
+	ErrInvalidDecision    = "INVALID_DECISION"
+	ErrInternal           = "INTERNAL_ERROR"
+)
+
+// Options configures a Server. The zero value serves without
+// authentication, verifies skills against live .well-known discovery and
+// never pins keys on first use.
+type Options struct {
+	// Token, if set, is required as "Authorization: Bearer <token>" on
+	// every endpoint except /healthz.
+	Token string
+	// Resolver resolves the signing keys of skills. Defaults to
+	// .well-known discovery cached for five minutes across requests.
+	// Schemas are resolved by the workflow.
+	Resolver resolver.SchemaResolver
+	// TrustBoundary rejects skills signed for domains outside it. Schemas
+	// are checked by the workflow (see utils.WithTrustBoundary).
+	TrustBoundary *pinning.TrustBoundary
+	// Policy and ContentPolicy configure skill verification (see
+	// skill.VerifyOptions). The schema policy is the workflow's.
+	Policy        *verification.Policy
+	ContentPolicy *verification.ContentPolicy
+	// AutoPin pins keys on first use unless a request says otherwise.
+	AutoPin bool
+	// LocalRoot, if set, lets JSON skill requests name a skill directory
+	// by path. Relative paths are resolved against it and no path may
+	// leave it. Empty rejects such requests, e.g. when the server is not
+	// a sidecar sharing the caller's filesystem.
+	LocalRoot string
+	// MaxBodyBytes limits JSON request bodies. Defaults to
+	// httpmw.DefaultMaxBodyBytes.
+	MaxBodyBytes int64
+	// MaxArchiveBytes limits skill archive uploads. Defaults to
+	// DefaultMaxArchiveBytes.
+	MaxArchiveBytes int64
+	// RequestTimeout bounds the context of each request, and so schema
+	// discovery. Skill discovery is bounded by the resolver's own
+	// timeout. Defaults to DefaultRequestTimeout.
+	RequestTimeout time.Duration
+	// Logger receives one record per request. Defaults to discarding.
+	Logger *slog.Logger
+}
+
+// Server is an http.Handler serving verification requests. It is safe for
+// concurrent use; every request shares its workflow, pinning database and
+// discovery cache.
+type Server struct {
+	workflow *utils.SchemaVerificationWorkflow
+	pinning  *pinning.KeyPinning
+	opts     Options
+	logger   *slog.Logger
+	mux      *http.ServeMux
+	metrics  *metrics
+}
+
+// New returns a Server verifying schemas with workflow and managing the
+// pins of keyPinning, which should be the database workflow was created
+// with. The caller closes both after the server has stopped.
+func New(workflow *utils.SchemaVerificationWorkflow, keyPinning *pinning.KeyPinning, opts Options) *Server {
+	if opts.Resolver == nil {
+		opts.Resolver = resolver.NewCachingResolver(resolver.NewWellKnownResolver(discoveryOptions(opts)...), 5*time.Minute)
+	}
+	if opts.MaxBodyBytes <= 0 {
+		opts.MaxBodyBytes = httpmw.DefaultMaxBodyBytes
+	}
+	if opts.MaxArchiveBytes <= 0 {
+		opts.MaxArchiveBytes = DefaultMaxArchiveBytes
+	}
+	if opts.RequestTimeout <= 0 {
+		opts.RequestTimeout = DefaultRequestTimeout
+	}
+	s := &Server{
+		workflow: workflow,
+		pinning:  keyPinning,
+		opts:     opts,
+		logger:   logging.OrDiscard(opts.Logger),
+		mux:      http.NewServeMux(),
+		metrics:  newMetrics(),
+	}
+	s.mux.HandleFunc("/v1/verify/schema", s.handleVerifySchema)
+	s.mux.HandleFunc("/v1/verify/skill", s.handleVerifySkill)
+	s.mux.HandleFunc("/v1/pins", s.handleListPins)
+	s.mux.HandleFunc("/v1/pins/", s.handlePin)
+	s.mux.HandleFunc("/v1/decisions", s.handleListDecisions)
+	s.mux.HandleFunc("/v1/decisions/", s.handleResolveDecision)
+	s.mux.HandleFunc("/healthz", s.handleHealth)
+	s.mux.HandleFunc("/metrics", s.handleMetrics)
+	s.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, ErrNotFound, fmt.Sprintf("no endpoint %s", r.URL.Path))
+	})
+	return s
+}
+
+// ServeHTTP authenticates r, bounds it by the request timeout and passes
+// it to the endpoint. The request ID from the requestid.Header header, or
+// a new one, is carried through verification and echoed in the response.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	ctx := r.Context()
+	if id := r.Header.Get(requestid.Header); id != "" {
+		ctx = requestid.NewContext(ctx, id)
+	}
+	ctx, id := requestid.Ensure(ctx)
+	ctx, cancel := context.WithTimeout(ctx, s.opts.RequestTimeout)
+	defer cancel()
+	r = r.WithContext(ctx)
+	w.Header().Set(requestid.Header, id)
+
+	recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	if r.URL.Path != "/healthz" && !s.authorized(r) {
+		recorder.Header().Set("WWW-Authenticate", `Bearer realm="schemapin"`)
+		writeError(recorder, http.StatusUnauthorized, ErrUnauthorized, "missing or invalid bearer token")
+	} else {
+		s.mux.ServeHTTP(recorder, r)
+	}
+
+	endpoint := endpointName(r.URL.Path)
+	duration := time.Since(start)
+	s.metrics.observeRequest(endpoint, recorder.status, duration)
+	s.logger.InfoContext(ctx, "request served",
+		"method", r.Method,
+		"endpoint", endpoint,
+		"status", recorder.status,
+		logging.KeyRequestID, id,
+		logging.KeyDuration, duration)
+}
+
+// authorized reports whether r carries the configured bearer token.
+func (s *Server) authorized(r *http.Request) bool {
+	if s.opts.Token == "" {
+		return true
+	}
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimSpace(token)), []byte(s.opts.Token)) == 1
+}
+
+// SchemaRequest is the body of POST /v1/verify/schema.
+type SchemaRequest struct {
+	Schema    map[string]interface{} `json:"schema"`
+	Signature string                 `json:"signature"`
+	// Signatures is the signatures array of a multi-signature schema,
+	// verified in place of Signature when it has entries (see
+	// utils.WithRequiredSignatures).
+	Signatures []verification.SignatureEntry `json:"signatures,omitempty"`
+	// SignedAt is the signed_at of the signature, checked against the
+	// domain's minimum_signed_at and the server's maximum signature age
+	// (see utils.WithMaxSignatureAge).
+	SignedAt string         `json:"signed_at,omitempty"`
+	ToolID   string         `json:"tool_id"`
+	Domain   string         `json:"domain"`
+	Options  RequestOptions `json:"options"`
+}
+
+// RequestOptions override the server's configuration for one request.
+type RequestOptions struct {
+	// AutoPin, when set, replaces Options.AutoPin.
+	AutoPin *bool `json:"auto_pin,omitempty"`
+	// Offline verifies schemas against pinned keys only, without
+	// discovery (see utils.WithOfflineMode).
+	Offline *bool `json:"offline,omitempty"`
+	// Reconsider lets a previously rejected key be pinned again (see
+	// utils.VerifyRequest).
+	Reconsider bool `json:"reconsider,omitempty"`
+}
+
+func (o RequestOptions) autoPin(def bool) bool {
+	if o.AutoPin != nil {
+		return *o.AutoPin
+	}
+	return def
+}
+
+func (s *Server) handleVerifySchema(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	var req SchemaRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+	switch {
+	case req.Schema == nil:
+		writeError(w, http.StatusBadRequest, httpmw.ErrMalformedUpload, "request has no schema")
+		return
+	case req.Signature == "" && len(req.Signatures) == 0:
+		writeError(w, http.StatusBadRequest, httpmw.ErrMissingSignature, "request has no signature")
+		return
+	case req.ToolID == "":
+		writeError(w, http.StatusBadRequest, httpmw.ErrMissingToolID, "request has no tool ID")
+		return
+	case req.Domain == "":
+		writeError(w, http.StatusBadRequest, httpmw.ErrMissingDomain, "request has no domain")
+		return
+	}
+
+	result, err := s.workflow.VerifySchemaWithOptions(r.Context(), utils.VerifyRequest{
+		Schema:     req.Schema,
+		Signature:  req.Signature,
+		Signatures: req.Signatures,
+		SignedAt:   req.SignedAt,
+		ToolID:     req.ToolID,
+		Domain:     req.Domain,
+		AutoPin:    req.Options.autoPin(s.opts.AutoPin),
+		Offline:    req.Options.Offline,
+		Reconsider: req.Options.Reconsider,
+	})
+	if err != nil {
+		s.logger.ErrorContext(r.Context(), "schema verification could not be completed", logging.KeyError, err)
+		writeError(w, http.StatusInternalServerError, utils.ErrVerificationFailed, "verification could not be completed")
+		return
+	}
+	s.metrics.observeVerification("schema", result.Valid, result.ErrorCode)
+	writeJSON(w, http.StatusOK, result)
+}
+
+// SkillRequest is the JSON body of POST /v1/verify/skill, naming a skill
+// directory under Options.LocalRoot. Archives are uploaded as
+// multipart/form-data instead, in an "archive" file part with an optional
+// "tool_id" field.
+type SkillRequest struct {
+	Path    string         `json:"path"`
+	ToolID  string         `json:"tool_id,omitempty"`
+	Options RequestOptions `json:"options"`
+}
+
+func (s *Server) handleVerifySkill(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodPost) {
+		return
+	}
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	var (
+		result *verification.VerificationResult
+		ok     bool
+	)
+	switch mediaType {
+	case "multipart/form-data":
+		result, ok = s.verifySkillUpload(w, r)
+	case "application/json":
+		result, ok = s.verifySkillPath(w, r)
+	default:
+		writeError(w, http.StatusUnsupportedMediaType, httpmw.ErrUnsupportedMedia, "expected multipart/form-data or application/json")
+		return
+	}
+	if !ok {
+		return
+	}
+	s.metrics.observeVerification("skill", result.Valid, string(result.ErrorCode))
+	writeJSON(w, http.StatusOK, result)
+}
+
+// verifySkillPath verifies the local skill directory named by a JSON
+// request.
+func (s *Server) verifySkillPath(w http.ResponseWriter, r *http.Request) (*verification.VerificationResult, bool) {
+	if s.opts.LocalRoot == "" {
+		writeError(w, http.StatusForbidden, ErrLocalPathsDisabled, "local skill paths are not enabled on this server")
+		return nil, false
+	}
+	var req SkillRequest
+	if !s.decodeJSON(w, r, &req) {
+		return nil, false
+	}
+	if req.Path == "" {
+		writeError(w, http.StatusBadRequest, httpmw.ErrMalformedUpload, "request has no path")
+		return nil, false
+	}
+	dir, err := resolveLocalPath(s.opts.LocalRoot, req.Path)
+	if err != nil {
+		writeError(w, http.StatusForbidden, ErrLocalPathsDisabled, err.Error())
+		return nil, false
+	}
+	return s.skillResult(w, r)(s.verifySkillDir(dir, req.ToolID, req.Options.autoPin(s.opts.AutoPin)))
+}
+
+// resolveLocalPath resolves path against root, refusing paths outside it.
+// Symbolic links in both are resolved first, so that a link under root
+// cannot lead outside it; a path that does not resolve is refused.
+func resolveLocalPath(root, path string) (string, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return "", fmt.Errorf("local root does not resolve: %w", err)
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Clean(path))
+	if err != nil {
+		return "", fmt.Errorf("skill path %s does not resolve", path)
+	}
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("skill path %s is outside %s", path, root)
+	}
+	return resolved, nil
+}
+
+// verifySkillUpload verifies the skill archive uploaded in a multipart
+// request.
+func (s *Server) verifySkillUpload(w http.ResponseWriter, r *http.Request) (*verification.VerificationResult, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, s.opts.MaxArchiveBytes)
+	parts, err := r.MultipartReader()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, httpmw.ErrMalformedUpload, fmt.Sprintf("invalid multipart body: %v", err))
+		return nil, false
+	}
+
+	var (
+		archive  []byte
+		filename string
+		toolID   string
+		autoPin  = s.opts.AutoPin
+	)
+	for {
+		part, err := parts.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			s.writeReadError(w, err, s.opts.MaxArchiveBytes)
+			return nil, false
+		}
+		data, err := io.ReadAll(part)
+		if err != nil {
+			s.writeReadError(w, err, s.opts.MaxArchiveBytes)
+			return nil, false
+		}
+		switch part.FormName() {
+		case "archive":
+			archive, filename = data, part.FileName()
+		case "tool_id":
+			toolID = string(data)
+		case "auto_pin":
+			autoPin = string(data) == "true"
+		}
+	}
+	if archive == nil {
+		writeError(w, http.StatusBadRequest, httpmw.ErrMalformedUpload, `request has no "archive" part`)
+		return nil, false
+	}
+	format, err := skill.DetectArchiveFormat(filename)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, httpmw.ErrMalformedUpload, err.Error())
+		return nil, false
+	}
+	return s.skillResult(w, r)(s.verifySkillArchive(archive, format, toolID, autoPin))
+}
+
+// skillResult returns a function passing on a skill verification result,
+// or answering the request with 500 if verification could not be
+// completed.
+func (s *Server) skillResult(w http.ResponseWriter, r *http.Request) func(*verification.VerificationResult, error) (*verification.VerificationResult, bool) {
+	return func(result *verification.VerificationResult, err error) (*verification.VerificationResult, bool) {
+		if err != nil {
+			s.logger.ErrorContext(r.Context(), "skill verification could not be completed", logging.KeyError, err)
+			writeError(w, http.StatusInternalServerError, utils.ErrVerificationFailed, "verification could not be completed")
+			return nil, false
+		}
+		return result, true
+	}
+}
+
+func (s *Server) handleListPins(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	pins, err := s.pinning.ListPinnedKeyInfo()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrInternal, fmt.Sprintf("failed to list pinned keys: %v", err))
+		return
+	}
+	if pins == nil {
+		pins = []pinning.PinnedKeyInfo{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"pins": pins})
+}
+
+// handlePin serves GET /v1/pins/export and DELETE /v1/pins/{tool_id}.
+func (s *Server) handlePin(w http.ResponseWriter, r *http.Request) {
+	toolID := strings.TrimPrefix(r.URL.Path, "/v1/pins/")
+	if toolID == "export" {
+		if !allowMethod(w, r, http.MethodGet) {
+			return
+		}
+		exported, err := s.pinning.ExportPinnedKeys()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, ErrInternal, fmt.Sprintf("failed to export pinned keys: %v", err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = io.WriteString(w, exported)
+		return
+	}
+
+	if !allowMethod(w, r, http.MethodDelete) {
+		return
+	}
+	info, err := s.pinning.GetKeyInfo(toolID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ErrInternal, fmt.Sprintf("failed to read pinned key: %v", err))
+		return
+	}
+	if info == nil {
+		writeError(w, http.StatusNotFound, ErrNotFound, fmt.Sprintf("no key is pinned for tool %s", toolID))
+		return
+	}
+	if err := s.workflow.RemovePinnedKey(toolID); err != nil {
+		writeError(w, http.StatusInternalServerError, ErrInternal, fmt.Sprintf("failed to remove pinned key: %v", err))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet, http.MethodHead) {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if !allowMethod(w, r, http.MethodGet) {
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	s.metrics.write(w, s.workflow.DiscoveryProtectionStats())
+}
+
+// decodeJSON decodes the JSON body of r into v, answering the request
+// itself on failure.
+func (s *Server) decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/json" {
+		writeError(w, http.StatusUnsupportedMediaType, httpmw.ErrUnsupportedMedia, "expected application/json")
+		return false
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, s.opts.MaxBodyBytes))
+	if err != nil {
+		s.writeReadError(w, err, s.opts.MaxBodyBytes)
+		return false
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		writeError(w, http.StatusBadRequest, httpmw.ErrMalformedUpload, fmt.Sprintf("invalid JSON request: %v", err))
+		return false
+	}
+	return true
+}
+
+// writeReadError answers a request whose body could not be read.
+func (s *Server) writeReadError(w http.ResponseWriter, err error, limit int64) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(w, http.StatusRequestEntityTooLarge, httpmw.ErrBodyTooLarge, fmt.Sprintf("body exceeds %d bytes", limit))
+		return
+	}
+	writeError(w, http.StatusBadRequest, httpmw.ErrMalformedUpload, fmt.Sprintf("failed to read body: %v", err))
+}
+
+// allowMethod reports whether r uses one of methods, answering it with 405
+// otherwise.
+func allowMethod(w http.ResponseWriter, r *http.Request, methods ...string) bool {
+	for _, method := range methods {
+		if r.Method == method {
+			return true
+		}
+	}
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	writeError(w, http.StatusMethodNotAllowed, ErrMethodNotAllowed, fmt.Sprintf("method %s not allowed", r.Method))
+	return false
+}
+
+// endpointName is the metrics label for a request path.
+func endpointName(path string) string {
+	switch {
+	case path == "/v1/verify/schema":
+		return "verify_schema"
+	case path == "/v1/verify/skill":
+		return "verify_skill"
+	case path == "/v1/pins" || strings.HasPrefix(path, "/v1/pins/"):
+		return "pins"
+	case path == "/v1/decisions" || strings.HasPrefix(path, "/v1/decisions/"):
+		return "decisions"
+	case path == "/healthz":
+		return "healthz"
+	case path == "/metrics":
+		return "metrics"
+	default:
+		return "other"
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, httpmw.ErrorResponse{ErrorCode: code, Error: message})
+}
+
+// statusRecorder records the status written through a ResponseWriter.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
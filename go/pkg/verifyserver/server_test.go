@@ -0,0 +1,512 @@
+package verifyserver
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/httpmw"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/interactive"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/pinning"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/skill"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/utils"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+const testToken = "s3cret"
+
+// serverFixture is a verification server backed by a discovery server
+// publishing the fixture key, which can be revoked mid-test.
+type serverFixture struct {
+	server      *httptest.Server
+	keyPinning  *pinning.KeyPinning
+	domain      string
+	fingerprint string
+	schema      map[string]interface{}
+	signature   string
+	skillsRoot  string
+	skillDir    string
+	archive     []byte
+	revoked     atomic.Bool
+}
+
+func newServerFixture(t *testing.T, opts Options, workflowOpts ...utils.WorkflowOption) *serverFixture {
+	t.Helper()
+	privateKeyPEM, publicKeyPEM, err := utils.GenerateKeyPair()
+	if err != nil {
+		t.Fatalf("Failed to generate key pair: %v", err)
+	}
+	f := &serverFixture{schema: map[string]interface{}{"type": "object", "description": "search tool"}}
+	if f.fingerprint, err = crypto.NewKeyManager().CalculateKeyFingerprintFromPEM(publicKeyPEM); err != nil {
+		t.Fatalf("Failed to fingerprint key: %v", err)
+	}
+	discoveryServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var revokedKeys []string
+		if f.revoked.Load() {
+			revokedKeys = []string{f.fingerprint}
+		}
+		_ = json.NewEncoder(w).Encode(utils.CreateWellKnownResponse(publicKeyPEM, "Search Corp", "", revokedKeys, "1.2", ""))
+	}))
+	t.Cleanup(discoveryServer.Close)
+	f.domain = discoveryServer.URL
+
+	signer, err := utils.NewSchemaSigningWorkflow(privateKeyPEM)
+	if err != nil {
+		t.Fatalf("Failed to create signing workflow: %v", err)
+	}
+	if f.signature, err = signer.SignSchema(f.schema); err != nil {
+		t.Fatalf("Failed to sign schema: %v", err)
+	}
+
+	f.skillsRoot = t.TempDir()
+	f.skillDir = filepath.Join(f.skillsRoot, "search")
+	if err := os.MkdirAll(f.skillDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{"SKILL.md": "# Search\n", "run.sh": "echo search\n"}
+	for name, body := range files {
+		if err := os.WriteFile(filepath.Join(f.skillDir, name), []byte(body), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := skill.SignSkill(f.skillDir, privateKeyPEM, f.domain, "", "search"); err != nil {
+		t.Fatalf("Failed to sign skill: %v", err)
+	}
+	f.archive = zipDir(t, f.skillDir, nil)
+
+	f.keyPinning, err = pinning.NewKeyPinning(filepath.Join(t.TempDir(), "pins.db"), pinning.PinningModeInteractive, nil)
+	if err != nil {
+		t.Fatalf("Failed to open pinning database: %v", err)
+	}
+	workflow := utils.NewSchemaVerificationWorkflowWithPinning(f.keyPinning, workflowOpts...)
+	t.Cleanup(func() { workflow.Close() })
+
+	opts.Token, opts.LocalRoot = testToken, f.skillsRoot
+	f.server = httptest.NewServer(New(workflow, f.keyPinning, opts))
+	t.Cleanup(f.server.Close)
+	return f
+}
+
+// zipDir packs the files of dir, including its signature, into a zip,
+// with the contents of any files named in replace replaced.
+func zipDir(t *testing.T, dir string, replace map[string]string) []byte {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if body, ok := replace[entry.Name()]; ok {
+			data = []byte(body)
+		}
+		w, err := zw.Create(entry.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// do sends an authenticated request and returns the response with its body
+// read.
+func (f *serverFixture) do(t *testing.T, method, path, contentType string, body []byte) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(method, f.server.URL+path, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, data
+}
+
+func (f *serverFixture) schemaRequest(t *testing.T, toolID string, autoPin bool) []byte {
+	t.Helper()
+	body, err := json.Marshal(SchemaRequest{
+		Schema: f.schema, Signature: f.signature, ToolID: toolID, Domain: f.domain,
+		Options: RequestOptions{AutoPin: &autoPin},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+// uploadArchive posts archive as a multipart skill upload.
+func (f *serverFixture) uploadArchive(t *testing.T, archive []byte, toolID string) (*http.Response, []byte) {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("archive", "search.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = part.Write(archive)
+	if toolID != "" {
+		_ = mw.WriteField("tool_id", toolID)
+	}
+	_ = mw.Close()
+	return f.do(t, http.MethodPost, "/v1/verify/skill", mw.FormDataContentType(), body.Bytes())
+}
+
+func TestVerifySchemaEndpoint(t *testing.T) {
+	f := newServerFixture(t, Options{})
+
+	resp, body := f.do(t, http.MethodPost, "/v1/verify/schema", "application/json", f.schemaRequest(t, "search", true))
+	var result utils.VerificationResult
+	if err := json.Unmarshal(body, &result); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 with a result, got %d %s", resp.StatusCode, body)
+	}
+	if !result.Valid || !result.FirstUse || !result.Pinned {
+		t.Fatalf("Expected a valid first use that pinned the key, got %s", body)
+	}
+	if resp.Header.Get("X-SchemaPin-Request-ID") != result.Metadata["request_id"] {
+		t.Errorf("Expected the response to echo request ID %v, got %q", result.Metadata["request_id"], resp.Header.Get("X-SchemaPin-Request-ID"))
+	}
+
+	// A schema signed only through the signatures array
+	signed, err := json.Marshal(SchemaRequest{
+		Schema: f.schema, Signatures: []verification.SignatureEntry{{SignerKid: f.fingerprint, Signature: f.signature}},
+		ToolID: "search", Domain: f.domain,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, body = f.do(t, http.MethodPost, "/v1/verify/schema", "application/json", signed)
+	result = utils.VerificationResult{}
+	if err := json.Unmarshal(body, &result); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 with a result, got %d %s", resp.StatusCode, body)
+	}
+	if signers, _ := result.Metadata["signers"].([]interface{}); !result.Valid || len(signers) != 1 || signers[0] != f.fingerprint {
+		t.Errorf("Expected a valid result signed by %s, got %s", f.fingerprint, body)
+	}
+
+	// Revoked after pinning
+	f.revoked.Store(true)
+	resp, body = f.do(t, http.MethodPost, "/v1/verify/schema", "application/json", f.schemaRequest(t, "search", true))
+	result = utils.VerificationResult{}
+	if err := json.Unmarshal(body, &result); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 with a result, got %d %s", resp.StatusCode, body)
+	}
+	if result.Valid || result.ErrorCode != utils.ErrKeyRevoked {
+		t.Errorf("Expected %s, got %s", utils.ErrKeyRevoked, body)
+	}
+}
+
+func TestVerifySkillEndpoint(t *testing.T) {
+	f := newServerFixture(t, Options{})
+	tampered := zipDir(t, f.skillDir, map[string]string{"run.sh": "echo hacked\n"})
+	path := func(p string) []byte {
+		body, _ := json.Marshal(SkillRequest{Path: p, Options: RequestOptions{AutoPin: new(bool)}})
+		return body
+	}
+	autoPinPath := func(p string) []byte {
+		autoPin := true
+		body, _ := json.Marshal(SkillRequest{Path: p, Options: RequestOptions{AutoPin: &autoPin}})
+		return body
+	}
+
+	// First use without auto-pin leaves the database alone
+	resp, body := f.uploadArchive(t, f.archive, "")
+	var result verification.VerificationResult
+	if err := json.Unmarshal(body, &result); err != nil || resp.StatusCode != http.StatusOK || !result.Valid {
+		t.Fatalf("Expected a valid archive, got %d %s", resp.StatusCode, body)
+	}
+	if info, _ := f.keyPinning.GetKeyInfo("search"); info != nil {
+		t.Fatalf("Expected no pin without auto-pin, got %+v", info)
+	}
+
+	// A link to a skill inside the root is followed, a link out of it is not
+	if err := os.Symlink(f.skillDir, filepath.Join(f.skillsRoot, "alias")); err != nil {
+		t.Fatal(err)
+	}
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "SKILL.md"), []byte("# Outside\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(f.skillsRoot, "escape")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		send          func() (*http.Response, []byte)
+		wantStatus    int
+		wantErrorCode string
+		wantPinStatus string
+	}{
+		{"path auto-pin", func() (*http.Response, []byte) {
+			return f.do(t, http.MethodPost, "/v1/verify/skill", "application/json", autoPinPath("search"))
+		}, http.StatusOK, "", "pinned"},
+		{"archive pinned", func() (*http.Response, []byte) { return f.uploadArchive(t, f.archive, "search") }, http.StatusOK, "", "pinned"},
+		{"absolute path", func() (*http.Response, []byte) {
+			return f.do(t, http.MethodPost, "/v1/verify/skill", "application/json", path(f.skillDir))
+		}, http.StatusOK, "", "pinned"},
+		{"tampered archive", func() (*http.Response, []byte) { return f.uploadArchive(t, tampered, "") }, http.StatusOK, string(verification.ErrSignatureInvalid), ""},
+		{"path outside root", func() (*http.Response, []byte) {
+			return f.do(t, http.MethodPost, "/v1/verify/skill", "application/json", path("../elsewhere"))
+		}, http.StatusForbidden, ErrLocalPathsDisabled, ""},
+		{"symlink inside root", func() (*http.Response, []byte) {
+			return f.do(t, http.MethodPost, "/v1/verify/skill", "application/json", path("alias"))
+		}, http.StatusOK, "", "pinned"},
+		{"symlink outside root", func() (*http.Response, []byte) {
+			return f.do(t, http.MethodPost, "/v1/verify/skill", "application/json", path("escape"))
+		}, http.StatusForbidden, ErrLocalPathsDisabled, ""},
+		{"missing path", func() (*http.Response, []byte) {
+			return f.do(t, http.MethodPost, "/v1/verify/skill", "application/json", path("missing"))
+		}, http.StatusForbidden, ErrLocalPathsDisabled, ""},
+		{"no archive", func() (*http.Response, []byte) {
+			return f.do(t, http.MethodPost, "/v1/verify/skill", "multipart/form-data; boundary=x", []byte("--x--\r\n"))
+		}, http.StatusBadRequest, httpmw.ErrMalformedUpload, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, body := tt.send()
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d %s", tt.wantStatus, resp.StatusCode, body)
+			}
+			var got struct {
+				Valid      bool                           `json:"valid"`
+				ErrorCode  string                         `json:"error_code"`
+				KeyPinning *verification.KeyPinningStatus `json:"key_pinning"`
+			}
+			if err := json.Unmarshal(body, &got); err != nil {
+				t.Fatalf("Expected a JSON body, got %s", body)
+			}
+			if got.ErrorCode != tt.wantErrorCode || got.Valid != (tt.wantErrorCode == "") {
+				t.Errorf("Expected error code %q, got %s", tt.wantErrorCode, body)
+			}
+			if tt.wantPinStatus != "" && (got.KeyPinning == nil || got.KeyPinning.Status != tt.wantPinStatus) {
+				t.Errorf("Expected pin status %q, got %s", tt.wantPinStatus, body)
+			}
+		})
+	}
+	if info, _ := f.keyPinning.GetKeyInfo("search"); info == nil || info.Provenance != pinning.ProvenanceDiscovery {
+		t.Errorf("Expected the skill key pinned from discovery, got %+v", info)
+	}
+
+	revokedFixture := newServerFixture(t, Options{})
+	revokedFixture.revoked.Store(true)
+	resp, body = revokedFixture.uploadArchive(t, revokedFixture.archive, "")
+	result = verification.VerificationResult{}
+	if err := json.Unmarshal(body, &result); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200 with a result, got %d %s", resp.StatusCode, body)
+	}
+	if result.Valid || result.ErrorCode != verification.ErrKeyRevoked {
+		t.Errorf("Expected %s, got %s", verification.ErrKeyRevoked, body)
+	}
+}
+
+func TestVerifySkillLocalPathsDisabled(t *testing.T) {
+	f := newServerFixture(t, Options{})
+	disabled := httptest.NewServer(New(utils.NewSchemaVerificationWorkflowWithPinning(f.keyPinning), f.keyPinning, Options{}))
+	defer disabled.Close()
+
+	resp, err := http.Post(disabled.URL+"/v1/verify/skill", "application/json", strings.NewReader(`{"path": "`+f.skillDir+`"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var failure httpmw.ErrorResponse
+	if err := json.NewDecoder(resp.Body).Decode(&failure); err != nil || resp.StatusCode != http.StatusForbidden || failure.ErrorCode != ErrLocalPathsDisabled {
+		t.Errorf("Expected 403 %s, got %d %+v", ErrLocalPathsDisabled, resp.StatusCode, failure)
+	}
+}
+
+func TestPinEndpoints(t *testing.T) {
+	f := newServerFixture(t, Options{})
+	if resp, body := f.do(t, http.MethodPost, "/v1/verify/schema", "application/json", f.schemaRequest(t, "search", true)); resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected the schema verified, got %d %s", resp.StatusCode, body)
+	}
+
+	resp, body := f.do(t, http.MethodGet, "/v1/pins", "", nil)
+	var list struct {
+		Pins []pinning.PinnedKeyInfo `json:"pins"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil || resp.StatusCode != http.StatusOK || len(list.Pins) != 1 || list.Pins[0].ToolID != "search" {
+		t.Fatalf("Expected one pin for search, got %d %s", resp.StatusCode, body)
+	}
+
+	resp, body = f.do(t, http.MethodGet, "/v1/pins/export", "", nil)
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), `"search"`) {
+		t.Errorf("Expected an export with the search pin, got %d %s", resp.StatusCode, body)
+	}
+
+	if resp, body = f.do(t, http.MethodDelete, "/v1/pins/search", "", nil); resp.StatusCode != http.StatusNoContent {
+		t.Errorf("Expected 204, got %d %s", resp.StatusCode, body)
+	}
+	if resp, body = f.do(t, http.MethodDelete, "/v1/pins/search", "", nil); resp.StatusCode != http.StatusNotFound || !strings.Contains(string(body), ErrNotFound) {
+		t.Errorf("Expected 404 %s, got %d %s", ErrNotFound, resp.StatusCode, body)
+	}
+	if resp, _ = f.do(t, http.MethodGet, "/v1/pins/search", "", nil); resp.StatusCode != http.StatusMethodNotAllowed || resp.Header.Get("Allow") != http.MethodDelete {
+		t.Errorf("Expected 405 allowing DELETE, got %d %q", resp.StatusCode, resp.Header.Get("Allow"))
+	}
+}
+
+func TestDecisionEndpoints(t *testing.T) {
+	f := newServerFixture(t, Options{}, utils.WithQueuedDecisions(nil))
+	verify := func() utils.VerificationResult {
+		t.Helper()
+		resp, body := f.do(t, http.MethodPost, "/v1/verify/schema", "application/json", f.schemaRequest(t, "search", true))
+		var result utils.VerificationResult
+		if err := json.Unmarshal(body, &result); err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected 200 with a result, got %d %s", resp.StatusCode, body)
+		}
+		return result
+	}
+
+	result := verify()
+	if result.Valid || result.ErrorCode != utils.ErrDecisionPending || result.PendingDecisionID == "" {
+		t.Fatalf("Expected %s with a pending decision ID, got %+v", utils.ErrDecisionPending, result)
+	}
+	resp, body := f.do(t, http.MethodGet, "/v1/decisions", "", nil)
+	var list struct {
+		Pending []interactive.PendingDecision `json:"pending"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil || resp.StatusCode != http.StatusOK || len(list.Pending) != 1 || list.Pending[0].ID != result.PendingDecisionID {
+		t.Fatalf("Expected the pending decision listed, got %d %s", resp.StatusCode, body)
+	}
+	if list.Pending[0].Prompt.NewKey == nil || list.Pending[0].Prompt.NewKey.Fingerprint != f.fingerprint {
+		t.Errorf("Expected the listing to show the new key, got %s", body)
+	}
+
+	path := "/v1/decisions/" + result.PendingDecisionID
+	if resp, body = f.do(t, http.MethodPost, path, "application/json", []byte(`{"decision":"maybe"}`)); resp.StatusCode != http.StatusBadRequest || !strings.Contains(string(body), ErrInvalidDecision) {
+		t.Errorf("Expected 400 %s, got %d %s", ErrInvalidDecision, resp.StatusCode, body)
+	}
+	if resp, body = f.do(t, http.MethodPost, path, "application/json", []byte(`{"decision":"accept"}`)); resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("Expected 204, got %d %s", resp.StatusCode, body)
+	}
+	if resp, body = f.do(t, http.MethodPost, path, "application/json", []byte(`{"decision":"accept"}`)); resp.StatusCode != http.StatusConflict || !strings.Contains(string(body), ErrDecisionResolved) {
+		t.Errorf("Expected 409 %s, got %d %s", ErrDecisionResolved, resp.StatusCode, body)
+	}
+	if resp, body = f.do(t, http.MethodPost, "/v1/decisions/missing", "application/json", []byte(`{"decision":"accept"}`)); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d %s", resp.StatusCode, body)
+	}
+
+	if result = verify(); !result.Valid || !result.Pinned {
+		t.Errorf("Expected the accepted key to be pinned, got %+v", result)
+	}
+}
+
+func TestDecisionEndpointsNotQueued(t *testing.T) {
+	f := newServerFixture(t, Options{})
+	if resp, body := f.do(t, http.MethodGet, "/v1/decisions", "", nil); resp.StatusCode != http.StatusNotFound || !strings.Contains(string(body), ErrNotFound) {
+		t.Errorf("Expected 404 %s, got %d %s", ErrNotFound, resp.StatusCode, body)
+	}
+}
+
+func TestRequestRejections(t *testing.T) {
+	f := newServerFixture(t, Options{MaxBodyBytes: 512, MaxArchiveBytes: 256})
+	large := f.schemaRequest(t, strings.Repeat("x", 600), false)
+
+	tests := []struct {
+		name          string
+		method, path  string
+		token         string
+		contentType   string
+		body          []byte
+		wantStatus    int
+		wantErrorCode string
+	}{
+		{"no token", http.MethodGet, "/v1/pins", "", "", nil, http.StatusUnauthorized, ErrUnauthorized},
+		{"wrong token", http.MethodGet, "/v1/pins", "wrong", "", nil, http.StatusUnauthorized, ErrUnauthorized},
+		{"health without token", http.MethodGet, "/healthz", "", "", nil, http.StatusOK, ""},
+		{"unknown endpoint", http.MethodGet, "/v2/pins", testToken, "", nil, http.StatusNotFound, ErrNotFound},
+		{"wrong method", http.MethodGet, "/v1/verify/schema", testToken, "", nil, http.StatusMethodNotAllowed, ErrMethodNotAllowed},
+		{"wrong media type", http.MethodPost, "/v1/verify/schema", testToken, "text/plain", []byte("{}"), http.StatusUnsupportedMediaType, httpmw.ErrUnsupportedMedia},
+		{"body too large", http.MethodPost, "/v1/verify/schema", testToken, "application/json", large, http.StatusRequestEntityTooLarge, httpmw.ErrBodyTooLarge},
+		{"malformed", http.MethodPost, "/v1/verify/schema", testToken, "application/json", []byte("{"), http.StatusBadRequest, httpmw.ErrMalformedUpload},
+		{"no signature", http.MethodPost, "/v1/verify/schema", testToken, "application/json", []byte(`{"schema": {}, "tool_id": "t", "domain": "d"}`), http.StatusBadRequest, httpmw.ErrMissingSignature},
+		{"no domain", http.MethodPost, "/v1/verify/schema", testToken, "application/json", []byte(`{"schema": {}, "signature": "s", "tool_id": "t"}`), http.StatusBadRequest, httpmw.ErrMissingDomain},
+		{"archive too large", http.MethodPost, "/v1/verify/skill", testToken, "multipart/form-data; boundary=x",
+			append([]byte("--x\r\nContent-Disposition: form-data; name=\"archive\"; filename=\"a.zip\"\r\n\r\n"), bytes.Repeat([]byte("a"), 300)...),
+			http.StatusRequestEntityTooLarge, httpmw.ErrBodyTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, f.server.URL+tt.path, bytes.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("Expected status %d, got %d", tt.wantStatus, resp.StatusCode)
+			}
+			if tt.wantErrorCode == "" {
+				return
+			}
+			var failure httpmw.ErrorResponse
+			if err := json.NewDecoder(resp.Body).Decode(&failure); err != nil || failure.ErrorCode != tt.wantErrorCode {
+				t.Errorf("Expected error code %s, got %+v, %v", tt.wantErrorCode, failure, err)
+			}
+		})
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	f := newServerFixture(t, Options{})
+	f.do(t, http.MethodPost, "/v1/verify/schema", "application/json", f.schemaRequest(t, "search", false))
+	f.revoked.Store(true)
+	f.do(t, http.MethodPost, "/v1/verify/schema", "application/json", f.schemaRequest(t, "search", false))
+	f.do(t, http.MethodGet, "/v1/pins/missing", "", nil)
+
+	resp, body := f.do(t, http.MethodGet, "/metrics", "", nil)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", resp.StatusCode)
+	}
+	for _, want := range []string{
+		`schemapin_server_requests_total{endpoint="verify_schema",status="200"} 2`,
+		`schemapin_server_requests_total{endpoint="pins",status="405"} 1`,
+		`schemapin_server_verifications_total{kind="schema",result="valid",error_code=""} 1`,
+		`schemapin_server_verifications_total{kind="schema",result="invalid",error_code="` + utils.ErrKeyRevoked + `"} 1`,
+		`schemapin_discovery_circuit_rejected_total 0`,
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Errorf("Expected metrics to contain %s, got:\n%s", want, body)
+		}
+	}
+}
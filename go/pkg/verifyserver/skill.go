@@ -0,0 +1,156 @@
+package verifyserver
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/ThirdKeyAi/schemapin/go/pkg/crypto"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/discovery"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/pinning"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/resolver"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/revocation"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/skill"
+	"github.com/ThirdKeyAi/schemapin/go/pkg/verification"
+)
+
+// discoveryOptions configures the default skill resolver with the logger
+// and any TLS pins of the trust boundary.
+func discoveryOptions(opts Options) []discovery.Option {
+	var discoveryOpts []discovery.Option
+	if opts.Logger != nil {
+		discoveryOpts = append(discoveryOpts, discovery.WithLogger(opts.Logger))
+	}
+	if opts.TrustBoundary != nil && len(opts.TrustBoundary.TLSPins) > 0 {
+		discoveryOpts = append(discoveryOpts, discovery.WithTLSPins(opts.TrustBoundary.TLSPins))
+	}
+	return discoveryOpts
+}
+
+// skillVerifier runs one skill verification with the resolved discovery
+// document, revocation document and a pin store seeded from the database.
+type skillVerifier func(disc *discovery.WellKnownResponse, rev *revocation.RevocationDocument, pinStore *verification.KeyPinStore, toolID string) *verification.VerificationResult
+
+func (s *Server) skillOptions() skill.VerifyOptions {
+	return skill.VerifyOptions{Policy: s.opts.Policy, ContentPolicy: s.opts.ContentPolicy}
+}
+
+// verifySkillDir verifies the skill directory dir.
+func (s *Server) verifySkillDir(dir, toolID string, autoPin bool) (*verification.VerificationResult, error) {
+	sig, err := skill.LoadSignature(dir)
+	if err != nil {
+		return &verification.VerificationResult{
+			Valid:        false,
+			ErrorCode:    verification.ErrSignatureInvalid,
+			ErrorMessage: "No .schemapin.sig found in skill directory",
+		}, nil
+	}
+	return s.verifySkill(sig, toolID, autoPin, func(disc *discovery.WellKnownResponse, rev *revocation.RevocationDocument, pinStore *verification.KeyPinStore, toolID string) *verification.VerificationResult {
+		return skill.VerifySkillOfflineWithOptions(dir, disc, sig, rev, pinStore, toolID, s.skillOptions())
+	})
+}
+
+// verifySkillArchive verifies the skill archive data in format.
+func (s *Server) verifySkillArchive(data []byte, format skill.ArchiveFormat, toolID string, autoPin bool) (*verification.VerificationResult, error) {
+	r := bytes.NewReader(data)
+	sig, err := skill.LoadArchiveSignature(r, r.Size(), format)
+	if err != nil {
+		return &verification.VerificationResult{
+			Valid:        false,
+			ErrorCode:    verification.ErrSignatureInvalid,
+			ErrorMessage: fmt.Sprintf("No usable .schemapin.sig in skill archive: %v", err),
+		}, nil
+	}
+	return s.verifySkill(sig, toolID, autoPin, func(disc *discovery.WellKnownResponse, rev *revocation.RevocationDocument, pinStore *verification.KeyPinStore, toolID string) *verification.VerificationResult {
+		return skill.VerifySkillArchiveOfflineWithOptions(r, r.Size(), format, disc, sig, rev, pinStore, toolID, s.skillOptions())
+	})
+}
+
+// verifySkill resolves the signing key of sig and runs verify against the
+// key pinned in the database for the tool or a namespace it is under. A
+// valid skill whose tool has no pin has its key pinned when autoPin is set.
+func (s *Server) verifySkill(sig *skill.SkillSignature, toolID string, autoPin bool, verify skillVerifier) (*verification.VerificationResult, error) {
+	if toolID == "" {
+		toolID = sig.SkillName
+	}
+	if err := s.opts.TrustBoundary.Check(sig.Domain); err != nil {
+		return &verification.VerificationResult{
+			Valid:        false,
+			Domain:       sig.Domain,
+			ErrorCode:    verification.ErrDomainBlocked,
+			ErrorMessage: err.Error(),
+		}, nil
+	}
+
+	disc, source, err := resolver.ResolveDiscoveryWithSource(s.opts.Resolver, sig.Domain)
+	if err != nil {
+		return &verification.VerificationResult{
+			Valid:        false,
+			Domain:       sig.Domain,
+			ErrorCode:    verification.DiscoveryErrorCode(err),
+			ErrorMessage: fmt.Sprintf("failed to discover public key: %v", err),
+		}, nil
+	}
+	rev, _ := s.opts.Resolver.ResolveRevocation(sig.Domain, disc)
+
+	// The pin store only lives for this request; the database is the
+	// record of pinned keys
+	pinned, _, err := s.pinning.ResolvePin(toolID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pinned key: %w", err)
+	}
+	pinStore := verification.NewKeyPinStore()
+	if pinned != nil {
+		fingerprint := pinned.Fingerprint
+		if fingerprint == "" {
+			if fingerprint, err = crypto.NewKeyManager().CalculateKeyFingerprintFromPEM(pinned.PublicKeyPEM); err != nil {
+				return nil, fmt.Errorf("failed to fingerprint pinned key: %w", err)
+			}
+		}
+		pinStore.CheckAndPin(toolID, sig.Domain, fingerprint)
+	}
+
+	result := verify(disc, rev, pinStore, toolID)
+	if result.DiscoverySource == "" {
+		result.DiscoverySource = source
+	}
+	if pinned == nil && !autoPin {
+		// The request's pin store is discarded, so nothing was pinned
+		result.TrustDecision = ""
+	}
+	if !result.Valid || pinned != nil || !autoPin {
+		return result, nil
+	}
+	return result, s.pinSkillKey(result, disc, toolID, sig.Domain)
+}
+
+// pinSkillKey pins the key that verified a skill seen for the first time.
+// If another request pinned a different key for the tool in the meantime,
+// result fails with ErrKeyPinMismatch.
+func (s *Server) pinSkillKey(result *verification.VerificationResult, disc *discovery.WellKnownResponse, toolID, domain string) error {
+	publicKeyPEM, err := disc.PublicKey()
+	if err != nil {
+		return nil
+	}
+	fingerprint, err := crypto.NewKeyManager().CalculateKeyFingerprintFromPEM(publicKeyPEM)
+	if err != nil || !crypto.FingerprintEqual(fingerprint, result.KeyFingerprint) {
+		// Verified by another key of the published key set
+		return nil
+	}
+	existing, err := s.pinning.PinKeyIfAbsent(toolID, publicKeyPEM, domain, disc.DeveloperName,
+		pinning.PinOptions{Provenance: pinning.ProvenanceDiscovery, SourceDetail: discovery.ConstructWellKnownURL(domain)})
+	if err != nil {
+		return fmt.Errorf("failed to pin key: %w", err)
+	}
+	if existing != nil && !crypto.PublicKeyPEMEqual(existing.PublicKeyPEM, publicKeyPEM) {
+		result.Valid = false
+		result.ErrorCode = verification.ErrKeyPinMismatch
+		result.ErrorMessage = "Key fingerprint changed since last use"
+		return nil
+	}
+	result.KeyPinning = &verification.KeyPinningStatus{Status: string(verification.PinPinned)}
+	result.TrustDecision = verification.TrustDecisionAutoPinned
+	if existing != nil {
+		result.TrustDecision = verification.TrustDecisionPrePinned
+	}
+	return nil
+}